@@ -15,9 +15,15 @@ func newConfigureCmd() *cobra.Command {
 	var draftModel string
 	var numTokens int
 	var minAcceptanceRate float64
+	var truncation inference.TruncationConfig
+	var compression bool
+	var compressionModel string
+	var postProcessors []string
+	var systemPrompt inference.SystemPromptConfig
+	var classification inference.ClassificationConfig
 
 	c := &cobra.Command{
-		Use:    "configure [--context-size=<n>] [--speculative-draft-model=<model>] MODEL [-- <runtime-flags...>]",
+		Use:    "configure [--context-size=<n>] [--backend-version=<version>] [--speculative-draft-model=<model>] [--matryoshka-dimensions=<n,...>] [--truncation-strategy=<strategy>] MODEL [-- <runtime-flags...>]",
 		Short:  "Configure runtime options for a model",
 		Hidden: true,
 		Args: func(cmd *cobra.Command, args []string) error {
@@ -52,12 +58,49 @@ func newConfigureCmd() *cobra.Command {
 					MinAcceptanceRate: minAcceptanceRate,
 				}
 			}
+			if truncation.Strategy != "" {
+				opts.Truncation = &truncation
+			} else if truncation.Window != 0 || truncation.SummaryModel != "" {
+				return fmt.Errorf("--truncation-window and --truncation-summary-model require --truncation-strategy")
+			}
+			if compression || compressionModel != "" {
+				opts.Compression = &inference.CompressionConfig{Model: compressionModel}
+			}
+			for _, processor := range postProcessors {
+				opts.PostProcessors = append(opts.PostProcessors, inference.PostProcessor(processor))
+			}
+			if systemPrompt.Prompt != "" {
+				if systemPrompt.Mode == "" {
+					systemPrompt.Mode = inference.SystemPromptDefault
+				}
+				opts.SystemPrompt = &systemPrompt
+			} else if systemPrompt.Mode != "" || systemPrompt.Policy != "" {
+				return fmt.Errorf("--system-prompt-mode and --system-prompt-policy require --system-prompt")
+			}
+			if len(classification.Labels) > 0 || classification.MultiLabel {
+				opts.Classification = &classification
+			}
 			return desktopClient.ConfigureBackend(opts)
 		},
 		ValidArgsFunction: completion.ModelNames(getDesktopClient, -1),
 	}
 
 	c.Flags().Int64Var(&opts.ContextSize, "context-size", -1, "context size (in tokens)")
+	c.Flags().StringVar(&opts.BackendVersion, "backend-version", "", "llama.cpp version to pin the model to (defaults to the installed version)")
+	c.Flags().StringVar((*string)(&opts.KVCacheType), "kv-cache-type", "", "experimental KV cache quantization (int8 for llama.cpp, fp8 for vLLM)")
+	c.Flags().BoolVar(&opts.StrictContextSize, "strict-context-size", false, "fail to load the model if it doesn't fit in memory with the context size, rather than reducing the context size")
+	c.Flags().IntSliceVar(&opts.MatryoshkaDimensions, "matryoshka-dimensions", nil, "reduced embedding dimensions supported by a matryoshka embedding model")
+	c.Flags().StringVar((*string)(&truncation.Strategy), "truncation-strategy", "", "how to truncate conversations that exceed the context (drop-oldest, sliding-window, or summarize)")
+	c.Flags().IntVar(&truncation.Window, "truncation-window", 0, "number of most recent messages kept by the sliding-window truncation strategy")
+	c.Flags().StringVar(&truncation.SummaryModel, "truncation-summary-model", "", "model used by the summarize truncation strategy (defaults to the configured model)")
+	c.Flags().BoolVar(&compression, "prompt-compression", false, "compress the prompts of conversations that exceed the context before truncating them")
+	c.Flags().StringVar(&compressionModel, "prompt-compression-model", "", "model used to compress prompts, which enables prompt compression (defaults to the configured model)")
+	c.Flags().StringSliceVar(&postProcessors, "post-processors", nil, "post-processors applied in order to completions (strip-fences, repair-json, collapse-whitespace)")
+	c.Flags().StringVar(&systemPrompt.Prompt, "system-prompt", "", "system prompt injected into chat completion requests")
+	c.Flags().StringVar((*string)(&systemPrompt.Mode), "system-prompt-mode", "", "when the system prompt is injected (mandatory, default, or suggested)")
+	c.Flags().StringVar((*string)(&systemPrompt.Policy), "system-prompt-policy", "", "how a mandatory system prompt is combined with client system messages (merge or override)")
+	c.Flags().StringToStringVar(&classification.Labels, "classification-labels", nil, "labels of a classification model's outputs, by index or metadata label (e.g. 0=negative,1=positive)")
+	c.Flags().BoolVar(&classification.MultiLabel, "classification-multi-label", false, "score a classification model's labels independently rather than as mutually exclusive")
 	c.Flags().StringVar(&draftModel, "speculative-draft-model", "", "draft model for speculative decoding")
 	c.Flags().IntVar(&numTokens, "speculative-num-tokens", 0, "number of tokens to predict speculatively")
 	c.Flags().Float64Var(&minAcceptanceRate, "speculative-min-acceptance-rate", 0, "minimum acceptance rate for speculative decoding")
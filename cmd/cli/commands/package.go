@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/docker/model-runner/pkg/distribution/builder"
 	"github.com/docker/model-runner/pkg/distribution/distribution"
@@ -28,18 +29,19 @@ func newPackagedCmd() *cobra.Command {
 	var opts packageOptions
 
 	c := &cobra.Command{
-		Use:   "package (--gguf <path> | --safetensors-dir <path> | --from <model>) [--license <path>...] [--context-size <tokens>] [--push] MODEL",
-		Short: "Package a GGUF file, Safetensors directory, or existing model into a Docker model OCI artifact.",
-		Long: "Package a GGUF file, Safetensors directory, or existing model into a Docker model OCI artifact, with optional licenses. The package is sent to the model-runner, unless --push is specified.\n" +
+		Use:   "package (--gguf <path> | --safetensors-dir <path> | --onnx-dir <path> | --from <model>) [--license <path>...] [--context-size <tokens>] [--push] MODEL",
+		Short: "Package a GGUF file, Safetensors directory, ONNX directory, or existing model into a Docker model OCI artifact.",
+		Long: "Package a GGUF file, Safetensors directory, ONNX directory, or existing model into a Docker model OCI artifact, with optional licenses. The package is sent to the model-runner, unless --push is specified.\n" +
 			"When packaging a sharded GGUF model, --gguf should point to the first shard. All shard files should be siblings and should include the index in the file name (e.g. model-00001-of-00015.gguf).\n" +
 			"When packaging a Safetensors model, --safetensors-dir should point to a directory containing .safetensors files and config files (*.json, merges.txt). All files will be auto-discovered and config files will be packaged into a tar archive.\n" +
+			"When packaging an ONNX sequence classification model, --onnx-dir should point to a directory containing a single .onnx file, its tokenizer.json, and its config.json, whose id2label mapping provides the model's labels. Config files will be packaged into a tar archive.\n" +
 			"When packaging from an existing model using --from, you can modify properties like context size to create a variant of the original model.",
 		Args: func(cmd *cobra.Command, args []string) error {
 			if err := requireExactArgs(1, "package", "MODEL")(cmd, args); err != nil {
 				return err
 			}
 
-			// Validate that exactly one of --gguf, --safetensors-dir, or --from is provided (mutually exclusive)
+			// Validate that exactly one of --gguf, --safetensors-dir, --onnx-dir, or --from is provided (mutually exclusive)
 			sourcesProvided := 0
 			if opts.ggufPath != "" {
 				sourcesProvided++
@@ -47,19 +49,22 @@ func newPackagedCmd() *cobra.Command {
 			if opts.safetensorsDir != "" {
 				sourcesProvided++
 			}
+			if opts.onnxDir != "" {
+				sourcesProvided++
+			}
 			if opts.fromModel != "" {
 				sourcesProvided++
 			}
 
 			if sourcesProvided == 0 {
 				return fmt.Errorf(
-					"One of --gguf, --safetensors-dir, or --from is required.\n\n" +
+					"One of --gguf, --safetensors-dir, --onnx-dir, or --from is required.\n\n" +
 						"See 'docker model package --help' for more information",
 				)
 			}
 			if sourcesProvided > 1 {
 				return fmt.Errorf(
-					"Cannot specify more than one of --gguf, --safetensors-dir, or --from. Please use only one source.\n\n" +
+					"Cannot specify more than one of --gguf, --safetensors-dir, --onnx-dir, or --from. Please use only one source.\n\n" +
 						"See 'docker model package --help' for more information",
 				)
 			}
@@ -77,33 +82,20 @@ func newPackagedCmd() *cobra.Command {
 
 			// Validate safetensors directory if provided
 			if opts.safetensorsDir != "" {
-				if !filepath.IsAbs(opts.safetensorsDir) {
-					return fmt.Errorf(
-						"Safetensors directory path must be absolute.\n\n" +
-							"See 'docker model package --help' for more information",
-					)
+				dir, err := validateSourceDir("Safetensors", opts.safetensorsDir)
+				if err != nil {
+					return err
 				}
-				opts.safetensorsDir = filepath.Clean(opts.safetensorsDir)
+				opts.safetensorsDir = dir
+			}
 
-				// Check if it's a directory
-				info, err := os.Stat(opts.safetensorsDir)
+			// Validate ONNX directory if provided
+			if opts.onnxDir != "" {
+				dir, err := validateSourceDir("ONNX", opts.onnxDir)
 				if err != nil {
-					if os.IsNotExist(err) {
-						return fmt.Errorf(
-							"Safetensors directory does not exist: %s\n\n"+
-								"See 'docker model package --help' for more information",
-							opts.safetensorsDir,
-						)
-					}
-					return fmt.Errorf("could not access safetensors directory %q: %w", opts.safetensorsDir, err)
-				}
-				if !info.IsDir() {
-					return fmt.Errorf(
-						"Safetensors path must be a directory: %s\n\n"+
-							"See 'docker model package --help' for more information",
-						opts.safetensorsDir,
-					)
+					return err
 				}
+				opts.onnxDir = dir
 			}
 
 			for i, l := range opts.licensePaths {
@@ -142,6 +134,7 @@ func newPackagedCmd() *cobra.Command {
 
 	c.Flags().StringVar(&opts.ggufPath, "gguf", "", "absolute path to gguf file")
 	c.Flags().StringVar(&opts.safetensorsDir, "safetensors-dir", "", "absolute path to directory containing safetensors files and config")
+	c.Flags().StringVar(&opts.onnxDir, "onnx-dir", "", "absolute path to directory containing an ONNX file and config")
 	c.Flags().StringVar(&opts.fromModel, "from", "", "reference to an existing model to repackage")
 	c.Flags().StringVar(&opts.chatTemplatePath, "chat-template", "", "absolute path to chat template file (must be Jinja format)")
 	c.Flags().StringArrayVarP(&opts.licensePaths, "license", "l", nil, "absolute path to a license file")
@@ -156,6 +149,7 @@ type packageOptions struct {
 	contextSize      uint64
 	ggufPath         string
 	safetensorsDir   string
+	onnxDir          string
 	fromModel        string
 	licensePaths     []string
 	dirTarPaths      []string
@@ -163,6 +157,40 @@ type packageOptions struct {
 	tag              string
 }
 
+// validateSourceDir validates the directory from which a model in the named
+// format is packaged, and returns its cleaned path.
+func validateSourceDir(format, dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf(
+			"%s directory path must be absolute.\n\n"+
+				"See 'docker model package --help' for more information",
+			format,
+		)
+	}
+	dir = filepath.Clean(dir)
+
+	// Check if it's a directory
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf(
+				"%s directory does not exist: %s\n\n"+
+					"See 'docker model package --help' for more information",
+				format, dir,
+			)
+		}
+		return "", fmt.Errorf("could not access %s directory %q: %w", strings.ToLower(format), dir, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf(
+			"%s path must be a directory: %s\n\n"+
+				"See 'docker model package --help' for more information",
+			format, dir,
+		)
+	}
+	return dir, nil
+}
+
 // builderInitResult contains the result of initializing a builder from various sources
 type builderInitResult struct {
 	builder     *builder.Builder
@@ -170,7 +198,7 @@ type builderInitResult struct {
 	cleanupFunc func()               // Optional cleanup function for temporary files
 }
 
-// initializeBuilder creates a package builder from GGUF, Safetensors, or existing model
+// initializeBuilder creates a package builder from GGUF, Safetensors, ONNX, or existing model
 func initializeBuilder(cmd *cobra.Command, opts packageOptions) (*builderInitResult, error) {
 	result := &builderInitResult{}
 
@@ -219,6 +247,36 @@ func initializeBuilder(cmd *cobra.Command, opts packageOptions) (*builderInitRes
 			return nil, fmt.Errorf("add gguf file: %w", err)
 		}
 		result.builder = pkg
+	} else if opts.onnxDir != "" {
+		// ONNX model from directory
+		cmd.PrintErrf("Scanning directory %q for ONNX model...\n", opts.onnxDir)
+		onnxPath, tempConfigArchive, err := packaging.PackageFromONNXDirectory(opts.onnxDir)
+		if err != nil {
+			return nil, fmt.Errorf("scan ONNX directory: %w", err)
+		}
+
+		// Set up cleanup for temp config archive
+		if tempConfigArchive != "" {
+			result.cleanupFunc = func() {
+				os.Remove(tempConfigArchive)
+			}
+		}
+
+		cmd.PrintErrf("Adding ONNX file from %q\n", onnxPath)
+		pkg, err := builder.FromONNX(onnxPath)
+		if err != nil {
+			return nil, fmt.Errorf("create ONNX model: %w", err)
+		}
+
+		// Add config archive if it was created
+		if tempConfigArchive != "" {
+			cmd.PrintErrf("Adding config archive from directory\n")
+			pkg, err = pkg.WithConfigArchive(tempConfigArchive)
+			if err != nil {
+				return nil, fmt.Errorf("add config archive: %w", err)
+			}
+		}
+		result.builder = pkg
 	} else {
 		// Safetensors model from directory
 		cmd.PrintErrf("Scanning directory %q for safetensors model...\n", opts.safetensorsDir)
@@ -328,6 +386,8 @@ func packageModel(cmd *cobra.Command, opts packageOptions) error {
 			var baseDir string
 			if opts.safetensorsDir != "" {
 				baseDir = opts.safetensorsDir
+			} else if opts.onnxDir != "" {
+				baseDir = opts.onnxDir
 			} else {
 				// For GGUF, use the directory containing the GGUF file
 				baseDir = filepath.Dir(opts.ggufPath)
@@ -125,7 +125,8 @@ func printUsage() {
 	fmt.Println("\nCommands:")
 	fmt.Println("  pull <reference>                Pull a model from a registry")
 	fmt.Println("  package <source> <reference>    Package a model file as an OCI artifact and push it to a registry")
-	fmt.Println("                                  (use --licenses to add license files, --mmproj for multimodal projector, --dir-tar for directories)")
+	fmt.Println("                                  (use --licenses to add license files, --mmproj for multimodal projector, --lora for LoRA adapters,")
+	fmt.Println("                                  --draft-model for a speculative decoding draft model, --dir-tar for directories)")
 	fmt.Println("  push <tag>                      Push a model from the content store to the registry")
 	fmt.Println("  list                            List all models")
 	fmt.Println("  get <reference>                 Get a model by reference")
@@ -136,6 +137,7 @@ func printUsage() {
 	fmt.Println("  model-distribution-tool --store-path ./models pull registry.example.com/models/llama:v1.0")
 	fmt.Println("  model-distribution-tool package ./model.gguf registry.example.com/models/llama:v1.0 --licenses ./license1.txt --licenses ./license2.txt")
 	fmt.Println("  model-distribution-tool package ./model.gguf registry.example.com/models/llama:v1.0 --mmproj ./model.mmproj")
+	fmt.Println("  model-distribution-tool package ./model.gguf registry.example.com/models/llama:v1.0 --lora ./adapter.gguf --draft-model registry.example.com/models/llama-draft:v1.0")
 	fmt.Println("  model-distribution-tool package ./model.gguf registry.example.com/models/llama:v1.0 --dir-tar ./config --dir-tar ./templates")
 	fmt.Println("  model-distribution-tool push registry.example.com/models/llama:v1.0")
 	fmt.Println("  model-distribution-tool list")
@@ -167,17 +169,21 @@ func cmdPackage(args []string) int {
 	var (
 		licensePaths stringSliceFlag
 		dirTarPaths  stringSliceFlag
+		loraPaths    stringSliceFlag
 		contextSize  uint64
 		file         string
 		tag          string
 		mmproj       string
 		chatTemplate string
+		draftModel   string
 	)
 
 	fs.Var(&licensePaths, "licenses", "Paths to license files (can be specified multiple times)")
 	fs.Var(&dirTarPaths, "dir-tar", "Relative paths to directories to package as tar (can be specified multiple times)")
 	fs.Uint64Var(&contextSize, "context-size", 0, "Context size in tokens")
 	fs.StringVar(&mmproj, "mmproj", "", "Path to Multimodal Projector file")
+	fs.Var(&loraPaths, "lora", "Paths to LoRA adapter files in GGUF format (can be specified multiple times)")
+	fs.StringVar(&draftModel, "draft-model", "", "Reference of a draft model for speculative decoding, pulled along with the model")
 	fs.StringVar(&file, "file", "", "Write archived model to the given file")
 	fs.StringVar(&tag, "tag", "", "Push model to the given registry tag")
 	fs.StringVar(&chatTemplate, "chat-template", "", "Jinja chat template file")
@@ -333,6 +339,20 @@ func cmdPackage(args []string) int {
 		}
 	}
 
+	for _, path := range loraPaths {
+		fmt.Println("Adding LoRA adapter:", path)
+		b, err = b.WithLoRAAdapter(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding LoRA adapter layer for %s: %v\n", path, err)
+			return 1
+		}
+	}
+
+	if draftModel != "" {
+		fmt.Println("Setting draft model:", draftModel)
+		b = b.WithDraftModel(draftModel)
+	}
+
 	if chatTemplate != "" {
 		fmt.Println("Adding chat template file:", chatTemplate)
 		b, err = b.WithChatTemplateFile(chatTemplate)
@@ -1,30 +1,56 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/docker/model-runner/pkg/gpuinfo"
+	"github.com/docker/go-units"
+	"github.com/docker/model-runner/pkg/batch"
+	"github.com/docker/model-runner/pkg/chaos"
+	"github.com/docker/model-runner/pkg/chargeback"
+	"github.com/docker/model-runner/pkg/credentials"
+	"github.com/docker/model-runner/pkg/files"
 	"github.com/docker/model-runner/pkg/inference"
 	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
-	"github.com/docker/model-runner/pkg/inference/backends/mlx"
-	"github.com/docker/model-runner/pkg/inference/backends/vllm"
+	"github.com/docker/model-runner/pkg/inference/backends/mock"
 	"github.com/docker/model-runner/pkg/inference/config"
 	"github.com/docker/model-runner/pkg/inference/memory"
-	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/inference/provenance"
+	"github.com/docker/model-runner/pkg/inference/quirks"
+	"github.com/docker/model-runner/pkg/inference/retrieval"
 	"github.com/docker/model-runner/pkg/inference/scheduling"
+	"github.com/docker/model-runner/pkg/jobs"
 	"github.com/docker/model-runner/pkg/metrics"
 	"github.com/docker/model-runner/pkg/middleware"
-	"github.com/docker/model-runner/pkg/ollama"
-	"github.com/docker/model-runner/pkg/routing"
+	"github.com/docker/model-runner/pkg/modelrunner"
+	"github.com/docker/model-runner/pkg/oidc"
+	"github.com/docker/model-runner/pkg/prompts"
+	"github.com/docker/model-runner/pkg/pullproxy"
+	"github.com/docker/model-runner/pkg/quota"
+	"github.com/docker/model-runner/pkg/security"
+	"github.com/docker/model-runner/pkg/storage"
+	"github.com/docker/model-runner/pkg/tracing"
+	"github.com/docker/model-runner/pkg/traffic"
+	"github.com/docker/model-runner/pkg/transcription"
+	"github.com/docker/model-runner/pkg/vectorstore"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/netutil"
 )
 
 var log = logrus.New()
@@ -60,20 +86,33 @@ func main() {
 		llamacpp.SetDesiredServerVersion(desiredServerVersion)
 	}
 
+	if validationModel := os.Getenv("LLAMA_SERVER_VALIDATION_MODEL"); validationModel != "" {
+		validation := &llamacpp.ValidationConfig{
+			Model:     validationModel,
+			Prompt:    os.Getenv("LLAMA_SERVER_VALIDATION_PROMPT"),
+			Signature: os.Getenv("LLAMA_SERVER_VALIDATION_SIGNATURE"),
+		}
+		if maxTokensStr := os.Getenv("LLAMA_SERVER_VALIDATION_MAX_TOKENS"); maxTokensStr != "" {
+			maxTokens, err := strconv.Atoi(maxTokensStr)
+			if err != nil || maxTokens <= 0 {
+				log.Fatalf("Invalid LLAMA_SERVER_VALIDATION_MAX_TOKENS value: %s", maxTokensStr)
+			}
+			validation.MaxTokens = maxTokens
+		}
+		llamacpp.SetValidationConfig(validation)
+		log.Infof("Validating llama.cpp server updates with %s", validationModel)
+	}
+
 	llamaServerPath := os.Getenv("LLAMA_SERVER_PATH")
 	if llamaServerPath == "" {
-		llamaServerPath = "/Applications/Docker.app/Contents/Resources/model-runner/bin"
+		llamaServerPath = modelrunner.DefaultLlamaServerPath
 	}
+	log.Infof("LLAMA_SERVER_PATH: %s", llamaServerPath)
 
-	gpuInfo := gpuinfo.New(llamaServerPath)
-
-	sysMemInfo, err := memory.NewSystemMemoryInfo(log, gpuInfo)
-	if err != nil {
-		log.Fatalf("unable to initialize system memory info: %v", err)
+	if os.Getenv("MODEL_RUNNER_RUNTIME_MEMORY_CHECK") == "1" {
+		memory.SetRuntimeMemoryCheck(true)
 	}
 
-	memEstimator := memory.NewEstimator(sysMemInfo)
-
 	// Create a proxy-aware HTTP transport
 	// Use a safe type assertion with fallback, and explicitly set Proxy to http.ProxyFromEnvironment
 	var baseTransport *http.Transport
@@ -84,132 +123,375 @@ func main() {
 	}
 	baseTransport.Proxy = http.ProxyFromEnvironment
 
-	clientConfig := models.ClientConfig{
-		StoreRootPath: modelPath,
-		Logger:        log.WithFields(logrus.Fields{"component": "model-manager"}),
-		Transport:     baseTransport,
+	conf := modelrunner.Config{
+		Log:                  log,
+		ModelsPath:           modelPath,
+		Transport:            baseTransport,
+		LlamaServerPath:      llamaServerPath,
+		LlamaCpp:             createLlamaCppConfigFromEnv(),
+		Backends:             make(map[string]inference.Backend),
+		RetentionPolicy:      createRetentionPolicyFromEnv(),
+		RecordsAnonymization: createAnonymizationPolicyFromEnv("RECORDS_ANONYMIZE"),
+		PrefetchPolicy:       createPrefetchPolicyFromEnv(),
+		WindowPolicy:         createWindowPolicyFromEnv(),
+		Backpressure:         createBackpressurePolicyFromEnv(),
+		Jailbreak:            createJailbreakPolicyFromEnv(),
+		RequestQueue:         createRequestQueuePolicyFromEnv(),
+		ModerationModel:      os.Getenv("MODERATION_MODEL"),
+		Compression:          createCompressionConfigFromEnv(),
+		DropFolder:           os.Getenv("MODELS_DROP_PATH"),
+	}
+	loadLimits := createLoadLimitsFromEnv()
+	conf.LoadLimits = &loadLimits
+	if retentionStr := os.Getenv("MODELS_TRASH_RETENTION"); retentionStr != "" {
+		if conf.TrashRetention, err = time.ParseDuration(retentionStr); err != nil || conf.TrashRetention <= 0 {
+			log.Fatalf("Invalid MODELS_TRASH_RETENTION: %q", retentionStr)
+		}
 	}
-	modelHandler := models.NewHandler(
-		log,
-		clientConfig,
-		nil,
-		memEstimator,
-	)
-	modelManager := models.NewManager(log.WithFields(logrus.Fields{"component": "model-manager"}), clientConfig)
-	log.Infof("LLAMA_SERVER_PATH: %s", llamaServerPath)
 
-	// Create llama.cpp configuration from environment variables
-	llamaCppConfig := createLlamaCppConfigFromEnv()
-
-	llamaCppBackend, err := llamacpp.New(
-		log,
-		modelManager,
-		log.WithFields(logrus.Fields{"component": llamacpp.Name}),
-		llamaServerPath,
-		func() string {
-			wd, _ := os.Getwd()
-			d := filepath.Join(wd, "updated-inference", "bin")
-			_ = os.MkdirAll(d, 0o755)
-			return d
-		}(),
-		llamaCppConfig,
-	)
-	if err != nil {
-		log.Fatalf("unable to initialize %s backend: %v", llamacpp.Name, err)
+	// Resolve registry and Hugging Face credentials from the environment and,
+	// if configured, a credential helper, so that they aren't kept in
+	// plaintext configuration.
+	conf.Credentials = createCredentialsFromEnv()
+
+	// Route pulls and pushes through their own proxies if configured, e.g.
+	// for corporate networks requiring a proxy for large downloads.
+	conf.PullProxy = createPullProxyFromEnv()
+
+	// Support deployments behind ingress controllers, which may route a path
+	// prefix to the model runner and identify clients in forwarded headers.
+	if basePath := os.Getenv("MODEL_RUNNER_BASE_PATH"); basePath != "" {
+		if !strings.HasPrefix(basePath, "/") {
+			log.Fatalf("MODEL_RUNNER_BASE_PATH must start with \"/\", got %q", basePath)
+		}
+		conf.BasePath = basePath
+		log.Infof("Serving the API under %s", basePath)
+	}
+	if proxiesStr := os.Getenv("TRUSTED_PROXIES"); proxiesStr != "" {
+		if conf.TrustedProxies, err = middleware.ParseTrustedProxies(proxiesStr); err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+		}
+		log.Infof("Trusting forwarded headers from proxies: %v", conf.TrustedProxies)
 	}
 
-	if os.Getenv("MODEL_RUNNER_RUNTIME_MEMORY_CHECK") == "1" {
-		memory.SetRuntimeMemoryCheck(true)
+	// Store fixtures recorded from real traffic if configured, so that they
+	// can be replayed by the mock backend.
+	if fixturesPath := os.Getenv("MOCK_FIXTURES_PATH"); fixturesPath != "" {
+		if conf.Fixtures, err = mock.NewFixtureStore(fixturesPath); err != nil {
+			log.Fatalf("Invalid MOCK_FIXTURES_PATH: %v", err)
+		}
+		log.Infof("Storing fixtures in %s", fixturesPath)
 	}
 
-	memEstimator.SetDefaultBackend(llamaCppBackend)
+	// Persist the serving state across restarts, e.g. upgrades, so that
+	// pins, virtual models, runner configurations, and loaded runners are
+	// restored. Recorded requests and quota usage are persisted there too
+	// unless they have their own storage.
+	if spec := os.Getenv("STATE_STORAGE"); spec != "" {
+		stateStorage, err := storage.Open(spec)
+		if err != nil {
+			log.Fatalf("Invalid STATE_STORAGE: %v", err)
+		}
+		defer stateStorage.Close()
+		conf.StateStorage = stateStorage
+		log.Infof("Persisting the serving state in %s", spec)
+	}
 
-	vllmBackend, err := vllm.New(
-		log,
-		modelManager,
-		log.WithFields(logrus.Fields{"component": vllm.Name}),
-		nil,
-	)
-	if err != nil {
-		log.Fatalf("unable to initialize %s backend: %v", vllm.Name, err)
+	// Persist recorded requests and the models index in the configured
+	// storage, e.g. "sqlite:/var/lib/model-runner/records.db".
+	if spec := os.Getenv("RECORDS_STORAGE"); spec != "" {
+		recordsStorage, err := storage.Open(spec)
+		if err != nil {
+			log.Fatalf("Invalid RECORDS_STORAGE: %v", err)
+		}
+		defer recordsStorage.Close()
+		conf.RecordsStorage = recordsStorage
+		log.Infof("Persisting recorded requests in %s", spec)
+	} else if conf.StateStorage != nil {
+		conf.RecordsStorage = conf.StateStorage
 	}
+	if conf.RecordsStorage != nil {
+		// Encrypt persisted bodies, since conversations may contain secrets.
+		// The key is read from a file if configured, e.g. a mounted secret.
+		encodedKey := os.Getenv("RECORDS_ENCRYPTION_KEY")
+		if keyFile := os.Getenv("RECORDS_ENCRYPTION_KEY_FILE"); keyFile != "" {
+			data, err := os.ReadFile(keyFile)
+			if err != nil {
+				log.Fatalf("Invalid RECORDS_ENCRYPTION_KEY_FILE: %v", err)
+			}
+			encodedKey = string(data)
+		}
+		if encodedKey != "" {
+			if conf.RecordsEncryptionKey, err = metrics.ParseEncryptionKey(encodedKey); err != nil {
+				log.Fatalf("Invalid records encryption key: %v", err)
+			}
+			log.Info("Encrypting persisted request and response bodies")
+		}
 
-	mlxBackend, err := mlx.New(
-		log,
-		modelManager,
-		log.WithFields(logrus.Fields{"component": mlx.Name}),
-		nil,
-	)
-	if err != nil {
-		log.Fatalf("unable to initialize %s backend: %v", mlx.Name, err)
-	}
-
-	scheduler := scheduling.NewScheduler(
-		log,
-		map[string]inference.Backend{
-			llamacpp.Name: llamaCppBackend,
-			vllm.Name:     vllmBackend,
-			mlx.Name:      mlxBackend,
-		},
-		llamaCppBackend,
-		modelHandler,
-		modelManager,
+		// Keep a hash-chained audit log of persisted records, optionally
+		// signed, so that auditors can detect altered records.
+		conf.RecordsAudit = os.Getenv("RECORDS_AUDIT") == "1"
+		encodedSigningKey := os.Getenv("RECORDS_SIGNING_KEY")
+		if keyFile := os.Getenv("RECORDS_SIGNING_KEY_FILE"); keyFile != "" {
+			data, err := os.ReadFile(keyFile)
+			if err != nil {
+				log.Fatalf("Invalid RECORDS_SIGNING_KEY_FILE: %v", err)
+			}
+			encodedSigningKey = string(data)
+		}
+		if encodedSigningKey != "" {
+			if conf.RecordsSigningKey, err = provenance.ParseKey(encodedSigningKey); err != nil {
+				log.Fatalf("Invalid records signing key: %v", err)
+			}
+		}
+		if conf.RecordsAudit || conf.RecordsSigningKey != nil {
+			log.Info("Keeping an audit log of persisted records")
+		}
+	}
+	if spec := os.Getenv("MODELS_METADATA_STORAGE"); spec != "" {
+		metadataStorage, err := storage.Open(spec)
+		if err != nil {
+			log.Fatalf("Invalid MODELS_METADATA_STORAGE: %v", err)
+		}
+		defer metadataStorage.Close()
+		conf.ModelMetadata = metadataStorage
+		log.Infof("Storing the models index in %s", spec)
+	}
+
+	// Serve mocked models with canned responses if configured, e.g. for
+	// integration tests in CI.
+	if mockConfig := createMockConfigFromEnv(); mockConfig != nil {
+		mockBackend, err := mock.New(log.WithFields(logrus.Fields{"component": mock.Name}), mockConfig)
+		if err != nil {
+			log.Fatalf("unable to initialize %s backend: %v", mock.Name, err)
+		}
+		conf.Backends[mock.Name] = mockBackend
+		log.Infof("Mock backend enabled for %d models", len(mockConfig.Models))
+	}
+
+	conf.Tracker = metrics.NewTracker(
 		http.DefaultClient,
-		nil,
-		metrics.NewTracker(
-			http.DefaultClient,
-			log.WithField("component", "metrics"),
-			"",
-			false,
-		),
-		sysMemInfo,
+		log.WithField("component", "metrics"),
+		"",
+		false,
 	)
+	conf.Tracker.SetAnonymizationPolicy(createAnonymizationPolicyFromEnv("USAGE_ANONYMIZE"))
+
+	profileName := scheduling.DefaultProfile
+	if name := os.Getenv("MODEL_RUNNER_PROFILE"); name != "" {
+		profileName = name
+	}
+	profile, err := scheduling.LookupProfile(profileName)
+	if err != nil {
+		log.Fatalf("Invalid MODEL_RUNNER_PROFILE: %v", err)
+	}
+	conf.Profile = &profile
+	if routesFile := os.Getenv("MODEL_ROUTES_FILE"); routesFile != "" {
+		conf.VirtualModels = loadVirtualModels(routesFile)
+		log.Infof("Loading virtual models from %s", routesFile)
+	}
+	if pipelinesFile := os.Getenv("PIPELINES_FILE"); pipelinesFile != "" {
+		conf.Pipelines = loadPipelines(pipelinesFile)
+		log.Infof("Loading pipelines from %s", pipelinesFile)
+	}
+	if quirksFile := os.Getenv("MODEL_QUIRKS_FILE"); quirksFile != "" {
+		conf.Quirks = loadQuirks(quirksFile)
+		log.Infof("Loading model quirk rules from %s", quirksFile)
+	}
+	if quotasFile := os.Getenv("QUOTAS_FILE"); quotasFile != "" {
+		conf.QuotaLimits = loadQuotaLimits(quotasFile)
+		log.Infof("Loading token quotas from %s", quotasFile)
+	}
+	if spec := os.Getenv("QUOTAS_STORAGE"); spec != "" {
+		quotaStorage, err := storage.Open(spec)
+		if err != nil {
+			log.Fatalf("Invalid QUOTAS_STORAGE: %v", err)
+		}
+		defer quotaStorage.Close()
+		conf.QuotaStorage = quotaStorage
+		log.Infof("Persisting quota usage in %s", spec)
+	} else if conf.StateStorage != nil {
+		conf.QuotaStorage = conf.StateStorage
+	}
+	conf.Chargeback = createChargebackExporterFromEnv()
+	conf.Provenance = createProvenanceSignerFromEnv()
+	if tracing.Enabled() {
+		tracerProvider, err := tracing.NewProvider(ctx)
+		if err != nil {
+			log.Fatalf("Invalid tracing configuration: %v", err)
+		}
+		defer func() {
+			// Flush pending spans.
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+				log.Warnf("Failed to flush traces: %v", err)
+			}
+		}()
+		conf.TracerProvider = tracerProvider
+		log.Info("Exporting traces of inference requests via OTLP")
+	}
+	if maxStr := os.Getenv("USAGE_MAX_USER_AGENTS"); maxStr != "" {
+		maxUserAgents, err := strconv.Atoi(maxStr)
+		if err != nil || maxUserAgents <= 0 {
+			log.Fatalf("USAGE_MAX_USER_AGENTS must be a positive integer, got %q", maxStr)
+		}
+		conf.MaxUserAgents = maxUserAgents
+	}
+	if os.Getenv("RECORDS_RESOURCE_SNAPSHOTS") == "1" {
+		conf.ResourceSnapshots = true
+		log.Info("Capturing resource snapshots for recorded requests")
+	}
+
+	// Add the vector store API if enabled.
+	if vectorStoresPath := os.Getenv("VECTOR_STORES_PATH"); vectorStoresPath != "" {
+		if conf.VectorStores, err = vectorstore.NewManager(log.WithField("component", "vector-stores"), vectorStoresPath); err != nil {
+			log.Fatalf("unable to initialize vector stores: %v", err)
+		}
+		// Allow chat completion requests to be grounded in vector stores.
+		if conf.RetrievalTemplate, err = retrieval.ParseTemplate(os.Getenv("RETRIEVAL_PROMPT_TEMPLATE")); err != nil {
+			log.Fatalf("unable to configure retrieval: %v", err)
+		}
+		log.Infof("Vector store API enabled with stores in %s", vectorStoresPath)
+	}
+
+	// Add the prompt template library if enabled, which lets chat completion
+	// requests reference named templates.
+	if promptTemplatesPath := os.Getenv("PROMPT_TEMPLATES_PATH"); promptTemplatesPath != "" {
+		promptTemplatesStorage, err := storage.NewFilesystem(promptTemplatesPath)
+		if err != nil {
+			log.Fatalf("unable to initialize prompt templates: %v", err)
+		}
+		if conf.PromptTemplates, err = prompts.NewManager(log.WithField("component", "prompt-templates"), promptTemplatesStorage); err != nil {
+			log.Fatalf("unable to initialize prompt templates: %v", err)
+		}
+		log.Infof("Prompt template API enabled with templates in %s", promptTemplatesPath)
+	}
+
+	// Add the Files API, which stores batch inputs and attachments.
+	filesPath := os.Getenv("FILES_PATH")
+	if filesPath == "" {
+		filesPath = filepath.Join(userHomeDir, ".docker", "model-runner", "files")
+	}
+	if conf.Files, err = files.NewManager(log.WithField("component", "files"), filesPath, createFileLimitsFromEnv()); err != nil {
+		log.Fatalf("unable to initialize files: %v", err)
+	}
+
+	// Add the Batch API if enabled, which processes batches of requests in
+	// the background whenever no other requests are in flight.
+	if batchesPath := os.Getenv("BATCHES_PATH"); batchesPath != "" {
+		if conf.Batches, err = batch.NewManager(log.WithField("component", "batches"), batchesPath, conf.Files); err != nil {
+			log.Fatalf("unable to initialize batches: %v", err)
+		}
+		log.Infof("Batch API enabled with batches in %s", batchesPath)
+	}
+
+	// Add scheduled jobs if enabled, which run prompts or batch files on a
+	// schedule.
+	if jobsPath := os.Getenv("JOBS_PATH"); jobsPath != "" {
+		jobsStorage, err := storage.NewFilesystem(jobsPath)
+		if err != nil {
+			log.Fatalf("unable to initialize jobs: %v", err)
+		}
+		if conf.Jobs, err = jobs.NewManager(log.WithField("component", "jobs"), jobsStorage); err != nil {
+			log.Fatalf("unable to initialize jobs: %v", err)
+		}
+		log.Infof("Scheduled jobs enabled with jobs in %s", jobsPath)
+	}
+
+	// Transcribe streamed audio with a whisper.cpp server if configured.
+	if whisperURL := os.Getenv("WHISPER_SERVER_URL"); whisperURL != "" {
+		conf.Transcriber = transcription.NewWhisperServer(whisperURL)
+		log.Infof("Streaming transcription enabled with the whisper.cpp server at %s", whisperURL)
+	}
+
+	// Add the fault injection API if chaos mode is enabled.
+	if os.Getenv("CHAOS_MODE") == "1" {
+		conf.Chaos = chaos.NewInjector()
+		if configFile := os.Getenv("CHAOS_CONFIG_FILE"); configFile != "" {
+			config, err := chaos.LoadConfig(configFile)
+			if err != nil {
+				log.Fatalf("unable to load fault injection configuration: %v", err)
+			}
+			conf.Chaos.Configure(config)
+		}
+		log.Warn("Chaos mode enabled: faults may be injected into inference responses")
+	}
 
-	router := routing.NewNormalizedServeMux()
-
-	// Register path prefixes to forward all HTTP methods (including OPTIONS) to components
-	// Components handle method routing internally
-	// Register both with and without trailing slash to avoid redirects
-	router.Handle(inference.ModelsPrefix, modelHandler)
-	router.Handle(inference.ModelsPrefix+"/", modelHandler)
-	router.Handle(inference.InferencePrefix+"/", scheduler)
-	// Add path aliases: /v1 -> /engines/v1, /rerank -> /engines/rerank, /score -> /engines/score.
-	aliasHandler := &middleware.AliasHandler{Handler: scheduler}
-	router.Handle("/v1/", aliasHandler)
-	router.Handle("/rerank", aliasHandler)
-	router.Handle("/score", aliasHandler)
-
-	// Add Ollama API compatibility layer (only register with trailing slash to catch sub-paths)
-	ollamaHandler := ollama.NewHandler(log, scheduler, nil, modelManager)
-	router.Handle(ollama.APIPrefix+"/", ollamaHandler)
-
-	// Register root handler LAST - it will only catch exact "/" requests that don't match other patterns
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// Only respond to exact root path
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Docker Model Runner is running"))
-	})
-
-	// Add metrics endpoint if enabled
 	if os.Getenv("DISABLE_METRICS") != "1" {
-		metricsHandler := metrics.NewAggregatedMetricsHandler(
-			log.WithField("component", "metrics"),
-			scheduler,
-		)
-		router.Handle("/metrics", metricsHandler)
 		log.Info("Metrics endpoint enabled at /metrics")
 	} else {
+		conf.DisableMetrics = true
 		log.Info("Metrics endpoint disabled")
 	}
 
-	server := &http.Server{
-		Handler:           router,
-		ReadHeaderTimeout: 10 * time.Second,
+	// Disable mutating management operations in read-only mode.
+	if os.Getenv("MODEL_RUNNER_READ_ONLY") == "1" {
+		conf.ReadOnly = true
+		log.Info("Read-only mode enabled: pulls, deletions, and configuration changes are disabled")
+	}
+
+	// Restrict the API to the roles bound to API keys or client certificates
+	// if configured, e.g. so that everyone can infer but only ops can manage
+	// models.
+	if policyPath := os.Getenv("MODEL_RUNNER_ACCESS_POLICY"); policyPath != "" {
+		policy, err := middleware.LoadAccessPolicy(policyPath)
+		if err != nil {
+			log.Fatalf("Invalid MODEL_RUNNER_ACCESS_POLICY: %v", err)
+		}
+		conf.AccessPolicy = &policy
+		log.Infof("Enforcing the access policy in %s", policyPath)
+	}
+
+	// Restrict the client addresses allowed to access each route group if
+	// configured, e.g. for runners exposed on a LAN without authentication.
+	conf.NetworkPolicy = createNetworkPolicyFromEnv()
+
+	// Accept tokens issued by an OpenID Connect provider if configured, e.g.
+	// for enterprises putting the model runner behind their identity
+	// provider.
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		scopeRoles, err := oidc.ParseScopeRoles(os.Getenv("OIDC_SCOPE_ROLES"))
+		if err != nil {
+			log.Fatalf("Invalid OIDC_SCOPE_ROLES: %v", err)
+		}
+		validator, err := oidc.NewValidator(ctx, oidc.Config{
+			Issuer:     issuer,
+			Audience:   os.Getenv("OIDC_AUDIENCE"),
+			ScopeRoles: scopeRoles,
+			HTTPClient: &http.Client{Transport: baseTransport, Timeout: 30 * time.Second},
+		})
+		if err != nil {
+			log.Fatalf("unable to initialize OIDC token validation: %v", err)
+		}
+		if conf.AccessPolicy == nil {
+			conf.AccessPolicy = &middleware.AccessPolicy{}
+		}
+		conf.AccessPolicy.Tokens = validator
+		log.Infof("Accepting tokens issued by %s", issuer)
+	}
+
+	// Lock out sources with too many failed authentication attempts, e.g.
+	// clients guessing API keys, unless disabled.
+	if conf.AccessPolicy != nil && os.Getenv("DISABLE_AUTH_LOCKOUT") != "1" {
+		conf.SecurityMonitor = createSecurityMonitorFromEnv()
 	}
+
+	// Record all traffic if enabled, so that it can be replayed later.
+	if recordPath := os.Getenv("TRAFFIC_RECORD_FILE"); recordPath != "" {
+		if conf.TrafficRecorder, err = traffic.NewRecorder(log.WithField("component", "traffic"), recordPath); err != nil {
+			log.Fatalf("unable to record traffic: %v", err)
+		}
+		defer conf.TrafficRecorder.Close()
+		log.Infof("Recording traffic to %s", recordPath)
+	}
+
+	modelRunner, err := modelrunner.New(ctx, conf)
+	if err != nil {
+		log.Fatalf("unable to initialize the model runner: %v", err)
+	}
+
+	server, maxConnections := createServerFromEnv(modelRunner.Handler())
 	serverErrors := make(chan error, 1)
 
 	// Check if we should use TCP port instead of Unix socket
@@ -219,8 +501,18 @@ func main() {
 		addr := ":" + tcpPort
 		log.Infof("Listening on TCP port %s", tcpPort)
 		server.Addr = addr
+		server.TLSConfig = createTLSConfigFromEnv()
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("Failed to listen on TCP port %s: %v", tcpPort, err)
+		}
+		ln = limitListener(ln, maxConnections)
 		go func() {
-			serverErrors <- server.ListenAndServe()
+			if server.TLSConfig != nil {
+				serverErrors <- server.ServeTLS(ln, "", "")
+				return
+			}
+			serverErrors <- server.Serve(ln)
 		}()
 	} else {
 		// Use Unix socket
@@ -233,14 +525,15 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to listen on socket: %v", err)
 		}
+		limited := limitListener(ln, maxConnections)
 		go func() {
-			serverErrors <- server.Serve(ln)
+			serverErrors <- server.Serve(limited)
 		}()
 	}
 
-	schedulerErrors := make(chan error, 1)
+	modelRunnerErrors := make(chan error, 1)
 	go func() {
-		schedulerErrors <- scheduler.Run(ctx)
+		modelRunnerErrors <- modelRunner.Run(ctx)
 	}()
 
 	select {
@@ -255,7 +548,7 @@ func main() {
 			log.Errorf("Server shutdown error: %v", err)
 		}
 		log.Infoln("Waiting for the scheduler to stop")
-		if err := <-schedulerErrors; err != nil {
+		if err := <-modelRunnerErrors; err != nil {
 			log.Errorf("Scheduler error: %v", err)
 		}
 	}
@@ -291,6 +584,667 @@ func createLlamaCppConfigFromEnv() config.BackendConfig {
 	}
 }
 
+// createRetentionPolicyFromEnv creates a record RetentionPolicy from environment variables
+func createRetentionPolicyFromEnv() metrics.RetentionPolicy {
+	var policy metrics.RetentionPolicy
+
+	if daysStr := os.Getenv("RECORDS_RETENTION_DAYS"); daysStr != "" {
+		days, err := strconv.Atoi(daysStr)
+		if err != nil || days < 0 {
+			log.Fatalf("RECORDS_RETENTION_DAYS must be a non-negative integer, got %q", daysStr)
+		}
+		policy.MaxAge = time.Duration(days) * 24 * time.Hour
+		log.Infof("Retaining recorded requests for %d days", days)
+	}
+
+	if maxStr := os.Getenv("RECORDS_MAX_PER_MODEL"); maxStr != "" {
+		maxRecords, err := strconv.Atoi(maxStr)
+		if err != nil || maxRecords < 1 {
+			log.Fatalf("RECORDS_MAX_PER_MODEL must be a positive integer, got %q", maxStr)
+		}
+		policy.MaxRecords = maxRecords
+		log.Infof("Retaining up to %d recorded requests per model", maxRecords)
+	}
+
+	if sizeStr := os.Getenv("RECORDS_MAX_SIZE"); sizeStr != "" {
+		maxSize, err := units.FromHumanSize(sizeStr)
+		if err != nil || maxSize < 1 {
+			log.Fatalf("RECORDS_MAX_SIZE must be a positive size (e.g. 512MB), got %q", sizeStr)
+		}
+		policy.MaxSize = maxSize
+		log.Infof("Retaining up to %s of recorded requests", units.HumanSize(float64(maxSize)))
+	}
+
+	if modelsStr := os.Getenv("RECORDS_EXCLUDE_BODY_MODELS"); modelsStr != "" {
+		for _, model := range strings.Split(modelsStr, ",") {
+			if model = strings.TrimSpace(model); model != "" {
+				policy.ExcludeBodyModels = append(policy.ExcludeBodyModels, model)
+			}
+		}
+		log.Infof("Not recording request bodies for models: %v", policy.ExcludeBodyModels)
+	}
+
+	if os.Getenv("RECORDS_STRIP_REASONING") == "1" {
+		policy.StripReasoning = true
+		log.Info("Stripping reasoning content from recorded responses")
+	}
+
+	return policy
+}
+
+// createAnonymizationPolicyFromEnv creates an anonymization policy for an
+// export target from the specified environment variable.
+func createAnonymizationPolicyFromEnv(variable string) metrics.AnonymizationPolicy {
+	policy, err := metrics.ParseAnonymizationPolicy(os.Getenv(variable))
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", variable, err)
+	}
+	if policy.Enabled() {
+		log.Infof("Anonymizing exported data (%s): %+v", variable, policy)
+	}
+	return policy
+}
+
+// createMockConfigFromEnv creates the mock backend configuration from the
+// JSON file set by MOCK_CONFIG_FILE, extended with the model references or
+// patterns listed in MOCK_MODELS, which are served with the default response.
+// It returns nil if neither is set.
+func createMockConfigFromEnv() *mock.Config {
+	configFile, modelsStr := os.Getenv("MOCK_CONFIG_FILE"), os.Getenv("MOCK_MODELS")
+	if configFile == "" && modelsStr == "" {
+		return nil
+	}
+	config := &mock.Config{}
+	if configFile != "" {
+		var err error
+		if config, err = mock.LoadConfig(configFile); err != nil {
+			log.Fatalf("Invalid MOCK_CONFIG_FILE: %v", err)
+		}
+	}
+	if config.Models == nil {
+		config.Models = make(map[string]mock.ModelConfig)
+	}
+	for pattern, modelConfig := range mock.NewDefaultConfig(strings.Split(modelsStr, ",")).Models {
+		if _, ok := config.Models[pattern]; !ok {
+			config.Models[pattern] = modelConfig
+		}
+	}
+	return config
+}
+
+// createCompressionConfigFromEnv creates the response compression
+// configuration from environment variables.
+func createCompressionConfigFromEnv() middleware.CompressionConfig {
+	if os.Getenv("DISABLE_COMPRESSION") == "1" {
+		log.Info("Response compression disabled")
+		return middleware.CompressionConfig{}
+	}
+
+	config := middleware.CompressionConfig{Routes: middleware.DefaultCompressionRoutes}
+	if routesStr := os.Getenv("COMPRESSION_ROUTES"); routesStr != "" {
+		config.Routes = nil
+		for _, route := range strings.Split(routesStr, ",") {
+			if route = strings.TrimSpace(route); route == "" {
+				continue
+			}
+			if _, err := path.Match(route, ""); err != nil {
+				log.Fatalf("Invalid route pattern %q in COMPRESSION_ROUTES: %v", route, err)
+			}
+			config.Routes = append(config.Routes, route)
+		}
+		log.Infof("Compressing responses for routes: %v", config.Routes)
+	}
+
+	if sizeStr := os.Getenv("COMPRESSION_MIN_SIZE"); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size < 0 {
+			log.Fatalf("COMPRESSION_MIN_SIZE must be a non-negative integer, got %q", sizeStr)
+		}
+		config.MinSize = size
+	}
+	return config
+}
+
+// networkRouteGroups are the route groups whose client addresses can be
+// restricted, by the suffixes of their environment variables. The empty role
+// applies to all routes.
+var networkRouteGroups = []struct {
+	suffix string
+	role   middleware.Role
+}{
+	{"", ""},
+	{"_INFERENCE", middleware.RoleInference},
+	{"_MODEL_MANAGER", middleware.RoleModelManager},
+	{"_ADMIN", middleware.RoleAdmin},
+}
+
+// createNetworkPolicyFromEnv creates the policy restricting the client
+// addresses allowed to access each route group from the NETWORK_ALLOW and
+// NETWORK_DENY environment variables, optionally suffixed with a route group.
+func createNetworkPolicyFromEnv() middleware.NetworkPolicy {
+	policy := make(middleware.NetworkPolicy)
+	for _, group := range networkRouteGroups {
+		var rule middleware.NetworkRule
+		var err error
+		allowVariable, denyVariable := "NETWORK_ALLOW"+group.suffix, "NETWORK_DENY"+group.suffix
+		if rule.Allow, err = middleware.ParsePrefixes(os.Getenv(allowVariable)); err != nil {
+			log.Fatalf("Invalid %s: %v", allowVariable, err)
+		}
+		if rule.Deny, err = middleware.ParsePrefixes(os.Getenv(denyVariable)); err != nil {
+			log.Fatalf("Invalid %s: %v", denyVariable, err)
+		}
+		if len(rule.Allow) == 0 && len(rule.Deny) == 0 {
+			continue
+		}
+		policy[group.role] = rule
+		routes := "all"
+		if group.role != "" {
+			routes = "the " + string(group.role)
+		}
+		log.Infof("Restricting client addresses for %s routes: allowed %v, denied %v", routes, rule.Allow, rule.Deny)
+	}
+	return policy
+}
+
+// createPullProxyFromEnv creates the proxy selector of pulls and pushes from
+// the configuration file in PULL_PROXY_CONFIG, or from the PULL_PROXY and
+// PULL_NO_PROXY environment variables. Without either, pulls use the standard
+// proxy environment variables.
+func createPullProxyFromEnv() *pullproxy.Selector {
+	config := pullproxy.Config{
+		Proxy:   os.Getenv("PULL_PROXY"),
+		NoProxy: pullproxy.ParseNoProxy(os.Getenv("PULL_NO_PROXY")),
+	}
+	if configFile := os.Getenv("PULL_PROXY_CONFIG"); configFile != "" {
+		var err error
+		if config, err = pullproxy.LoadConfig(configFile); err != nil {
+			log.Fatalf("Invalid PULL_PROXY_CONFIG: %v", err)
+		}
+	}
+	selector, err := pullproxy.NewSelector(config)
+	if err != nil {
+		log.Fatalf("Invalid PULL_PROXY: %v", err)
+	}
+	if config.Proxy != "" || len(config.Rules) > 0 {
+		log.Infof("Pulling models through proxies with %d rules", len(config.Rules))
+	}
+	return selector
+}
+
+// createCredentialsFromEnv creates the credentials store from environment
+// variables: credentials injected through REGISTRY_CREDENTIALS and HF_TOKEN,
+// followed by the credential helper named by CREDENTIALS_HELPER, where
+// "keychain" names the OS keychain's helper.
+func createCredentialsFromEnv() credentials.Chain {
+	env, err := credentials.ParseEnv(os.Getenv("REGISTRY_CREDENTIALS"), os.Getenv("HF_TOKEN"))
+	if err != nil {
+		log.Fatalf("Invalid REGISTRY_CREDENTIALS: %v", err)
+	}
+	store := credentials.Chain{env}
+	if helper := os.Getenv("CREDENTIALS_HELPER"); helper != "" {
+		if helper == "keychain" {
+			helper = credentials.DefaultHelper()
+		}
+		if _, err := exec.LookPath("docker-credential-" + helper); err != nil {
+			log.Fatalf("Invalid CREDENTIALS_HELPER: %v", err)
+		}
+		store = append(store, credentials.NewHelper(helper))
+		log.Infof("Storing registry credentials with the %s credential helper", helper)
+	}
+	return store
+}
+
+// createSecurityMonitorFromEnv creates the monitor of failed authentication
+// attempts from environment variables.
+func createSecurityMonitorFromEnv() *security.Monitor {
+	var policy security.Policy
+	if maxStr := os.Getenv("AUTH_MAX_FAILURES"); maxStr != "" {
+		maxFailures, err := strconv.Atoi(maxStr)
+		if err != nil || maxFailures <= 0 {
+			log.Fatalf("AUTH_MAX_FAILURES must be a positive integer, got %q", maxStr)
+		}
+		policy.MaxFailures = maxFailures
+	}
+	for _, setting := range []struct {
+		variable string
+		duration *time.Duration
+	}{
+		{"AUTH_FAILURE_WINDOW", &policy.Window},
+		{"AUTH_LOCKOUT_DURATION", &policy.Lockout},
+	} {
+		if durationStr := os.Getenv(setting.variable); durationStr != "" {
+			var err error
+			if *setting.duration, err = time.ParseDuration(durationStr); err != nil || *setting.duration <= 0 {
+				log.Fatalf("%s must be a positive duration, got %q", setting.variable, durationStr)
+			}
+		}
+	}
+	if os.Getenv("AUTH_LOCKOUT_LOCAL") == "1" {
+		policy.LockOutLocal = true
+		log.Infoln("Local clients are locked out after too many failed authentication attempts")
+	}
+	monitor, err := security.NewMonitor(log.WithField("component", "security"), policy)
+	if err != nil {
+		log.Fatalf("Invalid authentication lockout policy: %v", err)
+	}
+	return monitor
+}
+
+// defaultIdleTimeout is the default time after which idle keep-alive
+// connections are closed.
+const defaultIdleTimeout = 2 * time.Minute
+
+// createServerFromEnv creates the HTTP server serving handler from environment
+// variables, along with the maximum number of concurrent connections, which is
+// zero if they're unlimited. HTTP/2 is enabled for TLS connections and, with
+// prior knowledge (h2c), for unencrypted ones, so that clients such as
+// embedding pipelines can multiplex many concurrent requests over a few
+// connections.
+func createServerFromEnv(handler http.Handler) (*http.Server, int) {
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       defaultIdleTimeout,
+		Protocols:         new(http.Protocols),
+		HTTP2:             &http.HTTP2Config{},
+	}
+	server.Protocols.SetHTTP1(true)
+	if os.Getenv("DISABLE_HTTP2") == "1" {
+		log.Info("HTTP/2 disabled")
+	} else {
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	if streamsStr := os.Getenv("HTTP2_MAX_CONCURRENT_STREAMS"); streamsStr != "" {
+		streams, err := strconv.Atoi(streamsStr)
+		if err != nil || streams <= 0 {
+			log.Fatalf("HTTP2_MAX_CONCURRENT_STREAMS must be a positive integer, got %q", streamsStr)
+		}
+		server.HTTP2.MaxConcurrentStreams = streams
+		log.Infof("Allowing %d concurrent HTTP/2 streams per connection", streams)
+	}
+
+	if timeoutStr := os.Getenv("HTTP_IDLE_TIMEOUT"); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil || timeout <= 0 {
+			log.Fatalf("HTTP_IDLE_TIMEOUT must be a positive duration, got %q", timeoutStr)
+		}
+		server.IdleTimeout = timeout
+	}
+
+	if os.Getenv("DISABLE_KEEP_ALIVES") == "1" {
+		server.SetKeepAlivesEnabled(false)
+		log.Info("HTTP keep-alives disabled")
+	}
+
+	var maxConnections int
+	if connectionsStr := os.Getenv("HTTP_MAX_CONNECTIONS"); connectionsStr != "" {
+		var err error
+		if maxConnections, err = strconv.Atoi(connectionsStr); err != nil || maxConnections < 0 {
+			log.Fatalf("HTTP_MAX_CONNECTIONS must be a non-negative integer, got %q", connectionsStr)
+		}
+		if maxConnections > 0 {
+			log.Infof("Limiting concurrent connections to %d", maxConnections)
+		}
+	}
+	return server, maxConnections
+}
+
+// limitListener limits the number of concurrent connections accepted by ln,
+// unless maxConnections is zero. Further connections wait to be accepted.
+func limitListener(ln net.Listener, maxConnections int) net.Listener {
+	if maxConnections == 0 {
+		return ln
+	}
+	return netutil.LimitListener(ln, maxConnections)
+}
+
+// createTLSConfigFromEnv creates the TLS configuration of the TCP listener
+// from environment variables, or returns nil if TLS isn't enabled. Client
+// certificates are verified if a client CA is configured, so that their
+// identities can be bound to roles, but clients may still authenticate with
+// API keys instead.
+func createTLSConfigFromEnv() *tls.Config {
+	certFile, keyFile := os.Getenv("MODEL_RUNNER_TLS_CERT"), os.Getenv("MODEL_RUNNER_TLS_KEY")
+	if certFile == "" && keyFile == "" {
+		return nil
+	}
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		log.Fatalf("Invalid MODEL_RUNNER_TLS_CERT or MODEL_RUNNER_TLS_KEY: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile := os.Getenv("MODEL_RUNNER_TLS_CLIENT_CA"); caFile != "" {
+		caData, err := os.ReadFile(caFile)
+		if err != nil {
+			log.Fatalf("Invalid MODEL_RUNNER_TLS_CLIENT_CA: %v", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(caData) {
+			log.Fatalf("Invalid MODEL_RUNNER_TLS_CLIENT_CA: no certificates found in %s", caFile)
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	log.Info("TLS enabled")
+	return config
+}
+
+// createLoadLimitsFromEnv creates the limits on concurrent model loads from
+// environment variables.
+func createLoadLimitsFromEnv() scheduling.LoadLimits {
+	limits := scheduling.LoadLimits{MaxConcurrent: 1}
+
+	if countStr := os.Getenv("MAX_CONCURRENT_LOADS"); countStr != "" {
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count < 0 {
+			log.Fatalf("MAX_CONCURRENT_LOADS must be a non-negative integer, got %q", countStr)
+		}
+		limits.MaxConcurrent = count
+		log.Infof("Limiting concurrent model loads to %d", count)
+	}
+
+	if bytesStr := os.Getenv("MAX_CONCURRENT_LOAD_BYTES"); bytesStr != "" {
+		bytes, err := strconv.ParseUint(bytesStr, 10, 64)
+		if err != nil {
+			log.Fatalf("MAX_CONCURRENT_LOAD_BYTES must be a non-negative integer, got %q", bytesStr)
+		}
+		limits.MaxBytes = bytes
+		log.Infof("Limiting concurrently loaded model data to %d bytes", bytes)
+	}
+
+	return limits
+}
+
+// createFileLimitsFromEnv creates the limits on the storage used by files from
+// environment variables.
+func createFileLimitsFromEnv() files.Limits {
+	var limits files.Limits
+
+	if sizeStr := os.Getenv("FILES_MAX_FILE_SIZE"); sizeStr != "" {
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || size <= 0 {
+			log.Fatalf("FILES_MAX_FILE_SIZE must be a positive integer, got %q", sizeStr)
+		}
+		limits.MaxFileSize = size
+		log.Infof("Limiting uploaded files to %d bytes", size)
+	}
+
+	if quotaStr := os.Getenv("FILES_QUOTA"); quotaStr != "" {
+		quota, err := strconv.ParseInt(quotaStr, 10, 64)
+		if err != nil || quota <= 0 {
+			log.Fatalf("FILES_QUOTA must be a positive integer, got %q", quotaStr)
+		}
+		limits.Quota = quota
+		log.Infof("Limiting stored files to %d bytes", quota)
+	}
+
+	return limits
+}
+
+// createWindowPolicyFromEnv creates the global window policy from environment
+// variables.
+func createWindowPolicyFromEnv() scheduling.WindowPolicy {
+	var policy scheduling.WindowPolicy
+	var err error
+	if policy.Serving, err = scheduling.ParseWindow(os.Getenv("SERVING_WINDOW")); err != nil {
+		log.Fatalf("Invalid SERVING_WINDOW: %v", err)
+	} else if policy.Serving != nil {
+		log.Infof("Keeping models loaded only during %q", policy.Serving)
+	}
+	if policy.Pulls, err = scheduling.ParseWindow(os.Getenv("PULL_WINDOW")); err != nil {
+		log.Fatalf("Invalid PULL_WINDOW: %v", err)
+	} else if policy.Pulls != nil {
+		log.Infof("Allowing pulls only during %q", policy.Pulls)
+	}
+	return policy
+}
+
+// loadVirtualModels loads a JSON array of virtual models from a file.
+func loadVirtualModels(path string) []scheduling.VirtualModel {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Unable to read MODEL_ROUTES_FILE: %v", err)
+	}
+	var virtualModels []scheduling.VirtualModel
+	if err := json.Unmarshal(data, &virtualModels); err != nil {
+		log.Fatalf("Invalid MODEL_ROUTES_FILE: %v", err)
+	}
+	return virtualModels
+}
+
+// loadPipelines loads a JSON array of pipelines from a file.
+func loadPipelines(path string) []scheduling.Pipeline {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Unable to read PIPELINES_FILE: %v", err)
+	}
+	var pipelines []scheduling.Pipeline
+	if err := json.Unmarshal(data, &pipelines); err != nil {
+		log.Fatalf("Invalid PIPELINES_FILE: %v", err)
+	}
+	return pipelines
+}
+
+// loadQuirks loads a JSON array of model quirk rules from a file.
+func loadQuirks(path string) []quirks.Rule {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Unable to read MODEL_QUIRKS_FILE: %v", err)
+	}
+	var rules []quirks.Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		log.Fatalf("Invalid MODEL_QUIRKS_FILE: %v", err)
+	}
+	return rules
+}
+
+// loadQuotaLimits loads a JSON array of quota limits from a file.
+func loadQuotaLimits(path string) []quota.Limit {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Unable to read QUOTAS_FILE: %v", err)
+	}
+	var limits []quota.Limit
+	if err := json.Unmarshal(data, &limits); err != nil {
+		log.Fatalf("Invalid QUOTAS_FILE: %v", err)
+	}
+	return limits
+}
+
+// createChargebackExporterFromEnv creates the exporter of usage for
+// chargeback from environment variables, if exports are configured.
+func createChargebackExporterFromEnv() *chargeback.Exporter {
+	exportPath := os.Getenv("CHARGEBACK_EXPORT_PATH")
+	config := chargeback.Config{WebhookURL: os.Getenv("CHARGEBACK_EXPORT_WEBHOOK")}
+	if exportPath == "" && config.WebhookURL == "" {
+		return nil
+	}
+	if exportPath != "" {
+		blobs, err := storage.NewFilesystemBlobs(exportPath)
+		if err != nil {
+			log.Fatalf("Invalid CHARGEBACK_EXPORT_PATH: %v", err)
+		}
+		config.Storage = blobs
+	}
+	if intervalStr := os.Getenv("CHARGEBACK_EXPORT_INTERVAL"); intervalStr != "" {
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			log.Fatalf("Invalid CHARGEBACK_EXPORT_INTERVAL: %v", err)
+		}
+		config.Interval = interval
+	}
+	format, err := chargeback.ParseFormat(os.Getenv("CHARGEBACK_EXPORT_FORMAT"))
+	if err != nil {
+		log.Fatalf("Invalid CHARGEBACK_EXPORT_FORMAT: %v", err)
+	}
+	config.Format = format
+	exporter, err := chargeback.NewExporter(log.WithField("component", "chargeback"), config)
+	if err != nil {
+		log.Fatalf("Invalid chargeback export configuration: %v", err)
+	}
+	log.Infof("Exporting usage for chargeback every %s", cmp.Or(config.Interval, chargeback.DefaultInterval))
+	return exporter
+}
+
+// createProvenanceSignerFromEnv creates the signer of the provenance of
+// inference responses from environment variables, if provenance is enabled.
+func createProvenanceSignerFromEnv() *provenance.Signer {
+	// The key is read from a file if configured, e.g. a mounted secret.
+	encodedKey := os.Getenv("PROVENANCE_SIGNING_KEY")
+	if keyFile := os.Getenv("PROVENANCE_SIGNING_KEY_FILE"); keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			log.Fatalf("Invalid PROVENANCE_SIGNING_KEY_FILE: %v", err)
+		}
+		encodedKey = string(data)
+	}
+	if encodedKey == "" && os.Getenv("PROVENANCE") != "1" {
+		return nil
+	}
+
+	var key ed25519.PrivateKey
+	if encodedKey != "" {
+		var err error
+		if key, err = provenance.ParseKey(encodedKey); err != nil {
+			log.Fatalf("Invalid provenance signing key: %v", err)
+		}
+	}
+	signer, err := provenance.NewSigner(key)
+	if err != nil {
+		log.Fatalf("Unable to create provenance signer: %v", err)
+	}
+	if key == nil {
+		log.Warn("Signing response provenance with an ephemeral key, set PROVENANCE_SIGNING_KEY to keep it across restarts")
+	}
+	log.Infof("Signing response provenance with public key %s", base64.StdEncoding.EncodeToString(signer.PublicKey()))
+	return signer
+}
+
+// createPrefetchPolicyFromEnv creates the speculative prefetch policy from
+// environment variables.
+func createPrefetchPolicyFromEnv() scheduling.PrefetchPolicy {
+	var policy scheduling.PrefetchPolicy
+
+	if bytesStr := os.Getenv("PREFETCH_MEMORY_BUDGET"); bytesStr != "" {
+		bytes, err := strconv.ParseUint(bytesStr, 10, 64)
+		if err != nil {
+			log.Fatalf("PREFETCH_MEMORY_BUDGET must be a non-negative integer, got %q", bytesStr)
+		}
+		policy.MemoryBudget = bytes
+		if bytes > 0 {
+			log.Infof("Prefetching likely next models within %d bytes", bytes)
+		}
+	}
+
+	if probabilityStr := os.Getenv("PREFETCH_MIN_PROBABILITY"); probabilityStr != "" {
+		probability, err := strconv.ParseFloat(probabilityStr, 64)
+		if err != nil || probability <= 0 || probability > 1 {
+			log.Fatalf("PREFETCH_MIN_PROBABILITY must be a number in (0, 1], got %q", probabilityStr)
+		}
+		policy.MinProbability = probability
+	}
+
+	return policy
+}
+
+// createBackpressurePolicyFromEnv creates the policy for slow streaming
+// clients from environment variables.
+func createBackpressurePolicyFromEnv() scheduling.BackpressurePolicy {
+	var policy scheduling.BackpressurePolicy
+
+	if sizeStr := os.Getenv("STREAM_BUFFER_SIZE"); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size <= 0 {
+			log.Fatalf("STREAM_BUFFER_SIZE must be a positive integer, got %q", sizeStr)
+		}
+		policy.BufferSize = size
+	}
+
+	if action := os.Getenv("SLOW_CLIENT_ACTION"); action != "" {
+		policy.Action = scheduling.SlowClientAction(action)
+		if policy.Action != scheduling.SlowClientPause && policy.Action != scheduling.SlowClientDrop {
+			log.Fatalf("SLOW_CLIENT_ACTION must be %q or %q, got %q", scheduling.SlowClientPause, scheduling.SlowClientDrop, action)
+		}
+		log.Infof("Slow streaming clients are handled with action %q", action)
+	}
+
+	if timeoutStr := os.Getenv("SLOW_CLIENT_TIMEOUT"); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil || timeout < 0 {
+			log.Fatalf("SLOW_CLIENT_TIMEOUT must be a non-negative duration, got %q", timeoutStr)
+		}
+		policy.PauseTimeout = timeout
+	}
+
+	return policy
+}
+
+// createJailbreakPolicyFromEnv creates the policy for scoring incoming prompts
+// for jailbreak attempts from environment variables.
+func createJailbreakPolicyFromEnv() scheduling.JailbreakPolicy {
+	var policy scheduling.JailbreakPolicy
+
+	if action := os.Getenv("JAILBREAK_ACTION"); action != "" {
+		policy.Action = scheduling.JailbreakAction(action)
+		switch policy.Action {
+		case scheduling.JailbreakLog, scheduling.JailbreakFlag, scheduling.JailbreakBlock:
+		default:
+			log.Fatalf("JAILBREAK_ACTION must be %q, %q, or %q, got %q",
+				scheduling.JailbreakLog, scheduling.JailbreakFlag, scheduling.JailbreakBlock, action)
+		}
+		log.Infof("Prompts are scored for jailbreak attempts with action %q", action)
+	}
+
+	if thresholdStr := os.Getenv("JAILBREAK_THRESHOLD"); thresholdStr != "" {
+		threshold, err := strconv.ParseFloat(thresholdStr, 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			log.Fatalf("JAILBREAK_THRESHOLD must be a score between 0 and 1, got %q", thresholdStr)
+		}
+		policy.Threshold = threshold
+	}
+
+	return policy
+}
+
+// createRequestQueuePolicyFromEnv creates the policy limiting the requests that
+// each model serves concurrently from environment variables.
+func createRequestQueuePolicyFromEnv() scheduling.RequestQueuePolicy {
+	var policy scheduling.RequestQueuePolicy
+
+	if maxStr := os.Getenv("MAX_INFLIGHT_REQUESTS"); maxStr != "" {
+		maxInFlight, err := strconv.Atoi(maxStr)
+		if err != nil || maxInFlight < 0 {
+			log.Fatalf("MAX_INFLIGHT_REQUESTS must be a non-negative integer, got %q", maxStr)
+		}
+		policy.MaxInFlight = maxInFlight
+		if maxInFlight > 0 {
+			log.Infof("Models serve at most %d concurrent requests", maxInFlight)
+		}
+	}
+
+	if depthStr := os.Getenv("MAX_QUEUE_DEPTH"); depthStr != "" {
+		depth, err := strconv.Atoi(depthStr)
+		if err != nil || depth < 0 {
+			log.Fatalf("MAX_QUEUE_DEPTH must be a non-negative integer, got %q", depthStr)
+		}
+		policy.MaxQueueDepth = depth
+	}
+
+	if timeoutStr := os.Getenv("QUEUE_TIMEOUT"); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil || timeout < 0 {
+			log.Fatalf("QUEUE_TIMEOUT must be a non-negative duration, got %q", timeoutStr)
+		}
+		policy.QueueTimeout = timeout
+	}
+
+	return policy
+}
+
 // splitArgs splits a string into arguments, respecting quoted arguments
 func splitArgs(s string) []string {
 	var args []string
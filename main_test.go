@@ -1,8 +1,12 @@
 package main
 
 import (
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
 	"github.com/sirupsen/logrus"
@@ -106,3 +110,35 @@ func TestCreateLlamaCppConfigFromEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateServerFromEnv(t *testing.T) {
+	t.Setenv("HTTP2_MAX_CONCURRENT_STREAMS", "1000")
+	t.Setenv("HTTP_IDLE_TIMEOUT", "30s")
+	t.Setenv("HTTP_MAX_CONNECTIONS", "2")
+	server, maxConnections := createServerFromEnv(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	if server.HTTP2.MaxConcurrentStreams != 1000 || server.IdleTimeout != 30*time.Second || maxConnections != 2 {
+		t.Errorf("Unexpected server configuration: streams %d, idle timeout %s, connections %d", server.HTTP2.MaxConcurrentStreams, server.IdleTimeout, maxConnections)
+	}
+
+	// Clients with prior knowledge of HTTP/2 can use it without TLS.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go server.Serve(limitListener(ln, maxConnections))
+	defer server.Close()
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("Expected an HTTP/2 request, got %s", body)
+	}
+}
@@ -0,0 +1,299 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/files"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// BatchesPath is the path of the Batch API routes, relative to the
+	// inference prefix.
+	BatchesPath = "/v1/batches"
+
+	// maximumInputFileSize is the maximum size of a batch input file.
+	maximumInputFileSize = 200 * 1024 * 1024
+	// maximumRequestSize is the maximum size of a batch creation request.
+	maximumRequestSize = 1024 * 1024
+	// completionWindow is the only supported completion window.
+	completionWindow = "24h"
+	// completionWindowDuration is the duration of completionWindow.
+	completionWindowDuration = 24 * time.Hour
+	// maximumMetadataPairs is the maximum number of metadata key-value pairs.
+	maximumMetadataPairs = 16
+	// defaultListLimit is the default number of batches listed per page.
+	defaultListLimit = 20
+	// maximumListLimit is the maximum number of batches listed per page.
+	maximumListLimit = 100
+)
+
+// supportedEndpoints are the endpoints to which batch requests can be made.
+var supportedEndpoints = []string{"/v1/chat/completions", "/v1/completions", "/v1/embeddings"}
+
+// ErrInvalidRequest indicates that a batch creation request is invalid. If
+// returned in conjunction with an HTTP request, it should be paired with a 400
+// response status.
+var ErrInvalidRequest = errors.New("invalid batch request")
+
+// errNotCancellable indicates that a batch has already finished.
+var errNotCancellable = errors.New("batch can't be cancelled")
+
+// Scheduler serves the inference requests of batches, typically the model
+// runner's scheduler.
+type Scheduler interface {
+	http.Handler
+	// Busy returns whether other inference requests are waiting for or being
+	// served by runners, in which case batch requests wait.
+	Busy() bool
+}
+
+// CreateRequest is the body of a batch creation request.
+type CreateRequest struct {
+	// InputFileID is the ID of an uploaded file of requests.
+	InputFileID string `json:"input_file_id"`
+	// Endpoint is the endpoint to which all requests are made.
+	Endpoint string `json:"endpoint"`
+	// CompletionWindow must be "24h".
+	CompletionWindow string `json:"completion_window"`
+	// Metadata is arbitrary metadata attached to the batch.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// listResponse is the response to a list request.
+type listResponse[T any] struct {
+	Object  string `json:"object"`
+	Data    []T    `json:"data"`
+	FirstID string `json:"first_id,omitempty"`
+	LastID  string `json:"last_id,omitempty"`
+	HasMore bool   `json:"has_more"`
+}
+
+// Handler implements the Batch API.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	manager     *Manager
+	// scheduler serves the inference requests of batches.
+	scheduler Scheduler
+	// wake is signalled when a batch is created.
+	wake chan struct{}
+	// mu guards cancels.
+	mu sync.Mutex
+	// cancels maps the IDs of batches being processed to functions that
+	// cancel their processing.
+	cancels map[string]context.CancelFunc
+}
+
+// NewHandler creates a new Batch API handler whose batches are
+// served by scheduler once Run is called.
+func NewHandler(log logging.Logger, scheduler Scheduler, allowedOrigins []string, manager *Manager) *Handler {
+	h := &Handler{
+		log:       log,
+		router:    http.NewServeMux(),
+		manager:   manager,
+		scheduler: scheduler,
+		wake:      make(chan struct{}, 1),
+		cancels:   make(map[string]context.CancelFunc),
+	}
+
+	for route, handler := range h.routeHandlers() {
+		h.router.HandleFunc(route, handler)
+	}
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// routeHandlers returns the mapping of routes to their handlers.
+func (h *Handler) routeHandlers() map[string]http.HandlerFunc {
+	batches := inference.InferencePrefix + BatchesPath
+	return map[string]http.HandlerFunc{
+		"POST " + batches:                     h.handleCreateBatch,
+		"GET " + batches:                      h.handleListBatches,
+		"GET " + batches + "/{batch}":         h.handleGetBatch,
+		"POST " + batches + "/{batch}/cancel": h.handleCancelBatch,
+	}
+}
+
+// writeJSON writes a JSON response.
+func (h *Handler) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warnf("Failed to encode batch response: %v", err)
+	}
+}
+
+// writeError writes an error response with the status appropriate for err.
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, files.ErrFileNotFound), errors.Is(err, ErrBatchNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidRequest):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errNotCancellable):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		h.log.Warnf("Batch request failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) handleCreateBatch(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maximumRequestSize))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, "request too large", http.StatusBadRequest)
+		} else {
+			http.Error(w, "failed to read request body", http.StatusInternalServerError)
+		}
+		return
+	}
+	var request CreateRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	batch, err := h.Submit(request)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, batch)
+}
+
+// Submit validates and queues a batch.
+func (h *Handler) Submit(request CreateRequest) (Batch, error) {
+	if !slices.Contains(supportedEndpoints, request.Endpoint) {
+		return Batch{}, fmt.Errorf("%w: endpoint must be one of %s", ErrInvalidRequest, strings.Join(supportedEndpoints, ", "))
+	}
+	if request.CompletionWindow != completionWindow {
+		return Batch{}, fmt.Errorf("%w: completion_window must be %q", ErrInvalidRequest, completionWindow)
+	}
+	if len(request.Metadata) > maximumMetadataPairs {
+		return Batch{}, fmt.Errorf("%w: metadata can have at most %d pairs", ErrInvalidRequest, maximumMetadataPairs)
+	}
+	file, err := h.manager.files.Get(request.InputFileID)
+	if err != nil {
+		return Batch{}, err
+	}
+	if file.Purpose != files.PurposeBatch {
+		return Batch{}, fmt.Errorf("%w: input file must have purpose %q", ErrInvalidRequest, files.PurposeBatch)
+	}
+	if file.Bytes > maximumInputFileSize {
+		return Batch{}, fmt.Errorf("%w: input file can be at most %d bytes", ErrInvalidRequest, maximumInputFileSize)
+	}
+
+	now := time.Now()
+	batch := Batch{
+		ID:               utils.NewID("batch_"),
+		Object:           "batch",
+		Endpoint:         request.Endpoint,
+		InputFileID:      file.ID,
+		CompletionWindow: request.CompletionWindow,
+		Status:           StatusValidating,
+		CreatedAt:        now.Unix(),
+		ExpiresAt:        now.Add(completionWindowDuration).Unix(),
+		Metadata:         request.Metadata,
+	}
+	if err := h.manager.CreateBatch(batch); err != nil {
+		return Batch{}, err
+	}
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+	return batch, nil
+}
+
+// Batch returns a batch.
+func (h *Handler) Batch(id string) (Batch, error) {
+	return h.manager.Batch(id)
+}
+
+func (h *Handler) handleListBatches(w http.ResponseWriter, r *http.Request) {
+	limit := defaultListLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maximumListLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maximumListLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	batches := h.manager.Batches()
+	if after := r.URL.Query().Get("after"); after != "" {
+		index := slices.IndexFunc(batches, func(batch Batch) bool {
+			return batch.ID == after
+		})
+		batches = batches[index+1:]
+	}
+	response := listResponse[Batch]{Object: "list", Data: batches[:min(limit, len(batches))]}
+	response.HasMore = len(batches) > limit
+	if len(response.Data) > 0 {
+		response.FirstID = response.Data[0].ID
+		response.LastID = response.Data[len(response.Data)-1].ID
+	}
+	h.writeJSON(w, response)
+}
+
+func (h *Handler) handleGetBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := h.manager.Batch(r.PathValue("batch"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, batch)
+}
+
+func (h *Handler) handleCancelBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := h.manager.UpdateBatch(r.PathValue("batch"), func(b *Batch) error {
+		now := time.Now().Unix()
+		switch b.Status {
+		case StatusValidating:
+			// Queued batches are cancelled immediately.
+			b.Status = StatusCancelled
+			b.CancellingAt, b.CancelledAt = now, now
+		case StatusInProgress:
+			b.Status = StatusCancelling
+			b.CancellingAt = now
+		case StatusCancelling:
+		default:
+			return fmt.Errorf("%w: it's %s", errNotCancellable, b.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	// Stop the request in flight, if any.
+	h.mu.Lock()
+	if cancel := h.cancels[batch.ID]; cancel != nil {
+		cancel()
+	}
+	h.mu.Unlock()
+	h.writeJSON(w, batch)
+}
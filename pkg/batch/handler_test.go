@@ -0,0 +1,276 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/files"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/internal/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+// echoScheduler serves chat completions that echo the requested model, failing
+// requests for unknown models.
+type echoScheduler struct {
+	busy     atomic.Bool
+	requests atomic.Int64
+}
+
+func (s *echoScheduler) Busy() bool {
+	return s.busy.Load()
+}
+
+func (s *echoScheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	if r.URL.Path != inference.InferencePrefix+"/v1/chat/completions" || r.UserAgent() != userAgent {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		Model string `json:"model"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	if request.Model == "unknown" {
+		http.Error(w, "model not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"object": "chat.completion", "model": request.Model})
+}
+
+func newTestHandler(t *testing.T, dir string, scheduler Scheduler) *Handler {
+	t.Helper()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	fileManager, err := files.NewManager(log, filepath.Join(dir, "files"), files.Limits{})
+	if err != nil {
+		t.Fatalf("files.NewManager failed: %v", err)
+	}
+	manager, err := NewManager(log, filepath.Join(dir, "batches"), fileManager)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	return NewHandler(log, scheduler, nil, manager)
+}
+
+// serve performs a request and decodes a successful JSON response into v.
+func serve(t *testing.T, handler http.Handler, method, path string, body io.Reader, v any) int {
+	t.Helper()
+	return testutil.Serve(t, handler, httptest.NewRequest(method, inference.InferencePrefix+path, body), v)
+}
+
+// upload stores a batch input file.
+func upload(t *testing.T, handler *Handler, content string) files.File {
+	t.Helper()
+	file, err := handler.manager.files.Create("requests.jsonl", files.PurposeBatch, strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to store input file: %v", err)
+	}
+	return file
+}
+
+// createBatch creates a chat completions batch for an input file.
+func createBatch(t *testing.T, handler http.Handler, fileID string) Batch {
+	t.Helper()
+	var batch Batch
+	body := `{"input_file_id": "` + fileID + `", "endpoint": "/v1/chat/completions", "completion_window": "24h", "metadata": {"job": "test"}}`
+	if code := serve(t, handler, http.MethodPost, BatchesPath, strings.NewReader(body), &batch); code != http.StatusOK {
+		t.Fatalf("Expected batch creation to succeed, got status %d", code)
+	}
+	return batch
+}
+
+// waitForBatch waits for a batch to reach a final status.
+func waitForBatch(t *testing.T, handler *Handler, id string) Batch {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		batch, err := handler.manager.Batch(id)
+		if err != nil {
+			t.Fatalf("Failed to get batch: %v", err)
+		}
+		switch batch.Status {
+		case StatusCompleted, StatusFailed, StatusExpired, StatusCancelled:
+			return batch
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Batch %s didn't finish", id)
+	return Batch{}
+}
+
+// readLines reads the lines of a file's content.
+func readLines(t *testing.T, handler *Handler, fileID string) []outputLine {
+	t.Helper()
+	_, content, err := handler.manager.files.Open(fileID)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	var lines []outputLine
+	for _, encoded := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var line outputLine
+		if err := json.Unmarshal([]byte(encoded), &line); err != nil {
+			t.Fatalf("Invalid output line %q: %v", encoded, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	scheduler := &echoScheduler{}
+	handler := newTestHandler(t, dir, scheduler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handler.Run(ctx)
+
+	input := upload(t, handler, `{"custom_id": "a", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "ai/smollm2"}}
+
+{"custom_id": "b", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "unknown"}}
+`)
+	batch := waitForBatch(t, handler, createBatch(t, handler, input.ID).ID)
+	if batch.Status != StatusCompleted || batch.RequestCounts != (RequestCounts{Total: 2, Completed: 1, Failed: 1}) {
+		t.Fatalf("Unexpected batch %+v", batch)
+	}
+	if batch.Metadata["job"] != "test" || batch.CompletedAt == 0 {
+		t.Errorf("Unexpected batch metadata or timestamps %+v", batch)
+	}
+
+	output := readLines(t, handler, batch.OutputFileID)
+	if len(output) != 1 || output[0].CustomID != "a" || output[0].Response.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected output %+v", output)
+	}
+	errorLines := readLines(t, handler, batch.ErrorFileID)
+	if len(errorLines) != 1 || errorLines[0].CustomID != "b" || errorLines[0].Response.StatusCode != http.StatusNotFound {
+		t.Fatalf("Unexpected errors %+v", errorLines)
+	}
+	var errorBody struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(errorLines[0].Response.Body, &errorBody); err != nil || errorBody.Error.Message != "model not found" {
+		t.Errorf("Expected the text error to be wrapped, got %s", errorLines[0].Response.Body)
+	}
+
+	if outputs := handler.manager.files.List(files.PurposeBatchOutput); len(outputs) != 2 {
+		t.Errorf("Expected 2 output files, got %d", len(outputs))
+	}
+	var batches listResponse[Batch]
+	serve(t, handler, http.MethodGet, BatchesPath+"?limit=1", nil, &batches)
+	if len(batches.Data) != 1 || batches.FirstID != batch.ID || batches.HasMore {
+		t.Errorf("Unexpected batch list %+v", batches)
+	}
+
+	// Finished batches can't be cancelled.
+	if code := serve(t, handler, http.MethodPost, BatchesPath+"/"+batch.ID+"/cancel", nil, nil); code != http.StatusConflict {
+		t.Errorf("Expected status 409 when cancelling a finished batch, got %d", code)
+	}
+
+	// Batches are persisted.
+	reloaded := newTestHandler(t, dir, scheduler)
+	if persisted, err := reloaded.manager.Batch(batch.ID); err != nil || persisted.Status != StatusCompleted {
+		t.Errorf("Expected the batch to be persisted, got %+v (%v)", persisted, err)
+	}
+}
+
+func TestBatchValidation(t *testing.T) {
+	handler := newTestHandler(t, t.TempDir(), &echoScheduler{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handler.Run(ctx)
+
+	input := upload(t, handler, `{"custom_id": "a", "method": "POST", "url": "/v1/embeddings", "body": {"model": "ai/smollm2"}}`)
+	batch := waitForBatch(t, handler, createBatch(t, handler, input.ID).ID)
+	if batch.Status != StatusFailed || batch.Errors == nil || batch.Errors.Data[0].Code != "invalid_url" {
+		t.Errorf("Expected the batch to fail validation, got %+v", batch)
+	}
+
+	for _, body := range []string{
+		`{"input_file_id": "` + input.ID + `", "endpoint": "/v1/images", "completion_window": "24h"}`,
+		`{"input_file_id": "` + input.ID + `", "endpoint": "/v1/chat/completions", "completion_window": "1h"}`,
+	} {
+		if code := serve(t, handler, http.MethodPost, BatchesPath, strings.NewReader(body), nil); code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, code)
+		}
+	}
+	body := `{"input_file_id": "file-missing", "endpoint": "/v1/chat/completions", "completion_window": "24h"}`
+	if code := serve(t, handler, http.MethodPost, BatchesPath, strings.NewReader(body), nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing input file, got %d", code)
+	}
+	attachment, err := handler.manager.files.Create("notes.txt", files.PurposeUserData, strings.NewReader("notes"))
+	if err != nil {
+		t.Fatalf("Failed to store file: %v", err)
+	}
+	body = `{"input_file_id": "` + attachment.ID + `", "endpoint": "/v1/chat/completions", "completion_window": "24h"}`
+	if code := serve(t, handler, http.MethodPost, BatchesPath, strings.NewReader(body), nil); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an input file without the batch purpose, got %d", code)
+	}
+}
+
+func TestBatchCancellation(t *testing.T) {
+	dir := t.TempDir()
+	scheduler := &echoScheduler{}
+	scheduler.busy.Store(true)
+	handler := newTestHandler(t, dir, scheduler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handler.Run(ctx)
+
+	// Batch requests wait while the scheduler is busy.
+	input := upload(t, handler, `{"custom_id": "a", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "ai/smollm2"}}`)
+	batch := createBatch(t, handler, input.ID)
+	deadline := time.Now().Add(5 * time.Second)
+	for batch.Status != StatusInProgress && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		batch, _ = handler.manager.Batch(batch.ID)
+	}
+	if batch.Status != StatusInProgress || scheduler.requests.Load() != 0 {
+		t.Fatalf("Expected the batch to wait for the scheduler, got %+v", batch)
+	}
+
+	var cancelled Batch
+	if code := serve(t, handler, http.MethodPost, BatchesPath+"/"+batch.ID+"/cancel", nil, &cancelled); code != http.StatusOK {
+		t.Fatalf("Expected cancellation to succeed, got status %d", code)
+	}
+	if cancelled.Status != StatusCancelling {
+		t.Errorf("Expected the batch to be cancelling, got %s", cancelled.Status)
+	}
+	batch = waitForBatch(t, handler, batch.ID)
+	if batch.Status != StatusCancelled || batch.OutputFileID != "" || scheduler.requests.Load() != 0 {
+		t.Errorf("Expected the batch to be cancelled without requests, got %+v", batch)
+	}
+}
+
+func TestInterruptedBatchRestarts(t *testing.T) {
+	dir := t.TempDir()
+	handler := newTestHandler(t, dir, &echoScheduler{})
+	input := upload(t, handler, `{"custom_id": "a", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "ai/smollm2"}}`)
+	batch := createBatch(t, handler, input.ID)
+	if _, err := handler.manager.UpdateBatch(batch.ID, func(b *Batch) error {
+		b.Status = StatusInProgress
+		b.RequestCounts = RequestCounts{Total: 1, Completed: 1}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to update batch: %v", err)
+	}
+
+	reloaded := newTestHandler(t, dir, &echoScheduler{})
+	if restarted, _ := reloaded.manager.Batch(batch.ID); restarted.Status != StatusValidating || restarted.RequestCounts != (RequestCounts{}) {
+		t.Errorf("Expected the interrupted batch to be queued again, got %+v", restarted)
+	}
+}
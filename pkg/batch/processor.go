@@ -0,0 +1,445 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/docker/model-runner/pkg/files"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/internal/utils"
+)
+
+const (
+	// maximumBatchRequests is the maximum number of requests in a batch.
+	maximumBatchRequests = 50000
+	// maximumValidationErrors is the maximum number of validation errors
+	// reported for a batch.
+	maximumValidationErrors = 100
+	// idlePollInterval is the interval at which a busy scheduler is polled
+	// before issuing a batch request.
+	idlePollInterval = time.Second
+	// retryInterval is the time after which a batch that couldn't be started
+	// is retried.
+	retryInterval = time.Minute
+	// userAgent identifies batch requests in usage analytics.
+	userAgent = "model-runner-batch"
+)
+
+// errNotQueued indicates that a batch was cancelled before it started.
+var errNotQueued = errors.New("batch is no longer queued")
+
+// inputRequest is a request in a batch input file.
+type inputRequest struct {
+	// CustomID identifies the request's response in the output files.
+	CustomID string `json:"custom_id"`
+	// Method is the request's HTTP method, which must be POST.
+	Method string `json:"method"`
+	// URL is the request's endpoint, which must be the batch's endpoint.
+	URL string `json:"url"`
+	// Body is the request's body.
+	Body json.RawMessage `json:"body"`
+}
+
+// outputResponse is the response to a request in a batch output file.
+type outputResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// outputError describes a request that wasn't made.
+type outputError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// outputLine is a line of a batch output or error file.
+type outputLine struct {
+	ID       string          `json:"id"`
+	CustomID string          `json:"custom_id"`
+	Response *outputResponse `json:"response"`
+	Error    *outputError    `json:"error"`
+}
+
+// parseRequests reads and validates the requests of a batch input file, all of
+// which must be made to the specified endpoint.
+func parseRequests(r io.Reader, endpoint string) ([]inputRequest, []Error) {
+	var requests []inputRequest
+	var errs []Error
+	fail := func(line int, code, format string, args ...any) {
+		if len(errs) < maximumValidationErrors {
+			errs = append(errs, Error{Code: code, Message: fmt.Sprintf(format, args...), Line: line})
+		}
+	}
+
+	customIDs := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maximumInputFileSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var request inputRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			fail(line, "invalid_json_line", "line isn't a valid JSON object")
+			continue
+		}
+		if request.CustomID == "" {
+			fail(line, "missing_custom_id", "custom_id is required")
+		} else if customIDs[request.CustomID] {
+			fail(line, "duplicate_custom_id", "custom_id %q is used by an earlier request", request.CustomID)
+		}
+		customIDs[request.CustomID] = true
+		if request.Method != http.MethodPost {
+			fail(line, "invalid_method", "method must be POST")
+		}
+		if request.URL != endpoint {
+			fail(line, "invalid_url", "url must be the batch's endpoint, %s", endpoint)
+		}
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		if err := json.Unmarshal(request.Body, &body); err != nil {
+			fail(line, "invalid_body", "body must be a JSON object")
+		} else if body.Model == "" {
+			fail(line, "missing_model", "body must specify a model")
+		} else if body.Stream {
+			fail(line, "invalid_body", "streaming isn't supported in batches")
+		}
+		requests = append(requests, request)
+	}
+	if err := scanner.Err(); err != nil {
+		fail(0, "invalid_file", "unable to read input file: %v", err)
+	} else if len(requests) == 0 {
+		fail(0, "empty_file", "input file contains no requests")
+	} else if len(requests) > maximumBatchRequests {
+		fail(0, "too_many_requests", "batches can contain at most %d requests", maximumBatchRequests)
+	}
+	return requests, errs
+}
+
+// Run processes queued batches one at a time until the context is cancelled.
+// Batches interrupted by cancellation are processed again from the start by
+// the next manager.
+func (h *Handler) Run(ctx context.Context) {
+	for {
+		batch, ok := h.manager.nextBatch()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.wake:
+			}
+			continue
+		}
+		if err := h.process(ctx, batch); err != nil {
+			h.log.Warnf("Unable to process batch %s: %v", batch.ID, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// process validates and processes a queued batch.
+func (h *Handler) process(ctx context.Context, batch Batch) error {
+	requests, errs := h.readRequests(batch)
+	if len(errs) > 0 {
+		_, err := h.manager.UpdateBatch(batch.ID, func(b *Batch) error {
+			if b.Status != StatusValidating {
+				return errNotQueued
+			}
+			b.Status = StatusFailed
+			b.FailedAt = time.Now().Unix()
+			b.Errors = &Errors{Object: "list", Data: errs}
+			return nil
+		})
+		if errors.Is(err, errNotQueued) {
+			return nil
+		}
+		return err
+	}
+
+	// Register the cancellation of the batch before it's in progress, so that
+	// it can always be cancelled once it is.
+	batchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	h.setCancel(batch.ID, cancel)
+	defer h.setCancel(batch.ID, nil)
+
+	batch, err := h.manager.UpdateBatch(batch.ID, func(b *Batch) error {
+		if b.Status != StatusValidating {
+			return errNotQueued
+		}
+		b.Status = StatusInProgress
+		b.InProgressAt = time.Now().Unix()
+		b.RequestCounts = RequestCounts{Total: len(requests)}
+		return nil
+	})
+	if errors.Is(err, errNotQueued) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	h.log.Infof("Processing batch %s with %d requests", batch.ID, len(requests))
+
+	processErr := h.processRequests(ctx, batchCtx, batch, requests)
+	if processErr == nil {
+		return nil
+	}
+	// Fail the batch rather than leaving it in progress.
+	h.log.Warnf("Batch %s failed: %v", batch.ID, processErr)
+	_, err = h.manager.UpdateBatch(batch.ID, func(b *Batch) error {
+		b.Status = StatusFailed
+		b.FailedAt = time.Now().Unix()
+		b.Errors = &Errors{Object: "list", Data: []Error{{Code: "internal_error", Message: processErr.Error()}}}
+		return nil
+	})
+	return err
+}
+
+// processRequests makes the requests of a batch that's in progress and
+// finalizes it. If ctx is cancelled, the batch is left in progress, whereas
+// it's cancelled if only batchCtx is.
+func (h *Handler) processRequests(ctx, batchCtx context.Context, batch Batch, requests []inputRequest) error {
+	output, err := newOutputFile(h.manager.files, batch.ID+"-output")
+	if err != nil {
+		return err
+	}
+	defer output.discard()
+	errorOutput, err := newOutputFile(h.manager.files, batch.ID+"-errors")
+	if err != nil {
+		return err
+	}
+	defer errorOutput.discard()
+
+	status := StatusCompleted
+	counts := batch.RequestCounts
+	for i, request := range requests {
+		if current, err := h.manager.Batch(batch.ID); err != nil || current.Status == StatusCancelling {
+			status = StatusCancelled
+			break
+		}
+		if time.Now().Unix() >= batch.ExpiresAt {
+			for _, expired := range requests[i:] {
+				err = errorOutput.write(outputLine{
+					ID:       utils.NewID("batch_req_"),
+					CustomID: expired.CustomID,
+					Error: &outputError{
+						Code:    "batch_expired",
+						Message: "the request wasn't made before the batch's completion window expired",
+					},
+				})
+				if err != nil {
+					return err
+				}
+				counts.Failed++
+			}
+			status = StatusExpired
+			break
+		}
+
+		if !h.waitForIdle(batchCtx) {
+			if ctx.Err() != nil {
+				return nil
+			}
+			status = StatusCancelled
+			break
+		}
+		line, ok := h.serve(batchCtx, request)
+		if ctx.Err() != nil {
+			return nil
+		} else if batchCtx.Err() != nil {
+			status = StatusCancelled
+			break
+		}
+		if ok {
+			err = output.write(line)
+			counts.Completed++
+		} else {
+			err = errorOutput.write(line)
+			counts.Failed++
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := h.manager.UpdateBatch(batch.ID, func(b *Batch) error {
+			b.RequestCounts = counts
+			return nil
+		}); err != nil {
+			h.log.Warnf("Unable to update the progress of batch %s: %v", batch.ID, err)
+		}
+	}
+
+	if _, err := h.manager.UpdateBatch(batch.ID, func(b *Batch) error {
+		b.Status = StatusFinalizing
+		b.FinalizingAt = time.Now().Unix()
+		return nil
+	}); err != nil {
+		return err
+	}
+	outputFileID, err := output.add(h.manager.files, batch.ID+"_output.jsonl")
+	if err != nil {
+		return err
+	}
+	errorFileID, err := errorOutput.add(h.manager.files, batch.ID+"_error.jsonl")
+	if err != nil {
+		return err
+	}
+	_, err = h.manager.UpdateBatch(batch.ID, func(b *Batch) error {
+		now := time.Now().Unix()
+		b.Status = status
+		switch status {
+		case StatusCompleted:
+			b.CompletedAt = now
+		case StatusExpired:
+			b.ExpiredAt = now
+		case StatusCancelled:
+			b.CancelledAt = now
+		}
+		b.OutputFileID = outputFileID
+		b.ErrorFileID = errorFileID
+		b.RequestCounts = counts
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.log.Infof("Batch %s %s with %d completed and %d failed requests", batch.ID, status, counts.Completed, counts.Failed)
+	return nil
+}
+
+// readRequests reads and validates the requests of a batch's input file.
+func (h *Handler) readRequests(batch Batch) ([]inputRequest, []Error) {
+	_, content, err := h.manager.files.Open(batch.InputFileID)
+	if err != nil {
+		return nil, []Error{{Code: "invalid_file", Message: fmt.Sprintf("unable to open input file: %v", err)}}
+	}
+	defer content.Close()
+	return parseRequests(content, batch.Endpoint)
+}
+
+// waitForIdle waits until the scheduler isn't serving other inference
+// requests, returning false if the context is cancelled first.
+func (h *Handler) waitForIdle(ctx context.Context) bool {
+	for h.scheduler.Busy() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(idlePollInterval):
+		}
+	}
+	return ctx.Err() == nil
+}
+
+// serve makes a batch request, returning its output line and whether it
+// succeeded.
+func (h *Handler) serve(ctx context.Context, request inputRequest) (outputLine, bool) {
+	line := outputLine{ID: utils.NewID("batch_req_"), CustomID: request.CustomID}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, inference.InferencePrefix+request.URL, bytes.NewReader(request.Body))
+	if err != nil {
+		line.Error = &outputError{Code: "invalid_request", Message: err.Error()}
+		return line, false
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", userAgent)
+
+	recorder := utils.NewResponseRecorder()
+	h.scheduler.ServeHTTP(recorder, r)
+	body := bytes.TrimSpace(recorder.Body.Bytes())
+	if !json.Valid(body) {
+		// Errors are typically reported as text, so wrap them like OpenAI's.
+		body, _ = json.Marshal(map[string]any{
+			"error": map[string]string{"message": string(body)},
+		})
+	}
+	line.Response = &outputResponse{
+		StatusCode: recorder.StatusCode,
+		RequestID:  utils.NewID("req_"),
+		Body:       body,
+	}
+	return line, recorder.StatusCode == http.StatusOK
+}
+
+// setCancel registers (or, if cancel is nil, unregisters) the function that
+// cancels the processing of a batch.
+func (h *Handler) setCancel(id string, cancel context.CancelFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cancel == nil {
+		delete(h.cancels, id)
+	} else {
+		h.cancels[id] = cancel
+	}
+}
+
+// outputFile is a batch output or error file being written.
+type outputFile struct {
+	// file is the temporary file holding the output.
+	file *os.File
+	// writer buffers writes to file.
+	writer *bufio.Writer
+	// lines is the number of lines written.
+	lines int
+}
+
+// newOutputFile creates a temporary output file.
+func newOutputFile(m *files.Manager, name string) (*outputFile, error) {
+	file, err := m.CreateTemporary(name)
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// write appends a line to the output.
+func (o *outputFile) write(line outputLine) error {
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("unable to encode output: %w", err)
+	}
+	if _, err := o.writer.Write(append(encoded, '\n')); err != nil {
+		return fmt.Errorf("unable to write output: %w", err)
+	}
+	o.lines++
+	return nil
+}
+
+// add adds the output as a file with the specified name, returning its ID,
+// or an empty ID if the output is empty.
+func (o *outputFile) add(m *files.Manager, filename string) (string, error) {
+	if o.lines == 0 {
+		return "", nil
+	}
+	if err := o.writer.Flush(); err != nil {
+		return "", fmt.Errorf("unable to write output: %w", err)
+	}
+	if err := o.file.Close(); err != nil {
+		return "", fmt.Errorf("unable to write output: %w", err)
+	}
+	file, err := m.Add(o.file.Name(), filename, files.PurposeBatchOutput)
+	if err != nil {
+		return "", err
+	}
+	return file.ID, nil
+}
+
+// discard removes the output if it wasn't added as a file.
+func (o *outputFile) discard() {
+	o.file.Close()
+	os.Remove(o.file.Name())
+}
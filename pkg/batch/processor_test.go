@@ -0,0 +1,52 @@
+package batch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		requests int
+		codes    []string
+	}{
+		{
+			name: "valid requests",
+			input: `{"custom_id": "a", "method": "POST", "url": "/v1/embeddings", "body": {"model": "ai/embed", "input": "a"}}
+{"custom_id": "b", "method": "POST", "url": "/v1/embeddings", "body": {"model": "ai/embed", "input": "b"}}`,
+			requests: 2,
+		},
+		{
+			name:  "empty file",
+			input: "\n\n",
+			codes: []string{"empty_file"},
+		},
+		{
+			name: "invalid lines",
+			input: `not json
+{"method": "POST", "url": "/v1/embeddings", "body": {"model": "ai/embed"}}
+{"custom_id": "a", "method": "GET", "url": "/v1/chat/completions", "body": []}
+{"custom_id": "a", "method": "POST", "url": "/v1/embeddings", "body": {}}
+{"custom_id": "b", "method": "POST", "url": "/v1/embeddings", "body": {"model": "ai/embed", "stream": true}}`,
+			requests: 4,
+			codes:    []string{"invalid_json_line", "missing_custom_id", "invalid_method", "invalid_url", "invalid_body", "duplicate_custom_id", "missing_model", "invalid_body"},
+		},
+	}
+	for _, tt := range tests {
+		requests, errs := parseRequests(strings.NewReader(tt.input), "/v1/embeddings")
+		if len(requests) != tt.requests {
+			t.Errorf("%s: expected %d requests, got %d", tt.name, tt.requests, len(requests))
+		}
+		if len(errs) != len(tt.codes) {
+			t.Errorf("%s: expected errors %v, got %+v", tt.name, tt.codes, errs)
+			continue
+		}
+		for i, code := range tt.codes {
+			if errs[i].Code != code {
+				t.Errorf("%s: expected error %d to be %s, got %+v", tt.name, i, code, errs[i])
+			}
+		}
+	}
+}
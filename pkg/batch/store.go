@@ -0,0 +1,265 @@
+// Package batch implements the OpenAI Batch API, which processes files of
+// inference requests against local models in the background.
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/files"
+	"github.com/docker/model-runner/pkg/internal/jsonutil"
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/logging"
+)
+
+// ErrBatchNotFound indicates that a batch doesn't exist. If returned in
+// conjunction with an HTTP request, it should be paired with a 404 response
+// status.
+var ErrBatchNotFound = errors.New("batch not found")
+
+// Batch statuses.
+const (
+	// StatusValidating indicates that a batch is queued and its input file
+	// hasn't been validated yet.
+	StatusValidating = "validating"
+	// StatusFailed indicates that a batch's input file failed validation.
+	StatusFailed = "failed"
+	// StatusInProgress indicates that a batch's requests are being processed.
+	StatusInProgress = "in_progress"
+	// StatusFinalizing indicates that a batch's output files are being
+	// created.
+	StatusFinalizing = "finalizing"
+	// StatusCompleted indicates that all of a batch's requests have been
+	// processed. Individual requests may still have failed.
+	StatusCompleted = "completed"
+	// StatusExpired indicates that a batch wasn't completed within its
+	// completion window.
+	StatusExpired = "expired"
+	// StatusCancelling indicates that a batch is being cancelled.
+	StatusCancelling = "cancelling"
+	// StatusCancelled indicates that a batch was cancelled.
+	StatusCancelled = "cancelled"
+)
+
+// RequestCounts counts the requests of a batch.
+type RequestCounts struct {
+	// Total is the number of requests in the batch.
+	Total int `json:"total"`
+	// Completed is the number of requests that succeeded.
+	Completed int `json:"completed"`
+	// Failed is the number of requests that failed.
+	Failed int `json:"failed"`
+}
+
+// Error describes why a batch failed validation.
+type Error struct {
+	// Code identifies the kind of error.
+	Code string `json:"code"`
+	// Message describes the error.
+	Message string `json:"message"`
+	// Line is the input file line that caused the error, if any.
+	Line int `json:"line,omitempty"`
+}
+
+// Errors lists the errors of a batch.
+type Errors struct {
+	// Object is always "list".
+	Object string `json:"object"`
+	// Data are the errors.
+	Data []Error `json:"data"`
+}
+
+// Batch describes a batch.
+type Batch struct {
+	// ID is the batch's identifier.
+	ID string `json:"id"`
+	// Object is always "batch".
+	Object string `json:"object"`
+	// Endpoint is the endpoint to which all of the batch's requests are
+	// made.
+	Endpoint string `json:"endpoint"`
+	// Errors are the batch's validation errors.
+	Errors *Errors `json:"errors"`
+	// InputFileID is the ID of the file holding the batch's requests.
+	InputFileID string `json:"input_file_id"`
+	// CompletionWindow is the time frame within which the batch should be
+	// processed.
+	CompletionWindow string `json:"completion_window"`
+	// Status is the batch's status.
+	Status string `json:"status"`
+	// OutputFileID is the ID of the file holding the responses of successful
+	// requests.
+	OutputFileID string `json:"output_file_id,omitempty"`
+	// ErrorFileID is the ID of the file holding the responses of failed
+	// requests.
+	ErrorFileID string `json:"error_file_id,omitempty"`
+	// CreatedAt is the batch's creation time as a Unix timestamp.
+	CreatedAt int64 `json:"created_at"`
+	// InProgressAt is the time at which processing started.
+	InProgressAt int64 `json:"in_progress_at,omitempty"`
+	// ExpiresAt is the time at which the batch expires.
+	ExpiresAt int64 `json:"expires_at"`
+	// FinalizingAt is the time at which finalization started.
+	FinalizingAt int64 `json:"finalizing_at,omitempty"`
+	// CompletedAt is the time at which the batch completed.
+	CompletedAt int64 `json:"completed_at,omitempty"`
+	// FailedAt is the time at which the batch failed.
+	FailedAt int64 `json:"failed_at,omitempty"`
+	// ExpiredAt is the time at which the batch expired.
+	ExpiredAt int64 `json:"expired_at,omitempty"`
+	// CancellingAt is the time at which cancellation was requested.
+	CancellingAt int64 `json:"cancelling_at,omitempty"`
+	// CancelledAt is the time at which the batch was cancelled.
+	CancelledAt int64 `json:"cancelled_at,omitempty"`
+	// RequestCounts counts the batch's requests.
+	RequestCounts RequestCounts `json:"request_counts"`
+	// Metadata is arbitrary metadata attached to the batch.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Manager manages the batches persisted in a directory, each in <id>.json.
+type Manager struct {
+	// dir is the directory holding batches.
+	dir string
+	// files stores the batches' input and output files.
+	files *files.Manager
+	// mu guards batches.
+	mu sync.Mutex
+	// batches maps batch IDs to batches.
+	batches map[string]Batch
+}
+
+// NewManager creates a manager for the batches in the specified directory,
+// creating it if necessary, whose input and output files are stored by fileManager.
+// Batches that can't be loaded are logged and skipped. Batches that were being
+// processed when the model runner stopped are queued to be processed again
+// from the start.
+func NewManager(log logging.Logger, dir string, fileManager *files.Manager) (*Manager, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create batches directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read batches directory: %w", err)
+	}
+
+	m := &Manager{dir: dir, files: fileManager, batches: make(map[string]Batch)}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.Contains(name, utils.TemporarySuffix) {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if filepath.Ext(name) != ".json" {
+			continue
+		}
+		var batch Batch
+		if err := jsonutil.ReadFile(filepath.Join(dir, name), &batch); err != nil {
+			log.Warnf("Skipping batch %s: %v", name, err)
+			continue
+		}
+		switch batch.Status {
+		case StatusInProgress, StatusFinalizing:
+			log.Infof("Restarting interrupted batch %s", batch.ID)
+			batch.Status = StatusValidating
+			batch.InProgressAt, batch.FinalizingAt = 0, 0
+			batch.RequestCounts = RequestCounts{}
+		case StatusCancelling:
+			batch.Status = StatusCancelled
+			batch.CancelledAt = time.Now().Unix()
+		}
+		if err := m.saveBatch(batch); err != nil {
+			log.Warnf("Unable to update batch %s: %v", batch.ID, err)
+		}
+		m.batches[batch.ID] = batch
+	}
+	return m, nil
+}
+
+// CreateBatch persists a new batch.
+func (m *Manager) CreateBatch(batch Batch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.saveBatch(batch); err != nil {
+		return err
+	}
+	m.batches[batch.ID] = batch
+	return nil
+}
+
+// Batches returns all batches, newest first.
+func (m *Manager) Batches() []Batch {
+	m.mu.Lock()
+	batches := make([]Batch, 0, len(m.batches))
+	for _, batch := range m.batches {
+		batches = append(batches, batch)
+	}
+	m.mu.Unlock()
+	slices.SortFunc(batches, func(a, b Batch) int {
+		if a.CreatedAt != b.CreatedAt {
+			return int(b.CreatedAt - a.CreatedAt)
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	return batches
+}
+
+// Batch returns a batch.
+func (m *Manager) Batch(id string) (Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	batch, ok := m.batches[id]
+	if !ok {
+		return Batch{}, ErrBatchNotFound
+	}
+	return batch, nil
+}
+
+// UpdateBatch modifies and persists a batch, returning the updated batch.
+// If update returns an error, the batch isn't modified.
+func (m *Manager) UpdateBatch(id string, update func(*Batch) error) (Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	batch, ok := m.batches[id]
+	if !ok {
+		return Batch{}, ErrBatchNotFound
+	}
+	batch.Metadata = maps.Clone(batch.Metadata)
+	if err := update(&batch); err != nil {
+		return Batch{}, err
+	}
+	if err := m.saveBatch(batch); err != nil {
+		return Batch{}, err
+	}
+	m.batches[id] = batch
+	return batch, nil
+}
+
+// nextBatch returns the oldest queued batch.
+func (m *Manager) nextBatch() (Batch, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var next *Batch
+	for _, batch := range m.batches {
+		if batch.Status == StatusValidating && (next == nil || batch.CreatedAt < next.CreatedAt ||
+			(batch.CreatedAt == next.CreatedAt && batch.ID < next.ID)) {
+			next = &batch
+		}
+	}
+	if next == nil {
+		return Batch{}, false
+	}
+	return *next, true
+}
+
+// saveBatch persists a batch. The caller must hold the manager's lock.
+func (m *Manager) saveBatch(batch Batch) error {
+	return jsonutil.WriteFile(filepath.Join(m.dir, batch.ID+".json"), batch)
+}
@@ -0,0 +1,354 @@
+// Package chaos injects faults into inference responses, such as artificial
+// latency, dropped connections, malformed chunks, and server errors, at
+// configurable rates per model, so that application developers can harden
+// their clients against the model runner.
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+const (
+	// maximumLatency is the longest latency that can be injected.
+	maximumLatency = 5 * time.Minute
+	// maximumRequestSize is the maximum size of an inference request body
+	// inspected for its model.
+	maximumRequestSize = 16 * 1024 * 1024
+	// maximumDropWrites is the maximum number of response writes passed
+	// through before a dropped connection is cut.
+	maximumDropWrites = 3
+
+	// FaultLatency, FaultError, FaultDrop, and FaultMalformed are the kinds of
+	// injected faults.
+	FaultLatency   = "latency"
+	FaultError     = "error"
+	FaultDrop      = "drop"
+	FaultMalformed = "malformed"
+)
+
+// inferenceSuffixes are the path suffixes of the inference routes into which
+// faults are injected.
+var inferenceSuffixes = []string{
+	"/chat/completions",
+	"/completions",
+	"/embeddings",
+	"/rerank",
+	"/score",
+	"/api/chat",
+	"/api/generate",
+}
+
+// Faults are the faults injected into a model's responses. Each rate is the
+// probability, between 0 and 1, that a request is affected.
+type Faults struct {
+	// LatencyRate is the rate at which Latency (e.g. "2s") is added before
+	// requests are served.
+	LatencyRate float64 `json:"latency_rate,omitempty"`
+	Latency     string  `json:"latency,omitempty"`
+	// ErrorRate is the rate at which requests fail with ErrorStatus, which
+	// defaults to 503.
+	ErrorRate   float64 `json:"error_rate,omitempty"`
+	ErrorStatus int     `json:"error_status,omitempty"`
+	// DropRate is the rate at which connections are dropped partway through
+	// their responses.
+	DropRate float64 `json:"drop_rate,omitempty"`
+	// MalformedRate is the rate at which one chunk of a response, typically a
+	// server-sent event, is replaced with invalid JSON.
+	MalformedRate float64 `json:"malformed_rate,omitempty"`
+
+	// latency is the parsed Latency.
+	latency time.Duration
+}
+
+// validate checks that the faults are well-formed and parses their latency.
+func (f *Faults) validate() error {
+	for name, rate := range map[string]float64{
+		"latency_rate":   f.LatencyRate,
+		"error_rate":     f.ErrorRate,
+		"drop_rate":      f.DropRate,
+		"malformed_rate": f.MalformedRate,
+	} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s must be between 0 and 1", name)
+		}
+	}
+	if f.Latency != "" {
+		latency, err := time.ParseDuration(f.Latency)
+		if err != nil || latency < 0 || latency > maximumLatency {
+			return fmt.Errorf("latency must be a non-negative duration of at most %s", maximumLatency)
+		}
+		f.latency = latency
+	} else if f.LatencyRate > 0 {
+		return errors.New("latency is required with latency_rate")
+	}
+	if f.ErrorStatus == 0 {
+		f.ErrorStatus = http.StatusServiceUnavailable
+	} else if f.ErrorStatus < 500 || f.ErrorStatus > 599 {
+		return errors.New("error_status must be a 5xx status code")
+	}
+	return nil
+}
+
+// Config is the fault injection configuration.
+type Config struct {
+	// Default are the faults injected into the responses of models without
+	// their own faults.
+	Default *Faults `json:"default,omitempty"`
+	// Models are the faults injected into the responses of specific models.
+	Models map[string]*Faults `json:"models,omitempty"`
+}
+
+// Normalize validates the configuration and normalizes its model names.
+func (c *Config) Normalize() error {
+	if c.Default != nil {
+		if err := c.Default.validate(); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	normalized := make(map[string]*Faults, len(c.Models))
+	for model, faults := range c.Models {
+		if faults == nil {
+			return fmt.Errorf("%s: faults are required", model)
+		}
+		if err := faults.validate(); err != nil {
+			return fmt.Errorf("%s: %w", model, err)
+		}
+		normalized[models.NormalizeModelName(model)] = faults
+	}
+	c.Models = normalized
+	return nil
+}
+
+// lookup returns the faults injected into a model's responses, or nil if
+// there are none.
+func (c *Config) lookup(model string) *Faults {
+	if faults, ok := c.Models[models.NormalizeModelName(model)]; ok {
+		return faults
+	}
+	return c.Default
+}
+
+// Status reports the fault injection configuration and the number of faults
+// injected so far, by kind.
+type Status struct {
+	Config   Config         `json:"config"`
+	Injected map[string]int `json:"injected"`
+}
+
+// Injector injects faults into inference responses.
+type Injector struct {
+	// mutex guards the subsequent fields.
+	mutex    sync.Mutex
+	config   Config
+	injected map[string]int
+	rng      *mathrand.Rand
+}
+
+// NewInjector creates an injector that doesn't inject any faults until it's
+// configured.
+func NewInjector() *Injector {
+	return &Injector{
+		injected: make(map[string]int),
+		rng:      mathrand.New(mathrand.NewPCG(uint64(time.Now().UnixNano()), 0)),
+	}
+}
+
+// Configure replaces the injector's configuration, which must have been
+// normalized.
+func (i *Injector) Configure(config Config) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.config = config
+}
+
+// Status returns the injector's configuration and counts of injected faults.
+func (i *Injector) Status() Status {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return Status{Config: i.config, Injected: maps.Clone(i.injected)}
+}
+
+// plan is the set of faults injected into a request.
+type plan struct {
+	latency     time.Duration
+	errorStatus int
+	drop        bool
+	malformed   bool
+	// dropWrites is the number of response writes passed through before a
+	// dropped connection is cut.
+	dropWrites int
+	// malformedSkip is the number of JSON chunks passed through before one is
+	// malformed.
+	malformedSkip int
+}
+
+// plan draws the faults injected into a request for model, counting them.
+func (i *Injector) plan(model string) plan {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	faults := i.config.lookup(model)
+	if faults == nil {
+		return plan{}
+	}
+	var p plan
+	if faults.LatencyRate > 0 && i.rng.Float64() < faults.LatencyRate {
+		p.latency = faults.latency
+		i.injected[FaultLatency]++
+	}
+	if faults.ErrorRate > 0 && i.rng.Float64() < faults.ErrorRate {
+		p.errorStatus = faults.ErrorStatus
+		i.injected[FaultError]++
+		return p
+	}
+	if faults.DropRate > 0 && i.rng.Float64() < faults.DropRate {
+		p.drop = true
+		p.dropWrites = 1 + i.rng.IntN(maximumDropWrites)
+		i.injected[FaultDrop]++
+	}
+	if faults.MalformedRate > 0 && i.rng.Float64() < faults.MalformedRate {
+		p.malformed = true
+		p.malformedSkip = i.rng.IntN(3)
+		i.injected[FaultMalformed]++
+	}
+	return p
+}
+
+// isInferenceRequest returns whether faults may be injected into a request.
+func isInferenceRequest(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	for _, suffix := range inferenceSuffixes {
+		if strings.HasSuffix(r.URL.Path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware returns a handler that injects faults into the inference
+// responses of next.
+func (i *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isInferenceRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maximumRequestSize+1))
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusInternalServerError)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var request struct {
+			Model string `json:"model"`
+		}
+		if len(body) > maximumRequestSize || json.Unmarshal(body, &request) != nil || request.Model == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p := i.plan(request.Model)
+		if p.latency > 0 {
+			select {
+			case <-time.After(p.latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if p.errorStatus != 0 {
+			http.Error(w, fmt.Sprintf("injected fault: %s", http.StatusText(p.errorStatus)), p.errorStatus)
+			return
+		}
+		if !p.drop && !p.malformed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		writer := &faultWriter{ResponseWriter: w, plan: p, cancel: cancel}
+		next.ServeHTTP(writer, r.WithContext(ctx))
+		if p.drop {
+			// Abort the response, which closes the connection without
+			// completing it.
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// errDropped is returned by writes to dropped responses.
+var errDropped = errors.New("connection dropped by fault injection")
+
+// faultWriter is an http.ResponseWriter that drops responses or malforms
+// their chunks.
+type faultWriter struct {
+	http.ResponseWriter
+	plan plan
+	// cancel cancels the request once its response is dropped.
+	cancel context.CancelFunc
+	// writes is the number of writes passed through.
+	writes int
+	// chunks is the number of JSON chunks passed through.
+	chunks int
+	// dropped and malformed are set once the corresponding fault is injected.
+	dropped   bool
+	malformed bool
+}
+
+func (w *faultWriter) Write(b []byte) (int, error) {
+	if w.dropped {
+		return 0, errDropped
+	}
+	if w.plan.drop && w.writes >= w.plan.dropWrites {
+		w.dropped = true
+		w.Flush()
+		w.cancel()
+		return 0, errDropped
+	}
+	w.writes++
+	if w.plan.malformed && !w.malformed && bytes.IndexByte(b, '{') >= 0 {
+		if w.chunks >= w.plan.malformedSkip {
+			w.malformed = true
+			if _, err := w.ResponseWriter.Write(malform(b)); err != nil {
+				return 0, err
+			}
+			return len(b), nil
+		}
+		w.chunks++
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.Flush, so that streamed responses aren't
+// buffered.
+func (w *faultWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// malform truncates the JSON in a response chunk, preserving its line
+// terminator so that server-sent event and newline-delimited JSON framing
+// remains intact.
+func malform(chunk []byte) []byte {
+	start := bytes.IndexByte(chunk, '{')
+	content := bytes.TrimRight(chunk, "\r\n")
+	terminator := chunk[len(content):]
+	end := start + max((len(content)-start)/2, 1)
+	malformed := append([]byte(nil), chunk[:end]...)
+	return append(malformed, terminator...)
+}
@@ -0,0 +1,137 @@
+package chaos
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// streamHandler streams three server-sent events.
+var streamHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, event := range []string{`{"id":1}`, `{"id":2}`, `{"id":3}`} {
+		if _, err := io.WriteString(w, "data: "+event+"\n\n"); err != nil {
+			return
+		}
+		w.(http.Flusher).Flush()
+	}
+})
+
+func TestConfigNormalize(t *testing.T) {
+	config := Config{Models: map[string]*Faults{"smollm2": {ErrorRate: 0.5}}}
+	if err := config.Normalize(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	faults := config.lookup("ai/smollm2:latest")
+	if faults == nil || faults.ErrorStatus != http.StatusServiceUnavailable {
+		t.Errorf("Expected normalized faults with default status, got %+v", faults)
+	}
+	if config.lookup("ai/gemma3") != nil {
+		t.Error("Expected no faults for other models")
+	}
+
+	for _, invalid := range []*Faults{
+		{ErrorRate: 1.5},
+		{DropRate: -0.1},
+		{LatencyRate: 0.5},
+		{LatencyRate: 0.5, Latency: "forever"},
+		{ErrorRate: 1, ErrorStatus: 404},
+	} {
+		config := Config{Default: invalid}
+		if err := config.Normalize(); err == nil {
+			t.Errorf("Expected error for %+v", invalid)
+		}
+	}
+}
+
+func TestMiddlewareError(t *testing.T) {
+	injector := NewInjector()
+	config := Config{Models: map[string]*Faults{"ai/smollm2": {ErrorRate: 1, ErrorStatus: http.StatusBadGateway}}}
+	if err := config.Normalize(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	injector.Configure(config)
+	handler := injector.Middleware(streamHandler)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", strings.NewReader(`{"model":"ai/smollm2"}`)))
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("Expected injected status 502, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", strings.NewReader(`{"model":"ai/gemma3"}`)))
+	if recorder.Code != http.StatusOK || strings.Count(recorder.Body.String(), "data: ") != 3 {
+		t.Errorf("Expected other models to be unaffected, got %d: %q", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/models/create", strings.NewReader(`{"model":"ai/smollm2"}`)))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected non-inference requests to be unaffected, got %d", recorder.Code)
+	}
+
+	if injected := injector.Status().Injected[FaultError]; injected != 1 {
+		t.Errorf("Expected one injected error, got %d", injected)
+	}
+}
+
+func TestMiddlewareDrop(t *testing.T) {
+	injector := NewInjector()
+	config := Config{Default: &Faults{DropRate: 1}}
+	if err := config.Normalize(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	injector.Configure(config)
+	handler := injector.Middleware(streamHandler)
+
+	recorder := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if recovered := recover(); recovered == nil || !errors.Is(recovered.(error), http.ErrAbortHandler) {
+				t.Errorf("Expected the response to be aborted, got %v", recovered)
+			}
+		}()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", strings.NewReader(`{"model":"ai/smollm2"}`)))
+	}()
+	if events := strings.Count(recorder.Body.String(), "data: "); events < 1 || events > maximumDropWrites {
+		t.Errorf("Expected a partial stream, got %q", recorder.Body.String())
+	}
+}
+
+func TestMiddlewareMalformed(t *testing.T) {
+	injector := NewInjector()
+	config := Config{Default: &Faults{MalformedRate: 1}}
+	if err := config.Normalize(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	injector.Configure(config)
+
+	recorder := httptest.NewRecorder()
+	injector.Middleware(streamHandler).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", strings.NewReader(`{"model":"ai/smollm2"}`)))
+	events := strings.Split(strings.TrimSuffix(recorder.Body.String(), "\n\n"), "\n\n")
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %q", recorder.Body.String())
+	}
+	var malformed int
+	for _, event := range events {
+		if !strings.HasSuffix(event, "}") {
+			malformed++
+		}
+	}
+	if malformed != 1 {
+		t.Errorf("Expected one malformed event, got %q", recorder.Body.String())
+	}
+}
+
+func TestMalform(t *testing.T) {
+	if malformed := string(malform([]byte("data: {\"id\":1}\n\n"))); malformed != "data: {\"id\n\n" {
+		t.Errorf("Unexpected malformed chunk %q", malformed)
+	}
+	if malformed := string(malform([]byte("{}\n"))); malformed != "{\n" {
+		t.Errorf("Unexpected malformed chunk %q", malformed)
+	}
+}
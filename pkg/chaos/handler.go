@@ -0,0 +1,93 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// APIPath is the path of the fault injection configuration route, relative
+	// to the inference prefix.
+	APIPath = "/chaos"
+
+	// maximumConfigSize is the maximum size of a configuration.
+	maximumConfigSize = 1024 * 1024
+)
+
+// LoadConfig reads and normalizes the configuration in the file at path.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to read fault injection configuration: %w", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("invalid fault injection configuration: %w", err)
+	}
+	if err := config.Normalize(); err != nil {
+		return Config{}, fmt.Errorf("invalid fault injection configuration: %w", err)
+	}
+	return config, nil
+}
+
+// Handler implements the fault injection API, which inspects and replaces the
+// injector's configuration.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	injector    *Injector
+}
+
+// NewHandler creates a new fault injection API handler for injector.
+func NewHandler(log logging.Logger, injector *Injector, allowedOrigins []string) *Handler {
+	h := &Handler{
+		log:      log,
+		router:   http.NewServeMux(),
+		injector: injector,
+	}
+
+	h.router.HandleFunc("GET "+inference.InferencePrefix+APIPath, h.handleGetStatus)
+	h.router.HandleFunc("POST "+inference.InferencePrefix+APIPath, h.handleConfigure)
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+func (h *Handler) handleGetStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.injector.Status()); err != nil {
+		h.log.Warnf("Failed to encode fault injection status: %v", err)
+	}
+}
+
+// handleConfigure replaces the injector's configuration. An empty
+// configuration disables fault injection.
+func (h *Handler) handleConfigure(w http.ResponseWriter, r *http.Request) {
+	var config Config
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maximumConfigSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		http.Error(w, fmt.Sprintf("invalid configuration: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := config.Normalize(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.injector.Configure(config)
+	h.log.Infof("Fault injection configured for %d models", len(config.Models))
+	h.handleGetStatus(w, r)
+}
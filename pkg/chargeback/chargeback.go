@@ -0,0 +1,286 @@
+// Package chargeback periodically exports the usage of shared model runners
+// per namespace, key, and model, so that it can be charged back internally.
+package chargeback
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+const (
+	// DefaultInterval is the default interval between exports.
+	DefaultInterval = 24 * time.Hour
+	// webhookTimeout is the timeout of webhook deliveries.
+	webhookTimeout = 30 * time.Second
+	// userAgent is the User-Agent of webhook deliveries.
+	userAgent = "model-runner-chargeback"
+)
+
+// Format is the format of exports.
+type Format string
+
+const (
+	// FormatCSV exports a CSV file with a header row.
+	FormatCSV Format = "csv"
+	// FormatJSON exports a JSON document.
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses the name of an export format.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case FormatCSV, FormatJSON:
+		return format, nil
+	case "":
+		return FormatCSV, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q, expected csv or json", name)
+	}
+}
+
+// Config configures usage exports.
+type Config struct {
+	// Interval is the interval between exports, which cover the usage since
+	// the previous one. Exports are aligned to multiples of the interval in
+	// UTC, e.g. midnight for daily exports. It defaults to DefaultInterval.
+	Interval time.Duration
+	// Format is the format of exports. It defaults to FormatCSV.
+	Format Format
+	// Storage is the storage in which exports are written, if set, e.g.
+	// storage.NewFilesystemBlobs for a directory.
+	Storage storage.Blobs
+	// WebhookURL is the URL to which exports are posted, if set.
+	WebhookURL string
+}
+
+// Entry is the usage of a model by a key over an export's period.
+type Entry struct {
+	// Namespace is the namespace that the key's requests are accounted to.
+	Namespace string `json:"namespace"`
+	// Key is the name of the credentials that made the requests. See
+	// middleware.Identity.
+	Key   string `json:"key"`
+	Model string `json:"model"`
+	// Requests is the number of inference requests.
+	Requests int64 `json:"requests"`
+	// Tokens is the number of prompt and completion tokens reported by the
+	// responses.
+	Tokens int64 `json:"tokens"`
+	// GPUSeconds is the runner busy time attributable to the requests,
+	// excluding the time they were queued. While a runner serves several
+	// requests concurrently, its busy time is shared between them.
+	GPUSeconds float64 `json:"gpu_seconds"`
+}
+
+// Export is the usage over a period.
+type Export struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Entries are ordered by namespace, key, and model.
+	Entries []Entry `json:"entries"`
+}
+
+// entryKey identifies an entry.
+type entryKey struct {
+	namespace string
+	key       string
+	model     string
+}
+
+// Exporter aggregates usage and periodically exports it.
+type Exporter struct {
+	// log is the associated logger.
+	log logging.Logger
+	// config is the export configuration.
+	config Config
+	// client delivers exports to the webhook.
+	client *http.Client
+	// now returns the current time.
+	now func() time.Time
+	// m protects the fields below.
+	m sync.Mutex
+	// start is the start of the current period.
+	start time.Time
+	// entries is the usage over the current period.
+	entries map[entryKey]*Entry
+}
+
+// NewExporter creates a new exporter. At least one of the configuration's
+// storage and webhook URL must be set.
+func NewExporter(log logging.Logger, config Config) (*Exporter, error) {
+	if config.Interval == 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Format == "" {
+		config.Format = FormatCSV
+	}
+	switch {
+	case config.Interval < time.Minute:
+		return nil, errors.New("export interval must be at least a minute")
+	case config.Format != FormatCSV && config.Format != FormatJSON:
+		return nil, fmt.Errorf("unknown export format %q, expected csv or json", config.Format)
+	case config.Storage == nil && config.WebhookURL == "":
+		return nil, errors.New("exports need storage or a webhook URL")
+	}
+	if config.WebhookURL != "" {
+		if u, err := url.Parse(config.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, errors.New("webhook URL must be an http or https URL")
+		}
+	}
+	return &Exporter{
+		log:     log,
+		config:  config,
+		client:  &http.Client{Timeout: webhookTimeout},
+		now:     time.Now,
+		start:   time.Now().UTC(),
+		entries: make(map[entryKey]*Entry),
+	}, nil
+}
+
+// Record records an inference request of a key, accounted to a namespace,
+// that used the specified number of tokens and runner busy time.
+func (e *Exporter) Record(namespace, key, model string, tokens int64, busy time.Duration) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	id := entryKey{namespace: namespace, key: key, model: model}
+	entry := e.entries[id]
+	if entry == nil {
+		entry = &Entry{Namespace: namespace, Key: key, Model: model}
+		e.entries[id] = entry
+	}
+	entry.Requests++
+	entry.Tokens += tokens
+	entry.GPUSeconds += busy.Seconds()
+}
+
+// Run exports the usage at the end of each interval until the context is
+// cancelled, at which point the usage since the last export is exported.
+func (e *Exporter) Run(ctx context.Context) {
+	for {
+		now := e.now()
+		next := now.Truncate(e.config.Interval).Add(e.config.Interval)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			// Don't lose the usage of the last period on shutdown.
+			e.export(context.WithoutCancel(ctx), e.now())
+			return
+		case <-timer.C:
+			e.export(ctx, next)
+		}
+	}
+}
+
+// export exports the usage since the previous export, if any.
+func (e *Exporter) export(ctx context.Context, end time.Time) {
+	e.m.Lock()
+	export := Export{Start: e.start, End: end.UTC(), Entries: make([]Entry, 0, len(e.entries))}
+	for _, entry := range e.entries {
+		export.Entries = append(export.Entries, *entry)
+	}
+	e.start = export.End
+	e.entries = make(map[entryKey]*Entry)
+	e.m.Unlock()
+
+	if len(export.Entries) == 0 {
+		return
+	}
+	slices.SortFunc(export.Entries, func(a, b Entry) int {
+		return cmp.Or(
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.Key, b.Key),
+			cmp.Compare(a.Model, b.Model),
+		)
+	})
+	data, err := encode(export, e.config.Format)
+	if err != nil {
+		e.log.Warnf("Unable to encode usage export: %v", err)
+		return
+	}
+	if e.config.Storage != nil {
+		if err := e.write(export, data); err != nil {
+			e.log.Warnf("Unable to write usage export: %v", err)
+		}
+	}
+	if e.config.WebhookURL != "" {
+		if err := e.postWebhook(ctx, data); err != nil {
+			e.log.Warnf("Unable to deliver usage export: %v", err)
+		}
+	}
+	e.log.Infof("Exported usage of %d namespace, key, and model combinations from %s to %s",
+		len(export.Entries), export.Start.Format(time.RFC3339), export.End.Format(time.RFC3339))
+}
+
+// encode encodes an export in the specified format.
+func encode(export Export, format Format) ([]byte, error) {
+	if format == FormatJSON {
+		return json.Marshal(export)
+	}
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write([]string{"start", "end", "namespace", "key", "model", "requests", "tokens", "gpu_seconds"})
+	for _, entry := range export.Entries {
+		writer.Write([]string{
+			export.Start.Format(time.RFC3339),
+			export.End.Format(time.RFC3339),
+			entry.Namespace,
+			entry.Key,
+			entry.Model,
+			strconv.FormatInt(entry.Requests, 10),
+			strconv.FormatInt(entry.Tokens, 10),
+			strconv.FormatFloat(entry.GPUSeconds, 'f', 3, 64),
+		})
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+// write writes an export to the export storage, named after its period.
+func (e *Exporter) write(export Export, data []byte) error {
+	name := fmt.Sprintf("usage-%s-%s.%s", export.Start.Format("20060102T150405Z"), export.End.Format("20060102T150405Z"), e.config.Format)
+	_, err := e.config.Storage.Write(name, bytes.NewReader(data))
+	return err
+}
+
+// postWebhook posts an export to the webhook.
+func (e *Exporter) postWebhook(ctx context.Context, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.WebhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if e.config.Format == FormatJSON {
+		r.Header.Set("Content-Type", "application/json")
+	} else {
+		r.Header.Set("Content-Type", "text/csv")
+	}
+	r.Header.Set("User-Agent", userAgent)
+	response, err := e.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", response.StatusCode)
+	}
+	return nil
+}
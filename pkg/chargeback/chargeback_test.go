@@ -0,0 +1,110 @@
+package chargeback
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+func TestExport(t *testing.T) {
+	var delivered []byte
+	var contentType string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		delivered, _ = io.ReadAll(r.Body)
+	}))
+	defer webhook.Close()
+
+	dir := t.TempDir()
+	blobs, err := storage.NewFilesystemBlobs(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	exporter, err := NewExporter(logrus.New(), Config{Interval: time.Hour, Storage: blobs, WebhookURL: webhook.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	exporter.start = time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+	exporter.Record("team", "key-b", "ai/smollm2", 10, 1500*time.Millisecond)
+	exporter.Record("team", "key-b", "ai/smollm2", 5, 500*time.Millisecond)
+	exporter.Record("team", "key-a", "ai/smollm2", 1, time.Second)
+	exporter.export(context.Background(), time.Date(2026, 1, 31, 1, 0, 0, 0, time.UTC))
+
+	want := `start,end,namespace,key,model,requests,tokens,gpu_seconds
+2026-01-31T00:00:00Z,2026-01-31T01:00:00Z,team,key-a,ai/smollm2,1,1,1.000
+2026-01-31T00:00:00Z,2026-01-31T01:00:00Z,team,key-b,ai/smollm2,2,15,2.000
+`
+	data, err := os.ReadFile(filepath.Join(dir, "usage-20260131T000000Z-20260131T010000Z.csv"))
+	if err != nil || string(data) != want {
+		t.Errorf("Unexpected export file %q (%v)", data, err)
+	}
+	if string(delivered) != want || contentType != "text/csv" {
+		t.Errorf("Unexpected webhook delivery %q (%s)", delivered, contentType)
+	}
+
+	// Periods without usage aren't exported.
+	delivered = nil
+	exporter.export(context.Background(), time.Date(2026, 1, 31, 2, 0, 0, 0, time.UTC))
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 || delivered != nil {
+		t.Errorf("Expected no export without usage, got %v", entries)
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	blobs := storage.NewMemory().Blobs()
+	exporter, err := NewExporter(logrus.New(), Config{Format: FormatJSON, Storage: blobs})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	exporter.Record("anonymous", "anonymous", "ai/smollm2", 3, time.Second)
+	exporter.export(context.Background(), time.Now())
+
+	keys, _ := blobs.List("")
+	if len(keys) != 1 || !strings.HasSuffix(keys[0], ".json") {
+		t.Fatalf("Expected a JSON export, got %v", keys)
+	}
+	r, err := blobs.Open(keys[0])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer r.Close()
+	data, _ := io.ReadAll(r)
+	var export Export
+	if err := json.Unmarshal(data, &export); err != nil || len(export.Entries) != 1 || export.Entries[0].Tokens != 3 || export.Entries[0].GPUSeconds != 1 {
+		t.Errorf("Unexpected export %s (%v)", data, err)
+	}
+}
+
+func TestNewExporterInvalidConfig(t *testing.T) {
+	for _, config := range []Config{
+		{},
+		{Storage: storage.NewMemory().Blobs(), Interval: time.Second},
+		{Storage: storage.NewMemory().Blobs(), Format: "xml"},
+		{WebhookURL: "ftp://example.com"},
+	} {
+		if _, err := NewExporter(logrus.New(), config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"": FormatCSV, "csv": FormatCSV, "json": FormatJSON} {
+		if format, err := ParseFormat(name); err != nil || format != want {
+			t.Errorf("%q: expected %s, got %s (%v)", name, want, format, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected error for xml")
+	}
+}
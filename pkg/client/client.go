@@ -0,0 +1,258 @@
+// Package client implements a typed Go client for the model runner's API,
+// covering inference, model management, status, recorded requests, and their
+// events, so that Go programs embedding or orchestrating the model runner
+// don't have to hand-roll HTTP calls.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the address of a model runner started with the
+	// default port.
+	DefaultBaseURL = "http://localhost:12434"
+
+	// DefaultUserAgent is the user agent sent by clients.
+	DefaultUserAgent = "model-runner-go-client"
+
+	// defaultMaxRetries is the default number of times a failed request is
+	// retried.
+	defaultMaxRetries = 3
+
+	// defaultRetryBackoff is the default delay before the first retry, which
+	// doubles with each subsequent retry.
+	defaultRetryBackoff = 500 * time.Millisecond
+
+	// maximumErrorSize is the maximum size of an error response body kept in
+	// a StatusError.
+	maximumErrorSize = 64 * 1024
+)
+
+// StatusError is returned when the model runner responds with an unexpected
+// status code.
+type StatusError struct {
+	// StatusCode is the response's status code.
+	StatusCode int
+	// Message is the response body, or the error message of OpenAI-style
+	// error responses.
+	Message string
+}
+
+// Error implements error.Error.
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("unexpected status %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound returns whether err is a StatusError for a missing resource.
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// Client is a model runner API client. It's safe for concurrent use.
+type Client struct {
+	baseURL      *url.URL
+	httpClient   *http.Client
+	userAgent    string
+	header       http.Header
+	maxRetries   int
+	retryBackoff time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used to send requests, e.g. to connect
+// through a Unix socket or to set a timeout. Streaming requests last as long
+// as their streams, so the client shouldn't have an overall timeout if
+// streams are used.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		if httpClient != nil {
+			c.httpClient = httpClient
+		}
+	}
+}
+
+// WithUserAgent sets the user agent sent with requests, which is used to
+// attribute usage.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		if userAgent != "" {
+			c.userAgent = userAgent
+		}
+	}
+}
+
+// WithHeader sets a header sent with every request, e.g. an Authorization
+// header for a model runner behind an authenticating proxy.
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Set(key, value)
+	}
+}
+
+// WithAPIKey sets the API key that authenticates requests to a model runner
+// that enforces an access policy.
+func WithAPIKey(key string) Option {
+	return WithHeader("Authorization", "Bearer "+key)
+}
+
+// WithRetries sets the number of times a request is retried after network
+// errors or 429 and 5xx responses, and the delay before the first retry,
+// which doubles with each subsequent retry. Zero retries disables retrying.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = max(maxRetries, 0)
+		if backoff > 0 {
+			c.retryBackoff = backoff
+		}
+	}
+}
+
+// New creates a client for the model runner at baseURL, e.g.
+// "http://localhost:12434". If baseURL is empty, DefaultBaseURL is used.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+	c := &Client{
+		baseURL:      parsed,
+		httpClient:   http.DefaultClient,
+		userAgent:    DefaultUserAgent,
+		header:       make(http.Header),
+		maxRetries:   defaultMaxRetries,
+		retryBackoff: defaultRetryBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// request describes an API request.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	// body is encoded as JSON if it's not nil.
+	body any
+}
+
+// do sends a request, retrying it after transient failures, and returns the
+// response if its status code is successful. Otherwise, it returns a
+// StatusError. The caller must close the response body.
+func (c *Client) do(ctx context.Context, req request) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, fmt.Errorf("unable to encode request: %w", err)
+		}
+	}
+	endpoint := c.baseURL.JoinPath(req.path)
+	endpoint.RawQuery = req.query.Encode()
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := c.retryBackoff << (attempt - 1)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, endpoint.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("unable to create request: %w", err)
+		}
+		for key, values := range c.header {
+			httpReq.Header[key] = values
+		}
+		for key, values := range req.header {
+			httpReq.Header[key] = values
+		}
+		httpReq.Header.Set("User-Agent", c.userAgent)
+		if body != nil {
+			httpReq.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.httpClient.Do(httpReq)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		lastErr = newStatusError(resp)
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return nil, lastErr
+		}
+	}
+	if c.maxRetries > 0 {
+		return nil, fmt.Errorf("request failed after %d retries: %w", c.maxRetries, lastErr)
+	}
+	return nil, lastErr
+}
+
+// newStatusError creates the StatusError for an unsuccessful response,
+// closing its body.
+func newStatusError(resp *http.Response) *StatusError {
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maximumErrorSize))
+	message := strings.TrimSpace(string(data))
+	var openAIError struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &openAIError) == nil && openAIError.Error.Message != "" {
+		message = openAIError.Error.Message
+	}
+	return &StatusError{StatusCode: resp.StatusCode, Message: message}
+}
+
+// doJSON sends a request and decodes its JSON response into response, unless
+// response is nil.
+func (c *Client) doJSON(ctx context.Context, req request, response any) error {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if response == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
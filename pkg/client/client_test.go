@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := New(server.URL, WithRetries(2, time.Millisecond), WithUserAgent("test"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return client
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("unix:///var/run/model-runner.sock"); err == nil {
+		t.Error("Expected error for a non-HTTP base URL")
+	}
+	client, err := New("")
+	if err != nil || client.baseURL.String() != DefaultBaseURL {
+		t.Errorf("Expected the default base URL, got %v (%v)", client, err)
+	}
+}
+
+func TestChatCompletion(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/engines/llama.cpp/v1/chat/completions" || body["top_k"] != float64(20) || body["stream"] != nil || r.UserAgent() != "test" {
+			t.Errorf("Unexpected request to %s: %v", r.URL.Path, body)
+		}
+		messages := body["messages"].([]any)
+		if parts, ok := messages[0].(map[string]any)["content"].([]any); !ok || len(parts) != 1 {
+			t.Errorf("Expected multimodal content, got %v", messages[0])
+		}
+		fmt.Fprint(w, `{"model":"ai/smollm2","choices":[{"message":{"role":"assistant","content":"Hi!"},"finish_reason":"stop"}],"usage":{"total_tokens":3}}`)
+	})
+	response, err := client.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Model:    "ai/smollm2",
+		Messages: []Message{{Role: "user", Parts: []ContentPart{{Type: "text", Text: "Hello"}}}},
+		Extra:    map[string]any{"top_k": 20, "model": "ignored"},
+		Backend:  "llama.cpp",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if response.Content() != "Hi!" || response.Usage.TotalTokens != 3 {
+		t.Errorf("Unexpected response %+v", response)
+	}
+}
+
+func TestChatCompletionStream(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: queue\ndata: {\"state\":\"loading\"}\n\n")
+		for _, content := range []string{"Hel", "lo"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", content)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"completion_tokens\":2}}\n\ndata: [DONE]\n\n")
+	})
+	stream, err := client.ChatCompletionStream(context.Background(), ChatCompletionRequest{Model: "ai/smollm2"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+	var content strings.Builder
+	var usage *Usage
+	for stream.Next() {
+		chunk := stream.Current()
+		content.WriteString(chunk.Content())
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content.String() != "Hello" || usage == nil || usage.CompletionTokens != 2 {
+		t.Errorf("Unexpected content %q or usage %v", content.String(), usage)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var attempts atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			http.Error(w, "loading", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"llama.cpp":"running"}`)
+	})
+	status, err := client.Status(context.Background())
+	if err != nil || status["llama.cpp"] != "running" || attempts.Load() != 3 {
+		t.Errorf("Unexpected status %v after %d attempts (%v)", status, attempts.Load(), err)
+	}
+
+	attempts.Store(-10)
+	var statusErr *StatusError
+	if _, err := client.Status(context.Background()); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected a StatusError after exhausting retries, got %v", err)
+	}
+
+	attempts.Store(0)
+	client = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"message":"model not found"}}`)
+	})
+	if _, err := client.GetModel(context.Background(), "ai/missing", false); !IsNotFound(err) || !strings.Contains(err.Error(), "model not found") || attempts.Load() != 1 {
+		t.Errorf("Expected a single not found error, got %v after %d attempts", err, attempts.Load())
+	}
+}
+
+func TestPullModel(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var request models.ModelCreateRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		if r.URL.Path != "/models/create" || request.From != "ai/smollm2" {
+			t.Errorf("Unexpected request to %s: %+v", r.URL.Path, request)
+		}
+		fmt.Fprintln(w, `{"type":"progress","total":10,"layer":{"ID":"a","Size":10,"Current":5}}`)
+		if request.Tag == "fail" {
+			fmt.Fprintln(w, `{"type":"error","message":"disk full"}`)
+			return
+		}
+		fmt.Fprintln(w, `{"type":"success","message":"Model pulled successfully"}`)
+	})
+	var updates []Progress
+	message, err := client.PullModel(context.Background(), models.ModelCreateRequest{From: "ai/smollm2"}, func(progress Progress) {
+		updates = append(updates, progress)
+	})
+	if err != nil || message != "Model pulled successfully" || len(updates) != 2 || updates[0].Layer.Current != 5 {
+		t.Errorf("Unexpected message %q or updates %+v (%v)", message, updates, err)
+	}
+	if _, err := client.PullModel(context.Background(), models.ModelCreateRequest{From: "ai/smollm2", Tag: "fail"}, nil); err == nil || err.Error() != "disk full" {
+		t.Errorf("Expected the reported error, got %v", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" || r.URL.Query().Get("include_existing") != "true" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		fmt.Fprint(w, "event: connected\ndata: {\"status\": \"connected\"}\n\n")
+		fmt.Fprint(w, "event: existing_request\ndata: [{\"model\":\"a\",\"count\":1,\"records\":[{\"id\":\"1\"}]}]\n\n")
+		fmt.Fprint(w, "event: new_request\ndata: [{\"model\":\"b\",\"count\":1,\"records\":[{\"id\":\"2\"}]}]\n\n")
+	})
+	stream, err := client.Events(context.Background(), RecordsOptions{}, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+	var ids []string
+	for stream.Next() {
+		for _, records := range stream.Current() {
+			for _, record := range records.Records {
+				ids = append(ids, stream.Event()+":"+record.ID)
+			}
+		}
+	}
+	if stream.Err() != nil || strings.Join(ids, ",") != "existing_request:1,new_request:2" {
+		t.Errorf("Unexpected events %v (%v)", ids, stream.Err())
+	}
+}
+
+func TestStreamInvalidEvent(t *testing.T) {
+	stream := newStream[ChatCompletionChunk](io.NopCloser(strings.NewReader("data: {\n\n")))
+	if stream.Next() || stream.Err() == nil {
+		t.Error("Expected an invalid event to end the stream with an error")
+	}
+}
@@ -0,0 +1,270 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+// ContentPart is a part of multimodal message content.
+type ContentPart struct {
+	// Type is "text" or "image_url".
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL is an image in message content, either a URL or a data URL, e.g.
+// "data:image/jpeg;base64,...".
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// Message is a chat message.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Parts is multimodal content, sent instead of Content if it's not
+	// empty. It's never set in responses.
+	Parts []ContentPart `json:"-"`
+	// ReasoningContent is the reasoning of reasoning models, if the server
+	// separates it from the content.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// ToolCalls are the tool calls of assistant messages.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the ID of the tool call answered by tool messages.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, sending Parts as the content if
+// they're set.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	if len(m.Parts) == 0 {
+		return json.Marshal(message(m))
+	}
+	return json.Marshal(struct {
+		message
+		Content []ContentPart `json:"content"`
+	}{message: message(m), Content: m.Parts})
+}
+
+// ToolCall is a function call requested by a model.
+type ToolCall struct {
+	// Index identifies the tool call across the chunks of a stream.
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	} `json:"function"`
+}
+
+// Usage reports the tokens used by a request.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatCompletionRequest is a chat completion request.
+type ChatCompletionRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
+	Seed        *int64    `json:"seed,omitempty"`
+	Stop        []string  `json:"stop,omitempty"`
+	// Tools and ResponseFormat are passed through as is.
+	Tools          any `json:"tools,omitempty"`
+	ResponseFormat any `json:"response_format,omitempty"`
+	// Extra holds additional request fields, e.g. backend-specific sampling
+	// parameters. They don't override the fields above.
+	Extra map[string]any `json:"-"`
+	// Backend is the backend that serves the request. It defaults to the
+	// model's backend.
+	Backend string `json:"-"`
+}
+
+// ChatCompletion is the response to a chat completion request.
+type ChatCompletion struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Created int64  `json:"created"`
+	Choices []struct {
+		Index        int     `json:"index"`
+		Message      Message `json:"message"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Content returns the content of the first choice, if any.
+func (c *ChatCompletion) Content() string {
+	if len(c.Choices) == 0 {
+		return ""
+	}
+	return c.Choices[0].Message.Content
+}
+
+// ChatCompletionChunk is a chunk of a streamed chat completion.
+type ChatCompletionChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Created int64  `json:"created"`
+	Choices []struct {
+		Index        int     `json:"index"`
+		Delta        Message `json:"delta"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	// Usage is only set in the final chunk.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Content returns the content delta of the first choice, if any.
+func (c *ChatCompletionChunk) Content() string {
+	if len(c.Choices) == 0 {
+		return ""
+	}
+	return c.Choices[0].Delta.Content
+}
+
+// EmbeddingsRequest is an embeddings request.
+type EmbeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+	// Dimensions truncates embeddings, for models that support it.
+	Dimensions int `json:"dimensions,omitempty"`
+	// Backend is the backend that serves the request. It defaults to the
+	// model's backend.
+	Backend string `json:"-"`
+}
+
+// Embeddings is the response to an embeddings request.
+type Embeddings struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// RerankRequest is a request to rank documents by relevance to a query.
+type RerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n,omitempty"`
+	// Backend is the backend that serves the request. It defaults to the
+	// model's backend.
+	Backend string `json:"-"`
+}
+
+// Rerank is the response to a rerank request, ordered by decreasing
+// relevance.
+type Rerank struct {
+	Model   string `json:"model"`
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// inferencePath returns the path of an OpenAI-compatible endpoint, e.g.
+// "/v1/chat/completions", of a backend.
+func inferencePath(backend, endpoint string) string {
+	if backend == "" {
+		return inference.InferencePrefix + endpoint
+	}
+	return inference.InferencePrefix + "/" + backend + endpoint
+}
+
+// chatCompletionBody returns the body of a chat completion request.
+func chatCompletionBody(req *ChatCompletionRequest, stream bool) (map[string]any, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	for key, value := range req.Extra {
+		if _, ok := body[key]; !ok {
+			body[key] = value
+		}
+	}
+	if stream {
+		body["stream"] = true
+		body["stream_options"] = map[string]any{"include_usage": true}
+	}
+	return body, nil
+}
+
+// ChatCompletion sends a chat completion request.
+func (c *Client) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletion, error) {
+	body, err := chatCompletionBody(&req, false)
+	if err != nil {
+		return nil, err
+	}
+	var response ChatCompletion
+	if err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   inferencePath(req.Backend, "/v1/chat/completions"),
+		body:   body,
+	}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// ChatCompletionStream sends a streamed chat completion request. The final
+// chunk reports usage.
+func (c *Client) ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (*Stream[ChatCompletionChunk], error) {
+	body, err := chatCompletionBody(&req, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   inferencePath(req.Backend, "/v1/chat/completions"),
+		header: http.Header{"Accept": {"text/event-stream"}},
+		body:   body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newStream[ChatCompletionChunk](resp.Body, "message"), nil
+}
+
+// Embeddings sends an embeddings request.
+func (c *Client) Embeddings(ctx context.Context, req EmbeddingsRequest) (*Embeddings, error) {
+	var response Embeddings
+	if err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   inferencePath(req.Backend, "/v1/embeddings"),
+		body:   req,
+	}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Rerank ranks documents by relevance to a query.
+func (c *Client) Rerank(ctx context.Context, req RerankRequest) (*Rerank, error) {
+	var response Rerank
+	if err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   inferencePath(req.Backend, "/rerank"),
+		body:   req,
+	}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
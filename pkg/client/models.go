@@ -0,0 +1,148 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+// Progress is a progress update of a model pull or push.
+type Progress struct {
+	// Type is "progress", "success", "warning", or "error".
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// Total is the total size of the model, in bytes.
+	Total uint64 `json:"total"`
+	// Layer is the layer being transferred.
+	Layer struct {
+		ID      string
+		Size    uint64
+		Current uint64
+	} `json:"layer"`
+}
+
+// DeletedModel reports a tag removed or a model deleted by a model deletion.
+type DeletedModel struct {
+	Untagged *string `json:"Untagged,omitempty"`
+	Deleted  *string `json:"Deleted,omitempty"`
+}
+
+// ListModels lists the local models.
+func (c *Client) ListModels(ctx context.Context) ([]models.Model, error) {
+	var response []models.Model
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: inference.ModelsPrefix}, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetModel returns a local model, or a remote one if remote is true. Use
+// IsNotFound to check whether the model exists.
+func (c *Client) GetModel(ctx context.Context, name string, remote bool) (*models.Model, error) {
+	query := url.Values{}
+	if remote {
+		query.Set("remote", "true")
+	}
+	var response models.Model
+	if err := c.doJSON(ctx, request{
+		method: http.MethodGet,
+		path:   inference.ModelsPrefix + "/" + name,
+		query:  query,
+	}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// PullModel pulls a model, calling progress, if not nil, with each progress
+// update, and returns the final message.
+func (c *Client) PullModel(ctx context.Context, req models.ModelCreateRequest, progress func(Progress)) (string, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   inference.ModelsPrefix + "/create",
+		body:   req,
+	})
+	if err != nil {
+		return "", fmt.Errorf("pulling %s failed: %w", req.From, err)
+	}
+	defer resp.Body.Close()
+	return readProgress(resp.Body, progress)
+}
+
+// PushModel pushes a model to its registry, calling progress, if not nil,
+// with each progress update, and returns the final message.
+func (c *Client) PushModel(ctx context.Context, name string, progress func(Progress)) (string, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   inference.ModelsPrefix + "/" + name + "/push",
+	})
+	if err != nil {
+		return "", fmt.Errorf("pushing %s failed: %w", name, err)
+	}
+	defer resp.Body.Close()
+	return readProgress(resp.Body, progress)
+}
+
+// readProgress reads the newline-delimited progress updates of a pull or
+// push, returning the final message or the reported error.
+func readProgress(body io.Reader, progress func(Progress)) (string, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maximumEventSize)
+	var message string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		var update Progress
+		if err := json.Unmarshal([]byte(html.UnescapeString(line)), &update); err != nil {
+			continue
+		}
+		if progress != nil {
+			progress(update)
+		}
+		switch update.Type {
+		case "success":
+			message = update.Message
+		case "error":
+			return "", errors.New(update.Message)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("unable to read progress: %w", err)
+	}
+	return message, nil
+}
+
+// DeleteModel deletes a model, or only untags it if it has other tags. If
+// force is true, the model is deleted even if it has multiple tags.
+func (c *Client) DeleteModel(ctx context.Context, name string, force bool) ([]DeletedModel, error) {
+	var response []DeletedModel
+	if err := c.doJSON(ctx, request{
+		method: http.MethodDelete,
+		path:   inference.ModelsPrefix + "/" + name,
+		query:  url.Values{"force": {strconv.FormatBool(force)}},
+	}, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// TagModel tags a model as repository:tag.
+func (c *Client) TagModel(ctx context.Context, name, repository, tag string) error {
+	return c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   inference.ModelsPrefix + "/" + name + "/tag",
+		query:  url.Values{"repo": {repository}, "tag": {tag}},
+	}, nil)
+}
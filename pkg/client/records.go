@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/metrics"
+)
+
+// recordsPath is the path of the recorded requests.
+var recordsPath = inference.InferencePrefix + "/requests"
+
+// RecordsOptions filters recorded requests.
+type RecordsOptions struct {
+	// Model restricts records to a model.
+	Model string
+	// Pipeline restricts records to a pipeline run. It's ignored by Events.
+	Pipeline string
+}
+
+// query returns the query parameters of the options.
+func (o RecordsOptions) query() url.Values {
+	query := url.Values{}
+	if o.Model != "" {
+		query.Set("model", o.Model)
+	}
+	if o.Pipeline != "" {
+		query.Set("pipeline", o.Pipeline)
+	}
+	return query
+}
+
+// Records returns the recorded requests and responses, grouped by model.
+func (c *Client) Records(ctx context.Context, opts RecordsOptions) ([]metrics.ModelRecordsResponse, error) {
+	var response []metrics.ModelRecordsResponse
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: recordsPath, query: opts.query()}, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// DeleteRecord deletes a recorded request.
+func (c *Client) DeleteRecord(ctx context.Context, id string) error {
+	return c.doJSON(ctx, request{method: http.MethodDelete, path: recordsPath + "/" + id}, nil)
+}
+
+// ClearRecords deletes the recorded requests for a model, or for all models if
+// model is empty, and returns the number of deleted records.
+func (c *Client) ClearRecords(ctx context.Context, model string) (int, error) {
+	query := url.Values{}
+	if model != "" {
+		query.Set("model", model)
+	}
+	var response metrics.ClearRecordsResponse
+	if err := c.doJSON(ctx, request{method: http.MethodDelete, path: recordsPath, query: query}, &response); err != nil {
+		return 0, err
+	}
+	return response.Deleted, nil
+}
+
+// Events streams the requests recorded from now on, or since the oldest
+// retained record if includeExisting is true. Each event holds the records
+// of a single model.
+func (c *Client) Events(ctx context.Context, opts RecordsOptions, includeExisting bool) (*Stream[[]metrics.ModelRecordsResponse], error) {
+	query := opts.query()
+	query.Del("pipeline")
+	if includeExisting {
+		query.Set("include_existing", "true")
+	}
+	resp, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   recordsPath,
+		query:  query,
+		header: http.Header{"Accept": {"text/event-stream"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newStream[[]metrics.ModelRecordsResponse](resp.Body, "existing_request", "new_request"), nil
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/docker/model-runner/pkg/features"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/scheduling"
+	"github.com/docker/model-runner/pkg/version"
+)
+
+// Status returns the status of each backend, keyed by backend name.
+func (c *Client) Status(ctx context.Context) (map[string]string, error) {
+	var response map[string]string
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: inference.InferencePrefix + "/status"}, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Running returns the running backends and the models they serve.
+func (c *Client) Running(ctx context.Context) ([]scheduling.BackendStatus, error) {
+	var response []scheduling.BackendStatus
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: inference.InferencePrefix + "/ps"}, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// DiskUsage returns the disk usage of the models and the default backend.
+func (c *Client) DiskUsage(ctx context.Context) (*scheduling.DiskUsage, error) {
+	var response scheduling.DiskUsage
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: inference.InferencePrefix + "/df"}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Unload unloads the runners of models.
+func (c *Client) Unload(ctx context.Context, req scheduling.UnloadRequest) (*scheduling.UnloadResponse, error) {
+	var response scheduling.UnloadResponse
+	if err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   inference.InferencePrefix + "/unload",
+		body:   req,
+	}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Configure sets the runtime configuration of a model, which applies the next
+// time the model is loaded. If backend is empty, the default backend is
+// configured.
+func (c *Client) Configure(ctx context.Context, backend string, req scheduling.ConfigureRequest) error {
+	return c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   inferencePath(backend, "/_configure"),
+		body:   req,
+	}, nil)
+}
+
+// Features reports the optional capabilities enabled in the model runner, and
+// whether its backends are supported on its platform.
+func (c *Client) Features(ctx context.Context) (*features.Report, error) {
+	var response features.Report
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: inference.InferencePrefix + features.APIPath}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Version returns the model runner's build information and backend versions.
+func (c *Client) Version(ctx context.Context) (*version.Info, error) {
+	var response version.Info
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: inference.InferencePrefix + version.APIPath}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
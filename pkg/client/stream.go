@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// maximumEventSize is the maximum size of a server-sent event.
+const maximumEventSize = 16 * 1024 * 1024
+
+// Stream iterates over the events of a server-sent event stream, decoding
+// their data as T. It must be closed once done with.
+type Stream[T any] struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	// events, if not empty, are the event types that are decoded. Other
+	// events are skipped.
+	events  []string
+	current T
+	event   string
+	err     error
+}
+
+// newStream creates a stream reading the events of body.
+func newStream[T any](body io.ReadCloser, events ...string) *Stream[T] {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maximumEventSize)
+	return &Stream[T]{body: body, scanner: scanner, events: events}
+}
+
+// Next advances to the next event, returning false once the stream ends, is
+// terminated by a "[DONE]" event, or fails, in which case Err returns the
+// error.
+func (s *Stream[T]) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	for {
+		event, data, ok := s.readEvent()
+		if !ok {
+			return false
+		}
+		if data == "[DONE]" {
+			return false
+		}
+		if len(s.events) > 0 && !slices.Contains(s.events, event) {
+			continue
+		}
+		var current T
+		if err := json.Unmarshal([]byte(data), &current); err != nil {
+			s.err = fmt.Errorf("invalid %s event: %w", event, err)
+			return false
+		}
+		s.current, s.event = current, event
+		return true
+	}
+}
+
+// readEvent reads the next event with data, returning its type, which
+// defaults to "message", and data.
+func (s *Stream[T]) readEvent() (string, string, bool) {
+	event := "message"
+	var data []string
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				return event, strings.Join(data, "\n"), true
+			}
+			event = "message"
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		s.err = fmt.Errorf("unable to read stream: %w", err)
+		return "", "", false
+	}
+	if len(data) > 0 {
+		return event, strings.Join(data, "\n"), true
+	}
+	return "", "", false
+}
+
+// Current returns the current event's data.
+func (s *Stream[T]) Current() T {
+	return s.current
+}
+
+// Event returns the current event's type.
+func (s *Stream[T]) Event() string {
+	return s.event
+}
+
+// Err returns the error that ended the stream, if any.
+func (s *Stream[T]) Err() error {
+	return s.err
+}
+
+// Close closes the stream.
+func (s *Stream[T]) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,203 @@
+// Package credentials stores the credentials used to pull and push models,
+// such as registry and Hugging Face tokens, in Docker credential helpers, OS
+// keychains, or the environment, rather than in plaintext configuration.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/go-containerregistry/pkg/authn"
+	"github.com/docker/model-runner/pkg/logging"
+)
+
+var (
+	// ErrNotFound indicates that a store has no credentials for a host.
+	ErrNotFound = errors.New("credentials not found")
+	// ErrReadOnly indicates that a store can't add or remove credentials.
+	ErrReadOnly = errors.New("credentials store is read-only")
+)
+
+// Credential authenticates to a registry host.
+type Credential struct {
+	// Username is the user name. If it's empty, Secret is a bearer token,
+	// e.g. a Hugging Face access token.
+	Username string
+	// Secret is the password or token.
+	Secret string
+}
+
+// authenticator returns the authenticator presenting the credential.
+func (c Credential) authenticator() authn.Authenticator {
+	if c.Username == "" {
+		return &authn.Bearer{Token: c.Secret}
+	}
+	return &authn.Basic{Username: c.Username, Password: c.Secret}
+}
+
+// Store stores credentials by registry host.
+type Store interface {
+	// Name identifies the store, e.g. "env" or the name of a credential
+	// helper.
+	Name() string
+	// Get returns the credentials for a host, or ErrNotFound.
+	Get(ctx context.Context, host string) (Credential, error)
+	// List returns the user names of the stored credentials by host. Stores
+	// may also list credentials that they didn't store themselves.
+	List(ctx context.Context) (map[string]string, error)
+	// Put stores the credentials for a host, or returns ErrReadOnly.
+	Put(ctx context.Context, host string, credential Credential) error
+	// Delete removes the credentials for a host. It returns ErrNotFound if
+	// there are none, or ErrReadOnly.
+	Delete(ctx context.Context, host string) error
+}
+
+// NormalizeHost normalizes a registry host, removing any scheme and path, so
+// that different spellings of a host find the same credentials, e.g.
+// "https://index.docker.io/v1/" and "docker.io", or "hf.co" and
+// "huggingface.co".
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	host, _, _ = strings.Cut(host, "/")
+	switch host {
+	case "docker.io", "registry-1.docker.io":
+		return "index.docker.io"
+	case "hf.co":
+		return "huggingface.co"
+	}
+	return host
+}
+
+// Entry describes stored credentials without their secret.
+type Entry struct {
+	// Host is the registry host.
+	Host string `json:"host"`
+	// Username is the user name, if any.
+	Username string `json:"username,omitempty"`
+	// Store is the name of the store holding the credentials.
+	Store string `json:"store"`
+}
+
+// Chain looks up credentials in several stores, in order. Credentials are
+// added to and removed from the first store that isn't read-only.
+type Chain []Store
+
+// Name implements Store.Name.
+func (c Chain) Name() string {
+	names := make([]string, 0, len(c))
+	for _, store := range c {
+		names = append(names, store.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Get implements Store.Get. A store failing, e.g. a broken credential helper,
+// doesn't prevent looking up the credentials in the following stores: the
+// errors are only returned if no store has credentials for the host.
+func (c Chain) Get(ctx context.Context, host string) (Credential, error) {
+	var errs []error
+	for _, store := range c {
+		credential, err := store.Get(ctx, host)
+		if err == nil {
+			return credential, nil
+		} else if !errors.Is(err, ErrNotFound) {
+			errs = append(errs, fmt.Errorf("getting credentials from %s: %w", store.Name(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return Credential{}, errors.Join(errs...)
+	}
+	return Credential{}, ErrNotFound
+}
+
+// List implements Store.List.
+func (c Chain) List(ctx context.Context) (map[string]string, error) {
+	entries, err := c.Entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usernames := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		usernames[entry.Host] = entry.Username
+	}
+	return usernames, nil
+}
+
+// Entries lists the stored credentials by host, from the first store holding
+// credentials for each host, sorted by host.
+func (c Chain) Entries(ctx context.Context) ([]Entry, error) {
+	var entries []Entry
+	for _, store := range c {
+		usernames, err := store.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing credentials in %s: %w", store.Name(), err)
+		}
+		for host, username := range usernames {
+			host = NormalizeHost(host)
+			if !slices.ContainsFunc(entries, func(entry Entry) bool { return entry.Host == host }) {
+				entries = append(entries, Entry{Host: host, Username: username, Store: store.Name()})
+			}
+		}
+	}
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return strings.Compare(a.Host, b.Host)
+	})
+	return entries, nil
+}
+
+// Put implements Store.Put.
+func (c Chain) Put(ctx context.Context, host string, credential Credential) error {
+	for _, store := range c {
+		if err := store.Put(ctx, host, credential); !errors.Is(err, ErrReadOnly) {
+			return err
+		}
+	}
+	return ErrReadOnly
+}
+
+// Delete implements Store.Delete.
+func (c Chain) Delete(ctx context.Context, host string) error {
+	for _, store := range c {
+		if err := store.Delete(ctx, host); !errors.Is(err, ErrReadOnly) {
+			return err
+		}
+	}
+	return ErrReadOnly
+}
+
+// Keychain returns a keychain resolving registry credentials from store,
+// falling back to fallback, e.g. authn.DefaultKeychain, for hosts without
+// stored credentials. Errors getting the credentials from store are logged
+// and also fall back to fallback, rather than failing the pull.
+func Keychain(log logging.Logger, store Store, fallback authn.Keychain) authn.Keychain {
+	return authn.NewMultiKeychain(keychain{log: log, store: store}, fallback)
+}
+
+// keychain adapts a store to authn.Keychain.
+type keychain struct {
+	log   logging.Logger
+	store Store
+}
+
+// Resolve implements authn.Keychain.Resolve.
+func (k keychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	return k.ResolveContext(context.Background(), target)
+}
+
+// ResolveContext implements authn.ContextKeychain.ResolveContext.
+func (k keychain) ResolveContext(ctx context.Context, target authn.Resource) (authn.Authenticator, error) {
+	credential, err := k.store.Get(ctx, NormalizeHost(target.RegistryStr()))
+	if errors.Is(err, ErrNotFound) {
+		return authn.Anonymous, nil
+	} else if err != nil {
+		k.log.Warnf("Failed to resolve credentials for %s, falling back: %v", target.RegistryStr(), err)
+		return authn.Anonymous, nil
+	}
+	return credential.authenticator(), nil
+}
@@ -0,0 +1,314 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/go-containerregistry/pkg/authn"
+	"github.com/docker/model-runner/pkg/go-containerregistry/pkg/name"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeHelper is a credential helper storing credentials as files in
+// $CREDENTIALS_TEST_DIR.
+const fakeHelper = `#!/bin/sh
+dir="$CREDENTIALS_TEST_DIR"
+case "$1" in
+store)
+	input=$(cat)
+	host=$(printf '%s' "$input" | sed -n 's/.*"ServerURL":"\([^"]*\)".*/\1/p')
+	printf '%s' "$input" > "$dir/$host.json"
+	;;
+get)
+	read -r host
+	if [ ! -f "$dir/$host.json" ]; then
+		echo "credentials not found in native keychain"
+		exit 1
+	fi
+	cat "$dir/$host.json"
+	;;
+erase)
+	read -r host
+	rm "$dir/$host.json"
+	;;
+list)
+	printf '{'
+	sep=''
+	for f in "$dir"/*.json; do
+		[ -f "$f" ] || continue
+		host=$(basename "$f" .json)
+		username=$(sed -n 's/.*"Username":"\([^"]*\)".*/\1/p' "$f")
+		printf '%s"%s":"%s"' "$sep" "$host" "$username"
+		sep=','
+	done
+	printf '}'
+	;;
+esac
+`
+
+// installFakeHelper installs the fake credential helper on the PATH and
+// returns a store using it.
+func installFakeHelper(t *testing.T) *Helper {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake credential helper is a shell script")
+	}
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "docker-credential-fake"), []byte(fakeHelper), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("CREDENTIALS_TEST_DIR", t.TempDir())
+	return NewHelper("fake")
+}
+
+func TestNormalizeHost(t *testing.T) {
+	tests := map[string]string{
+		"ghcr.io":                     "ghcr.io",
+		"https://index.docker.io/v1/": "index.docker.io",
+		"docker.io":                   "index.docker.io",
+		"hf.co":                       "huggingface.co",
+		"HuggingFace.co":              "huggingface.co",
+		"localhost:5000":              "localhost:5000",
+	}
+	for host, want := range tests {
+		if got := NormalizeHost(host); got != want {
+			t.Errorf("NormalizeHost(%q): expected %q, got %q", host, want, got)
+		}
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	env, err := ParseEnv("ghcr.io=bot:ghp_secret, registry.local=:token", "hf_token")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := Env{
+		"ghcr.io":        {Username: "bot", Secret: "ghp_secret"},
+		"registry.local": {Secret: "token"},
+		"huggingface.co": {Secret: "hf_token"},
+	}
+	if len(env) != len(want) {
+		t.Fatalf("Expected %d credentials, got %d", len(want), len(env))
+	}
+	for host, credential := range want {
+		if env[host] != credential {
+			t.Errorf("%s: expected %+v, got %+v", host, credential, env[host])
+		}
+	}
+
+	_, err = ParseEnv("ghcr.io=ghp_secret", "")
+	if err == nil {
+		t.Fatal("Expected an error for credentials without a username separator")
+	}
+	if strings.Contains(err.Error(), "ghp_secret") {
+		t.Errorf("Expected the error not to include the secret, got %v", err)
+	}
+
+	_, err = ParseEnv("ghcr.io=bot:ghp_secret,user:hunter2", "")
+	if err == nil {
+		t.Fatal("Expected an error for credentials without a host separator")
+	}
+	if strings.Contains(err.Error(), "hunter2") || !strings.Contains(err.Error(), "entry 2") {
+		t.Errorf("Expected the error to name the entry without the secret, got %v", err)
+	}
+}
+
+// brokenStore is a store failing to get credentials, like a broken credential
+// helper.
+type brokenStore struct {
+	Env
+}
+
+func (brokenStore) Name() string {
+	return "broken"
+}
+
+func (brokenStore) Get(context.Context, string) (Credential, error) {
+	return Credential{}, errors.New("helper crashed")
+}
+
+func TestChainBrokenStore(t *testing.T) {
+	ctx := context.Background()
+	env, err := ParseEnv("docker.io=bot:secret", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store := Chain{brokenStore{}, env}
+
+	if credential, err := store.Get(ctx, "docker.io"); err != nil || credential.Secret != "secret" {
+		t.Errorf("Expected the following store's credentials, got %+v (error: %v)", credential, err)
+	}
+	if _, err := store.Get(ctx, "ghcr.io"); err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected the broken store's error, got %v", err)
+	}
+
+	fallback := authn.NewMultiKeychain(staticKeychain{&authn.Bearer{Token: "fallback"}})
+	ref, err := name.ParseReference("ghcr.io/org/model")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	auth, err := Keychain(logrus.New(), store, fallback).Resolve(ref.Context())
+	if err != nil {
+		t.Fatalf("Expected the keychain to fall back, got %v", err)
+	}
+	config, err := auth.Authorization()
+	if err != nil || config.RegistryToken != "fallback" {
+		t.Errorf("Expected the fallback credentials, got %+v (error: %v)", config, err)
+	}
+}
+
+// staticKeychain resolves every resource to the same authenticator.
+type staticKeychain struct {
+	auth authn.Authenticator
+}
+
+func (k staticKeychain) Resolve(authn.Resource) (authn.Authenticator, error) {
+	return k.auth, nil
+}
+
+func TestChain(t *testing.T) {
+	helper := installFakeHelper(t)
+	ctx := context.Background()
+	env, err := ParseEnv("", "hf_token")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store := Chain{env, helper}
+
+	if err := store.Put(ctx, "ghcr.io", Credential{Username: "bot", Secret: "ghp_secret"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := store.Put(ctx, "registry.local", Credential{Secret: "token"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if credential, err := store.Get(ctx, "ghcr.io"); err != nil || credential != (Credential{Username: "bot", Secret: "ghp_secret"}) {
+		t.Errorf("Unexpected credentials %+v (error: %v)", credential, err)
+	}
+	if credential, err := store.Get(ctx, "registry.local"); err != nil || credential != (Credential{Secret: "token"}) {
+		t.Errorf("Expected a bearer token, got %+v (error: %v)", credential, err)
+	}
+	if credential, err := store.Get(ctx, "hf.co"); err != nil || credential.Secret != "hf_token" {
+		t.Errorf("Expected the Hugging Face token, got %+v (error: %v)", credential, err)
+	}
+
+	entries, err := store.Entries(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []Entry{
+		{Host: "ghcr.io", Username: "bot", Store: "fake"},
+		{Host: "huggingface.co", Store: "env"},
+		{Host: "registry.local", Store: "fake"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Expected entries %+v, got %+v", want, entries)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("Expected entry %+v, got %+v", want[i], entries[i])
+		}
+	}
+
+	if err := store.Delete(ctx, "ghcr.io"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.Get(ctx, "ghcr.io"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after deletion, got %v", err)
+	}
+	if err := store.Delete(ctx, "ghcr.io"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting missing credentials, got %v", err)
+	}
+	if err := env.Put(ctx, "ghcr.io", Credential{Secret: "token"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected the environment to be read-only, got %v", err)
+	}
+}
+
+func TestKeychain(t *testing.T) {
+	env, err := ParseEnv("docker.io=bot:secret", "hf_token")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	keychain := Keychain(logrus.New(), env, authn.NewMultiKeychain())
+
+	tests := []struct {
+		reference string
+		want      authn.AuthConfig
+	}{
+		{reference: "ai/smollm2", want: authn.AuthConfig{Username: "bot", Password: "secret"}},
+		{reference: "huggingface.co/bartowski/model", want: authn.AuthConfig{RegistryToken: "hf_token"}},
+		{reference: "ghcr.io/org/model"},
+	}
+	for _, tt := range tests {
+		ref, err := name.ParseReference(tt.reference)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		auth, err := keychain.Resolve(ref.Context())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.reference, err)
+		}
+		config, err := auth.Authorization()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.reference, err)
+		}
+		if *config != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.reference, tt.want, *config)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	helper := installFakeHelper(t)
+	env, err := ParseEnv("", "hf_token")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler := NewHandler(logrus.New(), Chain{env, helper}, nil)
+	path := inference.InferencePrefix + APIPath
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{method: http.MethodPut, path: path + "/ghcr.io", body: `{"username": "bot", "secret": "ghp_secret"}`, want: http.StatusNoContent},
+		{method: http.MethodPut, path: path + "/ghcr.io", body: `{"username": "bot"}`, want: http.StatusBadRequest},
+		{method: http.MethodGet, path: path, want: http.StatusOK},
+		{method: http.MethodDelete, path: path + "/ghcr.io", want: http.StatusNoContent},
+		{method: http.MethodDelete, path: path + "/ghcr.io", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d: %s", tt.method, tt.path, tt.want, rec.Code, rec.Body.String())
+		}
+		if tt.method == http.MethodGet {
+			body := rec.Body.String()
+			if !strings.Contains(body, `"host":"ghcr.io"`) || !strings.Contains(body, `"host":"huggingface.co"`) {
+				t.Errorf("Expected the stored hosts to be listed, got %s", body)
+			}
+			if strings.Contains(body, "ghp_secret") || strings.Contains(body, "hf_token") {
+				t.Errorf("Expected secrets not to be listed, got %s", body)
+			}
+		}
+	}
+
+	// Without a credential helper, credentials can't be added.
+	handler = NewHandler(logrus.New(), Chain{env}, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, path+"/ghcr.io", strings.NewReader(`{"secret": "token"}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status %d without a writable store, got %d", http.StatusConflict, rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// huggingFaceHost is the registry host of Hugging Face models.
+const huggingFaceHost = "huggingface.co"
+
+// Env is a read-only store of credentials injected through the environment,
+// e.g. from the secrets of a container orchestrator.
+type Env map[string]Credential
+
+// ParseEnv parses credentials injected through the environment: a
+// comma-separated list of host=username:secret entries, where the username may
+// be empty for bearer tokens, e.g. "ghcr.io=bot:ghp_...,registry.local=:token",
+// and a Hugging Face token, if any.
+func ParseEnv(spec, huggingFaceToken string) (Env, error) {
+	env := make(Env)
+	for i, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		host, credential, ok := strings.Cut(entry, "=")
+		username, secret, hasSecret := strings.Cut(credential, ":")
+		if !ok || host == "" || !hasSecret || secret == "" {
+			// Don't include the entry, or the host if there's no "=" since it
+			// then holds the whole entry, which contains a secret.
+			if !ok || host == "" {
+				return nil, fmt.Errorf("invalid credentials in entry %d, expected host=username:secret", i+1)
+			}
+			return nil, fmt.Errorf("invalid credentials for %q in entry %d, expected host=username:secret", host, i+1)
+		}
+		env[NormalizeHost(host)] = Credential{Username: username, Secret: secret}
+	}
+	if huggingFaceToken != "" {
+		env[huggingFaceHost] = Credential{Secret: huggingFaceToken}
+	}
+	return env, nil
+}
+
+// Name implements Store.Name.
+func (e Env) Name() string {
+	return "env"
+}
+
+// Get implements Store.Get.
+func (e Env) Get(_ context.Context, host string) (Credential, error) {
+	credential, ok := e[NormalizeHost(host)]
+	if !ok {
+		return Credential{}, ErrNotFound
+	}
+	return credential, nil
+}
+
+// List implements Store.List.
+func (e Env) List(context.Context) (map[string]string, error) {
+	usernames := make(map[string]string, len(e))
+	for host, credential := range e {
+		usernames[host] = credential.Username
+	}
+	return usernames, nil
+}
+
+// Put implements Store.Put. The environment is read-only.
+func (e Env) Put(context.Context, string, Credential) error {
+	return ErrReadOnly
+}
+
+// Delete implements Store.Delete. The environment is read-only.
+func (e Env) Delete(context.Context, string) error {
+	return ErrReadOnly
+}
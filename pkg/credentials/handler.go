@@ -0,0 +1,123 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// APIPath is the path of the credentials API, relative to the inference
+	// prefix.
+	APIPath = "/credentials"
+
+	// maximumRequestSize is the maximum size of a credentials request.
+	maximumRequestSize = 64 * 1024
+)
+
+// PutRequest is the body of a request adding credentials for a host.
+type PutRequest struct {
+	// Username is the user name. It's empty for bearer tokens, such as
+	// Hugging Face access tokens.
+	Username string `json:"username,omitempty"`
+	// Secret is the password or token.
+	Secret string `json:"secret"`
+}
+
+// Handler implements the credentials API, which lists, adds, and removes
+// credentials by registry host. Secrets are never returned.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	store       Chain
+}
+
+// NewHandler creates a new credentials API handler for store.
+func NewHandler(log logging.Logger, store Chain, allowedOrigins []string) *Handler {
+	h := &Handler{
+		log:    log,
+		router: http.NewServeMux(),
+		store:  store,
+	}
+
+	h.router.HandleFunc("GET "+inference.InferencePrefix+APIPath, h.handleList)
+	h.router.HandleFunc("PUT "+inference.InferencePrefix+APIPath+"/{host}", h.handlePut)
+	h.router.HandleFunc("DELETE "+inference.InferencePrefix+APIPath+"/{host}", h.handleDelete)
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// handleList lists the stored credentials.
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.store.Entries(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		h.log.Warnf("Failed to encode credentials: %v", err)
+	}
+}
+
+// handlePut adds or replaces the credentials for a host.
+func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request) {
+	host := NormalizeHost(r.PathValue("host"))
+	var request PutRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maximumRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if host == "" || request.Secret == "" {
+		http.Error(w, "a host and a secret are required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.store.Put(r.Context(), host, Credential{Username: request.Username, Secret: request.Secret})
+	if errors.Is(err, ErrReadOnly) {
+		http.Error(w, "no writable credentials store is configured", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.log.Infof("Stored credentials for %s", utils.SanitizeForLog(host))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDelete removes the credentials for a host.
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	host := NormalizeHost(r.PathValue("host"))
+	err := h.store.Delete(r.Context(), host)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, fmt.Sprintf("no stored credentials for %s", host), http.StatusNotFound)
+		return
+	} else if errors.Is(err, ErrReadOnly) {
+		http.Error(w, "no writable credentials store is configured", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.log.Infof("Removed credentials for %s", utils.SanitizeForLog(host))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package credentials
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// tokenUsername is the user name under which credential helpers store bearer
+// tokens, since they require a user name. It's the user name that Docker uses
+// for identity tokens.
+const tokenUsername = "<token>"
+
+// helperCredential is the credential format of the credential helper
+// protocol.
+type helperCredential struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// Helper stores credentials with a Docker credential helper, i.e. a
+// docker-credential-<name> program on the PATH, such as the helpers storing
+// credentials in OS keychains.
+type Helper struct {
+	// name is the name of the helper.
+	name string
+}
+
+// NewHelper creates a store using the docker-credential-<name> helper.
+func NewHelper(name string) *Helper {
+	return &Helper{name: name}
+}
+
+// DefaultHelper returns the name of the credential helper storing credentials
+// in the OS keychain: the macOS keychain, the Windows Credential Manager, or
+// the Secret Service (e.g. GNOME Keyring) on other systems.
+func DefaultHelper() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "osxkeychain"
+	case "windows":
+		return "wincred"
+	default:
+		return "secretservice"
+	}
+}
+
+// Name implements Store.Name.
+func (h *Helper) Name() string {
+	return h.name
+}
+
+// run runs an action of the helper with input, returning its output.
+func (h *Helper) run(ctx context.Context, action string, input []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "docker-credential-"+h.name, action)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Helpers report errors on stdout, but be lenient.
+		message := strings.TrimSpace(stdout.String() + " " + stderr.String())
+		if strings.Contains(strings.ToLower(message), "credentials not found") {
+			return nil, ErrNotFound
+		}
+		var exitErr *exec.ExitError
+		if message != "" && errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("credential helper %s %s: %s", h.name, action, message)
+		}
+		return nil, fmt.Errorf("credential helper %s %s: %w", h.name, action, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Get implements Store.Get.
+func (h *Helper) Get(ctx context.Context, host string) (Credential, error) {
+	output, err := h.run(ctx, "get", []byte(host))
+	if err != nil {
+		return Credential{}, err
+	}
+	var credential helperCredential
+	if err := json.Unmarshal(output, &credential); err != nil {
+		return Credential{}, fmt.Errorf("credential helper %s get: invalid output: %w", h.name, err)
+	}
+	if credential.Secret == "" {
+		return Credential{}, ErrNotFound
+	}
+	if credential.Username == tokenUsername {
+		credential.Username = ""
+	}
+	return Credential{Username: credential.Username, Secret: credential.Secret}, nil
+}
+
+// List implements Store.List. It lists all of the helper's credentials,
+// including those stored by other programs, such as Docker.
+func (h *Helper) List(ctx context.Context) (map[string]string, error) {
+	output, err := h.run(ctx, "list", nil)
+	if err != nil {
+		return nil, err
+	}
+	var usernames map[string]string
+	if err := json.Unmarshal(output, &usernames); err != nil {
+		return nil, fmt.Errorf("credential helper %s list: invalid output: %w", h.name, err)
+	}
+	for host, username := range usernames {
+		if username == tokenUsername {
+			usernames[host] = ""
+		}
+	}
+	return usernames, nil
+}
+
+// Put implements Store.Put.
+func (h *Helper) Put(ctx context.Context, host string, credential Credential) error {
+	input, err := json.Marshal(helperCredential{
+		ServerURL: host,
+		Username:  cmp.Or(credential.Username, tokenUsername),
+		Secret:    credential.Secret,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.run(ctx, "store", input)
+	return err
+}
+
+// Delete implements Store.Delete.
+func (h *Helper) Delete(ctx context.Context, host string) error {
+	if _, err := h.Get(ctx, host); err != nil {
+		return err
+	}
+	_, err := h.run(ctx, "erase", []byte(host))
+	return err
+}
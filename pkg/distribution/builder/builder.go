@@ -9,6 +9,7 @@ import (
 
 	"github.com/docker/model-runner/pkg/distribution/internal/gguf"
 	"github.com/docker/model-runner/pkg/distribution/internal/mutate"
+	"github.com/docker/model-runner/pkg/distribution/internal/onnx"
 	"github.com/docker/model-runner/pkg/distribution/internal/partial"
 	"github.com/docker/model-runner/pkg/distribution/internal/safetensors"
 	"github.com/docker/model-runner/pkg/distribution/types"
@@ -42,6 +43,17 @@ func FromSafetensors(safetensorsPaths []string) (*Builder, error) {
 	}, nil
 }
 
+// FromONNX returns a *Builder that builds model artifacts from an ONNX file
+func FromONNX(path string) (*Builder, error) {
+	mdl, err := onnx.NewModel(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Builder{
+		model: mdl,
+	}, nil
+}
+
 // FromModel returns a *Builder that builds model artifacts from an existing model artifact
 func FromModel(mdl types.ModelArtifact) (*Builder, error) {
 	// Capture original layers for comparison
@@ -86,6 +98,28 @@ func (b *Builder) WithMultimodalProjector(path string) (*Builder, error) {
 	}, nil
 }
 
+// WithLoRAAdapter adds a LoRA adapter file in GGUF format to the artifact.
+// Multiple adapters can be added by calling this method multiple times.
+func (b *Builder) WithLoRAAdapter(path string) (*Builder, error) {
+	loraLayer, err := partial.NewLayer(path, types.MediaTypeLoRAAdapter)
+	if err != nil {
+		return nil, fmt.Errorf("LoRA adapter layer from %q: %w", path, err)
+	}
+	return &Builder{
+		model:          mutate.AppendLayers(b.model, loraLayer),
+		originalLayers: b.originalLayers,
+	}, nil
+}
+
+// WithDraftModel sets the reference of a draft model for speculative decoding,
+// which is pulled along with the model.
+func (b *Builder) WithDraftModel(reference string) *Builder {
+	return &Builder{
+		model:          mutate.DraftModel(b.model, reference),
+		originalLayers: b.originalLayers,
+	}
+}
+
 // WithChatTemplateFile adds a Jinja chat template file to the artifact which takes precedence over template from GGUF.
 func (b *Builder) WithChatTemplateFile(path string) (*Builder, error) {
 	templateLayer, err := partial.NewLayer(path, types.MediaTypeChatTemplate)
@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	v1 "github.com/docker/model-runner/pkg/go-containerregistry/pkg/v1"
+
 	"github.com/docker/model-runner/pkg/distribution/internal/gguf"
 	"github.com/docker/model-runner/pkg/distribution/internal/mutate"
 	"github.com/docker/model-runner/pkg/distribution/internal/partial"
@@ -63,6 +65,24 @@ func TestBundle(t *testing.T) {
 		t.Fatalf("Failed to write model to store: %v", err)
 	}
 
+	// Load model with LoRA adapters
+	var loraLayers []v1.Layer
+	for _, path := range []string{"dummy-00001-of-00002.gguf", "dummy-00002-of-00002.gguf"} {
+		loraLayer, err := partial.NewLayer(filepath.Join("..", "assets", path), types.MediaTypeLoRAAdapter)
+		if err != nil {
+			t.Fatalf("Failed to create LoRA adapter layer: %v", err)
+		}
+		loraLayers = append(loraLayers, loraLayer)
+	}
+	loraMdl := mutate.AppendLayers(mdl, loraLayers...)
+	loraMdlID, err := loraMdl.ID()
+	if err != nil {
+		t.Fatalf("Failed to get model ID: %v", err)
+	}
+	if err := client.store.Write(loraMdl, []string{"some-model-with-adapters"}, nil); err != nil {
+		t.Fatalf("Failed to write model to store: %v", err)
+	}
+
 	// Load sharded dummy model from asset directory
 	shardedMdl, err := gguf.NewModel(filepath.Join("..", "assets", "dummy-00001-of-00002.gguf"))
 	if err != nil {
@@ -120,6 +140,15 @@ func TestBundle(t *testing.T) {
 				"model/template.jinja": filepath.Join("..", "assets", "template.jinja"),
 			},
 		},
+		{
+			ref:         loraMdlID,
+			description: "model with LoRA adapters",
+			expectedFiles: map[string]string{
+				"model/model.gguf":         filepath.Join("..", "assets", "dummy.gguf"),
+				"model/adapter-00001.lora": filepath.Join("..", "assets", "dummy-00001-of-00002.gguf"),
+				"model/adapter-00002.lora": filepath.Join("..", "assets", "dummy-00002-of-00002.gguf"),
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -14,19 +14,21 @@ import (
 
 	"github.com/docker/model-runner/pkg/distribution/internal/progress"
 	"github.com/docker/model-runner/pkg/distribution/internal/store"
+	"github.com/docker/model-runner/pkg/distribution/objectstore"
 	"github.com/docker/model-runner/pkg/distribution/registry"
-	"github.com/docker/model-runner/pkg/distribution/tarball"
 	"github.com/docker/model-runner/pkg/distribution/types"
 	"github.com/docker/model-runner/pkg/go-containerregistry/pkg/authn"
 	"github.com/docker/model-runner/pkg/go-containerregistry/pkg/v1/remote"
 	"github.com/docker/model-runner/pkg/inference/platform"
+	"github.com/docker/model-runner/pkg/storage"
 )
 
 // Client provides model distribution functionality
 type Client struct {
-	store    *store.LocalStore
-	log      *logrus.Entry
-	registry *registry.Client
+	store       *store.LocalStore
+	log         *logrus.Entry
+	registry    *registry.Client
+	objectStore *objectstore.Client
 }
 
 // GetStorePath returns the root path where models are stored
@@ -45,6 +47,8 @@ type options struct {
 	userAgent     string
 	username      string
 	password      string
+	keychain      authn.Keychain
+	metadata      storage.KV
 }
 
 // WithStoreRootPath sets the store root path
@@ -93,6 +97,22 @@ func WithRegistryAuth(username, password string) Option {
 	}
 }
 
+// WithKeychain sets the keychain resolving registry credentials, which
+// otherwise come from the Docker configuration
+func WithKeychain(keychain authn.Keychain) Option {
+	return func(o *options) {
+		o.keychain = keychain
+	}
+}
+
+// WithMetadataStorage sets the storage of the models index, which otherwise
+// lives in the store root path
+func WithMetadataStorage(kv storage.KV) Option {
+	return func(o *options) {
+		o.metadata = kv
+	}
+}
+
 func defaultOptions() *options {
 	return &options{
 		logger:    logrus.NewEntry(logrus.StandardLogger()),
@@ -114,6 +134,7 @@ func NewClient(opts ...Option) (*Client, error) {
 
 	s, err := store.New(store.Options{
 		RootPath: options.storeRootPath,
+		Metadata: options.metadata,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("initializing store: %w", err)
@@ -123,6 +144,7 @@ func NewClient(opts ...Option) (*Client, error) {
 	registryOpts := []registry.ClientOption{
 		registry.WithTransport(options.transport),
 		registry.WithUserAgent(options.userAgent),
+		registry.WithKeychain(options.keychain),
 	}
 
 	// Add auth if credentials are provided
@@ -132,14 +154,50 @@ func NewClient(opts ...Option) (*Client, error) {
 
 	options.logger.Infoln("Successfully initialized store")
 	return &Client{
-		store:    s,
-		log:      options.logger,
-		registry: registry.NewClient(registryOpts...),
+		store:       s,
+		log:         options.logger,
+		registry:    registry.NewClient(registryOpts...),
+		objectStore: objectstore.NewClient(options.transport, options.userAgent),
 	}, nil
 }
 
-// PullModel pulls a model from a registry and returns the local file path
+// PullModel pulls a model from a registry, along with the draft model that it
+// bundles, if any
 func (c *Client) PullModel(ctx context.Context, reference string, progressWriter io.Writer, bearerToken ...string) error {
+	if err := c.pullModel(ctx, reference, progressWriter, bearerToken...); err != nil {
+		return err
+	}
+	return c.pullDependencies(ctx, reference, progressWriter, bearerToken...)
+}
+
+// pullDependencies pulls the models that a pulled model depends on, which is
+// the draft model for speculative decoding that it bundles, if any, unless
+// they're already in the local store. Dependencies of dependencies aren't
+// pulled.
+func (c *Client) pullDependencies(ctx context.Context, reference string, progressWriter io.Writer, bearerToken ...string) error {
+	model, err := c.store.Read(reference)
+	if err != nil {
+		return fmt.Errorf("reading pulled model: %w", err)
+	}
+	cfg, err := model.Config()
+	if err != nil {
+		return fmt.Errorf("getting pulled model config: %w", err)
+	}
+	if cfg.DraftModel == "" {
+		return nil
+	}
+	if _, err := c.store.Read(cfg.DraftModel); err == nil {
+		return nil
+	}
+	c.log.Infoln("Pulling draft model:", utils.SanitizeForLog(cfg.DraftModel))
+	if err := c.pullModel(ctx, cfg.DraftModel, progressWriter, bearerToken...); err != nil {
+		return fmt.Errorf("pulling draft model %q: %w", cfg.DraftModel, err)
+	}
+	return nil
+}
+
+// pullModel pulls a model without its dependencies.
+func (c *Client) pullModel(ctx context.Context, reference string, progressWriter io.Writer, bearerToken ...string) error {
 	c.log.Infoln("Starting model pull:", utils.SanitizeForLog(reference))
 
 	// Use the client's registry, or create a temporary one if bearer token is provided
@@ -277,41 +335,16 @@ func (c *Client) PullModel(ctx context.Context, reference string, progressWriter
 func (c *Client) LoadModel(r io.Reader, progressWriter io.Writer) (string, error) {
 	c.log.Infoln("Starting model load")
 
-	tr := tarball.NewReader(r)
-	for {
-		diffID, err := tr.Next()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			if errors.Is(err, io.ErrUnexpectedEOF) {
-				c.log.Infof("Model load interrupted (likely cancelled): %s", utils.SanitizeForLog(err.Error()))
-				return "", fmt.Errorf("model load interrupted: %w", err)
-			}
-			return "", fmt.Errorf("reading blob from stream: %w", err)
-		}
-		c.log.Infoln("Loading blob:", diffID)
-		if err := c.store.WriteBlob(diffID, tr); err != nil {
-			return "", fmt.Errorf("writing blob: %w", err)
-		}
-		c.log.Infoln("Loaded blob:", diffID)
-	}
-
-	manifest, digest, err := tr.Manifest()
+	id, err := c.loadArchive(r, nil)
 	if err != nil {
-		return "", fmt.Errorf("read manifest: %w", err)
-	}
-	c.log.Infoln("Loading manifest:", digest.String())
-	if err := c.store.WriteManifest(digest, manifest); err != nil {
-		return "", fmt.Errorf("write manifest: %w", err)
+		return "", err
 	}
-	c.log.Infoln("Loaded model with ID:", digest.String())
 
 	if err := progress.WriteSuccess(progressWriter, "Model loaded successfully"); err != nil {
 		c.log.Warnf("Failed to write success message: %v", err)
 	}
 
-	return digest.String(), nil
+	return id, nil
 }
 
 // ListModels returns all available models
@@ -350,6 +383,16 @@ func (c *Client) GetModel(reference string) (types.Model, error) {
 	return model, nil
 }
 
+// ModelCompleteness returns the number of bytes of a model's layers that are
+// present in the local store and the number of bytes expected.
+func (c *Client) ModelCompleteness(reference string) (present, expected int64, err error) {
+	present, expected, err = c.store.Completeness(reference)
+	if err != nil {
+		return 0, 0, fmt.Errorf("check model completeness '%q': %w", utils.SanitizeForLog(reference), err)
+	}
+	return present, expected, nil
+}
+
 // IsModelInStore checks if a model with the given reference is in the local store
 func (c *Client) IsModelInStore(reference string) (bool, error) {
 	c.log.Infoln("Checking model by reference:", utils.SanitizeForLog(reference))
@@ -364,12 +407,26 @@ func (c *Client) IsModelInStore(reference string) (bool, error) {
 type DeleteModelAction struct {
 	Untagged *string `json:"Untagged,omitempty"`
 	Deleted  *string `json:"Deleted,omitempty"`
+	// Trashed is the ID of a model moved to the trash instead of being
+	// deleted.
+	Trashed *string `json:"Trashed,omitempty"`
 }
 
 type DeleteModelResponse []DeleteModelAction
 
 // DeleteModel deletes a model
 func (c *Client) DeleteModel(reference string, force bool) (*DeleteModelResponse, error) {
+	return c.deleteModel(reference, force, false)
+}
+
+// TrashModel moves a model to the trash, from which it can be restored until
+// it's purged. Untagging a model that has other tags doesn't trash it.
+func (c *Client) TrashModel(reference string, force bool) (*DeleteModelResponse, error) {
+	return c.deleteModel(reference, force, true)
+}
+
+// deleteModel deletes a model, or moves it to the trash if trash is true
+func (c *Client) deleteModel(reference string, force, trash bool) (*DeleteModelResponse, error) {
 	mdl, err := c.store.Read(reference)
 	if err != nil {
 		return &DeleteModelResponse{}, err
@@ -386,7 +443,8 @@ func (c *Client) DeleteModel(reference string, force bool) (*DeleteModelResponse
 
 	resp := DeleteModelResponse{}
 
-	if isTag {
+	// Trashed models keep their last tag, so that they can be restored by it.
+	if isTag && (!trash || len(mdl.Tags()) > 1) {
 		c.log.Infoln("Untagging model:", reference)
 		tags, err := c.store.RemoveTags([]string{reference})
 		if err != nil {
@@ -409,6 +467,20 @@ func (c *Client) DeleteModel(reference string, force bool) (*DeleteModelResponse
 		)
 	}
 
+	if trash {
+		c.log.Infoln("Moving model to trash:", id)
+		trashedID, tags, err := c.store.MoveToTrash(id)
+		if err != nil {
+			c.log.Errorln("Failed to move model to trash:", err, "tag:", reference)
+			return &DeleteModelResponse{}, fmt.Errorf("moving model to trash: %w", err)
+		}
+		for _, t := range tags {
+			resp = append(resp, DeleteModelAction{Untagged: &t})
+		}
+		resp = append(resp, DeleteModelAction{Trashed: &trashedID})
+		return &resp, nil
+	}
+
 	c.log.Infoln("Deleting model:", id)
 	deletedID, tags, err := c.store.Delete(id)
 	if err != nil {
@@ -485,9 +557,9 @@ func (c *Client) GetBundle(ref string) (types.ModelBundle, error) {
 
 func GetSupportedFormats() []types.Format {
 	if platform.SupportsVLLM() {
-		return []types.Format{types.FormatGGUF, types.FormatSafetensors}
+		return []types.Format{types.FormatGGUF, types.FormatSafetensors, types.FormatONNX}
 	}
-	return []types.Format{types.FormatGGUF}
+	return []types.Format{types.FormatGGUF, types.FormatONNX}
 }
 
 func checkCompat(image types.ModelArtifact, log *logrus.Entry, reference string, progressWriter io.Writer) error {
@@ -26,6 +26,7 @@ import (
 	"github.com/docker/model-runner/pkg/distribution/internal/progress"
 	"github.com/docker/model-runner/pkg/distribution/internal/safetensors"
 	mdregistry "github.com/docker/model-runner/pkg/distribution/registry"
+	"github.com/docker/model-runner/pkg/distribution/types"
 	"github.com/docker/model-runner/pkg/inference/platform"
 )
 
@@ -593,6 +594,53 @@ func TestClientPullModel(t *testing.T) {
 	})
 }
 
+func TestClientPullModelDraftModel(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse registry URL: %v", err)
+	}
+	draftTag := registryURL.Host + "/testmodel-draft:v1.0.0"
+	tag := registryURL.Host + "/testmodel:v1.0.0"
+
+	draft, err := gguf.NewModel(filepath.Join("..", "assets", "dummy-00002-of-00002.gguf"))
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	model, err := gguf.NewModel(testGGUFFile)
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	for tag, mdl := range map[string]types.ModelArtifact{draftTag: draft, tag: mutate.DraftModel(model, draftTag)} {
+		ref, err := name.ParseReference(tag)
+		if err != nil {
+			t.Fatalf("Failed to parse reference: %v", err)
+		}
+		if err := remote.Write(ref, mdl); err != nil {
+			t.Fatalf("Failed to push model: %v", err)
+		}
+	}
+
+	client, err := NewClient(WithStoreRootPath(t.TempDir()))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if err := client.PullModel(t.Context(), tag, nil); err != nil {
+		t.Fatalf("Failed to pull model: %v", err)
+	}
+	pulled, err := client.GetModel(tag)
+	if err != nil {
+		t.Fatalf("Failed to get model: %v", err)
+	}
+	if cfg, err := pulled.Config(); err != nil || cfg.DraftModel != draftTag {
+		t.Errorf("Expected draft model %q, got %+v (%v)", draftTag, cfg, err)
+	}
+	if _, err := client.GetModel(draftTag); err != nil {
+		t.Errorf("Expected the draft model to be pulled along with the model: %v", err)
+	}
+}
+
 func TestClientGetModel(t *testing.T) {
 	// Create temp directory for store
 	tempDir, err := os.MkdirTemp("", "model-distribution-test-*")
@@ -0,0 +1,219 @@
+package distribution
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/model-runner/pkg/distribution/internal/progress"
+	"github.com/docker/model-runner/pkg/distribution/tarball"
+	"github.com/docker/model-runner/pkg/distribution/types"
+	v1 "github.com/docker/model-runner/pkg/go-containerregistry/pkg/v1"
+	"github.com/docker/model-runner/pkg/internal/utils"
+)
+
+// PullFromObjectStore pulls a model archive (as produced by saving a model)
+// from an object storage URL into the store and tags it. Gzip-compressed
+// archives are supported if the object's name ends in .gz or .tgz. Every
+// blob is verified against its digest and the manifest is checked for
+// compatibility before the model is added to the store. It returns the ID of
+// the pulled model.
+func (c *Client) PullFromObjectStore(ctx context.Context, objectURL, tag string, progressWriter io.Writer) (string, error) {
+	c.log.Infoln("Starting model pull from object storage:", utils.SanitizeForLog(objectURL))
+
+	id, err := c.pullFromObjectStore(ctx, objectURL, tag, progressWriter)
+	if err != nil {
+		if writeErr := progress.WriteError(progressWriter, fmt.Sprintf("Error: %s", err.Error())); writeErr != nil {
+			c.log.Warnf("Failed to write error message: %v", writeErr)
+		}
+		return "", err
+	}
+
+	if err := progress.WriteSuccess(progressWriter, "Model pulled successfully"); err != nil {
+		c.log.Warnf("Failed to write success message: %v", err)
+	}
+	return id, nil
+}
+
+// pullFromObjectStore implements PullFromObjectStore.
+func (c *Client) pullFromObjectStore(ctx context.Context, objectURL, tag string, progressWriter io.Writer) (string, error) {
+	object, err := c.objectStore.Open(ctx, objectURL)
+	if err != nil {
+		return "", fmt.Errorf("opening object: %w", err)
+	}
+	defer object.Body.Close()
+
+	var r io.Reader = &objectProgressReader{
+		reader: object.Body,
+		size:   object.Size,
+		id:     objectURL,
+		out:    progressWriter,
+	}
+	if strings.HasSuffix(objectURL, ".gz") || strings.HasSuffix(objectURL, ".tgz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return "", fmt.Errorf("decompressing object: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	id, err := c.loadArchive(r, checkManifestCompat)
+	if err != nil {
+		return "", err
+	}
+	if err := c.store.AddTags(id, []string{tag}); err != nil {
+		return "", fmt.Errorf("tagging model: %w", err)
+	}
+	c.log.Infoln("Pulled model from object storage with ID:", id)
+	return id, nil
+}
+
+// loadArchive writes the blobs and manifest in a model archive to the store,
+// verifying each blob against its digest. If check is non-nil, it's called
+// with the parsed manifest before the manifest is written. It returns the ID
+// of the loaded model. If loading fails, the blobs that it added to the store
+// are removed.
+func (c *Client) loadArchive(r io.Reader, check func(*v1.Manifest) error) (id string, err error) {
+	var written []v1.Hash
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, diffID := range written {
+			if removeErr := c.store.RemoveBlob(diffID); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+				c.log.Warnf("Failed to remove blob %s of failed model load: %v", diffID, removeErr)
+			}
+		}
+	}()
+
+	tr := tarball.NewReader(r)
+	for {
+		diffID, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				c.log.Infof("Model load interrupted (likely cancelled): %s", utils.SanitizeForLog(err.Error()))
+				return "", fmt.Errorf("model load interrupted: %w", err)
+			}
+			return "", fmt.Errorf("reading blob from stream: %w", err)
+		}
+		c.log.Infoln("Loading blob:", diffID)
+		blob, err := newVerifyingReader(tr, diffID)
+		if err != nil {
+			return "", err
+		}
+		exists, err := c.store.HasBlob(diffID)
+		if err != nil {
+			return "", fmt.Errorf("checking blob: %w", err)
+		}
+		if err := c.store.WriteBlob(diffID, blob); err != nil {
+			return "", fmt.Errorf("writing blob: %w", err)
+		}
+		if !exists {
+			written = append(written, diffID)
+		}
+		c.log.Infoln("Loaded blob:", diffID)
+	}
+
+	manifest, digest, err := tr.Manifest()
+	if err != nil {
+		return "", fmt.Errorf("read manifest: %w", err)
+	}
+	if check != nil {
+		parsed, err := v1.ParseManifest(bytes.NewReader(manifest))
+		if err != nil {
+			return "", fmt.Errorf("parse manifest: %w", err)
+		}
+		if err := check(parsed); err != nil {
+			return "", err
+		}
+	}
+	c.log.Infoln("Loading manifest:", digest.String())
+	if err := c.store.WriteManifest(digest, manifest); err != nil {
+		return "", fmt.Errorf("write manifest: %w", err)
+	}
+	c.log.Infoln("Loaded model with ID:", digest.String())
+	return digest.String(), nil
+}
+
+// checkManifestCompat checks that a manifest describes a supported model.
+func checkManifestCompat(manifest *v1.Manifest) error {
+	if manifest.Config.MediaType != types.MediaTypeModelConfigV01 {
+		return fmt.Errorf("config type %q is unsupported: %w", manifest.Config.MediaType, ErrUnsupportedMediaType)
+	}
+	return nil
+}
+
+// verifyingReader is a reader that verifies the content it reads against a
+// digest, failing at EOF if the content doesn't match.
+type verifyingReader struct {
+	reader io.Reader
+	hasher hash.Hash
+	digest v1.Hash
+}
+
+// newVerifyingReader creates a reader that verifies r against digest.
+func newVerifyingReader(r io.Reader, digest v1.Hash) (*verifyingReader, error) {
+	hasher, err := v1.Hasher(digest.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported digest %q: %w", digest, err)
+	}
+	return &verifyingReader{reader: r, hasher: hasher, digest: digest}, nil
+}
+
+// Read implements io.Reader.Read.
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hasher.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		computed := v1.Hash{Algorithm: r.digest.Algorithm, Hex: fmt.Sprintf("%x", r.hasher.Sum(nil))}
+		if computed != r.digest {
+			return n, fmt.Errorf("digest mismatch: got %s, want %s", computed, r.digest)
+		}
+	}
+	return n, err
+}
+
+// objectProgressReader reports progress while an object is read.
+type objectProgressReader struct {
+	reader      io.Reader
+	size        int64
+	id          string
+	out         io.Writer
+	read        int64
+	lastWritten int64
+	lastUpdate  time.Time
+}
+
+// Read implements io.Reader.Read.
+func (r *objectProgressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if r.out == nil {
+		return n, err
+	}
+	now := time.Now()
+	if errors.Is(err, io.EOF) ||
+		now.Sub(r.lastUpdate) >= progress.UpdateInterval ||
+		r.read-r.lastWritten >= progress.MinBytesForUpdate {
+		size := max(r.size, r.read)
+		msg := fmt.Sprintf("Downloaded: %.2f MB", float64(r.read)/1024/1024)
+		if writeErr := progress.WriteProgress(r.out, msg, uint64(size), uint64(size), uint64(r.read), r.id); writeErr != nil {
+			// Stop reporting progress if the writer fails.
+			r.out = nil
+		}
+		r.lastWritten = r.read
+		r.lastUpdate = now
+	}
+	return n, err
+}
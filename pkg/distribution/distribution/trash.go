@@ -0,0 +1,83 @@
+package distribution
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/model-runner/pkg/distribution/internal/store"
+	"github.com/docker/model-runner/pkg/internal/utils"
+)
+
+// TrashedModel is a model in the trash
+type TrashedModel struct {
+	// ID is the model's ID.
+	ID string `json:"id"`
+	// Tags are the tags the model had when it was deleted.
+	Tags []string `json:"tags"`
+	// Size is the size of the model's retained blobs in bytes.
+	Size int64 `json:"size"`
+	// DeletedAt is the time the model was moved to the trash.
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// ListTrash lists the models in the trash
+func (c *Client) ListTrash() ([]TrashedModel, error) {
+	entries, err := c.store.ListTrash()
+	if err != nil {
+		return nil, fmt.Errorf("listing trash: %w", err)
+	}
+	models := make([]TrashedModel, len(entries))
+	for i, entry := range entries {
+		models[i] = TrashedModel{
+			ID:        entry.ID,
+			Tags:      entry.Tags,
+			Size:      c.store.BlobsSize(entry.Files),
+			DeletedAt: entry.DeletedAt,
+		}
+	}
+	return models, nil
+}
+
+// RestoreModel restores a model from the trash by ID or by one of its former
+// tags. Tags that have since been assigned to other models aren't restored.
+func (c *Client) RestoreModel(reference string) (TrashedModel, error) {
+	c.log.Infoln("Restoring model from trash:", utils.SanitizeForLog(reference))
+	entry, err := c.store.Restore(reference)
+	if err != nil {
+		return TrashedModel{}, fmt.Errorf("restoring model: %w", err)
+	}
+	return TrashedModel{
+		ID:        entry.ID,
+		Tags:      entry.Tags,
+		Size:      c.store.BlobsSize(entry.Files),
+		DeletedAt: entry.DeletedAt,
+	}, nil
+}
+
+// PurgeTrash permanently deletes the model in the trash with the specified ID
+// or former tag, or all models in the trash if reference is empty. It returns
+// the IDs of the deleted models.
+func (c *Client) PurgeTrash(reference string) ([]string, error) {
+	ids, err := c.store.PurgeTrash(func(entry store.TrashEntry) bool {
+		return reference == "" || entry.MatchesReference(reference)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("purging trash: %w", err)
+	}
+	if reference != "" && len(ids) == 0 {
+		return nil, fmt.Errorf("purging trash: %w", ErrModelNotFound)
+	}
+	return ids, nil
+}
+
+// PurgeExpiredTrash permanently deletes the models moved to the trash before
+// the specified time. It returns the IDs of the deleted models.
+func (c *Client) PurgeExpiredTrash(before time.Time) ([]string, error) {
+	ids, err := c.store.PurgeTrash(func(entry store.TrashEntry) bool {
+		return entry.DeletedAt.Before(before)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("purging expired trash: %w", err)
+	}
+	return ids, nil
+}
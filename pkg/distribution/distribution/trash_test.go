@@ -0,0 +1,99 @@
+package distribution
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/distribution/internal/gguf"
+)
+
+func TestTrashModel(t *testing.T) {
+	client, err := NewClient(WithStoreRootPath(t.TempDir()))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	mdl, err := gguf.NewModel(testGGUFFile)
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	id, err := mdl.ID()
+	if err != nil {
+		t.Fatalf("Failed to get model ID: %v", err)
+	}
+	if err := client.store.Write(mdl, []string{"ai/dummy:latest"}, nil); err != nil {
+		t.Fatalf("Failed to write model to store: %v", err)
+	}
+
+	resp, err := client.TrashModel("ai/dummy:latest", false)
+	if err != nil {
+		t.Fatalf("Failed to trash model: %v", err)
+	}
+	if last := (*resp)[len(*resp)-1]; last.Trashed == nil || *last.Trashed != id || last.Deleted != nil {
+		t.Errorf("Expected the model to be trashed, got %+v", *resp)
+	}
+	if _, err := client.GetModel("ai/dummy:latest"); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("Expected trashed models to be hidden, got %v", err)
+	}
+	trashed, err := client.ListTrash()
+	if err != nil {
+		t.Fatalf("Failed to list trash: %v", err)
+	}
+	if len(trashed) != 1 || trashed[0].ID != id || !slices.Equal(trashed[0].Tags, []string{"ai/dummy:latest"}) || trashed[0].Size == 0 {
+		t.Fatalf("Unexpected trash %+v", trashed)
+	}
+	size := trashed[0].Size
+
+	// Restoring the model by its former tag brings it back.
+	restored, err := client.RestoreModel("ai/dummy:latest")
+	if err != nil {
+		t.Fatalf("Failed to restore model: %v", err)
+	}
+	if restored.ID != id || restored.Size != size {
+		t.Errorf("Unexpected restored model %+v", restored)
+	}
+	if _, err := client.GetModel("ai/dummy:latest"); err != nil {
+		t.Errorf("Failed to get restored model: %v", err)
+	}
+	if _, err := client.RestoreModel(id); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("Expected restoring a model that isn't in the trash to fail, got %v", err)
+	}
+
+	// Deleting a model that's also in the trash retains its blobs.
+	if _, err := client.TrashModel(id, false); err != nil {
+		t.Fatalf("Failed to trash model: %v", err)
+	}
+	if err := client.store.Write(mdl, []string{"ai/other:latest"}, nil); err != nil {
+		t.Fatalf("Failed to write model to store: %v", err)
+	}
+	if _, err := client.DeleteModel("ai/other:latest", false); err != nil {
+		t.Fatalf("Failed to delete model: %v", err)
+	}
+	if trashed, _ := client.ListTrash(); len(trashed) != 1 || trashed[0].Size != size {
+		t.Errorf("Expected the trashed model's blobs to be retained, got %+v", trashed)
+	}
+
+	// Expired models are purged.
+	if ids, err := client.PurgeExpiredTrash(time.Now().Add(-time.Hour)); err != nil || len(ids) != 0 {
+		t.Errorf("Expected no models to expire, got %v (%v)", ids, err)
+	}
+	if _, err := client.PurgeTrash("ai/missing:latest"); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("Expected purging a missing model to fail, got %v", err)
+	}
+	entries, err := client.store.ListTrash()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Unexpected trash %+v (%v)", entries, err)
+	}
+	files := entries[0].Files
+	ids, err := client.PurgeExpiredTrash(time.Now().Add(time.Hour))
+	if err != nil || !slices.Equal(ids, []string{id}) {
+		t.Fatalf("Expected the model to be purged, got %v (%v)", ids, err)
+	}
+	if entries, err := client.store.ListTrash(); err != nil || len(entries) != 0 {
+		t.Errorf("Expected the trash to be empty, got %+v (%v)", entries, err)
+	}
+	if size := client.store.BlobsSize(files); size != 0 {
+		t.Errorf("Expected the model's blobs to be removed, %d bytes remain", size)
+	}
+}
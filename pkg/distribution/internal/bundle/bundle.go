@@ -15,8 +15,10 @@ const (
 type Bundle struct {
 	dir              string
 	mmprojPath       string
+	loraPaths        []string
 	ggufFile         string // path to GGUF file (first shard when model is split among files)
 	safetensorsFile  string // path to safetensors file (first shard when model is split among files)
+	onnxFile         string // path to ONNX file
 	runtimeConfig    types.Config
 	chatTemplatePath string
 }
@@ -43,6 +45,15 @@ func (b *Bundle) MMPROJPath() string {
 	return filepath.Join(b.dir, ModelSubdir, b.mmprojPath)
 }
 
+// LoRAPaths returns the paths to LoRA adapter files, in the order in which they're applied.
+func (b *Bundle) LoRAPaths() []string {
+	paths := make([]string, len(b.loraPaths))
+	for i, path := range b.loraPaths {
+		paths[i] = filepath.Join(b.dir, ModelSubdir, path)
+	}
+	return paths
+}
+
 // ChatTemplatePath return the path to a Jinja chat template file or "" if none is present.
 func (b *Bundle) ChatTemplatePath() string {
 	if b.chatTemplatePath == "" {
@@ -59,6 +70,14 @@ func (b *Bundle) SafetensorsPath() string {
 	return filepath.Join(b.dir, ModelSubdir, b.safetensorsFile)
 }
 
+// ONNXPath returns the path to model ONNX file or "" if none is present.
+func (b *Bundle) ONNXPath() string {
+	if b.onnxFile == "" {
+		return ""
+	}
+	return filepath.Join(b.dir, ModelSubdir, b.onnxFile)
+}
+
 // RuntimeConfig returns config that should be respected by the backend at runtime.
 func (b *Bundle) RuntimeConfig() types.Config {
 	return b.runtimeConfig
@@ -31,15 +31,24 @@ func Parse(rootDir string) (*Bundle, error) {
 		return nil, err
 	}
 
+	onnxPath, err := findONNXFile(modelDir)
+	if err != nil {
+		return nil, err
+	}
+
 	// Ensure at least one model weight format is present
-	if ggufPath == "" && safetensorsPath == "" {
-		return nil, fmt.Errorf("no supported model weights found (neither GGUF nor safetensors)")
+	if ggufPath == "" && safetensorsPath == "" && onnxPath == "" {
+		return nil, fmt.Errorf("no supported model weights found (neither GGUF, safetensors, nor ONNX)")
 	}
 
 	mmprojPath, err := findMultiModalProjectorFile(modelDir)
 	if err != nil {
 		return nil, err
 	}
+	loraPaths, err := findLoRAAdapterFiles(modelDir)
+	if err != nil {
+		return nil, err
+	}
 	templatePath, err := findChatTemplateFile(modelDir)
 	if err != nil {
 		return nil, err
@@ -53,8 +62,10 @@ func Parse(rootDir string) (*Bundle, error) {
 	return &Bundle{
 		dir:              rootDir,
 		mmprojPath:       mmprojPath,
+		loraPaths:        loraPaths,
 		ggufFile:         ggufPath,
 		safetensorsFile:  safetensorsPath,
+		onnxFile:         onnxPath,
 		runtimeConfig:    cfg,
 		chatTemplatePath: templatePath,
 	}, nil
@@ -97,6 +108,18 @@ func findSafetensorsFile(modelDir string) (string, error) {
 	return filepath.Base(safetensors[0]), nil
 }
 
+func findONNXFile(modelDir string) (string, error) {
+	onnxPaths, err := filepath.Glob(filepath.Join(modelDir, "[^.]*.onnx"))
+	if err != nil {
+		return "", fmt.Errorf("find ONNX files: %w", err)
+	}
+	if len(onnxPaths) == 0 {
+		// ONNX files are optional - GGUF and safetensors models won't have them
+		return "", nil
+	}
+	return filepath.Base(onnxPaths[0]), nil
+}
+
 func findMultiModalProjectorFile(modelDir string) (string, error) {
 	mmprojPaths, err := filepath.Glob(filepath.Join(modelDir, "[^.]*.mmproj"))
 	if err != nil {
@@ -111,6 +134,18 @@ func findMultiModalProjectorFile(modelDir string) (string, error) {
 	return filepath.Base(mmprojPaths[0]), nil
 }
 
+func findLoRAAdapterFiles(modelDir string) ([]string, error) {
+	// Glob returns the adapters sorted by name, and so in order.
+	loraPaths, err := filepath.Glob(filepath.Join(modelDir, "[^.]*.lora"))
+	if err != nil {
+		return nil, fmt.Errorf("find LoRA adapter files: %w", err)
+	}
+	for i, path := range loraPaths {
+		loraPaths[i] = filepath.Base(path)
+	}
+	return loraPaths, nil
+}
+
 func findChatTemplateFile(modelDir string) (string, error) {
 	templatePaths, err := filepath.Glob(filepath.Join(modelDir, "[^.]*.jinja"))
 	if err != nil {
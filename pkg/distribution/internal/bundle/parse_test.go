@@ -41,7 +41,7 @@ func TestParse_NoModelWeights(t *testing.T) {
 		t.Fatal("Expected error when parsing bundle without model weights, got nil")
 	}
 
-	expectedErrMsg := "no supported model weights found (neither GGUF nor safetensors)"
+	expectedErrMsg := "no supported model weights found (neither GGUF, safetensors, nor ONNX)"
 	if !strings.Contains(err.Error(), expectedErrMsg) {
 		t.Errorf("Expected error message to contain %q, got: %v", expectedErrMsg, err)
 	}
@@ -139,6 +139,35 @@ func TestParse_WithSafetensors(t *testing.T) {
 	}
 }
 
+func TestParse_WithONNX(t *testing.T) {
+	tempDir := t.TempDir()
+	modelDir := filepath.Join(tempDir, ModelSubdir)
+	if err := os.MkdirAll(modelDir, 0755); err != nil {
+		t.Fatalf("Failed to create model directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(modelDir, "model.onnx"), []byte("dummy onnx content"), 0644); err != nil {
+		t.Fatalf("Failed to create ONNX file: %v", err)
+	}
+	data, err := json.Marshal(types.Config{Format: types.FormatONNX})
+	if err != nil {
+		t.Fatalf("Failed to encode config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "config.json"), data, 0644); err != nil {
+		t.Fatalf("Failed to create config.json: %v", err)
+	}
+
+	bundle, err := Parse(tempDir)
+	if err != nil {
+		t.Fatalf("Expected successful parse with ONNX file, got error: %v", err)
+	}
+	if bundle.ONNXPath() != filepath.Join(modelDir, "model.onnx") {
+		t.Errorf("Expected ONNX path to be %s, got: %s", filepath.Join(modelDir, "model.onnx"), bundle.ONNXPath())
+	}
+	if bundle.ggufFile != "" || bundle.safetensorsFile != "" {
+		t.Errorf("Expected no GGUF or safetensors file, got: %q, %q", bundle.ggufFile, bundle.safetensorsFile)
+	}
+}
+
 func TestParse_WithBothFormats(t *testing.T) {
 	// Create a temporary directory for the test bundle
 	tempDir := t.TempDir()
@@ -38,8 +38,12 @@ func Unpack(dir string, model types.Model) (*Bundle, error) {
 		if err := unpackSafetensors(bundle, model); err != nil {
 			return nil, fmt.Errorf("unpack safetensors files: %w", err)
 		}
+	case types.FormatONNX:
+		if err := unpackONNX(bundle, model); err != nil {
+			return nil, fmt.Errorf("unpack ONNX file: %w", err)
+		}
 	default:
-		return nil, fmt.Errorf("no supported model weights found (neither GGUF nor safetensors)")
+		return nil, fmt.Errorf("no supported model weights found (neither GGUF, safetensors, nor ONNX)")
 	}
 
 	// Unpack optional components based on their presence
@@ -49,6 +53,10 @@ func Unpack(dir string, model types.Model) (*Bundle, error) {
 		}
 	}
 
+	if err := unpackLoRAAdapters(bundle, model); err != nil {
+		return nil, fmt.Errorf("add LoRA adapters to runtime bundle: %w", err)
+	}
+
 	if hasLayerWithMediaType(model, types.MediaTypeChatTemplate) {
 		if err := unpackTemplate(bundle, model); err != nil {
 			return nil, fmt.Errorf("add chat template file to runtime bundle: %w", err)
@@ -88,6 +96,12 @@ func detectModelFormat(model types.Model) types.Format {
 		return types.FormatSafetensors
 	}
 
+	// Check for an ONNX file
+	onnxPath, err := model.ONNXPath()
+	if err == nil && onnxPath != "" {
+		return types.FormatONNX
+	}
+
 	return ""
 }
 
@@ -171,6 +185,25 @@ func unpackMultiModalProjector(bundle *Bundle, mdl types.Model) error {
 	return nil
 }
 
+func unpackLoRAAdapters(bundle *Bundle, mdl types.Model) error {
+	paths, err := mdl.LoRAPaths()
+	if err != nil {
+		return fmt.Errorf("get LoRA adapter files for model: %w", err)
+	}
+
+	modelDir := filepath.Join(bundle.dir, ModelSubdir)
+
+	// Adapters are numbered so that they're applied in the order of their layers.
+	for i, path := range paths {
+		name := fmt.Sprintf("adapter-%05d.lora", i+1)
+		if err := unpackFile(filepath.Join(modelDir, name), path); err != nil {
+			return err
+		}
+		bundle.loraPaths = append(bundle.loraPaths, name)
+	}
+	return nil
+}
+
 func unpackTemplate(bundle *Bundle, mdl types.Model) error {
 	path, err := mdl.ChatTemplatePath()
 	if err != nil {
@@ -220,6 +253,21 @@ func unpackSafetensors(bundle *Bundle, mdl types.Model) error {
 	return nil
 }
 
+func unpackONNX(bundle *Bundle, mdl types.Model) error {
+	onnxPath, err := mdl.ONNXPath()
+	if err != nil {
+		return fmt.Errorf("get ONNX file for model: %w", err)
+	}
+
+	modelDir := filepath.Join(bundle.dir, ModelSubdir)
+
+	if err := unpackFile(filepath.Join(modelDir, "model.onnx"), onnxPath); err != nil {
+		return err
+	}
+	bundle.onnxFile = "model.onnx"
+	return nil
+}
+
 func unpackConfigArchive(bundle *Bundle, mdl types.Model) error {
 	archivePath, err := mdl.ConfigArchivePath()
 	if err != nil {
@@ -17,6 +17,7 @@ type model struct {
 	appended        []v1.Layer
 	configMediaType ggcr.MediaType
 	contextSize     *uint64
+	draftModel      string
 }
 
 func (m *model) Descriptor() (types.Descriptor, error) {
@@ -127,6 +128,9 @@ func (m *model) RawConfigFile() ([]byte, error) {
 	if m.contextSize != nil {
 		cf.Config.ContextSize = m.contextSize
 	}
+	if m.draftModel != "" {
+		cf.Config.DraftModel = m.draftModel
+	}
 	raw, err := json.Marshal(cf)
 	if err != nil {
 		return nil, err
@@ -27,3 +27,10 @@ func ContextSize(mdl types.ModelArtifact, cs uint64) types.ModelArtifact {
 		contextSize: &cs,
 	}
 }
+
+func DraftModel(mdl types.ModelArtifact, reference string) types.ModelArtifact {
+	return &model{
+		base:       mdl,
+		draftModel: reference,
+	}
+}
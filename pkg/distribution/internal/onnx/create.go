@@ -0,0 +1,112 @@
+package onnx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	v1 "github.com/docker/model-runner/pkg/go-containerregistry/pkg/v1"
+
+	"github.com/docker/model-runner/pkg/distribution/internal/partial"
+	"github.com/docker/model-runner/pkg/distribution/types"
+)
+
+// MetadataClassifierLabels is the key of the ONNX metadata holding the
+// comma-separated output labels of sequence classification models, as in GGUF
+// metadata.
+const MetadataClassifierLabels = "classifier.output_labels"
+
+// NewModel creates a new ONNX model from an ONNX file. The model's
+// architecture and output labels are read from the Hugging Face config.json
+// file next to it, if any.
+func NewModel(path string) (*Model, error) {
+	layer, err := partial.NewLayer(path, types.MediaTypeONNX)
+	if err != nil {
+		return nil, fmt.Errorf("create ONNX layer from %q: %w", path, err)
+	}
+	diffID, err := layer.DiffID()
+	if err != nil {
+		return nil, fmt.Errorf("get ONNX layer diffID: %w", err)
+	}
+
+	config, err := configFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("create config from file: %w", err)
+	}
+
+	created := time.Now()
+	return &Model{
+		BaseModel: partial.BaseModel{
+			ModelConfigFile: types.ConfigFile{
+				Config: config,
+				Descriptor: types.Descriptor{
+					Created: &created,
+				},
+				RootFS: v1.RootFS{
+					Type:    "rootfs",
+					DiffIDs: []v1.Hash{diffID},
+				},
+			},
+			LayerList: []v1.Layer{layer},
+		},
+	}, nil
+}
+
+func configFromFile(path string) (types.Config, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return types.Config{}, fmt.Errorf("failed to stat file %s: %w", path, err)
+	}
+	config := types.Config{
+		Format: types.FormatONNX,
+		Size:   units.CustomSize("%.2f%s", float64(info.Size()), 1000.0, []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}),
+	}
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), "config.json"))
+	if err != nil {
+		// Continue without metadata if there's no config.json
+		return config, nil
+	}
+	var hfConfig struct {
+		Architectures []string          `json:"architectures"`
+		ID2Label      map[string]string `json:"id2label"`
+	}
+	if err := json.Unmarshal(data, &hfConfig); err != nil {
+		return types.Config{}, fmt.Errorf("parse config.json: %w", err)
+	}
+	if len(hfConfig.Architectures) > 0 {
+		config.Architecture = hfConfig.Architectures[0]
+	}
+	if labels := outputLabels(hfConfig.ID2Label); labels != "" {
+		config.ONNX = map[string]string{MetadataClassifierLabels: labels}
+	}
+	return config, nil
+}
+
+// outputLabels returns the labels of id2label in the order of their outputs,
+// or "" if they don't label every output.
+func outputLabels(id2label map[string]string) string {
+	ids := make([]int, 0, len(id2label))
+	for id := range id2label {
+		i, err := strconv.Atoi(id)
+		if err != nil {
+			return ""
+		}
+		ids = append(ids, i)
+	}
+	sort.Ints(ids)
+	labels := make([]string, len(ids))
+	for i, id := range ids {
+		if id != i {
+			return ""
+		}
+		labels[i] = id2label[strconv.Itoa(id)]
+	}
+	return strings.Join(labels, ", ")
+}
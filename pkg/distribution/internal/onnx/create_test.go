@@ -0,0 +1,74 @@
+package onnx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+)
+
+func TestNewModel(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "model.onnx")
+	if err := os.WriteFile(path, []byte("dummy onnx content"), 0644); err != nil {
+		t.Fatalf("Failed to write ONNX file: %v", err)
+	}
+
+	mdl, err := NewModel(path)
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	config, err := mdl.Config()
+	if err != nil {
+		t.Fatalf("Failed to get config: %v", err)
+	}
+	if config.Format != types.FormatONNX || config.ONNX != nil {
+		t.Errorf("Expected ONNX format without metadata, got %+v", config)
+	}
+	layers, err := mdl.Layers()
+	if err != nil {
+		t.Fatalf("Failed to get layers: %v", err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("Expected 1 layer, got %d", len(layers))
+	}
+	if mediaType, err := layers[0].MediaType(); err != nil || mediaType != types.MediaTypeONNX {
+		t.Errorf("Expected media type %s, got %s (%v)", types.MediaTypeONNX, mediaType, err)
+	}
+
+	// The architecture and labels are read from config.json.
+	hfConfig := `{"architectures": ["DistilBertForSequenceClassification"], "id2label": {"1": "POSITIVE", "0": "NEGATIVE"}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(hfConfig), 0644); err != nil {
+		t.Fatalf("Failed to write config.json: %v", err)
+	}
+	if mdl, err = NewModel(path); err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	if config, err = mdl.Config(); err != nil {
+		t.Fatalf("Failed to get config: %v", err)
+	}
+	if config.Architecture != "DistilBertForSequenceClassification" {
+		t.Errorf("Expected architecture from config.json, got %q", config.Architecture)
+	}
+	if labels := config.ONNX[MetadataClassifierLabels]; labels != "NEGATIVE, POSITIVE" {
+		t.Errorf("Expected labels in output order, got %q", labels)
+	}
+}
+
+func TestOutputLabels(t *testing.T) {
+	tests := []struct {
+		id2label map[string]string
+		want     string
+	}{
+		{id2label: nil, want: ""},
+		{id2label: map[string]string{"0": "safe", "1": "toxic"}, want: "safe, toxic"},
+		{id2label: map[string]string{"0": "safe", "2": "toxic"}, want: ""},
+		{id2label: map[string]string{"a": "safe"}, want: ""},
+	}
+	for _, tt := range tests {
+		if got := outputLabels(tt.id2label); got != tt.want {
+			t.Errorf("outputLabels(%v) = %q, want %q", tt.id2label, got, tt.want)
+		}
+	}
+}
@@ -84,6 +84,10 @@ func MMPROJPath(i WithLayers) (string, error) {
 	return paths[0], err
 }
 
+func LoRAPaths(i WithLayers) ([]string, error) {
+	return layerPathsByMediaType(i, types.MediaTypeLoRAAdapter)
+}
+
 func ChatTemplatePath(i WithLayers) (string, error) {
 	paths, err := layerPathsByMediaType(i, types.MediaTypeChatTemplate)
 	if err != nil {
@@ -103,6 +107,21 @@ func SafetensorsPaths(i WithLayers) ([]string, error) {
 	return layerPathsByMediaType(i, types.MediaTypeSafetensors)
 }
 
+func ONNXPath(i WithLayers) (string, error) {
+	paths, err := layerPathsByMediaType(i, types.MediaTypeONNX)
+	if err != nil {
+		return "", fmt.Errorf("get ONNX layer paths: %w", err)
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("model does not contain any layer of type %q", types.MediaTypeONNX)
+	}
+	if len(paths) > 1 {
+		return "", fmt.Errorf("found %d files of type %q, expected exactly 1",
+			len(paths), types.MediaTypeONNX)
+	}
+	return paths[0], err
+}
+
 func ConfigArchivePath(i WithLayers) (string, error) {
 	paths, err := layerPathsByMediaType(i, types.MediaTypeVLLMConfigArchive)
 	if err != nil {
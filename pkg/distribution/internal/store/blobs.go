@@ -89,7 +89,7 @@ func (s *LocalStore) writeLayer(layer blob, updates chan<- v1.Update) (bool, v1.
 	if err != nil {
 		return false, v1.Hash{}, fmt.Errorf("get file hash: %w", err)
 	}
-	hasBlob, err := s.hasBlob(hash)
+	hasBlob, err := s.HasBlob(hash)
 	if err != nil {
 		return false, v1.Hash{}, fmt.Errorf("check blob existence: %w", err)
 	}
@@ -130,7 +130,7 @@ func (s *LocalStore) writeLayer(layer blob, updates chan<- v1.Update) (bool, v1.
 // If the blob is already in the store, it is a no-op and the blob is not consumed from the reader.
 // If an incomplete download exists, it will be resumed by appending to the existing file.
 func (s *LocalStore) WriteBlob(diffID v1.Hash, r io.Reader) error {
-	hasBlob, err := s.hasBlob(diffID)
+	hasBlob, err := s.HasBlob(diffID)
 	if err != nil {
 		return fmt.Errorf("check blob existence: %w", err)
 	}
@@ -224,8 +224,8 @@ func (s *LocalStore) WriteBlob(diffID v1.Hash, r io.Reader) error {
 	return nil
 }
 
-// removeBlob removes the blob with the given hash from the store.
-func (s *LocalStore) removeBlob(hash v1.Hash) error {
+// RemoveBlob removes the blob with the given hash from the store.
+func (s *LocalStore) RemoveBlob(hash v1.Hash) error {
 	path, err := s.blobPath(hash)
 	if err != nil {
 		return fmt.Errorf("get blob path: %w", err)
@@ -233,7 +233,8 @@ func (s *LocalStore) removeBlob(hash v1.Hash) error {
 	return os.Remove(path)
 }
 
-func (s *LocalStore) hasBlob(hash v1.Hash) (bool, error) {
+// HasBlob reports whether the store contains the blob with the given hash.
+func (s *LocalStore) HasBlob(hash v1.Hash) (bool, error) {
 	path, err := s.blobPath(hash)
 	if err != nil {
 		return false, fmt.Errorf("get blob path: %w", err)
@@ -263,6 +264,33 @@ func (s *LocalStore) GetIncompleteSize(hash v1.Hash) (int64, error) {
 	return stat.Size(), nil
 }
 
+// Completeness returns the number of bytes of a model's layers that are
+// present in the store (including partially written layers) and the number of
+// bytes expected according to the model's manifest.
+func (s *LocalStore) Completeness(reference string) (present, expected int64, err error) {
+	mdl, err := s.Read(reference)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, layer := range mdl.manifest.Layers {
+		expected += layer.Size
+		path, err := s.blobPath(layer.Digest)
+		if err != nil {
+			return 0, 0, fmt.Errorf("get blob path: %w", err)
+		}
+		if stat, err := os.Stat(path); err == nil {
+			present += min(stat.Size(), layer.Size)
+			continue
+		}
+		incompleteSize, err := s.GetIncompleteSize(layer.Digest)
+		if err != nil {
+			return 0, 0, err
+		}
+		present += min(incompleteSize, layer.Size)
+	}
+	return present, expected, nil
+}
+
 // createFile is a wrapper around os.Create that creates any parent directories as needed.
 func createFile(path string) (*os.File, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
@@ -282,7 +310,7 @@ func (s *LocalStore) writeConfigFile(mdl v1.Image) (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("get digest: %w", err)
 	}
-	hasBlob, err := s.hasBlob(hash)
+	hasBlob, err := s.HasBlob(hash)
 	if err != nil {
 		return false, fmt.Errorf("check config existence: %w", err)
 	}
@@ -11,6 +11,7 @@ import (
 	"github.com/docker/model-runner/pkg/go-containerregistry/pkg/name"
 
 	"github.com/docker/model-runner/pkg/distribution/registry"
+	"github.com/docker/model-runner/pkg/storage"
 )
 
 // Index represents the index of all models in the store
@@ -95,9 +96,28 @@ func (i Index) Add(entry IndexEntry) Index {
 	}
 }
 
+// indexKey is the metadata key of the index
+const indexKey = "models.json"
+
 // indexPath returns the path to the index file
 func (s *LocalStore) indexPath() string {
-	return filepath.Join(s.rootPath, "models.json")
+	return filepath.Join(s.rootPath, indexKey)
+}
+
+// indexExists reports whether the index has been written
+func (s *LocalStore) indexExists() (bool, error) {
+	if s.metadata != nil {
+		_, err := s.metadata.Get(indexKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	_, err := os.Stat(s.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 // writeIndex writes the index to the index file
@@ -109,7 +129,12 @@ func (s *LocalStore) writeIndex(index Index) error {
 	}
 
 	// Write the models index
-	if err := writeFile(s.indexPath(), modelsData); err != nil {
+	if s.metadata != nil {
+		err = s.metadata.Put(indexKey, modelsData)
+	} else {
+		err = writeFile(s.indexPath(), modelsData)
+	}
+	if err != nil {
 		return fmt.Errorf("writing models file: %w", err)
 	}
 
@@ -123,8 +148,14 @@ func (s *LocalStore) writeIndex(index Index) error {
 // readIndex reads the index from the index file
 func (s *LocalStore) readIndex() (Index, error) {
 	// Read the models index
-	modelsData, err := os.ReadFile(s.indexPath())
-	if errors.Is(err, os.ErrNotExist) {
+	var modelsData []byte
+	var err error
+	if s.metadata != nil {
+		modelsData, err = s.metadata.Get(indexKey)
+	} else {
+		modelsData, err = os.ReadFile(s.indexPath())
+	}
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, storage.ErrNotFound) {
 		return Index{}, nil
 	} else if err != nil {
 		return Index{}, fmt.Errorf("reading models file: %w", err)
@@ -26,7 +26,7 @@ func (s *LocalStore) WriteManifest(hash v1.Hash, raw []byte) error {
 		return fmt.Errorf("parse manifest: %w", err)
 	}
 	for _, layer := range manifest.Layers {
-		hasBlob, err := s.hasBlob(layer.Digest)
+		hasBlob, err := s.HasBlob(layer.Digest)
 		if err != nil {
 			return fmt.Errorf("check blob existence: %w", err)
 		}
@@ -126,6 +126,10 @@ func (m *Model) MMPROJPath() (string, error) {
 	return mdpartial.MMPROJPath(m)
 }
 
+func (m *Model) LoRAPaths() ([]string, error) {
+	return mdpartial.LoRAPaths(m)
+}
+
 func (m *Model) ChatTemplatePath() (string, error) {
 	return mdpartial.ChatTemplatePath(m)
 }
@@ -134,6 +138,10 @@ func (m *Model) SafetensorsPaths() ([]string, error) {
 	return mdpartial.SafetensorsPaths(m)
 }
 
+func (m *Model) ONNXPath() (string, error) {
+	return mdpartial.ONNXPath(m)
+}
+
 func (m *Model) ConfigArchivePath() (string, error) {
 	return mdpartial.ConfigArchivePath(m)
 }
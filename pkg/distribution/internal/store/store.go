@@ -6,12 +6,14 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
 	v1 "github.com/docker/model-runner/pkg/go-containerregistry/pkg/v1"
 
 	"github.com/docker/model-runner/pkg/distribution/internal/progress"
+	"github.com/docker/model-runner/pkg/storage"
 )
 
 const (
@@ -22,6 +24,7 @@ const (
 // LocalStore implements the Store interface for local storage
 type LocalStore struct {
 	rootPath string
+	metadata storage.KV
 }
 
 // RootPath returns the root path of the store
@@ -32,12 +35,16 @@ func (s *LocalStore) RootPath() string {
 // Options represents options for creating a store
 type Options struct {
 	RootPath string
+	// Metadata stores the models index instead of the models.json file of the
+	// root path, if set.
+	Metadata storage.KV
 }
 
 // New creates a new LocalStore
 func New(opts Options) (*LocalStore, error) {
 	store := &LocalStore{
 		rootPath: opts.RootPath,
+		metadata: opts.Metadata,
 	}
 
 	// Initialize store if it doesn't exist
@@ -64,6 +71,15 @@ func (s *LocalStore) Reset() error {
 		}
 	}
 
+	if s.metadata != nil {
+		if err := s.metadata.Delete(indexKey); err != nil {
+			return fmt.Errorf("removing models index: %w", err)
+		}
+		if err := s.metadata.Delete(trashKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("removing trash: %w", err)
+		}
+	}
+
 	return s.initialize()
 }
 
@@ -75,7 +91,9 @@ func (s *LocalStore) initialize() error {
 	}
 
 	// Check if models.json exists, create if not
-	if _, err := os.Stat(s.indexPath()); os.IsNotExist(err) {
+	if exists, err := s.indexExists(); err != nil {
+		return fmt.Errorf("checking index: %w", err)
+	} else if !exists {
 		if err := s.writeIndex(Index{
 			Models: []IndexEntry{},
 		}); err != nil {
@@ -118,9 +136,19 @@ func (s *LocalStore) Delete(ref string) (string, []string, error) {
 		return "", nil, fmt.Errorf("parse manifest digest %q: %w", model.ID, err)
 	}
 
-	// Remove manifest file
-	if err := s.removeManifest(digest); err != nil {
-		fmt.Printf("Warning: failed to remove manifest %q: %v\n", digest, err)
+	// Models in the trash retain their manifests and blobs until they're
+	// purged.
+	trash, err := s.readTrash()
+	if err != nil {
+		return "", nil, err
+	}
+	trashed := slices.ContainsFunc(trash.Models, func(e TrashEntry) bool { return e.ID == model.ID })
+
+	// Remove manifest file, unless a trashed copy of the model retains it
+	if !trashed {
+		if err := s.removeManifest(digest); err != nil {
+			fmt.Printf("Warning: failed to remove manifest %q: %v\n", digest, err)
+		}
 	}
 
 	// Remove bundle if one exists
@@ -138,6 +166,11 @@ func (s *LocalStore) Delete(ref string) (string, []string, error) {
 			blobRefs[file]++
 		}
 	}
+	for _, m := range trash.Models {
+		for _, file := range m.Files {
+			blobRefs[file]++
+		}
+	}
 	// Only delete blobs that are not referenced by other models
 	for _, blobFile := range model.Files {
 		if blobRefs[blobFile] > 0 {
@@ -149,7 +182,7 @@ func (s *LocalStore) Delete(ref string) (string, []string, error) {
 			fmt.Printf("Warning: failed to parse blob hash %s: %v\n", blobFile, err)
 			continue
 		}
-		if err := s.removeBlob(hash); err != nil {
+		if err := s.RemoveBlob(hash); err != nil {
 			// Just log the error but don't fail the operation
 			fmt.Printf("Warning: failed to remove blob %q from store: %v\n", hash.String(), err)
 		}
@@ -262,7 +295,7 @@ func (s *LocalStore) Write(mdl v1.Image, tags []string, w io.Writer) (err error)
 			return fmt.Errorf("config digest: %w", hashErr)
 		}
 		cleanups = append(cleanups, func() error {
-			if err := s.removeBlob(cfgHash); err != nil && !errors.Is(err, os.ErrNotExist) {
+			if err := s.RemoveBlob(cfgHash); err != nil && !errors.Is(err, os.ErrNotExist) {
 				return fmt.Errorf("remove config blob: %w", err)
 			}
 			return nil
@@ -357,7 +390,7 @@ func (s *LocalStore) Write(mdl v1.Image, tags []string, w io.Writer) (err error)
 		cleanups = append(cleanups, func() error {
 			var errs []error
 			for _, dg := range digests {
-				if err := s.removeBlob(dg); err != nil && !errors.Is(err, os.ErrNotExist) {
+				if err := s.RemoveBlob(dg); err != nil && !errors.Is(err, os.ErrNotExist) {
 					errs = append(errs, fmt.Errorf("remove blob %s: %w", dg, err))
 				}
 			}
@@ -450,7 +483,7 @@ func (s *LocalStore) WriteLightweight(mdl v1.Image, tags []string) (err error) {
 		if err != nil {
 			return fmt.Errorf("getting layer digest: %w", err)
 		}
-		hasBlob, err := s.hasBlob(digest)
+		hasBlob, err := s.HasBlob(digest)
 		if err != nil {
 			return fmt.Errorf("checking if layer %s exists: %w", digest, err)
 		}
@@ -470,7 +503,7 @@ func (s *LocalStore) WriteLightweight(mdl v1.Image, tags []string) (err error) {
 			return fmt.Errorf("config digest: %w", hashErr)
 		}
 		cleanups = append(cleanups, func() error {
-			if err := s.removeBlob(cfgHash); err != nil && !errors.Is(err, os.ErrNotExist) {
+			if err := s.RemoveBlob(cfgHash); err != nil && !errors.Is(err, os.ErrNotExist) {
 				return fmt.Errorf("remove config blob: %w", err)
 			}
 			return nil
@@ -17,6 +17,7 @@ import (
 	"github.com/docker/model-runner/pkg/distribution/internal/store"
 	"github.com/docker/model-runner/pkg/distribution/types"
 	v1 "github.com/docker/model-runner/pkg/go-containerregistry/pkg/v1"
+	"github.com/docker/model-runner/pkg/storage"
 )
 
 // TestStoreAPI tests the store API directly
@@ -1361,3 +1362,94 @@ func TestWriteLightweight(t *testing.T) {
 		}
 	})
 }
+
+// TestCompleteness tests that missing and partially written layers are
+// reported as incomplete.
+func TestCompleteness(t *testing.T) {
+	tempDir := t.TempDir()
+
+	modelContent := []byte("test model content for completeness test")
+	modelPath := filepath.Join(tempDir, "completeness-test-model.gguf")
+	if err := os.WriteFile(modelPath, modelContent, 0644); err != nil {
+		t.Fatalf("Failed to create test model file: %v", err)
+	}
+	hash := sha256.Sum256(modelContent)
+	blobHash := hex.EncodeToString(hash[:])
+
+	s, err := store.New(store.Options{RootPath: filepath.Join(tempDir, "store")})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	mdl, err := gguf.NewModel(modelPath)
+	if err != nil {
+		t.Fatalf("Create model failed: %v", err)
+	}
+	if err := s.Write(mdl, []string{"completeness-test:latest"}, nil); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	present, expected, err := s.Completeness("completeness-test:latest")
+	if err != nil {
+		t.Fatalf("Completeness failed: %v", err)
+	}
+	if present != expected || expected != int64(len(modelContent)) {
+		t.Errorf("Expected complete model of %d bytes, got %d/%d", len(modelContent), present, expected)
+	}
+
+	// Replace the layer blob with a partially written one.
+	blobPath := filepath.Join(tempDir, "store", "blobs", "sha256", blobHash)
+	if err := os.Remove(blobPath); err != nil {
+		t.Fatalf("Failed to remove blob: %v", err)
+	}
+	if err := os.WriteFile(blobPath+".incomplete", modelContent[:10], 0644); err != nil {
+		t.Fatalf("Failed to create incomplete file: %v", err)
+	}
+
+	present, expected, err = s.Completeness("completeness-test:latest")
+	if err != nil {
+		t.Fatalf("Completeness failed: %v", err)
+	}
+	if present != 10 || expected != int64(len(modelContent)) {
+		t.Errorf("Expected 10/%d bytes present, got %d/%d", len(modelContent), present, expected)
+	}
+
+	if _, _, err := s.Completeness("missing:latest"); !errors.Is(err, store.ErrModelNotFound) {
+		t.Errorf("Expected ErrModelNotFound, got %v", err)
+	}
+}
+
+// TestMetadataStorage tests that the index is kept in the metadata storage
+func TestMetadataStorage(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "metadata-store")
+	metadata := storage.NewMemory()
+	s, err := store.New(store.Options{RootPath: storePath, Metadata: metadata})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	if err := s.Write(newTestModel(t), []string{"metadata-model:latest"}, nil); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(storePath, "models.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no models.json file, got %v", err)
+	}
+	if _, err := metadata.Get("models.json"); err != nil {
+		t.Errorf("Expected the index in the metadata storage: %v", err)
+	}
+
+	// A new store sharing the metadata sees the model
+	s, err = store.New(store.Options{RootPath: storePath, Metadata: metadata})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if _, err := s.Read("metadata-model:latest"); err != nil {
+		t.Errorf("Read failed: %v", err)
+	}
+
+	if err := s.Reset(); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if models, err := s.List(); err != nil || len(models) != 0 {
+		t.Errorf("Expected an empty index after reset, got %v (%v)", models, err)
+	}
+}
@@ -0,0 +1,266 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	v1 "github.com/docker/model-runner/pkg/go-containerregistry/pkg/v1"
+
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+// trashKey is the metadata key of the trash
+const trashKey = "trash.json"
+
+// Trash is the index of deleted models whose blobs are retained until they're
+// restored or purged
+type Trash struct {
+	Models []TrashEntry `json:"models"`
+}
+
+// TrashEntry represents a deleted model
+type TrashEntry struct {
+	IndexEntry
+	// DeletedAt is the time the model was moved to the trash.
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// trashPath returns the path to the trash file
+func (s *LocalStore) trashPath() string {
+	return filepath.Join(s.rootPath, trashKey)
+}
+
+// readTrash reads the trash, which is empty if it hasn't been written
+func (s *LocalStore) readTrash() (Trash, error) {
+	var data []byte
+	var err error
+	if s.metadata != nil {
+		data, err = s.metadata.Get(trashKey)
+	} else {
+		data, err = os.ReadFile(s.trashPath())
+	}
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, storage.ErrNotFound) {
+		return Trash{}, nil
+	} else if err != nil {
+		return Trash{}, fmt.Errorf("reading trash file: %w", err)
+	}
+
+	var trash Trash
+	if err := json.Unmarshal(data, &trash); err != nil {
+		return Trash{}, fmt.Errorf("unmarshaling trash: %w", err)
+	}
+	return trash, nil
+}
+
+// writeTrash writes the trash
+func (s *LocalStore) writeTrash(trash Trash) error {
+	data, err := json.MarshalIndent(trash, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling trash: %w", err)
+	}
+	if s.metadata != nil {
+		err = s.metadata.Put(trashKey, data)
+	} else {
+		err = writeFile(s.trashPath(), data)
+	}
+	if err != nil {
+		return fmt.Errorf("writing trash file: %w", err)
+	}
+	return nil
+}
+
+// MoveToTrash removes a model from the index, retaining its manifest and
+// blobs in the trash so that it can be restored. It returns the model's ID
+// and tags.
+func (s *LocalStore) MoveToTrash(ref string) (string, []string, error) {
+	idx, err := s.readIndex()
+	if err != nil {
+		return "", nil, fmt.Errorf("reading models file: %w", err)
+	}
+	model, _, ok := idx.Find(ref)
+	if !ok {
+		return "", nil, ErrModelNotFound
+	}
+	trash, err := s.readTrash()
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Merge the tags of a previous deletion of the same model.
+	entry := TrashEntry{IndexEntry: model, DeletedAt: time.Now().UTC()}
+	if i := slices.IndexFunc(trash.Models, func(e TrashEntry) bool { return e.ID == model.ID }); i >= 0 {
+		for _, tag := range trash.Models[i].Tags {
+			if !slices.Contains(entry.Tags, tag) {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+		trash.Models = slices.Delete(trash.Models, i, i+1)
+	}
+	trash.Models = append(trash.Models, entry)
+
+	// Bundles are recreated on demand, so they aren't retained.
+	if digest, err := v1.NewHash(model.ID); err == nil {
+		if err := s.removeBundle(digest); err != nil {
+			fmt.Printf("Warning: failed to remove bundle %q: %v\n", digest, err)
+		}
+	}
+
+	// Write the trash first, so that the model isn't lost if writing the
+	// index fails.
+	if err := s.writeTrash(trash); err != nil {
+		return "", nil, err
+	}
+	return model.ID, model.Tags, s.writeIndex(idx.Remove(model.ID))
+}
+
+// ListTrash lists the models in the trash
+func (s *LocalStore) ListTrash() ([]TrashEntry, error) {
+	trash, err := s.readTrash()
+	if err != nil {
+		return nil, err
+	}
+	return trash.Models, nil
+}
+
+// Restore moves a model from the trash back to the index, by ID or by one of
+// its former tags. Tags that have since been assigned to other models aren't
+// restored. It returns the restored entry.
+func (s *LocalStore) Restore(ref string) (TrashEntry, error) {
+	trash, err := s.readTrash()
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	i := slices.IndexFunc(trash.Models, func(e TrashEntry) bool { return e.MatchesReference(ref) })
+	if i < 0 {
+		return TrashEntry{}, ErrModelNotFound
+	}
+	entry := trash.Models[i]
+
+	idx, err := s.readIndex()
+	if err != nil {
+		return TrashEntry{}, fmt.Errorf("reading models file: %w", err)
+	}
+	existing, n, exists := idx.Find(entry.ID)
+	var tags []string
+	for _, tag := range entry.Tags {
+		if other, _, ok := idx.Find(tag); !ok || other.ID == entry.ID {
+			tags = append(tags, tag)
+		}
+	}
+	if exists {
+		// The model has been pulled again since it was deleted.
+		for _, tag := range tags {
+			if !slices.Contains(existing.Tags, tag) {
+				existing.Tags = append(existing.Tags, tag)
+			}
+		}
+		idx.Models[n] = existing
+		entry.Tags = existing.Tags
+	} else {
+		entry.Tags = tags
+		idx = idx.Add(entry.IndexEntry)
+	}
+
+	if err := s.writeIndex(idx); err != nil {
+		return TrashEntry{}, err
+	}
+	trash.Models = slices.Delete(trash.Models, i, i+1)
+	return entry, s.writeTrash(trash)
+}
+
+// PurgeTrash permanently deletes the models in the trash for which purge
+// returns true, removing their manifests and the blobs that no other model
+// references. It returns the IDs of the deleted models.
+func (s *LocalStore) PurgeTrash(purge func(TrashEntry) bool) ([]string, error) {
+	trash, err := s.readTrash()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := s.readIndex()
+	if err != nil {
+		return nil, fmt.Errorf("reading models file: %w", err)
+	}
+
+	var purged []TrashEntry
+	var kept Trash
+	for _, entry := range trash.Models {
+		if purge(entry) {
+			purged = append(purged, entry)
+		} else {
+			kept.Models = append(kept.Models, entry)
+		}
+	}
+	if len(purged) == 0 {
+		return nil, nil
+	}
+	if err := s.writeTrash(kept); err != nil {
+		return nil, err
+	}
+
+	// Retain the blobs referenced by models in the index or the trash.
+	blobRefs := make(map[string]int)
+	for _, m := range idx.Models {
+		for _, file := range m.Files {
+			blobRefs[file]++
+		}
+	}
+	for _, m := range kept.Models {
+		for _, file := range m.Files {
+			blobRefs[file]++
+		}
+	}
+
+	var ids []string
+	for _, entry := range purged {
+		ids = append(ids, entry.ID)
+		if _, _, ok := idx.Find(entry.ID); !ok {
+			digest, err := v1.NewHash(entry.ID)
+			if err != nil {
+				fmt.Printf("Warning: failed to parse manifest digest %q: %v\n", entry.ID, err)
+			} else if err := s.removeManifest(digest); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("Warning: failed to remove manifest %q: %v\n", digest, err)
+			}
+		}
+		for _, blobFile := range entry.Files {
+			if blobRefs[blobFile] > 0 {
+				continue
+			}
+			hash, err := v1.NewHash(blobFile)
+			if err != nil {
+				fmt.Printf("Warning: failed to parse blob hash %s: %v\n", blobFile, err)
+				continue
+			}
+			if err := s.RemoveBlob(hash); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("Warning: failed to remove blob %q from store: %v\n", hash.String(), err)
+			}
+			// Blobs shared by purged models are only removed once.
+			blobRefs[blobFile]++
+		}
+	}
+	return ids, nil
+}
+
+// BlobsSize returns the total size of the specified blobs that exist in the
+// store
+func (s *LocalStore) BlobsSize(files []string) int64 {
+	var size int64
+	for _, file := range files {
+		hash, err := v1.NewHash(file)
+		if err != nil {
+			continue
+		}
+		path, err := s.blobPath(hash)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
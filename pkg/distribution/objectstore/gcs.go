@@ -0,0 +1,231 @@
+package objectstore
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// gcsEndpoint is the Google Cloud Storage JSON API endpoint.
+	gcsEndpoint = "https://storage.googleapis.com"
+	// gcsReadScope is the OAuth scope granting read access to objects.
+	gcsReadScope = "https://www.googleapis.com/auth/devstorage.read_only"
+	// googleTokenURL is the default Google OAuth token endpoint.
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	// gceMetadataHost is the default host of the GCE metadata server.
+	gceMetadataHost = "metadata.google.internal"
+)
+
+// googleCredentialsFile is a Google credentials file, holding either service
+// account credentials or authorized user (gcloud) credentials.
+type googleCredentialsFile struct {
+	// Type is the credentials type ("service_account" or "authorized_user").
+	Type string `json:"type"`
+	// ClientEmail is the service account's email address.
+	ClientEmail string `json:"client_email"`
+	// PrivateKey is the service account's PEM-encoded private key.
+	PrivateKey string `json:"private_key"`
+	// TokenURI is the service account's token endpoint.
+	TokenURI string `json:"token_uri"`
+	// ClientID is the authorized user's OAuth client ID.
+	ClientID string `json:"client_id"`
+	// ClientSecret is the authorized user's OAuth client secret.
+	ClientSecret string `json:"client_secret"`
+	// RefreshToken is the authorized user's refresh token.
+	RefreshToken string `json:"refresh_token"`
+}
+
+// googleToken is an OAuth token response.
+type googleToken struct {
+	// AccessToken is the access token.
+	AccessToken string `json:"access_token"`
+}
+
+// newGCSRequest creates a request for a Google Cloud Storage object. The
+// storage emulator is supported via the STORAGE_EMULATOR_HOST variable.
+func (c *Client) newGCSRequest(ctx context.Context, location Location) (*http.Request, error) {
+	endpoint := gcsEndpoint
+	if emulatorHost := c.getenv("STORAGE_EMULATOR_HOST"); emulatorHost != "" {
+		endpoint = strings.TrimRight(emulatorHost, "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	}
+	objectURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media",
+		endpoint, url.PathEscape(location.Bucket), url.PathEscape(location.Key))
+	req, err := c.newRequest(ctx, objectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := c.googleAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// googleAccessToken resolves a Google access token following the application
+// default credentials conventions: an explicit token, the credentials file
+// named by GOOGLE_APPLICATION_CREDENTIALS, the gcloud application default
+// credentials file, and finally the GCE metadata server. It returns an empty
+// token if no credentials are found, in which case requests are made
+// anonymously.
+func (c *Client) googleAccessToken(ctx context.Context) (string, error) {
+	if token := c.getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	path := c.getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if dir := c.getenv("CLOUDSDK_CONFIG"); dir != "" {
+			path = filepath.Join(dir, "application_default_credentials.json")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return c.googleTokenFromFile(ctx, data)
+		} else if !os.IsNotExist(err) || c.getenv("GOOGLE_APPLICATION_CREDENTIALS") != "" {
+			return "", fmt.Errorf("reading Google credentials file: %w", err)
+		}
+	}
+
+	return c.googleMetadataToken(ctx), nil
+}
+
+// googleTokenFromFile exchanges the credentials in a Google credentials file
+// for an access token.
+func (c *Client) googleTokenFromFile(ctx context.Context, data []byte) (string, error) {
+	var credentials googleCredentialsFile
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return "", fmt.Errorf("parsing Google credentials file: %w", err)
+	}
+
+	form := url.Values{}
+	tokenURL := googleTokenURL
+	switch credentials.Type {
+	case "service_account":
+		assertion, err := c.serviceAccountAssertion(credentials)
+		if err != nil {
+			return "", err
+		}
+		if credentials.TokenURI != "" {
+			tokenURL = credentials.TokenURI
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", credentials.ClientID)
+		form.Set("client_secret", credentials.ClientSecret)
+		form.Set("refresh_token", credentials.RefreshToken)
+	default:
+		return "", fmt.Errorf("unsupported Google credentials type %q", credentials.Type)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching Google access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: fetching Google access token: unexpected status %s", ErrUnauthorized, resp.Status)
+	}
+	var token googleToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decoding Google access token: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// serviceAccountAssertion creates a signed JWT asserting a service account's
+// identity for the OAuth JWT bearer grant.
+func (c *Client) serviceAccountAssertion(credentials googleCredentialsFile) (string, error) {
+	block, _ := pem.Decode([]byte(credentials.PrivateKey))
+	if block == nil {
+		return "", errors.New("invalid service account private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("parsing service account private key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("service account private key isn't an RSA key")
+	}
+
+	audience := credentials.TokenURI
+	if audience == "" {
+		audience = googleTokenURL
+	}
+	issued := c.now().Unix()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   credentials.ClientEmail,
+		"scope": gcsReadScope,
+		"aud":   audience,
+		"iat":   issued,
+		"exp":   issued + 3600,
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing service account assertion: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// googleMetadataToken fetches an access token for the instance's service
+// account from the GCE metadata server. It returns an empty token if the
+// metadata server is unavailable.
+func (c *Client) googleMetadataToken(ctx context.Context) string {
+	host := firstNonEmpty(c.getenv("GCE_METADATA_HOST"), gceMetadataHost)
+	tokenURL := "http://" + host + "/computeMetadata/v1/instance/service-accounts/default/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL, http.NoBody)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := c.metadataClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	var token googleToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return ""
+	}
+	return token.AccessToken
+}
@@ -0,0 +1,204 @@
+// Package objectstore fetches objects from cloud object storage (Amazon S3,
+// Google Cloud Storage, and Azure Blob Storage), authenticating with the
+// credentials that each provider's standard tooling would use.
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnsupportedURL indicates that a URL doesn't identify an object in a
+	// supported object store.
+	ErrUnsupportedURL = errors.New("unsupported object storage URL")
+	// ErrObjectNotFound indicates that an object doesn't exist.
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrUnauthorized indicates that access to an object was denied.
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// Supported providers, identified by their URL schemes.
+const (
+	// ProviderS3 identifies Amazon S3 (and S3-compatible) storage, e.g.
+	// s3://bucket/path/to/object.
+	ProviderS3 = "s3"
+	// ProviderGCS identifies Google Cloud Storage, e.g.
+	// gs://bucket/path/to/object.
+	ProviderGCS = "gs"
+	// ProviderAzure identifies Azure Blob Storage, e.g.
+	// az://account/container/path/to/blob.
+	ProviderAzure = "az"
+)
+
+// Location identifies an object in an object store.
+type Location struct {
+	// Provider is the object store provider.
+	Provider string
+	// Account is the storage account (Azure only).
+	Account string
+	// Bucket is the bucket (or Azure container) holding the object.
+	Bucket string
+	// Key is the object's key within the bucket.
+	Key string
+}
+
+// Name returns the object's base name.
+func (l Location) Name() string {
+	return l.Key[strings.LastIndex(l.Key, "/")+1:]
+}
+
+// IsURL returns whether ref is an object storage URL.
+func IsURL(ref string) bool {
+	scheme, _, ok := strings.Cut(ref, "://")
+	if !ok {
+		return false
+	}
+	switch scheme {
+	case ProviderS3, ProviderGCS, ProviderAzure:
+		return true
+	default:
+		return false
+	}
+}
+
+// Parse parses an object storage URL.
+func Parse(rawURL string) (Location, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Location{}, fmt.Errorf("%w: %v", ErrUnsupportedURL, err)
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+
+	var location Location
+	switch u.Scheme {
+	case ProviderS3, ProviderGCS:
+		location = Location{Provider: u.Scheme, Bucket: u.Host, Key: path}
+	case ProviderAzure:
+		container, key, _ := strings.Cut(path, "/")
+		location = Location{Provider: u.Scheme, Account: u.Host, Bucket: container, Key: key}
+		if location.Account == "" {
+			return Location{}, fmt.Errorf("%w: missing storage account in %q", ErrUnsupportedURL, rawURL)
+		}
+	default:
+		return Location{}, fmt.Errorf("%w: %q", ErrUnsupportedURL, rawURL)
+	}
+	if location.Bucket == "" || location.Key == "" || strings.HasSuffix(location.Key, "/") {
+		return Location{}, fmt.Errorf("%w: %q doesn't identify an object", ErrUnsupportedURL, rawURL)
+	}
+	return location, nil
+}
+
+// Object is an object being read from an object store.
+type Object struct {
+	// Body is the object's content. It must be closed by the caller.
+	Body io.ReadCloser
+	// Size is the object's size, or -1 if it's unknown.
+	Size int64
+}
+
+// Client fetches objects from object stores.
+type Client struct {
+	// httpClient is the client used for object and credential requests.
+	httpClient *http.Client
+	// metadataClient is the client used for requests to cloud instance
+	// metadata services, which only exist on cloud instances and must
+	// therefore fail fast elsewhere.
+	metadataClient *http.Client
+	// userAgent is the User-Agent header sent with object requests.
+	userAgent string
+	// getenv looks up environment variables.
+	getenv func(string) string
+	// now returns the current time.
+	now func() time.Time
+}
+
+// NewClient creates a new object store client that uses the specified
+// transport for object requests.
+func NewClient(transport http.RoundTripper, userAgent string) *Client {
+	return &Client{
+		httpClient:     &http.Client{Transport: transport},
+		metadataClient: &http.Client{Timeout: 2 * time.Second},
+		userAgent:      userAgent,
+		getenv:         os.Getenv,
+		now:            time.Now,
+	}
+}
+
+// Open opens the object at the specified object storage URL.
+func (c *Client) Open(ctx context.Context, rawURL string) (*Object, error) {
+	location, err := Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var req *http.Request
+	switch location.Provider {
+	case ProviderS3:
+		req, err = c.newS3Request(ctx, location)
+	case ProviderGCS:
+		req, err = c.newGCSRequest(ctx, location)
+	case ProviderAzure:
+		req, err = c.newAzureRequest(ctx, location)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", rawURL, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return &Object{Body: resp.Body, Size: resp.ContentLength}, nil
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, rawURL)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: access to %s denied", ErrUnauthorized, rawURL)
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: unexpected status %s: %s", rawURL, resp.Status, strings.TrimSpace(string(body)))
+	}
+}
+
+// newRequest creates a GET request for an object.
+func (c *Client) newRequest(ctx context.Context, objectURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, objectURL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	return req, nil
+}
+
+// escapePath escapes each segment of an object key for use in a URL path.
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// firstNonEmpty returns the first non-empty value.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,296 @@
+package objectstore
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultAWSRegion is the region used if none is configured.
+	defaultAWSRegion = "us-east-1"
+	// ecsCredentialsHost is the host of the ECS container credentials
+	// endpoint.
+	ecsCredentialsHost = "http://169.254.170.2"
+	// unsignedPayload is the payload hash used for requests whose payload
+	// isn't signed.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// awsCredentials are AWS access credentials.
+type awsCredentials struct {
+	// AccessKeyID is the access key ID.
+	AccessKeyID string `json:"AccessKeyId"`
+	// SecretAccessKey is the secret access key.
+	SecretAccessKey string `json:"SecretAccessKey"`
+	// SessionToken is the optional session token for temporary credentials.
+	SessionToken string `json:"Token"`
+}
+
+// newS3Request creates a request for an S3 object. S3-compatible stores are
+// supported via the AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL) variable, in
+// which case path-style addressing is used.
+func (c *Client) newS3Request(ctx context.Context, location Location) (*http.Request, error) {
+	region := firstNonEmpty(c.getenv("AWS_REGION"), c.getenv("AWS_DEFAULT_REGION"), defaultAWSRegion)
+
+	var objectURL string
+	if endpoint := firstNonEmpty(c.getenv("AWS_ENDPOINT_URL_S3"), c.getenv("AWS_ENDPOINT_URL")); endpoint != "" {
+		objectURL = strings.TrimRight(endpoint, "/") + "/" + location.Bucket + "/" + awsEscapePath(location.Key)
+	} else {
+		objectURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", location.Bucket, region, awsEscapePath(location.Key))
+	}
+	req, err := c.newRequest(ctx, objectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := c.awsCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if credentials != nil {
+		signV4(req, credentials, region, "s3", c.now())
+	}
+	return req, nil
+}
+
+// awsCredentials resolves AWS credentials from the environment, the shared
+// credentials file, or the ECS container credentials endpoint, in that order.
+// It returns nil if no credentials are found, in which case requests are made
+// anonymously.
+func (c *Client) awsCredentials(ctx context.Context) (*awsCredentials, error) {
+	if accessKeyID := c.getenv("AWS_ACCESS_KEY_ID"); accessKeyID != "" {
+		return &awsCredentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: c.getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    c.getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	path := c.getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".aws", "credentials")
+		}
+	}
+	if path != "" {
+		profile := firstNonEmpty(c.getenv("AWS_PROFILE"), "default")
+		credentials, err := readSharedCredentials(path, profile)
+		if err != nil {
+			return nil, err
+		}
+		if credentials != nil {
+			return credentials, nil
+		}
+	}
+
+	if relativeURI := c.getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relativeURI != "" {
+		return c.containerCredentials(ctx, ecsCredentialsHost+relativeURI)
+	}
+	if fullURI := c.getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); fullURI != "" {
+		return c.containerCredentials(ctx, fullURI)
+	}
+	return nil, nil
+}
+
+// readSharedCredentials reads a profile's credentials from an AWS shared
+// credentials file. It returns nil if the file or profile doesn't exist.
+func readSharedCredentials(path, profile string) (*awsCredentials, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening AWS credentials file: %w", err)
+	}
+	defer f.Close()
+
+	var credentials awsCredentials
+	inProfile := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+			continue
+		}
+		if !inProfile {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			credentials.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			credentials.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			credentials.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading AWS credentials file: %w", err)
+	}
+	if credentials.AccessKeyID == "" {
+		return nil, nil
+	}
+	return &credentials, nil
+}
+
+// containerCredentials fetches credentials from a container credentials
+// endpoint.
+func (c *Client) containerCredentials(ctx context.Context, endpoint string) (*awsCredentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("creating container credentials request: %w", err)
+	}
+	if token := c.getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := c.metadataClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching container credentials: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching container credentials: unexpected status %s", resp.Status)
+	}
+	var credentials awsCredentials
+	if err := json.NewDecoder(resp.Body).Decode(&credentials); err != nil {
+		return nil, fmt.Errorf("decoding container credentials: %w", err)
+	}
+	return &credentials, nil
+}
+
+// signV4 signs a request using AWS Signature Version 4. The host, Range, and
+// x-amz-* headers are signed. If the request doesn't specify a payload hash
+// via the x-amz-content-sha256 header, then the payload is left unsigned.
+func signV4(req *http.Request, credentials *awsCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := req.Header.Get("x-amz-content-sha256")
+	if payloadHash == "" {
+		payloadHash = unsignedPayload
+		req.Header.Set("x-amz-content-sha256", payloadHash)
+	}
+	req.Header.Set("x-amz-date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", credentials.SessionToken)
+	}
+
+	// Collect the headers to sign.
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// S3 expects the path to be URI-encoded once, unlike other services.
+	canonicalURI := awsEscapePath(req.URL.Path)
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// awsEscape URI-encodes a string as specified for Signature Version 4: every
+// byte but the unreserved characters (A-Z, a-z, 0-9, '-', '.', '_', and '~')
+// is percent-encoded with uppercase hexadecimal digits. Unlike url.PathEscape
+// and url.QueryEscape, characters such as '$', '&', '+', and ' ' are always
+// percent-encoded. Slashes are kept if keepSlashes is true.
+func awsEscape(s string, keepSlashes bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var escaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && keepSlashes:
+			escaped.WriteByte(c)
+		default:
+			escaped.WriteByte('%')
+			escaped.WriteByte(hexDigits[c>>4])
+			escaped.WriteByte(hexDigits[c&0xf])
+		}
+	}
+	return escaped.String()
+}
+
+// awsEscapePath URI-encodes an object key or path for S3, keeping slashes.
+func awsEscapePath(path string) string {
+	return awsEscape(path, true)
+}
+
+// canonicalQuery returns the canonical query string of a request: the
+// URI-encoded parameters sorted by name and value.
+func canonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, awsEscape(name, false)+"="+awsEscape(value, false))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// hmacSHA256 computes the HMAC-SHA256 of data using key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,62 @@
+package packaging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PackageFromONNXDirectory scans a directory for an ONNX file and config files,
+// such as the tokenizer and the Hugging Face config.json, creating a temporary
+// tar archive of the config files.
+// It returns the path to the ONNX file, path to temporary config archive (if created),
+// and any error encountered.
+func PackageFromONNXDirectory(dirPath string) (onnxPath string, tempConfigArchive string, err error) {
+	// Read directory contents (only top level, no subdirectories)
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return "", "", fmt.Errorf("read directory: %w", err)
+	}
+
+	var onnxPaths, configFiles []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue // Skip subdirectories
+		}
+
+		name := entry.Name()
+		fullPath := filepath.Join(dirPath, name)
+
+		if strings.HasSuffix(strings.ToLower(name), ".onnx") {
+			onnxPaths = append(onnxPaths, fullPath)
+		}
+		if isConfigFile(name) {
+			configFiles = append(configFiles, fullPath)
+		}
+	}
+
+	// Models whose weights are stored outside of the ONNX graph (*.onnx_data)
+	// aren't supported, as their paths are relative to the graph's.
+	switch len(onnxPaths) {
+	case 0:
+		return "", "", fmt.Errorf("no ONNX file found in directory: %s", dirPath)
+	case 1:
+	default:
+		return "", "", fmt.Errorf("found %d ONNX files in directory %s, expected exactly 1", len(onnxPaths), dirPath)
+	}
+
+	// Create temporary tar archive with config files if any exist
+	if len(configFiles) > 0 {
+		// Sort config files for reproducible tar archive
+		sort.Strings(configFiles)
+
+		tempConfigArchive, err = CreateTempConfigArchive(configFiles)
+		if err != nil {
+			return "", "", fmt.Errorf("create config archive: %w", err)
+		}
+	}
+
+	return onnxPaths[0], tempConfigArchive, nil
+}
@@ -0,0 +1,52 @@
+package packaging
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPackageFromONNXDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"model.onnx":     "onnx content",
+		"config.json":    `{"id2label": {"0": "negative", "1": "positive"}}`,
+		"tokenizer.json": `{"model": {}}`,
+		"not.included":   "not included content",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file %s: %v", name, err)
+		}
+	}
+
+	onnxPath, tempConfigArchive, err := PackageFromONNXDirectory(tempDir)
+	if err != nil {
+		t.Fatalf("PackageFromONNXDirectory failed: %v", err)
+	}
+	defer os.Remove(tempConfigArchive)
+
+	if onnxPath != filepath.Join(tempDir, "model.onnx") {
+		t.Errorf("Expected ONNX file %s, got %s", filepath.Join(tempDir, "model.onnx"), onnxPath)
+	}
+	archiveFiles, err := readTarArchive(tempConfigArchive)
+	if err != nil {
+		t.Fatalf("Failed to read tar archive: %v", err)
+	}
+	if want := []string{"config.json", "tokenizer.json"}; !slices.Equal(archiveFiles, want) {
+		t.Errorf("Expected archive files %v, got %v", want, archiveFiles)
+	}
+
+	// Directories without exactly one ONNX file are rejected.
+	if err := os.WriteFile(filepath.Join(tempDir, "model_quantized.onnx"), []byte("onnx content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if _, _, err := PackageFromONNXDirectory(tempDir); err == nil || !strings.Contains(err.Error(), "expected exactly 1") {
+		t.Errorf("Expected error for multiple ONNX files, got %v", err)
+	}
+	if _, _, err := PackageFromONNXDirectory(t.TempDir()); err == nil || !strings.Contains(err.Error(), "no ONNX file") {
+		t.Errorf("Expected error for missing ONNX file, got %v", err)
+	}
+}
@@ -94,6 +94,16 @@ func WithAuth(auth authn.Authenticator) ClientOption {
 	}
 }
 
+// WithKeychain sets the keychain resolving credentials when no custom
+// authenticator is set.
+func WithKeychain(keychain authn.Keychain) ClientOption {
+	return func(c *Client) {
+		if keychain != nil {
+			c.keychain = keychain
+		}
+	}
+}
+
 func NewClient(opts ...ClientOption) *Client {
 	client := &Client{
 		transport: remote.DefaultTransport,
@@ -17,6 +17,9 @@ const (
 	// MediaTypeSafetensors indicates a file in safetensors format, containing model weights.
 	MediaTypeSafetensors = types.MediaType("application/vnd.docker.ai.safetensors")
 
+	// MediaTypeONNX indicates a file in ONNX format, containing a model graph and its weights.
+	MediaTypeONNX = types.MediaType("application/vnd.docker.ai.onnx")
+
 	// MediaTypeVLLMConfigArchive indicates a tar archive containing vLLM-specific config files.
 	MediaTypeVLLMConfigArchive = types.MediaType("application/vnd.docker.ai.vllm.config.tar")
 
@@ -29,11 +32,15 @@ const (
 	// MediaTypeMultimodalProjector indicates a Multimodal projector file
 	MediaTypeMultimodalProjector = types.MediaType("application/vnd.docker.ai.mmproj")
 
+	// MediaTypeLoRAAdapter indicates a LoRA adapter file in GGUF format, applied to the model's weights at runtime
+	MediaTypeLoRAAdapter = types.MediaType("application/vnd.docker.ai.lora")
+
 	// MediaTypeChatTemplate indicates a Jinja chat template
 	MediaTypeChatTemplate = types.MediaType("application/vnd.docker.ai.chat.template.jinja")
 
 	FormatGGUF        = Format("gguf")
 	FormatSafetensors = Format("safetensors")
+	FormatONNX        = Format("onnx")
 
 	// OCI Annotation keys for model layers
 	// See https://github.com/opencontainers/image-spec/blob/main/annotations.md
@@ -67,7 +74,11 @@ type Config struct {
 	Size         string            `json:"size,omitempty"`
 	GGUF         map[string]string `json:"gguf,omitempty"`
 	Safetensors  map[string]string `json:"safetensors,omitempty"`
+	ONNX         map[string]string `json:"onnx,omitempty"`
 	ContextSize  *uint64           `json:"context_size,omitempty"`
+	// DraftModel is the reference of a smaller model that's pulled along with
+	// the model and used as its draft model for speculative decoding.
+	DraftModel string `json:"draft_model,omitempty"`
 }
 
 // Descriptor provides metadata about the provenance of the model.
@@ -8,8 +8,10 @@ type Model interface {
 	ID() (string, error)
 	GGUFPaths() ([]string, error)
 	SafetensorsPaths() ([]string, error)
+	ONNXPath() (string, error)
 	ConfigArchivePath() (string, error)
 	MMPROJPath() (string, error)
+	LoRAPaths() ([]string, error)
 	Config() (Config, error)
 	Tags() []string
 	Descriptor() (Descriptor, error)
@@ -27,7 +29,9 @@ type ModelBundle interface {
 	RootDir() string
 	GGUFPath() string
 	SafetensorsPath() string
+	ONNXPath() string
 	ChatTemplatePath() string
 	MMPROJPath() string
+	LoRAPaths() []string
 	RuntimeConfig() Config
 }
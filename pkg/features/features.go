@@ -0,0 +1,148 @@
+// Package features reports which optional capabilities are enabled in a model
+// runner on its build and platform, so that clients can adapt to them rather
+// than probing with requests that fail.
+package features
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+// APIPath is the path of the features route, relative to the inference prefix.
+const APIPath = "/features"
+
+// The names of the optional capabilities.
+const (
+	// Vision is image input to chat completions with multimodal models.
+	Vision = "vision"
+	// AudioTranscription is the streaming transcription API.
+	AudioTranscription = "audio_transcription"
+	// Realtime is the realtime API.
+	Realtime = "realtime"
+	// Batching is the Batch API.
+	Batching = "batching"
+	// ScheduledJobs are jobs run on a schedule.
+	ScheduledJobs = "scheduled_jobs"
+	// Files is the Files API.
+	Files = "files"
+	// VectorStores are the vector store API and retrieval-augmented chat
+	// completions.
+	VectorStores = "vector_stores"
+	// PromptTemplates is the prompt template API.
+	PromptTemplates = "prompt_templates"
+	// Cluster is serving models across a cluster of model runners.
+	Cluster = "cluster"
+	// Metrics is the Prometheus metrics endpoint.
+	Metrics = "metrics"
+	// AccessControl restricts the API to the roles of clients.
+	AccessControl = "access_control"
+	// ReadOnly disables mutating management operations.
+	ReadOnly = "read_only"
+	// FaultInjection is the fault injection API.
+	FaultInjection = "fault_injection"
+	// TrafficRecording records all traffic for replays.
+	TrafficRecording = "traffic_recording"
+)
+
+// Feature reports whether an optional capability is enabled.
+type Feature struct {
+	// Name is the capability's name.
+	Name string `json:"name"`
+	// Enabled is whether the capability is enabled.
+	Enabled bool `json:"enabled"`
+	// Reason explains why a capability is disabled.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Enabled returns an enabled feature.
+func Enabled(name string) Feature {
+	return Feature{Name: name, Enabled: true}
+}
+
+// Disabled returns a feature disabled for the specified reason.
+func Disabled(name, reason string) Feature {
+	return Feature{Name: name, Reason: reason}
+}
+
+// Configured returns a feature that's enabled if it's configured.
+func Configured(name string, configured bool) Feature {
+	if !configured {
+		return Disabled(name, "not configured")
+	}
+	return Enabled(name)
+}
+
+// Backend reports whether an inference backend is supported on the platform,
+// along with its status.
+type Backend struct {
+	// Name is the backend's name.
+	Name string `json:"name"`
+	// Supported is whether the backend is supported on the platform.
+	Supported bool `json:"supported"`
+	// Reason explains why a backend isn't supported.
+	Reason string `json:"reason,omitempty"`
+	// Status is the backend's status, e.g. whether it's installed.
+	Status string `json:"status"`
+}
+
+// Report reports the capabilities of a model runner.
+type Report struct {
+	// OS and Arch are the platform's operating system and architecture.
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// Features are the optional capabilities.
+	Features []Feature `json:"features"`
+	// Backends are the inference backends, sorted by name.
+	Backends []Backend `json:"backends"`
+}
+
+// Enabled returns whether the named capability is enabled.
+func (r Report) Enabled(name string) bool {
+	for _, feature := range r.Features {
+		if feature.Name == name {
+			return feature.Enabled
+		}
+	}
+	return false
+}
+
+// Handler implements the features API.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	report      func() Report
+}
+
+// NewHandler creates a new features API handler, which responds with the
+// report returned by report, since backend statuses change over time.
+func NewHandler(log logging.Logger, allowedOrigins []string, report func() Report) *Handler {
+	h := &Handler{
+		log:    log,
+		router: http.NewServeMux(),
+		report: report,
+	}
+
+	h.router.HandleFunc("GET "+inference.InferencePrefix+APIPath, h.handleGetFeatures)
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// handleGetFeatures handles GET <inference-prefix>/features requests.
+func (h *Handler) handleGetFeatures(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.report()); err != nil {
+		h.log.Warnln("Error while encoding features response:", err)
+	}
+}
@@ -0,0 +1,176 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// FilesPath is the path of the Files API routes, relative to the inference
+	// prefix.
+	FilesPath = "/v1/files"
+
+	// maximumFormMemory is the maximum size of an upload that's buffered in
+	// memory rather than on disk.
+	maximumFormMemory = 32 * 1024 * 1024
+	// maximumFormOverhead allows for the multipart encoding on top of the file
+	// itself.
+	maximumFormOverhead = 1024 * 1024
+)
+
+// listResponse is the response to a list request.
+type listResponse struct {
+	Object string `json:"object"`
+	Data   []File `json:"data"`
+}
+
+// deletedResponse is the response to a deletion request.
+type deletedResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+// Handler implements the Files API.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	manager     *Manager
+}
+
+// NewHandler creates a new Files API handler.
+func NewHandler(log logging.Logger, allowedOrigins []string, manager *Manager) *Handler {
+	h := &Handler{
+		log:     log,
+		router:  http.NewServeMux(),
+		manager: manager,
+	}
+
+	for route, handler := range h.routeHandlers() {
+		h.router.HandleFunc(route, handler)
+	}
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// routeHandlers returns the mapping of routes to their handlers.
+func (h *Handler) routeHandlers() map[string]http.HandlerFunc {
+	files := inference.InferencePrefix + FilesPath
+	return map[string]http.HandlerFunc{
+		"POST " + files:                    h.handleUpload,
+		"GET " + files:                     h.handleList,
+		"GET " + files + "/{file}":         h.handleGet,
+		"GET " + files + "/{file}/content": h.handleGetContent,
+		"DELETE " + files + "/{file}":      h.handleDelete,
+	}
+}
+
+// writeJSON writes a JSON response.
+func (h *Handler) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warnf("Failed to encode files response: %v", err)
+	}
+}
+
+// writeError writes an error response with the status appropriate for err.
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrFileTooLarge), errors.Is(err, ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		h.log.Warnf("Files request failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.manager.Limits().MaxFileSize+maximumFormOverhead)
+	if err := r.ParseMultipartForm(maximumFormMemory); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			h.writeError(w, ErrFileTooLarge)
+		} else {
+			http.Error(w, "request must be a multipart form with a file field", http.StatusBadRequest)
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	purpose := r.FormValue("purpose")
+	if !slices.Contains(uploadPurposes, purpose) {
+		http.Error(w, fmt.Sprintf("purpose must be one of %s", strings.Join(uploadPurposes, ", ")), http.StatusBadRequest)
+		return
+	}
+	headers := r.MultipartForm.File["file"]
+	if len(headers) != 1 {
+		http.Error(w, "exactly one file is required", http.StatusBadRequest)
+		return
+	}
+	content, err := headers[0].Open()
+	if err != nil {
+		http.Error(w, "failed to read uploaded file", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	file, err := h.manager.Create(filepath.Base(headers[0].Filename), purpose, content)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, file)
+}
+
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, listResponse{Object: "list", Data: h.manager.List(r.URL.Query().Get("purpose"))})
+}
+
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	file, err := h.manager.Get(r.PathValue("file"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, file)
+}
+
+func (h *Handler) handleGetContent(w http.ResponseWriter, r *http.Request) {
+	file, content, err := h.manager.Open(r.PathValue("file"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, file.Filename, time.Unix(file.CreatedAt, 0), content)
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("file")
+	if err := h.manager.Delete(id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, deletedResponse{ID: id, Object: "file", Deleted: true})
+}
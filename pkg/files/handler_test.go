@@ -0,0 +1,138 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestHandler(t *testing.T, dir string, limits Limits) *Handler {
+	t.Helper()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	manager, err := NewManager(log, dir, limits)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	return NewHandler(log, nil, manager)
+}
+
+// serve performs a request and returns the recorded response.
+func serve(handler http.Handler, method, path, contentType string, body io.Reader) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, inference.InferencePrefix+path, body)
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// upload uploads a file, returning the response.
+func upload(handler http.Handler, purpose, filename, content string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("purpose", purpose)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	writer.Close()
+	return serve(handler, http.MethodPost, FilesPath, writer.FormDataContentType(), &body)
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	handler := newTestHandler(t, dir, Limits{})
+
+	response := upload(handler, PurposeUserData, "../notes.txt", "some notes")
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected upload to succeed, got status %d: %s", response.Code, response.Body)
+	}
+	var file File
+	if err := json.Unmarshal(response.Body.Bytes(), &file); err != nil {
+		t.Fatalf("Failed to decode file: %v", err)
+	}
+	if file.Purpose != PurposeUserData || file.Filename != "notes.txt" || file.Bytes != 10 || file.Object != "file" {
+		t.Errorf("Unexpected file %+v", file)
+	}
+	if response := upload(handler, PurposeBatch, "requests.jsonl", "{}"); response.Code != http.StatusOK {
+		t.Fatalf("Expected upload to succeed, got status %d", response.Code)
+	}
+
+	var list listResponse
+	json.Unmarshal(serve(handler, http.MethodGet, FilesPath+"?purpose="+PurposeUserData, "", nil).Body.Bytes(), &list)
+	if len(list.Data) != 1 || list.Data[0].ID != file.ID {
+		t.Errorf("Unexpected file list %+v", list)
+	}
+	if response := serve(handler, http.MethodGet, FilesPath+"/"+file.ID+"/content", "", nil); response.Code != http.StatusOK || response.Body.String() != "some notes" {
+		t.Errorf("Unexpected content %d %q", response.Code, response.Body)
+	}
+
+	// Files are persisted.
+	reloaded := newTestHandler(t, dir, Limits{})
+	if len(reloaded.manager.List("")) != 2 || reloaded.manager.Usage() != 12 {
+		t.Errorf("Expected 2 persisted files using 12 bytes, got %d using %d", len(reloaded.manager.List("")), reloaded.manager.Usage())
+	}
+
+	if response := serve(handler, http.MethodDelete, FilesPath+"/"+file.ID, "", nil); response.Code != http.StatusOK {
+		t.Errorf("Expected deletion to succeed, got status %d", response.Code)
+	}
+	for _, path := range []string{FilesPath + "/" + file.ID, FilesPath + "/" + file.ID + "/content"} {
+		if response := serve(handler, http.MethodGet, path, "", nil); response.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for %s, got %d", path, response.Code)
+		}
+	}
+	if usage := handler.manager.Usage(); usage != 2 {
+		t.Errorf("Expected usage of 2 bytes after deletion, got %d", usage)
+	}
+}
+
+func TestFileValidation(t *testing.T) {
+	handler := newTestHandler(t, t.TempDir(), Limits{})
+	for _, purpose := range []string{"", "fine-tune", PurposeBatchOutput} {
+		if response := upload(handler, purpose, "file.txt", "content"); response.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for purpose %q, got %d", purpose, response.Code)
+		}
+	}
+	if response := serve(handler, http.MethodPost, FilesPath, "application/json", strings.NewReader("{}")); response.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a non-multipart upload, got %d", response.Code)
+	}
+}
+
+func TestFileLimits(t *testing.T) {
+	handler := newTestHandler(t, t.TempDir(), Limits{MaxFileSize: 10, Quota: 15})
+
+	if response := upload(handler, PurposeAssistants, "large.txt", strings.Repeat("a", 11)); response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a file over the maximum size, got %d", response.Code)
+	}
+	if response := upload(handler, PurposeAssistants, "first.txt", strings.Repeat("a", 10)); response.Code != http.StatusOK {
+		t.Fatalf("Expected upload to succeed, got status %d", response.Code)
+	}
+	if response := upload(handler, PurposeAssistants, "second.txt", strings.Repeat("a", 6)); response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a file over the quota, got %d", response.Code)
+	}
+
+	// Generated files aren't rejected, but count towards the quota.
+	tmp, err := handler.manager.CreateTemporary("output")
+	if err != nil {
+		t.Fatalf("CreateTemporary failed: %v", err)
+	}
+	tmp.WriteString(strings.Repeat("a", 10))
+	tmp.Close()
+	if _, err := handler.manager.Add(tmp.Name(), "output.jsonl", PurposeBatchOutput); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if usage := handler.manager.Usage(); usage != 20 {
+		t.Errorf("Expected usage of 20 bytes, got %d", usage)
+	}
+	if len(handler.manager.List("")) != 2 {
+		t.Errorf("Expected rejected uploads not to be stored, got %d files", len(handler.manager.List("")))
+	}
+}
@@ -0,0 +1,307 @@
+// Package files implements the OpenAI Files API, which stores uploaded files
+// (such as batch inputs and attachments) and files generated by the model
+// runner (such as batch outputs) on disk.
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/internal/jsonutil"
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/logging"
+)
+
+var (
+	// ErrFileNotFound indicates that a file doesn't exist. If returned in
+	// conjunction with an HTTP request, it should be paired with a 404
+	// response status.
+	ErrFileNotFound = errors.New("file not found")
+	// ErrFileTooLarge indicates that a file exceeds the maximum file size. If
+	// returned in conjunction with an HTTP request, it should be paired with a
+	// 413 response status.
+	ErrFileTooLarge = errors.New("file exceeds the maximum file size")
+	// ErrQuotaExceeded indicates that storing a file would exceed the storage
+	// quota. If returned in conjunction with an HTTP request, it should be
+	// paired with a 413 response status.
+	ErrQuotaExceeded = errors.New("file storage quota exceeded")
+)
+
+// File purposes.
+const (
+	// PurposeBatch is the purpose of batch input files.
+	PurposeBatch = "batch"
+	// PurposeBatchOutput is the purpose of batch output and error files, which
+	// are generated rather than uploaded.
+	PurposeBatchOutput = "batch_output"
+	// PurposeJobOutput is the purpose of scheduled job results, which are
+	// generated rather than uploaded.
+	PurposeJobOutput = "job_output"
+	// PurposeAssistants is the purpose of files attached to assistants-style
+	// requests.
+	PurposeAssistants = "assistants"
+	// PurposeUserData is the purpose of general-purpose files.
+	PurposeUserData = "user_data"
+	// PurposeVision is the purpose of images used as inputs.
+	PurposeVision = "vision"
+)
+
+// uploadPurposes are the purposes with which files can be uploaded.
+var uploadPurposes = []string{PurposeBatch, PurposeAssistants, PurposeUserData, PurposeVision}
+
+const (
+	// DefaultMaxFileSize is the default maximum size of a file.
+	DefaultMaxFileSize = 512 * 1024 * 1024
+	// DefaultQuota is the default maximum total size of all files.
+	DefaultQuota = 10 * 1024 * 1024 * 1024
+)
+
+// Limits limits the storage used by files.
+type Limits struct {
+	// MaxFileSize is the maximum size of an uploaded file. Zero means
+	// DefaultMaxFileSize.
+	MaxFileSize int64
+	// Quota is the maximum total size of all files, including generated ones.
+	// Uploads that would exceed it are rejected. Zero means DefaultQuota.
+	Quota int64
+}
+
+// withDefaults returns the limits with defaults applied.
+func (l Limits) withDefaults() Limits {
+	if l.MaxFileSize <= 0 {
+		l.MaxFileSize = DefaultMaxFileSize
+	}
+	if l.Quota <= 0 {
+		l.Quota = DefaultQuota
+	}
+	return l
+}
+
+// File describes a file.
+type File struct {
+	// ID is the file's identifier.
+	ID string `json:"id"`
+	// Object is always "file".
+	Object string `json:"object"`
+	// Bytes is the file's size.
+	Bytes int64 `json:"bytes"`
+	// CreatedAt is the file's creation time as a Unix timestamp.
+	CreatedAt int64 `json:"created_at"`
+	// Filename is the file's name.
+	Filename string `json:"filename"`
+	// Purpose is the file's intended use.
+	Purpose string `json:"purpose"`
+}
+
+// Manager manages the files persisted in a directory, with each file's content
+// in <id>.data and its description in <id>.json.
+type Manager struct {
+	// dir is the directory holding the files.
+	dir string
+	// limits limits the storage used by files.
+	limits Limits
+	// mu guards files and usage.
+	mu sync.Mutex
+	// files maps file IDs to files.
+	files map[string]File
+	// usage is the total size of all files.
+	usage int64
+}
+
+// NewManager creates a manager for the files in the specified directory,
+// creating it if necessary. Files that can't be loaded are logged and skipped.
+func NewManager(log logging.Logger, dir string, limits Limits) (*Manager, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create files directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read files directory: %w", err)
+	}
+
+	m := &Manager{dir: dir, limits: limits.withDefaults(), files: make(map[string]File)}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.Contains(name, utils.TemporarySuffix) {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if filepath.Ext(name) != ".json" {
+			continue
+		}
+		var file File
+		if err := jsonutil.ReadFile(filepath.Join(dir, name), &file); err != nil {
+			log.Warnf("Skipping file %s: %v", name, err)
+			continue
+		}
+		m.files[file.ID] = file
+		m.usage += file.Bytes
+	}
+	return m, nil
+}
+
+// Limits returns the limits on the storage used by files.
+func (m *Manager) Limits() Limits {
+	return m.limits
+}
+
+// Usage returns the total size of all files.
+func (m *Manager) Usage() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// contentPath returns the path of a file's content.
+func (m *Manager) contentPath(id string) string {
+	return filepath.Join(m.dir, id+".data")
+}
+
+// Create creates a file with the content read from r, which is subject to the
+// maximum file size and the storage quota.
+func (m *Manager) Create(filename, purpose string, r io.Reader) (File, error) {
+	tmp, err := m.CreateTemporary("upload")
+	if err != nil {
+		return File{}, err
+	}
+	written, err := io.Copy(tmp, io.LimitReader(r, m.limits.MaxFileSize+1))
+	if err == nil && written > m.limits.MaxFileSize {
+		err = ErrFileTooLarge
+	} else if err != nil {
+		err = fmt.Errorf("unable to write file: %w", err)
+	}
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("unable to write file: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return File{}, err
+	}
+	return m.add(tmp.Name(), filename, purpose, true)
+}
+
+// CreateTemporary creates a temporary file in the files directory, which can
+// be added as a file with Add once written. Temporary files that aren't added
+// are removed on startup.
+func (m *Manager) CreateTemporary(name string) (*os.File, error) {
+	tmp, err := os.CreateTemp(m.dir, name+"-*"+utils.TemporarySuffix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	return tmp, nil
+}
+
+// Add moves a temporary file created with CreateTemporary into place as a new
+// file. Generated files aren't subject to the storage quota, but count towards
+// it.
+func (m *Manager) Add(tmpPath, filename, purpose string) (File, error) {
+	return m.add(tmpPath, filename, purpose, false)
+}
+
+// add moves a temporary file into place as a new file, optionally enforcing
+// the storage quota.
+func (m *Manager) add(tmpPath, filename, purpose string, enforceQuota bool) (File, error) {
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return File{}, fmt.Errorf("unable to read file: %w", err)
+	}
+	file := File{
+		ID:        utils.NewID("file-"),
+		Object:    "file",
+		Bytes:     info.Size(),
+		CreatedAt: time.Now().Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if enforceQuota && m.usage+file.Bytes > m.limits.Quota {
+		os.Remove(tmpPath)
+		return File{}, ErrQuotaExceeded
+	}
+	if err := os.Rename(tmpPath, m.contentPath(file.ID)); err != nil {
+		os.Remove(tmpPath)
+		return File{}, fmt.Errorf("unable to store file: %w", err)
+	}
+	// Write the description last, so that files are only loaded once their
+	// content is in place.
+	if err := jsonutil.WriteFile(filepath.Join(m.dir, file.ID+".json"), file); err != nil {
+		os.Remove(m.contentPath(file.ID))
+		return File{}, err
+	}
+	m.files[file.ID] = file
+	m.usage += file.Bytes
+	return file, nil
+}
+
+// List returns all files with the specified purpose (or all files if the
+// purpose is empty), newest first.
+func (m *Manager) List(purpose string) []File {
+	m.mu.Lock()
+	files := make([]File, 0, len(m.files))
+	for _, file := range m.files {
+		if purpose == "" || file.Purpose == purpose {
+			files = append(files, file)
+		}
+	}
+	m.mu.Unlock()
+	slices.SortFunc(files, func(a, b File) int {
+		if a.CreatedAt != b.CreatedAt {
+			return int(b.CreatedAt - a.CreatedAt)
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return files
+}
+
+// Get returns the description of a file.
+func (m *Manager) Get(id string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, ok := m.files[id]
+	if !ok {
+		return File{}, ErrFileNotFound
+	}
+	return file, nil
+}
+
+// Open opens a file's content for reading.
+func (m *Manager) Open(id string) (File, *os.File, error) {
+	file, err := m.Get(id)
+	if err != nil {
+		return File{}, nil, err
+	}
+	content, err := os.Open(m.contentPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return File{}, nil, ErrFileNotFound
+	} else if err != nil {
+		return File{}, nil, fmt.Errorf("unable to open file: %w", err)
+	}
+	return file, content, nil
+}
+
+// Delete deletes a file.
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, ok := m.files[id]
+	if !ok {
+		return ErrFileNotFound
+	}
+	if err := os.Remove(filepath.Join(m.dir, id+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to delete file: %w", err)
+	}
+	os.Remove(m.contentPath(id))
+	delete(m.files, id)
+	m.usage -= file.Bytes
+	return nil
+}
@@ -16,6 +16,62 @@ var ModelsPrefix = "/models"
 // to provide more granular tracking of model usage by source.
 const RequestOriginHeader = "X-Request-Origin"
 
+// DryRunHeader is the HTTP header used to request validation of an inference
+// request without executing it. If set to a true value (e.g. "1" or "true"),
+// the request is validated and the request that would be forwarded to the
+// backend is returned instead of a response.
+const DryRunHeader = "X-Dry-Run"
+
+// QueueProgressHeader is the HTTP header used to request queue progress for a
+// streaming inference request. If set to a true value, "queue" server-sent
+// events reporting the request's queue position and estimated wait are sent
+// while it waits for a runner, before any generated output.
+const QueueProgressHeader = "X-Queue-Progress"
+
+// IdempotencyKeyHeader is the HTTP header used to identify retries of an
+// inference request. A successful response is cached for the key, and retried
+// requests with the same key and body receive the cached response instead of
+// being executed again.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// TruncatedMessagesHeader is the HTTP response header reporting the number of
+// messages that were truncated from a chat conversation to fit its prompt
+// within the model's context.
+const TruncatedMessagesHeader = "X-Truncated-Messages"
+
+// PromptCompressionHeader is the HTTP response header reporting how a chat
+// conversation's prompt was compressed to fit within the model's context, as
+// the estimated original and compressed prompt tokens and the number of
+// compressed messages (e.g. "original-tokens=9000, compressed-tokens=4000,
+// messages=1").
+const PromptCompressionHeader = "X-Prompt-Compression"
+
+// RecordIDHeader is the HTTP response header reporting the ID of the record
+// of an inference request, if it was recorded.
+const RecordIDHeader = "X-Record-ID"
+
+// ProvenanceHeader is the HTTP response header, or trailer for streamed
+// responses, reporting the signed provenance marker of an inference response,
+// if response provenance is enabled. See the provenance package.
+const ProvenanceHeader = "X-Provenance"
+
+// RoutedModelHeader is the HTTP response header reporting the model to which a
+// request for a virtual model was routed.
+const RoutedModelHeader = "X-Routed-Model"
+
+// SessionIDHeader is the HTTP header used to group inference requests into a
+// session, such as the turns of a chat conversation, so that they can be
+// exported together.
+const SessionIDHeader = "X-Session-ID"
+
+// PipelineIDHeader is the HTTP header identifying the pipeline run on whose
+// behalf an inference request is made, which links the run's records.
+const PipelineIDHeader = "X-Pipeline-ID"
+
+// PipelineStepHeader is the HTTP header identifying the pipeline step on whose
+// behalf an inference request is made.
+const PipelineStepHeader = "X-Pipeline-Step"
+
 // Valid origin values for the RequestOriginHeader.
 const (
 	// OriginOllamaCompletion indicates the request came from the Ollama /api/chat or /api/generate endpoints
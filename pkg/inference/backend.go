@@ -16,6 +16,9 @@ const (
 	// mode.
 	BackendModeEmbedding
 	BackendModeReranking
+	// BackendModeClassification indicates that the backend should run a
+	// sequence classification model, such as a safety classifier.
+	BackendModeClassification
 )
 
 type ErrGGUFParse struct {
@@ -35,6 +38,8 @@ func (m BackendMode) String() string {
 		return "embedding"
 	case BackendModeReranking:
 		return "reranking"
+	case BackendModeClassification:
+		return "classification"
 	default:
 		return "unknown"
 	}
@@ -46,10 +51,172 @@ type SpeculativeDecodingConfig struct {
 	MinAcceptanceRate float64 `json:"min_acceptance_rate,omitempty"`
 }
 
+// KVCacheType is the data type in which a runner stores its KV cache.
+type KVCacheType string
+
+const (
+	// KVCacheTypeDefault stores the KV cache in the backend's default (16-bit)
+	// precision.
+	KVCacheTypeDefault KVCacheType = ""
+	// KVCacheTypeInt8 quantizes the KV cache to 8-bit integers. It's only
+	// supported by llama.cpp.
+	KVCacheTypeInt8 KVCacheType = "int8"
+	// KVCacheTypeFP8 quantizes the KV cache to 8-bit floating point numbers.
+	// It's only supported by vLLM.
+	KVCacheTypeFP8 KVCacheType = "fp8"
+)
+
 type BackendConfiguration struct {
 	ContextSize  int64                      `json:"context-size,omitempty"`
 	RuntimeFlags []string                   `json:"runtime-flags,omitempty"`
 	Speculative  *SpeculativeDecodingConfig `json:"speculative,omitempty"`
+	// Parallelism is the number of requests that a runner processes
+	// concurrently. A zero value means the backend's default.
+	Parallelism int `json:"parallelism,omitempty"`
+	// BackendVersion pins the version of the backend used to run the model,
+	// which is installed side by side with the default version. An empty
+	// value means the default version.
+	BackendVersion string `json:"backend-version,omitempty"`
+	// KVCacheType is the experimental quantization of the KV cache, which
+	// roughly halves its memory at a small cost in accuracy. An empty value
+	// means the backend's default precision.
+	KVCacheType KVCacheType `json:"kv-cache-type,omitempty"`
+	// StrictContextSize makes loads fail if the model doesn't fit in memory
+	// with its context size. Otherwise, the context size is reduced to fit.
+	StrictContextSize bool `json:"strict-context-size,omitempty"`
+	// FittedContextSize is the context size to which the scheduler reduced
+	// the model's context to fit it in memory. It takes precedence over other
+	// context sizes.
+	FittedContextSize uint64 `json:"fitted-context-size,omitempty"`
+	// ContextSizeOverride is a context size requested by inference requests,
+	// which the scheduler applies to the runners serving them. It takes
+	// precedence over the configured and model's context sizes.
+	ContextSizeOverride uint64 `json:"context-size-override,omitempty"`
+	// MatryoshkaDimensions are the reduced dimensions to which the model's
+	// embeddings may be truncated. They're applied by the scheduler rather than
+	// by backends.
+	MatryoshkaDimensions []int `json:"matryoshka-dimensions,omitempty"`
+	// Truncation configures how chat conversations whose prompts exceed the
+	// model's context are truncated. It's applied by the scheduler rather
+	// than by backends.
+	Truncation *TruncationConfig `json:"truncation,omitempty"`
+	// Compression configures how the prompts of chat conversations that
+	// exceed the model's context are compressed before they're truncated.
+	// It's applied by the scheduler rather than by backends.
+	Compression *CompressionConfig `json:"compression,omitempty"`
+	// PostProcessors are applied in order to the content of the model's
+	// completions before they're returned to clients. They're applied by the
+	// scheduler rather than by backends.
+	PostProcessors []PostProcessor `json:"post-processors,omitempty"`
+	// SystemPrompt is a server-side system prompt injected into the model's
+	// chat completion requests. It's applied by the scheduler rather than by
+	// backends.
+	SystemPrompt *SystemPromptConfig `json:"system-prompt,omitempty"`
+	// Classification configures how the outputs of sequence classification
+	// models are labeled and scored. It's applied by the scheduler rather than
+	// by backends.
+	Classification *ClassificationConfig `json:"classification,omitempty"`
+}
+
+// ClassificationConfig configures the labels and scoring of a sequence
+// classification model's outputs.
+type ClassificationConfig struct {
+	// Labels maps the model's outputs, by index (e.g. "0") or by the label in
+	// the model's metadata (e.g. "LABEL_0"), to labels.
+	Labels map[string]string `json:"labels,omitempty"`
+	// MultiLabel indicates that the model's labels are independent, so their
+	// probabilities are computed with a sigmoid rather than a softmax.
+	MultiLabel bool `json:"multi-label,omitempty"`
+}
+
+// SystemPromptMode determines when a server-side system prompt is injected and
+// whether clients can opt out of it.
+type SystemPromptMode string
+
+const (
+	// SystemPromptMandatory injects the system prompt into every request.
+	// Clients can't opt out, and their system messages are merged with or
+	// overridden by the system prompt according to the policy.
+	SystemPromptMandatory SystemPromptMode = "mandatory"
+	// SystemPromptDefault injects the system prompt into requests without
+	// system messages, unless clients opt out.
+	SystemPromptDefault SystemPromptMode = "default"
+	// SystemPromptSuggested injects the system prompt into requests without
+	// system messages only if clients opt in.
+	SystemPromptSuggested SystemPromptMode = "suggested"
+)
+
+// SystemPromptPolicy determines how a mandatory system prompt is combined
+// with client-provided system messages.
+type SystemPromptPolicy string
+
+const (
+	// SystemPromptMerge prepends the system prompt to the first client
+	// system message.
+	SystemPromptMerge SystemPromptPolicy = "merge"
+	// SystemPromptOverride replaces client system messages with the system
+	// prompt.
+	SystemPromptOverride SystemPromptPolicy = "override"
+)
+
+// SystemPromptConfig configures a server-side system prompt.
+type SystemPromptConfig struct {
+	Prompt string           `json:"prompt"`
+	Mode   SystemPromptMode `json:"mode"`
+	// Policy applies to the mandatory mode. If empty, it defaults to merge.
+	Policy SystemPromptPolicy `json:"policy,omitempty"`
+}
+
+// PostProcessor is a transformation applied to the content of completions.
+type PostProcessor string
+
+const (
+	// PostProcessorStripFences removes a markdown code fence enclosing the
+	// entire content.
+	PostProcessorStripFences PostProcessor = "strip-fences"
+	// PostProcessorRepairJSON extracts the JSON value in the content,
+	// repairing truncated values and trailing commas.
+	PostProcessorRepairJSON PostProcessor = "repair-json"
+	// PostProcessorCollapseWhitespace collapses runs of spaces and blank
+	// lines and trims the content.
+	PostProcessorCollapseWhitespace PostProcessor = "collapse-whitespace"
+)
+
+// TruncationStrategy is a strategy for truncating chat conversations whose
+// prompts exceed a model's context.
+type TruncationStrategy string
+
+const (
+	// TruncationDropOldest drops the oldest messages until the prompt fits.
+	TruncationDropOldest TruncationStrategy = "drop-oldest"
+	// TruncationSlidingWindow keeps only the most recent messages, dropping
+	// further messages if the prompt still doesn't fit.
+	TruncationSlidingWindow TruncationStrategy = "sliding-window"
+	// TruncationSummarize replaces the oldest messages with a summary
+	// generated by a (typically small) summary model.
+	TruncationSummarize TruncationStrategy = "summarize"
+)
+
+// TruncationConfig configures conversation truncation. System and developer
+// messages and the last message are never truncated.
+type TruncationConfig struct {
+	Strategy TruncationStrategy `json:"strategy"`
+	// Window is the number of most recent messages kept by the
+	// sliding-window strategy.
+	Window int `json:"window,omitempty"`
+	// SummaryModel is the model used by the summarize strategy. If empty,
+	// the model being truncated summarizes its own conversation.
+	SummaryModel string `json:"summary_model,omitempty"`
+}
+
+// CompressionConfig configures prompt compression, which prunes the words of
+// chat messages that are least needed to understand them, using a (typically
+// small) compression model, until the prompt fits in the model's context.
+// System and developer messages are never compressed.
+type CompressionConfig struct {
+	// Model is the compression model. If empty, the model being compressed
+	// compresses its own prompts.
+	Model string `json:"model,omitempty"`
 }
 
 type RequiredMemory struct {
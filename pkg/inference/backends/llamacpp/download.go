@@ -34,6 +34,7 @@ var (
 	DesiredServerVersionLock  sync.Mutex
 	errLlamaCppUpToDate       = errors.New("bundled llama.cpp version is up to date, no need to update")
 	errLlamaCppUpdateDisabled = errors.New("llama.cpp auto-updated is disabled")
+	errLlamaCppUpdateRejected = errors.New("latest llama.cpp version failed validation, not updating")
 )
 
 func GetDesiredServerVersion() string {
@@ -105,6 +106,22 @@ func (l *llamaCpp) downloadLatestLlamaCpp(ctx context.Context, log logging.Logge
 		return errLlamaCppUpToDate
 	}
 
+	// Don't install updates again once they've failed validation, but keep
+	// using any installed update.
+	if l.updateRejected(latest) {
+		log.Warnf("llama.cpp %s (%s) failed validation before, not updating", desiredTag, latest)
+		if current, err := os.ReadFile(currentVersionFile); err == nil && strings.TrimSpace(string(current)) != latest {
+			if _, err := os.Stat(llamaCppPath); err == nil {
+				l.status = fmt.Sprintf("running llama.cpp (update %s rejected by validation) version: %s",
+					latest, getLlamaCppVersion(log, llamaCppPath))
+				return nil
+			}
+		}
+		l.status = fmt.Sprintf("running llama.cpp (update %s rejected by validation) version: %s",
+			latest, getLlamaCppVersion(log, filepath.Join(vendoredServerStoragePath, "com.docker.llama-server")))
+		return errLlamaCppUpdateRejected
+	}
+
 	data, err = os.ReadFile(currentVersionFile)
 	if err != nil {
 		log.Warnf("failed to read current llama.cpp version: %v", err)
@@ -133,11 +150,8 @@ func (l *llamaCpp) downloadLatestLlamaCpp(ctx context.Context, log logging.Logge
 		return fmt.Errorf("could not extract image: %w", err)
 	}
 
-	if err := os.RemoveAll(filepath.Dir(llamaCppPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
-		return fmt.Errorf("failed to clear inference binary dir: %w", err)
-	}
-	if err := os.RemoveAll(filepath.Join(filepath.Dir(filepath.Dir(llamaCppPath)), "lib")); err != nil && !errors.Is(err, os.ErrNotExist) {
-		return fmt.Errorf("failed to clear inference library dir: %w", err)
+	if err := l.retireInstallation(llamaCppPath); err != nil {
+		return err
 	}
 
 	if err := os.MkdirAll(filepath.Dir(filepath.Dir(llamaCppPath)), 0o755); err != nil {
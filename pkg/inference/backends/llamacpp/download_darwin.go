@@ -8,9 +8,8 @@ import (
 )
 
 func (l *llamaCpp) ensureLatestLlamaCpp(ctx context.Context, log logging.Logger, httpClient *http.Client,
-	llamaCppPath, vendoredServerStoragePath string,
+	llamaCppPath, vendoredServerStoragePath, desiredVersion string,
 ) error {
-	desiredVersion := GetDesiredServerVersion()
 	desiredVariant := "metal"
 	return l.downloadLatestLlamaCpp(ctx, log, httpClient, llamaCppPath, vendoredServerStoragePath, desiredVersion,
 		desiredVariant)
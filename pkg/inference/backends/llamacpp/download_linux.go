@@ -10,7 +10,7 @@ import (
 )
 
 func (l *llamaCpp) ensureLatestLlamaCpp(_ context.Context, log logging.Logger, _ *http.Client,
-	_, vendoredServerStoragePath string,
+	_, vendoredServerStoragePath, _ string,
 ) error {
 	l.status = fmt.Sprintf("running llama.cpp version: %s",
 		getLlamaCppVersion(log, filepath.Join(vendoredServerStoragePath, "com.docker.llama-server")))
@@ -11,7 +11,7 @@ import (
 )
 
 func (l *llamaCpp) ensureLatestLlamaCpp(ctx context.Context, log logging.Logger, httpClient *http.Client,
-	llamaCppPath, vendoredServerStoragePath string,
+	llamaCppPath, vendoredServerStoragePath, desiredVersion string,
 ) error {
 	nvGPUInfoBin := filepath.Join(vendoredServerStoragePath, "com.docker.nv-gpu-info.exe")
 	var canUseCUDA11, canUseOpenCL bool
@@ -34,7 +34,6 @@ func (l *llamaCpp) ensureLatestLlamaCpp(ctx context.Context, log logging.Logger,
 			}
 		}
 	}
-	desiredVersion := GetDesiredServerVersion()
 	desiredVariant := "cpu"
 	if canUseCUDA11 {
 		desiredVariant = "cuda"
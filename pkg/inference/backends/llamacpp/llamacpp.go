@@ -7,12 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/docker/model-runner/pkg/distribution/types"
 	v1 "github.com/docker/model-runner/pkg/go-containerregistry/pkg/v1"
@@ -23,6 +25,7 @@ import (
 	"github.com/docker/model-runner/pkg/inference/backends"
 	"github.com/docker/model-runner/pkg/inference/config"
 	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/inference/quirks"
 	"github.com/docker/model-runner/pkg/logging"
 	"github.com/docker/model-runner/pkg/sandbox"
 )
@@ -52,6 +55,18 @@ type llamaCpp struct {
 	config config.BackendConfig
 	// gpuSupported indicates whether the underlying llama-server is built with GPU support.
 	gpuSupported bool
+	// httpClient is the HTTP client provided at installation, which is used to
+	// install pinned versions.
+	httpClient *http.Client
+	// versionsLock guards installedVersions.
+	versionsLock sync.Mutex
+	// installedVersions maps pinned versions to the parent paths of their
+	// com.docker.llama-server binaries.
+	installedVersions map[string]string
+	// throughputCheck checks the throughput of validated updates, if set.
+	throughputCheck ThroughputCheck
+	// quirks holds the workarounds for known model quirks, if set.
+	quirks *quirks.Registry
 }
 
 // New creates a new llama.cpp-based backend.
@@ -75,6 +90,7 @@ func New(
 		vendoredServerStoragePath: vendoredServerStoragePath,
 		updatedServerStoragePath:  updatedServerStoragePath,
 		config:                    conf,
+		installedVersions:         make(map[string]string),
 	}, nil
 }
 
@@ -92,6 +108,7 @@ func (l *llamaCpp) UsesExternalModelManagement() bool {
 // Install implements inference.Backend.Install.
 func (l *llamaCpp) Install(ctx context.Context, httpClient *http.Client) error {
 	l.updatedLlamaCpp = false
+	l.httpClient = httpClient
 
 	// We don't currently support this backend on Windows. We'll likely
 	// never support it on Intel Macs.
@@ -100,21 +117,17 @@ func (l *llamaCpp) Install(ctx context.Context, httpClient *http.Client) error {
 		return errors.New("platform not supported")
 	}
 
-	llamaServerBin := "com.docker.llama-server"
-	if runtime.GOOS == "windows" {
-		llamaServerBin = "com.docker.llama-server.exe"
-	}
-
 	l.status = "installing"
 
 	// Temporary workaround for dynamically downloading llama.cpp from Docker Hub.
 	// Internet access and an available docker/docker-model-backend-llamacpp:latest on Docker Hub are required.
 	// Even if docker/docker-model-backend-llamacpp:latest has been downloaded before, we still require its
 	// digest to be equal to the one on Docker Hub.
-	llamaCppPath := filepath.Join(l.updatedServerStoragePath, llamaServerBin)
-	if err := l.ensureLatestLlamaCpp(ctx, l.log, httpClient, llamaCppPath, l.vendoredServerStoragePath); err != nil {
+	llamaCppPath := filepath.Join(l.updatedServerStoragePath, serverBinaryName())
+	previousDigest := installedDigest(l.updatedServerStoragePath)
+	if err := l.ensureLatestLlamaCpp(ctx, l.log, httpClient, llamaCppPath, l.vendoredServerStoragePath, GetDesiredServerVersion()); err != nil {
 		l.log.Infof("failed to ensure latest llama.cpp: %v\n", err)
-		if !errors.Is(err, errLlamaCppUpToDate) && !errors.Is(err, errLlamaCppUpdateDisabled) {
+		if !errors.Is(err, errLlamaCppUpToDate) && !errors.Is(err, errLlamaCppUpdateDisabled) && !errors.Is(err, errLlamaCppUpdateRejected) {
 			l.status = fmt.Sprintf("failed to install llama.cpp: %v", err)
 		}
 		if errors.Is(err, context.Canceled) {
@@ -122,6 +135,10 @@ func (l *llamaCpp) Install(ctx context.Context, httpClient *http.Client) error {
 		}
 	} else {
 		l.updatedLlamaCpp = true
+		// Validate updates before using them, if enabled.
+		if validation := getValidationConfig(); validation != nil && installedDigest(l.updatedServerStoragePath) != previousDigest {
+			l.updatedLlamaCpp = l.validateUpdate(ctx, validation, previousDigest)
+		}
 	}
 
 	l.gpuSupported = l.checkGPUSupport(ctx)
@@ -145,9 +162,13 @@ func (l *llamaCpp) Run(ctx context.Context, socket, model string, _ string, mode
 		}
 	}
 
-	binPath := l.vendoredServerStoragePath
-	if l.updatedLlamaCpp {
-		binPath = l.updatedServerStoragePath
+	var version string
+	if config != nil {
+		version = config.BackendVersion
+	}
+	binPath, err := l.serverStoragePath(ctx, version)
+	if err != nil {
+		return err
 	}
 
 	args, err := l.config.GetArgs(bundle, socket, mode, config)
@@ -155,6 +176,17 @@ func (l *llamaCpp) Run(ctx context.Context, socket, model string, _ string, mode
 		return fmt.Errorf("failed to get args for llama.cpp: %w", err)
 	}
 
+	if mode == inference.BackendModeCompletion {
+		quirkArgs, applied, err := l.quirkArgs(bundle)
+		if err != nil {
+			return fmt.Errorf("failed to apply model workarounds: %w", err)
+		}
+		if len(applied) > 0 {
+			l.log.Infof("Applying workarounds %v to %s", applied, model)
+		}
+		args = append(args, quirkArgs...)
+	}
+
 	if draftBundle != nil && config != nil && config.Speculative != nil {
 		draftPath := draftBundle.GGUFPath()
 		if draftPath != "" {
@@ -189,7 +221,11 @@ func (l *llamaCpp) GetDiskUsage() (int64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("error while getting store size: %w", err)
 	}
-	return size, nil
+	versionsSize, err := diskusage.Size(l.versionsStoragePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("error while getting pinned versions size: %w", err)
+	}
+	return size + versionsSize, nil
 }
 
 func (l *llamaCpp) GetRequiredMemoryForModel(ctx context.Context, model string, config *inference.BackendConfiguration) (inference.RequiredMemory, error) {
@@ -208,14 +244,19 @@ func (l *llamaCpp) GetRequiredMemoryForModel(ctx context.Context, model string,
 		}
 	}
 
-	memory := l.estimateMemoryFromGGUF(mdlGguf, contextSize, ngl)
+	var kvCacheType inference.KVCacheType
+	if config != nil {
+		kvCacheType = config.KVCacheType
+	}
+
+	memory := l.estimateMemoryFromGGUF(mdlGguf, contextSize, ngl, kvCacheType)
 
 	if config != nil && config.Speculative != nil && config.Speculative.DraftModel != "" {
 		draftGguf, _, err := l.parseModel(ctx, config.Speculative.DraftModel)
 		if err != nil {
 			return inference.RequiredMemory{}, fmt.Errorf("estimating draft model memory: %w", &inference.ErrGGUFParse{Err: err})
 		}
-		draftMemory := l.estimateMemoryFromGGUF(draftGguf, contextSize, ngl)
+		draftMemory := l.estimateMemoryFromGGUF(draftGguf, contextSize, ngl, kvCacheType)
 		memory.RAM += draftMemory.RAM
 		memory.VRAM += draftMemory.VRAM
 	}
@@ -240,12 +281,20 @@ func (l *llamaCpp) parseModel(ctx context.Context, model string) (*parser.GGUFFi
 }
 
 // estimateMemoryFromGGUF estimates memory requirements from a parsed GGUF file.
-func (l *llamaCpp) estimateMemoryFromGGUF(ggufFile *parser.GGUFFile, contextSize uint64, ngl uint64) inference.RequiredMemory {
-	estimate := ggufFile.EstimateLLaMACppRun(
+func (l *llamaCpp) estimateMemoryFromGGUF(ggufFile *parser.GGUFFile, contextSize uint64, ngl uint64, kvCacheType inference.KVCacheType) inference.RequiredMemory {
+	options := []parser.GGUFRunEstimateOption{
 		parser.WithLLaMACppContextSize(int32(contextSize)),
 		parser.WithLLaMACppLogicalBatchSize(2048),
 		parser.WithLLaMACppOffloadLayers(ngl),
-	)
+	}
+	if kvCacheType == inference.KVCacheTypeInt8 {
+		options = append(options,
+			parser.WithLLaMACppCacheKeyType(parser.GGMLTypeQ8_0),
+			parser.WithLLaMACppCacheValueType(parser.GGMLTypeQ8_0),
+			parser.WithFlashAttention(),
+		)
+	}
+	estimate := ggufFile.EstimateLLaMACppRun(options...)
 	ram := uint64(estimate.Devices[0].Weight.Sum() + estimate.Devices[0].KVCache.Sum() + estimate.Devices[0].Computation.Sum())
 	var vram uint64
 	if len(estimate.Devices) > 1 {
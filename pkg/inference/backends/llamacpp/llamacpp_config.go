@@ -63,6 +63,8 @@ func (c *Config) GetArgs(bundle types.ModelBundle, socket string, mode inference
 		args = append(args, "--embeddings")
 	case inference.BackendModeReranking:
 		args = append(args, "--embeddings", "--reranking")
+	case inference.BackendModeClassification:
+		args = append(args, "--embeddings", "--pooling", "rank")
 	default:
 		return nil, fmt.Errorf("unsupported backend mode %q", mode)
 	}
@@ -70,11 +72,33 @@ func (c *Config) GetArgs(bundle types.ModelBundle, socket string, mode inference
 	// Add context size from model config or backend config
 	args = append(args, "--ctx-size", strconv.FormatUint(GetContextSize(bundle.RuntimeConfig(), config), 10))
 
+	// Add the number of parallel sequences, using a unified KV cache so that
+	// each sequence can use the whole context rather than an equal share
+	if config != nil && config.Parallelism > 0 {
+		args = append(args, "--parallel", strconv.Itoa(config.Parallelism), "--kv-unified")
+	}
+
+	// Quantize the KV cache, which requires flash attention for the values
+	if config != nil {
+		switch config.KVCacheType {
+		case inference.KVCacheTypeDefault:
+		case inference.KVCacheTypeInt8:
+			args = append(args, "--cache-type-k", "q8_0", "--cache-type-v", "q8_0", "--flash-attn", "on")
+		default:
+			return nil, fmt.Errorf("unsupported KV cache type %q", config.KVCacheType)
+		}
+	}
+
 	// Add arguments from backend config
 	if config != nil {
 		args = append(args, config.RuntimeFlags...)
 	}
 
+	// Apply the LoRA adapters bundled with the model
+	for _, path := range bundle.LoRAPaths() {
+		args = append(args, "--lora", path)
+	}
+
 	// Add arguments for Multimodal projector or jinja (they are mutually exclusive)
 	if path := bundle.MMPROJPath(); path != "" {
 		args = append(args, "--mmproj", path)
@@ -86,6 +110,14 @@ func (c *Config) GetArgs(bundle types.ModelBundle, socket string, mode inference
 }
 
 func GetContextSize(modelCfg types.Config, backendCfg *inference.BackendConfiguration) uint64 {
+	// A context size fitted to the available memory overrides all others
+	if backendCfg != nil && backendCfg.FittedContextSize > 0 {
+		return backendCfg.FittedContextSize
+	}
+	// followed by a context size requested per inference request
+	if backendCfg != nil && backendCfg.ContextSizeOverride > 0 {
+		return backendCfg.ContextSizeOverride
+	}
 	// Model config takes precedence
 	if modelCfg.ContextSize != nil {
 		return *modelCfg.ContextSize
@@ -164,6 +164,44 @@ func TestGetArgs(t *testing.T) {
 				"--jinja",
 			),
 		},
+		{
+			name: "fitted context size overrides model config",
+			mode: inference.BackendModeCompletion,
+			bundle: &fakeBundle{
+				ggufPath: modelPath,
+				config: types.Config{
+					ContextSize: uint64ptr(32768),
+				},
+			},
+			config: &inference.BackendConfiguration{
+				ContextSize:       16384,
+				FittedContextSize: 6144,
+			},
+			expected: append(slices.Clone(baseArgs),
+				"--model", modelPath,
+				"--host", socket,
+				"--ctx-size", "6144",
+				"--jinja",
+			),
+		},
+		{
+			name: "parallelism from backend config",
+			mode: inference.BackendModeCompletion,
+			bundle: &fakeBundle{
+				ggufPath: modelPath,
+			},
+			config: &inference.BackendConfiguration{
+				ContextSize: 8192,
+				Parallelism: 2,
+			},
+			expected: append(slices.Clone(baseArgs),
+				"--model", modelPath,
+				"--host", socket,
+				"--ctx-size", "8192",
+				"--parallel", "2", "--kv-unified",
+				"--jinja",
+			),
+		},
 		{
 			name: "chat template from model artifact",
 			mode: inference.BackendModeCompletion,
@@ -197,6 +235,25 @@ func TestGetArgs(t *testing.T) {
 				"--jinja",
 			),
 		},
+		{
+			name: "int8 KV cache",
+			mode: inference.BackendModeCompletion,
+			bundle: &fakeBundle{
+				ggufPath: modelPath,
+			},
+			config: &inference.BackendConfiguration{
+				KVCacheType: inference.KVCacheTypeInt8,
+			},
+			expected: append(slices.Clone(baseArgs),
+				"--model", modelPath,
+				"--host", socket,
+				"--ctx-size", "4096",
+				"--cache-type-k", "q8_0",
+				"--cache-type-v", "q8_0",
+				"--flash-attn", "on",
+				"--jinja",
+			),
+		},
 		{
 			name: "multimodal projector removes jinja",
 			mode: inference.BackendModeCompletion,
@@ -211,6 +268,22 @@ func TestGetArgs(t *testing.T) {
 				"--mmproj", "/path/to/model.mmproj",
 			),
 		},
+		{
+			name: "LoRA adapters",
+			mode: inference.BackendModeCompletion,
+			bundle: &fakeBundle{
+				ggufPath:  modelPath,
+				loraPaths: []string{"/path/to/adapter-00001.lora", "/path/to/adapter-00002.lora"},
+			},
+			expected: append(slices.Clone(baseArgs),
+				"--model", modelPath,
+				"--host", socket,
+				"--ctx-size", "4096",
+				"--lora", "/path/to/adapter-00001.lora",
+				"--lora", "/path/to/adapter-00002.lora",
+				"--jinja",
+			),
+		},
 	}
 
 	for _, tt := range tests {
@@ -251,6 +324,17 @@ func TestGetArgs(t *testing.T) {
 	}
 }
 
+func TestGetArgsUnsupportedKVCacheType(t *testing.T) {
+	config := NewDefaultLlamaCppConfig()
+	bundle := &fakeBundle{ggufPath: "/path/to/model"}
+	_, err := config.GetArgs(bundle, "unix:///tmp/socket", inference.BackendModeCompletion, &inference.BackendConfiguration{
+		KVCacheType: inference.KVCacheTypeFP8,
+	})
+	if err == nil {
+		t.Error("Expected an error for an unsupported KV cache type")
+	}
+}
+
 func TestContainsArg(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -295,6 +379,7 @@ type fakeBundle struct {
 	config       types.Config
 	templatePath string
 	mmprojPath   string
+	loraPaths    []string
 }
 
 func (f *fakeBundle) ChatTemplatePath() string {
@@ -313,10 +398,18 @@ func (f *fakeBundle) MMPROJPath() string {
 	return f.mmprojPath
 }
 
+func (f *fakeBundle) LoRAPaths() []string {
+	return f.loraPaths
+}
+
 func (f *fakeBundle) SafetensorsPath() string {
 	return ""
 }
 
+func (f *fakeBundle) ONNXPath() string {
+	return ""
+}
+
 func (f *fakeBundle) RuntimeConfig() types.Config {
 	return f.config
 }
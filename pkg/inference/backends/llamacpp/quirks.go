@@ -0,0 +1,93 @@
+package llamacpp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/quirks"
+)
+
+// SetQuirks makes a llama.cpp backend apply the workarounds of the rules in a
+// registry to the models it loads in completion mode.
+func SetQuirks(backend inference.Backend, registry *quirks.Registry) error {
+	l, ok := backend.(*llamaCpp)
+	if !ok {
+		return fmt.Errorf("%s isn't the llama.cpp backend", backend.Name())
+	}
+	l.quirks = registry
+	return nil
+}
+
+// bundleChatTemplate returns the chat template of a bundle, preferring a
+// bundled template file over the template embedded in the GGUF metadata.
+func bundleChatTemplate(bundle types.ModelBundle) string {
+	if path := bundle.ChatTemplatePath(); path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			return string(data)
+		}
+	}
+	return bundle.RuntimeConfig().GGUF[quirks.ChatTemplateKey]
+}
+
+// quirkArgs returns the llama-server arguments applying the workarounds for a
+// bundle's known quirks, which take precedence over the arguments preceding
+// them, along with the names of the rules applied.
+func (l *llamaCpp) quirkArgs(bundle types.ModelBundle) ([]string, []string, error) {
+	if l.quirks == nil {
+		return nil, nil, nil
+	}
+	workarounds := l.quirks.Workarounds(bundle.RuntimeConfig(), bundleChatTemplate(bundle))
+	var args, applied []string
+	for _, rule := range workarounds.Rules {
+		applied = append(applied, rule.Name)
+	}
+	if workarounds.EOSTokenID != nil {
+		args = append(args, "--override-kv", quirks.EOSTokenIDKey+"=int:"+strconv.Itoa(*workarounds.EOSTokenID))
+	}
+	if workarounds.ChatTemplate != "" {
+		path, err := writeChatTemplate(workarounds.ChatTemplate)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "--chat-template-file", path)
+	}
+	return args, applied, nil
+}
+
+// writeChatTemplate writes a fixed chat template to a file named after its
+// digest, so that runners of the same model share it, and returns its path.
+func writeChatTemplate(template string) (string, error) {
+	digest := sha256.Sum256([]byte(template))
+	dir := filepath.Join(os.TempDir(), "model-runner-chat-templates")
+	path := filepath.Join(dir, hex.EncodeToString(digest[:])+".jinja")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating chat template directory: %w", err)
+	}
+	// Write to a temporary file first so that concurrent loads never read a
+	// partial template.
+	tmp, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("creating chat template file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(template); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("writing chat template: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("writing chat template: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("writing chat template: %w", err)
+	}
+	return path, nil
+}
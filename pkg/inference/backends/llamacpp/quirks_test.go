@@ -0,0 +1,47 @@
+package llamacpp
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference/quirks"
+)
+
+func TestQuirkArgs(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "template.jinja")
+	template := "{{ raise_exception('Conversation roles must alternate user/assistant/user/assistant/...') }}<end_of_turn>"
+	if err := os.WriteFile(templatePath, []byte(template), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bundle := &fakeBundle{
+		templatePath: templatePath,
+		config:       types.Config{GGUF: map[string]string{quirks.EOSTokenIDKey: "1"}},
+	}
+
+	l := &llamaCpp{}
+	if args, applied, err := l.quirkArgs(bundle); err != nil || args != nil || applied != nil {
+		t.Fatalf("expected no workarounds without a registry, got %v, %v, %v", args, applied, err)
+	}
+
+	l.quirks = quirks.NewRegistry()
+	args, applied, err := l.quirkArgs(bundle)
+	if err != nil {
+		t.Fatalf("quirkArgs failed: %v", err)
+	}
+	if !slices.Equal(applied, []string{"gemma-end-of-turn-eos", "mistral-role-alternation"}) {
+		t.Errorf("unexpected workarounds applied: %v", applied)
+	}
+	if len(args) != 4 || args[0] != "--override-kv" || args[1] != "tokenizer.ggml.eos_token_id=int:107" || args[2] != "--chat-template-file" {
+		t.Fatalf("unexpected args: %v", args)
+	}
+	fixed, err := os.ReadFile(args[3])
+	if err != nil {
+		t.Fatalf("failed to read the fixed chat template: %v", err)
+	}
+	if string(fixed) != "{{ '' }}<end_of_turn>" {
+		t.Errorf("unexpected fixed chat template %q", fixed)
+	}
+}
@@ -0,0 +1,501 @@
+package llamacpp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends"
+	"github.com/docker/model-runner/pkg/sandbox"
+)
+
+const (
+	// defaultValidationPrompt is the prompt of validation generations unless
+	// another is configured.
+	defaultValidationPrompt = "The capital of France is"
+	// defaultValidationMaxTokens is the number of tokens generated by
+	// validation generations unless another number is configured.
+	defaultValidationMaxTokens = 16
+	// validationTimeout is the maximum duration of a validation generation,
+	// including the startup of the server.
+	validationTimeout = 5 * time.Minute
+	// validationReadinessInterval is the interval at which the readiness of
+	// a validation server is polled.
+	validationReadinessInterval = 500 * time.Millisecond
+	// maximumValidationReports is the number of validation reports, and of
+	// rejected updates, kept.
+	maximumValidationReports = 20
+)
+
+// ValidationConfig configures the validation of llama.cpp updates. Before an
+// updated server binary is used, it runs a canned generation with a small
+// model, whose output signature must match the expected one, or the signature
+// of the same generation with the previous binary. Updates that fail
+// validation are rolled back.
+type ValidationConfig struct {
+	// Model is the reference of the (pulled) model used for validation.
+	Model string
+	// Prompt is the prompt of the validation generation.
+	Prompt string
+	// MaxTokens is the number of tokens generated.
+	MaxTokens int
+	// Signature is the expected output signature, as reported by validation
+	// reports. If empty, the signature of the previous binary is expected.
+	Signature string
+}
+
+var (
+	validationConfig     *ValidationConfig
+	validationConfigLock sync.Mutex
+)
+
+// SetValidationConfig enables the validation of llama.cpp updates, or
+// disables it if config is nil.
+func SetValidationConfig(config *ValidationConfig) {
+	validationConfigLock.Lock()
+	defer validationConfigLock.Unlock()
+	validationConfig = config
+}
+
+func getValidationConfig() *ValidationConfig {
+	validationConfigLock.Lock()
+	defer validationConfigLock.Unlock()
+	if validationConfig == nil {
+		return nil
+	}
+	config := *validationConfig
+	if config.Prompt == "" {
+		config.Prompt = defaultValidationPrompt
+	}
+	if config.MaxTokens <= 0 {
+		config.MaxTokens = defaultValidationMaxTokens
+	}
+	return &config
+}
+
+// ValidationResult is the result of the validation of an update.
+type ValidationResult string
+
+const (
+	// ValidationPassed indicates that the update passed validation and is used.
+	ValidationPassed ValidationResult = "passed"
+	// ValidationRolledBack indicates that the update failed validation and was
+	// rolled back.
+	ValidationRolledBack ValidationResult = "rolled-back"
+	// ValidationSkipped indicates that the update couldn't be validated, e.g.
+	// because the validation model isn't pulled, and is used.
+	ValidationSkipped ValidationResult = "skipped"
+)
+
+// ValidationReport reports the validation of an update.
+type ValidationReport struct {
+	Time              time.Time `json:"time"`
+	Model             string    `json:"model"`
+	Version           string    `json:"version"`
+	PreviousVersion   string    `json:"previous_version,omitempty"`
+	ExpectedSignature string    `json:"expected_signature,omitempty"`
+	Signature         string    `json:"signature,omitempty"`
+	Output            string    `json:"output,omitempty"`
+	// TokensPerSecond is the generation throughput of the updated binary, as
+	// reported by the server.
+	TokensPerSecond float64          `json:"tokens_per_second,omitempty"`
+	Result          ValidationResult `json:"result"`
+	Error           string           `json:"error,omitempty"`
+}
+
+// ThroughputSample is the throughput of the validation generation with an
+// updated server binary, and with the previous one if it was run. Versions
+// are those reported by the binaries.
+type ThroughputSample struct {
+	Model                   string
+	Version                 string
+	TokensPerSecond         float64
+	PreviousVersion         string
+	PreviousTokensPerSecond float64
+}
+
+// ThroughputCheck checks the throughput of an update that passed the output
+// validation, returning an error if it regressed, in which case the update is
+// rolled back.
+type ThroughputCheck func(ctx context.Context, sample ThroughputSample) error
+
+// SetThroughputCheck makes a llama.cpp backend check the throughput of the
+// updates it validates. It must be called before the backend is installed.
+func SetThroughputCheck(backend inference.Backend, check ThroughputCheck) error {
+	l, ok := backend.(*llamaCpp)
+	if !ok {
+		return fmt.Errorf("%s isn't the llama.cpp backend", backend.Name())
+	}
+	l.throughputCheck = check
+	return nil
+}
+
+// previousStoragePath returns the parent path of the com.docker.llama-server
+// binary replaced by the last update, which is kept until the update passes
+// validation.
+func (l *llamaCpp) previousStoragePath() string {
+	return filepath.Join(filepath.Dir(l.updatedServerStoragePath), "previous", "bin")
+}
+
+// validationStatePath returns the path of the file of validation reports and
+// rejected updates.
+func (l *llamaCpp) validationStatePath() string {
+	return filepath.Join(filepath.Dir(l.updatedServerStoragePath), "validation.json")
+}
+
+// installedDigest returns the digest of the updated binary, or an empty string
+// if there's none.
+func installedDigest(binPath string) string {
+	data, err := os.ReadFile(filepath.Join(binPath, ".llamacpp_version"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// moveInstallation moves the bin directory of an installation and its sibling
+// lib directory to another bin path, replacing any installation there.
+func moveInstallation(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	for _, dir := range []string{"bin", "lib"} {
+		target := filepath.Join(filepath.Dir(to), dir)
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+		source := filepath.Join(filepath.Dir(from), dir)
+		if _, err := os.Stat(source); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := os.Rename(source, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeInstallation removes the bin directory of an installation and its
+// sibling lib directory.
+func removeInstallation(binPath string) error {
+	if err := os.RemoveAll(binPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to clear inference binary dir: %w", err)
+	}
+	if err := os.RemoveAll(filepath.Join(filepath.Dir(binPath), "lib")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to clear inference library dir: %w", err)
+	}
+	return nil
+}
+
+// retireInstallation clears the installation whose binary is at llamaCppPath
+// before it's replaced. The updated installation is kept as the previous one
+// if updates are validated, so that they can be rolled back.
+func (l *llamaCpp) retireInstallation(llamaCppPath string) error {
+	binPath := filepath.Dir(llamaCppPath)
+	if binPath == l.updatedServerStoragePath && getValidationConfig() != nil {
+		if _, err := os.Stat(binPath); err == nil {
+			if err := moveInstallation(binPath, l.previousStoragePath()); err != nil {
+				return fmt.Errorf("failed to keep the previous inference binary: %w", err)
+			}
+			return nil
+		}
+		if err := os.RemoveAll(filepath.Dir(l.previousStoragePath())); err != nil {
+			return fmt.Errorf("failed to clear the previous inference binary: %w", err)
+		}
+	}
+	return removeInstallation(binPath)
+}
+
+// validateUpdate validates the updated binary, which replaced the binary with
+// the previous digest, and rolls it back if the validation fails. It returns
+// whether an updated binary is still in use, i.e. unless the update replaced
+// the vendored binary and was rolled back.
+func (l *llamaCpp) validateUpdate(ctx context.Context, config *ValidationConfig, previousDigest string) bool {
+	report := ValidationReport{
+		Time:              time.Now(),
+		Model:             config.Model,
+		Version:           installedDigest(l.updatedServerStoragePath),
+		PreviousVersion:   previousDigest,
+		ExpectedSignature: config.Signature,
+	}
+	defer func() {
+		l.recordValidation(report)
+	}()
+
+	if _, err := l.modelManager.GetBundle(config.Model); err != nil {
+		report.Result = ValidationSkipped
+		report.Error = fmt.Sprintf("validation model unavailable: %v", err)
+		l.log.Warnf("Not validating llama.cpp update: %s", report.Error)
+		return true
+	}
+
+	previousPath := l.previousStoragePath()
+	if _, err := os.Stat(previousPath); err != nil {
+		previousPath = l.vendoredServerStoragePath
+	}
+	sample := ThroughputSample{Model: config.Model}
+	if report.ExpectedSignature == "" {
+		output, tokensPerSecond, err := l.generate(ctx, previousPath, config)
+		if err != nil {
+			report.Result = ValidationSkipped
+			report.Error = fmt.Sprintf("previous binary failed the validation generation: %v", err)
+			l.log.Warnf("Not validating llama.cpp update: %s", report.Error)
+			return true
+		}
+		report.ExpectedSignature = outputSignature(output)
+		sample.PreviousTokensPerSecond = tokensPerSecond
+	}
+
+	output, tokensPerSecond, err := l.generate(ctx, l.updatedServerStoragePath, config)
+	if errors.Is(err, context.Canceled) {
+		report.Result = ValidationSkipped
+		report.Error = err.Error()
+		return true
+	}
+	if err == nil {
+		report.Output = output
+		report.Signature = outputSignature(output)
+		report.TokensPerSecond = tokensPerSecond
+		if report.Signature != report.ExpectedSignature {
+			err = fmt.Errorf("output signature %s doesn't match the expected signature %s", report.Signature, report.ExpectedSignature)
+		} else if l.throughputCheck != nil && tokensPerSecond > 0 {
+			sample.Version = getLlamaCppVersion(l.log, filepath.Join(l.updatedServerStoragePath, "com.docker.llama-server"))
+			sample.PreviousVersion = getLlamaCppVersion(l.log, filepath.Join(previousPath, "com.docker.llama-server"))
+			sample.TokensPerSecond = tokensPerSecond
+			err = l.throughputCheck(ctx, sample)
+		}
+		if err == nil {
+			report.Result = ValidationPassed
+			l.log.Infof("llama.cpp update %s passed validation", report.Version)
+			return true
+		}
+	}
+	report.Result = ValidationRolledBack
+	report.Error = err.Error()
+	l.log.Warnf("llama.cpp update %s failed validation, rolling back: %v", report.Version, err)
+	return l.rollBack(previousPath)
+}
+
+// rollBack restores the previous installation, or removes the updated one if
+// the previous binary is the vendored one. Either way, the rejected update is
+// discarded rather than kept as the previous installation. It returns whether
+// an updated binary is still in use.
+func (l *llamaCpp) rollBack(previousPath string) bool {
+	binPath := l.vendoredServerStoragePath
+	updated := previousPath != l.vendoredServerStoragePath
+	var err error
+	if updated {
+		err = moveInstallation(previousPath, l.updatedServerStoragePath)
+		binPath = l.updatedServerStoragePath
+	} else {
+		err = removeInstallation(l.updatedServerStoragePath)
+	}
+	if err != nil {
+		l.log.Warnf("Failed to roll back llama.cpp update: %v", err)
+	}
+	l.status = fmt.Sprintf("running llama.cpp (update rolled back after failed validation) version: %s",
+		getLlamaCppVersion(l.log, filepath.Join(binPath, "com.docker.llama-server")))
+	return updated
+}
+
+// validationState is the content of the validation file.
+type validationState struct {
+	// Reports are the most recent validation reports, oldest first.
+	Reports []ValidationReport `json:"reports"`
+	// Rejected are the digests of the most recent updates that were rolled
+	// back after failing validation, which aren't installed again.
+	Rejected []string `json:"rejected,omitempty"`
+}
+
+// recordValidation appends a validation report to the validation file, along
+// with the update's digest if it was rolled back.
+func (l *llamaCpp) recordValidation(report ValidationReport) {
+	state, _ := l.validationState()
+	state.Reports = append(state.Reports, report)
+	if len(state.Reports) > maximumValidationReports {
+		state.Reports = state.Reports[len(state.Reports)-maximumValidationReports:]
+	}
+	if report.Result == ValidationRolledBack && report.Version != "" && !slices.Contains(state.Rejected, report.Version) {
+		state.Rejected = append(state.Rejected, report.Version)
+		if len(state.Rejected) > maximumValidationReports {
+			state.Rejected = state.Rejected[len(state.Rejected)-maximumValidationReports:]
+		}
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = os.WriteFile(l.validationStatePath(), data, 0o644)
+	}
+	if err != nil {
+		l.log.Warnf("Failed to record llama.cpp validation report: %v", err)
+	}
+}
+
+// validationState returns the recorded validation reports and rejected
+// updates. Files holding only an array of reports, as previously recorded,
+// are supported.
+func (l *llamaCpp) validationState() (validationState, error) {
+	data, err := os.ReadFile(l.validationStatePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return validationState{}, nil
+	} else if err != nil {
+		return validationState{}, err
+	}
+	var state validationState
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &state.Reports)
+	} else {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil {
+		return validationState{}, err
+	}
+	return state, nil
+}
+
+// updateRejected returns whether the update with a digest was rolled back
+// after failing validation.
+//
+//nolint:unused // Used in platform-specific files (download_darwin.go, download_windows.go)
+func (l *llamaCpp) updateRejected(digest string) bool {
+	state, err := l.validationState()
+	if err != nil {
+		l.log.Warnf("Failed to read llama.cpp validation reports: %v", err)
+		return false
+	}
+	return slices.Contains(state.Rejected, digest)
+}
+
+// outputSignature returns the signature of the output of a validation
+// generation.
+func outputSignature(output string) string {
+	sum := sha256.Sum256([]byte(output))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// generate runs the validation generation with the binary in binPath and
+// returns its output and the generation throughput reported by the server,
+// which is zero if it's not reported.
+func (l *llamaCpp) generate(ctx context.Context, binPath string, config *ValidationConfig) (string, float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, validationTimeout)
+	defer cancel()
+
+	bundle, err := l.modelManager.GetBundle(config.Model)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get validation model: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "llamacpp-validation")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "llama.sock")
+	args, err := l.config.GetArgs(bundle, socket, inference.BackendModeCompletion, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get args for llama.cpp: %w", err)
+	}
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- backends.RunBackend(serverCtx, backends.RunnerConfig{
+			BackendName:     "llama.cpp",
+			Socket:          socket,
+			BinaryPath:      filepath.Join(binPath, "com.docker.llama-server"),
+			SandboxPath:     binPath,
+			SandboxConfig:   sandbox.ConfigurationLlamaCpp,
+			Args:            args,
+			Logger:          l.log,
+			ServerLogWriter: l.serverLog.Writer(),
+		})
+	}()
+	defer func() {
+		stopServer()
+		<-done
+	}()
+
+	var dialer net.Dialer
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}}
+	defer client.CloseIdleConnections()
+
+	for {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/v1/models", http.NoBody)
+		if err != nil {
+			return "", 0, err
+		}
+		if response, err := client.Do(request); err == nil {
+			response.Body.Close()
+			if response.StatusCode == http.StatusOK {
+				break
+			}
+		}
+		select {
+		case err := <-done:
+			done <- err
+			return "", 0, fmt.Errorf("validation server exited: %w", err)
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		case <-time.After(validationReadinessInterval):
+		}
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"prompt":       config.Prompt,
+		"max_tokens":   config.MaxTokens,
+		"temperature":  0,
+		"seed":         0,
+		"cache_prompt": false,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/v1/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return "", 0, err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("validation generation failed with status %d: %s", response.StatusCode, bytes.TrimSpace(data))
+	}
+	var completion struct {
+		Choices []struct {
+			Text string `json:"text"`
+		} `json:"choices"`
+		Timings struct {
+			PredictedPerSecond float64 `json:"predicted_per_second"`
+		} `json:"timings"`
+	}
+	if err := json.Unmarshal(data, &completion); err != nil {
+		return "", 0, fmt.Errorf("invalid validation generation response: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", 0, errors.New("validation generation returned no choices")
+	}
+	return completion.Choices[0].Text, completion.Timings.PredictedPerSecond, nil
+}
@@ -0,0 +1,118 @@
+package llamacpp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// installFake installs a fake updated binary with a digest.
+func installFake(t *testing.T, binPath, digest string) {
+	t.Helper()
+	for _, dir := range []string{binPath, filepath.Join(filepath.Dir(binPath), "lib")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(binPath, ".llamacpp_version"), []byte(digest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(binPath), "lib", "libllama"), []byte(digest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollBack(t *testing.T) {
+	SetValidationConfig(&ValidationConfig{Model: "ai/smollm2"})
+	defer SetValidationConfig(nil)
+
+	root := t.TempDir()
+	backend, err := New(logrus.New(), nil, logrus.New(), filepath.Join(root, "vendored"), filepath.Join(root, "updated", "bin"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create backend: %v", err)
+	}
+	l := backend.(*llamaCpp)
+
+	// The first update replaces the vendored binary, so rolling it back
+	// removes it.
+	if err := l.retireInstallation(filepath.Join(l.updatedServerStoragePath, serverBinaryName())); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	installFake(t, l.updatedServerStoragePath, "sha256:first")
+	if l.rollBack(l.vendoredServerStoragePath) {
+		t.Error("Expected the vendored binary to be used after rolling back the first update")
+	}
+	if digest := installedDigest(l.updatedServerStoragePath); digest != "" {
+		t.Errorf("Expected the update to be removed, got %q", digest)
+	}
+	if _, err := os.Stat(filepath.Dir(l.previousStoragePath())); !os.IsNotExist(err) {
+		t.Errorf("Expected the rejected update not to be kept as the previous one, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "updated", "lib")); !os.IsNotExist(err) {
+		t.Errorf("Expected the rejected update's libraries to be removed, got %v", err)
+	}
+
+	// Later updates keep the previous binary, to which they're rolled back.
+	installFake(t, l.updatedServerStoragePath, "sha256:first")
+	if err := l.retireInstallation(filepath.Join(l.updatedServerStoragePath, serverBinaryName())); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if digest := installedDigest(l.previousStoragePath()); digest != "sha256:first" {
+		t.Fatalf("Expected the previous binary to be kept, got %q", digest)
+	}
+	installFake(t, l.updatedServerStoragePath, "sha256:second")
+	if !l.rollBack(l.previousStoragePath()) {
+		t.Error("Expected the previous updated binary to be used after rolling back")
+	}
+	if digest := installedDigest(l.updatedServerStoragePath); digest != "sha256:first" {
+		t.Errorf("Expected the previous binary to be restored, got %q", digest)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "updated", "lib", "libllama")); err != nil || string(data) != "sha256:first" {
+		t.Errorf("Expected the previous libraries to be restored, got %q (error: %v)", data, err)
+	}
+}
+
+func TestRecordValidation(t *testing.T) {
+	root := t.TempDir()
+	backend, err := New(logrus.New(), nil, logrus.New(), filepath.Join(root, "vendored"), filepath.Join(root, "updated", "bin"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create backend: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "updated"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	l := backend.(*llamaCpp)
+	for i := range maximumValidationReports + 1 {
+		l.recordValidation(ValidationReport{Version: "sha256:" + string(rune('a'+i)), Result: ValidationPassed})
+	}
+	state, err := l.validationState()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(state.Reports) != maximumValidationReports || state.Reports[0].Version != "sha256:b" {
+		t.Errorf("Expected the %d most recent reports, got %+v", maximumValidationReports, state.Reports)
+	}
+
+	// Rolled back updates are remembered, so that they aren't installed again.
+	if l.updateRejected("sha256:bad") {
+		t.Error("Expected no rejected update")
+	}
+	l.recordValidation(ValidationReport{Version: "sha256:bad", Result: ValidationRolledBack})
+	l.recordValidation(ValidationReport{Version: "sha256:bad", Result: ValidationRolledBack})
+	if state, _ := l.validationState(); !l.updateRejected("sha256:bad") || l.updateRejected("sha256:b") || len(state.Rejected) != 1 {
+		t.Errorf("Expected the rolled back update to be rejected once, got %+v", state.Rejected)
+	}
+
+	// Files recorded as an array of reports are still read.
+	if err := os.WriteFile(l.validationStatePath(), []byte(`[{"version": "sha256:old", "result": "passed"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := l.validationState(); err != nil || len(state.Reports) != 1 || state.Reports[0].Version != "sha256:old" {
+		t.Errorf("Expected the previous format to be read, got %+v (error: %v)", state, err)
+	}
+	if signature := outputSignature(" Paris."); signature != outputSignature(" Paris.") || signature == outputSignature(" Lyon.") {
+		t.Errorf("Expected signatures to identify outputs, got %s", signature)
+	}
+}
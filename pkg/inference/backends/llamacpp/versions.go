@@ -0,0 +1,84 @@
+package llamacpp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+)
+
+// versionRegexp matches the versions to which models may be pinned, which are
+// tags of the llama.cpp backend image without the variant suffix.
+var versionRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,99}$`)
+
+// ValidateServerVersion checks that a version to which a model is pinned is
+// well-formed.
+func ValidateServerVersion(version string) error {
+	if !versionRegexp.MatchString(version) {
+		return fmt.Errorf("invalid llama.cpp version %q", version)
+	}
+	return nil
+}
+
+// serverBinaryName returns the file name of the llama.cpp server binary.
+func serverBinaryName() string {
+	if runtime.GOOS == "windows" {
+		return "com.docker.llama-server.exe"
+	}
+	return "com.docker.llama-server"
+}
+
+// versionsStoragePath returns the path under which pinned versions are
+// installed side by side with the updated version.
+func (l *llamaCpp) versionsStoragePath() string {
+	return filepath.Join(filepath.Dir(l.updatedServerStoragePath), "versions")
+}
+
+// serverStoragePath returns the parent path of the com.docker.llama-server
+// binary to run for the specified version, installing the version if
+// necessary. An empty version selects the default (vendored or updated)
+// binary. Pinned versions are installed once per process. If an installation
+// fails, a previously installed binary for the version is used instead.
+func (l *llamaCpp) serverStoragePath(ctx context.Context, version string) (string, error) {
+	if version == "" {
+		if l.updatedLlamaCpp {
+			return l.updatedServerStoragePath, nil
+		}
+		return l.vendoredServerStoragePath, nil
+	}
+	if err := ValidateServerVersion(version); err != nil {
+		return "", err
+	}
+
+	l.versionsLock.Lock()
+	defer l.versionsLock.Unlock()
+	if path, ok := l.installedVersions[version]; ok {
+		return path, nil
+	}
+
+	path := filepath.Join(l.versionsStoragePath(), version, "bin")
+	llamaCppPath := filepath.Join(path, serverBinaryName())
+	// Installation reports its progress through the backend status, which
+	// should continue to describe the default version.
+	status := l.status
+	err := l.ensureLatestLlamaCpp(ctx, l.log, l.httpClient, llamaCppPath, l.vendoredServerStoragePath, version)
+	l.status = status
+	switch {
+	case err == nil:
+	case errors.Is(err, errLlamaCppUpToDate):
+		path = l.vendoredServerStoragePath
+	case errors.Is(err, context.Canceled):
+		return "", err
+	default:
+		if _, statErr := os.Stat(llamaCppPath); statErr != nil {
+			return "", fmt.Errorf("failed to install llama.cpp %s: %w", version, err)
+		}
+		l.log.Warnf("Failed to update llama.cpp %s, using the installed binary: %v", version, err)
+	}
+	l.log.Infof("Using llama.cpp %s from %s", version, path)
+	l.installedVersions[version] = path
+	return path, nil
+}
@@ -0,0 +1,64 @@
+package llamacpp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidateServerVersion(t *testing.T) {
+	for _, valid := range []string{"latest", "b6000", "v0.0.22", "b6000_rc-1"} {
+		if err := ValidateServerVersion(valid); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"", ".", "..", "../latest", "b6000/cuda", "-latest", "b 6000"} {
+		if err := ValidateServerVersion(invalid); err == nil {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestServerStoragePath(t *testing.T) {
+	ShouldUpdateServerLock.Lock()
+	shouldUpdateServer := ShouldUpdateServer
+	ShouldUpdateServer = false
+	ShouldUpdateServerLock.Unlock()
+	defer func() {
+		ShouldUpdateServerLock.Lock()
+		ShouldUpdateServer = shouldUpdateServer
+		ShouldUpdateServerLock.Unlock()
+	}()
+
+	root := t.TempDir()
+	backend, err := New(logrus.New(), nil, logrus.New(), filepath.Join(root, "vendored"), filepath.Join(root, "updated", "bin"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create backend: %v", err)
+	}
+	l := backend.(*llamaCpp)
+
+	installed := filepath.Join(root, "updated", "versions", "b6000", "bin")
+	if err := os.MkdirAll(installed, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(installed, serverBinaryName()), nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if path, err := l.serverStoragePath(ctx, ""); err != nil || path != l.vendoredServerStoragePath {
+		t.Errorf("Expected the vendored binary without a pinned version, got %q (%v)", path, err)
+	}
+	if path, err := l.serverStoragePath(ctx, "b6000"); err != nil || path != installed {
+		t.Errorf("Expected the installed binary for a pinned version, got %q (%v)", path, err)
+	}
+	if _, err := l.serverStoragePath(ctx, "b5000"); err == nil {
+		t.Error("Expected an error for a pinned version that can't be installed")
+	}
+	if _, err := l.serverStoragePath(ctx, "../bin"); err == nil {
+		t.Error("Expected an error for an invalid version")
+	}
+}
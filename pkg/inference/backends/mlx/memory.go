@@ -0,0 +1,93 @@
+package mlx
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+const (
+	// defaultContextSize is the context size for which the KV cache is
+	// estimated if neither the model nor the backend configuration sets one.
+	defaultContextSize = 4096
+	// serverOverhead is the memory used by the mlx_lm.server Python process
+	// itself, outside of the model's weights and KV cache.
+	serverOverhead = 512 * 1024 * 1024
+	// kvCacheBytesPerElement is the size of the elements of the KV cache,
+	// which MLX keeps in 16-bit floats.
+	kvCacheBytesPerElement = 2
+)
+
+// modelConfig holds the fields of a Hugging Face model's config.json that
+// determine the size of its KV cache.
+type modelConfig struct {
+	HiddenSize        uint64 `json:"hidden_size"`
+	NumHiddenLayers   uint64 `json:"num_hidden_layers"`
+	NumAttentionHeads uint64 `json:"num_attention_heads"`
+	NumKeyValueHeads  uint64 `json:"num_key_value_heads"`
+	HeadDim           uint64 `json:"head_dim"`
+}
+
+// kvCacheSize returns the size of the KV cache for a context size, or zero if
+// the model's config doesn't describe its attention layers.
+func (c modelConfig) kvCacheSize(contextSize uint64) uint64 {
+	if c.NumHiddenLayers == 0 || c.NumAttentionHeads == 0 {
+		return 0
+	}
+	headDim := c.HeadDim
+	if headDim == 0 {
+		headDim = c.HiddenSize / c.NumAttentionHeads
+	}
+	kvHeads := cmp.Or(c.NumKeyValueHeads, c.NumAttentionHeads)
+	return 2 * c.NumHiddenLayers * kvHeads * headDim * contextSize * kvCacheBytesPerElement
+}
+
+// estimateMemory estimates the memory used by a runner for a bundle: its
+// weights and KV cache, which live in the unified memory shared by the GPU and
+// are thus reported as VRAM, and the server process's overhead.
+func estimateMemory(bundle types.ModelBundle, config *inference.BackendConfiguration) (inference.RequiredMemory, error) {
+	safetensorsPath := bundle.SafetensorsPath()
+	if safetensorsPath == "" {
+		return inference.RequiredMemory{}, errors.New("safetensors path required by MLX backend")
+	}
+	modelDir := filepath.Dir(safetensorsPath)
+
+	// The weights may be sharded across several files.
+	shards, err := filepath.Glob(filepath.Join(modelDir, "*.safetensors"))
+	if err != nil {
+		return inference.RequiredMemory{}, fmt.Errorf("listing safetensors files: %w", err)
+	}
+	var weights uint64
+	for _, shard := range shards {
+		info, err := os.Stat(shard)
+		if err != nil {
+			return inference.RequiredMemory{}, fmt.Errorf("reading safetensors file: %w", err)
+		}
+		weights += uint64(info.Size())
+	}
+
+	var mdlConfig modelConfig
+	if data, err := os.ReadFile(filepath.Join(modelDir, "config.json")); err == nil {
+		if err := json.Unmarshal(data, &mdlConfig); err != nil {
+			return inference.RequiredMemory{}, fmt.Errorf("parsing model config: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return inference.RequiredMemory{}, fmt.Errorf("reading model config: %w", err)
+	}
+	contextSize := uint64(defaultContextSize)
+	if maxTokens := GetMaxTokens(bundle.RuntimeConfig(), config); maxTokens != nil {
+		contextSize = *maxTokens
+	}
+
+	return inference.RequiredMemory{
+		RAM:  serverOverhead,
+		VRAM: weights + mdlConfig.kvCacheSize(contextSize),
+	}, nil
+}
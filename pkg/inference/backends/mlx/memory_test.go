@@ -0,0 +1,46 @@
+package mlx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestEstimateMemory(t *testing.T) {
+	dir := t.TempDir()
+	for name, size := range map[string]int{"model-00001-of-00002.safetensors": 3000, "model-00002-of-00002.safetensors": 1000} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundle := &mockModelBundle{safetensorsPath: filepath.Join(dir, "model-00001-of-00002.safetensors")}
+
+	// Without a model config, only the weights are counted.
+	memory, err := estimateMemory(bundle, nil)
+	if err != nil {
+		t.Fatalf("estimateMemory failed: %v", err)
+	}
+	if memory.RAM != serverOverhead || memory.VRAM != 4000 {
+		t.Errorf("expected %d RAM and 4000 VRAM, got %+v", serverOverhead, memory)
+	}
+
+	// The KV cache is sized from the model config: 2 (keys and values) x 16
+	// layers x 8 KV heads x 64 dimensions x 1024 tokens x 2 bytes.
+	config := `{"hidden_size": 2048, "num_hidden_layers": 16, "num_attention_heads": 32, "num_key_value_heads": 8}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	memory, err = estimateMemory(bundle, &inference.BackendConfiguration{ContextSize: 1024})
+	if err != nil {
+		t.Fatalf("estimateMemory failed: %v", err)
+	}
+	if expected := uint64(4000 + 2*16*8*64*1024*2); memory.VRAM != expected {
+		t.Errorf("expected %d VRAM, got %d", expected, memory.VRAM)
+	}
+
+	if _, err := estimateMemory(&mockModelBundle{}, nil); err == nil {
+		t.Error("expected an error for a bundle without safetensors")
+	}
+}
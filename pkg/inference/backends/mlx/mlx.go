@@ -139,11 +139,12 @@ func (m *mlx) GetDiskUsage() (int64, error) {
 	return 0, nil
 }
 
-func (m *mlx) GetRequiredMemoryForModel(ctx context.Context, model string, config *inference.BackendConfiguration) (inference.RequiredMemory, error) {
-	// TODO: Implement accurate memory estimation based on model size.
-	// MLX runs on unified memory architecture (Apple Silicon), so memory estimation
-	// will need to account for the unified nature of RAM and VRAM on Apple Silicon.
-	// Returning an error prevents the scheduler from making incorrect decisions based
-	// on placeholder values.
-	return inference.RequiredMemory{}, errors.New("not implemented")
+// GetRequiredMemoryForModel implements
+// inference.Backend.GetRequiredMemoryForModel.
+func (m *mlx) GetRequiredMemoryForModel(_ context.Context, model string, config *inference.BackendConfiguration) (inference.RequiredMemory, error) {
+	bundle, err := m.modelManager.GetBundle(model)
+	if err != nil {
+		return inference.RequiredMemory{}, fmt.Errorf("failed to get model: %w", err)
+	}
+	return estimateMemory(bundle, config)
 }
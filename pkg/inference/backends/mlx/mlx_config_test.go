@@ -20,6 +20,10 @@ func (m *mockModelBundle) SafetensorsPath() string {
 	return m.safetensorsPath
 }
 
+func (m *mockModelBundle) ONNXPath() string {
+	return ""
+}
+
 func (m *mockModelBundle) ChatTemplatePath() string {
 	return ""
 }
@@ -28,6 +32,10 @@ func (m *mockModelBundle) MMPROJPath() string {
 	return ""
 }
 
+func (m *mockModelBundle) LoRAPaths() []string {
+	return nil
+}
+
 func (m *mockModelBundle) RuntimeConfig() types.Config {
 	return m.runtimeConfig
 }
@@ -0,0 +1,206 @@
+package mock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+// FixtureHeader reports whether a mocked response was served from a fixture
+// ("hit") or rendered from the model's templates ("miss").
+const FixtureHeader = "X-Mock-Fixture"
+
+// ErrFixtureNotFound is returned when there's no fixture for a request.
+var ErrFixtureNotFound = errors.New("fixture not found")
+
+// fixtureFields are the request fields that identify the prompt of each
+// endpoint served by mocked models. Other fields, such as sampling parameters
+// and streaming options, don't affect fixture keys.
+var fixtureFields = map[string][]string{
+	"/v1/chat/completions": {"messages", "tools", "response_format"},
+	"/v1/completions":      {"prompt", "suffix"},
+	"/v1/embeddings":       {"input"},
+	"/rerank":              {"query", "documents", "top_n"},
+	"/score":               {"text_1", "text_2"},
+}
+
+// Fixture is a recorded response to a request for a model, keyed by the hash
+// of the model, endpoint, and prompt.
+type Fixture struct {
+	Key      string `json:"key"`
+	Model    string `json:"model"`
+	Endpoint string `json:"endpoint"`
+	// Request is the recorded request, kept for reference.
+	Request json.RawMessage `json:"request,omitempty"`
+	// Response is the recorded, non-streamed response.
+	Response json.RawMessage `json:"response"`
+	Recorded time.Time       `json:"recorded"`
+}
+
+// FixtureEndpoint returns the endpoint served by mocked models to which a
+// request path corresponds, e.g. "/v1/chat/completions" for
+// "/engines/llama.cpp/v1/chat/completions".
+func FixtureEndpoint(path string) (string, bool) {
+	for endpoint := range fixtureFields {
+		if strings.HasSuffix(path, endpoint) {
+			return endpoint, true
+		}
+	}
+	return "", false
+}
+
+// FixtureKey returns the key of the fixture for a request to an endpoint of a
+// model, which is the hash of the model's normalized reference, the endpoint,
+// and the canonical JSON of the request's prompt fields.
+func FixtureKey(model, endpoint string, body []byte) (string, error) {
+	fields, ok := fixtureFields[endpoint]
+	if !ok {
+		return "", fmt.Errorf("unsupported endpoint %s", endpoint)
+	}
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return "", fmt.Errorf("invalid request: %w", err)
+	}
+	prompt := make(map[string]any, len(fields))
+	for _, field := range fields {
+		if raw, ok := request[field]; ok {
+			var value any
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return "", fmt.Errorf("invalid %s: %w", field, err)
+			}
+			prompt[field] = value
+		}
+	}
+	// Maps are encoded with sorted keys, so the encoding is canonical.
+	canonical, err := json.Marshal(prompt)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n", models.NormalizeModelName(model), endpoint)
+	hash.Write(canonical)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// NewFixture creates the fixture for a request to a model at path and its
+// non-streamed response.
+func NewFixture(model, path string, request, response []byte) (*Fixture, error) {
+	endpoint, ok := FixtureEndpoint(path)
+	if !ok {
+		return nil, fmt.Errorf("unsupported endpoint %s", path)
+	}
+	if !json.Valid(response) {
+		return nil, errors.New("response isn't JSON")
+	}
+	key, err := FixtureKey(model, endpoint, request)
+	if err != nil {
+		return nil, err
+	}
+	return &Fixture{
+		Key:      key,
+		Model:    models.NormalizeModelName(model),
+		Endpoint: endpoint,
+		Request:  request,
+		Response: response,
+		Recorded: time.Now().UTC(),
+	}, nil
+}
+
+// FixtureStore stores fixtures in a directory, one JSON file per fixture
+// named after its key, so that fixtures can be committed alongside tests.
+type FixtureStore struct {
+	path string
+}
+
+// NewFixtureStore creates a fixture store in the directory at path, creating
+// it if needed.
+func NewFixtureStore(path string) (*FixtureStore, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create fixtures directory: %w", err)
+	}
+	return &FixtureStore{path: path}, nil
+}
+
+// file returns the path of the file of the fixture with the specified key.
+func (s *FixtureStore) file(key string) string {
+	return filepath.Join(s.path, key+".json")
+}
+
+// Lookup returns the fixture with the specified key, or ErrFixtureNotFound
+// if there's none.
+func (s *FixtureStore) Lookup(key string) (*Fixture, error) {
+	data, err := os.ReadFile(s.file(filepath.Base(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrFixtureNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read fixture: %w", err)
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", key, err)
+	}
+	return &fixture, nil
+}
+
+// Save stores a fixture, replacing any fixture with the same key.
+func (s *FixtureStore) Save(fixture *Fixture) error {
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode fixture: %w", err)
+	}
+	temporary, err := os.CreateTemp(s.path, ".fixture-*")
+	if err != nil {
+		return fmt.Errorf("unable to create fixture: %w", err)
+	}
+	defer os.Remove(temporary.Name())
+	if _, err := temporary.Write(append(data, '\n')); err != nil {
+		temporary.Close()
+		return fmt.Errorf("unable to write fixture: %w", err)
+	}
+	if err := temporary.Close(); err != nil {
+		return fmt.Errorf("unable to write fixture: %w", err)
+	}
+	if err := os.Rename(temporary.Name(), s.file(fixture.Key)); err != nil {
+		return fmt.Errorf("unable to save fixture: %w", err)
+	}
+	return nil
+}
+
+// List returns the stored fixtures, ordered by model, endpoint, and key.
+// Invalid fixture files are skipped.
+func (s *FixtureStore) List() ([]*Fixture, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list fixtures: %w", err)
+	}
+	var fixtures []*Fixture
+	for _, entry := range entries {
+		key, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		if fixture, err := s.Lookup(key); err == nil {
+			fixtures = append(fixtures, fixture)
+		}
+	}
+	slices.SortFunc(fixtures, func(a, b *Fixture) int {
+		if c := strings.Compare(a.Model, b.Model); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Endpoint, b.Endpoint); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return fixtures, nil
+}
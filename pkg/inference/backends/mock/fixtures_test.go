@@ -0,0 +1,110 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFixtureKey(t *testing.T) {
+	key := func(model, endpoint, body string) string {
+		t.Helper()
+		key, err := FixtureKey(model, endpoint, []byte(body))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return key
+	}
+	base := key("echo", "/v1/chat/completions", `{"messages":[{"role":"user","content":"Hi"}]}`)
+	if other := key("ai/echo:latest", "/v1/chat/completions", `{"temperature":0.2,"stream":true,"messages":[{"content":"Hi","role":"user"}]}`); other != base {
+		t.Error("Expected sampling and streaming options not to affect the key")
+	}
+	if other := key("echo", "/v1/chat/completions", `{"messages":[{"role":"user","content":"Hello"}]}`); other == base {
+		t.Error("Expected the prompt to affect the key")
+	}
+	if other := key("other", "/v1/chat/completions", `{"messages":[{"role":"user","content":"Hi"}]}`); other == base {
+		t.Error("Expected the model to affect the key")
+	}
+	if _, err := FixtureKey("echo", "/v1/unknown", []byte(`{}`)); err == nil {
+		t.Error("Expected an error for an unsupported endpoint")
+	}
+}
+
+func TestFixtureStore(t *testing.T) {
+	store, err := NewFixtureStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.Lookup("missing"); !errors.Is(err, ErrFixtureNotFound) {
+		t.Errorf("Expected ErrFixtureNotFound, got %v", err)
+	}
+	for _, model := range []string{"second", "first"} {
+		fixture, err := NewFixture(model, "/engines/v1/embeddings", []byte(`{"input":"x"}`), []byte(`{"data":[]}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := store.Save(fixture); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	fixtures, err := store.List()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fixtures) != 2 || fixtures[0].Model != "ai/first:latest" || fixtures[1].Endpoint != "/v1/embeddings" {
+		t.Fatalf("Unexpected fixtures %+v", fixtures)
+	}
+	fixture, err := store.Lookup(fixtures[1].Key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var response bytes.Buffer
+	if err := json.Compact(&response, fixture.Response); err != nil || response.String() != `{"data":[]}` {
+		t.Errorf("Unexpected response %s", fixture.Response)
+	}
+}
+
+func TestServeFixture(t *testing.T) {
+	store, err := NewFixtureStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fixture, err := NewFixture("echo", "/v1/chat/completions",
+		[]byte(`{"messages":[{"role":"user","content":"Hi"}]}`),
+		[]byte(`{"choices":[{"message":{"role":"assistant","content":"Recorded reply"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":2}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := store.Save(fixture); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	backend := newTestBackend(t, &Config{Models: map[string]ModelConfig{
+		"echo":   {Default: "templated"},
+		"strict": {FixturesOnly: true},
+	}})
+
+	handler := newServer("ai/echo", backend.lookup("echo"), store)
+	recorder := serve(t, handler, "/v1/chat/completions", `{"messages":[{"role":"user","content":"Hi"}]}`)
+	if recorder.Header().Get(FixtureHeader) != "hit" || !strings.Contains(recorder.Body.String(), "Recorded reply") {
+		t.Errorf("Expected the fixture to be served, got %s", recorder.Body.String())
+	}
+	recorder = serve(t, handler, "/v1/chat/completions", `{"stream":true,"messages":[{"role":"user","content":"Hi"}]}`)
+	if body := recorder.Body.String(); !strings.Contains(body, `"content":"Recorded"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("Expected the fixture to be streamed, got %q", body)
+	}
+	recorder = serve(t, handler, "/v1/chat/completions", `{"messages":[{"role":"user","content":"Bye"}]}`)
+	if recorder.Header().Get(FixtureHeader) != "miss" || !strings.Contains(recorder.Body.String(), "templated") {
+		t.Errorf("Expected the templated response, got %s", recorder.Body.String())
+	}
+
+	handler = newServer("ai/strict", backend.lookup("strict"), store)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[]}`)))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
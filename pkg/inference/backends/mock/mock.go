@@ -0,0 +1,154 @@
+// Package mock implements an inference backend that serves canned or
+// templated responses instantly, without loading any model, so that
+// integration tests of applications using the model runner can run without
+// GPUs or model downloads.
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/logging"
+)
+
+const (
+	// Name is the backend name.
+	Name = "mock"
+
+	// shutdownTimeout is the time allowed for in-flight requests to complete
+	// once a runner is stopped.
+	shutdownTimeout = 5 * time.Second
+)
+
+// Backend is the mock backend implementation. Unlike other backends, it
+// serves models that aren't managed by the shared model manager.
+type Backend struct {
+	// log is the associated logger.
+	log logging.Logger
+	// models are the compiled configurations of the mocked models, in order
+	// of precedence.
+	models []*compiledModel
+	// fixtures holds the recorded responses served in preference to the
+	// models' configured responses. It may be nil.
+	fixtures *FixtureStore
+}
+
+// New creates a new mock backend serving the models in its configuration.
+func New(log logging.Logger, conf *Config) (*Backend, error) {
+	if conf == nil {
+		conf = &Config{}
+	}
+	compiled, err := conf.compile()
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{log: log, models: compiled}, nil
+}
+
+// SetFixtureStore sets the store of fixtures served in preference to the
+// models' configured responses. It must be called before any runner starts.
+func (b *Backend) SetFixtureStore(fixtures *FixtureStore) {
+	b.fixtures = fixtures
+}
+
+// ServesModel returns whether the backend mocks a model, in which case
+// requests for the model should be served by the backend.
+func (b *Backend) ServesModel(model string) bool {
+	return b.lookup(model) != nil
+}
+
+// lookup returns the configuration of a mocked model, or nil if the model
+// isn't mocked.
+func (b *Backend) lookup(model string) *compiledModel {
+	normalized := models.NormalizeModelName(model)
+	for _, compiled := range b.models {
+		if compiled.matches(normalized) {
+			return compiled
+		}
+	}
+	return nil
+}
+
+// Name implements inference.Backend.Name.
+func (b *Backend) Name() string {
+	return Name
+}
+
+// UsesExternalModelManagement implements
+// inference.Backend.UsesExternalModelManagement. Mocked models don't need to
+// be pulled.
+func (b *Backend) UsesExternalModelManagement() bool {
+	return true
+}
+
+// Install implements inference.Backend.Install. There's nothing to install.
+func (b *Backend) Install(_ context.Context, _ *http.Client) error {
+	return nil
+}
+
+// Run implements inference.Backend.Run, serving the mocked model's responses
+// on the socket until ctx is cancelled.
+func (b *Backend) Run(ctx context.Context, socket, model string, modelRef string, mode inference.BackendMode, _ *inference.BackendConfiguration) error {
+	compiled := b.lookup(modelRef)
+	if compiled == nil {
+		if compiled = b.lookup(model); compiled == nil {
+			return fmt.Errorf("model %s isn't mocked", modelRef)
+		}
+	}
+
+	if err := os.RemoveAll(socket); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		b.log.Warnf("failed to remove socket file %s: %v", socket, err)
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("unable to listen on socket: %w", err)
+	}
+
+	b.log.Infof("Serving mock model %s in %s mode", modelRef, mode)
+	server := &http.Server{
+		Handler:           newServer(modelRef, compiled, b.fixtures),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serverErrors := make(chan error, 1)
+	go func() {
+		serverErrors <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serverErrors:
+		return fmt.Errorf("mock server failed: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			server.Close()
+		}
+		return nil
+	}
+}
+
+// Status implements inference.Backend.Status.
+func (b *Backend) Status() string {
+	return fmt.Sprintf("running, mocking %d models", len(b.models))
+}
+
+// GetDiskUsage implements inference.Backend.GetDiskUsage. Mocked models don't
+// use any disk.
+func (b *Backend) GetDiskUsage() (int64, error) {
+	return 0, nil
+}
+
+// GetRequiredMemoryForModel implements
+// inference.Backend.GetRequiredMemoryForModel. Mocked models don't use any
+// memory.
+func (b *Backend) GetRequiredMemoryForModel(_ context.Context, _ string, _ *inference.BackendConfiguration) (inference.RequiredMemory, error) {
+	return inference.RequiredMemory{}, nil
+}
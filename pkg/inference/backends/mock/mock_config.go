@@ -0,0 +1,200 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+const (
+	// defaultResponse is the response template of models that don't specify
+	// one.
+	defaultResponse = "This is a mock response from {{.Model}}."
+	// defaultEmbeddingDimensions is the number of dimensions of the embeddings
+	// of models that don't specify one.
+	defaultEmbeddingDimensions = 16
+	// maximumEmbeddingDimensions is the largest number of embedding
+	// dimensions that can be configured.
+	maximumEmbeddingDimensions = 8192
+)
+
+// Config is the configuration for the mock backend.
+type Config struct {
+	// Models maps model references, or patterns matched against normalized
+	// model references (e.g. "mock/*"), to their configurations.
+	Models map[string]ModelConfig `json:"models"`
+}
+
+// ModelConfig configures the responses of a mock model.
+type ModelConfig struct {
+	// Responses are the responses to prompts matching their patterns, the
+	// first matching one of which is returned.
+	Responses []Response `json:"responses,omitempty"`
+	// Default is the response to prompts that don't match any pattern.
+	Default string `json:"default,omitempty"`
+	// EmbeddingDimensions is the number of dimensions of the model's
+	// embeddings.
+	EmbeddingDimensions int `json:"embedding_dimensions,omitempty"`
+	// FixturesOnly makes requests that don't match a fixture fail, rather
+	// than be served with the model's responses.
+	FixturesOnly bool `json:"fixtures_only,omitempty"`
+}
+
+// Response is a canned response. Its content is a Go template, executed with
+// the request's Model, Prompt (the last user message or completion prompt),
+// and Messages.
+type Response struct {
+	// Match is a regular expression matched against the prompt.
+	Match   string `json:"match"`
+	Content string `json:"content"`
+}
+
+// NewDefaultConfig creates a configuration that serves the models matching
+// patterns with the default response.
+func NewDefaultConfig(patterns []string) *Config {
+	config := &Config{Models: make(map[string]ModelConfig, len(patterns))}
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			config.Models[pattern] = ModelConfig{}
+		}
+	}
+	return config
+}
+
+// LoadConfig reads the configuration in the file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read mock configuration: %w", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid mock configuration: %w", err)
+	}
+	return &config, nil
+}
+
+// compiledResponse is a response with its pattern and template compiled.
+type compiledResponse struct {
+	match   *regexp.Regexp
+	content *template.Template
+}
+
+// compiledModel is a model configuration with its patterns and templates
+// compiled.
+type compiledModel struct {
+	// pattern is the normalized model reference or pattern.
+	pattern             string
+	responses           []compiledResponse
+	fallback            *template.Template
+	embeddingDimensions int
+	fixturesOnly        bool
+}
+
+// compile validates the configuration and compiles its patterns and
+// templates. Exact model references take precedence over patterns, which are
+// otherwise matched in lexical order.
+func (c *Config) compile() ([]*compiledModel, error) {
+	var exact, patterns []*compiledModel
+	for pattern, modelConfig := range c.Models {
+		isPattern := strings.ContainsAny(pattern, "*?[")
+		if isPattern {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid model pattern %q: %w", pattern, err)
+			}
+		} else {
+			pattern = models.NormalizeModelName(pattern)
+		}
+		compiled, err := modelConfig.compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+		if isPattern {
+			patterns = append(patterns, compiled)
+		} else {
+			exact = append(exact, compiled)
+		}
+	}
+	byPattern := func(a, b *compiledModel) int {
+		return strings.Compare(a.pattern, b.pattern)
+	}
+	slices.SortFunc(exact, byPattern)
+	slices.SortFunc(patterns, byPattern)
+	return append(exact, patterns...), nil
+}
+
+// compile validates the model configuration and compiles its patterns and
+// templates.
+func (c ModelConfig) compile(pattern string) (*compiledModel, error) {
+	compiled := &compiledModel{pattern: pattern, embeddingDimensions: c.EmbeddingDimensions, fixturesOnly: c.FixturesOnly}
+	if compiled.embeddingDimensions == 0 {
+		compiled.embeddingDimensions = defaultEmbeddingDimensions
+	} else if compiled.embeddingDimensions < 0 || compiled.embeddingDimensions > maximumEmbeddingDimensions {
+		return nil, fmt.Errorf("embedding_dimensions must be between 1 and %d", maximumEmbeddingDimensions)
+	}
+	for i, response := range c.Responses {
+		match, err := regexp.Compile(response.Match)
+		if err != nil {
+			return nil, fmt.Errorf("response %d: invalid match: %w", i, err)
+		}
+		content, err := template.New("response").Parse(response.Content)
+		if err != nil {
+			return nil, fmt.Errorf("response %d: invalid content: %w", i, err)
+		}
+		compiled.responses = append(compiled.responses, compiledResponse{match: match, content: content})
+	}
+	fallback := c.Default
+	if fallback == "" {
+		fallback = defaultResponse
+	}
+	var err error
+	if compiled.fallback, err = template.New("default").Parse(fallback); err != nil {
+		return nil, fmt.Errorf("invalid default: %w", err)
+	}
+	return compiled, nil
+}
+
+// matches returns whether the compiled model serves a normalized model
+// reference.
+func (c *compiledModel) matches(model string) bool {
+	if matched, _ := path.Match(c.pattern, model); matched {
+		return true
+	}
+	return c.pattern == model
+}
+
+// respond renders the response to a prompt.
+func (c *compiledModel) respond(data templateData) (string, error) {
+	content := c.fallback
+	for _, response := range c.responses {
+		if response.match.MatchString(data.Prompt) {
+			content = response.content
+			break
+		}
+	}
+	var rendered strings.Builder
+	if err := content.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("unable to render response: %w", err)
+	}
+	return rendered.String(), nil
+}
+
+// templateData is the data with which response templates are executed.
+type templateData struct {
+	Model    string
+	Prompt   string
+	Messages []Message
+}
+
+// Message is a chat message.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
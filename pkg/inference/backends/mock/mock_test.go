@@ -0,0 +1,187 @@
+package mock
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestBackend(t *testing.T, config *Config) *Backend {
+	t.Helper()
+	backend, err := New(logrus.NewEntry(logrus.New()), config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return backend
+}
+
+func TestServesModel(t *testing.T) {
+	backend := newTestBackend(t, &Config{Models: map[string]ModelConfig{
+		"echo":   {Default: "exact"},
+		"mock/*": {Default: "pattern"},
+	}})
+	tests := []struct {
+		model    string
+		expected string
+	}{
+		{model: "echo", expected: "exact"},
+		{model: "ai/echo:latest", expected: "exact"},
+		{model: "mock/anything", expected: "pattern"},
+		{model: "mock/anything:v2", expected: "pattern"},
+		{model: "ai/smollm2"},
+	}
+	for _, test := range tests {
+		compiled := backend.lookup(test.model)
+		if test.expected == "" {
+			if compiled != nil || backend.ServesModel(test.model) {
+				t.Errorf("Expected %s not to be mocked", test.model)
+			}
+			continue
+		}
+		if compiled == nil {
+			t.Errorf("Expected %s to be mocked", test.model)
+			continue
+		}
+		if response, _ := compiled.respond(templateData{}); response != test.expected {
+			t.Errorf("Expected %s to be served by %q, got %q", test.model, test.expected, response)
+		}
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	for _, config := range []*Config{
+		{Models: map[string]ModelConfig{"mock/[": {}}},
+		{Models: map[string]ModelConfig{"echo": {Responses: []Response{{Match: "(", Content: "x"}}}}},
+		{Models: map[string]ModelConfig{"echo": {Default: "{{.Missing"}}},
+		{Models: map[string]ModelConfig{"echo": {EmbeddingDimensions: -1}}},
+	} {
+		if _, err := New(logrus.NewEntry(logrus.New()), config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	content := "one two\nthree four"
+	if truncated, reason := truncate(content, 0); truncated != content || reason != "stop" {
+		t.Errorf("Expected untruncated content, got %q (%s)", truncated, reason)
+	}
+	if truncated, reason := truncate(content, 3); truncated != "one two\nthree" || reason != "length" {
+		t.Errorf("Expected truncated content, got %q (%s)", truncated, reason)
+	}
+	if joined := strings.Join(tokens(content), ""); joined != content {
+		t.Errorf("Expected tokens to reassemble content, got %q", joined)
+	}
+}
+
+func serve(t *testing.T, handler http.Handler, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	return recorder
+}
+
+func TestChatCompletions(t *testing.T) {
+	backend := newTestBackend(t, &Config{Models: map[string]ModelConfig{
+		"echo": {Responses: []Response{{Match: "(?i)weather", Content: "It's sunny."}}, Default: "You said: {{.Prompt}}"},
+	}})
+	handler := newServer("ai/echo", backend.lookup("echo"), nil)
+
+	recorder := serve(t, handler, "/v1/chat/completions", `{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":[{"type":"text","text":"Hello there"}]}]}`)
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if len(response.Choices) != 1 || response.Choices[0].Message.Content != "You said: Hello there" || response.Usage.CompletionTokens != 4 {
+		t.Errorf("Unexpected response %s", recorder.Body.String())
+	}
+
+	recorder = serve(t, handler, "/v1/chat/completions", `{"stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"What's the weather?"}]}`)
+	body := recorder.Body.String()
+	var content strings.Builder
+	for _, line := range strings.Split(body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("Invalid chunk %q: %v", data, err)
+		}
+		if len(chunk.Choices) > 0 {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if content.String() != "It's sunny." || !strings.HasSuffix(body, "data: [DONE]\n\n") || !strings.Contains(body, `"usage"`) {
+		t.Errorf("Unexpected stream %q", body)
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	backend := newTestBackend(t, &Config{Models: map[string]ModelConfig{"embed": {EmbeddingDimensions: 4}}})
+	handler := newServer("ai/embed", backend.lookup("embed"), nil)
+
+	recorder := serve(t, handler, "/v1/embeddings", `{"input":["a","b","a"]}`)
+	var response struct {
+		Data []struct {
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if len(response.Data) != 3 {
+		t.Fatalf("Expected 3 embeddings, got %d", len(response.Data))
+	}
+	var norm float64
+	for i, value := range response.Data[0].Embedding {
+		norm += value * value
+		if value != response.Data[2].Embedding[i] {
+			t.Error("Expected identical inputs to have identical embeddings")
+		}
+	}
+	if len(response.Data[0].Embedding) != 4 || math.Abs(norm-1) > 1e-9 {
+		t.Errorf("Expected a 4-dimensional unit vector, got %v", response.Data[0].Embedding)
+	}
+}
+
+func TestRerank(t *testing.T) {
+	backend := newTestBackend(t, NewDefaultConfig([]string{"rerank"}))
+	handler := newServer("ai/rerank", backend.lookup("rerank"), nil)
+
+	recorder := serve(t, handler, "/rerank", `{"query":"red apple","documents":["a banana","a red apple","an apple"],"top_n":2}`)
+	var response struct {
+		Results []struct {
+			Index int `json:"index"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if len(response.Results) != 2 || response.Results[0].Index != 1 || response.Results[1].Index != 2 {
+		t.Errorf("Unexpected results %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,517 @@
+package mock
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maximumRequestSize is the maximum size of a request to a mock model.
+const maximumRequestSize = 16 * 1024 * 1024
+
+// server serves a mocked model's OpenAI-compatible API.
+type server struct {
+	model    string
+	compiled *compiledModel
+	// fixtures holds the recorded responses served in preference to
+	// templated ones. It may be nil.
+	fixtures *FixtureStore
+	// requests counts requests, to generate response IDs.
+	requests atomic.Uint64
+}
+
+// newServer creates a handler serving a mocked model.
+func newServer(model string, compiled *compiledModel, fixtures *FixtureStore) http.Handler {
+	s := &server{model: model, compiled: compiled, fixtures: fixtures}
+	router := http.NewServeMux()
+	router.HandleFunc("GET /v1/models", s.handleModels)
+	router.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
+	router.HandleFunc("POST /v1/completions", s.handleCompletions)
+	router.HandleFunc("POST /v1/embeddings", s.handleEmbeddings)
+	router.HandleFunc("POST /rerank", s.handleRerank)
+	router.HandleFunc("POST /score", s.handleScore)
+	return router
+}
+
+// decode decodes a JSON request body to an endpoint, responding with an
+// error if it's invalid. If a fixture matches the request, it's served
+// instead, and false is returned.
+func (s *server) decode(w http.ResponseWriter, r *http.Request, endpoint string, request any) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maximumRequestSize))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return false
+	}
+	if s.serveFixture(w, endpoint, body) {
+		return false
+	}
+	if s.compiled.fixturesOnly {
+		http.Error(w, fmt.Sprintf("no fixture matches the request to %s", s.model), http.StatusNotFound)
+		return false
+	}
+	if err := json.Unmarshal(body, request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// serveFixture serves the fixture matching a request to an endpoint, if any,
+// returning whether it did. Streamed chat completion and completion requests
+// are served by streaming the content of the fixture's response.
+func (s *server) serveFixture(w http.ResponseWriter, endpoint string, body []byte) bool {
+	if s.fixtures == nil {
+		return false
+	}
+	key, err := FixtureKey(s.model, endpoint, body)
+	if err != nil {
+		return false
+	}
+	fixture, err := s.fixtures.Lookup(key)
+	if err != nil {
+		w.Header().Set(FixtureHeader, "miss")
+		return false
+	}
+	w.Header().Set(FixtureHeader, "hit")
+
+	var request generationRequest
+	json.Unmarshal(body, &request)
+	if !request.Stream || (endpoint != "/v1/chat/completions" && endpoint != "/v1/completions") {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(fixture.Response)
+		return true
+	}
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			Text         string `json:"text"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	json.Unmarshal(fixture.Response, &response)
+	content, finishReason := "", "stop"
+	if len(response.Choices) > 0 {
+		content = response.Choices[0].Message.Content + response.Choices[0].Text
+		if response.Choices[0].FinishReason != "" {
+			finishReason = response.Choices[0].FinishReason
+		}
+	}
+	if endpoint == "/v1/chat/completions" {
+		s.streamChatCompletion(w, &request, content, finishReason, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+	} else {
+		s.streamCompletion(w, &request, content, finishReason, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+	}
+	return true
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// nextID returns the ID of a response with the specified prefix.
+func (s *server) nextID(prefix string) string {
+	return fmt.Sprintf("%s-mock-%d", prefix, s.requests.Add(1))
+}
+
+func (s *server) handleModels(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{
+		"object": "list",
+		"data":   []map[string]any{{"id": s.model, "object": "model", "owned_by": Name}},
+	})
+}
+
+// text is message content, either a string or an array of content parts, of
+// which only the text parts are kept.
+type text string
+
+func (t *text) UnmarshalJSON(data []byte) error {
+	var content string
+	if err := json.Unmarshal(data, &content); err == nil {
+		*t = text(content)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of content parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	*t = text(strings.Join(texts, "\n"))
+	return nil
+}
+
+// texts is a string or an array of strings.
+type texts []string
+
+func (t *texts) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = texts{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("input must be a string or an array of strings")
+	}
+	*t = multiple
+	return nil
+}
+
+// generationRequest holds the options common to chat completion and
+// completion requests.
+type generationRequest struct {
+	Stream        bool `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	MaxTokens           int `json:"max_tokens"`
+	MaxCompletionTokens int `json:"max_completion_tokens"`
+}
+
+// limit returns the maximum number of tokens to generate, or zero if it's
+// unlimited.
+func (r *generationRequest) limit() int {
+	if r.MaxCompletionTokens > 0 {
+		return r.MaxCompletionTokens
+	}
+	return r.MaxTokens
+}
+
+// includeUsage returns whether a streamed response should include usage.
+func (r *generationRequest) includeUsage() bool {
+	return r.StreamOptions != nil && r.StreamOptions.IncludeUsage
+}
+
+// tokens splits content into tokens, each of which is a word with its
+// preceding whitespace.
+func tokens(content string) []string {
+	var result []string
+	start := 0
+	for i := 1; i <= len(content); i++ {
+		if i == len(content) || (content[i] == ' ' || content[i] == '\n') && content[i-1] != ' ' && content[i-1] != '\n' {
+			if i > start {
+				result = append(result, content[start:i])
+			}
+			start = i
+		}
+	}
+	return result
+}
+
+// truncate limits content to the specified number of tokens, returning the
+// truncated content and its finish reason.
+func truncate(content string, limit int) (string, string) {
+	if limit <= 0 {
+		return content, "stop"
+	}
+	parts := tokens(content)
+	if len(parts) <= limit {
+		return content, "stop"
+	}
+	return strings.Join(parts[:limit], ""), "length"
+}
+
+// countTokens approximates the number of tokens in texts by counting words.
+func countTokens(texts ...string) int {
+	var count int
+	for _, text := range texts {
+		count += len(strings.Fields(text))
+	}
+	return count
+}
+
+// usage reports token usage.
+func usage(promptTokens, completionTokens int) map[string]int {
+	return map[string]int{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      promptTokens + completionTokens,
+	}
+}
+
+func (s *server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		generationRequest
+		Messages []struct {
+			Role    string `json:"role"`
+			Content text   `json:"content"`
+		} `json:"messages"`
+	}
+	if !s.decode(w, r, "/v1/chat/completions", &request) {
+		return
+	}
+	data := templateData{Model: s.model}
+	var prompts []string
+	for _, message := range request.Messages {
+		data.Messages = append(data.Messages, Message{Role: message.Role, Content: string(message.Content)})
+		prompts = append(prompts, string(message.Content))
+		if message.Role == "user" {
+			data.Prompt = string(message.Content)
+		}
+	}
+	content, err := s.compiled.respond(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content, finishReason := truncate(content, request.limit())
+	promptTokens, completionTokens := countTokens(prompts...), len(tokens(content))
+
+	if request.Stream {
+		s.streamChatCompletion(w, &request.generationRequest, content, finishReason, promptTokens, completionTokens)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"id":      s.nextID("chatcmpl"),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   s.model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": content},
+			"finish_reason": finishReason,
+		}},
+		"usage": usage(promptTokens, completionTokens),
+	})
+}
+
+// streamChatCompletion streams a chat completion's content, one token per
+// event.
+func (s *server) streamChatCompletion(w http.ResponseWriter, request *generationRequest, content, finishReason string, promptTokens, completionTokens int) {
+	id, created := s.nextID("chatcmpl"), time.Now().Unix()
+	chunk := func(delta map[string]string, finishReason any) map[string]any {
+		return map[string]any{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   s.model,
+			"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+		}
+	}
+	events := []any{chunk(map[string]string{"role": "assistant", "content": ""}, nil)}
+	for _, token := range tokens(content) {
+		events = append(events, chunk(map[string]string{"content": token}, nil))
+	}
+	events = append(events, chunk(map[string]string{}, finishReason))
+	if request.includeUsage() {
+		events = append(events, map[string]any{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   s.model,
+			"choices": []any{},
+			"usage":   usage(promptTokens, completionTokens),
+		})
+	}
+	stream(w, events)
+}
+
+func (s *server) handleCompletions(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		generationRequest
+		Prompt texts `json:"prompt"`
+	}
+	if !s.decode(w, r, "/v1/completions", &request) {
+		return
+	}
+	prompt := strings.Join(request.Prompt, "\n")
+	content, err := s.compiled.respond(templateData{Model: s.model, Prompt: prompt})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content, finishReason := truncate(content, request.limit())
+	promptTokens, completionTokens := countTokens(prompt), len(tokens(content))
+
+	if request.Stream {
+		s.streamCompletion(w, &request.generationRequest, content, finishReason, promptTokens, completionTokens)
+		return
+	}
+	response := s.completion(s.nextID("cmpl"), time.Now().Unix(), content, finishReason)
+	response["usage"] = usage(promptTokens, completionTokens)
+	writeJSON(w, response)
+}
+
+// completion returns a completion response or chunk.
+func (s *server) completion(id string, created int64, text string, finishReason any) map[string]any {
+	return map[string]any{
+		"id":      id,
+		"object":  "text_completion",
+		"created": created,
+		"model":   s.model,
+		"choices": []map[string]any{{"index": 0, "text": text, "finish_reason": finishReason}},
+	}
+}
+
+// streamCompletion streams a completion's content, one token per event.
+func (s *server) streamCompletion(w http.ResponseWriter, request *generationRequest, content, finishReason string, promptTokens, completionTokens int) {
+	id, created := s.nextID("cmpl"), time.Now().Unix()
+	var events []any
+	for _, token := range tokens(content) {
+		events = append(events, s.completion(id, created, token, nil))
+	}
+	events = append(events, s.completion(id, created, "", finishReason))
+	if request.includeUsage() {
+		final := s.completion(id, created, "", nil)
+		final["choices"] = []any{}
+		final["usage"] = usage(promptTokens, completionTokens)
+		events = append(events, final)
+	}
+	stream(w, events)
+}
+
+// stream writes events as a stream of server-sent events terminated by
+// [DONE].
+func stream(w http.ResponseWriter, events []any) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// embed returns a deterministic unit vector derived from the hash of input, so
+// that identical inputs have identical embeddings.
+func embed(input string, dimensions int) []float64 {
+	embedding := make([]float64, dimensions)
+	var norm float64
+	for i := range embedding {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", i, input)))
+		value := float64(binary.BigEndian.Uint64(hash[:8]))/math.MaxUint64*2 - 1
+		embedding[i] = value
+		norm += value * value
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for i := range embedding {
+			embedding[i] /= norm
+		}
+	}
+	return embedding
+}
+
+func (s *server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Input texts `json:"input"`
+	}
+	if !s.decode(w, r, "/v1/embeddings", &request) {
+		return
+	}
+	data := make([]map[string]any, len(request.Input))
+	for i, input := range request.Input {
+		data[i] = map[string]any{"object": "embedding", "index": i, "embedding": embed(input, s.compiled.embeddingDimensions)}
+	}
+	promptTokens := countTokens(request.Input...)
+	writeJSON(w, map[string]any{
+		"object": "list",
+		"data":   data,
+		"model":  s.model,
+		"usage":  map[string]int{"prompt_tokens": promptTokens, "total_tokens": promptTokens},
+	})
+}
+
+// relevance scores a document's relevance to a query by the fraction of the
+// query's words that it contains.
+func relevance(query, document string) float64 {
+	queryWords := strings.Fields(strings.ToLower(query))
+	if len(queryWords) == 0 {
+		return 0
+	}
+	documentWords := strings.Fields(strings.ToLower(document))
+	var matches int
+	for _, word := range queryWords {
+		if slices.Contains(documentWords, word) {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(queryWords))
+}
+
+func (s *server) handleRerank(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Query     string   `json:"query"`
+		Documents []string `json:"documents"`
+		TopN      int      `json:"top_n"`
+	}
+	if !s.decode(w, r, "/rerank", &request) {
+		return
+	}
+	type result struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	}
+	results := make([]result, len(request.Documents))
+	for i, document := range request.Documents {
+		results[i] = result{Index: i, RelevanceScore: relevance(request.Query, document)}
+	}
+	slices.SortStableFunc(results, func(a, b result) int {
+		switch {
+		case a.RelevanceScore > b.RelevanceScore:
+			return -1
+		case a.RelevanceScore < b.RelevanceScore:
+			return 1
+		}
+		return 0
+	})
+	if request.TopN > 0 && request.TopN < len(results) {
+		results = results[:request.TopN]
+	}
+	writeJSON(w, map[string]any{
+		"model":   s.model,
+		"results": results,
+		"usage":   map[string]int{"prompt_tokens": countTokens(append(request.Documents, request.Query)...)},
+	})
+}
+
+func (s *server) handleScore(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Text1 string `json:"text_1"`
+		Text2 texts  `json:"text_2"`
+	}
+	if !s.decode(w, r, "/score", &request) {
+		return
+	}
+	data := make([]map[string]any, len(request.Text2))
+	for i, text := range request.Text2 {
+		data[i] = map[string]any{"index": i, "object": "score", "score": relevance(request.Text1, text)}
+	}
+	writeJSON(w, map[string]any{
+		"id":     s.nextID("score"),
+		"object": "list",
+		"model":  s.model,
+		"data":   data,
+	})
+}
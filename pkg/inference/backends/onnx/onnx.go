@@ -0,0 +1,182 @@
+package onnx
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends"
+	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/logging"
+)
+
+const (
+	// Name is the backend name.
+	Name = "onnx"
+)
+
+var ErrStatusNotFound = errors.New("Python or ONNX Runtime not found")
+
+// serverScript is the Python script serving ONNX sequence classification
+// models, which is written to the backend's directory on installation.
+//
+//go:embed server.py
+var serverScript []byte
+
+// onnx is the ONNX Runtime-based backend implementation. It only serves
+// sequence classification models, in classification mode.
+type onnx struct {
+	// log is the associated logger.
+	log logging.Logger
+	// modelManager is the shared model manager.
+	modelManager *models.Manager
+	// serverLog is the logger to use for the ONNX server process.
+	serverLog logging.Logger
+	// config is the configuration for the ONNX backend.
+	config *Config
+	// status is the state in which the ONNX backend is in.
+	status string
+	// pythonPath is the path to the python3 binary.
+	pythonPath string
+	// scriptPath is the path to which the server script is written.
+	scriptPath string
+}
+
+// New creates a new ONNX Runtime-based backend.
+func New(log logging.Logger, modelManager *models.Manager, serverLog logging.Logger, conf *Config) (inference.Backend, error) {
+	// If no config is provided, use the default configuration
+	if conf == nil {
+		conf = NewDefaultONNXConfig()
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return &onnx{
+		log:          log,
+		modelManager: modelManager,
+		serverLog:    serverLog,
+		config:       conf,
+		status:       "not installed",
+		scriptPath:   filepath.Join(dir, "docker-model-runner", Name, "server.py"),
+	}, nil
+}
+
+// Name implements inference.Backend.Name.
+func (o *onnx) Name() string {
+	return Name
+}
+
+// UsesExternalModelManagement implements
+// inference.Backend.UsesExternalModelManagement.
+func (o *onnx) UsesExternalModelManagement() bool {
+	return false
+}
+
+// Install implements inference.Backend.Install.
+func (o *onnx) Install(ctx context.Context, _ *http.Client) error {
+	// Check if Python 3 is available
+	pythonPath, err := exec.LookPath("python3")
+	if err != nil {
+		o.status = ErrStatusNotFound.Error()
+		return ErrStatusNotFound
+	}
+	o.pythonPath = pythonPath
+
+	// Check if the packages used by the server script are installed by
+	// attempting to import them
+	cmd := exec.CommandContext(ctx, pythonPath, "-c", "import numpy, onnxruntime, tokenizers")
+	if err := cmd.Run(); err != nil {
+		o.status = "onnxruntime packages not installed"
+		o.log.Warnf("onnxruntime packages not found. Install with: pip install onnxruntime tokenizers numpy")
+		return fmt.Errorf("onnxruntime packages not installed: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(o.scriptPath), 0o755); err != nil {
+		return fmt.Errorf("creating ONNX server directory: %w", err)
+	}
+	if err := os.WriteFile(o.scriptPath, serverScript, 0o644); err != nil {
+		return fmt.Errorf("writing ONNX server script: %w", err)
+	}
+
+	// Get ONNX Runtime version
+	cmd = exec.CommandContext(ctx, pythonPath, "-c", "import onnxruntime; print(onnxruntime.__version__)")
+	output, err := cmd.Output()
+	if err != nil {
+		o.log.Warnf("could not get ONNX Runtime version: %v", err)
+		o.status = "running ONNX Runtime version: unknown"
+	} else {
+		o.status = fmt.Sprintf("running ONNX Runtime version: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// Run implements inference.Backend.Run.
+func (o *onnx) Run(ctx context.Context, socket, model string, modelRef string, mode inference.BackendMode, backendConfig *inference.BackendConfiguration) error {
+	bundle, err := o.modelManager.GetBundle(model)
+	if err != nil {
+		return fmt.Errorf("failed to get model: %w", err)
+	}
+
+	args, err := o.config.GetArgs(bundle, socket, mode, backendConfig)
+	if err != nil {
+		return fmt.Errorf("failed to get ONNX arguments: %w", err)
+	}
+
+	// Run the server script, and add served model name
+	args = append([]string{o.scriptPath}, args...)
+	args = append(args, "--served-model-name", model, modelRef)
+
+	return backends.RunBackend(ctx, backends.RunnerConfig{
+		BackendName:     "ONNX",
+		Socket:          socket,
+		BinaryPath:      o.pythonPath,
+		SandboxPath:     "",
+		SandboxConfig:   "",
+		Args:            args,
+		Logger:          o.log,
+		ServerLogWriter: o.serverLog.Writer(),
+	})
+}
+
+func (o *onnx) Status() string {
+	return o.status
+}
+
+func (o *onnx) GetDiskUsage() (int64, error) {
+	// ONNX Runtime is installed via pip in the system Python environment, so
+	// only the server script is accounted for
+	info, err := os.Stat(o.scriptPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error while getting server script size: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// GetRequiredMemoryForModel implements
+// inference.Backend.GetRequiredMemoryForModel. Models run on the CPU, and
+// their weights are loaded into RAM.
+func (o *onnx) GetRequiredMemoryForModel(_ context.Context, model string, _ *inference.BackendConfiguration) (inference.RequiredMemory, error) {
+	bundle, err := o.modelManager.GetBundle(model)
+	if err != nil {
+		return inference.RequiredMemory{}, fmt.Errorf("failed to get model: %w", err)
+	}
+	info, err := os.Stat(bundle.ONNXPath())
+	if err != nil {
+		return inference.RequiredMemory{}, fmt.Errorf("failed to get model size: %w", err)
+	}
+	return inference.RequiredMemory{RAM: uint64(info.Size())}, nil
+}
@@ -0,0 +1,75 @@
+package onnx
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+// Config is the configuration for the ONNX backend.
+type Config struct {
+	// Args are the base arguments that are always included.
+	Args []string
+}
+
+// NewDefaultONNXConfig creates a new Config with default values.
+func NewDefaultONNXConfig() *Config {
+	return &Config{
+		Args: []string{},
+	}
+}
+
+// GetArgs implements BackendConfig.GetArgs. The arguments are those of the
+// ONNX server script, which the backend runs with Python.
+func (c *Config) GetArgs(bundle types.ModelBundle, socket string, mode inference.BackendMode, config *inference.BackendConfiguration) ([]string, error) {
+	// Start with the arguments from Config
+	args := append([]string{}, c.Args...)
+
+	onnxPath := bundle.ONNXPath()
+	if onnxPath == "" {
+		return nil, fmt.Errorf("ONNX path required by ONNX backend")
+	}
+	// The tokenizer is unpacked next to the model from its config archive.
+	tokenizerPath := filepath.Join(filepath.Dir(onnxPath), "tokenizer.json")
+
+	// Add model, tokenizer, and socket arguments
+	args = append(args, "--model", onnxPath, "--tokenizer", tokenizerPath, "--socket", socket)
+
+	// The ONNX backend only serves sequence classification models.
+	switch mode {
+	case inference.BackendModeClassification:
+	case inference.BackendModeCompletion, inference.BackendModeEmbedding, inference.BackendModeReranking:
+		return nil, fmt.Errorf("%s mode not supported by ONNX backend", mode)
+	default:
+		return nil, fmt.Errorf("unsupported backend mode %q", mode)
+	}
+
+	// Add max-length if specified in model config or backend config
+	if maxLen := GetMaxLength(bundle.RuntimeConfig(), config); maxLen != nil {
+		args = append(args, "--max-length", strconv.FormatUint(*maxLen, 10))
+	}
+
+	// Add arguments from backend config
+	if config != nil {
+		args = append(args, config.RuntimeFlags...)
+	}
+
+	return args, nil
+}
+
+// GetMaxLength returns the maximum number of tokens of an input from model
+// config or backend config. Model config takes precedence over backend config.
+// Returns nil if neither is specified (the server's default is used).
+func GetMaxLength(modelCfg types.Config, backendCfg *inference.BackendConfiguration) *uint64 {
+	if modelCfg.ContextSize != nil {
+		return modelCfg.ContextSize
+	}
+	if backendCfg != nil && backendCfg.ContextSize > 0 {
+		val := uint64(backendCfg.ContextSize)
+		return &val
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package onnx
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+type mockModelBundle struct {
+	onnxPath      string
+	runtimeConfig types.Config
+}
+
+func (m *mockModelBundle) GGUFPath() string {
+	return ""
+}
+
+func (m *mockModelBundle) SafetensorsPath() string {
+	return ""
+}
+
+func (m *mockModelBundle) ONNXPath() string {
+	return m.onnxPath
+}
+
+func (m *mockModelBundle) ChatTemplatePath() string {
+	return ""
+}
+
+func (m *mockModelBundle) MMPROJPath() string {
+	return ""
+}
+
+func (m *mockModelBundle) LoRAPaths() []string {
+	return nil
+}
+
+func (m *mockModelBundle) RuntimeConfig() types.Config {
+	return m.runtimeConfig
+}
+
+func (m *mockModelBundle) RootDir() string {
+	return "/path/to/bundle"
+}
+
+func TestGetArgs(t *testing.T) {
+	contextSize := uint64(256)
+	tests := []struct {
+		name        string
+		mode        inference.BackendMode
+		config      *inference.BackendConfiguration
+		bundle      *mockModelBundle
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:        "empty ONNX path should error",
+			mode:        inference.BackendModeClassification,
+			bundle:      &mockModelBundle{},
+			expectError: true,
+		},
+		{
+			name:   "basic args",
+			mode:   inference.BackendModeClassification,
+			bundle: &mockModelBundle{onnxPath: "/path/to/model.onnx"},
+			expected: []string{
+				"--model", "/path/to/model.onnx",
+				"--tokenizer", "/path/to/tokenizer.json",
+				"--socket", "/tmp/socket",
+			},
+		},
+		{
+			name:   "with backend context size and runtime flags",
+			mode:   inference.BackendModeClassification,
+			bundle: &mockModelBundle{onnxPath: "/path/to/model.onnx"},
+			config: &inference.BackendConfiguration{
+				ContextSize:  512,
+				RuntimeFlags: []string{"--threads", "4"},
+			},
+			expected: []string{
+				"--model", "/path/to/model.onnx",
+				"--tokenizer", "/path/to/tokenizer.json",
+				"--socket", "/tmp/socket",
+				"--max-length", "512",
+				"--threads", "4",
+			},
+		},
+		{
+			name: "model context size takes precedence",
+			mode: inference.BackendModeClassification,
+			bundle: &mockModelBundle{
+				onnxPath:      "/path/to/model.onnx",
+				runtimeConfig: types.Config{ContextSize: &contextSize},
+			},
+			config: &inference.BackendConfiguration{ContextSize: 512},
+			expected: []string{
+				"--model", "/path/to/model.onnx",
+				"--tokenizer", "/path/to/tokenizer.json",
+				"--socket", "/tmp/socket",
+				"--max-length", "256",
+			},
+		},
+		{
+			name:        "completion mode should error",
+			mode:        inference.BackendModeCompletion,
+			bundle:      &mockModelBundle{onnxPath: "/path/to/model.onnx"},
+			expectError: true,
+		},
+		{
+			name:        "embedding mode should error",
+			mode:        inference.BackendModeEmbedding,
+			bundle:      &mockModelBundle{onnxPath: "/path/to/model.onnx"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := NewDefaultONNXConfig().GetArgs(tt.bundle, "/tmp/socket", tt.mode, tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected error, got args %v", args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(args, tt.expected) {
+				t.Errorf("Expected args %v, got %v", tt.expected, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+"""Serves an ONNX sequence classification model for Docker Model Runner.
+
+The model's outputs (logits) are served as OpenAI embeddings on a Unix domain
+socket, from which Docker Model Runner computes classification and moderation
+results.
+"""
+
+import argparse
+import json
+import os
+import socketserver
+from http.server import BaseHTTPRequestHandler
+
+import numpy as np
+import onnxruntime
+from tokenizers import Tokenizer
+
+# The NumPy types of the integer ONNX tensor types of model inputs.
+INPUT_TYPES = {"tensor(int64)": np.int64, "tensor(int32)": np.int32}
+
+
+class Server(socketserver.ThreadingMixIn, socketserver.UnixStreamServer):
+    daemon_threads = True
+
+
+class Classifier:
+    def __init__(self, model, tokenizer, max_length, threads):
+        options = onnxruntime.SessionOptions()
+        if threads > 0:
+            options.intra_op_num_threads = threads
+        self.session = onnxruntime.InferenceSession(model, options, providers=["CPUExecutionProvider"])
+        self.inputs = {i.name: INPUT_TYPES.get(i.type, np.int64) for i in self.session.get_inputs()}
+        self.tokenizer = Tokenizer.from_file(tokenizer)
+        self.tokenizer.enable_truncation(max_length=max_length)
+        self.tokenizer.enable_padding()
+
+    def classify(self, texts):
+        """Returns the logits of texts and the number of tokens classified."""
+        encodings = self.tokenizer.encode_batch(texts)
+        features = {
+            "input_ids": [e.ids for e in encodings],
+            "attention_mask": [e.attention_mask for e in encodings],
+            "token_type_ids": [e.type_ids for e in encodings],
+        }
+        feed = {name: np.array(features[name], dtype=dtype) for name, dtype in self.inputs.items() if name in features}
+        logits = self.session.run(None, feed)[0]
+        return logits.reshape(len(texts), -1), sum(sum(e.attention_mask) for e in encodings)
+
+
+def error(message):
+    return {"error": {"message": message}}
+
+
+def handler(classifier, served_model_names):
+    class Handler(BaseHTTPRequestHandler):
+        protocol_version = "HTTP/1.1"
+
+        def address_string(self):
+            # Clients of Unix domain sockets have no address.
+            return "unix"
+
+        def do_GET(self):
+            if self.path.rstrip("/").endswith("/v1/models"):
+                models = [{"id": name, "object": "model", "owned_by": "docker"} for name in served_model_names]
+                self.reply(200, {"object": "list", "data": models})
+            else:
+                self.reply(404, error("not found"))
+
+        def do_POST(self):
+            body = self.rfile.read(int(self.headers.get("Content-Length", 0)))
+            if not self.path.endswith("/v1/embeddings"):
+                self.reply(404, error("not found"))
+                return
+            try:
+                request = json.loads(body)
+            except ValueError:
+                self.reply(400, error("invalid request"))
+                return
+            model = request.get("model")
+            if served_model_names and model not in served_model_names:
+                self.reply(421, error(f"model {model} is not served"))
+                return
+            texts = request.get("input")
+            if isinstance(texts, str):
+                texts = [texts]
+            if not isinstance(texts, list) or not texts or not all(isinstance(t, str) for t in texts):
+                self.reply(400, error("input must be a string or an array of strings"))
+                return
+            try:
+                logits, tokens = classifier.classify(texts)
+            except Exception as e:  # noqa: BLE001 - reported to the client
+                self.reply(500, error(str(e)))
+                return
+            data = [{"object": "embedding", "index": i, "embedding": row.tolist()} for i, row in enumerate(logits)]
+            usage = {"prompt_tokens": int(tokens), "total_tokens": int(tokens)}
+            self.reply(200, {"object": "list", "data": data, "model": model, "usage": usage})
+
+        def reply(self, status, body):
+            data = json.dumps(body).encode()
+            self.send_response(status)
+            self.send_header("Content-Type", "application/json")
+            self.send_header("Content-Length", str(len(data)))
+            self.end_headers()
+            self.wfile.write(data)
+
+    return Handler
+
+
+def main():
+    parser = argparse.ArgumentParser(description=__doc__)
+    parser.add_argument("--model", required=True, help="path to the ONNX model")
+    parser.add_argument("--tokenizer", required=True, help="path to the model's tokenizer.json")
+    parser.add_argument("--socket", required=True, help="path to the Unix domain socket to listen on")
+    parser.add_argument("--max-length", type=int, default=512, help="maximum number of tokens per input")
+    parser.add_argument("--threads", type=int, default=0, help="number of threads (0 for ONNX Runtime's default)")
+    parser.add_argument("--served-model-name", nargs="*", default=[], help="names of the served model")
+    args = parser.parse_args()
+
+    classifier = Classifier(args.model, args.tokenizer, args.max_length, args.threads)
+    server = Server(args.socket, handler(classifier, args.served_model_name))
+    try:
+        server.serve_forever()
+    except KeyboardInterrupt:
+        pass
+    finally:
+        server.server_close()
+        if os.path.exists(args.socket):
+            os.remove(args.socket)
+
+
+if __name__ == "__main__":
+    main()
@@ -47,6 +47,8 @@ func (c *Config) GetArgs(bundle types.ModelBundle, socket string, mode inference
 	// vLLM doesn't have a specific embedding flag like llama.cpp
 	// Embedding models are detected automatically
 	case inference.BackendModeReranking:
+	case inference.BackendModeClassification:
+		return nil, fmt.Errorf("classification mode not supported by vLLM backend")
 	default:
 		return nil, fmt.Errorf("unsupported backend mode %q", mode)
 	}
@@ -57,6 +59,22 @@ func (c *Config) GetArgs(bundle types.ModelBundle, socket string, mode inference
 	}
 	// If nil, vLLM will automatically derive from the model config
 
+	// Add the maximum number of concurrently processed sequences
+	if config != nil && config.Parallelism > 0 {
+		args = append(args, "--max-num-seqs", strconv.Itoa(config.Parallelism))
+	}
+
+	// Quantize the KV cache
+	if config != nil {
+		switch config.KVCacheType {
+		case inference.KVCacheTypeDefault:
+		case inference.KVCacheTypeFP8:
+			args = append(args, "--kv-cache-dtype", "fp8")
+		default:
+			return nil, fmt.Errorf("unsupported KV cache type %q", config.KVCacheType)
+		}
+	}
+
 	// Add arguments from backend config
 	if config != nil {
 		args = append(args, config.RuntimeFlags...)
@@ -20,6 +20,10 @@ func (m *mockModelBundle) SafetensorsPath() string {
 	return m.safetensorsPath
 }
 
+func (m *mockModelBundle) ONNXPath() string {
+	return ""
+}
+
 func (m *mockModelBundle) ChatTemplatePath() string {
 	return ""
 }
@@ -28,6 +32,10 @@ func (m *mockModelBundle) MMPROJPath() string {
 	return ""
 }
 
+func (m *mockModelBundle) LoRAPaths() []string {
+	return nil
+}
+
 func (m *mockModelBundle) RuntimeConfig() types.Config {
 	return m.runtimeConfig
 }
@@ -83,6 +91,50 @@ func TestGetArgs(t *testing.T) {
 				"8192",
 			},
 		},
+		{
+			name: "with parallelism",
+			bundle: &mockModelBundle{
+				safetensorsPath: "/path/to/model",
+			},
+			config: &inference.BackendConfiguration{
+				Parallelism: 4,
+			},
+			expected: []string{
+				"serve",
+				"/path/to",
+				"--uds",
+				"/tmp/socket",
+				"--max-num-seqs",
+				"4",
+			},
+		},
+		{
+			name: "with fp8 KV cache",
+			bundle: &mockModelBundle{
+				safetensorsPath: "/path/to/model",
+			},
+			config: &inference.BackendConfiguration{
+				KVCacheType: inference.KVCacheTypeFP8,
+			},
+			expected: []string{
+				"serve",
+				"/path/to",
+				"--uds",
+				"/tmp/socket",
+				"--kv-cache-dtype",
+				"fp8",
+			},
+		},
+		{
+			name: "unsupported KV cache type should error",
+			bundle: &mockModelBundle{
+				safetensorsPath: "/path/to/model",
+			},
+			config: &inference.BackendConfiguration{
+				KVCacheType: inference.KVCacheTypeInt8,
+			},
+			expectError: true,
+		},
 		{
 			name: "with runtime flags",
 			bundle: &mockModelBundle{
@@ -0,0 +1,130 @@
+// Package classification implements text classification with sequence
+// classification models, such as sentiment, topic, and safety classifiers,
+// whose outputs (logits) are requested from backends as embeddings.
+package classification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Request is a classification request.
+type Request struct {
+	// Model is the classifier model.
+	Model string
+	// Inputs are the texts to classify.
+	Inputs []string
+}
+
+// ParseRequest parses a classification request, whose input is a string, an
+// array of strings, or an array of text content parts.
+func ParseRequest(body []byte) (*Request, error) {
+	var fields struct {
+		Model string          `json:"model"`
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, errors.New("invalid request")
+	}
+	request := &Request{Model: fields.Model}
+	var input string
+	var inputs []string
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	switch {
+	case json.Unmarshal(fields.Input, &input) == nil:
+		request.Inputs = []string{input}
+	case json.Unmarshal(fields.Input, &inputs) == nil:
+		request.Inputs = inputs
+	case json.Unmarshal(fields.Input, &parts) == nil:
+		for _, part := range parts {
+			if part.Type != "text" {
+				return nil, fmt.Errorf("unsupported input type %q: only text can be classified", part.Type)
+			}
+			request.Inputs = append(request.Inputs, part.Text)
+		}
+	default:
+		return nil, errors.New("input must be a string, an array of strings, or an array of text content parts")
+	}
+	if len(request.Inputs) == 0 {
+		return nil, errors.New("input is required")
+	}
+	return request, nil
+}
+
+// EmbeddingsBody returns the body of the embeddings request with which the
+// classifier's outputs for the inputs are requested from backends.
+func (r *Request) EmbeddingsBody() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"model":           r.Model,
+		"input":           r.Inputs,
+		"encoding_format": "float",
+	})
+}
+
+// Labels returns the labels of a classifier's n outputs. They're the labels in
+// the model's metadata if they match its outputs, or "label_<i>" otherwise,
+// replaced by the mapping for the output's index (e.g. "0") or metadata label
+// (e.g. "LABEL_0"), if any.
+func Labels(modelLabels []string, n int, mapping map[string]string) []string {
+	labels := make([]string, n)
+	for i := range labels {
+		if len(modelLabels) == n {
+			labels[i] = modelLabels[i]
+		} else {
+			labels[i] = fmt.Sprintf("label_%d", i)
+		}
+		if mapped, ok := mapping[strconv.Itoa(i)]; ok {
+			labels[i] = mapped
+		} else if mapped, ok := mapping[labels[i]]; ok {
+			labels[i] = mapped
+		}
+	}
+	return labels
+}
+
+// Softmax normalizes logits into probabilities that sum to 1, for
+// single-label classifiers.
+func Softmax(logits []float64) []float64 {
+	probabilities := make([]float64, len(logits))
+	if len(logits) == 0 {
+		return probabilities
+	}
+	maximum := slices.Max(logits)
+	var sum float64
+	for i, logit := range logits {
+		probabilities[i] = math.Exp(logit - maximum)
+		sum += probabilities[i]
+	}
+	for i := range probabilities {
+		probabilities[i] /= sum
+	}
+	return probabilities
+}
+
+// Sigmoid converts logits into independent probabilities, for multi-label
+// classifiers.
+func Sigmoid(logits []float64) []float64 {
+	probabilities := make([]float64, len(logits))
+	for i, logit := range logits {
+		probabilities[i] = 1 / (1 + math.Exp(-logit))
+	}
+	return probabilities
+}
+
+// ValidateMapping validates a label mapping.
+func ValidateMapping(mapping map[string]string) error {
+	for output, label := range mapping {
+		if strings.TrimSpace(output) == "" || strings.TrimSpace(label) == "" {
+			return errors.New("classification labels must map non-empty outputs to non-empty labels")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package classification
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected []string
+	}{
+		{`{"model":"m","input":"hello"}`, []string{"hello"}},
+		{`{"input":["a","b"]}`, []string{"a", "b"}},
+		{`{"input":[{"type":"text","text":"a"}]}`, []string{"a"}},
+	}
+	for _, tt := range tests {
+		request, err := ParseRequest([]byte(tt.body))
+		if err != nil || !reflect.DeepEqual(request.Inputs, tt.expected) {
+			t.Errorf("Unexpected result for %s: %+v (%v)", tt.body, request, err)
+		}
+	}
+	for _, invalid := range []string{
+		`{}`,
+		`{"input":[]}`,
+		`{"input":42}`,
+		`{"input":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}`,
+	} {
+		if _, err := ParseRequest([]byte(invalid)); err == nil {
+			t.Errorf("Expected error for %s", invalid)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	tests := []struct {
+		modelLabels []string
+		n           int
+		mapping     map[string]string
+		expected    []string
+	}{
+		{[]string{"negative", "positive"}, 2, nil, []string{"negative", "positive"}},
+		{[]string{"a"}, 2, nil, []string{"label_0", "label_1"}},
+		{[]string{"LABEL_0", "LABEL_1"}, 2, map[string]string{"LABEL_1": "positive"}, []string{"LABEL_0", "positive"}},
+		{nil, 2, map[string]string{"0": "negative", "label_1": "positive"}, []string{"negative", "positive"}},
+	}
+	for _, tt := range tests {
+		if labels := Labels(tt.modelLabels, tt.n, tt.mapping); !reflect.DeepEqual(labels, tt.expected) {
+			t.Errorf("Expected %v, got %v", tt.expected, labels)
+		}
+	}
+}
+
+func TestSoftmaxAndSigmoid(t *testing.T) {
+	if probabilities := Softmax([]float64{0, math.Log(3)}); math.Abs(probabilities[1]-0.75) > 1e-9 {
+		t.Errorf("Unexpected softmax %v", probabilities)
+	}
+	if probabilities := Sigmoid([]float64{0}); probabilities[0] != 0.5 {
+		t.Errorf("Unexpected sigmoid %v", probabilities)
+	}
+}
+
+func TestValidateMapping(t *testing.T) {
+	if err := ValidateMapping(map[string]string{"0": "negative"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := ValidateMapping(map[string]string{"0": " "}); err == nil {
+		t.Error("Expected error for an empty label")
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	config := &inference.ClassificationConfig{Labels: map[string]string{"0": "negative", "1": "positive"}}
+	recorder := httptest.NewRecorder()
+	w := NewResponseWriter(recorder, func(outputs [][]float64) any {
+		return Classify("ai/sentiment", nil, config, outputs)
+	})
+	w.Header().Set("Content-Length", "1")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"data":[{"index":1,"embedding":[5,-5]},{"index":0,"embedding":[-5,5]}]}`))
+	if err := w.Finish(); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	var response Response
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response %s: %v", recorder.Body.String(), err)
+	}
+	if response.Model != "ai/sentiment" || len(response.Data) != 2 ||
+		response.Data[0].Label != "positive" || response.Data[1].Label != "negative" || response.Data[0].NumClasses != 2 {
+		t.Errorf("Unexpected response %+v", response)
+	}
+	if recorder.Header().Get("Content-Length") != "" {
+		t.Error("Expected Content-Length to be removed")
+	}
+
+	// Multi-label classifiers' probabilities are independent.
+	config.MultiLabel = true
+	if response := Classify("ai/topics", nil, config, [][]float64{{0, 0}}); response.Data[0].Probs[0] != 0.5 || response.Data[0].Probs[1] != 0.5 {
+		t.Errorf("Unexpected multi-label response %+v", response)
+	}
+
+	// Unexpected outputs are reported as errors.
+	recorder = httptest.NewRecorder()
+	w = NewResponseWriter(recorder, func(outputs [][]float64) any { return outputs })
+	w.Write([]byte(`{"object":"list"}`))
+	w.Finish()
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", recorder.Code)
+	}
+
+	// Errors are passed through.
+	recorder = httptest.NewRecorder()
+	w = NewResponseWriter(recorder, func(outputs [][]float64) any { return outputs })
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte("unavailable"))
+	w.Finish()
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Body.String() != "unavailable" {
+		t.Errorf("Unexpected response %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
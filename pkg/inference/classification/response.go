@@ -0,0 +1,75 @@
+package classification
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+// Response is a classification response, compatible with vLLM's classify
+// API.
+type Response struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Data    []Result `json:"data"`
+}
+
+// Result is the classification of an input.
+type Result struct {
+	Index int `json:"index"`
+	// Label is the most probable label.
+	Label string `json:"label"`
+	// Probs are the probabilities of the labels.
+	Probs      []float64 `json:"probs"`
+	NumClasses int       `json:"num_classes"`
+	// Labels are the labels of Probs. It's an extension of vLLM's API.
+	Labels []string `json:"labels"`
+}
+
+// Classify returns the classification response for a classifier's outputs for
+// each input, labeled by the model's metadata labels and the configured
+// mapping.
+func Classify(model string, modelLabels []string, config *inference.ClassificationConfig, outputs [][]float64) Response {
+	var mapping map[string]string
+	multiLabel := false
+	if config != nil {
+		mapping, multiLabel = config.Labels, config.MultiLabel
+	}
+	response := Response{
+		ID:      newID(),
+		Object:  "list",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Data:    make([]Result, len(outputs)),
+	}
+	for i, logits := range outputs {
+		result := Result{Index: i, NumClasses: len(logits), Labels: Labels(modelLabels, len(logits), mapping)}
+		if multiLabel {
+			result.Probs = Sigmoid(logits)
+		} else {
+			result.Probs = Softmax(logits)
+		}
+		best := -1
+		for j, probability := range result.Probs {
+			if best < 0 || probability > result.Probs[best] {
+				best = j
+			}
+		}
+		if best >= 0 {
+			result.Label = result.Labels[best]
+		}
+		response.Data[i] = result
+	}
+	return response
+}
+
+// newID generates a classification response ID.
+func newID() string {
+	var id [12]byte
+	rand.Read(id[:])
+	return "classify-" + hex.EncodeToString(id[:])
+}
@@ -0,0 +1,88 @@
+package classification
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// ResponseWriter converts the embeddings response of a classifier, whose
+// embeddings are its outputs for each input, into another response.
+// Successful responses are buffered, and written by Finish, which must be
+// called once the response has been fully written.
+type ResponseWriter struct {
+	http.ResponseWriter
+	// convert converts the classifier's outputs for each input into the
+	// response.
+	convert func(outputs [][]float64) any
+	// statusCode is the response status code.
+	statusCode int
+	// buffer holds the complete body of a successful response.
+	buffer bytes.Buffer
+}
+
+// NewResponseWriter creates a new ResponseWriter that wraps w and converts
+// classifier outputs with convert.
+func NewResponseWriter(w http.ResponseWriter, convert func(outputs [][]float64) any) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, convert: convert}
+}
+
+// WriteHeader implements net/http.ResponseWriter.WriteHeader. The status of
+// successful responses is written by Finish, since the conversion may fail.
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	if statusCode != http.StatusOK {
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+// Write implements net/http.ResponseWriter.Write.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.statusCode != http.StatusOK {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buffer.Write(b)
+}
+
+// Flush implements net/http.Flusher.Flush. Classification responses aren't
+// streamed, so the buffered body is only written by Finish.
+func (w *ResponseWriter) Flush() {}
+
+// Finish writes the converted response, or an error if the classifier's output
+// can't be converted.
+func (w *ResponseWriter) Finish() error {
+	if w.statusCode != http.StatusOK {
+		return nil
+	}
+	w.Header().Del("Content-Length")
+	var embeddings struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.buffer.Bytes(), &embeddings); err != nil || len(embeddings.Data) == 0 {
+		http.Error(w.ResponseWriter, "invalid classifier output", http.StatusBadGateway)
+		return nil
+	}
+	sort.SliceStable(embeddings.Data, func(i, j int) bool {
+		return embeddings.Data[i].Index < embeddings.Data[j].Index
+	})
+	outputs := make([][]float64, len(embeddings.Data))
+	for i, data := range embeddings.Data {
+		outputs[i] = data.Embedding
+	}
+
+	body, err := json.Marshal(w.convert(outputs))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+	_, err = w.ResponseWriter.Write(body)
+	return err
+}
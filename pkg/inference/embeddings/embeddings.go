@@ -0,0 +1,242 @@
+// Package embeddings implements the encoding formats for embeddings returned
+// by the OpenAI embeddings API, including compact binary extensions, as well as
+// dimension reduction for matryoshka embedding models.
+package embeddings
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Format is an embedding encoding format, as specified by the encoding_format
+// field of an embeddings request.
+type Format string
+
+const (
+	// FormatFloat encodes embeddings as arrays of numbers. It's the default.
+	FormatFloat Format = "float"
+	// FormatBase64 encodes embeddings as base64-encoded little-endian float32
+	// values, as specified by the OpenAI API.
+	FormatBase64 Format = "base64"
+	// FormatFloat16 encodes embeddings as base64-encoded little-endian IEEE
+	// 754 half-precision values. It's an extension of the OpenAI API.
+	FormatFloat16 Format = "float16"
+	// FormatInt8 encodes embeddings as base64-encoded int8 values, quantized
+	// symmetrically using a per-embedding scale that's reported alongside
+	// them, such that each value is approximately the int8 value multiplied
+	// by the scale. It's an extension of the OpenAI API.
+	FormatInt8 Format = "int8"
+)
+
+// ParseFormat parses an embedding encoding format. An empty string is parsed
+// as FormatFloat.
+func ParseFormat(format string) (Format, error) {
+	switch Format(format) {
+	case "", FormatFloat:
+		return FormatFloat, nil
+	case FormatBase64, FormatFloat16, FormatInt8:
+		return Format(format), nil
+	}
+	return "", fmt.Errorf("unsupported encoding_format %q (must be one of float, base64, float16, or int8)", format)
+}
+
+// Request holds the options of an embeddings request that are applied by the
+// model runner rather than by the backend.
+type Request struct {
+	// Format is the requested encoding format.
+	Format Format
+	// Dimensions is the requested number of dimensions, or 0 if the model's
+	// full embeddings were requested.
+	Dimensions int
+}
+
+// ParseRequest returns the options requested by the body of an embeddings
+// request, along with the body to forward to the backend, which omits them so
+// that the response can be converted regardless of the options that the
+// backend supports. If no options are requested, then the body is returned
+// unmodified.
+func ParseRequest(body []byte) (Request, []byte, error) {
+	options := Request{Format: FormatFloat}
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return options, body, nil
+	}
+
+	modified := false
+	if raw, ok := request["encoding_format"]; ok && string(raw) != "null" {
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return Request{}, nil, fmt.Errorf("encoding_format must be a string")
+		}
+		format, err := ParseFormat(name)
+		if err != nil {
+			return Request{}, nil, err
+		}
+		options.Format = format
+		if format != FormatFloat {
+			delete(request, "encoding_format")
+			modified = true
+		}
+	}
+	if raw, ok := request["dimensions"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &options.Dimensions); err != nil || options.Dimensions <= 0 {
+			return Request{}, nil, fmt.Errorf("dimensions must be a positive integer")
+		}
+		delete(request, "dimensions")
+		modified = true
+	}
+	if !modified {
+		return options, body, nil
+	}
+
+	upstream, err := json.Marshal(request)
+	if err != nil {
+		return Request{}, nil, fmt.Errorf("unable to encode request: %w", err)
+	}
+	return options, upstream, nil
+}
+
+// MaxInputs is the maximum number of inputs in a batched embeddings request,
+// as in the OpenAI API.
+const MaxInputs = 2048
+
+// CountInputs returns the number of inputs embedded by the body of an
+// embeddings request, whose input is either a string, an array of token IDs,
+// or a batch of strings or token ID arrays, and validates that batches are
+// neither empty nor larger than MaxInputs. Bodies that can't be parsed count
+// as a single input, leaving their validation to the backend.
+func CountInputs(body []byte) (int, error) {
+	var request struct {
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return 1, nil
+	}
+	var batch []json.RawMessage
+	if json.Unmarshal(request.Input, &batch) != nil {
+		return 1, nil
+	}
+	if len(batch) == 0 {
+		return 0, fmt.Errorf("input must not be empty")
+	}
+	if len(batch) > MaxInputs {
+		return 0, fmt.Errorf("input must not have more than %d items, got %d", MaxInputs, len(batch))
+	}
+	// An array of token IDs is a single input.
+	var token int
+	if json.Unmarshal(batch[0], &token) == nil {
+		return 1, nil
+	}
+	return len(batch), nil
+}
+
+// Truncate reduces an embedding to its first dimensions values and rescales
+// the result to unit length, as required for models trained with matryoshka
+// representation learning. Embeddings that already have no more than the
+// specified number of dimensions are returned unmodified.
+func Truncate(embedding []float32, dimensions int) []float32 {
+	if dimensions <= 0 || len(embedding) <= dimensions {
+		return embedding
+	}
+	truncated := embedding[:dimensions]
+	var sumOfSquares float64
+	for _, value := range truncated {
+		sumOfSquares += float64(value) * float64(value)
+	}
+	if sumOfSquares == 0 {
+		return truncated
+	}
+	norm := math.Sqrt(sumOfSquares)
+	for i, value := range truncated {
+		truncated[i] = float32(float64(value) / norm)
+	}
+	return truncated
+}
+
+// Encode encodes an embedding in the specified (non-float) format. For
+// FormatInt8, the quantization scale is returned as well.
+func Encode(embedding []float32, format Format) (string, float32) {
+	var data []byte
+	var scale float32
+	switch format {
+	case FormatFloat16:
+		data = make([]byte, 2*len(embedding))
+		for i, value := range embedding {
+			binary.LittleEndian.PutUint16(data[2*i:], Float16Bits(value))
+		}
+	case FormatInt8:
+		data, scale = quantizeInt8(embedding)
+	default:
+		data = make([]byte, 4*len(embedding))
+		for i, value := range embedding {
+			binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(value))
+		}
+	}
+	return base64.StdEncoding.EncodeToString(data), scale
+}
+
+// quantizeInt8 quantizes an embedding to int8 values using a symmetric scale
+// derived from the embedding's largest magnitude.
+func quantizeInt8(embedding []float32) ([]byte, float32) {
+	var maxMagnitude float64
+	for _, value := range embedding {
+		maxMagnitude = max(maxMagnitude, math.Abs(float64(value)))
+	}
+	data := make([]byte, len(embedding))
+	if maxMagnitude == 0 || math.IsInf(maxMagnitude, 0) || math.IsNaN(maxMagnitude) {
+		return data, 0
+	}
+	scale := maxMagnitude / 127
+	for i, value := range embedding {
+		quantized := math.Round(float64(value) / scale)
+		data[i] = byte(int8(max(-127, min(127, quantized))))
+	}
+	return data, float32(scale)
+}
+
+// Float16Bits converts a float32 value to the bits of the nearest IEEE 754
+// half-precision value, rounding to nearest even.
+func Float16Bits(value float32) uint16 {
+	bits := math.Float32bits(value)
+	sign := uint16(bits>>16) & 0x8000
+	exponent := int((bits>>23)&0xff) - 127 + 15
+	mantissa := bits & 0x7fffff
+
+	switch {
+	case (bits>>23)&0xff == 0xff:
+		// Infinity or NaN.
+		if mantissa != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exponent >= 0x1f:
+		// Overflow to infinity.
+		return sign | 0x7c00
+	case exponent <= 0:
+		// Subnormal or zero.
+		if exponent < -10 {
+			return sign
+		}
+		mantissa |= 0x800000
+		shift := uint32(14 - exponent)
+		half := uint16(mantissa >> shift)
+		remainder := mantissa & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if remainder > halfway || (remainder == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | half
+	}
+
+	half := sign | uint16(exponent)<<10 | uint16(mantissa>>13)
+	// Rounding may carry into the exponent, which correctly rounds up to the
+	// next power of two (or infinity).
+	remainder := mantissa & 0x1fff
+	if remainder > 0x1000 || (remainder == 0x1000 && half&1 == 1) {
+		half++
+	}
+	return half
+}
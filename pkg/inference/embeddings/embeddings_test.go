@@ -0,0 +1,188 @@
+package embeddings
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFloat16Bits(t *testing.T) {
+	tests := []struct {
+		value float32
+		want  uint16
+	}{
+		{value: 0, want: 0x0000},
+		{value: float32(math.Copysign(0, -1)), want: 0x8000},
+		{value: 1, want: 0x3c00},
+		{value: -2, want: 0xc000},
+		{value: 0.1, want: 0x2e66},
+		{value: 65504, want: 0x7bff},
+		{value: 65520, want: 0x7c00},
+		{value: 1e-8, want: 0x0000},
+		{value: 6e-8, want: 0x0001},
+		{value: 6.1035156e-05, want: 0x0400},
+		{value: float32(math.Inf(-1)), want: 0xfc00},
+		{value: float32(math.NaN()), want: 0x7e00},
+	}
+	for _, tt := range tests {
+		if got := Float16Bits(tt.value); got != tt.want {
+			t.Errorf("Float16Bits(%g) = %#04x, want %#04x", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	embedding := []float32{0.5, -0.25, 1, 0}
+
+	encoded, _ := Encode(embedding, FormatBase64)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) != 16 {
+		t.Fatalf("Expected 16 bytes of base64 data, got %d (%v)", len(data), err)
+	}
+	for i, want := range embedding {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:])); got != want {
+			t.Errorf("Expected value %d to be %g, got %g", i, want, got)
+		}
+	}
+
+	encoded, _ = Encode(embedding, FormatFloat16)
+	if data, _ := base64.StdEncoding.DecodeString(encoded); len(data) != 8 || binary.LittleEndian.Uint16(data[4:]) != 0x3c00 {
+		t.Errorf("Unexpected float16 data: %x", data)
+	}
+
+	encoded, scale := Encode(embedding, FormatInt8)
+	data, _ = base64.StdEncoding.DecodeString(encoded)
+	if len(data) != 4 || scale != float32(1.0/127) {
+		t.Fatalf("Unexpected int8 encoding: %x with scale %g", data, scale)
+	}
+	for i, want := range embedding {
+		if got := float32(int8(data[i])) * scale; math.Abs(float64(got-want)) > float64(scale) {
+			t.Errorf("Expected dequantized value %d to be about %g, got %g", i, want, got)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	body := []byte(`{"model":"m","input":"hi"}`)
+	if options, upstream, err := ParseRequest(body); err != nil || options != (Request{Format: FormatFloat}) || string(upstream) != string(body) {
+		t.Errorf("Expected default options and unmodified body, got %+v, %s (%v)", options, upstream, err)
+	}
+
+	options, upstream, err := ParseRequest([]byte(`{"model":"m","input":"hi","encoding_format":"int8","dimensions":256}`))
+	if err != nil || options != (Request{Format: FormatInt8, Dimensions: 256}) {
+		t.Fatalf("Expected int8 format with 256 dimensions, got %+v (%v)", options, err)
+	}
+	var request map[string]any
+	if err := json.Unmarshal(upstream, &request); err != nil {
+		t.Fatalf("Invalid upstream body: %v", err)
+	}
+	_, hasFormat := request["encoding_format"]
+	_, hasDimensions := request["dimensions"]
+	if hasFormat || hasDimensions || request["input"] != "hi" {
+		t.Errorf("Expected options to be removed from upstream body, got %s", upstream)
+	}
+
+	for _, invalid := range []string{
+		`{"encoding_format":"binary"}`,
+		`{"encoding_format":8}`,
+		`{"dimensions":0}`,
+		`{"dimensions":1.5}`,
+		`{"dimensions":"256"}`,
+	} {
+		if _, _, err := ParseRequest([]byte(invalid)); err == nil {
+			t.Errorf("Expected error for %s", invalid)
+		}
+	}
+}
+
+func TestCountInputs(t *testing.T) {
+	for body, expected := range map[string]int{
+		`{"input":"hi"}`:                     1,
+		`{"input":["a","b","c"]}`:            3,
+		`{"input":[1,2,3]}`:                  1,
+		`{"input":[[1,2],[3]]}`:              2,
+		`not json`:                           1,
+		`{"model":"m","input":["only one"]}`: 1,
+	} {
+		if inputs, err := CountInputs([]byte(body)); err != nil || inputs != expected {
+			t.Errorf("Expected %d inputs for %s, got %d (%v)", expected, body, inputs, err)
+		}
+	}
+
+	tooMany, _ := json.Marshal(map[string]any{"input": make([]string, MaxInputs+1)})
+	for _, invalid := range [][]byte{[]byte(`{"input":[]}`), tooMany} {
+		if _, err := CountInputs(invalid); err == nil {
+			t.Errorf("Expected error for %.40s", invalid)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	truncated := Truncate([]float32{3, 4, 12}, 2)
+	if len(truncated) != 2 || truncated[0] != 0.6 || truncated[1] != 0.8 {
+		t.Errorf("Expected [0.6 0.8], got %v", truncated)
+	}
+	if truncated := Truncate([]float32{0, 0, 1}, 2); len(truncated) != 2 || truncated[0] != 0 || truncated[1] != 0 {
+		t.Errorf("Expected zero vector to be truncated without normalization, got %v", truncated)
+	}
+	if truncated := Truncate([]float32{1, 2}, 4); len(truncated) != 2 || truncated[1] != 2 {
+		t.Errorf("Expected short embedding to be unmodified, got %v", truncated)
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	w := NewResponseWriter(recorder, Request{Format: FormatInt8})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,`))
+	w.Write([]byte(`"embedding":[0.5,-1]}],"model":"m"}`))
+	if err := w.Finish(); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+
+	var response struct {
+		Model string `json:"model"`
+		Data  []struct {
+			Index     int     `json:"index"`
+			Embedding string  `json:"embedding"`
+			Scale     float32 `json:"scale"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response %s: %v", recorder.Body.String(), err)
+	}
+	if response.Model != "m" || len(response.Data) != 1 {
+		t.Fatalf("Unexpected response: %s", recorder.Body.String())
+	}
+	if data, _ := base64.StdEncoding.DecodeString(response.Data[0].Embedding); len(data) != 2 || int8(data[1]) != -127 {
+		t.Errorf("Unexpected int8 embedding: %x", data)
+	}
+	if response.Data[0].Scale != float32(1.0/127) {
+		t.Errorf("Expected scale %g, got %g", 1.0/127, response.Data[0].Scale)
+	}
+
+	// Truncated embeddings are renormalized.
+	recorder = httptest.NewRecorder()
+	w = NewResponseWriter(recorder, Request{Format: FormatFloat, Dimensions: 2})
+	w.Write([]byte(`{"data":[{"index":0,"embedding":[0.3,0.4,0.866]}]}`))
+	if err := w.Finish(); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	if body := recorder.Body.String(); body != `{"data":[{"embedding":[0.6,0.8],"index":0}]}` {
+		t.Errorf("Unexpected truncated response: %s", body)
+	}
+
+	// Error responses are passed through.
+	recorder = httptest.NewRecorder()
+	w = NewResponseWriter(recorder, Request{Format: FormatBase64})
+	http.Error(w, "model not found", http.StatusNotFound)
+	w.Finish()
+	if recorder.Code != http.StatusNotFound || recorder.Body.String() != "model not found\n" {
+		t.Errorf("Expected error response to be passed through, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
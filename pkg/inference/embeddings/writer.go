@@ -0,0 +1,105 @@
+package embeddings
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// ResponseWriter rewrites embeddings responses, truncating embeddings returned
+// as arrays of numbers to the requested dimensions and converting them to the
+// requested encoding format. Responses
+// that can't be parsed, and embeddings that aren't flat arrays of numbers, are
+// left as-is. Finish must be called once the response has been fully written.
+type ResponseWriter struct {
+	http.ResponseWriter
+	// request holds the requested options.
+	request Request
+	// statusCode is the response status code.
+	statusCode int
+	// buffer holds the complete body of a successful response.
+	buffer bytes.Buffer
+}
+
+// NewResponseWriter creates a new ResponseWriter that wraps w and applies the
+// requested options to embeddings.
+func NewResponseWriter(w http.ResponseWriter, request Request) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, request: request}
+}
+
+// WriteHeader implements net/http.ResponseWriter.WriteHeader.
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	if statusCode == http.StatusOK {
+		// The body will be rewritten, so its length will change.
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements net/http.ResponseWriter.Write.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.statusCode != http.StatusOK {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buffer.Write(b)
+}
+
+// Flush implements net/http.Flusher.Flush. Embeddings responses aren't
+// streamed, so the buffered body is only written by Finish.
+func (w *ResponseWriter) Flush() {}
+
+// Finish writes any buffered output.
+func (w *ResponseWriter) Finish() error {
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	body := rewriteResponse(w.buffer.Bytes(), w.request)
+	w.buffer.Reset()
+	_, err := w.ResponseWriter.Write(body)
+	return err
+}
+
+// rewriteResponse applies the requested options to the embeddings in an
+// embeddings response. If the response can't be parsed, it's returned
+// unmodified.
+func rewriteResponse(body []byte, request Request) []byte {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	var data []map[string]json.RawMessage
+	if err := json.Unmarshal(response["data"], &data); err != nil {
+		return body
+	}
+
+	for _, item := range data {
+		var embedding []float32
+		if err := json.Unmarshal(item["embedding"], &embedding); err != nil {
+			continue
+		}
+		embedding = Truncate(embedding, request.Dimensions)
+		if request.Format == FormatFloat {
+			item["embedding"], _ = json.Marshal(embedding)
+			continue
+		}
+		encoded, scale := Encode(embedding, request.Format)
+		item["embedding"], _ = json.Marshal(encoded)
+		if request.Format == FormatInt8 {
+			item["scale"], _ = json.Marshal(scale)
+		}
+	}
+
+	var err error
+	if response["data"], err = json.Marshal(data); err != nil {
+		return body
+	}
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
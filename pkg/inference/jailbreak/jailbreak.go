@@ -0,0 +1,114 @@
+// Package jailbreak scores prompts for prompt injection and jailbreak attempts
+// with lightweight heuristics: phrases in several languages that override the
+// model's instructions, ask it to drop its restrictions or reveal its system
+// prompt, inject chat template delimiters, or hide text from reviewers.
+package jailbreak
+
+import "regexp"
+
+// Category is a category of jailbreak heuristics.
+type Category string
+
+const (
+	// CategoryInstructionOverride matches prompts telling the model to ignore
+	// its previous instructions.
+	CategoryInstructionOverride Category = "instruction_override"
+	// CategoryRolePlay matches prompts asking the model to adopt a persona or
+	// mode without restrictions.
+	CategoryRolePlay Category = "role_play"
+	// CategoryPromptLeak matches prompts asking the model to reveal its system
+	// prompt.
+	CategoryPromptLeak Category = "prompt_leak"
+	// CategoryDelimiterInjection matches prompts containing chat template
+	// delimiters that start system turns.
+	CategoryDelimiterInjection Category = "delimiter_injection"
+	// CategoryObfuscation matches prompts hiding text with invisible
+	// characters or long encoded payloads.
+	CategoryObfuscation Category = "obfuscation"
+)
+
+// Signal is a heuristic that matched a prompt.
+type Signal struct {
+	Category Category `json:"category"`
+	// Text is the matched text.
+	Text string `json:"text"`
+	// Weight is the heuristic's contribution to the score.
+	Weight float64 `json:"weight"`
+}
+
+// Result is the score of a prompt.
+type Result struct {
+	// Score is the likelihood, between 0 and 1, that the prompt is a
+	// jailbreak attempt.
+	Score float64 `json:"score"`
+	// Signals are the heuristics that matched the prompt, in the order in
+	// which they're evaluated.
+	Signals []Signal `json:"signals,omitempty"`
+}
+
+// heuristics are the patterns of jailbreak attempts and their weights.
+var heuristics = []struct {
+	category Category
+	weight   float64
+	pattern  *regexp.Regexp
+}{
+	// Instruction overrides, in English, Spanish, French, German, Italian,
+	// Portuguese, Russian, Chinese, and Japanese.
+	{CategoryInstructionOverride, 0.6, regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget|override)\s+(?:all\s+|any\s+)?(?:of\s+)?(?:the\s+|your\s+)?(?:previous|prior|above|earlier|preceding|original|system)\s+(?:instructions|prompts?|rules|directions|guidelines)`)},
+	{CategoryInstructionOverride, 0.6, regexp.MustCompile(`(?i)\b(?:ignora|olvida)\s+(?:todas\s+)?(?:las\s+)?instrucciones\s+(?:anteriores|previas)`)},
+	{CategoryInstructionOverride, 0.6, regexp.MustCompile(`(?i)\b(?:ignore[rz]?|oublie[rz]?)\s+(?:toutes\s+)?(?:les\s+)?instructions\s+(?:précédentes|antérieures)`)},
+	{CategoryInstructionOverride, 0.6, regexp.MustCompile(`(?i)\b(?:ignoriere|vergiss)\s+(?:alle\s+)?(?:vorherigen|bisherigen|obigen)\s+(?:Anweisungen|Instruktionen|Regeln)`)},
+	{CategoryInstructionOverride, 0.6, regexp.MustCompile(`(?i)\b(?:ignora|dimentica)\s+(?:tutte\s+)?(?:le\s+)?istruzioni\s+precedenti`)},
+	{CategoryInstructionOverride, 0.6, regexp.MustCompile(`(?i)\b(?:ignore|esqueça)\s+(?:todas\s+)?(?:as\s+)?instruções\s+anteriores`)},
+	{CategoryInstructionOverride, 0.6, regexp.MustCompile(`(?i)(?:игнорируй|забудь)\s+(?:все\s+)?(?:предыдущие|прошлые)\s+инструкции`)},
+	{CategoryInstructionOverride, 0.6, regexp.MustCompile(`(?:忽略|无视|忘记)(?:之前|以上|先前|上面)的(?:所有)?(?:指令|指示|说明|规则)`)},
+	{CategoryInstructionOverride, 0.6, regexp.MustCompile(`(?:以前|前|上記)の(?:指示|命令)を(?:すべて|全て)?無視`)},
+
+	// Personas and modes without restrictions.
+	{CategoryRolePlay, 0.5, regexp.MustCompile(`\bDAN\b|(?i)\bdo\s+anything\s+now\b`)},
+	{CategoryRolePlay, 0.4, regexp.MustCompile(`(?i)\b(?:developer|god|jailbreak|unrestricted)\s+mode\b|\bmodo\s+(?:desarrollador|sin\s+restricciones)\b|\bmode\s+(?:développeur|sans\s+restrictions)\b|\bEntwicklermodus\b|开发者模式`)},
+	{CategoryRolePlay, 0.4, regexp.MustCompile(`(?i)\b(?:without|no longer bound by)\s+(?:any\s+)?(?:restrictions|filters|limitations|guidelines|censorship)\b|\bsin\s+(?:ninguna\s+)?(?:restricción|restricciones|censura)\b|\bsans\s+(?:aucune\s+)?(?:restriction|restrictions|censure)\b|\bohne\s+(?:jegliche\s+)?(?:Einschränkungen|Zensur)\b|没有任何限制|不受任何限制`)},
+	{CategoryRolePlay, 0.3, regexp.MustCompile(`(?i)\bpretend\s+(?:that\s+)?you\s+(?:are|have)\s+(?:an?\s+)?(?:evil|unfiltered|uncensored|no)\b`)},
+
+	// System prompt leaks.
+	{CategoryPromptLeak, 0.4, regexp.MustCompile(`(?i)\b(?:reveal|show|print|repeat|output|tell)\s+(?:me\s+)?(?:your|the)\s+(?:system\s+prompt|initial\s+instructions|hidden\s+instructions|original\s+instructions)`)},
+	{CategoryPromptLeak, 0.4, regexp.MustCompile(`(?i)\b(?:muestra|revela|muéstrame)\s+(?:tu|el)\s+(?:prompt|mensaje)\s+(?:del\s+)?sistema|\b(?:révèle|affiche|montre)\s+(?:ton|le)\s+prompt\s+système|\b(?:zeige|verrate)\s+(?:mir\s+)?(?:deinen|den)\s+System-?prompt|(?:显示|泄露|输出|告诉我)(?:你的)?系统提示`)},
+
+	// Chat template delimiters starting system turns.
+	{CategoryDelimiterInjection, 0.5, regexp.MustCompile(`(?i)<\|im_start\|>\s*system|<\|start_header_id\|>\s*system|<<SYS>>|\[/?INST\]|</?system>`)},
+	{CategoryDelimiterInjection, 0.3, regexp.MustCompile(`(?im)^\s*(?:#{1,3}\s*)?(?:system|new\s+instructions)\s*:`)},
+
+	// Hidden text.
+	{CategoryObfuscation, 0.3, regexp.MustCompile(`[\x{200B}-\x{200F}\x{202A}-\x{202E}\x{2066}-\x{2069}\x{E0000}-\x{E007F}]`)},
+	{CategoryObfuscation, 0.2, regexp.MustCompile(`[A-Za-z0-9+/]{160,}={0,2}`)},
+}
+
+// Score scores a prompt. Each heuristic contributes its weight once, however
+// many times it matches, and weights are combined as independent
+// probabilities, so that the score grows with the number of matching
+// heuristics without exceeding 1.
+func Score(prompt string) Result {
+	result := Result{}
+	remaining := 1.0
+	for _, heuristic := range heuristics {
+		match := heuristic.pattern.FindString(prompt)
+		if match == "" {
+			continue
+		}
+		result.Signals = append(result.Signals, Signal{Category: heuristic.category, Text: match, Weight: heuristic.weight})
+		remaining *= 1 - heuristic.weight
+	}
+	result.Score = 1 - remaining
+	return result
+}
+
+// Categories returns the distinct categories of a result's signals, in order.
+func (r Result) Categories() []Category {
+	var categories []Category
+	for _, signal := range r.Signals {
+		if len(categories) == 0 || categories[len(categories)-1] != signal.Category {
+			categories = append(categories, signal.Category)
+		}
+	}
+	return categories
+}
@@ -0,0 +1,124 @@
+// Package language implements lightweight detection of the natural language of
+// prompts, using the scripts in which they're written and, for languages
+// written in the Latin script, the frequency of common words.
+package language
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// minimumStopwords is the minimum number of common words that a text in the
+// Latin script must contain for its language to be determined.
+const minimumStopwords = 2
+
+// scripts maps languages to the Unicode scripts that identify them. Languages
+// are identified by ISO 639-1 codes.
+var scripts = []struct {
+	language string
+	table    *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+	{"ru", unicode.Cyrillic},
+	{"ar", unicode.Arabic},
+	{"he", unicode.Hebrew},
+	{"el", unicode.Greek},
+	{"hi", unicode.Devanagari},
+	{"th", unicode.Thai},
+}
+
+// stopwords maps languages written in the Latin script to their most common
+// words.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "in", "that", "it", "you", "for", "with", "this", "what", "how", "be", "on", "can", "do", "i"},
+	"fr": {"le", "la", "les", "et", "est", "des", "un", "une", "du", "que", "qui", "pour", "dans", "pas", "vous", "je", "ce", "sur", "avec", "comment"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "ich", "sie", "mit", "den", "auf", "für", "wie", "was", "es", "sind", "auch"},
+	"es": {"el", "la", "los", "las", "y", "es", "de", "que", "en", "un", "una", "por", "para", "con", "no", "cómo", "qué", "del", "se", "lo"},
+	"it": {"il", "la", "di", "che", "e", "è", "un", "una", "per", "non", "sono", "con", "come", "del", "della", "gli", "le", "mi", "cosa", "questo"},
+	"pt": {"o", "a", "os", "as", "e", "é", "de", "que", "um", "uma", "para", "com", "não", "do", "da", "em", "como", "se", "por", "você"},
+	"nl": {"de", "het", "een", "en", "is", "van", "niet", "dat", "ik", "je", "op", "te", "zijn", "met", "voor", "wat", "hoe", "er", "maar", "ook"},
+}
+
+// Supported returns the languages that can be detected.
+func Supported() []string {
+	var languages []string
+	for _, script := range scripts {
+		if !slices.Contains(languages, script.language) {
+			languages = append(languages, script.language)
+		}
+	}
+	for language := range stopwords {
+		languages = append(languages, language)
+	}
+	slices.Sort(languages)
+	return languages
+}
+
+// IsSupported returns whether a language can be detected.
+func IsSupported(language string) bool {
+	return slices.Contains(Supported(), language)
+}
+
+// Detect returns the ISO 639-1 code of the language in which text is written,
+// or an empty string if it can't be determined.
+func Detect(text string) string {
+	// Identify languages with their own scripts by the script used by most
+	// letters. Japanese is identified by kana even if kanji are more common.
+	counts := make(map[string]int)
+	latin := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, script := range scripts {
+			if unicode.Is(script.table, r) {
+				counts[script.language]++
+				break
+			}
+		}
+	}
+	best, bestCount := "", 0
+	for _, script := range scripts {
+		if count := counts[script.language]; count > bestCount {
+			best, bestCount = script.language, count
+		}
+	}
+	if counts["ja"] > 0 && best == "zh" {
+		best = "ja"
+	}
+	if bestCount > latin {
+		return best
+	}
+
+	// Identify languages written in the Latin script by their common words.
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	best, bestCount = "", 0
+	tied := false
+	for language, common := range stopwords {
+		count := 0
+		for _, word := range words {
+			if slices.Contains(common, word) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount, tied = language, count, false
+		} else if count == bestCount {
+			tied = true
+		}
+	}
+	if bestCount < minimumStopwords || tied {
+		return ""
+	}
+	return best
+}
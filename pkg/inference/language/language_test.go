@@ -0,0 +1,36 @@
+package language
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"How do I run a model locally with the CLI?", "en"},
+		{"Comment est-ce que je peux lancer le modèle dans un conteneur ?", "fr"},
+		{"Wie kann ich das Modell mit Docker starten und was ist der Unterschied?", "de"},
+		{"¿Cómo puedo ejecutar el modelo en un contenedor para la demo?", "es"},
+		{"Come posso eseguire il modello in un container per la demo?", "it"},
+		{"Como posso executar o modelo em um contêiner para a demonstração?", "pt"},
+		{"Hoe kan ik het model in een container draaien en wat is er mis?", "nl"},
+		{"如何在本地运行模型？", "zh"},
+		{"モデルをローカルで実行する方法は？", "ja"},
+		{"로컬에서 모델을 실행하는 방법은?", "ko"},
+		{"Как запустить модель локально?", "ru"},
+		{"كيف أشغل النموذج محليا؟", "ar"},
+		{"func main() { fmt.Println(x) }", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if actual := Detect(tt.text); actual != tt.expected {
+			t.Errorf("Detect(%q) = %q, expected %q", tt.text, actual, tt.expected)
+		}
+	}
+}
+
+func TestIsSupported(t *testing.T) {
+	if !IsSupported("en") || !IsSupported("ja") || IsSupported("xx") {
+		t.Error("Unexpected supported languages")
+	}
+}
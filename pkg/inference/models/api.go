@@ -1,9 +1,11 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference/quirks"
 )
 
 // ModelCreateRequest represents a model create request. It is designed to
@@ -12,8 +14,12 @@ import (
 // facilitate pulls, though in the future it may facilitate model building and
 // refinement (such as fine tuning, quantization, or distillation).
 type ModelCreateRequest struct {
-	// From is the name of the model to pull.
+	// From is the name of the model to pull, or an object storage URL (s3://,
+	// gs://, or az://) of a model archive.
 	From string `json:"from"`
+	// Tag is the name to give a model pulled from object storage. It defaults
+	// to a name derived from the object's name.
+	Tag string `json:"tag,omitempty"`
 	// IgnoreRuntimeMemoryCheck indicates whether the server should check if it has sufficient
 	// memory to run the given model (assuming default configuration).
 	IgnoreRuntimeMemoryCheck bool `json:"ignore-runtime-memory-check,omitempty"`
@@ -32,6 +38,46 @@ type ModelPackageRequest struct {
 	ContextSize uint64 `json:"context-size,omitempty"`
 }
 
+// ModelMountRequest represents a request to mount a local GGUF file as a model
+// without importing it into the store.
+type ModelMountRequest struct {
+	// Path is the absolute path to the GGUF file.
+	Path string `json:"path"`
+	// Name is the name to give the mounted model.
+	Name string `json:"name"`
+}
+
+// ErrInvalidScaleRequest indicates that a request to scale a model's runners
+// can't be satisfied as specified.
+var ErrInvalidScaleRequest = errors.New("invalid scale request")
+
+// ModelScaleRequest represents a request to set the desired number of runner
+// replicas for a model.
+type ModelScaleRequest struct {
+	// Replicas is the desired (maximum) number of replicas.
+	Replicas int `json:"replicas"`
+	// Backend is the backend whose runners should be scaled. If empty, the
+	// default backend for the model is used.
+	Backend string `json:"backend,omitempty"`
+	// Mode is the runner mode ("completion", "embedding", or "classification")
+	// to scale. If empty, completion runners are scaled.
+	Mode string `json:"mode,omitempty"`
+}
+
+// ModelScaleResponse reports the replica counts for a model's runners.
+type ModelScaleResponse struct {
+	// Model is the model reference.
+	Model string `json:"model"`
+	// Backend is the backend whose runners were scaled.
+	Backend string `json:"backend"`
+	// Mode is the runner mode that was scaled.
+	Mode string `json:"mode"`
+	// Current is the number of replicas currently loaded.
+	Current int `json:"current"`
+	// Desired is the desired number of replicas.
+	Desired int `json:"desired"`
+}
+
 // SimpleModel is a wrapper that allows creating a model with modified configuration
 type SimpleModel struct {
 	types.Model
@@ -87,12 +133,19 @@ func ToOpenAI(m types.Model) (*OpenAIModel, error) {
 		id = tags[0]
 	}
 
-	return &OpenAIModel{
-		ID:      id,
-		Object:  "model",
-		Created: created,
-		OwnedBy: "docker",
-	}, nil
+	openAI := &OpenAIModel{
+		ID:           id,
+		Object:       "model",
+		Created:      created,
+		OwnedBy:      "docker",
+		Capabilities: Capabilities(m),
+		SizeOnDisk:   SizeOnDisk(m),
+	}
+	if config, err := m.Config(); err == nil {
+		openAI.ContextWindow = ContextWindow(config)
+		openAI.Quantization = config.Quantization
+	}
+	return openAI, nil
 }
 
 // OpenAIModel represents a locally stored model using OpenAI conventions.
@@ -105,6 +158,28 @@ type OpenAIModel struct {
 	Created int64 `json:"created"`
 	// OwnedBy is the model owner. At the moment, it is always "docker".
 	OwnedBy string `json:"owned_by"`
+
+	// The following fields are extensions to the OpenAI model object.
+
+	// ContextWindow is the maximum context length in tokens, if known.
+	ContextWindow *uint64 `json:"context_window,omitempty"`
+	// Capabilities lists the model capabilities (e.g. "completion", "tools").
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Quantization is the model's quantization type, if known.
+	Quantization string `json:"quantization,omitempty"`
+	// SizeOnDisk is the total size of the model files in bytes.
+	SizeOnDisk int64 `json:"size_on_disk,omitempty"`
+	// Loaded indicates whether the model is currently loaded by a runner.
+	Loaded bool `json:"loaded"`
+	// Pinned indicates whether the model is pinned as a favorite.
+	Pinned bool `json:"pinned,omitempty"`
+	// Requests is the number of inference requests made to the model.
+	Requests uint64 `json:"requests,omitempty"`
+	// LastUsed is the Unix epoch timestamp of the model's last inference
+	// request, if any.
+	LastUsed int64 `json:"last_used,omitempty"`
+	// Labels are the model's user labels.
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // OpenAIModelList represents a list of models using OpenAI conventions.
@@ -124,4 +199,15 @@ type Model struct {
 	Created int64 `json:"created"`
 	// Config describes the model.
 	Config types.Config `json:"config"`
+	// Labels are the model's user labels.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ModelInspection describes a locally stored model along with the workarounds
+// for its known quirks.
+type ModelInspection struct {
+	Model
+	// Workarounds are the rules describing the model's known quirks, whose
+	// workarounds are applied when it's loaded.
+	Workarounds []quirks.Rule `json:"workarounds"`
 }
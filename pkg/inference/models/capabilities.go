@@ -0,0 +1,150 @@
+package models
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+)
+
+// Model capabilities reported in OpenAI model listings.
+const (
+	// CapabilityCompletion indicates that a model can generate text.
+	CapabilityCompletion = "completion"
+	// CapabilityEmbeddings indicates that a model can produce embeddings.
+	CapabilityEmbeddings = "embeddings"
+	// CapabilityTools indicates that a model's chat template supports tools.
+	CapabilityTools = "tools"
+	// CapabilityVision indicates that a model accepts image input.
+	CapabilityVision = "vision"
+)
+
+// ggufChatTemplateKey is the GGUF metadata key holding the chat template.
+const ggufChatTemplateKey = "tokenizer.chat_template"
+
+// ContextWindow returns the maximum context length of a model in tokens. It
+// returns nil if the context length is unknown.
+func ContextWindow(config types.Config) *uint64 {
+	if config.ContextSize != nil {
+		return config.ContextSize
+	}
+	if config.GGUF == nil {
+		return nil
+	}
+	architecture := config.GGUF["general.architecture"]
+	if architecture == "" {
+		architecture = config.Architecture
+	}
+	if v, ok := config.GGUF[architecture+".context_length"]; ok {
+		if parsed, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return &parsed
+		}
+	}
+	return nil
+}
+
+// ClassifierLabels returns the output labels of a sequence classification
+// model, in the order of its outputs. It returns nil if the labels are unknown.
+func ClassifierLabels(config types.Config) []string {
+	architecture := config.GGUF["general.architecture"]
+	if architecture == "" {
+		architecture = config.Architecture
+	}
+	labels, ok := config.GGUF[architecture+".classifier.output_labels"]
+	if config.Format == types.FormatONNX {
+		// ONNX models' labels are read from their id2label mapping when
+		// they're packaged.
+		labels, ok = config.ONNX["classifier.output_labels"]
+	}
+	if !ok || labels == "" {
+		return nil
+	}
+	return strings.Split(labels, ", ")
+}
+
+// Capabilities returns the capabilities of a model, as inferred from its
+// configuration and bundled files.
+func Capabilities(m types.Model) []string {
+	config, err := m.Config()
+	if err != nil {
+		return nil
+	}
+
+	if isEmbeddingModel(config) {
+		return []string{CapabilityEmbeddings}
+	}
+
+	capabilities := []string{CapabilityCompletion}
+	if strings.Contains(ChatTemplate(m), "tools") {
+		capabilities = append(capabilities, CapabilityTools)
+	}
+	if path, err := m.MMPROJPath(); err == nil && path != "" {
+		capabilities = append(capabilities, CapabilityVision)
+	}
+	return capabilities
+}
+
+// isEmbeddingModel returns whether a model's configuration describes an
+// embedding-only model.
+func isEmbeddingModel(config types.Config) bool {
+	architecture := config.GGUF["general.architecture"]
+	if architecture == "" {
+		architecture = config.Architecture
+	}
+	if strings.Contains(strings.ToLower(architecture), "bert") {
+		return true
+	}
+	_, hasPoolingType := config.GGUF[architecture+".pooling_type"]
+	return hasPoolingType
+}
+
+// ChatTemplate returns the chat template of a model, preferring a bundled
+// template file over the template embedded in the GGUF metadata. It returns an
+// empty string if the model has no known chat template.
+func ChatTemplate(m types.Model) string {
+	if path, err := m.ChatTemplatePath(); err == nil && path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			return string(data)
+		}
+	}
+	config, err := m.Config()
+	if err != nil {
+		return ""
+	}
+	return config.GGUF[ggufChatTemplateKey]
+}
+
+// SizeOnDisk returns the total size in bytes of the files making up a model.
+func SizeOnDisk(m types.Model) int64 {
+	var paths []string
+	if ggufPaths, err := m.GGUFPaths(); err == nil {
+		paths = append(paths, ggufPaths...)
+	}
+	if safetensorsPaths, err := m.SafetensorsPaths(); err == nil {
+		paths = append(paths, safetensorsPaths...)
+	}
+	if path, err := m.ONNXPath(); err == nil {
+		paths = append(paths, path)
+	}
+	if path, err := m.ConfigArchivePath(); err == nil {
+		paths = append(paths, path)
+	}
+	if path, err := m.MMPROJPath(); err == nil {
+		paths = append(paths, path)
+	}
+	if path, err := m.ChatTemplatePath(); err == nil {
+		paths = append(paths, path)
+	}
+
+	var size int64
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
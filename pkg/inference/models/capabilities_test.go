@@ -0,0 +1,139 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+)
+
+// stubModel is a minimal types.Model implementation for testing.
+type stubModel struct {
+	types.Model
+	config       types.Config
+	ggufPaths    []string
+	mmprojPath   string
+	templatePath string
+}
+
+func (m *stubModel) Config() (types.Config, error)         { return m.config, nil }
+func (m *stubModel) GGUFPaths() ([]string, error)          { return m.ggufPaths, nil }
+func (m *stubModel) SafetensorsPaths() ([]string, error)   { return nil, nil }
+func (m *stubModel) ONNXPath() (string, error)             { return "", nil }
+func (m *stubModel) ConfigArchivePath() (string, error)    { return "", nil }
+func (m *stubModel) MMPROJPath() (string, error)           { return m.mmprojPath, nil }
+func (m *stubModel) ChatTemplatePath() (string, error)     { return m.templatePath, nil }
+func (m *stubModel) Descriptor() (types.Descriptor, error) { return types.Descriptor{}, nil }
+
+func TestContextWindow(t *testing.T) {
+	configured := uint64(4096)
+	tests := []struct {
+		name     string
+		config   types.Config
+		expected *uint64
+	}{
+		{
+			name:     "configured context size takes precedence",
+			config:   types.Config{ContextSize: &configured, GGUF: map[string]string{"general.architecture": "llama", "llama.context_length": "8192"}},
+			expected: &configured,
+		},
+		{
+			name:     "context length from GGUF metadata",
+			config:   types.Config{GGUF: map[string]string{"general.architecture": "qwen3", "qwen3.context_length": "40960"}},
+			expected: func() *uint64 { v := uint64(40960); return &v }(),
+		},
+		{
+			name:   "unknown context length",
+			config: types.Config{Architecture: "llama"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ContextWindow(tt.config)
+			if (result == nil) != (tt.expected == nil) || (result != nil && *result != *tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestClassifierLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   types.Config
+		expected []string
+	}{
+		{
+			name:     "labels from GGUF metadata",
+			config:   types.Config{GGUF: map[string]string{"general.architecture": "bert", "bert.classifier.output_labels": "negative, positive"}},
+			expected: []string{"negative", "positive"},
+		},
+		{
+			name:     "labels from ONNX metadata",
+			config:   types.Config{Format: types.FormatONNX, ONNX: map[string]string{"classifier.output_labels": "safe, toxic"}},
+			expected: []string{"safe", "toxic"},
+		},
+		{
+			name:   "unknown labels",
+			config: types.Config{Format: types.FormatONNX},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := ClassifierLabels(tt.config); !slices.Equal(result, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "template.jinja")
+	if err := os.WriteFile(templatePath, []byte("{% if tools %}{{ tools }}{% endif %}"), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		model    *stubModel
+		expected []string
+	}{
+		{
+			name:     "plain completion model",
+			model:    &stubModel{config: types.Config{GGUF: map[string]string{"general.architecture": "llama"}}},
+			expected: []string{CapabilityCompletion},
+		},
+		{
+			name:     "embedding model",
+			model:    &stubModel{config: types.Config{GGUF: map[string]string{"general.architecture": "nomic-bert"}}},
+			expected: []string{CapabilityEmbeddings},
+		},
+		{
+			name: "tools from GGUF chat template",
+			model: &stubModel{config: types.Config{GGUF: map[string]string{
+				"general.architecture": "llama",
+				ggufChatTemplateKey:    "{% for tool in tools %}{% endfor %}",
+			}}},
+			expected: []string{CapabilityCompletion, CapabilityTools},
+		},
+		{
+			name:     "tools from bundled chat template and vision from projector",
+			model:    &stubModel{templatePath: templatePath, mmprojPath: "model.mmproj"},
+			expected: []string{CapabilityCompletion, CapabilityTools, CapabilityVision},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Capabilities(tt.model)
+			if !slices.Equal(result, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/model-runner/pkg/internal/utils"
+)
+
+// dropFolderNamespace is the namespace under which models discovered in the
+// drop folder are registered.
+const dropFolderNamespace = "local/"
+
+// dropFile tracks a GGUF file found in the drop folder.
+type dropFile struct {
+	// size is the file's size when it was last observed.
+	size int64
+	// modTime is the file's modification time when it was last observed.
+	modTime time.Time
+	// settled indicates that the file was observed unchanged across two
+	// polls and that registration has been attempted.
+	settled bool
+	// name is the name under which the file is mounted, or empty if it
+	// isn't mounted.
+	name string
+}
+
+// dropModelName derives a model name from the name of a GGUF file in the drop
+// folder, e.g. "local/smollm2-q4_k_m" for SmolLM2-Q4_K_M.gguf.
+func dropModelName(fileName string) string {
+	base := strings.ToLower(strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '-'
+	}, base)
+	name = strings.Trim(name, ".-_")
+	if name == "" {
+		return ""
+	}
+	return dropFolderNamespace + name
+}
+
+// WatchDropFolder watches dir for GGUF files until ctx is cancelled. Files
+// placed in the directory are mounted (see Mount) under the local/ namespace
+// once they've stopped changing, and are unmounted when they're removed.
+// Models unmounted via the API stay unmounted until their files are modified.
+func (m *Manager) WatchDropFolder(ctx context.Context, dir string) {
+	m.log.Infof("Watching %s for models", utils.SanitizeForLog(dir, -1))
+
+	ticker := time.NewTicker(mountPollInterval)
+	defer ticker.Stop()
+
+	files := make(map[string]*dropFile)
+	var lastErr string
+	for {
+		if err := m.scanDropFolder(dir, files); err != nil {
+			if err.Error() != lastErr {
+				m.log.Warnf("Failed to scan model drop folder: %v", err)
+			}
+			lastErr = err.Error()
+		} else {
+			lastErr = ""
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scanDropFolder performs a single scan of the drop folder, updating files
+// and mounting or unmounting models as necessary.
+func (m *Manager) scanDropFolder(dir string, files map[string]*dropFile) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".gguf") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		present[path] = true
+
+		// Wait for new files to stop changing (e.g. while being copied)
+		// before registering them. Files that failed to register or were
+		// unmounted via the API are retried once they're modified.
+		file, ok := files[path]
+		if !ok {
+			files[path] = &dropFile{size: info.Size(), modTime: info.ModTime()}
+			continue
+		}
+		if info.Size() != file.size || !info.ModTime().Equal(file.modTime) {
+			file.size, file.modTime = info.Size(), info.ModTime()
+			if mounted := m.mount(file.name); file.name == "" || mounted == nil || mounted.path != path {
+				file.name = ""
+				file.settled = false
+			}
+			continue
+		}
+		if file.settled {
+			continue
+		}
+		file.settled = true
+
+		name := dropModelName(entry.Name())
+		if name == "" {
+			m.log.Warnf("Ignoring %s in model drop folder: can't derive a model name", utils.SanitizeForLog(entry.Name(), -1))
+			continue
+		}
+		if existing := m.mount(name); existing != nil {
+			if existing.path == path {
+				file.name = name
+				continue
+			}
+			m.log.Warnf("Ignoring %s in model drop folder: %s is already mounted from %s",
+				utils.SanitizeForLog(entry.Name(), -1), name, utils.SanitizeForLog(existing.path, -1))
+			continue
+		}
+		if _, err := m.Mount(name, path); err != nil {
+			m.log.Warnf("Failed to register %s from model drop folder: %v", utils.SanitizeForLog(entry.Name(), -1), err)
+			continue
+		}
+		file.name = name
+	}
+
+	// Deregister models whose files have been removed.
+	for path, file := range files {
+		if present[path] {
+			continue
+		}
+		delete(files, path)
+		if file.name != "" {
+			m.unmountPath(file.name, path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestDropModelName(t *testing.T) {
+	for fileName, expected := range map[string]string{
+		"smollm2.gguf":            "local/smollm2",
+		"SmolLM2-Q4_K_M.GGUF":     "local/smollm2-q4_k_m",
+		"my model (v2).gguf":      "local/my-model--v2",
+		"qwen3.5-0.8b.gguf":       "local/qwen3.5-0.8b",
+		"!!!.gguf":                "",
+		"-leading-separator.gguf": "local/leading-separator",
+	} {
+		if actual := dropModelName(fileName); actual != expected {
+			t.Errorf("dropModelName(%q) = %q, expected %q", fileName, actual, expected)
+		}
+	}
+}
+
+func TestScanDropFolder(t *testing.T) {
+	log := logrus.NewEntry(logrus.StandardLogger())
+	manager := NewManager(log, ClientConfig{
+		StoreRootPath: t.TempDir(),
+		Logger:        log,
+	})
+
+	dir := t.TempDir()
+	content, err := os.ReadFile(filepath.Join(getProjectRoot(t), "assets", "dummy.gguf"))
+	if err != nil {
+		t.Fatalf("Failed to read test model: %v", err)
+	}
+	path := filepath.Join(dir, "Dummy.gguf")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to write test model: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a model"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	files := make(map[string]*dropFile)
+	scan := func() {
+		if err := manager.scanDropFolder(dir, files); err != nil {
+			t.Fatalf("Failed to scan drop folder: %v", err)
+		}
+	}
+
+	// New files aren't registered until they've stopped changing.
+	scan()
+	if _, err := manager.GetLocal("local/dummy"); err == nil {
+		t.Error("Expected model not to be registered after first scan")
+	}
+	scan()
+	if _, err := manager.GetLocal("local/dummy"); err != nil {
+		t.Fatalf("Expected model to be registered: %v", err)
+	}
+	models, err := manager.RawList()
+	if err != nil {
+		t.Fatalf("Failed to list models: %v", err)
+	}
+	if len(models) != 1 {
+		t.Errorf("Expected 1 model, got %d", len(models))
+	}
+
+	// Removing the file deregisters the model.
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove test model: %v", err)
+	}
+	scan()
+	if _, err := manager.GetLocal("local/dummy"); err == nil {
+		t.Error("Expected model to be deregistered")
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected no tracked files, got %d", len(files))
+	}
+}
@@ -8,17 +8,24 @@ import (
 	"html"
 	"net/http"
 	"path"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/docker/model-runner/pkg/distribution/distribution"
+	"github.com/docker/model-runner/pkg/distribution/objectstore"
 	"github.com/docker/model-runner/pkg/distribution/registry"
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/go-containerregistry/pkg/authn"
 	"github.com/docker/model-runner/pkg/inference"
 	"github.com/docker/model-runner/pkg/inference/memory"
+	"github.com/docker/model-runner/pkg/inference/quirks"
 	"github.com/docker/model-runner/pkg/internal/utils"
 	"github.com/docker/model-runner/pkg/logging"
 	"github.com/docker/model-runner/pkg/middleware"
+	"github.com/docker/model-runner/pkg/storage"
 	"github.com/sirupsen/logrus"
 )
 
@@ -42,8 +49,23 @@ type Handler struct {
 	memoryEstimator memory.MemoryEstimator
 	// manager handles business logic for model operations.
 	manager *Manager
+	// deleteListeners are called with the ID of each model deleted from the
+	// store.
+	deleteListeners []func(modelID string)
+	// loadedModels returns the IDs of models currently loaded by runners. It
+	// may be nil.
+	loadedModels func(ctx context.Context) map[string]bool
+	// scale scales the runners for a model. It may be nil.
+	scale ScaleFunc
+	// quirks holds the rules describing known quirks of models. It may be
+	// nil.
+	quirks *quirks.Registry
 }
 
+// ScaleFunc sets the desired number of runner replicas for a model and reports
+// the resulting replica counts.
+type ScaleFunc func(ctx context.Context, model types.Model, modelRef string, request ModelScaleRequest) (ModelScaleResponse, error)
+
 type ClientConfig struct {
 	// StoreRootPath is the root path for the model store.
 	StoreRootPath string
@@ -53,6 +75,15 @@ type ClientConfig struct {
 	Transport http.RoundTripper
 	// UserAgent is the user agent to use.
 	UserAgent string
+	// Metadata stores the models index, if set. Otherwise the index is
+	// stored under StoreRootPath.
+	Metadata storage.KV
+	// TrashRetention is how long deleted models stay in the trash before
+	// they're purged. It defaults to DefaultTrashRetention.
+	TrashRetention time.Duration
+	// Keychain resolves registry credentials, if set. Otherwise they come
+	// from the Docker configuration.
+	Keychain authn.Keychain
 }
 
 // NewHandler creates a new model's handler.
@@ -74,6 +105,9 @@ func NewHandler(log logging.Logger, c ClientConfig, allowedOrigins []string, mem
 		m.router.HandleFunc(route, handler)
 	}
 
+	// Forget the usage and pins of deleted models.
+	m.OnModelDeleted(m.manager.preferences.forget)
+
 	m.RebuildRoutes(allowedOrigins)
 
 	// Handler successfully initialized.
@@ -87,6 +121,61 @@ func (h *Handler) RebuildRoutes(allowedOrigins []string) {
 	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
 }
 
+// OnModelDeleted registers a function to be called with the ID of each model
+// that is deleted from the store.
+func (h *Handler) OnModelDeleted(fn func(modelID string)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.deleteListeners = append(h.deleteListeners, fn)
+}
+
+// SetLoadedModelsFunc sets the function used to determine which models are
+// currently loaded when reporting models using OpenAI conventions.
+func (h *Handler) SetLoadedModelsFunc(fn func(ctx context.Context) map[string]bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.loadedModels = fn
+}
+
+// SetScaleFunc sets the function used to scale the runners for a model.
+func (h *Handler) SetScaleFunc(fn ScaleFunc) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.scale = fn
+}
+
+// SetQuirks sets the registry of rules describing known quirks of models,
+// which are listed when models are inspected.
+func (h *Handler) SetQuirks(registry *quirks.Registry) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.quirks = registry
+}
+
+// Manager returns the handler's model manager.
+func (h *Handler) Manager() *Manager {
+	return h.manager
+}
+
+// isLoaded reports whether the model with the specified ID is in the set of
+// loaded models.
+func isLoaded(m types.Model, loaded map[string]bool) bool {
+	id, err := m.ID()
+	return err == nil && loaded[id]
+}
+
+// notifyModelDeleted notifies the delete listeners that a model was deleted.
+// The listeners are called without holding the lock, so that they may call
+// back into the handler.
+func (h *Handler) notifyModelDeleted(modelID string) {
+	h.lock.RLock()
+	listeners := slices.Clone(h.deleteListeners)
+	h.lock.RUnlock()
+	for _, fn := range listeners {
+		fn(modelID)
+	}
+}
+
 // NormalizeModelName adds the default organization prefix (ai/) and tag (:latest) if missing.
 // It also converts Hugging Face model names to lowercase.
 // Examples:
@@ -139,11 +228,15 @@ func (h *Handler) routeHandlers() map[string]http.HandlerFunc {
 		"POST " + inference.ModelsPrefix + "/create":                          h.handleCreateModel,
 		"POST " + inference.ModelsPrefix + "/load":                            h.handleLoadModel,
 		"POST " + inference.ModelsPrefix + "/package":                         h.handlePackageModel,
+		"POST " + inference.ModelsPrefix + "/mount":                           h.handleMountModel,
 		"GET " + inference.ModelsPrefix:                                       h.handleGetModels,
 		"GET " + inference.ModelsPrefix + "/{name...}":                        h.handleGetModel,
 		"DELETE " + inference.ModelsPrefix + "/{name...}":                     h.handleDeleteModel,
 		"POST " + inference.ModelsPrefix + "/{nameAndAction...}":              h.handleModelAction,
 		"DELETE " + inference.ModelsPrefix + "/purge":                         h.handlePurge,
+		"GET " + inference.ModelsPrefix + "/trash":                            h.handleListTrash,
+		"DELETE " + inference.ModelsPrefix + "/trash":                         h.handlePurgeTrash,
+		"DELETE " + inference.ModelsPrefix + "/trash/{name...}":               h.handlePurgeTrash,
 		"GET " + inference.InferencePrefix + "/{backend}/v1/models":           h.handleOpenAIGetModels,
 		"GET " + inference.InferencePrefix + "/{backend}/v1/models/{name...}": h.handleOpenAIGetModel,
 		"GET " + inference.InferencePrefix + "/v1/models":                     h.handleOpenAIGetModels,
@@ -160,6 +253,12 @@ func (h *Handler) handleCreateModel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Object storage URLs are pulled separately, since they don't name a model.
+	if objectstore.IsURL(request.From) {
+		h.pullFromObjectStore(w, r, request)
+		return
+	}
+
 	// Normalize the model name to add defaults
 	request.From = NormalizeModelName(request.From)
 
@@ -200,6 +299,11 @@ func (h *Handler) handleCreateModel(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Model not found", http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, ErrPullNotAllowed) {
+			h.log.Warnf("Refused to pull model %q: %v", request.From, err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		// Note: ErrUnsupportedFormat is no longer treated as an error - it's a warning
 		// that's sent to the client via the progress stream
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -207,6 +311,56 @@ func (h *Handler) handleCreateModel(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// pullFromObjectStore handles model creation requests whose source is an
+// object storage URL. The runtime memory check is skipped, since the model's
+// requirements can't be estimated before its archive is downloaded.
+func (h *Handler) pullFromObjectStore(w http.ResponseWriter, r *http.Request, request ModelCreateRequest) {
+	location, err := objectstore.Parse(request.From)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tag := request.Tag
+	if tag == "" {
+		tag = objectModelName(location)
+	}
+	tag = NormalizeModelName(tag)
+
+	if err := h.manager.PullFromObjectStore(request.From, tag, r, w); err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			h.log.Infof("Request canceled/timed out while pulling model from %q", utils.SanitizeForLog(request.From, -1))
+			return
+		}
+		if errors.Is(err, objectstore.ErrUnauthorized) {
+			h.log.Warnf("Unauthorized to pull model from %q: %v", utils.SanitizeForLog(request.From, -1), err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, objectstore.ErrObjectNotFound) {
+			h.log.Warnf("Failed to pull model from %q: %v", utils.SanitizeForLog(request.From, -1), err)
+			http.Error(w, "Object not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrPullNotAllowed) {
+			h.log.Warnf("Refused to pull model from %q: %v", utils.SanitizeForLog(request.From, -1), err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// objectModelName derives a model name from the name of an object holding a
+// model archive, e.g. "smollm2" for s3://bucket/models/SmolLM2.tar.gz.
+func objectModelName(location objectstore.Location) string {
+	name := strings.ToLower(location.Name())
+	for _, suffix := range []string{".gz", ".tgz", ".tar"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return name
+}
+
 // handleLoadModel handles POST <inference-prefix>/models/load requests.
 func (h *Handler) handleLoadModel(w http.ResponseWriter, r *http.Request) {
 	err := h.manager.Load(r.Body, w)
@@ -216,13 +370,22 @@ func (h *Handler) handleLoadModel(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleGetModels handles GET <inference-prefix>/models requests.
+// handleGetModels handles GET <inference-prefix>/models requests. Models are
+// filtered by the label query parameters, if any.
 func (h *Handler) handleGetModels(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLabelFilter(r.URL.Query()["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	apiModels, err := h.manager.List()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	apiModels = slices.DeleteFunc(apiModels, func(model *Model) bool {
+		return !MatchLabels(model.Labels, filter)
+	})
 
 	// Write the response.
 	w.Header().Set("Content-Type", "application/json")
@@ -234,6 +397,10 @@ func (h *Handler) handleGetModels(w http.ResponseWriter, r *http.Request) {
 // handleGetModel handles GET <inference-prefix>/models/{name} requests.
 func (h *Handler) handleGetModel(w http.ResponseWriter, r *http.Request) {
 	modelRef := r.PathValue("name")
+	if model, ok := strings.CutSuffix(modelRef, "/inspect"); ok {
+		h.handleInspectModel(w, model)
+		return
+	}
 
 	// Parse remote query parameter
 	remote := false
@@ -261,6 +428,9 @@ func (h *Handler) handleGetModel(w http.ResponseWriter, r *http.Request) {
 		h.writeModelError(w, err)
 		return
 	}
+	if !remote {
+		apiModel.Labels = h.manager.preferences.get(apiModel.ID).Labels
+	}
 
 	// Write the response.
 	w.Header().Set("Content-Type", "application/json")
@@ -269,6 +439,38 @@ func (h *Handler) handleGetModel(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleInspectModel handles GET <inference-prefix>/models/{name}/inspect
+// requests, which describe a local model along with the workarounds applied to
+// it when it's loaded.
+func (h *Handler) handleInspectModel(w http.ResponseWriter, modelRef string) {
+	apiModel, err := h.getLocalAPIModel(modelRef)
+	if err != nil {
+		h.writeModelError(w, err)
+		return
+	}
+	model, err := h.manager.GetLocal(apiModel.ID)
+	if err != nil {
+		h.writeModelError(w, err)
+		return
+	}
+	apiModel.Labels = h.manager.preferences.get(apiModel.ID).Labels
+
+	inspection := ModelInspection{Model: *apiModel, Workarounds: []quirks.Rule{}}
+	h.lock.RLock()
+	registry := h.quirks
+	h.lock.RUnlock()
+	if registry != nil {
+		if rules := registry.Workarounds(apiModel.Config, ChatTemplate(model)).Rules; rules != nil {
+			inspection.Workarounds = rules
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(inspection); err != nil {
+		h.log.Warnln("Error while encoding model inspection:", err)
+	}
+}
+
 func (h *Handler) getRemoteAPIModel(ctx context.Context, modelRef string) (*Model, error) {
 	model, err := h.manager.GetRemote(ctx, modelRef)
 	if err != nil {
@@ -337,6 +539,7 @@ func findModelByPartialName(h *Handler, modelRef string) (*Model, error) {
 // handleDeleteModel handles DELETE <inference-prefix>/models/{name} requests.
 // query params:
 // - force: if true, delete the model even if it has multiple tags
+// - trash: if true, move the model to the trash instead of deleting it
 func (h *Handler) handleDeleteModel(w http.ResponseWriter, r *http.Request) {
 	// TODO: We probably want the manager to have a lock / unlock mechanism for
 	// models so that active runners can retain / release a model, analogous to
@@ -358,13 +561,23 @@ func (h *Handler) handleDeleteModel(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	deleteModel := h.manager.Delete
+	if r.URL.Query().Has("trash") {
+		if trash, err := strconv.ParseBool(r.URL.Query().Get("trash")); err != nil {
+			http.Error(w, "trash must be a boolean", http.StatusBadRequest)
+			return
+		} else if trash {
+			deleteModel = h.manager.Trash
+		}
+	}
+
 	// First try to delete without normalization (as ID), then with normalization if not found
-	resp, err := h.manager.Delete(modelRef, force)
+	resp, err := deleteModel(modelRef, force)
 	if err != nil && errors.Is(err, distribution.ErrModelNotFound) {
 		// If not found as-is, try with normalization
 		normalizedRef := NormalizeModelName(modelRef)
 		if normalizedRef != modelRef { // only try normalized if it's different
-			resp, err = h.manager.Delete(normalizedRef, force)
+			resp, err = deleteModel(normalizedRef, force)
 		}
 	}
 
@@ -382,6 +595,12 @@ func (h *Handler) handleDeleteModel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, action := range *resp {
+		if action.Deleted != nil {
+			h.notifyModelDeleted(*action.Deleted)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		http.Error(w, fmt.Sprintf("error writing response: %v", err), http.StatusInternalServerError)
@@ -389,8 +608,16 @@ func (h *Handler) handleDeleteModel(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleOpenAIGetModels handles GET <inference-prefix>/<backend>/v1/models and
-// GET /<inference-prefix>/v1/models requests.
+// GET /<inference-prefix>/v1/models requests. Models are filtered by the label
+// query parameters, if any, and models that the client may not use aren't
+// listed.
 func (h *Handler) handleOpenAIGetModels(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLabelFilter(r.URL.Query()["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Query models.
 	available, err := h.manager.RawList()
 	if err != nil {
@@ -403,6 +630,21 @@ func (h *Handler) handleOpenAIGetModels(w http.ResponseWriter, r *http.Request)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	var loaded map[string]bool
+	if h.loadedModels != nil {
+		loaded = h.loadedModels(r.Context())
+	}
+	for i, model := range available {
+		models.Data[i].Loaded = isLoaded(model, loaded)
+		models.Data[i].setPreferences(h.manager.Preferences(model))
+	}
+	models.Data = slices.DeleteFunc(models.Data, func(model *OpenAIModel) bool {
+		return !MatchLabels(model.Labels, filter) || !permitted(r, model.Labels)
+	})
+	if models.Data, err = orderOpenAIModels(models.Data, r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Write the response.
 	w.Header().Set("Content-Type", "application/json")
@@ -416,6 +658,9 @@ func (h *Handler) handleOpenAIGetModels(w http.ResponseWriter, r *http.Request)
 func (h *Handler) handleOpenAIGetModel(w http.ResponseWriter, r *http.Request) {
 	modelRef := r.PathValue("name")
 	model, err := h.manager.GetLocal(modelRef)
+	if err == nil && !permitted(r, h.manager.Labels(model)) {
+		err = fmt.Errorf("%w: %s", distribution.ErrModelNotFound, modelRef)
+	}
 	if err != nil {
 		if errors.Is(err, distribution.ErrModelNotFound) {
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -432,6 +677,10 @@ func (h *Handler) handleOpenAIGetModel(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if h.loadedModels != nil {
+		openaiModel.Loaded = isLoaded(model, h.loadedModels(r.Context()))
+	}
+	openaiModel.setPreferences(h.manager.Preferences(model))
 	if err := json.NewEncoder(w).Encode(openaiModel); err != nil {
 		h.log.Warnln("Error while encoding OpenAI model response:", err)
 	}
@@ -441,6 +690,10 @@ func (h *Handler) handleOpenAIGetModel(w http.ResponseWriter, r *http.Request) {
 // Action is one of:
 // - tag: tag the model with a repository and tag (e.g. POST <inference-prefix>/models/my-org/my-repo:latest/tag})
 // - push: pushes a tagged model to the registry
+// - scale: scales the runners for a model
+// - pin, unpin: pins a model as a favorite, or unpins it
+// - restore: restores a model from the trash
+// - labels: sets and removes labels of a model
 func (h *Handler) handleModelAction(w http.ResponseWriter, r *http.Request) {
 	model, action := path.Split(r.PathValue("nameAndAction"))
 	model = strings.TrimRight(model, "/")
@@ -452,6 +705,14 @@ func (h *Handler) handleModelAction(w http.ResponseWriter, r *http.Request) {
 		h.handleTagModel(w, r, NormalizeModelName(model))
 	case "push":
 		h.handlePushModel(w, r, model)
+	case "scale":
+		h.handleScaleModel(w, r, model)
+	case "pin", "unpin":
+		h.handlePinModel(w, r, model, action == "pin")
+	case "restore":
+		h.handleRestoreModel(w, r, model)
+	case "labels":
+		h.handleLabelModel(w, r, model)
 	default:
 		http.Error(w, fmt.Sprintf("unknown action %q", action), http.StatusNotFound)
 	}
@@ -563,14 +824,143 @@ func (h *Handler) handlePackageModel(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleScaleModel handles POST <inference-prefix>/models/{name}/scale requests.
+func (h *Handler) handleScaleModel(w http.ResponseWriter, r *http.Request, model string) {
+	var request ModelScaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.lock.RLock()
+	scale := h.scale
+	h.lock.RUnlock()
+	if scale == nil {
+		http.Error(w, "scaling is not supported", http.StatusNotImplemented)
+		return
+	}
+
+	mdl, err := h.manager.GetLocal(model)
+	if err != nil {
+		if errors.Is(err, distribution.ErrModelNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response, err := scale(r.Context(), mdl, model, request)
+	if err != nil {
+		if errors.Is(err, ErrInvalidScaleRequest) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.log.Warnf("Failed to scale %q: %v", utils.SanitizeForLog(model, -1), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Warnln("Error while encoding scale response:", err)
+	}
+}
+
+// handlePinModel handles POST <inference-prefix>/models/{name}/pin and
+// POST <inference-prefix>/models/{name}/unpin requests, responding with the
+// model using OpenAI conventions.
+func (h *Handler) handlePinModel(w http.ResponseWriter, r *http.Request, model string, pinned bool) {
+	mdl, err := h.manager.SetPinned(model, pinned)
+	if err != nil {
+		if errors.Is(err, distribution.ErrModelNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.log.Warnf("Failed to pin %q: %v", utils.SanitizeForLog(model, -1), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	openaiModel, err := ToOpenAI(mdl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.loadedModels != nil {
+		openaiModel.Loaded = isLoaded(mdl, h.loadedModels(r.Context()))
+	}
+	openaiModel.setPreferences(h.manager.Preferences(mdl))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(openaiModel); err != nil {
+		h.log.Warnln("Error while encoding pin response:", err)
+	}
+}
+
+// handleMountModel handles POST <inference-prefix>/models/mount requests.
+func (h *Handler) handleMountModel(w http.ResponseWriter, r *http.Request) {
+	// Decode the request
+	var request ModelMountRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate required fields
+	if request.Path == "" || request.Name == "" {
+		http.Error(w, "both 'path' and 'name' fields are required", http.StatusBadRequest)
+		return
+	}
+
+	model, err := h.manager.Mount(request.Name, request.Path)
+	if err != nil {
+		if errors.Is(err, ErrInvalidMount) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, distribution.ErrConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		h.log.Warnf("Failed to mount %q: %v", utils.SanitizeForLog(request.Path, -1), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiModel, err := ToModel(model)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(apiModel); err != nil {
+		h.log.Warnln("Error while encoding mount response:", err)
+	}
+}
+
 // handlePurge handles DELETE <inference-prefix>/models/purge requests.
 func (h *Handler) handlePurge(w http.ResponseWriter, _ *http.Request) {
+	// Collect the IDs of the models being purged so that listeners can be
+	// notified once the store has been reset.
+	var purgedIDs []string
+	if available, err := h.manager.RawList(); err == nil {
+		for _, model := range available {
+			if id, err := model.ID(); err == nil {
+				purgedIDs = append(purgedIDs, id)
+			}
+		}
+	}
+
 	err := h.manager.Purge()
 	if err != nil {
 		h.log.Warnf("Failed to purge models: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	for _, id := range purgedIDs {
+		h.notifyModelDeleted(id)
+	}
 }
 
 // ServeHTTP implement net/http.Handler.ServeHTTP.
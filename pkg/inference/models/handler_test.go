@@ -10,11 +10,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/docker/model-runner/pkg/go-containerregistry/pkg/registry"
 
 	"github.com/docker/model-runner/pkg/distribution/builder"
+	"github.com/docker/model-runner/pkg/distribution/objectstore"
 	reg "github.com/docker/model-runner/pkg/distribution/registry"
 	"github.com/docker/model-runner/pkg/inference"
 	"github.com/docker/model-runner/pkg/inference/memory"
@@ -331,3 +334,45 @@ func TestCors(t *testing.T) {
 		})
 	}
 }
+
+func TestObjectModelName(t *testing.T) {
+	tests := map[string]string{
+		"s3://bucket/models/SmolLM2.tar.gz": "smollm2",
+		"gs://bucket/gemma3.tgz":            "gemma3",
+		"az://account/container/qwen3.tar":  "qwen3",
+		"s3://bucket/llama":                 "llama",
+	}
+	for objectURL, expected := range tests {
+		location, err := objectstore.Parse(objectURL)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", objectURL, err)
+		}
+		if actual := objectModelName(location); actual != expected {
+			t.Errorf("objectModelName(%q) = %q, expected %q", objectURL, actual, expected)
+		}
+	}
+}
+
+func TestNotifyModelDeletedConcurrently(t *testing.T) {
+	log := logrus.NewEntry(logrus.StandardLogger())
+	handler := NewHandler(log, ClientConfig{StoreRootPath: t.TempDir(), Logger: log, Transport: http.DefaultTransport}, nil, &mockMemoryEstimator{})
+	var notified atomic.Int64
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			handler.OnModelDeleted(func(string) { notified.Add(1) })
+		}()
+		go func() {
+			defer wg.Done()
+			handler.notifyModelDeleted("sha256:deleted")
+		}()
+	}
+	wg.Wait()
+	notified.Store(0)
+	handler.notifyModelDeleted("sha256:deleted")
+	if n := notified.Load(); n != 10 {
+		t.Errorf("Expected 10 listeners to be notified, got %d", n)
+	}
+}
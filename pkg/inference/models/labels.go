@@ -0,0 +1,191 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/distribution/distribution"
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// maxLabels is the maximum number of labels per model.
+	maxLabels = 64
+	// maxLabelValueLength is the maximum length of label values.
+	maxLabelValueLength = 256
+)
+
+// labelKeyPattern matches valid label keys, e.g. "team" or
+// "example.com/approved".
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,126}[A-Za-z0-9])?$`)
+
+// ErrInvalidLabels indicates that a request to change a model's labels is
+// invalid.
+var ErrInvalidLabels = errors.New("invalid labels")
+
+// ModelLabelsRequest represents a request to change a model's labels.
+type ModelLabelsRequest struct {
+	// Labels are the labels to set, replacing the values of existing labels
+	// with the same keys.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Remove are the keys of the labels to remove.
+	Remove []string `json:"remove,omitempty"`
+}
+
+// validateLabelKey returns an error if a label key is invalid.
+func validateLabelKey(key string) error {
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("%w: key %q is invalid, since keys must be at most 128 alphanumeric, '.', '_', '/', or '-' characters, starting and ending with an alphanumeric character", ErrInvalidLabels, key)
+	}
+	return nil
+}
+
+// MatchLabels returns whether a model's labels satisfy the required labels.
+// A required label with an empty value only needs to be present.
+func MatchLabels(labels, required map[string]string) bool {
+	for key, value := range required {
+		actual, ok := labels[key]
+		if !ok || (value != "" && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLabelFilter parses label query parameters, each of which is either a
+// key, which matches models with that label, or key=value, which matches
+// models whose label has that value.
+func parseLabelFilter(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	filter := make(map[string]string, len(values))
+	for _, value := range values {
+		key, labelValue, _ := strings.Cut(value, "=")
+		if err := validateLabelKey(key); err != nil {
+			return nil, err
+		}
+		filter[key] = labelValue
+	}
+	return filter, nil
+}
+
+// setLabels sets and removes labels of a model.
+func (p *preferences) setLabels(id string, set map[string]string, remove []string) (ModelPreferences, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	preferences := p.models[id]
+	// Labels are replaced rather than modified, since get returns them to
+	// callers without copying.
+	labels := maps.Clone(preferences.Labels)
+	if labels == nil {
+		labels = make(map[string]string, len(set))
+	}
+	for _, key := range remove {
+		delete(labels, key)
+	}
+	maps.Copy(labels, set)
+	if len(labels) > maxLabels {
+		return ModelPreferences{}, fmt.Errorf("%w: models can have at most %d labels", ErrInvalidLabels, maxLabels)
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+	preferences.Labels = labels
+	p.models[id] = preferences
+	return preferences, p.save()
+}
+
+// SetLabels sets and removes labels of a model. Labels are kept by model ID,
+// so they're shared by the model's tags.
+func (m *Manager) SetLabels(ref string, request ModelLabelsRequest) (types.Model, error) {
+	for key, value := range request.Labels {
+		if err := validateLabelKey(key); err != nil {
+			return nil, err
+		}
+		if len(value) > maxLabelValueLength {
+			return nil, fmt.Errorf("%w: the value of label %q is longer than %d characters", ErrInvalidLabels, key, maxLabelValueLength)
+		}
+	}
+	model, err := m.GetLocal(ref)
+	if err != nil {
+		return nil, err
+	}
+	id, err := model.ID()
+	if err != nil {
+		return nil, fmt.Errorf("get model ID: %w", err)
+	}
+	if _, err := m.preferences.setLabels(id, request.Labels, request.Remove); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// Labels returns the labels of a model.
+func (m *Manager) Labels(model types.Model) map[string]string {
+	return m.Preferences(model).Labels
+}
+
+// FormatLabels formats labels as a sorted, comma-separated list of key=value
+// pairs, or keys if their values are empty.
+func FormatLabels(labels map[string]string) string {
+	formatted := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if value := labels[key]; value != "" {
+			formatted = append(formatted, key+"="+value)
+		} else {
+			formatted = append(formatted, key)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// permitted returns whether the identity of a request, if any, may use a
+// model with the specified labels.
+func permitted(r *http.Request, labels map[string]string) bool {
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	return !ok || MatchLabels(labels, identity.ModelLabels)
+}
+
+// handleLabelModel handles POST <inference-prefix>/models/{name}/labels
+// requests, responding with the model.
+func (h *Handler) handleLabelModel(w http.ResponseWriter, r *http.Request, model string) {
+	var request ModelLabelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	mdl, err := h.manager.SetLabels(model, request)
+	if err != nil {
+		if errors.Is(err, distribution.ErrModelNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrInvalidLabels) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.log.Warnf("Failed to label %q: %v", utils.SanitizeForLog(model, -1), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiModel, err := ToModel(mdl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	apiModel.Labels = h.manager.Labels(mdl)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(apiModel); err != nil {
+		h.log.Warnln("Error while encoding label response:", err)
+	}
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMatchLabels(t *testing.T) {
+	labels := map[string]string{"team": "search", "approved": "true"}
+	for _, tc := range []struct {
+		required map[string]string
+		want     bool
+	}{
+		{nil, true},
+		{map[string]string{"team": "search"}, true},
+		{map[string]string{"team": ""}, true},
+		{map[string]string{"team": "search", "approved": "true"}, true},
+		{map[string]string{"team": "ads"}, false},
+		{map[string]string{"purpose": ""}, false},
+	} {
+		if got := MatchLabels(labels, tc.required); got != tc.want {
+			t.Errorf("MatchLabels(%v, %v) = %v, expected %v", labels, tc.required, got, tc.want)
+		}
+	}
+}
+
+func TestModelLabels(t *testing.T) {
+	log := logrus.NewEntry(logrus.StandardLogger())
+	root := t.TempDir()
+	handler := NewHandler(log, ClientConfig{StoreRootPath: root, Logger: log}, nil, &mockMemoryEstimator{})
+	// The models need distinct files, since labels are kept by model ID.
+	for name, path := range map[string]string{
+		"dev/approved": filepath.Join("assets", "dummy.gguf"),
+		"dev/draft":    filepath.Join("pkg", "distribution", "assets", "dummy-00002-of-00002.gguf"),
+	} {
+		if _, err := handler.manager.Mount(name, filepath.Join(getProjectRoot(t), path)); err != nil {
+			t.Fatalf("Failed to mount model: %v", err)
+		}
+	}
+
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	label := func(model, body string) *httptest.ResponseRecorder {
+		return serve(httptest.NewRequest(http.MethodPost, inference.ModelsPrefix+"/"+model+"/labels", strings.NewReader(body)))
+	}
+	if w := label("dev/approved", `{"labels":{"team":"search","approved":"true","purpose":"chat"}}`); w.Code != http.StatusOK {
+		t.Fatalf("Failed to label model: %d %s", w.Code, w.Body.String())
+	}
+	w := label("dev/approved", `{"labels":{"purpose":"rag"},"remove":["team"]}`)
+	var model Model
+	if err := json.Unmarshal(w.Body.Bytes(), &model); err != nil {
+		t.Fatalf("Failed to decode model: %v", err)
+	}
+	if len(model.Labels) != 2 || model.Labels["approved"] != "true" || model.Labels["purpose"] != "rag" {
+		t.Errorf("Unexpected labels %v", model.Labels)
+	}
+	if w := label("dev/draft", `{"labels":{"team":"search"}}`); w.Code != http.StatusOK {
+		t.Fatalf("Failed to label model: %d %s", w.Code, w.Body.String())
+	}
+	if w := label("dev/draft", `{"labels":{"-invalid":"true"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid key, got %d", w.Code)
+	}
+	if w := label("dev/missing", `{"labels":{"team":"search"}}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing model, got %d", w.Code)
+	}
+
+	// Listings are filtered by labels.
+	var models []Model
+	w = serve(httptest.NewRequest(http.MethodGet, inference.ModelsPrefix+"?label=team", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &models); err != nil {
+		t.Fatalf("Failed to decode listing: %v", err)
+	}
+	if len(models) != 1 || models[0].Tags[0] != "dev/draft:latest" {
+		t.Errorf("Unexpected listing %s", w.Body.String())
+	}
+	var list OpenAIModelList
+	w = serve(httptest.NewRequest(http.MethodGet, inference.InferencePrefix+"/v1/models?label=approved=true", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode listing: %v", err)
+	}
+	if len(list.Data) != 1 || list.Data[0].ID != "dev/approved:latest" || list.Data[0].Labels["purpose"] != "rag" {
+		t.Errorf("Unexpected listing %s", w.Body.String())
+	}
+
+	// Clients restricted by model rules only see permitted models.
+	restricted := func(r *http.Request) *http.Request {
+		return r.WithContext(middleware.WithIdentity(r.Context(), middleware.Identity{
+			Role:        middleware.RoleInference,
+			ModelLabels: map[string]string{"approved": "true"},
+		}))
+	}
+	list = OpenAIModelList{}
+	w = serve(restricted(httptest.NewRequest(http.MethodGet, inference.InferencePrefix+"/v1/models", nil)))
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode listing: %v", err)
+	}
+	if len(list.Data) != 1 || list.Data[0].ID != "dev/approved:latest" {
+		t.Errorf("Unexpected listing %s", w.Body.String())
+	}
+	if w := serve(restricted(httptest.NewRequest(http.MethodGet, inference.InferencePrefix+"/v1/models/dev/draft", nil))); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a model that isn't permitted, got %d", w.Code)
+	}
+}
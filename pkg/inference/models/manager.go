@@ -1,12 +1,15 @@
 package models
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/model-runner/pkg/diskusage"
 	"github.com/docker/model-runner/pkg/distribution/builder"
@@ -22,6 +25,9 @@ const (
 	// maximumConcurrentModelPulls is the maximum number of concurrent model
 	// pulls that a model manager will allow.
 	maximumConcurrentModelPulls = 2
+	// mountChangesBuffer is the number of mounted model change notifications
+	// that can be pending delivery.
+	mountChangesBuffer = 16
 )
 
 // Manager handles the business logic for model management operations.
@@ -35,6 +41,25 @@ type Manager struct {
 	// pullTokens is a semaphore used to restrict the maximum number of
 	// concurrent pull requests.
 	pullTokens chan struct{}
+	// pullsLock guards pulls and pullPolicy.
+	pullsLock sync.Mutex
+	// pullPolicy returns an error if a model may not currently be pulled. It
+	// may be nil.
+	pullPolicy func(model string) error
+	// pulls maps normalized model names to the progress of in-progress
+	// pulls.
+	pulls map[string]*pullProgress
+	// mountsLock guards mounts.
+	mountsLock sync.Mutex
+	// mounts maps normalized model names to models mounted from local files.
+	mounts map[string]*mountedModel
+	// mountChanges carries the IDs of mounted models whose files have been
+	// modified.
+	mountChanges chan string
+	// preferences stores the usage and pins of models.
+	preferences *preferences
+	// trashRetention is how long deleted models stay in the trash.
+	trashRetention time.Duration
 }
 
 // NewManager creates a new model models with the provided clients.
@@ -45,6 +70,8 @@ func NewManager(log logging.Logger, c ClientConfig) *Manager {
 		distribution.WithLogger(c.Logger),
 		distribution.WithTransport(c.Transport),
 		distribution.WithUserAgent(c.UserAgent),
+		distribution.WithMetadataStorage(c.Metadata),
+		distribution.WithKeychain(c.Keychain),
 	)
 	if err != nil {
 		log.Errorf("Failed to create distribution client: %v", err)
@@ -56,6 +83,7 @@ func NewManager(log logging.Logger, c ClientConfig) *Manager {
 	registryClient := registry.NewClient(
 		registry.WithTransport(c.Transport),
 		registry.WithUserAgent(c.UserAgent),
+		registry.WithKeychain(c.Keychain),
 	)
 
 	tokens := make(chan struct{}, maximumConcurrentModelPulls)
@@ -70,12 +98,20 @@ func NewManager(log logging.Logger, c ClientConfig) *Manager {
 		distributionClient: distributionClient,
 		registryClient:     registryClient,
 		pullTokens:         tokens,
+		pulls:              make(map[string]*pullProgress),
+		mounts:             make(map[string]*mountedModel),
+		mountChanges:       make(chan string, mountChangesBuffer),
+		preferences:        newPreferences(log, c.Metadata, c.StoreRootPath),
+		trashRetention:     cmp.Or(c.TrashRetention, DefaultTrashRetention),
 	}
 }
 
 // GetLocal returns a single model by reference.
 // This is the core business logic for retrieving a model from the distribution client.
 func (m *Manager) GetLocal(ref string) (types.Model, error) {
+	if mounted := m.mount(ref); mounted != nil {
+		return mounted, nil
+	}
 	if m.distributionClient == nil {
 		return nil, fmt.Errorf("model distribution service unavailable")
 	}
@@ -160,6 +196,9 @@ func (m *Manager) BearerTokenForModel(ctx context.Context, ref string) (string,
 
 // GetBundle returns model bundle.
 func (m *Manager) GetBundle(ref string) (types.ModelBundle, error) {
+	if mounted := m.mount(ref); mounted != nil {
+		return mountBundle{model: mounted}, nil
+	}
 	bundle, err := m.distributionClient.GetBundle(ref)
 	if err != nil {
 		return nil, fmt.Errorf("error while getting model bundle: %w", err)
@@ -169,6 +208,9 @@ func (m *Manager) GetBundle(ref string) (types.ModelBundle, error) {
 
 // InStore checks if a given model is in the local store.
 func (m *Manager) InStore(ref string) (bool, error) {
+	if m.mount(ref) != nil {
+		return true, nil
+	}
 	return m.distributionClient.IsModelInStore(ref)
 }
 
@@ -186,6 +228,7 @@ func (m *Manager) List() ([]*Model, error) {
 			m.log.Warnf("error while converting model, skipping: %v", err)
 			continue
 		}
+		apiModel.Labels = m.preferences.get(apiModel.ID).Labels
 		apiModels = append(apiModels, apiModel)
 	}
 
@@ -200,11 +243,19 @@ func (m *Manager) RawList() ([]types.Model, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error while listing models: %w", err)
 	}
-	return models, nil
+	return append(models, m.mountedModels()...), nil
 }
 
 // Delete deletes a model from storage and returns the delete response
 func (m *Manager) Delete(reference string, force bool) (*distribution.DeleteModelResponse, error) {
+	// Deleting a mounted model removes the mount, leaving its file in place.
+	if mounted := m.unmount(reference); mounted != nil {
+		return &distribution.DeleteModelResponse{
+			{Untagged: &mounted.name},
+			{Deleted: &mounted.id},
+		}, nil
+	}
+
 	if m.distributionClient == nil {
 		return nil, errors.New("model distribution service unavailable")
 	}
@@ -219,6 +270,46 @@ func (m *Manager) Delete(reference string, force bool) (*distribution.DeleteMode
 // Pull pulls a model to local storage. Any error it returns is suitable
 // for writing back to the client.
 func (m *Manager) Pull(model string, bearerToken string, r *http.Request, w http.ResponseWriter) error {
+	return m.pull(model, r, w, func(progressWriter io.Writer) error {
+		// Use bearer token if provided
+		if bearerToken != "" {
+			m.log.Infoln("Using provided bearer token for authentication")
+			return m.distributionClient.PullModel(r.Context(), model, progressWriter, bearerToken)
+		}
+		return m.distributionClient.PullModel(r.Context(), model, progressWriter)
+	})
+}
+
+// PullFromObjectStore pulls a model archive from an object storage URL and
+// tags it, streaming progress to w in the same format as Pull.
+func (m *Manager) PullFromObjectStore(objectURL, tag string, r *http.Request, w http.ResponseWriter) error {
+	return m.pull(tag, r, w, func(progressWriter io.Writer) error {
+		m.log.Infoln("Pulling from:", utils.SanitizeForLog(objectURL, -1))
+		_, err := m.distributionClient.PullFromObjectStore(r.Context(), objectURL, tag, progressWriter)
+		return err
+	})
+}
+
+// SetPullPolicy sets the function used to determine whether a model may
+// currently be pulled.
+func (m *Manager) SetPullPolicy(policy func(model string) error) {
+	m.pullsLock.Lock()
+	defer m.pullsLock.Unlock()
+	m.pullPolicy = policy
+}
+
+// pull performs a pull of the named model, streaming its progress to w.
+func (m *Manager) pull(model string, r *http.Request, w http.ResponseWriter, pull func(progressWriter io.Writer) error) error {
+	// Enforce the pull policy.
+	m.pullsLock.Lock()
+	policy := m.pullPolicy
+	m.pullsLock.Unlock()
+	if policy != nil {
+		if err := policy(model); err != nil {
+			return fmt.Errorf("%w: %w", ErrPullNotAllowed, err)
+		}
+	}
+
 	// Restrict model pull concurrency.
 	select {
 	case <-m.pullTokens:
@@ -261,16 +352,12 @@ func (m *Manager) Pull(model string, bearerToken string, r *http.Request, w http
 	// Pull the model using the Docker model distribution client
 	m.log.Infoln("Pulling model:", utils.SanitizeForLog(model, -1))
 
-	// Use bearer token if provided
-	var err error
-	if bearerToken != "" {
-		m.log.Infoln("Using provided bearer token for authentication")
-		err = m.distributionClient.PullModel(r.Context(), model, progressWriter, bearerToken)
-	} else {
-		err = m.distributionClient.PullModel(r.Context(), model, progressWriter)
-	}
+	// Track the pull's progress so that inference requests for the model can
+	// report it.
+	trackingWriter, untrack := m.trackPull(model, progressWriter)
+	defer untrack()
 
-	if err != nil {
+	if err := pull(trackingWriter); err != nil {
 		return fmt.Errorf("error while pulling model: %w", err)
 	}
 
@@ -469,5 +556,8 @@ func (m *Manager) Purge() error {
 		m.log.Warnf("Failed to purge models: %v", err)
 		return fmt.Errorf("error while purging models: %w", err)
 	}
+	for _, mounted := range m.mountedModels() {
+		m.unmount(mounted.(*mountedModel).name)
+	}
 	return nil
 }
@@ -0,0 +1,353 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/model-runner/pkg/distribution/builder"
+	"github.com/docker/model-runner/pkg/distribution/distribution"
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/internal/utils"
+)
+
+// mountPollInterval is the interval at which mounted model files are checked
+// for modifications. It's a variable so that it can be shortened in tests.
+var mountPollInterval = time.Second
+
+// ErrInvalidMount indicates that a local model file can't be mounted.
+var ErrInvalidMount = errors.New("invalid model mount")
+
+// mountedModel is a model served directly from a local GGUF file, without
+// being imported into the store. It implements types.Model.
+type mountedModel struct {
+	// name is the normalized name under which the model is mounted.
+	name string
+	// path is the absolute path to the GGUF file.
+	path string
+	// id is the model's ID. It's derived from the file's path (rather than
+	// its content) so that it (and any runner configuration associated with
+	// it) remains stable as the file is modified.
+	id string
+	// artifact is the model artifact built from the file.
+	artifact types.ModelArtifact
+	// size is the file's size when the artifact was built.
+	size int64
+	// modTime is the file's modification time when the artifact was built.
+	modTime time.Time
+	// stop signals the mount's watcher to exit.
+	stop chan struct{}
+}
+
+// newMountedModel builds a mounted model from the GGUF file at path.
+func newMountedModel(name, path string) (*mountedModel, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMount, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%w: %s is not a regular file", ErrInvalidMount, path)
+	}
+	bldr, err := builder.FromGGUF(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMount, err)
+	}
+	config, err := bldr.Model().Config()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading model config: %v", ErrInvalidMount, err)
+	}
+	if config.Format != types.FormatGGUF {
+		return nil, fmt.Errorf("%w: %s is not a GGUF file", ErrInvalidMount, path)
+	}
+	id := sha256.Sum256([]byte("mount:" + path))
+	return &mountedModel{
+		name:     name,
+		path:     path,
+		id:       "sha256:" + hex.EncodeToString(id[:]),
+		artifact: bldr.Model(),
+		size:     info.Size(),
+		modTime:  info.ModTime(),
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// ID implements types.Model.ID.
+func (m *mountedModel) ID() (string, error) {
+	return m.id, nil
+}
+
+// GGUFPaths implements types.Model.GGUFPaths.
+func (m *mountedModel) GGUFPaths() ([]string, error) {
+	return []string{m.path}, nil
+}
+
+// SafetensorsPaths implements types.Model.SafetensorsPaths.
+func (m *mountedModel) SafetensorsPaths() ([]string, error) {
+	return nil, nil
+}
+
+// ONNXPath implements types.Model.ONNXPath.
+func (m *mountedModel) ONNXPath() (string, error) {
+	return "", nil
+}
+
+// ConfigArchivePath implements types.Model.ConfigArchivePath.
+func (m *mountedModel) ConfigArchivePath() (string, error) {
+	return "", nil
+}
+
+// MMPROJPath implements types.Model.MMPROJPath.
+func (m *mountedModel) MMPROJPath() (string, error) {
+	return "", nil
+}
+
+// LoRAPaths implements types.Model.LoRAPaths.
+func (m *mountedModel) LoRAPaths() ([]string, error) {
+	return nil, nil
+}
+
+// Config implements types.Model.Config.
+func (m *mountedModel) Config() (types.Config, error) {
+	return m.artifact.Config()
+}
+
+// Tags implements types.Model.Tags.
+func (m *mountedModel) Tags() []string {
+	return []string{m.name}
+}
+
+// Descriptor implements types.Model.Descriptor.
+func (m *mountedModel) Descriptor() (types.Descriptor, error) {
+	return m.artifact.Descriptor()
+}
+
+// ChatTemplatePath implements types.Model.ChatTemplatePath.
+func (m *mountedModel) ChatTemplatePath() (string, error) {
+	return "", nil
+}
+
+// mountBundle is the runtime bundle of a mounted model. It implements
+// types.ModelBundle.
+type mountBundle struct {
+	// model is the mounted model.
+	model *mountedModel
+}
+
+// RootDir implements types.ModelBundle.RootDir.
+func (b mountBundle) RootDir() string {
+	return filepath.Dir(b.model.path)
+}
+
+// GGUFPath implements types.ModelBundle.GGUFPath.
+func (b mountBundle) GGUFPath() string {
+	return b.model.path
+}
+
+// SafetensorsPath implements types.ModelBundle.SafetensorsPath.
+func (b mountBundle) SafetensorsPath() string {
+	return ""
+}
+
+// ONNXPath implements types.ModelBundle.ONNXPath.
+func (b mountBundle) ONNXPath() string {
+	return ""
+}
+
+// ChatTemplatePath implements types.ModelBundle.ChatTemplatePath.
+func (b mountBundle) ChatTemplatePath() string {
+	return ""
+}
+
+// MMPROJPath implements types.ModelBundle.MMPROJPath.
+func (b mountBundle) MMPROJPath() string {
+	return ""
+}
+
+// LoRAPaths implements types.ModelBundle.LoRAPaths.
+func (b mountBundle) LoRAPaths() []string {
+	return nil
+}
+
+// RuntimeConfig implements types.ModelBundle.RuntimeConfig.
+func (b mountBundle) RuntimeConfig() types.Config {
+	config, _ := b.model.Config()
+	return config
+}
+
+// Mount registers the GGUF file at path as a model with the specified name,
+// without importing it into the store. The file is watched for modifications,
+// and runners using the model are restarted when it changes. Mounting a name
+// that's already mounted replaces the existing mount.
+func (m *Manager) Mount(name, path string) (types.Model, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("%w: path %q must be absolute", ErrInvalidMount, path)
+	}
+	path = filepath.Clean(path)
+	name = NormalizeModelName(name)
+
+	// Mounted models can't shadow models in the store.
+	if m.distributionClient != nil {
+		if _, err := m.distributionClient.GetModel(name); err == nil {
+			return nil, fmt.Errorf("%w: model %q already exists in the store", distribution.ErrConflict, name)
+		}
+	}
+
+	mounted, err := newMountedModel(name, path)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mountsLock.Lock()
+	existing, replaced := m.mounts[name]
+	if replaced {
+		close(existing.stop)
+	}
+	m.mounts[name] = mounted
+	m.mountsLock.Unlock()
+
+	m.log.Infof("Mounted %s as %s", utils.SanitizeForLog(path, -1), utils.SanitizeForLog(name, -1))
+	go m.watchMount(mounted)
+
+	// Runners using a replaced mount are no longer up to date.
+	if replaced {
+		m.notifyMountChanged(existing)
+	}
+	return mounted, nil
+}
+
+// unmount removes the mount matching ref (a name or ID), returning the
+// unmounted model or nil if no mount matched.
+func (m *Manager) unmount(ref string) *mountedModel {
+	m.mountsLock.Lock()
+	defer m.mountsLock.Unlock()
+	mounted := m.mountLocked(ref)
+	if mounted == nil {
+		return nil
+	}
+	close(mounted.stop)
+	delete(m.mounts, mounted.name)
+	m.log.Infof("Unmounted %s", utils.SanitizeForLog(mounted.name, -1))
+	return mounted
+}
+
+// unmountPath removes the mount with the specified name if it's mounted from
+// path.
+func (m *Manager) unmountPath(name, path string) {
+	m.mountsLock.Lock()
+	defer m.mountsLock.Unlock()
+	name = NormalizeModelName(name)
+	mounted, ok := m.mounts[name]
+	if !ok || mounted.path != path {
+		return
+	}
+	close(mounted.stop)
+	delete(m.mounts, name)
+	m.log.Infof("Unmounted %s", utils.SanitizeForLog(name, -1))
+}
+
+// mount returns the mounted model matching ref (a name or ID), or nil if no
+// mount matches.
+func (m *Manager) mount(ref string) *mountedModel {
+	m.mountsLock.Lock()
+	defer m.mountsLock.Unlock()
+	return m.mountLocked(ref)
+}
+
+// mountLocked implements mount. The caller must hold mountsLock.
+func (m *Manager) mountLocked(ref string) *mountedModel {
+	if mounted, ok := m.mounts[NormalizeModelName(ref)]; ok {
+		return mounted
+	}
+	if strings.HasPrefix(ref, "sha256:") {
+		for _, mounted := range m.mounts {
+			if mounted.id == ref {
+				return mounted
+			}
+		}
+	}
+	return nil
+}
+
+// mountedModels returns all mounted models.
+func (m *Manager) mountedModels() []types.Model {
+	m.mountsLock.Lock()
+	defer m.mountsLock.Unlock()
+	mounted := make([]types.Model, 0, len(m.mounts))
+	for _, model := range m.mounts {
+		mounted = append(mounted, model)
+	}
+	return mounted
+}
+
+// MountChanges returns a channel that receives the IDs of mounted models
+// whose files have been modified.
+func (m *Manager) MountChanges() <-chan string {
+	return m.mountChanges
+}
+
+// watchMount polls a mounted model's file for modifications until the mount
+// is removed. Once a modification is detected and the file has stopped
+// changing, the model is rebuilt from the file and its ID is sent to the
+// mount changes channel.
+func (m *Manager) watchMount(mounted *mountedModel) {
+	ticker := time.NewTicker(mountPollInterval)
+	defer ticker.Stop()
+
+	size, modTime := mounted.size, mounted.modTime
+	for {
+		select {
+		case <-mounted.stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(mounted.path)
+		if err != nil {
+			// The file may be in the process of being replaced.
+			continue
+		}
+		if info.Size() != size || !info.ModTime().Equal(modTime) {
+			// Wait for the file to stop changing before reloading it.
+			size, modTime = info.Size(), info.ModTime()
+			continue
+		}
+		if size == mounted.size && modTime.Equal(mounted.modTime) {
+			continue
+		}
+
+		updated, err := newMountedModel(mounted.name, mounted.path)
+		if err != nil {
+			m.log.Warnf("Failed to reload mounted model %s: %v", utils.SanitizeForLog(mounted.name, -1), err)
+			// Don't retry until the file changes again.
+			mounted.size, mounted.modTime = size, modTime
+			continue
+		}
+		updated.stop = mounted.stop
+
+		m.mountsLock.Lock()
+		if m.mounts[mounted.name] != mounted {
+			m.mountsLock.Unlock()
+			return
+		}
+		m.mounts[mounted.name] = updated
+		m.mountsLock.Unlock()
+		mounted = updated
+
+		m.log.Infof("Mounted model %s changed, restarting its runners", utils.SanitizeForLog(mounted.name, -1))
+		m.notifyMountChanged(mounted)
+	}
+}
+
+// notifyMountChanged sends a mounted model's ID to the mount changes channel.
+func (m *Manager) notifyMountChanged(mounted *mountedModel) {
+	select {
+	case m.mountChanges <- mounted.id:
+	default:
+		m.log.Warnf("Dropped change notification for mounted model %s", utils.SanitizeForLog(mounted.name, -1))
+	}
+}
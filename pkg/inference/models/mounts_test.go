@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMount(t *testing.T) {
+	mountPollInterval = 10 * time.Millisecond
+	defer func() { mountPollInterval = time.Second }()
+
+	log := logrus.NewEntry(logrus.StandardLogger())
+	manager := NewManager(log, ClientConfig{
+		StoreRootPath: t.TempDir(),
+		Logger:        log,
+	})
+
+	// Copy the test model so that it can be modified.
+	content, err := os.ReadFile(filepath.Join(getProjectRoot(t), "assets", "dummy.gguf"))
+	if err != nil {
+		t.Fatalf("Failed to read test model: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "dummy.gguf")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to write test model: %v", err)
+	}
+
+	t.Run("invalid mounts", func(t *testing.T) {
+		if _, err := manager.Mount("ai/relative", "dummy.gguf"); !errors.Is(err, ErrInvalidMount) {
+			t.Errorf("Expected ErrInvalidMount for relative path, got %v", err)
+		}
+		notGGUF := filepath.Join(t.TempDir(), "model.txt")
+		if err := os.WriteFile(notGGUF, []byte("not a model"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if _, err := manager.Mount("ai/text", notGGUF); !errors.Is(err, ErrInvalidMount) {
+			t.Errorf("Expected ErrInvalidMount for non-GGUF file, got %v", err)
+		}
+	})
+
+	model, err := manager.Mount("dev/dummy", path)
+	if err != nil {
+		t.Fatalf("Failed to mount model: %v", err)
+	}
+	id, err := model.ID()
+	if err != nil {
+		t.Fatalf("Failed to get model ID: %v", err)
+	}
+
+	for _, ref := range []string{"dev/dummy", "dev/dummy:latest", id} {
+		if _, err := manager.GetLocal(ref); err != nil {
+			t.Errorf("Failed to get mounted model by %q: %v", ref, err)
+		}
+	}
+	bundle, err := manager.GetBundle("dev/dummy")
+	if err != nil {
+		t.Fatalf("Failed to get bundle: %v", err)
+	}
+	if bundle.GGUFPath() != path {
+		t.Errorf("Expected bundle GGUF path %s, got %s", path, bundle.GGUFPath())
+	}
+	models, err := manager.RawList()
+	if err != nil {
+		t.Fatalf("Failed to list models: %v", err)
+	}
+	if len(models) != 1 {
+		t.Errorf("Expected 1 model, got %d", len(models))
+	}
+
+	// Modifying the file should trigger a change notification.
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to modify test model: %v", err)
+	}
+	select {
+	case changed := <-manager.MountChanges():
+		if changed != id {
+			t.Errorf("Expected change notification for %s, got %s", id, changed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for change notification")
+	}
+	if updated, err := manager.GetLocal("dev/dummy"); err != nil {
+		t.Errorf("Failed to get updated model: %v", err)
+	} else if updatedID, _ := updated.ID(); updatedID != id {
+		t.Errorf("Expected model ID to remain %s, got %s", id, updatedID)
+	}
+
+	// Deleting the model should unmount it without touching the file.
+	if _, err := manager.Delete("dev/dummy", false); err != nil {
+		t.Fatalf("Failed to delete mounted model: %v", err)
+	}
+	if manager.mount("dev/dummy") != nil {
+		t.Error("Expected model to be unmounted")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected mounted file to remain: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package models
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+const (
+	// preferencesKey is the metadata key of the model preferences.
+	preferencesKey = "preferences.json"
+	// preferencesSaveDelay is the delay with which usage is saved, so that
+	// bursts of requests are saved at once.
+	preferencesSaveDelay = 10 * time.Second
+)
+
+// Orders of model listings.
+const (
+	// OrderMostUsed orders models by descending request count.
+	OrderMostUsed = "most_used"
+	// OrderRecentlyUsed orders models by descending time of last use.
+	OrderRecentlyUsed = "recently_used"
+)
+
+// ModelPreferences are a model's usage, whether it's pinned, and its labels.
+// They're kept by model ID, so they're shared by the model's tags.
+type ModelPreferences struct {
+	// Pinned indicates whether the model is pinned as a favorite.
+	Pinned bool `json:"pinned,omitempty"`
+	// Requests is the number of inference requests made to the model.
+	Requests uint64 `json:"requests,omitempty"`
+	// LastUsed is the time of the model's last inference request, if any.
+	LastUsed time.Time `json:"last_used,omitzero"`
+	// Labels are arbitrary user labels, e.g. team=search or approved=true.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// preferences stores the preferences of models, either in metadata storage or
+// in a file in the store root path.
+type preferences struct {
+	log logging.Logger
+	// metadata stores the preferences, if set.
+	metadata storage.KV
+	// path is the file storing the preferences if metadata isn't set. If it's
+	// empty, the preferences aren't persisted.
+	path string
+	// m guards the fields below.
+	m sync.Mutex
+	// models maps model IDs to their preferences.
+	models map[string]ModelPreferences
+	// saving is true while usage is waiting to be saved.
+	saving bool
+}
+
+// newPreferences loads the preferences stored in metadata, or in the store
+// root path if metadata is nil.
+func newPreferences(log logging.Logger, metadata storage.KV, rootPath string) *preferences {
+	p := &preferences{log: log, metadata: metadata, models: make(map[string]ModelPreferences)}
+	if metadata == nil && rootPath != "" {
+		p.path = filepath.Join(rootPath, preferencesKey)
+	}
+
+	var data []byte
+	var err error
+	if p.metadata != nil {
+		data, err = p.metadata.Get(preferencesKey)
+	} else if p.path != "" {
+		data, err = os.ReadFile(p.path)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, storage.ErrNotFound) {
+		log.Warnf("Failed to read model preferences: %v", err)
+	} else if len(data) > 0 {
+		if err := json.Unmarshal(data, &p.models); err != nil {
+			log.Warnf("Failed to decode model preferences: %v", err)
+		}
+	}
+	return p
+}
+
+// get returns the preferences of a model.
+func (p *preferences) get(id string) ModelPreferences {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.models[id]
+}
+
+// recordUsage records a request to a model. Usage is saved with a delay.
+func (p *preferences) recordUsage(id string) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	preferences := p.models[id]
+	preferences.Requests++
+	preferences.LastUsed = time.Now()
+	p.models[id] = preferences
+	if !p.saving {
+		p.saving = true
+		time.AfterFunc(preferencesSaveDelay, func() {
+			p.m.Lock()
+			defer p.m.Unlock()
+			p.saving = false
+			if err := p.save(); err != nil {
+				p.log.Warnf("Failed to save model usage: %v", err)
+			}
+		})
+	}
+}
+
+// setPinned pins or unpins a model.
+func (p *preferences) setPinned(id string, pinned bool) (ModelPreferences, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	preferences := p.models[id]
+	preferences.Pinned = pinned
+	p.models[id] = preferences
+	return preferences, p.save()
+}
+
+// forget removes the preferences of a deleted model.
+func (p *preferences) forget(id string) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if _, ok := p.models[id]; !ok {
+		return
+	}
+	delete(p.models, id)
+	if err := p.save(); err != nil {
+		p.log.Warnf("Failed to save model preferences: %v", err)
+	}
+}
+
+// save saves the preferences. The caller must hold p.m.
+func (p *preferences) save() error {
+	data, err := json.Marshal(p.models)
+	if err != nil {
+		return fmt.Errorf("encoding model preferences: %w", err)
+	}
+	if p.metadata != nil {
+		err = p.metadata.Put(preferencesKey, data)
+	} else if p.path != "" {
+		err = os.WriteFile(p.path, data, 0o644)
+	}
+	if err != nil {
+		return fmt.Errorf("writing model preferences: %w", err)
+	}
+	return nil
+}
+
+// RecordUsage records an inference request to a model.
+func (m *Manager) RecordUsage(model types.Model) {
+	if id, err := model.ID(); err == nil {
+		m.preferences.recordUsage(id)
+	}
+}
+
+// SetPinned pins a model as a favorite, or unpins it.
+func (m *Manager) SetPinned(ref string, pinned bool) (types.Model, error) {
+	model, err := m.GetLocal(ref)
+	if err != nil {
+		return nil, err
+	}
+	id, err := model.ID()
+	if err != nil {
+		return nil, fmt.Errorf("get model ID: %w", err)
+	}
+	if _, err := m.preferences.setPinned(id, pinned); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// Preferences returns the preferences of a model.
+func (m *Manager) Preferences(model types.Model) ModelPreferences {
+	id, err := model.ID()
+	if err != nil {
+		return ModelPreferences{}
+	}
+	return m.preferences.get(id)
+}
+
+// setPreferences sets the preference fields of an OpenAI model.
+func (o *OpenAIModel) setPreferences(preferences ModelPreferences) {
+	o.Pinned = preferences.Pinned
+	o.Labels = preferences.Labels
+	o.Requests = preferences.Requests
+	if !preferences.LastUsed.IsZero() {
+		o.LastUsed = preferences.LastUsed.Unix()
+	}
+}
+
+// orderOpenAIModels filters and orders OpenAI models by their preferences,
+// according to the order, pinned_first, pinned, and limit query parameters.
+// Without them, the models are returned unchanged.
+func orderOpenAIModels(models []*OpenAIModel, query url.Values) ([]*OpenAIModel, error) {
+	parseBool := func(name string) (bool, error) {
+		value := query.Get(name)
+		if value == "" {
+			return false, nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("%s must be a boolean", name)
+		}
+		return b, nil
+	}
+	pinnedFirst, err := parseBool("pinned_first")
+	if err != nil {
+		return nil, err
+	}
+	pinnedOnly, err := parseBool("pinned")
+	if err != nil {
+		return nil, err
+	}
+
+	var compare func(a, b *OpenAIModel) int
+	switch order := query.Get("order"); order {
+	case "":
+	case OrderMostUsed:
+		compare = func(a, b *OpenAIModel) int {
+			return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(b.LastUsed, a.LastUsed))
+		}
+	case OrderRecentlyUsed:
+		compare = func(a, b *OpenAIModel) int {
+			return cmp.Or(cmp.Compare(b.LastUsed, a.LastUsed), cmp.Compare(b.Requests, a.Requests))
+		}
+	default:
+		return nil, fmt.Errorf("order must be %s or %s", OrderMostUsed, OrderRecentlyUsed)
+	}
+	if pinnedFirst {
+		byUsage := compare
+		compare = func(a, b *OpenAIModel) int {
+			if a.Pinned != b.Pinned {
+				if a.Pinned {
+					return -1
+				}
+				return 1
+			}
+			if byUsage == nil {
+				return 0
+			}
+			return byUsage(a, b)
+		}
+	}
+
+	if pinnedOnly {
+		models = slices.DeleteFunc(models, func(model *OpenAIModel) bool {
+			return !model.Pinned
+		})
+	}
+	if compare != nil {
+		slices.SortStableFunc(models, compare)
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit must be a positive integer")
+		}
+		models = models[:min(limit, len(models))]
+	}
+	return models, nil
+}
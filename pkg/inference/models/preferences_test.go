@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/sirupsen/logrus"
+)
+
+func TestOrderOpenAIModels(t *testing.T) {
+	models := func() []*OpenAIModel {
+		return []*OpenAIModel{
+			{ID: "ai/unused"},
+			{ID: "ai/frequent", Requests: 10, LastUsed: 100},
+			{ID: "ai/recent", Requests: 2, LastUsed: 200},
+			{ID: "ai/pinned", Pinned: true, Requests: 1, LastUsed: 50},
+		}
+	}
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"ai/unused", "ai/frequent", "ai/recent", "ai/pinned"}},
+		{"order=most_used", []string{"ai/frequent", "ai/recent", "ai/pinned", "ai/unused"}},
+		{"order=recently_used", []string{"ai/recent", "ai/frequent", "ai/pinned", "ai/unused"}},
+		{"order=most_used&pinned_first=true", []string{"ai/pinned", "ai/frequent", "ai/recent", "ai/unused"}},
+		{"pinned_first=true", []string{"ai/pinned", "ai/unused", "ai/frequent", "ai/recent"}},
+		{"pinned=true", []string{"ai/pinned"}},
+		{"order=recently_used&limit=2", []string{"ai/recent", "ai/frequent"}},
+	} {
+		query, _ := url.ParseQuery(tt.query)
+		ordered, err := orderOpenAIModels(models(), query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.query, err)
+		}
+		var ids []string
+		for _, model := range ordered {
+			ids = append(ids, model.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.want, ids)
+		}
+	}
+
+	for _, invalid := range []string{"order=alphabetical", "pinned_first=maybe", "pinned=2", "limit=0"} {
+		query, _ := url.ParseQuery(invalid)
+		if _, err := orderOpenAIModels(models(), query); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
+
+func TestModelPreferences(t *testing.T) {
+	log := logrus.NewEntry(logrus.StandardLogger())
+	root := t.TempDir()
+	handler := NewHandler(log, ClientConfig{StoreRootPath: root, Logger: log}, nil, &mockMemoryEstimator{})
+	model, err := handler.manager.Mount("dev/dummy", filepath.Join(getProjectRoot(t), "assets", "dummy.gguf"))
+	if err != nil {
+		t.Fatalf("Failed to mount model: %v", err)
+	}
+	handler.manager.RecordUsage(model)
+	handler.manager.RecordUsage(model)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	if w := serve(http.MethodPost, inference.ModelsPrefix+"/dev/missing/pin"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing model, got %d", w.Code)
+	}
+	if w := serve(http.MethodPost, inference.ModelsPrefix+"/dev/dummy/pin"); w.Code != http.StatusOK {
+		t.Fatalf("Failed to pin model: %d %s", w.Code, w.Body.String())
+	}
+
+	w := serve(http.MethodGet, inference.InferencePrefix+"/v1/models?pinned=true&order=most_used")
+	var list OpenAIModelList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode listing: %v", err)
+	}
+	if len(list.Data) != 1 || !list.Data[0].Pinned || list.Data[0].Requests != 2 || list.Data[0].LastUsed == 0 {
+		t.Errorf("Unexpected listing %s", w.Body.String())
+	}
+	if w := serve(http.MethodGet, inference.InferencePrefix+"/v1/models?order=name"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown order, got %d", w.Code)
+	}
+
+	// Pins are saved immediately, and are shared by the model's references.
+	id, _ := model.ID()
+	if preferences := newPreferences(log, nil, root).get(id); !preferences.Pinned {
+		t.Errorf("Expected the pin to be saved, got %+v", preferences)
+	}
+	if w := serve(http.MethodPost, inference.ModelsPrefix+"/"+id+"/unpin"); w.Code != http.StatusOK {
+		t.Fatalf("Failed to unpin model: %d %s", w.Code, w.Body.String())
+	}
+	if handler.manager.Preferences(model).Pinned {
+		t.Error("Expected the model to be unpinned")
+	}
+
+	// Deleted models are forgotten.
+	if w := serve(http.MethodDelete, inference.ModelsPrefix+"/dev/dummy"); w.Code != http.StatusOK {
+		t.Fatalf("Failed to delete model: %d %s", w.Code, w.Body.String())
+	}
+	if preferences := handler.manager.Preferences(model); preferences.Requests != 0 {
+		t.Errorf("Expected the model's preferences to be forgotten, got %+v", preferences)
+	}
+}
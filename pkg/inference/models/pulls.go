@@ -0,0 +1,155 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrModelDownloading indicates that a model can't be used because it's
+	// still being pulled.
+	ErrModelDownloading = errors.New("model still downloading")
+	// ErrModelIncomplete indicates that a model can't be used because some of
+	// its files are missing or partially written.
+	ErrModelIncomplete = errors.New("model incomplete")
+	// ErrPullNotAllowed indicates that a model may not currently be pulled,
+	// e.g. because pulls are restricted to certain times.
+	ErrPullNotAllowed = errors.New("pull not allowed")
+)
+
+// pullProgress tracks the progress of a model pull.
+type pullProgress struct {
+	// total is the total size of the model's layers.
+	total uint64
+	// layers maps layer IDs to the number of bytes transferred.
+	layers map[string]uint64
+}
+
+// percent returns the percentage of the model that has been transferred.
+func (p *pullProgress) percent() float64 {
+	if p.total == 0 {
+		return 0
+	}
+	var current uint64
+	for _, transferred := range p.layers {
+		current += transferred
+	}
+	return min(100, float64(current)*100/float64(p.total))
+}
+
+// progressMessage is the portion of a pull progress message used to track
+// pull progress.
+type progressMessage struct {
+	// Type is the message type.
+	Type string `json:"type"`
+	// Total is the total size of the model's layers.
+	Total uint64 `json:"total"`
+	// Layer describes the layer being transferred.
+	Layer struct {
+		// ID is the layer ID.
+		ID string `json:"id"`
+		// Current is the number of bytes of the layer transferred.
+		Current uint64 `json:"current"`
+	} `json:"layer"`
+}
+
+// pullTrackingWriter forwards pull progress messages to an underlying writer
+// while recording the pull's progress.
+type pullTrackingWriter struct {
+	// writer is the underlying progress writer.
+	writer io.Writer
+	// m is the manager tracking the pull.
+	m *Manager
+	// progress is the tracked progress.
+	progress *pullProgress
+	// mu serializes writes.
+	mu sync.Mutex
+	// buffer holds any incomplete message.
+	buffer bytes.Buffer
+}
+
+// Write implements io.Writer.Write.
+func (w *pullTrackingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buffer.Write(p)
+	for {
+		line, err := w.buffer.ReadBytes('\n')
+		if err != nil {
+			// Retain the incomplete message for the next write.
+			w.buffer.Write(line)
+			break
+		}
+		var message progressMessage
+		if json.Unmarshal(line, &message) == nil && message.Type == "progress" {
+			w.m.pullsLock.Lock()
+			w.progress.total = message.Total
+			if message.Layer.ID != "" {
+				w.progress.layers[message.Layer.ID] = message.Layer.Current
+			}
+			w.m.pullsLock.Unlock()
+		}
+	}
+	return w.writer.Write(p)
+}
+
+// trackPull registers a pull of the specified model and returns a progress
+// writer that records its progress, along with a function that deregisters
+// the pull once it completes.
+func (m *Manager) trackPull(model string, progressWriter io.Writer) (io.Writer, func()) {
+	key := NormalizeModelName(model)
+	progress := &pullProgress{layers: make(map[string]uint64)}
+
+	m.pullsLock.Lock()
+	m.pulls[key] = progress
+	m.pullsLock.Unlock()
+
+	return &pullTrackingWriter{writer: progressWriter, m: m, progress: progress}, func() {
+		m.pullsLock.Lock()
+		defer m.pullsLock.Unlock()
+		if m.pulls[key] == progress {
+			delete(m.pulls, key)
+		}
+	}
+}
+
+// CheckDownloading returns an error wrapping ErrModelDownloading if the
+// specified model is currently being pulled.
+func (m *Manager) CheckDownloading(ref string) error {
+	m.pullsLock.Lock()
+	defer m.pullsLock.Unlock()
+
+	progress, ok := m.pulls[NormalizeModelName(ref)]
+	if !ok {
+		return nil
+	}
+	return fmt.Errorf("%w: model %s is still downloading, %.0f%% complete",
+		ErrModelDownloading, ref, progress.percent())
+}
+
+// CheckComplete returns an error wrapping ErrModelIncomplete if any of the
+// specified model's layers are missing or partially written, e.g. because
+// the store was modified while the model was in use.
+func (m *Manager) CheckComplete(ref string) error {
+	// Mounted models are used directly from their files.
+	if m.mount(ref) != nil {
+		return nil
+	}
+	if m.distributionClient == nil {
+		return errors.New("model distribution service unavailable")
+	}
+	present, expected, err := m.distributionClient.ModelCompleteness(ref)
+	if err != nil {
+		return fmt.Errorf("error while checking model: %w", err)
+	}
+	if present < expected {
+		return fmt.Errorf("%w: model %s is missing data (%.0f%% present), pull it again",
+			ErrModelIncomplete, ref, float64(present)*100/float64(expected))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPullTracking(t *testing.T) {
+	log := logrus.NewEntry(logrus.StandardLogger())
+	manager := NewManager(log, ClientConfig{
+		StoreRootPath: t.TempDir(),
+		Logger:        log,
+	})
+
+	if err := manager.CheckDownloading("ai/model"); err != nil {
+		t.Fatalf("Expected no error before pull, got %v", err)
+	}
+
+	var output bytes.Buffer
+	writer, untrack := manager.trackPull("ai/model", &output)
+	messages := []string{
+		`{"type":"progress","total":400,"layer":{"id":"sha256:a","current":100}}`,
+		`{"type":"progress","total":400,"layer":{"id":"sha256:b","current":50}}`,
+		`{"type":"progress","total":400,"layer":{"id":"sha256:a","current":150}}`,
+	}
+	for _, message := range messages {
+		// Split messages across writes to exercise buffering.
+		half := len(message) / 2
+		fmt.Fprint(writer, message[:half])
+		fmt.Fprint(writer, message[half:]+"\n")
+	}
+	if output.String() != strings.Join(messages, "\n")+"\n" {
+		t.Errorf("Progress messages weren't forwarded unmodified: %q", output.String())
+	}
+
+	err := manager.CheckDownloading("ai/model:latest")
+	if !errors.Is(err, ErrModelDownloading) {
+		t.Fatalf("Expected ErrModelDownloading, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "50% complete") {
+		t.Errorf("Expected 50%% progress, got %q", err.Error())
+	}
+
+	untrack()
+	if err := manager.CheckDownloading("ai/model"); err != nil {
+		t.Errorf("Expected no error after pull, got %v", err)
+	}
+}
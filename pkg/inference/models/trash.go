@@ -0,0 +1,196 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/docker/model-runner/pkg/distribution/distribution"
+	"github.com/docker/model-runner/pkg/internal/utils"
+)
+
+const (
+	// DefaultTrashRetention is how long models stay in the trash before
+	// they're purged, by default.
+	DefaultTrashRetention = 7 * 24 * time.Hour
+	// trashSweepInterval is the interval at which expired models are purged
+	// from the trash.
+	trashSweepInterval = time.Hour
+)
+
+// TrashedModel is a model in the trash.
+type TrashedModel struct {
+	distribution.TrashedModel
+	// ExpiresAt is the time after which the model is purged.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Trash moves a model to the trash, from which it can be restored until it's
+// purged, and returns the delete response. Mounted models are unmounted,
+// leaving their files in place, as with Delete.
+func (m *Manager) Trash(reference string, force bool) (*distribution.DeleteModelResponse, error) {
+	if mounted := m.unmount(reference); mounted != nil {
+		return &distribution.DeleteModelResponse{
+			{Untagged: &mounted.name},
+			{Deleted: &mounted.id},
+		}, nil
+	}
+
+	if m.distributionClient == nil {
+		return nil, errors.New("model distribution service unavailable")
+	}
+
+	resp, err := m.distributionClient.TrashModel(reference, force)
+	if err != nil {
+		return nil, fmt.Errorf("error while moving model to trash: %w", err)
+	}
+	return resp, nil
+}
+
+// ListTrash lists the models in the trash.
+func (m *Manager) ListTrash() ([]TrashedModel, error) {
+	if m.distributionClient == nil {
+		return nil, errors.New("model distribution service unavailable")
+	}
+	trashed, err := m.distributionClient.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+	models := make([]TrashedModel, len(trashed))
+	for i, model := range trashed {
+		models[i] = TrashedModel{TrashedModel: model, ExpiresAt: model.DeletedAt.Add(m.trashRetention)}
+	}
+	return models, nil
+}
+
+// Restore restores a model from the trash by ID or by one of its former tags.
+func (m *Manager) Restore(reference string) (*Model, error) {
+	if m.distributionClient == nil {
+		return nil, errors.New("model distribution service unavailable")
+	}
+	restored, err := m.distributionClient.RestoreModel(reference)
+	if err != nil && errors.Is(err, distribution.ErrModelNotFound) {
+		if normalized := NormalizeModelName(reference); normalized != reference {
+			restored, err = m.distributionClient.RestoreModel(normalized)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	model, err := m.GetLocal(restored.ID)
+	if err != nil {
+		return nil, err
+	}
+	return ToModel(model)
+}
+
+// PurgeTrash permanently deletes the model in the trash with the specified ID
+// or former tag, or all models in the trash if reference is empty. It returns
+// the IDs of the deleted models.
+func (m *Manager) PurgeTrash(reference string) ([]string, error) {
+	if m.distributionClient == nil {
+		return nil, errors.New("model distribution service unavailable")
+	}
+	ids, err := m.distributionClient.PurgeTrash(reference)
+	if err != nil && reference != "" && errors.Is(err, distribution.ErrModelNotFound) {
+		if normalized := NormalizeModelName(reference); normalized != reference {
+			ids, err = m.distributionClient.PurgeTrash(normalized)
+		}
+	}
+	return ids, err
+}
+
+// PurgeExpiredTrash permanently deletes the models that have been in the
+// trash for longer than the trash retention. It returns the IDs of the
+// deleted models.
+func (m *Manager) PurgeExpiredTrash() ([]string, error) {
+	if m.distributionClient == nil {
+		return nil, nil
+	}
+	return m.distributionClient.PurgeExpiredTrash(time.Now().Add(-m.trashRetention))
+}
+
+// RunTrashSweeper purges expired models from the trash periodically until ctx
+// is cancelled, notifying the delete listeners of the purged models.
+func (h *Handler) RunTrashSweeper(ctx context.Context) {
+	ticker := time.NewTicker(trashSweepInterval)
+	defer ticker.Stop()
+	for {
+		ids, err := h.manager.PurgeExpiredTrash()
+		if err != nil {
+			h.log.Warnf("Failed to purge expired models from the trash: %v", err)
+		}
+		for _, id := range ids {
+			h.log.Infof("Purged expired model %s from the trash", id)
+			h.notifyModelDeleted(id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleListTrash handles GET <inference-prefix>/models/trash requests.
+func (h *Handler) handleListTrash(w http.ResponseWriter, _ *http.Request) {
+	trashed, err := h.manager.ListTrash()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(trashed); err != nil {
+		h.log.Warnln("Error while encoding trash listing:", err)
+	}
+}
+
+// handleRestoreModel handles POST <inference-prefix>/models/{name}/restore
+// requests, responding with the restored model.
+func (h *Handler) handleRestoreModel(w http.ResponseWriter, _ *http.Request, model string) {
+	restored, err := h.manager.Restore(model)
+	if err != nil {
+		if errors.Is(err, distribution.ErrModelNotFound) {
+			http.Error(w, fmt.Sprintf("model %q isn't in the trash", model), http.StatusNotFound)
+			return
+		}
+		h.log.Warnf("Failed to restore %q: %v", utils.SanitizeForLog(model, -1), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(restored); err != nil {
+		h.log.Warnln("Error while encoding restore response:", err)
+	}
+}
+
+// handlePurgeTrash handles DELETE <inference-prefix>/models/trash and
+// DELETE <inference-prefix>/models/trash/{name} requests, which permanently
+// delete all models in the trash or a single one.
+func (h *Handler) handlePurgeTrash(w http.ResponseWriter, r *http.Request) {
+	model := r.PathValue("name")
+	ids, err := h.manager.PurgeTrash(model)
+	if err != nil {
+		if errors.Is(err, distribution.ErrModelNotFound) {
+			http.Error(w, fmt.Sprintf("model %q isn't in the trash", model), http.StatusNotFound)
+			return
+		}
+		h.log.Warnln("Error while purging trash:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := distribution.DeleteModelResponse{}
+	for _, id := range ids {
+		h.notifyModelDeleted(id)
+		resp = append(resp, distribution.DeleteModelAction{Deleted: &id})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.log.Warnln("Error while encoding purge response:", err)
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/go-containerregistry/pkg/registry"
+
+	"github.com/docker/model-runner/pkg/distribution/builder"
+	reg "github.com/docker/model-runner/pkg/distribution/registry"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/sirupsen/logrus"
+)
+
+func TestTrash(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	uri, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse registry URL: %v", err)
+	}
+	model, err := builder.FromGGUF(filepath.Join(getProjectRoot(t), "assets", "dummy.gguf"))
+	if err != nil {
+		t.Fatalf("Failed to create model builder: %v", err)
+	}
+	tag := uri.Host + "/ai/model:v1.0.0"
+	target, err := reg.NewClient().NewTarget(tag)
+	if err != nil {
+		t.Fatalf("Failed to create model target: %v", err)
+	}
+	if err := model.Build(context.Background(), target, os.Stdout); err != nil {
+		t.Fatalf("Failed to build model: %v", err)
+	}
+
+	log := logrus.NewEntry(logrus.StandardLogger())
+	handler := NewHandler(log, ClientConfig{StoreRootPath: t.TempDir(), Logger: log, Transport: http.DefaultTransport}, nil, &mockMemoryEstimator{})
+	var deleted []string
+	handler.OnModelDeleted(func(id string) {
+		deleted = append(deleted, id)
+	})
+	if err := handler.manager.Pull(tag, "", httptest.NewRequest(http.MethodPost, "/models/create", nil), httptest.NewRecorder()); err != nil {
+		t.Fatalf("Failed to pull model: %v", err)
+	}
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := serve(http.MethodDelete, inference.ModelsPrefix+"/"+tag+"?trash=true"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Trashed") {
+		t.Fatalf("Failed to trash model: %d %s", w.Code, w.Body.String())
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Expected trashed models not to be reported as deleted, got %v", deleted)
+	}
+	if w := serve(http.MethodGet, inference.ModelsPrefix+"/"+tag); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the trashed model to be hidden, got status %d", w.Code)
+	}
+	var trashed []TrashedModel
+	if err := json.Unmarshal(serve(http.MethodGet, inference.ModelsPrefix+"/trash").Body.Bytes(), &trashed); err != nil {
+		t.Fatalf("Failed to decode trash listing: %v", err)
+	}
+	if len(trashed) != 1 || trashed[0].ExpiresAt.Sub(trashed[0].DeletedAt) != DefaultTrashRetention {
+		t.Fatalf("Unexpected trash %+v", trashed)
+	}
+
+	if w := serve(http.MethodPost, inference.ModelsPrefix+"/"+tag+"/restore"); w.Code != http.StatusOK {
+		t.Fatalf("Failed to restore model: %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodGet, inference.ModelsPrefix+"/"+tag); w.Code != http.StatusOK {
+		t.Errorf("Expected the restored model to be available, got status %d", w.Code)
+	}
+	if w := serve(http.MethodPost, inference.ModelsPrefix+"/"+tag+"/restore"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a model that isn't in the trash, got %d", w.Code)
+	}
+
+	if w := serve(http.MethodDelete, inference.ModelsPrefix+"/"+tag+"?trash=true"); w.Code != http.StatusOK {
+		t.Fatalf("Failed to trash model: %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodDelete, inference.ModelsPrefix+"/trash/"+tag); w.Code != http.StatusOK {
+		t.Fatalf("Failed to purge model: %d %s", w.Code, w.Body.String())
+	}
+	if len(deleted) != 1 || deleted[0] != trashed[0].ID {
+		t.Errorf("Expected the purged model to be reported as deleted, got %v", deleted)
+	}
+	if w := serve(http.MethodDelete, inference.ModelsPrefix+"/trash/"+tag); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a purged model, got %d", w.Code)
+	}
+}
@@ -0,0 +1,136 @@
+// Package moderation implements the OpenAI moderations API on top of local
+// sequence classification models, such as safety classifiers, whose outputs
+// are requested from backends as embeddings.
+package moderation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference/classification"
+	"github.com/docker/model-runner/pkg/pii"
+)
+
+// FlagThreshold is the score at or above which a category is flagged.
+const FlagThreshold = 0.5
+
+// PIICategory is the category of inputs that contain personally identifiable
+// information or secrets. It's only reported if requested with the detect_pii
+// extension field.
+const PIICategory = "pii"
+
+// benignLabels are the classifier labels that indicate that content is safe.
+// They aren't reported as categories.
+var benignLabels = []string{"safe", "neutral", "benign", "normal", "ok", "none", "clean", "non-toxic", "non_toxic", "not-toxic", "not_toxic"}
+
+// Result is the moderation result for an input.
+type Result struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// Response is a moderation response.
+type Response struct {
+	ID      string   `json:"id"`
+	Model   string   `json:"model"`
+	Results []Result `json:"results"`
+}
+
+// Moderate returns the moderation response for a classifier's outputs for each
+// input, whose categories are named by the classifier's labels, replaced by
+// the configured label mapping, if any.
+func Moderate(model string, labels []string, mapping map[string]string, outputs [][]float64) Response {
+	response := Response{ID: newID(), Model: model, Results: make([]Result, len(outputs))}
+	for i, output := range outputs {
+		outputLabels := labels
+		if len(mapping) > 0 {
+			outputLabels = classification.Labels(labels, len(output), mapping)
+		}
+		response.Results[i] = Classify(outputLabels, output)
+	}
+	return response
+}
+
+// DetectsPII returns whether a moderation request requests PII detection with
+// the detect_pii extension field.
+func DetectsPII(body []byte) bool {
+	var fields struct {
+		DetectPII bool `json:"detect_pii"`
+	}
+	return json.Unmarshal(body, &fields) == nil && fields.DetectPII
+}
+
+// FlagPII adds the PII category to the results of the inputs, flagged if
+// sensitive data is detected in the input.
+func FlagPII(response *Response, inputs []string) {
+	for i := range response.Results {
+		if i >= len(inputs) {
+			break
+		}
+		flagged := len(pii.Detect(inputs[i])) > 0
+		result := &response.Results[i]
+		result.Categories[PIICategory] = flagged
+		result.CategoryScores[PIICategory] = 0
+		if flagged {
+			result.CategoryScores[PIICategory] = 1
+		}
+		result.Flagged = result.Flagged || flagged
+	}
+}
+
+// Classify returns the moderation result for a classifier's outputs (logits),
+// whose categories are named by the classifier's labels. Classifiers with a
+// benign label, such as "safe", are treated as single-label classifiers whose
+// scores are normalized with a softmax, while other classifiers' scores are
+// computed independently with a sigmoid. If the labels don't match the
+// outputs, then a single output is named "flagged", and multiple outputs are
+// named "label_<i>".
+func Classify(labels []string, outputs []float64) Result {
+	names := make([]string, len(outputs))
+	for i := range outputs {
+		switch {
+		case len(labels) == len(outputs):
+			names[i] = strings.ToLower(strings.TrimSpace(labels[i]))
+		case len(outputs) == 1:
+			names[i] = "flagged"
+		default:
+			names[i] = fmt.Sprintf("label_%d", i)
+		}
+	}
+
+	var scores []float64
+	if len(outputs) > 1 && slices.ContainsFunc(names, isBenign) {
+		scores = classification.Softmax(outputs)
+	} else {
+		scores = classification.Sigmoid(outputs)
+	}
+
+	result := Result{Categories: make(map[string]bool), CategoryScores: make(map[string]float64)}
+	for i, name := range names {
+		if isBenign(name) {
+			continue
+		}
+		flagged := scores[i] >= FlagThreshold
+		result.Categories[name] = flagged
+		result.CategoryScores[name] = scores[i]
+		result.Flagged = result.Flagged || flagged
+	}
+	return result
+}
+
+// isBenign returns whether a normalized label indicates that content is safe.
+func isBenign(label string) bool {
+	return slices.Contains(benignLabels, label)
+}
+
+// newID generates a moderation response ID.
+func newID() string {
+	var id [12]byte
+	rand.Read(id[:])
+	return "modr-" + hex.EncodeToString(id[:])
+}
@@ -0,0 +1,57 @@
+package moderation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	// Classifiers with a benign label are normalized with a softmax.
+	result := Classify([]string{"safe", "unsafe"}, []float64{0, math.Log(3)})
+	if !result.Flagged || len(result.Categories) != 1 || math.Abs(result.CategoryScores["unsafe"]-0.75) > 1e-9 {
+		t.Errorf("Unexpected single-label result %+v", result)
+	}
+
+	// Other classifiers are scored independently with a sigmoid.
+	result = Classify([]string{"Toxic", "threat"}, []float64{2, -2})
+	if !result.Flagged || !result.Categories["toxic"] || result.Categories["threat"] || result.CategoryScores["threat"] > 0.5 {
+		t.Errorf("Unexpected multi-label result %+v", result)
+	}
+
+	// Outputs without matching labels are named generically.
+	if result := Classify(nil, []float64{-3}); result.Flagged || len(result.CategoryScores) != 1 {
+		t.Errorf("Unexpected unlabeled result %+v", result)
+	}
+	if result := Classify([]string{"a"}, []float64{1, 2}); !result.Categories["label_1"] {
+		t.Errorf("Unexpected unlabeled result %+v", result)
+	}
+}
+
+func TestModerate(t *testing.T) {
+	outputs := [][]float64{{-5, 5}, {5, -5}}
+	response := Moderate("ai/classifier", []string{"safe", "unsafe"}, nil, outputs)
+	if response.Model != "ai/classifier" || len(response.Results) != 2 || !response.Results[0].Flagged || response.Results[1].Flagged {
+		t.Errorf("Unexpected response %+v", response)
+	}
+
+	// Label mappings rename the classifier's outputs.
+	response = Moderate("ai/classifier", []string{"LABEL_0", "LABEL_1"}, map[string]string{"LABEL_0": "safe", "1": "violence"}, outputs)
+	if !response.Results[0].Categories["violence"] || len(response.Results[0].Categories) != 1 {
+		t.Errorf("Unexpected mapped response %+v", response)
+	}
+}
+
+func TestFlagPII(t *testing.T) {
+	body := []byte(`{"input":["hi","mail jane@example.com"],"detect_pii":true}`)
+	if !DetectsPII(body) || DetectsPII([]byte(`{"input":"hi"}`)) {
+		t.Fatal("Unexpected PII detection request")
+	}
+	response := Moderate("ai/classifier", []string{"safe", "unsafe"}, nil, [][]float64{{5, -5}, {5, -5}})
+	FlagPII(&response, []string{"hi", "mail jane@example.com"})
+	if response.Results[0].Flagged || response.Results[0].Categories[PIICategory] {
+		t.Errorf("Unexpected result %+v", response.Results[0])
+	}
+	if !response.Results[1].Flagged || response.Results[1].CategoryScores[PIICategory] != 1 {
+		t.Errorf("Unexpected result %+v", response.Results[1])
+	}
+}
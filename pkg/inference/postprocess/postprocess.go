@@ -0,0 +1,165 @@
+// Package postprocess implements the post-processors that can be configured
+// for a model, which clean up the content of its completions (e.g. removing
+// markdown fences around JSON) before they're returned to clients.
+package postprocess
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+// Validate checks that post-processors are known and not repeated.
+func Validate(processors []inference.PostProcessor) error {
+	seen := make(map[inference.PostProcessor]bool, len(processors))
+	for _, processor := range processors {
+		switch processor {
+		case inference.PostProcessorStripFences, inference.PostProcessorRepairJSON, inference.PostProcessorCollapseWhitespace:
+		default:
+			return fmt.Errorf("unknown post-processor %q", processor)
+		}
+		if seen[processor] {
+			return fmt.Errorf("duplicate post-processor %q", processor)
+		}
+		seen[processor] = true
+	}
+	return nil
+}
+
+// Apply applies post-processors to content in order. Unknown post-processors
+// are ignored.
+func Apply(processors []inference.PostProcessor, content string) string {
+	for _, processor := range processors {
+		switch processor {
+		case inference.PostProcessorStripFences:
+			content = StripFences(content)
+		case inference.PostProcessorRepairJSON:
+			content = RepairJSON(content)
+		case inference.PostProcessorCollapseWhitespace:
+			content = CollapseWhitespace(content)
+		}
+	}
+	return content
+}
+
+// fence matches content that is entirely enclosed in a markdown code fence,
+// with an optional info string (e.g. ```json).
+var fence = regexp.MustCompile("(?s)^\\s*(```+|~~~+)[^\\n`]*\\n(.*?)\\n?\\s*(```+|~~~+)\\s*$")
+
+// StripFences removes a markdown code fence enclosing the entire content. If
+// the content isn't enclosed in a fence, then it's returned unmodified.
+func StripFences(content string) string {
+	match := fence.FindStringSubmatch(content)
+	if match == nil || match[1][0] != match[3][0] || len(match[3]) < len(match[1]) {
+		return content
+	}
+	return match[2]
+}
+
+// horizontalSpace matches runs of horizontal whitespace.
+var horizontalSpace = regexp.MustCompile(`[ \t\f\v]+`)
+
+// blankLines matches runs of blank lines.
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// CollapseWhitespace collapses runs of spaces and tabs into single spaces and
+// runs of blank lines into single blank lines, removes trailing whitespace
+// from lines, and trims the content.
+func CollapseWhitespace(content string) string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(horizontalSpace.ReplaceAllString(line, " "), " ")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// RepairJSON extracts the first JSON object or array in content, removing
+// trailing commas and closing unterminated strings, objects, and arrays (as
+// left by responses cut off at max_tokens). Text around the value is
+// discarded. If content is valid JSON or can't be repaired, then it's
+// returned unmodified.
+func RepairJSON(content string) string {
+	if json.Valid([]byte(content)) {
+		return content
+	}
+	start := strings.IndexAny(content, "{[")
+	if start < 0 {
+		return content
+	}
+
+	var repaired strings.Builder
+	var stack []byte
+	inString, escaped := false, false
+scan:
+	for i := start; i < len(content); i++ {
+		c := content[i]
+		if inString {
+			repaired.WriteByte(c)
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				return content
+			}
+			trimTrailingComma(&repaired)
+			stack = stack[:len(stack)-1]
+			repaired.WriteByte(c)
+			if len(stack) == 0 {
+				break scan
+			}
+			continue
+		}
+		repaired.WriteByte(c)
+	}
+
+	if inString {
+		if escaped {
+			// Drop the dangling escape character.
+			truncated := repaired.String()
+			repaired.Reset()
+			repaired.WriteString(truncated[:len(truncated)-1])
+		}
+		repaired.WriteByte('"')
+	}
+	if len(stack) > 0 {
+		trimTrailingComma(&repaired)
+		if strings.HasSuffix(strings.TrimRight(repaired.String(), " \t\r\n"), ":") {
+			repaired.WriteString("null")
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			repaired.WriteByte(stack[i])
+		}
+	}
+	if !json.Valid([]byte(repaired.String())) {
+		return content
+	}
+	return repaired.String()
+}
+
+// trimTrailingComma removes a trailing comma (and any whitespace after it)
+// from the output being repaired.
+func trimTrailingComma(repaired *strings.Builder) {
+	output := repaired.String()
+	trimmed := strings.TrimRight(output, " \t\r\n")
+	if strings.HasSuffix(trimmed, ",") {
+		repaired.Reset()
+		repaired.WriteString(trimmed[:len(trimmed)-1])
+	}
+}
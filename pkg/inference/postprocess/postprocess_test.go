@@ -0,0 +1,116 @@
+package postprocess
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]inference.PostProcessor{inference.PostProcessorStripFences, inference.PostProcessorRepairJSON}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for _, processors := range [][]inference.PostProcessor{
+		{"uppercase"},
+		{inference.PostProcessorRepairJSON, inference.PostProcessorRepairJSON},
+	} {
+		if err := Validate(processors); err == nil {
+			t.Errorf("Expected error for %v", processors)
+		}
+	}
+}
+
+func TestStripFences(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"```json\n{\"a\": 1}\n```", `{"a": 1}`},
+		{"  ```\nline 1\nline 2\n```\n", "line 1\nline 2"},
+		{"~~~python\nprint()\n~~~", "print()"},
+		{"Here you go:\n```json\n{}\n```", "Here you go:\n```json\n{}\n```"},
+		{"```json\n{}\n~~~", "```json\n{}\n~~~"},
+		{"no fences", "no fences"},
+	}
+	for _, tt := range tests {
+		if actual := StripFences(tt.content); actual != tt.expected {
+			t.Errorf("StripFences(%q) = %q, expected %q", tt.content, actual, tt.expected)
+		}
+	}
+}
+
+func TestCollapseWhitespace(t *testing.T) {
+	content := "  Hello,\t  world!  \r\n\n\n\nSecond   paragraph. \n"
+	if actual := CollapseWhitespace(content); actual != "Hello, world!\n\nSecond paragraph." {
+		t.Errorf("Unexpected result %q", actual)
+	}
+}
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{`{"a": [1, 2]}`, `{"a": [1, 2]}`},
+		{`Sure! {"a": 1, "b": "}"} Hope this helps.`, `{"a": 1, "b": "}"}`},
+		{`{"a": [1, 2,], "b": {"c": true,},}`, `{"a": [1, 2], "b": {"c": true}}`},
+		{`{"a": "unterminated`, `{"a": "unterminated"}`},
+		{`{"a": "escape\`, `{"a": "escape"}`},
+		{`[{"a": 1}, {"b":`, `[{"a": 1}, {"b":null}]`},
+		{`{"a": 1,`, `{"a": 1}`},
+		{`{"a": 1]`, `{"a": 1]`},
+		{`no json`, `no json`},
+	}
+	for _, tt := range tests {
+		if actual := RepairJSON(tt.content); actual != tt.expected {
+			t.Errorf("RepairJSON(%q) = %q, expected %q", tt.content, actual, tt.expected)
+		}
+	}
+}
+
+// serve writes a response through a ResponseWriter applying processors.
+func serve(processors []inference.PostProcessor, contentType string, writes ...string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	w := NewResponseWriter(recorder, processors)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	for _, write := range writes {
+		w.Write([]byte(write))
+	}
+	w.Finish()
+	return recorder
+}
+
+func TestResponseWriter(t *testing.T) {
+	processors := []inference.PostProcessor{inference.PostProcessorStripFences, inference.PostProcessorRepairJSON}
+
+	recorder := serve(processors, "application/json",
+		`{"choices":[{"index":0,"message":{"role":"assistant","content":"`+"```json\\n"+`{\"a\": 1,}\n`+"```"+`"}}]}`)
+	if body := recorder.Body.String(); !strings.Contains(body, `"content":"{\"a\": 1}"`) {
+		t.Errorf("Unexpected response %s", body)
+	}
+
+	recorder = serve(processors, "text/event-stream",
+		`data: {"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`+"\n\n",
+		`data: {"id":"1","choices":[{"index":0,"delta":{"content":"`+"```json\\n"+`{\"a\":"}}]}`+"\n\n",
+		`data: {"id":"1","choices":[{"index":0,"delta":{"content":" 1\n`+"```"+`"}}]}`+"\n\ndata: ",
+		`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n",
+		"data: [DONE]\n\n")
+	expected := `data: {"choices":[{"delta":{"role":"assistant"},"index":0}],"id":"1"}` + "\n\n" +
+		`data: {"choices":[{"delta":{"content":"{\"a\": 1}"},"finish_reason":"stop","index":0}],"id":"1"}` + "\n\n" +
+		"data: [DONE]\n\n"
+	if body := recorder.Body.String(); body != expected {
+		t.Errorf("Unexpected stream:\n%s\nexpected:\n%s", body, expected)
+	}
+
+	// Content of streams that end without finishing is flushed.
+	recorder = serve([]inference.PostProcessor{inference.PostProcessorCollapseWhitespace}, "text/event-stream",
+		`data: {"id":"2","object":"text_completion","choices":[{"index":0,"text":"a  b "}]}`+"\n\n")
+	expected = `data: {"choices":[{"index":0,"text":"a b"}],"id":"2","object":"text_completion"}` + "\n\n"
+	if body := recorder.Body.String(); body != expected {
+		t.Errorf("Unexpected stream:\n%s\nexpected:\n%s", body, expected)
+	}
+}
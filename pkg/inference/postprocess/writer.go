@@ -0,0 +1,274 @@
+package postprocess
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+// ResponseWriter applies post-processors to the content of chat completion and
+// completion responses. Since post-processors operate on complete content,
+// streamed content is held back until its choice finishes and then sent in the
+// choice's final chunk. Finish must be called once the response has been fully
+// written.
+type ResponseWriter struct {
+	http.ResponseWriter
+	// processors are the post-processors to apply.
+	processors []inference.PostProcessor
+	// statusCode is the response status code.
+	statusCode int
+	// streaming indicates that the response is a server-sent event stream.
+	streaming bool
+	// buffer holds the complete body for non-streaming responses and any
+	// incomplete event for streaming responses.
+	buffer bytes.Buffer
+	// pending holds the streamed content of unfinished choices, by index.
+	pending map[int]*strings.Builder
+	// field is the name of the field carrying streamed content, which is
+	// "text" for completions.
+	field string
+	// lastChunk is the most recent streamed chunk, whose identifying fields
+	// are copied to the chunk flushing pending content.
+	lastChunk map[string]any
+}
+
+// NewResponseWriter creates a new ResponseWriter that wraps w and applies
+// processors to the content of the response.
+func NewResponseWriter(w http.ResponseWriter, processors []inference.PostProcessor) *ResponseWriter {
+	return &ResponseWriter{
+		ResponseWriter: w,
+		processors:     processors,
+		pending:        make(map[int]*strings.Builder),
+	}
+}
+
+// WriteHeader implements net/http.ResponseWriter.WriteHeader.
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.streaming = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	if statusCode == http.StatusOK {
+		// The body will be rewritten, so its length may change.
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements net/http.ResponseWriter.Write.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.statusCode != http.StatusOK {
+		return w.ResponseWriter.Write(b)
+	}
+	w.buffer.Write(b)
+	if !w.streaming {
+		return len(b), nil
+	}
+
+	// Process all complete events.
+	for {
+		data := w.buffer.Bytes()
+		end := bytes.Index(data, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		event := string(data[:end+2])
+		w.buffer.Next(end + 2)
+		if err := w.writeEvent(event); err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush implements net/http.Flusher.Flush.
+func (w *ResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Finish writes any buffered output. If a stream ended without its choices
+// finishing, their pending content is written last.
+func (w *ResponseWriter) Finish() error {
+	if w.streaming {
+		if w.buffer.Len() > 0 {
+			remaining := w.buffer.String()
+			w.buffer.Reset()
+			if err := w.writeEvent(remaining); err != nil {
+				return err
+			}
+		}
+		return w.flushPending()
+	}
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	body := w.rewriteResponse(w.buffer.Bytes())
+	w.buffer.Reset()
+	_, err := w.ResponseWriter.Write(body)
+	return err
+}
+
+// rewriteResponse post-processes a non-streaming response. If the response
+// can't be parsed, it's returned unmodified.
+func (w *ResponseWriter) rewriteResponse(body []byte) []byte {
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	choices, ok := response["choices"].([]any)
+	if !ok {
+		return body
+	}
+
+	modified := false
+	for _, c := range choices {
+		choice, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		// Chat completions carry content in their message, and completions
+		// in their text.
+		target, field := choice, "text"
+		if message, ok := choice["message"].(map[string]any); ok {
+			target, field = message, "content"
+		}
+		content, ok := target[field].(string)
+		if !ok {
+			continue
+		}
+		if processed := Apply(w.processors, content); processed != content {
+			target[field] = processed
+			modified = true
+		}
+	}
+	if !modified {
+		return body
+	}
+
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// writeEvent processes and forwards a single server-sent event.
+func (w *ResponseWriter) writeEvent(event string) error {
+	data, ok := strings.CutPrefix(strings.TrimRight(event, "\n"), "data: ")
+	if ok && data == "[DONE]" {
+		if err := w.flushPending(); err != nil {
+			return err
+		}
+	}
+	var chunk map[string]any
+	if !ok || data == "[DONE]" || json.Unmarshal([]byte(data), &chunk) != nil {
+		_, err := w.ResponseWriter.Write([]byte(event))
+		return err
+	}
+	choices, ok := chunk["choices"].([]any)
+	if !ok {
+		_, err := w.ResponseWriter.Write([]byte(event))
+		return err
+	}
+	w.lastChunk = chunk
+
+	informative := chunk["usage"] != nil || len(choices) == 0
+	for _, c := range choices {
+		choice, ok := c.(map[string]any)
+		if !ok {
+			informative = true
+			continue
+		}
+		index := 0
+		if i, ok := choice["index"].(float64); ok {
+			index = int(i)
+		}
+		target, field := choice, "text"
+		if delta, ok := choice["delta"].(map[string]any); ok {
+			target, field = delta, "content"
+		}
+		w.field = field
+
+		// Hold back content until the choice finishes.
+		if content, ok := target[field].(string); ok {
+			pending := w.pending[index]
+			if pending == nil {
+				pending = &strings.Builder{}
+				w.pending[index] = pending
+			}
+			pending.WriteString(content)
+			delete(target, field)
+		}
+		if finishReason, ok := choice["finish_reason"].(string); ok && finishReason != "" {
+			if pending := w.pending[index]; pending != nil {
+				target[field] = Apply(w.processors, pending.String())
+				delete(w.pending, index)
+			}
+			informative = true
+		} else if len(target) > 0 && field == "content" {
+			informative = true
+		}
+		if field == "text" {
+			// Completion choices always have a text field.
+			if _, ok := target[field]; !ok {
+				target[field] = ""
+			}
+		}
+	}
+
+	// Drop chunks that no longer carry any information.
+	if !informative {
+		return nil
+	}
+	return w.writeChunk(chunk)
+}
+
+// flushPending writes the post-processed content of choices that haven't
+// finished.
+func (w *ResponseWriter) flushPending() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	indices := make([]int, 0, len(w.pending))
+	for index := range w.pending {
+		indices = append(indices, index)
+	}
+	slices.Sort(indices)
+
+	choices := make([]any, 0, len(indices))
+	for _, index := range indices {
+		content := Apply(w.processors, w.pending[index].String())
+		if w.field == "text" {
+			choices = append(choices, map[string]any{"index": index, "text": content})
+		} else {
+			choices = append(choices, map[string]any{"index": index, "delta": map[string]any{"content": content}})
+		}
+	}
+	clear(w.pending)
+
+	chunk := map[string]any{"choices": choices}
+	for _, field := range []string{"id", "object", "created", "model", "system_fingerprint"} {
+		if value, ok := w.lastChunk[field]; ok {
+			chunk[field] = value
+		}
+	}
+	return w.writeChunk(chunk)
+}
+
+// writeChunk forwards a chunk as a server-sent event.
+func (w *ResponseWriter) writeChunk(chunk map[string]any) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return fmt.Errorf("unable to encode chunk: %w", err)
+	}
+	_, err = fmt.Fprintf(w.ResponseWriter, "data: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,225 @@
+// Package prompttemplate implements named prompt templates with variables,
+// which chat completion requests can reference instead of spelling out
+// standardized prompts.
+package prompttemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrTemplateNotFound indicates that a request references a prompt
+	// template that doesn't exist. If returned in conjunction with an HTTP
+	// request, it should be paired with a 404 response status.
+	ErrTemplateNotFound = errors.New("prompt template not found")
+	// ErrInvalidTemplate indicates that a prompt template or the variables
+	// with which it's rendered are invalid. If returned in conjunction with
+	// an HTTP request, it should be paired with a 400 response status.
+	ErrInvalidTemplate = errors.New("invalid prompt template")
+)
+
+// messageRoles are the roles of template messages.
+var messageRoles = []string{"system", "developer", "user", "assistant"}
+
+// variableName matches valid variable names.
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// placeholder matches variable placeholders, such as {{topic}}.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// Message is a templated chat message.
+type Message struct {
+	// Role is the message's role.
+	Role string `json:"role"`
+	// Content is the message's content, with {{variable}} placeholders.
+	Content string `json:"content"`
+}
+
+// Variable declares a template variable.
+type Variable struct {
+	// Name is the variable's name.
+	Name string `json:"name"`
+	// Description describes the variable.
+	Description string `json:"description,omitempty"`
+	// Default is the variable's value if a request doesn't specify one. If
+	// nil, requests must specify a value.
+	Default *string `json:"default,omitempty"`
+}
+
+// Template is a named prompt template.
+type Template struct {
+	// ID is the template's identifier.
+	ID string `json:"id"`
+	// Object is always "prompt_template".
+	Object string `json:"object"`
+	// Name is the template's name.
+	Name string `json:"name"`
+	// Description describes the template.
+	Description string `json:"description,omitempty"`
+	// Version is incremented each time the template is updated.
+	Version int `json:"version"`
+	// Messages are the template's messages, which are prepended to the
+	// messages of requests that reference the template.
+	Messages []Message `json:"messages"`
+	// Variables are the template's variables.
+	Variables []Variable `json:"variables"`
+	// CreatedAt is the template's creation time as a Unix timestamp.
+	CreatedAt int64 `json:"created_at"`
+	// UpdatedAt is the time at which the template was last updated.
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// Validate checks that the template's messages and variables are well-formed
+// and that its placeholders only reference declared variables.
+func (t Template) Validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTemplate)
+	}
+	if len(t.Messages) == 0 {
+		return fmt.Errorf("%w: messages must be a non-empty array", ErrInvalidTemplate)
+	}
+	declared := make(map[string]bool, len(t.Variables))
+	for i, variable := range t.Variables {
+		if !variableName.MatchString(variable.Name) {
+			return fmt.Errorf("%w: variables[%d]: invalid name %q", ErrInvalidTemplate, i, variable.Name)
+		}
+		if declared[variable.Name] {
+			return fmt.Errorf("%w: variables[%d]: duplicate name %q", ErrInvalidTemplate, i, variable.Name)
+		}
+		declared[variable.Name] = true
+	}
+	for i, message := range t.Messages {
+		if !slices.Contains(messageRoles, message.Role) {
+			return fmt.Errorf("%w: messages[%d]: role must be one of %s", ErrInvalidTemplate, i, strings.Join(messageRoles, ", "))
+		}
+		for _, match := range placeholder.FindAllStringSubmatch(message.Content, -1) {
+			if !declared[match[1]] {
+				return fmt.Errorf("%w: messages[%d]: undeclared variable %q", ErrInvalidTemplate, i, match[1])
+			}
+		}
+	}
+	return nil
+}
+
+// Render renders the template's messages with the specified variables, using
+// the defaults of variables that aren't specified.
+func (t Template) Render(variables map[string]string) ([]Message, error) {
+	values := make(map[string]string, len(t.Variables))
+	for _, variable := range t.Variables {
+		if value, ok := variables[variable.Name]; ok {
+			values[variable.Name] = value
+		} else if variable.Default != nil {
+			values[variable.Name] = *variable.Default
+		} else {
+			return nil, fmt.Errorf("%w: variable %q is required", ErrInvalidTemplate, variable.Name)
+		}
+	}
+	var unknown []string
+	for name := range variables {
+		if _, ok := values[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("%w: unknown variables %s", ErrInvalidTemplate, strings.Join(unknown, ", "))
+	}
+
+	rendered := make([]Message, len(t.Messages))
+	for i, message := range t.Messages {
+		rendered[i] = Message{
+			Role: message.Role,
+			Content: placeholder.ReplaceAllStringFunc(message.Content, func(match string) string {
+				return values[placeholder.FindStringSubmatch(match)[1]]
+			}),
+		}
+	}
+	return rendered, nil
+}
+
+// Store looks up prompt templates.
+type Store interface {
+	// PromptTemplate returns the template with the specified ID, or
+	// ErrTemplateNotFound.
+	PromptTemplate(id string) (Template, error)
+}
+
+// Reference references a prompt template from a chat completion request's
+// prompt_template field. The field is an extension of the OpenAI API.
+type Reference struct {
+	// ID is the ID of the template.
+	ID string `json:"id"`
+	// Variables are the values of the template's variables.
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// Request is a parsed chat completion request that references a prompt
+// template.
+type Request struct {
+	// Reference references the template.
+	Reference Reference
+
+	// fields are the request's top-level fields, excluding the
+	// prompt_template field.
+	fields map[string]json.RawMessage
+	// messages are the request's own messages.
+	messages []json.RawMessage
+}
+
+// ParseRequest parses the prompt template reference of a chat completion
+// request. It returns nil if the request doesn't reference a template.
+func ParseRequest(body []byte) (*Request, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	raw, ok := fields["prompt_template"]
+	if !ok || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil, nil
+	}
+	delete(fields, "prompt_template")
+
+	var reference Reference
+	if err := json.Unmarshal(raw, &reference); err != nil {
+		return nil, fmt.Errorf("invalid prompt_template: %w", err)
+	}
+	if reference.ID == "" {
+		return nil, errors.New("prompt_template.id is required")
+	}
+	var messages []json.RawMessage
+	if raw, ok := fields["messages"]; ok {
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return nil, fmt.Errorf("invalid messages: %w", err)
+		}
+	}
+	return &Request{Reference: reference, fields: fields, messages: messages}, nil
+}
+
+// Apply returns the request body with the prompt_template field removed and
+// the rendered template messages prepended to the request's messages.
+func (r *Request) Apply(rendered []Message) ([]byte, error) {
+	messages := make([]any, 0, len(rendered)+len(r.messages))
+	for _, message := range rendered {
+		messages = append(messages, message)
+	}
+	for _, message := range r.messages {
+		messages = append(messages, message)
+	}
+	encoded, err := json.Marshal(messages)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode messages: %w", err)
+	}
+	fields := make(map[string]json.RawMessage, len(r.fields)+1)
+	for key, value := range r.fields {
+		fields[key] = value
+	}
+	fields["messages"] = encoded
+	return json.Marshal(fields)
+}
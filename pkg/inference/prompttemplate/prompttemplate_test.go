@@ -0,0 +1,119 @@
+package prompttemplate
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTemplate() Template {
+	audience := "engineers"
+	return Template{
+		Name: "summarize",
+		Messages: []Message{
+			{Role: "system", Content: "Summarize for {{ audience }}."},
+			{Role: "user", Content: "Summarize {{topic}} for {{audience}}: {{unset}}"},
+		},
+		Variables: []Variable{
+			{Name: "topic"},
+			{Name: "audience", Default: &audience},
+			{Name: "unset", Default: new(string)},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := newTemplate().Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	tests := []struct {
+		name   string
+		modify func(*Template)
+	}{
+		{"missing name", func(t *Template) { t.Name = " " }},
+		{"no messages", func(t *Template) { t.Messages = nil }},
+		{"invalid role", func(t *Template) { t.Messages[0].Role = "tool" }},
+		{"invalid variable name", func(t *Template) { t.Variables[0].Name = "a-b" }},
+		{"duplicate variable", func(t *Template) { t.Variables[1].Name = "topic" }},
+		{"undeclared variable", func(t *Template) { t.Messages[0].Content = "{{other}}" }},
+	}
+	for _, tt := range tests {
+		template := newTemplate()
+		tt.modify(&template)
+		if err := template.Validate(); !errors.Is(err, ErrInvalidTemplate) {
+			t.Errorf("%s: expected ErrInvalidTemplate, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	messages, err := newTemplate().Render(map[string]string{"topic": "{{audience}}", "audience": "managers"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	// Values aren't rendered recursively.
+	if messages[0].Content != "Summarize for managers." || messages[1].Content != "Summarize {{audience}} for managers: " {
+		t.Errorf("Unexpected messages %+v", messages)
+	}
+
+	if messages, err := newTemplate().Render(map[string]string{"topic": "Docker"}); err != nil || messages[0].Content != "Summarize for engineers." {
+		t.Errorf("Expected the default to be used, got %+v (%v)", messages, err)
+	}
+	for _, variables := range []map[string]string{
+		{},
+		{"topic": "Docker", "extra": "x"},
+	} {
+		if _, err := newTemplate().Render(variables); !errors.Is(err, ErrInvalidTemplate) {
+			t.Errorf("Expected ErrInvalidTemplate for %v, got %v", variables, err)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	request, err := ParseRequest([]byte(`{"model":"m","temperature":0.5,"messages":[{"role":"user","content":"Docker","name":"u"}],"prompt_template":{"id":"pt_1","variables":{"topic":"x"}}}`))
+	if err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+	if request.Reference.ID != "pt_1" || request.Reference.Variables["topic"] != "x" {
+		t.Errorf("Unexpected reference %+v", request.Reference)
+	}
+	body, err := request.Apply([]Message{{Role: "system", Content: "Be brief."}})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	var applied struct {
+		Temperature float64          `json:"temperature"`
+		Messages    []map[string]any `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &applied); err != nil {
+		t.Fatalf("Invalid body %s: %v", body, err)
+	}
+	if strings.Contains(string(body), "prompt_template") || applied.Temperature != 0.5 || len(applied.Messages) != 2 ||
+		applied.Messages[0]["content"] != "Be brief." || applied.Messages[1]["name"] != "u" {
+		t.Errorf("Unexpected body %s", body)
+	}
+
+	// Requests may rely on the template for all of their messages.
+	request, err = ParseRequest([]byte(`{"model":"m","prompt_template":{"id":"pt_1"}}`))
+	if err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+	if body, err := request.Apply([]Message{{Role: "user", Content: "Hi"}}); err != nil || !strings.Contains(string(body), `"messages":[{"role":"user","content":"Hi"}]`) {
+		t.Errorf("Unexpected body %s (%v)", body, err)
+	}
+
+	if request, err := ParseRequest([]byte(`{"model":"m","messages":[]}`)); request != nil || err != nil {
+		t.Errorf("Expected nil request without prompt_template field, got %+v (%v)", request, err)
+	}
+	for _, invalid := range []string{
+		`{"prompt_template":{}}`,
+		`{"prompt_template":"pt_1"}`,
+		`{"prompt_template":{"id":"pt_1","variables":{"a":1}}}`,
+		`{"prompt_template":{"id":"pt_1"},"messages":{}}`,
+	} {
+		if _, err := ParseRequest([]byte(invalid)); err == nil {
+			t.Errorf("Expected error for %s", invalid)
+		}
+	}
+}
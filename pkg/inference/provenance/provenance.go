@@ -0,0 +1,183 @@
+// Package provenance signs markers identifying the local model and runner that
+// produced an inference response, along with the digest of its content, so
+// that downstream systems can verify where an output came from. Markers are
+// signed with Ed25519, so that they can be verified with the runner's public
+// key alone.
+package provenance
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Algorithm is the signature algorithm of markers.
+	Algorithm = "ed25519"
+
+	// field is the name of the field holding the marker of JSON responses.
+	field = "provenance"
+)
+
+// Marker identifies the model and runner that produced a response, and the
+// response's content.
+type Marker struct {
+	// Model is the ID (digest) of the model.
+	Model string `json:"model"`
+	// Runner identifies the runner that served the request.
+	Runner string `json:"runner"`
+	// Timestamp is when the request was served, in Unix seconds.
+	Timestamp int64 `json:"timestamp"`
+	// RecordID is the ID of the request's record, if it was recorded.
+	RecordID string `json:"record_id,omitempty"`
+	// Digest is the digest of the response's content, as computed by Digest.
+	Digest string `json:"digest"`
+	// Signature is the base64-encoded signature of the other fields.
+	Signature string `json:"signature"`
+}
+
+// payload returns the signed representation of the marker's fields.
+func (m Marker) payload() []byte {
+	return []byte(strings.Join([]string{
+		"model-runner-provenance/v2",
+		m.Model,
+		m.Runner,
+		strconv.FormatInt(m.Timestamp, 10),
+		m.RecordID,
+		m.Digest,
+	}, "\n"))
+}
+
+// Header encodes the marker as the value of an HTTP header, e.g.
+// "model=sha256:...; runner=llama.cpp-0; timestamp=1700000000; record=...;
+// digest=sha256:...; signature=...".
+func (m Marker) Header() string {
+	fields := []string{
+		"model=" + m.Model,
+		"runner=" + m.Runner,
+		"timestamp=" + strconv.FormatInt(m.Timestamp, 10),
+	}
+	if m.RecordID != "" {
+		fields = append(fields, "record="+m.RecordID)
+	}
+	return strings.Join(append(fields, "digest="+m.Digest, "signature="+m.Signature), "; ")
+}
+
+// ParseHeader decodes a marker encoded by Marker.Header.
+func ParseHeader(header string) (Marker, error) {
+	var marker Marker
+	for _, field := range strings.Split(header, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return Marker{}, fmt.Errorf("invalid provenance field %q", field)
+		}
+		switch key {
+		case "model":
+			marker.Model = value
+		case "runner":
+			marker.Runner = value
+		case "timestamp":
+			timestamp, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Marker{}, fmt.Errorf("invalid provenance timestamp %q", value)
+			}
+			marker.Timestamp = timestamp
+		case "record":
+			marker.RecordID = value
+		case "digest":
+			marker.Digest = value
+		case "signature":
+			marker.Signature = value
+		}
+	}
+	if marker.Model == "" || marker.Digest == "" || marker.Signature == "" {
+		return Marker{}, errors.New("provenance must include a model, a digest, and a signature")
+	}
+	return marker, nil
+}
+
+// Digest returns the digest of a response's content, as received by clients.
+// The provenance field of JSON objects is left out, since it holds the marker
+// signing the digest, so their content is digested as re-encoded without it.
+func Digest(content []byte) string {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(content, &object); err == nil && object != nil {
+		if _, ok := object[field]; ok {
+			delete(object, field)
+			if encoded, err := json.Marshal(object); err == nil {
+				content = encoded
+			}
+		}
+	}
+	return digest(content)
+}
+
+// digest returns the SHA-256 digest of content.
+func digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ParseKey decodes a base64 or hex encoded Ed25519 private key seed.
+func ParseKey(encoded string) (ed25519.PrivateKey, error) {
+	encoded = strings.TrimSpace(encoded)
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		if seed, err = hex.DecodeString(encoded); err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("expected a base64 or hex encoded %d-byte Ed25519 seed", ed25519.SeedSize)
+		}
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Signer signs markers.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewSigner creates a signer with a private key. If key is nil, an ephemeral
+// key is generated, whose signatures can only be verified until the runner
+// restarts.
+func NewSigner(key ed25519.PrivateKey) (*Signer, error) {
+	if key == nil {
+		var err error
+		if _, key, err = ed25519.GenerateKey(rand.Reader); err != nil {
+			return nil, fmt.Errorf("generating provenance key: %w", err)
+		}
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("expected a %d-byte Ed25519 private key, got %d bytes", ed25519.PrivateKeySize, len(key))
+	}
+	return &Signer{key: key}, nil
+}
+
+// PublicKey returns the public key verifying the signer's markers.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Sign creates a signed marker for a response produced by a model and runner
+// at a time, whose content has a digest, as computed by Digest.
+func (s *Signer) Sign(model, runner, recordID string, at time.Time, digest string) Marker {
+	marker := Marker{Model: model, Runner: runner, Timestamp: at.Unix(), RecordID: recordID, Digest: digest}
+	marker.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, marker.payload()))
+	return marker
+}
+
+// Verify returns whether a marker was signed by the private key of publicKey
+// for a response's content, and neither has been modified since.
+func Verify(publicKey ed25519.PublicKey, marker Marker, content []byte) bool {
+	signature, err := base64.StdEncoding.DecodeString(marker.Signature)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return Digest(content) == marker.Digest && ed25519.Verify(publicKey, marker.payload(), signature)
+}
@@ -0,0 +1,135 @@
+package provenance
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	key, err := ParseKey(strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatalf("ParseKey failed: %v", err)
+	}
+	signer, err := NewSigner(key)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	content := []byte("The capital of France is Paris.")
+	marker := signer.Sign("sha256:abc", "llama.cpp-0", "record-1", time.Unix(1700000000, 0), Digest(content))
+	if !Verify(signer.PublicKey(), marker, content) {
+		t.Fatal("expected the marker to verify")
+	}
+
+	// Markers survive a round trip through the header.
+	parsed, err := ParseHeader(marker.Header())
+	if err != nil || parsed != marker {
+		t.Fatalf("expected %+v from the header, got %+v (%v)", marker, parsed, err)
+	}
+
+	// Modified markers, tampered content, and other keys don't verify.
+	tampered := marker
+	tampered.Model = "sha256:def"
+	if Verify(signer.PublicKey(), tampered, content) {
+		t.Error("expected a modified marker not to verify")
+	}
+	if Verify(signer.PublicKey(), marker, []byte("The capital of France is Lyon.")) {
+		t.Error("expected tampered content not to verify")
+	}
+	tampered = marker
+	tampered.Digest = Digest([]byte("The capital of France is Lyon."))
+	if Verify(signer.PublicKey(), tampered, []byte("The capital of France is Lyon.")) {
+		t.Error("expected a marker with a replaced digest not to verify")
+	}
+	other, _ := NewSigner(nil)
+	if Verify(other.PublicKey(), marker, content) {
+		t.Error("expected a marker not to verify with another key")
+	}
+
+	for _, invalid := range []string{"", "not a key", strings.Repeat("ab", 16)} {
+		if _, err := ParseKey(invalid); err == nil {
+			t.Errorf("expected key %q to be rejected", invalid)
+		}
+	}
+	if _, err := ParseHeader("model=sha256:abc; runner"); err == nil {
+		t.Error("expected an invalid header to be rejected")
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	signer, err := NewSigner(nil)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	marker := Marker{Model: "sha256:abc", Runner: "llama.cpp-0", Timestamp: 1700000000}
+	write := func(contentType, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		w := NewResponseWriter(recorder, signer, marker)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(body))
+		if err := w.Finish(); err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		return recorder
+	}
+
+	recorder := write("application/json", `{"id": "chatcmpl-1", "object": "chat.completion"}`)
+	var response struct {
+		ID         string `json:"id"`
+		Provenance Marker `json:"provenance"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %s: %v", recorder.Body, err)
+	}
+	if response.ID != "chatcmpl-1" || response.Provenance.Model != marker.Model || response.Provenance.Runner != marker.Runner {
+		t.Errorf("expected the marker to be added, got %s", recorder.Body)
+	}
+	if !Verify(signer.PublicKey(), response.Provenance, recorder.Body.Bytes()) {
+		t.Errorf("expected the response to verify with its provenance field, got %s", recorder.Body)
+	}
+	header, err := ParseHeader(recorder.Header().Get(inference.ProvenanceHeader))
+	if err != nil || header != response.Provenance {
+		t.Errorf("expected the header to hold the marker, got %+v (%v)", header, err)
+	}
+	if recorder.Header().Get("Content-Length") != "" {
+		t.Error("expected the content length to be removed")
+	}
+
+	// Copying the marker of a response onto other content doesn't verify.
+	forged := strings.Replace(recorder.Body.String(), "chatcmpl-1", "chatcmpl-2", 1)
+	if Verify(signer.PublicKey(), response.Provenance, []byte(forged)) {
+		t.Errorf("expected tampered content not to verify, got %s", forged)
+	}
+
+	// Streams are unmodified, with their marker in a trailer.
+	stream := "data: {\"id\":\"chatcmpl-1\"}\n\ndata: [DONE]\n\n"
+	if recorder = write("text/event-stream", stream); recorder.Body.String() != stream {
+		t.Errorf("expected streams to be unmodified, got %q", recorder.Body)
+	}
+	trailers := recorder.Result().Trailer
+	trailer, err := ParseHeader(trailers.Get(inference.ProvenanceHeader))
+	if err != nil || !Verify(signer.PublicKey(), trailer, []byte(stream)) {
+		t.Errorf("expected the stream to verify with its trailer, got %v (%v)", trailers, err)
+	}
+	if Verify(signer.PublicKey(), trailer, []byte(strings.Replace(stream, "chatcmpl-1", "chatcmpl-2", 1))) {
+		t.Error("expected a tampered stream not to verify")
+	}
+
+	if recorder = write("application/json", `[1, 2]`); recorder.Body.String() != `[1, 2]` {
+		t.Errorf("expected non-object responses to be unmodified, got %q", recorder.Body)
+	}
+	header, err = ParseHeader(recorder.Header().Get(inference.ProvenanceHeader))
+	if err != nil || !Verify(signer.PublicKey(), header, recorder.Body.Bytes()) {
+		t.Errorf("expected non-object responses to verify with their header, got %+v (%v)", header, err)
+	}
+	if recorder = write("application/json", `null`); recorder.Body.String() != `null` {
+		t.Errorf("expected null responses to be unmodified, got %q", recorder.Body)
+	}
+}
@@ -0,0 +1,121 @@
+package provenance
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+// ResponseWriter signs the marker of a response once its content is known.
+// Successful JSON responses are buffered, so that the marker is reported in
+// their provenance header and, for JSON objects, in a "provenance" extension
+// field. The marker of other responses, such as streams, is reported in their
+// provenance trailer. Finish must be called once the response has been fully
+// written.
+type ResponseWriter struct {
+	http.ResponseWriter
+	// signer signs the marker.
+	signer *Signer
+	// marker is the marker to sign, without its digest.
+	marker Marker
+	// statusCode is the response status code.
+	statusCode int
+	// buffered indicates whether the response body is buffered.
+	buffered bool
+	// buffer holds the complete body of a buffered response.
+	buffer bytes.Buffer
+	// hash digests the body of an unbuffered response.
+	hash hash.Hash
+}
+
+// NewResponseWriter creates a new ResponseWriter that wraps w and reports
+// marker, signed by signer once the response's content is known.
+func NewResponseWriter(w http.ResponseWriter, signer *Signer, marker Marker) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, signer: signer, marker: marker}
+}
+
+// WriteHeader implements net/http.ResponseWriter.WriteHeader. The header of
+// buffered responses is only written by Finish.
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	contentType := w.Header().Get("Content-Type")
+	w.buffered = statusCode == http.StatusOK && strings.HasPrefix(contentType, "application/json")
+	// Buffered bodies may be rewritten, so their length may change, and the
+	// trailers of unbuffered ones require chunked encoding.
+	w.Header().Del("Content-Length")
+	if w.buffered {
+		return
+	}
+	w.Header().Add("Trailer", inference.ProvenanceHeader)
+	w.hash = sha256.New()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements net/http.ResponseWriter.Write.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffered {
+		w.hash.Write(b)
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buffer.Write(b)
+}
+
+// Flush implements net/http.Flusher.Flush. Buffered responses are only
+// written by Finish.
+func (w *ResponseWriter) Flush() {
+	if w.buffered {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Finish signs the marker and writes any buffered output.
+func (w *ResponseWriter) Finish() error {
+	if w.statusCode == 0 {
+		return nil
+	}
+	if !w.buffered {
+		marker := w.sign("sha256:" + hex.EncodeToString(w.hash.Sum(nil)))
+		w.Header().Set(inference.ProvenanceHeader, marker.Header())
+		return nil
+	}
+
+	// The marker is added to JSON objects, whose content is digested as
+	// re-encoded without it, as by Digest.
+	body := w.buffer.Bytes()
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil || response == nil {
+		response = nil
+	} else if encoded, err := json.Marshal(response); err == nil {
+		body = encoded
+	}
+	marker := w.sign(digest(body))
+	if response != nil {
+		response[field], _ = json.Marshal(marker)
+		if rewritten, err := json.Marshal(response); err == nil {
+			body = rewritten
+		}
+	}
+	w.buffer.Reset()
+	w.Header().Set(inference.ProvenanceHeader, marker.Header())
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, err := w.ResponseWriter.Write(body)
+	return err
+}
+
+// sign signs the marker for content with a digest.
+func (w *ResponseWriter) sign(digest string) Marker {
+	return w.signer.Sign(w.marker.Model, w.marker.Runner, w.marker.RecordID, time.Unix(w.marker.Timestamp, 0), digest)
+}
@@ -0,0 +1,44 @@
+package quirks
+
+// intPtr returns a pointer to an integer.
+func intPtr(v int) *int {
+	return &v
+}
+
+// builtinRules are the rules describing the quirks of popular GGUF
+// conversions.
+var builtinRules = []Rule{
+	{
+		Name: "llama3-eot-eos",
+		Description: "Llama 3 instruct conversions whose end-of-sequence token is <|end_of_text|> rather than <|eot_id|>, " +
+			"which ends the assistant's turns, so generation runs on past the end of the answer.",
+		Match: Match{
+			Architecture: "llama",
+			Metadata:     map[string]string{EOSTokenIDKey: "128001"},
+			ChatTemplate: "<|eot_id|>",
+		},
+		EOSTokenID: intPtr(128009),
+	},
+	{
+		Name: "gemma-end-of-turn-eos",
+		Description: "Gemma instruct conversions whose end-of-sequence token is <eos> rather than <end_of_turn>, " +
+			"which ends the model's turns, so generation runs on into a new user turn.",
+		Match: Match{
+			Metadata:     map[string]string{EOSTokenIDKey: "1"},
+			ChatTemplate: "<end_of_turn>",
+		},
+		EOSTokenID: intPtr(107),
+	},
+	{
+		Name: "mistral-role-alternation",
+		Description: "Mistral chat templates that reject conversations whose roles don't alternate between user and " +
+			"assistant, which includes every conversation with tool calls.",
+		Match: Match{
+			ChatTemplate: "raise_exception('Conversation roles must alternate user/assistant/user/assistant/...')",
+		},
+		TemplatePatches: []TemplatePatch{{
+			Old: "raise_exception('Conversation roles must alternate user/assistant/user/assistant/...')",
+			New: "''",
+		}},
+	},
+}
@@ -0,0 +1,223 @@
+// Package quirks maintains a registry of known chat template and tokenizer
+// bugs of GGUF models, and of the workarounds applied to the models they
+// affect when they're loaded.
+package quirks
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+)
+
+const (
+	// architectureKey is the GGUF metadata key holding the model's
+	// architecture.
+	architectureKey = "general.architecture"
+	// nameKey is the GGUF metadata key holding the model's name.
+	nameKey = "general.name"
+	// ChatTemplateKey is the GGUF metadata key holding the chat template.
+	ChatTemplateKey = "tokenizer.chat_template"
+	// EOSTokenIDKey is the GGUF metadata key holding the ID of the
+	// end-of-sequence token.
+	EOSTokenIDKey = "tokenizer.ggml.eos_token_id"
+)
+
+// Match selects the models affected by a rule. All of its non-empty fields
+// must match.
+type Match struct {
+	// Architecture is the model's architecture, compared case-insensitively.
+	Architecture string `json:"architecture,omitempty"`
+	// Name is a substring of the model's name in its metadata, compared
+	// case-insensitively.
+	Name string `json:"name,omitempty"`
+	// Metadata maps GGUF metadata keys to their values, e.g.
+	// "tokenizer.ggml.eos_token_id" to "128001".
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// ChatTemplate is a substring of the model's chat template.
+	ChatTemplate string `json:"chat_template,omitempty"`
+}
+
+// TemplatePatch replaces all occurrences of a string in a chat template.
+type TemplatePatch struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// Rule describes a known quirk of some models and the workarounds applied to
+// them.
+type Rule struct {
+	// Name identifies the rule. Rules replace the built-in rules with the same
+	// name.
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Match       Match  `json:"match"`
+	// EOSTokenID overrides the ID of the model's end-of-sequence token.
+	EOSTokenID *int `json:"eos_token_id,omitempty"`
+	// ChatTemplate replaces the model's chat template.
+	ChatTemplate string `json:"chat_template,omitempty"`
+	// TemplatePatches are applied in order to the model's chat template,
+	// after it's replaced.
+	TemplatePatches []TemplatePatch `json:"template_patches,omitempty"`
+	// Disabled turns the rule off, e.g. to disable a built-in rule.
+	Disabled bool `json:"disabled,omitempty"`
+	// Builtin indicates that the rule is one of the built-in rules. It's set
+	// when rules are listed.
+	Builtin bool `json:"builtin,omitempty"`
+}
+
+// validate checks that a rule is well-formed.
+func (r Rule) validate() error {
+	if r.Name == "" {
+		return errors.New("rule name is required")
+	}
+	if r.Match.Architecture == "" && r.Match.Name == "" && len(r.Match.Metadata) == 0 && r.Match.ChatTemplate == "" {
+		return fmt.Errorf("rule %s must match on at least one of architecture, name, metadata, or chat_template", r.Name)
+	}
+	if r.EOSTokenID == nil && r.ChatTemplate == "" && len(r.TemplatePatches) == 0 && !r.Disabled {
+		return fmt.Errorf("rule %s has no workarounds", r.Name)
+	}
+	if r.EOSTokenID != nil && *r.EOSTokenID < 0 {
+		return fmt.Errorf("rule %s has a negative eos_token_id", r.Name)
+	}
+	for _, patch := range r.TemplatePatches {
+		if patch.Old == "" {
+			return fmt.Errorf("rule %s has a template patch without old", r.Name)
+		}
+	}
+	return nil
+}
+
+// matches returns whether a rule applies to a model with a configuration and
+// chat template.
+func (r Rule) matches(config types.Config, template string) bool {
+	if r.Disabled {
+		return false
+	}
+	if r.Match.Architecture != "" {
+		architecture := cmp.Or(config.GGUF[architectureKey], config.Architecture)
+		if !strings.EqualFold(architecture, r.Match.Architecture) {
+			return false
+		}
+	}
+	if r.Match.Name != "" && !strings.Contains(strings.ToLower(config.GGUF[nameKey]), strings.ToLower(r.Match.Name)) {
+		return false
+	}
+	for key, value := range r.Match.Metadata {
+		if actual, ok := config.GGUF[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return r.Match.ChatTemplate == "" || strings.Contains(template, r.Match.ChatTemplate)
+}
+
+// Workarounds are the combined workarounds of the rules that apply to a model.
+type Workarounds struct {
+	// Rules are the rules that apply to the model, ordered by name.
+	Rules []Rule
+	// EOSTokenID is the ID of the model's end-of-sequence token, if it's
+	// overridden.
+	EOSTokenID *int
+	// ChatTemplate is the model's fixed chat template, or empty if it's
+	// unchanged.
+	ChatTemplate string
+}
+
+// Registry holds the rules describing known quirks of models: the built-in
+// rules, and rules added at runtime, which replace built-in rules with the
+// same name. It's safe for concurrent use.
+type Registry struct {
+	// mutex guards rules.
+	mutex sync.RWMutex
+	// rules maps names to the rules added at runtime.
+	rules map[string]Rule
+}
+
+// NewRegistry creates a registry with the built-in rules.
+func NewRegistry() *Registry {
+	return &Registry{rules: make(map[string]Rule)}
+}
+
+// Set adds or replaces rules, which apply to the models loaded afterwards.
+func (r *Registry) Set(rules ...Rule) error {
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, rule := range rules {
+		rule.Builtin = false
+		r.rules[rule.Name] = rule
+	}
+	return nil
+}
+
+// Remove removes a rule added at runtime, restoring the built-in rule with the
+// same name, if any. It returns false if there's no such rule.
+func (r *Registry) Remove(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.rules[name]; !ok {
+		return false
+	}
+	delete(r.rules, name)
+	return true
+}
+
+// Custom returns the rules added at runtime, ordered by name.
+func (r *Registry) Custom() []Rule {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	rules := make([]Rule, 0, len(r.rules))
+	for _, rule := range r.rules {
+		rules = append(rules, rule)
+	}
+	slices.SortFunc(rules, func(a, b Rule) int { return cmp.Compare(a.Name, b.Name) })
+	return rules
+}
+
+// List returns the effective rules, ordered by name.
+func (r *Registry) List() []Rule {
+	rules := r.Custom()
+	for _, rule := range builtinRules {
+		if !slices.ContainsFunc(rules, func(custom Rule) bool { return custom.Name == rule.Name }) {
+			rule.Builtin = true
+			rules = append(rules, rule)
+		}
+	}
+	slices.SortFunc(rules, func(a, b Rule) int { return cmp.Compare(a.Name, b.Name) })
+	return rules
+}
+
+// Workarounds returns the workarounds for a model with a configuration and
+// chat template. Rules are matched against the model's original chat
+// template and applied in order, so later rules take precedence.
+func (r *Registry) Workarounds(config types.Config, template string) Workarounds {
+	var workarounds Workarounds
+	fixed := template
+	for _, rule := range r.List() {
+		if !rule.matches(config, template) {
+			continue
+		}
+		workarounds.Rules = append(workarounds.Rules, rule)
+		if rule.EOSTokenID != nil {
+			workarounds.EOSTokenID = rule.EOSTokenID
+		}
+		if rule.ChatTemplate != "" {
+			fixed = rule.ChatTemplate
+		}
+		for _, patch := range rule.TemplatePatches {
+			fixed = strings.ReplaceAll(fixed, patch.Old, patch.New)
+		}
+	}
+	if fixed != template {
+		workarounds.ChatTemplate = fixed
+	}
+	return workarounds
+}
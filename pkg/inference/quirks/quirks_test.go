@@ -0,0 +1,94 @@
+package quirks
+
+import (
+	"testing"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+)
+
+func TestWorkarounds(t *testing.T) {
+	llama3 := types.Config{GGUF: map[string]string{
+		architectureKey: "llama",
+		EOSTokenIDKey:   "128001",
+		ChatTemplateKey: "<|start_header_id|>{{ role }}<|end_header_id|>{{ content }}<|eot_id|>",
+	}}
+	registry := NewRegistry()
+
+	workarounds := registry.Workarounds(llama3, llama3.GGUF[ChatTemplateKey])
+	if len(workarounds.Rules) != 1 || workarounds.Rules[0].Name != "llama3-eot-eos" || !workarounds.Rules[0].Builtin {
+		t.Fatalf("expected the llama3-eot-eos rule, got %+v", workarounds.Rules)
+	}
+	if workarounds.EOSTokenID == nil || *workarounds.EOSTokenID != 128009 {
+		t.Errorf("expected EOS token 128009, got %v", workarounds.EOSTokenID)
+	}
+	if workarounds.ChatTemplate != "" {
+		t.Errorf("expected the chat template to be unchanged, got %q", workarounds.ChatTemplate)
+	}
+
+	// Fixed conversions aren't affected.
+	fixed := types.Config{GGUF: map[string]string{architectureKey: "llama", EOSTokenIDKey: "128009"}}
+	if rules := registry.Workarounds(fixed, llama3.GGUF[ChatTemplateKey]).Rules; len(rules) != 0 {
+		t.Errorf("expected no rules for a fixed conversion, got %+v", rules)
+	}
+
+	mistral := "{% if x %}{{ raise_exception('Conversation roles must alternate user/assistant/user/assistant/...') }}{% endif %}"
+	workarounds = registry.Workarounds(types.Config{}, mistral)
+	if workarounds.ChatTemplate != "{% if x %}{{ '' }}{% endif %}" {
+		t.Errorf("expected the role alternation check to be patched out, got %q", workarounds.ChatTemplate)
+	}
+
+	// Runtime rules are added to and replace the built-in rules.
+	eos := 2
+	if err := registry.Set(
+		Rule{Name: "llama3-eot-eos", Disabled: true, Match: Match{Architecture: "llama"}},
+		Rule{
+			Name:         "custom",
+			Match:        Match{Name: "TinyLlama"},
+			EOSTokenID:   &eos,
+			ChatTemplate: "{{ messages }}",
+		},
+	); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if rules := registry.Workarounds(llama3, llama3.GGUF[ChatTemplateKey]).Rules; len(rules) != 0 {
+		t.Errorf("expected the disabled rule not to apply, got %+v", rules)
+	}
+	tiny := types.Config{GGUF: map[string]string{nameKey: "tinyllama 1.1B chat"}}
+	workarounds = registry.Workarounds(tiny, "")
+	if len(workarounds.Rules) != 1 || workarounds.Rules[0].Builtin {
+		t.Fatalf("expected the custom rule, got %+v", workarounds.Rules)
+	}
+	if *workarounds.EOSTokenID != 2 || workarounds.ChatTemplate != "{{ messages }}" {
+		t.Errorf("unexpected workarounds %+v", workarounds)
+	}
+	if len(registry.Custom()) != 2 || len(registry.List()) != len(builtinRules)+1 {
+		t.Errorf("expected 2 custom rules and %d effective rules, got %d and %d",
+			len(builtinRules)+1, len(registry.Custom()), len(registry.List()))
+	}
+
+	// Removing a runtime rule restores the built-in rule.
+	if !registry.Remove("llama3-eot-eos") {
+		t.Fatal("expected the rule to be removed")
+	}
+	if registry.Remove("llama3-eot-eos") {
+		t.Error("expected built-in rules not to be removable")
+	}
+	if rules := registry.Workarounds(llama3, llama3.GGUF[ChatTemplateKey]).Rules; len(rules) != 1 {
+		t.Errorf("expected the built-in rule to be restored, got %+v", rules)
+	}
+}
+
+func TestRuleValidation(t *testing.T) {
+	eos := -1
+	for _, rule := range []Rule{
+		{Match: Match{Architecture: "llama"}, ChatTemplate: "x"},
+		{Name: "no-match", ChatTemplate: "x"},
+		{Name: "no-workarounds", Match: Match{Architecture: "llama"}},
+		{Name: "negative-eos", Match: Match{Architecture: "llama"}, EOSTokenID: &eos},
+		{Name: "empty-patch", Match: Match{Architecture: "llama"}, TemplatePatches: []TemplatePatch{{New: "x"}}},
+	} {
+		if err := NewRegistry().Set(rule); err == nil {
+			t.Errorf("expected rule %+v to be rejected", rule)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Package realtime implements a subset of the OpenAI Realtime API, in which
+// clients converse with a model by exchanging JSON events over a WebSocket.
+// Conversations of text and audio input are bridged to streaming chat
+// completion requests, whose outputs are streamed back as text events. Audio
+// input is transcribed by a transcription.Transcriber, if one is available,
+// and passed to the model as text; otherwise it's passed as input_audio
+// content, which requires a model that accepts audio. Audio output isn't
+// supported, since there's no text-to-speech backend.
+package realtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// SampleRate is the sample rate of pcm16 audio, in Hz. Audio is mono and
+	// little-endian.
+	SampleRate = 24000
+	// MaximumAudioBufferBytes is the maximum size of the input audio buffer,
+	// which holds about five minutes of audio.
+	MaximumAudioBufferBytes = 5 * 60 * SampleRate * 2
+	// minimumCommitBytes is the minimum size of committed audio, which is
+	// 100ms of audio.
+	minimumCommitBytes = SampleRate * 2 / 10
+	// defaultTemperature is the sampling temperature of new sessions.
+	defaultTemperature = 0.8
+)
+
+// MaxTokens is a maximum number of output tokens, which is encoded as "inf"
+// if unlimited.
+type MaxTokens int
+
+// MarshalJSON implements json.Marshaler.MarshalJSON.
+func (m MaxTokens) MarshalJSON() ([]byte, error) {
+	if m <= 0 {
+		return []byte(`"inf"`), nil
+	}
+	return []byte(strconv.Itoa(int(m))), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.UnmarshalJSON.
+func (m *MaxTokens) UnmarshalJSON(data []byte) error {
+	var value string
+	if json.Unmarshal(data, &value) == nil {
+		if value != "inf" {
+			return errors.New(`maximum output tokens must be an integer or "inf"`)
+		}
+		*m = 0
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(data, &n); err != nil || n < 1 {
+		return errors.New(`maximum output tokens must be a positive integer or "inf"`)
+	}
+	*m = MaxTokens(n)
+	return nil
+}
+
+// SessionConfig is the configuration of a realtime session, as reported in
+// session.created and session.updated events.
+type SessionConfig struct {
+	ID     string `json:"id"`
+	Object string `json:"object"`
+	Model  string `json:"model"`
+	// Modalities are the output modalities, which are always text: sessions
+	// and responses requesting audio output are rejected, since there's no
+	// text-to-speech backend.
+	Modalities []string `json:"modalities"`
+	// Instructions are the system instructions of responses.
+	Instructions     string `json:"instructions"`
+	InputAudioFormat string `json:"input_audio_format"`
+	// InputAudioTranscription configures the transcription of input audio,
+	// whose transcripts are passed to the model instead of the audio. It's
+	// null if transcription is disabled or unavailable.
+	InputAudioTranscription *InputAudioTranscription `json:"input_audio_transcription"`
+	// TurnDetection is always null, since clients commit the input audio
+	// buffer and request responses explicitly.
+	TurnDetection           *struct{} `json:"turn_detection"`
+	Temperature             float64   `json:"temperature"`
+	MaxResponseOutputTokens MaxTokens `json:"max_response_output_tokens"`
+}
+
+// InputAudioTranscription configures the transcription of input audio.
+type InputAudioTranscription struct {
+	// Model is the transcription model requested by the client. It's only
+	// echoed back, since audio is transcribed by the server's transcriber.
+	Model string `json:"model,omitempty"`
+	// Language is the language of the audio, which is detected if empty.
+	Language string `json:"language,omitempty"`
+}
+
+// sessionUpdate is the session field of a session.update event. Unset fields
+// leave the configuration unchanged.
+type sessionUpdate struct {
+	Modalities              []string          `json:"modalities"`
+	Instructions            *string           `json:"instructions"`
+	InputAudioFormat        *string           `json:"input_audio_format"`
+	InputAudioTranscription json.RawMessage   `json:"input_audio_transcription"`
+	TurnDetection           json.RawMessage   `json:"turn_detection"`
+	Tools                   []json.RawMessage `json:"tools"`
+	Temperature             *float64          `json:"temperature"`
+	MaxResponseOutputTokens *MaxTokens        `json:"max_response_output_tokens"`
+}
+
+// apply validates a session update and applies it to a configuration. Input
+// audio transcription can only be enabled if transcribing is true.
+func (u sessionUpdate) apply(config *SessionConfig, transcribing bool) *Error {
+	if u.Modalities != nil {
+		if err := checkModalities(u.Modalities, "session.modalities"); err != nil {
+			return err
+		}
+	}
+	if u.InputAudioFormat != nil && *u.InputAudioFormat != "pcm16" {
+		return invalidValue("session.input_audio_format", "unsupported input audio format %q (only pcm16 is supported)", *u.InputAudioFormat)
+	}
+	var transcription *InputAudioTranscription
+	if len(u.InputAudioTranscription) > 0 && string(bytes.TrimSpace(u.InputAudioTranscription)) != "null" {
+		if !transcribing {
+			return invalidValue("session.input_audio_transcription", "input audio transcription isn't supported, since no speech-to-text backend is available")
+		}
+		if err := json.Unmarshal(u.InputAudioTranscription, &transcription); err != nil {
+			return invalidValue("session.input_audio_transcription", "invalid input audio transcription: %v", err)
+		}
+	}
+	if len(u.TurnDetection) > 0 && string(bytes.TrimSpace(u.TurnDetection)) != "null" {
+		return invalidValue("session.turn_detection", "turn detection isn't supported; commit the input audio buffer and create responses explicitly")
+	}
+	if len(u.Tools) > 0 {
+		return invalidValue("session.tools", "tools aren't supported")
+	}
+	if u.Temperature != nil && (*u.Temperature < 0 || *u.Temperature > 2) {
+		return invalidValue("session.temperature", "temperature must be between 0 and 2")
+	}
+
+	if u.Instructions != nil {
+		config.Instructions = *u.Instructions
+	}
+	if len(u.InputAudioTranscription) > 0 {
+		config.InputAudioTranscription = transcription
+	}
+	if u.Temperature != nil {
+		config.Temperature = *u.Temperature
+	}
+	if u.MaxResponseOutputTokens != nil {
+		config.MaxResponseOutputTokens = *u.MaxResponseOutputTokens
+	}
+	return nil
+}
+
+// checkModalities checks that requested output modalities are supported.
+func checkModalities(modalities []string, param string) *Error {
+	for _, modality := range modalities {
+		switch modality {
+		case "text":
+		case "audio":
+			return invalidValue(param, "audio output isn't supported, since no text-to-speech backend is available")
+		default:
+			return invalidValue(param, "unknown modality %q", modality)
+		}
+	}
+	return nil
+}
+
+// ContentPart is a part of a conversation item's content.
+type ContentPart struct {
+	// Type is input_text or input_audio for user messages, input_text for
+	// system messages, and text for assistant messages.
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// Audio is base64-encoded pcm16 audio. It's only set in client events,
+	// and isn't echoed back.
+	Audio string `json:"audio,omitempty"`
+	// Transcript is the transcript of input_audio content, once it's been
+	// transcribed.
+	Transcript string `json:"transcript,omitempty"`
+	// audio is the decoded audio.
+	audio []byte
+	// transcribed is whether the audio has been transcribed, in which case
+	// the transcript is passed to the model instead of the audio.
+	transcribed bool
+}
+
+// Item is a conversation item. Only message items are supported.
+type Item struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Type    string        `json:"type"`
+	Status  string        `json:"status"`
+	Role    string        `json:"role"`
+	Content []ContentPart `json:"content"`
+}
+
+// Usage is the token usage of a response.
+type Usage struct {
+	TotalTokens  int64 `json:"total_tokens"`
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+}
+
+// Response is a response to a response.create event.
+type Response struct {
+	ID     string `json:"id"`
+	Object string `json:"object"`
+	// Status is in_progress, completed, cancelled, or failed.
+	Status        string         `json:"status"`
+	StatusDetails *StatusDetails `json:"status_details"`
+	Output        []Item         `json:"output"`
+	Usage         *Usage         `json:"usage"`
+}
+
+// StatusDetails describe why a response was cancelled or failed.
+type StatusDetails struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason,omitempty"`
+	Error  *Error `json:"error,omitempty"`
+}
+
+// Error is the error of an error event.
+type Error struct {
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	// EventID is the ID of the client event that caused the error, if any.
+	EventID string `json:"event_id,omitempty"`
+}
+
+// Error implements error.Error.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// invalidValue returns an invalid_request_error for a parameter.
+func invalidValue(param, format string, args ...any) *Error {
+	return &Error{Type: "invalid_request_error", Code: "invalid_value", Message: fmt.Sprintf(format, args...), Param: param}
+}
+
+// invalidRequest returns an invalid_request_error with the specified code.
+func invalidRequest(code, format string, args ...any) *Error {
+	return &Error{Type: "invalid_request_error", Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// encodeWAV encodes pcm16 audio as a WAV file.
+func encodeWAV(pcm []byte) []byte {
+	const bitsPerSample, channels = 16, 1
+	var wav bytes.Buffer
+	wav.Grow(44 + len(pcm))
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(36+len(pcm)))
+	wav.WriteString("WAVEfmt ")
+	for _, field := range []any{
+		uint32(16),
+		uint16(1), // PCM
+		uint16(channels),
+		uint32(SampleRate),
+		uint32(SampleRate * channels * bitsPerSample / 8),
+		uint16(channels * bitsPerSample / 8),
+		uint16(bitsPerSample),
+	} {
+		binary.Write(&wav, binary.LittleEndian, field)
+	}
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(len(pcm)))
+	wav.Write(pcm)
+	return wav.Bytes()
+}
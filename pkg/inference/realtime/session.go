@@ -0,0 +1,529 @@
+package realtime
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/transcription"
+)
+
+// Generator streams a model's response to a chat completion request body,
+// calling delta with each fragment of generated text as it's received. It
+// returns the response's usage.
+type Generator func(ctx context.Context, request []byte, delta func(text string)) (Usage, error)
+
+// Session is a realtime session, which holds a conversation and responds to
+// client events. Handle must not be called concurrently, but responses are
+// generated in the background so that they can be cancelled.
+type Session struct {
+	// ctx is the session's context, which is cancelled when it's closed.
+	ctx context.Context
+	// cancel cancels ctx.
+	cancel context.CancelFunc
+	// generate generates responses.
+	generate Generator
+	// transcriber transcribes input audio, if available.
+	transcriber transcription.Transcriber
+	// send sends an encoded server event to the client.
+	send func(event []byte) error
+	// responses tracks the response being generated, if any.
+	responses sync.WaitGroup
+	// transcriptions tracks the transcriptions in progress.
+	transcriptions sync.WaitGroup
+
+	// m guards the fields below, and serializes server events.
+	m sync.Mutex
+	// config is the session's configuration.
+	config SessionConfig
+	// items is the conversation.
+	items []Item
+	// audio is the input audio buffer.
+	audio []byte
+	// events is the number of server events sent.
+	events int
+	// cancelResponse cancels the response being generated, if any.
+	cancelResponse context.CancelFunc
+	// transcribing holds a channel for each transcription in progress, which
+	// is closed when it completes.
+	transcribing []chan struct{}
+}
+
+// NewSession creates a session conversing with a model. If transcriber isn't
+// nil, input audio is transcribed and the model receives the transcripts
+// instead of the audio. Server events are sent by calling send, which isn't
+// called concurrently.
+func NewSession(ctx context.Context, model string, generate Generator, transcriber transcription.Transcriber, send func(event []byte) error) *Session {
+	ctx, cancel := context.WithCancel(ctx)
+	session := &Session{
+		ctx:         ctx,
+		cancel:      cancel,
+		generate:    generate,
+		transcriber: transcriber,
+		send:        send,
+		config: SessionConfig{
+			ID:               utils.NewID("sess_"),
+			Object:           "realtime.session",
+			Model:            model,
+			Modalities:       []string{"text"},
+			InputAudioFormat: "pcm16",
+			Temperature:      defaultTemperature,
+		},
+	}
+	if transcriber != nil {
+		session.config.InputAudioTranscription = &InputAudioTranscription{}
+	}
+	return session
+}
+
+// Start sends the session.created event.
+func (s *Session) Start() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.emit("session.created", map[string]any{"session": s.config})
+}
+
+// Close cancels the response being generated and the transcriptions in
+// progress, if any, and waits for them to complete.
+func (s *Session) Close() {
+	s.cancel()
+	s.responses.Wait()
+	s.transcriptions.Wait()
+}
+
+// emit sends a server event with the specified type and fields. The caller
+// must hold the lock.
+func (s *Session) emit(eventType string, fields map[string]any) error {
+	s.events++
+	event := map[string]any{"event_id": fmt.Sprintf("event_%d", s.events), "type": eventType}
+	for name, value := range fields {
+		event[name] = value
+	}
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to encode %s event: %w", eventType, err)
+	}
+	return s.send(encoded)
+}
+
+// emitError sends an error event. The caller must hold the lock.
+func (s *Session) emitError(err *Error, eventID string) error {
+	err.EventID = eventID
+	return s.emit("error", map[string]any{"error": err})
+}
+
+// clientEvent is the common structure of client events. Fields are only set
+// for the events that define them.
+type clientEvent struct {
+	EventID        string          `json:"event_id"`
+	Type           string          `json:"type"`
+	Session        json.RawMessage `json:"session"`
+	Audio          string          `json:"audio"`
+	PreviousItemID *string         `json:"previous_item_id"`
+	Item           *Item           `json:"item"`
+	ItemID         string          `json:"item_id"`
+	Response       *responseConfig `json:"response"`
+}
+
+// responseConfig is the response field of a response.create event, which
+// overrides the session's configuration for a response.
+type responseConfig struct {
+	Modalities      []string   `json:"modalities"`
+	Instructions    *string    `json:"instructions"`
+	Temperature     *float64   `json:"temperature"`
+	MaxOutputTokens *MaxTokens `json:"max_output_tokens"`
+}
+
+// Handle handles a client event. Invalid events are reported to the client
+// with error events. It returns an error only if sending server events failed,
+// in which case the session should be closed.
+func (s *Session) Handle(data []byte) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var event clientEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return s.emitError(invalidRequest("invalid_json", "invalid event: %v", err), "")
+	}
+	if err := s.handle(event); err != nil {
+		var protocolErr *Error
+		if errors.As(err, &protocolErr) {
+			return s.emitError(protocolErr, event.EventID)
+		}
+		return err
+	}
+	return nil
+}
+
+// handle handles a decoded client event. The caller must hold the lock.
+func (s *Session) handle(event clientEvent) error {
+	switch event.Type {
+	case "session.update":
+		var update sessionUpdate
+		if err := json.Unmarshal(event.Session, &update); err != nil {
+			return invalidValue("session", "invalid session: %v", err)
+		}
+		if err := update.apply(&s.config, s.transcriber != nil); err != nil {
+			return err
+		}
+		return s.emit("session.updated", map[string]any{"session": s.config})
+	case "input_audio_buffer.append":
+		audio, err := base64.StdEncoding.DecodeString(event.Audio)
+		if err != nil {
+			return invalidValue("audio", "audio must be base64-encoded")
+		}
+		if len(s.audio)+len(audio) > MaximumAudioBufferBytes {
+			return invalidRequest("input_audio_buffer_full", "the input audio buffer holds at most %d bytes", MaximumAudioBufferBytes)
+		}
+		s.audio = append(s.audio, audio...)
+		return nil
+	case "input_audio_buffer.clear":
+		s.audio = nil
+		return s.emit("input_audio_buffer.cleared", nil)
+	case "input_audio_buffer.commit":
+		if len(s.audio) < minimumCommitBytes {
+			return invalidRequest("input_audio_buffer_commit_empty", "the input audio buffer holds %d bytes, but at least 100ms (%d bytes) of audio is required", len(s.audio), minimumCommitBytes)
+		}
+		item := Item{
+			ID:      utils.NewID("item_"),
+			Object:  "realtime.item",
+			Type:    "message",
+			Status:  "completed",
+			Role:    "user",
+			Content: []ContentPart{{Type: "input_audio", audio: s.audio}},
+		}
+		s.audio = nil
+		previousID := s.insert(item, len(s.items))
+		if err := s.emit("input_audio_buffer.committed", map[string]any{"previous_item_id": previousID, "item_id": item.ID}); err != nil {
+			return err
+		}
+		if err := s.emit("conversation.item.created", map[string]any{"previous_item_id": previousID, "item": item}); err != nil {
+			return err
+		}
+		s.transcribe(item)
+		return nil
+	case "conversation.item.create":
+		if event.Item == nil {
+			return invalidValue("item", "item is required")
+		}
+		item, err := newItem(*event.Item)
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(s.items, func(existing Item) bool { return existing.ID == item.ID }) {
+			return invalidValue("item.id", "item %s already exists", item.ID)
+		}
+		index := len(s.items)
+		if event.PreviousItemID != nil {
+			if index = s.indexAfter(*event.PreviousItemID); index < 0 {
+				return invalidValue("previous_item_id", "item %s doesn't exist", *event.PreviousItemID)
+			}
+		}
+		previousID := s.insert(item, index)
+		if err := s.emit("conversation.item.created", map[string]any{"previous_item_id": previousID, "item": item}); err != nil {
+			return err
+		}
+		s.transcribe(item)
+		return nil
+	case "conversation.item.delete":
+		index := slices.IndexFunc(s.items, func(item Item) bool { return item.ID == event.ItemID })
+		if index < 0 {
+			return invalidValue("item_id", "item %s doesn't exist", event.ItemID)
+		}
+		s.items = slices.Delete(s.items, index, index+1)
+		return s.emit("conversation.item.deleted", map[string]any{"item_id": event.ItemID})
+	case "response.create":
+		if s.cancelResponse != nil {
+			return invalidRequest("conversation_already_has_active_response", "a response is already being generated")
+		}
+		var config responseConfig
+		if event.Response != nil {
+			config = *event.Response
+		}
+		return s.startResponse(config)
+	case "response.cancel":
+		if s.cancelResponse == nil {
+			return invalidRequest("response_cancel_not_active", "no response is being generated")
+		}
+		s.cancelResponse()
+		return nil
+	}
+	return invalidRequest("invalid_event", "unsupported event type %q", event.Type)
+}
+
+// newItem validates an item created by the client and decodes its audio.
+func newItem(item Item) (Item, error) {
+	if item.Type != "message" {
+		return Item{}, invalidValue("item.type", "unsupported item type %q (only message items are supported)", item.Type)
+	}
+	var allowed []string
+	switch item.Role {
+	case "user":
+		allowed = []string{"input_text", "input_audio"}
+	case "system":
+		allowed = []string{"input_text"}
+	case "assistant":
+		allowed = []string{"text"}
+	default:
+		return Item{}, invalidValue("item.role", "unknown role %q", item.Role)
+	}
+	if len(item.Content) == 0 {
+		return Item{}, invalidValue("item.content", "content is required")
+	}
+	for i, part := range item.Content {
+		if !slices.Contains(allowed, part.Type) {
+			return Item{}, invalidValue(fmt.Sprintf("item.content[%d].type", i), "%s messages can't have %s content", item.Role, part.Type)
+		}
+		if part.Type == "input_audio" {
+			audio, err := base64.StdEncoding.DecodeString(part.Audio)
+			if err != nil || len(audio) == 0 {
+				return Item{}, invalidValue(fmt.Sprintf("item.content[%d].audio", i), "audio must be non-empty and base64-encoded")
+			}
+			item.Content[i].audio, item.Content[i].Audio = audio, ""
+		}
+	}
+	if item.ID == "" {
+		item.ID = utils.NewID("item_")
+	}
+	item.Object, item.Status = "realtime.item", "completed"
+	return item, nil
+}
+
+// indexAfter returns the index at which to insert an item after the item with
+// the specified ID, or -1 if there's no such item. The "root" ID inserts items
+// at the beginning of the conversation.
+func (s *Session) indexAfter(previousID string) int {
+	if previousID == "root" {
+		return 0
+	}
+	index := slices.IndexFunc(s.items, func(item Item) bool { return item.ID == previousID })
+	if index < 0 {
+		return -1
+	}
+	return index + 1
+}
+
+// insert inserts an item in the conversation at the specified index, and
+// returns the ID of the previous item, or nil if it's the first item.
+func (s *Session) insert(item Item, index int) *string {
+	s.items = slices.Insert(s.items, index, item)
+	if index == 0 {
+		return nil
+	}
+	return &s.items[index-1].ID
+}
+
+// transcribe starts transcribing the audio content of an item in the
+// background, if input audio transcription is enabled. Completed and failed
+// transcriptions are reported with conversation.item.input_audio_transcription
+// events, and responses wait for the transcriptions in progress, so that the
+// model receives the transcripts. The caller must hold the lock.
+func (s *Session) transcribe(item Item) {
+	if s.transcriber == nil || s.config.InputAudioTranscription == nil {
+		return
+	}
+	language := s.config.InputAudioTranscription.Language
+	for index, part := range item.Content {
+		if part.Type != "input_audio" {
+			continue
+		}
+		done := make(chan struct{})
+		s.transcribing = append(s.transcribing, done)
+		s.transcriptions.Add(1)
+		go func() {
+			defer s.transcriptions.Done()
+			transcript, err := s.transcriber.Transcribe(s.ctx, part.audio, SampleRate, language)
+
+			s.m.Lock()
+			defer s.m.Unlock()
+			s.transcribing = slices.DeleteFunc(s.transcribing, func(pending chan struct{}) bool { return pending == done })
+			close(done)
+			if s.ctx.Err() != nil {
+				return
+			}
+			fields := map[string]any{"item_id": item.ID, "content_index": index}
+			if err != nil {
+				// The model receives the audio instead.
+				s.emit("conversation.item.input_audio_transcription.failed", with(fields, "error", &Error{Type: "transcription_error", Message: err.Error()}))
+				return
+			}
+			// The item may have been deleted in the meantime.
+			if i := slices.IndexFunc(s.items, func(existing Item) bool { return existing.ID == item.ID }); i >= 0 {
+				s.items[i].Content[index].Transcript = transcript
+				s.items[i].Content[index].transcribed = true
+			}
+			s.emit("conversation.item.input_audio_transcription.completed", with(fields, "transcript", transcript))
+		}()
+	}
+}
+
+// chatRequest returns the body of the chat completion request generating a
+// response to the conversation. The caller must hold the lock.
+func (s *Session) chatRequest(config responseConfig) ([]byte, error) {
+	instructions := s.config.Instructions
+	if config.Instructions != nil {
+		instructions = *config.Instructions
+	}
+	temperature := s.config.Temperature
+	if config.Temperature != nil {
+		temperature = *config.Temperature
+	}
+	maxTokens := s.config.MaxResponseOutputTokens
+	if config.MaxOutputTokens != nil {
+		maxTokens = *config.MaxOutputTokens
+	}
+
+	var messages []map[string]any
+	if instructions != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": instructions})
+	}
+	for _, item := range s.items {
+		messages = append(messages, map[string]any{"role": item.Role, "content": messageContent(item.Content)})
+	}
+	request := map[string]any{
+		"model":          s.config.Model,
+		"messages":       messages,
+		"stream":         true,
+		"stream_options": map[string]any{"include_usage": true},
+		"temperature":    temperature,
+	}
+	if maxTokens > 0 {
+		request["max_tokens"] = int(maxTokens)
+	}
+	return json.Marshal(request)
+}
+
+// messageContent returns the chat completion message content of an item's
+// content parts. Transcribed audio is replaced by its transcript, text-only
+// content is joined into a string, for models that don't accept content parts,
+// and audio that hasn't been transcribed is encoded as WAV files.
+func messageContent(content []ContentPart) any {
+	untranscribed := func(part ContentPart) bool { return part.Type == "input_audio" && !part.transcribed }
+	if !slices.ContainsFunc(content, untranscribed) {
+		texts := make([]string, len(content))
+		for i, part := range content {
+			texts[i] = part.Text
+			if part.transcribed {
+				texts[i] = part.Transcript
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	parts := make([]map[string]any, len(content))
+	for i, part := range content {
+		if untranscribed(part) {
+			parts[i] = map[string]any{
+				"type": "input_audio",
+				"input_audio": map[string]string{
+					"data":   base64.StdEncoding.EncodeToString(encodeWAV(part.audio)),
+					"format": "wav",
+				},
+			}
+		} else if part.transcribed {
+			parts[i] = map[string]any{"type": "text", "text": part.Transcript}
+		} else {
+			parts[i] = map[string]any{"type": "text", "text": part.Text}
+		}
+	}
+	return parts
+}
+
+// startResponse starts generating a response in the background. The caller
+// must hold the lock.
+func (s *Session) startResponse(config responseConfig) error {
+	if err := checkModalities(config.Modalities, "response.modalities"); err != nil {
+		return err
+	}
+	if config.Temperature != nil && (*config.Temperature < 0 || *config.Temperature > 2) {
+		return invalidValue("response.temperature", "temperature must be between 0 and 2")
+	}
+
+	response := Response{ID: utils.NewID("resp_"), Object: "realtime.response", Status: "in_progress", Output: []Item{}}
+	item := Item{ID: utils.NewID("item_"), Object: "realtime.item", Type: "message", Status: "in_progress", Role: "assistant", Content: []ContentPart{}}
+	if err := s.emit("response.created", map[string]any{"response": response}); err != nil {
+		return err
+	}
+	if err := s.emit("response.output_item.added", map[string]any{"response_id": response.ID, "output_index": 0, "item": item}); err != nil {
+		return err
+	}
+	part := map[string]any{"response_id": response.ID, "item_id": item.ID, "output_index": 0, "content_index": 0}
+	if err := s.emit("response.content_part.added", with(part, "part", ContentPart{Type: "text"})); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.cancelResponse = cancel
+	pending := slices.Clone(s.transcribing)
+	s.responses.Add(1)
+	go func() {
+		defer s.responses.Done()
+		defer cancel()
+		var text strings.Builder
+		usage, err := s.generateResponse(ctx, config, pending, func(delta string) {
+			s.m.Lock()
+			defer s.m.Unlock()
+			text.WriteString(delta)
+			s.emit("response.text.delta", with(part, "delta", delta))
+		})
+
+		s.m.Lock()
+		defer s.m.Unlock()
+		s.cancelResponse = nil
+		response.Status, item.Status = "completed", "completed"
+		switch {
+		case err != nil && ctx.Err() != nil:
+			response.Status, item.Status = "cancelled", "incomplete"
+			response.StatusDetails = &StatusDetails{Type: "cancelled", Reason: "client_cancelled"}
+		case err != nil:
+			response.Status, item.Status = "failed", "incomplete"
+			response.StatusDetails = &StatusDetails{Type: "failed", Error: &Error{Type: "server_error", Message: err.Error()}}
+		default:
+			response.Usage = &usage
+		}
+		item.Content = []ContentPart{{Type: "text", Text: text.String()}}
+		s.emit("response.text.done", with(part, "text", text.String()))
+		s.emit("response.content_part.done", with(part, "part", item.Content[0]))
+		s.emit("response.output_item.done", map[string]any{"response_id": response.ID, "output_index": 0, "item": item})
+		if text.Len() > 0 {
+			s.items = append(s.items, item)
+		}
+		response.Output = []Item{item}
+		s.emit("response.done", map[string]any{"response": response})
+	}()
+	return nil
+}
+
+// generateResponse waits for the pending transcriptions, so that the model
+// receives their transcripts, and then generates a response to the
+// conversation.
+func (s *Session) generateResponse(ctx context.Context, config responseConfig, pending []chan struct{}, delta func(text string)) (Usage, error) {
+	for _, done := range pending {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return Usage{}, ctx.Err()
+		}
+	}
+	s.m.Lock()
+	request, err := s.chatRequest(config)
+	s.m.Unlock()
+	if err != nil {
+		return Usage{}, fmt.Errorf("unable to encode chat completion request: %w", err)
+	}
+	return s.generate(ctx, request, delta)
+}
+
+// with returns a copy of event fields with an additional field.
+func with(fields map[string]any, name string, value any) map[string]any {
+	extended := make(map[string]any, len(fields)+1)
+	for key, v := range fields {
+		extended[key] = v
+	}
+	extended[name] = value
+	return extended
+}
@@ -0,0 +1,357 @@
+package realtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// recorder records the server events of a session.
+type recorder struct {
+	m      sync.Mutex
+	events []map[string]any
+	// responses receives the responses of response.done events.
+	responses chan map[string]any
+}
+
+func newRecorder() *recorder {
+	return &recorder{responses: make(chan map[string]any, 1)}
+}
+
+func (r *recorder) send(event []byte) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	var decoded map[string]any
+	if err := json.Unmarshal(event, &decoded); err != nil {
+		return err
+	}
+	r.events = append(r.events, decoded)
+	if decoded["type"] == "response.done" {
+		r.responses <- decoded["response"].(map[string]any)
+	}
+	return nil
+}
+
+// types returns the types of the recorded events.
+func (r *recorder) types() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+	types := make([]string, len(r.events))
+	for i, event := range r.events {
+		types[i] = event["type"].(string)
+	}
+	return types
+}
+
+// last returns the last recorded event.
+func (r *recorder) last() map[string]any {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.events[len(r.events)-1]
+}
+
+func TestSessionTextConversation(t *testing.T) {
+	var requests []map[string]any
+	generate := func(_ context.Context, request []byte, delta func(string)) (Usage, error) {
+		var decoded map[string]any
+		json.Unmarshal(request, &decoded)
+		requests = append(requests, decoded)
+		delta("Hello")
+		delta(" there!")
+		return Usage{TotalTokens: 12, InputTokens: 10, OutputTokens: 2}, nil
+	}
+	events := newRecorder()
+	session := NewSession(context.Background(), "ai/smollm2", generate, nil, events.send)
+	if err := session.Start(); err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+
+	for _, event := range []string{
+		`{"type":"session.update","session":{"instructions":"Be brief.","temperature":0.5,"max_response_output_tokens":64}}`,
+		`{"type":"conversation.item.create","item":{"type":"message","role":"user","content":[{"type":"input_text","text":"Hi"}]}}`,
+		`{"type":"response.create"}`,
+	} {
+		if err := session.Handle([]byte(event)); err != nil {
+			t.Fatalf("Failed to handle %s: %v", event, err)
+		}
+	}
+	response := <-events.responses
+	session.Close()
+
+	want := []string{
+		"session.created",
+		"session.updated",
+		"conversation.item.created",
+		"response.created",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.text.delta",
+		"response.text.delta",
+		"response.text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.done",
+	}
+	if types := events.types(); !slices.Equal(types, want) {
+		t.Errorf("Expected events %v, got %v", want, types)
+	}
+	if response["status"] != "completed" || response["usage"].(map[string]any)["output_tokens"] != 2.0 {
+		t.Errorf("Unexpected response %v", response)
+	}
+
+	wantRequest := `{"max_tokens":64,"messages":[{"content":"Be brief.","role":"system"},{"content":"Hi","role":"user"}],"model":"ai/smollm2","stream":true,"stream_options":{"include_usage":true},"temperature":0.5}`
+	if encoded, _ := json.Marshal(requests[0]); string(encoded) != wantRequest {
+		t.Errorf("Expected request %s, got %s", wantRequest, encoded)
+	}
+
+	// The response is added to the conversation.
+	if len(session.items) != 2 || session.items[1].Role != "assistant" || session.items[1].Content[0].Text != "Hello there!" {
+		t.Errorf("Unexpected conversation %+v", session.items)
+	}
+}
+
+func TestSessionAudioInput(t *testing.T) {
+	var request []byte
+	generate := func(_ context.Context, body []byte, _ func(string)) (Usage, error) {
+		request = body
+		return Usage{}, errors.New("model doesn't accept audio")
+	}
+	events := newRecorder()
+	session := NewSession(context.Background(), "ai/qwen2.5-omni", generate, nil, events.send)
+
+	pcm := bytes.Repeat([]byte{1, 0}, SampleRate/5)
+	encoded := base64.StdEncoding.EncodeToString(pcm)
+	for _, event := range []string{
+		`{"type":"input_audio_buffer.append","audio":"` + encoded[:len(encoded)/2] + `"}`,
+		`{"type":"input_audio_buffer.append","audio":"` + encoded[len(encoded)/2:] + `"}`,
+		`{"type":"input_audio_buffer.commit"}`,
+		`{"type":"response.create"}`,
+	} {
+		if err := session.Handle([]byte(event)); err != nil {
+			t.Fatalf("Failed to handle %s: %v", event, err)
+		}
+	}
+	response := <-events.responses
+	session.Close()
+
+	var decoded struct {
+		Messages []struct {
+			Content []struct {
+				Type       string `json:"type"`
+				InputAudio struct {
+					Data   string `json:"data"`
+					Format string `json:"format"`
+				} `json:"input_audio"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(request, &decoded); err != nil || len(decoded.Messages) != 1 || len(decoded.Messages[0].Content) != 1 {
+		t.Fatalf("Unexpected request %s", request)
+	}
+	part := decoded.Messages[0].Content[0]
+	wav, _ := base64.StdEncoding.DecodeString(part.InputAudio.Data)
+	if part.Type != "input_audio" || part.InputAudio.Format != "wav" || !bytes.HasPrefix(wav, []byte("RIFF")) || !bytes.Equal(wav[44:], pcm) {
+		t.Errorf("Expected the committed audio as a WAV file, got %+v", part)
+	}
+
+	if response["status"] != "failed" {
+		t.Errorf("Expected the response to fail, got %v", response)
+	}
+	// Failed responses without output aren't added to the conversation.
+	if len(session.items) != 1 {
+		t.Errorf("Unexpected conversation %+v", session.items)
+	}
+}
+
+// transcriber is a fake transcription.Transcriber.
+type transcriber struct {
+	transcript string
+	err        error
+	// sampleRates records the sample rates of the transcribed audio.
+	sampleRates []int
+}
+
+func (t *transcriber) Transcribe(_ context.Context, _ []byte, sampleRate int, _ string) (string, error) {
+	t.sampleRates = append(t.sampleRates, sampleRate)
+	return t.transcript, t.err
+}
+
+func TestSessionTranscribedAudioInput(t *testing.T) {
+	var request []byte
+	generate := func(_ context.Context, body []byte, delta func(string)) (Usage, error) {
+		request = body
+		delta("Sunny.")
+		return Usage{}, nil
+	}
+	events := newRecorder()
+	stt := &transcriber{transcript: "What's the weather?"}
+	session := NewSession(context.Background(), "ai/smollm2", generate, stt, events.send)
+
+	pcm := bytes.Repeat([]byte{1, 0}, SampleRate/5)
+	for _, event := range []string{
+		`{"type":"input_audio_buffer.append","audio":"` + base64.StdEncoding.EncodeToString(pcm) + `"}`,
+		`{"type":"input_audio_buffer.commit"}`,
+		`{"type":"response.create"}`,
+	} {
+		if err := session.Handle([]byte(event)); err != nil {
+			t.Fatalf("Failed to handle %s: %v", event, err)
+		}
+	}
+	response := <-events.responses
+	session.Close()
+
+	if response["status"] != "completed" {
+		t.Errorf("Expected the response to complete, got %v", response)
+	}
+	if !slices.Contains(events.types(), "conversation.item.input_audio_transcription.completed") {
+		t.Errorf("Expected a transcription event, got %v", events.types())
+	}
+	if !slices.Equal(stt.sampleRates, []int{SampleRate}) {
+		t.Errorf("Expected the audio to be transcribed once at %d Hz, got %v", SampleRate, stt.sampleRates)
+	}
+	wantRequest := `{"messages":[{"content":"What's the weather?","role":"user"}],"model":"ai/smollm2","stream":true,"stream_options":{"include_usage":true},"temperature":0.8}`
+	if string(request) != wantRequest {
+		t.Errorf("Expected request %s, got %s", wantRequest, request)
+	}
+	if transcript := session.items[0].Content[0].Transcript; transcript != "What's the weather?" {
+		t.Errorf("Expected the transcript in the conversation, got %q", transcript)
+	}
+}
+
+func TestSessionFailedTranscription(t *testing.T) {
+	var request []byte
+	generate := func(_ context.Context, body []byte, _ func(string)) (Usage, error) {
+		request = body
+		return Usage{}, nil
+	}
+	events := newRecorder()
+	session := NewSession(context.Background(), "ai/qwen2.5-omni", generate, &transcriber{err: errors.New("server unavailable")}, events.send)
+	audio := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1, 0}, SampleRate/5))
+	for _, event := range []string{
+		`{"type":"conversation.item.create","item":{"type":"message","role":"user","content":[{"type":"input_audio","audio":"` + audio + `"}]}}`,
+		`{"type":"response.create"}`,
+	} {
+		if err := session.Handle([]byte(event)); err != nil {
+			t.Fatalf("Failed to handle %s: %v", event, err)
+		}
+	}
+	<-events.responses
+	session.Close()
+
+	if !slices.Contains(events.types(), "conversation.item.input_audio_transcription.failed") {
+		t.Errorf("Expected a failed transcription event, got %v", events.types())
+	}
+	// The model receives the audio instead.
+	if !bytes.Contains(request, []byte(`"type":"input_audio"`)) {
+		t.Errorf("Expected the audio in the request, got %s", request)
+	}
+}
+
+func TestSessionCancel(t *testing.T) {
+	started := make(chan struct{})
+	generate := func(ctx context.Context, _ []byte, delta func(string)) (Usage, error) {
+		delta("Once upon")
+		close(started)
+		<-ctx.Done()
+		return Usage{}, ctx.Err()
+	}
+	events := newRecorder()
+	session := NewSession(context.Background(), "ai/smollm2", generate, nil, events.send)
+	if err := session.Handle([]byte(`{"type":"response.create"}`)); err != nil {
+		t.Fatalf("Failed to create response: %v", err)
+	}
+	<-started
+	session.Handle([]byte(`{"event_id":"event_a","type":"response.create"}`))
+	if err := events.last()["error"].(map[string]any); err["code"] != "conversation_already_has_active_response" || err["event_id"] != "event_a" {
+		t.Errorf("Expected concurrent responses to be rejected, got %v", err)
+	}
+	session.Handle([]byte(`{"type":"response.cancel"}`))
+	response := <-events.responses
+	session.Close()
+	if response["status"] != "cancelled" {
+		t.Errorf("Expected the response to be cancelled, got %v", response)
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	events := newRecorder()
+	session := NewSession(context.Background(), "ai/smollm2", nil, nil, events.send)
+	for _, tt := range []struct {
+		event string
+		code  string
+	}{
+		{`{"type":"session.update","session":{"modalities":["text","audio"]}}`, "invalid_value"},
+		{`{"type":"session.update","session":{"turn_detection":{"type":"server_vad"}}}`, "invalid_value"},
+		{`{"type":"session.update","session":{"input_audio_format":"g711_ulaw"}}`, "invalid_value"},
+		{`{"type":"session.update","session":{"input_audio_transcription":{"model":"whisper-1"}}}`, "invalid_value"},
+		{`{"type":"input_audio_buffer.append","audio":"not base64!"}`, "invalid_value"},
+		{`{"type":"input_audio_buffer.commit"}`, "input_audio_buffer_commit_empty"},
+		{`{"type":"conversation.item.create","item":{"type":"function_call"}}`, "invalid_value"},
+		{`{"type":"conversation.item.create","item":{"type":"message","role":"assistant","content":[{"type":"input_text","text":"Hi"}]}}`, "invalid_value"},
+		{`{"type":"conversation.item.create","previous_item_id":"item_x","item":{"type":"message","role":"user","content":[{"type":"input_text","text":"Hi"}]}}`, "invalid_value"},
+		{`{"type":"conversation.item.delete","item_id":"item_x"}`, "invalid_value"},
+		{`{"type":"response.create","response":{"modalities":["audio"]}}`, "invalid_value"},
+		{`{"type":"response.cancel"}`, "response_cancel_not_active"},
+		{`{"type":"transcription_session.update"}`, "invalid_event"},
+		{`not json`, "invalid_json"},
+	} {
+		if err := session.Handle([]byte(tt.event)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.event, err)
+		}
+		event := events.last()
+		if event["type"] != "error" || event["error"].(map[string]any)["code"] != tt.code {
+			t.Errorf("%s: expected error %s, got %v", tt.event, tt.code, event)
+		}
+	}
+}
+
+func TestSessionItems(t *testing.T) {
+	events := newRecorder()
+	session := NewSession(context.Background(), "ai/smollm2", nil, nil, events.send)
+	for _, event := range []string{
+		`{"type":"conversation.item.create","item":{"id":"b","type":"message","role":"user","content":[{"type":"input_text","text":"second"}]}}`,
+		`{"type":"conversation.item.create","previous_item_id":"root","item":{"id":"a","type":"message","role":"system","content":[{"type":"input_text","text":"first"}]}}`,
+		`{"type":"conversation.item.create","previous_item_id":"b","item":{"id":"c","type":"message","role":"assistant","content":[{"type":"text","text":"third"}]}}`,
+		`{"type":"conversation.item.delete","item_id":"b"}`,
+	} {
+		if err := session.Handle([]byte(event)); err != nil {
+			t.Fatalf("Failed to handle %s: %v", event, err)
+		}
+		if event := events.last(); event["type"] == "error" {
+			t.Fatalf("Unexpected error %v", event)
+		}
+	}
+	var ids []string
+	for _, item := range session.items {
+		ids = append(ids, item.ID)
+	}
+	if !slices.Equal(ids, []string{"a", "c"}) {
+		t.Errorf("Expected items [a c], got %v", ids)
+	}
+	if err := session.Handle([]byte(`{"type":"conversation.item.create","item":{"id":"a","type":"message","role":"user","content":[{"type":"input_text","text":"again"}]}}`)); err != nil || events.last()["type"] != "error" {
+		t.Error("Expected duplicate item IDs to be rejected")
+	}
+}
+
+func TestMaxTokens(t *testing.T) {
+	var m MaxTokens
+	if err := json.Unmarshal([]byte(`"inf"`), &m); err != nil || m != 0 {
+		t.Errorf("Expected inf to be unlimited, got %d (%v)", m, err)
+	}
+	if err := json.Unmarshal([]byte(`128`), &m); err != nil || m != 128 {
+		t.Errorf("Expected 128, got %d (%v)", m, err)
+	}
+	for _, invalid := range []string{`"many"`, `0`, `-1`} {
+		if err := json.Unmarshal([]byte(invalid), &m); err == nil {
+			t.Errorf("Expected error for %s", invalid)
+		}
+	}
+	if encoded, _ := json.Marshal(MaxTokens(0)); string(encoded) != `"inf"` {
+		t.Errorf(`Expected "inf", got %s`, encoded)
+	}
+}
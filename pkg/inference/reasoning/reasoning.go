@@ -0,0 +1,45 @@
+// Package reasoning separates the reasoning emitted by thinking models in
+// <think> blocks (e.g. DeepSeek-R1 or Qwen3) from their final answers,
+// exposing it via the reasoning_content extension to the OpenAI API.
+package reasoning
+
+import (
+	"strings"
+)
+
+const (
+	// openTag is the tag that opens a reasoning block.
+	openTag = "<think>"
+	// closeTag is the tag that closes a reasoning block.
+	closeTag = "</think>"
+	// whitespace is the set of characters trimmed around reasoning blocks.
+	whitespace = " \t\r\n"
+)
+
+// UsesThinkTags returns whether a chat template indicates that a model emits
+// its reasoning in <think> blocks.
+func UsesThinkTags(chatTemplate string) bool {
+	return strings.Contains(chatTemplate, openTag) || strings.Contains(chatTemplate, closeTag)
+}
+
+// Split separates the reasoning in content from the final answer. Reasoning is
+// recognized if content starts with a <think> block, or if content contains a
+// closing </think> tag without an opening tag (as happens when the chat
+// template opens the block in the generation prompt). An unterminated block
+// is treated entirely as reasoning. If content contains no reasoning, then it
+// is returned unmodified as the answer.
+func Split(content string) (reasoning, answer string) {
+	text := content
+	trimmed := strings.TrimLeft(content, whitespace)
+	if strings.HasPrefix(trimmed, openTag) {
+		text = trimmed[len(openTag):]
+	} else if !strings.Contains(content, closeTag) {
+		return "", content
+	}
+
+	end := strings.Index(text, closeTag)
+	if end < 0 {
+		return strings.TrimSpace(text), ""
+	}
+	return strings.TrimSpace(text[:end]), strings.TrimLeft(text[end+len(closeTag):], whitespace)
+}
@@ -0,0 +1,149 @@
+package reasoning
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		reasoning string
+		answer    string
+	}{
+		{"think block", "<think>\nLet me add.\n</think>\n\n42", "Let me add.", "42"},
+		{"leading whitespace", "\n <think>a</think>b", "a", "b"},
+		{"opened by template", "Let me add.\n</think>\n\n42", "Let me add.", "42"},
+		{"unterminated", "<think>still thinking", "still thinking", ""},
+		{"empty block", "<think>\n\n</think>\n\n42", "", "42"},
+		{"no reasoning", "42", "", "42"},
+		{"tag mid-answer", "use <think> tags", "", "use <think> tags"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasoning, answer := Split(tt.content)
+			if reasoning != tt.reasoning || answer != tt.answer {
+				t.Errorf("Split() = (%q, %q), want (%q, %q)", reasoning, answer, tt.reasoning, tt.answer)
+			}
+		})
+	}
+}
+
+func TestResponseWriterNonStreaming(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	w := NewResponseWriter(recorder)
+	fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"<think>hmm</think>\n42"},"finish_reason":"stop"}]}`)
+	if err := w.Finish(); err != nil {
+		t.Fatalf("Finish() failed: %v", err)
+	}
+
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	message := response.Choices[0].Message
+	if message.Content != "42" || message.ReasoningContent != "hmm" {
+		t.Errorf("got content %q and reasoning %q", message.Content, message.ReasoningContent)
+	}
+}
+
+// streamChunk formats a streamed chat completion chunk as an SSE event.
+func streamChunk(delta map[string]interface{}, finishReason string) string {
+	choice := map[string]interface{}{"index": 0, "delta": delta, "finish_reason": nil}
+	if finishReason != "" {
+		choice["finish_reason"] = finishReason
+	}
+	data, _ := json.Marshal(map[string]interface{}{"choices": []interface{}{choice}})
+	return "data: " + string(data) + "\n\n"
+}
+
+func TestResponseWriterStreaming(t *testing.T) {
+	tests := []struct {
+		name      string
+		deltas    []map[string]interface{}
+		reasoning string
+		answer    string
+	}{
+		{
+			name: "split tags",
+			deltas: []map[string]interface{}{
+				{"content": "<thi"}, {"content": "nk>\nStep one."}, {"content": " Step two.</th"}, {"content": "ink>\n\nDone"},
+			},
+			reasoning: "Step one. Step two.",
+			answer:    "Done",
+		},
+		{
+			name:   "no reasoning",
+			deltas: []map[string]interface{}{{"content": "<b>"}, {"content": "bold</b>"}},
+			answer: "<b>bold</b>",
+		},
+		{
+			name:      "unterminated",
+			deltas:    []map[string]interface{}{{"content": "<think>a </"}},
+			reasoning: "a </",
+		},
+		{
+			name:      "native reasoning",
+			deltas:    []map[string]interface{}{{"reasoning_content": "r"}, {"content": "<think>x</think>"}},
+			reasoning: "r",
+			answer:    "<think>x</think>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			w := NewResponseWriter(recorder)
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			for _, delta := range tt.deltas {
+				fmt.Fprint(w, streamChunk(delta, ""))
+			}
+			fmt.Fprint(w, streamChunk(map[string]interface{}{}, "stop"))
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			if err := w.Finish(); err != nil {
+				t.Fatalf("Finish() failed: %v", err)
+			}
+
+			var reasoning, answer strings.Builder
+			for _, event := range strings.Split(recorder.Body.String(), "\n\n") {
+				data, ok := strings.CutPrefix(event, "data: ")
+				if !ok || data == "[DONE]" {
+					continue
+				}
+				var chunk struct {
+					Choices []struct {
+						Delta struct {
+							Content          string `json:"content"`
+							ReasoningContent string `json:"reasoning_content"`
+						} `json:"delta"`
+					} `json:"choices"`
+				}
+				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+					t.Fatalf("invalid chunk %q: %v", data, err)
+				}
+				reasoning.WriteString(chunk.Choices[0].Delta.ReasoningContent)
+				answer.WriteString(chunk.Choices[0].Delta.Content)
+			}
+			if reasoning.String() != tt.reasoning {
+				t.Errorf("reasoning = %q, want %q", reasoning.String(), tt.reasoning)
+			}
+			if answer.String() != tt.answer {
+				t.Errorf("answer = %q, want %q", answer.String(), tt.answer)
+			}
+		})
+	}
+}
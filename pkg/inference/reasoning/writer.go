@@ -0,0 +1,312 @@
+package reasoning
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// streamState is the state of a streamed chat completion.
+type streamState uint8
+
+const (
+	// stateUndetermined indicates that it's not yet known whether the stream
+	// starts with a reasoning block.
+	stateUndetermined streamState = iota
+	// stateReasoning indicates that a reasoning block is being streamed.
+	stateReasoning
+	// stateAnswer indicates that the final answer is being streamed.
+	stateAnswer
+)
+
+// ResponseWriter rewrites chat completion responses, moving reasoning emitted
+// in <think> blocks into the reasoning_content field. Both streaming
+// (server-sent events) and non-streaming responses are supported. Responses in
+// which the backend already reports reasoning content are left as-is. Finish
+// must be called once the response has been fully written.
+type ResponseWriter struct {
+	http.ResponseWriter
+	// statusCode is the response status code.
+	statusCode int
+	// streaming indicates that the response is a server-sent event stream.
+	streaming bool
+	// buffer holds the complete body for non-streaming responses and any
+	// incomplete event for streaming responses.
+	buffer bytes.Buffer
+	// native indicates that the backend reported reasoning content itself, in
+	// which case the remaining stream is passed through unmodified.
+	native bool
+	// state is the state of the stream.
+	state streamState
+	// pending is streamed content that hasn't been forwarded yet because it
+	// may be the start of a tag.
+	pending string
+	// trimReasoning indicates that leading whitespace should be trimmed from
+	// the reasoning.
+	trimReasoning bool
+	// trimAnswer indicates that leading whitespace should be trimmed from the
+	// answer.
+	trimAnswer bool
+}
+
+// NewResponseWriter creates a new ResponseWriter that wraps w.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+// WriteHeader implements net/http.ResponseWriter.WriteHeader.
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.streaming = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	if statusCode == http.StatusOK {
+		// The body will be rewritten, so its length may change.
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements net/http.ResponseWriter.Write.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.statusCode != http.StatusOK || w.native {
+		return w.ResponseWriter.Write(b)
+	}
+	w.buffer.Write(b)
+	if !w.streaming {
+		return len(b), nil
+	}
+
+	// Process all complete events.
+	for {
+		data := w.buffer.Bytes()
+		end := bytes.Index(data, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		event := string(data[:end+2])
+		w.buffer.Next(end + 2)
+		if err := w.writeEvent(event); err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush implements net/http.Flusher.Flush.
+func (w *ResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Finish writes any buffered output.
+func (w *ResponseWriter) Finish() error {
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	if w.streaming {
+		remaining := w.buffer.String()
+		w.buffer.Reset()
+		return w.writeEvent(remaining)
+	}
+	body := rewriteResponse(w.buffer.Bytes())
+	w.buffer.Reset()
+	_, err := w.ResponseWriter.Write(body)
+	return err
+}
+
+// rewriteResponse separates reasoning in a non-streaming chat completion
+// response. If the response can't be parsed, it's returned unmodified.
+func rewriteResponse(body []byte) []byte {
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	choices, ok := response["choices"].([]interface{})
+	if !ok {
+		return body
+	}
+
+	modified := false
+	for _, c := range choices {
+		choice, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		message, ok := choice["message"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := message["reasoning_content"]; ok {
+			continue
+		}
+		content, ok := message["content"].(string)
+		if !ok {
+			continue
+		}
+		reasoning, answer := Split(content)
+		if answer == content {
+			continue
+		}
+		message["content"] = answer
+		if reasoning != "" {
+			message["reasoning_content"] = reasoning
+		}
+		modified = true
+	}
+	if !modified {
+		return body
+	}
+
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// writeEvent processes and forwards a single server-sent event.
+func (w *ResponseWriter) writeEvent(event string) error {
+	data, ok := strings.CutPrefix(strings.TrimRight(event, "\n"), "data: ")
+	if !ok || data == "[DONE]" || w.native {
+		_, err := w.ResponseWriter.Write([]byte(event))
+		return err
+	}
+
+	var chunk map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		_, err := w.ResponseWriter.Write([]byte(event))
+		return err
+	}
+	choice, delta := chunkDelta(chunk)
+	if delta == nil {
+		_, err := w.ResponseWriter.Write([]byte(event))
+		return err
+	}
+
+	// If the backend separated reasoning itself, then stop rewriting.
+	if _, ok := delta["reasoning_content"]; ok {
+		w.native = true
+		_, err := w.ResponseWriter.Write([]byte(event))
+		return err
+	}
+
+	finished := false
+	if finishReason, ok := choice["finish_reason"].(string); ok && finishReason != "" {
+		finished = true
+	}
+	content, hasContent := delta["content"].(string)
+	if hasContent || finished {
+		reasoning, answer := w.consume(content, finished)
+		delete(delta, "content")
+		if reasoning != "" {
+			delta["reasoning_content"] = reasoning
+		}
+		if answer != "" {
+			delta["content"] = answer
+		}
+	}
+
+	// Drop chunks that no longer carry any information.
+	if len(delta) == 0 && !finished && chunk["usage"] == nil {
+		return nil
+	}
+	return w.writeChunk(chunk)
+}
+
+// consume processes streamed content, returning the portions of reasoning and
+// answer that can be forwarded to the client immediately. If finished is
+// true, then all held content is returned.
+func (w *ResponseWriter) consume(content string, finished bool) (reasoning, answer string) {
+	w.pending += content
+	for {
+		switch w.state {
+		case stateUndetermined:
+			trimmed := strings.TrimLeft(w.pending, whitespace)
+			if strings.HasPrefix(trimmed, openTag) {
+				w.state = stateReasoning
+				w.trimReasoning = true
+				w.pending = trimmed[len(openTag):]
+				continue
+			}
+			if strings.HasPrefix(openTag, trimmed) && !finished {
+				return reasoning, answer
+			}
+			w.state = stateAnswer
+		case stateReasoning:
+			if end := strings.Index(w.pending, closeTag); end >= 0 {
+				reasoning += w.trimmed(w.pending[:end], &w.trimReasoning)
+				w.pending = w.pending[end+len(closeTag):]
+				w.state = stateAnswer
+				w.trimAnswer = true
+				continue
+			}
+			hold := 0
+			if !finished {
+				hold = partialSuffix(w.pending, closeTag)
+			}
+			reasoning += w.trimmed(w.pending[:len(w.pending)-hold], &w.trimReasoning)
+			w.pending = w.pending[len(w.pending)-hold:]
+			return reasoning, answer
+		case stateAnswer:
+			answer += w.trimmed(w.pending, &w.trimAnswer)
+			w.pending = ""
+			return reasoning, answer
+		}
+	}
+}
+
+// trimmed returns text with leading whitespace removed if *trim is set,
+// clearing *trim once non-whitespace text has been seen.
+func (w *ResponseWriter) trimmed(text string, trim *bool) string {
+	if !*trim {
+		return text
+	}
+	text = strings.TrimLeft(text, whitespace)
+	if text != "" {
+		*trim = false
+	}
+	return text
+}
+
+// partialSuffix returns the length of the longest suffix of text that is a
+// proper prefix of tag.
+func partialSuffix(text, tag string) int {
+	for n := min(len(text), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// writeChunk forwards a chunk as a server-sent event.
+func (w *ResponseWriter) writeChunk(chunk map[string]interface{}) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return fmt.Errorf("unable to encode chunk: %w", err)
+	}
+	_, err = fmt.Fprintf(w.ResponseWriter, "data: %s\n\n", data)
+	return err
+}
+
+// chunkDelta returns the first choice of a streamed chunk and its delta.
+func chunkDelta(chunk map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	choices, ok := chunk["choices"].([]interface{})
+	if !ok || len(choices) == 0 {
+		return nil, nil
+	}
+	choice, ok := choices[0].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	delta, ok := choice["delta"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	return choice, delta
+}
@@ -0,0 +1,261 @@
+// Package retrieval implements retrieval-augmented generation for chat
+// completion requests, which ground responses in chunks retrieved from a
+// vector store and cite the chunks that were used.
+package retrieval
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+const (
+	// DefaultMaxNumResults is the number of chunks retrieved if a request
+	// doesn't specify one.
+	DefaultMaxNumResults = 5
+	// MaximumMaxNumResults is the maximum number of chunks that a request
+	// may retrieve.
+	MaximumMaxNumResults = 20
+)
+
+// DefaultTemplate is the default template used to inject retrieved chunks into
+// a prompt. It's executed with a TemplateData value.
+const DefaultTemplate = `Answer the user's question using the sources below. Cite the sources you use by their number, for example [1]. If the sources don't contain the answer, say so.
+{{range .Citations}}
+[{{.Index}}] {{.Text}}
+{{end}}`
+
+// ErrVectorStoreNotFound indicates that a request references a vector store
+// that doesn't exist. If returned in conjunction with an HTTP request, it
+// should be paired with a 404 response status.
+var ErrVectorStoreNotFound = errors.New("vector store not found")
+
+// Options are the retrieval options of a chat completion request, specified
+// by its retrieval field. The field is an extension of the OpenAI API.
+type Options struct {
+	// VectorStoreID is the ID of the vector store to retrieve chunks from.
+	VectorStoreID string `json:"vector_store_id"`
+	// MaxNumResults is the maximum number of chunks to retrieve.
+	MaxNumResults int `json:"max_num_results,omitempty"`
+	// ScoreThreshold is the minimum score of retrieved chunks.
+	ScoreThreshold *float32 `json:"score_threshold,omitempty"`
+}
+
+// Chunk is a chunk retrieved from a vector store.
+type Chunk struct {
+	// DocumentID is the ID of the document containing the chunk.
+	DocumentID string
+	// Text is the chunk's text.
+	Text string
+	// Score is the chunk's similarity to the query.
+	Score float32
+	// Metadata is the document's metadata.
+	Metadata map[string]any
+}
+
+// Retriever retrieves the chunks of a vector store most similar to a query.
+type Retriever interface {
+	// Retrieve retrieves chunks on behalf of r, most similar first.
+	Retrieve(r *http.Request, options Options, query string) ([]Chunk, error)
+}
+
+// Citation describes a retrieved chunk that was injected into a prompt. It's
+// attached to the response and recorded alongside the request.
+type Citation struct {
+	// Index is the 1-based number by which the prompt refers to the chunk.
+	Index int `json:"index"`
+	// VectorStoreID is the ID of the vector store containing the chunk.
+	VectorStoreID string `json:"vector_store_id"`
+	// DocumentID is the ID of the document containing the chunk.
+	DocumentID string `json:"document_id"`
+	// Score is the chunk's similarity to the query.
+	Score float32 `json:"score"`
+	// Text is the chunk's text.
+	Text string `json:"text"`
+	// Metadata is the document's metadata.
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// Citations converts retrieved chunks into citations.
+func Citations(vectorStoreID string, chunks []Chunk) []Citation {
+	citations := make([]Citation, len(chunks))
+	for i, chunk := range chunks {
+		citations[i] = Citation{
+			Index:         i + 1,
+			VectorStoreID: vectorStoreID,
+			DocumentID:    chunk.DocumentID,
+			Score:         chunk.Score,
+			Text:          chunk.Text,
+			Metadata:      chunk.Metadata,
+		}
+	}
+	return citations
+}
+
+// TemplateData is the data with which prompt templates are executed.
+type TemplateData struct {
+	// Query is the text that chunks were retrieved for.
+	Query string
+	// Citations are the retrieved chunks.
+	Citations []Citation
+}
+
+// ParseTemplate parses a prompt template. An empty template is parsed as
+// DefaultTemplate.
+func ParseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New("retrieval").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retrieval prompt template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// message is a chat completion message. Fields other than the role and content
+// are preserved.
+type message map[string]json.RawMessage
+
+// role returns the message's role.
+func (m message) role() string {
+	var role string
+	json.Unmarshal(m["role"], &role)
+	return role
+}
+
+// text returns the message's text content, concatenating text content parts.
+func (m message) text() string {
+	var content string
+	if err := json.Unmarshal(m["content"], &content); err == nil {
+		return content
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m["content"], &parts); err != nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Request is a parsed retrieval-augmented chat completion request.
+type Request struct {
+	// Options are the request's retrieval options.
+	Options Options
+	// Query is the text of the last user message, which chunks are retrieved
+	// for.
+	Query string
+
+	// fields are the request's top-level fields, excluding the retrieval
+	// field.
+	fields map[string]json.RawMessage
+	// messages are the request's messages.
+	messages []message
+}
+
+// ParseRequest parses the retrieval options of a chat completion request. It
+// returns nil if the request doesn't request retrieval.
+func ParseRequest(body []byte) (*Request, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	raw, ok := fields["retrieval"]
+	if !ok || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil, nil
+	}
+	delete(fields, "retrieval")
+
+	var options Options
+	if err := json.Unmarshal(raw, &options); err != nil {
+		return nil, fmt.Errorf("invalid retrieval options: %w", err)
+	}
+	if options.VectorStoreID == "" {
+		return nil, errors.New("retrieval.vector_store_id is required")
+	}
+	if options.MaxNumResults == 0 {
+		options.MaxNumResults = DefaultMaxNumResults
+	}
+	if options.MaxNumResults < 1 || options.MaxNumResults > MaximumMaxNumResults {
+		return nil, fmt.Errorf("retrieval.max_num_results must be between 1 and %d", MaximumMaxNumResults)
+	}
+
+	var messages []message
+	if err := json.Unmarshal(fields["messages"], &messages); err != nil {
+		return nil, fmt.Errorf("invalid messages: %w", err)
+	}
+	var query string
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].role() == "user" {
+			query = strings.TrimSpace(messages[i].text())
+			break
+		}
+	}
+	if query == "" {
+		return nil, errors.New("retrieval requires a user message with text content")
+	}
+
+	return &Request{Options: options, Query: query, fields: fields, messages: messages}, nil
+}
+
+// Body returns the request body with the retrieval field removed.
+func (r *Request) Body() ([]byte, error) {
+	return json.Marshal(r.fields)
+}
+
+// Augment returns the request body with the retrieval field removed and the
+// cited chunks injected into the prompt using tmpl. The rendered text is
+// appended to the leading system message, or is added as a system message if
+// there isn't one. If there are no citations, the prompt is left unmodified.
+func (r *Request) Augment(tmpl *template.Template, citations []Citation) ([]byte, error) {
+	if len(citations) == 0 {
+		return r.Body()
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, TemplateData{Query: r.Query, Citations: citations}); err != nil {
+		return nil, fmt.Errorf("unable to render retrieval prompt: %w", err)
+	}
+	sources := strings.TrimSpace(rendered.String())
+
+	messages := make([]message, 0, len(r.messages)+1)
+	var existing string
+	if len(r.messages) > 0 && r.messages[0].role() == "system" &&
+		json.Unmarshal(r.messages[0]["content"], &existing) == nil {
+		system := make(message, len(r.messages[0]))
+		for key, value := range r.messages[0] {
+			system[key] = value
+		}
+		content, _ := json.Marshal(existing + "\n\n" + sources)
+		system["content"] = content
+		messages = append(messages, system)
+		messages = append(messages, r.messages[1:]...)
+	} else {
+		content, _ := json.Marshal(sources)
+		messages = append(messages, message{"role": json.RawMessage(`"system"`), "content": content})
+		messages = append(messages, r.messages...)
+	}
+
+	encoded, err := json.Marshal(messages)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode messages: %w", err)
+	}
+	fields := make(map[string]json.RawMessage, len(r.fields))
+	for key, value := range r.fields {
+		fields[key] = value
+	}
+	fields["messages"] = encoded
+	return json.Marshal(fields)
+}
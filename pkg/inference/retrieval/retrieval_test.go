@@ -0,0 +1,110 @@
+package retrieval
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	request, err := ParseRequest([]byte(`{"model":"m","messages":[{"role":"user","content":"first"},{"role":"assistant","content":"reply"},{"role":"user","content":[{"type":"text","text":"What is"},{"type":"image_url","image_url":{"url":"data:"}},{"type":"text","text":"Docker?"}]}],"retrieval":{"vector_store_id":"vs_1"}}`))
+	if err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+	if request.Options.VectorStoreID != "vs_1" || request.Options.MaxNumResults != DefaultMaxNumResults {
+		t.Errorf("Unexpected options %+v", request.Options)
+	}
+	if request.Query != "What is\nDocker?" {
+		t.Errorf("Expected query from the last user message, got %q", request.Query)
+	}
+	body, err := request.Body()
+	if err != nil || strings.Contains(string(body), "retrieval") {
+		t.Errorf("Expected retrieval field to be removed, got %s (%v)", body, err)
+	}
+
+	if request, err := ParseRequest([]byte(`{"model":"m","messages":[]}`)); request != nil || err != nil {
+		t.Errorf("Expected nil request without retrieval field, got %+v (%v)", request, err)
+	}
+	for _, invalid := range []string{
+		`{"messages":[{"role":"user","content":"q"}],"retrieval":{}}`,
+		`{"messages":[{"role":"user","content":"q"}],"retrieval":{"vector_store_id":"vs_1","max_num_results":21}}`,
+		`{"messages":[{"role":"system","content":"s"}],"retrieval":{"vector_store_id":"vs_1"}}`,
+		`{"messages":[{"role":"user","content":"q"}],"retrieval":"vs_1"}`,
+	} {
+		if _, err := ParseRequest([]byte(invalid)); err == nil {
+			t.Errorf("Expected error for %s", invalid)
+		}
+	}
+}
+
+func TestAugment(t *testing.T) {
+	tmpl, err := ParseTemplate("")
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	citations := Citations("vs_1", []Chunk{
+		{DocumentID: "a", Text: "Alpha.", Score: 0.9},
+		{DocumentID: "b", Text: "Beta.", Score: 0.8},
+	})
+	if citations[1].Index != 2 || citations[1].VectorStoreID != "vs_1" {
+		t.Errorf("Unexpected citation %+v", citations[1])
+	}
+
+	tests := []struct {
+		name     string
+		messages string
+		// system is the expected content of the leading system message.
+		system string
+		count  int
+	}{
+		{
+			name:     "new system message",
+			messages: `[{"role":"user","content":"q"}]`,
+			count:    2,
+		},
+		{
+			name:     "existing system message",
+			messages: `[{"role":"system","content":"Be brief.","name":"sys"},{"role":"user","content":"q"}]`,
+			system:   "Be brief.\n\n",
+			count:    2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := ParseRequest([]byte(`{"model":"m","temperature":0.5,"messages":` + test.messages + `,"retrieval":{"vector_store_id":"vs_1"}}`))
+			if err != nil {
+				t.Fatalf("ParseRequest failed: %v", err)
+			}
+			body, err := request.Augment(tmpl, citations)
+			if err != nil {
+				t.Fatalf("Augment failed: %v", err)
+			}
+			var augmented struct {
+				Temperature float64                  `json:"temperature"`
+				Messages    []map[string]interface{} `json:"messages"`
+			}
+			if err := json.Unmarshal(body, &augmented); err != nil {
+				t.Fatalf("Invalid augmented body %s: %v", body, err)
+			}
+			if augmented.Temperature != 0.5 || len(augmented.Messages) != test.count {
+				t.Fatalf("Unexpected augmented body %s", body)
+			}
+			system := augmented.Messages[0]
+			content, _ := system["content"].(string)
+			if system["role"] != "system" || !strings.HasPrefix(content, test.system) ||
+				!strings.Contains(content, "[1] Alpha.\n") || !strings.HasSuffix(content, "[2] Beta.") {
+				t.Errorf("Unexpected system message %q", content)
+			}
+		})
+	}
+
+	// Without citations, only the retrieval field is removed.
+	request, _ := ParseRequest([]byte(`{"messages":[{"role":"user","content":"q"}],"retrieval":{"vector_store_id":"vs_1"}}`))
+	if body, err := request.Augment(tmpl, nil); err != nil || string(body) != `{"messages":[{"role":"user","content":"q"}]}` {
+		t.Errorf("Expected unmodified prompt without citations, got %s (%v)", body, err)
+	}
+
+	if _, err := ParseTemplate("{{range .Citations}"); err == nil {
+		t.Error("Expected error for invalid template")
+	}
+}
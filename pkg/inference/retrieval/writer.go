@@ -0,0 +1,170 @@
+package retrieval
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ResponseWriter attaches citations to chat completion responses. Non-streaming
+// responses gain a top-level citations field, while streaming responses gain a
+// final chunk with no choices and a citations field, which is sent before the
+// stream's terminating [DONE] event. Finish must be called once the response
+// has been fully written.
+type ResponseWriter struct {
+	http.ResponseWriter
+	// citations are the citations to attach.
+	citations []Citation
+	// statusCode is the response status code.
+	statusCode int
+	// streaming indicates that the response is a server-sent event stream.
+	streaming bool
+	// buffer holds the complete body for non-streaming responses and any
+	// incomplete event for streaming responses.
+	buffer bytes.Buffer
+	// lastChunk is the most recent streamed chunk, whose identifying fields
+	// are copied to the citations chunk.
+	lastChunk map[string]json.RawMessage
+	// attached indicates that the citations have been written.
+	attached bool
+}
+
+// NewResponseWriter creates a new ResponseWriter that wraps w and attaches
+// citations to the response.
+func NewResponseWriter(w http.ResponseWriter, citations []Citation) *ResponseWriter {
+	if citations == nil {
+		citations = []Citation{}
+	}
+	return &ResponseWriter{ResponseWriter: w, citations: citations}
+}
+
+// WriteHeader implements net/http.ResponseWriter.WriteHeader.
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.streaming = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	if statusCode == http.StatusOK {
+		// The body will be rewritten, so its length will change.
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements net/http.ResponseWriter.Write.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.statusCode != http.StatusOK || (w.attached && w.buffer.Len() == 0) {
+		return w.ResponseWriter.Write(b)
+	}
+	w.buffer.Write(b)
+	if !w.streaming {
+		return len(b), nil
+	}
+
+	// Process all complete events.
+	for {
+		data := w.buffer.Bytes()
+		end := bytes.Index(data, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		event := string(data[:end+2])
+		w.buffer.Next(end + 2)
+		if err := w.writeEvent(event); err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush implements net/http.Flusher.Flush.
+func (w *ResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Finish writes any buffered output. If a stream ended without a [DONE]
+// event, the citations chunk is written last.
+func (w *ResponseWriter) Finish() error {
+	if w.streaming {
+		if w.buffer.Len() > 0 {
+			remaining := w.buffer.String()
+			w.buffer.Reset()
+			if err := w.writeEvent(remaining); err != nil {
+				return err
+			}
+		}
+		if w.statusCode == http.StatusOK && !w.attached {
+			return w.writeCitations()
+		}
+		return nil
+	}
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	body := w.rewriteResponse(w.buffer.Bytes())
+	w.buffer.Reset()
+	_, err := w.ResponseWriter.Write(body)
+	return err
+}
+
+// rewriteResponse attaches citations to a non-streaming chat completion
+// response. If the response can't be parsed, it's returned unmodified.
+func (w *ResponseWriter) rewriteResponse(body []byte) []byte {
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	citations, err := json.Marshal(w.citations)
+	if err != nil {
+		return body
+	}
+	response["citations"] = citations
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// writeEvent forwards a single server-sent event, writing the citations chunk
+// before the [DONE] event.
+func (w *ResponseWriter) writeEvent(event string) error {
+	data, ok := strings.CutPrefix(strings.TrimRight(event, "\n"), "data: ")
+	if ok && data == "[DONE]" && !w.attached {
+		if err := w.writeCitations(); err != nil {
+			return err
+		}
+	} else if ok {
+		var chunk map[string]json.RawMessage
+		if json.Unmarshal([]byte(data), &chunk) == nil {
+			w.lastChunk = chunk
+		}
+	}
+	_, err := w.ResponseWriter.Write([]byte(event))
+	return err
+}
+
+// writeCitations writes the citations chunk.
+func (w *ResponseWriter) writeCitations() error {
+	w.attached = true
+	chunk := map[string]any{
+		"object":    "chat.completion.chunk",
+		"choices":   []any{},
+		"citations": w.citations,
+	}
+	for _, field := range []string{"id", "created", "model", "system_fingerprint"} {
+		if value, ok := w.lastChunk[field]; ok {
+			chunk[field] = value
+		}
+	}
+	encoded, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	_, err = w.ResponseWriter.Write([]byte("data: " + string(encoded) + "\n\n"))
+	return err
+}
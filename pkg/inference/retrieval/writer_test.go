@@ -0,0 +1,74 @@
+package retrieval
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriter(t *testing.T) {
+	citations := []Citation{{Index: 1, VectorStoreID: "vs_1", DocumentID: "a", Score: 0.9, Text: "Alpha."}}
+
+	t.Run("non-streaming", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		w := NewResponseWriter(recorder, citations)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","choices":[{"message":{"content":"Alpha [1]"}}]}`))
+		if err := w.Finish(); err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		var response struct {
+			ID        string     `json:"id"`
+			Citations []Citation `json:"citations"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Invalid response %s: %v", recorder.Body.String(), err)
+		}
+		if response.ID != "c1" || len(response.Citations) != 1 || response.Citations[0].DocumentID != "a" {
+			t.Errorf("Expected citations to be attached, got %s", recorder.Body.String())
+		}
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		w := NewResponseWriter(recorder, citations)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		// Events may be split across writes.
+		w.Write([]byte("data: {\"id\":\"c1\",\"model\":\"m\",\"choices\":[{\"delta\":{\"content\":\"Alpha\"}}]}\n\nda"))
+		w.Write([]byte("ta: [DONE]\n\n"))
+		if err := w.Finish(); err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		events := strings.Split(strings.TrimSuffix(recorder.Body.String(), "\n\n"), "\n\n")
+		if len(events) != 3 || events[2] != "data: [DONE]" {
+			t.Fatalf("Expected citations chunk before [DONE], got %q", events)
+		}
+		var chunk struct {
+			ID        string        `json:"id"`
+			Model     string        `json:"model"`
+			Choices   []interface{} `json:"choices"`
+			Citations []Citation    `json:"citations"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(events[1], "data: ")), &chunk); err != nil {
+			t.Fatalf("Invalid citations chunk %q: %v", events[1], err)
+		}
+		if chunk.ID != "c1" || chunk.Model != "m" || chunk.Choices == nil || len(chunk.Citations) != 1 {
+			t.Errorf("Unexpected citations chunk %q", events[1])
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		w := NewResponseWriter(recorder, citations)
+		http.Error(w, "model failed", http.StatusInternalServerError)
+		if err := w.Finish(); err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		if strings.Contains(recorder.Body.String(), "citations") {
+			t.Errorf("Expected error response to be left as-is, got %q", recorder.Body.String())
+		}
+	})
+}
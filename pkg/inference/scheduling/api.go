@@ -1,6 +1,7 @@
 package scheduling
 
 import (
+	"encoding/json"
 	"strings"
 	"time"
 
@@ -24,6 +25,8 @@ func trimRequestPathToOpenAIRoot(path string) string {
 		return path[index:]
 	} else if index = strings.Index(path, "/score"); index != -1 {
 		return path[index:]
+	} else if index = strings.Index(path, "/classify"); index != -1 {
+		return path[index:]
 	}
 	return path
 }
@@ -38,15 +41,35 @@ func backendModeForRequest(path string) (inference.BackendMode, bool) {
 		return inference.BackendModeEmbedding, true
 	} else if strings.HasSuffix(path, "/rerank") || strings.HasSuffix(path, "/score") {
 		return inference.BackendModeReranking, true
+	} else if strings.HasSuffix(path, "/v1/moderations") || strings.HasSuffix(path, "/classify") {
+		return inference.BackendModeClassification, true
 	}
 	return inference.BackendMode(0), false
 }
 
+// upstreamPath returns the path to which an inference request is forwarded.
+// Moderation and classification requests are served by requesting the
+// classifier's outputs as embeddings.
+func upstreamPath(path string) string {
+	if strings.HasSuffix(path, "/v1/moderations") {
+		return strings.TrimSuffix(path, "/v1/moderations") + "/v1/embeddings"
+	} else if strings.HasSuffix(path, "/classify") {
+		return strings.TrimSuffix(path, "/classify") + "/v1/embeddings"
+	}
+	return path
+}
+
 // OpenAIInferenceRequest is used to extract the model specification from either
 // a chat completion or embedding request in the OpenAI API.
 type OpenAIInferenceRequest struct {
 	// Model is the requested model name.
 	Model string `json:"model"`
+	// Stream indicates whether a streaming response was requested.
+	Stream bool `json:"stream"`
+	// ContextSize is an extension field requesting that the request be
+	// served by a runner with the specified context size, rather than the
+	// configured one.
+	ContextSize uint64 `json:"context_size,omitempty"`
 }
 
 // OpenAIErrorResponse is used to format an OpenAI API compatible error response
@@ -71,6 +94,74 @@ type BackendStatus struct {
 	LastUsed time.Time `json:"last_used,omitempty"`
 	// InUse indicates whether this backend is currently handling a request
 	InUse bool `json:"in_use,omitempty"`
+	// Replica is the index of this runner among the replicas of the same
+	// (backend, model, mode) tuple
+	Replica int `json:"replica"`
+	// Replicas is the number of replicas currently loaded for the same
+	// (backend, model, mode) tuple
+	Replicas int `json:"replicas"`
+	// DesiredReplicas is the desired number of replicas for the same
+	// (backend, model, mode) tuple
+	DesiredReplicas int `json:"desired_replicas"`
+	// FittedContextSize is the context size to which the runner's context
+	// was reduced because the configured context size didn't fit in memory
+	FittedContextSize uint64 `json:"fitted_context_size,omitempty"`
+	// ContextSize is the context size requested by the requests that the
+	// runner serves, if it doesn't use the configured context size
+	ContextSize uint64 `json:"context_size,omitempty"`
+}
+
+// QueueStatus describes the progress of an inference request that's waiting
+// for a runner, as reported in queue events for requests using
+// inference.QueueProgressHeader.
+type QueueStatus struct {
+	// State is the state of the request (queued or loading).
+	State string `json:"state"`
+	// Position is the request's 1-based position among the requests waiting
+	// for a runner, if queued.
+	Position int `json:"position,omitempty"`
+	// Waiting is the total number of requests waiting for a runner, if
+	// queued.
+	Waiting int `json:"waiting,omitempty"`
+	// EstimatedWaitSeconds is a rough estimate of the remaining wait, based on
+	// recent waits and runner startups. It's omitted if there's no history.
+	EstimatedWaitSeconds float64 `json:"estimated_wait_seconds,omitempty"`
+	// Warning describes a potential problem with the runner being loaded,
+	// such as its context size having been reduced to fit in memory.
+	Warning string `json:"warning,omitempty"`
+}
+
+// DryRunResponse describes how an inference request would be handled, as
+// reported for requests validated using inference.DryRunHeader.
+type DryRunResponse struct {
+	// Backend is the backend that would serve the request.
+	Backend string `json:"backend"`
+	// Model is the requested model.
+	Model string `json:"model"`
+	// ModelID is the ID of the requested model.
+	ModelID string `json:"model_id,omitempty"`
+	// Mode is the mode of the runner that would serve the request.
+	Mode string `json:"mode"`
+	// ContextWindow is the runner's context length in tokens, if known.
+	ContextWindow *uint64 `json:"context_window,omitempty"`
+	// EstimatedPromptTokens is a rough estimate of the number of prompt
+	// tokens, based on the prompt's size.
+	EstimatedPromptTokens uint64 `json:"estimated_prompt_tokens,omitempty"`
+	// Warnings are potential problems that don't prevent the request from
+	// being served.
+	Warnings []string `json:"warnings,omitempty"`
+	// Upstream is the request that would be forwarded to the backend.
+	Upstream DryRunUpstreamRequest `json:"upstream"`
+}
+
+// DryRunUpstreamRequest is a request that would be forwarded to a backend.
+type DryRunUpstreamRequest struct {
+	// Method is the HTTP method.
+	Method string `json:"method"`
+	// Path is the request path on the backend.
+	Path string `json:"path"`
+	// Body is the request body.
+	Body json.RawMessage `json:"body"`
 }
 
 // DiskUsage represents the disk usage of the models and default backend.
@@ -98,4 +189,382 @@ type ConfigureRequest struct {
 	RuntimeFlags    []string                             `json:"runtime-flags,omitempty"`
 	RawRuntimeFlags string                               `json:"raw-runtime-flags,omitempty"`
 	Speculative     *inference.SpeculativeDecodingConfig `json:"speculative,omitempty"`
+	// BackendVersion pins the backend version used to run the model, for
+	// models that regress on newer versions. It's only supported by
+	// llama.cpp.
+	BackendVersion string `json:"backend-version,omitempty"`
+	// KVCacheType is the experimental KV cache quantization, int8 for
+	// llama.cpp or fp8 for vLLM. Quantizing the KV cache roughly halves its
+	// memory, fitting more concurrent conversations.
+	KVCacheType inference.KVCacheType `json:"kv-cache-type,omitempty"`
+	// StrictContextSize makes loads fail if the model doesn't fit in memory
+	// with the configured context size, rather than reducing the context
+	// size to fit.
+	StrictContextSize bool `json:"strict-context-size,omitempty"`
+	// MatryoshkaDimensions declares the reduced embedding dimensions that an
+	// embedding model trained with matryoshka representations supports.
+	MatryoshkaDimensions []int `json:"matryoshka-dimensions,omitempty"`
+	// Truncation configures how chat conversations that exceed the model's
+	// context are truncated.
+	Truncation *inference.TruncationConfig `json:"truncation,omitempty"`
+	// Compression configures how the prompts of chat conversations that
+	// exceed the model's context are compressed, before they're truncated.
+	Compression *inference.CompressionConfig `json:"compression,omitempty"`
+	// PostProcessors are applied in order to the content of the model's
+	// completions, with the original output preserved in request records.
+	PostProcessors []inference.PostProcessor `json:"post-processors,omitempty"`
+	// SystemPrompt is a system prompt injected into the model's chat
+	// completion requests, in the mandatory, default, or suggested mode.
+	SystemPrompt *inference.SystemPromptConfig `json:"system-prompt,omitempty"`
+	// Classification configures the labels and scoring of a sequence
+	// classification model's outputs.
+	Classification *inference.ClassificationConfig `json:"classification,omitempty"`
+}
+
+// ProfileRequest selects the active configuration profile.
+type ProfileRequest struct {
+	Profile string `json:"profile"`
+}
+
+// ProfileInfo describes a configuration profile.
+type ProfileInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ContextSize int64  `json:"context_size,omitempty"`
+	Parallelism int    `json:"parallelism,omitempty"`
+	KeepAlive   string `json:"keep_alive,omitempty"`
+	Recording   string `json:"recording"`
+}
+
+// ProfileResponse reports the active configuration profile and the available
+// profiles.
+type ProfileResponse struct {
+	Active   string        `json:"active"`
+	Profiles []ProfileInfo `json:"profiles"`
+}
+
+// WindowPolicySpec specifies when models are kept loaded and when they may be
+// pulled, using the window syntax accepted by ParseWindow. Empty windows
+// impose no restrictions.
+type WindowPolicySpec struct {
+	Serving string `json:"serving,omitempty"`
+	Pulls   string `json:"pulls,omitempty"`
+}
+
+// WindowsRequest sets the window policy for a model, or the global window
+// policy if Model is empty.
+type WindowsRequest struct {
+	Model string `json:"model,omitempty"`
+	WindowPolicySpec
+}
+
+// WindowsResponse reports the window policies and pinned models.
+type WindowsResponse struct {
+	Global WindowPolicySpec            `json:"global"`
+	Models map[string]WindowPolicySpec `json:"models"`
+	Pins   []Pin                       `json:"pins"`
+}
+
+// PinRequest pins a model so that it's exempt from window policies, either
+// for a duration (e.g. "2h") or, if Duration is empty, until it's unpinned.
+type PinRequest struct {
+	Model    string `json:"model"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// Pin is a pinned model.
+type Pin struct {
+	Model string     `json:"model"`
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// RouteRule routes requests for a virtual model whose prompts match all of the
+// rule's conditions to another model. Prompts are the last user message of
+// chat completion requests and the prompt of completion requests.
+type RouteRule struct {
+	// Language matches prompts detected to be in the language with the
+	// specified ISO 639-1 code (e.g. "fr").
+	Language string `json:"language,omitempty"`
+	// Pattern is a regular expression that matches prompts.
+	Pattern string `json:"pattern,omitempty"`
+	// Model is the model to which matching requests are routed.
+	Model string `json:"model"`
+}
+
+// VirtualModel is a model name whose requests are routed to other models by an
+// ordered list of rules, or by a cascade.
+type VirtualModel struct {
+	Name string `json:"name"`
+	// Rules are evaluated in order, and the first matching rule selects the
+	// model.
+	Rules []RouteRule `json:"rules,omitempty"`
+	// Default is the model to which requests are routed if no rule matches.
+	Default string `json:"default,omitempty"`
+	// Cascade routes requests to a small model first, escalating them to a
+	// larger model if its answer is inadequate. It can't be combined with
+	// rules.
+	Cascade *Cascade `json:"cascade,omitempty"`
+	// Schemas validate the virtual model's requests and the tool calls in its
+	// responses.
+	Schemas *ModelSchemas `json:"schemas,omitempty"`
+}
+
+// ModelSchemas are JSON schemas attached to a virtual model, which catch
+// malformed requests and tool calls before they reach the model or the
+// application.
+type ModelSchemas struct {
+	// Request validates the bodies of requests, and typically describes the
+	// extension fields that applications are expected to set.
+	Request json.RawMessage `json:"request,omitempty"`
+	// ToolArguments maps function names to schemas validating the arguments
+	// of the tool calls to those functions in non-streaming chat completion
+	// responses.
+	ToolArguments map[string]json.RawMessage `json:"tool_arguments,omitempty"`
+}
+
+// Cascade configures a small-model-first cascade. Non-streaming chat
+// completion requests are answered by Model, and retried on EscalationModel if
+// the answer fails, is a refusal, or falls short of the thresholds. Other
+// requests are routed to EscalationModel.
+type Cascade struct {
+	// Model is the small model that answers first.
+	Model string `json:"model"`
+	// EscalationModel is the larger model to which requests are escalated.
+	EscalationModel string `json:"escalation_model"`
+	// MinLength escalates answers with fewer characters. Zero disables the
+	// check.
+	MinLength int `json:"min_length,omitempty"`
+	// MinConfidence escalates answers whose geometric mean token probability
+	// is lower, which requires backends to report log probabilities. Zero
+	// disables the check.
+	MinConfidence float64 `json:"min_confidence,omitempty"`
+	// Refusals escalates answers that look like refusals.
+	Refusals bool `json:"refusals,omitempty"`
+}
+
+// Pipeline is a named DAG of model calls, executed server-side from a single
+// request. Steps run as soon as the steps they depend on have completed.
+type Pipeline struct {
+	Name  string         `json:"name"`
+	Steps []PipelineStep `json:"steps"`
+	// Output is the name of the step whose output is the pipeline's output.
+	// It defaults to the last step.
+	Output string `json:"output,omitempty"`
+}
+
+// PipelineStep is a model call in a pipeline.
+type PipelineStep struct {
+	Name  string `json:"name"`
+	Model string `json:"model"`
+	// Endpoint is the endpoint to which the step's request is made:
+	// chat/completions (the default), embeddings, moderations, or classify.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Prompt is the step's input, in which {{input}} is replaced by the
+	// pipeline's input and {{steps.<name>}} by the output of a step, which the
+	// step then depends on. It defaults to the pipeline's input for steps
+	// without dependencies, and to their outputs otherwise.
+	Prompt string `json:"prompt,omitempty"`
+	// System is the system prompt of chat completion steps.
+	System string `json:"system,omitempty"`
+	// DependsOn are the names of the steps that must complete before the
+	// step runs, in addition to those referenced by its prompt.
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// PipelineRunRequest runs a pipeline on an input.
+type PipelineRunRequest struct {
+	Input string `json:"input"`
+}
+
+// PipelineRun is the result of a pipeline run. Its ID links the records of
+// the run's requests.
+type PipelineRun struct {
+	ID       string `json:"id"`
+	Object   string `json:"object"`
+	Pipeline string `json:"pipeline"`
+	// Status is completed, or failed if any step failed.
+	Status     string               `json:"status"`
+	Output     string               `json:"output,omitempty"`
+	DurationMs int64                `json:"duration_ms"`
+	Steps      []PipelineStepResult `json:"steps"`
+}
+
+// PipelineStepResult is the result of a pipeline step.
+type PipelineStepResult struct {
+	Name  string `json:"name"`
+	Model string `json:"model"`
+	// Status is completed, failed, or skipped if a step that it depends on
+	// failed.
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code,omitempty"`
+	// StartedMs is the time at which the step started, relative to the start
+	// of the run.
+	StartedMs  int64 `json:"started_ms"`
+	DurationMs int64 `json:"duration_ms"`
+	// Output is the content of a chat completion, or the response body of
+	// other endpoints.
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// MaintenanceRequest starts or ends maintenance. BufferTimeout is the maximum
+// time (e.g. "30s") for which inference requests are buffered before being
+// rejected, where "0s" rejects them immediately. It defaults to 30 seconds.
+type MaintenanceRequest struct {
+	Enabled       bool   `json:"enabled"`
+	BufferTimeout string `json:"buffer_timeout,omitempty"`
+}
+
+// MaintenanceStatus reports whether maintenance is in progress.
+type MaintenanceStatus struct {
+	Enabled       bool       `json:"enabled"`
+	Since         *time.Time `json:"since,omitempty"`
+	BufferTimeout string     `json:"buffer_timeout,omitempty"`
+	// Buffered is the number of requests waiting for maintenance to end.
+	Buffered int64 `json:"buffered"`
+	// InFlight is the number of admitted requests that haven't completed.
+	InFlight int64 `json:"in_flight"`
+}
+
+// TuneRequest requests that the parallel slot counts of a model's runner be
+// tuned during idle periods. Candidates are the slot counts to measure, which
+// default to 1, 2, 4, and 8. If Apply is true, the recommended slot count is
+// applied to the model's configuration.
+type TuneRequest struct {
+	Model      string `json:"model"`
+	Candidates []int  `json:"candidates,omitempty"`
+	Apply      bool   `json:"apply,omitempty"`
+}
+
+// BenchmarkSource identifies how a benchmark result was measured. Only results
+// from the same source are compared.
+type BenchmarkSource string
+
+const (
+	// BenchmarkSourceTuning indicates results of parallel slot tunings.
+	BenchmarkSourceTuning BenchmarkSource = "tuning"
+	// BenchmarkSourceValidation indicates results of the validation
+	// generations of llama.cpp updates, with a single slot.
+	BenchmarkSourceValidation BenchmarkSource = "validation"
+)
+
+// BenchmarkResult is the result of tuning the parallel slot count of a model's
+// runner, or of measuring its throughput when validating a backend update.
+// Results are kept by model digest, backend version, and device.
+type BenchmarkResult struct {
+	Model   string `json:"model"`
+	ModelID string `json:"model_id,omitempty"`
+	Backend string `json:"backend"`
+	// BackendVersion is the version reported by the backend, or the version
+	// to which the model is pinned.
+	BackendVersion string `json:"backend_version,omitempty"`
+	// Device identifies the hardware by platform and total VRAM.
+	Device   string          `json:"device,omitempty"`
+	Source   BenchmarkSource `json:"source,omitempty"`
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"`
+	// Measurements are the throughputs measured for each slot count.
+	Measurements []ParallelismMeasurement `json:"measurements"`
+	// RecommendedParallelism is the smallest slot count whose throughput is
+	// within 5% of the best, if any slot count was measured.
+	RecommendedParallelism int `json:"recommended_parallelism,omitempty"`
+	// Applied indicates whether the recommended slot count was applied.
+	Applied bool `json:"applied"`
+	// Error describes why tuning was cut short, if it was.
+	Error string `json:"error,omitempty"`
+}
+
+// BenchmarkComparison compares the best throughput of the latest benchmark
+// result of a model with a backend version on a device with that of the latest
+// result with another version, measured before.
+type BenchmarkComparison struct {
+	ModelID                  string          `json:"model_id"`
+	Backend                  string          `json:"backend"`
+	Device                   string          `json:"device"`
+	Source                   BenchmarkSource `json:"source"`
+	BaselineVersion          string          `json:"baseline_version"`
+	BaselineTokensPerSecond  float64         `json:"baseline_tokens_per_second"`
+	CandidateVersion         string          `json:"candidate_version"`
+	CandidateTokensPerSecond float64         `json:"candidate_tokens_per_second"`
+	// Change is the relative change in throughput, e.g. -0.2 if the
+	// candidate is 20% slower.
+	Change float64 `json:"change"`
+	// Regression indicates whether the throughput dropped by more than the
+	// tolerance.
+	Regression bool `json:"regression"`
+}
+
+// ParallelismMeasurement is the throughput measured with a parallel slot
+// count.
+type ParallelismMeasurement struct {
+	Parallelism int `json:"parallelism"`
+	// TokensPerSecond is the aggregate rate at which tokens were generated by
+	// concurrent requests filling every slot.
+	TokensPerSecond float64 `json:"tokens_per_second"`
+}
+
+// LoadTestRequest starts a synthetic load test of a model. Concurrency
+// requests are kept in flight for Duration (e.g. "1m"), each with a prompt
+// whose length in tokens is drawn from PromptLength and a completion of at
+// most MaxTokens tokens.
+type LoadTestRequest struct {
+	Model        string              `json:"model"`
+	Concurrency  int                 `json:"concurrency,omitempty"`
+	Duration     string              `json:"duration,omitempty"`
+	PromptLength *LengthDistribution `json:"prompt_length,omitempty"`
+	MaxTokens    int                 `json:"max_tokens,omitempty"`
+}
+
+// LengthDistribution is a distribution of lengths, in tokens. Fixed lengths
+// are always Mean, uniform lengths are between Min and Max, and normal lengths
+// have Mean and StdDev, clamped to Min and Max if set.
+type LengthDistribution struct {
+	Distribution string `json:"distribution"`
+	Mean         int    `json:"mean,omitempty"`
+	StdDev       int    `json:"stddev,omitempty"`
+	Min          int    `json:"min,omitempty"`
+	Max          int    `json:"max,omitempty"`
+}
+
+// LoadTestReport reports the progress or results of a load test.
+type LoadTestReport struct {
+	ID      string          `json:"id"`
+	Request LoadTestRequest `json:"request"`
+	// Status is running, completed, cancelled, or failed.
+	Status   string     `json:"status"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Requests is the number of completed requests, including Errors.
+	Requests int `json:"requests"`
+	Errors   int `json:"errors"`
+	// ErrorStatusCodes counts failed requests by status code.
+	ErrorStatusCodes map[string]int `json:"error_status_codes,omitempty"`
+	// LastError is the error of the most recent failed request.
+	LastError        string `json:"last_error,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	// RequestsPerSecond and OutputTokensPerSecond are the throughputs of
+	// successful requests.
+	RequestsPerSecond     float64 `json:"requests_per_second"`
+	OutputTokensPerSecond float64 `json:"output_tokens_per_second"`
+	// Latency and TimeToFirstToken summarize successful requests.
+	Latency          LatencyPercentiles `json:"latency"`
+	TimeToFirstToken LatencyPercentiles `json:"time_to_first_token"`
+}
+
+// LatencyPercentiles summarizes latencies, in milliseconds.
+type LatencyPercentiles struct {
+	P50Ms int64 `json:"p50_ms"`
+	P90Ms int64 `json:"p90_ms"`
+	P99Ms int64 `json:"p99_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+// RecordFixturesResponse reports the fixtures recorded from recorded requests.
+type RecordFixturesResponse struct {
+	// Recorded are the keys of the recorded fixtures.
+	Recorded []string `json:"recorded"`
+	// Skipped is the number of recorded requests that couldn't be turned
+	// into fixtures, e.g. because they failed or their bodies weren't stored.
+	Skipped int `json:"skipped"`
 }
@@ -0,0 +1,318 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/metrics"
+)
+
+// DefaultStreamBufferSize is the default maximum number of bytes of a
+// streamed response buffered for its client.
+const DefaultStreamBufferSize = 1024 * 1024
+
+// errSlowClient indicates that a client was dropped because it read a
+// streamed response too slowly.
+var errSlowClient = errors.New("client is reading the stream too slowly")
+
+// SlowClientAction is what happens to a stream whose client reads the
+// response slower than it's generated, once the stream's buffer is full.
+type SlowClientAction string
+
+const (
+	// SlowClientPause stops reading the response from the backend, which
+	// pauses the backend slot until the client catches up.
+	SlowClientPause SlowClientAction = "pause"
+	// SlowClientDrop disconnects the client, which frees the backend slot.
+	SlowClientDrop SlowClientAction = "drop"
+)
+
+// BackpressurePolicy configures how streamed responses are buffered for
+// clients that read them slower than they're generated, so that memory
+// doesn't grow with the backlog of slow clients.
+type BackpressurePolicy struct {
+	// BufferSize is the maximum number of bytes of a streamed response
+	// buffered for its client. A zero value means DefaultStreamBufferSize.
+	BufferSize int
+	// Action is what happens once a stream's buffer is full. It defaults to
+	// SlowClientPause.
+	Action SlowClientAction
+	// PauseTimeout is how long a paused stream waits for its client to catch
+	// up before the client is dropped. A zero value waits indefinitely.
+	PauseTimeout time.Duration
+}
+
+// normalize validates the policy and fills in its defaults.
+func (p *BackpressurePolicy) normalize() error {
+	if p.BufferSize < 0 {
+		return fmt.Errorf("invalid stream buffer size %d", p.BufferSize)
+	}
+	if p.BufferSize == 0 {
+		p.BufferSize = DefaultStreamBufferSize
+	}
+	switch p.Action {
+	case "":
+		p.Action = SlowClientPause
+	case SlowClientPause, SlowClientDrop:
+	default:
+		return fmt.Errorf("invalid slow client action %q, expected %q or %q", p.Action, SlowClientPause, SlowClientDrop)
+	}
+	if p.PauseTimeout < 0 {
+		return fmt.Errorf("invalid pause timeout %s", p.PauseTimeout)
+	}
+	return nil
+}
+
+// SetBackpressurePolicy sets the policy for streams whose clients read
+// responses slower than they're generated. It applies to streams started
+// afterwards.
+func (s *Scheduler) SetBackpressurePolicy(policy BackpressurePolicy) error {
+	if err := policy.normalize(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.backpressure = policy
+	return nil
+}
+
+// SlowClientIncidents returns the slow-client incidents by model.
+func (s *Scheduler) SlowClientIncidents() []metrics.SlowClientIncidents {
+	return s.slowClients.Incidents()
+}
+
+// newStreamBuffer creates a buffer for a stream of a model's response to the
+// client of r, which writes to w.
+func (s *Scheduler) newStreamBuffer(r *http.Request, w http.ResponseWriter, model string) *streamBuffer {
+	s.lock.RLock()
+	policy := s.backpressure
+	s.lock.RUnlock()
+	return newStreamBuffer(r.Context(), w, policy, func(dropped bool) {
+		if dropped {
+			s.log.Warnf("Dropping a client reading the stream of %s too slowly", utils.SanitizeForLog(model))
+		}
+		s.slowClients.Record(model, dropped)
+	})
+}
+
+// streamBuffer is a response writer that buffers a streamed response for its
+// client, writing it to the client in the background. Once the buffer is full,
+// writes either block until the client catches up, which in turn stops the
+// reverse proxy from reading the backend's response, or fail, which aborts
+// the response.
+type streamBuffer struct {
+	// ctx is the context of the client's request.
+	ctx context.Context
+	// w writes to the client.
+	w http.ResponseWriter
+	// policy is the backpressure policy.
+	policy BackpressurePolicy
+	// incident records a slow-client incident.
+	incident func(dropped bool)
+	// wake wakes the background writer when data is buffered or the buffer
+	// is closed.
+	wake chan struct{}
+	// done is closed when the background writer exits.
+	done chan struct{}
+
+	// m protects the fields below.
+	m sync.Mutex
+	// pending are the buffered bytes that haven't been written yet.
+	pending []byte
+	// size is the number of buffered bytes, including those being written.
+	size int
+	// drained is closed and replaced whenever buffered bytes are written or
+	// the buffer fails.
+	drained chan struct{}
+	// paused indicates whether a write has waited for the client.
+	paused bool
+	// closed indicates that no more bytes will be buffered.
+	closed bool
+	// err is the error with which the buffer failed, if any.
+	err error
+}
+
+// newStreamBuffer creates a stream buffer writing to w and starts its
+// background writer. The buffer must be finished once the response is
+// complete.
+func newStreamBuffer(ctx context.Context, w http.ResponseWriter, policy BackpressurePolicy, incident func(dropped bool)) *streamBuffer {
+	if policy.BufferSize <= 0 {
+		policy.BufferSize = DefaultStreamBufferSize
+	}
+	b := &streamBuffer{
+		ctx:      ctx,
+		w:        w,
+		policy:   policy,
+		incident: incident,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		drained:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// run writes buffered bytes to the client until the buffer is closed and
+// empty, or fails.
+func (b *streamBuffer) run() {
+	defer close(b.done)
+	for {
+		b.m.Lock()
+		data, closed, err := b.pending, b.closed, b.err
+		b.pending = nil
+		b.m.Unlock()
+		if err != nil {
+			return
+		}
+		if len(data) == 0 {
+			if closed {
+				return
+			}
+			<-b.wake
+			continue
+		}
+
+		_, err = b.w.Write(data)
+		if err == nil {
+			if flusher, ok := b.w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+
+		b.m.Lock()
+		b.size -= len(data)
+		if err != nil && b.err == nil {
+			b.err = err
+		}
+		b.notifyDrained()
+		b.m.Unlock()
+	}
+}
+
+// notifyDrained wakes writers waiting for the buffer to drain. The caller
+// must hold m.
+func (b *streamBuffer) notifyDrained() {
+	close(b.drained)
+	b.drained = make(chan struct{})
+}
+
+// signal wakes the background writer.
+func (b *streamBuffer) signal() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// fail fails the buffer with err, discarding buffered bytes and aborting an
+// ongoing write to the client if possible. The caller must hold m.
+func (b *streamBuffer) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+	b.pending = nil
+	b.notifyDrained()
+	b.signal()
+	_ = http.NewResponseController(b.w).SetWriteDeadline(time.Now())
+}
+
+// Header implements http.ResponseWriter.Header.
+func (b *streamBuffer) Header() http.Header {
+	return b.w.Header()
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader. The header is
+// written before any bytes are buffered, so it doesn't race with the
+// background writer.
+func (b *streamBuffer) WriteHeader(statusCode int) {
+	b.w.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter.Write. It buffers data, waiting for
+// the client to catch up first if the buffer is full and the policy pauses
+// slow clients.
+func (b *streamBuffer) Write(data []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	var timeout <-chan time.Time
+	// A single write larger than the buffer is accepted once the buffer is
+	// empty, since it can't be split without breaking up events.
+	for b.err == nil && b.size > 0 && b.size+len(data) > b.policy.BufferSize {
+		if b.policy.Action == SlowClientDrop {
+			b.incident(true)
+			b.fail(errSlowClient)
+			break
+		}
+		if !b.paused {
+			b.paused = true
+			b.incident(false)
+		}
+		if timeout == nil && b.policy.PauseTimeout > 0 {
+			timer := time.NewTimer(b.policy.PauseTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		drained := b.drained
+		b.m.Unlock()
+		select {
+		case <-drained:
+			b.m.Lock()
+		case <-timeout:
+			b.m.Lock()
+			b.incident(true)
+			b.fail(errSlowClient)
+		case <-b.ctx.Done():
+			b.m.Lock()
+			b.fail(b.ctx.Err())
+		}
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	b.pending = append(b.pending, data...)
+	b.size += len(data)
+	b.signal()
+	return len(data), nil
+}
+
+// Flush implements http.Flusher.Flush. Buffered bytes are flushed to the
+// client as soon as they're written, so there's nothing to do.
+func (b *streamBuffer) Flush() {}
+
+// finish closes the buffer and waits for the background writer to write the
+// remaining bytes, dropping the client if it doesn't catch up within the
+// pause timeout.
+func (b *streamBuffer) finish() {
+	b.m.Lock()
+	b.closed = true
+	b.m.Unlock()
+	b.signal()
+
+	var timeout <-chan time.Time
+	if b.policy.PauseTimeout > 0 {
+		timer := time.NewTimer(b.policy.PauseTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-b.done:
+		return
+	case <-timeout:
+		b.m.Lock()
+		b.incident(true)
+		b.fail(errSlowClient)
+		b.m.Unlock()
+	case <-b.ctx.Done():
+		b.m.Lock()
+		b.fail(b.ctx.Err())
+		b.m.Unlock()
+	}
+	<-b.done
+}
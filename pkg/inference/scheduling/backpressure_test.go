@@ -0,0 +1,101 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// gatedWriter is a response writer whose writes block until its gate is
+// opened, simulating a client that doesn't read the response.
+type gatedWriter struct {
+	*httptest.ResponseRecorder
+	gate chan struct{}
+}
+
+func (w *gatedWriter) Write(data []byte) (int, error) {
+	<-w.gate
+	return w.ResponseRecorder.Write(data)
+}
+
+func TestStreamBuffer(t *testing.T) {
+	type incidents struct {
+		paused, dropped int
+	}
+	tcs := []struct {
+		name     string
+		policy   BackpressurePolicy
+		expected incidents
+		err      error
+	}{
+		{
+			name:     "pause",
+			policy:   BackpressurePolicy{BufferSize: 10, Action: SlowClientPause},
+			expected: incidents{paused: 1},
+		},
+		{
+			name:     "drop",
+			policy:   BackpressurePolicy{BufferSize: 10, Action: SlowClientDrop},
+			expected: incidents{dropped: 1},
+			err:      errSlowClient,
+		},
+		{
+			name:     "pause timeout",
+			policy:   BackpressurePolicy{BufferSize: 10, Action: SlowClientPause, PauseTimeout: 10 * time.Millisecond},
+			expected: incidents{paused: 1, dropped: 1},
+			err:      errSlowClient,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &gatedWriter{ResponseRecorder: httptest.NewRecorder(), gate: make(chan struct{})}
+			var got incidents
+			buffer := newStreamBuffer(context.Background(), w, tc.policy, func(dropped bool) {
+				if dropped {
+					got.dropped++
+				} else {
+					got.paused++
+				}
+			})
+
+			if _, err := buffer.Write([]byte("data: 1\n\n")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// The first event is being written to the client, so the second
+			// one doesn't fit in the buffer.
+			written := make(chan error, 1)
+			go func() {
+				_, err := buffer.Write([]byte("data: 2\n\n"))
+				written <- err
+			}()
+			if tc.policy.Action == SlowClientPause && tc.policy.PauseTimeout == 0 {
+				select {
+				case err := <-written:
+					t.Fatalf("Expected the write to wait for the client, got %v", err)
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+			var err error
+			if tc.err != nil {
+				err = <-written
+			}
+			close(w.gate)
+			if tc.err == nil {
+				err = <-written
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Expected error %v, got %v", tc.err, err)
+			}
+			buffer.finish()
+
+			if got != tc.expected {
+				t.Errorf("Expected incidents %+v, got %+v", tc.expected, got)
+			}
+			if tc.err == nil && w.Body.String() != "data: 1\n\ndata: 2\n\n" {
+				t.Errorf("Unexpected response %q", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package scheduling
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+const (
+	// benchmarkKeyPrefix prefixes the storage keys of benchmark histories.
+	benchmarkKeyPrefix = "scheduler/benchmarks/"
+	// defaultRegressionTolerance is the fraction by which throughput may drop
+	// before it's flagged as a regression, unless another is requested.
+	defaultRegressionTolerance = 0.1
+)
+
+// benchmarkKey identifies the benchmark history of a model with a backend
+// version on a device.
+type benchmarkKey struct {
+	modelID        string
+	backend        string
+	backendVersion string
+	device         string
+}
+
+// keyOf returns the key of a benchmark result. Results without a model ID are
+// kept by model reference.
+func keyOf(result BenchmarkResult) benchmarkKey {
+	return benchmarkKey{
+		modelID:        cmp.Or(result.ModelID, result.Model),
+		backend:        result.Backend,
+		backendVersion: result.BackendVersion,
+		device:         result.Device,
+	}
+}
+
+// storageKey returns the storage key of the history with this key.
+func (k benchmarkKey) storageKey() string {
+	return benchmarkKeyPrefix + strings.Join([]string{k.modelID, k.backend, k.backendVersion, k.device}, "/")
+}
+
+// setStorage makes the benchmark history persist in kv and loads the history
+// persisted previously.
+func (t *tuner) setStorage(kv storage.KV) error {
+	keys, err := kv.List(benchmarkKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("listing benchmark results: %w", err)
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, key := range keys {
+		data, err := kv.Get(key)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+		var history []BenchmarkResult
+		if err := json.Unmarshal(data, &history); err != nil {
+			return fmt.Errorf("unmarshaling %s: %w", key, err)
+		}
+		for _, result := range history {
+			t.history[keyOf(result)] = append(t.history[keyOf(result)], result)
+		}
+	}
+	t.storage = kv
+	return nil
+}
+
+// backendVersion returns the version of a backend to which benchmark results
+// are attributed: the version to which the model is pinned, if any, or the
+// version reported in the backend's status.
+func backendVersion(backend inference.Backend, pinned string) string {
+	if pinned != "" || backend == nil {
+		return pinned
+	}
+	_, version, _ := strings.Cut(backend.Status(), "version: ")
+	return version
+}
+
+// benchmarkDevice identifies the hardware on which benchmarks run by its
+// platform and, if known, its total VRAM.
+func (l *loader) benchmarkDevice() string {
+	device := runtime.GOOS + "/" + runtime.GOARCH
+	if l.totalMemory.VRAM > 1 {
+		device += " " + formatMemorySize(l.totalMemory.VRAM) + " VRAM"
+	}
+	return device
+}
+
+// bestThroughput returns the best throughput measured by a benchmark.
+func bestThroughput(result BenchmarkResult) float64 {
+	var best float64
+	for _, measurement := range result.Measurements {
+		best = max(best, measurement.TokensPerSecond)
+	}
+	return best
+}
+
+// compareThroughput compares the best throughput of a candidate benchmark
+// result with that of a baseline.
+func compareThroughput(baseline, candidate BenchmarkResult, tolerance float64) BenchmarkComparison {
+	comparison := BenchmarkComparison{
+		ModelID:                  cmp.Or(candidate.ModelID, candidate.Model),
+		Backend:                  candidate.Backend,
+		Device:                   candidate.Device,
+		Source:                   candidate.Source,
+		BaselineVersion:          baseline.BackendVersion,
+		BaselineTokensPerSecond:  bestThroughput(baseline),
+		CandidateVersion:         candidate.BackendVersion,
+		CandidateTokensPerSecond: bestThroughput(candidate),
+	}
+	if comparison.BaselineTokensPerSecond > 0 {
+		comparison.Change = comparison.CandidateTokensPerSecond/comparison.BaselineTokensPerSecond - 1
+	}
+	comparison.Regression = comparison.Change < -tolerance
+	return comparison
+}
+
+// compareBenchmarks compares the latest result of each backend, device, and
+// source in a benchmark history, ordered by completion, with the latest prior
+// result with another backend version. Failed results are ignored.
+func compareBenchmarks(results []BenchmarkResult, tolerance float64) []BenchmarkComparison {
+	type group struct {
+		backend string
+		device  string
+		source  BenchmarkSource
+	}
+	groups := make(map[group][]BenchmarkResult)
+	for _, result := range results {
+		if result.Error != "" || bestThroughput(result) == 0 {
+			continue
+		}
+		key := group{backend: result.Backend, device: result.Device, source: result.Source}
+		groups[key] = append(groups[key], result)
+	}
+
+	comparisons := []BenchmarkComparison{}
+	for _, history := range groups {
+		candidate := history[len(history)-1]
+		for i := len(history) - 2; i >= 0; i-- {
+			if history[i].BackendVersion != candidate.BackendVersion {
+				comparisons = append(comparisons, compareThroughput(history[i], candidate, tolerance))
+				break
+			}
+		}
+	}
+	slices.SortFunc(comparisons, func(a, b BenchmarkComparison) int {
+		return cmp.Or(
+			cmp.Compare(a.Backend, b.Backend),
+			cmp.Compare(a.Device, b.Device),
+			cmp.Compare(a.Source, b.Source),
+		)
+	})
+	return comparisons
+}
+
+// CheckBackendThroughput records the throughput of the validation generation
+// of a llama.cpp update, and of the previous version if it was measured, as
+// benchmark results. It returns an error, which rolls the update back, if the
+// throughput dropped by more than defaultRegressionTolerance from the latest
+// result of the previous version on this device. See
+// llamacpp.SetThroughputCheck.
+func (s *Scheduler) CheckBackendThroughput(_ context.Context, sample llamacpp.ThroughputSample) error {
+	modelID := s.modelManager.ResolveID(sample.Model)
+	device := s.loader.benchmarkDevice()
+	record := func(version string, tokensPerSecond float64) {
+		now := time.Now()
+		result := BenchmarkResult{
+			Model:          sample.Model,
+			ModelID:        modelID,
+			Backend:        llamacpp.Name,
+			BackendVersion: version,
+			Device:         device,
+			Source:         BenchmarkSourceValidation,
+			Started:        now,
+			Finished:       now,
+			Measurements:   []ParallelismMeasurement{{Parallelism: 1, TokensPerSecond: tokensPerSecond}},
+		}
+		if err := s.tuner.record(result); err != nil {
+			s.log.Warnf("Failed to persist benchmark result: %v", err)
+		}
+	}
+	if sample.PreviousTokensPerSecond > 0 {
+		record(sample.PreviousVersion, sample.PreviousTokensPerSecond)
+	}
+	record(sample.Version, sample.TokensPerSecond)
+	if sample.PreviousVersion == sample.Version {
+		return nil
+	}
+
+	var baseline *BenchmarkResult
+	for _, result := range s.tuner.results(modelID) {
+		if result.Backend == llamacpp.Name && result.BackendVersion == sample.PreviousVersion &&
+			result.Device == device && result.Source == BenchmarkSourceValidation {
+			baseline = &result
+		}
+	}
+	if baseline == nil {
+		return nil
+	}
+	candidate := BenchmarkResult{
+		ModelID:        modelID,
+		BackendVersion: sample.Version,
+		Measurements:   []ParallelismMeasurement{{Parallelism: 1, TokensPerSecond: sample.TokensPerSecond}},
+	}
+	comparison := compareThroughput(*baseline, candidate, defaultRegressionTolerance)
+	if comparison.Regression {
+		return fmt.Errorf("throughput regressed by %.0f%% from %.1f tokens/s with version %s to %.1f tokens/s",
+			-comparison.Change*100, comparison.BaselineTokensPerSecond, comparison.BaselineVersion, comparison.CandidateTokensPerSecond)
+	}
+	return nil
+}
+
+// GetBenchmarkComparisons compares the latest benchmark results of the model
+// specified by the model query parameter with those of previous backend
+// versions on the same devices, flagging throughput drops larger than the
+// tolerance query parameter, a fraction that defaults to 0.1.
+func (s *Scheduler) GetBenchmarkComparisons(w http.ResponseWriter, r *http.Request) {
+	model := r.URL.Query().Get("model")
+	if model == "" {
+		http.Error(w, "model is required", http.StatusBadRequest)
+		return
+	}
+	tolerance := defaultRegressionTolerance
+	if value := r.URL.Query().Get("tolerance"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed >= 1 {
+			http.Error(w, "tolerance must be a fraction between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		tolerance = parsed
+	}
+	results := s.tuner.results(s.modelManager.ResolveID(models.NormalizeModelName(model)))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(compareBenchmarks(results, tolerance)); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
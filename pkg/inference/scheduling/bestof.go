@@ -0,0 +1,371 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/metrics"
+)
+
+const (
+	// bestOfSelectionLogprob selects the candidates with the highest mean
+	// log probability per token.
+	bestOfSelectionLogprob = "logprob"
+	// bestOfSelectionJudge selects the candidates ranked best by a judge
+	// model.
+	bestOfSelectionJudge = "judge"
+	// maximumJudgeRequestBytes is the maximum size of the request shown to
+	// the judge model. Longer requests are cut from the start.
+	maximumJudgeRequestBytes = 32 * 1024
+	// maximumJudgeTokens is the maximum number of tokens generated by the
+	// judge model for its ranking.
+	maximumJudgeTokens = 64
+	// judgeInstructions are the instructions given to the judge model.
+	judgeInstructions = "You are judging candidate responses to a request. Rank the candidates from best to worst by how well they answer the request. Reply with the candidate numbers only, from best to worst, separated by commas."
+)
+
+// judgeRankingPattern matches the candidate numbers in a judge's ranking.
+var judgeRankingPattern = regexp.MustCompile(`\d+`)
+
+// bestOfOptions are the best_of options of a completion request.
+type bestOfOptions struct {
+	// candidates is the number of candidates generated (best_of).
+	candidates int
+	// judge is the judge model (best_of_judge), if candidates are selected by
+	// a judge rather than by log probability.
+	judge string
+	// storeCandidates indicates whether the discarded candidates are stored
+	// in the selected candidates' records (best_of_store_candidates).
+	storeCandidates bool
+}
+
+// bestOfResult describes how a best_of request's choices were selected. It's
+// added to responses as the top-level "best_of" field.
+type bestOfResult struct {
+	Candidates int    `json:"candidates"`
+	Selection  string `json:"selection"`
+	Judge      string `json:"judge,omitempty"`
+}
+
+// bestOfCandidate is a generated candidate.
+type bestOfCandidate struct {
+	// response is the candidate's response.
+	response *bufferedResponseWriter
+	// content is the content of the candidate's choice.
+	content string
+	// score is the mean log probability per token of the candidate's choice,
+	// or negative infinity if the backend didn't report log probabilities.
+	score float64
+}
+
+// parseBestOf parses the best_of options of a completion request for n
+// choices. It returns nil if the request doesn't request more candidates than
+// choices.
+func parseBestOf(body []byte, n int, stream bool) (*bestOfOptions, error) {
+	var request struct {
+		BestOf                int    `json:"best_of"`
+		BestOfJudge           string `json:"best_of_judge"`
+		BestOfStoreCandidates bool   `json:"best_of_store_candidates"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, nil
+	}
+	if request.BestOf == 0 {
+		if request.BestOfJudge != "" || request.BestOfStoreCandidates {
+			return nil, errors.New("best_of_judge and best_of_store_candidates require best_of")
+		}
+		return nil, nil
+	}
+	switch {
+	case request.BestOf < n:
+		return nil, errors.New("best_of must be at least n")
+	case request.BestOf > maximumChoices:
+		return nil, fmt.Errorf("best_of must be at most %d", maximumChoices)
+	case stream && request.BestOf > n:
+		return nil, errors.New("best_of isn't supported for streaming requests")
+	}
+	if request.BestOf == n && request.BestOfJudge == "" {
+		return nil, nil
+	}
+	return &bestOfOptions{
+		candidates:      request.BestOf,
+		judge:           request.BestOfJudge,
+		storeCandidates: request.BestOfStoreCandidates,
+	}, nil
+}
+
+// bestOfRequestBody returns the body of the request generating a best_of
+// request's candidates, with the best_of options removed and log
+// probabilities requested. It also returns whether the client requested log
+// probabilities.
+func bestOfRequestBody(body []byte, chat bool) ([]byte, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, false, err
+	}
+	for _, name := range []string{"best_of", "best_of_judge", "best_of_store_candidates"} {
+		delete(fields, name)
+	}
+	var logprobs bool
+	if chat {
+		json.Unmarshal(fields["logprobs"], &logprobs)
+		fields["logprobs"] = json.RawMessage("true")
+	} else {
+		var count int
+		json.Unmarshal(fields["logprobs"], &count)
+		if logprobs = count > 0; !logprobs {
+			fields["logprobs"] = json.RawMessage("1")
+		}
+	}
+	encoded, err := json.Marshal(fields)
+	return encoded, logprobs, err
+}
+
+// parseBestOfCandidate parses the content and score of a candidate's response.
+func parseBestOfCandidate(response *bufferedResponseWriter) bestOfCandidate {
+	candidate := bestOfCandidate{response: response, score: math.Inf(-1)}
+	var body struct {
+		Choices []struct {
+			Text    string `json:"text"`
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			Logprobs *struct {
+				Content []struct {
+					Logprob float64 `json:"logprob"`
+				} `json:"content"`
+				TokenLogprobs []float64 `json:"token_logprobs"`
+			} `json:"logprobs"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(response.body.Bytes(), &body) != nil || len(body.Choices) == 0 {
+		return candidate
+	}
+	choice := body.Choices[0]
+	candidate.content = choice.Message.Content + choice.Text
+	if choice.Logprobs == nil {
+		return candidate
+	}
+	logprobs := choice.Logprobs.TokenLogprobs
+	for _, token := range choice.Logprobs.Content {
+		logprobs = append(logprobs, token.Logprob)
+	}
+	if len(logprobs) > 0 {
+		var sum float64
+		for _, logprob := range logprobs {
+			sum += logprob
+		}
+		candidate.score = sum / float64(len(logprobs))
+	}
+	return candidate
+}
+
+// rankByScore returns the indices of candidates ordered by descending score.
+// Candidates with equal scores keep their order.
+func rankByScore(candidates []bestOfCandidate) []int {
+	ranking := make([]int, len(candidates))
+	for i := range ranking {
+		ranking[i] = i
+	}
+	slices.SortStableFunc(ranking, func(a, b int) int {
+		switch {
+		case candidates[a].score > candidates[b].score:
+			return -1
+		case candidates[a].score < candidates[b].score:
+			return 1
+		}
+		return 0
+	})
+	return ranking
+}
+
+// parseJudgeRanking parses a judge's ranking of count candidates, numbered
+// from 1, into candidate indices, completing it with fallback, the ranking
+// used for the candidates that the judge didn't rank.
+func parseJudgeRanking(reply string, count int, fallback []int) ([]int, error) {
+	var ranking []int
+	for _, match := range judgeRankingPattern.FindAllString(reply, -1) {
+		number, err := strconv.Atoi(match)
+		if err != nil || number < 1 || number > count || slices.Contains(ranking, number-1) {
+			continue
+		}
+		ranking = append(ranking, number-1)
+	}
+	if len(ranking) == 0 {
+		return nil, fmt.Errorf("invalid ranking %q", reply)
+	}
+	for _, i := range fallback {
+		if !slices.Contains(ranking, i) {
+			ranking = append(ranking, i)
+		}
+	}
+	return ranking, nil
+}
+
+// requestText returns the text of a completion request for a judge: the
+// transcript of a chat completion request's messages or a completion
+// request's prompt.
+func requestText(body []byte) string {
+	var request struct {
+		Prompt   json.RawMessage `json:"prompt"`
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if json.Unmarshal(body, &request) != nil {
+		return ""
+	}
+	var text strings.Builder
+	for _, message := range request.Messages {
+		if content := messageText(message.Content); content != "" {
+			fmt.Fprintf(&text, "%s: %s\n\n", message.Role, content)
+		}
+	}
+	var prompt string
+	if json.Unmarshal(request.Prompt, &prompt) == nil {
+		text.WriteString(prompt)
+	}
+	return text.String()
+}
+
+// judge asks the judge model to rank candidates generated for a request,
+// issued on behalf of the original request.
+func (s *Scheduler) judge(r *http.Request, model string, body []byte, candidates []bestOfCandidate, fallback []int) ([]int, error) {
+	request := requestText(body)
+	if len(request) > maximumJudgeRequestBytes {
+		request = strings.ToValidUTF8(request[len(request)-maximumJudgeRequestBytes:], "")
+	}
+	var input strings.Builder
+	fmt.Fprintf(&input, "Request:\n%s\n\n", strings.TrimSpace(request))
+	for i, candidate := range candidates {
+		fmt.Fprintf(&input, "Candidate %d:\n%s\n\n", i+1, strings.TrimSpace(candidate.content))
+	}
+	reply, err := s.chatCompletion(r, model, judgeInstructions, input.String(), maximumJudgeTokens)
+	if err != nil {
+		return nil, fmt.Errorf("judge request failed: %w", err)
+	}
+	return parseJudgeRanking(reply, len(candidates), fallback)
+}
+
+// serveBestOf serves a non-streaming completion request for n choices
+// selected among several candidates, which not all backends support. The
+// candidates are generated as for requests for several choices, and the n
+// best candidates are returned, ranked by a judge model or by their mean log
+// probability per token. The usage accounts for all candidates.
+func (s *Scheduler) serveBestOf(w http.ResponseWriter, r *http.Request, body []byte, model string, n int, options bestOfOptions) {
+	candidateBody, clientLogprobs, err := bestOfRequestBody(body, strings.HasSuffix(r.URL.Path, "/chat/completions"))
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	bodies, err := choiceRequestBodies(candidateBody, options.candidates)
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	responses, failed := s.generateChoices(r, bodies)
+	if failed != nil {
+		writeBufferedResponse(w, failed)
+		return
+	}
+
+	// Rank the candidates, falling back to their log probabilities if the
+	// judge fails.
+	candidates := make([]bestOfCandidate, len(responses))
+	for i, response := range responses {
+		candidates[i] = parseBestOfCandidate(response)
+	}
+	result := bestOfResult{Candidates: len(candidates), Selection: bestOfSelectionLogprob}
+	ranking := rankByScore(candidates)
+	if options.judge != "" {
+		if judged, err := s.judge(r, options.judge, body, candidates, ranking); err != nil {
+			s.log.Warnf("Unable to judge candidates for %s, selecting by log probability instead: %v", model, err)
+		} else {
+			ranking = judged
+			result.Selection = bestOfSelectionJudge
+			result.Judge = options.judge
+		}
+	}
+
+	// Note the selection in the records of the selected candidates.
+	for rank, i := range ranking[:n] {
+		recordID := candidates[i].response.header.Get(inference.RecordIDHeader)
+		if recordID == "" {
+			continue
+		}
+		record := metrics.BestOfRecord{
+			Candidates: result.Candidates,
+			Selection:  result.Selection,
+			Judge:      result.Judge,
+			Rank:       rank + 1,
+		}
+		if options.storeCandidates {
+			for _, discarded := range ranking[n:] {
+				record.Discarded = append(record.Discarded, candidates[discarded].content)
+			}
+		}
+		recordModel := model
+		if routed := candidates[i].response.header.Get(inference.RoutedModelHeader); routed != "" {
+			recordModel = routed
+		}
+		s.openAIRecorder.RecordBestOf(recordID, recordModel, record)
+	}
+
+	selected := make([]*bufferedResponseWriter, n)
+	for rank, i := range ranking[:n] {
+		selected[rank] = responses[i]
+	}
+	merged, err := mergeBestOfResponses(selected, responses, result, clientLogprobs)
+	if err != nil {
+		http.Error(w, fmt.Errorf("unable to merge choices: %v", err).Error(), http.StatusBadGateway)
+		return
+	}
+	selected[0].body.Reset()
+	selected[0].body.Write(merged)
+	writeBufferedResponse(w, selected[0])
+}
+
+// mergeBestOfResponses merges the responses of the selected candidates into a
+// response with their choices, with the usage of all candidates and the
+// best_of result added, optionally removing the log probabilities of its
+// choices.
+func mergeBestOfResponses(selected, all []*bufferedResponseWriter, result bestOfResult, logprobs bool) ([]byte, error) {
+	merged, err := mergeChoiceResponses(selected)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(merged, &fields); err != nil {
+		return nil, err
+	}
+	if !logprobs {
+		var choices []map[string]json.RawMessage
+		if err := json.Unmarshal(fields["choices"], &choices); err != nil {
+			return nil, err
+		}
+		for _, choice := range choices {
+			delete(choice, "logprobs")
+		}
+		if fields["choices"], err = json.Marshal(choices); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := fields["usage"]; ok {
+		if fields["usage"], err = json.Marshal(totalUsage(all)); err != nil {
+			return nil, err
+		}
+	}
+	if fields["best_of"], err = json.Marshal(result); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
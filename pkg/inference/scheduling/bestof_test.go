@@ -0,0 +1,86 @@
+package scheduling
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestParseBestOf(t *testing.T) {
+	for _, tt := range []struct {
+		body   string
+		n      int
+		stream bool
+		want   *bestOfOptions
+		err    bool
+	}{
+		{body: `{}`, n: 1},
+		{body: `{"best_of":1}`, n: 1},
+		{body: `{"best_of":3}`, n: 1, want: &bestOfOptions{candidates: 3}},
+		{body: `{"best_of":3,"best_of_judge":"ai/qwen3","best_of_store_candidates":true}`, n: 2, want: &bestOfOptions{candidates: 3, judge: "ai/qwen3", storeCandidates: true}},
+		{body: `{"best_of":2}`, n: 3, err: true},
+		{body: `{"best_of":17}`, n: 1, err: true},
+		{body: `{"best_of":3}`, n: 1, stream: true, err: true},
+		{body: `{"best_of_judge":"ai/qwen3"}`, n: 1, err: true},
+	} {
+		options, err := parseBestOf([]byte(tt.body), tt.n, tt.stream)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.body, err)
+			continue
+		}
+		if (options == nil) != (tt.want == nil) || (options != nil && *options != *tt.want) {
+			t.Errorf("%s: expected %+v, got %+v", tt.body, tt.want, options)
+		}
+	}
+}
+
+func TestBestOfRequestBody(t *testing.T) {
+	body, logprobs, err := bestOfRequestBody([]byte(`{"model":"ai/smollm2","best_of":3,"best_of_judge":"ai/qwen3"}`), true)
+	if err != nil || logprobs || string(body) != `{"logprobs":true,"model":"ai/smollm2"}` {
+		t.Errorf("Unexpected chat body %s (%t, %v)", body, logprobs, err)
+	}
+	body, logprobs, err = bestOfRequestBody([]byte(`{"prompt":"Hi","best_of":3,"logprobs":2}`), false)
+	if err != nil || !logprobs || string(body) != `{"logprobs":2,"prompt":"Hi"}` {
+		t.Errorf("Unexpected completion body %s (%t, %v)", body, logprobs, err)
+	}
+}
+
+func TestBestOfSelection(t *testing.T) {
+	var responses []*bufferedResponseWriter
+	for _, body := range []string{
+		`{"choices":[{"index":0,"message":{"content":"a"},"logprobs":{"content":[{"logprob":-2},{"logprob":-1}]}}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`,
+		`{"choices":[{"index":0,"message":{"content":"b"},"logprobs":{"content":[{"logprob":-0.5}]}}],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`,
+		`{"choices":[{"index":0,"message":{"content":"c"}}],"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`,
+	} {
+		response := &bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}
+		response.body.WriteString(body)
+		responses = append(responses, response)
+	}
+	candidates := make([]bestOfCandidate, len(responses))
+	for i, response := range responses {
+		candidates[i] = parseBestOfCandidate(response)
+	}
+	ranking := rankByScore(candidates)
+	if !slices.Equal(ranking, []int{1, 0, 2}) {
+		t.Fatalf("Expected ranking [1 0 2], got %v", ranking)
+	}
+
+	// Judges may rank only some candidates, which are completed by the
+	// fallback ranking.
+	judged, err := parseJudgeRanking("3, 3, 7", 3, ranking)
+	if err != nil || !slices.Equal(judged, []int{2, 1, 0}) {
+		t.Errorf("Expected judged ranking [2 1 0], got %v (%v)", judged, err)
+	}
+	if _, err := parseJudgeRanking("none", 3, ranking); err == nil {
+		t.Error("Expected error for a ranking without candidates")
+	}
+
+	merged, err := mergeBestOfResponses([]*bufferedResponseWriter{responses[1]}, responses, bestOfResult{Candidates: 3, Selection: bestOfSelectionLogprob}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `{"best_of":{"candidates":3,"selection":"logprob"},"choices":[{"index":0,"message":{"content":"b"}}],"usage":{"prompt_tokens":5,"completion_tokens":6,"total_tokens":11}}`
+	if string(merged) != want {
+		t.Errorf("Expected %s, got %s", want, merged)
+	}
+}
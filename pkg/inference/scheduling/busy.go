@@ -0,0 +1,80 @@
+package scheduling
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// busyMeter attributes the busy time of a runner to the requests that it
+// serves. While a runner serves several requests concurrently, its busy time
+// is shared equally between them, so that the busy time of its requests adds
+// up to its own. Requests beyond the runner's parallel slots are queued by
+// the backend, so they aren't attributed any busy time until a slot frees up.
+type busyMeter struct {
+	// now returns the current time.
+	now func() time.Time
+	// slots is the number of requests that the runner processes concurrently,
+	// or zero if it's unknown, in which case all requests are considered
+	// processed.
+	slots int
+	// m protects the fields below.
+	m sync.Mutex
+	// last is the time up to which busy time has been attributed.
+	last time.Time
+	// active are the requests being served, in order of arrival.
+	active []*busyRequest
+}
+
+// busyRequest is a request being served by a runner.
+type busyRequest struct {
+	// busy is the busy time attributed to the request so far.
+	busy time.Duration
+}
+
+// newBusyMeter creates a new busy meter for a runner with the specified
+// number of parallel slots.
+func newBusyMeter(slots int) *busyMeter {
+	return &busyMeter{now: time.Now, slots: slots}
+}
+
+// advance attributes the busy time since the last event to the requests that
+// occupy slots. The caller must hold b.m.
+func (b *busyMeter) advance() {
+	now := b.now()
+	elapsed := now.Sub(b.last)
+	b.last = now
+	processing := len(b.active)
+	if b.slots > 0 {
+		processing = min(processing, b.slots)
+	}
+	if processing == 0 || elapsed <= 0 {
+		return
+	}
+	share := elapsed / time.Duration(processing)
+	for _, request := range b.active[:processing] {
+		request.busy += share
+	}
+}
+
+// start notes that the runner started serving a request.
+func (b *busyMeter) start() *busyRequest {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.advance()
+	request := &busyRequest{}
+	b.active = append(b.active, request)
+	return request
+}
+
+// finish notes that the runner finished serving a request and returns the
+// busy time attributed to it.
+func (b *busyMeter) finish(request *busyRequest) time.Duration {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.advance()
+	if i := slices.Index(b.active, request); i >= 0 {
+		b.active = slices.Delete(b.active, i, i+1)
+	}
+	return request.busy
+}
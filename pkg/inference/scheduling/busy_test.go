@@ -0,0 +1,51 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusyMeter(t *testing.T) {
+	var now time.Time
+	newMeter := func(slots int) *busyMeter {
+		meter := newBusyMeter(slots)
+		meter.now = func() time.Time { return now }
+		return meter
+	}
+	at := func(seconds int) { now = time.Unix(int64(seconds), 0) }
+
+	// Concurrent requests share the busy time.
+	meter := newMeter(0)
+	at(0)
+	a, b := meter.start(), meter.start()
+	at(2)
+	if busy := meter.finish(a); busy != time.Second {
+		t.Errorf("Expected 1s for a, got %s", busy)
+	}
+	at(3)
+	if busy := meter.finish(b); busy != 2*time.Second {
+		t.Errorf("Expected 2s for b, got %s", busy)
+	}
+
+	// Requests beyond the slots are queued, so they aren't attributed busy
+	// time until a slot frees up.
+	meter = newMeter(1)
+	at(10)
+	a, b = meter.start(), meter.start()
+	at(12)
+	if busy := meter.finish(a); busy != 2*time.Second {
+		t.Errorf("Expected 2s for a, got %s", busy)
+	}
+	at(13)
+	if busy := meter.finish(b); busy != time.Second {
+		t.Errorf("Expected 1s for queued b, got %s", busy)
+	}
+
+	// Idle time isn't attributed to later requests.
+	at(20)
+	c := meter.start()
+	at(21)
+	if busy := meter.finish(c); busy != time.Second {
+		t.Errorf("Expected 1s for c, got %s", busy)
+	}
+}
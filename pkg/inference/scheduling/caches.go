@@ -0,0 +1,67 @@
+package scheduling
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/model-runner/pkg/metrics"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// cacheSampleInterval is the interval at which the cache metrics of active
+// runners are sampled.
+const cacheSampleInterval = 15 * time.Second
+
+// sampleCaches samples the cache metrics of active runners periodically until
+// the context is cancelled.
+func (s *Scheduler) sampleCaches(ctx context.Context) {
+	ticker := time.NewTicker(cacheSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sampleCacheMetrics(ctx)
+		}
+	}
+}
+
+// sampleCacheMetrics fetches the metrics of the active runners and records
+// them by model, backend, and mode, combining replicas. Runners whose backends
+// don't serve metrics are skipped.
+func (s *Scheduler) sampleCacheMetrics(ctx context.Context) {
+	type runnerGroup struct {
+		backend string
+		modelID string
+		mode    string
+	}
+	sockets := make(map[runnerGroup][]string)
+	if !s.loader.lock(ctx) {
+		return
+	}
+	for key, runnerInfo := range s.loader.runners {
+		if s.loader.slots[runnerInfo.slot] == nil {
+			continue
+		}
+		socket, err := RunnerSocketPath(runnerInfo.slot)
+		if err != nil {
+			continue
+		}
+		group := runnerGroup{backend: key.backend, modelID: key.modelID, mode: key.mode.String()}
+		sockets[group] = append(sockets[group], socket)
+	}
+	s.loader.unlock()
+
+	for group, groupSockets := range sockets {
+		var replicas []map[string]*dto.MetricFamily
+		for _, socket := range groupSockets {
+			if families, err := metrics.FetchRunnerMetrics(ctx, socket); err == nil {
+				replicas = append(replicas, families)
+			}
+		}
+		if len(replicas) > 0 {
+			s.cacheStats.Sample(group.backend, group.modelID, group.mode, replicas)
+		}
+	}
+}
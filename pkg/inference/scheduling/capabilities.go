@@ -0,0 +1,106 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+// capabilityRequest is used to extract the portions of an OpenAI inference
+// request that depend on model capabilities.
+type capabilityRequest struct {
+	// Tools are the tools made available to the model.
+	Tools []json.RawMessage `json:"tools"`
+	// Messages are the chat messages.
+	Messages []struct {
+		// Content is either a string or an array of content parts.
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+}
+
+// contentPart is a single part of a multi-part chat message content.
+type contentPart struct {
+	// Type is the content part type (e.g. "text" or "image_url").
+	Type string `json:"type"`
+}
+
+// hasImageContent returns whether any of the request's messages contain
+// image content parts.
+func (r *capabilityRequest) hasImageContent() bool {
+	for _, message := range r.Messages {
+		var parts []contentPart
+		if err := json.Unmarshal(message.Content, &parts); err != nil {
+			// String (or otherwise non-array) content can't contain images.
+			continue
+		}
+		for _, part := range parts {
+			if part.Type == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateCapabilities checks that an inference request only relies on
+// features that the target model supports. Checks are only performed where the
+// model's support can be determined reliably, and malformed bodies are left
+// for the backend to reject.
+func validateCapabilities(model types.Model, modelRef string, mode inference.BackendMode, body []byte) error {
+	config, err := model.Config()
+	if err != nil {
+		return nil
+	}
+	capabilities := models.Capabilities(model)
+
+	if mode == inference.BackendModeCompletion && !slices.Contains(capabilities, models.CapabilityCompletion) {
+		return fmt.Errorf("%w: model %s does not support text generation (supported: %s)",
+			ErrUnsupportedCapability, modelRef, strings.Join(capabilities, ", "))
+	}
+
+	// Tool and vision support can only be inferred for GGUF models, whose
+	// chat templates and multimodal projectors are packaged explicitly.
+	if config.Format != types.FormatGGUF {
+		return nil
+	}
+
+	var request capabilityRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil
+	}
+	if len(request.Tools) > 0 && models.ChatTemplate(model) != "" && !slices.Contains(capabilities, models.CapabilityTools) {
+		return fmt.Errorf("%w: model %s does not support tools because its chat template has no tool support",
+			ErrUnsupportedCapability, modelRef)
+	}
+	if request.hasImageContent() && !slices.Contains(capabilities, models.CapabilityVision) {
+		return fmt.Errorf("%w: model %s does not support image input because it has no multimodal projector",
+			ErrUnsupportedCapability, modelRef)
+	}
+	return nil
+}
+
+// validateDimensions checks that an embedding model is configured to support
+// truncation of its embeddings to the requested number of dimensions. Only
+// models trained with matryoshka representations produce meaningful truncated
+// embeddings, so support must be declared explicitly.
+func validateDimensions(runnerConfig *inference.BackendConfiguration, modelRef string, dimensions int) error {
+	if runnerConfig == nil || len(runnerConfig.MatryoshkaDimensions) == 0 {
+		return fmt.Errorf("%w: model %s does not support the dimensions parameter because no matryoshka dimensions are configured",
+			ErrUnsupportedCapability, modelRef)
+	}
+	if !slices.Contains(runnerConfig.MatryoshkaDimensions, dimensions) {
+		supported := make([]string, len(runnerConfig.MatryoshkaDimensions))
+		for i, d := range runnerConfig.MatryoshkaDimensions {
+			supported[i] = strconv.Itoa(d)
+		}
+		return fmt.Errorf("%w: model %s does not support %d dimensions (supported: %s)",
+			ErrUnsupportedCapability, modelRef, dimensions, strings.Join(supported, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package scheduling
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+// capabilityModel is a minimal types.Model implementation for testing
+type capabilityModel struct {
+	types.Model
+	config     types.Config
+	mmprojPath string
+}
+
+func (m *capabilityModel) Config() (types.Config, error)     { return m.config, nil }
+func (m *capabilityModel) MMPROJPath() (string, error)       { return m.mmprojPath, nil }
+func (m *capabilityModel) ChatTemplatePath() (string, error) { return "", nil }
+
+func TestValidateCapabilities(t *testing.T) {
+	textModel := &capabilityModel{config: types.Config{
+		Format: types.FormatGGUF,
+		GGUF: map[string]string{
+			"general.architecture":    "llama",
+			"tokenizer.chat_template": "{{ messages }}",
+		},
+	}}
+	toolVisionModel := &capabilityModel{
+		config: types.Config{
+			Format: types.FormatGGUF,
+			GGUF: map[string]string{
+				"general.architecture":    "gemma3",
+				"tokenizer.chat_template": "{% if tools %}{% endif %}",
+			},
+		},
+		mmprojPath: "model.mmproj",
+	}
+	embeddingModel := &capabilityModel{config: types.Config{
+		Format: types.FormatGGUF,
+		GGUF:   map[string]string{"general.architecture": "bert"},
+	}}
+	safetensorsModel := &capabilityModel{config: types.Config{Format: types.FormatSafetensors}}
+
+	imageRequest := `{"model":"m","messages":[{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]}]}`
+	toolsRequest := `{"model":"m","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f"}}]}`
+	textRequest := `{"model":"m","messages":[{"role":"user","content":"hi"}]}`
+
+	tests := []struct {
+		name    string
+		model   types.Model
+		mode    inference.BackendMode
+		body    string
+		wantErr bool
+	}{
+		{"text request on text model", textModel, inference.BackendModeCompletion, textRequest, false},
+		{"image request on text model", textModel, inference.BackendModeCompletion, imageRequest, true},
+		{"tools request on text model", textModel, inference.BackendModeCompletion, toolsRequest, true},
+		{"image request on vision model", toolVisionModel, inference.BackendModeCompletion, imageRequest, false},
+		{"tools request on tool model", toolVisionModel, inference.BackendModeCompletion, toolsRequest, false},
+		{"completion request on embedding model", embeddingModel, inference.BackendModeCompletion, textRequest, true},
+		{"embedding request on embedding model", embeddingModel, inference.BackendModeEmbedding, `{"model":"m","input":"hi"}`, false},
+		{"image request on safetensors model", safetensorsModel, inference.BackendModeCompletion, imageRequest, false},
+		{"malformed body", textModel, inference.BackendModeCompletion, `{"messages":`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCapabilities(tt.model, "m", tt.mode, []byte(tt.body))
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedCapability) {
+					t.Errorf("Expected ErrUnsupportedCapability, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateDimensions(t *testing.T) {
+	matryoshkaConfig := &inference.BackendConfiguration{MatryoshkaDimensions: []int{256, 512}}
+	tests := []struct {
+		name         string
+		runnerConfig *inference.BackendConfiguration
+		dimensions   int
+		wantErr      bool
+	}{
+		{"unconfigured model", nil, 256, true},
+		{"model without matryoshka dimensions", &inference.BackendConfiguration{ContextSize: 512}, 256, true},
+		{"supported dimensions", matryoshkaConfig, 256, false},
+		{"unsupported dimensions", matryoshkaConfig, 128, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDimensions(tt.runnerConfig, "m", tt.dimensions)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedCapability) {
+					t.Errorf("Expected ErrUnsupportedCapability, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
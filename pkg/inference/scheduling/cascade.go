@@ -0,0 +1,243 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+// Reasons for which cascades escalate requests.
+const (
+	cascadeReasonError         = "error"
+	cascadeReasonTooShort      = "too_short"
+	cascadeReasonRefusal       = "refusal"
+	cascadeReasonLowConfidence = "low_confidence"
+)
+
+// refusalPrefixes are the lowercase prefixes of answers that look like
+// refusals.
+var refusalPrefixes = []string{
+	"i'm sorry",
+	"i am sorry",
+	"sorry, ",
+	"i can't",
+	"i cannot",
+	"i'm unable",
+	"i am unable",
+	"i'm not able",
+	"i am not able",
+	"i don't know",
+	"i do not know",
+	"as an ai",
+}
+
+// cascadeAttempt describes a request attempted by a cascade.
+type cascadeAttempt struct {
+	Model      string `json:"model"`
+	StatusCode int    `json:"status_code"`
+	// Reason is the reason for which the attempt was escalated, if it was.
+	Reason string `json:"reason,omitempty"`
+}
+
+// cascadeDecision describes how a cascade served a request. It's added to
+// responses as the top-level "cascade" field.
+type cascadeDecision struct {
+	Escalated bool             `json:"escalated"`
+	Reason    string           `json:"reason,omitempty"`
+	Attempts  []cascadeAttempt `json:"attempts"`
+}
+
+// validateCascade validates the cascade of the virtual model with the
+// specified normalized name.
+func validateCascade(name string, cascade *Cascade) error {
+	if cascade.Model == "" || cascade.EscalationModel == "" {
+		return invalidf("cascade: model and escalation_model are required")
+	}
+	model, escalationModel := models.NormalizeModelName(cascade.Model), models.NormalizeModelName(cascade.EscalationModel)
+	if model == name || escalationModel == name {
+		return invalidf("cascade: models can't be the virtual model itself")
+	}
+	if model == escalationModel {
+		return invalidf("cascade: model and escalation_model must differ")
+	}
+	if cascade.MinLength < 0 {
+		return invalidf("cascade: min_length can't be negative")
+	}
+	if cascade.MinConfidence < 0 || cascade.MinConfidence > 1 {
+		return invalidf("cascade: min_confidence must be between 0 and 1")
+	}
+	return nil
+}
+
+// serveCascade serves a non-streaming chat completion request with a cascade.
+// The request is sent to the cascade's model, and sent again to its escalation
+// model if the answer is inadequate. Both attempts are issued as internal
+// requests, so that they're recorded individually.
+func (s *Scheduler) serveCascade(w http.ResponseWriter, r *http.Request, body []byte, cascade *Cascade) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Request log probabilities from the first model if confidence is checked,
+	// and remove them from its answer unless the client requested them.
+	var stripLogprobs bool
+	if cascade.MinConfidence > 0 {
+		var logprobs bool
+		json.Unmarshal(fields["logprobs"], &logprobs)
+		if !logprobs {
+			fields["logprobs"] = json.RawMessage("true")
+			stripLogprobs = true
+		}
+	}
+
+	attempt := func(model string, fields map[string]json.RawMessage) (*bufferedResponseWriter, bool) {
+		encoded, err := json.Marshal(model)
+		if err != nil {
+			return nil, false
+		}
+		fields["model"] = encoded
+		attemptBody, err := json.Marshal(fields)
+		if err != nil {
+			return nil, false
+		}
+		recorder := &bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}
+		s.ServeHTTP(recorder, newInternalRequest(r, r.URL.Path, attemptBody))
+		return recorder, true
+	}
+
+	first, ok := attempt(cascade.Model, fields)
+	if !ok {
+		http.Error(w, "failed to encode request", http.StatusInternalServerError)
+		return
+	}
+	decision := cascadeDecision{Attempts: []cascadeAttempt{{Model: cascade.Model, StatusCode: first.statusCode}}}
+	decision.Reason = escalationReason(cascade, first.statusCode, first.body.Bytes())
+	if decision.Reason == "" {
+		writeCascadeResponse(w, first, cascade.Model, decision, stripLogprobs)
+		return
+	}
+	s.log.Infof("Escalating request for %s to %s: %s", cascade.Model, cascade.EscalationModel, decision.Reason)
+	decision.Escalated = true
+	decision.Attempts[0].Reason = decision.Reason
+
+	if stripLogprobs {
+		delete(fields, "logprobs")
+	}
+	second, ok := attempt(cascade.EscalationModel, fields)
+	if !ok {
+		http.Error(w, "failed to encode request", http.StatusInternalServerError)
+		return
+	}
+	decision.Attempts = append(decision.Attempts, cascadeAttempt{Model: cascade.EscalationModel, StatusCode: second.statusCode})
+	writeCascadeResponse(w, second, cascade.EscalationModel, decision, false)
+}
+
+// escalationReason returns the reason for which a cascade should escalate a
+// chat completion response, or an empty string if it shouldn't be escalated.
+// Every choice must be adequate for the response not to be escalated.
+func escalationReason(cascade *Cascade, statusCode int, body []byte) string {
+	if statusCode != http.StatusOK {
+		return cascadeReasonError
+	}
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			Logprobs *struct {
+				Content []struct {
+					Logprob float64 `json:"logprob"`
+				} `json:"content"`
+			} `json:"logprobs"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || len(response.Choices) == 0 {
+		return cascadeReasonError
+	}
+	for _, choice := range response.Choices {
+		content := strings.TrimSpace(choice.Message.Content)
+		if cascade.Refusals && isRefusal(content) {
+			return cascadeReasonRefusal
+		}
+		if utf8.RuneCountInString(content) < cascade.MinLength {
+			return cascadeReasonTooShort
+		}
+		// Backends that don't report log probabilities skip the check.
+		if cascade.MinConfidence > 0 && choice.Logprobs != nil && len(choice.Logprobs.Content) > 0 {
+			var sum float64
+			for _, token := range choice.Logprobs.Content {
+				sum += token.Logprob
+			}
+			if math.Exp(sum/float64(len(choice.Logprobs.Content))) < cascade.MinConfidence {
+				return cascadeReasonLowConfidence
+			}
+		}
+	}
+	return ""
+}
+
+// isRefusal returns whether an answer looks like a refusal.
+func isRefusal(content string) bool {
+	content = strings.ToLower(strings.ReplaceAll(content, "’", "'"))
+	for _, prefix := range refusalPrefixes {
+		if strings.HasPrefix(content, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCascadeResponse writes the response of a cascade's final attempt, with
+// the cascade decision added to successful responses.
+func writeCascadeResponse(w http.ResponseWriter, attempt *bufferedResponseWriter, model string, decision cascadeDecision, stripLogprobs bool) {
+	for name, values := range attempt.header {
+		if name != "Content-Length" {
+			w.Header()[name] = values
+		}
+	}
+	w.Header().Set(inference.RoutedModelHeader, model)
+	body := attempt.body.Bytes()
+	if attempt.statusCode == http.StatusOK {
+		if annotated, err := annotateCascadeResponse(body, decision, stripLogprobs); err == nil {
+			body = annotated
+		}
+	}
+	w.WriteHeader(attempt.statusCode)
+	w.Write(body)
+}
+
+// annotateCascadeResponse adds a cascade decision to a chat completion
+// response, optionally removing the log probabilities of its choices.
+func annotateCascadeResponse(body []byte, decision cascadeDecision, stripLogprobs bool) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	if stripLogprobs {
+		var choices []map[string]json.RawMessage
+		if err := json.Unmarshal(fields["choices"], &choices); err != nil {
+			return nil, err
+		}
+		for _, choice := range choices {
+			delete(choice, "logprobs")
+		}
+		encoded, err := json.Marshal(choices)
+		if err != nil {
+			return nil, err
+		}
+		fields["choices"] = encoded
+	}
+	encoded, err := json.Marshal(decision)
+	if err != nil {
+		return nil, err
+	}
+	fields["cascade"] = encoded
+	return json.Marshal(fields)
+}
@@ -0,0 +1,119 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestEscalationReason(t *testing.T) {
+	cascade := &Cascade{Model: "ai/smollm2", EscalationModel: "ai/gemma3", MinLength: 10, MinConfidence: 0.5, Refusals: true}
+	answer := func(content string, logprobs ...float64) []byte {
+		choice := map[string]any{"index": 0, "message": map[string]any{"role": "assistant", "content": content}}
+		if len(logprobs) > 0 {
+			tokens := make([]map[string]any, len(logprobs))
+			for i, logprob := range logprobs {
+				tokens[i] = map[string]any{"token": "x", "logprob": logprob}
+			}
+			choice["logprobs"] = map[string]any{"content": tokens}
+		}
+		body, _ := json.Marshal(map[string]any{"choices": []any{choice}})
+		return body
+	}
+
+	tests := []struct {
+		name       string
+		statusCode int
+		body       []byte
+		expected   string
+	}{
+		{"adequate", http.StatusOK, answer("The capital of France is Paris."), ""},
+		{"confident", http.StatusOK, answer("The capital of France is Paris.", -0.1, -0.2), ""},
+		{"failed", http.StatusServiceUnavailable, []byte("unavailable"), cascadeReasonError},
+		{"invalid", http.StatusOK, []byte(`{"choices":[]}`), cascadeReasonError},
+		{"too short", http.StatusOK, answer("Paris."), cascadeReasonTooShort},
+		{"refusal", http.StatusOK, answer("I’m sorry, but I can't help with that."), cascadeReasonRefusal},
+		{"low confidence", http.StatusOK, answer("The capital of France is Lyon.", -2, -1.5), cascadeReasonLowConfidence},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := escalationReason(cascade, tt.statusCode, tt.body); reason != tt.expected {
+				t.Errorf("Expected reason %q, got %q", tt.expected, reason)
+			}
+		})
+	}
+}
+
+func TestWriteCascadeResponse(t *testing.T) {
+	attempt := &bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}
+	attempt.header.Set("Content-Type", "application/json")
+	attempt.header.Set("Content-Length", "1")
+	attempt.body.WriteString(`{"object":"chat.completion","choices":[{"index":0,"message":{"content":"Paris"},"logprobs":{"content":[]}}]}`)
+	decision := cascadeDecision{
+		Escalated: true,
+		Reason:    cascadeReasonTooShort,
+		Attempts: []cascadeAttempt{
+			{Model: "ai/smollm2", StatusCode: http.StatusOK, Reason: cascadeReasonTooShort},
+			{Model: "ai/gemma3", StatusCode: http.StatusOK},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	writeCascadeResponse(w, attempt, "ai/gemma3", decision, true)
+	if w.Header().Get(inference.RoutedModelHeader) != "ai/gemma3" || w.Header().Get("Content-Length") != "" {
+		t.Errorf("Unexpected headers %v", w.Header())
+	}
+	var response struct {
+		Choices []map[string]json.RawMessage `json:"choices"`
+		Cascade cascadeDecision              `json:"cascade"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response %s: %v", w.Body.String(), err)
+	}
+	if _, ok := response.Choices[0]["logprobs"]; ok {
+		t.Error("Expected log probabilities to be removed")
+	}
+	if !response.Cascade.Escalated || len(response.Cascade.Attempts) != 2 || response.Cascade.Attempts[0] != decision.Attempts[0] {
+		t.Errorf("Unexpected cascade decision %+v", response.Cascade)
+	}
+
+	// Failed responses are written unmodified.
+	attempt = &bufferedResponseWriter{statusCode: http.StatusNotFound, header: make(http.Header)}
+	attempt.body.WriteString("model not found\n")
+	w = httptest.NewRecorder()
+	writeCascadeResponse(w, attempt, "ai/gemma3", decision, false)
+	if w.Code != http.StatusNotFound || w.Body.String() != "model not found\n" {
+		t.Errorf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCascadeDryRun(t *testing.T) {
+	log := createTestLogger()
+	backend := &mockBackend{name: "mock", usesExternalModelMgmt: true}
+	s := NewScheduler(log, map[string]inference.Backend{"mock": backend}, backend, nil, nil, nil, nil, nil, systemMemoryInfo{})
+	if err := s.SetVirtualModels([]VirtualModel{{Name: "assistant", Cascade: &Cascade{Model: "ai/smollm2", EscalationModel: "ai/gemma3"}}}); err != nil {
+		t.Fatalf("Failed to set virtual models: %v", err)
+	}
+
+	// Non-streaming chat completion requests are validated against the first
+	// model, and other requests are routed to the escalation model.
+	for body, expected := range map[string]string{
+		`{"model":"assistant","messages":[{"role":"user","content":"Hi"}]}`:               "ai/smollm2",
+		`{"model":"assistant","stream":true,"messages":[{"role":"user","content":"Hi"}]}`: "ai/gemma3",
+	} {
+		request := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/mock/v1/chat/completions", strings.NewReader(body))
+		request.Header.Set(inference.DryRunHeader, "1")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if routed := w.Header().Get(inference.RoutedModelHeader); routed != expected {
+			t.Errorf("Expected %s to be routed to %s, got %s", body, expected, routed)
+		}
+	}
+}
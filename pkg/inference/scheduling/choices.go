@@ -0,0 +1,393 @@
+package scheduling
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maximumChoices is the maximum number of choices that may be requested.
+const maximumChoices = 16
+
+// choiceUsage is the token usage of a completion.
+type choiceUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// add adds the usage of another choice of the same request. The prompt is
+// only accounted once, as for backends that generate choices natively.
+func (u *choiceUsage) add(other choiceUsage) {
+	u.PromptTokens = max(u.PromptTokens, other.PromptTokens)
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+}
+
+// totalUsage returns the usage of the responses to single-choice requests
+// generating the choices of the same request.
+func totalUsage(responses []*bufferedResponseWriter) choiceUsage {
+	var usage choiceUsage
+	for _, response := range responses {
+		var body struct {
+			Usage choiceUsage `json:"usage"`
+		}
+		if json.Unmarshal(response.body.Bytes(), &body) == nil {
+			usage.add(body.Usage)
+		}
+	}
+	return usage
+}
+
+// parseChoices returns the number of choices requested by a completion
+// request (its "n" field), or 1 if unspecified.
+func parseChoices(body []byte) (int, error) {
+	var request struct {
+		N *int `json:"n"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil || request.N == nil {
+		return 1, nil
+	}
+	if *request.N < 1 || *request.N > maximumChoices {
+		return 0, fmt.Errorf("n must be between 1 and %d", maximumChoices)
+	}
+	return *request.N, nil
+}
+
+// choiceRequestBodies returns the bodies of the single-choice requests that
+// generate the choices of a request for n choices. If the request has a seed,
+// each generation is given a distinct seed, so that the choices differ while
+// remaining reproducible.
+func choiceRequestBodies(body []byte, n int) ([][]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "n")
+	var seed *int64
+	json.Unmarshal(fields["seed"], &seed)
+	bodies := make([][]byte, n)
+	for i := range bodies {
+		if seed != nil {
+			fields["seed"], _ = json.Marshal(*seed + int64(i))
+		}
+		encoded, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		bodies[i] = encoded
+	}
+	return bodies, nil
+}
+
+// reindexChoices sets the index of a response's (or streamed chunk's) choices
+// to index and returns them.
+func reindexChoices(fields map[string]json.RawMessage, index int) ([]json.RawMessage, error) {
+	if _, ok := fields["choices"]; !ok {
+		return nil, nil
+	}
+	var choices []map[string]json.RawMessage
+	if err := json.Unmarshal(fields["choices"], &choices); err != nil {
+		return nil, err
+	}
+	encodedChoices := make([]json.RawMessage, len(choices))
+	for i, choice := range choices {
+		choice["index"], _ = json.Marshal(index)
+		encoded, err := json.Marshal(choice)
+		if err != nil {
+			return nil, err
+		}
+		encodedChoices[i] = encoded
+	}
+	return encodedChoices, nil
+}
+
+// serveChoices serves a completion request for n choices, which not all
+// backends support, by generating each choice with a single-choice request and
+// merging their responses. The generations are issued concurrently as internal
+// requests, so that they occupy the runner's parallel slots (or queue for
+// them) and are recorded individually.
+func (s *Scheduler) serveChoices(w http.ResponseWriter, r *http.Request, body []byte, n int, stream bool) {
+	bodies, err := choiceRequestBodies(body, n)
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if stream {
+		s.streamChoices(w, r, bodies)
+		return
+	}
+
+	recorders, failed := s.generateChoices(r, bodies)
+	if failed != nil {
+		writeBufferedResponse(w, failed)
+		return
+	}
+	merged, err := mergeChoiceResponses(recorders)
+	if err != nil {
+		http.Error(w, fmt.Errorf("unable to merge choices: %v", err).Error(), http.StatusBadGateway)
+		return
+	}
+	recorders[0].body.Reset()
+	recorders[0].body.Write(merged)
+	writeBufferedResponse(w, recorders[0])
+}
+
+// generateChoices issues the single-choice requests with the specified bodies
+// concurrently and returns their responses, or the first failed response if
+// any of them failed.
+func (s *Scheduler) generateChoices(r *http.Request, bodies [][]byte) ([]*bufferedResponseWriter, *bufferedResponseWriter) {
+	recorders := make([]*bufferedResponseWriter, len(bodies))
+	var wg sync.WaitGroup
+	for i, choiceBody := range bodies {
+		recorders[i] = &bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.ServeHTTP(recorders[i], newInternalRequest(r, r.URL.Path, choiceBody))
+		}()
+	}
+	wg.Wait()
+	for _, recorder := range recorders {
+		if recorder.statusCode != http.StatusOK {
+			return nil, recorder
+		}
+	}
+	return recorders, nil
+}
+
+// mergeChoiceResponses merges the responses of single-choice requests, in
+// order, into a response with their choices.
+func mergeChoiceResponses(recorders []*bufferedResponseWriter) ([]byte, error) {
+	var merged map[string]json.RawMessage
+	var choices []json.RawMessage
+	var usage choiceUsage
+	for i, recorder := range recorders {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(recorder.body.Bytes(), &fields); err != nil {
+			return nil, err
+		}
+		reindexed, err := reindexChoices(fields, i)
+		if err != nil {
+			return nil, err
+		}
+		choices = append(choices, reindexed...)
+		var choiceUsage choiceUsage
+		if json.Unmarshal(fields["usage"], &choiceUsage) == nil {
+			usage.add(choiceUsage)
+		}
+		if merged == nil {
+			merged = fields
+		}
+	}
+	var err error
+	if merged["choices"], err = json.Marshal(choices); err != nil {
+		return nil, err
+	}
+	if _, ok := merged["usage"]; ok {
+		if merged["usage"], err = json.Marshal(usage); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// writeBufferedResponse writes a buffered response.
+func writeBufferedResponse(w http.ResponseWriter, recorder *bufferedResponseWriter) {
+	for name, values := range recorder.header {
+		if name != "Content-Length" {
+			w.Header()[name] = values
+		}
+	}
+	w.WriteHeader(recorder.statusCode)
+	w.Write(recorder.body.Bytes())
+}
+
+// choiceStream merges the event streams of single-choice requests into the
+// event stream of a request for several choices. Chunks are relayed as they
+// arrive, with their choices reindexed, while usage is merged into a final
+// chunk.
+type choiceStream struct {
+	// w is the merged stream's writer.
+	w http.ResponseWriter
+	// m protects the fields below.
+	m sync.Mutex
+	// started indicates whether the merged stream has been started.
+	started bool
+	// usage is the merged usage, if any chunk reported usage.
+	usage *choiceUsage
+	// last is the last chunk relayed, used as a template for the usage chunk.
+	last map[string]json.RawMessage
+	// failure is the first failed generation's response, if any.
+	failure *bufferedResponseWriter
+}
+
+// streamChoices serves a streaming request for several choices.
+func (s *Scheduler) streamChoices(w http.ResponseWriter, r *http.Request, bodies [][]byte) {
+	stream := &choiceStream{w: w}
+	var wg sync.WaitGroup
+	for i, choiceBody := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			writer := newEventStreamWriter(func(data []byte) {
+				stream.relay(i, data)
+			})
+			s.ServeHTTP(writer, newInternalRequest(r, r.URL.Path, choiceBody))
+			if writer.failure != nil {
+				stream.fail(writer.failure)
+			}
+		}()
+	}
+	wg.Wait()
+	stream.finish()
+}
+
+// relay relays a chunk of the generation with the specified index.
+func (s *choiceStream) relay(index int, data []byte) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return
+	}
+	choices, err := reindexChoices(fields, index)
+	if err != nil {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if raw, ok := fields["usage"]; ok && string(raw) != "null" {
+		var usage choiceUsage
+		if json.Unmarshal(raw, &usage) == nil {
+			if s.usage == nil {
+				s.usage = &choiceUsage{}
+			}
+			s.usage.add(usage)
+		}
+		delete(fields, "usage")
+	}
+	s.last = fields
+	if len(choices) == 0 {
+		return
+	}
+	fields["choices"], _ = json.Marshal(choices)
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	s.start()
+	fmt.Fprintf(s.w, "data: %s\n\n", encoded)
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// start starts the merged stream if it hasn't been started. The caller must
+// hold s.m.
+func (s *choiceStream) start() {
+	if s.started {
+		return
+	}
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+	s.started = true
+}
+
+// fail notes the failure of a generation. Failures are reported as the
+// response if the stream hasn't started, and as error events otherwise.
+func (s *choiceStream) fail(recorder *bufferedResponseWriter) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !s.started {
+		if s.failure == nil {
+			s.failure = recorder
+		}
+		return
+	}
+	message := bytes.ReplaceAll(bytes.TrimSpace(recorder.body.Bytes()), []byte("\n"), []byte("\ndata: "))
+	fmt.Fprintf(s.w, "event: error\ndata: %s\n\n", message)
+}
+
+// finish ends the merged stream once all generations have completed, with
+// the merged usage, if any.
+func (s *choiceStream) finish() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !s.started && s.failure != nil {
+		writeBufferedResponse(s.w, s.failure)
+		return
+	}
+	s.start()
+	if s.usage != nil && s.last != nil {
+		s.last["choices"] = json.RawMessage("[]")
+		s.last["usage"], _ = json.Marshal(s.usage)
+		if encoded, err := json.Marshal(s.last); err == nil {
+			fmt.Fprintf(s.w, "data: %s\n\n", encoded)
+		}
+	}
+	fmt.Fprint(s.w, "data: [DONE]\n\n")
+}
+
+// eventStreamWriter is the response writer of an internal streaming request,
+// which passes the data of each server-sent event to a callback as soon as
+// it's complete.
+type eventStreamWriter struct {
+	// header is the response header.
+	header http.Header
+	// event is called with the data of each event, other than the final
+	// [DONE] event.
+	event func(data []byte)
+	// failure buffers the response if the request failed.
+	failure *bufferedResponseWriter
+	// pending buffers a partially received event.
+	pending bytes.Buffer
+}
+
+// newEventStreamWriter creates an eventStreamWriter passing event data to the
+// specified callback.
+func newEventStreamWriter(event func(data []byte)) *eventStreamWriter {
+	return &eventStreamWriter{header: make(http.Header), event: event}
+}
+
+// Header implements http.ResponseWriter.Header.
+func (w *eventStreamWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (w *eventStreamWriter) WriteHeader(statusCode int) {
+	if statusCode != http.StatusOK && w.failure == nil {
+		w.failure = &bufferedResponseWriter{statusCode: statusCode, header: w.header}
+	}
+}
+
+// Write implements http.ResponseWriter.Write.
+func (w *eventStreamWriter) Write(data []byte) (int, error) {
+	if w.failure != nil {
+		return w.failure.body.Write(data)
+	}
+	w.pending.Write(data)
+	for {
+		event, rest, found := bytes.Cut(w.pending.Bytes(), []byte("\n\n"))
+		if !found {
+			break
+		}
+		for _, line := range strings.Split(string(event), "\n") {
+			if payload, ok := strings.CutPrefix(line, "data: "); ok && payload != "[DONE]" {
+				w.event([]byte(payload))
+			}
+		}
+		remaining := bytes.Clone(rest)
+		w.pending.Reset()
+		w.pending.Write(remaining)
+	}
+	return len(data), nil
+}
+
+// Flush implements http.Flusher.Flush. Events are passed on as soon as
+// they're complete, so there's nothing to flush.
+func (w *eventStreamWriter) Flush() {}
@@ -0,0 +1,96 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseChoices(t *testing.T) {
+	for body, want := range map[string]int{`{}`: 1, `{"n":1}`: 1, `{"n":4}`: 4} {
+		if n, err := parseChoices([]byte(body)); err != nil || n != want {
+			t.Errorf("%s: expected %d, got %d (%v)", body, want, n, err)
+		}
+	}
+	for _, body := range []string{`{"n":0}`, `{"n":17}`} {
+		if _, err := parseChoices([]byte(body)); err == nil {
+			t.Errorf("%s: expected error", body)
+		}
+	}
+}
+
+func TestChoiceRequestBodies(t *testing.T) {
+	bodies, err := choiceRequestBodies([]byte(`{"model":"ai/smollm2","n":3,"seed":42}`), 3)
+	if err != nil || len(bodies) != 3 {
+		t.Fatalf("Unexpected bodies %q (%v)", bodies, err)
+	}
+	for i, body := range bodies {
+		var request struct {
+			N    *int  `json:"n"`
+			Seed int64 `json:"seed"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil || request.N != nil || request.Seed != 42+int64(i) {
+			t.Errorf("Unexpected body %s (%v)", body, err)
+		}
+	}
+}
+
+func TestMergeChoiceResponses(t *testing.T) {
+	var recorders []*bufferedResponseWriter
+	for _, content := range []string{"a", "b"} {
+		recorder := &bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}
+		recorder.body.WriteString(`{"id":"` + content + `","choices":[{"index":0,"message":{"content":"` + content + `"}}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`)
+		recorders = append(recorders, recorder)
+	}
+	merged, err := mergeChoiceResponses(recorders)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `{"choices":[{"index":0,"message":{"content":"a"}},{"index":1,"message":{"content":"b"}}],"id":"a","usage":{"prompt_tokens":10,"completion_tokens":4,"total_tokens":14}}`
+	if string(merged) != want {
+		t.Errorf("Expected %s, got %s", want, merged)
+	}
+}
+
+func TestChoiceStream(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	stream := &choiceStream{w: recorder}
+	for i, content := range []string{"a", "b"} {
+		writer := newEventStreamWriter(func(data []byte) {
+			stream.relay(i, data)
+		})
+		writer.WriteHeader(http.StatusOK)
+		// Events may be split across writes.
+		writer.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"` + content + `"}}]}` + "\n"))
+		writer.Write([]byte("\n" + `data: {"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":1,"total_tokens":11}}` + "\n\ndata: [DONE]\n\n"))
+	}
+	stream.finish()
+
+	want := `data: {"choices":[{"delta":{"content":"a"},"index":0}]}
+
+data: {"choices":[{"delta":{"content":"b"},"index":1}]}
+
+data: {"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}
+
+data: [DONE]
+
+`
+	if body := recorder.Body.String(); body != want {
+		t.Errorf("Expected stream %q, got %q", want, body)
+	}
+
+	// Failures before the stream starts are reported as the response.
+	recorder = httptest.NewRecorder()
+	stream = &choiceStream{w: recorder}
+	writer := newEventStreamWriter(func(data []byte) {
+		stream.relay(0, data)
+	})
+	http.Error(writer, "model not found", http.StatusNotFound)
+	stream.fail(writer.failure)
+	stream.finish()
+	if recorder.Code != http.StatusNotFound || !strings.Contains(recorder.Body.String(), "model not found") {
+		t.Errorf("Expected the failure to be reported, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,267 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+const (
+	// compressionField is the chat completion request field that enables or
+	// disables prompt compression for the request.
+	compressionField = "prompt_compression"
+	// minimumCompressionBytes is the minimum size of the messages that are
+	// compressed.
+	minimumCompressionBytes = 1024
+	// minimumCompressionRatio is the minimum ratio of a compressed message's
+	// size to its original size that's requested from the compression model.
+	minimumCompressionRatio = 0.2
+	// maximumCompressionChunkBytes is the maximum size of the text sent to the
+	// compression model at once. Longer messages are compressed in chunks, so
+	// that they fit in the compression model's context.
+	maximumCompressionChunkBytes = 8 * 1024
+	// approximateBytesPerWord is the average number of bytes per word, with
+	// its separator, used to express compression targets in words.
+	approximateBytesPerWord = 6
+	// compressionInstructions are the instructions given to the compression
+	// model, formatted with the target number of words.
+	compressionInstructions = "Compress the following text to about %d words by removing the words that aren't needed to understand it, such as filler words, articles, and redundant phrases. Keep all facts, names, numbers, and code, in their original order and language. Reply with the compressed text only."
+)
+
+// compressionOption is a chat completion request's prompt compression option.
+type compressionOption struct {
+	// set indicates that the request specified the option, overriding the
+	// model's configuration.
+	set bool
+	// config is the requested compression configuration, or nil if the
+	// request disabled compression.
+	config *inference.CompressionConfig
+}
+
+// resolve returns the compression configuration for a request given the
+// model's configuration, or nil if the request's prompt isn't compressed. A
+// request that enables compression without selecting a compression model uses
+// the model's configured compression model, if any.
+func (o compressionOption) resolve(configured *inference.CompressionConfig) *inference.CompressionConfig {
+	if !o.set {
+		return configured
+	}
+	if o.config != nil && o.config.Model == "" && configured != nil {
+		return configured
+	}
+	return o.config
+}
+
+// parseCompressionOption parses and strips the prompt compression field of a
+// chat completion request, which is either a boolean or a compression
+// configuration.
+func parseCompressionOption(body []byte) (compressionOption, []byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return compressionOption{}, body, nil
+	}
+	raw, ok := fields[compressionField]
+	if !ok {
+		return compressionOption{}, body, nil
+	}
+	option := compressionOption{set: true}
+	var enabled bool
+	if err := json.Unmarshal(raw, &enabled); err == nil {
+		if enabled {
+			option.config = &inference.CompressionConfig{}
+		}
+	} else if err := json.Unmarshal(raw, &option.config); err != nil || option.config == nil {
+		return compressionOption{}, nil, errors.New("prompt_compression must be a boolean or an object")
+	}
+	delete(fields, compressionField)
+	stripped, err := json.Marshal(fields)
+	if err != nil {
+		return compressionOption{}, nil, fmt.Errorf("unable to encode request: %w", err)
+	}
+	return option, stripped, nil
+}
+
+// compressionStats describes how a conversation's prompt was compressed.
+type compressionStats struct {
+	// originalTokens and compressedTokens are the estimated numbers of prompt
+	// tokens before and after compression.
+	originalTokens   uint64
+	compressedTokens uint64
+	// messages is the number of compressed messages.
+	messages int
+}
+
+// String returns the representation of the statistics reported in
+// inference.PromptCompressionHeader.
+func (s compressionStats) String() string {
+	return fmt.Sprintf("original-tokens=%d, compressed-tokens=%d, messages=%d", s.originalTokens, s.compressedTokens, s.messages)
+}
+
+// textCompressor compresses text to about targetBytes bytes.
+type textCompressor func(text string, targetBytes int) (string, error)
+
+// compress compresses the largest messages of a conversation, other than
+// system and developer messages, until it fits within budget tokens or no
+// message can be compressed further. It returns the rewritten request body
+// and the compression statistics, or a nil body if no message was compressed.
+// The compressed conversation may still exceed the budget, in which case it's
+// left to truncation.
+func compress(c *conversation, budget uint64, compressText textCompressor) ([]byte, compressionStats, error) {
+	keep := make([]bool, len(c.messages))
+	for i := range keep {
+		keep[i] = true
+	}
+	stats := compressionStats{originalTokens: c.estimatedTokens(keep)}
+	if stats.originalTokens <= budget {
+		return nil, stats, nil
+	}
+
+	// Compress the largest messages first, since they hold the most
+	// redundancy and require the fewest compression requests.
+	type compressible struct {
+		index   int
+		message map[string]json.RawMessage
+		text    string
+	}
+	var candidates []compressible
+	for i, raw := range c.messages {
+		if c.roles[i] == "system" || c.roles[i] == "developer" {
+			continue
+		}
+		var message map[string]json.RawMessage
+		var text string
+		if json.Unmarshal(raw, &message) != nil || json.Unmarshal(message["content"], &text) != nil || len(text) < minimumCompressionBytes {
+			continue
+		}
+		candidates = append(candidates, compressible{index: i, message: message, text: text})
+	}
+	slices.SortStableFunc(candidates, func(a, b compressible) int {
+		return len(b.text) - len(a.text)
+	})
+
+	excess := int(stats.originalTokens-budget) * approximateBytesPerToken
+	for _, candidate := range candidates {
+		if excess <= 0 {
+			break
+		}
+		target := max(len(candidate.text)-excess, int(float64(len(candidate.text))*minimumCompressionRatio))
+		compressed, err := compressText(candidate.text, target)
+		if err != nil {
+			// Keep the messages compressed so far and leave the rest to
+			// truncation.
+			break
+		}
+		if len(compressed) >= len(candidate.text) {
+			continue
+		}
+		candidate.message["content"], _ = json.Marshal(compressed)
+		encoded, err := json.Marshal(candidate.message)
+		if err != nil {
+			return nil, stats, fmt.Errorf("unable to encode compressed message: %w", err)
+		}
+		c.messages[candidate.index] = encoded
+		excess -= len(candidate.text) - len(compressed)
+		stats.messages++
+	}
+	if stats.messages == 0 {
+		return nil, stats, nil
+	}
+
+	body, err := c.body(keep, "")
+	if err != nil {
+		return nil, stats, fmt.Errorf("unable to encode compressed conversation: %w", err)
+	}
+	stats.compressedTokens = c.estimatedTokens(keep)
+	return body, stats, nil
+}
+
+// compressionChunks splits text into chunks of at most maximumBytes bytes,
+// splitting at whitespace where possible.
+func compressionChunks(text string, maximumBytes int) []string {
+	var chunks []string
+	for len(text) > maximumBytes {
+		end := strings.LastIndexFunc(text[:maximumBytes], unicode.IsSpace)
+		if end <= 0 {
+			end = maximumBytes
+			for end > 0 && !utf8.RuneStart(text[end]) {
+				end--
+			}
+		}
+		chunks = append(chunks, text[:end])
+		text = strings.TrimLeftFunc(text[end:], unicode.IsSpace)
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// compressConversation compresses a chat completion request's conversation
+// to fit within the model's context, if compression is configured for the
+// model or requested. If contextSize is non-zero, it's the context length
+// requested by the request. It returns a nil body if no message was
+// compressed, including if the model's context length is unknown.
+func (s *Scheduler) compressConversation(r *http.Request, backend inference.Backend, model types.Model, modelRef string, contextSize uint64, option compressionOption, body []byte) ([]byte, compressionStats, error) {
+	modelID, err := model.ID()
+	if err != nil {
+		return nil, compressionStats{}, nil
+	}
+	runnerConfig := s.loader.runnerConfig(r.Context(), backend.Name(), modelID, inference.BackendModeCompletion)
+	var configured *inference.CompressionConfig
+	if runnerConfig != nil {
+		configured = runnerConfig.Compression
+	}
+	compression := option.resolve(configured)
+	if compression == nil {
+		return nil, compressionStats{}, nil
+	}
+	config, err := model.Config()
+	if err != nil {
+		return nil, compressionStats{}, nil
+	}
+	contextWindow := contextWindowForRunner(backend, config, withContextSizeOverride(runnerConfig, contextSize))
+	if contextWindow == nil {
+		return nil, compressionStats{}, nil
+	}
+	c, err := parseConversation(body)
+	if err != nil {
+		return nil, compressionStats{}, nil
+	}
+
+	compressionModel := compression.Model
+	if compressionModel == "" {
+		compressionModel = modelRef
+	}
+	return compress(c, promptBudget(*contextWindow, c.maxTokens), func(text string, targetBytes int) (string, error) {
+		compressed, err := s.compressText(r, compressionModel, text, targetBytes)
+		if err != nil {
+			s.log.Warnf("Unable to compress prompt for %s: %v", modelRef, err)
+		}
+		return compressed, err
+	})
+}
+
+// compressText compresses text to about targetBytes bytes using chat
+// completion requests to model, issued on behalf of the original request.
+func (s *Scheduler) compressText(r *http.Request, model, text string, targetBytes int) (string, error) {
+	var compressed []string
+	for _, chunk := range compressionChunks(text, maximumCompressionChunkBytes) {
+		chunkTarget := max(len(chunk)*targetBytes/len(text), approximateBytesPerWord)
+		words := chunkTarget / approximateBytesPerWord
+		maxTokens := uint64(2*chunkTarget/approximateBytesPerToken + 16)
+		result, err := s.chatCompletion(r, model, fmt.Sprintf(compressionInstructions, max(words, 1)), chunk, maxTokens)
+		if err != nil {
+			return "", fmt.Errorf("compression request failed: %w", err)
+		}
+		compressed = append(compressed, result)
+	}
+	return strings.Join(compressed, "\n"), nil
+}
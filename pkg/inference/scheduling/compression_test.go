@@ -0,0 +1,107 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestParseCompressionOption(t *testing.T) {
+	configured := &inference.CompressionConfig{Model: "ai/smollm2"}
+	for _, tt := range []struct {
+		field string
+		want  *inference.CompressionConfig
+	}{
+		{"", configured},
+		{`,"prompt_compression":false`, nil},
+		{`,"prompt_compression":true`, configured},
+		{`,"prompt_compression":{"model":"ai/qwen3"}`, &inference.CompressionConfig{Model: "ai/qwen3"}},
+	} {
+		option, body, err := parseCompressionOption([]byte(`{"model":"ai/gemma3"` + tt.field + `}`))
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.field, err)
+		}
+		if strings.Contains(string(body), compressionField) {
+			t.Errorf("%q: expected the option to be stripped, got %s", tt.field, body)
+		}
+		got := option.resolve(configured)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%q: expected %+v, got %+v", tt.field, tt.want, got)
+		}
+	}
+
+	// Requests can enable compression for models without a configuration.
+	option, _, _ := parseCompressionOption([]byte(`{"prompt_compression":true}`))
+	if config := option.resolve(nil); config == nil || config.Model != "" {
+		t.Errorf("Expected compression with the model itself, got %+v", config)
+	}
+
+	if _, _, err := parseCompressionOption([]byte(`{"prompt_compression":"yes"}`)); err == nil {
+		t.Error("Expected error for an invalid option")
+	}
+}
+
+func TestCompress(t *testing.T) {
+	document := strings.Repeat("the quick brown fox jumps over the lazy dog ", 100)
+	body, _ := json.Marshal(map[string]any{
+		"model": "ai/gemma3",
+		"messages": []map[string]string{
+			{"role": "system", "content": strings.Repeat("Be concise. ", 200)},
+			{"role": "user", "content": document},
+			{"role": "user", "content": "Summarize the document."},
+		},
+	})
+	c, err := parseConversation(body)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var targets []int
+	compressed, stats, err := compress(c, 1000, func(text string, targetBytes int) (string, error) {
+		targets = append(targets, targetBytes)
+		return text[:targetBytes], nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(targets) != 1 || stats.messages != 1 {
+		t.Fatalf("Expected only the document to be compressed, got targets %v", targets)
+	}
+	if stats.compressedTokens > 1000 || stats.compressedTokens >= stats.originalTokens {
+		t.Errorf("Expected the conversation to fit, got %s", stats)
+	}
+	var request struct {
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(compressed, &request); err != nil || len(request.Messages) != 3 {
+		t.Fatalf("Unexpected compressed request %s (%v)", compressed, err)
+	}
+	if request.Messages[0].Content != strings.Repeat("Be concise. ", 200) || len(request.Messages[1].Content) != targets[0] {
+		t.Errorf("Unexpected compressed messages %+v", request.Messages)
+	}
+
+	// Conversations that fit aren't compressed.
+	c, _ = parseConversation(body)
+	if compressed, _, _ := compress(c, 100000, nil); compressed != nil {
+		t.Errorf("Expected no compression, got %s", compressed)
+	}
+}
+
+func TestCompressionChunks(t *testing.T) {
+	text := strings.Repeat("word ", 10) + strings.Repeat("é", 20)
+	chunks := compressionChunks(text, 16)
+	removeSpaces := func(s string) string { return strings.ReplaceAll(s, " ", "") }
+	if removeSpaces(strings.Join(chunks, "")) != removeSpaces(text) {
+		t.Errorf("Expected chunks to cover the text, got %q", chunks)
+	}
+	for _, chunk := range chunks {
+		if len(chunk) > 16 || !utf8.ValidString(chunk) {
+			t.Errorf("Unexpected chunk %q", chunk)
+		}
+	}
+}
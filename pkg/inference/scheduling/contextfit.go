@@ -0,0 +1,89 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+)
+
+const (
+	// minimumContextSize is the smallest context size, in tokens, to which a
+	// model's context is reduced to fit it in memory or which requests may
+	// override it with.
+	minimumContextSize = 1024
+	// fittedContextSizeStep is the granularity, in tokens, of fitted context
+	// sizes.
+	fittedContextSizeStep = 256
+)
+
+// contextSizeFor returns the context size, in tokens, with which a runner for
+// the specified model would start, or zero if it's unknown or can't be
+// reduced to fit the model in memory.
+func (l *loader) contextSizeFor(backend inference.Backend, modelID string, runnerConfig *inference.BackendConfiguration) uint64 {
+	if backend.Name() != llamacpp.Name || l.modelManager == nil {
+		return 0
+	}
+	model, err := l.modelManager.GetLocal(modelID)
+	if err != nil {
+		return 0
+	}
+	config, err := model.Config()
+	if err != nil {
+		return 0
+	}
+	return llamacpp.GetContextSize(config, runnerConfig)
+}
+
+// fitContextSize finds the largest context size, below the specified one,
+// with which the model fits in memory. It returns a copy of the runner
+// configuration with the fitted context size applied, along with the memory
+// that the runner will require, or errModelTooBig if even the minimum context
+// size doesn't fit.
+func (l *loader) fitContextSize(ctx context.Context, backend inference.Backend, modelID string, runnerConfig *inference.BackendConfiguration, contextSize uint64) (*inference.BackendConfiguration, inference.RequiredMemory, error) {
+	var fitted inference.BackendConfiguration
+	if runnerConfig != nil {
+		fitted = *runnerConfig
+	}
+	try := func(size uint64) (inference.RequiredMemory, error) {
+		fitted.FittedContextSize = size
+		return l.requiredMemory(ctx, backend, modelID, &fitted)
+	}
+
+	// Binary search over multiples of the step, given that the minimum fits.
+	low, high := uint64(minimumContextSize), (contextSize-1)/fittedContextSizeStep*fittedContextSizeStep
+	if high < low {
+		return nil, inference.RequiredMemory{}, errModelTooBig
+	}
+	memory, err := try(low)
+	if err != nil {
+		return nil, inference.RequiredMemory{}, err
+	}
+	for low < high {
+		mid := (low + high + fittedContextSizeStep) / 2 / fittedContextSizeStep * fittedContextSizeStep
+		midMemory, err := try(mid)
+		if errors.Is(err, errModelTooBig) {
+			high = mid - fittedContextSizeStep
+		} else if err != nil {
+			return nil, inference.RequiredMemory{}, err
+		} else {
+			low, memory = mid, midMemory
+		}
+	}
+	fitted.FittedContextSize = low
+
+	l.log.Warnf("Context size of %d tokens for %s doesn't fit in memory, reducing it to %d tokens",
+		contextSize, modelID, low)
+	return &fitted, memory, nil
+}
+
+// contextSizeWarning returns the warning reported for runners whose context
+// size was reduced to fit in memory.
+func contextSizeWarning(runnerConfig *inference.BackendConfiguration) string {
+	if runnerConfig == nil || runnerConfig.FittedContextSize == 0 {
+		return ""
+	}
+	return fmt.Sprintf("the context size was reduced to %d tokens to fit the model in memory", runnerConfig.FittedContextSize)
+}
@@ -0,0 +1,67 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+// contextScaledBackend is a mock backend whose memory requirements grow with
+// the fitted context size.
+type contextScaledBackend struct {
+	mockBackend
+	// bytesPerToken is the memory required per token of context.
+	bytesPerToken uint64
+}
+
+func (b *contextScaledBackend) GetRequiredMemoryForModel(ctx context.Context, model string, config *inference.BackendConfiguration) (inference.RequiredMemory, error) {
+	contextSize := uint64(32768)
+	if config != nil && config.FittedContextSize > 0 {
+		contextSize = config.FittedContextSize
+	}
+	return inference.RequiredMemory{RAM: GB/4 + contextSize*b.bytesPerToken, VRAM: 1}, nil
+}
+
+func TestFitContextSize(t *testing.T) {
+	log := createTestLogger()
+	backend := &contextScaledBackend{mockBackend: mockBackend{name: "test-backend"}, bytesPerToken: 64 * 1024}
+	sysMemInfo := &mockSystemMemoryInfo{
+		totalMemory: inference.RequiredMemory{RAM: 1 * GB, VRAM: 1 * GB},
+	}
+	loader := newLoader(log, map[string]inference.Backend{"test-backend": backend}, nil, nil, sysMemInfo)
+	ctx := context.Background()
+
+	if _, err := loader.requiredMemory(ctx, backend, "modelX", nil); !errors.Is(err, errModelTooBig) {
+		t.Fatalf("Expected the full context not to fit, got %v", err)
+	}
+
+	// 768 MB remain for the context, which is enough for 12288 tokens.
+	runnerConfig := &inference.BackendConfiguration{Parallelism: 2}
+	fitted, memory, err := loader.fitContextSize(ctx, backend, "modelX", runnerConfig, 32768)
+	if err != nil {
+		t.Fatalf("Expected the context size to be fitted, got %v", err)
+	}
+	if fitted.FittedContextSize != 12288 || fitted.Parallelism != 2 {
+		t.Errorf("Expected a fitted context size of 12288 tokens, got %+v", fitted)
+	}
+	if memory.RAM != 1*GB {
+		t.Errorf("Expected the fitted runner to require 1 GB, got %d", memory.RAM)
+	}
+	if runnerConfig.FittedContextSize != 0 {
+		t.Error("Expected the original configuration to be unmodified")
+	}
+	if warning := contextSizeWarning(fitted); warning == "" {
+		t.Error("Expected a warning for a fitted context size")
+	}
+
+	// Fail if even the minimum context size doesn't fit.
+	backend.bytesPerToken = 1024 * 1024
+	if _, _, err := loader.fitContextSize(ctx, backend, "modelX", nil, 32768); !errors.Is(err, errModelTooBig) {
+		t.Errorf("Expected errModelTooBig, got %v", err)
+	}
+	if _, _, err := loader.fitContextSize(ctx, backend, "modelX", nil, minimumContextSize); !errors.Is(err, errModelTooBig) {
+		t.Errorf("Expected errModelTooBig at the minimum context size, got %v", err)
+	}
+}
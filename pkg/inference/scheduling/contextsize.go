@@ -0,0 +1,65 @@
+package scheduling
+
+import (
+	"encoding/json"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+// contextSizeField is the extension field with which inference requests
+// override the context size of the runner serving them.
+const contextSizeField = "context_size"
+
+// withContextSizeOverride returns a copy of the runner configuration with the
+// specified context size override applied, or the configuration itself if the
+// context size is zero.
+func withContextSizeOverride(runnerConfig *inference.BackendConfiguration, contextSize uint64) *inference.BackendConfiguration {
+	if contextSize == 0 {
+		return runnerConfig
+	}
+	var overridden inference.BackendConfiguration
+	if runnerConfig != nil {
+		overridden = *runnerConfig
+	}
+	overridden.ContextSizeOverride = contextSize
+	return &overridden
+}
+
+// validateContextSizeOverride checks that a request's context size override
+// is supported and within the model's maximum context length.
+func validateContextSizeOverride(backend inference.Backend, model types.Model, mode inference.BackendMode, contextSize uint64) error {
+	if mode != inference.BackendModeCompletion {
+		return invalidf("%s is only supported by completion requests", contextSizeField)
+	}
+	if backend.Name() != llamacpp.Name || model == nil {
+		return invalidf("%s is not supported by the %s backend", contextSizeField, backend.Name())
+	}
+	if contextSize < minimumContextSize {
+		return invalidf("%s (%d) must be at least %d tokens", contextSizeField, contextSize, minimumContextSize)
+	}
+	config, err := model.Config()
+	if err != nil {
+		return nil
+	}
+	if maximum := models.ContextWindow(config); maximum != nil && contextSize > *maximum {
+		return invalidf("%s (%d) exceeds the model's maximum context length of %d tokens", contextSizeField, contextSize, *maximum)
+	}
+	return nil
+}
+
+// stripContextSize removes the context size override from the body of an
+// inference request, since backends don't recognize it.
+func stripContextSize(body []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	if _, ok := fields[contextSizeField]; !ok {
+		return body, nil
+	}
+	delete(fields, contextSizeField)
+	return json.Marshal(fields)
+}
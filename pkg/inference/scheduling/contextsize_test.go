@@ -0,0 +1,113 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+)
+
+func TestValidateContextSizeOverride(t *testing.T) {
+	model := &capabilityModel{config: types.Config{
+		Format: types.FormatGGUF,
+		GGUF: map[string]string{
+			"general.architecture": "llama",
+			"llama.context_length": "8192",
+		},
+	}}
+	llamaCpp := &mockBackend{name: llamacpp.Name}
+
+	tests := []struct {
+		name        string
+		backend     inference.Backend
+		mode        inference.BackendMode
+		contextSize uint64
+		valid       bool
+	}{
+		{name: "smaller context", backend: llamaCpp, mode: inference.BackendModeCompletion, contextSize: 2048, valid: true},
+		{name: "model maximum", backend: llamaCpp, mode: inference.BackendModeCompletion, contextSize: 8192, valid: true},
+		{name: "beyond model maximum", backend: llamaCpp, mode: inference.BackendModeCompletion, contextSize: 16384},
+		{name: "below minimum", backend: llamaCpp, mode: inference.BackendModeCompletion, contextSize: 512},
+		{name: "embedding request", backend: llamaCpp, mode: inference.BackendModeEmbedding, contextSize: 2048},
+		{name: "unsupported backend", backend: &mockBackend{name: "vllm"}, mode: inference.BackendModeCompletion, contextSize: 2048},
+	}
+	for _, tt := range tests {
+		err := validateContextSizeOverride(tt.backend, model, tt.mode, tt.contextSize)
+		if tt.valid && err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+		} else if !tt.valid && !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("%s: expected ErrInvalidRequest, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestStripContextSize(t *testing.T) {
+	body := []byte(`{"model":"ai/smollm2","context_size":2048,"max_tokens":16}`)
+	stripped, err := stripContextSize(body)
+	if err != nil {
+		t.Fatalf("Failed to strip context size: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(stripped, &fields); err != nil {
+		t.Fatalf("Invalid stripped body: %v", err)
+	}
+	if _, ok := fields[contextSizeField]; ok || len(fields) != 2 {
+		t.Errorf("Expected only the context size to be stripped, got %s", stripped)
+	}
+
+	unmodified := []byte(`{"model":"ai/smollm2"}`)
+	if stripped, err := stripContextSize(unmodified); err != nil || string(stripped) != string(unmodified) {
+		t.Errorf("Expected body without context size to be unmodified, got %s (%v)", stripped, err)
+	}
+}
+
+// TestContextSizeRunners tests that requests overriding the context size are
+// served by separate runners.
+func TestContextSizeRunners(t *testing.T) {
+	log := createTestLogger()
+	backend := &fastFailBackend{mockBackend: mockBackend{name: "test-backend"}}
+	sysMemInfo := &mockSystemMemoryInfo{
+		totalMemory: inference.RequiredMemory{RAM: 8 * GB, VRAM: 8 * GB},
+	}
+	loader := newLoader(log, map[string]inference.Backend{"test-backend": backend}, nil, nil, sysMemInfo)
+	loader.slots = make([]*runner, 2)
+	loader.references = make([]uint, 2)
+	loader.allocations = make([]inference.RequiredMemory, 2)
+	loader.timestamps = make([]time.Time, 2)
+	loader.loadsEnabled = true
+
+	key := makeRunnerKey("test-backend", "modelX", "", inference.BackendModeCompletion)
+	key.contextSize = 2048
+	loader.slots[0] = createAliveTerminableMockRunner(log, backend)
+	loader.runners[key] = runnerInfo{slot: 0, modelRef: "modelX:latest"}
+
+	r, err := loader.load(context.Background(), "test-backend", "modelX", "modelX:latest", inference.BackendModeCompletion, 2048, nil)
+	if err != nil || r != loader.slots[0] {
+		t.Fatalf("Expected the runner with the requested context size, got %v", err)
+	}
+	loader.release(r)
+
+	// Requests without an override need a runner with the configured context
+	// size (which fails to start with the fast-failing backend).
+	if _, err := loader.load(context.Background(), "test-backend", "modelX", "modelX:latest", inference.BackendModeCompletion, 0, nil); err == nil {
+		t.Error("Expected a runner with the configured context size to be started")
+	}
+
+	// Reconfiguring the model restarts runners with requested context sizes.
+	loader.references[0] = 1
+	if err := loader.setRunnerConfig(context.Background(), "test-backend", "modelX", inference.BackendModeCompletion, inference.BackendConfiguration{ContextSize: 4096}); err != nil {
+		t.Fatalf("Failed to configure runner: %v", err)
+	}
+	if !loader.stale[0] {
+		t.Error("Expected the runner with a requested context size to be marked stale")
+	}
+
+	if config := withContextSizeOverride(nil, 2048); config == nil || config.ContextSizeOverride != 2048 {
+		t.Errorf("Expected an override configuration, got %+v", config)
+	}
+}
@@ -0,0 +1,78 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/inference/reasoning"
+	"github.com/docker/model-runner/pkg/inference/toolcalls"
+)
+
+// responseConverter is an http.ResponseWriter that rewrites the response
+// written to it. Finish must be called once the response has been written.
+type responseConverter interface {
+	http.ResponseWriter
+	// Finish writes any buffered output.
+	Finish() error
+}
+
+// responseConvertersForRequest returns constructors for the converters to
+// apply to the response to an inference request, from the innermost (applied
+// last) to the outermost (applied first).
+func responseConvertersForRequest(model types.Model, path string, body []byte) []func(http.ResponseWriter) responseConverter {
+	if !strings.HasSuffix(path, "/chat/completions") {
+		return nil
+	}
+	chatTemplate := models.ChatTemplate(model)
+
+	var converters []func(http.ResponseWriter) responseConverter
+	if parser := toolCallParserForRequest(chatTemplate, body); parser != nil {
+		converters = append(converters, func(w http.ResponseWriter) responseConverter {
+			return toolcalls.NewResponseWriter(w, parser)
+		})
+	}
+	// Reasoning must be separated before tool calls are parsed, since thinking
+	// models may reason about tool calls before making them.
+	if reasoning.UsesThinkTags(chatTemplate) {
+		converters = append(converters, func(w http.ResponseWriter) responseConverter {
+			return reasoning.NewResponseWriter(w)
+		})
+	}
+	return converters
+}
+
+// toolCallParserForRequest returns the parser to use for converting tool calls
+// in the response to a chat completion request from the model's native format
+// into OpenAI tool_calls objects. It returns nil if the request doesn't provide
+// tools or if the model's tool call format can't be determined.
+func toolCallParserForRequest(chatTemplate string, body []byte) *toolcalls.Parser {
+	var request capabilityRequest
+	if err := json.Unmarshal(body, &request); err != nil || len(request.Tools) == 0 {
+		return nil
+	}
+	return toolcalls.ForChatTemplate(chatTemplate)
+}
+
+// serveConverted serves a request using handler, applying the specified
+// response converters.
+func serveConverted(handler http.Handler, w http.ResponseWriter, r *http.Request, converters []func(http.ResponseWriter) responseConverter) error {
+	chain := make([]responseConverter, 0, len(converters))
+	for _, newConverter := range converters {
+		converter := newConverter(w)
+		chain = append(chain, converter)
+		w = converter
+	}
+	handler.ServeHTTP(w, r)
+
+	// Finish the converters from the outermost to the innermost, since each
+	// one's buffered output is written to the next.
+	for i := len(chain) - 1; i >= 0; i-- {
+		if err := chain[i].Finish(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
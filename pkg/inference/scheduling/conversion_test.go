@@ -0,0 +1,56 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference/reasoning"
+	"github.com/docker/model-runner/pkg/inference/toolcalls"
+)
+
+func TestServeConverted(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"<think>Use the tool.</think>\n<tool_call>{\"name\": \"f\", \"arguments\": {}}</tool_call>"},"finish_reason":"stop"}]}`)
+	})
+	converters := []func(http.ResponseWriter) responseConverter{
+		func(w http.ResponseWriter) responseConverter {
+			return toolcalls.NewResponseWriter(w, toolcalls.Hermes)
+		},
+		func(w http.ResponseWriter) responseConverter {
+			return reasoning.NewResponseWriter(w)
+		},
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	if err := serveConverted(handler, recorder, request, converters); err != nil {
+		t.Fatalf("serveConverted() failed: %v", err)
+	}
+
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content          *string              `json:"content"`
+				ReasoningContent string               `json:"reasoning_content"`
+				ToolCalls        []toolcalls.ToolCall `json:"tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+	}
+	message := response.Choices[0].Message
+	if message.ReasoningContent != "Use the tool." {
+		t.Errorf("reasoning_content = %q, want %q", message.ReasoningContent, "Use the tool.")
+	}
+	if message.Content != nil {
+		t.Errorf("content = %q, want null", *message.Content)
+	}
+	if len(message.ToolCalls) != 1 || message.ToolCalls[0].Function.Name != "f" {
+		t.Errorf("unexpected tool calls: %+v", message.ToolCalls)
+	}
+}
@@ -0,0 +1,95 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+// serveDryRun validates an inference request without executing it and
+// responds with a description of how it would be handled. Capability checks
+// have already been performed by the caller. The model is nil for backends
+// that manage models externally. The upstream body is the body that would be
+// forwarded to the backend.
+func (s *Scheduler) serveDryRun(w http.ResponseWriter, r *http.Request, backend inference.Backend, model types.Model, modelRef string, mode inference.BackendMode, contextSize uint64, body, upstreamBody []byte) {
+	result, err := validateRequestSchema(r.URL.Path, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := DryRunResponse{
+		Backend:               backend.Name(),
+		Model:                 modelRef,
+		Mode:                  mode.String(),
+		EstimatedPromptTokens: result.estimatedPromptTokens,
+		Upstream: DryRunUpstreamRequest{
+			Method: r.Method,
+			Path:   trimRequestPathToOpenAIRoot(upstreamPath(r.URL.Path)),
+			Body:   upstreamBody,
+		},
+	}
+
+	if model != nil {
+		modelID, err := model.ID()
+		if err != nil {
+			http.Error(w, "model unavailable", http.StatusInternalServerError)
+			return
+		}
+		response.ModelID = modelID
+
+		// Check the request against the context length the runner would use.
+		if config, err := model.Config(); err == nil {
+			runnerConfig := withContextSizeOverride(s.loader.runnerConfig(r.Context(), backend.Name(), modelID, mode), contextSize)
+			response.ContextWindow = contextWindowForRunner(backend, config, runnerConfig)
+		}
+		if err := checkContextLength(result, response.ContextWindow); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if window := response.ContextWindow; window != nil && result.estimatedPromptTokens+result.maxTokens > *window {
+			response.Warnings = append(response.Warnings, fmt.Sprintf(
+				"the prompt (roughly %d tokens) and max_tokens may exceed the context length of %d tokens",
+				result.estimatedPromptTokens, *window,
+			))
+		}
+
+		if err := s.modelManager.CheckComplete(modelID); errors.Is(err, models.ErrModelIncomplete) {
+			response.Warnings = append(response.Warnings, err.Error())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.log.Warnf("Failed to encode dry run response: %v", err)
+	}
+}
+
+// contextWindowForRunner returns the context length in tokens that a runner
+// for the model would use, or nil if it's unknown.
+func contextWindowForRunner(backend inference.Backend, config types.Config, runnerConfig *inference.BackendConfiguration) *uint64 {
+	if backend.Name() == llamacpp.Name {
+		contextSize := llamacpp.GetContextSize(config, runnerConfig)
+		return &contextSize
+	}
+	if runnerConfig != nil && runnerConfig.ContextSize > 0 {
+		contextSize := uint64(runnerConfig.ContextSize)
+		return &contextSize
+	}
+	return models.ContextWindow(config)
+}
+
+// checkContextLength checks that the number of tokens requested for
+// generation doesn't exceed the context length, if known.
+func checkContextLength(result validationResult, contextWindow *uint64) error {
+	if contextWindow == nil || result.maxTokens <= *contextWindow {
+		return nil
+	}
+	return invalidf("max_tokens (%d) exceeds the model's context length of %d tokens", result.maxTokens, *contextWindow)
+}
@@ -8,3 +8,13 @@ import (
 // returned in conjunction with an HTTP request, it should be paired with a
 // 404 response status.
 var ErrBackendNotFound = errors.New("backend not found")
+
+// ErrUnsupportedCapability indicates that a request relies on a capability
+// that the target model doesn't support. If returned in conjunction with an
+// HTTP request, it should be paired with a 400 response status.
+var ErrUnsupportedCapability = errors.New("unsupported model capability")
+
+// ErrMaintenance indicates that a request couldn't be admitted because
+// maintenance is in progress. If returned in conjunction with an HTTP request,
+// it should be paired with a 503 response status.
+var ErrMaintenance = errors.New("model runner is under maintenance")
@@ -0,0 +1,70 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/model-runner/pkg/inference/backends/mock"
+)
+
+// SetFixtureStore enables recording fixtures from recorded requests into
+// store, so that responses of real models can be replayed by the mock
+// backend.
+func (s *Scheduler) SetFixtureStore(store *mock.FixtureStore) {
+	s.fixtures = store
+}
+
+// GetFixtures lists the recorded fixtures.
+func (s *Scheduler) GetFixtures(w http.ResponseWriter, _ *http.Request) {
+	if s.fixtures == nil {
+		http.Error(w, "fixtures are not enabled", http.StatusNotFound)
+		return
+	}
+	fixtures, err := s.fixtures.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if fixtures == nil {
+		fixtures = []*mock.Fixture{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fixtures); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// RecordFixtures turns the successful recorded requests for the model in the
+// "model" query parameter, or for all models if it's omitted, into fixtures.
+func (s *Scheduler) RecordFixtures(w http.ResponseWriter, r *http.Request) {
+	if s.fixtures == nil {
+		http.Error(w, "fixtures are not enabled", http.StatusNotFound)
+		return
+	}
+	response := RecordFixturesResponse{Recorded: []string{}}
+	for _, record := range s.openAIRecorder.Records(r.URL.Query().Get("model")) {
+		if record.StatusCode != http.StatusOK || record.Request == "" || record.Response == "" {
+			response.Skipped++
+			continue
+		}
+		fixture, err := mock.NewFixture(record.Model, record.URL, []byte(record.Request), []byte(record.Response))
+		if err != nil {
+			response.Skipped++
+			continue
+		}
+		if err := s.fixtures.Save(fixture); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Recorded = append(response.Recorded, fixture.Key)
+	}
+	s.log.Infof("Recorded %d fixtures, skipped %d requests", len(response.Recorded), response.Skipped)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,434 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// grammarParser checks the syntax of GBNF grammars, following the parser used
+// by llama.cpp, so that invalid grammars can be rejected without a backend.
+type grammarParser struct {
+	// src is the grammar source.
+	src string
+	// pos is the current parsing position.
+	pos int
+	// defined is the set of defined rule names.
+	defined map[string]bool
+	// referenced is the set of referenced rule names.
+	referenced []string
+}
+
+// checkGrammar checks that a GBNF grammar is syntactically valid, defines a
+// root rule, and only references rules that it defines.
+func checkGrammar(grammar string) error {
+	p := &grammarParser{src: grammar, defined: make(map[string]bool)}
+	p.space(true)
+	for p.pos < len(p.src) {
+		if err := p.rule(); err != nil {
+			return err
+		}
+		p.space(true)
+	}
+	if !p.defined["root"] {
+		return errors.New("grammar does not define a root rule")
+	}
+	for _, name := range p.referenced {
+		if !p.defined[name] {
+			return fmt.Errorf("undefined rule %q", name)
+		}
+	}
+	return nil
+}
+
+// errorf returns a parse error at the current position.
+func (p *grammarParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s at offset %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+// peek returns the current character, or 0 at the end of the input.
+func (p *grammarParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// space skips whitespace and comments. Newlines are only skipped if
+// newlineOK is true.
+func (p *grammarParser) space(newlineOK bool) {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\r' && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case (c == '\r' || c == '\n') && newlineOK:
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// isWordChar returns whether c can appear in a rule name.
+func isWordChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-'
+}
+
+// name parses a rule name.
+func (p *grammarParser) name() string {
+	start := p.pos
+	for p.pos < len(p.src) && isWordChar(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// rule parses a rule definition.
+func (p *grammarParser) rule() error {
+	name := p.name()
+	if name == "" {
+		return p.errorf("expecting rule name")
+	}
+	p.space(false)
+	if !strings.HasPrefix(p.src[p.pos:], "::=") {
+		return p.errorf("expecting ::=")
+	}
+	p.pos += len("::=")
+	p.space(true)
+	if err := p.alternates(false); err != nil {
+		return err
+	}
+	if p.peek() == '\r' {
+		p.pos++
+	}
+	if p.peek() == '\n' {
+		p.pos++
+	} else if p.pos < len(p.src) {
+		return p.errorf("expecting newline or end")
+	}
+	p.defined[name] = true
+	return nil
+}
+
+// alternates parses a set of alternative sequences.
+func (p *grammarParser) alternates(nested bool) error {
+	if err := p.sequence(nested); err != nil {
+		return err
+	}
+	for p.peek() == '|' {
+		p.pos++
+		p.space(true)
+		if err := p.sequence(nested); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sequence parses a sequence of (possibly repeated) elements.
+func (p *grammarParser) sequence(nested bool) error {
+	hasElement := false
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '"':
+			if err := p.literal(); err != nil {
+				return err
+			}
+		case c == '[':
+			if err := p.class(); err != nil {
+				return err
+			}
+		case c == '(':
+			p.pos++
+			p.space(true)
+			if err := p.alternates(true); err != nil {
+				return err
+			}
+			if p.peek() != ')' {
+				return p.errorf("expecting ')'")
+			}
+			p.pos++
+		case c == '.':
+			p.pos++
+		case isWordChar(c):
+			p.referenced = append(p.referenced, p.name())
+		case c == '*' || c == '+' || c == '?':
+			if !hasElement {
+				return p.errorf("expecting preceding item to %c", c)
+			}
+			p.pos++
+		case c == '{':
+			if !hasElement {
+				return p.errorf("expecting preceding item to {")
+			}
+			if err := p.repetition(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		hasElement = true
+		p.space(nested)
+	}
+	return nil
+}
+
+// literal parses a string literal.
+func (p *grammarParser) literal() error {
+	p.pos++
+	for p.pos < len(p.src) && p.src[p.pos] != '"' {
+		if err := p.char(); err != nil {
+			return err
+		}
+	}
+	if p.pos >= len(p.src) {
+		return p.errorf("unexpected end of input in string literal")
+	}
+	p.pos++
+	return nil
+}
+
+// class parses a character class.
+func (p *grammarParser) class() error {
+	p.pos++
+	if p.peek() == '^' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && p.src[p.pos] != ']' {
+		if err := p.char(); err != nil {
+			return err
+		}
+		if p.peek() == '-' && p.pos+1 < len(p.src) && p.src[p.pos+1] != ']' {
+			p.pos++
+			if err := p.char(); err != nil {
+				return err
+			}
+		}
+	}
+	if p.pos >= len(p.src) {
+		return p.errorf("unexpected end of input in character class")
+	}
+	p.pos++
+	return nil
+}
+
+// char parses a (possibly escaped) character in a literal or class.
+func (p *grammarParser) char() error {
+	if p.src[p.pos] != '\\' {
+		p.pos++
+		return nil
+	}
+	p.pos++
+	digits := 0
+	switch p.peek() {
+	case 'x':
+		digits = 2
+	case 'u':
+		digits = 4
+	case 'U':
+		digits = 8
+	case 't', 'r', 'n', '\\', '"', '[', ']', '-':
+	default:
+		return p.errorf("unknown escape")
+	}
+	p.pos++
+	if p.pos+digits > len(p.src) {
+		return p.errorf("unexpected end of input in escape")
+	}
+	if _, err := strconv.ParseUint(p.src[p.pos:p.pos+digits], 16, 32); digits > 0 && err != nil {
+		return p.errorf("invalid hex escape")
+	}
+	p.pos += digits
+	return nil
+}
+
+// repetition parses a {m}, {m,}, or {m,n} repetition.
+func (p *grammarParser) repetition() error {
+	p.pos++
+	p.space(false)
+	digits := func() (int, bool) {
+		start := p.pos
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		n, err := strconv.Atoi(p.src[start:p.pos])
+		return n, err == nil
+	}
+	minimum, ok := digits()
+	if !ok {
+		return p.errorf("expecting an integer")
+	}
+	p.space(false)
+	if p.peek() == ',' {
+		p.pos++
+		p.space(false)
+		if p.peek() != '}' {
+			maximum, ok := digits()
+			if !ok {
+				return p.errorf("expecting an integer")
+			} else if maximum < minimum {
+				return p.errorf("invalid repetition range")
+			}
+			p.space(false)
+		}
+	}
+	if p.peek() != '}' {
+		return p.errorf("expecting '}'")
+	}
+	p.pos++
+	return nil
+}
+
+// jsonSchemaTypes are the valid JSON schema types.
+var jsonSchemaTypes = []string{"string", "number", "integer", "boolean", "object", "array", "null"}
+
+// checkJSONSchema checks that a JSON schema can be converted into a grammar
+// for constrained output. It checks the schema's structure and references,
+// along with the constraints that llama.cpp places on patterns.
+func checkJSONSchema(raw json.RawMessage) error {
+	var root any
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return errors.New("schema isn't valid JSON")
+	}
+	return checkSchemaNode(root, root, "#")
+}
+
+// checkSchemaNode checks a schema node at the specified location within root.
+func checkSchemaNode(root, node any, location string) error {
+	if _, ok := node.(bool); ok {
+		return nil
+	}
+	schema, ok := node.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s: schema must be an object or a boolean", location)
+	}
+
+	checkSchemas := func(keyword string, value any) error {
+		switch v := value.(type) {
+		case []any:
+			for i, item := range v {
+				if err := checkSchemaNode(root, item, fmt.Sprintf("%s/%s/%d", location, keyword, i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		case map[string]any:
+			for name, item := range v {
+				if err := checkSchemaNode(root, item, location+"/"+keyword+"/"+name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return fmt.Errorf("%s/%s: invalid value", location, keyword)
+	}
+
+	for keyword, value := range schema {
+		var err error
+		switch keyword {
+		case "type":
+			types, isArray := value.([]any)
+			if !isArray {
+				types = []any{value}
+			}
+			for _, t := range types {
+				if name, ok := t.(string); !ok || !slices.Contains(jsonSchemaTypes, name) {
+					err = fmt.Errorf("%s/type: unknown type %v", location, t)
+				}
+			}
+		case "properties", "patternProperties", "$defs", "definitions":
+			if _, ok := value.(map[string]any); !ok {
+				err = fmt.Errorf("%s/%s: must be an object", location, keyword)
+			} else {
+				err = checkSchemas(keyword, value)
+			}
+		case "anyOf", "oneOf", "allOf", "prefixItems":
+			if items, ok := value.([]any); !ok || len(items) == 0 {
+				err = fmt.Errorf("%s/%s: must be a non-empty array", location, keyword)
+			} else {
+				err = checkSchemas(keyword, value)
+			}
+		case "items":
+			if _, ok := value.([]any); ok {
+				err = checkSchemas(keyword, value)
+			} else {
+				err = checkSchemaNode(root, value, location+"/items")
+			}
+		case "additionalProperties", "additionalItems", "not", "contains", "propertyNames":
+			err = checkSchemaNode(root, value, location+"/"+keyword)
+		case "required":
+			names, ok := value.([]any)
+			for _, name := range names {
+				if _, isString := name.(string); !isString {
+					ok = false
+				}
+			}
+			if !ok {
+				err = fmt.Errorf("%s/required: must be an array of strings", location)
+			}
+		case "enum":
+			if values, ok := value.([]any); !ok || len(values) == 0 {
+				err = fmt.Errorf("%s/enum: must be a non-empty array", location)
+			}
+		case "minItems", "maxItems", "minLength", "maxLength", "minProperties", "maxProperties":
+			if n, ok := value.(float64); !ok || n < 0 || n != float64(int64(n)) {
+				err = fmt.Errorf("%s/%s: must be a non-negative integer", location, keyword)
+			}
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			if _, ok := value.(float64); !ok {
+				err = fmt.Errorf("%s/%s: must be a number", location, keyword)
+			}
+		case "pattern":
+			if pattern, ok := value.(string); !ok || !strings.HasPrefix(pattern, "^") || !strings.HasSuffix(pattern, "$") {
+				err = fmt.Errorf("%s/pattern: must be a string starting with '^' and ending with '$'", location)
+			}
+		case "$ref":
+			ref, ok := value.(string)
+			if !ok {
+				err = fmt.Errorf("%s/$ref: must be a string", location)
+			} else if _, resolveErr := resolveSchemaRef(root, ref); resolveErr != nil {
+				err = fmt.Errorf("%s/$ref: %w", location, resolveErr)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveSchemaRef resolves a local JSON schema reference (e.g.
+// "#/$defs/item") within root.
+func resolveSchemaRef(root any, ref string) (any, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference %q (only local references are supported)", ref)
+	}
+	node := root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch v := node.(type) {
+		case map[string]any:
+			child, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("unresolved reference %q", ref)
+			}
+			node = child
+		case []any:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("unresolved reference %q", ref)
+			}
+			node = v[index]
+		default:
+			return nil, fmt.Errorf("unresolved reference %q", ref)
+		}
+	}
+	return node, nil
+}
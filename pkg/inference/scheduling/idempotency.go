@@ -0,0 +1,217 @@
+package scheduling
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// maximumIdempotencyEntries is the maximum number of idempotency keys
+	// whose responses are cached. The oldest entries are evicted first.
+	maximumIdempotencyEntries = 256
+	// maximumIdempotentResponseSize is the maximum size of a response body
+	// that's cached for replay. Larger responses aren't cached.
+	maximumIdempotentResponseSize = 1 << 20
+	// idempotencyKeyTTL is the duration for which a cached response is
+	// replayed.
+	idempotencyKeyTTL = time.Hour
+	// maximumIdempotencyKeyLength is the maximum length of an idempotency key.
+	maximumIdempotencyKeyLength = 255
+)
+
+var (
+	// errIdempotencyKeyInUse indicates that an idempotency key is in use by a
+	// request that's in progress. If returned in conjunction with an HTTP
+	// request, it should be paired with a 409 response status.
+	errIdempotencyKeyInUse = errors.New("a request with this idempotency key is in progress")
+	// errIdempotencyKeyMismatch indicates that an idempotency key was
+	// previously used for a different request. If returned in conjunction with
+	// an HTTP request, it should be paired with a 422 response status.
+	errIdempotencyKeyMismatch = errors.New("idempotency key was used for a different request")
+)
+
+// idempotentResponse is a cached response to a request with an idempotency
+// key.
+type idempotentResponse struct {
+	// fingerprint identifies the request that produced the response.
+	fingerprint [sha256.Size]byte
+	// created is the time at which the request was first received.
+	created time.Time
+	// complete indicates whether the response has been generated. Incomplete
+	// entries reserve the key for a request that's in progress.
+	complete bool
+	// statusCode is the response status code.
+	statusCode int
+	// header is the response header.
+	header http.Header
+	// body is the response body.
+	body []byte
+}
+
+// idempotencyCache is a bounded cache of responses keyed by idempotency key.
+type idempotencyCache struct {
+	// m protects the fields below.
+	m sync.Mutex
+	// entries maps idempotency keys to their responses.
+	entries map[string]*idempotentResponse
+	// order is the list of idempotency keys in insertion order.
+	order []string
+}
+
+// newIdempotencyCache creates a new idempotency cache.
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{entries: make(map[string]*idempotentResponse)}
+}
+
+// requestFingerprint computes a fingerprint for an inference request, so that
+// reuse of an idempotency key for a different request can be detected.
+func requestFingerprint(r *http.Request, body []byte) [sha256.Size]byte {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	var fingerprint [sha256.Size]byte
+	hash.Sum(fingerprint[:0])
+	return fingerprint
+}
+
+// reserve looks up the response for an idempotency key. If there's no entry,
+// the key is reserved for the request and nil is returned, in which case the
+// caller must complete or abandon the reservation. Otherwise, the cached
+// response is returned, or an error if the key is in use by a request in
+// progress or was used for a different request.
+func (c *idempotencyCache) reserve(key string, fingerprint [sha256.Size]byte) (*idempotentResponse, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.evictExpired()
+	if entry, ok := c.entries[key]; ok {
+		if entry.fingerprint != fingerprint {
+			return nil, errIdempotencyKeyMismatch
+		}
+		if !entry.complete {
+			return nil, errIdempotencyKeyInUse
+		}
+		return entry, nil
+	}
+
+	// Evict the oldest completed entries to make room. Reservations for
+	// requests in progress are only evicted once they complete.
+	for len(c.entries) >= maximumIdempotencyEntries {
+		index := slices.IndexFunc(c.order, func(key string) bool {
+			return c.entries[key].complete
+		})
+		if index < 0 {
+			break
+		}
+		delete(c.entries, c.order[index])
+		c.order = slices.Delete(c.order, index, index+1)
+	}
+	c.entries[key] = &idempotentResponse{fingerprint: fingerprint, created: time.Now()}
+	c.order = append(c.order, key)
+	return nil, nil
+}
+
+// evictExpired removes expired entries. The caller must hold the cache lock.
+func (c *idempotencyCache) evictExpired() {
+	expired := 0
+	for _, key := range c.order {
+		entry := c.entries[key]
+		if !entry.complete || time.Since(entry.created) < idempotencyKeyTTL {
+			break
+		}
+		delete(c.entries, key)
+		expired++
+	}
+	c.order = c.order[expired:]
+}
+
+// complete stores the response for a reserved idempotency key. Only complete,
+// successful responses are cached, so that failed requests (and requests whose
+// context was canceled, which may have truncated responses) can be retried.
+func (c *idempotencyCache) complete(ctx context.Context, key string, w *idempotencyRecorder) {
+	if ctx.Err() != nil || w.statusCode == 0 || w.statusCode >= http.StatusBadRequest || w.overflowed {
+		c.abandon(key)
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if entry, ok := c.entries[key]; ok {
+		entry.complete = true
+		entry.statusCode = w.statusCode
+		entry.header = w.Header().Clone()
+		entry.body = w.body.Bytes()
+	}
+}
+
+// abandon releases the reservation of an idempotency key.
+func (c *idempotencyCache) abandon(key string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if entry, ok := c.entries[key]; ok && !entry.complete {
+		delete(c.entries, key)
+		c.order = slices.DeleteFunc(c.order, func(other string) bool {
+			return other == key
+		})
+	}
+}
+
+// replay writes a cached response.
+func (r *idempotentResponse) replay(w http.ResponseWriter) {
+	for name, values := range r.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(r.statusCode)
+	w.Write(r.body)
+}
+
+// idempotencyRecorder is a response writer that captures a response for
+// replay.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	// statusCode is the response status code.
+	statusCode int
+	// body is the captured response body.
+	body bytes.Buffer
+	// overflowed indicates whether the response body exceeded the maximum
+	// size that's cached.
+	overflowed bool
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (w *idempotencyRecorder) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter.Write.
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	if !w.overflowed {
+		if w.body.Len()+len(data) > maximumIdempotentResponseSize {
+			w.overflowed = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(data)
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush implements http.Flusher.Flush.
+func (w *idempotencyRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
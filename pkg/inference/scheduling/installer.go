@@ -138,3 +138,18 @@ func (i *installer) wait(ctx context.Context, backend string) error {
 		return status.err
 	}
 }
+
+// failed returns whether installation of the specified backend failed. It
+// doesn't wait for installation to complete.
+func (i *installer) failed(backend string) bool {
+	status, ok := i.statuses[backend]
+	if !ok {
+		return true
+	}
+	select {
+	case <-status.failed:
+		return true
+	default:
+		return false
+	}
+}
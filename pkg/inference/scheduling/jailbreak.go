@@ -0,0 +1,91 @@
+package scheduling
+
+import (
+	"fmt"
+
+	"github.com/docker/model-runner/pkg/inference/jailbreak"
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/metrics"
+)
+
+// JailbreakAction is what happens to requests whose prompts score at or above
+// the jailbreak policy's threshold.
+type JailbreakAction string
+
+const (
+	// JailbreakLog logs the request's score and signals.
+	JailbreakLog JailbreakAction = "log"
+	// JailbreakFlag logs the request and flags it in its record.
+	JailbreakFlag JailbreakAction = "flag"
+	// JailbreakBlock rejects the request.
+	JailbreakBlock JailbreakAction = "block"
+)
+
+// DefaultJailbreakThreshold is the default score at or above which the
+// jailbreak policy's action is taken.
+const DefaultJailbreakThreshold = 0.5
+
+// JailbreakPolicy configures the scoring of incoming prompts for prompt
+// injection and jailbreak attempts. Prompts aren't scored unless Action is
+// set.
+type JailbreakPolicy struct {
+	// Action is what happens to requests scoring at or above Threshold.
+	Action JailbreakAction
+	// Threshold is the score, between 0 and 1, at or above which Action is
+	// taken. A zero value means DefaultJailbreakThreshold.
+	Threshold float64
+}
+
+// normalize validates the policy and fills in its defaults.
+func (p *JailbreakPolicy) normalize() error {
+	switch p.Action {
+	case "", JailbreakLog, JailbreakFlag, JailbreakBlock:
+	default:
+		return fmt.Errorf("invalid jailbreak action %q, expected %q, %q, or %q", p.Action, JailbreakLog, JailbreakFlag, JailbreakBlock)
+	}
+	if p.Threshold < 0 || p.Threshold > 1 {
+		return fmt.Errorf("invalid jailbreak threshold %g, expected a score between 0 and 1", p.Threshold)
+	}
+	if p.Threshold == 0 {
+		p.Threshold = DefaultJailbreakThreshold
+	}
+	return nil
+}
+
+// SetJailbreakPolicy sets the policy for scoring incoming prompts for
+// jailbreak attempts. It applies to requests received afterwards.
+func (s *Scheduler) SetJailbreakPolicy(policy JailbreakPolicy) error {
+	if err := policy.normalize(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.jailbreak = policy
+	return nil
+}
+
+// scoreJailbreak scores the prompt of a request body according to the
+// jailbreak policy. It returns the record to attach to the request, if the
+// prompt was scored, and whether the request must be blocked.
+func (s *Scheduler) scoreJailbreak(model string, body []byte) (*metrics.JailbreakRecord, bool) {
+	s.lock.RLock()
+	policy := s.jailbreak
+	s.lock.RUnlock()
+	if policy.Action == "" {
+		return nil, false
+	}
+	prompt := requestPrompt(body)
+	if prompt == "" {
+		return nil, false
+	}
+
+	result := jailbreak.Score(prompt)
+	record := &metrics.JailbreakRecord{Score: result.Score, Categories: result.Categories()}
+	if result.Score < policy.Threshold {
+		return record, false
+	}
+	s.log.Warnf("Prompt for %s scored %.2f for jailbreak categories %v, action %q",
+		utils.SanitizeForLog(model), result.Score, record.Categories, policy.Action)
+	record.Flagged = policy.Action == JailbreakFlag || policy.Action == JailbreakBlock
+	return record, policy.Action == JailbreakBlock
+}
@@ -0,0 +1,271 @@
+package scheduling
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference/postprocess"
+)
+
+// jsonRepairStrategy is a strategy for repairing structured outputs that
+// aren't valid JSON, requested by the json_repair extension field of chat
+// completion requests.
+type jsonRepairStrategy string
+
+const (
+	// jsonRepairNone leaves invalid output as-is.
+	jsonRepairNone jsonRepairStrategy = ""
+	// jsonRepairFix repairs invalid output with a deterministic fixer.
+	jsonRepairFix jsonRepairStrategy = "fix"
+	// jsonRepairReask repairs invalid output with a deterministic fixer,
+	// falling back to asking the model once to correct its output, which is
+	// constrained by the request's response_format.
+	jsonRepairReask jsonRepairStrategy = "reask"
+)
+
+// jsonReaskInstructions are the instructions with which models are asked to
+// correct invalid JSON output.
+const jsonReaskInstructions = "Your previous response was not valid JSON (%v). Reply with only the corrected JSON."
+
+// parseJSONRepair parses the json_repair field of a chat completion request,
+// returning the requested strategy and the request body without the field.
+// The field requires a JSON response_format and a non-streaming request.
+func parseJSONRepair(body []byte) (jsonRepairStrategy, []byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return jsonRepairNone, body, nil
+	}
+	raw, ok := fields["json_repair"]
+	if !ok {
+		return jsonRepairNone, body, nil
+	}
+	var strategy jsonRepairStrategy
+	if err := json.Unmarshal(raw, &strategy); err != nil {
+		return jsonRepairNone, nil, errors.New("json_repair must be a string")
+	}
+	switch strategy {
+	case jsonRepairNone, jsonRepairFix, jsonRepairReask:
+	default:
+		return jsonRepairNone, nil, fmt.Errorf("json_repair must be %q or %q", jsonRepairFix, jsonRepairReask)
+	}
+	if strategy != jsonRepairNone {
+		var request struct {
+			Stream         bool `json:"stream"`
+			ResponseFormat struct {
+				Type string `json:"type"`
+			} `json:"response_format"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return jsonRepairNone, nil, errors.New("invalid request")
+		}
+		if request.ResponseFormat.Type != "json_object" && request.ResponseFormat.Type != "json_schema" {
+			return jsonRepairNone, nil, errors.New("json_repair requires a json_object or json_schema response_format")
+		}
+		if request.Stream {
+			return jsonRepairNone, nil, errors.New("json_repair isn't supported for streaming requests")
+		}
+	}
+	delete(fields, "json_repair")
+	stripped, err := json.Marshal(fields)
+	if err != nil {
+		return jsonRepairNone, nil, fmt.Errorf("unable to encode request: %w", err)
+	}
+	return strategy, stripped, nil
+}
+
+// jsonRepair describes the repair of a choice's output. Repairs are listed in
+// the json_repair field of responses.
+type jsonRepair struct {
+	// Index is the index of the repaired choice.
+	Index int `json:"index"`
+	// Method is the method by which the output was repaired.
+	Method jsonRepairStrategy `json:"method"`
+}
+
+// repairJSON repairs invalid JSON output using the deterministic fixer. It
+// returns an error describing why output can't be parsed if it can't be
+// repaired.
+func repairJSON(content string) (string, error) {
+	var value any
+	err := json.Unmarshal([]byte(content), &value)
+	if err == nil {
+		return content, nil
+	}
+	repaired := postprocess.RepairJSON(postprocess.StripFences(content))
+	if !json.Valid([]byte(repaired)) {
+		return "", err
+	}
+	return repaired, nil
+}
+
+// jsonRepairWriter is a responseConverter that repairs the invalid JSON
+// outputs of a non-streaming chat completion response. Responses whose
+// outputs can't be repaired are replaced with an error.
+type jsonRepairWriter struct {
+	http.ResponseWriter
+	// strategy is the repair strategy.
+	strategy jsonRepairStrategy
+	// reask asks the model to correct invalid output, returning the
+	// corrected output.
+	reask func(content string, parseErr error) (string, error)
+	// statusCode is the response status code, which is only written once the
+	// response has been repaired.
+	statusCode int
+	// buffer holds the response body.
+	buffer bytes.Buffer
+}
+
+// WriteHeader implements net/http.ResponseWriter.WriteHeader.
+func (w *jsonRepairWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	if statusCode != http.StatusOK {
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+// Write implements net/http.ResponseWriter.Write.
+func (w *jsonRepairWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.statusCode != http.StatusOK {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buffer.Write(b)
+}
+
+// Flush implements net/http.Flusher.Flush. Responses are buffered, so it's a
+// no-op.
+func (w *jsonRepairWriter) Flush() {}
+
+// Finish implements responseConverter.Finish.
+func (w *jsonRepairWriter) Finish() error {
+	if w.statusCode != http.StatusOK {
+		return nil
+	}
+	body, err := w.repairResponse(w.buffer.Bytes())
+	w.buffer.Reset()
+	w.Header().Del("Content-Length")
+	if err != nil {
+		http.Error(w.ResponseWriter, err.Error(), http.StatusBadGateway)
+		return nil
+	}
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+	_, err = w.ResponseWriter.Write(body)
+	return err
+}
+
+// repairResponse repairs the outputs of a chat completion response, returning
+// an error if an output can't be repaired. Responses that can't be parsed are
+// returned unmodified.
+func (w *jsonRepairWriter) repairResponse(body []byte) ([]byte, error) {
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body, nil
+	}
+	choices, ok := response["choices"].([]any)
+	if !ok {
+		return body, nil
+	}
+
+	var repairs []jsonRepair
+	for i, c := range choices {
+		choice, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		message, ok := choice["message"].(map[string]any)
+		if !ok {
+			continue
+		}
+		content, ok := message["content"].(string)
+		if !ok || json.Valid([]byte(content)) {
+			continue
+		}
+		index := i
+		if value, ok := choice["index"].(float64); ok {
+			index = int(value)
+		}
+
+		method := jsonRepairFix
+		repaired, err := repairJSON(content)
+		if err != nil && w.strategy == jsonRepairReask {
+			method = jsonRepairReask
+			var reasked string
+			if reasked, err = w.reask(content, err); err == nil {
+				repaired, err = repairJSON(reasked)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("choices[%d]: model output isn't valid JSON: %v", index, err)
+		}
+		message["content"] = repaired
+		repairs = append(repairs, jsonRepair{Index: index, Method: method})
+	}
+	if len(repairs) == 0 {
+		return body, nil
+	}
+
+	response["json_repair"] = repairs
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode repaired response: %w", err)
+	}
+	return rewritten, nil
+}
+
+// reaskJSON asks a model to correct its invalid JSON output to a chat
+// completion request, by replaying the request with the output and
+// correction instructions appended to its conversation. The request's
+// response_format constrains the corrected output.
+func (s *Scheduler) reaskJSON(r *http.Request, body []byte, content string, parseErr error) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", fmt.Errorf("invalid request: %w", err)
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(fields["messages"], &messages); err != nil {
+		return "", fmt.Errorf("invalid messages: %w", err)
+	}
+	for _, message := range []map[string]string{
+		{"role": "assistant", "content": content},
+		{"role": "user", "content": fmt.Sprintf(jsonReaskInstructions, parseErr)},
+	} {
+		encoded, err := json.Marshal(message)
+		if err != nil {
+			return "", err
+		}
+		messages = append(messages, encoded)
+	}
+	encoded, err := json.Marshal(messages)
+	if err != nil {
+		return "", err
+	}
+	fields["messages"] = encoded
+	fields["n"] = json.RawMessage("1")
+	reaskBody, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+
+	recorder := &bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}
+	s.ServeHTTP(recorder, newInternalRequest(r, r.URL.Path, reaskBody))
+	if recorder.statusCode != http.StatusOK {
+		return "", fmt.Errorf("re-ask request failed with status %d: %s", recorder.statusCode, strings.TrimSpace(recorder.body.String()))
+	}
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(recorder.body.Bytes(), &response); err != nil || len(response.Choices) == 0 {
+		return "", errors.New("invalid re-ask response")
+	}
+	return response.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,96 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONRepair(t *testing.T) {
+	strategy, body, err := parseJSONRepair([]byte(`{"model":"m","response_format":{"type":"json_object"},"json_repair":"reask"}`))
+	if err != nil || strategy != jsonRepairReask || strings.Contains(string(body), "json_repair") {
+		t.Errorf("Unexpected result %q, %s (%v)", strategy, body, err)
+	}
+	original := []byte(`{"model":"m"}`)
+	if strategy, body, err := parseJSONRepair(original); err != nil || strategy != jsonRepairNone || string(body) != string(original) {
+		t.Errorf("Expected requests without json_repair to be unmodified, got %q, %s (%v)", strategy, body, err)
+	}
+	for _, invalid := range []string{
+		`{"json_repair":"fix"}`,
+		`{"json_repair":"fix","response_format":{"type":"text"}}`,
+		`{"json_repair":"fix","response_format":{"type":"json_object"},"stream":true}`,
+		`{"json_repair":"retry","response_format":{"type":"json_object"}}`,
+		`{"json_repair":true,"response_format":{"type":"json_object"}}`,
+	} {
+		if _, _, err := parseJSONRepair([]byte(invalid)); err == nil {
+			t.Errorf("Expected error for %s", invalid)
+		}
+	}
+}
+
+func TestJSONRepairWriter(t *testing.T) {
+	serve := func(strategy jsonRepairStrategy, reask func(string, error) (string, error), contents ...string) *httptest.ResponseRecorder {
+		choices := make([]map[string]any, len(contents))
+		for i, content := range contents {
+			choices[i] = map[string]any{"index": i, "message": map[string]any{"role": "assistant", "content": content}}
+		}
+		body, _ := json.Marshal(map[string]any{"object": "chat.completion", "choices": choices})
+		recorder := httptest.NewRecorder()
+		w := &jsonRepairWriter{ResponseWriter: recorder, strategy: strategy, reask: reask}
+		w.Header().Set("Content-Length", "1")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+		if err := w.Finish(); err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		return recorder
+	}
+	var reasked []string
+	reask := func(content string, parseErr error) (string, error) {
+		reasked = append(reasked, content)
+		if content == "broken" {
+			return `{"fixed": true}`, nil
+		}
+		return "", errors.New("failed")
+	}
+
+	recorder := serve(jsonRepairReask, reask, `{"valid": true}`, "```json\n{\"a\": [1,\n```", "broken")
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		JSONRepair []jsonRepair `json:"json_repair"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response %s: %v", recorder.Body.String(), err)
+	}
+	if response.Choices[0].Message.Content != `{"valid": true}` || response.Choices[1].Message.Content != `{"a": [1]}` ||
+		response.Choices[2].Message.Content != `{"fixed": true}` {
+		t.Errorf("Unexpected choices %+v", response.Choices)
+	}
+	if len(response.JSONRepair) != 2 || response.JSONRepair[0] != (jsonRepair{Index: 1, Method: jsonRepairFix}) ||
+		response.JSONRepair[1] != (jsonRepair{Index: 2, Method: jsonRepairReask}) {
+		t.Errorf("Unexpected repairs %+v", response.JSONRepair)
+	}
+	if len(reasked) != 1 || recorder.Header().Get("Content-Length") != "" {
+		t.Errorf("Expected only unfixable output to be re-asked, got %v", reasked)
+	}
+
+	// Valid responses are unmodified.
+	if recorder := serve(jsonRepairFix, nil, `{}`); strings.Contains(recorder.Body.String(), "json_repair") {
+		t.Errorf("Unexpected response %s", recorder.Body.String())
+	}
+
+	// Outputs that can't be repaired are replaced with an error.
+	if recorder := serve(jsonRepairFix, nil, "broken"); recorder.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", recorder.Code)
+	}
+	if recorder := serve(jsonRepairReask, reask, "unrepairable"); recorder.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502 after a failed re-ask, got %d", recorder.Code)
+	}
+}
@@ -7,14 +7,19 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"slices"
 	"time"
 
 	"github.com/docker/model-runner/pkg/environment"
 	"github.com/docker/model-runner/pkg/inference"
 	"github.com/docker/model-runner/pkg/inference/memory"
 	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/internal/utils"
 	"github.com/docker/model-runner/pkg/logging"
 	"github.com/docker/model-runner/pkg/metrics"
+	"github.com/docker/model-runner/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -37,6 +42,9 @@ var (
 	// errRunnerAlreadyActive indicates that a given runner is already active
 	// and therefore can't be reconfigured for example
 	errRunnerAlreadyActive = errors.New("runner already active")
+	// errInvalidReplicas indicates that a requested replica count is out of
+	// range.
+	errInvalidReplicas = errors.New("invalid replica count")
 )
 
 // runnerKey is used to index runners.
@@ -49,6 +57,12 @@ type runnerKey struct {
 	draftModelID string
 	// mode is the operation mode associated with the runner.
 	mode inference.BackendMode
+	// contextSize is the context size requested by the requests that the
+	// runner serves, or zero if the runner uses the configured context size.
+	contextSize uint64
+	// replica is the index of the runner among the replicas of the same
+	// configuration.
+	replica int
 }
 
 // makeConfigKey creates a runnerKey for configuration storage.
@@ -81,6 +95,9 @@ type runnerInfo struct {
 	slot int
 	// modelRef is the original model reference (tag) used to load the runner.
 	modelRef string
+	// fittedContextSize is the context size to which the runner's context
+	// was reduced to fit in memory, if any.
+	fittedContextSize uint64
 }
 
 // loader manages the loading and unloading of backend runners. It regulates
@@ -95,8 +112,9 @@ type loader struct {
 	backends map[string]inference.Backend
 	// modelManager is the shared model manager.
 	modelManager *models.Manager
-	// runnerIdleTimeout is the loader-specific default runner idle timeout.
-	runnerIdleTimeout time.Duration
+	// baseRunnerIdleTimeout is the loader-specific default runner idle
+	// timeout, which applies unless the profile overrides it.
+	baseRunnerIdleTimeout time.Duration
 	// totalMemory is the total system memory allocated to the loader.
 	totalMemory inference.RequiredMemory
 	// idleCheck is used to signal the run loop when timestamps have updated.
@@ -128,6 +146,39 @@ type loader struct {
 	timestamps []time.Time
 	// runnerConfigs maps model names to runner configurations
 	runnerConfigs map[runnerKey]inference.BackendConfiguration
+	// runnerDefaults holds the context size and parallelism used by runners
+	// whose configurations don't specify them.
+	runnerDefaults inference.BackendConfiguration
+	// runnerIdleTimeout is the runner idle timeout.
+	runnerIdleTimeout time.Duration
+	// loadLimits are the limits on concurrent runner startups.
+	loadLimits LoadLimits
+	// startups maps slot indices to the runner startups in progress. Runners
+	// that are starting are registered (and hold a reference), but aren't
+	// returned to other loaders until they're ready.
+	startups map[int]*loadProgress
+	// queuedLoads maps the polling channels of loads that are waiting for the
+	// load limits to permit a startup to their progress.
+	queuedLoads map[chan<- struct{}]*loadProgress
+	// stale is the set of slot indices whose runners should be retired, e.g.
+	// because they're using an outdated version of a mounted model or exceed
+	// the desired replica count. Stale runners aren't returned to loaders and
+	// are evicted once they're unused.
+	stale map[int]bool
+	// prefetched is the set of slot indices whose runners were started
+	// speculatively and haven't been used yet.
+	prefetched map[int]bool
+	// replicas maps configuration keys to the desired (i.e. maximum) number
+	// of runner replicas. Configurations without an entry have one replica.
+	replicas map[runnerKey]int
+	// waiting maps the polling channels of loads that have waited for a
+	// runner to the time at which they started waiting.
+	waiting map[chan<- struct{}]time.Time
+	// averageWait is a moving average of the time that loads have waited for
+	// a runner.
+	averageWait time.Duration
+	// averageStartup is a moving average of runner startup durations.
+	averageStartup time.Duration
 	// openAIRecorder is used to record OpenAI API inference requests and responses.
 	openAIRecorder *metrics.OpenAIRecorder
 }
@@ -164,22 +215,30 @@ func newLoader(
 
 	// Create the loader.
 	l := &loader{
-		log:               log,
-		backends:          backends,
-		modelManager:      modelManager,
-		runnerIdleTimeout: runnerIdleTimeout,
-		totalMemory:       totalMemory,
-		idleCheck:         make(chan struct{}, 1),
-		guard:             make(chan struct{}, 1),
-		availableMemory:   totalMemory,
-		waiters:           make(map[chan<- struct{}]bool),
-		runners:           make(map[runnerKey]runnerInfo, nSlots),
-		slots:             make([]*runner, nSlots),
-		references:        make([]uint, nSlots),
-		allocations:       make([]inference.RequiredMemory, nSlots),
-		timestamps:        make([]time.Time, nSlots),
-		runnerConfigs:     make(map[runnerKey]inference.BackendConfiguration),
-		openAIRecorder:    openAIRecorder,
+		log:                   log,
+		backends:              backends,
+		modelManager:          modelManager,
+		baseRunnerIdleTimeout: runnerIdleTimeout,
+		runnerIdleTimeout:     runnerIdleTimeout,
+		totalMemory:           totalMemory,
+		idleCheck:             make(chan struct{}, 1),
+		guard:                 make(chan struct{}, 1),
+		availableMemory:       totalMemory,
+		waiters:               make(map[chan<- struct{}]bool),
+		runners:               make(map[runnerKey]runnerInfo, nSlots),
+		slots:                 make([]*runner, nSlots),
+		references:            make([]uint, nSlots),
+		allocations:           make([]inference.RequiredMemory, nSlots),
+		timestamps:            make([]time.Time, nSlots),
+		runnerConfigs:         make(map[runnerKey]inference.BackendConfiguration),
+		loadLimits:            defaultLoadLimits,
+		startups:              make(map[int]*loadProgress),
+		queuedLoads:           make(map[chan<- struct{}]*loadProgress),
+		stale:                 make(map[int]bool),
+		prefetched:            make(map[int]bool),
+		replicas:              make(map[runnerKey]int),
+		waiting:               make(map[chan<- struct{}]time.Time),
+		openAIRecorder:        openAIRecorder,
 	}
 	l.guard <- struct{}{}
 	return l
@@ -201,6 +260,40 @@ func (l *loader) unlock() {
 	l.guard <- struct{}{}
 }
 
+// availableVRAM returns the amount of VRAM not reserved by loaded runners. Its
+// second return value is false if the loader lock is currently held or if the
+// total VRAM size is unknown. Unlike most loader methods, it never blocks.
+func (l *loader) availableVRAM() (uint64, bool) {
+	select {
+	case <-l.guard:
+	default:
+		return 0, false
+	}
+	defer l.unlock()
+
+	if l.totalMemory.VRAM <= 1 {
+		return 0, false
+	}
+	return l.availableMemory.VRAM, true
+}
+
+// loadedModelIDs returns the set of model IDs for which a runner is currently
+// loaded. It returns nil if ctx is cancelled before the loader lock is acquired.
+func (l *loader) loadedModelIDs(ctx context.Context) map[string]bool {
+	if !l.lock(ctx) {
+		return nil
+	}
+	defer l.unlock()
+
+	loaded := make(map[string]bool, len(l.runners))
+	for key, info := range l.runners {
+		if _, starting := l.startups[info.slot]; !starting {
+			loaded[key.modelID] = true
+		}
+	}
+	return loaded
+}
+
 // broadcast signals all waiters. Callers must hold the loader lock.
 func (l *loader) broadcast() {
 	for waiter := range l.waiters {
@@ -229,6 +322,8 @@ func (l *loader) freeRunnerSlot(slot int, key runnerKey) {
 	l.availableMemory.VRAM += l.allocations[slot].VRAM
 	l.allocations[slot] = inference.RequiredMemory{RAM: 0, VRAM: 0}
 	l.timestamps[slot] = time.Time{}
+	delete(l.stale, slot)
+	delete(l.prefetched, slot)
 	delete(l.runners, key)
 }
 
@@ -288,6 +383,169 @@ func (l *loader) evictRunner(backend, model string, mode inference.BackendMode)
 	return len(l.runners)
 }
 
+// restartModel restarts the runners using the specified model, e.g. because
+// the model's file has been modified. Unused runners are evicted immediately,
+// while runners in use are marked as stale and evicted once released. New
+// runners are started with the model on next use.
+func (l *loader) restartModel(ctx context.Context, modelID string) {
+	if !l.lock(ctx) {
+		return
+	}
+	defer l.unlock()
+
+	for r, runnerInfo := range l.runners {
+		if r.modelID != modelID {
+			continue
+		}
+		if l.references[runnerInfo.slot] == 0 {
+			l.log.Infof("Restarting %s backend runner with model %s (%s) in %s mode",
+				r.backend, r.modelID, runnerInfo.modelRef, r.mode,
+			)
+			l.freeRunnerSlot(runnerInfo.slot, r)
+		} else {
+			l.stale[runnerInfo.slot] = true
+		}
+	}
+	l.broadcast()
+}
+
+// evictUnused evicts the unused runners whose model references satisfy
+// predicate and returns the number of runners evicted.
+func (l *loader) evictUnused(ctx context.Context, predicate func(modelRef string) bool) int {
+	if !l.lock(ctx) {
+		return 0
+	}
+	defer l.unlock()
+
+	evicted := 0
+	for r, runnerInfo := range l.runners {
+		if l.references[runnerInfo.slot] == 0 && predicate(runnerInfo.modelRef) {
+			l.log.Infof("Evicting %s backend runner with model %s (%s) in %s mode",
+				r.backend, r.modelID, runnerInfo.modelRef, r.mode,
+			)
+			l.freeRunnerSlot(runnerInfo.slot, r)
+			evicted++
+		}
+	}
+	if evicted > 0 {
+		l.broadcast()
+	}
+	return evicted
+}
+
+// replicasFor returns the keys of all registered replicas of the specified
+// runner configuration, where a non-zero context size identifies runners
+// serving requests with that context size. The caller must hold the loader
+// lock.
+func (l *loader) replicasFor(backendName, modelID, draftModelID string, mode inference.BackendMode, contextSize uint64) []runnerKey {
+	var replicas []runnerKey
+	for key := range l.runners {
+		if key.backend == backendName && key.modelID == modelID && key.draftModelID == draftModelID && key.mode == mode && key.contextSize == contextSize {
+			replicas = append(replicas, key)
+		}
+	}
+	return replicas
+}
+
+// nextReplica returns the lowest replica index that isn't registered for the
+// runner configuration identified by key. The caller must hold the loader
+// lock.
+func (l *loader) nextReplica(key runnerKey) int {
+	for replica := 0; ; replica++ {
+		key.replica = replica
+		if _, ok := l.runners[key]; !ok {
+			return replica
+		}
+	}
+}
+
+// desiredReplicas returns the desired number of replicas for the specified
+// backend, model, and mode. The caller must hold the loader lock.
+func (l *loader) desiredReplicas(backendName, modelID string, mode inference.BackendMode) int {
+	if replicas, ok := l.replicas[makeConfigKey(backendName, modelID, mode)]; ok {
+		return replicas
+	}
+	return 1
+}
+
+// availableVRAMForLoad returns the VRAM available for starting a runner. On
+// Windows, llamacpp can use up to half of system RAM as shared GPU memory if it
+// runs out of dedicated VRAM. The caller must hold the loader lock.
+func (l *loader) availableVRAMForLoad() uint64 {
+	availableVRAM := l.availableMemory.VRAM
+	if runtime.GOOS == "windows" {
+		sharedRAM := l.totalMemory.RAM / 2
+		if l.availableMemory.RAM < sharedRAM {
+			sharedRAM = l.availableMemory.RAM
+		}
+		availableVRAM += sharedRAM
+	}
+	return availableVRAM
+}
+
+// canStartWithoutEviction returns whether a runner requiring the specified
+// memory can be started immediately without evicting other runners. The
+// caller must hold the loader lock.
+func (l *loader) canStartWithoutEviction(memory inference.RequiredMemory, availableVRAM, loadBytes uint64) bool {
+	return memory.RAM <= l.availableMemory.RAM && memory.VRAM <= availableVRAM &&
+		len(l.runners) < len(l.slots) && l.startupPermitted(loadBytes)
+}
+
+// setReplicas sets the desired number of replicas for the specified backend,
+// model, and mode. Additional replicas are started on demand, when all
+// existing replicas are busy and there are sufficient resources. Surplus
+// replicas are evicted immediately if they're unused and once they're
+// released otherwise. It returns the number of replicas that remain loaded.
+func (l *loader) setReplicas(ctx context.Context, backendName, modelID string, mode inference.BackendMode, replicas int) (int, error) {
+	if replicas < 1 || replicas > len(l.slots) {
+		return 0, fmt.Errorf("%w: replica count must be between 1 and %d", errInvalidReplicas, len(l.slots))
+	}
+	if !l.lock(ctx) {
+		return 0, context.Canceled
+	}
+	defer l.unlock()
+
+	if replicas == 1 {
+		delete(l.replicas, makeConfigKey(backendName, modelID, mode))
+	} else {
+		l.replicas[makeConfigKey(backendName, modelID, mode)] = replicas
+	}
+	l.log.Infof("Scaling %s runners for %s in %s mode to %d replica(s)", backendName, modelID, mode, replicas)
+
+	// Retire the highest-indexed replicas beyond the desired count.
+	var active []runnerKey
+	for key, runnerInfo := range l.runners {
+		if key.backend == backendName && key.modelID == modelID && key.mode == mode && !l.stale[runnerInfo.slot] {
+			active = append(active, key)
+		}
+	}
+	slices.SortFunc(active, func(a, b runnerKey) int {
+		return a.replica - b.replica
+	})
+	for _, key := range active[min(replicas, len(active)):] {
+		runnerInfo := l.runners[key]
+		if l.references[runnerInfo.slot] == 0 {
+			l.freeRunnerSlot(runnerInfo.slot, key)
+		} else {
+			l.stale[runnerInfo.slot] = true
+		}
+	}
+	l.broadcast()
+	return min(replicas, len(active)), nil
+}
+
+// replicaCounts returns the number of loaded replicas for each configuration
+// key. The caller must hold the loader lock.
+func (l *loader) replicaCounts() map[runnerKey]int {
+	counts := make(map[runnerKey]int)
+	for key, runnerInfo := range l.runners {
+		if !l.stale[runnerInfo.slot] {
+			counts[makeConfigKey(key.backend, key.modelID, key.mode)]++
+		}
+	}
+	return counts
+}
+
 // Unload unloads runners and returns the number of unloaded runners.
 func (l *loader) Unload(ctx context.Context, unload UnloadRequest) int {
 	if !l.lock(ctx) {
@@ -308,10 +566,11 @@ func (l *loader) Unload(ctx context.Context, unload UnloadRequest) int {
 						delete(l.runnerConfigs, key)
 					}
 				}
-				// Evict both, completion and embedding models. We should consider
-				// accepting a mode parameter in unload requests.
+				// Evict completion, embedding, and classification models. We
+				// should consider accepting a mode parameter in unload requests.
 				l.evictRunner(unload.Backend, modelID, inference.BackendModeCompletion)
 				l.evictRunner(unload.Backend, modelID, inference.BackendModeEmbedding)
+				l.evictRunner(unload.Backend, modelID, inference.BackendModeClassification)
 			}
 			return len(l.runners)
 		}
@@ -431,18 +690,10 @@ func (l *loader) run(ctx context.Context) {
 	}
 }
 
-// load allocates a runner using the specified backend and modelID. If allocated,
-// it should be released by the caller using the release mechanism (once the
-// runner is no longer needed).
-func (l *loader) load(ctx context.Context, backendName, modelID, modelRef string, mode inference.BackendMode) (*runner, error) {
-	// Grab the backend.
-	backend, ok := l.backends[backendName]
-	if !ok {
-		return nil, ErrBackendNotFound
-	}
-
-	// Estimate the amount of memory that will be used by the model and check
-	// that we're even capable of loading it.
+// configFor returns the runner configuration for the specified backend,
+// model, and mode, along with the ID of its speculative decoding draft model,
+// if any.
+func (l *loader) configFor(backendName, modelID string, mode inference.BackendMode) (*inference.BackendConfiguration, string) {
 	var runnerConfig *inference.BackendConfiguration
 	draftModelID := ""
 	if rc, ok := l.runnerConfigs[makeConfigKey(backendName, modelID, mode)]; ok {
@@ -450,8 +701,8 @@ func (l *loader) load(ctx context.Context, backendName, modelID, modelRef string
 		if runnerConfig.Speculative != nil && runnerConfig.Speculative.DraftModel != "" {
 			draftModelID = l.modelManager.ResolveID(runnerConfig.Speculative.DraftModel)
 		}
-	} else if mode == inference.BackendModeReranking {
-		// For reranking mode, fallback to completion config if specific config is not found.
+	} else if mode == inference.BackendModeReranking || mode == inference.BackendModeClassification {
+		// For reranking and classification modes, fallback to completion config if specific config is not found.
 		if rc, ok := l.runnerConfigs[makeConfigKey(backendName, modelID, inference.BackendModeCompletion)]; ok {
 			runnerConfig = &rc
 			if runnerConfig.Speculative != nil && runnerConfig.Speculative.DraftModel != "" {
@@ -459,6 +710,108 @@ func (l *loader) load(ctx context.Context, backendName, modelID, modelRef string
 			}
 		}
 	}
+
+	// Use the draft model that the model bundles, unless one is configured.
+	if draftModelID == "" && mode == inference.BackendModeCompletion {
+		if draftModel := l.bundledDraftModel(modelID); draftModel != "" {
+			var merged inference.BackendConfiguration
+			if runnerConfig != nil {
+				merged = *runnerConfig
+			}
+			var speculative inference.SpeculativeDecodingConfig
+			if merged.Speculative != nil {
+				speculative = *merged.Speculative
+			}
+			speculative.DraftModel = draftModel
+			merged.Speculative = &speculative
+			runnerConfig = &merged
+			draftModelID = l.modelManager.ResolveID(draftModel)
+		}
+	}
+	return l.withRunnerDefaults(runnerConfig), draftModelID
+}
+
+// bundledDraftModel returns the reference of the draft model that a model
+// bundles for speculative decoding, if any and it's in the local store.
+func (l *loader) bundledDraftModel(modelID string) string {
+	if l.modelManager == nil {
+		return ""
+	}
+	model, err := l.modelManager.GetLocal(modelID)
+	if err != nil {
+		return ""
+	}
+	config, err := model.Config()
+	if err != nil || config.DraftModel == "" {
+		return ""
+	}
+	if _, err := l.modelManager.GetLocal(config.DraftModel); err != nil {
+		l.log.Warnf("Not using draft model %s of model %s, since it isn't available: %v", utils.SanitizeForLog(config.DraftModel, -1), modelID, err)
+		return ""
+	}
+	return config.DraftModel
+}
+
+// withRunnerDefaults returns the runner configuration with the default context
+// size and parallelism applied if it doesn't specify them. The caller must
+// hold the loader lock.
+func (l *loader) withRunnerDefaults(runnerConfig *inference.BackendConfiguration) *inference.BackendConfiguration {
+	if l.runnerDefaults.ContextSize <= 0 && l.runnerDefaults.Parallelism == 0 {
+		return runnerConfig
+	}
+	var merged inference.BackendConfiguration
+	if runnerConfig != nil {
+		merged = *runnerConfig
+	}
+	if merged.ContextSize <= 0 {
+		merged.ContextSize = l.runnerDefaults.ContextSize
+	}
+	if merged.Parallelism == 0 {
+		merged.Parallelism = l.runnerDefaults.Parallelism
+	}
+	return &merged
+}
+
+// setRunnerDefaults sets the default context size and parallelism of runners
+// and the runner idle timeout, where a zero idle timeout means the loader's
+// default. If the runner defaults change, runners are restarted to apply them:
+// unused runners are evicted immediately, while runners in use are marked as
+// stale and evicted once released.
+func (l *loader) setRunnerDefaults(ctx context.Context, defaults inference.BackendConfiguration, idleTimeout time.Duration) {
+	if !l.lock(ctx) {
+		return
+	}
+	defer l.unlock()
+
+	if idleTimeout == 0 {
+		idleTimeout = l.baseRunnerIdleTimeout
+	}
+	l.runnerIdleTimeout = idleTimeout
+	select {
+	case l.idleCheck <- struct{}{}:
+	default:
+	}
+
+	if reflect.DeepEqual(defaults, l.runnerDefaults) {
+		return
+	}
+	l.runnerDefaults = defaults
+	for r, runnerInfo := range l.runners {
+		if l.references[runnerInfo.slot] == 0 {
+			l.log.Infof("Restarting %s backend runner with model %s (%s) in %s mode to apply new defaults",
+				r.backend, r.modelID, runnerInfo.modelRef, r.mode,
+			)
+			l.freeRunnerSlot(runnerInfo.slot, r)
+		} else {
+			l.stale[runnerInfo.slot] = true
+		}
+	}
+	l.broadcast()
+}
+
+// requiredMemory estimates the memory that a runner for the specified model
+// will use and checks that the system is even capable of loading it.
+func (l *loader) requiredMemory(ctx context.Context, backend inference.Backend, modelID string, runnerConfig *inference.BackendConfiguration) (inference.RequiredMemory, error) {
 	memory, err := backend.GetRequiredMemoryForModel(ctx, modelID, runnerConfig)
 	var parseErr *inference.ErrGGUFParse
 	if errors.As(err, &parseErr) {
@@ -471,7 +824,7 @@ func (l *loader) load(ctx context.Context, backendName, modelID, modelRef string
 			VRAM: 0,
 		}
 	} else if err != nil {
-		return nil, err
+		return inference.RequiredMemory{}, err
 	}
 
 	l.log.Infof("Loading %s, which will require %s RAM and %s VRAM on a system with %s RAM and %s VRAM",
@@ -495,8 +848,42 @@ func (l *loader) load(ctx context.Context, backendName, modelID, modelRef string
 		totalVRAM += l.totalMemory.RAM / 2
 	}
 	if memory.RAM > l.totalMemory.RAM || memory.VRAM > totalVRAM {
-		return nil, errModelTooBig
+		return inference.RequiredMemory{}, errModelTooBig
 	}
+	return memory, nil
+}
+
+// load allocates a runner using the specified backend and modelID. If allocated,
+// it should be released by the caller using the release mechanism (once the
+// runner is no longer needed). If contextSize is non-zero, the runner is one
+// started with that context size rather than the configured one. If observer
+// is non-nil, it's notified of the load's queue status while it waits.
+func (l *loader) load(ctx context.Context, backendName, modelID, modelRef string, mode inference.BackendMode, contextSize uint64, observer queueObserver) (*runner, error) {
+	// Grab the backend.
+	backend, ok := l.backends[backendName]
+	if !ok {
+		return nil, ErrBackendNotFound
+	}
+
+	// Estimate the amount of memory that will be used by the model and check
+	// that we're even capable of loading it.
+	// If the model doesn't fit with its configured context size, then reduce
+	// the context size to fit, unless the configuration is strict. Context
+	// sizes requested explicitly aren't reduced.
+	runnerConfig, draftModelID := l.configFor(backendName, modelID, mode)
+	runnerConfig = withContextSizeOverride(runnerConfig, contextSize)
+	memory, err := l.requiredMemory(ctx, backend, modelID, runnerConfig)
+	if errors.Is(err, errModelTooBig) && contextSize == 0 && (runnerConfig == nil || !runnerConfig.StrictContextSize) {
+		if contextSize := l.contextSizeFor(backend, modelID, runnerConfig); contextSize > 0 {
+			runnerConfig, memory, err = l.fitContextSize(ctx, backend, modelID, runnerConfig, contextSize)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine the size of the model for enforcing load limits.
+	loadBytes := l.modelSize(modelID)
 
 	// Acquire the loader lock and defer its release.
 	if !l.lock(ctx) {
@@ -505,49 +892,78 @@ func (l *loader) load(ctx context.Context, backendName, modelID, modelRef string
 	defer l.unlock()
 
 	// Create a polling channel that we can use to detect state changes and
-	// ensure that it's deregistered by the time we return.
+	// ensure that it (and any queued load) is deregistered by the time we
+	// return.
 	poll := make(chan struct{}, 1)
 	l.waiters[poll] = true
 	defer func() {
 		delete(l.waiters, poll)
+		delete(l.queuedLoads, poll)
+		delete(l.waiting, poll)
 	}()
 
 	// Loop until we can satisfy the request or an error occurs.
 	for {
 		slot := -1
-		availableVRAM := l.availableMemory.VRAM
-		if runtime.GOOS == "windows" {
-			sharedRAM := l.totalMemory.RAM / 2
-			if l.availableMemory.RAM < sharedRAM {
-				sharedRAM = l.availableMemory.RAM
-			}
-			availableVRAM += sharedRAM
-		}
+		availableVRAM := l.availableVRAMForLoad()
 
 		// If loads are disabled, then there's nothing we can do.
 		if !l.loadsEnabled {
 			return nil, errLoadsDisabled
 		}
 
-		// See if we can satisfy the request with an existing runner.
-		existing, ok := l.runners[makeRunnerKey(backendName, modelID, draftModelID, mode)]
-		if ok {
+		// See if we can satisfy the request with an existing replica,
+		// preferring the least used one. Defunct and outdated replicas are
+		// evicted if they're unused and waited on otherwise.
+		replicas := l.replicasFor(backendName, modelID, draftModelID, mode, contextSize)
+		var candidate *runnerInfo
+		evicted := false
+		for _, key := range replicas {
+			existing := l.runners[key]
 			select {
 			case <-l.slots[existing.slot].done:
 				l.log.Warnf("%s runner for %s is defunct. Waiting for it to be evicted.", backendName, existing.modelRef)
 				if l.references[existing.slot] == 0 {
-					l.evictRunner(backendName, modelID, mode)
-					// Continue the loop to retry loading after evicting the defunct runner
-					continue
-				} else {
-					goto WaitForChange
+					l.freeRunnerSlot(existing.slot, key)
+					evicted = true
 				}
+				continue
 			default:
-				l.references[existing.slot]++
-				l.timestamps[existing.slot] = time.Time{}
-				return l.slots[existing.slot], nil
+			}
+			if l.stale[existing.slot] {
+				if l.references[existing.slot] == 0 {
+					l.freeRunnerSlot(existing.slot, key)
+					evicted = true
+				}
+				continue
+			}
+			// Runners that are still starting aren't ready to be used.
+			if _, starting := l.startups[existing.slot]; starting {
+				continue
+			}
+			if candidate == nil || l.references[existing.slot] < l.references[candidate.slot] {
+				candidate = &existing
 			}
 		}
+		if evicted {
+			// Continue the loop to retry loading after evicting replicas.
+			continue
+		}
+		if candidate != nil {
+			// Use the candidate unless it's busy and there's room to start
+			// another replica without evicting anything.
+			if l.references[candidate.slot] == 0 ||
+				len(replicas) >= l.desiredReplicas(backendName, modelID, mode) ||
+				!l.canStartWithoutEviction(memory, availableVRAM, loadBytes) {
+				l.references[candidate.slot]++
+				l.timestamps[candidate.slot] = time.Time{}
+				delete(l.prefetched, candidate.slot)
+				l.finishWait(poll)
+				return l.slots[candidate.slot], nil
+			}
+		} else if len(replicas) > 0 {
+			goto WaitForChange
+		}
 
 		// If there's not sufficient memory or all slots are full, then try
 		// evicting unused runners.
@@ -584,41 +1000,28 @@ func (l *loader) load(ctx context.Context, backendName, modelID, modelRef string
 				len(l.runners), len(l.slots))
 		}
 
-		// If we've identified a slot, then we're ready to start a runner.
+		// If we've identified a slot, then we're ready to start a runner,
+		// subject to the load limits.
+		if slot >= 0 && !l.startupPermitted(loadBytes) {
+			if _, queued := l.queuedLoads[poll]; !queued {
+				l.log.Infof("Queuing load of %s: %d runner startup(s) in progress", modelID, len(l.startups))
+				l.queuedLoads[poll] = &loadProgress{
+					backendName: backendName,
+					modelRef:    modelRef,
+					mode:        mode,
+					bytes:       loadBytes,
+					since:       time.Now(),
+				}
+			}
+			goto WaitForChange
+		}
 		if slot >= 0 {
-			// runnerConfig was already retrieved earlier (lines 401-405), no need to look it up again
-			// Create the runner.
-			l.log.Infof("Loading %s backend runner with model %s in %s mode", backendName, modelID, mode)
-			runner, err := run(l.log, backend, modelID, modelRef, mode, slot, runnerConfig, l.openAIRecorder)
+			delete(l.queuedLoads, poll)
+			runner, err := l.startRunner(ctx, backend, backendName, modelID, modelRef, draftModelID, mode, slot, runnerConfig, memory, loadBytes, observer)
 			if err != nil {
-				l.log.Warnf("Unable to start %s backend runner with model %s in %s mode: %v",
-					backendName, modelID, mode, err,
-				)
-				return nil, fmt.Errorf("unable to start runner: %w", err)
-			}
-
-			// Wait for the runner to be ready. In theory it's a little
-			// inefficient to block all other loaders (including those that
-			// might not want this runner), but in reality they would probably
-			// be blocked by the underlying loading anyway (in terms of disk and
-			// GPU performance). We have to retain a lock here though to enforce
-			// deduplication of runners and keep slot / memory reservations.
-			if err := runner.wait(ctx); err != nil {
-				runner.terminate()
-				l.log.Warnf("Initialization for %s backend runner with model %s in %s mode failed: %v",
-					backendName, modelID, mode, err,
-				)
-				return nil, fmt.Errorf("error waiting for runner to be ready: %w", err)
+				return nil, err
 			}
-
-			// Perform registration and return the runner.
-			l.availableMemory.RAM -= memory.RAM
-			l.availableMemory.VRAM -= memory.VRAM
-			l.runners[makeRunnerKey(backendName, modelID, draftModelID, mode)] = runnerInfo{slot, modelRef}
-			l.slots[slot] = runner
-			l.references[slot] = 1
-			l.allocations[slot].RAM = memory.RAM
-			l.allocations[slot].VRAM = memory.VRAM
+			l.finishWait(poll)
 			return runner, nil
 		}
 
@@ -626,7 +1029,11 @@ func (l *loader) load(ctx context.Context, backendName, modelID, modelRef string
 		// context.Background() because we need to ensure we hold the lock by
 		// the time we return.
 	WaitForChange:
+		status := l.queueStatus(poll)
 		l.unlock()
+		if observer != nil {
+			observer(status)
+		}
 		select {
 		case <-ctx.Done():
 			l.lock(context.Background())
@@ -637,6 +1044,91 @@ func (l *loader) load(ctx context.Context, backendName, modelID, modelRef string
 	}
 }
 
+// startRunner starts a runner in the specified free slot, reserving the
+// specified memory, and waits for it to be ready. The runner is returned with a
+// reference held. The caller must hold the loader lock, which is released
+// while waiting for the runner.
+func (l *loader) startRunner(ctx context.Context, backend inference.Backend, backendName, modelID, modelRef, draftModelID string, mode inference.BackendMode, slot int, runnerConfig *inference.BackendConfiguration, memory inference.RequiredMemory, loadBytes uint64, observer queueObserver) (*runner, error) {
+	// Verify that the model's files are complete before starting a
+	// runner, since a backend would fail obscurely otherwise.
+	if l.modelManager != nil && !backend.UsesExternalModelManagement() {
+		if err := l.modelManager.CheckComplete(modelID); errors.Is(err, models.ErrModelIncomplete) {
+			return nil, err
+		} else if err != nil {
+			l.log.Warnf("Unable to verify completeness of model %s: %v", modelID, err)
+		}
+	}
+
+	// Create the runner, tracing its startup within the request's trace.
+	ctx, span := tracing.Start(ctx, "runner startup", trace.WithAttributes(
+		attribute.String("model_runner.backend", backendName),
+		attribute.String("model_runner.model_id", modelID),
+		attribute.String("model_runner.mode", mode.String()),
+	))
+	l.log.Infof("Loading %s backend runner with model %s in %s mode", backendName, modelID, mode)
+	runner, err := run(l.log, backend, modelID, modelRef, mode, slot, runnerConfig, l.openAIRecorder)
+	if err != nil {
+		endSpan(span, err)
+		l.log.Warnf("Unable to start %s backend runner with model %s in %s mode: %v",
+			backendName, modelID, mode, err,
+		)
+		return nil, fmt.Errorf("unable to start runner: %w", err)
+	}
+
+	// Register the runner and reserve its slot and memory while it
+	// starts. The reference held by this loader prevents eviction.
+	key := makeRunnerKey(backendName, modelID, draftModelID, mode)
+	if runnerConfig != nil {
+		key.contextSize = runnerConfig.ContextSizeOverride
+	}
+	key.replica = l.nextReplica(key)
+	l.availableMemory.RAM -= memory.RAM
+	l.availableMemory.VRAM -= memory.VRAM
+	info := runnerInfo{slot: slot, modelRef: modelRef}
+	if runnerConfig != nil {
+		info.fittedContextSize = runnerConfig.FittedContextSize
+	}
+	l.runners[key] = info
+	l.slots[slot] = runner
+	l.references[slot] = 1
+	l.allocations[slot].RAM = memory.RAM
+	l.allocations[slot].VRAM = memory.VRAM
+	l.startups[slot] = &loadProgress{
+		backendName: backendName,
+		modelRef:    modelRef,
+		mode:        mode,
+		bytes:       loadBytes,
+		since:       time.Now(),
+	}
+
+	// Wait for the runner to be ready. We release the loader lock while
+	// waiting so that requests for other runners (and, within the load
+	// limits, other loads) can proceed. Loaders that want this runner
+	// will wait until its startup completes.
+	status := l.loadingStatus()
+	status.Warning = contextSizeWarning(runnerConfig)
+	startTime := time.Now()
+	l.unlock()
+	if observer != nil {
+		observer(status)
+	}
+	err = runner.wait(ctx)
+	endSpan(span, err)
+	l.lock(context.Background())
+	delete(l.startups, slot)
+	l.broadcast()
+	if err != nil {
+		l.references[slot] = 0
+		l.freeRunnerSlot(slot, key)
+		l.log.Warnf("Initialization for %s backend runner with model %s in %s mode failed: %v",
+			backendName, modelID, mode, err,
+		)
+		return nil, fmt.Errorf("error waiting for runner to be ready: %w", err)
+	}
+	l.averageStartup = ewma(l.averageStartup, time.Since(startTime))
+	return runner, nil
+}
+
 // release releases a runner, which internally decrements its reference count.
 func (l *loader) release(runner *runner) {
 	// Acquire the loader lock and defer its release.
@@ -644,10 +1136,11 @@ func (l *loader) release(runner *runner) {
 	defer l.unlock()
 
 	// Find the runner's slot by iterating through runners
+	var slotKey runnerKey
 	var slotInfo runnerInfo
 	for key, info := range l.runners {
-		if key.backend == runner.backend.Name() && key.modelID == runner.model && key.mode == runner.mode {
-			slotInfo = info
+		if l.slots[info.slot] == runner {
+			slotKey, slotInfo = key, info
 			break
 		}
 	}
@@ -656,13 +1149,17 @@ func (l *loader) release(runner *runner) {
 	l.references[slotInfo.slot]--
 
 	// If the runner's reference count is now zero, then check if it is still
-	// active, and record now as its idle start time and signal the idle
-	// checker.
+	// active (and up to date), and record now as its idle start time and
+	// signal the idle checker.
 	if l.references[slotInfo.slot] == 0 {
 		select {
 		case <-runner.done:
-			l.evictRunner(runner.backend.Name(), runner.model, runner.mode)
+			l.freeRunnerSlot(slotInfo.slot, slotKey)
 		default:
+			if l.stale[slotInfo.slot] {
+				l.freeRunnerSlot(slotInfo.slot, slotKey)
+				break
+			}
 			l.timestamps[slotInfo.slot] = time.Now()
 			select {
 			case l.idleCheck <- struct{}{}:
@@ -675,6 +1172,27 @@ func (l *loader) release(runner *runner) {
 	l.broadcast()
 }
 
+// runnerConfig returns the configuration that would be used to start a runner
+// for the specified backend, model, and mode, or nil if none is configured and
+// there are no runner defaults.
+func (l *loader) runnerConfig(ctx context.Context, backendName, modelID string, mode inference.BackendMode) *inference.BackendConfiguration {
+	if !l.lock(ctx) {
+		return nil
+	}
+	defer l.unlock()
+
+	var runnerConfig *inference.BackendConfiguration
+	if rc, ok := l.runnerConfigs[makeConfigKey(backendName, modelID, mode)]; ok {
+		runnerConfig = &rc
+	} else if mode == inference.BackendModeReranking || mode == inference.BackendModeClassification {
+		// For reranking and classification modes, fall back to the completion config.
+		if rc, ok := l.runnerConfigs[makeConfigKey(backendName, modelID, inference.BackendModeCompletion)]; ok {
+			runnerConfig = &rc
+		}
+	}
+	return l.withRunnerDefaults(runnerConfig)
+}
+
 func (l *loader) setRunnerConfig(ctx context.Context, backendName, modelID string, mode inference.BackendMode, runnerConfig inference.BackendConfiguration) error {
 	l.lock(ctx)
 	defer l.unlock()
@@ -693,20 +1211,27 @@ func (l *loader) setRunnerConfig(ctx context.Context, backendName, modelID strin
 	if runnerConfig.Speculative != nil && runnerConfig.Speculative.DraftModel != "" {
 		draftModelID = l.modelManager.ResolveID(runnerConfig.Speculative.DraftModel)
 	}
-	rKey := makeRunnerKey(backendName, modelID, draftModelID, mode)
 
-	// If there's an active runner whose configuration we want to override, then
-	// try evicting it (because it may not be in use).
-	if _, ok := l.runners[rKey]; ok {
+	// If there are active runners whose configuration we want to override,
+	// then try evicting them (because they may not be in use).
+	if len(l.replicasFor(backendName, modelID, draftModelID, mode, 0)) > 0 {
 		l.evictRunner(backendName, modelID, mode)
 	}
 
-	// If there's still then active runner, then we can't (or at least
+	// If there are still active runners, then we can't (or at least
 	// shouldn't) change the configuration.
-	if _, ok := l.runners[rKey]; ok {
+	if len(l.replicasFor(backendName, modelID, draftModelID, mode, 0)) > 0 {
 		return errRunnerAlreadyActive
 	}
 
+	// Runners serving requests with a requested context size are restarted
+	// with the new configuration once released.
+	for key, runnerInfo := range l.runners {
+		if key.backend == backendName && key.modelID == modelID && key.mode == mode && key.contextSize != 0 {
+			l.stale[runnerInfo.slot] = true
+		}
+	}
+
 	l.log.Infof("Configuring %s runner for %s", backendName, modelID)
 	l.runnerConfigs[configKey] = runnerConfig
 	return nil
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -268,6 +269,37 @@ func TestMemoryCalculation(t *testing.T) {
 	}
 }
 
+// TestAvailableVRAM tests that the available VRAM is reported without blocking
+func TestAvailableVRAM(t *testing.T) {
+	log := createTestLogger()
+	sysMemInfo := &mockSystemMemoryInfo{
+		totalMemory: inference.RequiredMemory{
+			RAM:  2 * 1024 * 1024 * 1024, // 2 GB
+			VRAM: 4 * 1024 * 1024 * 1024, // 4 GB
+		},
+	}
+	loader := newLoader(log, nil, nil, nil, sysMemInfo)
+
+	vram, ok := loader.availableVRAM()
+	if !ok || vram != 4*1024*1024*1024 {
+		t.Errorf("Expected 4 GB available VRAM, got %d (ok=%v)", vram, ok)
+	}
+
+	// While the loader lock is held, the query should fail rather than block.
+	loader.lock(context.Background())
+	if _, ok := loader.availableVRAM(); ok {
+		t.Error("Expected availableVRAM to fail while the loader lock is held")
+	}
+	loader.unlock()
+
+	unknown := newLoader(log, nil, nil, nil, &mockSystemMemoryInfo{
+		totalMemory: inference.RequiredMemory{RAM: 2 * 1024 * 1024 * 1024, VRAM: 1},
+	})
+	if _, ok := unknown.availableVRAM(); ok {
+		t.Error("Expected availableVRAM to fail when the VRAM size is unknown")
+	}
+}
+
 // TestMakeRunnerKey tests that runner keys are created correctly
 func TestMakeRunnerKey(t *testing.T) {
 	tests := []struct {
@@ -413,7 +445,7 @@ func TestDefunctRunnerEvictionTriggersRetry(t *testing.T) {
 	loader.unlock()
 
 	// Attempt to load - with fastFail backend, this should return quickly after eviction+retry
-	_, err := loader.load(context.Background(), "test-backend", "model1", "model1:latest", inference.BackendModeCompletion)
+	_, err := loader.load(context.Background(), "test-backend", "model1", "model1:latest", inference.BackendModeCompletion, 0, nil)
 
 	// We expect an error (backend fails fast), but not a timeout/hang
 	if errors.Is(err, context.DeadlineExceeded) {
@@ -478,7 +510,7 @@ func TestUnusedRunnerEvictionTriggersRetry(t *testing.T) {
 	loader.unlock()
 
 	// Attempt to load a different model; eviction should occur and loop should retry immediately
-	_, err := loader.load(context.Background(), "test-backend", "model1", "model1:latest", inference.BackendModeCompletion)
+	_, err := loader.load(context.Background(), "test-backend", "model1", "model1:latest", inference.BackendModeCompletion, 0, nil)
 
 	if errors.Is(err, context.DeadlineExceeded) {
 		t.Error("load() timed out - eviction of unused runner did not trigger retry")
@@ -487,3 +519,282 @@ func TestUnusedRunnerEvictionTriggersRetry(t *testing.T) {
 		t.Error("Unexpected success; acceptable but unusual with fastFail backend")
 	}
 }
+
+// TestRestartModel tests that restarting a model evicts its unused runners
+// immediately and its in-use runners once they're released.
+func TestRestartModel(t *testing.T) {
+	log := createTestLogger()
+	backend := &mockBackend{name: "test-backend"}
+	sysMemInfo := &mockSystemMemoryInfo{
+		totalMemory: inference.RequiredMemory{RAM: 1 * GB, VRAM: 1 * GB},
+	}
+	backends := map[string]inference.Backend{"test-backend": backend}
+	loader := newLoader(log, backends, nil, nil, sysMemInfo)
+	key := makeRunnerKey("test-backend", "modelX", "", inference.BackendModeCompletion)
+
+	// install registers a runner for modelX in slot 0 with the specified
+	// number of references.
+	install := func(references uint) *runner {
+		if !loader.lock(context.Background()) {
+			t.Fatal("Failed to acquire loader lock")
+		}
+		defer loader.unlock()
+		r := createAliveTerminableMockRunner(log, backend)
+		loader.slots[0] = r
+		loader.runners[key] = runnerInfo{slot: 0, modelRef: "modelX:latest"}
+		loader.references[0] = references
+		loader.allocations[0] = inference.RequiredMemory{RAM: 1 * GB, VRAM: 1 * GB}
+		loader.availableMemory = inference.RequiredMemory{}
+		loader.timestamps[0] = time.Now()
+		return r
+	}
+
+	// loaded reports whether the runner is still registered and whether it's
+	// marked stale.
+	loaded := func() (bool, bool) {
+		if !loader.lock(context.Background()) {
+			t.Fatal("Failed to acquire loader lock")
+		}
+		defer loader.unlock()
+		_, ok := loader.runners[key]
+		return ok, loader.stale[0]
+	}
+
+	install(0)
+	loader.restartModel(context.Background(), "modelX")
+	if ok, _ := loaded(); ok {
+		t.Error("Expected unused runner to be evicted")
+	}
+
+	inUse := install(1)
+	loader.restartModel(context.Background(), "modelX")
+	if ok, stale := loaded(); !ok || !stale {
+		t.Errorf("Expected in-use runner to remain loaded and be marked stale (loaded=%v, stale=%v)", ok, stale)
+	}
+
+	loader.release(inUse)
+	if ok, stale := loaded(); ok || stale {
+		t.Errorf("Expected stale runner to be evicted on release (loaded=%v, stale=%v)", ok, stale)
+	}
+}
+
+// TestReplicas tests that busy runners are scaled out to the desired number of
+// replicas and that surplus replicas are retired when scaling down.
+func TestReplicas(t *testing.T) {
+	log := createTestLogger()
+	backend := &fastFailBackend{mockBackend: mockBackend{name: "test-backend"}}
+	sysMemInfo := &mockSystemMemoryInfo{
+		totalMemory: inference.RequiredMemory{RAM: 8 * GB, VRAM: 8 * GB},
+	}
+	backends := map[string]inference.Backend{"test-backend": backend}
+	loader := newLoader(log, backends, nil, nil, sysMemInfo)
+
+	// Use a fixed number of slots regardless of the host's CPU count.
+	const nSlots = 3
+	loader.slots = make([]*runner, nSlots)
+	loader.references = make([]uint, nSlots)
+	loader.allocations = make([]inference.RequiredMemory, nSlots)
+	loader.timestamps = make([]time.Time, nSlots)
+	loader.loadsEnabled = true
+
+	// install registers a replica of modelX with the specified number of
+	// references.
+	install := func(replica int, references uint) runnerKey {
+		if !loader.lock(context.Background()) {
+			t.Fatal("Failed to acquire loader lock")
+		}
+		defer loader.unlock()
+		key := makeRunnerKey("test-backend", "modelX", "", inference.BackendModeCompletion)
+		key.replica = replica
+		loader.slots[replica] = createAliveTerminableMockRunner(log, backend)
+		loader.runners[key] = runnerInfo{slot: replica, modelRef: "modelX:latest"}
+		loader.references[replica] = references
+		return key
+	}
+
+	if _, err := loader.setReplicas(context.Background(), "test-backend", "modelX", inference.BackendModeCompletion, nSlots+1); !errors.Is(err, errInvalidReplicas) {
+		t.Errorf("Expected errInvalidReplicas, got %v", err)
+	}
+
+	// With a single replica, a busy runner is shared.
+	busy := install(0, 1)
+	r, err := loader.load(context.Background(), "test-backend", "modelX", "modelX:latest", inference.BackendModeCompletion, 0, nil)
+	if err != nil {
+		t.Fatalf("Expected busy runner to be shared, got %v", err)
+	}
+	if r != loader.slots[0] || loader.references[0] != 2 {
+		t.Errorf("Expected busy runner to be returned with 2 references, got %d", loader.references[0])
+	}
+	loader.release(r)
+
+	// With two replicas, a new runner is started instead (which fails with
+	// the fast-failing backend).
+	current, err := loader.setReplicas(context.Background(), "test-backend", "modelX", inference.BackendModeCompletion, 2)
+	if err != nil || current != 1 {
+		t.Fatalf("Expected 1 current replica, got %d (%v)", current, err)
+	}
+	if _, err := loader.load(context.Background(), "test-backend", "modelX", "modelX:latest", inference.BackendModeCompletion, 0, nil); err == nil {
+		t.Error("Expected a new replica to be started")
+	}
+	if loader.references[0] != 1 {
+		t.Errorf("Expected busy runner to remain with 1 reference, got %d", loader.references[0])
+	}
+
+	// Scaling down retires surplus replicas, deferring in-use ones until
+	// they're released.
+	install(1, 0)
+	loader.references[0] = 0
+	loader.references[1] = 1
+	current, err = loader.setReplicas(context.Background(), "test-backend", "modelX", inference.BackendModeCompletion, 1)
+	if err != nil || current != 1 {
+		t.Fatalf("Expected 1 current replica, got %d (%v)", current, err)
+	}
+	if _, ok := loader.runners[busy]; !ok {
+		t.Error("Expected replica 0 to remain loaded")
+	}
+	if !loader.stale[1] {
+		t.Error("Expected in-use surplus replica to be marked stale")
+	}
+	if counts := loader.replicaCounts(); counts[makeConfigKey("test-backend", "modelX", inference.BackendModeCompletion)] != 1 {
+		t.Errorf("Expected 1 counted replica, got %v", counts)
+	}
+}
+
+// TestStartupPermitted tests that runner startups are limited by count and by
+// aggregate model size.
+func TestStartupPermitted(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   LoadLimits
+		startups []uint64
+		bytes    uint64
+		expected bool
+	}{
+		{"no startups", LoadLimits{MaxConcurrent: 1}, nil, 10 * GB, true},
+		{"count reached", LoadLimits{MaxConcurrent: 1}, []uint64{1 * GB}, 1 * GB, false},
+		{"count available", LoadLimits{MaxConcurrent: 2}, []uint64{1 * GB}, 1 * GB, true},
+		{"bytes exceeded", LoadLimits{MaxBytes: 3 * GB}, []uint64{2 * GB}, 2 * GB, false},
+		{"bytes available", LoadLimits{MaxBytes: 3 * GB}, []uint64{1 * GB}, 2 * GB, true},
+		{"oversized single load", LoadLimits{MaxBytes: 1 * GB}, nil, 2 * GB, true},
+		{"no limits", LoadLimits{}, []uint64{1 * GB, 2 * GB}, 4 * GB, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loader := newLoader(createTestLogger(), nil, nil, nil, &mockSystemMemoryInfo{})
+			loader.loadLimits = tt.limits
+			for i, bytes := range tt.startups {
+				loader.startups[i] = &loadProgress{bytes: bytes}
+			}
+			if got := loader.startupPermitted(tt.bytes); got != tt.expected {
+				t.Errorf("startupPermitted(%d) = %v, want %v", tt.bytes, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestLoadStatuses tests that queued and in-progress loads are reported in
+// order.
+func TestLoadStatuses(t *testing.T) {
+	loader := newLoader(createTestLogger(), nil, nil, nil, &mockSystemMemoryInfo{})
+	now := time.Now()
+	loader.startups[0] = &loadProgress{
+		backendName: "test-backend",
+		modelRef:    "model1",
+		mode:        inference.BackendModeCompletion,
+		bytes:       1 * GB,
+		since:       now,
+	}
+	poll := make(chan struct{}, 1)
+	loader.queuedLoads[poll] = &loadProgress{
+		backendName: "test-backend",
+		modelRef:    "model2",
+		mode:        inference.BackendModeEmbedding,
+		bytes:       2 * GB,
+		since:       now.Add(time.Second),
+	}
+
+	statuses := loader.loadStatuses(context.Background())
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 load statuses, got %d", len(statuses))
+	}
+	if statuses[0].ModelName != "model1" || statuses[0].State != LoadStateStarting {
+		t.Errorf("Unexpected first status: %+v", statuses[0])
+	}
+	if statuses[1].ModelName != "model2" || statuses[1].State != LoadStateQueued || statuses[1].Mode != "embedding" {
+		t.Errorf("Unexpected second status: %+v", statuses[1])
+	}
+}
+
+// TestQueueProgress tests that loads waiting for a runner report their queue
+// status.
+func TestQueueProgress(t *testing.T) {
+	log := createTestLogger()
+	backend := &mockBackend{name: "test-backend"}
+	sysMemInfo := &mockSystemMemoryInfo{
+		totalMemory: inference.RequiredMemory{RAM: 8 * GB, VRAM: 8 * GB},
+	}
+	loader := newLoader(log, map[string]inference.Backend{"test-backend": backend}, nil, nil, sysMemInfo)
+	loader.slots = make([]*runner, 1)
+	loader.references = make([]uint, 1)
+	loader.allocations = make([]inference.RequiredMemory, 1)
+	loader.timestamps = make([]time.Time, 1)
+	loader.loadsEnabled = true
+
+	// Occupy the only slot with a busy runner for another model.
+	key := makeRunnerKey("test-backend", "modelX", "", inference.BackendModeCompletion)
+	loader.slots[0] = createAliveTerminableMockRunner(log, backend)
+	loader.runners[key] = runnerInfo{slot: 0, modelRef: "modelX:latest"}
+	loader.references[0] = 1
+
+	// Register an earlier waiter and a wait history.
+	loader.waiting[make(chan struct{})] = time.Now().Add(-time.Second)
+	loader.averageWait = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var statuses []QueueStatus
+	_, err := loader.load(ctx, "test-backend", "modelY", "modelY:latest", inference.BackendModeCompletion, 0, func(status QueueStatus) {
+		statuses = append(statuses, status)
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected load to be canceled, got %v", err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("Expected 1 queue status, got %+v", statuses)
+	}
+	status := statuses[0]
+	if status.State != QueueStateQueued || status.Position != 2 || status.Waiting != 2 {
+		t.Errorf("Unexpected queue status: %+v", status)
+	}
+	if status.EstimatedWaitSeconds < 110 || status.EstimatedWaitSeconds > 120 {
+		t.Errorf("Expected an estimated wait of about 2 minutes, got %v seconds", status.EstimatedWaitSeconds)
+	}
+	if len(loader.waiting) != 1 {
+		t.Errorf("Expected canceled load to be deregistered, got %d waiting", len(loader.waiting))
+	}
+}
+
+// TestQueueProgressWriter tests that queue events start the event stream and
+// that subsequent error responses are converted to error events.
+func TestQueueProgressWriter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	w := &queueProgressWriter{ResponseWriter: recorder}
+	w.report(QueueStatus{State: QueueStateQueued, Position: 1, Waiting: 1})
+	w.report(QueueStatus{State: QueueStateQueued, Position: 1, Waiting: 1})
+	w.report(QueueStatus{State: QueueStateLoading})
+	http.Error(w, "unable to load runner", http.StatusInternalServerError)
+
+	// The headers are snapshotted when written, before http.Error modifies
+	// them.
+	if result := recorder.Result(); result.StatusCode != http.StatusOK || result.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected an event stream, got %d (%s)", result.StatusCode, result.Header.Get("Content-Type"))
+	}
+	expected := "event: queue\ndata: {\"state\":\"queued\",\"position\":1,\"waiting\":1}\n\n" +
+		"event: queue\ndata: {\"state\":\"loading\"}\n\n" +
+		"event: error\ndata: unable to load runner\n\n"
+	if body := recorder.Body.String(); body != expected {
+		t.Errorf("Unexpected event stream:\n%s", body)
+	}
+}
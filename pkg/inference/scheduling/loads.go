@@ -0,0 +1,143 @@
+package scheduling
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+// LoadLimits limits the runner startups that the loader performs
+// concurrently. Loads exceeding the limits are queued until enough in-progress
+// startups complete. A single load is always permitted when no other startups
+// are in progress, even if it exceeds MaxBytes.
+type LoadLimits struct {
+	// MaxConcurrent is the maximum number of concurrent runner startups. A
+	// zero value means no limit.
+	MaxConcurrent int
+	// MaxBytes is the maximum aggregate size (in bytes) of the models being
+	// loaded concurrently. A zero value means no limit.
+	MaxBytes uint64
+}
+
+// defaultLoadLimits are the default load limits, which serialize runner
+// startups to avoid thrashing disk and memory.
+var defaultLoadLimits = LoadLimits{MaxConcurrent: 1}
+
+// Load states reported in LoadStatus.
+const (
+	// LoadStateQueued indicates that a load is waiting for other loads to
+	// complete.
+	LoadStateQueued = "queued"
+	// LoadStateStarting indicates that a runner is starting.
+	LoadStateStarting = "starting"
+)
+
+// LoadStatus describes a load that's queued or in progress.
+type LoadStatus struct {
+	// BackendName is the name of the backend.
+	BackendName string `json:"backend_name"`
+	// ModelName is the name of the model being loaded.
+	ModelName string `json:"model_name"`
+	// Mode is the mode the backend will operate in.
+	Mode string `json:"mode"`
+	// State is the state of the load (queued or starting).
+	State string `json:"state"`
+	// Bytes is the size of the model being loaded.
+	Bytes uint64 `json:"bytes"`
+	// Since is the time at which the load entered its current state.
+	Since time.Time `json:"since"`
+}
+
+// loadProgress tracks a load that's queued or in progress.
+type loadProgress struct {
+	// backendName is the name of the backend.
+	backendName string
+	// modelRef is the reference of the model being loaded.
+	modelRef string
+	// mode is the mode the backend will operate in.
+	mode inference.BackendMode
+	// bytes is the size of the model being loaded.
+	bytes uint64
+	// since is the time at which the load entered its current state.
+	since time.Time
+}
+
+// status converts the progress to a LoadStatus with the specified state.
+func (p *loadProgress) status(state string) LoadStatus {
+	return LoadStatus{
+		BackendName: p.backendName,
+		ModelName:   p.modelRef,
+		Mode:        p.mode.String(),
+		State:       state,
+		Bytes:       p.bytes,
+		Since:       p.since,
+	}
+}
+
+// modelSize returns the size of a model's files, or zero if the size can't be
+// determined.
+func (l *loader) modelSize(modelID string) uint64 {
+	if l.modelManager == nil {
+		return 0
+	}
+	model, err := l.modelManager.GetLocal(modelID)
+	if err != nil {
+		return 0
+	}
+	return uint64(models.SizeOnDisk(model))
+}
+
+// startupPermitted returns whether a runner startup for a model of the
+// specified size is permitted by the load limits. The caller must hold the
+// loader lock.
+func (l *loader) startupPermitted(bytes uint64) bool {
+	if len(l.startups) == 0 {
+		return true
+	}
+	if l.loadLimits.MaxConcurrent > 0 && len(l.startups) >= l.loadLimits.MaxConcurrent {
+		return false
+	}
+	if l.loadLimits.MaxBytes > 0 {
+		total := bytes
+		for _, startup := range l.startups {
+			total += startup.bytes
+		}
+		if total > l.loadLimits.MaxBytes {
+			return false
+		}
+	}
+	return true
+}
+
+// setLoadLimits sets the load limits and wakes any queued loads that may now
+// be permitted.
+func (l *loader) setLoadLimits(limits LoadLimits) {
+	l.lock(context.Background())
+	defer l.unlock()
+	l.loadLimits = limits
+	l.broadcast()
+}
+
+// loadStatuses returns the status of all queued and in-progress loads, ordered
+// by the time at which they entered their current state.
+func (l *loader) loadStatuses(ctx context.Context) []LoadStatus {
+	if !l.lock(ctx) {
+		return []LoadStatus{}
+	}
+	defer l.unlock()
+
+	statuses := make([]LoadStatus, 0, len(l.startups)+len(l.queuedLoads))
+	for _, startup := range l.startups {
+		statuses = append(statuses, startup.status(LoadStateStarting))
+	}
+	for _, queued := range l.queuedLoads {
+		statuses = append(statuses, queued.status(LoadStateQueued))
+	}
+	slices.SortFunc(statuses, func(a, b LoadStatus) int {
+		return a.Since.Compare(b.Since)
+	})
+	return statuses
+}
@@ -0,0 +1,510 @@
+package scheduling
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/distribution/distribution"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+const (
+	// loadTestUserAgent identifies load test requests in usage analytics.
+	loadTestUserAgent = "model-runner-loadtest"
+	// defaultLoadTestDuration is the duration of load tests that don't
+	// specify one.
+	defaultLoadTestDuration = 30 * time.Second
+	// maximumLoadTestDuration is the longest load test that can be run.
+	maximumLoadTestDuration = time.Hour
+	// defaultLoadTestPromptLength is the prompt length, in tokens, of load
+	// tests that don't specify a distribution.
+	defaultLoadTestPromptLength = 128
+	// maximumLoadTestPromptLength is the longest prompt that can be generated.
+	maximumLoadTestPromptLength = 32768
+	// defaultLoadTestMaxTokens is the completion length of load tests that
+	// don't specify one.
+	defaultLoadTestMaxTokens = 128
+	// maximumLoadTestMaxTokens is the longest completion that can be
+	// requested.
+	maximumLoadTestMaxTokens = 8192
+	// maximumLoadTestHistory is the number of load test reports retained.
+	maximumLoadTestHistory = 20
+
+	// loadTestStatusRunning is the status of load tests in progress.
+	loadTestStatusRunning = "running"
+	// loadTestStatusCompleted is the status of load tests that ran for their
+	// full duration.
+	loadTestStatusCompleted = "completed"
+	// loadTestStatusCancelled is the status of cancelled load tests.
+	loadTestStatusCancelled = "cancelled"
+	// loadTestStatusFailed is the status of load tests whose requests all
+	// failed.
+	loadTestStatusFailed = "failed"
+)
+
+// loadTestWords are the words of generated prompts, each of which is roughly
+// one token.
+var loadTestWords = strings.Fields("the quick brown fox jumps over a lazy dog while river stone light house keeper " +
+	"writes long story about sea wind rain night morning ship harbor bell town market green hill old road")
+
+// normalizeLoadTestRequest validates a load test request and applies its
+// defaults, returning its duration.
+func normalizeLoadTestRequest(request *LoadTestRequest) (time.Duration, error) {
+	if request.Model == "" {
+		return 0, errors.New("model is required")
+	}
+	request.Model = models.NormalizeModelName(request.Model)
+	if request.Concurrency == 0 {
+		request.Concurrency = 1
+	} else if request.Concurrency < 0 || request.Concurrency > maximumTuningParallelism {
+		return 0, fmt.Errorf("concurrency must be between 1 and %d", maximumTuningParallelism)
+	}
+	duration := defaultLoadTestDuration
+	if request.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(request.Duration); err != nil || duration <= 0 || duration > maximumLoadTestDuration {
+			return 0, fmt.Errorf("duration must be a positive duration of at most %s", maximumLoadTestDuration)
+		}
+	}
+	request.Duration = duration.String()
+	if request.MaxTokens == 0 {
+		request.MaxTokens = defaultLoadTestMaxTokens
+	} else if request.MaxTokens < 0 || request.MaxTokens > maximumLoadTestMaxTokens {
+		return 0, fmt.Errorf("max_tokens must be between 1 and %d", maximumLoadTestMaxTokens)
+	}
+	if request.PromptLength == nil {
+		request.PromptLength = &LengthDistribution{Distribution: "fixed", Mean: defaultLoadTestPromptLength}
+	}
+	if err := request.PromptLength.validate(); err != nil {
+		return 0, fmt.Errorf("prompt_length: %w", err)
+	}
+	return duration, nil
+}
+
+// validate checks that the distribution is well-formed.
+func (d *LengthDistribution) validate() error {
+	inRange := func(length int) bool {
+		return length >= 1 && length <= maximumLoadTestPromptLength
+	}
+	switch d.Distribution {
+	case "fixed":
+		if !inRange(d.Mean) {
+			return fmt.Errorf("mean must be between 1 and %d", maximumLoadTestPromptLength)
+		}
+	case "uniform":
+		if !inRange(d.Min) || !inRange(d.Max) || d.Min > d.Max {
+			return fmt.Errorf("min and max must be between 1 and %d, with min at most max", maximumLoadTestPromptLength)
+		}
+	case "normal":
+		if !inRange(d.Mean) || d.StdDev < 0 {
+			return fmt.Errorf("mean must be between 1 and %d, with a non-negative stddev", maximumLoadTestPromptLength)
+		}
+		if (d.Min != 0 && !inRange(d.Min)) || (d.Max != 0 && !inRange(d.Max)) || (d.Max != 0 && d.Min > d.Max) {
+			return fmt.Errorf("min and max must be between 1 and %d, with min at most max", maximumLoadTestPromptLength)
+		}
+	default:
+		return fmt.Errorf("unsupported distribution %q (supported: fixed, uniform, normal)", d.Distribution)
+	}
+	return nil
+}
+
+// sample draws a length from the distribution.
+func (d *LengthDistribution) sample(rng *mathrand.Rand) int {
+	switch d.Distribution {
+	case "uniform":
+		return d.Min + rng.IntN(d.Max-d.Min+1)
+	case "normal":
+		length := int(math.Round(float64(d.Mean) + rng.NormFloat64()*float64(d.StdDev)))
+		lower, upper := max(d.Min, 1), maximumLoadTestPromptLength
+		if d.Max != 0 {
+			upper = d.Max
+		}
+		return min(max(length, lower), upper)
+	default:
+		return d.Mean
+	}
+}
+
+// loadTestPrompt generates a prompt of roughly the specified number of
+// tokens.
+func loadTestPrompt(tokens int, rng *mathrand.Rand) string {
+	words := make([]string, tokens)
+	for i := range words {
+		words[i] = loadTestWords[rng.IntN(len(loadTestWords))]
+	}
+	return strings.Join(words, " ")
+}
+
+// percentiles summarizes latencies.
+func percentiles(latencies []int64) LatencyPercentiles {
+	if len(latencies) == 0 {
+		return LatencyPercentiles{}
+	}
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	percentile := func(p int) int64 {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	return LatencyPercentiles{P50Ms: percentile(50), P90Ms: percentile(90), P99Ms: percentile(99), MaxMs: sorted[len(sorted)-1]}
+}
+
+// loadTestResult is the outcome of a load test request.
+type loadTestResult struct {
+	statusCode       int
+	err              error
+	latency          time.Duration
+	timeToFirstToken time.Duration
+	promptTokens     int
+	completionTokens int
+}
+
+// loadTest is a load test in progress or finished.
+type loadTest struct {
+	// cancel cancels the load test.
+	cancel context.CancelFunc
+	// mutex guards the subsequent fields.
+	mutex  sync.Mutex
+	report LoadTestReport
+	// latencies and timesToFirstToken are those of successful requests, in
+	// milliseconds.
+	latencies         []int64
+	timesToFirstToken []int64
+	// successes is the number of successful requests.
+	successes int
+	// cancelled is set if the load test was cancelled.
+	cancelled bool
+}
+
+// record adds the result of a request to the load test.
+func (t *loadTest) record(result loadTestResult) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.report.Requests++
+	if result.err != nil {
+		t.report.Errors++
+		if result.statusCode != 0 {
+			if t.report.ErrorStatusCodes == nil {
+				t.report.ErrorStatusCodes = make(map[string]int)
+			}
+			t.report.ErrorStatusCodes[strconv.Itoa(result.statusCode)]++
+		}
+		t.report.LastError = result.err.Error()
+		return
+	}
+	t.successes++
+	t.report.PromptTokens += result.promptTokens
+	t.report.CompletionTokens += result.completionTokens
+	t.latencies = append(t.latencies, result.latency.Milliseconds())
+	if result.timeToFirstToken > 0 {
+		t.timesToFirstToken = append(t.timesToFirstToken, result.timeToFirstToken.Milliseconds())
+	}
+}
+
+// finish marks the load test as finished.
+func (t *loadTest) finish() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	finished := time.Now()
+	t.report.Finished = &finished
+	switch {
+	case t.cancelled:
+		t.report.Status = loadTestStatusCancelled
+	case t.report.Requests > 0 && t.successes == 0:
+		t.report.Status = loadTestStatusFailed
+	default:
+		t.report.Status = loadTestStatusCompleted
+	}
+}
+
+// snapshot returns the load test's report, with its throughputs and latency
+// percentiles computed so far.
+func (t *loadTest) snapshot() LoadTestReport {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	report := t.report
+	end := time.Now()
+	if report.Finished != nil {
+		end = *report.Finished
+	}
+	if elapsed := end.Sub(report.Started).Seconds(); elapsed > 0 {
+		report.RequestsPerSecond = float64(t.successes) / elapsed
+		report.OutputTokensPerSecond = float64(report.CompletionTokens) / elapsed
+	}
+	report.Latency = percentiles(t.latencies)
+	report.TimeToFirstToken = percentiles(t.timesToFirstToken)
+	return report
+}
+
+// loadTests tracks the running load test and the reports of recent ones.
+type loadTests struct {
+	// mutex guards tests.
+	mutex sync.Mutex
+	// tests are the recent load tests, from oldest to newest.
+	tests []*loadTest
+}
+
+// start adds a load test, returning false if another one is running.
+func (l *loadTests) start(test *loadTest) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, other := range l.tests {
+		if other.snapshot().Status == loadTestStatusRunning {
+			return false
+		}
+	}
+	l.tests = append(l.tests, test)
+	if len(l.tests) > maximumLoadTestHistory {
+		l.tests = l.tests[len(l.tests)-maximumLoadTestHistory:]
+	}
+	return true
+}
+
+// lookup returns the load test with the specified ID, or nil if there's none.
+func (l *loadTests) lookup(id string) *loadTest {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, test := range l.tests {
+		if test.report.ID == id {
+			return test
+		}
+	}
+	return nil
+}
+
+// list returns the reports of the recent load tests, from newest to oldest.
+func (l *loadTests) list() []LoadTestReport {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	reports := make([]LoadTestReport, 0, len(l.tests))
+	for i := len(l.tests) - 1; i >= 0; i-- {
+		reports = append(reports, l.tests[i].snapshot())
+	}
+	return reports
+}
+
+// runLoadTest keeps the load test's concurrent requests in flight until its
+// duration elapses or it's cancelled. Requests cut short by the end of the
+// load test aren't counted.
+func (s *Scheduler) runLoadTest(ctx context.Context, test *loadTest, duration time.Duration) {
+	defer test.finish()
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	request := test.report.Request
+	var wg sync.WaitGroup
+	for i := range request.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := mathrand.New(mathrand.NewPCG(uint64(test.report.Started.UnixNano()), uint64(i)))
+			for ctx.Err() == nil {
+				prompt := loadTestPrompt(request.PromptLength.sample(rng), rng)
+				result := s.loadTestRequest(ctx, request.Model, prompt, request.MaxTokens)
+				if ctx.Err() != nil {
+					return
+				}
+				test.record(result)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// loadTestRequest issues a streamed chat completion request, measuring its
+// latency and time to first token.
+func (s *Scheduler) loadTestRequest(ctx context.Context, model, prompt string, maxTokens int) loadTestResult {
+	body, err := json.Marshal(map[string]any{
+		"model":          model,
+		"messages":       []map[string]string{{"role": "user", "content": prompt}},
+		"max_tokens":     maxTokens,
+		"ignore_eos":     true,
+		"stream":         true,
+		"stream_options": map[string]bool{"include_usage": true},
+	})
+	if err != nil {
+		return loadTestResult{err: err}
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, inference.InferencePrefix+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return loadTestResult{err: err}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", loadTestUserAgent)
+
+	recorder := &timingResponseWriter{bufferedResponseWriter: bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}, start: time.Now()}
+	s.ServeHTTP(recorder, request)
+	result := loadTestResult{statusCode: recorder.statusCode, latency: time.Since(recorder.start)}
+	if recorder.statusCode != http.StatusOK {
+		result.err = fmt.Errorf("request failed with status %d: %s", recorder.statusCode, strings.TrimSpace(recorder.body.String()))
+		return result
+	}
+	if !recorder.firstToken.IsZero() {
+		result.timeToFirstToken = recorder.firstToken.Sub(recorder.start)
+	}
+	result.promptTokens, result.completionTokens = streamUsage(recorder.body.Bytes())
+	return result
+}
+
+// streamUsage returns the token usage reported by a streamed chat completion,
+// or, if it isn't reported, the number of content chunks as the completion
+// token count.
+func streamUsage(stream []byte) (int, int) {
+	var chunks int
+	scanner := bufio.NewScanner(bytes.NewReader(stream))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if json.Unmarshal([]byte(data), &chunk) != nil {
+			continue
+		}
+		if chunk.Usage != nil {
+			return chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			chunks++
+		}
+	}
+	return 0, chunks
+}
+
+// timingResponseWriter is a bufferedResponseWriter that records when the first
+// content of a streamed chat completion was written.
+type timingResponseWriter struct {
+	bufferedResponseWriter
+	start      time.Time
+	firstToken time.Time
+}
+
+func (w *timingResponseWriter) Write(b []byte) (int, error) {
+	if w.firstToken.IsZero() && bytes.Contains(b, []byte(`"content":"`)) && !bytes.Contains(b, []byte(`"content":""`)) {
+		w.firstToken = time.Now()
+	}
+	return w.bufferedResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.Flush, so that responses are streamed as they
+// would be to clients.
+func (w *timingResponseWriter) Flush() {}
+
+// newLoadTestID generates a load test ID.
+func newLoadTestID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return "loadtest-" + hex.EncodeToString(id[:])
+}
+
+// StartLoadTest starts a synthetic load test of a model, which runs in the
+// background. Only one load test can run at a time.
+func (s *Scheduler) StartLoadTest(w http.ResponseWriter, r *http.Request) {
+	var request LoadTestRequest
+	if !decodeAdminRequest(w, r, &request) {
+		return
+	}
+	duration, err := normalizeLoadTestRequest(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.routes.lookup(request.Model) == nil && s.mockBackendFor(request.Model) == nil {
+		if _, err := s.modelManager.GetLocal(request.Model); errors.Is(err, distribution.ErrModelNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "model unavailable", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	test := &loadTest{
+		cancel: cancel,
+		report: LoadTestReport{ID: newLoadTestID(), Request: request, Status: loadTestStatusRunning, Started: time.Now()},
+	}
+	if !s.loadTests.start(test) {
+		cancel()
+		http.Error(w, "a load test is already running", http.StatusConflict)
+		return
+	}
+	s.log.Infof("Starting load test %s of %s with %d concurrent requests for %s", test.report.ID, request.Model, request.Concurrency, duration)
+	go func() {
+		s.runLoadTest(ctx, test, duration)
+		cancel()
+		report := test.snapshot()
+		s.log.Infof("Load test %s %s: %d requests, %d errors, %.1f output tokens/s", report.ID, report.Status, report.Requests, report.Errors, report.OutputTokensPerSecond)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(test.snapshot()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetLoadTests returns the reports of recent load tests, from newest to
+// oldest.
+func (s *Scheduler) GetLoadTests(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.loadTests.list()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetLoadTest returns the report of a load test.
+func (s *Scheduler) GetLoadTest(w http.ResponseWriter, r *http.Request) {
+	test := s.loadTests.lookup(r.PathValue("id"))
+	if test == nil {
+		http.Error(w, "load test not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(test.snapshot()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// CancelLoadTest cancels a running load test.
+func (s *Scheduler) CancelLoadTest(w http.ResponseWriter, r *http.Request) {
+	test := s.loadTests.lookup(r.PathValue("id"))
+	if test == nil {
+		http.Error(w, "load test not found", http.StatusNotFound)
+		return
+	}
+	test.mutex.Lock()
+	if test.report.Status == loadTestStatusRunning {
+		test.cancelled = true
+	}
+	test.mutex.Unlock()
+	test.cancel()
+	w.WriteHeader(http.StatusNoContent)
+}
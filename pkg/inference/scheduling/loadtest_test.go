@@ -0,0 +1,126 @@
+package scheduling
+
+import (
+	"errors"
+	mathrand "math/rand/v2"
+	"testing"
+	"time"
+)
+
+// errTestLoadTest is the error of failed requests in load test tests.
+var errTestLoadTest = errors.New("service unavailable")
+
+func TestNormalizeLoadTestRequest(t *testing.T) {
+	request := LoadTestRequest{Model: "smollm2"}
+	duration, err := normalizeLoadTestRequest(&request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if duration != defaultLoadTestDuration || request.Concurrency != 1 || request.MaxTokens != defaultLoadTestMaxTokens {
+		t.Errorf("Expected defaults, got %s and %+v", duration, request)
+	}
+	if request.Model != "ai/smollm2:latest" {
+		t.Errorf("Expected normalized model name, got %q", request.Model)
+	}
+	if request.PromptLength == nil || request.PromptLength.Distribution != "fixed" || request.PromptLength.Mean != defaultLoadTestPromptLength {
+		t.Errorf("Expected default prompt length, got %+v", request.PromptLength)
+	}
+
+	invalid := []LoadTestRequest{
+		{},
+		{Model: "ai/smollm2", Concurrency: maximumTuningParallelism + 1},
+		{Model: "ai/smollm2", Duration: "2h"},
+		{Model: "ai/smollm2", Duration: "forever"},
+		{Model: "ai/smollm2", MaxTokens: -1},
+		{Model: "ai/smollm2", PromptLength: &LengthDistribution{Distribution: "zipf", Mean: 10}},
+		{Model: "ai/smollm2", PromptLength: &LengthDistribution{Distribution: "uniform", Min: 20, Max: 10}},
+		{Model: "ai/smollm2", PromptLength: &LengthDistribution{Distribution: "normal", Mean: 10, StdDev: -1}},
+	}
+	for _, request := range invalid {
+		if _, err := normalizeLoadTestRequest(&request); err == nil {
+			t.Errorf("Expected error for %+v", request)
+		}
+	}
+}
+
+func TestLengthDistributionSample(t *testing.T) {
+	rng := mathrand.New(mathrand.NewPCG(1, 2))
+	uniform := &LengthDistribution{Distribution: "uniform", Min: 10, Max: 20}
+	normal := &LengthDistribution{Distribution: "normal", Mean: 100, StdDev: 50, Min: 80, Max: 120}
+	for range 1000 {
+		if length := uniform.sample(rng); length < 10 || length > 20 {
+			t.Fatalf("Uniform length %d out of range", length)
+		}
+		if length := normal.sample(rng); length < 80 || length > 120 {
+			t.Fatalf("Normal length %d out of range", length)
+		}
+	}
+	fixed := &LengthDistribution{Distribution: "fixed", Mean: 42}
+	if length := fixed.sample(rng); length != 42 {
+		t.Errorf("Expected fixed length 42, got %d", length)
+	}
+}
+
+func TestStreamUsage(t *testing.T) {
+	stream := []byte("data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"b\"}}]}\n\n" +
+		"data: [DONE]\n\n")
+	if prompt, completion := streamUsage(stream); prompt != 0 || completion != 2 {
+		t.Errorf("Expected chunk count, got %d and %d", prompt, completion)
+	}
+
+	stream = append([]byte("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":34}}\n\n"), stream...)
+	if prompt, completion := streamUsage(stream); prompt != 12 || completion != 34 {
+		t.Errorf("Expected reported usage, got %d and %d", prompt, completion)
+	}
+}
+
+func TestLoadTestReport(t *testing.T) {
+	test := &loadTest{report: LoadTestReport{Status: loadTestStatusRunning, Started: time.Now().Add(-2 * time.Second)}}
+	test.record(loadTestResult{latency: 100 * time.Millisecond, timeToFirstToken: 10 * time.Millisecond, promptTokens: 5, completionTokens: 20})
+	test.record(loadTestResult{latency: 300 * time.Millisecond, promptTokens: 5, completionTokens: 20})
+	test.record(loadTestResult{statusCode: 503, err: errTestLoadTest})
+	test.finish()
+
+	report := test.snapshot()
+	if report.Status != loadTestStatusCompleted || report.Requests != 3 || report.Errors != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.ErrorStatusCodes["503"] != 1 || report.LastError != errTestLoadTest.Error() {
+		t.Errorf("Unexpected errors %v (%q)", report.ErrorStatusCodes, report.LastError)
+	}
+	if report.CompletionTokens != 40 || report.OutputTokensPerSecond <= 0 {
+		t.Errorf("Unexpected throughput %+v", report)
+	}
+	if report.Latency.P50Ms != 100 || report.Latency.MaxMs != 300 || report.TimeToFirstToken.MaxMs != 10 {
+		t.Errorf("Unexpected latencies %+v and %+v", report.Latency, report.TimeToFirstToken)
+	}
+
+	failed := &loadTest{report: LoadTestReport{Status: loadTestStatusRunning, Started: time.Now()}}
+	failed.record(loadTestResult{err: errTestLoadTest})
+	failed.finish()
+	if status := failed.snapshot().Status; status != loadTestStatusFailed {
+		t.Errorf("Expected failed status, got %s", status)
+	}
+}
+
+func TestLoadTestsStart(t *testing.T) {
+	var tests loadTests
+	first := &loadTest{report: LoadTestReport{ID: "first", Status: loadTestStatusRunning}}
+	if !tests.start(first) {
+		t.Fatal("Expected first load test to start")
+	}
+	if tests.start(&loadTest{report: LoadTestReport{ID: "second", Status: loadTestStatusRunning}}) {
+		t.Error("Expected second load test to be refused while the first is running")
+	}
+	first.finish()
+	if !tests.start(&loadTest{report: LoadTestReport{ID: "third", Status: loadTestStatusRunning}}) {
+		t.Error("Expected load test to start once the first finished")
+	}
+	if reports := tests.list(); len(reports) != 2 || reports[0].ID != "third" {
+		t.Errorf("Unexpected reports %+v", reports)
+	}
+	if tests.lookup("first") != first || tests.lookup("missing") != nil {
+		t.Error("Unexpected lookup results")
+	}
+}
@@ -0,0 +1,154 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultMaintenanceBufferTimeout is the default maximum time for which
+	// inference requests are buffered during maintenance.
+	defaultMaintenanceBufferTimeout = 30 * time.Second
+	// maximumMaintenanceBufferTimeout is the maximum allowed buffer timeout.
+	maximumMaintenanceBufferTimeout = 10 * time.Minute
+	// maintenanceRetryAfter is the delay after which clients whose requests
+	// are rejected during maintenance are told to retry.
+	maintenanceRetryAfter = 10 * time.Second
+)
+
+// maintenance tracks maintenance mode, during which the admission of
+// inference requests is paused.
+type maintenance struct {
+	// buffered is the number of requests waiting for maintenance to end.
+	buffered atomic.Int64
+	// mutex guards all subsequent fields.
+	mutex sync.Mutex
+	// since is the time at which maintenance started, which is zero if
+	// maintenance isn't in progress.
+	since time.Time
+	// bufferTimeout is the maximum time for which requests are buffered.
+	bufferTimeout time.Duration
+	// resumed is closed when maintenance ends.
+	resumed chan struct{}
+}
+
+// start starts maintenance, or updates the buffer timeout if maintenance is
+// already in progress.
+func (m *maintenance) start(bufferTimeout time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.bufferTimeout = bufferTimeout
+	if m.since.IsZero() {
+		m.since = time.Now()
+		m.resumed = make(chan struct{})
+	}
+}
+
+// stop ends maintenance, admitting buffered requests.
+func (m *maintenance) stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.since.IsZero() {
+		m.since = time.Time{}
+		close(m.resumed)
+	}
+}
+
+// wait waits for maintenance to end, if in progress, for up to the buffer
+// timeout. It returns ErrMaintenance if maintenance doesn't end in time.
+func (m *maintenance) wait(ctx context.Context) error {
+	m.mutex.Lock()
+	inProgress := !m.since.IsZero()
+	bufferTimeout, resumed := m.bufferTimeout, m.resumed
+	m.mutex.Unlock()
+	if !inProgress {
+		return nil
+	}
+	if bufferTimeout == 0 {
+		return ErrMaintenance
+	}
+
+	m.buffered.Add(1)
+	defer m.buffered.Add(-1)
+	timer := time.NewTimer(bufferTimeout)
+	defer timer.Stop()
+	select {
+	case <-resumed:
+		return nil
+	case <-timer.C:
+		return ErrMaintenance
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// status returns the API representation of the maintenance state.
+func (m *maintenance) status() MaintenanceStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	status := MaintenanceStatus{Enabled: !m.since.IsZero()}
+	if status.Enabled {
+		since := m.since
+		status.Since = &since
+		status.BufferTimeout = m.bufferTimeout.String()
+	}
+	status.Buffered = m.buffered.Load()
+	return status
+}
+
+// rejectForMaintenance writes a response rejecting a request because
+// maintenance is in progress.
+func rejectForMaintenance(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter.Seconds())))
+	http.Error(w, ErrMaintenance.Error(), http.StatusServiceUnavailable)
+}
+
+// GetMaintenance reports whether maintenance is in progress, along with the
+// number of requests buffered and in flight.
+func (s *Scheduler) GetMaintenance(w http.ResponseWriter, _ *http.Request) {
+	status := s.maintenance.status()
+	status.InFlight = s.pendingRequests.Load() + s.activeRequests.Load()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateMaintenance starts or ends maintenance. While maintenance is in
+// progress, new inference requests are buffered until it ends or the buffer
+// timeout elapses, after which they're rejected with a Retry-After header.
+// Requests already in flight are unaffected.
+func (s *Scheduler) UpdateMaintenance(w http.ResponseWriter, r *http.Request) {
+	var request MaintenanceRequest
+	if !decodeAdminRequest(w, r, &request) {
+		return
+	}
+
+	if !request.Enabled {
+		s.maintenance.stop()
+		s.log.Infoln("Maintenance ended, admitting requests")
+		s.GetMaintenance(w, r)
+		return
+	}
+
+	bufferTimeout := defaultMaintenanceBufferTimeout
+	if request.BufferTimeout != "" {
+		var err error
+		bufferTimeout, err = time.ParseDuration(request.BufferTimeout)
+		if err != nil || bufferTimeout < 0 || bufferTimeout > maximumMaintenanceBufferTimeout {
+			http.Error(w, fmt.Sprintf("invalid buffer timeout %q: must be a duration between 0s and %s", request.BufferTimeout, maximumMaintenanceBufferTimeout), http.StatusBadRequest)
+			return
+		}
+	}
+	s.maintenance.start(bufferTimeout)
+	s.log.Infof("Maintenance started, buffering requests for up to %s", bufferTimeout)
+	s.GetMaintenance(w, r)
+}
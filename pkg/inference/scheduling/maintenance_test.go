@@ -0,0 +1,52 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+	var m maintenance
+	ctx := context.Background()
+	if err := m.wait(ctx); err != nil {
+		t.Fatalf("Expected admission without maintenance, got %v", err)
+	}
+
+	// Buffered requests are admitted when maintenance ends.
+	m.start(time.Minute)
+	admitted := make(chan error, 1)
+	go func() {
+		admitted <- m.wait(ctx)
+	}()
+	for m.status().Buffered != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	m.stop()
+	if err := <-admitted; err != nil {
+		t.Errorf("Expected buffered request to be admitted, got %v", err)
+	}
+	if status := m.status(); status.Enabled || status.Buffered != 0 {
+		t.Errorf("Unexpected status after maintenance %+v", status)
+	}
+
+	// Requests are rejected once the buffer timeout elapses.
+	m.start(10 * time.Millisecond)
+	if err := m.wait(ctx); !errors.Is(err, ErrMaintenance) {
+		t.Errorf("Expected ErrMaintenance after the buffer timeout, got %v", err)
+	}
+	m.start(0)
+	if err := m.wait(ctx); !errors.Is(err, ErrMaintenance) {
+		t.Errorf("Expected immediate ErrMaintenance without buffering, got %v", err)
+	}
+	m.stop()
+
+	rec := httptest.NewRecorder()
+	rejectForMaintenance(rec)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "10" {
+		t.Errorf("Expected 503 with Retry-After, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
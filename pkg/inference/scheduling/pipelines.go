@@ -0,0 +1,413 @@
+package scheduling
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+const (
+	// pipelineStatusCompleted is the status of completed pipeline runs and
+	// steps.
+	pipelineStatusCompleted = "completed"
+	// pipelineStatusFailed is the status of failed pipeline runs and steps.
+	pipelineStatusFailed = "failed"
+	// pipelineStatusSkipped is the status of steps skipped because a step
+	// that they depend on failed.
+	pipelineStatusSkipped = "skipped"
+)
+
+// pipelineEndpoints maps the endpoints of pipeline steps to their paths.
+var pipelineEndpoints = map[string]string{
+	"chat/completions": "/v1/chat/completions",
+	"embeddings":       "/v1/embeddings",
+	"moderations":      "/v1/moderations",
+	"classify":         "/classify",
+}
+
+// pipelineNamePattern matches valid pipeline and step names.
+var pipelineNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// pipelinePlaceholderPattern matches the placeholders of step prompts.
+var pipelinePlaceholderPattern = regexp.MustCompile(`\{\{\s*(input|steps\.[A-Za-z0-9._-]+)\s*\}\}`)
+
+// compiledPipeline is a validated pipeline with its steps' dependencies
+// resolved.
+type compiledPipeline struct {
+	Pipeline
+	// dependencies are the indices of the steps on which each step depends.
+	dependencies [][]int
+	// output is the index of the output step.
+	output int
+}
+
+// compilePipeline validates a pipeline and resolves its steps' dependencies.
+func compilePipeline(pipeline Pipeline) (*compiledPipeline, error) {
+	if !pipelineNamePattern.MatchString(pipeline.Name) {
+		return nil, invalidf("invalid pipeline name %q", pipeline.Name)
+	}
+	if len(pipeline.Steps) == 0 {
+		return nil, invalidf("steps are required")
+	}
+	indices := make(map[string]int, len(pipeline.Steps))
+	for i, step := range pipeline.Steps {
+		if !pipelineNamePattern.MatchString(step.Name) {
+			return nil, invalidf("steps[%d]: invalid name %q", i, step.Name)
+		}
+		if _, ok := indices[step.Name]; ok {
+			return nil, invalidf("steps[%d]: duplicate name %q", i, step.Name)
+		}
+		indices[step.Name] = i
+		if step.Model == "" {
+			return nil, invalidf("steps[%d]: model is required", i)
+		}
+		if _, ok := pipelineEndpoints[step.endpoint()]; !ok {
+			return nil, invalidf("steps[%d]: unsupported endpoint %q", i, step.Endpoint)
+		}
+	}
+
+	compiled := &compiledPipeline{Pipeline: pipeline, dependencies: make([][]int, len(pipeline.Steps)), output: len(pipeline.Steps) - 1}
+	for i, step := range pipeline.Steps {
+		names := slices.Clone(step.DependsOn)
+		for _, match := range pipelinePlaceholderPattern.FindAllStringSubmatch(step.Prompt, -1) {
+			if name, ok := strings.CutPrefix(match[1], "steps."); ok {
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			dependency, ok := indices[name]
+			if !ok {
+				return nil, invalidf("steps[%d]: unknown step %q", i, name)
+			} else if dependency == i {
+				return nil, invalidf("steps[%d]: step can't depend on itself", i)
+			}
+			if !slices.Contains(compiled.dependencies[i], dependency) {
+				compiled.dependencies[i] = append(compiled.dependencies[i], dependency)
+			}
+		}
+	}
+	if err := compiled.checkAcyclic(); err != nil {
+		return nil, err
+	}
+	if pipeline.Output != "" {
+		output, ok := indices[pipeline.Output]
+		if !ok {
+			return nil, invalidf("unknown output step %q", pipeline.Output)
+		}
+		compiled.output = output
+	}
+	return compiled, nil
+}
+
+// checkAcyclic returns an error if the pipeline's steps have a dependency
+// cycle.
+func (p *compiledPipeline) checkAcyclic() error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make([]int, len(p.Steps))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch states[i] {
+		case visiting:
+			return invalidf("steps have a dependency cycle through %q", p.Steps[i].Name)
+		case visited:
+			return nil
+		}
+		states[i] = visiting
+		for _, dependency := range p.dependencies[i] {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		states[i] = visited
+		return nil
+	}
+	for i := range p.Steps {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endpoint returns the step's endpoint, which defaults to chat completions.
+func (step PipelineStep) endpoint() string {
+	if step.Endpoint == "" {
+		return "chat/completions"
+	}
+	return strings.TrimPrefix(step.Endpoint, "/")
+}
+
+// prompt renders the step's input from the pipeline's input and the outputs
+// of the steps on which it depends.
+func (p *compiledPipeline) prompt(step int, input string, outputs []string) string {
+	prompt := p.Steps[step].Prompt
+	if prompt == "" {
+		if len(p.dependencies[step]) == 0 {
+			return input
+		}
+		texts := make([]string, len(p.dependencies[step]))
+		for i, dependency := range p.dependencies[step] {
+			texts[i] = outputs[dependency]
+		}
+		return strings.Join(texts, "\n\n")
+	}
+	indices := make(map[string]int, len(p.Steps))
+	for i, s := range p.Steps {
+		indices[s.Name] = i
+	}
+	return pipelinePlaceholderPattern.ReplaceAllStringFunc(prompt, func(placeholder string) string {
+		name := pipelinePlaceholderPattern.FindStringSubmatch(placeholder)[1]
+		if name == "input" {
+			return input
+		}
+		return outputs[indices[strings.TrimPrefix(name, "steps.")]]
+	})
+}
+
+// pipelines tracks the defined pipelines.
+type pipelines struct {
+	// mutex guards pipelines.
+	mutex sync.Mutex
+	// pipelines maps pipeline names to pipelines.
+	pipelines map[string]*compiledPipeline
+}
+
+// newPipelines creates an empty set of pipelines.
+func newPipelines() *pipelines {
+	return &pipelines{pipelines: make(map[string]*compiledPipeline)}
+}
+
+// set adds or replaces pipelines.
+func (p *pipelines) set(pipelines ...Pipeline) error {
+	compiled := make([]*compiledPipeline, len(pipelines))
+	for i, pipeline := range pipelines {
+		c, err := compilePipeline(pipeline)
+		if err != nil {
+			return err
+		}
+		compiled[i] = c
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, pipeline := range compiled {
+		p.pipelines[pipeline.Name] = pipeline
+	}
+	return nil
+}
+
+// remove removes a pipeline and returns whether it existed.
+func (p *pipelines) remove(name string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_, ok := p.pipelines[name]
+	delete(p.pipelines, name)
+	return ok
+}
+
+// list returns the pipelines, sorted by name.
+func (p *pipelines) list() []Pipeline {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	list := make([]Pipeline, 0, len(p.pipelines))
+	for _, pipeline := range p.pipelines {
+		list = append(list, pipeline.Pipeline)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// lookup returns the pipeline with the specified name, or nil if there's none.
+func (p *pipelines) lookup(name string) *compiledPipeline {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.pipelines[name]
+}
+
+// runPipeline runs a pipeline on an input, issuing the requests of its steps
+// on behalf of r. Steps run concurrently once the steps that they depend on
+// have completed, and are skipped if any of them failed.
+func (s *Scheduler) runPipeline(r *http.Request, pipeline *compiledPipeline, input string) PipelineRun {
+	run := PipelineRun{
+		ID:       newPipelineRunID(),
+		Object:   "pipeline.run",
+		Pipeline: pipeline.Name,
+		Status:   pipelineStatusCompleted,
+		Steps:    make([]PipelineStepResult, len(pipeline.Steps)),
+	}
+	start := time.Now()
+	outputs := make([]string, len(pipeline.Steps))
+	done := make([]chan struct{}, len(pipeline.Steps))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	for i, step := range pipeline.Steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+			result := &run.Steps[i]
+			result.Name, result.Model = step.Name, step.Model
+			for _, dependency := range pipeline.dependencies[i] {
+				<-done[dependency]
+				if run.Steps[dependency].Status != pipelineStatusCompleted {
+					result.Status = pipelineStatusSkipped
+					return
+				}
+			}
+			stepStart := time.Now()
+			result.StartedMs = stepStart.Sub(start).Milliseconds()
+			output, statusCode, err := s.runPipelineStep(r, run.ID, step, pipeline.prompt(i, input, outputs))
+			result.DurationMs = time.Since(stepStart).Milliseconds()
+			result.StatusCode = statusCode
+			if err != nil {
+				result.Status = pipelineStatusFailed
+				result.Error = err.Error()
+				return
+			}
+			result.Status = pipelineStatusCompleted
+			result.Output = output
+			outputs[i] = output
+		}()
+	}
+	wg.Wait()
+
+	run.DurationMs = time.Since(start).Milliseconds()
+	for _, step := range run.Steps {
+		if step.Status != pipelineStatusCompleted {
+			run.Status = pipelineStatusFailed
+		}
+	}
+	if run.Status == pipelineStatusCompleted {
+		run.Output = outputs[pipeline.output]
+	}
+	return run
+}
+
+// runPipelineStep issues the request of a pipeline step, returning its output
+// and the response status code.
+func (s *Scheduler) runPipelineStep(r *http.Request, runID string, step PipelineStep, prompt string) (string, int, error) {
+	endpoint := step.endpoint()
+	request := map[string]any{"model": step.Model}
+	if endpoint == "chat/completions" {
+		var messages []map[string]string
+		if step.System != "" {
+			messages = append(messages, map[string]string{"role": "system", "content": step.System})
+		}
+		request["messages"] = append(messages, map[string]string{"role": "user", "content": prompt})
+		request["stream"] = false
+	} else {
+		request["input"] = prompt
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	internal := newInternalRequest(r, inference.InferencePrefix+pipelineEndpoints[endpoint], body)
+	internal.Header.Set(inference.PipelineIDHeader, runID)
+	internal.Header.Set(inference.PipelineStepHeader, step.Name)
+	recorder := &bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}
+	s.ServeHTTP(recorder, internal)
+	if recorder.statusCode != http.StatusOK {
+		return "", recorder.statusCode, fmt.Errorf("request failed with status %d: %s", recorder.statusCode, strings.TrimSpace(recorder.body.String()))
+	}
+	if endpoint != "chat/completions" {
+		return strings.TrimSpace(recorder.body.String()), recorder.statusCode, nil
+	}
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(recorder.body.Bytes(), &response); err != nil || len(response.Choices) == 0 {
+		return "", recorder.statusCode, fmt.Errorf("invalid chat completion response")
+	}
+	return response.Choices[0].Message.Content, recorder.statusCode, nil
+}
+
+// newPipelineRunID generates a pipeline run ID.
+func newPipelineRunID() string {
+	var id [12]byte
+	rand.Read(id[:])
+	return "pipe-" + hex.EncodeToString(id[:])
+}
+
+// SetPipelines adds or replaces pipelines.
+func (s *Scheduler) SetPipelines(pipelines []Pipeline) error {
+	return s.pipelines.set(pipelines...)
+}
+
+// GetPipelines returns the pipelines.
+func (s *Scheduler) GetPipelines(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.pipelines.list()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdatePipelines adds or replaces a pipeline.
+func (s *Scheduler) UpdatePipelines(w http.ResponseWriter, r *http.Request) {
+	var request Pipeline
+	if !decodeAdminRequest(w, r, &request) {
+		return
+	}
+	if err := s.pipelines.set(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.GetPipelines(w, r)
+}
+
+// DeletePipeline removes a pipeline.
+func (s *Scheduler) DeletePipeline(w http.ResponseWriter, r *http.Request) {
+	if !s.pipelines.remove(r.PathValue("name")) {
+		http.Error(w, "pipeline not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunPipeline runs a pipeline on the request's input. Runs with failed steps
+// are reported with a 502 status.
+func (s *Scheduler) RunPipeline(w http.ResponseWriter, r *http.Request) {
+	pipeline := s.pipelines.lookup(r.PathValue("name"))
+	if pipeline == nil {
+		http.Error(w, "pipeline not found", http.StatusNotFound)
+		return
+	}
+	var request PipelineRunRequest
+	if !decodeAdminRequest(w, r, &request) {
+		return
+	}
+	run := s.runPipeline(r, pipeline, request.Input)
+	s.log.Infof("Pipeline %s run %s %s in %dms", pipeline.Name, run.ID, run.Status, run.DurationMs)
+
+	w.Header().Set("Content-Type", "application/json")
+	if run.Status != pipelineStatusCompleted {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	if err := json.NewEncoder(w).Encode(run); err != nil {
+		s.log.Warnf("Failed to encode pipeline run: %v", err)
+	}
+}
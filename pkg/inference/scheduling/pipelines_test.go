@@ -0,0 +1,151 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestCompilePipeline(t *testing.T) {
+	pipeline, err := compilePipeline(Pipeline{
+		Name: "notes",
+		Steps: []PipelineStep{
+			{Name: "summarize", Model: "ai/smollm2", Prompt: "Summarize: {{input}}"},
+			{Name: "title", Model: "ai/smollm2", Prompt: "Title for {{ steps.summarize }}"},
+			{Name: "embed", Model: "ai/embeddinggemma", Endpoint: "embeddings", DependsOn: []string{"summarize"}},
+		},
+		Output: "title",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(pipeline.dependencies, [][]int{nil, {0}, {0}}) || pipeline.output != 1 {
+		t.Errorf("Unexpected dependencies %v or output %d", pipeline.dependencies, pipeline.output)
+	}
+	outputs := []string{"short", "", ""}
+	if prompt := pipeline.prompt(1, "long", outputs); prompt != "Title for short" {
+		t.Errorf("Unexpected prompt %q", prompt)
+	}
+	if prompt := pipeline.prompt(2, "long", outputs); prompt != "short" {
+		t.Errorf("Unexpected default prompt %q", prompt)
+	}
+
+	for name, invalid := range map[string]Pipeline{
+		"name":     {Name: "a b", Steps: []PipelineStep{{Name: "a", Model: "m"}}},
+		"steps":    {Name: "p"},
+		"model":    {Name: "p", Steps: []PipelineStep{{Name: "a"}}},
+		"endpoint": {Name: "p", Steps: []PipelineStep{{Name: "a", Model: "m", Endpoint: "images"}}},
+		"duplicate": {Name: "p", Steps: []PipelineStep{
+			{Name: "a", Model: "m"}, {Name: "a", Model: "m"},
+		}},
+		"unknown step": {Name: "p", Steps: []PipelineStep{{Name: "a", Model: "m", Prompt: "{{steps.b}}"}}},
+		"cycle": {Name: "p", Steps: []PipelineStep{
+			{Name: "a", Model: "m", DependsOn: []string{"b"}}, {Name: "b", Model: "m", DependsOn: []string{"a"}},
+		}},
+		"output": {Name: "p", Steps: []PipelineStep{{Name: "a", Model: "m"}}, Output: "b"},
+	} {
+		if _, err := compilePipeline(invalid); err == nil {
+			t.Errorf("Expected error for invalid %s", name)
+		}
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	log := createTestLogger()
+	backend := &mockBackend{name: "mock", usesExternalModelMgmt: true}
+	s := NewScheduler(log, map[string]inference.Backend{"mock": backend}, backend, nil, nil, nil, nil, nil, systemMemoryInfo{})
+	if err := s.SetPipelines([]Pipeline{{
+		Name: "notes",
+		Steps: []PipelineStep{
+			{Name: "summarize", Model: "ai/smollm2", Prompt: "Summarize: {{input}}"},
+			{Name: "title", Model: "ai/smollm2", Prompt: "Title: {{steps.summarize}}"},
+			{Name: "embed", Model: "ai/embeddinggemma", Endpoint: "embeddings", DependsOn: []string{"summarize"}},
+		},
+		Output: "title",
+	}}); err != nil {
+		t.Fatalf("Failed to set pipelines: %v", err)
+	}
+
+	// Serve inference requests with a fake backend that echoes prompts.
+	var mutex sync.Mutex
+	var runIDs []string
+	router := s.httpHandler
+	s.httpHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/pipelines/") {
+			router.ServeHTTP(w, r)
+			return
+		}
+		mutex.Lock()
+		runIDs = append(runIDs, r.Header.Get(inference.PipelineIDHeader)+"/"+r.Header.Get(inference.PipelineStepHeader))
+		mutex.Unlock()
+		var request struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+		if request.Model == "ai/embeddinggemma" {
+			if !strings.HasSuffix(r.URL.Path, "/v1/embeddings") {
+				http.Error(w, "unexpected path", http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"data":[{"embedding":[0.5]}]}`))
+			return
+		}
+		content := strings.ToUpper(request.Messages[len(request.Messages)-1].Content)
+		fmt.Fprintf(w, `{"choices":[{"message":{"content":%q}}]}`, content)
+	})
+
+	request := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/pipelines/notes/run", strings.NewReader(`{"input":"hello"}`))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var run PipelineRun
+	if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+		t.Fatalf("Failed to decode run: %v", err)
+	}
+	if run.Status != pipelineStatusCompleted || run.Output != "TITLE: SUMMARIZE: HELLO" || len(run.Steps) != 3 {
+		t.Errorf("Unexpected run %+v", run)
+	}
+	if run.Steps[2].Output != `{"data":[{"embedding":[0.5]}]}` {
+		t.Errorf("Unexpected embedding step %+v", run.Steps[2])
+	}
+	if len(runIDs) != 3 || !strings.HasPrefix(runIDs[0], run.ID+"/summarize") {
+		t.Errorf("Unexpected pipeline headers %v", runIDs)
+	}
+
+	// Steps that depend on a failed step are skipped.
+	s.SetPipelines([]Pipeline{{Name: "broken", Steps: []PipelineStep{
+		{Name: "embed", Model: "ai/embeddinggemma", Endpoint: "classify"},
+		{Name: "title", Model: "ai/smollm2", DependsOn: []string{"embed"}},
+	}}})
+	request = httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/pipelines/broken/run", strings.NewReader(`{"input":"hello"}`))
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, request)
+	if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+		t.Fatalf("Failed to decode run: %v", err)
+	}
+	if w.Code != http.StatusBadGateway || run.Status != pipelineStatusFailed || run.Steps[0].StatusCode != http.StatusNotFound ||
+		run.Steps[1].Status != pipelineStatusSkipped {
+		t.Errorf("Unexpected failed run %d: %+v", w.Code, run)
+	}
+
+	request = httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/pipelines/missing/run", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, request)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,241 @@
+package scheduling
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+const (
+	// defaultPrefetchMinProbability is the default minimum probability with
+	// which a model must follow another for it to be prefetched.
+	defaultPrefetchMinProbability = 0.5
+	// minimumPrefetchObservations is the number of transitions from a model
+	// that must be observed before the next model is predicted.
+	minimumPrefetchObservations = 3
+	// prefetchTransitionWindow is the maximum time between requests for them
+	// to be considered consecutive.
+	prefetchTransitionWindow = 5 * time.Minute
+	// maximumPrefetchModels is the maximum number of models whose successors
+	// are tracked, and the maximum number of successors tracked for each.
+	maximumPrefetchModels = 64
+)
+
+// PrefetchPolicy configures speculative prefetching, which warms the model
+// most likely to be requested next based on observed usage patterns (e.g. the
+// embedding model that always follows a chat model in a RAG flow).
+type PrefetchPolicy struct {
+	// MemoryBudget is the maximum amount of memory (RAM and VRAM combined, in
+	// bytes) that prefetched runners may occupy until they're used. A zero
+	// value disables prefetching.
+	MemoryBudget uint64
+	// MinProbability is the minimum observed probability with which a model
+	// must follow the requested model for it to be prefetched. A zero value
+	// means 0.5.
+	MinProbability float64
+}
+
+// prefetchTarget identifies a runner configuration that may be prefetched.
+type prefetchTarget struct {
+	backendName string
+	modelID     string
+	mode        inference.BackendMode
+}
+
+// prefetchSuccessors counts the models requested after a model.
+type prefetchSuccessors struct {
+	// counts maps successors to the number of times they were requested next.
+	counts map[prefetchTarget]int
+	// total is the total number of transitions observed.
+	total int
+	// lastSeen is the time at which the model was last requested.
+	lastSeen time.Time
+}
+
+// usagePredictor predicts the model most likely to be requested next from the
+// sequence of requested models.
+type usagePredictor struct {
+	// mutex guards all subsequent fields.
+	mutex sync.Mutex
+	// policy is the prefetch policy.
+	policy PrefetchPolicy
+	// previous is the most recently requested model.
+	previous prefetchTarget
+	// previousTime is the time at which previous was requested.
+	previousTime time.Time
+	// successors maps models to their observed successors.
+	successors map[prefetchTarget]*prefetchSuccessors
+	// modelRefs maps models to the reference with which they were last
+	// requested.
+	modelRefs map[prefetchTarget]string
+}
+
+// newUsagePredictor creates a new usage predictor with prefetching disabled.
+func newUsagePredictor() *usagePredictor {
+	return &usagePredictor{
+		successors: make(map[prefetchTarget]*prefetchSuccessors),
+		modelRefs:  make(map[prefetchTarget]string),
+	}
+}
+
+// setPolicy sets the prefetch policy.
+func (p *usagePredictor) setPolicy(policy PrefetchPolicy) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if policy.MinProbability == 0 {
+		policy.MinProbability = defaultPrefetchMinProbability
+	}
+	p.policy = policy
+}
+
+// observe records a request for a model at the specified time and returns the
+// model most likely to be requested next, along with the reference with which
+// it was last requested and the prefetch memory budget. It returns false if
+// prefetching is disabled or no model is likely enough to be requested next.
+func (p *usagePredictor) observe(target prefetchTarget, modelRef string, now time.Time) (prefetchTarget, string, uint64, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.policy.MemoryBudget == 0 {
+		return prefetchTarget{}, "", 0, false
+	}
+
+	// Record the transition from the previously requested model. Repeated
+	// requests for the same model aren't transitions.
+	if target != p.previous && !p.previousTime.IsZero() && now.Sub(p.previousTime) <= prefetchTransitionWindow {
+		if successors := p.successors[p.previous]; successors != nil {
+			if _, ok := successors.counts[target]; ok || len(successors.counts) < maximumPrefetchModels {
+				successors.counts[target]++
+				successors.total++
+			}
+		}
+	}
+	p.previous = target
+	p.previousTime = now
+	p.modelRefs[target] = modelRef
+
+	successors := p.successors[target]
+	if successors == nil {
+		p.evictLeastRecentlySeen()
+		successors = &prefetchSuccessors{counts: make(map[prefetchTarget]int)}
+		p.successors[target] = successors
+	}
+	successors.lastSeen = now
+
+	// Predict the most frequent successor.
+	if successors.total < minimumPrefetchObservations {
+		return prefetchTarget{}, "", 0, false
+	}
+	var next prefetchTarget
+	best := 0
+	for successor, count := range successors.counts {
+		if count > best {
+			next, best = successor, count
+		}
+	}
+	if float64(best)/float64(successors.total) < p.policy.MinProbability {
+		return prefetchTarget{}, "", 0, false
+	}
+	return next, p.modelRefs[next], p.policy.MemoryBudget, true
+}
+
+// evictLeastRecentlySeen stops tracking the least recently requested model if
+// the maximum number of models are tracked. The caller must hold the mutex.
+func (p *usagePredictor) evictLeastRecentlySeen() {
+	if len(p.successors) < maximumPrefetchModels {
+		return
+	}
+	var oldest prefetchTarget
+	var oldestTime time.Time
+	for target, successors := range p.successors {
+		if oldestTime.IsZero() || successors.lastSeen.Before(oldestTime) {
+			oldest, oldestTime = target, successors.lastSeen
+		}
+	}
+	delete(p.successors, oldest)
+	delete(p.modelRefs, oldest)
+}
+
+// SetPrefetchPolicy sets the speculative prefetch policy.
+func (s *Scheduler) SetPrefetchPolicy(policy PrefetchPolicy) {
+	s.predictor.setPolicy(policy)
+}
+
+// prefetchNext records a request for a model and, if another model is likely
+// to be requested next, prefetches it in the background.
+func (s *Scheduler) prefetchNext(backendName, modelID, modelRef string, mode inference.BackendMode) {
+	next, nextRef, budget, ok := s.predictor.observe(prefetchTarget{backendName, modelID, mode}, modelRef, time.Now())
+	if !ok {
+		return
+	}
+	go func() {
+		if s.loader.prefetch(context.Background(), next.backendName, next.modelID, nextRef, next.mode, budget) {
+			s.log.Infof("Prefetched %s runner for %s in %s mode after a request for %s", next.backendName, nextRef, next.mode, modelRef)
+		}
+	}()
+}
+
+// prefetch speculatively starts a runner for the specified backend, model,
+// and mode if none is loaded and one can be started immediately without
+// evicting other runners. The memory used by prefetched runners that haven't
+// been used yet, including the new runner, is limited to budget bytes. The
+// runner is released once it's ready, so it's subject to the usual idle
+// eviction. It returns whether a runner was started.
+func (l *loader) prefetch(ctx context.Context, backendName, modelID, modelRef string, mode inference.BackendMode, budget uint64) bool {
+	backend, ok := l.backends[backendName]
+	if !ok {
+		return false
+	}
+	runnerConfig, draftModelID := l.configFor(backendName, modelID, mode)
+	memory, err := l.requiredMemory(ctx, backend, modelID, runnerConfig)
+	if err != nil {
+		return false
+	}
+	loadBytes := l.modelSize(modelID)
+
+	if !l.lock(ctx) {
+		return false
+	}
+	defer l.unlock()
+
+	if !l.loadsEnabled || len(l.replicasFor(backendName, modelID, draftModelID, mode, 0)) > 0 {
+		return false
+	}
+	used := memory.RAM + memory.VRAM
+	for slot := range l.prefetched {
+		used += l.allocations[slot].RAM + l.allocations[slot].VRAM
+	}
+	if used > budget || !l.canStartWithoutEviction(memory, l.availableVRAMForLoad(), loadBytes) {
+		return false
+	}
+	slot := -1
+	for s, runner := range l.slots {
+		if runner == nil {
+			slot = s
+			break
+		}
+	}
+	if slot < 0 {
+		return false
+	}
+
+	runner, err := l.startRunner(ctx, backend, backendName, modelID, modelRef, draftModelID, mode, slot, runnerConfig, memory, loadBytes, nil)
+	if err != nil {
+		return false
+	}
+
+	// Release the runner so that it can be used or evicted, and signal any
+	// loads that have been waiting for it.
+	l.references[slot]--
+	if l.references[slot] == 0 {
+		l.prefetched[slot] = true
+		l.timestamps[slot] = time.Now()
+		select {
+		case l.idleCheck <- struct{}{}:
+		default:
+		}
+	}
+	l.broadcast()
+	return l.slots[slot] == runner
+}
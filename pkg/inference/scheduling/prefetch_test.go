@@ -0,0 +1,69 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestUsagePredictor(t *testing.T) {
+	chat := prefetchTarget{"llama.cpp", "sha256:chat", inference.BackendModeCompletion}
+	embed := prefetchTarget{"llama.cpp", "sha256:embed", inference.BackendModeEmbedding}
+	other := prefetchTarget{"llama.cpp", "sha256:other", inference.BackendModeCompletion}
+	start := time.Now()
+
+	p := newUsagePredictor()
+	if _, _, _, ok := p.observe(chat, "ai/chat", start); ok {
+		t.Error("Expected no prediction with prefetching disabled")
+	}
+	p.setPolicy(PrefetchPolicy{MemoryBudget: 1 << 30})
+
+	// Alternate between the chat and embedding models, with a repeated chat
+	// request that shouldn't count as a transition.
+	now := start
+	sequence := []prefetchTarget{chat, chat, embed, chat, embed, chat, other, chat}
+	for i, target := range sequence {
+		now = now.Add(time.Second)
+		next, ref, budget, ok := p.observe(target, "ai/"+target.modelID[7:], now)
+		if i < len(sequence)-1 {
+			if ok {
+				t.Errorf("Expected no prediction after %d observations, got %+v", i+1, next)
+			}
+			continue
+		}
+		if !ok || next != embed || ref != "ai/embed" || budget != 1<<30 {
+			t.Errorf("Expected the embedding model to be predicted, got %+v %q %d %v", next, ref, budget, ok)
+		}
+	}
+
+	// A stricter policy rejects the prediction (2 of 3 transitions).
+	p.setPolicy(PrefetchPolicy{MemoryBudget: 1 << 30, MinProbability: 0.9})
+	if next, _, _, ok := p.observe(chat, "ai/chat", now.Add(time.Second)); ok {
+		t.Errorf("Expected no prediction below the minimum probability, got %+v", next)
+	}
+
+	// Requests too far apart aren't transitions.
+	p.setPolicy(PrefetchPolicy{MemoryBudget: 1 << 30})
+	now = now.Add(time.Second + prefetchTransitionWindow + time.Second)
+	p.observe(other, "ai/other", now)
+	if _, _, _, ok := p.observe(chat, "ai/chat", now.Add(prefetchTransitionWindow+time.Second)); !ok {
+		t.Error("Expected the prediction to be unaffected by a stale transition")
+	}
+}
+
+func TestUsagePredictorEviction(t *testing.T) {
+	p := newUsagePredictor()
+	p.setPolicy(PrefetchPolicy{MemoryBudget: 1})
+	now := time.Now()
+	for i := 0; i <= maximumPrefetchModels; i++ {
+		now = now.Add(time.Second)
+		p.observe(prefetchTarget{modelID: string(rune('A' + i))}, "", now)
+	}
+	if len(p.successors) != maximumPrefetchModels {
+		t.Errorf("Expected %d tracked models, got %d", maximumPrefetchModels, len(p.successors))
+	}
+	if _, ok := p.successors[prefetchTarget{modelID: "A"}]; ok {
+		t.Error("Expected the least recently requested model to be evicted")
+	}
+}
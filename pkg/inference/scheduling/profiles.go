@@ -0,0 +1,139 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/metrics"
+)
+
+// DefaultProfile is the name of the configuration profile used by default.
+const DefaultProfile = "balanced"
+
+// Profile is a named set of coherent defaults for runner configuration and
+// request recording.
+type Profile struct {
+	// Name is the name of the profile.
+	Name string
+	// Description describes the profile's purpose.
+	Description string
+	// ContextSize is the context size of runners whose configuration doesn't
+	// specify one. A zero value means the backend's or model's default.
+	ContextSize int64
+	// Parallelism is the number of requests processed concurrently by
+	// runners whose configuration doesn't specify it. A zero value means the
+	// backend's default.
+	Parallelism int
+	// KeepAlive is the time for which idle runners are kept loaded. A zero
+	// value means the default idle timeout.
+	KeepAlive time.Duration
+	// Recording is how much of each request is recorded.
+	Recording metrics.RecordingVerbosity
+}
+
+// profiles are the available configuration profiles.
+var profiles = []Profile{
+	{
+		Name:        "dev",
+		Description: "Small contexts, serial processing, and a short keep-alive to conserve memory while developing, with full request recording for debugging",
+		ContextSize: 4096,
+		Parallelism: 1,
+		KeepAlive:   time.Minute,
+		Recording:   metrics.RecordingFull,
+	},
+	{
+		Name:        DefaultProfile,
+		Description: "Backend and model defaults with full request recording",
+		Recording:   metrics.RecordingFull,
+	},
+	{
+		Name:        "performance",
+		Description: "Large contexts, concurrent request processing, and a long keep-alive for throughput, with metadata-only request recording",
+		ContextSize: 16384,
+		Parallelism: 4,
+		KeepAlive:   30 * time.Minute,
+		Recording:   metrics.RecordingMetadata,
+	},
+}
+
+// LookupProfile returns the configuration profile with the specified name.
+func LookupProfile(name string) (Profile, error) {
+	for _, profile := range profiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+	return Profile{}, invalidf("unknown profile %q", name)
+}
+
+// info returns the API representation of the profile.
+func (p Profile) info() ProfileInfo {
+	info := ProfileInfo{
+		Name:        p.Name,
+		Description: p.Description,
+		ContextSize: p.ContextSize,
+		Parallelism: p.Parallelism,
+		Recording:   string(p.Recording),
+	}
+	if p.KeepAlive > 0 {
+		info.KeepAlive = p.KeepAlive.String()
+	}
+	return info
+}
+
+// SetProfile applies a configuration profile. Runners are restarted if the
+// profile changes their default configuration.
+func (s *Scheduler) SetProfile(ctx context.Context, profile Profile) {
+	s.profileLock.Lock()
+	defer s.profileLock.Unlock()
+	s.loader.setRunnerDefaults(ctx, inference.BackendConfiguration{
+		ContextSize: profile.ContextSize,
+		Parallelism: profile.Parallelism,
+	}, profile.KeepAlive)
+	s.openAIRecorder.SetVerbosity(profile.Recording)
+	s.profile = profile.Name
+	s.log.Infof("Using %s configuration profile", profile.Name)
+}
+
+// GetProfile returns the active configuration profile and the available
+// profiles.
+func (s *Scheduler) GetProfile(w http.ResponseWriter, _ *http.Request) {
+	s.writeProfile(w)
+}
+
+// UpdateProfile switches the active configuration profile.
+func (s *Scheduler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var profileRequest ProfileRequest
+	if !decodeAdminRequest(w, r, &profileRequest) {
+		return
+	}
+	profile, err := LookupProfile(profileRequest.Profile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.SetProfile(r.Context(), profile)
+	s.writeProfile(w)
+}
+
+// writeProfile writes the active configuration profile and the available
+// profiles as a response.
+func (s *Scheduler) writeProfile(w http.ResponseWriter) {
+	s.profileLock.Lock()
+	response := ProfileResponse{Active: s.profile}
+	s.profileLock.Unlock()
+	for _, profile := range profiles {
+		response.Profiles = append(response.Profiles, profile.info())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
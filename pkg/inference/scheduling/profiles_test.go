@@ -0,0 +1,83 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestLookupProfile(t *testing.T) {
+	for _, name := range []string{"dev", "balanced", "performance"} {
+		if profile, err := LookupProfile(name); err != nil || profile.Name != name {
+			t.Errorf("Expected profile %s, got %+v (%v)", name, profile, err)
+		}
+	}
+	if _, err := LookupProfile("turbo"); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for unknown profile, got %v", err)
+	}
+}
+
+// TestRunnerDefaults tests that runner defaults apply to unconfigured
+// settings and that changing them restarts runners.
+func TestRunnerDefaults(t *testing.T) {
+	log := createTestLogger()
+	backend := &mockBackend{name: "test-backend"}
+	sysMemInfo := &mockSystemMemoryInfo{
+		totalMemory: inference.RequiredMemory{RAM: 1 * GB, VRAM: 1 * GB},
+	}
+	loader := newLoader(log, map[string]inference.Backend{"test-backend": backend}, nil, nil, sysMemInfo)
+	ctx := context.Background()
+
+	if config := loader.runnerConfig(ctx, "test-backend", "modelX", inference.BackendModeCompletion); config != nil {
+		t.Errorf("Expected no configuration without defaults, got %+v", config)
+	}
+
+	loader.setRunnerDefaults(ctx, inference.BackendConfiguration{ContextSize: 4096, Parallelism: 2}, time.Minute)
+	if config := loader.runnerConfig(ctx, "test-backend", "modelX", inference.BackendModeCompletion); config == nil ||
+		config.ContextSize != 4096 || config.Parallelism != 2 {
+		t.Errorf("Expected defaults to apply, got %+v", config)
+	}
+	if err := loader.setRunnerConfig(ctx, "test-backend", "modelX", inference.BackendModeCompletion, inference.BackendConfiguration{ContextSize: 1024}); err != nil {
+		t.Fatalf("setRunnerConfig failed: %v", err)
+	}
+	if config := loader.runnerConfig(ctx, "test-backend", "modelX", inference.BackendModeCompletion); config == nil ||
+		config.ContextSize != 1024 || config.Parallelism != 2 {
+		t.Errorf("Expected explicit configuration to take precedence, got %+v", config)
+	}
+
+	// Install an unused runner, which should survive an idle timeout change
+	// but not a change of defaults.
+	if !loader.lock(ctx) {
+		t.Fatal("Failed to acquire loader lock")
+	}
+	key := makeRunnerKey("test-backend", "modelX", "", inference.BackendModeCompletion)
+	loader.slots[0] = createAliveTerminableMockRunner(log, backend)
+	loader.runners[key] = runnerInfo{slot: 0, modelRef: "modelX:latest"}
+	loader.timestamps[0] = time.Now()
+	loader.unlock()
+
+	loaded := func() bool {
+		if !loader.lock(ctx) {
+			t.Fatal("Failed to acquire loader lock")
+		}
+		defer loader.unlock()
+		_, ok := loader.runners[key]
+		return ok
+	}
+
+	loader.setRunnerDefaults(ctx, inference.BackendConfiguration{ContextSize: 4096, Parallelism: 2}, 0)
+	if !loaded() {
+		t.Error("Expected runner to remain loaded when defaults are unchanged")
+	}
+	if loader.runnerIdleTimeout != loader.baseRunnerIdleTimeout {
+		t.Errorf("Expected the default idle timeout to be restored, got %v", loader.runnerIdleTimeout)
+	}
+
+	loader.setRunnerDefaults(ctx, inference.BackendConfiguration{}, 0)
+	if loaded() {
+		t.Error("Expected unused runner to be restarted when defaults change")
+	}
+}
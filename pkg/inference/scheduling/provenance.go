@@ -0,0 +1,114 @@
+package scheduling
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/model-runner/pkg/inference/provenance"
+)
+
+// ProvenanceKey is the public key verifying the provenance markers of
+// responses, as returned by the provenance endpoint.
+type ProvenanceKey struct {
+	// Algorithm is the signature algorithm of markers.
+	Algorithm string `json:"algorithm"`
+	// PublicKey is the base64-encoded public key.
+	PublicKey string `json:"public_key"`
+}
+
+// VerifyProvenanceRequest is the body of a provenance verification request,
+// which specifies the content of a response, either as Response, for JSON
+// responses, or as Content, along with its marker, either as found in the
+// provenance field of the response or as the value of its provenance header or
+// trailer. The marker of a JSON response defaults to its provenance field.
+type VerifyProvenanceRequest struct {
+	Provenance *provenance.Marker `json:"provenance,omitempty"`
+	Header     string             `json:"header,omitempty"`
+	Response   json.RawMessage    `json:"response,omitempty"`
+	Content    *string            `json:"content,omitempty"`
+}
+
+// VerifyProvenanceResponse is the response to a provenance verification
+// request.
+type VerifyProvenanceResponse struct {
+	// Valid indicates whether the marker was signed by this runner for the
+	// response's content, and neither has been modified since.
+	Valid bool `json:"valid"`
+	// Provenance is the verified marker.
+	Provenance provenance.Marker `json:"provenance"`
+}
+
+// SetProvenanceSigner makes the provenance of inference responses signed by
+// signer and reported in their provenance header and field. It must be
+// called before Run.
+func (s *Scheduler) SetProvenanceSigner(signer *provenance.Signer) {
+	s.provenance = signer
+}
+
+// GetProvenanceKey returns the public key verifying the provenance markers of
+// responses.
+func (s *Scheduler) GetProvenanceKey(w http.ResponseWriter, r *http.Request) {
+	if s.provenance == nil {
+		http.Error(w, "response provenance is disabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ProvenanceKey{
+		Algorithm: provenance.Algorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(s.provenance.PublicKey()),
+	}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// VerifyProvenance verifies the provenance marker of a response.
+func (s *Scheduler) VerifyProvenance(w http.ResponseWriter, r *http.Request) {
+	if s.provenance == nil {
+		http.Error(w, "response provenance is disabled", http.StatusNotFound)
+		return
+	}
+	var request VerifyProvenanceRequest
+	if !decodeAdminRequest(w, r, &request) {
+		return
+	}
+	var content []byte
+	switch {
+	case request.Response != nil:
+		content = request.Response
+	case request.Content != nil:
+		content = []byte(*request.Content)
+	default:
+		http.Error(w, "response or content is required", http.StatusBadRequest)
+		return
+	}
+	var marker provenance.Marker
+	switch {
+	case request.Provenance != nil:
+		marker = *request.Provenance
+	case request.Header != "":
+		var err error
+		if marker, err = provenance.ParseHeader(request.Header); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		var response struct {
+			Provenance *provenance.Marker `json:"provenance"`
+		}
+		if err := json.Unmarshal(content, &response); err != nil || response.Provenance == nil {
+			http.Error(w, "provenance or header is required for responses without a provenance field", http.StatusBadRequest)
+			return
+		}
+		marker = *response.Provenance
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(VerifyProvenanceResponse{
+		Valid:      provenance.Verify(s.provenance.PublicKey(), marker, content),
+		Provenance: marker,
+	}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
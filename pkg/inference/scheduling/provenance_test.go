@@ -0,0 +1,71 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/provenance"
+)
+
+func TestVerifyProvenance(t *testing.T) {
+	backend := &mockBackend{name: "mock"}
+	s := NewScheduler(createTestLogger(), map[string]inference.Backend{"mock": backend}, backend, nil, nil, nil, nil, nil, systemMemoryInfo{})
+	signer, err := provenance.NewSigner(nil)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	s.SetProvenanceSigner(signer)
+
+	// Sign a JSON response and a stream as the scheduler would.
+	marker := provenance.Marker{Model: "sha256:abc", Runner: "mock-0", Timestamp: 1700000000}
+	serve := func(contentType, body string) *http.Response {
+		recorder := httptest.NewRecorder()
+		w := provenance.NewResponseWriter(recorder, signer, marker)
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+		if err := w.Finish(); err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		return recorder.Result()
+	}
+	response := serve("application/json", `{"choices":[{"message":{"content":"Paris"}}]}`)
+	body, _ := io.ReadAll(response.Body)
+	signed := string(body)
+	stream := "data: {\"choices\":[{\"delta\":{\"content\":\"Paris\"}}]}\n\ndata: [DONE]\n\n"
+	trailer := serve("text/event-stream", stream)
+	trailer.Body.Close()
+
+	verify := func(request VerifyProvenanceRequest) (int, bool) {
+		encoded, _ := json.Marshal(request)
+		recorder := httptest.NewRecorder()
+		s.VerifyProvenance(recorder, httptest.NewRequest(http.MethodPost, "/engines/provenance/verify", strings.NewReader(string(encoded))))
+		var result VerifyProvenanceResponse
+		json.Unmarshal(recorder.Body.Bytes(), &result)
+		return recorder.Code, result.Valid
+	}
+	content := func(s string) *string { return &s }
+	forged := strings.Replace(signed, "Paris", "Lyon", 1)
+	for _, tc := range []struct {
+		name    string
+		request VerifyProvenanceRequest
+		status  int
+		valid   bool
+	}{
+		{"response", VerifyProvenanceRequest{Response: json.RawMessage(signed)}, http.StatusOK, true},
+		{"tampered response", VerifyProvenanceRequest{Response: json.RawMessage(forged)}, http.StatusOK, false},
+		{"header", VerifyProvenanceRequest{Header: response.Header.Get(inference.ProvenanceHeader), Content: content(signed)}, http.StatusOK, true},
+		{"trailer", VerifyProvenanceRequest{Header: trailer.Trailer.Get(inference.ProvenanceHeader), Content: content(stream)}, http.StatusOK, true},
+		{"tampered stream", VerifyProvenanceRequest{Header: trailer.Trailer.Get(inference.ProvenanceHeader), Content: content(strings.Replace(stream, "Paris", "Lyon", 1))}, http.StatusOK, false},
+		{"no content", VerifyProvenanceRequest{Header: response.Header.Get(inference.ProvenanceHeader)}, http.StatusBadRequest, false},
+		{"no marker", VerifyProvenanceRequest{Content: content(stream)}, http.StatusBadRequest, false},
+	} {
+		if status, valid := verify(tc.request); status != tc.status || valid != tc.valid {
+			t.Errorf("%s: expected status %d and valid %t, got %d and %t", tc.name, tc.status, tc.valid, status, valid)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package scheduling
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Queue states reported in QueueStatus.
+const (
+	// QueueStateQueued indicates that a request is waiting for a runner.
+	QueueStateQueued = "queued"
+	// QueueStateLoading indicates that a runner is starting for a request.
+	QueueStateLoading = "loading"
+)
+
+// queueObserver receives updates about a request while it waits for a runner.
+// It's called without the loader lock held.
+type queueObserver func(status QueueStatus)
+
+// ewmaWeight is the weight given to new samples in the moving averages of
+// wait and startup durations.
+const ewmaWeight = 0.2
+
+// ewma updates a moving average of durations with a new sample.
+func ewma(average, sample time.Duration) time.Duration {
+	if average == 0 {
+		return sample
+	}
+	return average + time.Duration(ewmaWeight*float64(sample-average))
+}
+
+// queueStatus computes the queue status of the load identified by its polling
+// channel, registering it as waiting if it isn't already. The caller must hold
+// the loader lock.
+func (l *loader) queueStatus(poll chan<- struct{}) QueueStatus {
+	now := time.Now()
+	since, ok := l.waiting[poll]
+	if !ok {
+		since = now
+		l.waiting[poll] = since
+	}
+
+	status := QueueStatus{State: QueueStateQueued, Position: 1, Waiting: len(l.waiting)}
+	for other, otherSince := range l.waiting {
+		if other != poll && otherSince.Before(since) {
+			status.Position++
+		}
+	}
+	if l.averageWait > 0 {
+		estimate := time.Duration(status.Position)*l.averageWait - now.Sub(since)
+		status.EstimatedWaitSeconds = max(estimate, 0).Seconds()
+	}
+	return status
+}
+
+// loadingStatus returns the queue status of a load that's starting a runner.
+// The caller must hold the loader lock.
+func (l *loader) loadingStatus() QueueStatus {
+	return QueueStatus{
+		State:                QueueStateLoading,
+		EstimatedWaitSeconds: l.averageStartup.Seconds(),
+	}
+}
+
+// finishWait records the wait duration of the load identified by its polling
+// channel, if it had to wait. The caller must hold the loader lock.
+func (l *loader) finishWait(poll chan<- struct{}) {
+	if since, ok := l.waiting[poll]; ok {
+		l.averageWait = ewma(l.averageWait, time.Since(since))
+		delete(l.waiting, poll)
+	}
+}
+
+// queueProgressWriter is a response writer that reports the queue status of a
+// streaming request as server-sent events while it waits for a runner. Once
+// events have been sent, the response status is committed, so subsequent
+// error responses are converted to error events.
+type queueProgressWriter struct {
+	http.ResponseWriter
+	// started indicates whether the event stream has been started.
+	started bool
+	// failed indicates whether an error response is being written after the
+	// event stream was started.
+	failed bool
+	// last is the last status reported.
+	last QueueStatus
+}
+
+// report sends a queue event if the status has changed since it was last
+// reported.
+func (w *queueProgressWriter) report(status QueueStatus) {
+	// Only report changes in position or state, not estimate drift.
+	if w.started && status.State == w.last.State && status.Position == w.last.Position && status.Waiting == w.last.Waiting {
+		return
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	if !w.started {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.ResponseWriter.WriteHeader(http.StatusOK)
+		w.started = true
+	}
+	w.last = status
+	fmt.Fprintf(w.ResponseWriter, "event: queue\ndata: %s\n\n", data)
+	w.Flush()
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (w *queueProgressWriter) WriteHeader(statusCode int) {
+	if !w.started {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.failed = statusCode >= http.StatusBadRequest
+}
+
+// Write implements http.ResponseWriter.Write.
+func (w *queueProgressWriter) Write(data []byte) (int, error) {
+	if !w.failed {
+		return w.ResponseWriter.Write(data)
+	}
+	message := bytes.ReplaceAll(bytes.TrimSpace(data), []byte("\n"), []byte("\ndata: "))
+	if _, err := fmt.Fprintf(w.ResponseWriter, "event: error\ndata: %s\n\n", message); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Flush implements http.Flusher.Flush.
+func (w *queueProgressWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
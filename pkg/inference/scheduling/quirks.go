@@ -0,0 +1,54 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/model-runner/pkg/inference/quirks"
+)
+
+// Quirks returns the registry of rules describing known quirks of models,
+// whose workarounds backends apply when they load the models.
+func (s *Scheduler) Quirks() *quirks.Registry {
+	return s.quirks
+}
+
+// SetQuirks adds or replaces rules describing known quirks of models.
+func (s *Scheduler) SetQuirks(rules []quirks.Rule) error {
+	return s.quirks.Set(rules...)
+}
+
+// GetQuirks returns the effective rules describing known quirks of models:
+// the built-in rules and those added at runtime.
+func (s *Scheduler) GetQuirks(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.quirks.List()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateQuirks adds or replaces a rule describing a known quirk of models,
+// which applies to the runners started afterwards.
+func (s *Scheduler) UpdateQuirks(w http.ResponseWriter, r *http.Request) {
+	var request quirks.Rule
+	if !decodeAdminRequest(w, r, &request) {
+		return
+	}
+	if err := s.quirks.Set(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.GetQuirks(w, r)
+}
+
+// DeleteQuirk removes a rule added at runtime, restoring the built-in rule
+// with the same name, if any.
+func (s *Scheduler) DeleteQuirk(w http.ResponseWriter, r *http.Request) {
+	if !s.quirks.Remove(r.PathValue("name")) {
+		http.Error(w, "quirk rule not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
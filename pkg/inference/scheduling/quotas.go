@@ -0,0 +1,50 @@
+package scheduling
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/model-runner/pkg/middleware"
+	"github.com/docker/model-runner/pkg/quota"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+// SetQuotaLimits sets the token budgets of namespaces. Requests are accounted
+// to the namespace of their identity (see middleware.Identity), or to
+// middleware.AnonymousNamespace without access control.
+func (s *Scheduler) SetQuotaLimits(limits []quota.Limit) error {
+	return s.quotas.SetLimits(limits)
+}
+
+// SetQuotaStorage makes quota usage and usage reports persist in kv across
+// restarts and loads those persisted previously.
+func (s *Scheduler) SetQuotaStorage(kv storage.KV) error {
+	return s.quotas.SetStorage(kv)
+}
+
+// requestIdentity returns the identity of a request, which is anonymous
+// without access control.
+func requestIdentity(r *http.Request) middleware.Identity {
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		identity = middleware.Identity{Name: middleware.AnonymousNamespace}
+	}
+	if identity.Namespace == "" {
+		identity.Namespace = identity.Name
+	}
+	return identity
+}
+
+// rejectForQuota rejects a request whose namespace has used its token budget
+// with a 402 response that reports when the budget resets.
+func rejectForQuota(w http.ResponseWriter, err error) {
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		retryAfter := max(int(time.Until(exceeded.ResetAt).Seconds()), 1)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		w.Header().Set(quota.ResetHeader, exceeded.ResetAt.Format(time.RFC3339))
+	}
+	http.Error(w, err.Error(), http.StatusPaymentRequired)
+}
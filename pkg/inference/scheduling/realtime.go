@@ -0,0 +1,118 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/realtime"
+)
+
+// maximumRealtimeEventBytes is the maximum size of a realtime client event,
+// which bounds the chunks of audio appended to the input audio buffer.
+const maximumRealtimeEventBytes = 16 * 1024 * 1024
+
+// webSocketHeaders are the headers of WebSocket handshakes, which are removed
+// from the internal requests issued on behalf of realtime sessions.
+var webSocketHeaders = []string{
+	"Connection",
+	"Upgrade",
+	"Sec-WebSocket-Key",
+	"Sec-WebSocket-Version",
+	"Sec-WebSocket-Extensions",
+	"Sec-WebSocket-Protocol",
+}
+
+// serveRealtime serves a realtime session over a WebSocket, conversing with
+// the model named by the model query parameter. Responses are generated by
+// streaming chat completion requests issued on behalf of the session's
+// request, so they're scheduled, routed, and recorded like other requests.
+func (s *Scheduler) serveRealtime(w http.ResponseWriter, r *http.Request) {
+	model := r.URL.Query().Get("model")
+	if model == "" {
+		http.Error(w, "model is required", http.StatusBadRequest)
+		return
+	}
+	path := inference.InferencePrefix + "/v1/chat/completions"
+	if backend := r.PathValue("backend"); backend != "" {
+		path = inference.InferencePrefix + "/" + backend + "/v1/chat/completions"
+	}
+
+	server := websocket.Server{
+		// Origins are checked by the CORS middleware, like those of other
+		// requests.
+		Handshake: func(*websocket.Config, *http.Request) error {
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = maximumRealtimeEventBytes
+			session := realtime.NewSession(r.Context(), model, s.realtimeGenerator(r, path), s.transcriber, func(event []byte) error {
+				return websocket.Message.Send(conn, string(event))
+			})
+			defer session.Close()
+			if err := session.Start(); err != nil {
+				return
+			}
+			for {
+				var event []byte
+				if err := websocket.Message.Receive(conn, &event); err != nil {
+					return
+				}
+				if err := session.Handle(event); err != nil {
+					s.log.Warnf("Closing realtime session: %v", err)
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// realtimeGenerator returns a realtime.Generator issuing streaming chat
+// completion requests to the specified path on behalf of r.
+func (s *Scheduler) realtimeGenerator(r *http.Request, path string) realtime.Generator {
+	return func(ctx context.Context, body []byte, delta func(text string)) (realtime.Usage, error) {
+		request := newInternalRequest(r, path, body).WithContext(ctx)
+		request.Method = http.MethodPost
+		for _, header := range webSocketHeaders {
+			request.Header.Del(header)
+		}
+
+		var usage realtime.Usage
+		writer := newEventStreamWriter(func(data []byte) {
+			var chunk struct {
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+				} `json:"choices"`
+				Usage *choiceUsage `json:"usage"`
+			}
+			if json.Unmarshal(data, &chunk) != nil {
+				return
+			}
+			if chunk.Usage != nil {
+				usage = realtime.Usage{
+					TotalTokens:  chunk.Usage.TotalTokens,
+					InputTokens:  chunk.Usage.PromptTokens,
+					OutputTokens: chunk.Usage.CompletionTokens,
+				}
+			}
+			for _, choice := range chunk.Choices {
+				if choice.Delta.Content != "" {
+					delta(choice.Delta.Content)
+				}
+			}
+		})
+		s.ServeHTTP(writer, request)
+		if writer.failure != nil {
+			return usage, fmt.Errorf("chat completion request failed with status %d: %s", writer.failure.statusCode, strings.TrimSpace(writer.failure.body.String()))
+		}
+		return usage, ctx.Err()
+	}
+}
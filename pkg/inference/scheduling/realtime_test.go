@@ -0,0 +1,67 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestServeRealtime(t *testing.T) {
+	log := createTestLogger()
+	backend := &mockBackend{name: "mock", usesExternalModelMgmt: true}
+	s := NewScheduler(log, map[string]inference.Backend{"mock": backend}, backend, nil, nil, nil, nil, nil, systemMemoryInfo{})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + inference.InferencePrefix + "/v1/realtime")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected sessions without a model to be rejected, got status %d", response.StatusCode)
+	}
+
+	// Origins are checked like those of other requests.
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + inference.InferencePrefix + "/v1/realtime?model=ai/smollm2"
+	if conn, err := websocket.Dial(url, "", server.URL); err == nil {
+		conn.Close()
+		t.Fatal("Expected a session from a disallowed origin to be rejected")
+	}
+	s.RebuildRoutes([]string{server.URL})
+	conn, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var event struct {
+		Type    string `json:"type"`
+		Session struct {
+			Model        string `json:"model"`
+			Instructions string `json:"instructions"`
+		} `json:"session"`
+	}
+	if err := websocket.JSON.Receive(conn, &event); err != nil || event.Type != "session.created" || event.Session.Model != "ai/smollm2" {
+		t.Fatalf("Expected session.created for ai/smollm2, got %+v (%v)", event, err)
+	}
+	if err := websocket.Message.Send(conn, `{"type":"session.update","session":{"instructions":"Be brief."}}`); err != nil {
+		t.Fatalf("Failed to send event: %v", err)
+	}
+	if err := websocket.JSON.Receive(conn, &event); err != nil || event.Type != "session.updated" || event.Session.Instructions != "Be brief." {
+		t.Errorf("Expected session.updated, got %+v (%v)", event, err)
+	}
+	if err := websocket.Message.Send(conn, `{"type":"session.update","session":{"modalities":["audio","text"]}}`); err != nil {
+		t.Fatalf("Failed to send event: %v", err)
+	}
+	var errorEvent map[string]json.RawMessage
+	if err := websocket.JSON.Receive(conn, &errorEvent); err != nil || string(errorEvent["type"]) != `"error"` {
+		t.Errorf("Expected an error for audio output, got %v (%v)", errorEvent, err)
+	}
+}
@@ -0,0 +1,272 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/metrics"
+)
+
+var (
+	// errRequestQueueFull indicates that a request was rejected because the
+	// request queue of its model was full.
+	errRequestQueueFull = errors.New("too many requests queued for the model")
+	// errRequestQueueTimeout indicates that a request was rejected because it
+	// waited in the request queue of its model for too long.
+	errRequestQueueTimeout = errors.New("timed out waiting for the model to serve queued requests")
+)
+
+// RequestQueuePolicy limits the inference requests that each model serves
+// concurrently in each mode, across its runner replicas, queueing the others
+// rather than sending them all to its runners.
+type RequestQueuePolicy struct {
+	// MaxInFlight is the maximum number of requests that a model serves
+	// concurrently. A zero value disables queueing.
+	MaxInFlight int
+	// MaxQueueDepth is the maximum number of requests queued for a model,
+	// beyond which requests are rejected. A zero value doesn't limit the
+	// queue.
+	MaxQueueDepth int
+	// QueueTimeout is how long a request waits in the queue before it's
+	// rejected. A zero value waits until the client gives up.
+	QueueTimeout time.Duration
+}
+
+// normalize validates the policy.
+func (p *RequestQueuePolicy) normalize() error {
+	if p.MaxInFlight < 0 {
+		return fmt.Errorf("invalid maximum in-flight requests %d", p.MaxInFlight)
+	}
+	if p.MaxQueueDepth < 0 {
+		return fmt.Errorf("invalid maximum queue depth %d", p.MaxQueueDepth)
+	}
+	if p.QueueTimeout < 0 {
+		return fmt.Errorf("invalid queue timeout %s", p.QueueTimeout)
+	}
+	return nil
+}
+
+// SetRequestQueuePolicy sets the policy limiting the requests that each model
+// serves concurrently. It applies to requests received afterwards.
+func (s *Scheduler) SetRequestQueuePolicy(policy RequestQueuePolicy) error {
+	if err := policy.normalize(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requestQueuePolicy = policy
+	return nil
+}
+
+// requestQueueKey identifies the request queue of a model in a mode.
+type requestQueueKey struct {
+	backend string
+	modelID string
+	mode    inference.BackendMode
+}
+
+// requestQueue admits the requests of a model in a mode up to the maximum
+// number of in-flight requests, queueing the others in order of arrival.
+type requestQueue struct {
+	// model is the name of the model, as reported in metrics.
+	model string
+	// m protects the fields below.
+	m sync.Mutex
+	// inFlight is the number of admitted requests that haven't completed.
+	inFlight int
+	// waiting are the channels of the queued requests, in order of arrival,
+	// which are closed once the requests are admitted.
+	waiting []chan struct{}
+	// averageDuration is a moving average of the duration of admitted
+	// requests.
+	averageDuration time.Duration
+	// admitted, rejected, and timedOut count the requests that were
+	// admitted, rejected because the queue was full, and rejected because
+	// they waited too long.
+	admitted, rejected, timedOut uint64
+}
+
+// requestQueue returns the request queue of a model in a mode, creating it if
+// needed.
+func (s *Scheduler) requestQueue(key requestQueueKey, model string) *requestQueue {
+	s.requestQueuesLock.Lock()
+	defer s.requestQueuesLock.Unlock()
+	queue, ok := s.requestQueues[key]
+	if !ok {
+		queue = &requestQueue{model: model}
+		s.requestQueues[key] = queue
+	}
+	return queue
+}
+
+// admitRequest waits until a request to a model may be served according to
+// the request queue policy. If the request is admitted, the returned function
+// must be called once it completes. Otherwise, the error is
+// errRequestQueueFull, errRequestQueueTimeout, or the context's error.
+func (s *Scheduler) admitRequest(ctx context.Context, key requestQueueKey, model string) (func(), error) {
+	s.lock.RLock()
+	policy := s.requestQueuePolicy
+	s.lock.RUnlock()
+	if policy.MaxInFlight == 0 {
+		return func() {}, nil
+	}
+	queue := s.requestQueue(key, model)
+	if err := queue.acquire(ctx, policy); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	return func() { queue.release(time.Since(start)) }, nil
+}
+
+// acquire waits until the queue admits a request.
+func (q *requestQueue) acquire(ctx context.Context, policy RequestQueuePolicy) error {
+	q.m.Lock()
+	if q.inFlight < policy.MaxInFlight && len(q.waiting) == 0 {
+		q.inFlight++
+		q.admitted++
+		q.m.Unlock()
+		return nil
+	}
+	if policy.MaxQueueDepth > 0 && len(q.waiting) >= policy.MaxQueueDepth {
+		q.rejected++
+		q.m.Unlock()
+		return errRequestQueueFull
+	}
+	admitted := make(chan struct{})
+	q.waiting = append(q.waiting, admitted)
+	q.m.Unlock()
+
+	var timeout <-chan time.Time
+	if policy.QueueTimeout > 0 {
+		timer := time.NewTimer(policy.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case <-admitted:
+		return nil
+	case <-timeout:
+		err = errRequestQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.m.Lock()
+	defer q.m.Unlock()
+	if index := slices.Index(q.waiting, admitted); index >= 0 {
+		q.waiting = slices.Delete(q.waiting, index, index+1)
+		if err == errRequestQueueTimeout {
+			q.timedOut++
+		}
+		return err
+	}
+	// The request was admitted as it gave up. Serve it unless the client is
+	// gone, in which case its slot is handed to the next request.
+	if err == errRequestQueueTimeout {
+		return nil
+	}
+	q.releaseLocked(0)
+	return err
+}
+
+// release completes an admitted request that took duration, admitting the
+// next queued request, if any.
+func (q *requestQueue) release(duration time.Duration) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.releaseLocked(duration)
+}
+
+// releaseLocked implements release. The caller must hold q.m.
+func (q *requestQueue) releaseLocked(duration time.Duration) {
+	if duration > 0 {
+		q.averageDuration = ewma(q.averageDuration, duration)
+	}
+	if len(q.waiting) == 0 {
+		q.inFlight--
+		return
+	}
+	// Hand the slot over to the next request.
+	close(q.waiting[0])
+	q.waiting = q.waiting[1:]
+	q.admitted++
+}
+
+// retryAfter estimates how long a rejected request should wait before it's
+// retried, from the time it would take to serve the queued requests.
+func (q *requestQueue) retryAfter(policy RequestQueuePolicy) time.Duration {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if q.averageDuration == 0 || policy.MaxInFlight == 0 {
+		return time.Second
+	}
+	batches := float64(len(q.waiting)+1) / float64(policy.MaxInFlight)
+	return max(time.Duration(batches*float64(q.averageDuration)), time.Second)
+}
+
+// rejectQueuedRequest responds to a request that the request queue of a
+// model rejected.
+func (s *Scheduler) rejectQueuedRequest(w http.ResponseWriter, key requestQueueKey, model string, err error) {
+	if !errors.Is(err, errRequestQueueFull) && !errors.Is(err, errRequestQueueTimeout) {
+		// The client is gone.
+		return
+	}
+	s.lock.RLock()
+	policy := s.requestQueuePolicy
+	s.lock.RUnlock()
+	retryAfter := s.requestQueue(key, model).retryAfter(policy)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+// RequestQueues returns the state of the request queues of models, ordered by
+// backend, model, and mode.
+func (s *Scheduler) RequestQueues() []metrics.RequestQueueStats {
+	s.requestQueuesLock.Lock()
+	stats := make([]metrics.RequestQueueStats, 0, len(s.requestQueues))
+	for key, queue := range s.requestQueues {
+		queue.m.Lock()
+		stats = append(stats, metrics.RequestQueueStats{
+			Backend:  key.backend,
+			Model:    queue.model,
+			Mode:     key.mode.String(),
+			InFlight: queue.inFlight,
+			Queued:   len(queue.waiting),
+			Admitted: queue.admitted,
+			Rejected: queue.rejected,
+			TimedOut: queue.timedOut,
+		})
+		queue.m.Unlock()
+	}
+	s.requestQueuesLock.Unlock()
+
+	slices.SortFunc(stats, func(a, b metrics.RequestQueueStats) int {
+		if c := strings.Compare(a.Backend, b.Backend); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Model, b.Model); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Mode, b.Mode)
+	})
+	return stats
+}
+
+// GetRequestQueues returns the state of the request queues of models.
+func (s *Scheduler) GetRequestQueues(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.RequestQueues()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
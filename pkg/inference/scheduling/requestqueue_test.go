@@ -0,0 +1,92 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestRequestQueue(t *testing.T) {
+	backend := &mockBackend{name: "mock"}
+	s := NewScheduler(createTestLogger(), map[string]inference.Backend{"mock": backend}, backend, nil, nil, nil, nil, nil, systemMemoryInfo{})
+	key := requestQueueKey{backend: "mock", modelID: "sha256:model", mode: inference.BackendModeCompletion}
+	ctx := context.Background()
+
+	// Requests aren't queued without a policy.
+	if _, err := s.admitRequest(ctx, key, "model"); err != nil {
+		t.Fatalf("expected admission without a policy, got %v", err)
+	}
+	if queues := s.RequestQueues(); len(queues) != 0 {
+		t.Errorf("expected no queues without a policy, got %+v", queues)
+	}
+
+	if err := s.SetRequestQueuePolicy(RequestQueuePolicy{MaxInFlight: 1, MaxQueueDepth: 1}); err != nil {
+		t.Fatalf("SetRequestQueuePolicy failed: %v", err)
+	}
+	finish, err := s.admitRequest(ctx, key, "model")
+	if err != nil {
+		t.Fatalf("expected the first request to be admitted, got %v", err)
+	}
+
+	// The second request is queued until the first completes.
+	admitted := make(chan func())
+	go func() {
+		next, err := s.admitRequest(ctx, key, "model")
+		if err != nil {
+			t.Errorf("expected the queued request to be admitted, got %v", err)
+		}
+		admitted <- next
+	}()
+	for len(s.RequestQueues()) == 0 || s.RequestQueues()[0].Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The third request is rejected since the queue is full.
+	if _, err := s.admitRequest(ctx, key, "model"); !errors.Is(err, errRequestQueueFull) {
+		t.Errorf("expected the queue to be full, got %v", err)
+	}
+	recorder := httptest.NewRecorder()
+	s.rejectQueuedRequest(recorder, key, "model", errRequestQueueFull)
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a 429 response with Retry-After, got %d and %q", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+
+	finish()
+	next := <-admitted
+	stats := s.RequestQueues()[0]
+	if stats.Model != "model" || stats.InFlight != 1 || stats.Queued != 0 || stats.Admitted != 2 || stats.Rejected != 1 {
+		t.Errorf("unexpected queue stats %+v", stats)
+	}
+
+	// Queued requests time out.
+	if err := s.SetRequestQueuePolicy(RequestQueuePolicy{MaxInFlight: 1, QueueTimeout: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("SetRequestQueuePolicy failed: %v", err)
+	}
+	if _, err := s.admitRequest(ctx, key, "model"); !errors.Is(err, errRequestQueueTimeout) {
+		t.Errorf("expected the queued request to time out, got %v", err)
+	}
+
+	// Canceled requests leave the queue.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.admitRequest(canceled, key, "model"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the queued request to be canceled, got %v", err)
+	}
+
+	next()
+	stats = s.RequestQueues()[0]
+	if stats.InFlight != 0 || stats.Queued != 0 || stats.TimedOut != 1 {
+		t.Errorf("unexpected queue stats %+v", stats)
+	}
+
+	for _, policy := range []RequestQueuePolicy{{MaxInFlight: -1}, {MaxQueueDepth: -1}, {QueueTimeout: -time.Second}} {
+		if err := s.SetRequestQueuePolicy(policy); err == nil {
+			t.Errorf("expected policy %+v to be rejected", policy)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package scheduling
+
+import (
+	"github.com/docker/model-runner/pkg/metrics"
+	"github.com/elastic/go-sysinfo"
+	"github.com/elastic/go-sysinfo/types"
+)
+
+// EnableResourceSnapshots enables capturing a resource snapshot for each
+// recorded inference request.
+func (s *Scheduler) EnableResourceSnapshots() {
+	s.openAIRecorder.SetResourceSnapshotFunc(s.resourceSnapshot)
+}
+
+// resourceSnapshot captures a snapshot of the current resource usage. It
+// never blocks on the loader.
+func (s *Scheduler) resourceSnapshot() *metrics.ResourceSnapshot {
+	snapshot := &metrics.ResourceSnapshot{
+		PendingRequests: s.pendingRequests.Load(),
+		ActiveRequests:  s.activeRequests.Load(),
+	}
+
+	if vram, ok := s.loader.availableVRAM(); ok {
+		snapshot.AvailableVRAM = vram
+	}
+
+	host, err := sysinfo.Host()
+	if err != nil {
+		return snapshot
+	}
+	if mem, err := host.Memory(); err == nil {
+		snapshot.AvailableRAM = mem.Available
+	}
+	if loadAverage, ok := host.(types.LoadAverage); ok {
+		if info, err := loadAverage.LoadAverage(); err == nil {
+			snapshot.LoadAverage = info.One
+		}
+	}
+
+	return snapshot
+}
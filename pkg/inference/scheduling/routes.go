@@ -0,0 +1,285 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/model-runner/pkg/inference/language"
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+// compiledVirtualModel is a virtual model with its rules' patterns compiled.
+type compiledVirtualModel struct {
+	VirtualModel
+	// patterns are the compiled patterns of the rules, which are nil for
+	// rules without patterns.
+	patterns []*regexp.Regexp
+	// schemas are the compiled schemas, if any.
+	schemas *compiledModelSchemas
+}
+
+// virtualModels tracks the virtual models whose requests are routed to other
+// models.
+type virtualModels struct {
+	// mutex guards models.
+	mutex sync.Mutex
+	// models maps normalized virtual model names to virtual models.
+	models map[string]*compiledVirtualModel
+}
+
+// newVirtualModels creates an empty set of virtual models.
+func newVirtualModels() *virtualModels {
+	return &virtualModels{models: make(map[string]*compiledVirtualModel)}
+}
+
+// compileVirtualModel validates a virtual model and compiles its rules.
+func compileVirtualModel(model VirtualModel) (*compiledVirtualModel, error) {
+	if model.Name == "" {
+		return nil, invalidf("name is required")
+	}
+	model.Name = models.NormalizeModelName(model.Name)
+	var schemas *compiledModelSchemas
+	if model.Schemas != nil {
+		var err error
+		if schemas, err = compileModelSchemas(model.Schemas); err != nil {
+			return nil, err
+		}
+	}
+	if model.Cascade != nil {
+		if len(model.Rules) > 0 || model.Default != "" {
+			return nil, invalidf("cascade can't be combined with rules or default")
+		}
+		if err := validateCascade(model.Name, model.Cascade); err != nil {
+			return nil, err
+		}
+		return &compiledVirtualModel{VirtualModel: model, schemas: schemas}, nil
+	}
+	if model.Default == "" {
+		return nil, invalidf("default is required")
+	}
+	if models.NormalizeModelName(model.Default) == model.Name {
+		return nil, invalidf("default can't be the virtual model itself")
+	}
+	compiled := &compiledVirtualModel{VirtualModel: model, patterns: make([]*regexp.Regexp, len(model.Rules)), schemas: schemas}
+	for i, rule := range model.Rules {
+		if rule.Model == "" {
+			return nil, invalidf("rules[%d]: model is required", i)
+		} else if models.NormalizeModelName(rule.Model) == model.Name {
+			return nil, invalidf("rules[%d]: model can't be the virtual model itself", i)
+		}
+		if rule.Language == "" && rule.Pattern == "" {
+			return nil, invalidf("rules[%d]: language or pattern is required", i)
+		}
+		if rule.Language != "" && !language.IsSupported(rule.Language) {
+			return nil, invalidf("rules[%d]: unsupported language %q (supported: %s)", i, rule.Language, strings.Join(language.Supported(), ", "))
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, invalidf("rules[%d]: invalid pattern: %v", i, err)
+			}
+			compiled.patterns[i] = pattern
+		}
+	}
+	return compiled, nil
+}
+
+// targets returns the normalized names of the models to which a virtual model
+// routes requests.
+func (m *compiledVirtualModel) targets() []string {
+	if m.Cascade != nil {
+		return []string{models.NormalizeModelName(m.Cascade.Model), models.NormalizeModelName(m.Cascade.EscalationModel)}
+	}
+	targets := []string{models.NormalizeModelName(m.Default)}
+	for _, rule := range m.Rules {
+		targets = append(targets, models.NormalizeModelName(rule.Model))
+	}
+	return targets
+}
+
+// set adds or replaces virtual models. Virtual models can't route requests to
+// other virtual models.
+func (vm *virtualModels) set(virtualModels ...VirtualModel) error {
+	compiled := make(map[string]*compiledVirtualModel, len(virtualModels))
+	for _, model := range virtualModels {
+		c, err := compileVirtualModel(model)
+		if err != nil {
+			return err
+		}
+		compiled[c.Name] = c
+	}
+
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	isVirtual := func(name string) bool {
+		_, ok := compiled[name]
+		if !ok {
+			_, ok = vm.models[name]
+		}
+		return ok
+	}
+	for name, model := range compiled {
+		for _, target := range model.targets() {
+			if isVirtual(target) {
+				return invalidf("%s routes requests to virtual model %s", name, target)
+			}
+		}
+	}
+	for name, model := range vm.models {
+		if _, replaced := compiled[name]; replaced {
+			continue
+		}
+		for _, target := range model.targets() {
+			if _, ok := compiled[target]; ok {
+				return invalidf("%s is a target of virtual model %s", target, name)
+			}
+		}
+	}
+	for name, model := range compiled {
+		vm.models[name] = model
+	}
+	return nil
+}
+
+// remove removes a virtual model and returns whether it existed.
+func (vm *virtualModels) remove(name string) bool {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	name = models.NormalizeModelName(name)
+	_, ok := vm.models[name]
+	delete(vm.models, name)
+	return ok
+}
+
+// list returns the virtual models, sorted by name.
+func (vm *virtualModels) list() []VirtualModel {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	list := make([]VirtualModel, 0, len(vm.models))
+	for _, model := range vm.models {
+		list = append(list, model.VirtualModel)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// lookup returns the virtual model with the specified name, or nil if the model
+// isn't a virtual model.
+func (vm *virtualModels) lookup(model string) *compiledVirtualModel {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	return vm.models[models.NormalizeModelName(model)]
+}
+
+// route returns the model to which a request should be routed by the virtual
+// model's rules, based on the request's prompt. Cascades route requests to
+// their escalation model.
+func (virtual *compiledVirtualModel) route(body []byte) string {
+	if virtual.Cascade != nil {
+		return virtual.Cascade.EscalationModel
+	}
+	prompt := requestPrompt(body)
+	var detected string
+	detectedLanguage := false
+	for i, rule := range virtual.Rules {
+		if rule.Language != "" {
+			if !detectedLanguage {
+				detected, detectedLanguage = language.Detect(prompt), true
+			}
+			if detected != rule.Language {
+				continue
+			}
+		}
+		if pattern := virtual.patterns[i]; pattern != nil && !pattern.MatchString(prompt) {
+			continue
+		}
+		return rule.Model
+	}
+	return virtual.Default
+}
+
+// requestPrompt returns the text of the last user message of a chat completion
+// request, or the prompt of a completion request.
+func requestPrompt(body []byte) string {
+	var request struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		Prompt json.RawMessage `json:"prompt"`
+	}
+	if json.Unmarshal(body, &request) != nil {
+		return ""
+	}
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role == "user" {
+			return messageText(request.Messages[i].Content)
+		}
+	}
+	var prompt string
+	if json.Unmarshal(request.Prompt, &prompt) == nil {
+		return prompt
+	}
+	var prompts []string
+	if json.Unmarshal(request.Prompt, &prompts) == nil && len(prompts) > 0 {
+		return prompts[0]
+	}
+	return ""
+}
+
+// withModel returns a request body with its model replaced.
+func withModel(body []byte, model string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	fields["model"] = encoded
+	return json.Marshal(fields)
+}
+
+// SetVirtualModels adds or replaces virtual models.
+func (s *Scheduler) SetVirtualModels(virtualModels []VirtualModel) error {
+	return s.routes.set(virtualModels...)
+}
+
+// GetRoutes returns the virtual models.
+func (s *Scheduler) GetRoutes(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.routes.list()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateRoutes adds or replaces a virtual model.
+func (s *Scheduler) UpdateRoutes(w http.ResponseWriter, r *http.Request) {
+	var request VirtualModel
+	if !decodeAdminRequest(w, r, &request) {
+		return
+	}
+	if err := s.routes.set(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.GetRoutes(w, r)
+}
+
+// DeleteRoutes removes a virtual model.
+func (s *Scheduler) DeleteRoutes(w http.ResponseWriter, r *http.Request) {
+	if !s.routes.remove(r.PathValue("name")) {
+		http.Error(w, "virtual model not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestVirtualModels(t *testing.T) {
+	routes := newVirtualModels()
+	err := routes.set(VirtualModel{
+		Name: "assistant",
+		Rules: []RouteRule{
+			{Pattern: "(?m)^```|\\bfunc\\b|\\bdef\\b", Model: "ai/qwen2.5-coder"},
+			{Language: "fr", Model: "ai/mistral"},
+			{Language: "de", Pattern: "(?i)urgent", Model: "ai/gemma3"},
+		},
+		Default: "ai/smollm2",
+	})
+	if err != nil {
+		t.Fatalf("Failed to set virtual model: %v", err)
+	}
+
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{`{"messages":[{"role":"user","content":"def main(): pass"}]}`, "ai/qwen2.5-coder"},
+		{`{"messages":[{"role":"user","content":"Comment est-ce que je peux lancer le modèle ?"}]}`, "ai/mistral"},
+		{`{"messages":[{"role":"user","content":"Das ist urgent, wie kann ich das beheben?"}]}`, "ai/gemma3"},
+		{`{"messages":[{"role":"user","content":"Wie kann ich das beheben und was ist der Fehler?"}]}`, "ai/smollm2"},
+		// Only the last user message is considered.
+		{`{"messages":[{"role":"user","content":"def f(): pass"},{"role":"assistant","content":"def"},{"role":"user","content":"Thanks!"}]}`, "ai/smollm2"},
+		{`{"messages":[{"role":"user","content":[{"type":"text","text":"Que fait le code ? Je ne comprends pas."}]}]}`, "ai/mistral"},
+		{`{"prompt":"func main() {}"}`, "ai/qwen2.5-coder"},
+	}
+	for _, tt := range tests {
+		if target := routes.lookup("ai/assistant:latest").route([]byte(tt.body)); target != tt.expected {
+			t.Errorf("Expected %s to be routed to %s, got %s", tt.body, tt.expected, target)
+		}
+	}
+	if routes.lookup("ai/smollm2") != nil {
+		t.Error("Expected requests for other models not to be routed")
+	}
+
+	for _, invalid := range []VirtualModel{
+		{Name: "invalid", Default: "ai/smollm2", Rules: []RouteRule{{Model: "ai/gemma3"}}},
+		{Name: "invalid", Default: "ai/smollm2", Rules: []RouteRule{{Language: "xx", Model: "ai/gemma3"}}},
+		{Name: "invalid", Default: "ai/smollm2", Rules: []RouteRule{{Pattern: "(", Model: "ai/gemma3"}}},
+		{Name: "invalid", Rules: []RouteRule{{Pattern: "x", Model: "ai/gemma3"}}},
+		{Name: "invalid", Default: "invalid"},
+		// Virtual models can't be chained.
+		{Name: "invalid", Default: "assistant"},
+		{Name: "ai/smollm2", Default: "ai/gemma3"},
+		{Name: "invalid", Cascade: &Cascade{Model: "ai/smollm2"}},
+		{Name: "invalid", Cascade: &Cascade{Model: "ai/smollm2", EscalationModel: "smollm2"}},
+		{Name: "invalid", Cascade: &Cascade{Model: "ai/smollm2", EscalationModel: "ai/gemma3", MinConfidence: 2}},
+		{Name: "invalid", Default: "ai/smollm2", Cascade: &Cascade{Model: "ai/smollm2", EscalationModel: "ai/gemma3"}},
+	} {
+		if err := routes.set(invalid); err == nil {
+			t.Errorf("Expected error for %+v", invalid)
+		}
+	}
+	if list := routes.list(); len(list) != 1 || list[0].Name != "ai/assistant:latest" {
+		t.Errorf("Unexpected virtual models %+v", list)
+	}
+	if !routes.remove("assistant") || routes.remove("assistant") {
+		t.Error("Expected the virtual model to be removed once")
+	}
+}
+
+func TestRoutedDryRun(t *testing.T) {
+	log := createTestLogger()
+	backend := &mockBackend{name: "mock", usesExternalModelMgmt: true}
+	s := NewScheduler(log, map[string]inference.Backend{"mock": backend}, backend, nil, nil, nil, nil, nil, systemMemoryInfo{})
+
+	request := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/routes", strings.NewReader(`{"name":"assistant","rules":[{"pattern":"\\bdef\\b","model":"ai/coder"}],"default":"ai/smollm2"}`))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	request = httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/mock/v1/chat/completions", strings.NewReader(`{"model":"assistant","messages":[{"role":"user","content":"def f(): pass"}]}`))
+	request.Header.Set(inference.DryRunHeader, "1")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response DryRunResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Header().Get(inference.RoutedModelHeader) != "ai/coder" || !strings.Contains(string(response.Upstream.Body), `"model":"ai/coder"`) {
+		t.Errorf("Expected the request to be routed to ai/coder, got %s", response.Upstream.Body)
+	}
+
+	request = httptest.NewRequest(http.MethodDelete, inference.InferencePrefix+"/routes/assistant", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, request)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+}
@@ -53,6 +53,8 @@ type runner struct {
 	model string
 	// mode is the backend operation mode.
 	mode inference.BackendMode
+	// slot is the runner's slot.
+	slot int
 	// cancel terminates the runner's backend run loop.
 	cancel context.CancelFunc
 	// done is closed when the runner's backend run loop exits.
@@ -67,6 +69,8 @@ type runner struct {
 	proxyLog io.Closer
 	// openAIRecorder is used to record OpenAI API inference requests and responses.
 	openAIRecorder *metrics.OpenAIRecorder
+	// busy attributes the runner's busy time to its requests.
+	busy *busyMeter
 	// err is the error returned by the runner's backend, only valid after done is closed.
 	err error
 }
@@ -92,7 +96,11 @@ func run(
 		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
 			return dialer.DialContext(ctx, "unix", socket)
 		},
+		// The runner is the transport's only host, so keep as many idle
+		// connections to it as in total, so that bursts of concurrent small
+		// requests (e.g. from embedding pipelines) reuse their connections.
 		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   100,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
@@ -135,11 +143,16 @@ func run(
 	runCtx, runCancel := context.WithCancel(context.Background())
 	runDone := make(chan struct{})
 
+	var slots int
+	if runnerConfig != nil {
+		slots = runnerConfig.Parallelism
+	}
 	r := &runner{
 		log:            log,
 		backend:        backend,
 		model:          modelID,
 		mode:           mode,
+		slot:           slot,
 		cancel:         runCancel,
 		done:           runDone,
 		transport:      transport,
@@ -147,6 +160,7 @@ func run(
 		proxy:          proxy,
 		proxyLog:       proxyLog,
 		openAIRecorder: openAIRecorder,
+		busy:           newBusyMeter(slots),
 	}
 
 	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
@@ -3,27 +3,51 @@ package scheduling
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
+	"github.com/docker/model-runner/pkg/chargeback"
 	"github.com/docker/model-runner/pkg/distribution/distribution"
 	"github.com/docker/model-runner/pkg/distribution/types"
 	"github.com/docker/model-runner/pkg/inference"
 	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+	"github.com/docker/model-runner/pkg/inference/backends/mlx"
+	"github.com/docker/model-runner/pkg/inference/backends/mock"
+	"github.com/docker/model-runner/pkg/inference/backends/onnx"
 	"github.com/docker/model-runner/pkg/inference/backends/vllm"
+	"github.com/docker/model-runner/pkg/inference/classification"
+	"github.com/docker/model-runner/pkg/inference/embeddings"
 	"github.com/docker/model-runner/pkg/inference/memory"
 	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/inference/moderation"
+	"github.com/docker/model-runner/pkg/inference/postprocess"
+	"github.com/docker/model-runner/pkg/inference/prompttemplate"
+	"github.com/docker/model-runner/pkg/inference/provenance"
+	"github.com/docker/model-runner/pkg/inference/quirks"
+	"github.com/docker/model-runner/pkg/inference/retrieval"
 	"github.com/docker/model-runner/pkg/internal/utils"
 	"github.com/docker/model-runner/pkg/logging"
 	"github.com/docker/model-runner/pkg/metrics"
 	"github.com/docker/model-runner/pkg/middleware"
+	"github.com/docker/model-runner/pkg/quota"
+	"github.com/docker/model-runner/pkg/storage"
+	"github.com/docker/model-runner/pkg/tracing"
+	"github.com/docker/model-runner/pkg/transcription"
 	"github.com/mattn/go-shellwords"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -53,8 +77,103 @@ type Scheduler struct {
 	tracker *metrics.Tracker
 	// openAIRecorder is used to record OpenAI API inference requests and responses.
 	openAIRecorder *metrics.OpenAIRecorder
-	// lock is used to synchronize access to the scheduler's router.
+	// usage aggregates inference requests by user agent and model.
+	usage *metrics.UsageStats
+	// slowClients aggregates slow-client incidents by model.
+	slowClients *metrics.SlowClientStats
+	// inferenceStats aggregates inference traffic by model and backend.
+	inferenceStats *metrics.InferenceStats
+	// cacheStats aggregates the KV cache statistics of runners.
+	cacheStats *metrics.CacheStats
+	// tokenUsage aggregates token usage by API key and model.
+	tokenUsage *metrics.TokenUsageStats
+	// tracer traces inference requests.
+	tracer trace.Tracer
+	// quotas tracks the token usage of namespaces and enforces their
+	// budgets.
+	quotas *quota.Tracker
+	// chargeback exports usage for internal chargeback. It may be nil, in
+	// which case usage isn't exported.
+	chargeback *chargeback.Exporter
+	// idempotency caches responses to requests with idempotency keys.
+	idempotency *idempotencyCache
+	// retriever retrieves chunks for retrieval-augmented chat completion
+	// requests. It may be nil, in which case retrieval is unavailable.
+	retriever retrieval.Retriever
+	// retrievalTemplate is the template used to inject retrieved chunks into
+	// prompts.
+	retrievalTemplate *template.Template
+	// promptTemplates looks up the prompt templates referenced by chat
+	// completion requests. It may be nil, in which case prompt templates are
+	// unavailable.
+	promptTemplates prompttemplate.Store
+	// moderationModel is the classifier used by moderation requests that
+	// don't specify a model. It may be empty, in which case a model is
+	// required.
+	moderationModel string
+	// transcriber transcribes the input audio of realtime sessions. It may be
+	// nil, in which case the audio is passed to the model.
+	transcriber transcription.Transcriber
+	// predictor tracks usage patterns to prefetch the model most likely to be
+	// requested next.
+	predictor *usagePredictor
+	// maintenance tracks maintenance mode.
+	maintenance maintenance
+	// tuner tunes the parallel slot counts of models during idle periods.
+	tuner *tuner
+	// loadTests tracks synthetic load tests.
+	loadTests loadTests
+	// fixtures stores the fixtures recorded from recorded requests. It may
+	// be nil, in which case fixtures can't be recorded.
+	fixtures *mock.FixtureStore
+	// windows holds the window policies restricting when models are kept
+	// loaded and pulled.
+	windows *servingWindows
+	// routes holds the virtual models whose requests are routed to other
+	// models.
+	routes *virtualModels
+	// pipelines holds the pipelines of model calls that can be run from a
+	// single request.
+	pipelines *pipelines
+	// quirks holds the rules describing known quirks of models, whose
+	// workarounds are applied when they're loaded.
+	quirks *quirks.Registry
+	// profileLock serializes profile changes and guards profile.
+	profileLock sync.Mutex
+	// profile is the name of the active configuration profile.
+	profile string
+	// checkpoint persists the serving state across restarts. It may be nil,
+	// in which case the state isn't persisted.
+	checkpoint *checkpoint
+	// pendingRequests is the number of inference requests waiting for a
+	// runner.
+	pendingRequests atomic.Int64
+	// activeRequests is the number of inference requests being served by
+	// runners.
+	activeRequests atomic.Int64
+	// requestQueuesLock guards requestQueues.
+	requestQueuesLock sync.Mutex
+	// requestQueues are the request queues of models, by backend, model,
+	// and mode.
+	requestQueues map[requestQueueKey]*requestQueue
+	// lock is used to synchronize access to the scheduler's router and the
+	// subsequent fields.
 	lock sync.RWMutex
+	// allowedOrigins are the origins allowed by CORS.
+	allowedOrigins []string
+	// readOnly indicates that mutating endpoints are disabled.
+	readOnly bool
+	// backpressure is the policy for streams whose clients read responses
+	// slower than they're generated.
+	backpressure BackpressurePolicy
+	// provenance signs the provenance of inference responses, if set.
+	provenance *provenance.Signer
+	// jailbreak is the policy for scoring incoming prompts for jailbreak
+	// attempts.
+	jailbreak JailbreakPolicy
+	// requestQueuePolicy limits the requests that each model serves
+	// concurrently.
+	requestQueuePolicy RequestQueuePolicy
 }
 
 // NewScheduler creates a new inference scheduler.
@@ -83,6 +202,22 @@ func NewScheduler(
 		router:         http.NewServeMux(),
 		tracker:        tracker,
 		openAIRecorder: openAIRecorder,
+		usage:          metrics.NewUsageStats(metrics.DefaultMaxUserAgents),
+		slowClients:    metrics.NewSlowClientStats(),
+		inferenceStats: metrics.NewInferenceStats(),
+		cacheStats:     metrics.NewCacheStats(),
+		tokenUsage:     metrics.NewTokenUsageStats(),
+		tracer:         tracing.Tracer(nil),
+		quotas:         quota.NewTracker(log.WithField("component", "quotas")),
+		idempotency:    newIdempotencyCache(),
+		predictor:      newUsagePredictor(),
+		profile:        DefaultProfile,
+		windows:        newServingWindows(),
+		routes:         newVirtualModels(),
+		pipelines:      newPipelines(),
+		quirks:         quirks.NewRegistry(),
+		tuner:          newTuner(),
+		requestQueues:  make(map[requestQueueKey]*requestQueue),
 	}
 
 	// Register routes.
@@ -96,6 +231,24 @@ func NewScheduler(
 
 	s.RebuildRoutes(allowedOrigins)
 
+	if modelManager != nil {
+		// Restrict pulls to their windows.
+		modelManager.SetPullPolicy(func(model string) error {
+			return s.windows.pullAllowed(model, time.Now())
+		})
+	}
+
+	if handler != nil {
+		// Purge recorded requests for models that are deleted from the store.
+		handler.OnModelDeleted(openAIRecorder.PurgeModel)
+		// Report loaded state in OpenAI model listings.
+		handler.SetLoadedModelsFunc(s.loader.loadedModelIDs)
+		// Scale runner replicas on request.
+		handler.SetScaleFunc(s.scaleModel)
+		// List the workarounds applied to models when they're inspected.
+		handler.SetQuirks(s.quirks)
+	}
+
 	// Scheduler successfully initialized.
 	return s
 }
@@ -103,8 +256,29 @@ func NewScheduler(
 func (s *Scheduler) RebuildRoutes(allowedOrigins []string) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	s.allowedOrigins = allowedOrigins
+	s.rebuildHandler()
+}
+
+// SetReadOnly enables or disables read-only mode, in which the scheduler's
+// mutating endpoints (e.g. configuration changes and unloads) are disabled,
+// including when they're invoked internally by other components.
+func (s *Scheduler) SetReadOnly(readOnly bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.readOnly = readOnly
+	s.rebuildHandler()
+}
+
+// rebuildHandler rebuilds the HTTP handler that wraps the router. The caller
+// must hold the lock.
+func (s *Scheduler) rebuildHandler() {
+	handler := http.Handler(s.router)
+	if s.readOnly {
+		handler = middleware.ReadOnlyMiddleware(middleware.DefaultReadOnlyRoutes, handler)
+	}
 	// Update handlers that depend on the allowed origins.
-	s.httpHandler = middleware.CorsMiddleware(allowedOrigins, s.router)
+	s.httpHandler = middleware.CorsMiddleware(s.allowedOrigins, handler)
 }
 
 func (s *Scheduler) routeHandlers() map[string]http.HandlerFunc {
@@ -119,11 +293,17 @@ func (s *Scheduler) routeHandlers() map[string]http.HandlerFunc {
 		"POST " + inference.InferencePrefix + "/rerank",
 		"POST " + inference.InferencePrefix + "/{backend}/score",
 		"POST " + inference.InferencePrefix + "/score",
+		"POST " + inference.InferencePrefix + "/{backend}/v1/moderations",
+		"POST " + inference.InferencePrefix + "/v1/moderations",
+		"POST " + inference.InferencePrefix + "/{backend}/classify",
+		"POST " + inference.InferencePrefix + "/classify",
 	}
 	m := make(map[string]http.HandlerFunc)
 	for _, route := range openAIRoutes {
 		m[route] = s.handleOpenAIInference
 	}
+	m["GET "+inference.InferencePrefix+"/{backend}/v1/realtime"] = s.serveRealtime
+	m["GET "+inference.InferencePrefix+"/v1/realtime"] = s.serveRealtime
 
 	// Register /v1/models routes - these delegate to the model manager
 	m["GET "+inference.InferencePrefix+"/{backend}/v1/models"] = s.handleModels
@@ -132,12 +312,53 @@ func (s *Scheduler) routeHandlers() map[string]http.HandlerFunc {
 	m["GET "+inference.InferencePrefix+"/v1/models/{name...}"] = s.handleModels
 
 	m["GET "+inference.InferencePrefix+"/status"] = s.GetBackendStatus
+	m["GET "+inference.InferencePrefix+"/provenance"] = s.GetProvenanceKey
+	m["POST "+inference.InferencePrefix+"/provenance/verify"] = s.VerifyProvenance
 	m["GET "+inference.InferencePrefix+"/ps"] = s.GetRunningBackends
+	m["GET "+inference.InferencePrefix+"/loads"] = s.GetLoads
+	m["GET "+inference.InferencePrefix+"/queues"] = s.GetRequestQueues
 	m["GET "+inference.InferencePrefix+"/df"] = s.GetDiskUsage
 	m["POST "+inference.InferencePrefix+"/unload"] = s.Unload
 	m["POST "+inference.InferencePrefix+"/{backend}/_configure"] = s.Configure
 	m["POST "+inference.InferencePrefix+"/_configure"] = s.Configure
+	m["GET "+inference.InferencePrefix+"/profile"] = s.GetProfile
+	m["POST "+inference.InferencePrefix+"/profile"] = s.UpdateProfile
+	m["GET "+inference.InferencePrefix+"/maintenance"] = s.GetMaintenance
+	m["POST "+inference.InferencePrefix+"/maintenance"] = s.UpdateMaintenance
+	m["GET "+inference.InferencePrefix+"/windows"] = s.GetWindows
+	m["POST "+inference.InferencePrefix+"/windows"] = s.UpdateWindows
+	m["POST "+inference.InferencePrefix+"/pins"] = s.PinModel
+	m["DELETE "+inference.InferencePrefix+"/pins/{name...}"] = s.UnpinModel
+	m["GET "+inference.InferencePrefix+"/routes"] = s.GetRoutes
+	m["POST "+inference.InferencePrefix+"/routes"] = s.UpdateRoutes
+	m["DELETE "+inference.InferencePrefix+"/routes/{name...}"] = s.DeleteRoutes
+	m["GET "+inference.InferencePrefix+"/quirks"] = s.GetQuirks
+	m["POST "+inference.InferencePrefix+"/quirks"] = s.UpdateQuirks
+	m["DELETE "+inference.InferencePrefix+"/quirks/{name}"] = s.DeleteQuirk
+	m["GET "+inference.InferencePrefix+"/pipelines"] = s.GetPipelines
+	m["POST "+inference.InferencePrefix+"/pipelines"] = s.UpdatePipelines
+	m["DELETE "+inference.InferencePrefix+"/pipelines/{name}"] = s.DeletePipeline
+	m["POST "+inference.InferencePrefix+"/pipelines/{name}/run"] = s.RunPipeline
+	m["POST "+inference.InferencePrefix+"/tune"] = s.Tune
+	m["GET "+inference.InferencePrefix+"/benchmarks"] = s.GetBenchmarks
+	m["GET "+inference.InferencePrefix+"/benchmarks/compare"] = s.GetBenchmarkComparisons
+	m["POST "+inference.InferencePrefix+"/loadtests"] = s.StartLoadTest
+	m["GET "+inference.InferencePrefix+"/loadtests"] = s.GetLoadTests
+	m["GET "+inference.InferencePrefix+"/loadtests/{id}"] = s.GetLoadTest
+	m["DELETE "+inference.InferencePrefix+"/loadtests/{id}"] = s.CancelLoadTest
+	m["GET "+inference.InferencePrefix+"/fixtures"] = s.GetFixtures
+	m["POST "+inference.InferencePrefix+"/fixtures/_record"] = s.RecordFixtures
 	m["GET "+inference.InferencePrefix+"/requests"] = s.openAIRecorder.GetRecordsHandler()
+	m["DELETE "+inference.InferencePrefix+"/requests"] = s.openAIRecorder.ClearRecordsHandler()
+	m["DELETE "+inference.InferencePrefix+"/requests/{id}"] = s.openAIRecorder.DeleteRecordHandler()
+	m["POST "+inference.InferencePrefix+"/requests/_purge"] = s.openAIRecorder.PurgeHandler()
+	m["GET "+inference.InferencePrefix+"/requests/_export"] = s.openAIRecorder.ExportHandler()
+	m["GET "+inference.InferencePrefix+"/requests/_verify"] = s.openAIRecorder.VerifyAuditHandler()
+	m["GET "+inference.InferencePrefix+"/usage"] = s.usage.UsageHandler()
+	m["GET "+inference.InferencePrefix+"/usage/tokens"] = s.tokenUsage.Handler()
+	m["GET "+inference.InferencePrefix+"/cache"] = s.cacheStats.Handler()
+	m["GET "+inference.InferencePrefix+"/quotas"] = s.quotas.UsageHandler()
+	m["GET "+inference.InferencePrefix+"/quotas/reports"] = s.quotas.ReportsHandler()
 	return m
 }
 
@@ -159,12 +380,89 @@ func (s *Scheduler) Run(ctx context.Context) error {
 		return nil
 	})
 
+	// Start the recorded request retention sweeper.
+	workers.Go(func() error {
+		s.openAIRecorder.RunRetentionSweeper(workerCtx)
+		return nil
+	})
+
+	// Unload idle runners outside their serving windows.
+	workers.Go(func() error {
+		s.enforceServingWindows(workerCtx)
+		return nil
+	})
+
+	// Restart runners when mounted models change.
+	workers.Go(func() error {
+		s.restartChangedMounts(workerCtx)
+		return nil
+	})
+
+	// Sample the cache metrics of active runners.
+	workers.Go(func() error {
+		s.sampleCaches(workerCtx)
+		return nil
+	})
+
+	// Tune parallel slot counts during idle periods.
+	workers.Go(func() error {
+		s.runTuner(workerCtx)
+		return nil
+	})
+
+	// Reset quotas and generate usage reports as periods end.
+	workers.Go(func() error {
+		s.quotas.Run(workerCtx)
+		return nil
+	})
+
+	// Persist the serving state and start the runners restored from it, if
+	// enabled.
+	if s.checkpoint != nil {
+		workers.Go(func() error {
+			s.runCheckpoints(workerCtx)
+			return nil
+		})
+		workers.Go(func() error {
+			s.rewarm(workerCtx)
+			return nil
+		})
+	}
+
+	// Export usage for chargeback, if enabled.
+	if s.chargeback != nil {
+		workers.Go(func() error {
+			s.chargeback.Run(workerCtx)
+			return nil
+		})
+	}
+
 	// Wait for all workers to exit.
 	return workers.Wait()
 }
 
+// restartChangedMounts restarts the runners of mounted models whose files
+// change until the context is cancelled.
+func (s *Scheduler) restartChangedMounts(ctx context.Context) {
+	changes := s.modelManager.MountChanges()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case modelID := <-changes:
+			s.loader.restartModel(ctx, modelID)
+		}
+	}
+}
+
+// safetensorsBackends are the backends that serve models in safetensors
+// format, in order of preference.
+var safetensorsBackends = []string{vllm.Name, mlx.Name}
+
 // selectBackendForModel selects the appropriate backend for a model based on its format.
-// If the model is in safetensors format, it will prefer vLLM if available.
+// ONNX models are served by the ONNX backend.
+// If the model is in safetensors format, it will prefer vLLM if available, or
+// MLX if vLLM failed to install, unless one of them was requested.
 func (s *Scheduler) selectBackendForModel(model types.Model, backend inference.Backend, modelRef string) inference.Backend {
 	config, err := model.Config()
 	if err != nil {
@@ -172,11 +470,29 @@ func (s *Scheduler) selectBackendForModel(model types.Model, backend inference.B
 		return backend
 	}
 
+	if config.Format == types.FormatONNX {
+		if backend.Name() == onnx.Name {
+			return backend
+		}
+		if candidate, ok := s.backends[onnx.Name]; ok && candidate != nil && !s.installer.failed(onnx.Name) {
+			return candidate
+		}
+		s.log.Warnf("Model %s is in ONNX format but the ONNX backend is not available. "+
+			"Backend %s does not support this format and will fail at runtime.",
+			utils.SanitizeForLog(modelRef), backend.Name())
+		return backend
+	}
+
 	if config.Format == types.FormatSafetensors {
-		if vllmBackend, ok := s.backends[vllm.Name]; ok && vllmBackend != nil {
-			return vllmBackend
+		if slices.Contains(safetensorsBackends, backend.Name()) {
+			return backend
 		}
-		s.log.Warnf("Model %s is in safetensors format but vLLM backend is not available. "+
+		for _, name := range safetensorsBackends {
+			if candidate, ok := s.backends[name]; ok && candidate != nil && !s.installer.failed(name) {
+				return candidate
+			}
+		}
+		s.log.Warnf("Model %s is in safetensors format but neither the vLLM nor the MLX backend is available. "+
 			"Backend %s may not support this format and could fail at runtime.",
 			utils.SanitizeForLog(modelRef), backend.Name())
 	}
@@ -184,6 +500,15 @@ func (s *Scheduler) selectBackendForModel(model types.Model, backend inference.B
 	return backend
 }
 
+// mockBackendFor returns the mock backend if it mocks the specified model, or
+// nil otherwise.
+func (s *Scheduler) mockBackendFor(model string) inference.Backend {
+	if mockBackend, ok := s.backends[mock.Name].(*mock.Backend); ok && mockBackend.ServesModel(model) {
+		return mockBackend
+	}
+	return nil
+}
+
 // handleOpenAIInference handles scheduling and responding to OpenAI inference
 // requests, including:
 // - POST <inference-prefix>/{backend}/v1/chat/completions
@@ -192,7 +517,17 @@ func (s *Scheduler) selectBackendForModel(model types.Model, backend inference.B
 // and 2 extras:
 // - POST <inference-prefix>/{backend}/rerank
 // - POST <inference-prefix>/{backend}/score
+// - POST <inference-prefix>/{backend}/v1/moderations
+// - POST <inference-prefix>/{backend}/classify
 func (s *Scheduler) handleOpenAIInference(w http.ResponseWriter, r *http.Request) {
+	// Trace the request, continuing the client's trace, if any.
+	ctx, span := s.tracer.Start(tracing.Extract(r.Context(), r.Header), r.Method+" "+r.URL.Path,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("http.request.method", r.Method), attribute.String("url.path", r.URL.Path)),
+	)
+	defer span.End()
+	r = r.WithContext(ctx)
+
 	// Determine the requested backend and ensure that it's valid.
 	var backend inference.Backend
 	if b := r.PathValue("backend"); b == "" {
@@ -207,7 +542,8 @@ func (s *Scheduler) handleOpenAIInference(w http.ResponseWriter, r *http.Request
 
 	// Read the entire request body. We put some basic size constraints in place
 	// to avoid DoS attacks. We do this early to avoid client write timeouts.
-	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maximumOpenAIInferenceRequestSize))
+	// Large prompts are prefilled while they're being uploaded.
+	body, err := s.readRequestBody(w, r, backend)
 	if err != nil {
 		var maxBytesError *http.MaxBytesError
 		if errors.As(err, &maxBytesError) {
@@ -218,6 +554,21 @@ func (s *Scheduler) handleOpenAIInference(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Wait for maintenance to end, if in progress.
+	if err := s.maintenance.wait(r.Context()); err != nil {
+		if errors.Is(err, ErrMaintenance) {
+			rejectForMaintenance(w)
+		}
+		return
+	}
+
+	// Reject requests from namespaces that have used their token budget.
+	identity := requestIdentity(r)
+	if err := s.quotas.Check(identity.Namespace); err != nil {
+		rejectForQuota(w, err)
+		return
+	}
+
 	// Determine the backend operation mode.
 	backendMode, ok := backendModeForRequest(r.URL.Path)
 	if !ok {
@@ -231,22 +582,175 @@ func (s *Scheduler) handleOpenAIInference(w http.ResponseWriter, r *http.Request
 		http.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
+	if request.Model == "" && backendMode == inference.BackendModeClassification && s.moderationModel != "" {
+		if body, err = withModel(body, s.moderationModel); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		request.Model = s.moderationModel
+	}
 	if request.Model == "" {
 		http.Error(w, "model is required", http.StatusBadRequest)
 		return
 	}
+	span.SetAttributes(
+		attribute.String("model_runner.model", request.Model),
+		attribute.String("model_runner.backend", backend.Name()),
+		attribute.String("model_runner.mode", backendMode.String()),
+	)
+
+	// Render the prompt template referenced by a chat completion request, if
+	// any. The rendered request replaces the original one, so that it's what's
+	// validated and recorded.
+	var promptTemplateRecord *metrics.PromptTemplateRecord
+	if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		templateRequest, err := prompttemplate.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if templateRequest != nil {
+			if s.promptTemplates == nil {
+				http.Error(w, "prompt templates require the prompt template API to be enabled", http.StatusBadRequest)
+				return
+			}
+			promptTemplate, err := s.promptTemplates.PromptTemplate(templateRequest.Reference.ID)
+			if err != nil {
+				if errors.Is(err, prompttemplate.ErrTemplateNotFound) {
+					http.Error(w, err.Error(), http.StatusNotFound)
+				} else {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+			rendered, err := promptTemplate.Render(templateRequest.Reference.Variables)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if body, err = templateRequest.Apply(rendered); err != nil {
+				http.Error(w, "failed to encode request", http.StatusInternalServerError)
+				return
+			}
+			promptTemplateRecord = &metrics.PromptTemplateRecord{
+				ID:        promptTemplate.ID,
+				Name:      promptTemplate.Name,
+				Version:   promptTemplate.Version,
+				Variables: templateRequest.Reference.Variables,
+			}
+		}
+	}
+
+	// Determine whether only validation was requested.
+	dryRun, _ := strconv.ParseBool(r.Header.Get(inference.DryRunHeader))
+
+	// Serve requests for several choices, or for choices selected among
+	// several candidates or samples, by generating each choice, candidate, or
+	// sample with a separate request, since not all backends support the n
+	// and best_of parameters.
+	if strings.HasSuffix(r.URL.Path, "/completions") {
+		n, err := parseChoices(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		consistency, err := parseSelfConsistency(body, n, request.Stream)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if consistency != nil && !dryRun {
+			s.serveSelfConsistency(w, r, body, consistency)
+			return
+		}
+		bestOf, err := parseBestOf(body, n, request.Stream)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if bestOf != nil && !dryRun {
+			s.serveBestOf(w, r, body, request.Model, n, *bestOf)
+			return
+		}
+		if n > 1 && !dryRun {
+			s.serveChoices(w, r, body, n, request.Stream)
+			return
+		}
+	}
+
+	// Route requests for virtual models to the models selected by their
+	// rules, after validating them against the virtual model's schemas. The
+	// tool calls in non-streaming chat completion responses are validated
+	// too. Non-streaming chat completion requests for cascades are served by
+	// the cascade, and validated against its first model.
+	var toolCallSchemas *compiledModelSchemas
+	if virtual := s.routes.lookup(request.Model); virtual != nil {
+		if virtual.schemas != nil {
+			if err := virtual.schemas.validateRequest(body); err != nil {
+				http.Error(w, fmt.Sprintf("request doesn't match the schema of %s: %v", virtual.Name, err), http.StatusBadRequest)
+				return
+			}
+			if len(virtual.schemas.toolArguments) > 0 && !request.Stream && strings.HasSuffix(r.URL.Path, "/chat/completions") {
+				toolCallSchemas = virtual.schemas
+			}
+		}
+		target := virtual.route(body)
+		if cascade := virtual.Cascade; cascade != nil && !request.Stream && strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			if !dryRun {
+				if toolCallSchemas == nil {
+					s.serveCascade(w, r, body, cascade)
+					return
+				}
+				validator := &toolCallSchemaWriter{ResponseWriter: w, schemas: toolCallSchemas}
+				s.serveCascade(validator, r, body, cascade)
+				if err := validator.Finish(); err != nil {
+					s.log.Warnf("Failed to write cascade response: %v", err)
+				}
+				return
+			}
+			target = cascade.Model
+		}
+		if body, err = withModel(body, target); err != nil {
+			http.Error(w, "failed to encode request", http.StatusInternalServerError)
+			return
+		}
+		request.Model = target
+		w.Header().Set(inference.RoutedModelHeader, target)
+	}
+
+	// Serve requests for mocked models with the mock backend, unless another
+	// backend was requested explicitly.
+	if r.PathValue("backend") == "" {
+		if mockBackend := s.mockBackendFor(request.Model); mockBackend != nil {
+			backend = mockBackend
+		}
+	}
 
 	// Check if the shared model manager has the requested model available.
+	var model types.Model
+	var converters []func(http.ResponseWriter) responseConverter
 	if !backend.UsesExternalModelManagement() {
-		model, err := s.modelManager.GetLocal(request.Model)
+		model, err = s.modelManager.GetLocal(request.Model)
 		if err != nil {
 			if errors.Is(err, distribution.ErrModelNotFound) {
+				// Report the progress of the model's pull if it's underway.
+				if downloadErr := s.modelManager.CheckDownloading(request.Model); downloadErr != nil {
+					http.Error(w, downloadErr.Error(), http.StatusServiceUnavailable)
+					return
+				}
 				http.Error(w, err.Error(), http.StatusNotFound)
 			} else {
 				http.Error(w, "model unavailable", http.StatusInternalServerError)
 			}
 			return
 		}
+		// Reject requests for models that the client's access policy doesn't
+		// permit it to use.
+		if required := requestIdentity(r).ModelLabels; !models.MatchLabels(s.modelManager.Labels(model), required) {
+			http.Error(w, fmt.Sprintf("model %q lacks the labels required for this client: %s", request.Model, models.FormatLabels(required)), http.StatusForbidden)
+			return
+		}
+
 		// Determine the action for tracking
 		action := "inference/" + backendMode.String()
 		// Check if there's a request origin header to provide more specific tracking
@@ -260,13 +764,245 @@ func (s *Scheduler) handleOpenAIInference(w http.ResponseWriter, r *http.Request
 			}
 		}
 
-		// Non-blocking call to track the model usage.
-		s.tracker.TrackModel(model, r.UserAgent(), action)
+		// Reject requests that rely on capabilities the model lacks.
+		if err := validateCapabilities(model, request.Model, backendMode, body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Determine how the model's native output needs to be converted.
+		converters = responseConvertersForRequest(model, r.URL.Path, body)
+
+		// Non-blocking call to track the model usage, which also orders
+		// model listings by usage.
+		if !dryRun {
+			s.tracker.TrackModel(model, r.UserAgent(), action)
+			s.modelManager.RecordUsage(model)
+		}
 
 		// Automatically identify models for vLLM.
 		backend = s.selectBackendForModel(model, backend, request.Model)
 	}
 
+	// Truncate embeddings to the requested dimensions and convert them to the
+	// requested encoding format, which backends may not support, requesting
+	// full embeddings in the default format from the backend.
+	upstreamBody := body
+	var embeddingsRecord *metrics.EmbeddingsRecord
+	if backendMode == inference.BackendModeEmbedding {
+		options, rewritten, err := embeddings.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		inputs, err := embeddings.CountInputs(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		embeddingsRecord = &metrics.EmbeddingsRecord{Inputs: inputs, Dimensions: options.Dimensions, Format: string(options.Format)}
+		if options.Dimensions > 0 {
+			modelID := s.modelManager.ResolveID(request.Model)
+			runnerConfig := s.loader.runnerConfig(r.Context(), backend.Name(), modelID, backendMode)
+			if err := validateDimensions(runnerConfig, request.Model, options.Dimensions); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if options.Format != embeddings.FormatFloat || options.Dimensions > 0 {
+			upstreamBody = rewritten
+			converters = append(converters, func(w http.ResponseWriter) responseConverter {
+				return embeddings.NewResponseWriter(w, options)
+			})
+		}
+	}
+
+	// Serve moderation and classification requests by requesting the
+	// classifier's outputs as embeddings, and converting them into moderation
+	// or classification results.
+	if backendMode == inference.BackendModeClassification {
+		classificationRequest, err := classification.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		classificationRequest.Model = request.Model
+		if upstreamBody, err = classificationRequest.EmbeddingsBody(); err != nil {
+			http.Error(w, "failed to encode request", http.StatusInternalServerError)
+			return
+		}
+		detectPII := moderation.DetectsPII(body)
+		var labels []string
+		var classificationConfig *inference.ClassificationConfig
+		if model != nil {
+			if config, err := model.Config(); err == nil {
+				labels = models.ClassifierLabels(config)
+			}
+			modelID := s.modelManager.ResolveID(request.Model)
+			if runnerConfig := s.loader.runnerConfig(r.Context(), backend.Name(), modelID, backendMode); runnerConfig != nil {
+				classificationConfig = runnerConfig.Classification
+			}
+		}
+		converters = append(converters, func(w http.ResponseWriter) responseConverter {
+			return classification.NewResponseWriter(w, func(outputs [][]float64) any {
+				if strings.HasSuffix(r.URL.Path, "/classify") {
+					return classification.Classify(request.Model, labels, classificationConfig, outputs)
+				}
+				var mapping map[string]string
+				if classificationConfig != nil {
+					mapping = classificationConfig.Labels
+				}
+				response := moderation.Moderate(request.Model, labels, mapping, outputs)
+				if detectPII {
+					moderation.FlagPII(&response, classificationRequest.Inputs)
+				}
+				return response
+			})
+		})
+	}
+
+	// Serve requests that override the context size with a runner started
+	// with that context size, which backends needn't know about.
+	if request.ContextSize > 0 {
+		if err := validateContextSizeOverride(backend, model, backendMode, request.ContextSize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if upstreamBody, err = stripContextSize(upstreamBody); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Score the client's prompt for jailbreak attempts before it's altered
+	// by the model's system prompt.
+	jailbreakRecord, blocked := s.scoreJailbreak(request.Model, upstreamBody)
+	if blocked {
+		http.Error(w, "prompt rejected by the jailbreak policy", http.StatusBadRequest)
+		return
+	}
+
+	// Apply the system prompt configured for the model to chat completion
+	// requests, according to its mode and policy.
+	var systemPromptRecord *metrics.SystemPromptRecord
+	if model != nil && strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		modelID := s.modelManager.ResolveID(request.Model)
+		if runnerConfig := s.loader.runnerConfig(r.Context(), backend.Name(), modelID, backendMode); runnerConfig != nil && runnerConfig.SystemPrompt != nil {
+			if upstreamBody, systemPromptRecord, err = applySystemPrompt(runnerConfig.SystemPrompt, upstreamBody); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	// Strip the retrieval options from retrieval-augmented chat completion
+	// requests. The retrieval itself is performed once the request is
+	// scheduled.
+	var retrievalRequest *retrieval.Request
+	if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		retrievalRequest, err = retrieval.ParseRequest(upstreamBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if retrievalRequest != nil {
+			if s.retriever == nil {
+				http.Error(w, "retrieval requires the vector store API to be enabled", http.StatusBadRequest)
+				return
+			}
+			if upstreamBody, err = retrievalRequest.Body(); err != nil {
+				http.Error(w, "failed to encode request", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	// Validate the tool calls in responses to requests for virtual models
+	// with tool argument schemas, once native tool calls have been converted.
+	if toolCallSchemas != nil {
+		converters = append([]func(http.ResponseWriter) responseConverter{
+			func(w http.ResponseWriter) responseConverter {
+				return &toolCallSchemaWriter{ResponseWriter: w, schemas: toolCallSchemas}
+			},
+		}, converters...)
+	}
+
+	// Repair invalid JSON outputs to requests for structured outputs if
+	// requested. Outputs are repaired after being converted, but before
+	// citations are attached.
+	if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		var repairStrategy jsonRepairStrategy
+		repairStrategy, upstreamBody, err = parseJSONRepair(upstreamBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if repairStrategy != jsonRepairNone {
+			converters = append([]func(http.ResponseWriter) responseConverter{
+				func(w http.ResponseWriter) responseConverter {
+					return &jsonRepairWriter{
+						ResponseWriter: w,
+						strategy:       repairStrategy,
+						reask: func(content string, parseErr error) (string, error) {
+							return s.reaskJSON(r, upstreamBody, content, parseErr)
+						},
+					}
+				},
+			}, converters...)
+		}
+	}
+
+	// Strip the prompt compression option from chat completion requests. The
+	// prompt itself is compressed once it's complete.
+	var compression compressionOption
+	if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		if compression, upstreamBody, err = parseCompressionOption(upstreamBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// If only validation was requested, then report how the request would
+	// be handled instead of executing it.
+	if dryRun {
+		s.serveDryRun(w, r, backend, model, request.Model, backendMode, request.ContextSize, body, upstreamBody)
+		return
+	}
+
+	// Report queue progress to streaming clients that request it.
+	var observer queueObserver
+	if queueProgress, _ := strconv.ParseBool(r.Header.Get(inference.QueueProgressHeader)); queueProgress && request.Stream {
+		progressWriter := &queueProgressWriter{ResponseWriter: w}
+		observer = progressWriter.report
+		w = progressWriter
+	}
+
+	// Replay the response to a previous request with the same idempotency
+	// key, or reserve the key and capture the response for replay. The
+	// response is captured above the queue progress writer so that queue
+	// events aren't replayed.
+	if key := r.Header.Get(inference.IdempotencyKeyHeader); key != "" {
+		if len(key) > maximumIdempotencyKeyLength {
+			http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+			return
+		}
+		cached, err := s.idempotency.reserve(key, requestFingerprint(r, body))
+		if errors.Is(err, errIdempotencyKeyInUse) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if errors.Is(err, errIdempotencyKeyMismatch) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if cached != nil {
+			cached.replay(w)
+			return
+		}
+		recorder := &idempotencyRecorder{ResponseWriter: w}
+		w = recorder
+		defer s.idempotency.complete(r.Context(), key, recorder)
+	}
+
 	// Wait for the corresponding backend installation to complete or fail. We
 	// don't allow any requests to be scheduled for a backend until it has
 	// completed installation.
@@ -289,30 +1025,216 @@ func (s *Scheduler) handleOpenAIInference(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Ground retrieval-augmented requests in chunks retrieved from the
+	// referenced vector store and cite them in the response. This happens
+	// before a runner is requested, since retrieval requires an embedding
+	// runner.
+	var retrievalRecord *metrics.RetrievalRecord
+	if retrievalRequest != nil {
+		chunks, err := s.retriever.Retrieve(r, retrievalRequest.Options, retrievalRequest.Query)
+		if err != nil {
+			if errors.Is(err, retrieval.ErrVectorStoreNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+			} else {
+				http.Error(w, fmt.Errorf("retrieval failed: %w", err).Error(), http.StatusBadGateway)
+			}
+			return
+		}
+		citations := retrieval.Citations(retrievalRequest.Options.VectorStoreID, chunks)
+		if upstreamBody, err = retrievalRequest.Augment(s.retrievalTemplate, citations); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Citations are attached last, after the model's output has been
+		// converted.
+		converters = append([]func(http.ResponseWriter) responseConverter{
+			func(w http.ResponseWriter) responseConverter {
+				return retrieval.NewResponseWriter(w, citations)
+			},
+		}, converters...)
+		retrievalRecord = &metrics.RetrievalRecord{
+			VectorStoreID: retrievalRequest.Options.VectorStoreID,
+			Query:         retrievalRequest.Query,
+			Citations:     citations,
+			Request:       string(upstreamBody),
+		}
+	}
+
+	// Compress the prompts of conversations that exceed the model's context,
+	// if configured for the model or requested, before truncating them.
+	if model != nil && strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		compressed, stats, err := s.compressConversation(r, backend, model, request.Model, request.ContextSize, compression, upstreamBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if compressed != nil {
+			upstreamBody = compressed
+			w.Header().Set(inference.PromptCompressionHeader, stats.String())
+		}
+	}
+
+	// Truncate conversations that exceed the model's context using the
+	// model's configured truncation strategy.
+	if model != nil && strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		truncated, removed, err := s.truncateConversation(r, backend, model, request.Model, request.ContextSize, upstreamBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if truncated != nil {
+			upstreamBody = truncated
+			w.Header().Set(inference.TruncatedMessagesHeader, strconv.Itoa(removed))
+		}
+	}
+
 	modelID := s.modelManager.ResolveID(request.Model)
 
+	// Look up the post-processors configured for the model's completions.
+	var postProcessors []inference.PostProcessor
+	if backendMode == inference.BackendModeCompletion && strings.HasSuffix(r.URL.Path, "/completions") {
+		if runnerConfig := s.loader.runnerConfig(r.Context(), backend.Name(), modelID, backendMode); runnerConfig != nil {
+			postProcessors = runnerConfig.PostProcessors
+		}
+	}
+
+	// Wait for the model to serve fewer requests than its concurrency limit,
+	// rejecting the request if too many are queued or it waits too long.
+	queueKey := requestQueueKey{backend: backend.Name(), modelID: modelID, mode: backendMode}
+	finish, err := s.admitRequest(r.Context(), queueKey, models.NormalizeModelName(request.Model))
+	if err != nil {
+		s.rejectQueuedRequest(w, queueKey, models.NormalizeModelName(request.Model), err)
+		return
+	}
+	defer finish()
+
 	// Request a runner to execute the request and defer its release.
-	runner, err := s.loader.load(r.Context(), backend.Name(), modelID, request.Model, backendMode)
+	start := time.Now()
+	s.pendingRequests.Add(1)
+	dequeue := s.inferenceStats.Enqueue(backend.Name(), models.NormalizeModelName(request.Model))
+	scheduleCtx, scheduleSpan := s.tracer.Start(r.Context(), "schedule")
+	runner, err := s.loader.load(scheduleCtx, backend.Name(), modelID, request.Model, backendMode, request.ContextSize, observer)
+	endSpan(scheduleSpan, err)
+	dequeue()
+	s.pendingRequests.Add(-1)
 	if err != nil {
 		http.Error(w, fmt.Errorf("unable to load runner: %w", err).Error(), http.StatusInternalServerError)
 		return
 	}
 	defer s.loader.release(runner)
 
+	// Buffer streamed responses, so that clients reading them slower than
+	// they're generated are paused for or dropped once the buffer is full,
+	// rather than stalling the runner or growing memory. The runner is
+	// released once the buffer has been written.
+	if request.Stream {
+		buffer := s.newStreamBuffer(r, w, models.NormalizeModelName(request.Model))
+		defer buffer.finish()
+		w = buffer
+	}
+
+	// Warm the model most likely to be requested next, if any.
+	s.prefetchNext(backend.Name(), modelID, request.Model, backendMode)
+
+	// Post-process the response outside of the recorder, so that the
+	// original output is recorded.
+	if len(postProcessors) > 0 {
+		postProcessor := postprocess.NewResponseWriter(w, postProcessors)
+		defer func() {
+			if err := postProcessor.Finish(); err != nil {
+				s.log.Warnf("Unable to write post-processed response: %v", err)
+			}
+		}()
+		w = postProcessor
+	}
+
 	// Record the request in the OpenAI recorder.
 	recordID := s.openAIRecorder.RecordRequest(request.Model, r, body)
+	w.Header().Set(inference.RecordIDHeader, recordID)
+	if retrievalRecord != nil {
+		s.openAIRecorder.RecordRetrieval(recordID, request.Model, *retrievalRecord)
+	}
+	if promptTemplateRecord != nil {
+		s.openAIRecorder.RecordPromptTemplate(recordID, request.Model, *promptTemplateRecord)
+	}
+	if len(postProcessors) > 0 {
+		s.openAIRecorder.RecordPostProcessors(recordID, request.Model, postProcessors)
+	}
+	if systemPromptRecord != nil {
+		s.openAIRecorder.RecordSystemPrompt(recordID, request.Model, *systemPromptRecord)
+	}
+	if embeddingsRecord != nil {
+		s.openAIRecorder.RecordEmbeddings(recordID, request.Model, *embeddingsRecord)
+	}
+	if jailbreakRecord != nil {
+		s.openAIRecorder.RecordJailbreak(recordID, request.Model, *jailbreakRecord)
+	}
 	w = s.openAIRecorder.NewResponseRecorder(w)
+
+	// Sign the provenance of the response along with its content, after any
+	// other conversion. It's reported in a header and, for JSON responses, in a
+	// field, or in a trailer for streams.
+	if s.provenance != nil {
+		marker := provenance.Marker{
+			Model:     modelID,
+			Runner:    fmt.Sprintf("%s-%d", backend.Name(), runner.slot),
+			Timestamp: time.Now().Unix(),
+			RecordID:  recordID,
+		}
+		converters = append([]func(http.ResponseWriter) responseConverter{func(w http.ResponseWriter) responseConverter {
+			return provenance.NewResponseWriter(w, s.provenance, marker)
+		}}, converters...)
+	}
+	busyRequest := runner.busy.start()
 	defer func() {
-		// Record the response in the OpenAI recorder.
+		// Record the response in the OpenAI recorder, along with the runner's
+		// busy time attributable to the request.
+		busy := runner.busy.finish(busyRequest)
+		s.openAIRecorder.RecordBusyTime(recordID, request.Model, busy)
 		s.openAIRecorder.RecordResponse(recordID, request.Model, w)
+		s.usage.Record(r.UserAgent(), models.NormalizeModelName(request.Model), metrics.ResponseStatusCode(w))
+		s.inferenceStats.Record(backend.Name(), models.NormalizeModelName(request.Model), start, w)
+		s.cacheStats.RecordResponse(backend.Name(), models.NormalizeModelName(request.Model), modelID, backendMode.String(), w)
+		s.tokenUsage.Record(identity.Name, models.NormalizeModelName(request.Model), w)
+		statusCode := metrics.ResponseStatusCode(w)
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode), attribute.String("model_runner.record_id", recordID))
+		if statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(statusCode))
+		}
+		tokens := metrics.ResponseTokens(w)
+		s.quotas.Record(identity.Namespace, tokens)
+		if s.chargeback != nil {
+			s.chargeback.Record(identity.Namespace, identity.Name, models.NormalizeModelName(request.Model), tokens, busy)
+		}
 	}()
 
+	// Trace the call to the backend, propagating the trace context to it.
+	upstreamCtx, upstreamSpan := s.tracer.Start(r.Context(), backend.Name()+" upstream",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("model_runner.backend", backend.Name())),
+	)
+	defer upstreamSpan.End()
+
 	// Create a request with the body replaced for forwarding upstream.
-	upstreamRequest := r.Clone(r.Context())
-	upstreamRequest.Body = io.NopCloser(bytes.NewReader(body))
+	upstreamRequest := r.Clone(upstreamCtx)
+	tracing.Inject(upstreamCtx, upstreamRequest.Header)
+	upstreamRequest.URL.Path = upstreamPath(r.URL.Path)
+	upstreamRequest.Body = io.NopCloser(bytes.NewReader(upstreamBody))
+	upstreamRequest.ContentLength = int64(len(upstreamBody))
 
 	// Perform the request.
-	runner.ServeHTTP(w, upstreamRequest)
+	s.activeRequests.Add(1)
+	defer s.activeRequests.Add(-1)
+	if len(converters) == 0 {
+		runner.ServeHTTP(w, upstreamRequest)
+		return
+	}
+
+	// Convert the model's native output (e.g. tool calls or reasoning). The
+	// converters wrap the recorder so that the converted response is recorded.
+	if err := serveConverted(runner, w, upstreamRequest, converters); err != nil {
+		s.log.Warnf("Unable to write converted response: %v", err)
+	}
 }
 
 func (s *Scheduler) GetBackendStatus(w http.ResponseWriter, r *http.Request) {
@@ -331,6 +1253,80 @@ func (s *Scheduler) GetBackendStatus(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// SetRetentionPolicy sets the retention policy for recorded requests.
+func (s *Scheduler) SetRetentionPolicy(policy metrics.RetentionPolicy) {
+	s.openAIRecorder.SetRetentionPolicy(policy)
+}
+
+// SetRecordsStorage makes recorded requests persist in kv across restarts
+// and loads those recorded previously.
+func (s *Scheduler) SetRecordsStorage(kv storage.KV) error {
+	return s.openAIRecorder.SetStorage(kv)
+}
+
+// SetRecordsEncryptionKey makes the bodies of persisted records encrypted
+// with key. It must be called before SetRecordsStorage.
+func (s *Scheduler) SetRecordsEncryptionKey(key []byte) error {
+	return s.openAIRecorder.SetEncryptionKey(key)
+}
+
+// EnableRecordsAudit makes persisted records hash-chained in an audit log,
+// signed with key if it isn't nil. It must be called before SetRecordsStorage.
+func (s *Scheduler) EnableRecordsAudit(key ed25519.PrivateKey) error {
+	return s.openAIRecorder.EnableAudit(key)
+}
+
+// SetRecordsAnonymizationPolicy sets the anonymization policy applied to
+// records served by the records endpoints.
+func (s *Scheduler) SetRecordsAnonymizationPolicy(policy metrics.AnonymizationPolicy) {
+	s.openAIRecorder.SetAnonymizationPolicy(policy)
+}
+
+// SetChargebackExporter makes inference usage exported by exporter for
+// internal chargeback. It must be called before Run.
+func (s *Scheduler) SetChargebackExporter(exporter *chargeback.Exporter) {
+	s.chargeback = exporter
+}
+
+// SetMaxUserAgents sets the maximum number of distinct user agents tracked
+// for usage analytics.
+func (s *Scheduler) SetMaxUserAgents(maxUserAgents int) {
+	s.usage.SetMaxUserAgents(maxUserAgents)
+}
+
+// SetRetriever enables retrieval-augmented chat completion requests, which
+// retrieve chunks using retriever and inject them into prompts using
+// promptTemplate. If promptTemplate is nil, retrieval.DefaultTemplate is used.
+func (s *Scheduler) SetRetriever(retriever retrieval.Retriever, promptTemplate *template.Template) {
+	if promptTemplate == nil {
+		promptTemplate = template.Must(retrieval.ParseTemplate(""))
+	}
+	s.retriever = retriever
+	s.retrievalTemplate = promptTemplate
+}
+
+// SetPromptTemplates enables chat completion requests that reference prompt
+// templates, which are looked up in store.
+func (s *Scheduler) SetPromptTemplates(store prompttemplate.Store) {
+	s.promptTemplates = store
+}
+
+// SetModerationModel sets the classifier used by moderation requests that don't
+// specify a model.
+func (s *Scheduler) SetModerationModel(model string) {
+	s.moderationModel = model
+}
+
+// SetTranscriber sets the transcriber of the input audio of realtime sessions.
+func (s *Scheduler) SetTranscriber(transcriber transcription.Transcriber) {
+	s.transcriber = transcriber
+}
+
+// SetLoadLimits sets the limits on concurrent runner startups.
+func (s *Scheduler) SetLoadLimits(limits LoadLimits) {
+	s.loader.setLoadLimits(limits)
+}
+
 func (s *Scheduler) ResetInstaller(httpClient *http.Client) {
 	s.installer = newInstaller(s.log, s.backends, httpClient)
 }
@@ -346,6 +1342,17 @@ func (s *Scheduler) GetRunningBackends(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetLoads returns information about all queued and in-progress loads.
+func (s *Scheduler) GetLoads(w http.ResponseWriter, r *http.Request) {
+	loads := s.loader.loadStatuses(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(loads); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
 // GetRunningBackendsInfo returns information about all running backends as a slice
 func (s *Scheduler) GetRunningBackendsInfo(ctx context.Context) []BackendStatus {
 	return s.getLoaderStatus(ctx)
@@ -359,15 +1366,21 @@ func (s *Scheduler) getLoaderStatus(ctx context.Context) []BackendStatus {
 	defer s.loader.unlock()
 
 	result := make([]BackendStatus, 0, len(s.loader.runners))
+	replicaCounts := s.loader.replicaCounts()
 
 	for key, runnerInfo := range s.loader.runners {
 		if s.loader.slots[runnerInfo.slot] != nil {
 			status := BackendStatus{
-				BackendName: key.backend,
-				ModelName:   runnerInfo.modelRef,
-				Mode:        key.mode.String(),
-				LastUsed:    time.Time{},
-				InUse:       s.loader.references[runnerInfo.slot] > 0,
+				BackendName:       key.backend,
+				ModelName:         runnerInfo.modelRef,
+				Mode:              key.mode.String(),
+				LastUsed:          time.Time{},
+				InUse:             s.loader.references[runnerInfo.slot] > 0,
+				Replica:           key.replica,
+				Replicas:          replicaCounts[makeConfigKey(key.backend, key.modelID, key.mode)],
+				DesiredReplicas:   s.loader.desiredReplicas(key.backend, key.modelID, key.mode),
+				FittedContextSize: runnerInfo.fittedContextSize,
+				ContextSize:       key.contextSize,
 			}
 
 			if s.loader.references[runnerInfo.slot] == 0 {
@@ -474,13 +1487,59 @@ func (s *Scheduler) Configure(w http.ResponseWriter, r *http.Request) {
 		runtimeFlags = rawFlags
 	}
 
+	for _, dimensions := range configureRequest.MatryoshkaDimensions {
+		if dimensions <= 0 {
+			http.Error(w, "matryoshka dimensions must be positive", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := validateTruncationConfig(configureRequest.Truncation); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := postprocess.Validate(configureRequest.PostProcessors); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateSystemPromptConfig(configureRequest.SystemPrompt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if configureRequest.Classification != nil {
+		if err := classification.ValidateMapping(configureRequest.Classification.Labels); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if configureRequest.BackendVersion != "" {
+		if err := llamacpp.ValidateServerVersion(configureRequest.BackendVersion); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	var runnerConfig inference.BackendConfiguration
 	runnerConfig.ContextSize = configureRequest.ContextSize
 	runnerConfig.RuntimeFlags = runtimeFlags
 	runnerConfig.Speculative = configureRequest.Speculative
-
+	runnerConfig.MatryoshkaDimensions = configureRequest.MatryoshkaDimensions
+	runnerConfig.Truncation = configureRequest.Truncation
+	runnerConfig.Compression = configureRequest.Compression
+	runnerConfig.PostProcessors = configureRequest.PostProcessors
+	runnerConfig.SystemPrompt = configureRequest.SystemPrompt
+	runnerConfig.Classification = configureRequest.Classification
+	runnerConfig.BackendVersion = configureRequest.BackendVersion
+	runnerConfig.StrictContextSize = configureRequest.StrictContextSize
+	runnerConfig.KVCacheType = configureRequest.KVCacheType
+
+	// Matryoshka dimensions only apply to embedding models.
 	mode := inference.BackendModeCompletion
-	if slices.Contains(runnerConfig.RuntimeFlags, "--embeddings") {
+	if slices.Contains(runnerConfig.RuntimeFlags, "--embeddings") || len(runnerConfig.MatryoshkaDimensions) > 0 {
 		mode = inference.BackendModeEmbedding
 	}
 
@@ -491,6 +1550,14 @@ func (s *Scheduler) Configure(w http.ResponseWriter, r *http.Request) {
 		// Automatically identify models for vLLM.
 		backend = s.selectBackendForModel(model, backend, configureRequest.Model)
 	}
+	if runnerConfig.BackendVersion != "" && backend.Name() != llamacpp.Name {
+		http.Error(w, fmt.Sprintf("backend version pinning is not supported by %s", backend.Name()), http.StatusBadRequest)
+		return
+	}
+	if err := validateKVCacheType(backend.Name(), runnerConfig.KVCacheType); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	modelID := s.modelManager.ResolveID(configureRequest.Model)
 	if err := s.loader.setRunnerConfig(r.Context(), backend.Name(), modelID, mode, runnerConfig); err != nil {
 		s.log.Warnf("Failed to configure %s runner for %s (%s): %s", backend.Name(), configureRequest.Model, modelID, err)
@@ -505,6 +1572,68 @@ func (s *Scheduler) Configure(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// validateKVCacheType checks that a KV cache type is supported by a backend.
+func validateKVCacheType(backendName string, kvCacheType inference.KVCacheType) error {
+	var supported inference.KVCacheType
+	switch backendName {
+	case llamacpp.Name:
+		supported = inference.KVCacheTypeInt8
+	case vllm.Name:
+		supported = inference.KVCacheTypeFP8
+	}
+	switch kvCacheType {
+	case inference.KVCacheTypeDefault, supported:
+		return nil
+	case inference.KVCacheTypeInt8, inference.KVCacheTypeFP8:
+		return fmt.Errorf("KV cache type %q is not supported by %s", kvCacheType, backendName)
+	default:
+		return fmt.Errorf("unknown KV cache type %q", kvCacheType)
+	}
+}
+
+// scaleModel sets the desired number of runner replicas for a model.
+func (s *Scheduler) scaleModel(ctx context.Context, model types.Model, modelRef string, request models.ModelScaleRequest) (models.ModelScaleResponse, error) {
+	// Determine the requested backend and ensure that it's valid.
+	backend := s.defaultBackend
+	if request.Backend != "" {
+		backend = s.backends[request.Backend]
+		if backend == nil {
+			return models.ModelScaleResponse{}, fmt.Errorf("%w: %s", models.ErrInvalidScaleRequest, ErrBackendNotFound)
+		}
+	}
+	backend = s.selectBackendForModel(model, backend, modelRef)
+
+	var mode inference.BackendMode
+	switch request.Mode {
+	case "", "completion":
+		mode = inference.BackendModeCompletion
+	case "embedding":
+		mode = inference.BackendModeEmbedding
+	case "classification":
+		mode = inference.BackendModeClassification
+	default:
+		return models.ModelScaleResponse{}, fmt.Errorf("%w: unknown mode %q", models.ErrInvalidScaleRequest, request.Mode)
+	}
+
+	modelID, err := model.ID()
+	if err != nil {
+		return models.ModelScaleResponse{}, err
+	}
+	current, err := s.loader.setReplicas(ctx, backend.Name(), modelID, mode, request.Replicas)
+	if errors.Is(err, errInvalidReplicas) {
+		return models.ModelScaleResponse{}, fmt.Errorf("%w: %w", models.ErrInvalidScaleRequest, err)
+	} else if err != nil {
+		return models.ModelScaleResponse{}, err
+	}
+	return models.ModelScaleResponse{
+		Model:   modelRef,
+		Backend: backend.Name(),
+		Mode:    mode.String(),
+		Current: current,
+		Desired: request.Replicas,
+	}, nil
+}
+
 // GetAllActiveRunners returns information about all active runners
 func (s *Scheduler) GetAllActiveRunners() []metrics.ActiveRunner {
 	runningBackends := s.getLoaderStatus(context.Background())
@@ -541,6 +1670,38 @@ func (s *Scheduler) GetAllActiveRunners() []metrics.ActiveRunner {
 	return activeRunners
 }
 
+// UserAgentUsage returns inference usage aggregated by user agent and model.
+func (s *Scheduler) UserAgentUsage() []metrics.UserAgentUsage {
+	return s.usage.Usage()
+}
+
+// TokenUsage returns the token usage of inference requests made with an API
+// key (or other credentials, see middleware.Identity) to a model, ordered by
+// descending total tokens. Empty API keys or models match all of them.
+func (s *Scheduler) TokenUsage(apiKey, model string) []metrics.TokenUsage {
+	return s.tokenUsage.Usage(apiKey, model)
+}
+
+// InferenceTraffic returns inference traffic aggregated by model and backend.
+func (s *Scheduler) InferenceTraffic() []metrics.InferenceTraffic {
+	return s.inferenceStats.Traffic()
+}
+
+// SetTracerProvider makes inference requests traced by provider. It must be
+// called before Run.
+func (s *Scheduler) SetTracerProvider(provider trace.TracerProvider) {
+	s.tracer = tracing.Tracer(provider)
+}
+
+// endSpan ends a span, recording err, if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
 // GetLlamaCppSocket returns the Unix socket path for an active llama.cpp runner
 func (s *Scheduler) GetLlamaCppSocket() (string, error) {
 	runningBackends := s.getLoaderStatus(context.Background())
@@ -575,6 +1736,10 @@ func parseBackendMode(mode string) inference.BackendMode {
 		return inference.BackendModeCompletion
 	case "embedding":
 		return inference.BackendModeEmbedding
+	case "reranking":
+		return inference.BackendModeReranking
+	case "classification":
+		return inference.BackendModeClassification
 	default:
 		return inference.BackendModeCompletion
 	}
@@ -586,6 +1751,12 @@ func (s *Scheduler) handleModels(w http.ResponseWriter, r *http.Request) {
 	s.modelHandler.ServeHTTP(w, r)
 }
 
+// Busy returns whether any inference requests are waiting for or being served
+// by runners, allowing background work to defer to them.
+func (s *Scheduler) Busy() bool {
+	return s.pendingRequests.Load()+s.activeRequests.Load() > 0
+}
+
 // ServeHTTP implements net/http.Handler.ServeHTTP.
 func (s *Scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.lock.RLock()
@@ -1,13 +1,25 @@
 package scheduling
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/docker/model-runner/pkg/distribution/types"
 	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+	"github.com/docker/model-runner/pkg/inference/backends/mlx"
+	"github.com/docker/model-runner/pkg/inference/backends/onnx"
+	"github.com/docker/model-runner/pkg/inference/backends/vllm"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type systemMemoryInfo struct{}
@@ -56,3 +68,168 @@ func TestCors(t *testing.T) {
 		})
 	}
 }
+
+func TestIdempotencyCache(t *testing.T) {
+	cache := newIdempotencyCache()
+	request := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	body := []byte(`{"model":"ai/smollm2"}`)
+	fingerprint := requestFingerprint(request, body)
+
+	// respond completes the reservation of key with the specified response.
+	respond := func(ctx context.Context, key string, statusCode int, response string) {
+		recorder := &idempotencyRecorder{ResponseWriter: httptest.NewRecorder()}
+		recorder.Header().Set("Content-Type", "application/json")
+		recorder.WriteHeader(statusCode)
+		recorder.Write([]byte(response))
+		cache.complete(ctx, key, recorder)
+	}
+
+	if cached, err := cache.reserve("key", fingerprint); cached != nil || err != nil {
+		t.Fatalf("Expected key to be reserved, got %v (%v)", cached, err)
+	}
+	if _, err := cache.reserve("key", fingerprint); !errors.Is(err, errIdempotencyKeyInUse) {
+		t.Errorf("Expected errIdempotencyKeyInUse, got %v", err)
+	}
+	respond(context.Background(), "key", http.StatusOK, `{"id":"1"}`)
+
+	cached, err := cache.reserve("key", fingerprint)
+	if err != nil || cached == nil {
+		t.Fatalf("Expected cached response, got %v (%v)", cached, err)
+	}
+	w := httptest.NewRecorder()
+	cached.replay(w)
+	if w.Code != http.StatusOK || w.Body.String() != `{"id":"1"}` || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Unexpected replayed response: %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+
+	other := requestFingerprint(request, []byte(`{"model":"ai/gemma3"}`))
+	if _, err := cache.reserve("key", other); !errors.Is(err, errIdempotencyKeyMismatch) {
+		t.Errorf("Expected errIdempotencyKeyMismatch, got %v", err)
+	}
+
+	// Failed and canceled requests release their keys for retries.
+	cache.reserve("failed", fingerprint)
+	respond(context.Background(), "failed", http.StatusInternalServerError, "error")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	cache.reserve("canceled", fingerprint)
+	respond(canceled, "canceled", http.StatusOK, "partial")
+	for _, key := range []string{"failed", "canceled"} {
+		if cached, err := cache.reserve(key, fingerprint); cached != nil || err != nil {
+			t.Errorf("Expected key %q to be reservable again, got %v (%v)", key, cached, err)
+		}
+	}
+
+	// The cache is bounded, evicting the oldest completed entries first.
+	for i := range maximumIdempotencyEntries {
+		key := "bulk-" + strings.Repeat("x", i)
+		cache.reserve(key, fingerprint)
+		respond(context.Background(), key, http.StatusOK, "{}")
+	}
+	if len(cache.entries) > maximumIdempotencyEntries {
+		t.Errorf("Expected at most %d entries, got %d", maximumIdempotencyEntries, len(cache.entries))
+	}
+	if _, ok := cache.entries["key"]; ok {
+		t.Error("Expected the oldest entry to be evicted")
+	}
+}
+
+func TestValidateKVCacheType(t *testing.T) {
+	tests := []struct {
+		backend     string
+		kvCacheType inference.KVCacheType
+		valid       bool
+	}{
+		{backend: llamacpp.Name, kvCacheType: inference.KVCacheTypeDefault, valid: true},
+		{backend: llamacpp.Name, kvCacheType: inference.KVCacheTypeInt8, valid: true},
+		{backend: llamacpp.Name, kvCacheType: inference.KVCacheTypeFP8},
+		{backend: vllm.Name, kvCacheType: inference.KVCacheTypeFP8, valid: true},
+		{backend: vllm.Name, kvCacheType: inference.KVCacheTypeInt8},
+		{backend: "mlx", kvCacheType: inference.KVCacheTypeDefault, valid: true},
+		{backend: "mlx", kvCacheType: inference.KVCacheTypeInt8},
+		{backend: llamacpp.Name, kvCacheType: "q4"},
+	}
+	for _, tt := range tests {
+		if err := validateKVCacheType(tt.backend, tt.kvCacheType); (err == nil) != tt.valid {
+			t.Errorf("%s with %q: expected valid %t, got %v", tt.backend, tt.kvCacheType, tt.valid, err)
+		}
+	}
+}
+
+func TestSelectBackendForModel(t *testing.T) {
+	llamaCpp := &mockBackend{name: llamacpp.Name}
+	vllmBackend := &mockBackend{name: vllm.Name}
+	mlxBackend := &mockBackend{name: mlx.Name}
+	onnxBackend := &mockBackend{name: onnx.Name}
+	s := NewScheduler(createTestLogger(), map[string]inference.Backend{
+		llamacpp.Name: llamaCpp,
+		vllm.Name:     vllmBackend,
+		mlx.Name:      mlxBackend,
+		onnx.Name:     onnxBackend,
+	}, llamaCpp, nil, nil, nil, nil, nil, systemMemoryInfo{})
+	gguf := &capabilityModel{config: types.Config{Format: types.FormatGGUF}}
+	safetensors := &capabilityModel{config: types.Config{Format: types.FormatSafetensors}}
+	onnxModel := &capabilityModel{config: types.Config{Format: types.FormatONNX}}
+
+	if backend := s.selectBackendForModel(gguf, llamaCpp, "ai/smollm2"); backend != llamaCpp {
+		t.Errorf("Expected llama.cpp for a GGUF model, got %s", backend.Name())
+	}
+	if backend := s.selectBackendForModel(safetensors, llamaCpp, "ai/smollm2"); backend != vllmBackend {
+		t.Errorf("Expected vLLM for a safetensors model, got %s", backend.Name())
+	}
+	if backend := s.selectBackendForModel(safetensors, mlxBackend, "ai/smollm2"); backend != mlxBackend {
+		t.Errorf("Expected the requested MLX backend to be kept, got %s", backend.Name())
+	}
+	if backend := s.selectBackendForModel(onnxModel, llamaCpp, "ai/sentiment-classifier"); backend != onnxBackend {
+		t.Errorf("Expected the ONNX backend for an ONNX model, got %s", backend.Name())
+	}
+
+	// Fall back to MLX if vLLM failed to install.
+	close(s.installer.statuses[vllm.Name].failed)
+	if backend := s.selectBackendForModel(safetensors, llamaCpp, "ai/smollm2"); backend != mlxBackend {
+		t.Errorf("Expected MLX when vLLM failed to install, got %s", backend.Name())
+	}
+	close(s.installer.statuses[mlx.Name].failed)
+	if backend := s.selectBackendForModel(safetensors, llamaCpp, "ai/smollm2"); backend != llamaCpp {
+		t.Errorf("Expected the default backend when no safetensors backend is available, got %s", backend.Name())
+	}
+}
+
+func TestTracing(t *testing.T) {
+	backend := &mockBackend{name: "mock", usesExternalModelMgmt: true}
+	s := NewScheduler(createTestLogger(), map[string]inference.Backend{"mock": backend}, backend, nil, nil, nil, nil, nil, systemMemoryInfo{})
+	spans := tracetest.NewSpanRecorder()
+	s.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+
+	// Requests continue the trace propagated by clients.
+	request := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/mock/v1/chat/completions", strings.NewReader(`{"model":"ai/smollm2","messages":[{"role":"user","content":"Hi"}]}`))
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929b0e0e4736-00f067aa0ba902b7-01")
+	request.Header.Set(inference.DryRunHeader, "1")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("Expected a single span, got %d", len(ended))
+	}
+	span := ended[0]
+	if span.Name() != "POST "+inference.InferencePrefix+"/mock/v1/chat/completions" || span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Unexpected span %s of kind %s", span.Name(), span.SpanKind())
+	}
+	if traceID := span.SpanContext().TraceID().String(); traceID != "4bf92f3577b34da6a3ce929b0e0e4736" {
+		t.Errorf("Expected the client's trace to be continued, got trace %s", traceID)
+	}
+	if parent := span.Parent().SpanID().String(); parent != "00f067aa0ba902b7" {
+		t.Errorf("Expected the client's span as parent, got %s", parent)
+	}
+	attributes := make(map[attribute.Key]string)
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value.Emit()
+	}
+	if attributes["model_runner.model"] != "ai/smollm2" || attributes["model_runner.backend"] != "mock" {
+		t.Errorf("Unexpected span attributes %v", attributes)
+	}
+}
@@ -0,0 +1,569 @@
+package scheduling
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonSchema is a compiled JSON schema that validates JSON values. It supports
+// the validation keywords that describe types, objects, arrays, strings,
+// numbers, and their combinations, along with local references. Other
+// keywords, such as format, are ignored.
+type jsonSchema struct {
+	// root is the decoded schema.
+	root any
+	// patterns maps the schema's pattern and patternProperties regular
+	// expressions to their compiled forms.
+	patterns map[string]*regexp.Regexp
+}
+
+// compileJSONSchema compiles a JSON schema for validation.
+func compileJSONSchema(raw json.RawMessage) (*jsonSchema, error) {
+	var root any
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, errors.New("schema isn't valid JSON")
+	}
+	schema := &jsonSchema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := schema.compile(root, "#"); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// compile checks a schema node at the specified location, compiling its
+// patterns and resolving its references.
+func (s *jsonSchema) compile(node any, location string) error {
+	if _, ok := node.(bool); ok {
+		return nil
+	}
+	schema, ok := node.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s: schema must be an object or a boolean", location)
+	}
+	compilePattern := func(pattern, location string) error {
+		if _, ok := s.patterns[pattern]; ok {
+			return nil
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %v", location, err)
+		}
+		s.patterns[pattern] = compiled
+		return nil
+	}
+	for keyword, value := range schema {
+		var err error
+		switch keyword {
+		case "properties", "patternProperties", "$defs", "definitions":
+			subschemas, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s/%s: must be an object", location, keyword)
+			}
+			for name, subschema := range subschemas {
+				if keyword == "patternProperties" {
+					if err := compilePattern(name, location+"/"+keyword); err != nil {
+						return err
+					}
+				}
+				if err := s.compile(subschema, location+"/"+keyword+"/"+name); err != nil {
+					return err
+				}
+			}
+		case "anyOf", "oneOf", "allOf", "prefixItems", "items":
+			subschemas, ok := value.([]any)
+			if !ok {
+				if keyword == "items" {
+					err = s.compile(value, location+"/items")
+					break
+				}
+				return fmt.Errorf("%s/%s: must be an array", location, keyword)
+			}
+			for i, subschema := range subschemas {
+				if err := s.compile(subschema, fmt.Sprintf("%s/%s/%d", location, keyword, i)); err != nil {
+					return err
+				}
+			}
+		case "additionalProperties", "additionalItems", "not", "contains", "propertyNames":
+			err = s.compile(value, location+"/"+keyword)
+		case "pattern":
+			pattern, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s/pattern: must be a string", location)
+			}
+			err = compilePattern(pattern, location+"/pattern")
+		case "$ref":
+			ref, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s/$ref: must be a string", location)
+			} else if _, resolveErr := resolveSchemaRef(s.root, ref); resolveErr != nil {
+				return fmt.Errorf("%s/$ref: %w", location, resolveErr)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate validates a decoded JSON value, returning an error describing the
+// location of the first violation found and how the value violates the
+// schema.
+func (s *jsonSchema) validate(value any) error {
+	return s.validateNode(s.root, value, "#", 0)
+}
+
+// maximumSchemaDepth bounds the nesting of schema references followed while
+// validating a value, so that recursive schemas can't recurse indefinitely.
+const maximumSchemaDepth = 64
+
+// validateNode validates a value at the specified location against a schema
+// node.
+func (s *jsonSchema) validateNode(node, value any, location string, depth int) error {
+	if depth > maximumSchemaDepth {
+		return fmt.Errorf("%s: schema is nested too deeply", location)
+	}
+	if allowed, ok := node.(bool); ok {
+		if !allowed {
+			return fmt.Errorf("%s: no value is allowed", location)
+		}
+		return nil
+	}
+	schema, _ := node.(map[string]any)
+
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := resolveSchemaRef(s.root, ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+		if err := s.validateNode(resolved, value, location, depth+1); err != nil {
+			return err
+		}
+	}
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		return fmt.Errorf("%s: expected %s, got %s", location, describeTypes(types), jsonType(value))
+	}
+	if expected, ok := schema["const"]; ok && !reflect.DeepEqual(expected, value) {
+		return fmt.Errorf("%s: must be %s", location, encodeValue(expected))
+	}
+	if values, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(values, func(v any) bool { return reflect.DeepEqual(v, value) }) {
+		encoded := make([]string, len(values))
+		for i, v := range values {
+			encoded[i] = encodeValue(v)
+		}
+		return fmt.Errorf("%s: must be one of %s", location, strings.Join(encoded, ", "))
+	}
+
+	var err error
+	switch v := value.(type) {
+	case map[string]any:
+		err = s.validateObject(schema, v, location, depth)
+	case []any:
+		err = s.validateArray(schema, v, location, depth)
+	case string:
+		err = s.validateString(schema, v, location)
+	case float64:
+		err = validateNumber(schema, v, location)
+	}
+	if err != nil {
+		return err
+	}
+
+	if subschemas, ok := schema["allOf"].([]any); ok {
+		for _, subschema := range subschemas {
+			if err := s.validateNode(subschema, value, location, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if subschemas, ok := schema["anyOf"].([]any); ok {
+		if matches, firstErr := s.countMatches(subschemas, value, location, depth); matches == 0 {
+			return fmt.Errorf("%s: doesn't match any of the allowed schemas (%v)", location, firstErr)
+		}
+	}
+	if subschemas, ok := schema["oneOf"].([]any); ok {
+		if matches, firstErr := s.countMatches(subschemas, value, location, depth); matches == 0 {
+			return fmt.Errorf("%s: doesn't match any of the allowed schemas (%v)", location, firstErr)
+		} else if matches > 1 {
+			return fmt.Errorf("%s: matches %d schemas instead of exactly one", location, matches)
+		}
+	}
+	if subschema, ok := schema["not"]; ok && s.validateNode(subschema, value, location, depth+1) == nil {
+		return fmt.Errorf("%s: matches a disallowed schema", location)
+	}
+	return nil
+}
+
+// countMatches returns the number of subschemas that a value matches, along
+// with the error of the first subschema that it doesn't match.
+func (s *jsonSchema) countMatches(subschemas []any, value any, location string, depth int) (int, error) {
+	var matches int
+	var firstErr error
+	for _, subschema := range subschemas {
+		if err := s.validateNode(subschema, value, location, depth+1); err == nil {
+			matches++
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return matches, firstErr
+}
+
+// validateObject validates the properties of an object.
+func (s *jsonSchema) validateObject(schema, object map[string]any, location string, depth int) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, present := object[name]; !present {
+					return fmt.Errorf("%s: missing required property %q", location, name)
+				}
+			}
+		}
+	}
+	if err := checkBounds(schema, "minProperties", "maxProperties", len(object), "properties", location); err != nil {
+		return err
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	patternProperties, _ := schema["patternProperties"].(map[string]any)
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		propertyLocation := location + "/" + escapePointerToken(name)
+		if propertyNames, ok := schema["propertyNames"]; ok {
+			if err := s.validateNode(propertyNames, name, propertyLocation, depth+1); err != nil {
+				return err
+			}
+		}
+		matched := false
+		if subschema, ok := properties[name]; ok {
+			matched = true
+			if err := s.validateNode(subschema, object[name], propertyLocation, depth+1); err != nil {
+				return err
+			}
+		}
+		for pattern, subschema := range patternProperties {
+			if s.patterns[pattern].MatchString(name) {
+				matched = true
+				if err := s.validateNode(subschema, object[name], propertyLocation, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		if additional, ok := schema["additionalProperties"]; ok && !matched {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				return fmt.Errorf("%s: unexpected property %q", location, name)
+			}
+			if err := s.validateNode(additional, object[name], propertyLocation, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateArray validates the items of an array.
+func (s *jsonSchema) validateArray(schema map[string]any, array []any, location string, depth int) error {
+	if err := checkBounds(schema, "minItems", "maxItems", len(array), "items", location); err != nil {
+		return err
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := range array {
+			for j := range i {
+				if reflect.DeepEqual(array[i], array[j]) {
+					return fmt.Errorf("%s: items %d and %d are equal", location, j, i)
+				}
+			}
+		}
+	}
+
+	// Items are validated against the schema at their position, if any, and
+	// the remaining items against the schema for additional items.
+	prefixItems, _ := schema["prefixItems"].([]any)
+	additional, hasAdditional := schema["items"]
+	if tuple, ok := additional.([]any); ok {
+		prefixItems = tuple
+		additional, hasAdditional = schema["additionalItems"]
+	}
+	for i, item := range array {
+		itemLocation := fmt.Sprintf("%s/%d", location, i)
+		var err error
+		if i < len(prefixItems) {
+			err = s.validateNode(prefixItems[i], item, itemLocation, depth+1)
+		} else if hasAdditional {
+			err = s.validateNode(additional, item, itemLocation, depth+1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if contains, ok := schema["contains"]; ok {
+		if !slices.ContainsFunc(array, func(item any) bool { return s.validateNode(contains, item, location, depth+1) == nil }) {
+			return fmt.Errorf("%s: no item matches the contains schema", location)
+		}
+	}
+	return nil
+}
+
+// validateString validates the length and pattern of a string.
+func (s *jsonSchema) validateString(schema map[string]any, value, location string) error {
+	if err := checkBounds(schema, "minLength", "maxLength", utf8.RuneCountInString(value), "characters", location); err != nil {
+		return err
+	}
+	if pattern, ok := schema["pattern"].(string); ok && !s.patterns[pattern].MatchString(value) {
+		return fmt.Errorf("%s: %q doesn't match pattern %q", location, value, pattern)
+	}
+	return nil
+}
+
+// validateNumber validates the range of a number.
+func validateNumber(schema map[string]any, value float64, location string) error {
+	if minimum, ok := schema["minimum"].(float64); ok && value < minimum {
+		return fmt.Errorf("%s: %g is less than the minimum of %g", location, value, minimum)
+	}
+	if maximum, ok := schema["maximum"].(float64); ok && value > maximum {
+		return fmt.Errorf("%s: %g is greater than the maximum of %g", location, value, maximum)
+	}
+	if minimum, ok := schema["exclusiveMinimum"].(float64); ok && value <= minimum {
+		return fmt.Errorf("%s: %g must be greater than %g", location, value, minimum)
+	}
+	if maximum, ok := schema["exclusiveMaximum"].(float64); ok && value >= maximum {
+		return fmt.Errorf("%s: %g must be less than %g", location, value, maximum)
+	}
+	if divisor, ok := schema["multipleOf"].(float64); ok && divisor > 0 {
+		if quotient := value / divisor; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			return fmt.Errorf("%s: %g isn't a multiple of %g", location, value, divisor)
+		}
+	}
+	return nil
+}
+
+// checkBounds checks a count against a schema's minimum and maximum keywords.
+func checkBounds(schema map[string]any, minimumKeyword, maximumKeyword string, count int, unit, location string) error {
+	if minimum, ok := schema[minimumKeyword].(float64); ok && float64(count) < minimum {
+		return fmt.Errorf("%s: has %d %s, fewer than the minimum of %g", location, count, unit, minimum)
+	}
+	if maximum, ok := schema[maximumKeyword].(float64); ok && float64(count) > maximum {
+		return fmt.Errorf("%s: has %d %s, more than the maximum of %g", location, count, unit, maximum)
+	}
+	return nil
+}
+
+// matchesType returns whether a value has one of the types of a schema's type
+// keyword.
+func matchesType(types, value any) bool {
+	names, isArray := types.([]any)
+	if !isArray {
+		names = []any{types}
+	}
+	actual := jsonType(value)
+	for _, name := range names {
+		if name == actual || name == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// describeTypes describes the types of a schema's type keyword.
+func describeTypes(types any) string {
+	names, isArray := types.([]any)
+	if !isArray {
+		return fmt.Sprint(types)
+	}
+	described := make([]string, len(names))
+	for i, name := range names {
+		described[i] = fmt.Sprint(name)
+	}
+	return strings.Join(described, " or ")
+}
+
+// jsonType returns the JSON schema type of a decoded JSON value. Numbers
+// without a fractional part are integers.
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+// encodeValue encodes a decoded JSON value for error messages.
+func encodeValue(value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// escapePointerToken escapes a property name for use in a JSON pointer.
+func escapePointerToken(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+// compiledModelSchemas are a virtual model's compiled schemas.
+type compiledModelSchemas struct {
+	// request validates request bodies, if set.
+	request *jsonSchema
+	// toolArguments maps function names to the schemas validating their
+	// arguments.
+	toolArguments map[string]*jsonSchema
+}
+
+// compileModelSchemas compiles a virtual model's schemas.
+func compileModelSchemas(schemas *ModelSchemas) (*compiledModelSchemas, error) {
+	compiled := &compiledModelSchemas{toolArguments: make(map[string]*jsonSchema, len(schemas.ToolArguments))}
+	if len(schemas.Request) > 0 {
+		schema, err := compileJSONSchema(schemas.Request)
+		if err != nil {
+			return nil, invalidf("schemas.request: %v", err)
+		}
+		compiled.request = schema
+	}
+	for name, raw := range schemas.ToolArguments {
+		if name == "" {
+			return nil, invalidf("schemas.tool_arguments: function name is required")
+		}
+		schema, err := compileJSONSchema(raw)
+		if err != nil {
+			return nil, invalidf("schemas.tool_arguments[%q]: %v", name, err)
+		}
+		compiled.toolArguments[name] = schema
+	}
+	return compiled, nil
+}
+
+// validateRequest validates a request body against the request schema, if
+// any.
+func (c *compiledModelSchemas) validateRequest(body []byte) error {
+	if c.request == nil {
+		return nil
+	}
+	var request any
+	if err := json.Unmarshal(body, &request); err != nil {
+		return errors.New("request body isn't valid JSON")
+	}
+	return c.request.validate(request)
+}
+
+// validateToolCalls validates the arguments of the tool calls in a chat
+// completion response against the schemas of their functions. Tool calls to
+// functions without schemas aren't validated, and responses that can't be
+// parsed are left to the client.
+func (c *compiledModelSchemas) validateToolCalls(body []byte) error {
+	var response struct {
+		Choices []struct {
+			Index   *int `json:"index"`
+			Message struct {
+				ToolCalls []struct {
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return nil
+	}
+	for i, choice := range response.Choices {
+		index := i
+		if choice.Index != nil {
+			index = *choice.Index
+		}
+		for j, call := range choice.Message.ToolCalls {
+			schema, ok := c.toolArguments[call.Function.Name]
+			if !ok {
+				continue
+			}
+			var arguments any
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+				return fmt.Errorf("choices[%d].message.tool_calls[%d]: arguments of %s aren't valid JSON: %v", index, j, call.Function.Name, err)
+			}
+			if err := schema.validate(arguments); err != nil {
+				return fmt.Errorf("choices[%d].message.tool_calls[%d]: arguments of %s don't match the schema: %v", index, j, call.Function.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// toolCallSchemaWriter is a responseConverter that validates the arguments of
+// the tool calls in a non-streaming chat completion response. Responses with
+// invalid tool calls are replaced with an error.
+type toolCallSchemaWriter struct {
+	http.ResponseWriter
+	// schemas are the virtual model's schemas.
+	schemas *compiledModelSchemas
+	// statusCode is the response status code, which is only written once the
+	// response has been validated.
+	statusCode int
+	// buffer holds the response body.
+	buffer bytes.Buffer
+}
+
+// WriteHeader implements net/http.ResponseWriter.WriteHeader.
+func (w *toolCallSchemaWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	if statusCode != http.StatusOK {
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+// Write implements net/http.ResponseWriter.Write.
+func (w *toolCallSchemaWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.statusCode != http.StatusOK {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buffer.Write(b)
+}
+
+// Flush implements net/http.Flusher.Flush. Responses are buffered, so it's a
+// no-op.
+func (w *toolCallSchemaWriter) Flush() {}
+
+// Finish implements responseConverter.Finish.
+func (w *toolCallSchemaWriter) Finish() error {
+	if w.statusCode != http.StatusOK {
+		return nil
+	}
+	if err := w.schemas.validateToolCalls(w.buffer.Bytes()); err != nil {
+		w.Header().Del("Content-Length")
+		http.Error(w.ResponseWriter, err.Error(), http.StatusBadGateway)
+		return nil
+	}
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+	_, err := w.ResponseWriter.Write(w.buffer.Bytes())
+	return err
+}
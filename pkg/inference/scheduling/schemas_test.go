@@ -0,0 +1,149 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestJSONSchemaValidation(t *testing.T) {
+	schema, err := compileJSONSchema(json.RawMessage(`{
+		"type": "object",
+		"required": ["city"],
+		"properties": {
+			"city": {"type": "string", "minLength": 2, "pattern": "^[A-Z]"},
+			"days": {"type": "integer", "minimum": 1, "maximum": 7},
+			"units": {"enum": ["metric", "imperial"]},
+			"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "uniqueItems": true}
+		},
+		"additionalProperties": false,
+		"$defs": {"tag": {"type": "string", "maxLength": 8}}
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+
+	for _, tt := range []struct {
+		value string
+		err   string
+	}{
+		{`{"city":"Paris","days":3,"units":"metric","tags":["a","b"]}`, ""},
+		{`{"days":3}`, `#: missing required property "city"`},
+		{`{"city":42}`, "#/city: expected string, got integer"},
+		{`{"city":"paris"}`, `#/city: "paris" doesn't match pattern "^[A-Z]"`},
+		{`{"city":"Paris","days":2.5}`, "#/days: expected integer, got number"},
+		{`{"city":"Paris","days":8}`, "#/days: 8 is greater than the maximum of 7"},
+		{`{"city":"Paris","units":"kelvin"}`, `#/units: must be one of "metric", "imperial"`},
+		{`{"city":"Paris","tags":["a","a"]}`, "#/tags: items 0 and 1 are equal"},
+		{`{"city":"Paris","tags":["overlylong"]}`, "#/tags/0: has 10 characters, more than the maximum of 8"},
+		{`{"city":"Paris","country":"FR"}`, `#: unexpected property "country"`},
+	} {
+		var value any
+		if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+			t.Fatalf("Invalid test value %s: %v", tt.value, err)
+		}
+		err := schema.validate(value)
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.value, err)
+		} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%s: expected error %q, got %v", tt.value, tt.err, err)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"type": "object", "properties": []}`,
+		`{"pattern": "("}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"anyOf": {}}`,
+		`[]`,
+	} {
+		if _, err := compileJSONSchema(json.RawMessage(invalid)); err == nil {
+			t.Errorf("Expected error compiling %s", invalid)
+		}
+	}
+}
+
+func TestValidateToolCalls(t *testing.T) {
+	schemas, err := compileModelSchemas(&ModelSchemas{
+		ToolArguments: map[string]json.RawMessage{
+			"get_weather": json.RawMessage(`{"type":"object","required":["city"]}`),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile schemas: %v", err)
+	}
+	response := func(name, arguments string) []byte {
+		encoded, _ := json.Marshal(arguments)
+		return []byte(`{"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[{"type":"function","function":{"name":"` + name + `","arguments":` + string(encoded) + `}}]}}]}`)
+	}
+
+	for _, tt := range []struct {
+		body []byte
+		err  string
+	}{
+		{response("get_weather", `{"city":"Paris"}`), ""},
+		{response("get_time", `{}`), ""},
+		{response("get_weather", `{"town":"Paris"}`), `choices[0].message.tool_calls[0]: arguments of get_weather don't match the schema: #: missing required property "city"`},
+		{response("get_weather", `{"city":`), "choices[0].message.tool_calls[0]: arguments of get_weather aren't valid JSON: unexpected end of JSON input"},
+		{[]byte(`not json`), ""},
+	} {
+		err := schemas.validateToolCalls(tt.body)
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.body, err)
+		} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%s: expected error %q, got %v", tt.body, tt.err, err)
+		}
+	}
+
+	validator := &toolCallSchemaWriter{ResponseWriter: httptest.NewRecorder(), schemas: schemas}
+	validator.Write(response("get_weather", `{}`))
+	if err := validator.Finish(); err != nil {
+		t.Fatalf("Failed to finish response: %v", err)
+	}
+	if recorder := validator.ResponseWriter.(*httptest.ResponseRecorder); recorder.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestVirtualModelRequestSchema(t *testing.T) {
+	log := createTestLogger()
+	backend := &mockBackend{name: "mock", usesExternalModelMgmt: true}
+	s := NewScheduler(log, map[string]inference.Backend{"mock": backend}, backend, nil, nil, nil, nil, nil, systemMemoryInfo{})
+	err := s.SetVirtualModels([]VirtualModel{{
+		Name:    "agent",
+		Default: "ai/smollm2",
+		Schemas: &ModelSchemas{
+			Request: json.RawMessage(`{"type":"object","required":["metadata"],"properties":{"metadata":{"type":"object","required":["session"]}}}`),
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to set virtual model: %v", err)
+	}
+	if err := s.SetVirtualModels([]VirtualModel{{Name: "invalid", Default: "ai/smollm2", Schemas: &ModelSchemas{Request: json.RawMessage(`{"pattern":"("}`)}}}); err == nil {
+		t.Error("Expected an invalid schema to be rejected")
+	}
+
+	for _, tt := range []struct {
+		body   string
+		status int
+		err    string
+	}{
+		{`{"model":"agent","messages":[{"role":"user","content":"Hi"}],"metadata":{"session":"1"}}`, http.StatusOK, ""},
+		{`{"model":"agent","messages":[{"role":"user","content":"Hi"}],"metadata":{}}`, http.StatusBadRequest, `request doesn't match the schema of ai/agent:latest: #/metadata: missing required property "session"`},
+	} {
+		request := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/mock/v1/chat/completions", strings.NewReader(tt.body))
+		request.Header.Set(inference.DryRunHeader, "1")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.body, tt.status, w.Code, w.Body.String())
+		}
+		if tt.err != "" && strings.TrimSpace(w.Body.String()) != tt.err {
+			t.Errorf("%s: expected error %q, got %q", tt.body, tt.err, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	// selfConsistencyField is the completion request field that requests
+	// self-consistency voting.
+	selfConsistencyField = "self_consistency"
+	// defaultSelfConsistencySamples is the default number of samples voting
+	// on the answer.
+	defaultSelfConsistencySamples = 5
+	// defaultSelfConsistencyTemperature is the temperature at which samples
+	// are generated if the request doesn't specify a non-zero temperature.
+	defaultSelfConsistencyTemperature = 0.7
+)
+
+// selfConsistencyOptions are the options of a completion request's
+// self_consistency extension field, which generates several samples and
+// returns the one whose answer is the most common.
+type selfConsistencyOptions struct {
+	// Samples is the number of samples generated. It defaults to 5.
+	Samples int `json:"samples,omitempty"`
+	// Extract is a regular expression extracting the answer from a sample's
+	// content, from its last match (the first capture group, if any). If
+	// empty, the answer is the last non-empty line of the content.
+	Extract string `json:"extract,omitempty"`
+}
+
+// selfConsistency is a parsed self-consistency request.
+type selfConsistency struct {
+	// samples is the number of samples generated.
+	samples int
+	// extract extracts answers, if set.
+	extract *regexp.Regexp
+}
+
+// selfConsistencyResult describes the vote of a self-consistency request. It's
+// added to responses as the top-level "self_consistency" field.
+type selfConsistencyResult struct {
+	Samples int    `json:"samples"`
+	Answer  string `json:"answer"`
+	Votes   int    `json:"votes"`
+	// Answers are the answers of the samples, in order, with an empty answer
+	// for samples without one.
+	Answers []string `json:"answers"`
+}
+
+// parseSelfConsistency parses the self-consistency options of a completion
+// request for n choices. It returns nil if the request doesn't request
+// self-consistency voting.
+func parseSelfConsistency(body []byte, n int, stream bool) (*selfConsistency, error) {
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, nil
+	}
+	raw, ok := request[selfConsistencyField]
+	if !ok {
+		return nil, nil
+	}
+	var options selfConsistencyOptions
+	var enabled bool
+	if err := json.Unmarshal(raw, &enabled); err == nil {
+		if !enabled {
+			return nil, nil
+		}
+	} else if err := json.Unmarshal(raw, &options); err != nil {
+		return nil, errors.New("self_consistency must be a boolean or an object")
+	}
+	if options.Samples == 0 {
+		options.Samples = defaultSelfConsistencySamples
+	}
+	switch {
+	case options.Samples < 2 || options.Samples > maximumChoices:
+		return nil, fmt.Errorf("self_consistency samples must be between 2 and %d", maximumChoices)
+	case n > 1:
+		return nil, errors.New("self_consistency isn't supported with n")
+	case stream:
+		return nil, errors.New("self_consistency isn't supported for streaming requests")
+	}
+	if _, ok := request["best_of"]; ok {
+		return nil, errors.New("self_consistency isn't supported with best_of")
+	}
+	parsed := &selfConsistency{samples: options.Samples}
+	if options.Extract != "" {
+		extract, err := regexp.Compile(options.Extract)
+		if err != nil {
+			return nil, fmt.Errorf("invalid self_consistency extract pattern: %w", err)
+		}
+		parsed.extract = extract
+	}
+	return parsed, nil
+}
+
+// selfConsistencyRequestBody returns the body of the requests generating a
+// self-consistency request's samples, with the option removed and a non-zero
+// temperature, so that the samples differ.
+func selfConsistencyRequestBody(body []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, selfConsistencyField)
+	var temperature float64
+	json.Unmarshal(fields["temperature"], &temperature)
+	if temperature == 0 {
+		fields["temperature"], _ = json.Marshal(defaultSelfConsistencyTemperature)
+	}
+	return json.Marshal(fields)
+}
+
+// answer extracts the answer from a sample's content. Answers are normalized,
+// so that equivalent answers differing by case, whitespace, or trailing
+// punctuation are counted together.
+func (c *selfConsistency) answer(content string) string {
+	var answer string
+	if c.extract != nil {
+		matches := c.extract.FindAllStringSubmatch(content, -1)
+		if len(matches) == 0 {
+			return ""
+		}
+		match := matches[len(matches)-1]
+		answer = match[0]
+		if len(match) > 1 {
+			answer = match[1]
+		}
+	} else {
+		lines := strings.Split(strings.TrimSpace(content), "\n")
+		answer = lines[len(lines)-1]
+	}
+	answer = strings.ToLower(strings.Join(strings.Fields(answer), " "))
+	return strings.TrimRight(answer, ".!?;:")
+}
+
+// vote returns the index of the first sample whose answer is the most common
+// among the samples with answers, and the number of samples with that answer.
+// Ties are broken in favor of the answer given first. It returns -1 if no
+// sample has an answer.
+func vote(answers []string) (int, int) {
+	counts := make(map[string]int)
+	for _, answer := range answers {
+		if answer != "" {
+			counts[answer]++
+		}
+	}
+	winner, votes := -1, 0
+	for i, answer := range answers {
+		if answer != "" && counts[answer] > votes {
+			winner, votes = i, counts[answer]
+		}
+	}
+	return winner, votes
+}
+
+// serveSelfConsistency serves a non-streaming completion request with
+// self-consistency voting. The samples are generated as for requests for
+// several choices, and the first sample whose answer is the most common is
+// returned. The usage accounts for all samples.
+func (s *Scheduler) serveSelfConsistency(w http.ResponseWriter, r *http.Request, body []byte, consistency *selfConsistency) {
+	sampleBody, err := selfConsistencyRequestBody(body)
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	bodies, err := choiceRequestBodies(sampleBody, consistency.samples)
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	responses, failed := s.generateChoices(r, bodies)
+	if failed != nil {
+		writeBufferedResponse(w, failed)
+		return
+	}
+
+	result := selfConsistencyResult{Samples: len(responses), Answers: make([]string, len(responses))}
+	for i, response := range responses {
+		result.Answers[i] = consistency.answer(parseBestOfCandidate(response).content)
+	}
+	winner, votes := vote(result.Answers)
+	if winner < 0 {
+		// Without answers, there's no consensus, so return the first sample.
+		winner = 0
+	}
+	result.Answer, result.Votes = result.Answers[winner], votes
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(responses[winner].body.Bytes(), &fields); err != nil {
+		http.Error(w, "invalid response", http.StatusBadGateway)
+		return
+	}
+	if _, ok := fields["usage"]; ok {
+		fields["usage"], _ = json.Marshal(totalUsage(responses))
+	}
+	fields[selfConsistencyField], _ = json.Marshal(result)
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	responses[winner].body.Reset()
+	responses[winner].body.Write(merged)
+	writeBufferedResponse(w, responses[winner])
+}
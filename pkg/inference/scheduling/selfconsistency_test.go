@@ -0,0 +1,91 @@
+package scheduling
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseSelfConsistency(t *testing.T) {
+	consistency, err := parseSelfConsistency([]byte(`{"self_consistency":true}`), 1, false)
+	if err != nil || consistency == nil || consistency.samples != defaultSelfConsistencySamples || consistency.extract != nil {
+		t.Errorf("Unexpected default options %+v (%v)", consistency, err)
+	}
+	consistency, err = parseSelfConsistency([]byte(`{"self_consistency":{"samples":3,"extract":"answer: (\\d+)"}}`), 1, false)
+	if err != nil || consistency == nil || consistency.samples != 3 || consistency.extract == nil {
+		t.Errorf("Unexpected options %+v (%v)", consistency, err)
+	}
+	if consistency, err := parseSelfConsistency([]byte(`{"self_consistency":false}`), 1, false); err != nil || consistency != nil {
+		t.Errorf("Expected voting to be disabled, got %+v (%v)", consistency, err)
+	}
+	for _, tt := range []struct {
+		body   string
+		n      int
+		stream bool
+	}{
+		{`{"self_consistency":{"samples":1}}`, 1, false},
+		{`{"self_consistency":{"extract":"("}}`, 1, false},
+		{`{"self_consistency":true}`, 2, false},
+		{`{"self_consistency":true}`, 1, true},
+		{`{"self_consistency":true,"best_of":3}`, 1, false},
+		{`{"self_consistency":"yes"}`, 1, false},
+	} {
+		if _, err := parseSelfConsistency([]byte(tt.body), tt.n, tt.stream); err == nil {
+			t.Errorf("%s: expected error", tt.body)
+		}
+	}
+}
+
+func TestSelfConsistencyRequestBody(t *testing.T) {
+	body, err := selfConsistencyRequestBody([]byte(`{"model":"ai/smollm2","self_consistency":true}`))
+	if err != nil || string(body) != `{"model":"ai/smollm2","temperature":0.7}` {
+		t.Errorf("Unexpected body %s (%v)", body, err)
+	}
+	body, err = selfConsistencyRequestBody([]byte(`{"temperature":1.2,"self_consistency":true}`))
+	if err != nil || string(body) != `{"temperature":1.2}` {
+		t.Errorf("Unexpected body %s (%v)", body, err)
+	}
+}
+
+func TestSelfConsistencyVote(t *testing.T) {
+	lastLine := &selfConsistency{}
+	extract, _ := parseSelfConsistency([]byte(`{"self_consistency":{"extract":"answer is (\\d+)"}}`), 1, false)
+	for _, tt := range []struct {
+		consistency *selfConsistency
+		content     string
+		want        string
+	}{
+		{lastLine, "Let's think.\n\nThe Answer:  42.\n", "the answer: 42"},
+		{extract, "The answer is 12, or rather the answer is 13!", "13"},
+		{extract, "I don't know", ""},
+	} {
+		if answer := tt.consistency.answer(tt.content); answer != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.content, tt.want, answer)
+		}
+	}
+
+	for _, tt := range []struct {
+		answers []string
+		winner  int
+		votes   int
+	}{
+		{[]string{"a", "b", "b", "a"}, 0, 2},
+		{[]string{"", "b", "a", "b"}, 1, 2},
+		{[]string{"", ""}, -1, 0},
+	} {
+		if winner, votes := vote(tt.answers); winner != tt.winner || votes != tt.votes {
+			t.Errorf("%q: expected sample %d with %d votes, got %d with %d", tt.answers, tt.winner, tt.votes, winner, votes)
+		}
+	}
+}
+
+func TestTotalUsage(t *testing.T) {
+	var responses []*bufferedResponseWriter
+	for _, usage := range []string{`{"prompt_tokens":4,"completion_tokens":2}`, `{"prompt_tokens":4,"completion_tokens":3}`} {
+		response := &bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}
+		response.body.WriteString(`{"usage":` + usage + `}`)
+		responses = append(responses, response)
+	}
+	if usage := totalUsage(responses); usage != (choiceUsage{PromptTokens: 4, CompletionTokens: 5, TotalTokens: 9}) {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+}
@@ -0,0 +1,342 @@
+package scheduling
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/quirks"
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+const (
+	// stateKey is the storage key of the persisted serving state.
+	stateKey = "scheduler/state"
+	// stateCheckpointInterval is the interval at which the serving state is
+	// persisted while the scheduler runs. It's also persisted on shutdown.
+	stateCheckpointInterval = 10 * time.Second
+	// rewarmRetryInterval is the interval at which restored runners retry
+	// their startup while the loader isn't accepting loads yet.
+	rewarmRetryInterval = 100 * time.Millisecond
+)
+
+// persistedRunnerConfig is the persisted configuration of the runners of a
+// model in some mode.
+type persistedRunnerConfig struct {
+	Backend  string                          `json:"backend"`
+	ModelID  string                          `json:"model_id"`
+	Mode     string                          `json:"mode"`
+	Config   *inference.BackendConfiguration `json:"config,omitempty"`
+	Replicas int                             `json:"replicas,omitempty"`
+}
+
+// persistedRunner is a runner that was loaded when the state was persisted,
+// and that's started again when the state is restored.
+type persistedRunner struct {
+	Backend     string `json:"backend"`
+	ModelID     string `json:"model_id"`
+	ModelRef    string `json:"model_ref"`
+	Mode        string `json:"mode"`
+	ContextSize uint64 `json:"context_size,omitempty"`
+}
+
+// servingState is the persisted serving state of the scheduler: the state
+// changed through the API after startup and the runners that were loaded.
+type servingState struct {
+	Profile       string                  `json:"profile,omitempty"`
+	Windows       WindowsResponse         `json:"windows"`
+	VirtualModels []VirtualModel          `json:"virtual_models,omitempty"`
+	Pipelines     []Pipeline              `json:"pipelines,omitempty"`
+	Quirks        []quirks.Rule           `json:"quirks,omitempty"`
+	RunnerConfigs []persistedRunnerConfig `json:"runner_configs,omitempty"`
+	Runners       []persistedRunner       `json:"runners,omitempty"`
+}
+
+// checkpoint persists the serving state.
+type checkpoint struct {
+	// storage is where the state is persisted.
+	storage storage.KV
+	// mutex guards the subsequent fields.
+	mutex sync.Mutex
+	// runners are the runners that were last seen loaded while the loader
+	// accepted loads. They're persisted instead of the loaded runners while
+	// the loader doesn't, i.e. before startup and while shutting down.
+	runners []persistedRunner
+	// rewarming indicates that the restored runners are being started, during
+	// which they're persisted instead of the loaded runners.
+	rewarming bool
+	// saved is the last persisted state, used to skip unchanged writes.
+	saved []byte
+}
+
+// SetStateStorage makes the serving state persist in kv across restarts, e.g.
+// upgrades, and restores the state persisted previously: the profile, window
+// policies and pins, virtual models, pipelines, model quirk rules, runner
+// configurations and replica counts, and the loaded runners, which are started
+// again once the scheduler runs. Restored state takes precedence over the
+// state configured at startup, and restored virtual models, pipelines, and
+// quirk rules are added to those configured at startup. The benchmark history is persisted there too. It must
+// be called before Run.
+func (s *Scheduler) SetStateStorage(ctx context.Context, kv storage.KV) error {
+	if err := s.tuner.setStorage(kv); err != nil {
+		return err
+	}
+	s.checkpoint = &checkpoint{storage: kv}
+	data, err := kv.Get(stateKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading %s: %w", stateKey, err)
+	}
+	var state servingState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("unmarshaling %s: %w", stateKey, err)
+	}
+	if err := s.restoreState(ctx, state); err != nil {
+		return err
+	}
+	s.checkpoint.runners = state.Runners
+	s.checkpoint.rewarming = len(state.Runners) > 0
+	s.checkpoint.saved = data
+	return nil
+}
+
+// restoreState applies a persisted serving state.
+func (s *Scheduler) restoreState(ctx context.Context, state servingState) error {
+	if state.Profile != "" {
+		profile, err := LookupProfile(state.Profile)
+		if err != nil {
+			s.log.Warnf("Not restoring unknown profile %s", utils.SanitizeForLog(state.Profile))
+		} else if profile.Name != s.profileName() {
+			s.SetProfile(ctx, profile)
+		}
+	}
+
+	global, err := parseWindowPolicy(state.Windows.Global)
+	if err != nil {
+		return fmt.Errorf("invalid persisted window policy: %w", err)
+	}
+	s.windows.setPolicy("", global)
+	for model, spec := range state.Windows.Models {
+		policy, err := parseWindowPolicy(spec)
+		if err != nil {
+			return fmt.Errorf("invalid persisted window policy for %s: %w", model, err)
+		}
+		s.windows.setPolicy(model, policy)
+	}
+	now := time.Now()
+	for _, pin := range state.Windows.Pins {
+		var until time.Time
+		if pin.Until != nil {
+			if !now.Before(*pin.Until) {
+				continue
+			}
+			until = *pin.Until
+		}
+		s.windows.pin(pin.Model, until)
+	}
+
+	if err := s.routes.set(state.VirtualModels...); err != nil {
+		return fmt.Errorf("invalid persisted virtual models: %w", err)
+	}
+	if err := s.pipelines.set(state.Pipelines...); err != nil {
+		return fmt.Errorf("invalid persisted pipelines: %w", err)
+	}
+	if err := s.quirks.Set(state.Quirks...); err != nil {
+		return fmt.Errorf("invalid persisted quirk rules: %w", err)
+	}
+	s.loader.restoreConfigs(state.RunnerConfigs)
+	s.log.Infof("Restored serving state with %d virtual models, %d pipelines, %d runner configurations, and %d runners",
+		len(state.VirtualModels), len(state.Pipelines), len(state.RunnerConfigs), len(state.Runners))
+	return nil
+}
+
+// parseWindowPolicy parses the API representation of a window policy.
+func parseWindowPolicy(spec WindowPolicySpec) (WindowPolicy, error) {
+	var policy WindowPolicy
+	var err error
+	if policy.Serving, err = ParseWindow(spec.Serving); err != nil {
+		return WindowPolicy{}, err
+	}
+	if policy.Pulls, err = ParseWindow(spec.Pulls); err != nil {
+		return WindowPolicy{}, err
+	}
+	return policy, nil
+}
+
+// profileName returns the name of the active configuration profile.
+func (s *Scheduler) profileName() string {
+	s.profileLock.Lock()
+	defer s.profileLock.Unlock()
+	return s.profile
+}
+
+// captureState returns the current serving state.
+func (s *Scheduler) captureState() servingState {
+	runnerConfigs, runners, accepting := s.loader.snapshot()
+	s.checkpoint.mutex.Lock()
+	if accepting && !s.checkpoint.rewarming {
+		s.checkpoint.runners = runners
+	}
+	runners = s.checkpoint.runners
+	s.checkpoint.mutex.Unlock()
+
+	return servingState{
+		Profile:       s.profileName(),
+		Windows:       s.windows.status(time.Now()),
+		VirtualModels: s.routes.list(),
+		Pipelines:     s.pipelines.list(),
+		Quirks:        s.quirks.Custom(),
+		RunnerConfigs: runnerConfigs,
+		Runners:       runners,
+	}
+}
+
+// saveState persists the serving state if it changed.
+func (s *Scheduler) saveState() {
+	data, err := json.Marshal(s.captureState())
+	if err != nil {
+		s.log.Warnf("Failed to encode serving state: %v", err)
+		return
+	}
+	s.checkpoint.mutex.Lock()
+	defer s.checkpoint.mutex.Unlock()
+	if bytes.Equal(data, s.checkpoint.saved) {
+		return
+	}
+	if err := s.checkpoint.storage.Put(stateKey, data); err != nil {
+		s.log.Warnf("Failed to persist serving state: %v", err)
+		return
+	}
+	s.checkpoint.saved = data
+}
+
+// runCheckpoints persists the serving state periodically until the context
+// is cancelled, and a final time on shutdown.
+func (s *Scheduler) runCheckpoints(ctx context.Context) {
+	ticker := time.NewTicker(stateCheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.saveState()
+			return
+		case <-ticker.C:
+			s.saveState()
+		}
+	}
+}
+
+// rewarm starts the runners that were loaded when the state was persisted.
+// They're released once started, so they're subject to the usual idle
+// eviction.
+func (s *Scheduler) rewarm(ctx context.Context) {
+	s.checkpoint.mutex.Lock()
+	runners := slices.Clone(s.checkpoint.runners)
+	s.checkpoint.mutex.Unlock()
+	defer func() {
+		s.checkpoint.mutex.Lock()
+		s.checkpoint.rewarming = false
+		s.checkpoint.mutex.Unlock()
+	}()
+
+	for _, persisted := range runners {
+		if err := s.installer.wait(ctx, persisted.Backend); err != nil {
+			s.log.Warnf("Unable to restore %s runner for %s: %v", persisted.Backend, utils.SanitizeForLog(persisted.ModelRef), err)
+			continue
+		}
+		mode := parseBackendMode(persisted.Mode)
+		for {
+			runner, err := s.loader.load(ctx, persisted.Backend, persisted.ModelID, persisted.ModelRef, mode, persisted.ContextSize, nil)
+			if errors.Is(err, errLoadsDisabled) {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(rewarmRetryInterval):
+					continue
+				}
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				s.log.Warnf("Unable to restore %s runner for %s: %v", persisted.Backend, utils.SanitizeForLog(persisted.ModelRef), err)
+			} else {
+				s.log.Infof("Restored %s runner for %s in %s mode", persisted.Backend, utils.SanitizeForLog(persisted.ModelRef), mode)
+				s.loader.release(runner)
+			}
+			break
+		}
+	}
+}
+
+// snapshot returns the runner configurations and replica counts, the loaded
+// runners other than additional replicas, and whether loads are enabled.
+func (l *loader) snapshot() ([]persistedRunnerConfig, []persistedRunner, bool) {
+	l.lock(context.Background())
+	defer l.unlock()
+
+	configs := make(map[runnerKey]*persistedRunnerConfig)
+	configFor := func(key runnerKey) *persistedRunnerConfig {
+		if configs[key] == nil {
+			configs[key] = &persistedRunnerConfig{Backend: key.backend, ModelID: key.modelID, Mode: key.mode.String()}
+		}
+		return configs[key]
+	}
+	for key, config := range l.runnerConfigs {
+		configFor(key).Config = &config
+	}
+	for key, replicas := range l.replicas {
+		configFor(key).Replicas = replicas
+	}
+	runnerConfigs := make([]persistedRunnerConfig, 0, len(configs))
+	for _, config := range configs {
+		runnerConfigs = append(runnerConfigs, *config)
+	}
+	slices.SortFunc(runnerConfigs, func(a, b persistedRunnerConfig) int {
+		return cmp.Or(cmp.Compare(a.Backend, b.Backend), cmp.Compare(a.ModelID, b.ModelID), cmp.Compare(a.Mode, b.Mode))
+	})
+
+	var runners []persistedRunner
+	for key, runnerInfo := range l.runners {
+		if key.replica != 0 || l.stale[runnerInfo.slot] {
+			continue
+		}
+		runners = append(runners, persistedRunner{
+			Backend:     key.backend,
+			ModelID:     key.modelID,
+			ModelRef:    runnerInfo.modelRef,
+			Mode:        key.mode.String(),
+			ContextSize: key.contextSize,
+		})
+	}
+	slices.SortFunc(runners, func(a, b persistedRunner) int {
+		return cmp.Or(cmp.Compare(a.Backend, b.Backend), cmp.Compare(a.ModelID, b.ModelID), cmp.Compare(a.Mode, b.Mode))
+	})
+	return runnerConfigs, runners, l.loadsEnabled
+}
+
+// restoreConfigs restores persisted runner configurations and replica counts.
+// It must be called before any runners are loaded.
+func (l *loader) restoreConfigs(configs []persistedRunnerConfig) {
+	l.lock(context.Background())
+	defer l.unlock()
+	for _, config := range configs {
+		key := makeConfigKey(config.Backend, config.ModelID, parseBackendMode(config.Mode))
+		if config.Config != nil {
+			l.runnerConfigs[key] = *config.Config
+		}
+		if config.Replicas > 1 {
+			l.replicas[key] = min(config.Replicas, len(l.slots))
+		}
+	}
+}
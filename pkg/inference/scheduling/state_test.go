@@ -0,0 +1,81 @@
+package scheduling
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/quirks"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+func TestStateCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	backend := &mockBackend{name: "mock", usesExternalModelMgmt: true}
+	newScheduler := func() *Scheduler {
+		return NewScheduler(createTestLogger(), map[string]inference.Backend{"mock": backend}, backend, nil, nil, nil, nil, nil, systemMemoryInfo{})
+	}
+	kv := storage.NewMemory()
+
+	s := newScheduler()
+	if err := s.SetStateStorage(ctx, kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	profile, err := LookupProfile("performance")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s.SetProfile(ctx, profile)
+	workingHours, _ := ParseWindow("Mon-Fri 09:00-18:00")
+	s.windows.setPolicy("ai/gemma3", WindowPolicy{Serving: workingHours})
+	s.windows.pin("ai/smollm2", time.Time{})
+	s.windows.pin("ai/expired", time.Now().Add(-time.Minute))
+	if err := s.SetVirtualModels([]VirtualModel{{Name: "assistant", Default: "ai/smollm2"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := s.SetPipelines([]Pipeline{{Name: "notes", Steps: []PipelineStep{{Name: "summarize", Model: "ai/smollm2"}}}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	eos := 2
+	if err := s.SetQuirks([]quirks.Rule{{Name: "tinyllama-eos", Match: quirks.Match{Name: "TinyLlama"}, EOSTokenID: &eos}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := s.loader.setRunnerConfig(ctx, "mock", "sha256:model", inference.BackendModeEmbedding, inference.BackendConfiguration{ContextSize: 4096}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if replicas := len(s.loader.slots); replicas > 1 {
+		s.loader.replicas[makeConfigKey("mock", "sha256:model", inference.BackendModeCompletion)] = replicas
+	}
+
+	// Runners are only captured while the loader accepts loads.
+	s.loader.runners[makeRunnerKey("mock", "sha256:model", "", inference.BackendModeCompletion)] = runnerInfo{slot: 0, modelRef: "ai/smollm2"}
+	s.saveState()
+	if runners := s.captureState().Runners; len(runners) != 0 {
+		t.Fatalf("Expected no runners before loads are enabled, got %+v", runners)
+	}
+	s.loader.loadsEnabled = true
+	s.saveState()
+	saved := s.captureState()
+	if len(saved.Runners) != 1 || len(saved.Windows.Pins) != 1 {
+		t.Fatalf("Unexpected captured state %+v", saved)
+	}
+	s.loader.loadsEnabled = false
+	delete(s.loader.runners, makeRunnerKey("mock", "sha256:model", "", inference.BackendModeCompletion))
+	s.saveState()
+
+	restored := newScheduler()
+	if err := restored.SetStateStorage(ctx, kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := restored.captureState(); !reflect.DeepEqual(got, saved) {
+		t.Errorf("Expected restored state %+v, got %+v", saved, got)
+	}
+	if config, _ := restored.loader.configFor("mock", "sha256:model", inference.BackendModeEmbedding); config == nil || config.ContextSize != 4096 {
+		t.Errorf("Expected the runner configuration to be restored, got %+v", config)
+	}
+	if !restored.windows.keepLoaded("ai/smollm2", time.Now()) {
+		t.Error("Expected the pin to be restored")
+	}
+}
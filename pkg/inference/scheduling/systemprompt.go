@@ -0,0 +1,168 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/metrics"
+)
+
+// systemPromptField is the chat completion request field with which clients
+// opt out of default system prompts (false) or into suggested ones (true).
+const systemPromptField = "server_system_prompt"
+
+// Decisions recorded for requests to models with system prompts.
+const (
+	// systemPromptInjected means that the system prompt was added as the
+	// first message.
+	systemPromptInjected = "injected"
+	// systemPromptMerged means that the system prompt was prepended to the
+	// client's first system message.
+	systemPromptMerged = "merged"
+	// systemPromptOverridden means that the client's system messages were
+	// replaced with the system prompt.
+	systemPromptOverridden = "overridden"
+	// systemPromptClientProvided means that the client's system messages
+	// took precedence over a default or suggested system prompt.
+	systemPromptClientProvided = "client-provided"
+	// systemPromptOptedOut means that the client opted out of a default
+	// system prompt.
+	systemPromptOptedOut = "opted-out"
+	// systemPromptNotOptedIn means that the client didn't opt into a
+	// suggested system prompt.
+	systemPromptNotOptedIn = "not-opted-in"
+)
+
+// validateSystemPromptConfig validates a system prompt configuration.
+func validateSystemPromptConfig(config *inference.SystemPromptConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.Prompt == "" {
+		return errors.New("system prompt must not be empty")
+	}
+	switch config.Mode {
+	case inference.SystemPromptMandatory, inference.SystemPromptDefault, inference.SystemPromptSuggested:
+	default:
+		return fmt.Errorf("unknown system prompt mode %q", config.Mode)
+	}
+	switch config.Policy {
+	case "", inference.SystemPromptMerge, inference.SystemPromptOverride:
+	default:
+		return fmt.Errorf("unknown system prompt policy %q", config.Policy)
+	}
+	if config.Policy != "" && config.Mode != inference.SystemPromptMandatory {
+		return fmt.Errorf("system prompt policy only applies to the %s mode", inference.SystemPromptMandatory)
+	}
+	return nil
+}
+
+// applySystemPrompt applies a model's system prompt to a chat completion
+// request according to its mode and policy, and strips the client's opt-in or
+// opt-out. It returns the resulting request body and the decision that was
+// made.
+func applySystemPrompt(config *inference.SystemPromptConfig, body []byte) ([]byte, *metrics.SystemPromptRecord, error) {
+	c, err := parseConversation(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var optIn *bool
+	if value, ok := c.fields[systemPromptField]; ok {
+		optIn = new(bool)
+		if err := json.Unmarshal(value, optIn); err != nil {
+			return nil, nil, fmt.Errorf("%s must be a boolean", systemPromptField)
+		}
+		delete(c.fields, systemPromptField)
+	}
+	policy := config.Policy
+	if policy == "" && config.Mode == inference.SystemPromptMandatory {
+		policy = inference.SystemPromptMerge
+	}
+	record := &metrics.SystemPromptRecord{Mode: config.Mode, Policy: policy}
+
+	first := -1
+	for i, role := range c.roles {
+		if role == "system" || role == "developer" {
+			first = i
+			break
+		}
+	}
+	system, err := json.Marshal(map[string]string{"role": "system", "content": config.Prompt})
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case config.Mode == inference.SystemPromptMandatory:
+		record.OptOutDenied = optIn != nil && !*optIn
+		if first < 0 {
+			record.Decision = systemPromptInjected
+			c.messages = append([]json.RawMessage{system}, c.messages...)
+		} else if policy == inference.SystemPromptOverride {
+			record.Decision = systemPromptOverridden
+			messages := []json.RawMessage{system}
+			for i, message := range c.messages {
+				if c.roles[i] != "system" && c.roles[i] != "developer" {
+					messages = append(messages, message)
+				}
+			}
+			c.messages = messages
+		} else {
+			record.Decision = systemPromptMerged
+			merged, err := prependContent(c.messages[first], config.Prompt)
+			if err != nil {
+				return nil, nil, err
+			}
+			c.messages[first] = merged
+		}
+	case first >= 0:
+		record.Decision = systemPromptClientProvided
+	case config.Mode == inference.SystemPromptDefault && optIn != nil && !*optIn:
+		record.Decision = systemPromptOptedOut
+	case config.Mode == inference.SystemPromptSuggested && (optIn == nil || !*optIn):
+		record.Decision = systemPromptNotOptedIn
+	default:
+		record.Decision = systemPromptInjected
+		c.messages = append([]json.RawMessage{system}, c.messages...)
+	}
+
+	if c.fields["messages"], err = json.Marshal(c.messages); err != nil {
+		return nil, nil, err
+	}
+	encoded, err := json.Marshal(c.fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encoded, record, nil
+}
+
+// prependContent prepends text to the content of a message, which may be a
+// string or an array of content parts.
+func prependContent(message json.RawMessage, text string) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return nil, err
+	}
+	var content string
+	var parts []json.RawMessage
+	var err error
+	if json.Unmarshal(fields["content"], &content) == nil {
+		fields["content"], err = json.Marshal(text + "\n\n" + content)
+	} else if json.Unmarshal(fields["content"], &parts) == nil {
+		part, err := json.Marshal(map[string]string{"type": "text", "text": text})
+		if err != nil {
+			return nil, err
+		}
+		fields["content"], err = json.Marshal(append([]json.RawMessage{part}, parts...))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fields["content"], err = json.Marshal(text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
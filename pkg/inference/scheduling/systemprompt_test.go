@@ -0,0 +1,92 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestApplySystemPrompt(t *testing.T) {
+	const (
+		withoutSystem = `{"model":"m","messages":[{"role":"user","content":"Hi"}]}`
+		withSystem    = `{"model":"m","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}`
+		withParts     = `{"model":"m","messages":[{"role":"system","content":[{"type":"text","text":"Be brief."}]},{"role":"user","content":"Hi"}]}`
+		optedOut      = `{"model":"m","server_system_prompt":false,"messages":[{"role":"user","content":"Hi"}]}`
+		optedIn       = `{"model":"m","server_system_prompt":true,"messages":[{"role":"user","content":"Hi"}]}`
+	)
+	config := func(mode inference.SystemPromptMode, policy inference.SystemPromptPolicy) *inference.SystemPromptConfig {
+		return &inference.SystemPromptConfig{Prompt: "Answer in English.", Mode: mode, Policy: policy}
+	}
+
+	tests := []struct {
+		name         string
+		config       *inference.SystemPromptConfig
+		body         string
+		decision     string
+		optOutDenied bool
+		messages     string
+	}{
+		{"mandatory without system", config(inference.SystemPromptMandatory, ""), withoutSystem, systemPromptInjected, false,
+			`[{"content":"Answer in English.","role":"system"},{"role":"user","content":"Hi"}]`},
+		{"mandatory merge", config(inference.SystemPromptMandatory, ""), withSystem, systemPromptMerged, false,
+			`[{"content":"Answer in English.\n\nBe brief.","role":"system"},{"role":"user","content":"Hi"}]`},
+		{"mandatory merge parts", config(inference.SystemPromptMandatory, inference.SystemPromptMerge), withParts, systemPromptMerged, false,
+			`[{"content":[{"text":"Answer in English.","type":"text"},{"type":"text","text":"Be brief."}],"role":"system"},{"role":"user","content":"Hi"}]`},
+		{"mandatory override", config(inference.SystemPromptMandatory, inference.SystemPromptOverride), withSystem, systemPromptOverridden, false,
+			`[{"content":"Answer in English.","role":"system"},{"role":"user","content":"Hi"}]`},
+		{"mandatory opt-out", config(inference.SystemPromptMandatory, ""), optedOut, systemPromptInjected, true,
+			`[{"content":"Answer in English.","role":"system"},{"role":"user","content":"Hi"}]`},
+		{"default", config(inference.SystemPromptDefault, ""), withoutSystem, systemPromptInjected, false,
+			`[{"content":"Answer in English.","role":"system"},{"role":"user","content":"Hi"}]`},
+		{"default client-provided", config(inference.SystemPromptDefault, ""), withSystem, systemPromptClientProvided, false,
+			`[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]`},
+		{"default opt-out", config(inference.SystemPromptDefault, ""), optedOut, systemPromptOptedOut, false,
+			`[{"role":"user","content":"Hi"}]`},
+		{"suggested", config(inference.SystemPromptSuggested, ""), withoutSystem, systemPromptNotOptedIn, false,
+			`[{"role":"user","content":"Hi"}]`},
+		{"suggested opt-in", config(inference.SystemPromptSuggested, ""), optedIn, systemPromptInjected, false,
+			`[{"content":"Answer in English.","role":"system"},{"role":"user","content":"Hi"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, record, err := applySystemPrompt(tt.config, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("applySystemPrompt failed: %v", err)
+			}
+			if record.Decision != tt.decision || record.OptOutDenied != tt.optOutDenied || record.Mode != tt.config.Mode {
+				t.Errorf("Unexpected record %+v", record)
+			}
+			var request map[string]json.RawMessage
+			if err := json.Unmarshal(body, &request); err != nil {
+				t.Fatalf("Invalid request %s: %v", body, err)
+			}
+			if _, ok := request[systemPromptField]; ok {
+				t.Errorf("Expected %s to be stripped", systemPromptField)
+			}
+			if string(request["messages"]) != tt.messages {
+				t.Errorf("Expected messages %s, got %s", tt.messages, request["messages"])
+			}
+		})
+	}
+
+	if _, _, err := applySystemPrompt(config(inference.SystemPromptDefault, ""), []byte(`{"server_system_prompt":"no","messages":[]}`)); err == nil {
+		t.Error("Expected error for a non-boolean opt-out")
+	}
+}
+
+func TestValidateSystemPromptConfig(t *testing.T) {
+	for _, invalid := range []inference.SystemPromptConfig{
+		{Mode: inference.SystemPromptDefault},
+		{Prompt: "p", Mode: "always"},
+		{Prompt: "p", Mode: inference.SystemPromptMandatory, Policy: "append"},
+		{Prompt: "p", Mode: inference.SystemPromptDefault, Policy: inference.SystemPromptOverride},
+	} {
+		if err := validateSystemPromptConfig(&invalid); err == nil {
+			t.Errorf("Expected error for %+v", invalid)
+		}
+	}
+	if err := validateSystemPromptConfig(&inference.SystemPromptConfig{Prompt: "p", Mode: inference.SystemPromptMandatory, Policy: inference.SystemPromptOverride}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
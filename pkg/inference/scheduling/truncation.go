@@ -0,0 +1,461 @@
+package scheduling
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/distribution/types"
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+const (
+	// defaultTruncationWindow is the number of messages kept by the
+	// sliding-window strategy if no window is configured.
+	defaultTruncationWindow = 8
+	// maximumSummaryTokens is the maximum number of tokens generated for a
+	// conversation summary.
+	maximumSummaryTokens = 512
+	// maximumSummaryTranscriptBytes is the maximum size of the transcript of
+	// truncated messages sent to the summary model. Longer transcripts are
+	// cut from the start.
+	maximumSummaryTranscriptBytes = 64 * 1024
+	// summaryInstructions are the instructions given to the summary model.
+	summaryInstructions = "Summarize the following conversation concisely, preserving the facts, decisions, and open questions needed to continue it. Reply with the summary only."
+)
+
+// validateTruncationConfig checks that a truncation configuration is valid.
+func validateTruncationConfig(config *inference.TruncationConfig) error {
+	if config == nil {
+		return nil
+	}
+	switch config.Strategy {
+	case inference.TruncationDropOldest, inference.TruncationSlidingWindow, inference.TruncationSummarize:
+	default:
+		return fmt.Errorf("unknown truncation strategy %q", config.Strategy)
+	}
+	if config.Window < 0 {
+		return errors.New("truncation window must not be negative")
+	} else if config.Window > 0 && config.Strategy != inference.TruncationSlidingWindow {
+		return fmt.Errorf("truncation window only applies to the %s strategy", inference.TruncationSlidingWindow)
+	}
+	if config.SummaryModel != "" && config.Strategy != inference.TruncationSummarize {
+		return fmt.Errorf("summary model only applies to the %s strategy", inference.TruncationSummarize)
+	}
+	return nil
+}
+
+// promptBudget returns the number of tokens available for the prompt in a
+// context window, after reserving max_tokens for generation, or a quarter of
+// the context window if max_tokens isn't specified.
+func promptBudget(contextWindow, maxTokens uint64) uint64 {
+	reserve := maxTokens
+	if reserve == 0 {
+		reserve = contextWindow / 4
+	}
+	if reserve >= contextWindow {
+		return 0
+	}
+	return contextWindow - reserve
+}
+
+// conversation is a chat completion request whose messages may be truncated.
+type conversation struct {
+	// fields are the request's top-level fields.
+	fields map[string]json.RawMessage
+	// messages are the request's messages.
+	messages []json.RawMessage
+	// roles are the roles of the messages.
+	roles []string
+	// maxTokens is the requested maximum number of generated tokens, or 0 if
+	// unspecified.
+	maxTokens uint64
+}
+
+// parseConversation parses a chat completion request.
+func parseConversation(body []byte) (*conversation, error) {
+	c := &conversation{}
+	if err := json.Unmarshal(body, &c.fields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(c.fields["messages"], &c.messages); err != nil {
+		return nil, err
+	}
+	c.roles = make([]string, len(c.messages))
+	for i, message := range c.messages {
+		var fields struct {
+			Role string `json:"role"`
+		}
+		if err := json.Unmarshal(message, &fields); err != nil {
+			return nil, err
+		}
+		c.roles[i] = fields.Role
+	}
+	for _, name := range []string{"max_tokens", "max_completion_tokens"} {
+		var value uint64
+		if json.Unmarshal(c.fields[name], &value) == nil && value > 0 {
+			c.maxTokens = value
+		}
+	}
+	return c, nil
+}
+
+// pinned returns whether the message at index i may never be truncated.
+func (c *conversation) pinned(i int) bool {
+	return c.roles[i] == "system" || c.roles[i] == "developer" || i == len(c.messages)-1
+}
+
+// estimatedTokens returns a rough estimate of the number of prompt tokens in
+// the request if only the kept messages are sent.
+func (c *conversation) estimatedTokens(keep []bool) uint64 {
+	var size int
+	for name, value := range c.fields {
+		if name != "messages" {
+			size += len(value)
+		}
+	}
+	for i, message := range c.messages {
+		if keep[i] {
+			size += len(message)
+		}
+	}
+	return uint64(size) / approximateBytesPerToken
+}
+
+// droppableGroups returns the groups of message indices that may be dropped,
+// oldest first. Tool results are grouped with the preceding message, so that
+// tool calls aren't separated from their results.
+func (c *conversation) droppableGroups() [][]int {
+	var groups [][]int
+	for i := range c.messages {
+		if c.roles[i] == "tool" && len(groups) > 0 && groups[len(groups)-1][len(groups[len(groups)-1])-1] == i-1 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], i)
+		} else if !c.pinned(i) {
+			groups = append(groups, []int{i})
+		}
+	}
+	// Drop groups that contain the last message, which is pinned.
+	for len(groups) > 0 && c.pinned(groups[len(groups)-1][len(groups[len(groups)-1])-1]) {
+		groups = groups[:len(groups)-1]
+	}
+	return groups
+}
+
+// dropOldest drops the oldest droppable messages until the kept messages fit
+// within budget. It returns whether they fit.
+func (c *conversation) dropOldest(keep []bool, budget uint64) bool {
+	for _, group := range c.droppableGroups() {
+		if c.estimatedTokens(keep) <= budget {
+			return true
+		}
+		for _, i := range group {
+			keep[i] = false
+		}
+	}
+	return c.estimatedTokens(keep) <= budget
+}
+
+// dropOutsideWindow drops the droppable messages that precede the most recent
+// window non-system messages.
+func (c *conversation) dropOutsideWindow(keep []bool, window int) {
+	start := len(c.messages)
+	for i := len(c.messages) - 1; i >= 0 && window > 0; i-- {
+		if c.roles[i] != "system" && c.roles[i] != "developer" {
+			start = i
+			window--
+		}
+	}
+	for _, group := range c.droppableGroups() {
+		if group[0] < start {
+			for _, i := range group {
+				keep[i] = false
+			}
+		}
+	}
+}
+
+// body returns the request body containing only the kept messages. If summary
+// is non-empty, it's appended to the leading system message, or added as a
+// system message if there isn't one.
+func (c *conversation) body(keep []bool, summary string) ([]byte, error) {
+	messages := make([]json.RawMessage, 0, len(c.messages)+1)
+	for i, message := range c.messages {
+		if keep[i] {
+			messages = append(messages, message)
+		}
+	}
+	if summary != "" {
+		summary = "Summary of the earlier conversation:\n" + summary
+		var system map[string]json.RawMessage
+		var content string
+		if len(messages) > 0 && c.roles[0] == "system" && keep[0] &&
+			json.Unmarshal(messages[0], &system) == nil && json.Unmarshal(system["content"], &content) == nil {
+			system["content"], _ = json.Marshal(content + "\n\n" + summary)
+			encoded, err := json.Marshal(system)
+			if err != nil {
+				return nil, err
+			}
+			messages[0] = encoded
+		} else {
+			encoded, err := json.Marshal(map[string]string{"role": "system", "content": summary})
+			if err != nil {
+				return nil, err
+			}
+			messages = append([]json.RawMessage{encoded}, messages...)
+		}
+	}
+
+	encoded, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage, len(c.fields))
+	for name, value := range c.fields {
+		fields[name] = value
+	}
+	fields["messages"] = encoded
+	return json.Marshal(fields)
+}
+
+// summarizer summarizes messages in at most maxTokens tokens.
+type summarizer func(messages []json.RawMessage, maxTokens uint64) (string, error)
+
+// truncate truncates a conversation to fit within budget tokens using the
+// specified configuration. It returns the rewritten request body and the
+// number of messages that were removed. If the conversation can't be made to
+// fit, an ErrInvalidRequest error is returned.
+func truncate(c *conversation, config inference.TruncationConfig, budget uint64, summarize summarizer) ([]byte, int, error) {
+	keep := make([]bool, len(c.messages))
+	for i := range keep {
+		keep[i] = true
+	}
+	if c.estimatedTokens(keep) <= budget {
+		return nil, 0, nil
+	}
+
+	var summary string
+	fits := false
+	switch config.Strategy {
+	case inference.TruncationSlidingWindow:
+		window := config.Window
+		if window == 0 {
+			window = defaultTruncationWindow
+		}
+		c.dropOutsideWindow(keep, window)
+		fits = c.dropOldest(keep, budget)
+	case inference.TruncationSummarize:
+		// Make room for the summary, falling back to dropping messages if
+		// they can't be summarized.
+		summaryTokens := min(maximumSummaryTokens, budget/4)
+		if c.dropOldest(keep, budget-summaryTokens) {
+			var dropped []json.RawMessage
+			for i, message := range c.messages {
+				if !keep[i] {
+					dropped = append(dropped, message)
+				}
+			}
+			var err error
+			if summary, err = summarize(dropped, summaryTokens); err != nil {
+				summary = ""
+			}
+		}
+		if summary == "" {
+			for i := range keep {
+				keep[i] = true
+			}
+			fits = c.dropOldest(keep, budget)
+		} else {
+			fits = true
+		}
+	default:
+		fits = c.dropOldest(keep, budget)
+	}
+	if !fits {
+		return nil, 0, invalidf("the conversation (roughly %d tokens without truncated messages) can't be truncated to fit the %d tokens available for the prompt",
+			c.estimatedTokens(keep), budget)
+	}
+
+	removed := 0
+	for _, kept := range keep {
+		if !kept {
+			removed++
+		}
+	}
+	body, err := c.body(keep, summary)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to encode truncated conversation: %w", err)
+	}
+	return body, removed, nil
+}
+
+// truncateConversation truncates a chat completion request's conversation to
+// fit within the model's context using the model's configured truncation
+// strategy. If contextSize is non-zero, it's the context length requested by
+// the request. It returns a nil body if no truncation is necessary, including
+// if the model has no truncation strategy or its context length is unknown.
+func (s *Scheduler) truncateConversation(r *http.Request, backend inference.Backend, model types.Model, modelRef string, contextSize uint64, body []byte) ([]byte, int, error) {
+	modelID, err := model.ID()
+	if err != nil {
+		return nil, 0, nil
+	}
+	runnerConfig := s.loader.runnerConfig(r.Context(), backend.Name(), modelID, inference.BackendModeCompletion)
+	if runnerConfig == nil || runnerConfig.Truncation == nil {
+		return nil, 0, nil
+	}
+	config, err := model.Config()
+	if err != nil {
+		return nil, 0, nil
+	}
+	contextWindow := contextWindowForRunner(backend, config, withContextSizeOverride(runnerConfig, contextSize))
+	if contextWindow == nil {
+		return nil, 0, nil
+	}
+	c, err := parseConversation(body)
+	if err != nil {
+		return nil, 0, nil
+	}
+
+	summaryModel := runnerConfig.Truncation.SummaryModel
+	if summaryModel == "" {
+		summaryModel = modelRef
+	}
+	return truncate(c, *runnerConfig.Truncation, promptBudget(*contextWindow, c.maxTokens), func(messages []json.RawMessage, maxTokens uint64) (string, error) {
+		summary, err := s.summarize(r, summaryModel, messages, maxTokens)
+		if err != nil {
+			s.log.Warnf("Unable to summarize conversation for %s, dropping messages instead: %v", modelRef, err)
+		}
+		return summary, err
+	})
+}
+
+// summarize summarizes messages using a chat completion request to model,
+// issued on behalf of the original request.
+func (s *Scheduler) summarize(r *http.Request, model string, messages []json.RawMessage, maxTokens uint64) (string, error) {
+	var transcript strings.Builder
+	for _, message := range messages {
+		var fields struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		}
+		if json.Unmarshal(message, &fields) != nil {
+			continue
+		}
+		if text := messageText(fields.Content); text != "" {
+			fmt.Fprintf(&transcript, "%s: %s\n\n", fields.Role, text)
+		}
+	}
+	text := transcript.String()
+	if len(text) > maximumSummaryTranscriptBytes {
+		text = strings.ToValidUTF8(text[len(text)-maximumSummaryTranscriptBytes:], "")
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", errors.New("no text to summarize")
+	}
+
+	summary, err := s.chatCompletion(r, model, summaryInstructions, text, maxTokens)
+	if err != nil {
+		return "", fmt.Errorf("summary request failed: %w", err)
+	}
+	return summary, nil
+}
+
+// chatCompletion issues a non-streaming chat completion request to model with
+// the specified instructions and input on behalf of r, returning the
+// completion's content.
+func (s *Scheduler) chatCompletion(r *http.Request, model, instructions, input string, maxTokens uint64) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"model": model,
+		"messages": []map[string]string{
+			{"role": "system", "content": instructions},
+			{"role": "user", "content": input},
+		},
+		"max_tokens": maxTokens,
+		"stream":     false,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	recorder := &bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}
+	s.ServeHTTP(recorder, newInternalRequest(r, inference.InferencePrefix+"/v1/chat/completions", body))
+	if recorder.statusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d: %s", recorder.statusCode, strings.TrimSpace(recorder.body.String()))
+	}
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(recorder.body.Bytes(), &response); err != nil || len(response.Choices) == 0 {
+		return "", errors.New("invalid response")
+	}
+	content := strings.TrimSpace(response.Choices[0].Message.Content)
+	if content == "" {
+		return "", errors.New("empty response")
+	}
+	return content, nil
+}
+
+// messageText returns the text of a message's content, concatenating text
+// content parts.
+func messageText(content json.RawMessage) string {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(content, &parts) != nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// newInternalRequest creates a request to path with the specified JSON body,
+// issued by the scheduler on behalf of r. The request preserves r's headers
+// (User-Agent, etc.), except for those that only apply to r.
+func newInternalRequest(r *http.Request, path string, body []byte) *http.Request {
+	request := r.Clone(r.Context())
+	request.URL.Path = path
+	request.URL.RawQuery = ""
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	request.ContentLength = int64(len(body))
+	request.Header.Set("Content-Type", "application/json")
+	for _, header := range []string{inference.DryRunHeader, inference.IdempotencyKeyHeader, inference.QueueProgressHeader, "Accept-Encoding"} {
+		request.Header.Del(header)
+	}
+	return request
+}
+
+// bufferedResponseWriter is an http.ResponseWriter that buffers a response.
+type bufferedResponseWriter struct {
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
@@ -0,0 +1,205 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+// conversationBody builds a chat completion request body with the specified
+// messages, each of which is a role and content pair.
+func conversationBody(messages ...string) []byte {
+	var encoded []map[string]string
+	for i := 0; i+1 < len(messages); i += 2 {
+		encoded = append(encoded, map[string]string{"role": messages[i], "content": messages[i+1]})
+	}
+	body, _ := json.Marshal(map[string]any{"model": "m", "messages": encoded})
+	return body
+}
+
+// messageContents returns the role and content of each message in a body.
+func messageContents(t *testing.T, body []byte) []string {
+	t.Helper()
+	var request struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatalf("Invalid body %s: %v", body, err)
+	}
+	var contents []string
+	for _, message := range request.Messages {
+		contents = append(contents, message.Role+": "+message.Content)
+	}
+	return contents
+}
+
+func TestValidateTruncationConfig(t *testing.T) {
+	valid := []*inference.TruncationConfig{
+		nil,
+		{Strategy: inference.TruncationDropOldest},
+		{Strategy: inference.TruncationSlidingWindow, Window: 4},
+		{Strategy: inference.TruncationSummarize, SummaryModel: "ai/smollm2"},
+	}
+	for _, config := range valid {
+		if err := validateTruncationConfig(config); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", config, err)
+		}
+	}
+	invalid := []*inference.TruncationConfig{
+		{Strategy: "truncate-middle"},
+		{Strategy: inference.TruncationSlidingWindow, Window: -1},
+		{Strategy: inference.TruncationDropOldest, Window: 4},
+		{Strategy: inference.TruncationDropOldest, SummaryModel: "ai/smollm2"},
+	}
+	for _, config := range invalid {
+		if err := validateTruncationConfig(config); err == nil {
+			t.Errorf("Expected %+v to be invalid", config)
+		}
+	}
+}
+
+func TestPromptBudget(t *testing.T) {
+	if budget := promptBudget(4096, 0); budget != 3072 {
+		t.Errorf("Expected a quarter of the context to be reserved, got %d", budget)
+	}
+	if budget := promptBudget(4096, 1000); budget != 3096 {
+		t.Errorf("Expected max_tokens to be reserved, got %d", budget)
+	}
+	if budget := promptBudget(4096, 5000); budget != 0 {
+		t.Errorf("Expected no budget, got %d", budget)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	// Each message is roughly 30 tokens.
+	filler := strings.Repeat("x", 100)
+	body := conversationBody(
+		"system", "Be helpful.",
+		"user", "one "+filler,
+		"assistant", "two "+filler,
+		"user", "three "+filler,
+		"assistant", "four "+filler,
+		"user", "five "+filler,
+	)
+	noSummary := func([]json.RawMessage, uint64) (string, error) {
+		return "", errors.New("unexpected summary")
+	}
+
+	tests := []struct {
+		name      string
+		config    inference.TruncationConfig
+		budget    uint64
+		summarize summarizer
+		removed   int
+		want      []string
+	}{
+		{
+			name:      "fits",
+			config:    inference.TruncationConfig{Strategy: inference.TruncationDropOldest},
+			budget:    1000,
+			summarize: noSummary,
+		},
+		{
+			name:      "drop oldest",
+			config:    inference.TruncationConfig{Strategy: inference.TruncationDropOldest},
+			budget:    140,
+			summarize: noSummary,
+			removed:   2,
+			want:      []string{"system: Be helpful.", "user: three " + filler, "assistant: four " + filler, "user: five " + filler},
+		},
+		{
+			name:      "sliding window",
+			config:    inference.TruncationConfig{Strategy: inference.TruncationSlidingWindow, Window: 2},
+			budget:    150,
+			summarize: noSummary,
+			removed:   3,
+			want:      []string{"system: Be helpful.", "assistant: four " + filler, "user: five " + filler},
+		},
+		{
+			name:   "summarize",
+			config: inference.TruncationConfig{Strategy: inference.TruncationSummarize},
+			budget: 140,
+			summarize: func(messages []json.RawMessage, maxTokens uint64) (string, error) {
+				if len(messages) != 3 || maxTokens != 35 {
+					return "", fmt.Errorf("unexpected summary request for %d messages in %d tokens", len(messages), maxTokens)
+				}
+				return "We counted.", nil
+			},
+			removed: 3,
+			want:    []string{"system: Be helpful.\n\nSummary of the earlier conversation:\nWe counted.", "assistant: four " + filler, "user: five " + filler},
+		},
+		{
+			name:   "summary failure",
+			config: inference.TruncationConfig{Strategy: inference.TruncationSummarize},
+			budget: 140,
+			summarize: func([]json.RawMessage, uint64) (string, error) {
+				return "", errors.New("model unavailable")
+			},
+			removed: 2,
+			want:    []string{"system: Be helpful.", "user: three " + filler, "assistant: four " + filler, "user: five " + filler},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := parseConversation(body)
+			if err != nil {
+				t.Fatalf("parseConversation failed: %v", err)
+			}
+			truncated, removed, err := truncate(c, test.config, test.budget, test.summarize)
+			if err != nil {
+				t.Fatalf("truncate failed: %v", err)
+			}
+			if removed != test.removed {
+				t.Errorf("Expected %d messages to be removed, got %d", test.removed, removed)
+			}
+			if test.want == nil {
+				if truncated != nil {
+					t.Errorf("Expected no truncation, got %s", truncated)
+				}
+				return
+			}
+			got := messageContents(t, truncated)
+			if strings.Join(got, "|") != strings.Join(test.want, "|") {
+				t.Errorf("Expected messages %q, got %q", test.want, got)
+			}
+		})
+	}
+
+	c, _ := parseConversation(body)
+	if _, _, err := truncate(c, inference.TruncationConfig{Strategy: inference.TruncationDropOldest}, 20, noSummary); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest when the conversation can't fit, got %v", err)
+	}
+}
+
+func TestTruncateKeepsToolResults(t *testing.T) {
+	filler := strings.Repeat("x", 200)
+	body := []byte(`{"messages":[
+		{"role":"user","content":"` + filler + `"},
+		{"role":"assistant","content":null,"tool_calls":[{"id":"1","type":"function","function":{"name":"f","arguments":"{}"}}]},
+		{"role":"tool","tool_call_id":"1","content":"` + filler + `"},
+		{"role":"assistant","content":"done"},
+		{"role":"user","content":"next"}
+	]}`)
+	c, err := parseConversation(body)
+	if err != nil {
+		t.Fatalf("parseConversation failed: %v", err)
+	}
+	groups := c.droppableGroups()
+	if fmt.Sprint(groups) != "[[0] [1 2] [3]]" {
+		t.Fatalf("Expected tool results to be grouped with their calls, got %v", groups)
+	}
+	truncated, removed, err := truncate(c, inference.TruncationConfig{Strategy: inference.TruncationDropOldest}, 40, nil)
+	if err != nil || removed != 3 {
+		t.Fatalf("Expected the tool call and its result to be removed together, got %d removed (%v)", removed, err)
+	}
+	if got := messageContents(t, truncated); len(got) != 2 || got[0] != "assistant: done" {
+		t.Errorf("Unexpected messages %q", got)
+	}
+}
@@ -0,0 +1,452 @@
+package scheduling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/distribution/distribution"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+	"github.com/docker/model-runner/pkg/inference/backends/vllm"
+	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+const (
+	// tuningIdlePeriod is the time for which no inference requests must have
+	// been waiting or in flight before tuning starts.
+	tuningIdlePeriod = 30 * time.Second
+	// tuningRounds is the number of times that every slot is filled with a
+	// concurrent request when measuring a slot count.
+	tuningRounds = 2
+	// tuningMaxTokens is the number of tokens generated by each tuning
+	// request.
+	tuningMaxTokens = 128
+	// tuningPrompt is the prompt of tuning requests.
+	tuningPrompt = "Write a long story about a lighthouse keeper."
+	// tuningUserAgent identifies tuning requests in usage analytics.
+	tuningUserAgent = "model-runner-tuner"
+	// tuningTolerance is the fraction of the best throughput within which
+	// the smallest slot count is recommended.
+	tuningTolerance = 0.05
+	// maximumTuningParallelism is the largest slot count that can be tuned.
+	maximumTuningParallelism = 64
+	// maximumBenchmarkHistory is the number of benchmark results retained per
+	// model digest, backend version, and device.
+	maximumBenchmarkHistory = 20
+)
+
+// defaultTuningCandidates are the slot counts measured by default.
+var defaultTuningCandidates = []int{1, 2, 4, 8}
+
+// tuningJob is a pending tuning of a model's parallel slot count.
+type tuningJob struct {
+	// request is the tuning request, with its candidates normalized.
+	request TuneRequest
+	// backendName is the backend that serves the model.
+	backendName string
+}
+
+// tuner queues tunings of parallel slot counts and records their results.
+type tuner struct {
+	// idlePeriod is the time for which the scheduler must be idle before
+	// tuning starts.
+	idlePeriod time.Duration
+	// wake is signalled when a tuning is queued.
+	wake chan struct{}
+	// mutex guards the subsequent fields.
+	mutex sync.Mutex
+	// queue holds the pending tunings, including the one in progress.
+	queue []tuningJob
+	// history maps benchmark keys to their results, from oldest to newest.
+	history map[benchmarkKey][]BenchmarkResult
+	// storage persists the history, if set.
+	storage storage.KV
+}
+
+// newTuner creates a new tuner.
+func newTuner() *tuner {
+	return &tuner{
+		idlePeriod: tuningIdlePeriod,
+		wake:       make(chan struct{}, 1),
+		history:    make(map[benchmarkKey][]BenchmarkResult),
+	}
+}
+
+// enqueue queues a tuning, returning false if the model is already queued.
+func (t *tuner) enqueue(job tuningJob) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, queued := range t.queue {
+		if queued.request.Model == job.request.Model {
+			return false
+		}
+	}
+	t.queue = append(t.queue, job)
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// next returns the next pending tuning, if any, which stays queued until it
+// finishes.
+func (t *tuner) next() (tuningJob, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.queue) == 0 {
+		return tuningJob{}, false
+	}
+	return t.queue[0], true
+}
+
+// finish dequeues the tuning in progress and records its result.
+func (t *tuner) finish(result BenchmarkResult) error {
+	t.mutex.Lock()
+	t.queue = t.queue[1:]
+	t.mutex.Unlock()
+	return t.record(result)
+}
+
+// record adds a result to the benchmark history, and persists the history of
+// its key if storage is set.
+func (t *tuner) record(result BenchmarkResult) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key := keyOf(result)
+	history := append(t.history[key], result)
+	if len(history) > maximumBenchmarkHistory {
+		history = history[len(history)-maximumBenchmarkHistory:]
+	}
+	t.history[key] = history
+	if t.storage == nil {
+		return nil
+	}
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return t.storage.Put(key.storageKey(), data)
+}
+
+// results returns the benchmark history of a model, identified by its ID or,
+// for results without one, its reference, across backend versions and
+// devices, ordered by completion.
+func (t *tuner) results(modelID string) []BenchmarkResult {
+	t.mutex.Lock()
+	var results []BenchmarkResult
+	for key, history := range t.history {
+		if key.modelID == modelID {
+			results = append(results, history...)
+		}
+	}
+	t.mutex.Unlock()
+	slices.SortStableFunc(results, func(a, b BenchmarkResult) int {
+		return a.Finished.Compare(b.Finished)
+	})
+	return results
+}
+
+// normalizeTuningCandidates validates, sorts, and deduplicates slot counts,
+// defaulting to defaultTuningCandidates.
+func normalizeTuningCandidates(candidates []int) ([]int, error) {
+	if len(candidates) == 0 {
+		return slices.Clone(defaultTuningCandidates), nil
+	}
+	for _, candidate := range candidates {
+		if candidate < 1 || candidate > maximumTuningParallelism {
+			return nil, invalidf("parallel slot counts must be between 1 and %d", maximumTuningParallelism)
+		}
+	}
+	candidates = slices.Clone(candidates)
+	slices.Sort(candidates)
+	return slices.Compact(candidates), nil
+}
+
+// recommendParallelism returns the smallest slot count whose throughput is
+// within tuningTolerance of the best, since fewer slots leave more of the
+// context for each request. It returns zero if there are no measurements.
+func recommendParallelism(measurements []ParallelismMeasurement) int {
+	var best float64
+	for _, measurement := range measurements {
+		best = max(best, measurement.TokensPerSecond)
+	}
+	recommended := 0
+	for _, measurement := range measurements {
+		if measurement.TokensPerSecond >= best*(1-tuningTolerance) &&
+			(recommended == 0 || measurement.Parallelism < recommended) {
+			recommended = measurement.Parallelism
+		}
+	}
+	return recommended
+}
+
+// runTuner runs queued tunings during idle periods until the context is
+// cancelled.
+func (s *Scheduler) runTuner(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.tuner.wake:
+		}
+		for {
+			job, ok := s.tuner.next()
+			if !ok {
+				break
+			}
+			if !s.waitForIdle(ctx, s.tuner.idlePeriod) {
+				return
+			}
+			if err := s.tuner.finish(s.tune(ctx, job)); err != nil {
+				s.log.Warnf("Failed to persist benchmark result: %v", err)
+			}
+		}
+	}
+}
+
+// waitForIdle waits until no inference requests have been waiting or in
+// flight for the specified period, returning false if the context is
+// cancelled first.
+func (s *Scheduler) waitForIdle(ctx context.Context, period time.Duration) bool {
+	interval := min(period, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	idleSince := time.Now()
+	for {
+		if s.Busy() {
+			idleSince = time.Now()
+		} else if time.Since(idleSince) >= period {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// tune measures the throughput of a model's runner with each candidate slot
+// count, then restores the model's configuration or applies the recommended
+// slot count.
+func (s *Scheduler) tune(ctx context.Context, job tuningJob) BenchmarkResult {
+	model := job.request.Model
+	modelID := s.modelManager.ResolveID(model)
+	original, configured := s.loader.configuredRunnerConfig(ctx, job.backendName, modelID, inference.BackendModeCompletion)
+	result := BenchmarkResult{
+		Model:          model,
+		ModelID:        modelID,
+		Backend:        job.backendName,
+		BackendVersion: backendVersion(s.backends[job.backendName], original.BackendVersion),
+		Device:         s.loader.benchmarkDevice(),
+		Source:         BenchmarkSourceTuning,
+		Started:        time.Now(),
+		Measurements:   []ParallelismMeasurement{},
+	}
+	s.log.Infof("Tuning parallel slot counts %v for %s", job.request.Candidates, model)
+
+	for _, parallelism := range job.request.Candidates {
+		tuned := original
+		tuned.Parallelism = parallelism
+		if err := s.loader.setRunnerConfig(ctx, job.backendName, modelID, inference.BackendModeCompletion, tuned); err != nil {
+			result.Error = fmt.Sprintf("unable to configure %d parallel slots: %v", parallelism, err)
+			break
+		}
+		tokensPerSecond, err := s.measureThroughput(ctx, job.backendName, model, parallelism)
+		if err != nil {
+			result.Error = fmt.Sprintf("unable to measure %d parallel slots: %v", parallelism, err)
+			break
+		}
+		s.log.Infof("Measured %.1f tokens/s for %s with %d parallel slots", tokensPerSecond, model, parallelism)
+		result.Measurements = append(result.Measurements, ParallelismMeasurement{
+			Parallelism:     parallelism,
+			TokensPerSecond: tokensPerSecond,
+		})
+	}
+
+	result.RecommendedParallelism = recommendParallelism(result.Measurements)
+	restored := original
+	if job.request.Apply && result.RecommendedParallelism > 0 {
+		restored.Parallelism = result.RecommendedParallelism
+		configured = true
+	}
+	if err := s.loader.restoreRunnerConfig(context.Background(), job.backendName, modelID, inference.BackendModeCompletion, restored, configured); err != nil {
+		s.log.Warnf("Unable to restore the configuration of %s after tuning: %v", model, err)
+	} else if restored.Parallelism != original.Parallelism {
+		result.Applied = true
+		s.log.Infof("Applied %d parallel slots to %s", restored.Parallelism, model)
+	}
+	result.Finished = time.Now()
+	return result
+}
+
+// measureThroughput measures the aggregate token generation rate of a model
+// by filling every slot with concurrent requests for a number of rounds,
+// after a warm-up request that loads the runner.
+func (s *Scheduler) measureThroughput(ctx context.Context, backendName, model string, parallelism int) (float64, error) {
+	if _, err := s.tuningRequest(ctx, backendName, model); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	var tokens int
+	for range tuningRounds {
+		counts := make([]int, parallelism)
+		errs := make([]error, parallelism)
+		var wg sync.WaitGroup
+		for i := range parallelism {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				counts[i], errs[i] = s.tuningRequest(ctx, backendName, model)
+			}()
+		}
+		wg.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return 0, err
+		}
+		for _, count := range counts {
+			tokens += count
+		}
+	}
+	return float64(tokens) / time.Since(start).Seconds(), nil
+}
+
+// tuningRequest issues a chat completion request for measuring throughput,
+// returning the number of tokens generated.
+func (s *Scheduler) tuningRequest(ctx context.Context, backendName, model string) (int, error) {
+	body, err := json.Marshal(map[string]any{
+		"model":      model,
+		"messages":   []map[string]string{{"role": "user", "content": tuningPrompt}},
+		"max_tokens": tuningMaxTokens,
+		"ignore_eos": true,
+		"stream":     false,
+	})
+	if err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, inference.InferencePrefix+"/"+backendName+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", tuningUserAgent)
+
+	recorder := &bufferedResponseWriter{statusCode: http.StatusOK, header: make(http.Header)}
+	s.ServeHTTP(recorder, request)
+	if recorder.statusCode != http.StatusOK {
+		return 0, fmt.Errorf("request failed with status %d: %s", recorder.statusCode, strings.TrimSpace(recorder.body.String()))
+	}
+	var response struct {
+		Usage struct {
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(recorder.body.Bytes(), &response); err != nil {
+		return 0, errors.New("invalid response")
+	}
+	return response.Usage.CompletionTokens, nil
+}
+
+// configuredRunnerConfig returns the runner configuration set for the
+// specified backend, model, and mode, without defaults applied, along with
+// whether one is set.
+func (l *loader) configuredRunnerConfig(ctx context.Context, backendName, modelID string, mode inference.BackendMode) (inference.BackendConfiguration, bool) {
+	if !l.lock(ctx) {
+		return inference.BackendConfiguration{}, false
+	}
+	defer l.unlock()
+	runnerConfig, ok := l.runnerConfigs[makeConfigKey(backendName, modelID, mode)]
+	return runnerConfig, ok
+}
+
+// restoreRunnerConfig sets the runner configuration for the specified
+// backend, model, and mode, or removes it if configured is false.
+func (l *loader) restoreRunnerConfig(ctx context.Context, backendName, modelID string, mode inference.BackendMode, runnerConfig inference.BackendConfiguration, configured bool) error {
+	if err := l.setRunnerConfig(ctx, backendName, modelID, mode, runnerConfig); err != nil {
+		return err
+	}
+	if !configured {
+		l.lock(ctx)
+		delete(l.runnerConfigs, makeConfigKey(backendName, modelID, mode))
+		l.unlock()
+	}
+	return nil
+}
+
+// Tune queues the tuning of a model's parallel slot count, which runs once
+// inference requests have been idle for a while. Results are added to the
+// model's benchmark history.
+func (s *Scheduler) Tune(w http.ResponseWriter, r *http.Request) {
+	var request TuneRequest
+	if !decodeAdminRequest(w, r, &request) {
+		return
+	}
+	if request.Model == "" {
+		http.Error(w, "model is required", http.StatusBadRequest)
+		return
+	}
+	candidates, err := normalizeTuningCandidates(request.Candidates)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.Candidates = candidates
+	request.Model = models.NormalizeModelName(request.Model)
+
+	model, err := s.modelManager.GetLocal(request.Model)
+	if errors.Is(err, distribution.ErrModelNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "model unavailable", http.StatusInternalServerError)
+		return
+	}
+	backend := s.selectBackendForModel(model, s.defaultBackend, request.Model)
+	if backend.Name() != llamacpp.Name && backend.Name() != vllm.Name {
+		http.Error(w, fmt.Sprintf("parallel slots are not supported by %s", backend.Name()), http.StatusBadRequest)
+		return
+	}
+
+	if !s.tuner.enqueue(tuningJob{request: request, backendName: backend.Name()}) {
+		http.Error(w, "model is already being tuned", http.StatusConflict)
+		return
+	}
+	s.log.Infof("Queued tuning of %s for the next idle period", request.Model)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(request); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetBenchmarks returns the benchmark history of the model specified by the
+// model query parameter.
+func (s *Scheduler) GetBenchmarks(w http.ResponseWriter, r *http.Request) {
+	model := r.URL.Query().Get("model")
+	if model == "" {
+		http.Error(w, "model is required", http.StatusBadRequest)
+		return
+	}
+	results := s.tuner.results(s.modelManager.ResolveID(models.NormalizeModelName(model)))
+	if results == nil {
+		results = []BenchmarkResult{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
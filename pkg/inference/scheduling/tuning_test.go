@@ -0,0 +1,169 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+func TestNormalizeTuningCandidates(t *testing.T) {
+	candidates, err := normalizeTuningCandidates(nil)
+	if err != nil || !slices.Equal(candidates, defaultTuningCandidates) {
+		t.Errorf("Expected default candidates, got %v (%v)", candidates, err)
+	}
+
+	candidates, err = normalizeTuningCandidates([]int{8, 2, 8, 1})
+	if err != nil || !slices.Equal(candidates, []int{1, 2, 8}) {
+		t.Errorf("Expected sorted, deduplicated candidates, got %v (%v)", candidates, err)
+	}
+
+	for _, invalid := range [][]int{{0}, {1, maximumTuningParallelism + 1}} {
+		if _, err := normalizeTuningCandidates(invalid); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("Expected ErrInvalidRequest for %v, got %v", invalid, err)
+		}
+	}
+}
+
+func TestRecommendParallelism(t *testing.T) {
+	tests := []struct {
+		name         string
+		measurements []ParallelismMeasurement
+		expected     int
+	}{
+		{name: "no measurements", expected: 0},
+		{
+			name: "best throughput",
+			measurements: []ParallelismMeasurement{
+				{Parallelism: 1, TokensPerSecond: 40},
+				{Parallelism: 2, TokensPerSecond: 70},
+				{Parallelism: 4, TokensPerSecond: 100},
+				{Parallelism: 8, TokensPerSecond: 80},
+			},
+			expected: 4,
+		},
+		{
+			name: "fewer slots within tolerance",
+			measurements: []ParallelismMeasurement{
+				{Parallelism: 1, TokensPerSecond: 40},
+				{Parallelism: 2, TokensPerSecond: 97},
+				{Parallelism: 4, TokensPerSecond: 100},
+			},
+			expected: 2,
+		},
+	}
+	for _, tt := range tests {
+		if recommended := recommendParallelism(tt.measurements); recommended != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.expected, recommended)
+		}
+	}
+}
+
+func TestTunerQueue(t *testing.T) {
+	tuner := newTuner()
+	if !tuner.enqueue(tuningJob{request: TuneRequest{Model: "ai/smollm2:latest"}}) {
+		t.Fatal("Expected the tuning to be queued")
+	}
+	if tuner.enqueue(tuningJob{request: TuneRequest{Model: "ai/smollm2:latest"}}) {
+		t.Error("Expected a duplicate tuning to be rejected")
+	}
+
+	for i := range maximumBenchmarkHistory + 1 {
+		if _, ok := tuner.next(); !ok {
+			tuner.enqueue(tuningJob{request: TuneRequest{Model: "ai/smollm2:latest"}})
+		}
+		tuner.finish(BenchmarkResult{Model: "ai/smollm2:latest", RecommendedParallelism: i + 1})
+	}
+	if _, ok := tuner.next(); ok {
+		t.Error("Expected the queue to be empty")
+	}
+	results := tuner.results("ai/smollm2:latest")
+	if len(results) != maximumBenchmarkHistory || results[len(results)-1].RecommendedParallelism != maximumBenchmarkHistory+1 {
+		t.Errorf("Expected the %d newest results, got %d", maximumBenchmarkHistory, len(results))
+	}
+}
+
+func TestWaitForIdle(t *testing.T) {
+	s := &Scheduler{}
+	if !s.waitForIdle(context.Background(), 10*time.Millisecond) {
+		t.Error("Expected an idle scheduler to become idle")
+	}
+
+	s.activeRequests.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if s.waitForIdle(ctx, 10*time.Millisecond) {
+		t.Error("Expected a busy scheduler not to become idle")
+	}
+}
+
+func TestCompareBenchmarks(t *testing.T) {
+	start := time.Now()
+	result := func(version string, finished time.Duration, tokensPerSecond float64) BenchmarkResult {
+		return BenchmarkResult{
+			ModelID:        "sha256:model",
+			Backend:        "llama.cpp",
+			BackendVersion: version,
+			Device:         "linux/amd64",
+			Source:         BenchmarkSourceTuning,
+			Finished:       start.Add(finished),
+			Measurements:   []ParallelismMeasurement{{Parallelism: 1, TokensPerSecond: tokensPerSecond}},
+		}
+	}
+	failed := result("c", 4*time.Minute, 10)
+	failed.Error = "unable to measure"
+	results := []BenchmarkResult{
+		result("a", time.Minute, 100),
+		result("b", 2*time.Minute, 95),
+		result("b", 3*time.Minute, 80),
+		failed,
+	}
+
+	comparisons := compareBenchmarks(results, defaultRegressionTolerance)
+	if len(comparisons) != 1 {
+		t.Fatalf("Expected one comparison, got %+v", comparisons)
+	}
+	comparison := comparisons[0]
+	if comparison.BaselineVersion != "a" || comparison.CandidateVersion != "b" ||
+		comparison.CandidateTokensPerSecond != 80 || !comparison.Regression {
+		t.Errorf("Expected a regression from a to b, got %+v", comparison)
+	}
+	if comparisons := compareBenchmarks(results, 0.25); comparisons[0].Regression {
+		t.Errorf("Expected no regression within the tolerance, got %+v", comparisons[0])
+	}
+	if comparisons := compareBenchmarks(results[:1], defaultRegressionTolerance); len(comparisons) != 0 {
+		t.Errorf("Expected no comparison without another version, got %+v", comparisons)
+	}
+}
+
+func TestBenchmarkStorage(t *testing.T) {
+	kv := storage.NewMemory()
+	tuner := newTuner()
+	if err := tuner.setStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, version := range []string{"a", "b"} {
+		err := tuner.record(BenchmarkResult{
+			Model:          "ai/smollm2:latest",
+			ModelID:        "sha256:model",
+			Backend:        "llama.cpp",
+			BackendVersion: version,
+			Device:         "linux/amd64",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	restored := newTuner()
+	if err := restored.setStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	results := restored.results("sha256:model")
+	if len(results) != 2 || results[0].BackendVersion == results[1].BackendVersion {
+		t.Errorf("Expected the results of both versions to be restored, got %+v", results)
+	}
+}
@@ -0,0 +1,270 @@
+package scheduling
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+)
+
+const (
+	// streamingUploadThreshold is the request size above which the prompts of
+	// chat completion requests are prefilled while they're being uploaded.
+	// Requests without a declared size (i.e. chunked uploads) are always
+	// prefilled while they're being uploaded.
+	streamingUploadThreshold = 1024 * 1024
+	// prefillInterval is the amount of conversation that must be received
+	// between incremental prefills.
+	prefillInterval = 512 * 1024
+)
+
+// readRequestBody reads the body of an inference request, subject to the
+// maximum request size. While the conversation of a large chat completion
+// request is being uploaded, the requested model's runner is started and the
+// conversation received so far is prefilled, so that most of the prompt is
+// already cached once the upload completes.
+func (s *Scheduler) readRequestBody(w http.ResponseWriter, r *http.Request, backend inference.Backend) ([]byte, error) {
+	reader := http.MaxBytesReader(w, r.Body, maximumOpenAIInferenceRequestSize)
+	if !strings.HasSuffix(r.URL.Path, "/chat/completions") || (r.ContentLength >= 0 && r.ContentLength <= streamingUploadThreshold) {
+		return io.ReadAll(reader)
+	}
+	if dryRun, _ := strconv.ParseBool(r.Header.Get(inference.DryRunHeader)); dryRun {
+		return io.ReadAll(reader)
+	}
+
+	// Prefill in the background so that the upload isn't slowed down. Only
+	// the most recent conversation is kept pending while a prefill is in
+	// progress.
+	var prefills chan []json.RawMessage
+	var finished chan struct{}
+	onModel := func(modelRef string) {
+		if prefills != nil {
+			return
+		}
+		prefiller := s.newUploadPrefiller(r, backend, modelRef)
+		if prefiller == nil {
+			return
+		}
+		prefills = make(chan []json.RawMessage, 1)
+		finished = make(chan struct{})
+		go func() {
+			defer close(finished)
+			prefiller.run(prefills)
+		}()
+	}
+	onMessages := func(messages []json.RawMessage) {
+		if prefills == nil {
+			return
+		}
+		select {
+		case <-prefills:
+		default:
+		}
+		prefills <- messages
+	}
+	body, err := readPrompt(reader, prefillInterval, onModel, onMessages)
+
+	// Wait for the prefill in progress, if any, since the request would
+	// otherwise compete with it for the cached prompt. Pending prefills are
+	// superseded by the request itself.
+	if prefills != nil {
+		select {
+		case <-prefills:
+		default:
+		}
+		close(prefills)
+		<-finished
+	}
+	return body, err
+}
+
+// readPrompt reads a chat completion request body while incrementally parsing
+// it. It calls onModel once the requested model has been received and
+// onMessages with the conversation received so far whenever another interval
+// bytes of messages have been received. Requests whose model follows their
+// messages are still read, but their conversation isn't reported. Invalid
+// requests are read without being parsed further, so that they can be
+// rejected once they've been read.
+func readPrompt(reader io.Reader, interval int64, onModel func(string), onMessages func([]json.RawMessage)) ([]byte, error) {
+	var body bytes.Buffer
+	decoder := json.NewDecoder(io.TeeReader(reader, &body))
+	parsePrompt(decoder, interval, onModel, onMessages)
+
+	// Read the remainder of the body, which also reports read errors that
+	// interrupted parsing.
+	if _, err := io.Copy(&body, reader); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// parsePrompt parses the top-level fields of a chat completion request.
+func parsePrompt(decoder *json.Decoder, interval int64, onModel func(string), onMessages func([]json.RawMessage)) error {
+	if token, err := decoder.Token(); err != nil {
+		return err
+	} else if token != json.Delim('{') {
+		return errors.New("request isn't an object")
+	}
+	modelReceived := false
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "model":
+			var model string
+			if err := decoder.Decode(&model); err != nil {
+				return err
+			}
+			if model != "" {
+				modelReceived = true
+				onModel(model)
+			}
+		case "messages":
+			if !modelReceived {
+				onMessages = func([]json.RawMessage) {}
+			}
+			if err := parseMessages(decoder, interval, onMessages); err != nil {
+				return err
+			}
+		default:
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseMessages parses the messages of a chat completion request.
+func parseMessages(decoder *json.Decoder, interval int64, onMessages func([]json.RawMessage)) error {
+	if token, err := decoder.Token(); err != nil {
+		return err
+	} else if token != json.Delim('[') {
+		return errors.New("messages aren't an array")
+	}
+	var messages []json.RawMessage
+	reported := decoder.InputOffset()
+	for decoder.More() {
+		var message json.RawMessage
+		if err := decoder.Decode(&message); err != nil {
+			return err
+		}
+		messages = append(messages, message)
+		if offset := decoder.InputOffset(); offset-reported >= interval {
+			reported = offset
+			onMessages(slices.Clone(messages))
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+// uploadPrefiller prefills the conversation of a chat completion request
+// that's being uploaded.
+type uploadPrefiller struct {
+	// s is the scheduler.
+	s *Scheduler
+	// r is the request being uploaded.
+	r *http.Request
+	// backend is the backend serving the request.
+	backend inference.Backend
+	// modelID and modelRef identify the requested model.
+	modelID  string
+	modelRef string
+	// systemPrompt is the system prompt configured for the model, if any,
+	// which is applied to the prefilled conversation as it will be to the
+	// request.
+	systemPrompt *inference.SystemPromptConfig
+}
+
+// newUploadPrefiller creates a prefiller for a request for the specified
+// model, or returns nil if the request won't be served by a llama.cpp runner
+// for a locally available model, whose prompt cache makes prefilling
+// worthwhile, or if the request will be rejected anyway.
+func (s *Scheduler) newUploadPrefiller(r *http.Request, backend inference.Backend, modelRef string) *uploadPrefiller {
+	if s.routes.lookup(modelRef) != nil || (r.PathValue("backend") == "" && s.mockBackendFor(modelRef) != nil) {
+		return nil
+	}
+	if backend.UsesExternalModelManagement() || s.maintenance.status().Enabled {
+		return nil
+	}
+	if s.quotas.Check(requestIdentity(r).Namespace) != nil {
+		return nil
+	}
+	model, err := s.modelManager.GetLocal(modelRef)
+	if err != nil {
+		return nil
+	}
+	backend = s.selectBackendForModel(model, backend, modelRef)
+	if backend.Name() != llamacpp.Name {
+		return nil
+	}
+	prefiller := &uploadPrefiller{
+		s:        s,
+		r:        r,
+		backend:  backend,
+		modelID:  s.modelManager.ResolveID(modelRef),
+		modelRef: modelRef,
+	}
+	if runnerConfig := s.loader.runnerConfig(r.Context(), backend.Name(), prefiller.modelID, inference.BackendModeCompletion); runnerConfig != nil {
+		prefiller.systemPrompt = runnerConfig.SystemPrompt
+	}
+	return prefiller
+}
+
+// run starts the model's runner and prefills conversations until prefills is
+// closed. It stops prefilling after the first failure.
+func (p *uploadPrefiller) run(prefills <-chan []json.RawMessage) {
+	ctx := p.r.Context()
+	if err := p.s.installer.wait(ctx, p.backend.Name()); err != nil {
+		return
+	}
+	runner, err := p.s.loader.load(ctx, p.backend.Name(), p.modelID, p.modelRef, inference.BackendModeCompletion, 0, nil)
+	if err != nil {
+		p.s.log.Warnf("Unable to start runner for %s while uploading prompt: %v", p.modelRef, err)
+		return
+	}
+	defer p.s.loader.release(runner)
+
+	for messages := range prefills {
+		if err := p.prefill(runner, messages); err != nil {
+			p.s.log.Warnf("Unable to prefill uploaded prompt for %s: %v", p.modelRef, err)
+			return
+		}
+	}
+}
+
+// prefill processes a conversation with the runner, generating a single token,
+// so that the backend caches its prompt.
+func (p *uploadPrefiller) prefill(runner *runner, messages []json.RawMessage) error {
+	body, err := json.Marshal(map[string]any{
+		"model":        p.modelRef,
+		"messages":     messages,
+		"max_tokens":   1,
+		"cache_prompt": true,
+	})
+	if err != nil {
+		return err
+	}
+	if p.systemPrompt != nil {
+		if body, _, err = applySystemPrompt(p.systemPrompt, body); err != nil {
+			return err
+		}
+	}
+	recorder := &bufferedResponseWriter{header: make(http.Header)}
+	runner.ServeHTTP(recorder, newInternalRequest(p.r, upstreamPath(p.r.URL.Path), body))
+	if recorder.statusCode != 0 && recorder.statusCode != http.StatusOK {
+		return errors.New(http.StatusText(recorder.statusCode))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadPrompt(t *testing.T) {
+	content := strings.Repeat("a", 100)
+	message := `{"role":"user","content":"` + content + `"}`
+	messages := "[" + strings.Repeat(message+",", 4) + message + "]"
+
+	for _, tt := range []struct {
+		name    string
+		body    string
+		model   string
+		reports []int
+	}{
+		{
+			name:    "model first",
+			body:    `{"model":"ai/smollm2","stream":true,"messages":` + messages + `}`,
+			model:   "ai/smollm2",
+			reports: []int{2, 4},
+		},
+		{
+			name:  "model last",
+			body:  `{"messages":` + messages + `,"model":"ai/smollm2"}`,
+			model: "ai/smollm2",
+		},
+		{
+			name: "invalid",
+			body: `{"model":"ai/smollm2","messages":{"role"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var model string
+			var reports []int
+			body, err := readPrompt(strings.NewReader(tt.body), 2*int64(len(message)), func(m string) {
+				model = m
+			}, func(received []json.RawMessage) {
+				if model == "" {
+					t.Error("Messages reported before model")
+				}
+				reports = append(reports, len(received))
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, body)
+			}
+			if tt.model != "" && model != tt.model {
+				t.Errorf("Expected model %q, got %q", tt.model, model)
+			}
+			if !slices.Equal(reports, tt.reports) {
+				t.Errorf("Expected conversations of %v messages to be reported, got %v", tt.reports, reports)
+			}
+		})
+	}
+}
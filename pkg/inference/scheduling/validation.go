@@ -0,0 +1,221 @@
+package scheduling
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidRequest indicates that an inference request is malformed. If
+// returned in conjunction with an HTTP request, it should be paired with a 400
+// response status.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// approximateBytesPerToken is the average number of bytes per token used to
+// estimate prompt lengths without a tokenizer.
+const approximateBytesPerToken = 4
+
+// chatMessageRoles are the valid chat message roles.
+var chatMessageRoles = []string{"system", "developer", "user", "assistant", "tool", "function"}
+
+// validationResult holds the information gathered while validating an
+// inference request.
+type validationResult struct {
+	// maxTokens is the requested maximum number of generated tokens, or 0 if
+	// unspecified.
+	maxTokens uint64
+	// estimatedPromptTokens is a rough estimate of the number of prompt
+	// tokens.
+	estimatedPromptTokens uint64
+}
+
+// invalidf returns an ErrInvalidRequest error with the specified message.
+func invalidf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRequest, fmt.Sprintf(format, args...))
+}
+
+// validateRequestSchema checks that the body of an OpenAI inference request to
+// the specified path is well-formed, to the extent that backends would reject
+// it otherwise. Unknown fields are ignored, since backends support various
+// extensions.
+func validateRequestSchema(path string, body []byte) (validationResult, error) {
+	var result validationResult
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return result, invalidf("request body must be a JSON object")
+	}
+
+	// Check the fields required by each endpoint.
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"):
+		var messages []map[string]json.RawMessage
+		if err := unmarshalField(fields, "messages", &messages); err != nil {
+			return result, err
+		} else if len(messages) == 0 {
+			return result, invalidf("messages must be a non-empty array")
+		}
+		for i, message := range messages {
+			var role string
+			if err := json.Unmarshal(message["role"], &role); err != nil || role == "" {
+				return result, invalidf("messages[%d]: role must be a non-empty string", i)
+			} else if !slices.Contains(chatMessageRoles, role) {
+				return result, invalidf("messages[%d]: unknown role %q", i, role)
+			}
+			content := message["content"]
+			if len(content) > 0 && !isJSONKind(content, '"', '[', 'n') {
+				return result, invalidf("messages[%d]: content must be a string or an array", i)
+			}
+			result.estimatedPromptTokens += uint64(len(content)) / approximateBytesPerToken
+		}
+	case strings.HasSuffix(path, "/completions"):
+		if err := requireField(fields, "prompt", '"', '['); err != nil {
+			return result, err
+		}
+		result.estimatedPromptTokens = uint64(len(fields["prompt"])) / approximateBytesPerToken
+	case strings.HasSuffix(path, "/embeddings"), strings.HasSuffix(path, "/moderations"), strings.HasSuffix(path, "/classify"):
+		if err := requireField(fields, "input", '"', '['); err != nil {
+			return result, err
+		}
+	case strings.HasSuffix(path, "/rerank"):
+		if err := requireField(fields, "query", '"'); err != nil {
+			return result, err
+		}
+		if err := requireField(fields, "documents", '['); err != nil {
+			return result, err
+		}
+	}
+
+	// Check the types and ranges of common optional fields.
+	var stream bool
+	if err := optionalField(fields, "stream", &stream); err != nil {
+		return result, err
+	}
+	for _, name := range []string{"max_tokens", "max_completion_tokens", "n"} {
+		var value uint64
+		if err := optionalField(fields, name, &value); err != nil {
+			return result, err
+		}
+		if name != "n" && value > 0 {
+			result.maxTokens = value
+		}
+	}
+	for name, limit := range map[string]float64{"temperature": 2, "top_p": 1} {
+		var value float64
+		if err := optionalField(fields, name, &value); err != nil {
+			return result, err
+		} else if value < 0 || value > limit {
+			return result, invalidf("%s must be between 0 and %g", name, limit)
+		}
+	}
+	if stop, ok := fields["stop"]; ok && !isJSONKind(stop, '"', '[', 'n') {
+		return result, invalidf("stop must be a string or an array of strings")
+	}
+
+	// Check tool definitions.
+	var tools []struct {
+		Type     string `json:"type"`
+		Function *struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := optionalField(fields, "tools", &tools); err != nil {
+		return result, err
+	}
+	for i, tool := range tools {
+		if tool.Type != "function" || tool.Function == nil || tool.Function.Name == "" {
+			return result, invalidf("tools[%d] must be a function with a name", i)
+		}
+	}
+
+	// Check that constrained output grammars compile.
+	var grammar string
+	if err := optionalField(fields, "grammar", &grammar); err != nil {
+		return result, err
+	}
+	if grammar != "" {
+		if err := checkGrammar(grammar); err != nil {
+			return result, invalidf("grammar: %v", err)
+		}
+	}
+	var responseFormat struct {
+		Type       string `json:"type"`
+		JSONSchema *struct {
+			Schema json.RawMessage `json:"schema"`
+		} `json:"json_schema"`
+		// Schema is a llama.cpp extension for json_object formats.
+		Schema json.RawMessage `json:"schema"`
+	}
+	if err := optionalField(fields, "response_format", &responseFormat); err != nil {
+		return result, err
+	}
+	var schema json.RawMessage
+	switch responseFormat.Type {
+	case "", "text":
+	case "json_object":
+		schema = responseFormat.Schema
+	case "json_schema":
+		if responseFormat.JSONSchema == nil || len(responseFormat.JSONSchema.Schema) == 0 {
+			return result, invalidf("response_format: json_schema.schema is required")
+		}
+		schema = responseFormat.JSONSchema.Schema
+	default:
+		return result, invalidf("response_format: unknown type %q", responseFormat.Type)
+	}
+	if len(schema) > 0 {
+		if grammar != "" {
+			return result, invalidf("grammar and a JSON schema response_format can't both be specified")
+		}
+		if err := checkJSONSchema(schema); err != nil {
+			return result, invalidf("response_format: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// isJSONKind returns whether the raw JSON value starts with one of the
+// specified characters (e.g. '"' for strings or '[' for arrays).
+func isJSONKind(value json.RawMessage, kinds ...byte) bool {
+	value = bytes.TrimSpace(value)
+	return len(value) > 0 && slices.Contains(kinds, value[0])
+}
+
+// requireField checks that the named field is present and of one of the
+// specified JSON kinds.
+func requireField(fields map[string]json.RawMessage, name string, kinds ...byte) error {
+	value, ok := fields[name]
+	if !ok || isJSONKind(value, 'n') {
+		return invalidf("%s is required", name)
+	}
+	if !isJSONKind(value, kinds...) {
+		return invalidf("%s has an invalid type", name)
+	}
+	return nil
+}
+
+// unmarshalField decodes the named (required) field into target.
+func unmarshalField(fields map[string]json.RawMessage, name string, target any) error {
+	value, ok := fields[name]
+	if !ok || isJSONKind(value, 'n') {
+		return invalidf("%s is required", name)
+	}
+	if err := json.Unmarshal(value, target); err != nil {
+		return invalidf("%s has an invalid type or value", name)
+	}
+	return nil
+}
+
+// optionalField decodes the named field into target if it's present and not
+// null.
+func optionalField(fields map[string]json.RawMessage, name string, target any) error {
+	value, ok := fields[name]
+	if !ok || isJSONKind(value, 'n') {
+		return nil
+	}
+	if err := json.Unmarshal(value, target); err != nil {
+		return invalidf("%s has an invalid type or value", name)
+	}
+	return nil
+}
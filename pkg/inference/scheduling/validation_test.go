@@ -0,0 +1,293 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/prompttemplate"
+)
+
+// promptTemplates is an in-memory prompttemplate.Store.
+type promptTemplates map[string]prompttemplate.Template
+
+func (p promptTemplates) PromptTemplate(id string) (prompttemplate.Template, error) {
+	template, ok := p[id]
+	if !ok {
+		return prompttemplate.Template{}, prompttemplate.ErrTemplateNotFound
+	}
+	return template, nil
+}
+
+func TestValidateRequestSchema(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		wantErr   string
+		maxTokens uint64
+	}{
+		{
+			name:      "valid chat completion",
+			path:      "/v1/chat/completions",
+			body:      `{"model":"m","messages":[{"role":"user","content":"hi"}],"max_tokens":16,"temperature":0.7,"stop":["\n"]}`,
+			maxTokens: 16,
+		},
+		{name: "not an object", path: "/v1/chat/completions", body: `[]`, wantErr: "JSON object"},
+		{name: "missing messages", path: "/v1/chat/completions", body: `{"model":"m"}`, wantErr: "messages is required"},
+		{name: "empty messages", path: "/v1/chat/completions", body: `{"model":"m","messages":[]}`, wantErr: "non-empty"},
+		{name: "unknown role", path: "/v1/chat/completions", body: `{"messages":[{"role":"robot","content":"hi"}]}`, wantErr: "unknown role"},
+		{name: "invalid content", path: "/v1/chat/completions", body: `{"messages":[{"role":"user","content":42}]}`, wantErr: "content"},
+		{name: "missing prompt", path: "/v1/completions", body: `{"model":"m"}`, wantErr: "prompt is required"},
+		{name: "valid embeddings", path: "/v1/embeddings", body: `{"model":"m","input":["a","b"]}`},
+		{name: "missing input", path: "/v1/embeddings", body: `{"model":"m"}`, wantErr: "input is required"},
+		{name: "missing documents", path: "/rerank", body: `{"model":"m","query":"q"}`, wantErr: "documents is required"},
+		{name: "negative max_tokens", path: "/v1/completions", body: `{"prompt":"p","max_tokens":-1}`, wantErr: "max_tokens"},
+		{name: "temperature out of range", path: "/v1/completions", body: `{"prompt":"p","temperature":3}`, wantErr: "temperature"},
+		{name: "invalid stream", path: "/v1/completions", body: `{"prompt":"p","stream":"yes"}`, wantErr: "stream"},
+		{name: "unnamed tool", path: "/v1/chat/completions", body: `{"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{}}]}`, wantErr: "tools[0]"},
+		{name: "invalid grammar", path: "/v1/completions", body: `{"prompt":"p","grammar":"root ::= item"}`, wantErr: "undefined rule"},
+		{name: "missing json schema", path: "/v1/completions", body: `{"prompt":"p","response_format":{"type":"json_schema"}}`, wantErr: "json_schema.schema"},
+		{name: "invalid json schema", path: "/v1/completions", body: `{"prompt":"p","response_format":{"type":"json_schema","json_schema":{"schema":{"type":"thing"}}}}`, wantErr: "unknown type"},
+		{name: "grammar and schema", path: "/v1/completions", body: `{"prompt":"p","grammar":"root ::= \"a\"","response_format":{"type":"json_object","schema":{}}}`, wantErr: "both"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := validateRequestSchema(tt.path, []byte(tt.body))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if result.maxTokens != tt.maxTokens {
+					t.Errorf("Expected max tokens %d, got %d", tt.maxTokens, result.maxTokens)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidRequest) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected ErrInvalidRequest containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckGrammar(t *testing.T) {
+	tests := []struct {
+		name    string
+		grammar string
+		wantErr string
+	}{
+		{
+			name: "json-like",
+			grammar: `# A small JSON subset.
+root   ::= object
+object ::=
+  "{" ws (
+    string ":" ws value
+    ("," ws string ":" ws value)*
+  )? "}" ws
+value  ::= object | string | [0-9]+ | ("true" | "false")
+string ::= "\"" ([^"\\\x7F\x00-\x1F] | "\\" ["\\/bfnrt])* "\"" ws
+ws     ::= [ \t\n]{0,20}
+`,
+		},
+		{name: "no root", grammar: `item ::= "a"`, wantErr: "root"},
+		{name: "undefined rule", grammar: `root ::= item`, wantErr: "undefined rule"},
+		{name: "unterminated literal", grammar: `root ::= "a`, wantErr: "string literal"},
+		{name: "unterminated class", grammar: `root ::= [a-z`, wantErr: "character class"},
+		{name: "unbalanced group", grammar: `root ::= ("a" | "b"`, wantErr: "')'"},
+		{name: "dangling repetition", grammar: `root ::= *`, wantErr: "preceding item"},
+		{name: "invalid range", grammar: `root ::= "a"{3,1}`, wantErr: "repetition range"},
+		{name: "missing definition", grammar: `root "a"`, wantErr: "::="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkGrammar(tt.grammar)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckJSONSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			schema: `{"type":"object","properties":{"name":{"type":"string","pattern":"^[a-z]+$"},` +
+				`"items":{"type":"array","items":{"$ref":"#/$defs/item"},"minItems":1}},` +
+				`"required":["name"],"$defs":{"item":{"anyOf":[{"type":"integer"},{"type":"null"}]}}}`,
+		},
+		{name: "boolean", schema: `true`},
+		{name: "not an object", schema: `"string"`, wantErr: "object or a boolean"},
+		{name: "unknown type", schema: `{"type":["string","text"]}`, wantErr: "unknown type"},
+		{name: "unresolved reference", schema: `{"$ref":"#/$defs/missing"}`, wantErr: "unresolved reference"},
+		{name: "remote reference", schema: `{"$ref":"https://example.com/schema.json"}`, wantErr: "only local references"},
+		{name: "unanchored pattern", schema: `{"type":"string","pattern":"[a-z]+"}`, wantErr: "pattern"},
+		{name: "invalid required", schema: `{"required":[1]}`, wantErr: "array of strings"},
+		{name: "empty anyOf", schema: `{"anyOf":[]}`, wantErr: "non-empty array"},
+		{name: "nested invalid", schema: `{"properties":{"a":{"minLength":-1}}}`, wantErr: "#/properties/a/minLength"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkJSONSchema(json.RawMessage(tt.schema))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	log := createTestLogger()
+	backend := &mockBackend{name: "mock", usesExternalModelMgmt: true}
+	s := NewScheduler(log, map[string]inference.Backend{"mock": backend}, backend, nil, nil, nil, nil, nil, systemMemoryInfo{})
+
+	t.Run("valid", func(t *testing.T) {
+		body := `{"model":"m","messages":[{"role":"user","content":"hi"}]}`
+		req := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/mock/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set(inference.DryRunHeader, "1")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response DryRunResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Backend != "mock" || response.Mode != inference.BackendModeCompletion.String() {
+			t.Errorf("Unexpected backend or mode: %+v", response)
+		}
+		if response.Upstream.Path != "/v1/chat/completions" || string(response.Upstream.Body) != body {
+			t.Errorf("Unexpected upstream request: %+v", response.Upstream)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		body := `{"model":"m","messages":[]}`
+		req := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/mock/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set(inference.DryRunHeader, "true")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("moderation", func(t *testing.T) {
+		s.SetModerationModel("ai/classifier")
+		defer s.SetModerationModel("")
+		req := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/mock/v1/moderations", strings.NewReader(`{"input":"hi"}`))
+		req.Header.Set(inference.DryRunHeader, "1")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response DryRunResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Model != "ai/classifier" || response.Mode != inference.BackendModeClassification.String() {
+			t.Errorf("Unexpected model or mode: %+v", response)
+		}
+		if response.Upstream.Path != "/v1/embeddings" || string(response.Upstream.Body) != `{"encoding_format":"float","input":["hi"],"model":"ai/classifier"}` {
+			t.Errorf("Unexpected upstream request: %+v", response.Upstream)
+		}
+	})
+
+	t.Run("classification", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/mock/classify", strings.NewReader(`{"model":"ai/sentiment","input":["good","bad"]}`))
+		req.Header.Set(inference.DryRunHeader, "1")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response DryRunResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Mode != inference.BackendModeClassification.String() || response.Upstream.Path != "/v1/embeddings" {
+			t.Errorf("Unexpected dry run response: %+v", response)
+		}
+	})
+
+	t.Run("prompt template", func(t *testing.T) {
+		serve := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/mock/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set(inference.DryRunHeader, "1")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			return w
+		}
+		body := `{"model":"m","prompt_template":{"id":"pt_1","variables":{"topic":"Docker"}}}`
+		if w := serve(body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 without prompt templates, got %d", w.Code)
+		}
+
+		s.SetPromptTemplates(promptTemplates{"pt_1": {
+			ID:        "pt_1",
+			Name:      "summarize",
+			Messages:  []prompttemplate.Message{{Role: "user", Content: "Summarize {{topic}}."}},
+			Variables: []prompttemplate.Variable{{Name: "topic"}},
+		}})
+		defer s.SetPromptTemplates(nil)
+		w := serve(body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response DryRunResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if want := `{"messages":[{"role":"user","content":"Summarize Docker."}],"model":"m"}`; string(response.Upstream.Body) != want {
+			t.Errorf("Expected upstream body %s, got %s", want, response.Upstream.Body)
+		}
+
+		for body, code := range map[string]int{
+			`{"model":"m","prompt_template":{"id":"pt_2"}}`: http.StatusNotFound,
+			`{"model":"m","prompt_template":{"id":"pt_1"}}`: http.StatusBadRequest,
+		} {
+			if w := serve(body); w.Code != code {
+				t.Errorf("Expected status %d for %s, got %d", code, body, w.Code)
+			}
+		}
+	})
+}
+
+func TestCheckContextLength(t *testing.T) {
+	window := uint64(4096)
+	if err := checkContextLength(validationResult{maxTokens: 4096}, &window); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := checkContextLength(validationResult{maxTokens: 8192}, &window); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest, got %v", err)
+	}
+	if err := checkContextLength(validationResult{maxTokens: 8192}, nil); err != nil {
+		t.Errorf("Unexpected error for unknown context length: %v", err)
+	}
+}
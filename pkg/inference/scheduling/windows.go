@@ -0,0 +1,429 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+// servingWindowCheckInterval is the interval at which serving windows are
+// enforced for idle runners.
+const servingWindowCheckInterval = time.Minute
+
+// weekdays maps abbreviated day names to weekdays.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// windowRange is a daily time range on a set of days.
+type windowRange struct {
+	// days are the days on which the range starts.
+	days [7]bool
+	// start is the start of the range in minutes since midnight.
+	start int
+	// end is the end of the range in minutes since midnight. If it's not
+	// after start, the range extends past midnight into the following day.
+	end int
+}
+
+// contains returns whether the range contains the specified time.
+func (r windowRange) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if r.start < r.end {
+		return r.days[day] && minute >= r.start && minute < r.end
+	}
+	previous := (day + 6) % 7
+	return (r.days[day] && minute >= r.start) || (r.days[previous] && minute < r.end)
+}
+
+// Window is a recurring weekly time window in local time, such as working
+// hours. A nil window contains all times.
+type Window struct {
+	// spec is the specification from which the window was parsed.
+	spec string
+	// ranges are the time ranges that make up the window.
+	ranges []windowRange
+}
+
+// ParseWindow parses a window specification consisting of one or more
+// semicolon-separated ranges of the form "[DAYS ]HH:MM-HH:MM", where DAYS is a
+// comma-separated list of days (e.g. "Mon") or day ranges (e.g. "Mon-Fri") and
+// defaults to every day, e.g. "Mon-Fri 09:00-18:00; Sat 10:00-14:00". Ranges
+// whose end isn't after their start extend past midnight, e.g. "22:00-06:00".
+// It returns nil for an empty specification.
+func ParseWindow(spec string) (*Window, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	window := &Window{spec: spec}
+	for _, part := range strings.Split(spec, ";") {
+		fields := strings.Fields(part)
+		var r windowRange
+		var times string
+		switch len(fields) {
+		case 1:
+			for day := range r.days {
+				r.days[day] = true
+			}
+			times = fields[0]
+		case 2:
+			if err := parseWindowDays(fields[0], &r.days); err != nil {
+				return nil, err
+			}
+			times = fields[1]
+		default:
+			return nil, fmt.Errorf("invalid window range %q: expected [DAYS ]HH:MM-HH:MM", strings.TrimSpace(part))
+		}
+		start, end, ok := strings.Cut(times, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid window times %q: expected HH:MM-HH:MM", times)
+		}
+		var err error
+		if r.start, err = parseWindowTime(start); err != nil {
+			return nil, err
+		}
+		if r.end, err = parseWindowTime(end); err != nil {
+			return nil, err
+		}
+		if r.start == 24*60 {
+			return nil, fmt.Errorf("invalid window start time %q", start)
+		}
+		window.ranges = append(window.ranges, r)
+	}
+	return window, nil
+}
+
+// parseWindowDays parses a comma-separated list of days and day ranges into
+// days.
+func parseWindowDays(spec string, days *[7]bool) error {
+	for _, item := range strings.Split(spec, ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		start, ok := weekdays[strings.ToLower(first)]
+		if !ok {
+			return fmt.Errorf("invalid window day %q", first)
+		}
+		end := start
+		if isRange {
+			if end, ok = weekdays[strings.ToLower(last)]; !ok {
+				return fmt.Errorf("invalid window day %q", last)
+			}
+		}
+		for day := start; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == end {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseWindowTime parses a time of day of the form HH:MM (up to 24:00) into
+// minutes since midnight.
+func parseWindowTime(spec string) (int, error) {
+	hours, minutes, ok := strings.Cut(spec, ":")
+	h, hErr := strconv.Atoi(hours)
+	m, mErr := strconv.Atoi(minutes)
+	if !ok || hErr != nil || mErr != nil || len(minutes) != 2 || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid window time %q: expected HH:MM", spec)
+	}
+	return h*60 + m, nil
+}
+
+// Contains returns whether the window contains the specified time, which is
+// converted to local time.
+func (w *Window) Contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	t = t.Local()
+	for _, r := range w.ranges {
+		if r.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the window's specification.
+func (w *Window) String() string {
+	if w == nil {
+		return ""
+	}
+	return w.spec
+}
+
+// WindowPolicy restricts when models are kept loaded and when they may be
+// pulled. Nil windows impose no restrictions.
+type WindowPolicy struct {
+	// Serving is when runners are kept loaded between requests. Outside it,
+	// requests are still served, but runners are unloaded once idle.
+	Serving *Window
+	// Pulls is when models may be pulled.
+	Pulls *Window
+}
+
+// servingWindows tracks the global and per-model window policies and the
+// models pinned to override them.
+type servingWindows struct {
+	// mutex guards all subsequent fields.
+	mutex sync.Mutex
+	// global is the policy for models without their own policy.
+	global WindowPolicy
+	// models maps normalized model references to their policies.
+	models map[string]WindowPolicy
+	// pins maps normalized model references to the time at which their pins
+	// expire, which is zero for pins that don't expire.
+	pins map[string]time.Time
+}
+
+// newServingWindows creates a new set of window policies without
+// restrictions.
+func newServingWindows() *servingWindows {
+	return &servingWindows{
+		models: make(map[string]WindowPolicy),
+		pins:   make(map[string]time.Time),
+	}
+}
+
+// setPolicy sets the policy for a model, or the global policy if model is
+// empty. A model policy without windows is removed.
+func (sw *servingWindows) setPolicy(model string, policy WindowPolicy) {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	if model == "" {
+		sw.global = policy
+	} else if policy.Serving == nil && policy.Pulls == nil {
+		delete(sw.models, models.NormalizeModelName(model))
+	} else {
+		sw.models[models.NormalizeModelName(model)] = policy
+	}
+}
+
+// policyFor returns the policy for a model. The caller must hold the mutex.
+func (sw *servingWindows) policyFor(model string) WindowPolicy {
+	if policy, ok := sw.models[model]; ok {
+		return policy
+	}
+	return sw.global
+}
+
+// pinnedAt returns whether a model is pinned at the specified time. The
+// caller must hold the mutex.
+func (sw *servingWindows) pinnedAt(model string, now time.Time) bool {
+	until, ok := sw.pins[model]
+	if ok && !until.IsZero() && !now.Before(until) {
+		delete(sw.pins, model)
+		return false
+	}
+	return ok
+}
+
+// pin pins a model until the specified time, or indefinitely if until is
+// zero.
+func (sw *servingWindows) pin(model string, until time.Time) {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	sw.pins[models.NormalizeModelName(model)] = until
+}
+
+// unpin unpins a model and returns whether it was pinned.
+func (sw *servingWindows) unpin(model string) bool {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	model = models.NormalizeModelName(model)
+	pinned := sw.pinnedAt(model, time.Now())
+	delete(sw.pins, model)
+	return pinned
+}
+
+// keepLoaded returns whether runners for a model may be kept loaded between
+// requests at the specified time.
+func (sw *servingWindows) keepLoaded(model string, now time.Time) bool {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	model = models.NormalizeModelName(model)
+	return sw.pinnedAt(model, now) || sw.policyFor(model).Serving.Contains(now)
+}
+
+// pullAllowed returns an error if a model may not be pulled at the specified
+// time.
+func (sw *servingWindows) pullAllowed(model string, now time.Time) error {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	model = models.NormalizeModelName(model)
+	if window := sw.policyFor(model).Pulls; !sw.pinnedAt(model, now) && !window.Contains(now) {
+		return fmt.Errorf("%s may only be pulled during %q", model, window)
+	}
+	return nil
+}
+
+// status returns the API representation of the policies and pins.
+func (sw *servingWindows) status(now time.Time) WindowsResponse {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	response := WindowsResponse{
+		Global: WindowPolicySpec{Serving: sw.global.Serving.String(), Pulls: sw.global.Pulls.String()},
+		Models: make(map[string]WindowPolicySpec, len(sw.models)),
+		Pins:   []Pin{},
+	}
+	for model, policy := range sw.models {
+		response.Models[model] = WindowPolicySpec{Serving: policy.Serving.String(), Pulls: policy.Pulls.String()}
+	}
+	for model, until := range sw.pins {
+		if sw.pinnedAt(model, now) {
+			response.Pins = append(response.Pins, newPin(model, until))
+		}
+	}
+	sort.Slice(response.Pins, func(i, j int) bool {
+		return response.Pins[i].Model < response.Pins[j].Model
+	})
+	return response
+}
+
+// newPin returns the API representation of a pin.
+func newPin(model string, until time.Time) Pin {
+	pin := Pin{Model: model}
+	if !until.IsZero() {
+		pin.Until = &until
+	}
+	return pin
+}
+
+// SetWindowPolicy sets the global window policy.
+func (s *Scheduler) SetWindowPolicy(policy WindowPolicy) {
+	s.windows.setPolicy("", policy)
+}
+
+// enforceServingWindows periodically unloads idle runners whose models are
+// outside their serving windows.
+func (s *Scheduler) enforceServingWindows(ctx context.Context) {
+	ticker := time.NewTicker(servingWindowCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.unloadOutsideServingWindows(ctx)
+		}
+	}
+}
+
+// unloadOutsideServingWindows unloads idle runners whose models are outside
+// their serving windows.
+func (s *Scheduler) unloadOutsideServingWindows(ctx context.Context) {
+	now := time.Now()
+	s.loader.evictUnused(ctx, func(modelRef string) bool {
+		return !s.windows.keepLoaded(modelRef, now)
+	})
+}
+
+// GetWindows returns the window policies and pinned models.
+func (s *Scheduler) GetWindows(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.windows.status(time.Now())); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateWindows sets the window policy for a model or the global window
+// policy.
+func (s *Scheduler) UpdateWindows(w http.ResponseWriter, r *http.Request) {
+	var request WindowsRequest
+	if !decodeAdminRequest(w, r, &request) {
+		return
+	}
+	var policy WindowPolicy
+	var err error
+	if policy.Serving, err = ParseWindow(request.Serving); err != nil {
+		http.Error(w, fmt.Sprintf("invalid serving window: %v", err), http.StatusBadRequest)
+		return
+	}
+	if policy.Pulls, err = ParseWindow(request.Pulls); err != nil {
+		http.Error(w, fmt.Sprintf("invalid pull window: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.windows.setPolicy(request.Model, policy)
+	s.unloadOutsideServingWindows(r.Context())
+	s.GetWindows(w, r)
+}
+
+// PinModel pins a model so that it's exempt from window policies.
+func (s *Scheduler) PinModel(w http.ResponseWriter, r *http.Request) {
+	var request PinRequest
+	if !decodeAdminRequest(w, r, &request) {
+		return
+	}
+	if request.Model == "" {
+		http.Error(w, "model is required", http.StatusBadRequest)
+		return
+	}
+	var until time.Time
+	if request.Duration != "" {
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, fmt.Sprintf("invalid duration %q", request.Duration), http.StatusBadRequest)
+			return
+		}
+		until = time.Now().Add(duration)
+	}
+
+	s.windows.pin(request.Model, until)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newPin(models.NormalizeModelName(request.Model), until)); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// UnpinModel removes a model's pin.
+func (s *Scheduler) UnpinModel(w http.ResponseWriter, r *http.Request) {
+	if !s.windows.unpin(r.PathValue("name")) {
+		http.Error(w, "model not pinned", http.StatusNotFound)
+		return
+	}
+	s.unloadOutsideServingWindows(r.Context())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeAdminRequest decodes a JSON administrative request body into request,
+// writing an error response and returning false on failure.
+func decodeAdminRequest(w http.ResponseWriter, r *http.Request, request any) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maximumOpenAIInferenceRequestSize))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, "request too large", http.StatusBadRequest)
+		} else {
+			http.Error(w, "failed to read request body", http.StatusInternalServerError)
+		}
+		return false
+	}
+	if err := json.Unmarshal(body, request); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
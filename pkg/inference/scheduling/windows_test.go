@@ -0,0 +1,116 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns the local time on the specified day of the week of 2024-01-01
+// (a Monday) at the specified hour and minute.
+func at(day time.Weekday, hour, minute int) time.Time {
+	offset := (int(day) + 6) % 7
+	return time.Date(2024, time.January, 1+offset, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseWindow(t *testing.T) {
+	if window, err := ParseWindow(" "); window != nil || err != nil {
+		t.Errorf("Expected nil window for empty specification, got %v (%v)", window, err)
+	}
+	for _, invalid := range []string{
+		"9:00",
+		"09:00-18:60",
+		"09:00-25:00",
+		"24:00-06:00",
+		"Mon-Fry 09:00-18:00",
+		"Mon Fri 09:00-18:00",
+		"Mon-Fri 09-18",
+		"Mon-Fri 09:00-18:00;",
+	} {
+		if _, err := ParseWindow(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+
+	tests := []struct {
+		spec string
+		in   []time.Time
+		out  []time.Time
+	}{
+		{
+			spec: "Mon-Fri 09:00-18:00",
+			in:   []time.Time{at(time.Monday, 9, 0), at(time.Friday, 17, 59)},
+			out:  []time.Time{at(time.Monday, 8, 59), at(time.Friday, 18, 0), at(time.Saturday, 12, 0)},
+		},
+		{
+			spec: "22:00-06:00",
+			in:   []time.Time{at(time.Sunday, 23, 0), at(time.Monday, 5, 59)},
+			out:  []time.Time{at(time.Monday, 6, 0), at(time.Monday, 21, 59)},
+		},
+		{
+			spec: "Fri-Mon 20:00-02:00; wed 12:00-24:00",
+			in:   []time.Time{at(time.Saturday, 1, 0), at(time.Tuesday, 1, 0), at(time.Wednesday, 23, 59)},
+			out:  []time.Time{at(time.Wednesday, 1, 0), at(time.Thursday, 0, 0), at(time.Tuesday, 20, 0)},
+		},
+	}
+	for _, test := range tests {
+		window, err := ParseWindow(test.spec)
+		if err != nil {
+			t.Fatalf("ParseWindow(%q) failed: %v", test.spec, err)
+		}
+		if window.String() != test.spec {
+			t.Errorf("Expected specification %q, got %q", test.spec, window)
+		}
+		for _, in := range test.in {
+			if !window.Contains(in) {
+				t.Errorf("Expected %q to contain %s", test.spec, in.Format(time.RFC1123))
+			}
+		}
+		for _, out := range test.out {
+			if window.Contains(out) {
+				t.Errorf("Expected %q not to contain %s", test.spec, out.Format(time.RFC1123))
+			}
+		}
+	}
+}
+
+func TestServingWindows(t *testing.T) {
+	workingHours, _ := ParseWindow("Mon-Fri 09:00-18:00")
+	nights, _ := ParseWindow("00:00-06:00")
+	sw := newServingWindows()
+	sw.setPolicy("", WindowPolicy{Serving: workingHours, Pulls: nights})
+	sw.setPolicy("ai/batch", WindowPolicy{Serving: nights})
+
+	noon, midnight := at(time.Tuesday, 12, 0), at(time.Tuesday, 0, 30)
+	if !sw.keepLoaded("ai/chat", noon) || sw.keepLoaded("ai/chat", midnight) {
+		t.Error("Expected the global serving window to apply")
+	}
+	if sw.keepLoaded("ai/batch:latest", noon) || !sw.keepLoaded("ai/batch", midnight) {
+		t.Error("Expected the model serving window to apply")
+	}
+	if sw.pullAllowed("ai/chat", noon) == nil || sw.pullAllowed("ai/chat", midnight) != nil {
+		t.Error("Expected the global pull window to apply")
+	}
+	if sw.pullAllowed("ai/batch", noon) != nil {
+		t.Error("Expected the model policy to replace the global pull window")
+	}
+
+	// Pins override windows until they expire.
+	sw.pin("ai/chat", noon.Add(time.Hour))
+	if !sw.keepLoaded("ai/chat", noon) || sw.pullAllowed("ai/chat", noon) != nil {
+		t.Error("Expected a pinned model to be exempt from windows")
+	}
+	if status := sw.status(noon); len(status.Pins) != 1 || status.Pins[0].Model != "ai/chat:latest" || status.Pins[0].Until == nil {
+		t.Errorf("Unexpected pins %+v", status.Pins)
+	}
+	if sw.pullAllowed("ai/chat", noon.Add(2*time.Hour)) == nil {
+		t.Error("Expected an expired pin not to apply")
+	}
+	if sw.unpin("ai/chat") {
+		t.Error("Expected an expired pin to be removed")
+	}
+
+	sw.setPolicy("ai/batch", WindowPolicy{})
+	if status := sw.status(noon); len(status.Models) != 0 {
+		t.Errorf("Expected model policy to be removed, got %+v", status.Models)
+	}
+}
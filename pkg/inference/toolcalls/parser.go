@@ -0,0 +1,256 @@
+// Package toolcalls converts tool calls emitted by models in their native
+// formats (e.g. Hermes, Llama 3, or Mistral) into OpenAI tool_calls objects.
+package toolcalls
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// ToolCall is an OpenAI API tool call.
+type ToolCall struct {
+	// Index is the index of the tool call. It's only set in streaming deltas.
+	Index *int `json:"index,omitempty"`
+	// ID is the tool call ID.
+	ID string `json:"id"`
+	// Type is the tool call type. It's always "function".
+	Type string `json:"type"`
+	// Function is the called function.
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall is an OpenAI API function call.
+type FunctionCall struct {
+	// Name is the function name.
+	Name string `json:"name"`
+	// Arguments are the JSON-encoded function arguments.
+	Arguments string `json:"arguments"`
+}
+
+// Parser extracts tool calls from model output in a specific native format.
+type Parser struct {
+	// name is the name of the tool call format.
+	name string
+	// marker is the text that introduces a tool call.
+	marker string
+	// leadingJSON indicates that content consisting solely of a JSON object
+	// is also treated as a tool call.
+	leadingJSON bool
+	// parse parses the tool calls in text starting at the marker (or at the
+	// leading JSON object).
+	parse func(text string) ([]ToolCall, bool)
+}
+
+// Name returns the name of the tool call format.
+func (p *Parser) Name() string {
+	return p.name
+}
+
+// Markers introducing tool calls in the supported formats.
+const (
+	hermesMarker    = "<tool_call>"
+	hermesEndMarker = "</tool_call>"
+	llama3Marker    = "<|python_tag|>"
+	mistralMarker   = "[TOOL_CALLS]"
+)
+
+var (
+	// Hermes parses Hermes-style tool calls, as used by Qwen and NousResearch
+	// models, e.g. <tool_call>{"name": ..., "arguments": {...}}</tool_call>.
+	Hermes = &Parser{
+		name:   "hermes",
+		marker: hermesMarker,
+		parse:  parseHermes,
+	}
+	// Llama3 parses Llama 3.x-style tool calls, e.g.
+	// <|python_tag|>{"name": ..., "parameters": {...}} or a bare JSON object.
+	Llama3 = &Parser{
+		name:        "llama3",
+		marker:      llama3Marker,
+		leadingJSON: true,
+		parse:       parseLlama3,
+	}
+	// Mistral parses Mistral-style tool calls, e.g.
+	// [TOOL_CALLS][{"name": ..., "arguments": {...}}].
+	Mistral = &Parser{
+		name:   "mistral",
+		marker: mistralMarker,
+		parse:  parseMistral,
+	}
+)
+
+// ForChatTemplate selects the tool call parser matching the format used by a
+// chat template. It returns nil if the format can't be determined.
+func ForChatTemplate(chatTemplate string) *Parser {
+	switch {
+	case strings.Contains(chatTemplate, hermesMarker):
+		return Hermes
+	case strings.Contains(chatTemplate, mistralMarker):
+		return Mistral
+	case strings.Contains(chatTemplate, llama3Marker),
+		strings.Contains(chatTemplate, "<|eom_id|>"):
+		return Llama3
+	default:
+		return nil
+	}
+}
+
+// start returns the index at which a tool call starts in content, or -1 if
+// content contains no tool call.
+func (p *Parser) start(content string) int {
+	if index := strings.Index(content, p.marker); index >= 0 {
+		return index
+	}
+	if p.leadingJSON {
+		if trimmed := strings.TrimLeft(content, " \t\r\n"); strings.HasPrefix(trimmed, "{") {
+			return len(content) - len(trimmed)
+		}
+	}
+	return -1
+}
+
+// Parse extracts tool calls from content. It returns the content preceding
+// the tool calls and the tool calls themselves. If no valid tool calls are
+// found, then content is returned unmodified with a nil slice.
+func (p *Parser) Parse(content string) (string, []ToolCall) {
+	index := p.start(content)
+	if index < 0 {
+		return content, nil
+	}
+	calls, ok := p.parse(content[index:])
+	if !ok || len(calls) == 0 {
+		return content, nil
+	}
+	return strings.TrimSpace(content[:index]), calls
+}
+
+// rawCall is a tool call as emitted by a model.
+type rawCall struct {
+	Name       string          `json:"name"`
+	Arguments  json.RawMessage `json:"arguments"`
+	Parameters json.RawMessage `json:"parameters"`
+}
+
+// toToolCall converts a raw call to an OpenAI tool call.
+func (c *rawCall) toToolCall() (ToolCall, bool) {
+	if c.Name == "" {
+		return ToolCall{}, false
+	}
+	arguments := c.Arguments
+	if len(arguments) == 0 {
+		arguments = c.Parameters
+	}
+	return ToolCall{
+		ID:   newCallID(),
+		Type: "function",
+		Function: FunctionCall{
+			Name:      c.Name,
+			Arguments: encodeArguments(arguments),
+		},
+	}, true
+}
+
+// encodeArguments converts raw arguments to the JSON string representation
+// expected by the OpenAI API.
+func encodeArguments(arguments json.RawMessage) string {
+	if len(arguments) == 0 {
+		return "{}"
+	}
+	// Some models already emit arguments as a JSON-encoded string.
+	var encoded string
+	if err := json.Unmarshal(arguments, &encoded); err == nil {
+		return encoded
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, arguments); err != nil {
+		return string(arguments)
+	}
+	return compacted.String()
+}
+
+// newCallID generates a random tool call ID.
+func newCallID() string {
+	var id [12]byte
+	_, _ = rand.Read(id[:])
+	return "call_" + hex.EncodeToString(id[:])
+}
+
+// decodeCalls decodes consecutive JSON values (objects or arrays of objects)
+// from text, stopping at the first non-JSON content.
+func decodeCalls(text string) ([]ToolCall, bool) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	var calls []ToolCall
+	for decoder.More() {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			break
+		}
+		var raws []rawCall
+		if err := json.Unmarshal(value, &raws); err != nil {
+			var raw rawCall
+			if err := json.Unmarshal(value, &raw); err != nil {
+				return nil, false
+			}
+			raws = []rawCall{raw}
+		}
+		for _, raw := range raws {
+			call, ok := raw.toToolCall()
+			if !ok {
+				return nil, false
+			}
+			calls = append(calls, call)
+		}
+	}
+	return calls, len(calls) > 0
+}
+
+func parseHermes(text string) ([]ToolCall, bool) {
+	var calls []ToolCall
+	for {
+		start := strings.Index(text, hermesMarker)
+		if start < 0 {
+			break
+		}
+		text = text[start+len(hermesMarker):]
+		body := text
+		if end := strings.Index(text, hermesEndMarker); end >= 0 {
+			body = text[:end]
+			text = text[end+len(hermesEndMarker):]
+		} else {
+			text = ""
+		}
+		parsed, ok := decodeCalls(body)
+		if !ok {
+			return nil, false
+		}
+		calls = append(calls, parsed...)
+	}
+	return calls, len(calls) > 0
+}
+
+func parseLlama3(text string) ([]ToolCall, bool) {
+	text = strings.TrimPrefix(strings.TrimSpace(text), llama3Marker)
+	// Multiple calls may be separated by semicolons.
+	var calls []ToolCall
+	for text = strings.TrimSpace(text); text != ""; text = strings.TrimLeft(text, "; \t\r\n") {
+		decoder := json.NewDecoder(strings.NewReader(text))
+		var raw rawCall
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, false
+		}
+		call, ok := raw.toToolCall()
+		if !ok {
+			return nil, false
+		}
+		calls = append(calls, call)
+		text = text[decoder.InputOffset():]
+	}
+	return calls, len(calls) > 0
+}
+
+func parseMistral(text string) ([]ToolCall, bool) {
+	return decodeCalls(strings.TrimPrefix(text, mistralMarker))
+}
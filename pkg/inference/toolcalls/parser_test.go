@@ -0,0 +1,108 @@
+package toolcalls
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestForChatTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expected *Parser
+	}{
+		{"hermes", "{% for tool in tools %}<tool_call>{{ tool }}</tool_call>{% endfor %}", Hermes},
+		{"mistral", "{{ '[TOOL_CALLS]' + tool_calls|tojson }}", Mistral},
+		{"llama3", "{{- '<|python_tag|>' + tool_call.arguments }}<|eom_id|>", Llama3},
+		{"unknown", "{{ messages }}", nil},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ForChatTemplate(tt.template); got != tt.expected {
+				t.Errorf("ForChatTemplate() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		parser    *Parser
+		content   string
+		remaining string
+		calls     []FunctionCall
+	}{
+		{
+			name:      "hermes single call",
+			parser:    Hermes,
+			content:   "Let me check.\n<tool_call>\n{\"name\": \"get_weather\", \"arguments\": {\"city\": \"Paris\"}}\n</tool_call>",
+			remaining: "Let me check.",
+			calls:     []FunctionCall{{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+		},
+		{
+			name:    "hermes multiple calls",
+			parser:  Hermes,
+			content: "<tool_call>{\"name\": \"a\", \"arguments\": {}}</tool_call>\n<tool_call>{\"name\": \"b\", \"arguments\": {\"x\": 1}}</tool_call>",
+			calls:   []FunctionCall{{Name: "a", Arguments: "{}"}, {Name: "b", Arguments: `{"x":1}`}},
+		},
+		{
+			name:      "hermes invalid JSON",
+			parser:    Hermes,
+			content:   "<tool_call>not json</tool_call>",
+			remaining: "<tool_call>not json</tool_call>",
+		},
+		{
+			name:    "llama3 python tag",
+			parser:  Llama3,
+			content: "<|python_tag|>{\"name\": \"search\", \"parameters\": {\"query\": \"go\"}}",
+			calls:   []FunctionCall{{Name: "search", Arguments: `{"query":"go"}`}},
+		},
+		{
+			name:    "llama3 bare JSON with multiple calls",
+			parser:  Llama3,
+			content: " {\"name\": \"a\", \"parameters\": {}}; {\"name\": \"b\", \"parameters\": {\"y\": \"z\"}}",
+			calls:   []FunctionCall{{Name: "a", Arguments: "{}"}, {Name: "b", Arguments: `{"y":"z"}`}},
+		},
+		{
+			name:      "llama3 plain text",
+			parser:    Llama3,
+			content:   "The answer is 42.",
+			remaining: "The answer is 42.",
+		},
+		{
+			name:    "mistral",
+			parser:  Mistral,
+			content: "[TOOL_CALLS][{\"name\": \"add\", \"arguments\": {\"a\": 1, \"b\": 2}}]",
+			calls:   []FunctionCall{{Name: "add", Arguments: `{"a":1,"b":2}`}},
+		},
+		{
+			name:    "string-encoded arguments",
+			parser:  Mistral,
+			content: "[TOOL_CALLS][{\"name\": \"add\", \"arguments\": \"{\\\"a\\\":1}\"}]",
+			calls:   []FunctionCall{{Name: "add", Arguments: `{"a":1}`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining, calls := tt.parser.Parse(tt.content)
+			if remaining != tt.remaining {
+				t.Errorf("remaining = %q, want %q", remaining, tt.remaining)
+			}
+			if len(calls) != len(tt.calls) {
+				t.Fatalf("got %d calls, want %d", len(calls), len(tt.calls))
+			}
+			for i, call := range calls {
+				if call.Function != tt.calls[i] {
+					t.Errorf("call %d = %+v, want %+v", i, call.Function, tt.calls[i])
+				}
+				if call.Type != "function" || !strings.HasPrefix(call.ID, "call_") {
+					t.Errorf("call %d has unexpected type %q or ID %q", i, call.Type, call.ID)
+				}
+			}
+		})
+	}
+}
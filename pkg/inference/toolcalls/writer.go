@@ -0,0 +1,330 @@
+package toolcalls
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ResponseWriter rewrites chat completion responses, converting tool calls
+// emitted in a model's native format into OpenAI tool_calls objects. Both
+// streaming (server-sent events) and non-streaming responses are supported.
+// Responses in which the backend already reports tool calls are left as-is.
+// Finish must be called once the response has been fully written.
+type ResponseWriter struct {
+	http.ResponseWriter
+	// parser is the parser for the model's tool call format.
+	parser *Parser
+	// statusCode is the response status code.
+	statusCode int
+	// streaming indicates that the response is a server-sent event stream.
+	streaming bool
+	// buffer holds the complete body for non-streaming responses and any
+	// incomplete event for streaming responses.
+	buffer bytes.Buffer
+	// native indicates that the backend reported tool calls itself, in which
+	// case the remaining stream is passed through unmodified.
+	native bool
+	// pending is streamed content that hasn't been forwarded yet because it
+	// may be the start of a tool call marker.
+	pending string
+	// toolText is the buffered content of the tool call being streamed.
+	toolText string
+	// inToolCall indicates that a tool call is being streamed.
+	inToolCall bool
+	// emitted indicates that content has been forwarded to the client.
+	emitted bool
+	// lastChunk is the most recent streamed chunk, used as a template when
+	// flushing held content.
+	lastChunk map[string]interface{}
+}
+
+// NewResponseWriter creates a new ResponseWriter that wraps w.
+func NewResponseWriter(w http.ResponseWriter, parser *Parser) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, parser: parser}
+}
+
+// WriteHeader implements net/http.ResponseWriter.WriteHeader.
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.streaming = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	if statusCode == http.StatusOK {
+		// The body will be rewritten, so its length may change.
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements net/http.ResponseWriter.Write.
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.statusCode != http.StatusOK || w.native {
+		return w.ResponseWriter.Write(b)
+	}
+	w.buffer.Write(b)
+	if !w.streaming {
+		return len(b), nil
+	}
+
+	// Process all complete events.
+	for {
+		data := w.buffer.Bytes()
+		end := bytes.Index(data, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		event := string(data[:end+2])
+		w.buffer.Next(end + 2)
+		if err := w.writeEvent(event); err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush implements net/http.Flusher.Flush.
+func (w *ResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Finish writes any buffered output.
+func (w *ResponseWriter) Finish() error {
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	if w.streaming {
+		remaining := w.buffer.String()
+		w.buffer.Reset()
+		return w.writeEvent(remaining)
+	}
+	body := w.rewriteResponse(w.buffer.Bytes())
+	w.buffer.Reset()
+	_, err := w.ResponseWriter.Write(body)
+	return err
+}
+
+// rewriteResponse converts tool calls in a non-streaming chat completion
+// response. If the response can't be parsed, it's returned unmodified.
+func (w *ResponseWriter) rewriteResponse(body []byte) []byte {
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+	choices, ok := response["choices"].([]interface{})
+	if !ok {
+		return body
+	}
+
+	modified := false
+	for _, c := range choices {
+		choice, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		message, ok := choice["message"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if existing, ok := message["tool_calls"].([]interface{}); ok && len(existing) > 0 {
+			continue
+		}
+		content, ok := message["content"].(string)
+		if !ok {
+			continue
+		}
+		remaining, calls := w.parser.Parse(content)
+		if calls == nil {
+			continue
+		}
+		if remaining == "" {
+			message["content"] = nil
+		} else {
+			message["content"] = remaining
+		}
+		message["tool_calls"] = calls
+		choice["finish_reason"] = "tool_calls"
+		modified = true
+	}
+	if !modified {
+		return body
+	}
+
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// writeEvent processes and forwards a single server-sent event.
+func (w *ResponseWriter) writeEvent(event string) error {
+	data, ok := strings.CutPrefix(strings.TrimRight(event, "\n"), "data: ")
+	if !ok || data == "[DONE]" || w.native {
+		if ok && data == "[DONE]" {
+			if err := w.flushHeld(); err != nil {
+				return err
+			}
+		}
+		_, err := w.ResponseWriter.Write([]byte(event))
+		return err
+	}
+
+	var chunk map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		_, err := w.ResponseWriter.Write([]byte(event))
+		return err
+	}
+	w.lastChunk = chunk
+
+	choice, delta := chunkDelta(chunk)
+	if delta == nil {
+		_, err := w.ResponseWriter.Write([]byte(event))
+		return err
+	}
+
+	// If the backend parsed tool calls itself, then stop rewriting.
+	if calls, ok := delta["tool_calls"].([]interface{}); ok && len(calls) > 0 {
+		if err := w.flushHeld(); err != nil {
+			return err
+		}
+		w.native = true
+		_, err := w.ResponseWriter.Write([]byte(event))
+		return err
+	}
+
+	if content, ok := delta["content"].(string); ok {
+		forward := w.consume(content)
+		if forward == "" {
+			delete(delta, "content")
+		} else {
+			delta["content"] = forward
+		}
+	}
+
+	if finishReason, ok := choice["finish_reason"].(string); ok && finishReason != "" {
+		w.finishChoice(choice, delta)
+	}
+
+	// Drop chunks that no longer carry any information.
+	if len(delta) == 0 && choice["finish_reason"] == nil && chunk["usage"] == nil {
+		return nil
+	}
+	return w.writeChunk(chunk)
+}
+
+// consume processes streamed content, returning the portion that can be
+// forwarded to the client immediately.
+func (w *ResponseWriter) consume(content string) string {
+	if w.inToolCall {
+		w.toolText += content
+		return ""
+	}
+
+	w.pending += content
+	if start := w.parser.start(w.pending); start >= 0 && (start > 0 || !w.emitted || !w.parser.leadingJSON) {
+		forward := w.pending[:start]
+		w.toolText = w.pending[start:]
+		w.pending = ""
+		w.inToolCall = true
+		w.emitted = w.emitted || forward != ""
+		return forward
+	}
+
+	// Hold back leading whitespace (which may precede a bare JSON tool call)
+	// and any suffix that may be the start of the tool call marker.
+	if w.parser.leadingJSON && !w.emitted && strings.TrimSpace(w.pending) == "" {
+		return ""
+	}
+	hold := 0
+	for n := min(len(w.pending), len(w.parser.marker)-1); n > 0; n-- {
+		if strings.HasSuffix(w.pending, w.parser.marker[:n]) {
+			hold = n
+			break
+		}
+	}
+	forward := w.pending[:len(w.pending)-hold]
+	w.pending = w.pending[len(w.pending)-hold:]
+	w.emitted = w.emitted || forward != ""
+	return forward
+}
+
+// finishChoice updates the final chunk of a choice, replacing it with the
+// parsed tool calls or restoring any held content.
+func (w *ResponseWriter) finishChoice(choice, delta map[string]interface{}) {
+	held := w.pending
+	w.pending = ""
+	if w.inToolCall {
+		w.inToolCall = false
+		_, calls := w.parser.Parse(w.toolText)
+		if calls != nil {
+			for i := range calls {
+				index := i
+				calls[i].Index = &index
+			}
+			delta["tool_calls"] = calls
+			choice["finish_reason"] = "tool_calls"
+		} else {
+			held += w.toolText
+		}
+		w.toolText = ""
+	}
+	if held != "" {
+		if content, ok := delta["content"].(string); ok {
+			held = content + held
+		}
+		delta["content"] = held
+	}
+}
+
+// flushHeld forwards any held content that wasn't terminated by a finish
+// reason (e.g. if the stream ended abruptly).
+func (w *ResponseWriter) flushHeld() error {
+	held := w.pending + w.toolText
+	w.pending, w.toolText, w.inToolCall = "", "", false
+	if held == "" || w.lastChunk == nil {
+		return nil
+	}
+	choice, delta := chunkDelta(w.lastChunk)
+	if delta == nil {
+		return nil
+	}
+	for key := range delta {
+		delete(delta, key)
+	}
+	delta["content"] = held
+	choice["finish_reason"] = nil
+	return w.writeChunk(w.lastChunk)
+}
+
+// writeChunk forwards a chunk as a server-sent event.
+func (w *ResponseWriter) writeChunk(chunk map[string]interface{}) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return fmt.Errorf("unable to encode chunk: %w", err)
+	}
+	_, err = fmt.Fprintf(w.ResponseWriter, "data: %s\n\n", data)
+	return err
+}
+
+// chunkDelta returns the first choice of a streamed chunk and its delta.
+func chunkDelta(chunk map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	choices, ok := chunk["choices"].([]interface{})
+	if !ok || len(choices) == 0 {
+		return nil, nil
+	}
+	choice, ok := choices[0].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	delta, ok := choice["delta"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	return choice, delta
+}
@@ -0,0 +1,190 @@
+package toolcalls
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriterNonStreaming(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	w := NewResponseWriter(recorder, Hermes)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"<tool_call>{\"name\": \"f\", \"arguments\": {\"x\": 1}}</tool_call>"},"finish_reason":"stop"}]}`)
+	if err := w.Finish(); err != nil {
+		t.Fatalf("Finish() failed: %v", err)
+	}
+
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content   *string    `json:"content"`
+				ToolCalls []ToolCall `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	choice := response.Choices[0]
+	if choice.Message.Content != nil {
+		t.Errorf("content = %q, want null", *choice.Message.Content)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Name != "f" {
+		t.Errorf("unexpected tool calls: %+v", choice.Message.ToolCalls)
+	}
+	if choice.FinishReason != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", choice.FinishReason)
+	}
+}
+
+func TestResponseWriterNonStreamingPassthrough(t *testing.T) {
+	body := `{"choices":[{"message":{"content":"hello"},"finish_reason":"stop"}]}`
+	recorder := httptest.NewRecorder()
+	w := NewResponseWriter(recorder, Hermes)
+	fmt.Fprint(w, body)
+	if err := w.Finish(); err != nil {
+		t.Fatalf("Finish() failed: %v", err)
+	}
+	if recorder.Body.String() != body {
+		t.Errorf("body = %q, want %q", recorder.Body.String(), body)
+	}
+}
+
+// streamChunk formats a streamed chat completion chunk as an SSE event.
+func streamChunk(content string, finishReason string) string {
+	delta := map[string]interface{}{}
+	if content != "" {
+		delta["content"] = content
+	}
+	choice := map[string]interface{}{"index": 0, "delta": delta, "finish_reason": nil}
+	if finishReason != "" {
+		choice["finish_reason"] = finishReason
+	}
+	data, _ := json.Marshal(map[string]interface{}{"choices": []interface{}{choice}})
+	return "data: " + string(data) + "\n\n"
+}
+
+// streamResult summarizes the content and tool calls of a streamed response.
+func streamResult(t *testing.T, body string) (string, []ToolCall, string) {
+	t.Helper()
+	var content strings.Builder
+	var calls []ToolCall
+	var finishReason string
+	for _, event := range strings.Split(body, "\n\n") {
+		data, ok := strings.CutPrefix(event, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content   string     `json:"content"`
+					ToolCalls []ToolCall `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+		calls = append(calls, chunk.Choices[0].Delta.ToolCalls...)
+		if chunk.Choices[0].FinishReason != nil {
+			finishReason = *chunk.Choices[0].FinishReason
+		}
+	}
+	return content.String(), calls, finishReason
+}
+
+func TestResponseWriterStreaming(t *testing.T) {
+	tests := []struct {
+		name         string
+		parser       *Parser
+		pieces       []string
+		content      string
+		calls        []string
+		finishReason string
+	}{
+		{
+			name:         "hermes split marker",
+			parser:       Hermes,
+			pieces:       []string{"Sure. <tool", "_call>{\"name\": \"f\", ", "\"arguments\": {}}</tool_call>"},
+			content:      "Sure. ",
+			calls:        []string{"f"},
+			finishReason: "tool_calls",
+		},
+		{
+			name:         "llama3 bare JSON",
+			parser:       Llama3,
+			pieces:       []string{"{\"name\": \"g\",", " \"parameters\": {\"q\": 1}}"},
+			calls:        []string{"g"},
+			finishReason: "tool_calls",
+		},
+		{
+			name:         "mistral multiple calls",
+			parser:       Mistral,
+			pieces:       []string{"[TOOL_", "CALLS][{\"name\": \"a\", \"arguments\": {}}, {\"name\": \"b\", \"arguments\": {}}]"},
+			calls:        []string{"a", "b"},
+			finishReason: "tool_calls",
+		},
+		{
+			name:         "plain text with partial marker",
+			parser:       Hermes,
+			pieces:       []string{"a <", "b"},
+			content:      "a <b",
+			finishReason: "stop",
+		},
+		{
+			name:         "invalid tool call",
+			parser:       Hermes,
+			pieces:       []string{"<tool_call>", "oops"},
+			content:      "<tool_call>oops",
+			finishReason: "stop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			w := NewResponseWriter(recorder, tt.parser)
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			for _, piece := range tt.pieces {
+				fmt.Fprint(w, streamChunk(piece, ""))
+			}
+			fmt.Fprint(w, streamChunk("", "stop"))
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			if err := w.Finish(); err != nil {
+				t.Fatalf("Finish() failed: %v", err)
+			}
+
+			content, calls, finishReason := streamResult(t, recorder.Body.String())
+			if content != tt.content {
+				t.Errorf("content = %q, want %q", content, tt.content)
+			}
+			if len(calls) != len(tt.calls) {
+				t.Fatalf("got %d tool calls, want %d", len(calls), len(tt.calls))
+			}
+			for i, call := range calls {
+				if call.Function.Name != tt.calls[i] {
+					t.Errorf("call %d name = %q, want %q", i, call.Function.Name, tt.calls[i])
+				}
+				if call.Index == nil || *call.Index != i {
+					t.Errorf("call %d has unexpected index %v", i, call.Index)
+				}
+			}
+			if finishReason != tt.finishReason {
+				t.Errorf("finish_reason = %q, want %q", finishReason, tt.finishReason)
+			}
+			if !strings.HasSuffix(recorder.Body.String(), "data: [DONE]\n\n") {
+				t.Errorf("stream doesn't end with [DONE]")
+			}
+		})
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+
+	"github.com/docker/model-runner/pkg/internal/utils"
 )
 
 // ReadFile parses the contents of a file as JSON.
@@ -19,3 +22,13 @@ func ReadFile[T any](path string, result T) error {
 	}
 	return nil
 }
+
+// WriteFile replaces the contents of a file with the JSON encoding of v such
+// that readers never observe a partially written file.
+func WriteFile(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to encode %s: %w", filepath.Base(path), err)
+	}
+	return utils.WriteFileAtomically(path, data)
+}
@@ -0,0 +1,23 @@
+// Package testutil provides helpers shared by the tests of the HTTP APIs.
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Serve serves a request with handler and decodes a successful JSON response
+// into v, if it isn't nil. It returns the response's status code.
+func Serve(t testing.TB, handler http.Handler, request *http.Request, v any) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code >= 200 && recorder.Code <= 299 && v != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+			t.Fatalf("Failed to decode response %s: %v", recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TemporarySuffix is the suffix of the temporary files created by
+// WriteFileAtomically. Callers listing a directory may remove files
+// containing it, which are left behind by interrupted writes.
+const TemporarySuffix = ".tmp"
+
+// WriteFileAtomically replaces the contents of a file such that readers never
+// observe a partially written file.
+func WriteFileAtomically(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"-*"+TemporarySuffix)
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("unable to replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// NewID generates a random identifier with the specified prefix, e.g. "vs_"
+// for vector stores.
+func NewID(prefix string) string {
+	var id [12]byte
+	rand.Read(id[:])
+	return prefix + hex.EncodeToString(id[:])
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// ResponseRecorder is a ResponseWriter that records a response, used to serve
+// requests made internally, e.g. for embeddings or batched requests.
+type ResponseRecorder struct {
+	// StatusCode is the status code of the response.
+	StatusCode int
+	// Body is the body of the response.
+	Body bytes.Buffer
+	// headers are the headers of the response.
+	headers http.Header
+}
+
+// NewResponseRecorder creates a recorder for a response, whose status code is
+// 200 unless the handler sets another one.
+func NewResponseRecorder() *ResponseRecorder {
+	return &ResponseRecorder{StatusCode: http.StatusOK, headers: make(http.Header)}
+}
+
+// Header implements http.ResponseWriter.Header.
+func (rr *ResponseRecorder) Header() http.Header {
+	return rr.headers
+}
+
+// Write implements http.ResponseWriter.Write.
+func (rr *ResponseRecorder) Write(data []byte) (int, error) {
+	return rr.Body.Write(data)
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (rr *ResponseRecorder) WriteHeader(statusCode int) {
+	rr.StatusCode = statusCode
+}
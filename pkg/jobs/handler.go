@@ -0,0 +1,290 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/docker/model-runner/pkg/batch"
+	"github.com/docker/model-runner/pkg/files"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// JobsPath is the path of the jobs API routes, relative to the inference
+	// prefix.
+	JobsPath = "/v1/jobs"
+
+	// maximumRequestSize is the maximum size of a job creation request.
+	maximumRequestSize = 1024 * 1024
+	// defaultEndpoint is the default endpoint of batch jobs' requests.
+	defaultEndpoint = "/v1/chat/completions"
+)
+
+// errInvalidJob indicates that a job creation request is invalid.
+var errInvalidJob = errors.New("invalid job")
+
+// Batches submits the batches of batch jobs, typically the Batch API handler.
+type Batches interface {
+	// Submit validates and queues a batch.
+	Submit(request batch.CreateRequest) (batch.Batch, error)
+	// Batch returns a batch.
+	Batch(id string) (batch.Batch, error)
+}
+
+// CreateRequest is the body of a job creation request. Exactly one of Prompt
+// and InputFileID must be set.
+type CreateRequest struct {
+	// Name is an optional name for the job.
+	Name string `json:"name,omitempty"`
+	// Schedule is a cron expression, evaluated in local time.
+	Schedule string `json:"schedule"`
+	// Model is the model to which a prompt job's prompt is sent.
+	Model string `json:"model,omitempty"`
+	// SystemPrompt is an optional system prompt for a prompt job.
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// Prompt is the user prompt of a prompt job.
+	Prompt string `json:"prompt,omitempty"`
+	// InputFileID is the ID of the batch input file of a batch job.
+	InputFileID string `json:"input_file_id,omitempty"`
+	// Endpoint is the endpoint of a batch job's requests, which defaults to
+	// /v1/chat/completions.
+	Endpoint string `json:"endpoint,omitempty"`
+	// WebhookURL is the URL to which results are posted. If empty, results
+	// are stored as files.
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+// listResponse is the response to a list request.
+type listResponse struct {
+	Object string `json:"object"`
+	Data   []Job  `json:"data"`
+}
+
+// deletedResponse is the response to a deletion request.
+type deletedResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+// Handler implements the scheduled jobs API.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	manager     *Manager
+	// scheduler serves the inference requests of prompt jobs.
+	scheduler http.Handler
+	// files stores the results of jobs without webhooks.
+	files *files.Manager
+	// batches submits the batches of batch jobs, or is nil if the Batch API
+	// isn't enabled.
+	batches Batches
+	// client delivers results to webhooks.
+	client *http.Client
+	// batchPollInterval is the interval at which batch jobs' batches are
+	// polled.
+	batchPollInterval time.Duration
+	// wake is signalled when a job is created or triggered.
+	wake chan struct{}
+}
+
+// NewHandler creates a new jobs API handler whose jobs are run once Run is
+// called. Batch jobs can only be created if batches is non-nil.
+func NewHandler(log logging.Logger, scheduler http.Handler, allowedOrigins []string, manager *Manager, fileManager *files.Manager, batches Batches) *Handler {
+	h := &Handler{
+		log:               log,
+		router:            http.NewServeMux(),
+		manager:           manager,
+		scheduler:         scheduler,
+		files:             fileManager,
+		batches:           batches,
+		client:            &http.Client{Timeout: webhookTimeout},
+		batchPollInterval: defaultBatchPollInterval,
+		wake:              make(chan struct{}, 1),
+	}
+
+	for route, handler := range h.routeHandlers() {
+		h.router.HandleFunc(route, handler)
+	}
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// routeHandlers returns the mapping of routes to their handlers.
+func (h *Handler) routeHandlers() map[string]http.HandlerFunc {
+	jobs := inference.InferencePrefix + JobsPath
+	return map[string]http.HandlerFunc{
+		"POST " + jobs:                h.handleCreateJob,
+		"GET " + jobs:                 h.handleListJobs,
+		"GET " + jobs + "/{job}":      h.handleGetJob,
+		"DELETE " + jobs + "/{job}":   h.handleDeleteJob,
+		"POST " + jobs + "/{job}/run": h.handleRunJob,
+	}
+}
+
+// writeJSON writes a JSON response.
+func (h *Handler) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warnf("Failed to encode jobs response: %v", err)
+	}
+}
+
+// writeError writes an error response with the status appropriate for err.
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrJobNotFound), errors.Is(err, files.ErrFileNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errInvalidJob):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.log.Warnf("Jobs request failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// wakeRunner signals the runner to reconsider the next job.
+func (h *Handler) wakeRunner() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (h *Handler) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maximumRequestSize))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, "request too large", http.StatusBadRequest)
+		} else {
+			http.Error(w, "failed to read request body", http.StatusInternalServerError)
+		}
+		return
+	}
+	var request CreateRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	job, err := h.newJob(request)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if err := h.manager.CreateJob(job); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.wakeRunner()
+	h.writeJSON(w, job)
+}
+
+// newJob validates a job creation request and creates the job it describes.
+func (h *Handler) newJob(request CreateRequest) (Job, error) {
+	schedule, err := ParseSchedule(request.Schedule)
+	if err != nil {
+		return Job{}, fmt.Errorf("%w: %w", errInvalidJob, err)
+	}
+	if (request.Prompt == "") == (request.InputFileID == "") {
+		return Job{}, fmt.Errorf("%w: exactly one of prompt and input_file_id is required", errInvalidJob)
+	}
+	if request.Prompt != "" && request.Model == "" {
+		return Job{}, fmt.Errorf("%w: model is required for prompt jobs", errInvalidJob)
+	}
+	if request.InputFileID != "" {
+		if h.batches == nil {
+			return Job{}, fmt.Errorf("%w: batch jobs require the Batch API to be enabled", errInvalidJob)
+		}
+		file, err := h.files.Get(request.InputFileID)
+		if err != nil {
+			return Job{}, err
+		}
+		if file.Purpose != files.PurposeBatch {
+			return Job{}, fmt.Errorf("%w: input file must have purpose %q", errInvalidJob, files.PurposeBatch)
+		}
+		if request.Endpoint == "" {
+			request.Endpoint = defaultEndpoint
+		}
+	} else if request.Endpoint != "" {
+		return Job{}, fmt.Errorf("%w: endpoint is only supported for batch jobs", errInvalidJob)
+	}
+	if request.WebhookURL != "" {
+		u, err := url.Parse(request.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Job{}, fmt.Errorf("%w: webhook_url must be an http or https URL", errInvalidJob)
+		}
+	}
+
+	now := time.Now()
+	return Job{
+		ID:           utils.NewID("job_"),
+		Object:       "job",
+		Name:         request.Name,
+		Schedule:     schedule.String(),
+		Model:        request.Model,
+		SystemPrompt: request.SystemPrompt,
+		Prompt:       request.Prompt,
+		InputFileID:  request.InputFileID,
+		Endpoint:     request.Endpoint,
+		WebhookURL:   request.WebhookURL,
+		CreatedAt:    now.Unix(),
+		NextRunAt:    schedule.Next(now).Unix(),
+		Runs:         []Run{},
+	}, nil
+}
+
+func (h *Handler) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, listResponse{Object: "list", Data: h.manager.Jobs()})
+}
+
+func (h *Handler) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.manager.Job(r.PathValue("job"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, job)
+}
+
+func (h *Handler) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("job")
+	if err := h.manager.DeleteJob(id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, deletedResponse{ID: id, Object: "job", Deleted: true})
+}
+
+// handleRunJob runs a job as soon as possible, outside of its schedule.
+func (h *Handler) handleRunJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.manager.UpdateJob(r.PathValue("job"), func(j *Job) {
+		j.NextRunAt = time.Now().Unix()
+	})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.wakeRunner()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		h.log.Warnf("Failed to encode jobs response: %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/batch"
+	"github.com/docker/model-runner/pkg/files"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/internal/testutil"
+	"github.com/docker/model-runner/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// echoScheduler serves chat completions that echo the requested model, failing
+// requests for unknown models.
+type echoScheduler struct {
+	requests atomic.Int64
+}
+
+func (s *echoScheduler) Busy() bool {
+	return false
+}
+
+func (s *echoScheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	var request struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Role string `json:"role"`
+		} `json:"messages"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	if request.Model == "unknown" {
+		http.Error(w, "model not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"object": "chat.completion", "model": request.Model, "messages": len(request.Messages)})
+}
+
+// testEnvironment holds a jobs handler and its dependencies.
+type testEnvironment struct {
+	handler *Handler
+	files   *files.Manager
+}
+
+func newTestEnvironment(t *testing.T, withBatches bool) *testEnvironment {
+	t.Helper()
+	dir := t.TempDir()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	fileManager, err := files.NewManager(log, filepath.Join(dir, "files"), files.Limits{})
+	if err != nil {
+		t.Fatalf("files.NewManager failed: %v", err)
+	}
+	scheduler := &echoScheduler{}
+	var batches Batches
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if withBatches {
+		batchManager, err := batch.NewManager(log, filepath.Join(dir, "batches"), fileManager)
+		if err != nil {
+			t.Fatalf("batch.NewManager failed: %v", err)
+		}
+		batchHandler := batch.NewHandler(log, scheduler, nil, batchManager)
+		go batchHandler.Run(ctx)
+		batches = batchHandler
+	}
+	manager, err := NewManager(log, storage.NewMemory())
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	handler := NewHandler(log, scheduler, nil, manager, fileManager, batches)
+	handler.batchPollInterval = 10 * time.Millisecond
+	go handler.Run(ctx)
+	return &testEnvironment{handler: handler, files: fileManager}
+}
+
+// serve performs a request and decodes a successful JSON response into v.
+func serve(t *testing.T, handler http.Handler, method, path, body string, v any) int {
+	t.Helper()
+	return testutil.Serve(t, handler, httptest.NewRequest(method, inference.InferencePrefix+path, strings.NewReader(body)), v)
+}
+
+// createJob creates a job, failing the test if it's rejected.
+func createJob(t *testing.T, handler http.Handler, body string) Job {
+	t.Helper()
+	var job Job
+	if code := serve(t, handler, http.MethodPost, JobsPath, body, &job); code != http.StatusOK {
+		t.Fatalf("Expected job creation to succeed, got status %d", code)
+	}
+	return job
+}
+
+// runJob triggers a job and waits for its run to be recorded.
+func runJob(t *testing.T, handler *Handler, id string) Run {
+	t.Helper()
+	var triggered Job
+	if code := serve(t, handler, http.MethodPost, JobsPath+"/"+id+"/run", "", &triggered); code != http.StatusAccepted {
+		t.Fatalf("Expected the job to be triggered, got status %d", code)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := handler.manager.Job(id)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if len(job.Runs) > len(triggered.Runs) {
+			if job.NextRunAt <= time.Now().Unix() {
+				t.Errorf("Expected the job to be rescheduled, got %d", job.NextRunAt)
+			}
+			return job.Runs[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s didn't run", id)
+	return Run{}
+}
+
+func TestPromptJob(t *testing.T) {
+	env := newTestEnvironment(t, false)
+	job := createJob(t, env.handler, `{"name": "summary", "schedule": "0 2 * * *", "model": "ai/smollm2", "system_prompt": "Be brief.", "prompt": "Summarize."}`)
+	if job.NextRunAt <= time.Now().Unix() || job.Schedule != "0 2 * * *" {
+		t.Errorf("Unexpected job %+v", job)
+	}
+
+	// Results are stored as files without a webhook.
+	run := runJob(t, env.handler, job.ID)
+	if run.Status != RunStatusSucceeded || run.OutputFileID == "" {
+		t.Fatalf("Unexpected run %+v", run)
+	}
+	file, content, err := env.files.Open(run.OutputFileID)
+	if err != nil {
+		t.Fatalf("Failed to open output file: %v", err)
+	}
+	defer content.Close()
+	var completion struct {
+		Model    string `json:"model"`
+		Messages int    `json:"messages"`
+	}
+	if err := json.NewDecoder(content).Decode(&completion); err != nil || completion.Model != "ai/smollm2" || completion.Messages != 2 {
+		t.Errorf("Unexpected output %+v (%v)", completion, err)
+	}
+	if file.Purpose != files.PurposeJobOutput {
+		t.Errorf("Expected the output file to have purpose %s, got %s", files.PurposeJobOutput, file.Purpose)
+	}
+
+	// Failed requests are recorded.
+	failing := createJob(t, env.handler, `{"schedule": "@daily", "model": "unknown", "prompt": "Summarize."}`)
+	if run := runJob(t, env.handler, failing.ID); run.Status != RunStatusFailed || !strings.Contains(run.Error, "model not found") {
+		t.Errorf("Expected the run to fail, got %+v", run)
+	}
+
+	var list listResponse
+	serve(t, env.handler, http.MethodGet, JobsPath, "", &list)
+	if len(list.Data) != 2 {
+		t.Errorf("Expected 2 jobs, got %d", len(list.Data))
+	}
+	if code := serve(t, env.handler, http.MethodDelete, JobsPath+"/"+job.ID, "", nil); code != http.StatusOK {
+		t.Errorf("Expected deletion to succeed, got status %d", code)
+	}
+	if code := serve(t, env.handler, http.MethodGet, JobsPath+"/"+job.ID, "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a deleted job, got %d", code)
+	}
+}
+
+func TestJobWebhook(t *testing.T) {
+	payloads := make(chan webhookPayload, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+	}))
+	defer webhook.Close()
+
+	env := newTestEnvironment(t, false)
+	job := createJob(t, env.handler, `{"schedule": "@hourly", "model": "ai/smollm2", "prompt": "Classify.", "webhook_url": "`+webhook.URL+`"}`)
+	run := runJob(t, env.handler, job.ID)
+	if run.Status != RunStatusSucceeded || run.OutputFileID != "" {
+		t.Errorf("Unexpected run %+v", run)
+	}
+	payload := <-payloads
+	if payload.JobID != job.ID || payload.Run.Status != RunStatusSucceeded || !strings.Contains(string(payload.Result), "chat.completion") {
+		t.Errorf("Unexpected payload %+v", payload)
+	}
+	if len(env.files.List("")) != 0 {
+		t.Errorf("Expected no output files, got %d", len(env.files.List("")))
+	}
+}
+
+func TestBatchJob(t *testing.T) {
+	env := newTestEnvironment(t, true)
+	input, err := env.files.Create("requests.jsonl", files.PurposeBatch, strings.NewReader(
+		`{"custom_id": "a", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "ai/smollm2"}}`))
+	if err != nil {
+		t.Fatalf("Failed to store input file: %v", err)
+	}
+	job := createJob(t, env.handler, `{"schedule": "0 3 * * 1", "input_file_id": "`+input.ID+`"}`)
+	if job.Endpoint != "/v1/chat/completions" {
+		t.Errorf("Expected the default endpoint, got %q", job.Endpoint)
+	}
+	run := runJob(t, env.handler, job.ID)
+	if run.Status != RunStatusSucceeded || run.BatchID == "" || run.OutputFileID == "" {
+		t.Errorf("Unexpected run %+v", run)
+	}
+}
+
+func TestJobValidation(t *testing.T) {
+	env := newTestEnvironment(t, false)
+	attachment, err := env.files.Create("requests.jsonl", files.PurposeBatch, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("Failed to store file: %v", err)
+	}
+	for _, body := range []string{
+		`{"schedule": "daily", "model": "ai/smollm2", "prompt": "Hi"}`,
+		`{"schedule": "@daily", "model": "ai/smollm2"}`,
+		`{"schedule": "@daily", "prompt": "Hi"}`,
+		`{"schedule": "@daily", "model": "ai/smollm2", "prompt": "Hi", "endpoint": "/v1/embeddings"}`,
+		`{"schedule": "@daily", "model": "ai/smollm2", "prompt": "Hi", "webhook_url": "file:///tmp/results"}`,
+		// Batch jobs require the Batch API.
+		`{"schedule": "@daily", "input_file_id": "` + attachment.ID + `"}`,
+	} {
+		if code := serve(t, env.handler, http.MethodPost, JobsPath, body, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, code)
+		}
+	}
+	if code := serve(t, env.handler, http.MethodPost, JobsPath+"/job_missing/run", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing job, got %d", code)
+	}
+}
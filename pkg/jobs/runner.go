@@ -0,0 +1,267 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/model-runner/pkg/batch"
+	"github.com/docker/model-runner/pkg/files"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/internal/utils"
+)
+
+const (
+	// retryInterval is the interval after which the runner retries when it's
+	// unable to record a run.
+	retryInterval = time.Minute
+	// defaultBatchPollInterval is the interval at which a batch job's batch
+	// is polled until it finishes.
+	defaultBatchPollInterval = 5 * time.Second
+	// webhookTimeout is the timeout of webhook deliveries.
+	webhookTimeout = 30 * time.Second
+	// maximumErrorLength is the maximum length of a response body included
+	// in a run's error.
+	maximumErrorLength = 512
+	// userAgent is the User-Agent of job requests and webhook deliveries.
+	userAgent = "model-runner-jobs"
+)
+
+// webhookPayload is the body posted to a job's webhook after each run.
+type webhookPayload struct {
+	// Object is always "job.run".
+	Object string `json:"object"`
+	// JobID is the ID of the job.
+	JobID string `json:"job_id"`
+	// JobName is the name of the job.
+	JobName string `json:"job_name,omitempty"`
+	// Run describes the run.
+	Run Run `json:"run"`
+	// Result is the chat completion of a prompt job, or the batch of a batch
+	// job.
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Run runs jobs as they become due until the context is cancelled. Runs that
+// were missed while the model runner was stopped are skipped.
+func (h *Handler) Run(ctx context.Context) {
+	h.skipMissedRuns()
+	for {
+		var timer *time.Timer
+		var due <-chan time.Time
+		if job, ok := h.manager.nextJob(); ok {
+			delay := time.Until(time.Unix(job.NextRunAt, 0))
+			if delay <= 0 {
+				err := h.run(ctx, job)
+				if ctx.Err() != nil {
+					return
+				} else if err == nil {
+					continue
+				}
+				h.log.Warnf("Unable to record run of job %s: %v", job.ID, err)
+				delay = retryInterval
+			}
+			timer = time.NewTimer(delay)
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-h.wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// skipMissedRuns reschedules jobs whose next run has already passed.
+func (h *Handler) skipMissedRuns() {
+	now := time.Now()
+	for _, job := range h.manager.Jobs() {
+		if job.NextRunAt >= now.Unix() {
+			continue
+		}
+		schedule, err := ParseSchedule(job.Schedule)
+		if err != nil {
+			h.log.Warnf("Job %s has an invalid schedule: %v", job.ID, err)
+			continue
+		}
+		if _, err := h.manager.UpdateJob(job.ID, func(j *Job) {
+			j.NextRunAt = schedule.Next(now).Unix()
+		}); err != nil {
+			h.log.Warnf("Unable to reschedule job %s: %v", job.ID, err)
+		}
+	}
+}
+
+// run runs a job, delivers its results, and records the run.
+func (h *Handler) run(ctx context.Context, job Job) error {
+	h.log.Infof("Running job %s", job.ID)
+	run := Run{StartedAt: time.Now().Unix()}
+	var result json.RawMessage
+	var err error
+	if job.InputFileID != "" {
+		var b batch.Batch
+		if b, err = h.runBatch(ctx, job); b.ID != "" {
+			run.BatchID = b.ID
+			run.OutputFileID = b.OutputFileID
+			result, _ = json.Marshal(b)
+		}
+	} else {
+		result, err = h.runPrompt(ctx, job)
+	}
+	if ctx.Err() != nil {
+		// The run was interrupted by shutdown, so don't record it.
+		return nil
+	}
+
+	run.CompletedAt = time.Now().Unix()
+	run.Status = RunStatusSucceeded
+	if err != nil {
+		run.Status = RunStatusFailed
+		run.Error = err.Error()
+	}
+	if job.WebhookURL != "" {
+		if err := h.postWebhook(ctx, job, run, result); err != nil {
+			run.Status = RunStatusFailed
+			run.Error = fmt.Sprintf("unable to deliver results: %v", err)
+		}
+	} else if run.Status == RunStatusSucceeded && job.InputFileID == "" {
+		file, err := h.files.Create(fmt.Sprintf("%s_%d.json", job.ID, run.StartedAt), files.PurposeJobOutput, bytes.NewReader(result))
+		if err != nil {
+			run.Status = RunStatusFailed
+			run.Error = fmt.Sprintf("unable to store results: %v", err)
+		} else {
+			run.OutputFileID = file.ID
+		}
+	}
+	if run.Status == RunStatusFailed {
+		h.log.Warnf("Job %s failed: %s", job.ID, run.Error)
+	}
+
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return err
+	}
+	_, err = h.manager.UpdateJob(job.ID, func(j *Job) {
+		j.Runs = append([]Run{run}, j.Runs...)[:min(len(j.Runs)+1, maximumRunHistory)]
+		j.NextRunAt = schedule.Next(time.Now()).Unix()
+	})
+	if errors.Is(err, ErrJobNotFound) {
+		// The job was deleted while running.
+		return nil
+	}
+	return err
+}
+
+// runPrompt sends a prompt job's prompt to its model, returning the chat
+// completion.
+func (h *Handler) runPrompt(ctx context.Context, job Job) (json.RawMessage, error) {
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	var messages []message
+	if job.SystemPrompt != "" {
+		messages = append(messages, message{Role: "system", Content: job.SystemPrompt})
+	}
+	messages = append(messages, message{Role: "user", Content: job.Prompt})
+	body, err := json.Marshal(map[string]any{"model": job.Model, "messages": messages})
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode request: %w", err)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, inference.InferencePrefix+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", userAgent)
+	recorder := utils.NewResponseRecorder()
+	h.scheduler.ServeHTTP(recorder, r)
+	if recorder.StatusCode != http.StatusOK {
+		message := strings.TrimSpace(recorder.Body.String())
+		if len(message) > maximumErrorLength {
+			message = message[:maximumErrorLength]
+		}
+		return nil, fmt.Errorf("request failed with status %d: %s", recorder.StatusCode, message)
+	}
+	return recorder.Body.Bytes(), nil
+}
+
+// runBatch submits a batch job's batch and waits for it to finish, returning
+// the finished batch.
+func (h *Handler) runBatch(ctx context.Context, job Job) (batch.Batch, error) {
+	if h.batches == nil {
+		return batch.Batch{}, errors.New("the Batch API isn't enabled")
+	}
+	b, err := h.batches.Submit(batch.CreateRequest{
+		InputFileID:      job.InputFileID,
+		Endpoint:         job.Endpoint,
+		CompletionWindow: "24h",
+		Metadata:         map[string]string{"job_id": job.ID},
+	})
+	if err != nil {
+		return batch.Batch{}, fmt.Errorf("unable to create batch: %w", err)
+	}
+	for {
+		switch b.Status {
+		case batch.StatusCompleted:
+			return b, nil
+		case batch.StatusFailed, batch.StatusExpired, batch.StatusCancelled:
+			return b, fmt.Errorf("batch %s %s", b.ID, b.Status)
+		}
+		select {
+		case <-ctx.Done():
+			return b, ctx.Err()
+		case <-time.After(h.batchPollInterval):
+		}
+		current, err := h.batches.Batch(b.ID)
+		if err != nil {
+			return b, fmt.Errorf("unable to get batch %s: %w", b.ID, err)
+		}
+		b = current
+	}
+}
+
+// postWebhook posts a run's results to its job's webhook.
+func (h *Handler) postWebhook(ctx context.Context, job Job, run Run, result json.RawMessage) error {
+	body, err := json.Marshal(webhookPayload{
+		Object:  "job.run",
+		JobID:   job.ID,
+		JobName: job.Name,
+		Run:     run,
+		Result:  result,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to encode payload: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, job.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", userAgent)
+	response, err := h.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maximumScheduleSearch bounds the search for a schedule's next run, so that
+// schedules that never match (such as February 30th) are rejected.
+const maximumScheduleSearch = 5 * 366 * 24 * time.Hour
+
+// scheduleMacros are the supported shorthands for common schedules.
+var scheduleMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+}
+
+// scheduleField describes a field of a cron expression.
+type scheduleField struct {
+	name     string
+	min, max int
+}
+
+// scheduleFields are the fields of a cron expression, in order.
+var scheduleFields = [5]scheduleField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Schedule is a parsed cron expression, evaluated in local time.
+type Schedule struct {
+	// spec is the original expression.
+	spec string
+	// minutes, hours, days, months, and weekdays are the matching values of
+	// each field.
+	minutes, hours, days, months, weekdays uint64
+	// restrictedDays and restrictedWeekdays record whether the day of month
+	// and day of week fields aren't "*", in which case, as in cron, a day
+	// matches if either field matches.
+	restrictedDays, restrictedWeekdays bool
+}
+
+// ParseSchedule parses a standard five-field cron expression ("MIN HOUR DOM
+// MON DOW"), whose fields support "*", values, ranges ("1-5"), steps ("*/15"
+// or "0-30/10"), and comma-separated lists, or one of the @hourly, @daily,
+// @weekly, @monthly, and @yearly shorthands. Sunday is 0 or 7.
+func ParseSchedule(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	expression := spec
+	if macro, ok := scheduleMacros[spec]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != len(scheduleFields) {
+		return nil, fmt.Errorf("invalid schedule %q: expected MIN HOUR DOM MON DOW", spec)
+	}
+
+	schedule := &Schedule{spec: spec}
+	values := [5]*uint64{&schedule.minutes, &schedule.hours, &schedule.days, &schedule.months, &schedule.weekdays}
+	for i, field := range fields {
+		bits, err := parseScheduleField(field, scheduleFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		*values[i] = bits
+	}
+	// Sunday may be written as 7.
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+	schedule.restrictedDays = fields[2] != "*"
+	schedule.restrictedWeekdays = fields[4] != "*"
+
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid schedule %q: it never matches", spec)
+	}
+	return schedule, nil
+}
+
+// parseScheduleField parses a field of a cron expression into a bit set of
+// matching values.
+func parseScheduleField(field string, f scheduleField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		valueRange, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepStr)
+			}
+		}
+		start, end := f.min, f.max
+		if valueRange != "*" {
+			startStr, endStr, isRange := strings.Cut(valueRange, "-")
+			var err error
+			if start, err = parseScheduleValue(startStr, f); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = parseScheduleValue(endStr, f); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = f.max
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, valueRange)
+			}
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// parseScheduleValue parses a value of a cron expression field.
+func parseScheduleValue(s string, f scheduleField) (int, error) {
+	value, err := strconv.Atoi(s)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("invalid %s %q: expected %d-%d", f.name, s, f.min, f.max)
+	}
+	return value, nil
+}
+
+// String returns the schedule's original expression.
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// Next returns the first time after t at which the schedule matches, or the
+// zero time if it doesn't match within the next five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maximumScheduleSearch)
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay returns whether the schedule matches t's day.
+func (s *Schedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.restrictedDays && s.restrictedWeekdays {
+		return day || weekday
+	}
+	return day && weekday
+}
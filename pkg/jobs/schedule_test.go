@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2025, time.January, 15, 10, 30, 20, 0, time.Local)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2025, time.January, 15, 10, 31, 0, 0, time.Local)},
+		{"*/15 * * * *", time.Date(2025, time.January, 15, 10, 45, 0, 0, time.Local)},
+		{"0 2 * * *", time.Date(2025, time.January, 16, 2, 0, 0, 0, time.Local)},
+		{"@daily", time.Date(2025, time.January, 16, 0, 0, 0, 0, time.Local)},
+		{"30 9 * * 1-5", time.Date(2025, time.January, 16, 9, 30, 0, 0, time.Local)},
+		{"0 0 * * 7", time.Date(2025, time.January, 19, 0, 0, 0, 0, time.Local)},
+		{"0 0 1 * *", time.Date(2025, time.February, 1, 0, 0, 0, 0, time.Local)},
+		{"0 12 29 2 *", time.Date(2028, time.February, 29, 12, 0, 0, 0, time.Local)},
+		// As in cron, restricting both days matches either.
+		{"0 0 20 * 5", time.Date(2025, time.January, 17, 0, 0, 0, 0, time.Local)},
+		{"5,10 11,12 * * *", time.Date(2025, time.January, 15, 11, 5, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.spec, err)
+			continue
+		}
+		if next := schedule.Next(now); !next.Equal(tt.next) {
+			t.Errorf("%q: expected next run at %v, got %v", tt.spec, tt.next, next)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"a * * * *",
+		"@often",
+		"0 0 30 2 *",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package jobs implements scheduled inference jobs, which run a stored prompt
+// or batch file against a model on a cron-like schedule and deliver the
+// results to a webhook or a file.
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+// ErrJobNotFound indicates that a job doesn't exist. If returned in
+// conjunction with an HTTP request, it should be paired with a 404 response
+// status.
+var ErrJobNotFound = errors.New("job not found")
+
+// Run statuses.
+const (
+	// RunStatusSucceeded indicates that a run's results were delivered.
+	RunStatusSucceeded = "succeeded"
+	// RunStatusFailed indicates that a run failed or its results couldn't be
+	// delivered.
+	RunStatusFailed = "failed"
+)
+
+const (
+	// maximumRunHistory is the number of recent runs kept for each job.
+	maximumRunHistory = 20
+	// storageKeyPrefix prefixes the storage keys of jobs, so that jobs may
+	// share storage with other state.
+	storageKeyPrefix = "jobs/"
+)
+
+// Run describes a run of a job.
+type Run struct {
+	// Status is RunStatusSucceeded or RunStatusFailed.
+	Status string `json:"status"`
+	// StartedAt is the time at which the run started as a Unix timestamp.
+	StartedAt int64 `json:"started_at"`
+	// CompletedAt is the time at which the run completed.
+	CompletedAt int64 `json:"completed_at"`
+	// BatchID is the ID of the batch created by the run of a batch job.
+	BatchID string `json:"batch_id,omitempty"`
+	// OutputFileID is the ID of the file holding the run's results, unless
+	// they were delivered to a webhook.
+	OutputFileID string `json:"output_file_id,omitempty"`
+	// Error describes why the run failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Job describes a scheduled job. Exactly one of Prompt and InputFileID is set.
+type Job struct {
+	// ID is the job's identifier.
+	ID string `json:"id"`
+	// Object is always "job".
+	Object string `json:"object"`
+	// Name is an optional name for the job.
+	Name string `json:"name,omitempty"`
+	// Schedule is the job's cron expression, evaluated in local time.
+	Schedule string `json:"schedule"`
+	// Model is the model to which a prompt job's prompt is sent.
+	Model string `json:"model,omitempty"`
+	// SystemPrompt is an optional system prompt for a prompt job.
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// Prompt is the user prompt of a prompt job.
+	Prompt string `json:"prompt,omitempty"`
+	// InputFileID is the ID of the batch input file of a batch job.
+	InputFileID string `json:"input_file_id,omitempty"`
+	// Endpoint is the endpoint of a batch job's requests.
+	Endpoint string `json:"endpoint,omitempty"`
+	// WebhookURL is the URL to which results are posted. If empty, results
+	// are stored as files.
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// CreatedAt is the job's creation time as a Unix timestamp.
+	CreatedAt int64 `json:"created_at"`
+	// NextRunAt is the time of the job's next run.
+	NextRunAt int64 `json:"next_run_at"`
+	// Runs are the job's most recent runs, newest first.
+	Runs []Run `json:"runs"`
+}
+
+// Manager manages the jobs persisted in storage, each under jobs/<id>.
+type Manager struct {
+	// storage persists jobs.
+	storage storage.KV
+	// mu guards jobs.
+	mu sync.Mutex
+	// jobs maps job IDs to jobs.
+	jobs map[string]Job
+}
+
+// NewManager creates a manager for the jobs persisted in kv. Jobs that can't
+// be loaded are logged and skipped.
+func NewManager(log logging.Logger, kv storage.KV) (*Manager, error) {
+	keys, err := kv.List(storageKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list jobs: %w", err)
+	}
+
+	m := &Manager{storage: kv, jobs: make(map[string]Job)}
+	for _, key := range keys {
+		data, err := kv.Get(key)
+		var job Job
+		if err == nil {
+			err = json.Unmarshal(data, &job)
+		}
+		if err != nil {
+			log.Warnf("Skipping job %s: %v", key, err)
+			continue
+		}
+		m.jobs[job.ID] = job
+	}
+	return m, nil
+}
+
+// CreateJob persists a new job.
+func (m *Manager) CreateJob(job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.saveJob(job); err != nil {
+		return err
+	}
+	m.jobs[job.ID] = job
+	return nil
+}
+
+// Jobs returns all jobs, newest first.
+func (m *Manager) Jobs() []Job {
+	m.mu.Lock()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	m.mu.Unlock()
+	slices.SortFunc(jobs, func(a, b Job) int {
+		if a.CreatedAt != b.CreatedAt {
+			return int(b.CreatedAt - a.CreatedAt)
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	return jobs
+}
+
+// Job returns a job.
+func (m *Manager) Job(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// UpdateJob modifies and persists a job, returning the updated job.
+func (m *Manager) UpdateJob(id string, update func(*Job)) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	job.Runs = slices.Clone(job.Runs)
+	update(&job)
+	if err := m.saveJob(job); err != nil {
+		return Job{}, err
+	}
+	m.jobs[id] = job
+	return job, nil
+}
+
+// DeleteJob deletes a job.
+func (m *Manager) DeleteJob(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	if err := m.storage.Delete(storageKeyPrefix + id); err != nil {
+		return fmt.Errorf("unable to delete job: %w", err)
+	}
+	delete(m.jobs, id)
+	return nil
+}
+
+// nextJob returns the job with the earliest next run.
+func (m *Manager) nextJob() (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var next *Job
+	for _, job := range m.jobs {
+		if next == nil || job.NextRunAt < next.NextRunAt ||
+			(job.NextRunAt == next.NextRunAt && job.ID < next.ID) {
+			next = &job
+		}
+	}
+	if next == nil {
+		return Job{}, false
+	}
+	return *next, true
+}
+
+// saveJob persists a job. The caller must hold the manager's lock.
+func (m *Manager) saveJob(job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("unable to encode job: %w", err)
+	}
+	if err := m.storage.Put(storageKeyPrefix+job.ID, data); err != nil {
+		return fmt.Errorf("unable to write job: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+func TestManagerPersistence(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	kv, err := storage.NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	manager, err := NewManager(log, kv)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	for _, id := range []string{"job_kept", "job_deleted"} {
+		if err := manager.CreateJob(Job{ID: id, Object: "job", Schedule: "@daily", Prompt: "Hi"}); err != nil {
+			t.Fatalf("CreateJob failed: %v", err)
+		}
+	}
+	if _, err := manager.UpdateJob("job_kept", func(job *Job) {
+		job.Runs = append(job.Runs, Run{Status: RunStatusSucceeded})
+	}); err != nil {
+		t.Fatalf("UpdateJob failed: %v", err)
+	}
+	if err := manager.DeleteJob("job_deleted"); err != nil {
+		t.Fatalf("DeleteJob failed: %v", err)
+	}
+	if err := kv.Put(storageKeyPrefix+"job_corrupt", []byte("{")); err != nil {
+		t.Fatalf("Failed to store a corrupt job: %v", err)
+	}
+
+	reloaded, err := NewManager(log, kv)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if job, err := reloaded.Job("job_kept"); err != nil || len(job.Runs) != 1 {
+		t.Errorf("Expected the updated job to be reloaded, got %+v (error: %v)", job, err)
+	}
+	if _, err := reloaded.Job("job_deleted"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected the deleted job to be gone, got %v", err)
+	}
+	if jobs := reloaded.Jobs(); len(jobs) != 1 {
+		t.Errorf("Expected only the valid job to be reloaded, got %+v", jobs)
+	}
+}
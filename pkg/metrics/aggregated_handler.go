@@ -37,8 +37,15 @@ func (h *AggregatedMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Usage analytics, slow-client incidents, inference traffic, and request
+	// queues are available even without active runners
+	usageFamilies := usageMetricFamilies(h.scheduler.UserAgentUsage())
+	slowClientFamilies := slowClientMetricFamilies(h.scheduler.SlowClientIncidents())
+	requestQueueFamilies := requestQueueMetricFamilies(h.scheduler.RequestQueues())
+
 	runners := h.scheduler.GetAllActiveRunners()
-	if len(runners) == 0 {
+	inferenceFamilies := inferenceMetricFamilies(h.scheduler.InferenceTraffic(), runners)
+	if len(runners) == 0 && len(usageFamilies) == 0 && len(slowClientFamilies) == 0 && len(inferenceFamilies) == 0 && len(requestQueueFamilies) == 0 {
 		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "# No active runners\n")
@@ -47,6 +54,18 @@ func (h *AggregatedMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 
 	// Collect and aggregate metrics from all runners
 	allFamilies := h.collectAndAggregateMetrics(r.Context(), runners)
+	for name, family := range usageFamilies {
+		allFamilies[name] = family
+	}
+	for name, family := range slowClientFamilies {
+		allFamilies[name] = family
+	}
+	for name, family := range inferenceFamilies {
+		allFamilies[name] = family
+	}
+	for name, family := range requestQueueFamilies {
+		allFamilies[name] = family
+	}
 
 	// Write aggregated response using Prometheus encoder
 	h.writeAggregatedMetrics(w, allFamilies)
@@ -63,7 +82,7 @@ func (h *AggregatedMetricsHandler) collectAndAggregateMetrics(ctx context.Contex
 		go func(runner ActiveRunner) {
 			defer wg.Done()
 
-			families, err := h.fetchRunnerMetrics(ctx, runner)
+			families, err := FetchRunnerMetrics(ctx, runner.Socket)
 			if err != nil {
 				h.log.Warnf("Failed to fetch metrics from runner %s/%s: %v", runner.BackendName, runner.ModelName, err)
 				return
@@ -86,13 +105,14 @@ func (h *AggregatedMetricsHandler) collectAndAggregateMetrics(ctx context.Contex
 	return allFamilies
 }
 
-// fetchRunnerMetrics fetches and parses metrics from a single runner
-func (h *AggregatedMetricsHandler) fetchRunnerMetrics(ctx context.Context, runner ActiveRunner) (map[string]*dto.MetricFamily, error) {
+// FetchRunnerMetrics fetches and parses the metrics of the runner listening on
+// a socket.
+func FetchRunnerMetrics(ctx context.Context, socket string) (map[string]*dto.MetricFamily, error) {
 	// Create HTTP client for Unix socket communication
 	client := &http.Client{
 		Transport: &http.Transport{
 			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				return net.DialTimeout("unix", runner.Socket, 5*time.Second)
+				return net.DialTimeout("unix", socket, 5*time.Second)
 			},
 		},
 		Timeout: 10 * time.Second,
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultTimestampBucket is the timestamp bucket size used when all
+// anonymization options are requested at once.
+const defaultTimestampBucket = time.Hour
+
+// anonymizationSalt is the per-process salt used to hash identifiers. Hashes
+// are stable for the lifetime of the process, so records can still be
+// correlated with each other, but can't be reversed by precomputing the hashes
+// of known values.
+var anonymizationSalt = func() []byte {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		panic(fmt.Sprintf("unable to generate anonymization salt: %v", err))
+	}
+	return salt
+}()
+
+// AnonymizationPolicy specifies how data is anonymized before it's exported
+// off-host.
+type AnonymizationPolicy struct {
+	// HashIdentifiers indicates that identifiers (user agents, client
+	// addresses, record IDs, and session IDs) are replaced by salted hashes.
+	HashIdentifiers bool
+	// StripBodies indicates that request, response, and error bodies are
+	// removed.
+	StripBodies bool
+	// TimestampBucket is the granularity to which timestamps are rounded down.
+	// A zero value leaves timestamps unmodified.
+	TimestampBucket time.Duration
+}
+
+// ParseAnonymizationPolicy parses an anonymization policy from a
+// comma-separated list of options: "hash-ids", "strip-bodies", and
+// "bucket=<duration>". The "all" option enables every option, with hourly
+// timestamp buckets. An empty specification disables anonymization.
+func ParseAnonymizationPolicy(spec string) (AnonymizationPolicy, error) {
+	var policy AnonymizationPolicy
+	for _, option := range strings.Split(spec, ",") {
+		option = strings.TrimSpace(option)
+		switch {
+		case option == "":
+		case option == "all":
+			policy.HashIdentifiers = true
+			policy.StripBodies = true
+			policy.TimestampBucket = max(policy.TimestampBucket, defaultTimestampBucket)
+		case option == "hash-ids":
+			policy.HashIdentifiers = true
+		case option == "strip-bodies":
+			policy.StripBodies = true
+		case strings.HasPrefix(option, "bucket="):
+			bucket, err := time.ParseDuration(strings.TrimPrefix(option, "bucket="))
+			if err != nil || bucket < time.Second {
+				return AnonymizationPolicy{}, fmt.Errorf("invalid timestamp bucket %q: must be a duration of at least 1s", option)
+			}
+			policy.TimestampBucket = bucket
+		default:
+			return AnonymizationPolicy{}, fmt.Errorf("unknown anonymization option %q", option)
+		}
+	}
+	return policy, nil
+}
+
+// Enabled returns whether the policy modifies any data.
+func (p AnonymizationPolicy) Enabled() bool {
+	return p.HashIdentifiers || p.StripBodies || p.TimestampBucket > 0
+}
+
+// combine returns a policy that applies the options of both policies, using
+// the coarser timestamp bucket.
+func (p AnonymizationPolicy) combine(other AnonymizationPolicy) AnonymizationPolicy {
+	return AnonymizationPolicy{
+		HashIdentifiers: p.HashIdentifiers || other.HashIdentifiers,
+		StripBodies:     p.StripBodies || other.StripBodies,
+		TimestampBucket: max(p.TimestampBucket, other.TimestampBucket),
+	}
+}
+
+// hashIdentifier returns a salted hash of an identifier. Empty identifiers are
+// left empty.
+func hashIdentifier(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, anonymizationSalt)
+	mac.Write([]byte(value))
+	return "anon-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// anonymizeRecord returns an anonymized copy of a record.
+func (p AnonymizationPolicy) anonymizeRecord(record *RequestResponsePair) *RequestResponsePair {
+	anonymized := *record
+	if p.HashIdentifiers {
+		// Record IDs embed the request time, so they're hashed along with
+		// user agents.
+		anonymized.ID = hashIdentifier(record.ID)
+		anonymized.UserAgent = hashIdentifier(record.UserAgent)
+		anonymized.ClientAddress = hashIdentifier(record.ClientAddress)
+		anonymized.Session = hashIdentifier(record.Session)
+	}
+	if p.StripBodies {
+		anonymized.Request = ""
+		anonymized.Response = ""
+		anonymized.Error = ""
+		if record.Retrieval != nil {
+			anonymized.Retrieval = record.Retrieval.withoutBodies()
+		}
+		if record.PromptTemplate != nil {
+			anonymized.PromptTemplate = record.PromptTemplate.withoutBodies()
+		}
+		if record.BestOf != nil {
+			anonymized.BestOf = record.BestOf.withoutBodies()
+		}
+	}
+	if bucket := int64(p.TimestampBucket / time.Second); bucket > 0 {
+		anonymized.Timestamp -= anonymized.Timestamp % bucket
+	}
+	return &anonymized
+}
+
+// anonymizeRecords returns anonymized copies of the specified records. The
+// records are returned unmodified if the policy isn't enabled.
+func (p AnonymizationPolicy) anonymizeRecords(responses []ModelRecordsResponse) []ModelRecordsResponse {
+	if !p.Enabled() {
+		return responses
+	}
+	anonymized := make([]ModelRecordsResponse, len(responses))
+	for i, response := range responses {
+		anonymized[i] = response
+		anonymized[i].Records = make([]*RequestResponsePair, len(response.Records))
+		for j, record := range response.Records {
+			anonymized[i].Records[j] = p.anonymizeRecord(record)
+		}
+	}
+	return anonymized
+}
+
+// SetAnonymizationPolicy sets the anonymization policy applied to records
+// served by the records endpoints.
+func (r *OpenAIRecorder) SetAnonymizationPolicy(policy AnonymizationPolicy) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.anonymization = policy
+}
+
+// anonymizationForRequest returns the anonymization policy for a records
+// request, which combines the configured policy with any options specified in
+// the anonymize query parameter. Clients can request additional anonymization,
+// but can't disable the configured policy.
+func (r *OpenAIRecorder) anonymizationForRequest(req *http.Request) (AnonymizationPolicy, error) {
+	requested, err := ParseAnonymizationPolicy(req.URL.Query().Get("anonymize"))
+	if err != nil {
+		return AnonymizationPolicy{}, err
+	}
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.anonymization.combine(requested), nil
+}
+
+// SetAnonymizationPolicy sets the anonymization policy applied to usage data.
+// Usage data contains no bodies or timestamps, so only identifier hashing
+// applies.
+func (t *Tracker) SetAnonymizationPolicy(policy AnonymizationPolicy) {
+	t.hashUserAgents = policy.HashIdentifiers
+}
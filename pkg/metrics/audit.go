@@ -0,0 +1,271 @@
+package metrics
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+const (
+	// auditKeyPrefix prefixes the storage keys of audit log entries, which
+	// are followed by their zero-padded sequence number, so that keys sort
+	// in sequence order.
+	auditKeyPrefix = "recorder/audit/"
+	// auditPut is the action of entries recording a persisted record.
+	auditPut = "put"
+	// auditDelete is the action of entries recording a deleted record.
+	auditDelete = "delete"
+)
+
+// AuditEntry is an entry of the audit log of persisted records. Each entry
+// records the digest of a record as persisted, or its deletion, and is chained
+// to the previous entry by its hash, so that altering, reordering, or removing
+// entries breaks the chain.
+type AuditEntry struct {
+	Sequence uint64 `json:"sequence"`
+	// Action is "put" or "delete".
+	Action   string `json:"action"`
+	RecordID string `json:"record_id"`
+	// Timestamp is when the entry was added, in Unix seconds.
+	Timestamp int64 `json:"timestamp"`
+	// Digest is the SHA-256 digest of the persisted record, for puts.
+	Digest string `json:"digest,omitempty"`
+	// Previous is the hash of the previous entry, or empty for the first.
+	Previous string `json:"previous,omitempty"`
+	// Hash is the SHA-256 hash of the entry's other fields.
+	Hash string `json:"hash"`
+	// Signature is the base64-encoded Ed25519 signature of Hash, if the
+	// audit log is signed.
+	Signature string `json:"signature,omitempty"`
+}
+
+// hash returns the hash of the entry's fields, other than its signature.
+func (e AuditEntry) hash() string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		strconv.FormatUint(e.Sequence, 10),
+		e.Action,
+		e.RecordID,
+		strconv.FormatInt(e.Timestamp, 10),
+		e.Digest,
+		e.Previous,
+	}, "\n")))
+	return hex.EncodeToString(hash[:])
+}
+
+// AuditReport is the result of verifying the audit log of persisted records.
+type AuditReport struct {
+	// Valid indicates whether the audit log is intact and matches the
+	// persisted records.
+	Valid bool `json:"valid"`
+	// Entries is the number of entries in the audit log.
+	Entries int `json:"entries"`
+	// Records is the number of persisted records.
+	Records int `json:"records"`
+	// Head is the hash of the last entry, which auditors can keep to detect
+	// the removal of later entries.
+	Head string `json:"head,omitempty"`
+	// PublicKey is the base64-encoded public key verifying the signatures of
+	// entries, if the audit log is signed.
+	PublicKey string `json:"public_key,omitempty"`
+	// Errors describe the broken links, invalid signatures, and altered,
+	// missing, or unaudited records.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// EnableAudit makes the recorder keep a hash-chained audit log of persisted
+// records, so that records altered after the fact can be detected. Entries
+// are signed with key, if it isn't nil. It must be called before SetStorage.
+func (r *OpenAIRecorder) EnableAudit(key ed25519.PrivateKey) error {
+	if key != nil && len(key) != ed25519.PrivateKeySize {
+		return fmt.Errorf("expected a %d-byte Ed25519 private key, got %d bytes", ed25519.PrivateKeySize, len(key))
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.audit = true
+	r.auditKey = key
+	return nil
+}
+
+// loadAuditLog loads the head of the audit log from kv. If the log is empty,
+// the records already persisted are entered into it. The caller must hold r.m.
+func (r *OpenAIRecorder) loadAuditLog(kv storage.KV) error {
+	keys, err := kv.List(auditKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("listing audit log: %w", err)
+	}
+	if len(keys) > 0 {
+		var head AuditEntry
+		if err := getJSON(kv, keys[len(keys)-1], &head); err != nil {
+			return err
+		}
+		r.auditSequence, r.auditHead = head.Sequence, head.Hash
+		return nil
+	}
+
+	recordKeys, err := kv.List(recordKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("listing records: %w", err)
+	}
+	for _, key := range recordKeys {
+		data, err := kv.Get(key)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+		r.appendAudit(kv, auditPut, strings.TrimPrefix(key, recordKeyPrefix), data)
+	}
+	return nil
+}
+
+// appendAudit adds an entry for a record to the audit log in kv, if enabled.
+// data is the persisted record, for puts. The caller must hold r.m.
+func (r *OpenAIRecorder) appendAudit(kv storage.KV, action, recordID string, data []byte) {
+	if !r.audit {
+		return
+	}
+	entry := AuditEntry{
+		Sequence:  r.auditSequence + 1,
+		Action:    action,
+		RecordID:  recordID,
+		Timestamp: time.Now().Unix(),
+		Previous:  r.auditHead,
+	}
+	if data != nil {
+		digest := sha256.Sum256(data)
+		entry.Digest = hex.EncodeToString(digest[:])
+	}
+	entry.Hash = entry.hash()
+	if r.auditKey != nil {
+		entry.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(r.auditKey, []byte(entry.Hash)))
+	}
+	encoded, err := json.Marshal(entry)
+	if err == nil {
+		err = kv.Put(auditKey(entry.Sequence), encoded)
+	}
+	if err != nil {
+		r.log.Warnf("Failed to append %s of record %s to the audit log: %v", action, recordID, err)
+		return
+	}
+	r.auditSequence, r.auditHead = entry.Sequence, entry.Hash
+}
+
+// auditKey returns the storage key of an audit log entry.
+func auditKey(sequence uint64) string {
+	return fmt.Sprintf("%s%020d", auditKeyPrefix, sequence)
+}
+
+// VerifyAudit verifies that the audit log of persisted records is intact and
+// that the persisted records match their latest entries.
+func (r *OpenAIRecorder) VerifyAudit() (AuditReport, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if !r.audit || r.storage == nil {
+		return AuditReport{}, fmt.Errorf("the audit log requires records persistence and auditing to be enabled")
+	}
+	var report AuditReport
+	var publicKey ed25519.PublicKey
+	if r.auditKey != nil {
+		publicKey = r.auditKey.Public().(ed25519.PublicKey)
+		report.PublicKey = base64.StdEncoding.EncodeToString(publicKey)
+	}
+	fail := func(format string, args ...any) {
+		report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+	}
+
+	keys, err := r.storage.List(auditKeyPrefix)
+	if err != nil {
+		return AuditReport{}, fmt.Errorf("listing audit log: %w", err)
+	}
+	report.Entries = len(keys)
+	// digests are the digests of the records that should be persisted,
+	// according to the audit log.
+	digests := make(map[string]string)
+	var previous AuditEntry
+	for i, key := range keys {
+		var entry AuditEntry
+		if err := getJSON(r.storage, key, &entry); err != nil {
+			fail("entry %s is unreadable: %v", key, err)
+			continue
+		}
+		if key != auditKey(entry.Sequence) || (i > 0 && entry.Sequence != previous.Sequence+1) || (i == 0 && entry.Sequence != 1) {
+			fail("entry %d is out of sequence", entry.Sequence)
+		}
+		if entry.Previous != previous.Hash {
+			fail("entry %d isn't chained to the previous entry", entry.Sequence)
+		}
+		if entry.hash() != entry.Hash {
+			fail("entry %d was altered", entry.Sequence)
+		}
+		if publicKey != nil {
+			signature, err := base64.StdEncoding.DecodeString(entry.Signature)
+			if err != nil || !ed25519.Verify(publicKey, []byte(entry.Hash), signature) {
+				fail("entry %d has an invalid signature", entry.Sequence)
+			}
+		}
+		switch entry.Action {
+		case auditPut:
+			digests[entry.RecordID] = entry.Digest
+		case auditDelete:
+			delete(digests, entry.RecordID)
+		}
+		previous = entry
+	}
+	report.Head = previous.Hash
+	if previous.Hash != r.auditHead {
+		fail("the audit log was truncated after entry %d", previous.Sequence)
+	}
+
+	recordKeys, err := r.storage.List(recordKeyPrefix)
+	if err != nil {
+		return AuditReport{}, fmt.Errorf("listing records: %w", err)
+	}
+	report.Records = len(recordKeys)
+	for _, key := range recordKeys {
+		id := strings.TrimPrefix(key, recordKeyPrefix)
+		data, err := r.storage.Get(key)
+		if err != nil {
+			fail("record %s is unreadable: %v", id, err)
+			continue
+		}
+		expected, ok := digests[id]
+		delete(digests, id)
+		if !ok {
+			fail("record %s isn't in the audit log", id)
+		} else if digest := sha256.Sum256(data); hex.EncodeToString(digest[:]) != expected {
+			fail("record %s was altered", id)
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(digests)) {
+		fail("record %s was deleted without an audit log entry", id)
+	}
+
+	report.Valid = len(report.Errors) == 0
+	return report, nil
+}
+
+// VerifyAuditHandler returns a handler for GET requests that verify the audit
+// log of persisted records.
+func (r *OpenAIRecorder) VerifyAuditHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		report, err := r.VerifyAudit()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package metrics
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// maxCacheSamples is the number of samples of the backend's cache metrics kept
+// per runner.
+const maxCacheSamples = 60
+
+var (
+	// cachedTokensMetrics are the backend metrics reporting the number of
+	// tokens held in the KV cache.
+	cachedTokensMetrics = []string{"llamacpp:kv_cache_tokens"}
+	// cacheUsageMetrics are the backend metrics reporting the fraction of the
+	// KV cache in use.
+	cacheUsageMetrics = []string{"llamacpp:kv_cache_usage_ratio", "vllm:kv_cache_usage_perc", "vllm:gpu_cache_usage_perc"}
+	// preemptionMetrics are the backend metrics counting the requests whose
+	// KV cache was evicted to make room for others.
+	preemptionMetrics = []string{"vllm:num_preemptions_total", "vllm:num_preemptions"}
+)
+
+// CacheSample is a sample of the KV cache statistics of a runner.
+type CacheSample struct {
+	Time time.Time `json:"time"`
+	// CachedTokens and CacheUsageRatio are the number of tokens held in the
+	// cache and the fraction of the cache in use, if the backend reports them.
+	CachedTokens    float64 `json:"cached_tokens"`
+	CacheUsageRatio float64 `json:"cache_usage_ratio"`
+	// ReuseRatio is the fraction of the prompt tokens reported by responses
+	// since the previous sample that were served from the cache.
+	ReuseRatio float64 `json:"reuse_ratio"`
+}
+
+// RunnerCacheStats are the KV cache statistics of the runners of a model with
+// a backend in some mode, aggregated since the model runner started.
+type RunnerCacheStats struct {
+	// Model is the reference with which the model was last requested.
+	Model   string `json:"model,omitempty"`
+	ModelID string `json:"model_id"`
+	Backend string `json:"backend"`
+	Mode    string `json:"mode"`
+	// Requests is the number of successful responses that reported prompt
+	// tokens.
+	Requests uint64 `json:"requests"`
+	// PromptTokens are the prompt tokens reported by responses, of which
+	// CachedPromptTokens were served from the cache rather than evaluated.
+	PromptTokens       uint64 `json:"prompt_tokens"`
+	CachedPromptTokens uint64 `json:"cached_prompt_tokens"`
+	// ReuseRatio is CachedPromptTokens over PromptTokens.
+	ReuseRatio float64 `json:"reuse_ratio"`
+	// CachedTokens and CacheUsageRatio are the last sampled number of tokens
+	// held in the caches of all replicas and average fraction of their caches
+	// in use, if the backend reports them.
+	CachedTokens    float64 `json:"cached_tokens"`
+	CacheUsageRatio float64 `json:"cache_usage_ratio"`
+	// Evictions counts the cache evictions observed in the backend's
+	// metrics: preemptions reported by vLLM, or drops in the number of tokens
+	// held in the cache between samples, whose tokens are counted by
+	// EvictedTokens.
+	Evictions     uint64 `json:"evictions"`
+	EvictedTokens uint64 `json:"evicted_tokens"`
+	// Samples are the most recent samples of the backend's cache metrics,
+	// oldest first.
+	Samples []CacheSample `json:"samples"`
+
+	// preemptions is the last sampled number of preemptions.
+	preemptions float64
+	// sampledPromptTokens and sampledCachedPromptTokens are the values of
+	// PromptTokens and CachedPromptTokens at the last sample.
+	sampledPromptTokens       uint64
+	sampledCachedPromptTokens uint64
+}
+
+// cacheKey identifies the runners of a model with a backend in some mode.
+type cacheKey struct {
+	backend string
+	modelID string
+	mode    string
+}
+
+// CacheStats aggregates the KV cache statistics of runners over time, from the
+// usage reported by responses and samples of the backends' metrics.
+type CacheStats struct {
+	// m protects the fields below.
+	m sync.Mutex
+	// runners maps runner keys to their statistics.
+	runners map[cacheKey]*RunnerCacheStats
+}
+
+// NewCacheStats creates a new cache statistics aggregator.
+func NewCacheStats() *CacheStats {
+	return &CacheStats{runners: make(map[cacheKey]*RunnerCacheStats)}
+}
+
+// statsFor returns the statistics of the runners of a model with a backend in
+// some mode, creating them if necessary. The caller must hold the lock.
+func (s *CacheStats) statsFor(backend, modelID, mode string) *RunnerCacheStats {
+	key := cacheKey{backend: backend, modelID: modelID, mode: mode}
+	stats, ok := s.runners[key]
+	if !ok {
+		stats = &RunnerCacheStats{ModelID: modelID, Backend: backend, Mode: mode, Samples: []CacheSample{}}
+		s.runners[key] = stats
+	}
+	return stats
+}
+
+// RecordResponse records the prompt token usage of a successful response of a
+// runner, written to a response writer created by NewResponseRecorder.
+func (s *CacheStats) RecordResponse(backend, model, modelID, mode string, rw http.ResponseWriter) {
+	if ResponseStatusCode(rw) >= http.StatusBadRequest {
+		return
+	}
+	usage := responseUsage(rw)
+	if usage.PromptTokens <= 0 {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	stats := s.statsFor(backend, modelID, mode)
+	stats.Model = model
+	stats.Requests++
+	stats.PromptTokens += uint64(usage.PromptTokens)
+	stats.CachedPromptTokens += uint64(min(max(usage.CachedTokens, 0), usage.PromptTokens))
+}
+
+// Sample records a sample of the metrics of the replicas of a runner of a
+// model with a backend in some mode, as returned by FetchRunnerMetrics.
+func (s *CacheStats) Sample(backend, modelID, mode string, replicas []map[string]*dto.MetricFamily) {
+	var cachedTokens, usageRatio, preemptions float64
+	var hasPreemptions bool
+	for _, families := range replicas {
+		replicaCachedTokens, _ := metricValue(families, cachedTokensMetrics)
+		replicaUsageRatio, _ := metricValue(families, cacheUsageMetrics)
+		replicaPreemptions, ok := metricValue(families, preemptionMetrics)
+		cachedTokens += replicaCachedTokens
+		usageRatio += replicaUsageRatio / float64(len(replicas))
+		preemptions += replicaPreemptions
+		hasPreemptions = hasPreemptions || ok
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	stats := s.statsFor(backend, modelID, mode)
+	if hasPreemptions {
+		// Counters are reset when runners restart.
+		if preemptions >= stats.preemptions {
+			stats.Evictions += uint64(preemptions - stats.preemptions)
+		} else {
+			stats.Evictions += uint64(preemptions)
+		}
+		stats.preemptions = preemptions
+	}
+	if cachedTokens < stats.CachedTokens {
+		stats.Evictions++
+		stats.EvictedTokens += uint64(stats.CachedTokens - cachedTokens)
+	}
+	stats.CachedTokens = cachedTokens
+	stats.CacheUsageRatio = usageRatio
+
+	sample := CacheSample{
+		Time:            time.Now(),
+		CachedTokens:    cachedTokens,
+		CacheUsageRatio: usageRatio,
+		ReuseRatio:      ratio(stats.CachedPromptTokens-stats.sampledCachedPromptTokens, stats.PromptTokens-stats.sampledPromptTokens),
+	}
+	stats.sampledPromptTokens, stats.sampledCachedPromptTokens = stats.PromptTokens, stats.CachedPromptTokens
+	stats.Samples = append(stats.Samples, sample)
+	if len(stats.Samples) > maxCacheSamples {
+		stats.Samples = stats.Samples[len(stats.Samples)-maxCacheSamples:]
+	}
+}
+
+// Stats returns the cache statistics of all runners, ordered by model,
+// backend, and mode.
+func (s *CacheStats) Stats() []RunnerCacheStats {
+	s.m.Lock()
+	result := make([]RunnerCacheStats, 0, len(s.runners))
+	for _, stats := range s.runners {
+		snapshot := *stats
+		snapshot.ReuseRatio = ratio(stats.CachedPromptTokens, stats.PromptTokens)
+		snapshot.Samples = slices.Clone(stats.Samples)
+		result = append(result, snapshot)
+	}
+	s.m.Unlock()
+
+	slices.SortFunc(result, func(a, b RunnerCacheStats) int {
+		return cmp.Or(
+			cmp.Compare(a.ModelID, b.ModelID),
+			cmp.Compare(a.Backend, b.Backend),
+			cmp.Compare(a.Mode, b.Mode),
+		)
+	})
+	return result
+}
+
+// Handler returns a handler that serves the cache statistics of all runners,
+// or of the runners of the model specified by the model query parameter, by
+// reference or ID.
+func (s *CacheStats) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		stats := s.Stats()
+		if model := req.URL.Query().Get("model"); model != "" {
+			stats = slices.DeleteFunc(stats, func(entry RunnerCacheStats) bool {
+				return entry.Model != model && entry.ModelID != model
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats); err != nil {
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// metricValue returns the sum of the values of the first of the named metric
+// families that's present, if any.
+func metricValue(families map[string]*dto.MetricFamily, names []string) (float64, bool) {
+	for _, name := range names {
+		family, ok := families[name]
+		if !ok {
+			continue
+		}
+		var sum float64
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.Gauge != nil:
+				sum += metric.Gauge.GetValue()
+			case metric.Counter != nil:
+				sum += metric.Counter.GetValue()
+			case metric.Untyped != nil:
+				sum += metric.Untyped.GetValue()
+			}
+		}
+		return sum, true
+	}
+	return 0, false
+}
+
+// ratio returns part over whole, or zero if whole is zero.
+func ratio(part, whole uint64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EncryptionKeySize is the size of the keys that encrypt persisted record
+// bodies with AES-256-GCM.
+const EncryptionKeySize = 32
+
+// ParseEncryptionKey decodes a base64 or hex encoded encryption key.
+func ParseEncryptionKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != EncryptionKeySize {
+		if key, err = hex.DecodeString(encoded); err != nil || len(key) != EncryptionKeySize {
+			return nil, fmt.Errorf("expected a base64 or hex encoded %d-byte key", EncryptionKeySize)
+		}
+	}
+	return key, nil
+}
+
+// persistedRecord is a record as persisted. If encryption is enabled, the
+// bodies are stripped from the record, and Sealed holds the encrypted record.
+type persistedRecord struct {
+	*RequestResponsePair
+	Sealed string `json:"sealed,omitempty"`
+}
+
+// SetEncryptionKey makes the recorder encrypt the bodies of persisted records
+// with key, so that conversations aren't stored in plaintext. Records are
+// decrypted when they're loaded, so the key must be set before SetStorage.
+func (r *OpenAIRecorder) SetEncryptionKey(key []byte) error {
+	if len(key) != EncryptionKeySize {
+		return fmt.Errorf("expected a %d-byte key, got %d bytes", EncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.aead = aead
+	return nil
+}
+
+// sealRecord returns the persisted form of a record. The caller must hold
+// r.m.
+func (r *OpenAIRecorder) sealRecord(record *RequestResponsePair) (persistedRecord, error) {
+	if r.aead == nil {
+		return persistedRecord{RequestResponsePair: record}, nil
+	}
+	plaintext, err := json.Marshal(record)
+	if err != nil {
+		return persistedRecord{}, err
+	}
+	nonce := make([]byte, r.aead.NonceSize(), r.aead.NonceSize()+len(plaintext)+r.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return persistedRecord{}, err
+	}
+	// The record ID is authenticated, so sealed bodies can't be swapped
+	// between records.
+	sealed := r.aead.Seal(nonce, nonce, plaintext, []byte(record.ID))
+	return persistedRecord{
+		RequestResponsePair: AnonymizationPolicy{StripBodies: true}.anonymizeRecord(record),
+		Sealed:              base64.StdEncoding.EncodeToString(sealed),
+	}, nil
+}
+
+// openRecord returns the record of its persisted form, decrypting it if
+// needed.
+func (r *OpenAIRecorder) openRecord(persisted persistedRecord) (*RequestResponsePair, error) {
+	if persisted.Sealed == "" {
+		return persisted.RequestResponsePair, nil
+	}
+	if r.aead == nil {
+		return nil, errors.New("record is encrypted, but no encryption key is set")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(persisted.Sealed)
+	if err != nil || len(sealed) < r.aead.NonceSize() {
+		return nil, errors.New("invalid encrypted record")
+	}
+	nonce, ciphertext := sealed[:r.aead.NonceSize()], sealed[r.aead.NonceSize():]
+	plaintext, err := r.aead.Open(nil, nonce, ciphertext, []byte(persisted.ID))
+	if err != nil {
+		return nil, errors.New("decrypting record: wrong encryption key or corrupted record")
+	}
+	var record RequestResponsePair
+	if err := json.Unmarshal(plaintext, &record); err != nil {
+		return nil, fmt.Errorf("unmarshaling decrypted record: %w", err)
+	}
+	return &record, nil
+}
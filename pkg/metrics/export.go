@@ -0,0 +1,268 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportFormat is a format in which recorded conversations are exported.
+type ExportFormat string
+
+const (
+	// ExportFormatMarkdown exports conversations as markdown documents, for
+	// bug reports.
+	ExportFormatMarkdown ExportFormat = "markdown"
+	// ExportFormatShareGPT exports conversations as ShareGPT JSON, for
+	// prompt sharing and datasets.
+	ExportFormatShareGPT ExportFormat = "sharegpt"
+)
+
+// ShareGPTConversation is a conversation in the ShareGPT format.
+type ShareGPTConversation struct {
+	ID            string            `json:"id"`
+	Model         string            `json:"model,omitempty"`
+	Conversations []ShareGPTMessage `json:"conversations"`
+}
+
+// ShareGPTMessage is a message of a ShareGPT conversation.
+type ShareGPTMessage struct {
+	// From is system, human, gpt, function_call, or observation.
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+// conversationTurn is a message of an exported conversation.
+type conversationTurn struct {
+	// from is the ShareGPT role of the message.
+	from    string
+	content string
+}
+
+// markdownHeadings maps ShareGPT roles to markdown headings.
+var markdownHeadings = map[string]string{
+	"system":        "System",
+	"human":         "User",
+	"gpt":           "Assistant",
+	"function_call": "Tool Call",
+	"observation":   "Tool Result",
+}
+
+// exportedMessage is a chat message in a recorded request or response.
+type exportedMessage struct {
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	ToolCalls []struct {
+		Function struct {
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		} `json:"function"`
+	} `json:"tool_calls"`
+}
+
+// turns returns the conversation turns of a message.
+func (m exportedMessage) turns() []conversationTurn {
+	var turns []conversationTurn
+	from := map[string]string{"system": "system", "developer": "system", "user": "human", "assistant": "gpt", "tool": "observation"}[m.Role]
+	if from == "" {
+		from = "human"
+	}
+	if content := contentText(m.Content); content != "" {
+		turns = append(turns, conversationTurn{from: from, content: content})
+	}
+	for _, call := range m.ToolCalls {
+		turns = append(turns, conversationTurn{from: "function_call", content: fmt.Sprintf("%s(%s)", call.Function.Name, call.Function.Arguments)})
+	}
+	return turns
+}
+
+// contentText returns the text of message content, which may be a string or
+// an array of content parts. Media parts are replaced with placeholders.
+func contentText(content json.RawMessage) string {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(content, &parts) != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			texts = append(texts, part.Text)
+		case "image_url":
+			texts = append(texts, "[image]")
+		case "input_audio":
+			texts = append(texts, "[audio]")
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// recordTurns returns the conversation turns of a chat completion or
+// completion record: the request's messages or prompt, followed by the first
+// choice of the response.
+func recordTurns(record *RequestResponsePair) []conversationTurn {
+	var turns []conversationTurn
+	var request struct {
+		Messages []exportedMessage `json:"messages"`
+		Prompt   json.RawMessage   `json:"prompt"`
+	}
+	if json.Unmarshal([]byte(record.Request), &request) == nil {
+		for _, message := range request.Messages {
+			turns = append(turns, message.turns()...)
+		}
+		if prompt := contentText(request.Prompt); prompt != "" {
+			turns = append(turns, conversationTurn{from: "human", content: prompt})
+		}
+	}
+	var response struct {
+		Choices []struct {
+			Message *exportedMessage `json:"message"`
+			Text    string           `json:"text"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal([]byte(record.Response), &response) == nil && len(response.Choices) > 0 {
+		choice := response.Choices[0]
+		if choice.Message != nil {
+			choice.Message.Role = "assistant"
+			turns = append(turns, choice.Message.turns()...)
+		} else if choice.Text != "" {
+			turns = append(turns, conversationTurn{from: "gpt", content: choice.Text})
+		}
+	}
+	return turns
+}
+
+// sessionTurns returns the conversation of the records of a session, in order.
+// Records whose turns extend the conversation so far, as is the case for the
+// turns of a chat, replace it, while other records are appended to it.
+func sessionTurns(records []*RequestResponsePair) []conversationTurn {
+	var conversation []conversationTurn
+	for _, record := range records {
+		turns := recordTurns(record)
+		if len(turns) >= len(conversation) && slices.Equal(turns[:len(conversation)], conversation) {
+			conversation = turns
+		} else {
+			conversation = append(conversation, turns...)
+		}
+	}
+	return conversation
+}
+
+// exportRecords returns anonymized copies of the record with the specified
+// ID, or of the records of the specified session in chronological order.
+// Identifiers hashed by the policy match their hashes.
+func (r *OpenAIRecorder) exportRecords(id, session string, policy AnonymizationPolicy) []*RequestResponsePair {
+	matches := func(value, requested string) bool {
+		return value != "" && (value == requested || (policy.HashIdentifiers && hashIdentifier(value) == requested))
+	}
+
+	r.m.RLock()
+	defer r.m.RUnlock()
+	var records []*RequestResponsePair
+	for _, modelData := range r.records {
+		for _, record := range modelData.Records {
+			if (id != "" && matches(record.ID, id)) || (session != "" && matches(record.Session, session)) {
+				records = append(records, policy.anonymizeRecord(record))
+			}
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp < records[j].Timestamp
+	})
+	return records
+}
+
+// ExportHandler returns a handler that exports the conversation of a single
+// record (the "id" query parameter) or of a session (the "session" query
+// parameter) in the format specified by the "format" query parameter, with
+// sensitive data redacted.
+func (r *OpenAIRecorder) ExportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		id, session := query.Get("id"), query.Get("session")
+		if (id == "") == (session == "") {
+			http.Error(w, "exactly one of id or session is required", http.StatusBadRequest)
+			return
+		}
+		format := ExportFormat(query.Get("format"))
+		if format == "" {
+			format = ExportFormatMarkdown
+		} else if format != ExportFormatMarkdown && format != ExportFormatShareGPT {
+			http.Error(w, fmt.Sprintf("unknown export format %q (supported: %s, %s)", format, ExportFormatMarkdown, ExportFormatShareGPT), http.StatusBadRequest)
+			return
+		}
+		policy, err := r.anonymizationForRequest(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if policy.StripBodies {
+			http.Error(w, "conversations can't be exported when bodies are stripped by the anonymization policy", http.StatusForbidden)
+			return
+		}
+
+		records := r.exportRecords(id, session, policy)
+		if len(records) == 0 {
+			http.Error(w, "no matching records found", http.StatusNotFound)
+			return
+		}
+		turns := sessionTurns(records)
+		if len(turns) == 0 {
+			http.Error(w, "no conversation was recorded", http.StatusUnprocessableEntity)
+			return
+		}
+		for i := range turns {
+			turns[i].content = redactText(turns[i].content)
+		}
+
+		last := records[len(records)-1]
+		exportID := last.ID
+		if session != "" {
+			exportID = last.Session
+		}
+		var models []string
+		for _, record := range records {
+			if !slices.Contains(models, record.Model) {
+				models = append(models, record.Model)
+			}
+		}
+
+		if format == ExportFormatShareGPT {
+			conversation := ShareGPTConversation{ID: exportID, Model: strings.Join(models, ", ")}
+			for _, turn := range turns {
+				conversation.Conversations = append(conversation.Conversations, ShareGPTMessage{From: turn.from, Value: turn.content})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(conversation); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to encode conversation: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		var markdown strings.Builder
+		markdown.WriteString("# Conversation\n\n")
+		if session != "" {
+			fmt.Fprintf(&markdown, "- Session: `%s`\n", exportID)
+		} else {
+			fmt.Fprintf(&markdown, "- Record: `%s`\n", exportID)
+		}
+		fmt.Fprintf(&markdown, "- Model: %s\n", strings.Join(models, ", "))
+		fmt.Fprintf(&markdown, "- Date: %s\n", time.Unix(records[0].Timestamp, 0).UTC().Format(time.RFC3339))
+		for _, turn := range turns {
+			fmt.Fprintf(&markdown, "\n## %s\n\n%s\n", markdownHeadings[turn.from], turn.content)
+		}
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Write([]byte(markdown.String()))
+	}
+}
@@ -0,0 +1,299 @@
+package metrics
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	// timeToFirstTokenBuckets are the upper bounds, in seconds, of the time to
+	// first token histogram buckets.
+	timeToFirstTokenBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	// tokensPerSecondBuckets are the upper bounds of the generation throughput
+	// histogram buckets.
+	tokensPerSecondBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000}
+)
+
+// Histogram is a snapshot of a Prometheus histogram.
+type Histogram struct {
+	// Bounds are the upper bounds of the buckets.
+	Bounds []float64 `json:"bounds"`
+	// Counts are the numbers of observations in each bucket, which aren't
+	// cumulative. Observations above the last bound are only counted by Count.
+	Counts []uint64 `json:"counts"`
+	// Count is the total number of observations.
+	Count uint64 `json:"count"`
+	// Sum is the sum of the observations.
+	Sum float64 `json:"sum"`
+}
+
+// newHistogram creates an empty histogram with the specified bucket bounds.
+func newHistogram(bounds []float64) Histogram {
+	return Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds))}
+}
+
+// observe adds an observation to the histogram.
+func (h *Histogram) observe(value float64) {
+	if i, _ := slices.BinarySearch(h.Bounds, value); i < len(h.Bounds) {
+		h.Counts[i]++
+	}
+	h.Count++
+	h.Sum += value
+}
+
+// clone returns a copy of the histogram.
+func (h Histogram) clone() Histogram {
+	h.Counts = slices.Clone(h.Counts)
+	return h
+}
+
+// InferenceTraffic aggregates the inference requests served by a backend for
+// a model.
+type InferenceTraffic struct {
+	Model   string `json:"model"`
+	Backend string `json:"backend"`
+	// Requests maps response status codes to numbers of requests.
+	Requests map[int]uint64 `json:"requests"`
+	// PromptTokens and CompletionTokens are the token counts reported in
+	// the usage of successful responses.
+	PromptTokens     uint64 `json:"prompt_tokens"`
+	CompletionTokens uint64 `json:"completion_tokens"`
+	// TimeToFirstToken is the time from the request's arrival to the first
+	// streamed chunk of its response, in seconds, for streamed responses.
+	TimeToFirstToken Histogram `json:"time_to_first_token"`
+	// TokensPerSecond is the generation throughput of successful responses,
+	// i.e. their completion tokens over the time from when they were
+	// forwarded to the runner until they were written.
+	TokensPerSecond Histogram `json:"tokens_per_second"`
+	// Queued is the number of requests waiting for a runner.
+	Queued int64 `json:"queued"`
+}
+
+// inferenceKey identifies an inference traffic aggregate.
+type inferenceKey struct {
+	model   string
+	backend string
+}
+
+// InferenceStats aggregates inference traffic by model and backend.
+type InferenceStats struct {
+	// m protects the fields below.
+	m sync.Mutex
+	// models is the set of tracked models.
+	models map[string]struct{}
+	// traffic maps models and backends to their traffic.
+	traffic map[inferenceKey]*InferenceTraffic
+}
+
+// NewInferenceStats creates a new inference traffic aggregator.
+func NewInferenceStats() *InferenceStats {
+	return &InferenceStats{
+		models:  make(map[string]struct{}),
+		traffic: make(map[inferenceKey]*InferenceTraffic),
+	}
+}
+
+// trafficFor returns the traffic aggregate of a model and backend, creating
+// it if necessary. The caller must hold the lock.
+func (s *InferenceStats) trafficFor(backend, model string) *InferenceTraffic {
+	key := inferenceKey{model: admitLabel(s.models, model, maxUsageModels), backend: backend}
+	traffic, ok := s.traffic[key]
+	if !ok {
+		traffic = &InferenceTraffic{
+			Model:            key.model,
+			Backend:          backend,
+			Requests:         make(map[int]uint64),
+			TimeToFirstToken: newHistogram(timeToFirstTokenBuckets),
+			TokensPerSecond:  newHistogram(tokensPerSecondBuckets),
+		}
+		s.traffic[key] = traffic
+	}
+	return traffic
+}
+
+// Enqueue records a request to a model waiting for a runner of a backend. The
+// returned function must be called once the request stops waiting.
+func (s *InferenceStats) Enqueue(backend, model string) func() {
+	s.m.Lock()
+	traffic := s.trafficFor(backend, model)
+	traffic.Queued++
+	s.m.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.m.Lock()
+			traffic.Queued--
+			s.m.Unlock()
+		})
+	}
+}
+
+// Record records a request to a model served by a backend, which arrived at
+// start, along with its response, written to a response writer created by
+// NewResponseRecorder.
+func (s *InferenceStats) Record(backend, model string, start time.Time, rw http.ResponseWriter) {
+	rr, ok := rw.(*responseRecorder)
+	if !ok {
+		return
+	}
+	statusCode := ResponseStatusCode(rw)
+	streaming := isStreamingResponse(rr.body.Bytes())
+	var usage tokenUsage
+	if statusCode < http.StatusBadRequest {
+		usage = responseUsage(rw)
+	}
+	elapsed := time.Since(rr.start)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	traffic := s.trafficFor(backend, model)
+	traffic.Requests[statusCode]++
+	if streaming && !rr.firstWrite.IsZero() {
+		traffic.TimeToFirstToken.observe(rr.firstWrite.Sub(start).Seconds())
+	}
+	if usage.PromptTokens > 0 {
+		traffic.PromptTokens += uint64(usage.PromptTokens)
+	}
+	if usage.CompletionTokens > 0 {
+		traffic.CompletionTokens += uint64(usage.CompletionTokens)
+		if elapsed > 0 {
+			traffic.TokensPerSecond.observe(float64(usage.CompletionTokens) / elapsed.Seconds())
+		}
+	}
+}
+
+// Traffic returns the traffic aggregates, ordered by model and backend.
+func (s *InferenceStats) Traffic() []InferenceTraffic {
+	s.m.Lock()
+	result := make([]InferenceTraffic, 0, len(s.traffic))
+	for _, traffic := range s.traffic {
+		snapshot := *traffic
+		snapshot.Requests = make(map[int]uint64, len(traffic.Requests))
+		for code, count := range traffic.Requests {
+			snapshot.Requests[code] = count
+		}
+		snapshot.TimeToFirstToken = traffic.TimeToFirstToken.clone()
+		snapshot.TokensPerSecond = traffic.TokensPerSecond.clone()
+		result = append(result, snapshot)
+	}
+	s.m.Unlock()
+
+	slices.SortFunc(result, func(a, b InferenceTraffic) int {
+		return cmp.Or(cmp.Compare(a.Model, b.Model), cmp.Compare(a.Backend, b.Backend))
+	})
+	return result
+}
+
+// inferenceMetricFamilies returns Prometheus metric families for the
+// specified inference traffic aggregates and active runners.
+func inferenceMetricFamilies(traffic []InferenceTraffic, runners []ActiveRunner) map[string]*dto.MetricFamily {
+	if len(traffic) == 0 && len(runners) == 0 {
+		return nil
+	}
+	counterType, gaugeType, histogramType := dto.MetricType_COUNTER, dto.MetricType_GAUGE, dto.MetricType_HISTOGRAM
+	families := make(map[string]*dto.MetricFamily, 7)
+	family := func(name, help string, metricType *dto.MetricType) *dto.MetricFamily {
+		metricFamily := &dto.MetricFamily{Name: &name, Help: &help, Type: metricType}
+		families[name] = metricFamily
+		return metricFamily
+	}
+	labels := func(pairs ...string) []*dto.LabelPair {
+		result := make([]*dto.LabelPair, 0, len(pairs)/2)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			result = append(result, &dto.LabelPair{Name: &pairs[i], Value: &pairs[i+1]})
+		}
+		return result
+	}
+	value := func(value float64) *float64 { return &value }
+
+	if len(traffic) > 0 {
+		requests := family("model_runner_inference_requests_total",
+			"Number of inference requests by model, backend, and response status code.", &counterType)
+		promptTokens := family("model_runner_inference_prompt_tokens_total",
+			"Number of prompt tokens reported by successful inference responses, by model and backend.", &counterType)
+		completionTokens := family("model_runner_inference_completion_tokens_total",
+			"Number of completion tokens reported by successful inference responses, by model and backend.", &counterType)
+		timeToFirstToken := family("model_runner_inference_time_to_first_token_seconds",
+			"Time from the arrival of streamed inference requests to their first chunk, by model and backend.", &histogramType)
+		tokensPerSecond := family("model_runner_inference_tokens_per_second",
+			"Completion tokens generated per second by successful inference requests, by model and backend.", &histogramType)
+		queueDepth := family("model_runner_inference_queue_depth",
+			"Number of inference requests waiting for a runner, by model and backend.", &gaugeType)
+		for _, entry := range traffic {
+			codes := make([]int, 0, len(entry.Requests))
+			for code := range entry.Requests {
+				codes = append(codes, code)
+			}
+			slices.Sort(codes)
+			for _, code := range codes {
+				requests.Metric = append(requests.Metric, &dto.Metric{
+					Label:   labels("model", entry.Model, "backend", entry.Backend, "code", strconv.Itoa(code)),
+					Counter: &dto.Counter{Value: value(float64(entry.Requests[code]))},
+				})
+			}
+			promptTokens.Metric = append(promptTokens.Metric, &dto.Metric{
+				Label:   labels("model", entry.Model, "backend", entry.Backend),
+				Counter: &dto.Counter{Value: value(float64(entry.PromptTokens))},
+			})
+			completionTokens.Metric = append(completionTokens.Metric, &dto.Metric{
+				Label:   labels("model", entry.Model, "backend", entry.Backend),
+				Counter: &dto.Counter{Value: value(float64(entry.CompletionTokens))},
+			})
+			timeToFirstToken.Metric = append(timeToFirstToken.Metric, &dto.Metric{
+				Label:     labels("model", entry.Model, "backend", entry.Backend),
+				Histogram: histogramMetric(entry.TimeToFirstToken),
+			})
+			tokensPerSecond.Metric = append(tokensPerSecond.Metric, &dto.Metric{
+				Label:     labels("model", entry.Model, "backend", entry.Backend),
+				Histogram: histogramMetric(entry.TokensPerSecond),
+			})
+			queueDepth.Metric = append(queueDepth.Metric, &dto.Metric{
+				Label: labels("model", entry.Model, "backend", entry.Backend),
+				Gauge: &dto.Gauge{Value: value(float64(entry.Queued))},
+			})
+		}
+	}
+
+	if len(runners) > 0 {
+		activeRunners := family("model_runner_active_runners",
+			"Number of active runners by model, backend, and mode.", &gaugeType)
+		type runnerKey struct{ model, backend, mode string }
+		counts := make(map[runnerKey]int)
+		var keys []runnerKey
+		for _, runner := range runners {
+			key := runnerKey{model: runner.ModelName, backend: runner.BackendName, mode: runner.Mode}
+			if counts[key] == 0 {
+				keys = append(keys, key)
+			}
+			counts[key]++
+		}
+		for _, key := range keys {
+			activeRunners.Metric = append(activeRunners.Metric, &dto.Metric{
+				Label: labels("model", key.model, "backend", key.backend, "mode", key.mode),
+				Gauge: &dto.Gauge{Value: value(float64(counts[key]))},
+			})
+		}
+	}
+	return families
+}
+
+// histogramMetric converts a histogram snapshot to a Prometheus histogram.
+func histogramMetric(histogram Histogram) *dto.Histogram {
+	count, sum := histogram.Count, histogram.Sum
+	metric := &dto.Histogram{SampleCount: &count, SampleSum: &sum}
+	var cumulative uint64
+	for i, bound := range histogram.Bounds {
+		cumulative += histogram.Counts[i]
+		bucketCount := cumulative
+		metric.Bucket = append(metric.Bucket, &dto.Bucket{CumulativeCount: &bucketCount, UpperBound: &bound})
+	}
+	return metric
+}
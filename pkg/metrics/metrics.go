@@ -21,6 +21,10 @@ type Tracker struct {
 	transport  http.RoundTripper
 	log        logging.Logger
 	userAgent  string
+
+	// hashUserAgents indicates that client user agents are hashed before
+	// they're sent.
+	hashUserAgents bool
 }
 
 type TrackerRoundTripper struct {
@@ -80,6 +84,9 @@ func (t *Tracker) trackModel(model types.Model, userAgent, action string) {
 	}
 	parts := []string{t.userAgent}
 	if userAgent != "" {
+		if t.hashUserAgents {
+			userAgent = hashIdentifier(userAgent)
+		}
 		parts = append(parts, userAgent)
 	}
 	if action != "" {
@@ -2,22 +2,31 @@ package metrics
 
 import (
 	"bytes"
+	"crypto/cipher"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/jailbreak"
 	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/inference/retrieval"
+	"github.com/docker/model-runner/pkg/internal/utils"
 	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+	"github.com/docker/model-runner/pkg/storage"
 )
 
-// maximumRecordsPerModel is the maximum number of records that will be stored
-// per model.
-const maximumRecordsPerModel = 10
+// defaultMaxRecordsPerModel is the maximum number of records that will be
+// stored per model unless the retention policy sets another limit.
+const defaultMaxRecordsPerModel = 10
 
 // subscriberChannelBuffer is the buffer size for subscriber channels.
 const subscriberChannelBuffer = 100
@@ -54,9 +63,17 @@ type responseRecorder struct {
 	http.ResponseWriter
 	body       *bytes.Buffer
 	statusCode int
+	// start is when the recorder was created, i.e. when the request was
+	// forwarded to the runner.
+	start time.Time
+	// firstWrite is when the first part of the response body was written.
+	firstWrite time.Time
 }
 
 func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.firstWrite.IsZero() {
+		rr.firstWrite = time.Now()
+	}
 	rr.body.Write(b)
 	return rr.ResponseWriter.Write(b)
 }
@@ -83,6 +100,149 @@ type RequestResponsePair struct {
 	Timestamp  int64  `json:"timestamp"`
 	StatusCode int    `json:"status_code"`
 	UserAgent  string `json:"user_agent,omitempty"`
+	// ClientAddress is the address of the client, as forwarded by trusted
+	// reverse proxies.
+	ClientAddress string `json:"client_address,omitempty"`
+	// Session is the ID of the session to which the request belongs, if the
+	// client specified one.
+	Session string `json:"session,omitempty"`
+	// Pipeline links the requests of a pipeline run.
+	Pipeline *PipelineRecord `json:"pipeline,omitempty"`
+
+	Resources      *ResourceSnapshot     `json:"resources,omitempty"`
+	Retrieval      *RetrievalRecord      `json:"retrieval,omitempty"`
+	PromptTemplate *PromptTemplateRecord `json:"prompt_template,omitempty"`
+	// PostProcessors are the post-processors applied to the response before
+	// it was returned. Response is the original, unprocessed output.
+	PostProcessors []inference.PostProcessor `json:"post_processors,omitempty"`
+	SystemPrompt   *SystemPromptRecord       `json:"system_prompt,omitempty"`
+	// Embeddings describes the batch of an embeddings request.
+	Embeddings *EmbeddingsRecord `json:"embeddings,omitempty"`
+	// Jailbreak is the jailbreak score of the request's prompt, if it was
+	// scored.
+	Jailbreak *JailbreakRecord `json:"jailbreak,omitempty"`
+	// BusySeconds is the runner busy time attributable to the request,
+	// excluding the time it was queued.
+	BusySeconds float64 `json:"busy_seconds,omitempty"`
+	// BestOf describes the best_of selection in which the request's response
+	// was selected, if any.
+	BestOf *BestOfRecord `json:"best_of,omitempty"`
+	// Usage is the token usage reported by the response, if any.
+	Usage *TokenCounts `json:"usage,omitempty"`
+}
+
+// BestOfRecord records how a response was selected among the candidates
+// generated for a best_of request. Each candidate is recorded as a separate
+// request.
+type BestOfRecord struct {
+	// Candidates is the number of candidates generated.
+	Candidates int `json:"candidates"`
+	// Selection is how the candidate was selected: logprob or judge.
+	Selection string `json:"selection"`
+	// Judge is the judge model, if the candidate was selected by a judge.
+	Judge string `json:"judge,omitempty"`
+	// Rank is the 1-based rank of the candidate among the candidates.
+	Rank int `json:"rank"`
+	// Discarded are the contents of the discarded candidates, if the client
+	// requested that they be stored.
+	Discarded []string `json:"discarded,omitempty"`
+}
+
+// withoutBodies returns a copy of the record without the contents of the
+// discarded candidates.
+func (br *BestOfRecord) withoutBodies() *BestOfRecord {
+	return &BestOfRecord{Candidates: br.Candidates, Selection: br.Selection, Judge: br.Judge, Rank: br.Rank}
+}
+
+// PipelineRecord records the pipeline run and step on whose behalf a request
+// was made.
+type PipelineRecord struct {
+	RunID string `json:"run_id"`
+	Step  string `json:"step"`
+}
+
+// SystemPromptRecord records how a model's server-side system prompt was
+// applied to a request. The resulting messages are sent upstream, while
+// Request is the client's original request.
+type SystemPromptRecord struct {
+	Mode   inference.SystemPromptMode   `json:"mode"`
+	Policy inference.SystemPromptPolicy `json:"policy,omitempty"`
+	// Decision is how the system prompt was applied: injected, merged,
+	// overridden, client-provided, opted-out, or not-opted-in.
+	Decision string `json:"decision"`
+	// OptOutDenied is set if the client opted out of a mandatory system
+	// prompt.
+	OptOutDenied bool `json:"opt_out_denied,omitempty"`
+}
+
+// EmbeddingsRecord records the batch of an embeddings request.
+type EmbeddingsRecord struct {
+	// Inputs is the number of inputs embedded by the request.
+	Inputs int `json:"inputs"`
+	// Dimensions is the number of dimensions to which the embeddings were
+	// truncated, if any.
+	Dimensions int `json:"dimensions,omitempty"`
+	// Format is the encoding format of the embeddings.
+	Format string `json:"format,omitempty"`
+}
+
+// JailbreakRecord records the score of a request's prompt for prompt
+// injection and jailbreak attempts.
+type JailbreakRecord struct {
+	// Score is the likelihood, between 0 and 1, that the prompt is a
+	// jailbreak attempt.
+	Score float64 `json:"score"`
+	// Categories are the categories of the heuristics that matched the
+	// prompt.
+	Categories []jailbreak.Category `json:"categories,omitempty"`
+	// Flagged is set if the score reached the jailbreak policy's threshold
+	// and the policy flags or blocks such requests.
+	Flagged bool `json:"flagged,omitempty"`
+}
+
+// RetrievalRecord records the retrieval performed for a retrieval-augmented
+// request, so that the sources a response was grounded in can be audited.
+type RetrievalRecord struct {
+	// VectorStoreID is the ID of the vector store that was searched.
+	VectorStoreID string `json:"vector_store_id"`
+	// Query is the text that was searched for.
+	Query string `json:"query,omitempty"`
+	// Citations are the chunks that were injected into the prompt.
+	Citations []retrieval.Citation `json:"citations"`
+	// Request is the augmented request body that was sent to the backend.
+	Request string `json:"request,omitempty"`
+}
+
+// withoutBodies returns a copy of the record without the query, the augmented
+// request, or the text of its citations.
+func (rr *RetrievalRecord) withoutBodies() *RetrievalRecord {
+	stripped := &RetrievalRecord{
+		VectorStoreID: rr.VectorStoreID,
+		Citations:     make([]retrieval.Citation, len(rr.Citations)),
+	}
+	for i, citation := range rr.Citations {
+		citation.Text = ""
+		stripped.Citations[i] = citation
+	}
+	return stripped
+}
+
+// PromptTemplateRecord records the prompt template that a request referenced.
+// The rendered prompt is part of the recorded request body.
+type PromptTemplateRecord struct {
+	// ID is the ID of the template.
+	ID string `json:"id"`
+	// Name is the template's name at the time of the request.
+	Name string `json:"name"`
+	// Version is the template's version at the time of the request.
+	Version int `json:"version"`
+	// Variables are the variables the request specified.
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// withoutBodies returns a copy of the record without its variables.
+func (pr *PromptTemplateRecord) withoutBodies() *PromptTemplateRecord {
+	return &PromptTemplateRecord{ID: pr.ID, Name: pr.Name, Version: pr.Version}
 }
 
 type ModelData struct {
@@ -91,17 +251,50 @@ type ModelData struct {
 }
 
 type ModelRecordsResponse struct {
-	Count int    `json:"count"`
+	Count int `json:"count"`
+	// Total is the number of records matching the query, of which Count are
+	// returned, if the records are paginated.
+	Total int    `json:"total,omitempty"`
 	Model string `json:"model"`
 	ModelData
 }
 
+// ClearRecordsResponse reports the number of records removed by a bulk delete.
+type ClearRecordsResponse struct {
+	Deleted int `json:"deleted"`
+}
+
 type OpenAIRecorder struct {
 	log          logging.Logger
 	records      map[string]*ModelData // key is model ID
 	modelManager *models.Manager       // for resolving model tags to IDs
 	m            sync.RWMutex
 
+	// retention
+	retention         RetentionPolicy
+	excludeBodyModels map[string]struct{}
+	verbosity         RecordingVerbosity
+
+	// anonymization
+	anonymization AnonymizationPolicy
+
+	// resource snapshots
+	snapshotFunc ResourceSnapshotFunc
+
+	// persistence
+	storage storage.KV
+	aead    cipher.AEAD
+	// recordSizes are the sizes in bytes of the persisted records by ID, and
+	// recordsSize their total, which is limited by the retention policy.
+	recordSizes map[string]int64
+	recordsSize int64
+
+	// audit log of persisted records
+	audit         bool
+	auditKey      ed25519.PrivateKey
+	auditSequence uint64
+	auditHead     string
+
 	// streaming
 	subscribers map[string]chan []ModelRecordsResponse
 	subMutex    sync.RWMutex
@@ -112,6 +305,7 @@ func NewOpenAIRecorder(log logging.Logger, modelManager *models.Manager) *OpenAI
 		log:          log,
 		modelManager: modelManager,
 		records:      make(map[string]*ModelData),
+		recordSizes:  make(map[string]int64),
 		subscribers:  make(map[string]chan []ModelRecordsResponse),
 	}
 }
@@ -221,30 +415,48 @@ func (r *OpenAIRecorder) SetConfigForModel(model string, config *inference.Backe
 	}
 
 	r.records[modelID].Config = *config
+	r.persistConfig(modelID, *config)
 }
 
 func (r *OpenAIRecorder) RecordRequest(model string, req *http.Request, body []byte) string {
 	modelID := r.modelManager.ResolveID(model)
 
+	// Capture the resource snapshot (if enabled) outside of the lock.
+	r.m.RLock()
+	snapshotFunc := r.snapshotFunc
+	r.m.RUnlock()
+	var snapshot *ResourceSnapshot
+	if snapshotFunc != nil {
+		snapshot = snapshotFunc()
+	}
+
 	r.m.Lock()
 	defer r.m.Unlock()
 
 	recordID := fmt.Sprintf("%s_%d", modelID, time.Now().UnixNano())
 
 	record := &RequestResponsePair{
-		ID:        recordID,
-		Model:     model,
-		Method:    req.Method,
-		URL:       req.URL.Path,
-		Request:   string(r.truncateMediaFields(body)),
-		Timestamp: time.Now().Unix(),
-		UserAgent: req.UserAgent(),
+		ID:            recordID,
+		Model:         model,
+		Method:        req.Method,
+		URL:           req.URL.Path,
+		Timestamp:     time.Now().Unix(),
+		UserAgent:     req.UserAgent(),
+		ClientAddress: middleware.ClientAddress(req),
+		Session:       req.Header.Get(inference.SessionIDHeader),
+		Resources:     snapshot,
+	}
+	if runID := req.Header.Get(inference.PipelineIDHeader); runID != "" {
+		record.Pipeline = &PipelineRecord{RunID: runID, Step: req.Header.Get(inference.PipelineStepHeader)}
+	}
+	if r.shouldStoreBodies(model, modelID) {
+		record.Request = string(r.truncateMediaFields(body))
 	}
 
 	modelData := r.records[modelID]
 	if modelData == nil {
 		modelData = &ModelData{
-			Records: make([]*RequestResponsePair, 0, maximumRecordsPerModel),
+			Records: make([]*RequestResponsePair, 0, defaultMaxRecordsPerModel),
 			Config:  inference.BackendConfiguration{},
 		}
 		r.records[modelID] = modelData
@@ -255,24 +467,192 @@ func (r *OpenAIRecorder) RecordRequest(model string, req *http.Request, body []b
 	// slightly inefficieny memory shuffle. Note that truncating the front of
 	// the slice and continually appending would cause the slice's capacity to
 	// grow unbounded.
-	if len(modelData.Records) == maximumRecordsPerModel {
-		copy(
-			modelData.Records[:maximumRecordsPerModel-1],
-			modelData.Records[1:],
-		)
-		modelData.Records[maximumRecordsPerModel-1] = record
-	} else {
-		modelData.Records = append(modelData.Records, record)
-	}
+	r.dropOldestRecords(modelData, r.maxRecordsPerModel()-1)
+	modelData.Records = append(modelData.Records, record)
+	r.persistRecord(record)
+	r.enforceMaxSize()
 
 	return recordID
 }
 
+// RecordRetrieval attaches the retrieval performed for a request to its record.
+func (r *OpenAIRecorder) RecordRetrieval(id, model string, retrievalRecord RetrievalRecord) {
+	modelID := r.modelManager.ResolveID(model)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	modelData, exists := r.records[modelID]
+	if !exists {
+		return
+	}
+	for _, record := range modelData.Records {
+		if record.ID == id {
+			if r.shouldStoreBodies(model, modelID) {
+				record.Retrieval = &retrievalRecord
+			} else {
+				record.Retrieval = retrievalRecord.withoutBodies()
+			}
+			return
+		}
+	}
+}
+
+// RecordPromptTemplate attaches the prompt template referenced by a request to
+// its record.
+func (r *OpenAIRecorder) RecordPromptTemplate(id, model string, templateRecord PromptTemplateRecord) {
+	modelID := r.modelManager.ResolveID(model)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	modelData, exists := r.records[modelID]
+	if !exists {
+		return
+	}
+	for _, record := range modelData.Records {
+		if record.ID == id {
+			if r.shouldStoreBodies(model, modelID) {
+				record.PromptTemplate = &templateRecord
+			} else {
+				record.PromptTemplate = templateRecord.withoutBodies()
+			}
+			return
+		}
+	}
+}
+
+// RecordPostProcessors notes the post-processors applied to the response to a
+// request in its record.
+func (r *OpenAIRecorder) RecordPostProcessors(id, model string, processors []inference.PostProcessor) {
+	modelID := r.modelManager.ResolveID(model)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	modelData, exists := r.records[modelID]
+	if !exists {
+		return
+	}
+	for _, record := range modelData.Records {
+		if record.ID == id {
+			record.PostProcessors = processors
+			return
+		}
+	}
+}
+
+// RecordSystemPrompt notes how a model's system prompt was applied to a
+// request in its record.
+func (r *OpenAIRecorder) RecordSystemPrompt(id, model string, systemPromptRecord SystemPromptRecord) {
+	modelID := r.modelManager.ResolveID(model)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	modelData, exists := r.records[modelID]
+	if !exists {
+		return
+	}
+	for _, record := range modelData.Records {
+		if record.ID == id {
+			record.SystemPrompt = &systemPromptRecord
+			return
+		}
+	}
+}
+
+// RecordEmbeddings notes the batch of an embeddings request in its record.
+func (r *OpenAIRecorder) RecordEmbeddings(id, model string, embeddingsRecord EmbeddingsRecord) {
+	modelID := r.modelManager.ResolveID(model)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	modelData, exists := r.records[modelID]
+	if !exists {
+		return
+	}
+	for _, record := range modelData.Records {
+		if record.ID == id {
+			record.Embeddings = &embeddingsRecord
+			return
+		}
+	}
+}
+
+// RecordJailbreak notes the jailbreak score of a request's prompt in its
+// record.
+func (r *OpenAIRecorder) RecordJailbreak(id, model string, jailbreakRecord JailbreakRecord) {
+	modelID := r.modelManager.ResolveID(model)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	modelData, exists := r.records[modelID]
+	if !exists {
+		return
+	}
+	for _, record := range modelData.Records {
+		if record.ID == id {
+			record.Jailbreak = &jailbreakRecord
+			return
+		}
+	}
+}
+
+// RecordBusyTime notes the runner busy time attributable to a request in its
+// record. It must be called before RecordResponse to be persisted.
+func (r *OpenAIRecorder) RecordBusyTime(id, model string, busy time.Duration) {
+	modelID := r.modelManager.ResolveID(model)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	modelData, exists := r.records[modelID]
+	if !exists {
+		return
+	}
+	for _, record := range modelData.Records {
+		if record.ID == id {
+			record.BusySeconds = busy.Seconds()
+			return
+		}
+	}
+}
+
+// RecordBestOf notes how a request's response was selected by a best_of
+// request in its record. Discarded candidates are only stored if request
+// bodies are stored for the model.
+func (r *OpenAIRecorder) RecordBestOf(id, model string, bestOfRecord BestOfRecord) {
+	modelID := r.modelManager.ResolveID(model)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	modelData, exists := r.records[modelID]
+	if !exists {
+		return
+	}
+	for _, record := range modelData.Records {
+		if record.ID == id {
+			if !r.shouldStoreBodies(model, modelID) {
+				bestOfRecord.Discarded = nil
+			}
+			record.BestOf = &bestOfRecord
+			r.persistRecord(record)
+			r.enforceMaxSize()
+			return
+		}
+	}
+}
+
 func (r *OpenAIRecorder) NewResponseRecorder(w http.ResponseWriter) http.ResponseWriter {
 	rc := &responseRecorder{
 		ResponseWriter: w,
 		body:           &bytes.Buffer{},
 		statusCode:     0,
+		start:          time.Now(),
 	}
 	return rc
 }
@@ -336,15 +716,123 @@ func (r *OpenAIRecorder) serializeStreamingError(err error) string {
 	return r.normalizeErrorToJSON(err.Error())
 }
 
+// ResponseStatusCode returns the status code written to a response writer
+// created by NewResponseRecorder.
+func ResponseStatusCode(rw http.ResponseWriter) int {
+	if rr, ok := rw.(*responseRecorder); ok && rr.statusCode != 0 {
+		return rr.statusCode
+	}
+	// No status code was written (request canceled or failed before response).
+	return http.StatusRequestTimeout
+}
+
+// tokenUsage is the token usage reported in OpenAI responses.
+type tokenUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+	// PromptTokensDetails reports the prompt tokens served from the cache.
+	PromptTokensDetails *struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details,omitempty"`
+	// CachedTokens is the number of prompt tokens served from the cache, from
+	// PromptTokensDetails or llama.cpp's timings.
+	CachedTokens int64 `json:"-"`
+}
+
+// total returns the total number of tokens.
+func (u tokenUsage) total() int64 {
+	if u.TotalTokens > 0 {
+		return u.TotalTokens
+	}
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// ResponseTokens returns the number of tokens reported in the usage of a
+// response written to a response writer created by NewResponseRecorder. For
+// streaming responses, it's the usage of the last chunk that reports one.
+func ResponseTokens(rw http.ResponseWriter) int64 {
+	return responseUsage(rw).total()
+}
+
+// TokenCounts are the token counts reported in the usage of a response.
+type TokenCounts struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// ResponseUsage returns the token counts reported in the usage of a response
+// written to a response writer created by NewResponseRecorder, and whether
+// any were. For streaming responses, they're those of the last chunk that
+// reports a usage.
+func ResponseUsage(rw http.ResponseWriter) (TokenCounts, bool) {
+	usage := responseUsage(rw)
+	if usage.total() <= 0 {
+		return TokenCounts{}, false
+	}
+	return TokenCounts{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.total(),
+	}, true
+}
+
+// responseUsage returns the token usage reported in a response written to a
+// response writer created by NewResponseRecorder, which is empty if none was
+// reported. For streaming responses, it's the usage of the last chunk that
+// reports one.
+func responseUsage(rw http.ResponseWriter) tokenUsage {
+	rr, ok := rw.(*responseRecorder)
+	if !ok {
+		return tokenUsage{}
+	}
+	usage := func(data []byte) tokenUsage {
+		var response struct {
+			Usage *tokenUsage `json:"usage"`
+			// Timings are reported by llama.cpp along with the usage.
+			Timings *struct {
+				CacheN int64 `json:"cache_n"`
+			} `json:"timings"`
+		}
+		if json.Unmarshal(data, &response) != nil || response.Usage == nil {
+			return tokenUsage{}
+		}
+		usage := *response.Usage
+		if usage.PromptTokensDetails != nil {
+			usage.CachedTokens = usage.PromptTokensDetails.CachedTokens
+		} else if response.Timings != nil {
+			usage.CachedTokens = response.Timings.CacheN
+		}
+		return usage
+	}
+
+	body := rr.body.Bytes()
+	if !isStreamingResponse(body) {
+		return usage(body)
+	}
+	lines := bytes.Split(body, []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if data, ok := bytes.CutPrefix(lines[i], []byte("data: ")); ok {
+			if chunkUsage := usage(data); chunkUsage.total() > 0 {
+				return chunkUsage
+			}
+		}
+	}
+	return tokenUsage{}
+}
+
+// isStreamingResponse returns whether a response body is streamed as
+// server-sent events.
+func isStreamingResponse(body []byte) bool {
+	return bytes.Contains(body, []byte("data: "))
+}
+
 func (r *OpenAIRecorder) RecordResponse(id, model string, rw http.ResponseWriter) {
 	rr := rw.(*responseRecorder)
 
 	responseBody := rr.body.String()
-	statusCode := rr.statusCode
-	if statusCode == 0 {
-		// No status code was written (request canceled or failed before response).
-		statusCode = http.StatusRequestTimeout
-	}
+	statusCode := ResponseStatusCode(rw)
 
 	var response string
 	var streamingErr error
@@ -363,7 +851,17 @@ func (r *OpenAIRecorder) RecordResponse(id, model string, rw http.ResponseWriter
 		for _, record := range modelData.Records {
 			if record.ID == id {
 				record.StatusCode = statusCode
+				if usage, ok := ResponseUsage(rw); ok {
+					record.Usage = &usage
+				}
 				r.handleErrorRecording(record, streamingErr, response, statusCode)
+				if !r.shouldStoreBodies(model, modelID) {
+					record.Response = ""
+				} else if r.retention.StripReasoning && record.Response != "" {
+					record.Response = stripReasoningContent(record.Response)
+				}
+				r.persistRecord(record)
+				r.enforceMaxSize()
 				// Create ModelRecordsResponse with this single updated record to match
 				// what the non-streaming endpoint returns - []ModelRecordsResponse.
 				// See getAllRecords and getRecordsByModel.
@@ -520,13 +1018,25 @@ func (r *OpenAIRecorder) GetRecordsHandler() http.HandlerFunc {
 }
 
 func (r *OpenAIRecorder) handleJSONRequests(w http.ResponseWriter, req *http.Request) {
+	anonymization, err := r.anonymizationForRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
 	model := req.URL.Query().Get("model")
+	pipeline := req.URL.Query().Get("pipeline")
+	query, err := parseRecordsQuery(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if model == "" {
 		// Retrieve all records for all models.
-		allRecords := r.getAllRecords()
+		allRecords := anonymization.anonymizeRecords(query.apply(filterPipelineRecords(r.getAllRecords(), pipeline)))
 		if allRecords == nil {
 			allRecords = []ModelRecordsResponse{}
 		}
@@ -537,7 +1047,7 @@ func (r *OpenAIRecorder) handleJSONRequests(w http.ResponseWriter, req *http.Req
 		}
 	} else {
 		// Retrieve records for the specified model.
-		records := r.getRecordsByModel(model)
+		records := anonymization.anonymizeRecords(query.apply(filterPipelineRecords(r.getRecordsByModel(model), pipeline)))
 		if records == nil {
 			records = []ModelRecordsResponse{}
 		}
@@ -550,6 +1060,12 @@ func (r *OpenAIRecorder) handleJSONRequests(w http.ResponseWriter, req *http.Req
 }
 
 func (r *OpenAIRecorder) handleStreamingRequests(w http.ResponseWriter, req *http.Request) {
+	anonymization, err := r.anonymizationForRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Set SSE headers.
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -575,7 +1091,7 @@ func (r *OpenAIRecorder) handleStreamingRequests(w http.ResponseWriter, req *htt
 	// Optional: Send existing records first.
 	model := req.URL.Query().Get("model")
 	if includeExisting := req.URL.Query().Get("include_existing"); includeExisting == "true" {
-		r.sendExistingRecords(w, model)
+		r.sendExistingRecords(w, model, anonymization)
 	}
 
 	flusher, ok := w.(http.Flusher)
@@ -605,7 +1121,7 @@ func (r *OpenAIRecorder) handleStreamingRequests(w http.ResponseWriter, req *htt
 			}
 
 			// Send as SSE event.
-			jsonData, err := json.Marshal(modelRecords)
+			jsonData, err := json.Marshal(anonymization.anonymizeRecords(modelRecords))
 			if err != nil {
 				r.log.Errorf("Failed to marshal record for streaming: %v", err)
 				errorMsg := fmt.Sprintf(`{"error": "Failed to marshal record: %v"}`, err)
@@ -652,6 +1168,120 @@ func (r *OpenAIRecorder) getAllRecords() []ModelRecordsResponse {
 	return result
 }
 
+// filterPipelineRecords returns the records of a pipeline run, omitting models
+// without any, or all records if runID is empty.
+func filterPipelineRecords(responses []ModelRecordsResponse, runID string) []ModelRecordsResponse {
+	if runID == "" {
+		return responses
+	}
+	var filtered []ModelRecordsResponse
+	for _, response := range responses {
+		var records []*RequestResponsePair
+		for _, record := range response.Records {
+			if record.Pipeline != nil && record.Pipeline.RunID == runID {
+				records = append(records, record)
+			}
+		}
+		if len(records) > 0 {
+			response.Count = len(records)
+			response.Records = records
+			filtered = append(filtered, response)
+		}
+	}
+	return filtered
+}
+
+// recordsQuery selects a time range of the records of each model and a page
+// of those.
+type recordsQuery struct {
+	// since and until bound the timestamps of the records, if non-zero.
+	since, until int64
+	// limit is the maximum number of records returned per model, the most
+	// recent first, or zero for no limit.
+	limit int
+	// offset is the number of most recent records skipped per model.
+	offset int
+}
+
+// parseRecordsQuery parses the since, until, limit, and offset query
+// parameters. Times are RFC 3339 timestamps or Unix times in seconds.
+func parseRecordsQuery(values url.Values) (recordsQuery, error) {
+	var query recordsQuery
+	parseTime := func(name string) (int64, error) {
+		value := values.Get(name)
+		if value == "" {
+			return 0, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t.Unix(), nil
+		}
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: expected an RFC 3339 timestamp or Unix time", name, value)
+		}
+		return seconds, nil
+	}
+	parseCount := func(name string) (int, error) {
+		value := values.Get(name)
+		if value == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid %s %q: expected a non-negative integer", name, value)
+		}
+		return n, nil
+	}
+	var err error
+	if query.since, err = parseTime("since"); err != nil {
+		return recordsQuery{}, err
+	}
+	if query.until, err = parseTime("until"); err != nil {
+		return recordsQuery{}, err
+	}
+	if query.limit, err = parseCount("limit"); err != nil {
+		return recordsQuery{}, err
+	}
+	if query.offset, err = parseCount("offset"); err != nil {
+		return recordsQuery{}, err
+	}
+	return query, nil
+}
+
+// apply returns the records selected by the query, omitting models without
+// any if the query selects a time range.
+func (q recordsQuery) apply(responses []ModelRecordsResponse) []ModelRecordsResponse {
+	if q == (recordsQuery{}) {
+		return responses
+	}
+	var selected []ModelRecordsResponse
+	for _, response := range responses {
+		var records []*RequestResponsePair
+		for _, record := range response.Records {
+			if (q.since == 0 || record.Timestamp >= q.since) && (q.until == 0 || record.Timestamp < q.until) {
+				records = append(records, record)
+			}
+		}
+		if len(records) == 0 && (q.since != 0 || q.until != 0) {
+			continue
+		}
+		// Records are sorted chronologically, so pages start from the end.
+		total := len(records)
+		end := max(total-q.offset, 0)
+		start := 0
+		if q.limit > 0 {
+			start = max(end-q.limit, 0)
+		}
+		response.Records = records[start:end]
+		response.Count = len(response.Records)
+		if q.limit > 0 || q.offset > 0 {
+			response.Total = total
+		}
+		selected = append(selected, response)
+	}
+	return selected
+}
+
 func (r *OpenAIRecorder) getRecordsByModel(model string) []ModelRecordsResponse {
 	modelID := r.modelManager.ResolveID(model)
 
@@ -685,7 +1315,7 @@ func (r *OpenAIRecorder) broadcastToSubscribers(modelResponses []ModelRecordsRes
 	}
 }
 
-func (r *OpenAIRecorder) sendExistingRecords(w http.ResponseWriter, model string) {
+func (r *OpenAIRecorder) sendExistingRecords(w http.ResponseWriter, model string, anonymization AnonymizationPolicy) {
 	var records []ModelRecordsResponse
 
 	if model == "" {
@@ -695,7 +1325,7 @@ func (r *OpenAIRecorder) sendExistingRecords(w http.ResponseWriter, model string
 	}
 
 	// Send each individual request-response pair as a separate event.
-	for _, modelRecord := range records {
+	for _, modelRecord := range anonymization.anonymizeRecords(records) {
 		for _, requestRecord := range modelRecord.Records {
 			// Create a ModelRecordsResponse with a single record to match
 			// what the non-streaming endpoint returns - []ModelRecordsResponse.
@@ -730,10 +1360,108 @@ func (r *OpenAIRecorder) RemoveModel(model string) {
 	r.m.Lock()
 	defer r.m.Unlock()
 
-	if _, exists := r.records[modelID]; exists {
+	if modelData, exists := r.records[modelID]; exists {
 		delete(r.records, modelID)
+		r.unpersistModel(modelID, modelData)
 		r.log.Infof("Removed records for model: %s", modelID)
 	} else {
 		r.log.Warnf("No records found for model: %s", modelID)
 	}
 }
+
+// DeleteRecord removes the record with the specified ID. It returns false if
+// no matching record exists.
+func (r *OpenAIRecorder) DeleteRecord(id string) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for modelID, modelData := range r.records {
+		for i, record := range modelData.Records {
+			if record.ID == id {
+				modelData.Records = append(modelData.Records[:i], modelData.Records[i+1:]...)
+				r.unpersistRecords(record)
+				r.log.Infof("Deleted record %s for model: %s", utils.SanitizeForLog(id), modelID)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ClearRecords removes all records for the specified model, or for all models
+// if model is empty. Backend configurations are retained. It returns the number
+// of records that were removed.
+func (r *OpenAIRecorder) ClearRecords(model string) int {
+	var modelID string
+	if model != "" {
+		modelID = r.modelManager.ResolveID(model)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var deleted int
+	for id, modelData := range r.records {
+		if modelID != "" && id != modelID {
+			continue
+		}
+		deleted += len(modelData.Records)
+		r.unpersistRecords(modelData.Records...)
+		modelData.Records = make([]*RequestResponsePair, 0, defaultMaxRecordsPerModel)
+	}
+
+	if modelID == "" {
+		r.log.Infof("Cleared %d records for all models", deleted)
+	} else {
+		r.log.Infof("Cleared %d records for model: %s", deleted, modelID)
+	}
+	return deleted
+}
+
+// Records returns copies of the records for the specified model, or for all
+// models if model is empty, in chronological order for each model.
+func (r *OpenAIRecorder) Records(model string) []RequestResponsePair {
+	var modelID string
+	if model != "" {
+		modelID = r.modelManager.ResolveID(model)
+	}
+
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var records []RequestResponsePair
+	for id, modelData := range r.records {
+		if modelID != "" && id != modelID {
+			continue
+		}
+		for _, record := range modelData.Records {
+			records = append(records, *record)
+		}
+	}
+	return records
+}
+
+// DeleteRecordHandler returns a handler for DELETE requests targeting a
+// single record by ID.
+func (r *OpenAIRecorder) DeleteRecordHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !r.DeleteRecord(req.PathValue("id")) {
+			http.Error(w, "record not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ClearRecordsHandler returns a handler for DELETE requests that clear records
+// in bulk, optionally filtered by the "model" query parameter.
+func (r *OpenAIRecorder) ClearRecordsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		deleted := r.ClearRecords(req.URL.Query().Get("model"))
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ClearRecordsResponse{Deleted: deleted}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -1,10 +1,24 @@
 package metrics
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/model-runner/pkg/inference"
 	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/inference/retrieval"
+	"github.com/docker/model-runner/pkg/storage"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
 	"github.com/sirupsen/logrus"
 )
 
@@ -205,6 +219,139 @@ func TestTruncateBase64Data(t *testing.T) {
 	}
 }
 
+func newTestRecorder(t *testing.T) *OpenAIRecorder {
+	t.Helper()
+	logger := logrus.New()
+	modelManager := models.NewManager(logger, models.ClientConfig{
+		StoreRootPath: t.TempDir(),
+		Logger:        logger.WithField("component", "model-manager"),
+	})
+	return NewOpenAIRecorder(logger, modelManager)
+}
+
+func TestDeleteRecord(t *testing.T) {
+	recorder := newTestRecorder(t)
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	first := recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	second := recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+
+	if !recorder.DeleteRecord(first) {
+		t.Fatalf("Expected record %s to be deleted", first)
+	}
+	if recorder.DeleteRecord(first) {
+		t.Errorf("Expected second deletion of %s to report not found", first)
+	}
+
+	records := recorder.getRecordsByModel("model-a")
+	if len(records) != 1 || len(records[0].Records) != 1 {
+		t.Fatalf("Expected exactly one remaining record, got %+v", records)
+	}
+	if records[0].Records[0].ID != second {
+		t.Errorf("Expected remaining record %s, got %s", second, records[0].Records[0].ID)
+	}
+}
+
+func TestClearRecords(t *testing.T) {
+	recorder := newTestRecorder(t)
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	recorder.RecordRequest("model-b", req, []byte(`{"model":"model-b"}`))
+
+	if deleted := recorder.ClearRecords("model-a"); deleted != 2 {
+		t.Errorf("Expected 2 records deleted for model-a, got %d", deleted)
+	}
+	if records := recorder.getRecordsByModel("model-b"); len(records) != 1 || len(records[0].Records) != 1 {
+		t.Errorf("Expected model-b records to be retained, got %+v", records)
+	}
+
+	if deleted := recorder.ClearRecords(""); deleted != 1 {
+		t.Errorf("Expected 1 record deleted for all models, got %d", deleted)
+	}
+	for _, modelRecords := range recorder.getAllRecords() {
+		if len(modelRecords.Records) != 0 {
+			t.Errorf("Expected no records for %s, got %d", modelRecords.Model, len(modelRecords.Records))
+		}
+	}
+}
+
+func TestDeleteRecordHandler(t *testing.T) {
+	recorder := newTestRecorder(t)
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	id := recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /requests/{id}", recorder.DeleteRecordHandler())
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/requests/"+id, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/requests/"+id, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestRecordRetrieval(t *testing.T) {
+	recorder := newTestRecorder(t)
+	recorder.SetRetentionPolicy(RetentionPolicy{ExcludeBodyModels: []string{"sensitive"}})
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	retrievalRecord := RetrievalRecord{
+		VectorStoreID: "vs_1",
+		Query:         "question",
+		Citations:     []retrieval.Citation{{Index: 1, VectorStoreID: "vs_1", DocumentID: "doc", Score: 0.5, Text: "secret"}},
+		Request:       `{"messages":[]}`,
+	}
+
+	for _, model := range []string{"model-a", "ai/sensitive"} {
+		id := recorder.RecordRequest(model, req, []byte(`{"model":"`+model+`"}`))
+		recorder.RecordRetrieval(id, model, retrievalRecord)
+		record := recorder.getRecordsByModel(model)[0].Records[0]
+		if record.Retrieval == nil || record.Retrieval.VectorStoreID != "vs_1" || record.Retrieval.Citations[0].DocumentID != "doc" {
+			t.Fatalf("Expected retrieval to be recorded for %s, got %+v", model, record.Retrieval)
+		}
+		storesBodies := model == "model-a"
+		if (record.Retrieval.Query != "") != storesBodies || (record.Retrieval.Request != "") != storesBodies ||
+			(record.Retrieval.Citations[0].Text != "") != storesBodies {
+			t.Errorf("Expected retrieval bodies to be stored only if request bodies are for %s, got %+v", model, record.Retrieval)
+		}
+	}
+
+	// The original record isn't modified by anonymization.
+	anonymized := AnonymizationPolicy{StripBodies: true}.anonymizeRecord(recorder.getRecordsByModel("model-a")[0].Records[0])
+	if anonymized.Retrieval.Query != "" || anonymized.Retrieval.Citations[0].Text != "" || retrievalRecord.Citations[0].Text != "secret" {
+		t.Errorf("Expected retrieval bodies to be stripped, got %+v", anonymized.Retrieval)
+	}
+}
+
+func TestRecordPromptTemplate(t *testing.T) {
+	recorder := newTestRecorder(t)
+	recorder.SetRetentionPolicy(RetentionPolicy{ExcludeBodyModels: []string{"sensitive"}})
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	templateRecord := PromptTemplateRecord{ID: "pt_1", Name: "summarize", Version: 2, Variables: map[string]string{"topic": "secret"}}
+
+	for _, model := range []string{"model-a", "ai/sensitive"} {
+		id := recorder.RecordRequest(model, req, []byte(`{"model":"`+model+`"}`))
+		recorder.RecordPromptTemplate(id, model, templateRecord)
+		record := recorder.getRecordsByModel(model)[0].Records[0]
+		if record.PromptTemplate == nil || record.PromptTemplate.ID != "pt_1" || record.PromptTemplate.Version != 2 {
+			t.Fatalf("Expected the prompt template to be recorded for %s, got %+v", model, record.PromptTemplate)
+		}
+		if storesBodies := model == "model-a"; (record.PromptTemplate.Variables != nil) != storesBodies {
+			t.Errorf("Expected variables to be stored only if request bodies are for %s, got %+v", model, record.PromptTemplate)
+		}
+	}
+
+	anonymized := AnonymizationPolicy{StripBodies: true}.anonymizeRecord(recorder.getRecordsByModel("model-a")[0].Records[0])
+	if anonymized.PromptTemplate.Variables != nil || anonymized.PromptTemplate.Name != "summarize" {
+		t.Errorf("Expected variables to be stripped, got %+v", anonymized.PromptTemplate)
+	}
+}
+
 // Helper function to generate a string of specified length
 func generateLongString(length int) string {
 	result := make([]byte, length)
@@ -213,3 +360,783 @@ func generateLongString(length int) string {
 	}
 	return string(result)
 }
+
+func TestRetentionPolicy(t *testing.T) {
+	recorder := newTestRecorder(t)
+	recorder.SetRetentionPolicy(RetentionPolicy{
+		MaxAge:            24 * time.Hour,
+		ExcludeBodyModels: []string{"sensitive"},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	recorder.RecordRequest("ai/sensitive:latest", req, []byte(`{"model":"ai/sensitive"}`))
+	stale := recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	fresh := recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+
+	records := recorder.getRecordsByModel("ai/sensitive:latest")
+	if len(records) != 1 || len(records[0].Records) != 1 {
+		t.Fatalf("Expected one record for excluded model, got %+v", records)
+	}
+	if records[0].Records[0].Request != "" {
+		t.Errorf("Expected request body to be omitted, got %q", records[0].Records[0].Request)
+	}
+
+	for _, record := range recorder.getRecordsByModel("model-a")[0].Records {
+		if record.ID == stale {
+			record.Timestamp = time.Now().Add(-48 * time.Hour).Unix()
+		}
+	}
+	if purged := recorder.PurgeExpired(); purged != 1 {
+		t.Errorf("Expected 1 record purged, got %d", purged)
+	}
+	remaining := recorder.getRecordsByModel("model-a")[0].Records
+	if len(remaining) != 1 || remaining[0].ID != fresh {
+		t.Errorf("Expected only record %s to remain, got %+v", fresh, remaining)
+	}
+
+	recorder.PurgeModel("model-a")
+	if records := recorder.getRecordsByModel("model-a"); records != nil {
+		t.Errorf("Expected records for model-a to be purged, got %+v", records)
+	}
+}
+
+func TestRetentionLimits(t *testing.T) {
+	recorder := newTestRecorder(t)
+	recorder.SetRetentionPolicy(RetentionPolicy{MaxRecords: 3})
+
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	var ids []string
+	for range 5 {
+		ids = append(ids, recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`)))
+	}
+	records := recorder.getRecordsByModel("model-a")[0].Records
+	if len(records) != 3 || records[0].ID != ids[2] {
+		t.Fatalf("Expected the 3 most recent records to be kept, got %+v", records)
+	}
+
+	// Lowering the limit purges the oldest records.
+	recorder.SetRetentionPolicy(RetentionPolicy{MaxRecords: 2})
+	if purged := recorder.PurgeExpired(); purged != 1 {
+		t.Errorf("Expected 1 record purged, got %d", purged)
+	}
+
+	// Records beyond the maximum size are purged oldest first, across models.
+	recorder.RecordRequest("model-b", req, []byte(`{"model":"model-b"}`))
+	for i, record := range recorder.getRecordsByModel("model-a")[0].Records {
+		record.Timestamp -= int64(10 - i)
+	}
+	data, err := json.Marshal(recorder.getRecordsByModel("model-b")[0].Records[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.SetRetentionPolicy(RetentionPolicy{MaxRecords: 2, MaxSize: int64(len(data)) + 1})
+	if purged := recorder.PurgeExpired(); purged != 2 {
+		t.Errorf("Expected 2 records purged, got %d", purged)
+	}
+	if records := recorder.getRecordsByModel("model-a")[0].Records; len(records) != 0 {
+		t.Errorf("Expected the oldest records to be purged, got %+v", records)
+	}
+	if records := recorder.getRecordsByModel("model-b")[0].Records; len(records) != 1 {
+		t.Errorf("Expected the most recent record to be kept, got %+v", records)
+	}
+}
+
+func TestRecordsQuery(t *testing.T) {
+	recorder := newTestRecorder(t)
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	var ids []string
+	for range 5 {
+		ids = append(ids, recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`)))
+	}
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for i, record := range recorder.getRecordsByModel("model-a")[0].Records {
+		record.Timestamp = start.Add(time.Duration(i) * time.Hour).Unix()
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+		total int
+	}{
+		{query: "limit=2", want: ids[3:], total: 5},
+		{query: "limit=2&offset=2", want: ids[1:3], total: 5},
+		{query: "offset=4", want: ids[:1], total: 5},
+		{query: "since=2025-01-01T01:00:00Z&until=2025-01-01T03:00:00Z", want: ids[1:3]},
+		{query: fmt.Sprintf("since=%d&limit=1", start.Add(3*time.Hour).Unix()), want: ids[4:], total: 2},
+		{query: "since=2026-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		recorder.GetRecordsHandler()(rec, httptest.NewRequest(http.MethodGet, "/engines/requests?model=model-a&"+tt.query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", tt.query, http.StatusOK, rec.Code)
+		}
+		var responses []ModelRecordsResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &responses); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.query, err)
+		}
+		if len(tt.want) == 0 {
+			if len(responses) != 0 {
+				t.Errorf("%s: expected no records, got %+v", tt.query, responses)
+			}
+			continue
+		}
+		if len(responses) != 1 || responses[0].Total != tt.total || responses[0].Count != len(tt.want) {
+			t.Fatalf("%s: unexpected response %+v", tt.query, responses)
+		}
+		for i, record := range responses[0].Records {
+			if record.ID != tt.want[i] {
+				t.Errorf("%s: expected record %s, got %s", tt.query, tt.want[i], record.ID)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	recorder.GetRecordsHandler()(rec, httptest.NewRequest(http.MethodGet, "/engines/requests?limit=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid limit, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestRecordingVerbosity(t *testing.T) {
+	recorder := newTestRecorder(t)
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+
+	recorder.SetVerbosity(RecordingMetadata)
+	recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	recorder.SetVerbosity(RecordingFull)
+	recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+
+	records := recorder.getRecordsByModel("model-a")[0].Records
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].Request != "" {
+		t.Errorf("Expected request body to be omitted with metadata verbosity, got %q", records[0].Request)
+	}
+	if records[1].Request == "" {
+		t.Error("Expected request body to be recorded with full verbosity")
+	}
+}
+
+func TestStripReasoningContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		expected string
+	}{
+		{
+			name:     "reasoning removed",
+			response: `{"choices":[{"message":{"content":"42","reasoning_content":"thinking","role":"assistant"}}]}`,
+			expected: `{"choices":[{"message":{"content":"42","role":"assistant"}}]}`,
+		},
+		{
+			name:     "no reasoning",
+			response: `{"choices": [{"message": {"content": "42"}}]}`,
+			expected: `{"choices": [{"message": {"content": "42"}}]}`,
+		},
+		{
+			name:     "not JSON",
+			response: "data: partial",
+			expected: "data: partial",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripReasoningContent(tt.response); got != tt.expected {
+				t.Errorf("stripReasoningContent() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseAnonymizationPolicy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    AnonymizationPolicy
+		wantErr bool
+	}{
+		{spec: "", want: AnonymizationPolicy{}},
+		{spec: "all", want: AnonymizationPolicy{HashIdentifiers: true, StripBodies: true, TimestampBucket: time.Hour}},
+		{spec: "hash-ids, bucket=15m", want: AnonymizationPolicy{HashIdentifiers: true, TimestampBucket: 15 * time.Minute}},
+		{spec: "strip-bodies", want: AnonymizationPolicy{StripBodies: true}},
+		{spec: "bucket=10ms", wantErr: true},
+		{spec: "redact", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			policy, err := ParseAnonymizationPolicy(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", policy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if policy != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, policy)
+			}
+		})
+	}
+}
+
+func TestAnonymizedRecords(t *testing.T) {
+	recorder := newTestRecorder(t)
+	recorder.SetAnonymizationPolicy(AnonymizationPolicy{HashIdentifiers: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	req.Header.Set("User-Agent", "client/1.0")
+	id := recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+
+	rec := httptest.NewRecorder()
+	recorder.GetRecordsHandler()(rec, httptest.NewRequest(http.MethodGet, "/requests?model=model-a&anonymize=strip-bodies,bucket=1h", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var records []ModelRecordsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &records); err != nil {
+		t.Fatalf("Failed to decode records: %v", err)
+	}
+	if len(records) != 1 || len(records[0].Records) != 1 {
+		t.Fatalf("Expected exactly one record, got %+v", records)
+	}
+	record := records[0].Records[0]
+	if record.ID == id || record.ID != hashIdentifier(id) {
+		t.Errorf("Expected hashed record ID, got %q", record.ID)
+	}
+	if record.UserAgent != hashIdentifier("client/1.0") {
+		t.Errorf("Expected hashed user agent, got %q", record.UserAgent)
+	}
+	if record.Request != "" {
+		t.Errorf("Expected request body to be stripped, got %q", record.Request)
+	}
+	if record.Timestamp%3600 != 0 {
+		t.Errorf("Expected timestamp to be bucketed to the hour, got %d", record.Timestamp)
+	}
+
+	// The stored record must not be modified.
+	stored := recorder.getRecordsByModel("model-a")[0].Records[0]
+	if stored.ID != id || stored.UserAgent != "client/1.0" || stored.Request == "" {
+		t.Errorf("Expected stored record to be unmodified, got %+v", stored)
+	}
+
+	rec = httptest.NewRecorder()
+	recorder.GetRecordsHandler()(rec, httptest.NewRequest(http.MethodGet, "/requests?anonymize=bogus", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid anonymization options, got %d", rec.Code)
+	}
+}
+
+func TestNormalizeUserAgent(t *testing.T) {
+	tests := map[string]string{
+		"":                             "unknown",
+		"OpenAI/Python 1.40.3":         "OpenAI/Python/1.40",
+		"curl/8.4.0":                   "curl/8.4",
+		"Go-http-client/1.1":           "Go-http-client/1.1",
+		"Mozilla/5.0 (X11; Linux)":     "Mozilla/5.0",
+		"langchain/0.3.1rc2 python/3":  "langchain/0.3",
+		"my-app":                       "my-app",
+		"weird<script>/2":              "weirdscript/2",
+		"(compatible; bot)":            "unknown",
+		"docker-model-runner/v1.2.3 x": "docker-model-runner/v1.2.3",
+	}
+	for userAgent, want := range tests {
+		if got := NormalizeUserAgent(userAgent); got != want {
+			t.Errorf("NormalizeUserAgent(%q) = %q, want %q", userAgent, got, want)
+		}
+	}
+}
+
+func TestUsageStats(t *testing.T) {
+	usage := NewUsageStats(2)
+	usage.Record("OpenAI/Python 1.40.3", "ai/smollm2:latest", http.StatusOK)
+	usage.Record("OpenAI/Python 1.40.9", "ai/smollm2:latest", http.StatusInternalServerError)
+	usage.Record("curl/8.4.0", "ai/smollm2:latest", http.StatusOK)
+	usage.Record("httpie/3.2", "ai/smollm2:latest", http.StatusOK)
+
+	got := usage.Usage()
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 usage entries, got %+v", got)
+	}
+	if got[0].UserAgent != "OpenAI/Python/1.40" || got[0].Requests != 2 || got[0].Errors != 1 {
+		t.Errorf("Unexpected top entry: %+v", got[0])
+	}
+	if got[1].UserAgent != "curl/8.4" || got[2].UserAgent != otherLabel {
+		t.Errorf("Expected user agents beyond the cap to be reported as %q, got %+v", otherLabel, got)
+	}
+
+	families := usageMetricFamilies(got)
+	requests := families["model_runner_user_agent_requests_total"]
+	if requests == nil || len(requests.GetMetric()) != 3 || requests.GetMetric()[0].GetCounter().GetValue() != 2 {
+		t.Errorf("Unexpected requests metric family: %v", requests)
+	}
+}
+
+func TestInferenceStats(t *testing.T) {
+	recorder := NewOpenAIRecorder(logrus.New(), nil)
+	stats := NewInferenceStats()
+	record := func(statusCode int, body string) {
+		start := time.Now().Add(-time.Second)
+		w := recorder.NewResponseRecorder(httptest.NewRecorder())
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body))
+		stats.Record("llama.cpp", "ai/smollm2:latest", start, w)
+	}
+	record(http.StatusOK, `{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`)
+	record(http.StatusOK, "data: {\"choices\":[]}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":4}}\n\ndata: [DONE]\n\n")
+	record(http.StatusInternalServerError, `{"error":"failed","usage":{"prompt_tokens":100}}`)
+	dequeue := stats.Enqueue("llama.cpp", "ai/smollm2:latest")
+
+	traffic := stats.Traffic()
+	if len(traffic) != 1 {
+		t.Fatalf("Expected a single traffic aggregate, got %+v", traffic)
+	}
+	entry := traffic[0]
+	if entry.Requests[http.StatusOK] != 2 || entry.Requests[http.StatusInternalServerError] != 1 {
+		t.Errorf("Unexpected request counts: %v", entry.Requests)
+	}
+	if entry.PromptTokens != 8 || entry.CompletionTokens != 11 {
+		t.Errorf("Expected 8 prompt and 11 completion tokens, got %d and %d", entry.PromptTokens, entry.CompletionTokens)
+	}
+	if entry.TimeToFirstToken.Count != 1 || entry.TimeToFirstToken.Sum < 1 || entry.TokensPerSecond.Count != 2 {
+		t.Errorf("Unexpected histograms: %+v, %+v", entry.TimeToFirstToken, entry.TokensPerSecond)
+	}
+	if entry.Queued != 1 {
+		t.Errorf("Expected a queued request, got %d", entry.Queued)
+	}
+	dequeue()
+	dequeue()
+	if queued := stats.Traffic()[0].Queued; queued != 0 {
+		t.Errorf("Expected no queued requests, got %d", queued)
+	}
+
+	families := inferenceMetricFamilies(traffic, []ActiveRunner{
+		{BackendName: "llama.cpp", ModelName: "sha256:model", Mode: "completion"},
+		{BackendName: "llama.cpp", ModelName: "sha256:model", Mode: "completion"},
+	})
+	if requests := families["model_runner_inference_requests_total"]; requests == nil || len(requests.GetMetric()) != 2 {
+		t.Errorf("Unexpected requests metric family: %v", requests)
+	}
+	histogram := families["model_runner_inference_time_to_first_token_seconds"].GetMetric()[0].GetHistogram()
+	if buckets := histogram.GetBucket(); buckets[len(buckets)-1].GetCumulativeCount() != 1 || buckets[0].GetCumulativeCount() != 0 {
+		t.Errorf("Unexpected time to first token histogram: %v", histogram)
+	}
+	if runners := families["model_runner_active_runners"]; runners == nil || runners.GetMetric()[0].GetGauge().GetValue() != 2 {
+		t.Errorf("Unexpected active runners metric family: %v", runners)
+	}
+}
+
+func TestResponseTokens(t *testing.T) {
+	recorder := NewOpenAIRecorder(logrus.New(), nil)
+	tests := []struct {
+		body string
+		want int64
+	}{
+		{body: `{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`, want: 12},
+		{body: `{"data":[],"usage":{"prompt_tokens":4}}`, want: 4},
+		{body: "data: {\"choices\":[]}\n\ndata: {\"choices\":[],\"usage\":{\"total_tokens\":9}}\n\ndata: [DONE]\n\n", want: 9},
+		{body: "data: {\"choices\":[]}\n\ndata: [DONE]\n\n", want: 0},
+		{body: `not json`, want: 0},
+	}
+	for _, tt := range tests {
+		w := recorder.NewResponseRecorder(httptest.NewRecorder())
+		w.Write([]byte(tt.body))
+		if got := ResponseTokens(w); got != tt.want {
+			t.Errorf("%q: expected %d tokens, got %d", tt.body, tt.want, got)
+		}
+	}
+}
+
+func TestExportConversation(t *testing.T) {
+	recorder := newTestRecorder(t)
+	record := func(session, request, response string) string {
+		req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+		req.Header.Set(inference.SessionIDHeader, session)
+		id := recorder.RecordRequest("model-a", req, []byte(request))
+		for _, stored := range recorder.getRecordsByModel("model-a")[0].Records {
+			if stored.ID == id {
+				stored.Response = response
+			}
+		}
+		return id
+	}
+	first := record("chat-1",
+		`{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"My e-mail is jane@example.com."}]}`,
+		`{"choices":[{"message":{"role":"assistant","content":"Noted."}}]}`)
+	record("chat-1",
+		`{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"My e-mail is jane@example.com."},{"role":"assistant","content":"Noted."},{"role":"user","content":[{"type":"text","text":"What's in it?"},{"type":"image_url","image_url":{"url":"data:"}}]}]}`,
+		`{"choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"function":{"name":"describe","arguments":"{}"}}]}}]}`)
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		recorder.ExportHandler()(rec, httptest.NewRequest(http.MethodGet, "/requests/_export?"+query, nil))
+		return rec
+	}
+
+	rec := export("session=chat-1&format=sharegpt")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var conversation ShareGPTConversation
+	if err := json.Unmarshal(rec.Body.Bytes(), &conversation); err != nil {
+		t.Fatalf("Failed to decode conversation: %v", err)
+	}
+	expected := []ShareGPTMessage{
+		{From: "system", Value: "Be brief."},
+		{From: "human", Value: "My e-mail is [REDACTED_EMAIL]."},
+		{From: "gpt", Value: "Noted."},
+		{From: "human", Value: "What's in it?\n[image]"},
+		{From: "function_call", Value: "describe({})"},
+	}
+	if conversation.ID != "chat-1" || conversation.Model != "model-a" || !reflect.DeepEqual(conversation.Conversations, expected) {
+		t.Errorf("Unexpected conversation %+v", conversation)
+	}
+
+	rec = export("id=" + first)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/markdown") {
+		t.Fatalf("Expected markdown, got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "## User\n\nMy e-mail is [REDACTED_EMAIL].\n") || !strings.Contains(body, "## Assistant\n\nNoted.\n") || strings.Contains(body, "What's in it?") {
+		t.Errorf("Unexpected markdown:\n%s", body)
+	}
+
+	// Hashed identifiers match their hashes, and stripped bodies can't be
+	// exported.
+	recorder.SetAnonymizationPolicy(AnonymizationPolicy{HashIdentifiers: true})
+	if rec := export("session=" + hashIdentifier("chat-1")); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a hashed session ID, got %d", rec.Code)
+	}
+	for query, code := range map[string]int{
+		"":                               http.StatusBadRequest,
+		"id=x&session=y":                 http.StatusBadRequest,
+		"id=" + first + "&format=pdf":    http.StatusBadRequest,
+		"id=missing":                     http.StatusNotFound,
+		"id=" + first + "&anonymize=all": http.StatusForbidden,
+	} {
+		if rec := export(query); rec.Code != code {
+			t.Errorf("Expected status %d for %q, got %d", code, query, rec.Code)
+		}
+	}
+}
+
+func TestRedactText(t *testing.T) {
+	text := "Contact jane.doe@example.com from 192.168.1.10 with Authorization: Bearer abc.def-123 or key sk-abcdefghijklmnopqrstuvwx."
+	expected := "Contact [REDACTED_EMAIL] from [REDACTED_IP] with Authorization: Bearer [REDACTED_SECRET] or key [REDACTED_SECRET]."
+	if redacted := redactText(text); redacted != expected {
+		t.Errorf("Expected %q, got %q", expected, redacted)
+	}
+}
+
+func TestFilterPipelineRecords(t *testing.T) {
+	responses := []ModelRecordsResponse{
+		{Count: 2, Model: "a", ModelData: ModelData{Records: []*RequestResponsePair{
+			{ID: "1", Pipeline: &PipelineRecord{RunID: "pipe-1", Step: "summarize"}},
+			{ID: "2"},
+		}}},
+		{Count: 1, Model: "b", ModelData: ModelData{Records: []*RequestResponsePair{{ID: "3"}}}},
+	}
+	if filtered := filterPipelineRecords(responses, ""); len(filtered) != 2 {
+		t.Errorf("Expected all records, got %+v", filtered)
+	}
+	filtered := filterPipelineRecords(responses, "pipe-1")
+	if len(filtered) != 1 || filtered[0].Count != 1 || filtered[0].Records[0].ID != "1" {
+		t.Errorf("Unexpected filtered records %+v", filtered)
+	}
+}
+
+func TestRecorderStorage(t *testing.T) {
+	kv := storage.NewMemory()
+	recorder := newTestRecorder(t)
+	if err := recorder.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	recorder.SetConfigForModel("model-a", &inference.BackendConfiguration{ContextSize: 4096})
+	first := recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	second := recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	recorder.RecordRequest("model-b", req, []byte(`{"model":"model-b"}`))
+	recorder.DeleteRecord(first)
+	recorder.ClearRecords("model-b")
+
+	restored := newTestRecorder(t)
+	if err := restored.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	records := restored.getRecordsByModel("model-a")
+	if len(records) != 1 || len(records[0].Records) != 1 || records[0].Records[0].ID != second {
+		t.Fatalf("Expected only record %s to be restored, got %+v", second, records)
+	}
+	if records[0].Config.ContextSize != 4096 {
+		t.Errorf("Expected the configuration to be restored, got %+v", records[0].Config)
+	}
+	if records := restored.getRecordsByModel("model-b"); len(records) != 0 && len(records[0].Records) != 0 {
+		t.Errorf("Expected cleared records not to be restored, got %+v", records)
+	}
+
+	restored.RemoveModel("model-a")
+	if keys, _ := kv.List(""); len(keys) != 0 {
+		t.Errorf("Expected removing the model to delete its persisted data, got %v", keys)
+	}
+}
+
+func TestRecorderStorageMaxSize(t *testing.T) {
+	kv := storage.NewMemory()
+	recorder := newTestRecorder(t)
+	if err := recorder.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	first := recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	data, err := kv.Get(recordKeyPrefix + first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The maximum size is enforced as records are written, without waiting
+	// for the sweeper, and applies to the bytes persisted.
+	recorder.SetRetentionPolicy(RetentionPolicy{MaxSize: int64(len(data))*5/2 + 1})
+	recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	recorder.RecordRequest("model-b", req, []byte(`{"model":"model-b"}`))
+	last := recorder.RecordRequest("model-b", req, []byte(`{"model":"model-b"}`))
+	keys, err := kv.List(recordKeyPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !slices.Contains(keys, recordKeyPrefix+last) {
+		t.Fatalf("Expected the 2 most recent records to be kept, got %v", keys)
+	}
+	var size int64
+	for _, key := range keys {
+		data, err := kv.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += int64(len(data))
+	}
+	if recorder.recordsSize != size {
+		t.Errorf("Expected the records size to be %d bytes, got %d", size, recorder.recordsSize)
+	}
+	if records := recorder.getRecordsByModel("model-a")[0].Records; len(records) != 0 {
+		t.Errorf("Expected the oldest records to be purged, got %+v", records)
+	}
+}
+
+func TestRecorderEncryption(t *testing.T) {
+	key, err := ParseEncryptionKey(strings.Repeat("ab", EncryptionKeySize))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	kv := storage.NewMemory()
+	recorder := newTestRecorder(t)
+	if err := recorder.SetEncryptionKey(key); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := recorder.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	id := recorder.RecordRequest("model-a", req, []byte(`{"messages":[{"content":"my password is hunter2"}]}`))
+
+	persisted, err := kv.Get(recordKeyPrefix + id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(string(persisted), "hunter2") || !strings.Contains(string(persisted), id) {
+		t.Errorf("Expected the persisted body to be encrypted, got %s", persisted)
+	}
+
+	if err := newTestRecorder(t).SetStorage(kv); err == nil {
+		t.Error("Expected loading encrypted records without a key to fail")
+	}
+	restored := newTestRecorder(t)
+	restored.SetEncryptionKey(key)
+	if err := restored.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if records := restored.getRecordsByModel("model-a"); len(records) != 1 || !strings.Contains(records[0].Records[0].Request, "hunter2") {
+		t.Errorf("Expected the decrypted record, got %+v", records)
+	}
+
+	if _, err := ParseEncryptionKey("c2hvcnQ="); err == nil {
+		t.Error("Expected error for a short key")
+	}
+}
+
+func TestRecorderEncryptionBestOf(t *testing.T) {
+	key, err := ParseEncryptionKey(strings.Repeat("ab", EncryptionKeySize))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	kv := storage.NewMemory()
+	recorder := newTestRecorder(t)
+	recorder.SetEncryptionKey(key)
+	if err := recorder.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	id := recorder.RecordRequest("model-a", req, []byte(`{"messages":[{"content":"hi"}]}`))
+	recorder.RecordBestOf(id, "model-a", BestOfRecord{Candidates: 2, Selection: "logprob", Rank: 1, Discarded: []string{"discarded hunter2"}})
+
+	data, err := kv.Get(recordKeyPrefix + id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var persisted persistedRecord
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if persisted.Sealed == "" || persisted.BestOf == nil || persisted.BestOf.Candidates != 2 || len(persisted.BestOf.Discarded) != 0 {
+		t.Errorf("Expected the plaintext part to keep the selection without the discarded candidates, got %+v", persisted.BestOf)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Errorf("Expected the discarded candidates to be encrypted, got %s", data)
+	}
+
+	restored := newTestRecorder(t)
+	restored.SetEncryptionKey(key)
+	if err := restored.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if records := restored.getRecordsByModel("model-a"); len(records) != 1 || records[0].Records[0].BestOf == nil ||
+		len(records[0].Records[0].BestOf.Discarded) != 1 {
+		t.Errorf("Expected the decrypted discarded candidates, got %+v", records)
+	}
+}
+
+func TestRecorderAudit(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	kv := storage.NewMemory()
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+
+	// Records persisted before auditing was enabled are entered into the log.
+	unaudited := newTestRecorder(t)
+	if err := unaudited.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	first := unaudited.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+
+	recorder := newTestRecorder(t)
+	if err := recorder.EnableAudit(key); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := recorder.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second := recorder.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	recorder.RecordRequest("model-b", req, []byte(`{"model":"model-b"}`))
+	recorder.DeleteRecord(first)
+	report, err := recorder.VerifyAudit()
+	if err != nil || !report.Valid || report.Entries != 4 || report.Records != 2 || report.PublicKey == "" {
+		t.Fatalf("Expected a valid audit log of 4 entries and 2 records, got %+v (%v)", report, err)
+	}
+
+	// The chain survives restarts.
+	restored := newTestRecorder(t)
+	restored.EnableAudit(key)
+	if err := restored.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	restored.RecordRequest("model-a", req, []byte(`{"model":"model-a"}`))
+	if report, _ := restored.VerifyAudit(); !report.Valid || report.Entries != 5 {
+		t.Fatalf("Expected a valid audit log of 5 entries, got %+v", report)
+	}
+
+	// Altered records and entries, and records deleted behind the recorder's
+	// back, are detected.
+	kv.Put(recordKeyPrefix+second, []byte(`{"id":"`+second+`","request":"altered"}`))
+	entry, _ := kv.Get(auditKey(2))
+	kv.Put(auditKey(2), []byte(strings.Replace(string(entry), `"put"`, `"delete"`, 1)))
+	keys, _ := kv.List(recordKeyPrefix + "model-b")
+	kv.Delete(keys[0])
+	report, _ = restored.VerifyAudit()
+	if report.Valid || len(report.Errors) != 3 {
+		t.Errorf("Expected 3 errors, got %+v", report)
+	}
+
+	if _, err := newTestRecorder(t).VerifyAudit(); err == nil {
+		t.Error("Expected verification to fail without auditing")
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	recorder := NewOpenAIRecorder(logrus.New(), nil)
+	stats := NewCacheStats()
+	record := func(statusCode int, body string) {
+		w := recorder.NewResponseRecorder(httptest.NewRecorder())
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body))
+		stats.RecordResponse("llama.cpp", "ai/smollm2:latest", "sha256:model", "completion", w)
+	}
+	record(http.StatusOK, `{"choices":[],"usage":{"prompt_tokens":100,"completion_tokens":7},"timings":{"cache_n":80}}`)
+	record(http.StatusOK, "data: {\"choices\":[]}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":100,\"prompt_tokens_details\":{\"cached_tokens\":20}}}\n\ndata: [DONE]\n\n")
+	record(http.StatusInternalServerError, `{"error":"failed","usage":{"prompt_tokens":100}}`)
+
+	sample := func(metrics ...string) {
+		var replicas []map[string]*dto.MetricFamily
+		for _, text := range metrics {
+			parser := expfmt.NewTextParser(model.LegacyValidation)
+			families, err := parser.TextToMetricFamilies(strings.NewReader(text))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			replicas = append(replicas, families)
+		}
+		stats.Sample("llama.cpp", "sha256:model", "completion", replicas)
+	}
+	sample("# TYPE llamacpp:kv_cache_tokens gauge\nllamacpp:kv_cache_tokens 300\n# TYPE llamacpp:kv_cache_usage_ratio gauge\nllamacpp:kv_cache_usage_ratio 0.5\n",
+		"# TYPE llamacpp:kv_cache_tokens gauge\nllamacpp:kv_cache_tokens 200\n# TYPE llamacpp:kv_cache_usage_ratio gauge\nllamacpp:kv_cache_usage_ratio 0.3\n")
+	sample("# TYPE llamacpp:kv_cache_tokens gauge\nllamacpp:kv_cache_tokens 100\n")
+
+	result := stats.Stats()
+	if len(result) != 1 {
+		t.Fatalf("Expected the statistics of a single runner, got %+v", result)
+	}
+	entry := result[0]
+	if entry.Model != "ai/smollm2:latest" || entry.Requests != 2 || entry.PromptTokens != 200 || entry.CachedPromptTokens != 100 || entry.ReuseRatio != 0.5 {
+		t.Errorf("Unexpected reuse statistics: %+v", entry)
+	}
+	if entry.CachedTokens != 100 || entry.Evictions != 1 || entry.EvictedTokens != 400 {
+		t.Errorf("Unexpected eviction statistics: %+v", entry)
+	}
+	if len(entry.Samples) != 2 || entry.Samples[0].CachedTokens != 500 || entry.Samples[0].CacheUsageRatio != 0.4 ||
+		entry.Samples[0].ReuseRatio != 0.5 || entry.Samples[1].ReuseRatio != 0 {
+		t.Errorf("Unexpected samples: %+v", entry.Samples)
+	}
+}
+
+func TestTokenUsageStats(t *testing.T) {
+	recorder := NewOpenAIRecorder(logrus.New(), nil)
+	stats := NewTokenUsageStats()
+	record := func(apiKey string, statusCode int, body string) {
+		w := recorder.NewResponseRecorder(httptest.NewRecorder())
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body))
+		stats.Record(apiKey, "ai/smollm2:latest", w)
+	}
+	record("key-a", http.StatusOK, `{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`)
+	record("key-a", http.StatusOK, "data: {\"choices\":[]}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":4}}\n\ndata: [DONE]\n\n")
+	record("key-b", http.StatusOK, `{"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+	record("key-b", http.StatusInternalServerError, `{"error":"failed","usage":{"prompt_tokens":100}}`)
+
+	usage := stats.Usage("", "")
+	if len(usage) != 2 || usage[0].APIKey != "key-a" {
+		t.Fatalf("Expected the usage of both keys, most used first, got %+v", usage)
+	}
+	if entry := usage[0]; entry.Requests != 2 || entry.PromptTokens != 8 || entry.CompletionTokens != 11 || entry.TotalTokens != 19 {
+		t.Errorf("Unexpected usage of key-a: %+v", entry)
+	}
+	if entry := stats.Usage("key-b", "ai/smollm2:latest"); len(entry) != 1 || entry[0].Requests != 2 || entry[0].TotalTokens != 2 {
+		t.Errorf("Unexpected usage of key-b: %+v", entry)
+	}
+	if totals := stats.Totals("", "ai/smollm2:latest"); totals.Requests != 4 || totals.TotalTokens != 21 {
+		t.Errorf("Unexpected totals: %+v", totals)
+	}
+}
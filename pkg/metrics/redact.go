@@ -0,0 +1,9 @@
+package metrics
+
+import "github.com/docker/model-runner/pkg/pii"
+
+// redactText replaces e-mail addresses, IP addresses, and other sensitive data
+// detected in text, such as API keys and tokens, with placeholders.
+func redactText(text string) string {
+	return pii.Redact(text)
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	dto "github.com/prometheus/client_model/go"
+)
+
+// RequestQueueStats is the state of the request queue of a model in a mode,
+// which limits the requests that the model serves concurrently.
+type RequestQueueStats struct {
+	Backend string `json:"backend"`
+	Model   string `json:"model"`
+	Mode    string `json:"mode"`
+	// InFlight is the number of admitted requests being served.
+	InFlight int `json:"in_flight"`
+	// Queued is the number of requests waiting to be admitted.
+	Queued int `json:"queued"`
+	// Admitted is the number of requests that were admitted.
+	Admitted uint64 `json:"admitted"`
+	// Rejected is the number of requests rejected because the queue was full.
+	Rejected uint64 `json:"rejected"`
+	// TimedOut is the number of requests rejected because they waited in the
+	// queue for too long.
+	TimedOut uint64 `json:"timed_out"`
+}
+
+// requestQueueMetricFamilies returns Prometheus metric families for the
+// specified request queues.
+func requestQueueMetricFamilies(queues []RequestQueueStats) map[string]*dto.MetricFamily {
+	if len(queues) == 0 {
+		return nil
+	}
+	gaugeType, counterType := dto.MetricType_GAUGE, dto.MetricType_COUNTER
+	families := make(map[string]*dto.MetricFamily)
+	for _, family := range []struct {
+		name, help string
+		metricType *dto.MetricType
+		value      func(RequestQueueStats) float64
+	}{
+		{
+			name:       "model_runner_request_queue_in_flight",
+			help:       "Number of admitted requests being served, by backend, model, and mode.",
+			metricType: &gaugeType,
+			value:      func(q RequestQueueStats) float64 { return float64(q.InFlight) },
+		},
+		{
+			name:       "model_runner_request_queue_depth",
+			help:       "Number of requests waiting to be admitted, by backend, model, and mode.",
+			metricType: &gaugeType,
+			value:      func(q RequestQueueStats) float64 { return float64(q.Queued) },
+		},
+		{
+			name:       "model_runner_request_queue_admitted_total",
+			help:       "Number of requests admitted by the request queue, by backend, model, and mode.",
+			metricType: &counterType,
+			value:      func(q RequestQueueStats) float64 { return float64(q.Admitted) },
+		},
+		{
+			name:       "model_runner_request_queue_rejected_total",
+			help:       "Number of requests rejected because the request queue was full, by backend, model, and mode.",
+			metricType: &counterType,
+			value:      func(q RequestQueueStats) float64 { return float64(q.Rejected) },
+		},
+		{
+			name:       "model_runner_request_queue_timeouts_total",
+			help:       "Number of requests rejected because they waited in the request queue for too long, by backend, model, and mode.",
+			metricType: &counterType,
+			value:      func(q RequestQueueStats) float64 { return float64(q.TimedOut) },
+		},
+	} {
+		name, help := family.name, family.help
+		metricFamily := &dto.MetricFamily{Name: &name, Help: &help, Type: family.metricType}
+		for _, queue := range queues {
+			backendLabel, modelLabel, modeLabel := "backend", "model", "mode"
+			value := family.value(queue)
+			metric := &dto.Metric{
+				Label: []*dto.LabelPair{
+					{Name: &backendLabel, Value: &queue.Backend},
+					{Name: &modelLabel, Value: &queue.Model},
+					{Name: &modeLabel, Value: &queue.Mode},
+				},
+			}
+			if *family.metricType == dto.MetricType_GAUGE {
+				metric.Gauge = &dto.Gauge{Value: &value}
+			} else {
+				metric.Counter = &dto.Counter{Value: &value}
+			}
+			metricFamily.Metric = append(metricFamily.Metric, metric)
+		}
+		families[name] = metricFamily
+	}
+	return families
+}
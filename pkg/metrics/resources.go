@@ -0,0 +1,28 @@
+package metrics
+
+// ResourceSnapshot is a lightweight snapshot of system resource usage captured
+// when a request is recorded. Values that couldn't be determined are omitted.
+type ResourceSnapshot struct {
+	// LoadAverage is the one-minute system load average.
+	LoadAverage float64 `json:"load_average,omitempty"`
+	// AvailableRAM is the amount of RAM available without swapping, in bytes.
+	AvailableRAM uint64 `json:"available_ram,omitempty"`
+	// AvailableVRAM is the amount of VRAM not reserved by loaded runners, in
+	// bytes.
+	AvailableVRAM uint64 `json:"available_vram,omitempty"`
+	// PendingRequests is the number of requests waiting for a runner.
+	PendingRequests int64 `json:"pending_requests"`
+	// ActiveRequests is the number of requests being served by runners.
+	ActiveRequests int64 `json:"active_requests"`
+}
+
+// ResourceSnapshotFunc captures a ResourceSnapshot.
+type ResourceSnapshotFunc func() *ResourceSnapshot
+
+// SetResourceSnapshotFunc sets the function used to capture a resource
+// snapshot for each recorded request. A nil function disables snapshots.
+func (r *OpenAIRecorder) SetResourceSnapshotFunc(fn ResourceSnapshotFunc) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.snapshotFunc = fn
+}
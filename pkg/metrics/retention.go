@@ -0,0 +1,296 @@
+package metrics
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference/models"
+)
+
+// retentionSweepInterval is the interval at which the retention sweeper
+// enforces the record retention policy.
+const retentionSweepInterval = time.Hour
+
+// RetentionPolicy specifies how long and how many recorded requests are kept
+// and which models are allowed to have their request and response bodies
+// stored.
+type RetentionPolicy struct {
+	// MaxAge is the maximum age of a record before it's purged. A zero value
+	// disables age-based purging.
+	MaxAge time.Duration
+	// MaxRecords is the maximum number of records kept per model, beyond which
+	// the oldest are dropped. A zero value keeps 10 records per model.
+	MaxRecords int
+	// MaxSize is the maximum total size in bytes of the records of all models,
+	// as written to storage (or as they would be without storage), beyond
+	// which the oldest are purged whenever a record is written. A zero value
+	// disables size-based purging.
+	MaxSize int64
+	// ExcludeBodyModels lists the models (by reference or ID) for which
+	// request and response bodies are never stored.
+	ExcludeBodyModels []string
+	// StripReasoning indicates that reasoning content is removed from
+	// recorded responses to save space.
+	StripReasoning bool
+}
+
+// RecordingVerbosity specifies how much of each request is recorded.
+type RecordingVerbosity string
+
+const (
+	// RecordingFull records request and response bodies along with request
+	// metadata, subject to the retention policy.
+	RecordingFull RecordingVerbosity = "full"
+	// RecordingMetadata records only request metadata (e.g. status codes,
+	// timestamps, and user agents), never request or response bodies.
+	RecordingMetadata RecordingVerbosity = "metadata"
+)
+
+// SetVerbosity sets how much of each request is recorded. It only affects
+// requests recorded afterwards.
+func (r *OpenAIRecorder) SetVerbosity(verbosity RecordingVerbosity) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.verbosity = verbosity
+}
+
+// SetRetentionPolicy sets the record retention policy.
+func (r *OpenAIRecorder) SetRetentionPolicy(policy RetentionPolicy) {
+	excluded := make(map[string]struct{}, len(policy.ExcludeBodyModels))
+	for _, model := range policy.ExcludeBodyModels {
+		excluded[models.NormalizeModelName(model)] = struct{}{}
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.retention = policy
+	r.excludeBodyModels = excluded
+	// Without storage, record sizes are only measured while they're limited.
+	if r.storage == nil && policy.MaxSize > 0 {
+		for _, modelData := range r.records {
+			for _, record := range modelData.Records {
+				if _, ok := r.recordSizes[record.ID]; !ok {
+					r.persistRecord(record)
+				}
+			}
+		}
+	}
+}
+
+// shouldStoreBodies returns whether request and response bodies may be stored
+// for the specified model. The caller must hold the recorder lock.
+func (r *OpenAIRecorder) shouldStoreBodies(model, modelID string) bool {
+	if r.verbosity == RecordingMetadata {
+		return false
+	}
+	if _, excluded := r.excludeBodyModels[modelID]; excluded {
+		return false
+	}
+	_, excluded := r.excludeBodyModels[models.NormalizeModelName(model)]
+	return !excluded
+}
+
+// stripReasoningContent removes reasoning content from a recorded chat
+// completion response. If the response can't be parsed, it's returned
+// unmodified.
+func stripReasoningContent(response string) string {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(response), &parsed); err != nil {
+		return response
+	}
+	choices, ok := parsed["choices"].([]interface{})
+	if !ok {
+		return response
+	}
+
+	modified := false
+	for _, c := range choices {
+		choice, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		message, ok := choice["message"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := message["reasoning_content"]; ok {
+			delete(message, "reasoning_content")
+			modified = true
+		}
+	}
+	if !modified {
+		return response
+	}
+
+	stripped, err := json.Marshal(parsed)
+	if err != nil {
+		return response
+	}
+	return string(stripped)
+}
+
+// maxRecordsPerModel returns the maximum number of records kept per model.
+// The caller must hold the recorder lock.
+func (r *OpenAIRecorder) maxRecordsPerModel() int {
+	return cmp.Or(r.retention.MaxRecords, defaultMaxRecordsPerModel)
+}
+
+// dropOldestRecords drops the oldest records of a model beyond the specified
+// number and returns the number of records dropped. The caller must hold the
+// recorder lock.
+func (r *OpenAIRecorder) dropOldestRecords(modelData *ModelData, keep int) int {
+	excess := len(modelData.Records) - max(keep, 0)
+	if excess <= 0 {
+		return 0
+	}
+	r.unpersistRecords(modelData.Records[:excess]...)
+	n := copy(modelData.Records, modelData.Records[excess:])
+	clear(modelData.Records[n:])
+	modelData.Records = modelData.Records[:n]
+	return excess
+}
+
+// PurgeExpired removes the records that exceed the retention policy, i.e.
+// those older than its maximum age, beyond its maximum number of records per
+// model, or beyond its maximum total size, oldest first, and returns the
+// number of records removed.
+func (r *OpenAIRecorder) PurgeExpired() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var purged int
+	if r.retention.MaxAge > 0 {
+		cutoff := time.Now().Add(-r.retention.MaxAge).Unix()
+		for _, modelData := range r.records {
+			// Records are sorted chronologically.
+			expired, _ := slices.BinarySearchFunc(modelData.Records, cutoff, func(record *RequestResponsePair, cutoff int64) int {
+				return cmp.Compare(record.Timestamp, cutoff)
+			})
+			purged += r.dropOldestRecords(modelData, len(modelData.Records)-expired)
+		}
+		if purged > 0 {
+			r.log.Infof("Purged %d records older than %s", purged, r.retention.MaxAge)
+		}
+	}
+
+	// The maximum number of records may have been lowered since the records
+	// were recorded.
+	for _, modelData := range r.records {
+		purged += r.dropOldestRecords(modelData, r.maxRecordsPerModel())
+	}
+
+	purged += r.enforceMaxSize()
+	return purged
+}
+
+// setRecordSize sets the size of a record as persisted. The caller must hold
+// the recorder lock.
+func (r *OpenAIRecorder) setRecordSize(id string, size int64) {
+	r.recordsSize += size - r.recordSizes[id]
+	r.recordSizes[id] = size
+}
+
+// forgetRecordSize forgets the size of a removed record. The caller must hold
+// the recorder lock.
+func (r *OpenAIRecorder) forgetRecordSize(id string) {
+	r.recordsSize -= r.recordSizes[id]
+	delete(r.recordSizes, id)
+}
+
+// enforceMaxSize purges the oldest records of all models if their total size
+// exceeds the retention policy's maximum size, and returns the number of
+// records removed. It's called whenever a record is written, so that the
+// records never grow beyond the maximum size between sweeps. The caller must
+// hold the recorder lock.
+func (r *OpenAIRecorder) enforceMaxSize() int {
+	if r.retention.MaxSize <= 0 || r.recordsSize <= r.retention.MaxSize {
+		return 0
+	}
+	purged := r.purgeOversized()
+	if purged > 0 {
+		r.log.Infof("Purged %d records exceeding the maximum size of %d bytes", purged, r.retention.MaxSize)
+	}
+	return purged
+}
+
+// purgeOversized removes the oldest records of all models until their total
+// size is within the retention policy's maximum size, and returns the number
+// of records removed. The caller must hold the recorder lock.
+func (r *OpenAIRecorder) purgeOversized() int {
+	type modelRecord struct {
+		record    *RequestResponsePair
+		modelData *ModelData
+	}
+	var records []modelRecord
+	for _, modelData := range r.records {
+		for _, record := range modelData.Records {
+			records = append(records, modelRecord{record: record, modelData: modelData})
+		}
+	}
+	slices.SortStableFunc(records, func(a, b modelRecord) int {
+		return cmp.Compare(a.record.Timestamp, b.record.Timestamp)
+	})
+	total := r.recordsSize
+	oldest := make(map[*ModelData]int)
+	var purged int
+	for _, record := range records {
+		if total <= r.retention.MaxSize {
+			break
+		}
+		oldest[record.modelData]++
+		total -= r.recordSizes[record.record.ID]
+		purged++
+	}
+	for modelData, count := range oldest {
+		r.dropOldestRecords(modelData, len(modelData.Records)-count)
+	}
+	return purged
+}
+
+// PurgeModel removes all records and configuration for the specified model ID.
+// Unlike RemoveModel, it doesn't attempt to resolve the model reference, which
+// makes it suitable for use after the model has been deleted from the store.
+func (r *OpenAIRecorder) PurgeModel(modelID string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if modelData, exists := r.records[modelID]; exists {
+		delete(r.records, modelID)
+		r.unpersistModel(modelID, modelData)
+		r.log.Infof("Purged records for deleted model: %s", modelID)
+	}
+}
+
+// RunRetentionSweeper periodically enforces the retention policy until the
+// context is cancelled.
+func (r *OpenAIRecorder) RunRetentionSweeper(ctx context.Context) {
+	ticker := time.NewTicker(retentionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.PurgeExpired()
+		}
+	}
+}
+
+// PurgeHandler returns a handler that immediately enforces the retention
+// policy.
+func (r *OpenAIRecorder) PurgeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		purged := r.PurgeExpired()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ClearRecordsResponse{Deleted: purged}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -20,6 +20,10 @@ type SchedulerInterface interface {
 	GetRunningBackends(w http.ResponseWriter, r *http.Request)
 	GetLlamaCppSocket() (string, error)
 	GetAllActiveRunners() []ActiveRunner
+	UserAgentUsage() []UserAgentUsage
+	SlowClientIncidents() []SlowClientIncidents
+	InferenceTraffic() []InferenceTraffic
+	RequestQueues() []RequestQueueStats
 }
 
 // ActiveRunner contains information about an active runner
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// SlowClientIncidents counts the streams to a model whose clients read the
+// response slower than it was generated, until the stream's buffer filled up.
+type SlowClientIncidents struct {
+	Model string `json:"model"`
+	// Paused is the number of streams whose backend slot was paused until the
+	// client caught up.
+	Paused uint64 `json:"paused"`
+	// Dropped is the number of streams whose client was disconnected.
+	Dropped uint64 `json:"dropped"`
+}
+
+// SlowClientStats aggregates slow-client incidents by model.
+type SlowClientStats struct {
+	// m protects the fields below.
+	m sync.Mutex
+	// models is the set of tracked models.
+	models map[string]struct{}
+	// incidents maps models to their incidents.
+	incidents map[string]*SlowClientIncidents
+}
+
+// NewSlowClientStats creates a new slow-client incident aggregator.
+func NewSlowClientStats() *SlowClientStats {
+	return &SlowClientStats{
+		models:    make(map[string]struct{}),
+		incidents: make(map[string]*SlowClientIncidents),
+	}
+}
+
+// Record records a slow-client incident for a stream to the specified model,
+// whose client was either paused for or dropped.
+func (s *SlowClientStats) Record(model string, dropped bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	model = admitLabel(s.models, model, maxUsageModels)
+	incidents, ok := s.incidents[model]
+	if !ok {
+		incidents = &SlowClientIncidents{Model: model}
+		s.incidents[model] = incidents
+	}
+	if dropped {
+		incidents.Dropped++
+	} else {
+		incidents.Paused++
+	}
+}
+
+// Incidents returns the incidents, ordered by model.
+func (s *SlowClientStats) Incidents() []SlowClientIncidents {
+	s.m.Lock()
+	result := make([]SlowClientIncidents, 0, len(s.incidents))
+	for _, incidents := range s.incidents {
+		result = append(result, *incidents)
+	}
+	s.m.Unlock()
+
+	slices.SortFunc(result, func(a, b SlowClientIncidents) int {
+		return strings.Compare(a.Model, b.Model)
+	})
+	return result
+}
+
+// slowClientMetricFamilies returns Prometheus metric families for the
+// specified slow-client incidents.
+func slowClientMetricFamilies(incidents []SlowClientIncidents) map[string]*dto.MetricFamily {
+	if len(incidents) == 0 {
+		return nil
+	}
+	counterType := dto.MetricType_COUNTER
+	name := "model_runner_slow_client_incidents_total"
+	help := "Number of streamed responses whose clients read slower than generation until the stream's buffer filled up, by model and action."
+	metricFamily := &dto.MetricFamily{Name: &name, Help: &help, Type: &counterType}
+	for _, entry := range incidents {
+		for _, action := range []struct {
+			name  string
+			value uint64
+		}{
+			{name: "pause", value: entry.Paused},
+			{name: "drop", value: entry.Dropped},
+		} {
+			modelLabel, actionLabel := "model", "action"
+			value := float64(action.value)
+			metricFamily.Metric = append(metricFamily.Metric, &dto.Metric{
+				Label: []*dto.LabelPair{
+					{Name: &modelLabel, Value: &entry.Model},
+					{Name: &actionLabel, Value: &action.name},
+				},
+				Counter: &dto.Counter{Value: &value},
+			})
+		}
+	}
+	return map[string]*dto.MetricFamily{name: metricFamily}
+}
@@ -0,0 +1,209 @@
+package metrics
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+const (
+	// recordKeyPrefix prefixes the storage keys of records, which are
+	// followed by the record ID.
+	recordKeyPrefix = "recorder/records/"
+	// configKeyPrefix prefixes the storage keys of backend configurations,
+	// which are followed by the model ID.
+	configKeyPrefix = "recorder/configs/"
+)
+
+// SetStorage makes the recorder persist records and backend configurations
+// in kv, so that they survive restarts, and loads those persisted previously.
+// Records are persisted individually as they're recorded, deleted, or purged.
+func (r *OpenAIRecorder) SetStorage(kv storage.KV) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.audit {
+		if err := r.loadAuditLog(kv); err != nil {
+			return err
+		}
+	}
+
+	loaded := make(map[string]*ModelData)
+	modelData := func(modelID string) *ModelData {
+		if loaded[modelID] == nil {
+			loaded[modelID] = &ModelData{Records: make([]*RequestResponsePair, 0, defaultMaxRecordsPerModel)}
+		}
+		return loaded[modelID]
+	}
+
+	keys, err := kv.List(configKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("listing configurations: %w", err)
+	}
+	for _, key := range keys {
+		var config inference.BackendConfiguration
+		if err := getJSON(kv, key, &config); err != nil {
+			return err
+		}
+		modelData(strings.TrimPrefix(key, configKeyPrefix)).Config = config
+	}
+
+	if keys, err = kv.List(recordKeyPrefix); err != nil {
+		return fmt.Errorf("listing records: %w", err)
+	}
+	unsealed := make(map[string]bool)
+	sizes := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		data, err := kv.Get(key)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+		var persisted persistedRecord
+		if err := json.Unmarshal(data, &persisted); err != nil {
+			return fmt.Errorf("unmarshaling %s: %w", key, err)
+		}
+		record, err := r.openRecord(persisted)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+		if r.aead != nil && persisted.Sealed == "" {
+			unsealed[record.ID] = true
+		}
+		// Record IDs are the model ID followed by the time of the request.
+		separator := strings.LastIndex(record.ID, "_")
+		if separator < 0 {
+			r.log.Warnf("Ignoring persisted record with invalid ID %q", record.ID)
+			continue
+		}
+		modelData := modelData(record.ID[:separator])
+		modelData.Records = append(modelData.Records, record)
+		sizes[record.ID] = int64(len(data))
+	}
+
+	for modelID, data := range loaded {
+		slices.SortStableFunc(data.Records, func(a, b *RequestResponsePair) int {
+			return cmp.Compare(a.Timestamp, b.Timestamp)
+		})
+		// Drop records beyond the per-model limit, oldest first.
+		for len(data.Records) > r.maxRecordsPerModel() {
+			if err := kv.Delete(recordKeyPrefix + data.Records[0].ID); err != nil {
+				return fmt.Errorf("deleting record: %w", err)
+			}
+			r.appendAudit(kv, auditDelete, data.Records[0].ID, nil)
+			data.Records = data.Records[1:]
+		}
+		r.records[modelID] = data
+		for _, record := range data.Records {
+			r.setRecordSize(record.ID, sizes[record.ID])
+		}
+	}
+	r.storage = kv
+
+	// Encrypt the records persisted before encryption was enabled.
+	for _, data := range loaded {
+		for _, record := range data.Records {
+			if unsealed[record.ID] {
+				r.persistRecord(record)
+			}
+		}
+	}
+	r.enforceMaxSize()
+	return nil
+}
+
+// getJSON unmarshals the value of a key.
+func getJSON(kv storage.KV, key string, v any) error {
+	data, err := kv.Get(key)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", key, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unmarshaling %s: %w", key, err)
+	}
+	return nil
+}
+
+// putJSON marshals v as the value of a key.
+func (r *OpenAIRecorder) putJSON(key string, v any) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = r.storage.Put(key, data)
+	}
+	if err != nil {
+		r.log.Warnf("Failed to persist %s: %v", key, err)
+	}
+}
+
+// persistRecord persists a record and records its size as persisted. Without
+// storage, only the size that the record would be persisted with is recorded,
+// if the retention policy limits the size of the records. The caller must hold
+// r.m.
+func (r *OpenAIRecorder) persistRecord(record *RequestResponsePair) {
+	if r.storage == nil {
+		if r.retention.MaxSize > 0 {
+			if data, err := json.Marshal(record); err == nil {
+				r.setRecordSize(record.ID, int64(len(data)))
+			}
+		}
+		return
+	}
+	persisted, err := r.sealRecord(record)
+	if err != nil {
+		r.log.Warnf("Failed to encrypt record %s: %v", record.ID, err)
+		return
+	}
+	// The record is marshaled here rather than by putJSON, so that the audit
+	// log holds the digest of the bytes as persisted.
+	data, err := json.Marshal(persisted)
+	if err == nil {
+		err = r.storage.Put(recordKeyPrefix+record.ID, data)
+	}
+	if err != nil {
+		r.log.Warnf("Failed to persist %s: %v", recordKeyPrefix+record.ID, err)
+		return
+	}
+	r.setRecordSize(record.ID, int64(len(data)))
+	r.appendAudit(r.storage, auditPut, record.ID, data)
+}
+
+// persistConfig persists the backend configuration of a model. The caller
+// must hold r.m.
+func (r *OpenAIRecorder) persistConfig(modelID string, config inference.BackendConfiguration) {
+	if r.storage != nil {
+		r.putJSON(configKeyPrefix+modelID, config)
+	}
+}
+
+// unpersistRecords deletes persisted records. The caller must hold r.m.
+func (r *OpenAIRecorder) unpersistRecords(records ...*RequestResponsePair) {
+	for _, record := range records {
+		r.forgetRecordSize(record.ID)
+	}
+	if r.storage == nil {
+		return
+	}
+	for _, record := range records {
+		if err := r.storage.Delete(recordKeyPrefix + record.ID); err != nil {
+			r.log.Warnf("Failed to delete persisted record %s: %v", record.ID, err)
+			continue
+		}
+		r.appendAudit(r.storage, auditDelete, record.ID, nil)
+	}
+}
+
+// unpersistModel deletes the persisted records and backend configuration of a
+// model. The caller must hold r.m.
+func (r *OpenAIRecorder) unpersistModel(modelID string, data *ModelData) {
+	r.unpersistRecords(data.Records...)
+	if r.storage == nil {
+		return
+	}
+	if err := r.storage.Delete(configKeyPrefix + modelID); err != nil {
+		r.log.Warnf("Failed to delete persisted configuration for %s: %v", modelID, err)
+	}
+}
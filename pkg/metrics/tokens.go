@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxTokenUsageKeys is the maximum number of distinct API keys tracked for
+// token usage. Requests with additional keys are aggregated under "other".
+const maxTokenUsageKeys = 1000
+
+// TokenUsage totals the tokens used by the requests made with an API key (or
+// other credentials) to a model, as reported in the usage of their responses.
+type TokenUsage struct {
+	APIKey           string    `json:"api_key"`
+	Model            string    `json:"model"`
+	Requests         uint64    `json:"requests"`
+	PromptTokens     uint64    `json:"prompt_tokens"`
+	CompletionTokens uint64    `json:"completion_tokens"`
+	TotalTokens      uint64    `json:"total_tokens"`
+	LastUsed         time.Time `json:"last_used,omitzero"`
+}
+
+// tokenUsageKey identifies a token usage aggregate.
+type tokenUsageKey struct {
+	apiKey string
+	model  string
+}
+
+// TokenUsageStats aggregates the token usage of inference requests by API key
+// and model.
+type TokenUsageStats struct {
+	// m protects the fields below.
+	m sync.Mutex
+	// apiKeys is the set of tracked API keys.
+	apiKeys map[string]struct{}
+	// models is the set of tracked models.
+	models map[string]struct{}
+	// usage maps API keys and models to their usage.
+	usage map[tokenUsageKey]*TokenUsage
+}
+
+// NewTokenUsageStats creates a new token usage aggregator.
+func NewTokenUsageStats() *TokenUsageStats {
+	return &TokenUsageStats{
+		apiKeys: make(map[string]struct{}),
+		models:  make(map[string]struct{}),
+		usage:   make(map[tokenUsageKey]*TokenUsage),
+	}
+}
+
+// Record records a request made with an API key to a model, along with the
+// token usage reported by its response, written to a response writer created
+// by NewResponseRecorder. The usage of streamed responses is the one reported
+// by their last chunk, which clients request with stream_options.include_usage.
+func (s *TokenUsageStats) Record(apiKey, model string, rw http.ResponseWriter) {
+	var usage TokenCounts
+	if ResponseStatusCode(rw) < http.StatusBadRequest {
+		usage, _ = ResponseUsage(rw)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	key := tokenUsageKey{
+		apiKey: admitLabel(s.apiKeys, apiKey, maxTokenUsageKeys),
+		model:  admitLabel(s.models, model, maxUsageModels),
+	}
+	entry, ok := s.usage[key]
+	if !ok {
+		entry = &TokenUsage{APIKey: key.apiKey, Model: key.model}
+		s.usage[key] = entry
+	}
+	entry.Requests++
+	entry.PromptTokens += uint64(max(usage.PromptTokens, 0))
+	entry.CompletionTokens += uint64(max(usage.CompletionTokens, 0))
+	entry.TotalTokens += uint64(max(usage.TotalTokens, 0))
+	entry.LastUsed = time.Now()
+}
+
+// Usage returns the token usage of the requests made with an API key to a
+// model, ordered by descending total tokens. Empty API keys or models match
+// all of them.
+func (s *TokenUsageStats) Usage(apiKey, model string) []TokenUsage {
+	s.m.Lock()
+	result := make([]TokenUsage, 0, len(s.usage))
+	for key, entry := range s.usage {
+		if (apiKey == "" || key.apiKey == apiKey) && (model == "" || key.model == model) {
+			result = append(result, *entry)
+		}
+	}
+	s.m.Unlock()
+
+	slices.SortFunc(result, func(a, b TokenUsage) int {
+		return cmp.Or(
+			cmp.Compare(b.TotalTokens, a.TotalTokens),
+			cmp.Compare(a.APIKey, b.APIKey),
+			cmp.Compare(a.Model, b.Model),
+		)
+	})
+	return result
+}
+
+// Totals returns the token usage of the requests made with an API key to a
+// model, summed over all API keys or models if they're empty.
+func (s *TokenUsageStats) Totals(apiKey, model string) TokenUsage {
+	totals := TokenUsage{APIKey: apiKey, Model: model}
+	for _, entry := range s.Usage(apiKey, model) {
+		totals.Requests += entry.Requests
+		totals.PromptTokens += entry.PromptTokens
+		totals.CompletionTokens += entry.CompletionTokens
+		totals.TotalTokens += entry.TotalTokens
+		if entry.LastUsed.After(totals.LastUsed) {
+			totals.LastUsed = entry.LastUsed
+		}
+	}
+	return totals
+}
+
+// Handler returns a handler that serves the token usage, optionally filtered
+// by the api_key and model query parameters.
+func (s *TokenUsageStats) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.Usage(query.Get("api_key"), query.Get("model"))); err != nil {
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefaultMaxUserAgents is the default maximum number of distinct user agents
+// tracked for usage analytics.
+const DefaultMaxUserAgents = 100
+
+const (
+	// maxUsageModels is the maximum number of distinct models tracked for
+	// usage analytics. Backends that manage models externally accept arbitrary
+	// model names, so these are capped as well.
+	maxUsageModels = 100
+	// unknownUserAgent is the user agent reported for requests without one.
+	unknownUserAgent = "unknown"
+	// otherLabel is the user agent or model reported for requests that exceed
+	// the cardinality caps.
+	otherLabel = "other"
+	// maxUserAgentNameLength is the maximum length of a normalized user agent
+	// name.
+	maxUserAgentNameLength = 64
+)
+
+// UserAgentUsage reports the requests made by an application (identified by
+// its normalized user agent) to a model.
+type UserAgentUsage struct {
+	UserAgent string    `json:"user_agent"`
+	Model     string    `json:"model"`
+	Requests  uint64    `json:"requests"`
+	Errors    uint64    `json:"errors"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// usageKey identifies a usage aggregate.
+type usageKey struct {
+	userAgent string
+	model     string
+}
+
+// UsageStats aggregates inference requests by normalized user agent and model.
+type UsageStats struct {
+	// m protects the fields below.
+	m sync.Mutex
+	// maxUserAgents is the maximum number of distinct user agents tracked.
+	// Requests from additional user agents are aggregated under "other".
+	maxUserAgents int
+	// userAgents is the set of tracked user agents.
+	userAgents map[string]struct{}
+	// models is the set of tracked models.
+	models map[string]struct{}
+	// usage maps user agents and models to their usage.
+	usage map[usageKey]*UserAgentUsage
+}
+
+// NewUsageStats creates a new usage aggregator tracking at most maxUserAgents
+// distinct user agents. A non-positive limit uses DefaultMaxUserAgents.
+func NewUsageStats(maxUserAgents int) *UsageStats {
+	if maxUserAgents <= 0 {
+		maxUserAgents = DefaultMaxUserAgents
+	}
+	return &UsageStats{
+		maxUserAgents: maxUserAgents,
+		userAgents:    make(map[string]struct{}),
+		models:        make(map[string]struct{}),
+		usage:         make(map[usageKey]*UserAgentUsage),
+	}
+}
+
+// NormalizeUserAgent reduces a user agent to the name and major.minor version
+// of the client that sent it (e.g. "OpenAI/Python 1.40.3" becomes
+// "OpenAI/Python/1.40" and "curl/8.4.0" becomes "curl/8.4"), discarding
+// comments and secondary products.
+func NormalizeUserAgent(userAgent string) string {
+	var tokens []string
+	for _, token := range strings.Fields(userAgent) {
+		if strings.HasPrefix(token, "(") {
+			break
+		}
+		tokens = append(tokens, token)
+	}
+	if len(tokens) == 0 {
+		return unknownUserAgent
+	}
+
+	name, version := tokens[0], ""
+	if i := strings.LastIndex(name, "/"); i >= 0 && startsWithDigit(name[i+1:]) {
+		name, version = name[:i], name[i+1:]
+	} else if len(tokens) > 1 && startsWithDigit(tokens[1]) {
+		// Some SDKs separate the version with a space.
+		version = tokens[1]
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("._-/", r):
+			return r
+		}
+		return -1
+	}, name)
+	if len(name) > maxUserAgentNameLength {
+		name = name[:maxUserAgentNameLength]
+	}
+	if name == "" {
+		return unknownUserAgent
+	}
+
+	// Keep only the major and minor version to limit cardinality.
+	if end := strings.IndexFunc(version, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); end >= 0 {
+		version = version[:end]
+	}
+	parts := strings.FieldsFunc(version, func(r rune) bool { return r == '.' })
+	if len(parts) == 0 {
+		return name
+	}
+	return name + "/" + strings.Join(parts[:min(len(parts), 2)], ".")
+}
+
+// startsWithDigit returns whether s starts with an ASCII digit.
+func startsWithDigit(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// Record records a request from the specified user agent to the specified
+// model, along with the response status code.
+func (u *UsageStats) Record(userAgent, model string, statusCode int) {
+	userAgent = NormalizeUserAgent(userAgent)
+
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	userAgent = admitLabel(u.userAgents, userAgent, u.maxUserAgents)
+	model = admitLabel(u.models, model, maxUsageModels)
+
+	key := usageKey{userAgent: userAgent, model: model}
+	usage, ok := u.usage[key]
+	if !ok {
+		usage = &UserAgentUsage{UserAgent: userAgent, Model: model}
+		u.usage[key] = usage
+	}
+	usage.Requests++
+	if statusCode >= http.StatusBadRequest {
+		usage.Errors++
+	}
+	usage.LastSeen = time.Now()
+}
+
+// admitLabel adds a label value to the set of tracked values if there's room,
+// returning the value to use. Values that don't fit are reported as "other".
+func admitLabel(tracked map[string]struct{}, value string, limit int) string {
+	if _, ok := tracked[value]; ok {
+		return value
+	}
+	if len(tracked) >= limit {
+		return otherLabel
+	}
+	tracked[value] = struct{}{}
+	return value
+}
+
+// SetMaxUserAgents sets the maximum number of distinct user agents tracked. A
+// non-positive limit uses DefaultMaxUserAgents. User agents that are already
+// tracked remain tracked.
+func (u *UsageStats) SetMaxUserAgents(maxUserAgents int) {
+	if maxUserAgents <= 0 {
+		maxUserAgents = DefaultMaxUserAgents
+	}
+	u.m.Lock()
+	defer u.m.Unlock()
+	u.maxUserAgents = maxUserAgents
+}
+
+// Usage returns the usage aggregates, ordered by descending request count.
+func (u *UsageStats) Usage() []UserAgentUsage {
+	u.m.Lock()
+	result := make([]UserAgentUsage, 0, len(u.usage))
+	for _, usage := range u.usage {
+		result = append(result, *usage)
+	}
+	u.m.Unlock()
+
+	slices.SortFunc(result, func(a, b UserAgentUsage) int {
+		if a.Requests != b.Requests {
+			if a.Requests > b.Requests {
+				return -1
+			}
+			return 1
+		}
+		if c := strings.Compare(a.UserAgent, b.UserAgent); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Model, b.Model)
+	})
+	return result
+}
+
+// UsageHandler returns a handler that serves the usage aggregates, optionally
+// filtered by the model query parameter.
+func (u *UsageStats) UsageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		usage := u.Usage()
+		if model := req.URL.Query().Get("model"); model != "" {
+			usage = slices.DeleteFunc(usage, func(entry UserAgentUsage) bool {
+				return entry.Model != model
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(usage); err != nil {
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// usageMetricFamilies returns Prometheus metric families for the specified
+// usage aggregates.
+func usageMetricFamilies(usage []UserAgentUsage) map[string]*dto.MetricFamily {
+	if len(usage) == 0 {
+		return nil
+	}
+	counterType := dto.MetricType_COUNTER
+	families := make(map[string]*dto.MetricFamily, 2)
+	for _, family := range []struct {
+		name  string
+		help  string
+		value func(UserAgentUsage) uint64
+	}{
+		{
+			name:  "model_runner_user_agent_requests_total",
+			help:  "Number of inference requests by normalized user agent and model.",
+			value: func(entry UserAgentUsage) uint64 { return entry.Requests },
+		},
+		{
+			name:  "model_runner_user_agent_errors_total",
+			help:  "Number of failed inference requests by normalized user agent and model.",
+			value: func(entry UserAgentUsage) uint64 { return entry.Errors },
+		},
+	} {
+		metricFamily := &dto.MetricFamily{Name: &family.name, Help: &family.help, Type: &counterType}
+		for _, entry := range usage {
+			modelLabel, userAgentLabel := "model", "user_agent"
+			value := float64(family.value(entry))
+			metricFamily.Metric = append(metricFamily.Metric, &dto.Metric{
+				Label: []*dto.LabelPair{
+					{Name: &modelLabel, Value: &entry.Model},
+					{Name: &userAgentLabel, Value: &entry.UserAgent},
+				},
+				Counter: &dto.Counter{Value: &value},
+			})
+		}
+		families[family.name] = metricFamily
+	}
+	return families
+}
@@ -0,0 +1,405 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Role grants access to a group of routes. Each role includes the access of
+// the roles below it.
+type Role string
+
+const (
+	// RoleInference grants access to inference and to model and status
+	// queries.
+	RoleInference Role = "inference"
+	// RoleModelManager additionally grants access to pulling, pushing,
+	// deleting, loading, and configuring models.
+	RoleModelManager Role = "model-manager"
+	// RoleAdmin grants access to every route, including recorded requests,
+	// metrics, and runtime settings.
+	RoleAdmin Role = "admin"
+)
+
+// roles are the valid roles, from least to most privileged.
+var roles = []Role{RoleInference, RoleModelManager, RoleAdmin}
+
+// ParseRole parses the name of a role.
+func ParseRole(name string) (Role, error) {
+	if !slices.Contains(roles, Role(name)) {
+		return "", fmt.Errorf("unknown role %q, expected one of inference, model-manager, or admin", name)
+	}
+	return Role(name), nil
+}
+
+// Includes returns whether the role includes the access of another role.
+func (r Role) Includes(other Role) bool {
+	return slices.Index(roles, r) >= slices.Index(roles, other)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, rejecting unknown roles.
+func (r *Role) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	if name == "" {
+		*r = ""
+		return nil
+	}
+	role, err := ParseRole(name)
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// AnonymousNamespace is the name and namespace of requests without
+// credentials.
+const AnonymousNamespace = "anonymous"
+
+// Identity is the authenticated identity of a request.
+type Identity struct {
+	// Name identifies the credentials of the request. It's given by
+	// APIKeyName for API keys, and it's the identity of client
+	// certificates and the subject of tokens.
+	Name string
+	// Namespace is the namespace that the request is accounted to, e.g. for
+	// quotas. It's the name unless the access policy maps the name to
+	// another namespace.
+	Namespace string
+	// Role is the role granted to the request.
+	Role Role
+	// ModelLabels are the labels that models must have for the request to
+	// use them, set from the access policy's model rules. A label with an
+	// empty value only needs to be present.
+	ModelLabels map[string]string
+}
+
+// identityKey is the context key of the identity of a request.
+type identityKey struct{}
+
+// WithIdentity returns a context carrying an identity.
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity set by AccessControlMiddleware, if
+// any.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// APIKeyName returns the name of an API key, which is "key-" followed by the
+// first 12 hex digits of its SHA-256 hash, so that it doesn't reveal the key.
+func APIKeyName(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(hash[:6])
+}
+
+// TokenValidator validates bearer tokens that aren't API keys, such as JSON
+// Web Tokens issued by an identity provider, and returns their identity. The
+// name of the identity is the token's subject, and its namespace is set by
+// AccessControlMiddleware.
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (Identity, error)
+}
+
+// FailureTracker tracks failed authentication attempts by source, e.g. to lock
+// out sources attempting to guess API keys. Sources are client addresses, or
+// LocalSource for requests without one, which all local clients share.
+type FailureTracker interface {
+	// Locked returns whether a source is locked out, and if so, for how long.
+	Locked(source string) (time.Duration, bool)
+	// Failure records a failed authentication attempt by a source.
+	Failure(source, reason string)
+	// Success records a successful authentication by a source.
+	Success(source string)
+}
+
+// LocalSource is the source of requests without a client address, such as
+// requests over Unix sockets.
+const LocalSource = "local"
+
+// requestSource returns the source of a request for a FailureTracker.
+func requestSource(r *http.Request) string {
+	if address := ClientAddress(r); address != "" {
+		return address
+	}
+	return LocalSource
+}
+
+// InferenceRoutes are the routes that require the inference role for all
+// methods, in the syntax of CompressionConfig.Routes, where a trailing "/..."
+// also matches any path below the route.
+var InferenceRoutes = append(slices.Clone(DefaultReadOnlyRoutes),
+	"/engines/v1/pii/detect",
+	"/v1/pii/detect",
+	"/engines/v1/files/...",
+	"/v1/files/...",
+	"/engines/v1/batches/...",
+	"/v1/batches/...",
+)
+
+// InferenceQueryRoutes are the routes that require the inference role for
+// safe methods (GET, HEAD, and OPTIONS), along with the root path.
+var InferenceQueryRoutes = []string{
+	"/models/...",
+	"/engines/v1/models/...",
+	"/engines/*/v1/models/...",
+	"/v1/models/...",
+	"/engines/status",
+	"/engines/ps",
+	"/engines/features",
+	"/engines/provenance",
+	"/features",
+	"/engines/version",
+	"/version",
+	"/engines/v1/prompt_templates/...",
+	"/v1/prompt_templates/...",
+	"/api/tags",
+	"/api/version",
+	"/api/ps",
+}
+
+// ModelManagerRoutes are the routes that require the model-manager role for
+// all methods. All other routes require the admin role.
+var ModelManagerRoutes = []string{
+	"/models/...",
+	"/api/pull",
+	"/api/push",
+	"/api/delete",
+	"/api/copy",
+	"/api/create",
+	"/engines/unload",
+	"/engines/_configure",
+	"/engines/*/_configure",
+	"/engines/pins/...",
+	"/engines/loads",
+	"/engines/df",
+}
+
+// RequiredRole returns the role required to make a request.
+func RequiredRole(r *http.Request) Role {
+	switch {
+	case routeMatches(InferenceRoutes, r.URL.Path):
+		return RoleInference
+	case isSafeMethod(r.Method) && (r.URL.Path == "/" || routeMatches(InferenceQueryRoutes, r.URL.Path)):
+		return RoleInference
+	case routeMatches(ModelManagerRoutes, r.URL.Path):
+		return RoleModelManager
+	default:
+		return RoleAdmin
+	}
+}
+
+// isSafeMethod returns whether a method doesn't modify state.
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// ModelRule restricts the models that requests with some roles may use to
+// those with the specified labels, e.g. so that only approved models are
+// served to external clients.
+type ModelRule struct {
+	// Roles are the roles that the rule applies to. Unlike route access, a
+	// rule doesn't apply to more privileged roles unless they're listed.
+	Roles []Role `json:"roles"`
+	// Labels are the labels that models must have. A label with an empty
+	// value only needs to be present.
+	Labels map[string]string `json:"labels"`
+}
+
+// AccessPolicy binds identities to roles.
+type AccessPolicy struct {
+	// APIKeys maps the API keys that clients present as bearer tokens to
+	// their roles.
+	APIKeys map[string]Role `json:"api_keys,omitempty"`
+	// Identities maps the common names and DNS names of verified client
+	// certificates to their roles.
+	Identities map[string]Role `json:"identities,omitempty"`
+	// Anonymous is the role of requests without credentials. If it's empty,
+	// such requests are rejected.
+	Anonymous Role `json:"anonymous,omitempty"`
+	// Namespaces maps the names of identities to the namespaces that their
+	// requests are accounted to, so that several identities can share a
+	// namespace. See Identity.Name.
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+	// ModelRules restrict the models that requests may use by their labels.
+	ModelRules []ModelRule `json:"model_rules,omitempty"`
+	// Tokens validates bearer tokens that aren't API keys, if set.
+	Tokens TokenValidator `json:"-"`
+	// Failures tracks failed authentication attempts and rejects requests
+	// from locked-out sources, if set.
+	Failures FailureTracker `json:"-"`
+}
+
+// LoadAccessPolicy loads an access policy from a JSON file.
+func LoadAccessPolicy(path string) (AccessPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return AccessPolicy{}, err
+	}
+	var policy AccessPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return AccessPolicy{}, fmt.Errorf("parsing access policy: %w", err)
+	}
+	for key, role := range policy.APIKeys {
+		if key == "" || role == "" {
+			return AccessPolicy{}, fmt.Errorf("API keys must be non-empty and have a role")
+		}
+	}
+	for identity, role := range policy.Identities {
+		if role == "" {
+			return AccessPolicy{}, fmt.Errorf("identity %q has no role", identity)
+		}
+	}
+	for identity, namespace := range policy.Namespaces {
+		if namespace == "" {
+			return AccessPolicy{}, fmt.Errorf("identity %q has an empty namespace", identity)
+		}
+	}
+	for i, rule := range policy.ModelRules {
+		if len(rule.Roles) == 0 || len(rule.Labels) == 0 {
+			return AccessPolicy{}, fmt.Errorf("model rule %d must have roles and labels", i)
+		}
+	}
+	return policy, nil
+}
+
+// AccessControlMiddleware enforces the access policy on each request, based
+// on the role returned by RequiredRole. Requests with an API key use its
+// role (or the role of a token accepted by the policy's token validator), then
+// requests with a verified client certificate use the role of its identity,
+// and other requests use the anonymous role. Requests without an
+// acceptable identity are rejected with a 401 response, and requests whose
+// role is insufficient with a 403 response. The identity of accepted
+// requests is available from IdentityFromContext, along with the model
+// labels required by the policy's model rules. If the policy tracks failures,
+// requests with invalid credentials are recorded as failures, and requests
+// from locked-out sources are rejected with a 429 response.
+func AccessControlMiddleware(policy AccessPolicy, next http.Handler) http.Handler {
+	// Keys are looked up by hash so that lookups don't leak their contents
+	// through timing.
+	apiKeys := make(map[[sha256.Size]byte]Identity, len(policy.APIKeys))
+	for key, role := range policy.APIKeys {
+		apiKeys[sha256.Sum256([]byte(key))] = Identity{Name: APIKeyName(key), Role: role}
+	}
+	modelLabels := make(map[Role]map[string]string, len(roles))
+	for _, role := range roles {
+		modelLabels[role] = policy.modelLabels(role)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Let CORS preflight requests through, since browsers never send
+		// credentials with them.
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		source := requestSource(r)
+		if policy.Failures != nil {
+			if remaining, locked := policy.Failures.Locked(source); locked {
+				w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Round(time.Second).Seconds())+1))
+				http.Error(w, "too many failed authentication attempts", http.StatusTooManyRequests)
+				return
+			}
+		}
+		// reject rejects a request with invalid credentials.
+		reject := func(challenge, message string) {
+			if policy.Failures != nil {
+				policy.Failures.Failure(source, message)
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, message, http.StatusUnauthorized)
+		}
+
+		var identity Identity
+		if authorization := r.Header.Get("Authorization"); authorization != "" {
+			scheme, token, _ := strings.Cut(authorization, " ")
+			token = strings.TrimSpace(token)
+			if strings.EqualFold(scheme, "Bearer") {
+				identity = apiKeys[sha256.Sum256([]byte(token))]
+			}
+			if identity.Role == "" && strings.EqualFold(scheme, "Bearer") && policy.Tokens != nil {
+				var err error
+				if identity, err = policy.Tokens.ValidateToken(r.Context(), token); err != nil {
+					reject(`Bearer error="invalid_token"`, fmt.Sprintf("invalid token: %v", err))
+					return
+				}
+			}
+			if identity.Role == "" {
+				reject("Bearer", "invalid API key")
+				return
+			}
+			if policy.Failures != nil {
+				policy.Failures.Success(source)
+			}
+		} else if identity = certificateIdentity(policy, r); identity.Role == "" {
+			identity = Identity{Name: AnonymousNamespace, Role: policy.Anonymous}
+		}
+		if identity.Role == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		if required := RequiredRole(r); !identity.Role.Includes(required) {
+			http.Error(w, fmt.Sprintf("%s %s requires the %s role", r.Method, r.URL.Path, required), http.StatusForbidden)
+			return
+		}
+		identity.Namespace = identity.Name
+		if namespace, ok := policy.Namespaces[identity.Name]; ok {
+			identity.Namespace = namespace
+		}
+		identity.ModelLabels = modelLabels[identity.Role]
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+// modelLabels returns the labels that the model rules require models to have
+// for a role, or nil if no rule applies to it.
+func (p AccessPolicy) modelLabels(role Role) map[string]string {
+	var labels map[string]string
+	for _, rule := range p.ModelRules {
+		if !slices.Contains(rule.Roles, role) {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string, len(rule.Labels))
+		}
+		maps.Copy(labels, rule.Labels)
+	}
+	return labels
+}
+
+// certificateIdentity returns the identity of the request's verified client
+// certificate, if any.
+func certificateIdentity(policy AccessPolicy, r *http.Request) Identity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Identity{}
+	}
+	certificate := r.TLS.VerifiedChains[0][0]
+	if role := policy.Identities[certificate.Subject.CommonName]; role != "" && certificate.Subject.CommonName != "" {
+		return Identity{Name: certificate.Subject.CommonName, Role: role}
+	}
+	for _, name := range certificate.DNSNames {
+		if role := policy.Identities[name]; role != "" {
+			return Identity{Name: name, Role: role}
+		}
+	}
+	return Identity{}
+}
@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRequiredRole(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		method string
+		path   string
+		want   Role
+	}{
+		{method: http.MethodPost, path: "/engines/llama.cpp/v1/chat/completions", want: RoleInference},
+		{method: http.MethodPost, path: "/v1/files", want: RoleInference},
+		{method: http.MethodGet, path: "/v1/batches/batch_1", want: RoleInference},
+		{method: http.MethodGet, path: "/", want: RoleInference},
+		{method: http.MethodGet, path: "/models", want: RoleInference},
+		{method: http.MethodGet, path: "/models/ai/smollm2/", want: RoleInference},
+		{method: http.MethodGet, path: "/engines/llama.cpp/v1/models/ai/smollm2", want: RoleInference},
+		{method: http.MethodPost, path: "/models/create", want: RoleModelManager},
+		{method: http.MethodDelete, path: "/models/ai/smollm2", want: RoleModelManager},
+		{method: http.MethodPost, path: "/engines/llama.cpp/_configure", want: RoleModelManager},
+		{method: http.MethodPost, path: "/api/pull", want: RoleModelManager},
+		{method: http.MethodGet, path: "/engines/requests", want: RoleAdmin},
+		{method: http.MethodPost, path: "/engines/maintenance", want: RoleAdmin},
+		{method: http.MethodGet, path: "/metrics", want: RoleAdmin},
+		{method: http.MethodPost, path: "/v1/prompt_templates", want: RoleAdmin},
+	}
+	for _, tt := range tests {
+		if got := RequiredRole(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Errorf("%s %s: expected role %s, got %s", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestAccessControlMiddleware(t *testing.T) {
+	t.Parallel()
+
+	handler := AccessControlMiddleware(AccessPolicy{
+		APIKeys:    map[string]Role{"ops-key": RoleModelManager, "admin-key": RoleAdmin},
+		Identities: map[string]Role{"ci.example.com": RoleAdmin},
+		Anonymous:  RoleInference,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method        string
+		path          string
+		authorization string
+		identity      string
+		want          int
+	}{
+		{method: http.MethodPost, path: "/engines/v1/chat/completions", want: http.StatusOK},
+		{method: http.MethodPost, path: "/models/create", want: http.StatusForbidden},
+		{method: http.MethodOptions, path: "/models/create", want: http.StatusOK},
+		{method: http.MethodPost, path: "/models/create", authorization: "Bearer ops-key", want: http.StatusOK},
+		{method: http.MethodGet, path: "/engines/requests", authorization: "Bearer ops-key", want: http.StatusForbidden},
+		{method: http.MethodGet, path: "/engines/requests", authorization: "bearer admin-key", want: http.StatusOK},
+		{method: http.MethodPost, path: "/engines/v1/chat/completions", authorization: "Bearer wrong", want: http.StatusUnauthorized},
+		{method: http.MethodPost, path: "/engines/v1/chat/completions", authorization: "Basic b3BzLWtleQ==", want: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/engines/requests", identity: "ci.example.com", want: http.StatusOK},
+		{method: http.MethodGet, path: "/engines/requests", identity: "other.example.com", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		if tt.identity != "" {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: tt.identity}}}}}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s (%q, %q): expected status %d, got %d", tt.method, tt.path, tt.authorization, tt.identity, tt.want, rec.Code)
+		}
+	}
+
+	// Without an anonymous role, requests must authenticate.
+	handler = AccessControlMiddleware(AccessPolicy{}, http.NotFoundHandler())
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/models", nil))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("Expected an authentication challenge, got status %d", rec.Code)
+	}
+}
+
+// tokenValidator accepts a single token.
+type tokenValidator struct{}
+
+func (tokenValidator) ValidateToken(_ context.Context, token string) (Identity, error) {
+	if token != "header.claims.signature" {
+		return Identity{}, errors.New("invalid signature")
+	}
+	return Identity{Name: "ci", Role: RoleModelManager}, nil
+}
+
+func TestAccessControlMiddlewareTokens(t *testing.T) {
+	t.Parallel()
+
+	handler := AccessControlMiddleware(AccessPolicy{
+		APIKeys: map[string]Role{"admin-key": RoleAdmin},
+		Tokens:  tokenValidator{},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		token string
+		path  string
+		want  int
+	}{
+		{token: "admin-key", path: "/engines/requests", want: http.StatusOK},
+		{token: "header.claims.signature", path: "/models/create", want: http.StatusOK},
+		{token: "header.claims.signature", path: "/engines/requests", want: http.StatusForbidden},
+		{token: "header.claims.forged", path: "/models/create", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s with %q: expected status %d, got %d", tt.path, tt.token, tt.want, rec.Code)
+		}
+	}
+}
+
+// failureTracker is a FailureTracker locking out sources after two failures.
+type failureTracker struct {
+	failures map[string]int
+}
+
+func (t *failureTracker) Locked(source string) (time.Duration, bool) {
+	return time.Minute, t.failures[source] >= 2
+}
+
+func (t *failureTracker) Failure(source, _ string) {
+	t.failures[source]++
+}
+
+func (t *failureTracker) Success(source string) {
+	delete(t.failures, source)
+}
+
+func TestAccessControlMiddlewareFailures(t *testing.T) {
+	t.Parallel()
+
+	tracker := &failureTracker{failures: make(map[string]int)}
+	handler := AccessControlMiddleware(AccessPolicy{
+		APIKeys:  map[string]Role{"admin-key": RoleAdmin},
+		Failures: tracker,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		remoteAddr string
+		token      string
+		want       int
+	}{
+		{remoteAddr: "192.0.2.1:4711", token: "guess-1", want: http.StatusUnauthorized},
+		{remoteAddr: "192.0.2.1:4711", token: "admin-key", want: http.StatusOK},
+		{remoteAddr: "192.0.2.1:4711", token: "guess-2", want: http.StatusUnauthorized},
+		{remoteAddr: "192.0.2.1:4711", token: "", want: http.StatusUnauthorized},
+		{remoteAddr: "192.0.2.1:4711", token: "guess-3", want: http.StatusUnauthorized},
+		{remoteAddr: "192.0.2.1:4711", token: "admin-key", want: http.StatusTooManyRequests},
+		{remoteAddr: "192.0.2.2:4711", token: "admin-key", want: http.StatusOK},
+		{remoteAddr: "@", token: "guess-4", want: http.StatusUnauthorized},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/engines/requests", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("request %d from %s with %q: expected status %d, got %d", i, tt.remoteAddr, tt.token, tt.want, rec.Code)
+		}
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("request %d: expected a Retry-After header", i)
+		}
+	}
+	if tracker.failures[LocalSource] != 1 {
+		t.Errorf("Expected a failure from the local source, got %d", tracker.failures[LocalSource])
+	}
+}
+
+func TestAccessControlMiddlewareNamespaces(t *testing.T) {
+	t.Parallel()
+
+	var namespace string
+	handler := AccessControlMiddleware(AccessPolicy{
+		APIKeys:    map[string]Role{"team-key": RoleInference, "other-key": RoleInference},
+		Anonymous:  RoleInference,
+		Tokens:     tokenValidator{},
+		Namespaces: map[string]string{APIKeyName("team-key"): "team", "ci": "team"},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := IdentityFromContext(r.Context())
+		namespace = identity.Namespace
+	}))
+
+	for token, want := range map[string]string{
+		"":                        AnonymousNamespace,
+		"team-key":                "team",
+		"header.claims.signature": "team",
+		"other-key":               APIKeyName("other-key"),
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		namespace = ""
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if namespace != want {
+			t.Errorf("%q: expected namespace %q, got %q", token, want, namespace)
+		}
+	}
+}
+
+func TestAccessControlMiddlewareModelRules(t *testing.T) {
+	t.Parallel()
+
+	var labels map[string]string
+	handler := AccessControlMiddleware(AccessPolicy{
+		APIKeys:   map[string]Role{"admin-key": RoleAdmin},
+		Anonymous: RoleInference,
+		ModelRules: []ModelRule{
+			{Roles: []Role{RoleInference}, Labels: map[string]string{"approved": "true"}},
+			{Roles: []Role{RoleInference, RoleModelManager}, Labels: map[string]string{"team": ""}},
+		},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := IdentityFromContext(r.Context())
+		labels = identity.ModelLabels
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil))
+	if len(labels) != 2 || labels["approved"] != "true" || labels["team"] != "" {
+		t.Errorf("Expected the anonymous role to require both rules' labels, got %v", labels)
+	}
+
+	// Rules don't apply to more privileged roles that they don't list.
+	req := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions", nil)
+	req.Header.Set("Authorization", "Bearer admin-key")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if labels != nil {
+		t.Errorf("Expected the admin role not to require labels, got %v", labels)
+	}
+}
+
+func TestLoadAccessPolicy(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	os.WriteFile(valid, []byte(`{"anonymous":"inference","api_keys":{"key":"admin"},"identities":{"ops":"model-manager"}}`), 0o600)
+	policy, err := LoadAccessPolicy(valid)
+	if err != nil || policy.Anonymous != RoleInference || policy.APIKeys["key"] != RoleAdmin || policy.Identities["ops"] != RoleModelManager {
+		t.Errorf("Unexpected policy %+v (%v)", policy, err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	for _, data := range []string{`{"api_keys":{"key":"root"}}`, `{"api_keys":{"key":""}}`, `{"identities":{"ops":""}}`, `{"model_rules":[{"labels":{"approved":"true"}}]}`} {
+		os.WriteFile(invalid, []byte(data), 0o600)
+		if _, err := LoadAccessPolicy(invalid); err == nil {
+			t.Errorf("Expected error for %s", data)
+		}
+	}
+}
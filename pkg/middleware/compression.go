@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCompressionMinSize is the default minimum response size (in bytes)
+// for which responses are compressed.
+const DefaultCompressionMinSize = 1024
+
+// DefaultCompressionRoutes are the routes whose responses are compressed by
+// default: endpoints that return potentially large, non-streaming JSON
+// payloads.
+var DefaultCompressionRoutes = []string{
+	"/engines/v1/embeddings",
+	"/engines/*/v1/embeddings",
+	"/v1/embeddings",
+	"/engines/v1/models",
+	"/engines/*/v1/models",
+	"/v1/models",
+	"/models",
+	"/engines/requests",
+	"/engines/usage",
+	"/engines/usage/tokens",
+}
+
+// CompressionConfig configures response compression.
+type CompressionConfig struct {
+	// Routes are the path patterns (in the syntax of path.Match, where "*"
+	// matches a single path segment) of the routes whose responses may be
+	// compressed.
+	Routes []string
+	// MinSize is the minimum response size (in bytes) for which responses are
+	// compressed. Smaller responses aren't worth the overhead.
+	MinSize int
+}
+
+// Supported content encodings, in order of preference.
+const (
+	encodingZstd = "zstd"
+	encodingGzip = "gzip"
+)
+
+var (
+	// gzipWriters pools gzip writers, which are relatively expensive to
+	// allocate.
+	gzipWriters = sync.Pool{New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}}
+	// zstdWriters pools zstd encoders, which are expensive to allocate.
+	zstdWriters = sync.Pool{New: func() any {
+		encoder, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1))
+		return encoder
+	}}
+)
+
+// CompressionMiddleware compresses the responses of the configured routes
+// using the best content encoding accepted by the client (zstd or gzip).
+// Server-sent event streams, responses that are already encoded, and
+// responses smaller than the minimum size are never compressed.
+func CompressionMiddleware(config CompressionConfig, next http.Handler) http.Handler {
+	if len(config.Routes) == 0 {
+		return next
+	}
+	if config.MinSize <= 0 {
+		config.MinSize = DefaultCompressionMinSize
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !routeMatches(config.Routes, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Responses of compressible routes vary by the accepted encodings,
+		// even if they aren't compressed.
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressionWriter{ResponseWriter: w, encoding: encoding, minSize: config.MinSize}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// routeMatches returns whether the request path matches one of the route
+// patterns. A pattern ending in "/..." also matches any path below it.
+func routeMatches(routes []string, requestPath string) bool {
+	requestPath = strings.TrimSuffix(requestPath, "/")
+	for _, route := range routes {
+		if prefix, ok := strings.CutSuffix(route, "/..."); ok {
+			if routeMatchesPrefix(prefix, requestPath) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(route, requestPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// routeMatchesPrefix returns whether the request path or one of its parents
+// matches the pattern.
+func routeMatchesPrefix(pattern, requestPath string) bool {
+	for p := requestPath; p != "" && p != "/"; p = path.Dir(p) {
+		if matched, _ := path.Match(pattern, p); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding selects the preferred content encoding accepted by the
+// client, based on an Accept-Encoding header. It returns an empty string if
+// no supported encoding is acceptable.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range []string{encodingZstd, encodingGzip} {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// compressionWriter is a response writer that compresses the response body.
+// The decision to compress is deferred until the response's headers are
+// known and either enough of the body has been written or the response is
+// flushed or complete.
+type compressionWriter struct {
+	http.ResponseWriter
+	// encoding is the content encoding to use.
+	encoding string
+	// minSize is the minimum response size for which responses are
+	// compressed.
+	minSize int
+	// statusCode is the deferred response status code.
+	statusCode int
+	// buffer holds the body written before the decision to compress.
+	buffer []byte
+	// decided indicates whether the decision to compress has been made.
+	decided bool
+	// encoder is the compressing writer, or nil if the response isn't
+	// compressed.
+	encoder io.WriteCloser
+}
+
+// WriteHeader implements http.ResponseWriter.WriteHeader.
+func (w *compressionWriter) WriteHeader(statusCode int) {
+	if w.decided || w.statusCode != 0 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	// Informational responses are sent immediately.
+	if statusCode >= 100 && statusCode < 200 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.statusCode = statusCode
+}
+
+// Write implements http.ResponseWriter.Write.
+func (w *compressionWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buffer = append(w.buffer, data...)
+		if len(w.buffer) < w.minSize {
+			return len(data), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// decide determines whether to compress the response, writes the response
+// headers, and writes any buffered body.
+func (w *compressionWriter) decide() error {
+	w.decided = true
+
+	header := w.Header()
+	statusCode := w.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	compress := len(w.buffer) >= w.minSize &&
+		statusCode != http.StatusNoContent && statusCode != http.StatusNotModified &&
+		header.Get("Content-Encoding") == "" &&
+		!strings.HasPrefix(header.Get("Content-Type"), "text/event-stream")
+
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		switch w.encoding {
+		case encodingZstd:
+			encoder := zstdWriters.Get().(*zstd.Encoder)
+			encoder.Reset(w.ResponseWriter)
+			w.encoder = encoder
+		default:
+			encoder := gzipWriters.Get().(*gzip.Writer)
+			encoder.Reset(w.ResponseWriter)
+			w.encoder = encoder
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+
+	buffered := w.buffer
+	w.buffer = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buffered)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buffered)
+	return err
+}
+
+// Flush implements http.Flusher.Flush. Flushing before enough of the body has
+// been written to decide indicates a streaming response, which isn't
+// compressed.
+func (w *compressionWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	switch encoder := w.encoder.(type) {
+	case *gzip.Writer:
+		encoder.Flush()
+	case *zstd.Encoder:
+		encoder.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying response writer, for use by
+// http.ResponseController.
+func (w *compressionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close completes the response, writing any buffered body and finishing the
+// compressed stream.
+func (w *compressionWriter) close() {
+	if !w.decided {
+		if w.statusCode == 0 && len(w.buffer) == 0 {
+			// Nothing was written, so leave the response to the server.
+			return
+		}
+		w.decide()
+	}
+	if w.encoder == nil {
+		return
+	}
+	w.encoder.Close()
+	switch encoder := w.encoder.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(encoder)
+	case *zstd.Encoder:
+		encoder.Reset(nil)
+		zstdWriters.Put(encoder)
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"":                       "",
+		"gzip":                   "gzip",
+		"gzip, deflate, br":      "gzip",
+		"gzip, zstd":             "zstd",
+		"zstd;q=0.5, gzip":       "gzip",
+		"zstd;q=0, gzip;q=0":     "",
+		"*":                      "zstd",
+		"identity, *;q=0":        "",
+		"GZIP;q=0.8, zstd;q=0.1": "gzip",
+	}
+	for acceptEncoding, want := range tests {
+		if got := negotiateEncoding(acceptEncoding); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", acceptEncoding, got, want)
+		}
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	t.Parallel()
+
+	largeBody := `{"data":[` + strings.Repeat(`{"embedding":[0.1,0.2,0.3]},`, 100) + `{}]}`
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		wantEncoding   string
+	}{
+		{name: "gzip", path: "/engines/v1/embeddings", acceptEncoding: "gzip", body: largeBody, wantEncoding: "gzip"},
+		{name: "zstd", path: "/engines/llama.cpp/v1/embeddings", acceptEncoding: "gzip, zstd", body: largeBody, wantEncoding: "zstd"},
+		{name: "not accepted", path: "/v1/embeddings", body: largeBody},
+		{name: "small response", path: "/v1/embeddings", acceptEncoding: "gzip", body: `{"data":[]}`},
+		{name: "unmatched route", path: "/engines/v1/chat/completions", acceptEncoding: "gzip", body: largeBody},
+		{name: "event stream", path: "/v1/embeddings", acceptEncoding: "gzip", contentType: "text/event-stream", body: largeBody},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := CompressionMiddleware(CompressionConfig{Routes: DefaultCompressionRoutes}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType := tt.contentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				w.Header().Set("Content-Type", contentType)
+				w.WriteHeader(http.StatusCreated)
+				// Write in chunks to exercise buffering.
+				for i := 0; i < len(tt.body); i += 100 {
+					io.WriteString(w, tt.body[i:min(i+100, len(tt.body))])
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusCreated {
+				t.Errorf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+			}
+			if encoding := rec.Header().Get("Content-Encoding"); encoding != tt.wantEncoding {
+				t.Fatalf("Expected encoding %q, got %q", tt.wantEncoding, encoding)
+			}
+
+			var reader io.Reader = rec.Body
+			switch tt.wantEncoding {
+			case "gzip":
+				gzipReader, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatalf("Failed to create gzip reader: %v", err)
+				}
+				reader = gzipReader
+			case "zstd":
+				zstdReader, err := zstd.NewReader(rec.Body)
+				if err != nil {
+					t.Fatalf("Failed to create zstd reader: %v", err)
+				}
+				defer zstdReader.Close()
+				reader = zstdReader
+			}
+			body, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Failed to read body: %v", err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("Unexpected body: %q", body)
+			}
+		})
+	}
+}
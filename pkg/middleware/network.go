@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ParsePrefixes parses a comma-separated list of addresses or CIDR prefixes,
+// e.g. "192.168.1.0/24,127.0.0.1". Addresses are parsed as single-address
+// prefixes.
+func ParsePrefixes(spec string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range strings.Split(spec, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: expected an address or a CIDR prefix", value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// NetworkRule restricts the client addresses allowed to access a group of
+// routes.
+type NetworkRule struct {
+	// Allow are the prefixes of the allowed client addresses. If it's empty,
+	// all addresses that aren't denied are allowed.
+	Allow []netip.Prefix
+	// Deny are the prefixes of the denied client addresses. They take
+	// precedence over Allow.
+	Deny []netip.Prefix
+}
+
+// allows returns whether the rule allows a client address.
+func (r NetworkRule) allows(addr netip.Addr) bool {
+	contains := func(prefix netip.Prefix) bool {
+		return prefix.Contains(addr)
+	}
+	if slices.ContainsFunc(r.Deny, contains) {
+		return false
+	}
+	return len(r.Allow) == 0 || slices.ContainsFunc(r.Allow, contains)
+}
+
+// NetworkPolicy restricts the client addresses allowed to access each group
+// of routes, i.e. the routes requiring each role as given by RequiredRole.
+// Requests are checked against the rules of their route group and of the
+// empty role, which applies to all routes.
+type NetworkPolicy map[Role]NetworkRule
+
+// NetworkPolicyMiddleware rejects requests from client addresses that the
+// policy doesn't allow to access the requested routes with a 403 response.
+// It's meant for deployments exposing the model runner on a trusted network
+// without authentication infrastructure, and complements
+// AccessControlMiddleware. Requests without a client address, such as
+// requests over Unix sockets, are local and always allowed.
+func NetworkPolicyMiddleware(policy NetworkPolicy, next http.Handler) http.Handler {
+	if len(policy) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := netip.ParseAddr(ClientAddress(r))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		addr = addr.Unmap()
+		group := RequiredRole(r)
+		if !policy[""].allows(addr) || !policy[group].allows(addr) {
+			http.Error(w, fmt.Sprintf("%s isn't allowed to access the %s routes", addr, group), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
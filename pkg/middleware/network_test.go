@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestNetworkPolicyMiddleware(t *testing.T) {
+	t.Parallel()
+
+	mustParse := func(spec string) []netip.Prefix {
+		prefixes, err := ParsePrefixes(spec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return prefixes
+	}
+	policy := NetworkPolicy{
+		"":            {Deny: mustParse("192.168.1.66")},
+		RoleInference: {Allow: mustParse("192.168.1.0/24, 127.0.0.1")},
+		RoleAdmin:     {Allow: mustParse("127.0.0.1, ::1")},
+	}
+	handler := NetworkPolicyMiddleware(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method     string
+		path       string
+		remoteAddr string
+		want       int
+	}{
+		{method: http.MethodPost, path: "/engines/v1/chat/completions", remoteAddr: "192.168.1.10:4711", want: http.StatusOK},
+		{method: http.MethodPost, path: "/engines/v1/chat/completions", remoteAddr: "[::ffff:192.168.1.10]:4711", want: http.StatusOK},
+		{method: http.MethodPost, path: "/engines/v1/chat/completions", remoteAddr: "10.0.0.1:4711", want: http.StatusForbidden},
+		{method: http.MethodPost, path: "/engines/v1/chat/completions", remoteAddr: "192.168.1.66:4711", want: http.StatusForbidden},
+		{method: http.MethodPost, path: "/models/create", remoteAddr: "10.0.0.1:4711", want: http.StatusOK},
+		{method: http.MethodPost, path: "/models/create", remoteAddr: "192.168.1.66:4711", want: http.StatusForbidden},
+		{method: http.MethodGet, path: "/metrics", remoteAddr: "192.168.1.10:4711", want: http.StatusForbidden},
+		{method: http.MethodGet, path: "/metrics", remoteAddr: "[::1]:4711", want: http.StatusOK},
+		{method: http.MethodGet, path: "/metrics", remoteAddr: "@", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		r.RemoteAddr = tt.remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s from %s: expected status %d, got %d", tt.method, tt.path, tt.remoteAddr, tt.want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// ParseTrustedProxies parses a comma-separated list of the addresses or CIDR
+// prefixes of trusted reverse proxies, e.g. "10.0.0.0/8,127.0.0.1".
+func ParseTrustedProxies(spec string) ([]netip.Prefix, error) {
+	prefixes, err := ParsePrefixes(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	return prefixes, nil
+}
+
+// ForwardedMiddleware identifies the clients of requests forwarded by trusted
+// reverse proxies from their X-Forwarded-For or Forwarded headers, replacing
+// the requests' remote addresses, so that logs and records show the clients
+// rather than the proxies. The headers of requests from other peers are
+// ignored, since clients can set them to anything.
+func ForwardedMiddleware(trustedProxies []netip.Prefix, next http.Handler) http.Handler {
+	if len(trustedProxies) == 0 {
+		return next
+	}
+	trusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		for _, prefix := range trustedProxies {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := parseForwardedAddr(r.RemoteAddr)
+		if !ok || !trusted(peer) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Each proxy appends the address of its peer, so the client is the
+		// last address that isn't a trusted proxy. Addresses before it may
+		// have been set by the client.
+		client := peer
+		hops := forwardedHops(r.Header)
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, ok := parseForwardedAddr(hops[i])
+			if !ok {
+				break
+			}
+			client = addr
+			if !trusted(addr) {
+				break
+			}
+		}
+		if client != peer {
+			r = r.Clone(r.Context())
+			r.RemoteAddr = netip.AddrPortFrom(client, 0).String()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedHops returns the addresses through which a request was forwarded,
+// from its X-Forwarded-For headers or, if there are none, its Forwarded
+// headers.
+func forwardedHops(header http.Header) []string {
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	if len(hops) > 0 {
+		return hops
+	}
+	for _, value := range header.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseForwardedAddr parses an address with an optional port, such as
+// "192.0.2.1", "192.0.2.1:4711", or "[2001:db8::1]:4711".
+func parseForwardedAddr(value string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// ClientAddress returns the IP address of a request's client, or an empty
+// string if it isn't known, e.g. for requests over Unix sockets.
+func ClientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// BasePathMiddleware serves next under a base path, e.g. "/model-runner" when
+// deployed behind an ingress that routes that path prefix to the model runner
+// without stripping it. The base path is stripped from request paths, and
+// requests outside of it aren't found.
+func BasePathMiddleware(basePath string, next http.Handler) http.Handler {
+	basePath = strings.TrimRight(basePath, "/")
+	if basePath == "" {
+		return next
+	}
+	strip := func(path string) (string, bool) {
+		path, ok := strings.CutPrefix(path, basePath)
+		if !ok || (path != "" && path[0] != '/') {
+			return "", false
+		}
+		if path == "" {
+			path = "/"
+		}
+		return path, true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := strip(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath, _ = strip(r.URL.RawPath)
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
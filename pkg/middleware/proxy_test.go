@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedMiddleware(t *testing.T) {
+	t.Parallel()
+
+	trustedProxies, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got string
+	handler := ForwardedMiddleware(trustedProxies, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientAddress(r)
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "198.51.100.7:4711",
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "untrusted peer",
+			remoteAddr: "198.51.100.7:4711",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.5"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "192.0.2.1:4711",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.5"}},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "proxy chain",
+			remoteAddr: "10.0.0.2:4711",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.5", "10.0.0.1"}},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "forwarded",
+			remoteAddr: "10.0.0.2:4711",
+			header:     http.Header{"Forwarded": {`for="[2001:db8::1]:4711";proto=https`}},
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "invalid hop",
+			remoteAddr: "10.0.0.2:4711",
+			header:     http.Header{"X-Forwarded-For": {"unknown"}},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "unix socket",
+			remoteAddr: "@",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.5"}},
+			want:       "",
+		},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/models", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for key, values := range tt.header {
+			r.Header[key] = values
+		}
+		got = ""
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if got != tt.want {
+			t.Errorf("%s: expected client %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	t.Parallel()
+
+	if _, err := ParseTrustedProxies("10.0.0.0/8,proxy.local"); err == nil {
+		t.Error("Expected an error for a host name")
+	}
+}
+
+func TestBasePathMiddleware(t *testing.T) {
+	t.Parallel()
+
+	handler := BasePathMiddleware("/model-runner/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.EscapedPath()))
+	}))
+
+	tests := []struct {
+		path string
+		want int
+		body string
+	}{
+		{path: "/model-runner/models", want: http.StatusOK, body: "/models"},
+		{path: "/model-runner", want: http.StatusOK, body: "/"},
+		{path: "/model-runner/models/ai%2Fsmollm2", want: http.StatusOK, body: "/models/ai%2Fsmollm2"},
+		{path: "/models", want: http.StatusNotFound},
+		{path: "/model-runnerx/models", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.want, rec.Code)
+		}
+		if tt.body != "" && rec.Body.String() != tt.body {
+			t.Errorf("%s: expected path %q, got %q", tt.path, tt.body, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// DefaultReadOnlyRoutes are the routes that remain available for all methods
+// in read-only mode, in the syntax of CompressionConfig.Routes: endpoints that
+// serve inference or queries rather than modifying state.
+var DefaultReadOnlyRoutes = []string{
+	"/engines/v1/chat/completions",
+	"/engines/*/v1/chat/completions",
+	"/v1/chat/completions",
+	"/engines/v1/completions",
+	"/engines/*/v1/completions",
+	"/v1/completions",
+	"/engines/v1/embeddings",
+	"/engines/*/v1/embeddings",
+	"/v1/embeddings",
+	"/engines/rerank",
+	"/engines/*/rerank",
+	"/rerank",
+	"/engines/score",
+	"/engines/*/score",
+	"/score",
+	"/engines/v1/realtime",
+	"/engines/*/v1/realtime",
+	"/v1/realtime",
+	"/engines/v1/audio/transcriptions/stream",
+	"/v1/audio/transcriptions/stream",
+	"/engines/v1/vector_stores/*/search",
+	"/v1/vector_stores/*/search",
+	"/engines/pipelines/*/run",
+	"/engines/provenance/verify",
+	"/api/chat",
+	"/api/generate",
+	"/api/show",
+}
+
+// ReadOnlyMiddleware rejects requests that may modify state, such as model
+// pulls, deletions, and configuration changes, with a 403 response. Requests
+// with safe methods (GET, HEAD, and OPTIONS) and requests to the specified
+// routes are passed through.
+func ReadOnlyMiddleware(routes []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if routeMatches(routes, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, fmt.Sprintf("%s %s is disabled: the model runner is in read-only mode", r.Method, r.URL.Path), http.StatusForbidden)
+	})
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	t.Parallel()
+
+	handler := ReadOnlyMiddleware(DefaultReadOnlyRoutes, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{method: http.MethodGet, path: "/models", want: http.StatusOK},
+		{method: http.MethodOptions, path: "/models/create", want: http.StatusOK},
+		{method: http.MethodPost, path: "/engines/v1/chat/completions", want: http.StatusOK},
+		{method: http.MethodPost, path: "/engines/llama.cpp/v1/embeddings", want: http.StatusOK},
+		{method: http.MethodPost, path: "/v1/vector_stores/vs_1/search", want: http.StatusOK},
+		{method: http.MethodPost, path: "/api/chat", want: http.StatusOK},
+		{method: http.MethodPost, path: "/models/create", want: http.StatusForbidden},
+		{method: http.MethodDelete, path: "/models/ai/smollm2", want: http.StatusForbidden},
+		{method: http.MethodPost, path: "/engines/_configure", want: http.StatusForbidden},
+		{method: http.MethodPost, path: "/engines/unload", want: http.StatusForbidden},
+		{method: http.MethodPost, path: "/api/pull", want: http.StatusForbidden},
+		{method: http.MethodPost, path: "/v1/vector_stores/vs_1/documents", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.want, rec.Code)
+		}
+		if rec.Code == http.StatusForbidden && !strings.Contains(rec.Body.String(), "read-only mode") {
+			t.Errorf("%s %s: expected read-only reason, got %q", tt.method, tt.path, rec.Body.String())
+		}
+	}
+}
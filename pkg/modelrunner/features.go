@@ -0,0 +1,76 @@
+package modelrunner
+
+import (
+	"maps"
+	"runtime"
+	"slices"
+
+	"github.com/docker/model-runner/pkg/features"
+	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+	"github.com/docker/model-runner/pkg/inference/backends/mlx"
+	"github.com/docker/model-runner/pkg/inference/backends/vllm"
+	"github.com/docker/model-runner/pkg/inference/platform"
+)
+
+// visionBackends are the backends that accept image input with multimodal
+// models.
+var visionBackends = []string{llamacpp.Name, vllm.Name, mlx.Name}
+
+// backendSupport returns whether the named backend is supported on this
+// platform and, if it isn't, why.
+func backendSupport(name string) (bool, string) {
+	switch name {
+	case vllm.Name:
+		if !platform.SupportsVLLM() {
+			return false, "requires Linux"
+		}
+	case mlx.Name:
+		if !platform.SupportsMLX() {
+			return false, "requires macOS on Apple silicon"
+		}
+	}
+	return true, ""
+}
+
+// features reports the optional capabilities enabled by a configuration on
+// this build and platform, along with the backends' current statuses.
+func (m *ModelRunner) features(conf Config) features.Report {
+	report := features.Report{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+	}
+	metricsFeature := features.Enabled(features.Metrics)
+	if conf.DisableMetrics {
+		metricsFeature = features.Disabled(features.Metrics, "disabled")
+	}
+	vision := features.Disabled(features.Vision, "no backend supporting multimodal models is available")
+	for _, name := range slices.Sorted(maps.Keys(m.backends)) {
+		supported, reason := backendSupport(name)
+		report.Backends = append(report.Backends, features.Backend{
+			Name:      name,
+			Supported: supported,
+			Reason:    reason,
+			Status:    m.backends[name].Status(),
+		})
+		if supported && slices.Contains(visionBackends, name) {
+			vision = features.Enabled(features.Vision)
+		}
+	}
+	report.Features = []features.Feature{
+		vision,
+		features.Configured(features.AudioTranscription, conf.Transcriber != nil),
+		features.Enabled(features.Realtime),
+		features.Configured(features.Batching, conf.Batches != nil),
+		features.Configured(features.ScheduledJobs, conf.Jobs != nil),
+		features.Configured(features.Files, conf.Files != nil),
+		features.Configured(features.VectorStores, conf.VectorStores != nil),
+		features.Configured(features.PromptTemplates, conf.PromptTemplates != nil),
+		features.Disabled(features.Cluster, "not supported by this build"),
+		metricsFeature,
+		features.Configured(features.AccessControl, conf.AccessPolicy != nil),
+		features.Configured(features.ReadOnly, conf.ReadOnly),
+		features.Configured(features.FaultInjection, conf.Chaos != nil),
+		features.Configured(features.TrafficRecording, conf.TrafficRecorder != nil),
+	}
+	return report
+}
@@ -0,0 +1,796 @@
+// Package modelrunner embeds the model runner in-process, so that Go services
+// can serve its API from their own HTTP servers rather than running it as a
+// sidecar. New assembles the model runner from a Config, in which every
+// subsystem can be injected, and returns a ModelRunner whose Handler serves
+// the API and whose Run method drives its background work.
+package modelrunner
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/docker/model-runner/pkg/batch"
+	"github.com/docker/model-runner/pkg/chaos"
+	"github.com/docker/model-runner/pkg/chargeback"
+	"github.com/docker/model-runner/pkg/credentials"
+	"github.com/docker/model-runner/pkg/features"
+	"github.com/docker/model-runner/pkg/files"
+	"github.com/docker/model-runner/pkg/go-containerregistry/pkg/authn"
+	"github.com/docker/model-runner/pkg/gpuinfo"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends/llamacpp"
+	"github.com/docker/model-runner/pkg/inference/backends/mlx"
+	"github.com/docker/model-runner/pkg/inference/backends/mock"
+	"github.com/docker/model-runner/pkg/inference/backends/onnx"
+	"github.com/docker/model-runner/pkg/inference/backends/vllm"
+	"github.com/docker/model-runner/pkg/inference/config"
+	"github.com/docker/model-runner/pkg/inference/memory"
+	"github.com/docker/model-runner/pkg/inference/models"
+	"github.com/docker/model-runner/pkg/inference/provenance"
+	"github.com/docker/model-runner/pkg/inference/quirks"
+	"github.com/docker/model-runner/pkg/inference/scheduling"
+	"github.com/docker/model-runner/pkg/jobs"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/metrics"
+	"github.com/docker/model-runner/pkg/middleware"
+	"github.com/docker/model-runner/pkg/ollama"
+	"github.com/docker/model-runner/pkg/pii"
+	"github.com/docker/model-runner/pkg/prompts"
+	"github.com/docker/model-runner/pkg/pullproxy"
+	"github.com/docker/model-runner/pkg/quota"
+	"github.com/docker/model-runner/pkg/routing"
+	"github.com/docker/model-runner/pkg/security"
+	"github.com/docker/model-runner/pkg/storage"
+	"github.com/docker/model-runner/pkg/traffic"
+	"github.com/docker/model-runner/pkg/transcription"
+	"github.com/docker/model-runner/pkg/vectorstore"
+	"github.com/docker/model-runner/pkg/version"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultLlamaServerPath is the directory of the llama.cpp server binaries
+// shipped with Docker Desktop.
+const DefaultLlamaServerPath = "/Applications/Docker.app/Contents/Resources/model-runner/bin"
+
+// Config configures an embedded model runner. Subsystems left nil are either
+// created with defaults or disabled, as documented for each field.
+type Config struct {
+	// Log is the logger. It defaults to a new logrus logger.
+	Log logging.Logger
+	// AllowedOrigins are the origins allowed by CORS.
+	AllowedOrigins []string
+
+	// ModelsPath is the directory of the model store, used if ModelHandler
+	// is nil. It defaults to ~/.docker/models.
+	ModelsPath string
+	// Transport is the transport used to pull and push models, used if
+	// ModelHandler is nil. It defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+	// ModelHandler manages and serves models. If it's nil, a handler storing
+	// models in ModelsPath is created.
+	ModelHandler *models.Handler
+	// SystemMemoryInfo describes the memory available to models. If it's
+	// nil, it's measured, including the memory of the GPUs detected with the
+	// llama.cpp server binaries in LlamaServerPath.
+	SystemMemoryInfo memory.SystemMemoryInfo
+
+	// LlamaServerPath is the directory of the llama.cpp server binaries. It
+	// defaults to DefaultLlamaServerPath.
+	LlamaServerPath string
+	// LlamaServerUpdatePath is the directory in which updated llama.cpp
+	// server binaries are installed. It defaults to "updated-inference/bin"
+	// in the working directory.
+	LlamaServerUpdatePath string
+	// LlamaCpp is the llama.cpp backend configuration. It defaults to the
+	// backend's default configuration.
+	LlamaCpp config.BackendConfig
+	// Backends are served in addition to the default llama.cpp, vLLM, and
+	// MLX backends, replacing default backends with the same names.
+	// Backends that use the shared model manager need ModelHandler to be set
+	// to the handler whose manager they use.
+	Backends map[string]inference.Backend
+	// DefaultBackend is the name of the backend serving requests that don't
+	// specify one. It defaults to llama.cpp.
+	DefaultBackend string
+	// Fixtures stores the fixtures recorded from recorded requests and
+	// replayed by the mock backend. If it's nil, fixtures are disabled.
+	Fixtures *mock.FixtureStore
+
+	// Tracker tracks model usage. It defaults to a tracker that doesn't
+	// identify the embedding service.
+	Tracker *metrics.Tracker
+	// Profile is the configuration profile. It defaults to the
+	// scheduling.DefaultProfile profile.
+	Profile *scheduling.Profile
+	// LoadLimits limits concurrent runner startups. If it's nil, loads are
+	// serialized.
+	LoadLimits *scheduling.LoadLimits
+	// PrefetchPolicy, WindowPolicy, RetentionPolicy, and
+	// RecordsAnonymization default to disabled.
+	PrefetchPolicy       scheduling.PrefetchPolicy
+	WindowPolicy         scheduling.WindowPolicy
+	RetentionPolicy      metrics.RetentionPolicy
+	RecordsAnonymization metrics.AnonymizationPolicy
+	// Backpressure configures how streamed responses are buffered for slow
+	// clients. It defaults to pausing streams once 1 MiB is buffered.
+	Backpressure scheduling.BackpressurePolicy
+	// Jailbreak configures the scoring of incoming prompts for jailbreak
+	// attempts. Prompts aren't scored by default.
+	Jailbreak scheduling.JailbreakPolicy
+	// RequestQueue limits the requests that each model serves concurrently,
+	// queueing the others. Requests aren't queued by default.
+	RequestQueue scheduling.RequestQueuePolicy
+	// RecordsStorage persists recorded requests across restarts, if set.
+	RecordsStorage storage.KV
+	// RecordsEncryptionKey encrypts the bodies of persisted records, if set.
+	// See metrics.ParseEncryptionKey.
+	RecordsEncryptionKey []byte
+	// RecordsAudit makes persisted records hash-chained in an audit log, so
+	// that records altered after the fact can be detected. Entries are
+	// signed with RecordsSigningKey, if set, which implies RecordsAudit.
+	RecordsAudit      bool
+	RecordsSigningKey ed25519.PrivateKey
+	// QuotaLimits are the token budgets of namespaces. See
+	// scheduling.Scheduler.SetQuotaLimits.
+	QuotaLimits []quota.Limit
+	// QuotaStorage persists quota usage and usage reports across restarts,
+	// if set.
+	QuotaStorage storage.KV
+	// StateStorage persists the serving state, such as pins, virtual models,
+	// runner configurations, and loaded runners, across restarts, if set. See
+	// scheduling.Scheduler.SetStateStorage.
+	StateStorage storage.KV
+	// Chargeback exports inference usage for internal chargeback, if set.
+	Chargeback *chargeback.Exporter
+	// Provenance signs the provenance of inference responses, if set. See
+	// scheduling.Scheduler.SetProvenanceSigner.
+	Provenance *provenance.Signer
+	// TracerProvider traces inference requests, if set. See the tracing
+	// package.
+	TracerProvider trace.TracerProvider
+	// ModelMetadata stores the models index instead of a file in ModelsPath,
+	// if set. It's ignored if ModelHandler is set.
+	ModelMetadata storage.KV
+	// PullProxy selects the proxies of pulls and pushes, separately from
+	// other traffic, and enables the pull proxy API, if set. It's ignored by
+	// the model handler if ModelHandler is set.
+	PullProxy *pullproxy.Selector
+	// Credentials store the registry and Hugging Face credentials used to
+	// pull and push models, and enable the credentials API, if set. Hosts
+	// without stored credentials use the Docker configuration. They're
+	// ignored by the model handler if ModelHandler is set.
+	Credentials credentials.Chain
+	// TrashRetention is how long deleted models stay in the trash before
+	// they're purged. It defaults to models.DefaultTrashRetention, and is
+	// ignored if ModelHandler is set.
+	TrashRetention time.Duration
+	// VirtualModels and Pipelines are the initial virtual models and
+	// pipelines.
+	VirtualModels []scheduling.VirtualModel
+	Pipelines     []scheduling.Pipeline
+	// Quirks are rules describing known quirks of models, which are added to
+	// the built-in rules or replace those with the same names.
+	Quirks []quirks.Rule
+	// ModerationModel is the classifier used by moderation requests that
+	// don't specify a model.
+	ModerationModel string
+	// MaxUserAgents is the maximum number of distinct user agents tracked
+	// for usage analytics. Zero keeps the default.
+	MaxUserAgents int
+	// ResourceSnapshots enables resource snapshots in recorded requests.
+	ResourceSnapshots bool
+
+	// VectorStores enables the vector store API and retrieval-augmented
+	// chat completions, which inject retrieved chunks into prompts using
+	// RetrievalTemplate, or retrieval.DefaultTemplate if it's nil.
+	VectorStores      *vectorstore.Manager
+	RetrievalTemplate *template.Template
+	// PromptTemplates enables the prompt template API.
+	PromptTemplates *prompts.Manager
+	// Files enables the Files API. It's required by Jobs.
+	Files *files.Manager
+	// Batches enables the Batch API.
+	Batches *batch.Manager
+	// Jobs enables scheduled jobs.
+	Jobs *jobs.Manager
+	// Transcriber enables the streaming transcription API, and transcribes the
+	// input audio of realtime sessions.
+	Transcriber transcription.Transcriber
+	// Chaos injects faults into inference responses and enables the fault
+	// injection API.
+	Chaos *chaos.Injector
+	// TrafficRecorder records all traffic. It isn't closed by the model
+	// runner.
+	TrafficRecorder *traffic.Recorder
+
+	// DisableMetrics disables the Prometheus metrics endpoint.
+	DisableMetrics bool
+	// ReadOnly disables mutating management operations.
+	ReadOnly bool
+	// AccessPolicy restricts the API to the roles of the clients' API keys
+	// or certificates, if set.
+	AccessPolicy *middleware.AccessPolicy
+	// SecurityMonitor locks out sources with too many failed authentication
+	// attempts and enables the security events feed, if set. It only applies
+	// with an access policy.
+	SecurityMonitor *security.Monitor
+	// NetworkPolicy restricts the client addresses allowed to access each
+	// group of routes, if set.
+	NetworkPolicy middleware.NetworkPolicy
+	// Compression configures response compression. It defaults to disabled,
+	// e.g. for embedding services that compress responses themselves.
+	Compression middleware.CompressionConfig
+	// BasePath is the path prefix under which the API is served, e.g. behind
+	// an ingress that doesn't strip it. It defaults to the root.
+	BasePath string
+	// TrustedProxies are the reverse proxies whose forwarded headers identify
+	// clients in traffic recordings and recorded requests. See
+	// middleware.ParseTrustedProxies.
+	TrustedProxies []netip.Prefix
+	// DropFolder is a directory watched for models to import. If it's
+	// empty, no directory is watched.
+	DropFolder string
+}
+
+// ModelRunner is an embedded model runner.
+type ModelRunner struct {
+	// log is the associated logger.
+	log logging.Logger
+	// modelHandler manages and serves models.
+	modelHandler *models.Handler
+	// scheduler schedules inference requests.
+	scheduler *scheduling.Scheduler
+	// backends are the inference backends, keyed by name.
+	backends map[string]inference.Backend
+	// batches processes batches, if enabled.
+	batches *batch.Handler
+	// jobs runs scheduled jobs, if enabled.
+	jobs *jobs.Handler
+	// dropFolder is the watched model drop folder, if any.
+	dropFolder string
+	// handler serves the API.
+	handler http.Handler
+	// publicHandler serves the API to clients, enforcing the access policy.
+	publicHandler http.Handler
+}
+
+// New assembles a model runner from its configuration. Its background work
+// doesn't start until Run is called.
+func New(ctx context.Context, conf Config) (*ModelRunner, error) {
+	log := conf.Log
+	if log == nil {
+		log = logrus.New()
+	}
+	if conf.Jobs != nil && conf.Files == nil {
+		return nil, errors.New("scheduled jobs require the Files API")
+	}
+	if conf.LlamaServerPath == "" {
+		conf.LlamaServerPath = DefaultLlamaServerPath
+	}
+
+	sysMemInfo := conf.SystemMemoryInfo
+	if sysMemInfo == nil {
+		var err error
+		if sysMemInfo, err = memory.NewSystemMemoryInfo(log, gpuinfo.New(conf.LlamaServerPath)); err != nil {
+			return nil, fmt.Errorf("unable to initialize system memory info: %w", err)
+		}
+	}
+
+	// Share the handler's model manager so that state tracked by the manager
+	// (such as in-progress pulls and mounted models) is visible to the
+	// scheduler and backends.
+	modelHandler := conf.ModelHandler
+	var memEstimator memory.MemoryEstimator
+	if modelHandler == nil {
+		var err error
+		if modelHandler, memEstimator, err = newModelHandler(log, conf, sysMemInfo); err != nil {
+			return nil, err
+		}
+	}
+	modelManager := modelHandler.Manager()
+
+	backends, err := newDefaultBackends(log, conf, modelManager)
+	if err != nil {
+		return nil, err
+	}
+	for name, backend := range conf.Backends {
+		backends[name] = backend
+	}
+	defaultBackendName := conf.DefaultBackend
+	if defaultBackendName == "" {
+		defaultBackendName = llamacpp.Name
+	}
+	defaultBackend := backends[defaultBackendName]
+	if defaultBackend == nil {
+		return nil, fmt.Errorf("unknown default backend %s", defaultBackendName)
+	}
+	if memEstimator != nil {
+		memEstimator.SetDefaultBackend(defaultBackend)
+	}
+	if conf.Fixtures != nil {
+		if mockBackend, ok := backends[mock.Name].(*mock.Backend); ok {
+			mockBackend.SetFixtureStore(conf.Fixtures)
+		}
+	}
+
+	tracker := conf.Tracker
+	if tracker == nil {
+		tracker = metrics.NewTracker(http.DefaultClient, log.WithField("component", "metrics"), "", false)
+	}
+
+	scheduler := scheduling.NewScheduler(
+		log,
+		backends,
+		defaultBackend,
+		modelHandler,
+		modelManager,
+		http.DefaultClient,
+		conf.AllowedOrigins,
+		tracker,
+		sysMemInfo,
+	)
+	if err := configureScheduler(ctx, scheduler, conf); err != nil {
+		return nil, err
+	}
+	// Check the throughput of validated llama.cpp updates against the
+	// benchmark history, so that regressions are rolled back, and work around
+	// the known quirks of the models it loads. This fails, harmlessly, if
+	// another backend is configured in its place.
+	if backend, ok := backends[llamacpp.Name]; ok {
+		_ = llamacpp.SetThroughputCheck(backend, scheduler.CheckBackendThroughput)
+		_ = llamacpp.SetQuirks(backend, scheduler.Quirks())
+	}
+
+	m := &ModelRunner{
+		log:          log,
+		modelHandler: modelHandler,
+		scheduler:    scheduler,
+		backends:     backends,
+		dropFolder:   conf.DropFolder,
+	}
+	router := m.newRouter(conf)
+
+	// Disable mutating management operations in read-only mode. The scheduler
+	// also enforces this for requests made internally by other components.
+	var handler http.Handler = router
+	if conf.ReadOnly {
+		scheduler.SetReadOnly(true)
+		handler = middleware.ReadOnlyMiddleware(middleware.DefaultReadOnlyRoutes, router)
+	}
+
+	// Inject faults into inference responses in chaos mode.
+	if conf.Chaos != nil {
+		handler = conf.Chaos.Middleware(handler)
+	}
+
+	// Record all traffic if enabled, so that it can be replayed later.
+	if conf.TrafficRecorder != nil {
+		handler = conf.TrafficRecorder.Middleware(handler)
+	}
+
+	m.handler = middleware.CompressionMiddleware(conf.Compression, handler)
+
+	// Enforce the access policy on clients. Replayed requests bypass it, since
+	// recordings don't include credentials and replays require the admin
+	// role.
+	m.publicHandler = m.handler
+	if conf.AccessPolicy != nil {
+		policy := *conf.AccessPolicy
+		if conf.SecurityMonitor != nil {
+			policy.Failures = conf.SecurityMonitor
+		}
+		m.publicHandler = middleware.AccessControlMiddleware(policy, m.handler)
+	}
+
+	// Restrict the client addresses allowed to access each route group.
+	m.publicHandler = middleware.NetworkPolicyMiddleware(conf.NetworkPolicy, m.publicHandler)
+
+	// Report the server's version to clients, including on denied requests,
+	// so that they can negotiate compatibility.
+	m.publicHandler = version.Middleware(m.publicHandler)
+
+	// Serve the API under the base path, to the clients identified by trusted
+	// reverse proxies.
+	m.publicHandler = middleware.BasePathMiddleware(conf.BasePath, m.publicHandler)
+	m.publicHandler = middleware.ForwardedMiddleware(conf.TrustedProxies, m.publicHandler)
+	return m, nil
+}
+
+// newModelHandler creates the model handler storing models in the configured
+// models path, and the memory estimator used to check that pulled models fit.
+func newModelHandler(log logging.Logger, conf Config, sysMemInfo memory.SystemMemoryInfo) (*models.Handler, memory.MemoryEstimator, error) {
+	modelsPath := conf.ModelsPath
+	if modelsPath == "" {
+		userHomeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to determine the models path: %w", err)
+		}
+		modelsPath = filepath.Join(userHomeDir, ".docker", "models")
+	}
+	transport := conf.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if conf.PullProxy != nil {
+		base, ok := transport.(*http.Transport)
+		if !ok {
+			return nil, nil, fmt.Errorf("the pull proxy requires an *http.Transport, got %T", transport)
+		}
+		transport = conf.PullProxy.Transport(base)
+	}
+	var keychain authn.Keychain
+	if conf.Credentials != nil {
+		keychain = credentials.Keychain(log.WithField("component", "credentials"), conf.Credentials, authn.DefaultKeychain)
+	}
+	memEstimator := memory.NewEstimator(sysMemInfo)
+	modelHandler := models.NewHandler(
+		log,
+		models.ClientConfig{
+			StoreRootPath:  modelsPath,
+			Logger:         log.WithField("component", "model-manager"),
+			Transport:      transport,
+			Metadata:       conf.ModelMetadata,
+			TrashRetention: conf.TrashRetention,
+			Keychain:       keychain,
+		},
+		conf.AllowedOrigins,
+		memEstimator,
+	)
+	return modelHandler, memEstimator, nil
+}
+
+// newDefaultBackends creates the llama.cpp, vLLM, MLX, and ONNX backends, skipping
+// those replaced by configured backends.
+func newDefaultBackends(log logging.Logger, conf Config, modelManager *models.Manager) (map[string]inference.Backend, error) {
+	backends := make(map[string]inference.Backend)
+	if _, ok := conf.Backends[llamacpp.Name]; !ok {
+		updatePath := conf.LlamaServerUpdatePath
+		if updatePath == "" {
+			wd, _ := os.Getwd()
+			updatePath = filepath.Join(wd, "updated-inference", "bin")
+		}
+		_ = os.MkdirAll(updatePath, 0o755)
+		backend, err := llamacpp.New(
+			log,
+			modelManager,
+			log.WithField("component", llamacpp.Name),
+			conf.LlamaServerPath,
+			updatePath,
+			conf.LlamaCpp,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize %s backend: %w", llamacpp.Name, err)
+		}
+		backends[llamacpp.Name] = backend
+	}
+	if _, ok := conf.Backends[vllm.Name]; !ok {
+		backend, err := vllm.New(log, modelManager, log.WithField("component", vllm.Name), nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize %s backend: %w", vllm.Name, err)
+		}
+		backends[vllm.Name] = backend
+	}
+	if _, ok := conf.Backends[mlx.Name]; !ok {
+		backend, err := mlx.New(log, modelManager, log.WithField("component", mlx.Name), nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize %s backend: %w", mlx.Name, err)
+		}
+		backends[mlx.Name] = backend
+	}
+	if _, ok := conf.Backends[onnx.Name]; !ok {
+		backend, err := onnx.New(log, modelManager, log.WithField("component", onnx.Name), nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize %s backend: %w", onnx.Name, err)
+		}
+		backends[onnx.Name] = backend
+	}
+	return backends, nil
+}
+
+// configureScheduler applies the scheduler settings of a configuration.
+func configureScheduler(ctx context.Context, scheduler *scheduling.Scheduler, conf Config) error {
+	scheduler.SetRetentionPolicy(conf.RetentionPolicy)
+	scheduler.SetRecordsAnonymizationPolicy(conf.RecordsAnonymization)
+	if conf.RecordsEncryptionKey != nil {
+		if conf.RecordsStorage == nil {
+			return errors.New("records encryption requires records storage")
+		}
+		if err := scheduler.SetRecordsEncryptionKey(conf.RecordsEncryptionKey); err != nil {
+			return fmt.Errorf("invalid records encryption key: %w", err)
+		}
+	}
+	if conf.RecordsAudit || conf.RecordsSigningKey != nil {
+		if conf.RecordsStorage == nil {
+			return errors.New("records auditing requires records storage")
+		}
+		if err := scheduler.EnableRecordsAudit(conf.RecordsSigningKey); err != nil {
+			return fmt.Errorf("invalid records signing key: %w", err)
+		}
+	}
+	if conf.RecordsStorage != nil {
+		if err := scheduler.SetRecordsStorage(conf.RecordsStorage); err != nil {
+			return fmt.Errorf("loading persisted records: %w", err)
+		}
+	}
+	if conf.QuotaLimits != nil {
+		if err := scheduler.SetQuotaLimits(conf.QuotaLimits); err != nil {
+			return fmt.Errorf("invalid quota limits: %w", err)
+		}
+	}
+	if conf.QuotaStorage != nil {
+		if err := scheduler.SetQuotaStorage(conf.QuotaStorage); err != nil {
+			return fmt.Errorf("loading persisted quota usage: %w", err)
+		}
+	}
+	if conf.Chargeback != nil {
+		scheduler.SetChargebackExporter(conf.Chargeback)
+	}
+	if conf.Provenance != nil {
+		scheduler.SetProvenanceSigner(conf.Provenance)
+	}
+	if conf.TracerProvider != nil {
+		scheduler.SetTracerProvider(conf.TracerProvider)
+	}
+	if conf.LoadLimits != nil {
+		scheduler.SetLoadLimits(*conf.LoadLimits)
+	} else {
+		scheduler.SetLoadLimits(scheduling.LoadLimits{MaxConcurrent: 1})
+	}
+	scheduler.SetPrefetchPolicy(conf.PrefetchPolicy)
+	profile := conf.Profile
+	if profile == nil {
+		defaultProfile, err := scheduling.LookupProfile(scheduling.DefaultProfile)
+		if err != nil {
+			return err
+		}
+		profile = &defaultProfile
+	}
+	scheduler.SetProfile(ctx, *profile)
+	scheduler.SetWindowPolicy(conf.WindowPolicy)
+	if err := scheduler.SetBackpressurePolicy(conf.Backpressure); err != nil {
+		return fmt.Errorf("invalid backpressure policy: %w", err)
+	}
+	if err := scheduler.SetJailbreakPolicy(conf.Jailbreak); err != nil {
+		return fmt.Errorf("invalid jailbreak policy: %w", err)
+	}
+	if err := scheduler.SetRequestQueuePolicy(conf.RequestQueue); err != nil {
+		return fmt.Errorf("invalid request queue policy: %w", err)
+	}
+	if conf.VirtualModels != nil {
+		if err := scheduler.SetVirtualModels(conf.VirtualModels); err != nil {
+			return fmt.Errorf("invalid virtual models: %w", err)
+		}
+	}
+	if conf.Pipelines != nil {
+		if err := scheduler.SetPipelines(conf.Pipelines); err != nil {
+			return fmt.Errorf("invalid pipelines: %w", err)
+		}
+	}
+	if conf.Quirks != nil {
+		if err := scheduler.SetQuirks(conf.Quirks); err != nil {
+			return fmt.Errorf("invalid quirk rules: %w", err)
+		}
+	}
+	scheduler.SetModerationModel(conf.ModerationModel)
+	if conf.Transcriber != nil {
+		scheduler.SetTranscriber(conf.Transcriber)
+	}
+	if conf.MaxUserAgents > 0 {
+		scheduler.SetMaxUserAgents(conf.MaxUserAgents)
+	}
+	if conf.ResourceSnapshots {
+		scheduler.EnableResourceSnapshots()
+	}
+	if conf.Fixtures != nil {
+		scheduler.SetFixtureStore(conf.Fixtures)
+	}
+	if conf.StateStorage != nil {
+		if err := scheduler.SetStateStorage(ctx, conf.StateStorage); err != nil {
+			return fmt.Errorf("loading persisted serving state: %w", err)
+		}
+	}
+	return nil
+}
+
+// newRouter creates the router serving the API of the model runner and its
+// enabled subsystems.
+func (m *ModelRunner) newRouter(conf Config) *routing.NormalizedServeMux {
+	log, scheduler := m.log, m.scheduler
+	router := routing.NewNormalizedServeMux()
+
+	// Register path prefixes to forward all HTTP methods (including OPTIONS) to components
+	// Components handle method routing internally
+	// Register both with and without trailing slash to avoid redirects
+	router.Handle(inference.ModelsPrefix, m.modelHandler)
+	router.Handle(inference.ModelsPrefix+"/", m.modelHandler)
+	router.Handle(inference.InferencePrefix+"/", scheduler)
+	// Add path aliases: /v1 -> /engines/v1, /rerank -> /engines/rerank, /score -> /engines/score.
+	aliasHandler := &middleware.AliasHandler{Handler: scheduler}
+	router.Handle("/v1/", aliasHandler)
+	router.Handle("/rerank", aliasHandler)
+	router.Handle("/score", aliasHandler)
+
+	// Add Ollama API compatibility layer (only register with trailing slash to catch sub-paths)
+	ollamaHandler := ollama.NewHandler(log, scheduler, conf.AllowedOrigins, m.modelHandler.Manager())
+	router.Handle(ollama.APIPrefix+"/", ollamaHandler)
+
+	// Add the vector store API if enabled. It's registered under its own
+	// prefix, which takes precedence over the scheduler's.
+	if conf.VectorStores != nil {
+		vectorStoreHandler := vectorstore.NewHandler(log.WithField("component", "vector-stores"), scheduler, conf.AllowedOrigins, conf.VectorStores)
+		handleWithAlias(router, vectorstore.APIPath, vectorStoreHandler)
+		// Allow chat completion requests to be grounded in vector stores.
+		scheduler.SetRetriever(vectorStoreHandler, conf.RetrievalTemplate)
+	}
+
+	// Add the prompt template library if enabled, which lets chat completion
+	// requests reference named templates.
+	if conf.PromptTemplates != nil {
+		handleWithAlias(router, prompts.APIPath, prompts.NewHandler(log.WithField("component", "prompt-templates"), conf.AllowedOrigins, conf.PromptTemplates))
+		scheduler.SetPromptTemplates(conf.PromptTemplates)
+	}
+
+	// Add the Files API, which stores batch inputs and attachments.
+	if conf.Files != nil {
+		handleWithAlias(router, files.FilesPath, files.NewHandler(log.WithField("component", "files"), conf.AllowedOrigins, conf.Files))
+	}
+
+	// Add the PII detection API, which detects sensitive data with patterns
+	// and, optionally, a model served by the scheduler.
+	piiHandler := pii.NewHandler(log.WithField("component", "pii"), scheduler, conf.AllowedOrigins)
+	router.Handle(inference.InferencePrefix+pii.APIPath, piiHandler)
+	router.Handle(pii.APIPath, &middleware.AliasHandler{Handler: piiHandler})
+
+	// Add the streaming transcription API if enabled, which transcribes
+	// audio streamed over WebSockets.
+	if conf.Transcriber != nil {
+		handleWithAlias(router, transcription.APIPath, transcription.NewHandler(log.WithField("component", "transcription"), conf.Transcriber, conf.AllowedOrigins))
+	}
+
+	// Add the Batch API if enabled, which processes batches of requests in
+	// the background whenever no other requests are in flight.
+	var batches jobs.Batches
+	if conf.Batches != nil {
+		m.batches = batch.NewHandler(log.WithField("component", "batches"), scheduler, conf.AllowedOrigins, conf.Batches)
+		handleWithAlias(router, batch.BatchesPath, m.batches)
+		batches = m.batches
+	}
+
+	// Add scheduled jobs if enabled, which run prompts or batch files on a
+	// schedule.
+	if conf.Jobs != nil {
+		m.jobs = jobs.NewHandler(log.WithField("component", "jobs"), scheduler, conf.AllowedOrigins, conf.Jobs, conf.Files, batches)
+		handleWithAlias(router, jobs.JobsPath, m.jobs)
+	}
+
+	// Add the traffic replay API, which replays recordings against the
+	// model runner's handler, including its middleware.
+	replayHandler := traffic.NewHandler(log.WithField("component", "traffic"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.handler.ServeHTTP(w, r)
+	}), conf.AllowedOrigins)
+	router.Handle(inference.InferencePrefix+traffic.ReplayPath, replayHandler)
+
+	// Add the pull proxy API if pull proxies are configurable.
+	if conf.PullProxy != nil {
+		router.Handle(inference.InferencePrefix+pullproxy.APIPath, pullproxy.NewHandler(log.WithField("component", "pull-proxy"), conf.PullProxy, conf.AllowedOrigins))
+	}
+
+	// Add the credentials API if credentials are stored.
+	if conf.Credentials != nil {
+		credentialsHandler := credentials.NewHandler(log.WithField("component", "credentials"), conf.Credentials, conf.AllowedOrigins)
+		router.Handle(inference.InferencePrefix+credentials.APIPath, credentialsHandler)
+		router.Handle(inference.InferencePrefix+credentials.APIPath+"/", credentialsHandler)
+	}
+
+	// Add the security events feed if failed authentication attempts are
+	// tracked.
+	if conf.AccessPolicy != nil && conf.SecurityMonitor != nil {
+		router.Handle(inference.InferencePrefix+security.APIPath, security.NewHandler(log.WithField("component", "security"), conf.SecurityMonitor, conf.AllowedOrigins))
+	}
+
+	// Add the fault injection API if chaos mode is enabled.
+	if conf.Chaos != nil {
+		router.Handle(inference.InferencePrefix+chaos.APIPath, chaos.NewHandler(log.WithField("component", "chaos"), conf.Chaos, conf.AllowedOrigins))
+	}
+
+	// Add the features API, which reports the optional capabilities enabled
+	// on this build and platform.
+	handleWithAlias(router, features.APIPath, features.NewHandler(log.WithField("component", "features"), conf.AllowedOrigins, func() features.Report {
+		return m.features(conf)
+	}))
+
+	// Add the version API, which reports build metadata and backend
+	// versions.
+	handleWithAlias(router, version.APIPath, version.NewHandler(log.WithField("component", "version"), conf.AllowedOrigins, m.backendVersions))
+
+	// Register root handler LAST - it will only catch exact "/" requests that don't match other patterns
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// Only respond to exact root path
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Docker Model Runner is running"))
+	})
+
+	// Add metrics endpoint if enabled
+	if !conf.DisableMetrics {
+		router.Handle("/metrics", metrics.NewAggregatedMetricsHandler(log.WithField("component", "metrics"), scheduler))
+	}
+	return router
+}
+
+// backendVersions returns the versions of the running backends, keyed by
+// name.
+func (m *ModelRunner) backendVersions() map[string]string {
+	versions := make(map[string]string)
+	for name, backend := range m.backends {
+		if v := version.BackendVersion(backend.Status()); v != "" {
+			versions[name] = v
+		}
+	}
+	return versions
+}
+
+// handleWithAlias registers a subsystem's handler under the inference prefix
+// and, as an alias, at the root.
+func handleWithAlias(router *routing.NormalizedServeMux, path string, handler http.Handler) {
+	router.Handle(inference.InferencePrefix+path, handler)
+	router.Handle(inference.InferencePrefix+path+"/", handler)
+	aliasHandler := &middleware.AliasHandler{Handler: handler}
+	router.Handle(path, aliasHandler)
+	router.Handle(path+"/", aliasHandler)
+}
+
+// Handler returns the handler serving the model runner's API.
+func (m *ModelRunner) Handler() http.Handler {
+	return m.publicHandler
+}
+
+// Scheduler returns the inference scheduler, e.g. to change its settings at
+// runtime.
+func (m *ModelRunner) Scheduler() *scheduling.Scheduler {
+	return m.scheduler
+}
+
+// ModelManager returns the model manager.
+func (m *ModelRunner) ModelManager() *models.Manager {
+	return m.modelHandler.Manager()
+}
+
+// Run runs the model runner's background work, such as loading and unloading
+// models and processing batches, until ctx is cancelled. By the time it
+// returns, all models have been unloaded from memory. Requests shouldn't be
+// served once it returns.
+func (m *ModelRunner) Run(ctx context.Context) error {
+	if m.batches != nil {
+		go m.batches.Run(ctx)
+	}
+	if m.jobs != nil {
+		go m.jobs.Run(ctx)
+	}
+
+	// Purge expired models from the trash.
+	go m.modelHandler.RunTrashSweeper(ctx)
+
+	// Watch the model drop folder, if configured.
+	if m.dropFolder != "" {
+		dropFolder, err := filepath.Abs(m.dropFolder)
+		if err != nil {
+			return fmt.Errorf("invalid drop folder: %w", err)
+		}
+		go m.ModelManager().WatchDropFolder(ctx, dropFolder)
+	}
+
+	return m.scheduler.Run(ctx)
+}
@@ -0,0 +1,187 @@
+package modelrunner
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/features"
+	"github.com/docker/model-runner/pkg/files"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/backends/mock"
+	"github.com/docker/model-runner/pkg/jobs"
+	"github.com/docker/model-runner/pkg/middleware"
+	"github.com/docker/model-runner/pkg/storage"
+	"github.com/docker/model-runner/pkg/version"
+	"github.com/sirupsen/logrus"
+)
+
+type systemMemoryInfo struct{}
+
+func (i systemMemoryInfo) HaveSufficientMemory(inference.RequiredMemory) (bool, error) {
+	return true, nil
+}
+
+func (i systemMemoryInfo) GetTotalMemory() inference.RequiredMemory {
+	return inference.RequiredMemory{}
+}
+
+func newTestConfig(t *testing.T) Config {
+	t.Helper()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	mockBackend, err := mock.New(log.WithField("component", mock.Name), mock.NewDefaultConfig([]string{"mock/*"}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dir := t.TempDir()
+	return Config{
+		Log:                   log,
+		ModelsPath:            filepath.Join(dir, "models"),
+		LlamaServerPath:       filepath.Join(dir, "bin"),
+		LlamaServerUpdatePath: filepath.Join(dir, "updated"),
+		SystemMemoryInfo:      systemMemoryInfo{},
+		Backends:              map[string]inference.Backend{mock.Name: mockBackend},
+		ReadOnly:              true,
+	}
+}
+
+func TestNew(t *testing.T) {
+	modelRunner, err := New(context.Background(), newTestConfig(t))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler := modelRunner.Handler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/engines/status", nil))
+	var status map[string]string
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Invalid status %s: %v", recorder.Body.String(), err)
+	}
+	for _, backend := range []string{"llama.cpp", "vllm", "mlx", mock.Name} {
+		if _, ok := status[backend]; !ok {
+			t.Errorf("Expected backend %s in %v", backend, status)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/models/create", strings.NewReader(`{"from":"ai/smollm2"}`)))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected pulls to be forbidden in read-only mode, got status %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/files", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected the Files API to be disabled, got status %d", recorder.Code)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.DefaultBackend = "missing"
+	if _, err := New(context.Background(), conf); err == nil {
+		t.Error("Expected error for an unknown default backend")
+	}
+
+	conf = newTestConfig(t)
+	var err error
+	if conf.Jobs, err = jobs.NewManager(conf.Log, storage.NewMemory()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := New(context.Background(), conf); err == nil {
+		t.Error("Expected error for jobs without files")
+	}
+	if conf.Files, err = files.NewManager(conf.Log, t.TempDir(), files.Limits{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := New(context.Background(), conf); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestNewAccessPolicy(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.AccessPolicy = &middleware.AccessPolicy{
+		APIKeys:   map[string]middleware.Role{"admin-key": middleware.RoleAdmin},
+		Anonymous: middleware.RoleInference,
+	}
+	modelRunner, err := New(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler := modelRunner.Handler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/engines/status", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected anonymous status queries to be allowed, got status %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var info version.Info
+	if err := json.Unmarshal(recorder.Body.Bytes(), &info); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("Invalid version %d %s: %v", recorder.Code, recorder.Body.String(), err)
+	}
+	if info.APIRevision != version.APIRevision || info.Version != version.Version {
+		t.Errorf("Unexpected version %+v", info)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/engines/requests", nil))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected anonymous record queries to be forbidden, got status %d", recorder.Code)
+	}
+	if recorder.Header().Get(version.APIRevisionHeader) == "" {
+		t.Error("Expected denied requests to report the API revision")
+	}
+
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/engines/requests", nil)
+	req.Header.Set("Authorization", "Bearer admin-key")
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected the admin to query records, got status %d", recorder.Code)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	conf := newTestConfig(t)
+	conf.AccessPolicy = &middleware.AccessPolicy{Anonymous: middleware.RoleInference}
+	modelRunner, err := New(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	modelRunner.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/features", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected anonymous feature queries to be allowed, got status %d", recorder.Code)
+	}
+	var report features.Report
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid report %s: %v", recorder.Body.String(), err)
+	}
+	for name, enabled := range map[string]bool{
+		features.Vision:         true,
+		features.Files:          false,
+		features.Cluster:        false,
+		features.ReadOnly:       true,
+		features.AccessControl:  true,
+		features.FaultInjection: false,
+	} {
+		if report.Enabled(name) != enabled {
+			t.Errorf("Expected feature %s to be enabled: %t, got %+v", name, enabled, report.Features)
+		}
+	}
+	if len(report.Backends) != 5 || report.Backends[0].Name != "llama.cpp" || !report.Backends[0].Supported {
+		t.Errorf("Unexpected backends %+v", report.Backends)
+	}
+}
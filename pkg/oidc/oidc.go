@@ -0,0 +1,377 @@
+// Package oidc validates JSON Web Tokens issued by an OpenID Connect provider
+// and maps their scopes to access control roles, so that the model runner can
+// be put behind an enterprise identity provider instead of static API keys.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// clockSkew is the tolerated difference between the issuer's clock and
+	// ours when checking expiration and not-before times.
+	clockSkew = time.Minute
+	// keysRefreshInterval is the minimum interval between fetches of the
+	// issuer's keys, which are refetched when a token is signed with an
+	// unknown key, e.g. after the issuer rotates its keys.
+	keysRefreshInterval = time.Minute
+)
+
+// Config configures token validation.
+type Config struct {
+	// Issuer is the URL of the OpenID Connect issuer, which must match the
+	// iss claim of tokens.
+	Issuer string
+	// Audience must be one of the aud claims of tokens.
+	Audience string
+	// ScopeRoles maps token scopes to roles. A token gets the most privileged
+	// role of its scopes.
+	ScopeRoles map[string]middleware.Role
+	// HTTPClient fetches the issuer's discovery document and keys. If it's
+	// nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// ParseScopeRoles parses a comma-separated list of scope=role bindings.
+func ParseScopeRoles(value string) (map[string]middleware.Role, error) {
+	scopeRoles := make(map[string]middleware.Role)
+	for _, binding := range strings.Split(value, ",") {
+		if binding = strings.TrimSpace(binding); binding == "" {
+			continue
+		}
+		scope, name, ok := strings.Cut(binding, "=")
+		if !ok || scope == "" {
+			return nil, fmt.Errorf("invalid scope binding %q, expected scope=role", binding)
+		}
+		role, err := middleware.ParseRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scope binding %q: %w", binding, err)
+		}
+		scopeRoles[scope] = role
+	}
+	return scopeRoles, nil
+}
+
+// Validator validates tokens. It implements middleware.TokenValidator.
+type Validator struct {
+	config  Config
+	jwksURI string
+
+	m         sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewValidator creates a validator for the configured issuer, fetching its
+// discovery document and keys.
+func NewValidator(ctx context.Context, config Config) (*Validator, error) {
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("issuer and audience are required")
+	}
+	if len(config.ScopeRoles) == 0 {
+		return nil, errors.New("at least one scope must be mapped to a role")
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := getJSON(ctx, config.HTTPClient, strings.TrimSuffix(config.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+	if discovery.Issuer != config.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, expected %q", discovery.Issuer, config.Issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document has no jwks_uri")
+	}
+
+	v := &Validator{config: config, jwksURI: discovery.JWKSURI}
+	if err := v.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ValidateToken verifies the signature and claims of a token and returns its
+// subject along with the role granted by its scopes.
+func (v *Validator) ValidateToken(ctx context.Context, token string) (middleware.Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return middleware.Identity{}, errors.New("malformed token")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return middleware.Identity{}, fmt.Errorf("decoding header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return middleware.Identity{}, fmt.Errorf("decoding signature: %w", err)
+	}
+	key, err := v.key(ctx, header.KeyID)
+	if err != nil {
+		return middleware.Identity{}, err
+	}
+	if err := verify(header.Algorithm, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return middleware.Identity{}, err
+	}
+
+	var claims struct {
+		Issuer    string     `json:"iss"`
+		Subject   string     `json:"sub"`
+		Audience  stringList `json:"aud"`
+		Expiry    *float64   `json:"exp"`
+		NotBefore *float64   `json:"nbf"`
+		Scope     string     `json:"scope"`
+		Scopes    stringList `json:"scp"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return middleware.Identity{}, fmt.Errorf("decoding claims: %w", err)
+	}
+	now := time.Now()
+	switch {
+	case claims.Issuer != v.config.Issuer:
+		return middleware.Identity{}, fmt.Errorf("token issued by %q", claims.Issuer)
+	case !slices.Contains(claims.Audience, v.config.Audience):
+		return middleware.Identity{}, errors.New("token isn't intended for this audience")
+	case claims.Expiry == nil || now.After(time.Unix(int64(*claims.Expiry), 0).Add(clockSkew)):
+		return middleware.Identity{}, errors.New("token expired")
+	case claims.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(int64(*claims.NotBefore), 0)):
+		return middleware.Identity{}, errors.New("token not yet valid")
+	}
+
+	var role middleware.Role
+	for _, scope := range append(strings.Fields(claims.Scope), claims.Scopes...) {
+		if scopeRole, ok := v.config.ScopeRoles[scope]; ok && (role == "" || !role.Includes(scopeRole)) {
+			role = scopeRole
+		}
+	}
+	if role == "" {
+		return middleware.Identity{}, errors.New("no token scope grants a role")
+	}
+	return middleware.Identity{Name: claims.Subject, Role: role}, nil
+}
+
+// key returns the issuer's key with the specified ID, refetching the keys if
+// it's unknown.
+func (v *Validator) key(ctx context.Context, id string) (crypto.PublicKey, error) {
+	v.m.Lock()
+	defer v.m.Unlock()
+	if key, ok := v.keys[id]; ok {
+		return key, nil
+	}
+	if time.Since(v.fetchedAt) >= keysRefreshInterval {
+		if err := v.refreshKeysLocked(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok := v.keys[id]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", id)
+}
+
+// refreshKeys fetches the issuer's keys.
+func (v *Validator) refreshKeys(ctx context.Context) error {
+	v.m.Lock()
+	defer v.m.Unlock()
+	return v.refreshKeysLocked(ctx)
+}
+
+// refreshKeysLocked fetches the issuer's keys. The caller must hold v.m.
+func (v *Validator) refreshKeysLocked(ctx context.Context) error {
+	v.fetchedAt = time.Now()
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, v.config.HTTPClient, v.jwksURI, &jwks); err != nil {
+		return fmt.Errorf("fetching keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Skip unsupported keys, e.g. of new key types, rather than failing
+		// to validate any token.
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	v.keys = keys
+	return nil
+}
+
+// jsonWebKey is a public key in JWK format.
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	// RSA keys.
+	N string `json:"n"`
+	E string `json:"e"`
+	// Elliptic curve keys.
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// publicKey returns the public key.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// verify verifies a signature made with the specified algorithm.
+func verify(algorithm string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch algorithm[min(2, len(algorithm)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	invalid := errors.New("invalid signature")
+	switch {
+	case strings.HasPrefix(algorithm, "RS") || strings.HasPrefix(algorithm, "PS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return invalid
+		}
+		if algorithm[0] == 'P' {
+			if rsa.VerifyPSS(rsaKey, hash, digest, signature, nil) != nil {
+				return invalid
+			}
+		} else if rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature) != nil {
+			return invalid
+		}
+	case strings.HasPrefix(algorithm, "ES"):
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature)%2 != 0 {
+			return invalid
+		}
+		size := len(signature) / 2
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return invalid
+		}
+	default:
+		// Notably, unsigned ("none") and HMAC tokens are rejected.
+		return fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	return nil
+}
+
+// stringList is a claim that's either a space-separated string or an array of
+// strings.
+type stringList []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *stringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = strings.Fields(single)
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a token.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeInt decodes a base64url-encoded big-endian integer.
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// getJSON fetches and decodes a JSON document.
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
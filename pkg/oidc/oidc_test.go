@@ -0,0 +1,175 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+// issuer is a test OpenID Connect issuer.
+type issuer struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	iss := &issuer{rsaKey: rsaKey, ecKey: ecKey}
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	iss.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": iss.URL, "jwks_uri": iss.URL + "/keys"})
+		case "/keys":
+			json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+				{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+				{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+				{"kty": "OKP", "kid": "unsupported"},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+// token signs a token with the specified claims.
+func (iss *issuer) token(t *testing.T, algorithm string, claims map[string]any) string {
+	t.Helper()
+	kid := "rsa"
+	if algorithm == "ES256" {
+		kid = "ec"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": algorithm, "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	var err error
+	switch algorithm {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, iss.ecKey, digest[:])
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	default:
+		signature = []byte("unsigned")
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestValidateToken(t *testing.T) {
+	iss := newIssuer(t)
+	validator, err := NewValidator(context.Background(), Config{
+		Issuer:   iss.URL,
+		Audience: "model-runner",
+		ScopeRoles: map[string]middleware.Role{
+			"models:infer":  middleware.RoleInference,
+			"models:manage": middleware.RoleModelManager,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	valid := func(overrides map[string]any) map[string]any {
+		claims := map[string]any{"iss": iss.URL, "aud": "model-runner", "sub": "alice", "exp": time.Now().Add(time.Hour).Unix(), "scope": "openid models:infer"}
+		for key, value := range overrides {
+			claims[key] = value
+		}
+		return claims
+	}
+	tests := []struct {
+		name      string
+		algorithm string
+		claims    map[string]any
+		want      middleware.Role
+	}{
+		{name: "rsa", algorithm: "RS256", claims: valid(nil), want: middleware.RoleInference},
+		{name: "ecdsa", algorithm: "ES256", claims: valid(nil), want: middleware.RoleInference},
+		{name: "most privileged scope", algorithm: "RS256", claims: valid(map[string]any{"scope": "", "scp": []string{"models:manage", "models:infer"}, "aud": []string{"other", "model-runner"}}), want: middleware.RoleModelManager},
+		{name: "unsigned", algorithm: "none", claims: valid(nil)},
+		{name: "wrong issuer", algorithm: "RS256", claims: valid(map[string]any{"iss": "https://evil.example.com"})},
+		{name: "wrong audience", algorithm: "RS256", claims: valid(map[string]any{"aud": "other"})},
+		{name: "expired", algorithm: "RS256", claims: valid(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})},
+		{name: "not yet valid", algorithm: "RS256", claims: valid(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})},
+		{name: "no mapped scope", algorithm: "RS256", claims: valid(map[string]any{"scope": "openid"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := validator.ValidateToken(context.Background(), iss.token(t, tt.algorithm, tt.claims))
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("Expected the token to be rejected, got role %s", identity.Role)
+				}
+			} else if err != nil || identity.Role != tt.want || identity.Name != "alice" {
+				t.Errorf("Expected role %s for alice, got %+v (%v)", tt.want, identity, err)
+			}
+		})
+	}
+
+	// Tampered tokens are rejected.
+	token := iss.token(t, "RS256", valid(nil))
+	parts := strings.Split(token, ".")
+	claims, _ := json.Marshal(valid(map[string]any{"scope": "models:manage"}))
+	parts[1] = base64.RawURLEncoding.EncodeToString(claims)
+	if _, err := validator.ValidateToken(context.Background(), strings.Join(parts, ".")); err == nil {
+		t.Error("Expected a tampered token to be rejected")
+	}
+}
+
+func TestNewValidatorInvalidConfig(t *testing.T) {
+	iss := newIssuer(t)
+	scopeRoles := map[string]middleware.Role{"models:infer": middleware.RoleInference}
+	for _, config := range []Config{
+		{Issuer: iss.URL, ScopeRoles: scopeRoles},
+		{Issuer: iss.URL, Audience: "model-runner"},
+		{Issuer: iss.URL + "/other", Audience: "model-runner", ScopeRoles: scopeRoles},
+	} {
+		if _, err := NewValidator(context.Background(), config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
+
+func TestParseScopeRoles(t *testing.T) {
+	scopeRoles, err := ParseScopeRoles("models:infer=inference, models:admin=admin")
+	if err != nil || len(scopeRoles) != 2 || scopeRoles["models:admin"] != middleware.RoleAdmin {
+		t.Errorf("Unexpected scope roles %v (%v)", scopeRoles, err)
+	}
+	for _, value := range []string{"models:infer", "=admin", "models:infer=root"} {
+		if _, err := ParseScopeRoles(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
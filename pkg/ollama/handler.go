@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -853,8 +854,12 @@ func (h *Handler) handlePull(w http.ResponseWriter, r *http.Request) {
 
 		if !ollamaWriter.headersSent {
 			// Headers not sent yet - we can still use http.Error
+			status := http.StatusInternalServerError
+			if errors.Is(err, models.ErrPullNotAllowed) {
+				status = http.StatusServiceUnavailable
+			}
 			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(status)
 			if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
 				h.log.Errorf("failed to encode response: %v", err)
 			}
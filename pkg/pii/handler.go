@@ -0,0 +1,140 @@
+package pii
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// APIPath is the path of the PII detection route, relative to the
+	// inference prefix.
+	APIPath = "/v1/pii/detect"
+
+	// maximumRequestSize is the maximum size of a detection request.
+	maximumRequestSize = 1024 * 1024
+)
+
+// DetectRequest is the body of a detection request.
+type DetectRequest struct {
+	// Input is the text, or texts, in which to detect sensitive data.
+	Input json.RawMessage `json:"input"`
+	// Model is an optional model that detects sensitive data that patterns
+	// can't, such as names and addresses, in addition to patterns.
+	Model string `json:"model,omitempty"`
+	// Redact requests the inputs with the detected data redacted.
+	Redact bool `json:"redact,omitempty"`
+}
+
+// inputs returns the request's texts.
+func (r DetectRequest) inputs() ([]string, error) {
+	var input string
+	if err := json.Unmarshal(r.Input, &input); err == nil {
+		return []string{input}, nil
+	}
+	var inputs []string
+	if err := json.Unmarshal(r.Input, &inputs); err != nil || len(inputs) == 0 {
+		return nil, errors.New("input must be a string or a non-empty array of strings")
+	}
+	return inputs, nil
+}
+
+// DetectResult is the sensitive data detected in an input.
+type DetectResult struct {
+	Index    int      `json:"index"`
+	Entities []Entity `json:"entities"`
+	// Redacted is the input with the detected data redacted, if requested.
+	Redacted *string `json:"redacted,omitempty"`
+}
+
+// DetectResponse is the response to a detection request.
+type DetectResponse struct {
+	Object string         `json:"object"`
+	Model  string         `json:"model,omitempty"`
+	Data   []DetectResult `json:"data"`
+}
+
+// Handler implements the PII detection API.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	// scheduler serves the requests of detection models.
+	scheduler http.Handler
+}
+
+// NewHandler creates a new PII detection API handler whose detection models
+// are served by scheduler.
+func NewHandler(log logging.Logger, scheduler http.Handler, allowedOrigins []string) *Handler {
+	h := &Handler{
+		log:       log,
+		router:    http.NewServeMux(),
+		scheduler: scheduler,
+	}
+
+	h.router.HandleFunc("POST "+inference.InferencePrefix+APIPath, h.handleDetect)
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+func (h *Handler) handleDetect(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maximumRequestSize))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, "request too large", http.StatusBadRequest)
+		} else {
+			http.Error(w, "failed to read request body", http.StatusInternalServerError)
+		}
+		return
+	}
+	var request DetectRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	inputs, err := request.inputs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := DetectResponse{Object: "list", Model: request.Model, Data: make([]DetectResult, len(inputs))}
+	for i, input := range inputs {
+		entities := Detect(input)
+		if request.Model != "" {
+			modelEntities, err := DetectWithModel(r.Context(), h.scheduler, request.Model, input)
+			if err != nil {
+				h.log.Warnf("PII detection with model %s failed: %v", request.Model, err)
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			entities = Merge(entities, modelEntities...)
+		}
+		if entities == nil {
+			entities = []Entity{}
+		}
+		response.Data[i] = DetectResult{Index: i, Entities: entities}
+		if request.Redact {
+			redacted := RedactEntities(input, entities)
+			response.Data[i].Redacted = &redacted
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Warnf("Failed to encode PII detection response: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package pii
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandleDetect(t *testing.T) {
+	var modelRequest map[string]any
+	scheduler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &modelRequest)
+		w.Write([]byte(`{"choices":[{"message":{"content":"{\"entities\":[{\"type\":\"person\",\"text\":\"Jane Doe\"}]}"}}]}`))
+	})
+	h := NewHandler(logrus.New(), scheduler, nil)
+	detect := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, inference.InferencePrefix+APIPath, strings.NewReader(body)))
+		return w
+	}
+
+	w := detect(`{"input":["Jane Doe, jane@example.com"],"model":"ai/smollm2","redact":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response DetectResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Data) != 1 || len(response.Data[0].Entities) != 2 || response.Data[0].Redacted == nil ||
+		*response.Data[0].Redacted != "[REDACTED_PERSON], [REDACTED_EMAIL]" {
+		t.Errorf("Unexpected response %s", w.Body.String())
+	}
+	if modelRequest["model"] != "ai/smollm2" {
+		t.Errorf("Unexpected model request %+v", modelRequest)
+	}
+
+	// Without a model, only patterns are used.
+	modelRequest = nil
+	w = detect(`{"input":"Jane Doe"}`)
+	if w.Code != http.StatusOK || modelRequest != nil || !strings.Contains(w.Body.String(), `"entities":[]`) || strings.Contains(w.Body.String(), "redacted") {
+		t.Errorf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := detect(`{"input":[]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
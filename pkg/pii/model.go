@@ -0,0 +1,128 @@
+package pii
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+const (
+	// userAgent is the User-Agent of model detection requests.
+	userAgent = "model-runner-pii"
+	// maximumErrorLength is the maximum length of a failed model detection
+	// request's error message.
+	maximumErrorLength = 256
+)
+
+// modelPrompt instructs models to extract sensitive data.
+const modelPrompt = `Extract the personally identifiable information in the user's text, ` +
+	`such as names of people, postal addresses, phone numbers, e-mail addresses, and credentials. ` +
+	`Respond only with a JSON object of the form {"entities": [{"type": "...", "text": "..."}]}, ` +
+	`where type is one of person, address, phone_number, email, or secret, ` +
+	`and text is copied exactly from the user's text.`
+
+// DetectWithModel returns the sensitive data detected in text by a model,
+// served by scheduler, ordered by offset. Entities that the model reports but
+// that don't appear in the text are ignored.
+func DetectWithModel(ctx context.Context, scheduler http.Handler, model, text string) ([]Entity, error) {
+	body, err := json.Marshal(map[string]any{
+		"model": model,
+		"messages": []map[string]string{
+			{"role": "system", "content": modelPrompt},
+			{"role": "user", "content": text},
+		},
+		"temperature":     0,
+		"response_format": map[string]string{"type": "json_object"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode request: %w", err)
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, inference.InferencePrefix+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", userAgent)
+	recorder := &responseRecorder{statusCode: http.StatusOK, headers: make(http.Header)}
+	scheduler.ServeHTTP(recorder, r)
+	if recorder.statusCode != http.StatusOK {
+		message := strings.TrimSpace(recorder.body.String())
+		if len(message) > maximumErrorLength {
+			message = message[:maximumErrorLength]
+		}
+		return nil, fmt.Errorf("model request failed with status %d: %s", recorder.statusCode, message)
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(recorder.body.Bytes(), &completion); err != nil || len(completion.Choices) == 0 {
+		return nil, errors.New("invalid model response")
+	}
+	return parseModelEntities(text, completion.Choices[0].Message.Content)
+}
+
+// parseModelEntities locates the entities reported by a model in text.
+func parseModelEntities(text, content string) ([]Entity, error) {
+	var reported struct {
+		Entities []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"entities"`
+	}
+	if err := json.Unmarshal([]byte(content), &reported); err != nil {
+		return nil, fmt.Errorf("invalid model output: %w", err)
+	}
+	var entities []Entity
+	for _, entity := range reported.Entities {
+		entityType := EntityType(strings.ToLower(strings.TrimSpace(entity.Type)))
+		if entityType == "" || strings.TrimSpace(entity.Text) == "" {
+			continue
+		}
+		for offset := 0; ; {
+			index := strings.Index(text[offset:], entity.Text)
+			if index < 0 {
+				break
+			}
+			start := offset + index
+			entities = Merge(entities, Entity{
+				Type:   entityType,
+				Text:   entity.Text,
+				Start:  start,
+				End:    start + len(entity.Text),
+				Source: SourceModel,
+			})
+			offset = start + len(entity.Text)
+		}
+	}
+	return entities, nil
+}
+
+// responseRecorder is a ResponseWriter that records a response.
+type responseRecorder struct {
+	statusCode int
+	headers    http.Header
+	body       bytes.Buffer
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.headers
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	return rr.body.Write(data)
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	rr.statusCode = statusCode
+}
@@ -0,0 +1,167 @@
+// Package pii detects and redacts personally identifiable information and
+// secrets in text. Detection is pattern-based, optionally complemented by a
+// small model, and is shared by the PII detection API, the redaction of
+// exported conversations, and moderation.
+package pii
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// EntityType is a type of sensitive data.
+type EntityType string
+
+const (
+	// EntitySecret is an API key, access token, or other credential.
+	EntitySecret EntityType = "secret"
+	// EntityEmail is an e-mail address.
+	EntityEmail EntityType = "email"
+	// EntityIPAddress is an IPv4 address.
+	EntityIPAddress EntityType = "ip"
+	// EntityCreditCard is a payment card number.
+	EntityCreditCard EntityType = "credit_card"
+	// EntitySSN is a US social security number.
+	EntitySSN EntityType = "ssn"
+	// EntityPhoneNumber is a phone number.
+	EntityPhoneNumber EntityType = "phone_number"
+	// EntityPerson is a person's name. It's only detected by models.
+	EntityPerson EntityType = "person"
+	// EntityAddress is a postal address. It's only detected by models.
+	EntityAddress EntityType = "address"
+)
+
+// Source is how an entity was detected.
+type Source string
+
+const (
+	// SourcePattern indicates that an entity was detected by a pattern.
+	SourcePattern Source = "pattern"
+	// SourceModel indicates that an entity was detected by a model.
+	SourceModel Source = "model"
+)
+
+// Entity is sensitive data detected in text.
+type Entity struct {
+	Type EntityType `json:"type"`
+	Text string     `json:"text"`
+	// Start and End are the byte offsets of the entity in the text.
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Source Source `json:"source"`
+}
+
+// detectors are the patterns of sensitive data, in order of precedence.
+// Secrets are detected first, so that credentials embedded in them aren't
+// partially detected as e-mail or IP addresses. If a pattern has a group, only
+// the group is detected.
+var detectors = []struct {
+	entityType EntityType
+	pattern    *regexp.Regexp
+	// valid, if set, validates matches.
+	valid func(match string) bool
+}{
+	{EntitySecret, regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]+=*)`), nil},
+	{EntitySecret, regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), nil},
+	{EntitySecret, regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}`), nil},
+	{EntitySecret, regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{20,}`), nil},
+	{EntitySecret, regexp.MustCompile(`\bhf_[A-Za-z0-9]{20,}`), nil},
+	{EntitySecret, regexp.MustCompile(`\bxox[abpr]-[A-Za-z0-9-]{10,}`), nil},
+	{EntitySecret, regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), nil},
+	{EntityEmail, regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), nil},
+	{EntityIPAddress, regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), nil},
+	{EntityCreditCard, regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), luhn},
+	{EntitySSN, regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), nil},
+	{EntityPhoneNumber, regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{3}\)|\b\d{3})[ .-]?\d{3}[ .-]\d{4}\b`), nil},
+}
+
+// Detect returns the sensitive data detected in text by patterns, ordered by
+// offset.
+func Detect(text string) []Entity {
+	var entities []Entity
+	for _, detector := range detectors {
+		for _, match := range detector.pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := match[0], match[1]
+			if len(match) > 2 {
+				start, end = match[2], match[3]
+			}
+			if detector.valid != nil && !detector.valid(text[start:end]) {
+				continue
+			}
+			entities = Merge(entities, Entity{
+				Type:   detector.entityType,
+				Text:   text[start:end],
+				Start:  start,
+				End:    end,
+				Source: SourcePattern,
+			})
+		}
+	}
+	return entities
+}
+
+// Merge adds entities to detected entities, ordered by offset, skipping those
+// that overlap detected ones.
+func Merge(detected []Entity, entities ...Entity) []Entity {
+	for _, entity := range entities {
+		if slices.ContainsFunc(detected, func(other Entity) bool {
+			return entity.Start < other.End && other.Start < entity.End
+		}) {
+			continue
+		}
+		index, _ := slices.BinarySearchFunc(detected, entity.Start, func(other Entity, start int) int {
+			return other.Start - start
+		})
+		detected = slices.Insert(detected, index, entity)
+	}
+	return detected
+}
+
+// Placeholder returns the placeholder that replaces redacted entities of a
+// type, e.g. "[REDACTED_EMAIL]".
+func Placeholder(entityType EntityType) string {
+	return "[REDACTED_" + strings.ToUpper(string(entityType)) + "]"
+}
+
+// RedactEntities replaces detected entities, ordered by offset, in text with
+// their placeholders.
+func RedactEntities(text string, entities []Entity) string {
+	var redacted strings.Builder
+	offset := 0
+	for _, entity := range entities {
+		redacted.WriteString(text[offset:entity.Start])
+		redacted.WriteString(Placeholder(entity.Type))
+		offset = entity.End
+	}
+	redacted.WriteString(text[offset:])
+	return redacted.String()
+}
+
+// Redact replaces the sensitive data detected in text by patterns with
+// placeholders.
+func Redact(text string) string {
+	return RedactEntities(text, Detect(text))
+}
+
+// luhn returns whether a card number, which may contain spaces or dashes,
+// passes the Luhn checksum.
+func luhn(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		if number[i] < '0' || number[i] > '9' {
+			continue
+		}
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
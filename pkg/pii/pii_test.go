@@ -0,0 +1,57 @@
+package pii
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	text := "Mail jane@example.com or call +1 555-123-4567 from 10.0.0.1, card 4111 1111 1111 1111, SSN 123-45-6789, key hf_abcdefghijklmnopqrstuv."
+	var types []EntityType
+	for _, entity := range Detect(text) {
+		if text[entity.Start:entity.End] != entity.Text || entity.Source != SourcePattern {
+			t.Errorf("Unexpected entity %+v", entity)
+		}
+		types = append(types, entity.Type)
+	}
+	expected := []EntityType{EntityEmail, EntityPhoneNumber, EntityIPAddress, EntityCreditCard, EntitySSN, EntitySecret}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected %v, got %v", expected, types)
+	}
+
+	// Numbers that fail the Luhn checksum aren't card numbers.
+	if entities := Detect("order 4111 1111 1111 1112"); len(entities) != 0 {
+		t.Errorf("Unexpected entities %+v", entities)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	text := "Authorization: Bearer abc.def-123 for jane@example.com"
+	expected := "Authorization: Bearer [REDACTED_SECRET] for [REDACTED_EMAIL]"
+	if redacted := Redact(text); redacted != expected {
+		t.Errorf("Expected %q, got %q", expected, redacted)
+	}
+}
+
+func TestParseModelEntities(t *testing.T) {
+	text := "Jane Doe met John at 1 Main St. Jane Doe left."
+	entities, err := parseModelEntities(text, `{"entities":[{"type":"Person","text":"Jane Doe"},{"type":"address","text":"1 Main St"},{"type":"person","text":"Nobody"}]}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entities) != 3 || entities[0].Start != 0 || entities[1].Type != EntityAddress || entities[2].Start != 32 || entities[2].Source != SourceModel {
+		t.Errorf("Unexpected entities %+v", entities)
+	}
+
+	// Pattern entities take precedence over overlapping model entities.
+	merged := Merge(Detect("Jane at jane@example.com"),
+		Entity{Type: EntityPerson, Text: "Jane", Start: 0, End: 4, Source: SourceModel},
+		Entity{Type: EntityPerson, Text: "jane", Start: 8, End: 12, Source: SourceModel})
+	if len(merged) != 2 || merged[0].Type != EntityPerson || merged[1].Type != EntityEmail {
+		t.Errorf("Unexpected merged entities %+v", merged)
+	}
+
+	if _, err := parseModelEntities(text, "not json"); err == nil {
+		t.Error("Expected error for invalid model output")
+	}
+}
@@ -0,0 +1,191 @@
+package prompts
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/prompttemplate"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// APIPath is the path of the prompt template API routes, relative to the
+	// inference prefix.
+	APIPath = "/v1/prompt_templates"
+
+	// maximumRequestSize is the maximum size of a template creation or update
+	// request.
+	maximumRequestSize = 1024 * 1024
+)
+
+// TemplateRequest is the body of a template creation or update request.
+type TemplateRequest struct {
+	// Name is the template's unique name.
+	Name string `json:"name"`
+	// Description describes the template.
+	Description string `json:"description,omitempty"`
+	// Messages are the template's messages, with {{variable}} placeholders.
+	Messages []prompttemplate.Message `json:"messages"`
+	// Variables declares the template's variables.
+	Variables []prompttemplate.Variable `json:"variables,omitempty"`
+}
+
+// template returns the template described by the request.
+func (r TemplateRequest) template() prompttemplate.Template {
+	return prompttemplate.Template{
+		Name:        r.Name,
+		Description: r.Description,
+		Messages:    r.Messages,
+		Variables:   r.Variables,
+	}
+}
+
+// listResponse is the response to a list request.
+type listResponse struct {
+	Object string                    `json:"object"`
+	Data   []prompttemplate.Template `json:"data"`
+}
+
+// deletedResponse is the response to a deletion request.
+type deletedResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+// Handler implements the prompt template API.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	manager     *Manager
+}
+
+// NewHandler creates a new prompt template API handler.
+func NewHandler(log logging.Logger, allowedOrigins []string, manager *Manager) *Handler {
+	h := &Handler{
+		log:     log,
+		router:  http.NewServeMux(),
+		manager: manager,
+	}
+
+	for route, handler := range h.routeHandlers() {
+		h.router.HandleFunc(route, handler)
+	}
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// routeHandlers returns the mapping of routes to their handlers.
+func (h *Handler) routeHandlers() map[string]http.HandlerFunc {
+	prefix := inference.InferencePrefix + APIPath
+	return map[string]http.HandlerFunc{
+		"POST " + prefix:                   h.handleCreate,
+		"GET " + prefix:                    h.handleList,
+		"GET " + prefix + "/{template}":    h.handleGet,
+		"POST " + prefix + "/{template}":   h.handleUpdate,
+		"DELETE " + prefix + "/{template}": h.handleDelete,
+	}
+}
+
+// decodeRequest decodes a JSON request body, writing an error response and
+// returning false if it can't be decoded.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maximumRequestSize))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, "request too large", http.StatusBadRequest)
+		} else {
+			http.Error(w, "failed to read request body", http.StatusInternalServerError)
+		}
+		return false
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeJSON writes a JSON response.
+func (h *Handler) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warnf("Failed to encode prompt template response: %v", err)
+	}
+}
+
+// writeError writes an error response with the status appropriate for err.
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, prompttemplate.ErrTemplateNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, prompttemplate.ErrInvalidTemplate):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrNameInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		h.log.Warnf("Prompt template request failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var request TemplateRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	template, err := h.manager.Create(request.template())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, template)
+}
+
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, listResponse{Object: "list", Data: h.manager.List()})
+}
+
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	template, err := h.manager.Get(r.PathValue("template"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, template)
+}
+
+func (h *Handler) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var request TemplateRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	template, err := h.manager.Update(r.PathValue("template"), request.template())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, template)
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("template")
+	if err := h.manager.Delete(id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, deletedResponse{ID: id, Object: "prompt_template.deleted", Deleted: true})
+}
@@ -0,0 +1,91 @@
+package prompts
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/prompttemplate"
+	"github.com/docker/model-runner/pkg/internal/testutil"
+	"github.com/docker/model-runner/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestHandler(t *testing.T, kv storage.KV) *Handler {
+	t.Helper()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	manager, err := NewManager(log, kv)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	return NewHandler(log, nil, manager)
+}
+
+// serve performs a request and decodes a successful JSON response into v.
+func serve(t *testing.T, handler http.Handler, method, path, body string, v any) int {
+	t.Helper()
+	return testutil.Serve(t, handler, httptest.NewRequest(method, inference.InferencePrefix+APIPath+path, strings.NewReader(body)), v)
+}
+
+func TestHandler(t *testing.T) {
+	kv, err := storage.NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	handler := newTestHandler(t, kv)
+
+	var created prompttemplate.Template
+	if code := serve(t, handler, http.MethodPost, "", `{"name": "summarize", "messages": [{"role": "system", "content": "Summarize for {{audience}}."}], "variables": [{"name": "audience", "default": "engineers"}]}`, &created); code != http.StatusOK {
+		t.Fatalf("Expected creation to succeed, got status %d", code)
+	}
+	if !strings.HasPrefix(created.ID, "pt_") || created.Object != "prompt_template" || created.Version != 1 {
+		t.Errorf("Unexpected template %+v", created)
+	}
+	if code := serve(t, handler, http.MethodPost, "", `{"name": "summarize", "messages": [{"role": "user", "content": "Hi"}]}`, nil); code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a duplicate name, got %d", code)
+	}
+
+	var updated prompttemplate.Template
+	if code := serve(t, handler, http.MethodPost, "/"+created.ID, `{"name": "summarize", "messages": [{"role": "system", "content": "Be brief."}]}`, &updated); code != http.StatusOK {
+		t.Fatalf("Expected update to succeed, got status %d", code)
+	}
+	if updated.Version != 2 || updated.CreatedAt != created.CreatedAt || len(updated.Variables) != 0 {
+		t.Errorf("Unexpected updated template %+v", updated)
+	}
+
+	// Templates are persisted.
+	handler = newTestHandler(t, kv)
+	var list listResponse
+	serve(t, handler, http.MethodGet, "", "", &list)
+	if len(list.Data) != 1 || list.Data[0].Version != 2 || list.Data[0].Messages[0].Content != "Be brief." {
+		t.Errorf("Unexpected templates %+v", list.Data)
+	}
+
+	if code := serve(t, handler, http.MethodDelete, "/"+created.ID, "", nil); code != http.StatusOK {
+		t.Errorf("Expected deletion to succeed, got status %d", code)
+	}
+	if code := serve(t, handler, http.MethodGet, "/"+created.ID, "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a deleted template, got %d", code)
+	}
+}
+
+func TestHandlerValidation(t *testing.T) {
+	handler := newTestHandler(t, storage.NewMemory())
+	for _, body := range []string{
+		`{"messages": [{"role": "user", "content": "Hi"}]}`,
+		`{"name": "empty"}`,
+		`{"name": "undeclared", "messages": [{"role": "user", "content": "{{topic}}"}]}`,
+		`{"name": "invalid"`,
+	} {
+		if code := serve(t, handler, http.MethodPost, "", body, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, code)
+		}
+	}
+	if code := serve(t, handler, http.MethodPost, "/pt_missing", `{"name": "missing", "messages": [{"role": "user", "content": "Hi"}]}`, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing template, got %d", code)
+	}
+}
@@ -0,0 +1,188 @@
+// Package prompts implements a library of named prompt templates, which chat
+// completion requests can reference by ID to standardize prompts across
+// applications.
+package prompts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference/prompttemplate"
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+// ErrNameInUse indicates that a template's name is already used by another
+// template. If returned in conjunction with an HTTP request, it should be
+// paired with a 409 response status.
+var ErrNameInUse = errors.New("prompt template name already in use")
+
+// storageKeyPrefix prefixes the storage keys of templates, so that templates
+// may share storage with other state.
+const storageKeyPrefix = "prompt-templates/"
+
+// Manager manages the prompt templates persisted in storage, each under
+// prompt-templates/<id>.
+type Manager struct {
+	// storage persists templates.
+	storage storage.KV
+	// mu guards templates.
+	mu sync.Mutex
+	// templates maps template IDs to templates.
+	templates map[string]prompttemplate.Template
+}
+
+// NewManager creates a manager for the prompt templates persisted in kv.
+// Templates that can't be loaded are logged and skipped.
+func NewManager(log logging.Logger, kv storage.KV) (*Manager, error) {
+	keys, err := kv.List(storageKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list prompt templates: %w", err)
+	}
+
+	m := &Manager{storage: kv, templates: make(map[string]prompttemplate.Template)}
+	for _, key := range keys {
+		data, err := kv.Get(key)
+		var template prompttemplate.Template
+		if err == nil {
+			err = json.Unmarshal(data, &template)
+		}
+		if err != nil {
+			log.Warnf("Skipping prompt template %s: %v", key, err)
+			continue
+		}
+		m.templates[template.ID] = template
+	}
+	return m, nil
+}
+
+// nameInUse returns whether a template other than the one with the specified
+// ID uses name. The caller must hold the manager's lock.
+func (m *Manager) nameInUse(name, id string) bool {
+	for _, template := range m.templates {
+		if template.Name == name && template.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// Create validates and persists a new template, assigning its ID, version,
+// and timestamps.
+func (m *Manager) Create(template prompttemplate.Template) (prompttemplate.Template, error) {
+	now := time.Now().Unix()
+	template.ID = utils.NewID("pt_")
+	template.Object = "prompt_template"
+	template.Version = 1
+	template.CreatedAt, template.UpdatedAt = now, now
+	if template.Variables == nil {
+		template.Variables = []prompttemplate.Variable{}
+	}
+	if err := template.Validate(); err != nil {
+		return prompttemplate.Template{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.nameInUse(template.Name, template.ID) {
+		return prompttemplate.Template{}, fmt.Errorf("%w: %q", ErrNameInUse, template.Name)
+	}
+	if err := m.save(template); err != nil {
+		return prompttemplate.Template{}, err
+	}
+	m.templates[template.ID] = template
+	return template, nil
+}
+
+// Update validates and persists new contents for an existing template,
+// incrementing its version.
+func (m *Manager) Update(id string, contents prompttemplate.Template) (prompttemplate.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	template, ok := m.templates[id]
+	if !ok {
+		return prompttemplate.Template{}, prompttemplate.ErrTemplateNotFound
+	}
+	template.Name = contents.Name
+	template.Description = contents.Description
+	template.Messages = contents.Messages
+	template.Variables = contents.Variables
+	if template.Variables == nil {
+		template.Variables = []prompttemplate.Variable{}
+	}
+	template.Version++
+	template.UpdatedAt = time.Now().Unix()
+	if err := template.Validate(); err != nil {
+		return prompttemplate.Template{}, err
+	}
+	if m.nameInUse(template.Name, id) {
+		return prompttemplate.Template{}, fmt.Errorf("%w: %q", ErrNameInUse, template.Name)
+	}
+	if err := m.save(template); err != nil {
+		return prompttemplate.Template{}, err
+	}
+	m.templates[id] = template
+	return template, nil
+}
+
+// List returns all templates, sorted by name.
+func (m *Manager) List() []prompttemplate.Template {
+	m.mu.Lock()
+	templates := make([]prompttemplate.Template, 0, len(m.templates))
+	for _, template := range m.templates {
+		templates = append(templates, template)
+	}
+	m.mu.Unlock()
+	slices.SortFunc(templates, func(a, b prompttemplate.Template) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return templates
+}
+
+// Get returns a template.
+func (m *Manager) Get(id string) (prompttemplate.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	template, ok := m.templates[id]
+	if !ok {
+		return prompttemplate.Template{}, prompttemplate.ErrTemplateNotFound
+	}
+	return template, nil
+}
+
+// Delete deletes a template.
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.templates[id]; !ok {
+		return prompttemplate.ErrTemplateNotFound
+	}
+	if err := m.storage.Delete(storageKeyPrefix + id); err != nil {
+		return fmt.Errorf("unable to delete prompt template: %w", err)
+	}
+	delete(m.templates, id)
+	return nil
+}
+
+// PromptTemplate implements prompttemplate.Store.PromptTemplate.
+func (m *Manager) PromptTemplate(id string) (prompttemplate.Template, error) {
+	return m.Get(id)
+}
+
+// save persists a template. The caller must hold the manager's lock.
+func (m *Manager) save(template prompttemplate.Template) error {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("unable to encode prompt template: %w", err)
+	}
+	if err := m.storage.Put(storageKeyPrefix+template.ID, data); err != nil {
+		return fmt.Errorf("unable to write prompt template: %w", err)
+	}
+	return nil
+}
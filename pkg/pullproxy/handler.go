@@ -0,0 +1,93 @@
+package pullproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// APIPath is the path of the pull proxy configuration route, relative to
+	// the inference prefix.
+	APIPath = "/pull-proxy"
+
+	// maximumConfigSize is the maximum size of a configuration.
+	maximumConfigSize = 1024 * 1024
+)
+
+// LoadConfig reads and validates the configuration in the file at path.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to read pull proxy configuration: %w", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("invalid pull proxy configuration: %w", err)
+	}
+	if err := config.Normalize(); err != nil {
+		return Config{}, fmt.Errorf("invalid pull proxy configuration: %w", err)
+	}
+	return config, nil
+}
+
+// Handler implements the pull proxy API, which inspects and replaces the
+// selector's configuration at runtime.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	selector    *Selector
+}
+
+// NewHandler creates a new pull proxy API handler for selector.
+func NewHandler(log logging.Logger, selector *Selector, allowedOrigins []string) *Handler {
+	h := &Handler{
+		log:      log,
+		router:   http.NewServeMux(),
+		selector: selector,
+	}
+
+	h.router.HandleFunc("GET "+inference.InferencePrefix+APIPath, h.handleGetConfig)
+	h.router.HandleFunc("PUT "+inference.InferencePrefix+APIPath, h.handleConfigure)
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// handleGetConfig returns the configuration, without proxy passwords.
+func (h *Handler) handleGetConfig(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.selector.Config().Redacted()); err != nil {
+		h.log.Warnf("Failed to encode pull proxy configuration: %v", err)
+	}
+}
+
+// handleConfigure replaces the configuration. An empty configuration uses the
+// proxy environment variables.
+func (h *Handler) handleConfigure(w http.ResponseWriter, r *http.Request) {
+	var config Config
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maximumConfigSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		http.Error(w, fmt.Sprintf("invalid configuration: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := h.selector.Configure(config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.log.Infof("Pull proxy configured with %d rules", len(config.Rules))
+	h.handleGetConfig(w, r)
+}
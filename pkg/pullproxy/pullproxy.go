@@ -0,0 +1,230 @@
+// Package pullproxy routes model pulls and pushes through HTTP(S) or SOCKS
+// proxies, with per-destination rules, separately from other traffic, e.g.
+// for corporate networks requiring a proxy for large downloads.
+package pullproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Direct is the proxy of rules whose destinations are reached without a proxy.
+const Direct = "direct"
+
+// proxySchemes are the supported proxy URL schemes.
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// Rule routes the requests to some destinations through a proxy.
+type Rule struct {
+	// Hosts are the destination hosts that the rule applies to: host names,
+	// which also match their subdomains if they start with "." or "*.",
+	// addresses, CIDR prefixes, or "*" for all hosts.
+	Hosts []string `json:"hosts"`
+	// Proxy is the URL of the proxy, e.g. "http://proxy:3128" or
+	// "socks5://proxy:1080", or Direct.
+	Proxy string `json:"proxy"`
+}
+
+// Config configures the proxies used for pulls and pushes. An empty
+// configuration uses the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment
+// variables.
+type Config struct {
+	// Rules route the requests to matching destinations, in order, taking
+	// precedence over Proxy and NoProxy.
+	Rules []Rule `json:"rules,omitempty"`
+	// Proxy is the URL of the proxy used for other destinations, if any.
+	Proxy string `json:"proxy,omitempty"`
+	// NoProxy are the destinations reached without Proxy, in the syntax of
+	// the NO_PROXY environment variable.
+	NoProxy []string `json:"no_proxy,omitempty"`
+}
+
+// isEmpty returns whether the configuration is empty.
+func (c Config) isEmpty() bool {
+	return len(c.Rules) == 0 && c.Proxy == "" && len(c.NoProxy) == 0
+}
+
+// Normalize validates the configuration.
+func (c *Config) Normalize() error {
+	for i, rule := range c.Rules {
+		if len(rule.Hosts) == 0 {
+			return fmt.Errorf("rule %d has no hosts", i)
+		}
+		for _, host := range rule.Hosts {
+			if strings.TrimSpace(host) == "" {
+				return fmt.Errorf("rule %d has an empty host", i)
+			}
+		}
+		if rule.Proxy != Direct {
+			if _, err := parseProxy(rule.Proxy); err != nil {
+				return fmt.Errorf("rule %d: %w", i, err)
+			}
+		}
+	}
+	if c.Proxy != "" {
+		if _, err := parseProxy(c.Proxy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration without proxy passwords.
+func (c Config) Redacted() Config {
+	redact := func(proxy string) string {
+		if u, err := url.Parse(proxy); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+		return proxy
+	}
+	redacted := Config{Proxy: redact(c.Proxy), NoProxy: slices.Clone(c.NoProxy)}
+	for _, rule := range c.Rules {
+		redacted.Rules = append(redacted.Rules, Rule{Hosts: slices.Clone(rule.Hosts), Proxy: redact(rule.Proxy)})
+	}
+	return redacted
+}
+
+// parseProxy parses the URL of a proxy.
+func parseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", redactedURL(proxy))
+	}
+	if !slices.Contains(proxySchemes, u.Scheme) {
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected one of %s", u.Scheme, strings.Join(proxySchemes, ", "))
+	}
+	return u, nil
+}
+
+// redactedURL redacts the credentials of a URL that may not parse.
+func redactedURL(value string) string {
+	if scheme, rest, ok := strings.Cut(value, "://"); ok {
+		if _, host, ok := strings.Cut(rest, "@"); ok {
+			return scheme + "://xxxxx@" + host
+		}
+	}
+	return value
+}
+
+// matches returns whether a host pattern matches a destination host.
+func matches(pattern, host string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*."), strings.HasPrefix(pattern, "."):
+		suffix := strings.TrimPrefix(pattern, "*")
+		return strings.HasSuffix(host, suffix) || host == suffix[1:]
+	}
+	if prefix, err := netip.ParsePrefix(pattern); err == nil {
+		addr, err := netip.ParseAddr(host)
+		return err == nil && prefix.Contains(addr.Unmap())
+	}
+	return host == pattern
+}
+
+// Selector selects the proxy of each pull or push request from its
+// configuration, which can be changed at runtime.
+type Selector struct {
+	// m protects the fields below.
+	m sync.RWMutex
+	// config is the configuration.
+	config Config
+	// proxy selects the proxy for destinations not matching any rule.
+	proxy func(*url.URL) (*url.URL, error)
+	// transports are the transports using the selector, whose idle
+	// connections are closed when the configuration changes.
+	transports []*http.Transport
+}
+
+// NewSelector creates a selector with an initial configuration.
+func NewSelector(config Config) (*Selector, error) {
+	s := &Selector{}
+	if err := s.Configure(config); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Configure replaces the configuration.
+func (s *Selector) Configure(config Config) error {
+	if err := config.Normalize(); err != nil {
+		return err
+	}
+	proxy := httpproxy.FromEnvironment().ProxyFunc()
+	if !config.isEmpty() {
+		proxy = (&httpproxy.Config{
+			HTTPProxy:  config.Proxy,
+			HTTPSProxy: config.Proxy,
+			NoProxy:    strings.Join(config.NoProxy, ","),
+		}).ProxyFunc()
+	}
+
+	s.m.Lock()
+	s.config = config
+	s.proxy = proxy
+	transports := slices.Clone(s.transports)
+	s.m.Unlock()
+
+	// Connections through the previous proxies are no longer reused.
+	for _, transport := range transports {
+		transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+// Config returns the configuration.
+func (s *Selector) Config() Config {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.config
+}
+
+// Proxy returns the URL of the proxy for a request, or nil if it's sent
+// directly. It has the signature of http.Transport.Proxy.
+func (s *Selector) Proxy(r *http.Request) (*url.URL, error) {
+	s.m.RLock()
+	config, proxy := s.config, s.proxy
+	s.m.RUnlock()
+
+	host := strings.ToLower(r.URL.Hostname())
+	for _, rule := range config.Rules {
+		if !slices.ContainsFunc(rule.Hosts, func(pattern string) bool { return matches(pattern, host) }) {
+			continue
+		}
+		if rule.Proxy == Direct {
+			return nil, nil
+		}
+		return parseProxy(rule.Proxy)
+	}
+	return proxy(r.URL)
+}
+
+// Transport returns a clone of base that selects proxies with the selector.
+func (s *Selector) Transport(base *http.Transport) *http.Transport {
+	transport := base.Clone()
+	transport.Proxy = s.Proxy
+	s.m.Lock()
+	s.transports = append(s.transports, transport)
+	s.m.Unlock()
+	return transport
+}
+
+// ParseNoProxy parses a comma-separated list of destinations reached without
+// a proxy.
+func ParseNoProxy(spec string) []string {
+	var hosts []string
+	for _, host := range strings.Split(spec, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
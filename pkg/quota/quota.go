@@ -0,0 +1,479 @@
+// Package quota enforces per-namespace token budgets over daily and monthly
+// periods and generates a usage report for each period as it ends.
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/storage"
+)
+
+// Period is the period over which a token budget applies. Periods start at
+// midnight UTC.
+type Period string
+
+const (
+	// Daily budgets reset every day.
+	Daily Period = "daily"
+	// Monthly budgets reset on the first day of every month.
+	Monthly Period = "monthly"
+)
+
+// periods are the tracked periods.
+var periods = []Period{Daily, Monthly}
+
+// AnyNamespace is the namespace of limits that apply to each namespace
+// without a limit of its own for the same period.
+const AnyNamespace = "*"
+
+// ResetHeader is the response header reporting when the exhausted budget of
+// a rejected request resets, in RFC 3339 format.
+const ResetHeader = "X-Quota-Reset"
+
+// maxReports is the maximum number of usage reports kept for each period.
+const maxReports = 100
+
+const (
+	// windowKeyPrefix prefixes the storage keys of the current usage of each
+	// period, which are followed by the period.
+	windowKeyPrefix = "quota/windows/"
+	// reportKeyPrefix prefixes the storage keys of usage reports, which are
+	// followed by the period and the start of the report.
+	reportKeyPrefix = "quota/reports/"
+)
+
+// start returns the start of the period containing t.
+func (p Period) start(t time.Time) time.Time {
+	t = t.UTC()
+	if p == Monthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// end returns the end of the period starting at start.
+func (p Period) end(start time.Time) time.Time {
+	if p == Monthly {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Limit is a token budget.
+type Limit struct {
+	// Namespace is the namespace whose requests are limited, or AnyNamespace.
+	Namespace string `json:"namespace"`
+	// Period is the period over which the budget applies.
+	Period Period `json:"period"`
+	// Tokens is the number of tokens (prompt and completion) that requests
+	// may use over the period.
+	Tokens int64 `json:"tokens"`
+}
+
+// validate returns an error if the limit is invalid.
+func (l Limit) validate() error {
+	switch {
+	case l.Namespace == "":
+		return fmt.Errorf("limit has no namespace")
+	case !slices.Contains(periods, l.Period):
+		return fmt.Errorf("limit for %s has unknown period %q, expected daily or monthly", l.Namespace, l.Period)
+	case l.Tokens <= 0:
+		return fmt.Errorf("limit for %s must allow a positive number of tokens", l.Namespace)
+	}
+	return nil
+}
+
+// ExceededError reports that a namespace has used its token budget.
+type ExceededError struct {
+	// Limit is the exhausted budget.
+	Limit Limit
+	// Namespace is the namespace of the request.
+	Namespace string
+	// Used is the number of tokens used over the period.
+	Used int64
+	// ResetAt is the time at which the budget resets.
+	ResetAt time.Time
+}
+
+// Error implements error.
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s token quota of %d exceeded for namespace %s, resets at %s",
+		e.Limit.Period, e.Limit.Tokens, e.Namespace, e.ResetAt.Format(time.RFC3339))
+}
+
+// Usage is the usage of a namespace over a period.
+type Usage struct {
+	Namespace string `json:"namespace"`
+	Tokens    int64  `json:"tokens"`
+	Requests  int64  `json:"requests"`
+	// Limit is the namespace's token budget for the period, or zero if it's
+	// unlimited.
+	Limit int64 `json:"limit,omitempty"`
+}
+
+// Report is the usage of all namespaces over a period.
+type Report struct {
+	Period Period    `json:"period"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// Usage is ordered by namespace.
+	Usage []Usage `json:"usage"`
+}
+
+// window is the usage over the current period.
+type window struct {
+	Start time.Time         `json:"start"`
+	Usage map[string]*Usage `json:"usage"`
+}
+
+// Tracker tracks the token usage of namespaces and enforces their limits.
+type Tracker struct {
+	// log is the associated logger.
+	log logging.Logger
+	// now returns the current time.
+	now func() time.Time
+	// m protects the fields below.
+	m sync.Mutex
+	// limits are the token budgets.
+	limits []Limit
+	// windows maps periods to their current usage.
+	windows map[Period]*window
+	// reports maps periods to their usage reports, oldest first.
+	reports map[Period][]Report
+	// storage persists usage and reports, if set.
+	storage storage.KV
+}
+
+// NewTracker creates a new tracker without limits.
+func NewTracker(log logging.Logger) *Tracker {
+	return &Tracker{
+		log:     log,
+		now:     time.Now,
+		windows: make(map[Period]*window),
+		reports: make(map[Period][]Report),
+	}
+}
+
+// SetLimits sets the token budgets. A namespace may have one limit for each
+// period, and limits for AnyNamespace apply to namespaces without their own.
+func (t *Tracker) SetLimits(limits []Limit) error {
+	type limitKey struct {
+		namespace string
+		period    Period
+	}
+	seen := make(map[limitKey]bool, len(limits))
+	for _, limit := range limits {
+		if err := limit.validate(); err != nil {
+			return err
+		}
+		key := limitKey{namespace: limit.Namespace, period: limit.Period}
+		if seen[key] {
+			return fmt.Errorf("namespace %s has several %s limits", limit.Namespace, limit.Period)
+		}
+		seen[key] = true
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.limits = slices.Clone(limits)
+	return nil
+}
+
+// limit returns the limit of a namespace for a period, if any. The caller
+// must hold t.m.
+func (t *Tracker) limit(namespace string, period Period) (Limit, bool) {
+	var fallback *Limit
+	for i, limit := range t.limits {
+		if limit.Period != period {
+			continue
+		}
+		if limit.Namespace == namespace {
+			return limit, true
+		}
+		if limit.Namespace == AnyNamespace {
+			fallback = &t.limits[i]
+		}
+	}
+	if fallback == nil {
+		return Limit{}, false
+	}
+	return *fallback, true
+}
+
+// Check returns an *ExceededError if a namespace has used any of its token
+// budgets. If several are used, the error reports the one that resets last.
+func (t *Tracker) Check(namespace string) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.rollover()
+
+	var exceeded *ExceededError
+	for _, period := range periods {
+		limit, ok := t.limit(namespace, period)
+		if !ok {
+			continue
+		}
+		current := t.windows[period]
+		var used int64
+		if usage := current.Usage[namespace]; usage != nil {
+			used = usage.Tokens
+		}
+		resetAt := period.end(current.Start)
+		if used >= limit.Tokens && (exceeded == nil || resetAt.After(exceeded.ResetAt)) {
+			exceeded = &ExceededError{Limit: limit, Namespace: namespace, Used: used, ResetAt: resetAt}
+		}
+	}
+	if exceeded != nil {
+		return exceeded
+	}
+	return nil
+}
+
+// Record records a request of a namespace that used the specified number of
+// tokens.
+func (t *Tracker) Record(namespace string, tokens int64) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.rollover()
+
+	for _, period := range periods {
+		current := t.windows[period]
+		usage := current.Usage[namespace]
+		if usage == nil {
+			usage = &Usage{Namespace: namespace}
+			current.Usage[namespace] = usage
+		}
+		usage.Tokens += tokens
+		usage.Requests++
+		t.persist(windowKeyPrefix+string(period), current)
+	}
+}
+
+// rollover ends the periods that are over, generating their reports. The
+// caller must hold t.m.
+func (t *Tracker) rollover() {
+	now := t.now()
+	for _, period := range periods {
+		start := period.start(now)
+		current := t.windows[period]
+		if current != nil && !current.Start.Before(start) {
+			continue
+		}
+		if current != nil && len(current.Usage) > 0 {
+			t.addReport(t.report(period, current))
+		}
+		current = &window{Start: start, Usage: make(map[string]*Usage)}
+		t.windows[period] = current
+		t.persist(windowKeyPrefix+string(period), current)
+	}
+}
+
+// report returns the report of the usage over a period. The caller must hold
+// t.m.
+func (t *Tracker) report(period Period, current *window) Report {
+	report := Report{
+		Period: period,
+		Start:  current.Start,
+		End:    period.end(current.Start),
+		Usage:  make([]Usage, 0, len(current.Usage)),
+	}
+	for namespace, usage := range current.Usage {
+		entry := *usage
+		if limit, ok := t.limit(namespace, period); ok {
+			entry.Limit = limit.Tokens
+		}
+		report.Usage = append(report.Usage, entry)
+	}
+	slices.SortFunc(report.Usage, func(a, b Usage) int {
+		return strings.Compare(a.Namespace, b.Namespace)
+	})
+	return report
+}
+
+// addReport keeps a report of a period that ended, dropping the oldest
+// reports beyond maxReports. The caller must hold t.m.
+func (t *Tracker) addReport(report Report) {
+	reports := append(t.reports[report.Period], report)
+	for len(reports) > maxReports {
+		t.unpersist(reportKey(reports[0]))
+		reports = reports[1:]
+	}
+	t.reports[report.Period] = reports
+	t.persist(reportKey(report), report)
+	t.log.Infof("Generated %s usage report for %d namespaces from %s", report.Period, len(report.Usage), report.Start.Format(time.DateOnly))
+}
+
+// reportKey returns the storage key of a report.
+func reportKey(report Report) string {
+	return reportKeyPrefix + string(report.Period) + "/" + report.Start.Format(time.RFC3339)
+}
+
+// Usage returns the usage of all namespaces over the current period,
+// ordered by namespace.
+func (t *Tracker) Usage(period Period) Report {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.rollover()
+	return t.report(period, t.windows[period])
+}
+
+// Reports returns the reports of the periods that ended, most recent first.
+func (t *Tracker) Reports(period Period) []Report {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.rollover()
+	reports := slices.Clone(t.reports[period])
+	slices.Reverse(reports)
+	return reports
+}
+
+// Run generates the usage reports of periods as they end, until the context
+// is cancelled. Without it, periods still reset when usage is next recorded
+// or checked.
+func (t *Tracker) Run(ctx context.Context) {
+	for {
+		now := t.now()
+		timer := time.NewTimer(Daily.end(Daily.start(now)).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		t.m.Lock()
+		t.rollover()
+		t.m.Unlock()
+	}
+}
+
+// SetStorage makes the tracker persist usage and reports in kv, so that
+// budgets don't reset on restarts, and loads those persisted previously.
+func (t *Tracker) SetStorage(kv storage.KV) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for _, period := range periods {
+		var persisted window
+		if err := getJSON(kv, windowKeyPrefix+string(period), &persisted); err == nil {
+			if persisted.Usage == nil {
+				persisted.Usage = make(map[string]*Usage)
+			}
+			t.windows[period] = &persisted
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+
+		keys, err := kv.List(reportKeyPrefix + string(period) + "/")
+		if err != nil {
+			return fmt.Errorf("listing reports: %w", err)
+		}
+		reports := make([]Report, 0, len(keys))
+		for _, key := range keys {
+			var report Report
+			if err := getJSON(kv, key, &report); err != nil {
+				return err
+			}
+			reports = append(reports, report)
+		}
+		// Keys sort chronologically, since report starts are in UTC.
+		t.reports[period] = reports
+	}
+	t.storage = kv
+	t.rollover()
+	return nil
+}
+
+// getJSON unmarshals the value of a key.
+func getJSON(kv storage.KV, key string, v any) error {
+	data, err := kv.Get(key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("reading %s: %w", key, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unmarshaling %s: %w", key, err)
+	}
+	return nil
+}
+
+// persist marshals v as the value of a key. The caller must hold t.m.
+func (t *Tracker) persist(key string, v any) {
+	if t.storage == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = t.storage.Put(key, data)
+	}
+	if err != nil {
+		t.log.Warnf("Failed to persist %s: %v", key, err)
+	}
+}
+
+// unpersist deletes a key. The caller must hold t.m.
+func (t *Tracker) unpersist(key string) {
+	if t.storage == nil {
+		return
+	}
+	if err := t.storage.Delete(key); err != nil {
+		t.log.Warnf("Failed to delete persisted %s: %v", key, err)
+	}
+}
+
+// parsePeriod parses the period query parameter of a request, which
+// defaults to daily.
+func parsePeriod(r *http.Request) (Period, error) {
+	period := Period(r.URL.Query().Get("period"))
+	if period == "" {
+		return Daily, nil
+	}
+	if !slices.Contains(periods, period) {
+		return "", fmt.Errorf("unknown period %q, expected daily or monthly", period)
+	}
+	return period, nil
+}
+
+// UsageHandler returns a handler that serves the usage over the current
+// period selected by the period query parameter.
+func (t *Tracker) UsageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		period, err := parsePeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, t.Usage(period))
+	}
+}
+
+// ReportsHandler returns a handler that serves the usage reports of the
+// period selected by the period query parameter, most recent first.
+func (t *Tracker) ReportsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		period, err := parsePeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, t.Reports(period))
+	}
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,154 @@
+package quota
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestTracker creates a tracker whose clock is controlled by the returned
+// function.
+func newTestTracker(t *testing.T, now time.Time) (*Tracker, func(time.Time)) {
+	t.Helper()
+	tracker := NewTracker(logrus.New())
+	tracker.now = func() time.Time { return now }
+	return tracker, func(next time.Time) { now = next }
+}
+
+func TestCheck(t *testing.T) {
+	tracker, setNow := newTestTracker(t, time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC))
+	if err := tracker.SetLimits([]Limit{
+		{Namespace: "team", Period: Daily, Tokens: 100},
+		{Namespace: "team", Period: Monthly, Tokens: 150},
+		{Namespace: AnyNamespace, Period: Daily, Tokens: 10},
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tracker.Record("team", 99)
+	if err := tracker.Check("team"); err != nil {
+		t.Errorf("Expected the budget to remain, got %v", err)
+	}
+	tracker.Record("team", 1)
+	var exceeded *ExceededError
+	if err := tracker.Check("team"); !errors.As(err, &exceeded) || exceeded.Limit.Period != Daily || !exceeded.ResetAt.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the daily budget to be exceeded, got %v", err)
+	}
+
+	// Other namespaces have their own budget from the wildcard limit.
+	if err := tracker.Check("other"); err != nil {
+		t.Errorf("Expected the budget to remain, got %v", err)
+	}
+	tracker.Record("other", 10)
+	if err := tracker.Check("other"); !errors.As(err, &exceeded) || exceeded.Limit.Tokens != 10 {
+		t.Errorf("Expected the wildcard budget to be exceeded, got %v", err)
+	}
+
+	// The daily budget resets the next day, which also starts a new month.
+	setNow(time.Date(2026, 2, 1, 0, 0, 1, 0, time.UTC))
+	if err := tracker.Check("team"); err != nil {
+		t.Errorf("Expected the budget to reset, got %v", err)
+	}
+
+	// When both budgets are exceeded, the error reports the last reset.
+	tracker.Record("team", 150)
+	if err := tracker.Check("team"); !errors.As(err, &exceeded) || exceeded.Limit.Period != Monthly || !exceeded.ResetAt.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the monthly budget to be exceeded, got %v", err)
+	}
+}
+
+func TestReports(t *testing.T) {
+	tracker, setNow := newTestTracker(t, time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC))
+	tracker.SetLimits([]Limit{{Namespace: "team", Period: Daily, Tokens: 100}})
+	tracker.Record("team", 40)
+	tracker.Record("team", 20)
+	tracker.Record("anonymous", 5)
+
+	usage := tracker.Usage(Daily)
+	if len(usage.Usage) != 2 || usage.Usage[1] != (Usage{Namespace: "team", Tokens: 60, Requests: 2, Limit: 100}) {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+
+	setNow(time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC))
+	daily := tracker.Reports(Daily)
+	if len(daily) != 1 || !daily[0].Start.Equal(time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)) || len(daily[0].Usage) != 2 || daily[0].Usage[1].Tokens != 60 {
+		t.Errorf("Unexpected daily reports %+v", daily)
+	}
+	monthly := tracker.Reports(Monthly)
+	if len(monthly) != 1 || !monthly[0].End.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected monthly reports %+v", monthly)
+	}
+	if usage := tracker.Usage(Daily); len(usage.Usage) != 0 {
+		t.Errorf("Expected usage to reset, got %+v", usage)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	kv := storage.NewMemory()
+	tracker, _ := newTestTracker(t, time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC))
+	if err := tracker.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tracker.Record("team", 40)
+
+	// A restart on the same day keeps the usage.
+	restarted, setNow := newTestTracker(t, time.Date(2026, 1, 31, 18, 0, 0, 0, time.UTC))
+	if err := restarted.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if usage := restarted.Usage(Daily); len(usage.Usage) != 1 || usage.Usage[0].Tokens != 40 {
+		t.Errorf("Expected persisted usage, got %+v", usage)
+	}
+
+	// A restart on the next day reports the previous day.
+	setNow(time.Date(2026, 2, 1, 6, 0, 0, 0, time.UTC))
+	restarted.Record("team", 1)
+	restarted, _ = newTestTracker(t, time.Date(2026, 2, 1, 7, 0, 0, 0, time.UTC))
+	if err := restarted.SetStorage(kv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reports := restarted.Reports(Daily); len(reports) != 1 || reports[0].Usage[0].Tokens != 40 {
+		t.Errorf("Expected a persisted report, got %+v", reports)
+	}
+	if usage := restarted.Usage(Daily); len(usage.Usage) != 1 || usage.Usage[0].Tokens != 1 {
+		t.Errorf("Expected persisted usage, got %+v", usage)
+	}
+}
+
+func TestSetLimitsInvalid(t *testing.T) {
+	tracker := NewTracker(logrus.New())
+	for _, limits := range [][]Limit{
+		{{Period: Daily, Tokens: 1}},
+		{{Namespace: "team", Period: "weekly", Tokens: 1}},
+		{{Namespace: "team", Period: Daily}},
+		{{Namespace: "team", Period: Daily, Tokens: 1}, {Namespace: "team", Period: Daily, Tokens: 2}},
+	} {
+		if err := tracker.SetLimits(limits); err == nil {
+			t.Errorf("Expected error for %+v", limits)
+		}
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	tracker := NewTracker(logrus.New())
+	for _, tt := range []struct {
+		handler http.HandlerFunc
+		query   string
+		want    int
+	}{
+		{handler: tracker.UsageHandler(), want: http.StatusOK},
+		{handler: tracker.UsageHandler(), query: "?period=monthly", want: http.StatusOK},
+		{handler: tracker.ReportsHandler(), query: "?period=weekly", want: http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		tt.handler(rec, httptest.NewRequest(http.MethodGet, "/engines/quotas"+tt.query, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.query, tt.want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+// APIPath is the path of the security events feed, relative to the inference
+// prefix.
+const APIPath = "/security/events"
+
+// Feed is the security events feed.
+type Feed struct {
+	// Events are the matching security events, oldest first.
+	Events []Event `json:"events"`
+	// Lockouts are the active lockouts.
+	Lockouts []Lockout `json:"lockouts"`
+}
+
+// Handler serves the security events feed.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	monitor     *Monitor
+}
+
+// NewHandler creates a new security events feed handler for monitor.
+func NewHandler(log logging.Logger, monitor *Monitor, allowedOrigins []string) *Handler {
+	h := &Handler{
+		log:     log,
+		router:  http.NewServeMux(),
+		monitor: monitor,
+	}
+
+	h.router.HandleFunc("GET "+inference.InferencePrefix+APIPath, h.handleGetEvents)
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// handleGetEvents lists the security events, optionally filtered by the "type"
+// query parameter and by the "since" query parameter, an RFC 3339 time, along
+// with the active lockouts.
+func (h *Handler) handleGetEvents(w http.ResponseWriter, r *http.Request) {
+	eventType := EventType(r.URL.Query().Get("type"))
+	switch eventType {
+	case "", EventAuthFailure, EventLockout:
+	default:
+		http.Error(w, fmt.Sprintf("invalid event type %q, expected %q or %q", eventType, EventAuthFailure, EventLockout), http.StatusBadRequest)
+		return
+	}
+	var since time.Time
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, sinceStr); err != nil {
+			http.Error(w, fmt.Sprintf("invalid since time %q, expected an RFC 3339 time", sinceStr), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	feed := Feed{Events: h.monitor.Events(eventType, since), Lockouts: h.monitor.Lockouts()}
+	if err := json.NewEncoder(w).Encode(feed); err != nil {
+		h.log.Warnf("Failed to encode security events: %v", err)
+	}
+}
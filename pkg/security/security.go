@@ -0,0 +1,262 @@
+// Package security detects brute-force attacks on authentication, locking out
+// sources with too many failed attempts and recording security events.
+package security
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// DefaultMaxFailures is the default number of failed authentication
+	// attempts within the window after which a source is locked out.
+	DefaultMaxFailures = 10
+	// DefaultWindow is the default window over which failed attempts are
+	// counted.
+	DefaultWindow = 5 * time.Minute
+	// DefaultLockout is the default duration of lockouts.
+	DefaultLockout = 15 * time.Minute
+
+	// maxEvents is the maximum number of security events retained.
+	maxEvents = 1000
+	// maxSources is the number of tracked sources above which sources whose
+	// failures have expired are forgotten.
+	maxSources = 1024
+)
+
+// Policy configures when sources are locked out.
+type Policy struct {
+	// MaxFailures is the number of failed authentication attempts within
+	// Window after which a source is locked out. A zero value means
+	// DefaultMaxFailures.
+	MaxFailures int
+	// Window is the window over which failed attempts are counted. A zero
+	// value means DefaultWindow.
+	Window time.Duration
+	// Lockout is how long sources are locked out. A zero value means
+	// DefaultLockout.
+	Lockout time.Duration
+	// LockOutLocal indicates that local requests, e.g. over Unix sockets,
+	// are locked out too. They share a single source, so a local client
+	// with invalid credentials would otherwise lock out every local client,
+	// including admins. Their failed attempts are recorded either way.
+	LockOutLocal bool
+}
+
+// normalize validates the policy and fills in its defaults.
+func (p *Policy) normalize() error {
+	if p.MaxFailures < 0 || p.Window < 0 || p.Lockout < 0 {
+		return fmt.Errorf("invalid lockout policy: values must be non-negative")
+	}
+	if p.MaxFailures == 0 {
+		p.MaxFailures = DefaultMaxFailures
+	}
+	if p.Window == 0 {
+		p.Window = DefaultWindow
+	}
+	if p.Lockout == 0 {
+		p.Lockout = DefaultLockout
+	}
+	return nil
+}
+
+// EventType is the type of a security event.
+type EventType string
+
+const (
+	// EventAuthFailure is a failed authentication attempt.
+	EventAuthFailure EventType = "auth_failure"
+	// EventLockout is an alert that a source exceeded the failure threshold
+	// and was locked out.
+	EventLockout EventType = "lockout"
+)
+
+// Event is a security event.
+type Event struct {
+	// Time is when the event occurred.
+	Time time.Time `json:"time"`
+	// Type is the type of the event.
+	Type EventType `json:"type"`
+	// Source is the client address of the request, or "local" for requests
+	// over Unix sockets.
+	Source string `json:"source"`
+	// Reason describes why authentication failed.
+	Reason string `json:"reason,omitempty"`
+	// Failures is the number of failed attempts that led to a lockout.
+	Failures int `json:"failures,omitempty"`
+	// LockedUntil is when a lockout ends.
+	LockedUntil time.Time `json:"locked_until,omitzero"`
+}
+
+// Lockout is an active lockout.
+type Lockout struct {
+	// Source is the locked-out source.
+	Source string `json:"source"`
+	// Until is when the lockout ends.
+	Until time.Time `json:"until"`
+}
+
+// source tracks the failed attempts of a source.
+type source struct {
+	// failures are the times of the failed attempts within the window.
+	failures []time.Time
+	// lockedUntil is when the source's lockout ends, if it's locked out.
+	lockedUntil time.Time
+}
+
+// Monitor tracks failed authentication attempts by source, locks out sources
+// exceeding the policy's threshold, and records security events.
+type Monitor struct {
+	// log is the associated logger.
+	log logging.Logger
+	// policy is the lockout policy.
+	policy Policy
+	// now returns the current time.
+	now func() time.Time
+
+	// m protects the fields below.
+	m sync.Mutex
+	// sources are the tracked sources, keyed by address.
+	sources map[string]*source
+	// events are the most recent security events, oldest first.
+	events []Event
+}
+
+// NewMonitor creates a monitor enforcing policy.
+func NewMonitor(log logging.Logger, policy Policy) (*Monitor, error) {
+	if err := policy.normalize(); err != nil {
+		return nil, err
+	}
+	return &Monitor{
+		log:     log,
+		policy:  policy,
+		now:     time.Now,
+		sources: make(map[string]*source),
+	}, nil
+}
+
+// Locked returns whether a source is locked out, and if so, for how long.
+func (m *Monitor) Locked(address string) (time.Duration, bool) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	s := m.sources[address]
+	if s == nil {
+		return 0, false
+	}
+	remaining := s.lockedUntil.Sub(m.now())
+	return remaining, remaining > 0
+}
+
+// Failure records a failed authentication attempt by a source, locking it
+// out if it exceeds the policy's threshold. Local requests are only locked out
+// if the policy says so.
+func (m *Monitor) Failure(address, reason string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	now := m.now()
+	if address == middleware.LocalSource && !m.policy.LockOutLocal {
+		m.record(Event{Time: now, Type: EventAuthFailure, Source: address, Reason: reason})
+		return
+	}
+	if len(m.sources) >= maxSources {
+		m.prune(now)
+	}
+	s := m.sources[address]
+	if s == nil {
+		s = &source{}
+		m.sources[address] = s
+	}
+	s.failures = append(expire(s.failures, now.Add(-m.policy.Window)), now)
+	m.record(Event{Time: now, Type: EventAuthFailure, Source: address, Reason: reason})
+
+	if len(s.failures) < m.policy.MaxFailures || now.Before(s.lockedUntil) {
+		return
+	}
+	s.lockedUntil = now.Add(m.policy.Lockout)
+	m.record(Event{
+		Time:        now,
+		Type:        EventLockout,
+		Source:      address,
+		Failures:    len(s.failures),
+		LockedUntil: s.lockedUntil,
+	})
+	m.log.Warnf("Locking out %s until %s after %d failed authentication attempts",
+		utils.SanitizeForLog(address), s.lockedUntil.Format(time.RFC3339), len(s.failures))
+	s.failures = nil
+}
+
+// Success records a successful authentication by a source, forgetting its
+// failed attempts unless it's locked out.
+func (m *Monitor) Success(address string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if s := m.sources[address]; s != nil && !m.now().Before(s.lockedUntil) {
+		delete(m.sources, address)
+	}
+}
+
+// Events returns the retained security events of the given type, or of all
+// types if it's empty, that occurred after since, oldest first.
+func (m *Monitor) Events(eventType EventType, since time.Time) []Event {
+	m.m.Lock()
+	defer m.m.Unlock()
+	events := make([]Event, 0)
+	for _, event := range m.events {
+		if (eventType == "" || event.Type == eventType) && event.Time.After(since) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Lockouts returns the active lockouts, sorted by source.
+func (m *Monitor) Lockouts() []Lockout {
+	m.m.Lock()
+	defer m.m.Unlock()
+	now := m.now()
+	lockouts := make([]Lockout, 0)
+	for address, s := range m.sources {
+		if now.Before(s.lockedUntil) {
+			lockouts = append(lockouts, Lockout{Source: address, Until: s.lockedUntil})
+		}
+	}
+	slices.SortFunc(lockouts, func(a, b Lockout) int {
+		return strings.Compare(a.Source, b.Source)
+	})
+	return lockouts
+}
+
+// record retains an event, discarding the oldest events beyond maxEvents. The
+// caller must hold m.
+func (m *Monitor) record(event Event) {
+	if len(m.events) >= maxEvents {
+		m.events = slices.Delete(m.events, 0, len(m.events)-maxEvents+1)
+	}
+	m.events = append(m.events, event)
+}
+
+// prune forgets the sources that aren't locked out and have no failures
+// within the window. The caller must hold m.
+func (m *Monitor) prune(now time.Time) {
+	for address, s := range m.sources {
+		if s.failures = expire(s.failures, now.Add(-m.policy.Window)); len(s.failures) == 0 && !now.Before(s.lockedUntil) {
+			delete(m.sources, address)
+		}
+	}
+}
+
+// expire removes the failures that occurred before cutoff.
+func expire(failures []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(failures) && failures[i].Before(cutoff) {
+		i++
+	}
+	return failures[i:]
+}
@@ -0,0 +1,136 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMonitor(t *testing.T) {
+	monitor, err := NewMonitor(logrus.New(), Policy{MaxFailures: 3, Window: time.Minute, Lockout: 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	monitor.now = func() time.Time { return now }
+
+	// Failures outside the window don't count towards the threshold.
+	monitor.Failure("192.0.2.1", "invalid API key")
+	now = now.Add(2 * time.Minute)
+	monitor.Failure("192.0.2.1", "invalid API key")
+	monitor.Failure("192.0.2.1", "invalid API key")
+	if _, locked := monitor.Locked("192.0.2.1"); locked {
+		t.Fatal("Expected the source not to be locked out yet")
+	}
+
+	// Successful authentication resets the failures.
+	monitor.Success("192.0.2.1")
+	monitor.Failure("192.0.2.1", "invalid API key")
+	monitor.Failure("192.0.2.1", "invalid API key")
+	if _, locked := monitor.Locked("192.0.2.1"); locked {
+		t.Fatal("Expected the source not to be locked out after a success")
+	}
+
+	monitor.Failure("192.0.2.1", "invalid API key")
+	remaining, locked := monitor.Locked("192.0.2.1")
+	if !locked || remaining != 10*time.Minute {
+		t.Fatalf("Expected a 10m lockout, got %s (locked: %t)", remaining, locked)
+	}
+	if _, locked := monitor.Locked("192.0.2.2"); locked {
+		t.Error("Expected other sources not to be locked out")
+	}
+
+	lockouts := monitor.Lockouts()
+	if len(lockouts) != 1 || lockouts[0].Source != "192.0.2.1" || !lockouts[0].Until.Equal(now.Add(10*time.Minute)) {
+		t.Errorf("Unexpected lockouts %+v", lockouts)
+	}
+	alerts := monitor.Events(EventLockout, time.Time{})
+	if len(alerts) != 1 || alerts[0].Source != "192.0.2.1" || alerts[0].Failures != 3 {
+		t.Errorf("Unexpected lockout events %+v", alerts)
+	}
+	if events := monitor.Events("", time.Time{}); len(events) != 7 {
+		t.Errorf("Expected 7 events, got %d", len(events))
+	}
+	if events := monitor.Events(EventAuthFailure, now.Add(-time.Second)); len(events) != 5 {
+		t.Errorf("Expected 5 recent failures, got %d", len(events))
+	}
+
+	// Lockouts expire.
+	now = now.Add(10 * time.Minute)
+	if _, locked := monitor.Locked("192.0.2.1"); locked {
+		t.Error("Expected the lockout to have expired")
+	}
+	if lockouts := monitor.Lockouts(); len(lockouts) != 0 {
+		t.Errorf("Expected no lockouts, got %+v", lockouts)
+	}
+}
+
+func TestMonitorRetainsRecentEvents(t *testing.T) {
+	monitor, err := NewMonitor(logrus.New(), Policy{MaxFailures: 2 * maxEvents})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for range maxEvents + 10 {
+		monitor.Failure("192.0.2.1", "invalid API key")
+	}
+	if events := monitor.Events("", time.Time{}); len(events) != maxEvents {
+		t.Errorf("Expected %d events, got %d", maxEvents, len(events))
+	}
+}
+
+func TestMonitorLocalSource(t *testing.T) {
+	for _, lockOutLocal := range []bool{false, true} {
+		monitor, err := NewMonitor(logrus.New(), Policy{MaxFailures: 2, LockOutLocal: lockOutLocal})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for range 3 {
+			monitor.Failure(middleware.LocalSource, "invalid API key")
+		}
+		if _, locked := monitor.Locked(middleware.LocalSource); locked != lockOutLocal {
+			t.Errorf("Expected local requests to be locked out: %t, got %t", lockOutLocal, locked)
+		}
+		if failures := monitor.Events(EventAuthFailure, time.Time{}); len(failures) != 3 {
+			t.Errorf("Expected the local failures to be recorded, got %+v", failures)
+		}
+		if lockouts := monitor.Lockouts(); (len(lockouts) == 1) != lockOutLocal {
+			t.Errorf("Expected local lockouts only when enabled, got %+v", lockouts)
+		}
+	}
+}
+
+func TestMonitorLocalClients(t *testing.T) {
+	monitor, err := NewMonitor(logrus.New(), Policy{MaxFailures: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler := middleware.AccessControlMiddleware(middleware.AccessPolicy{
+		APIKeys:  map[string]middleware.Role{"admin-key": middleware.RoleAdmin},
+		Failures: monitor,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(key string) int {
+		// Requests over Unix sockets have no client address.
+		request := httptest.NewRequest(http.MethodGet, "/engines/requests", nil)
+		request.RemoteAddr = "@"
+		request.Header.Set("Authorization", "Bearer "+key)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// A local client with an invalid key doesn't lock out local admins.
+	for range 3 {
+		if code := serve("wrong-key"); code != http.StatusUnauthorized {
+			t.Fatalf("Expected invalid keys to be rejected, got %d", code)
+		}
+	}
+	if code := serve("admin-key"); code != http.StatusOK {
+		t.Errorf("Expected a local admin to be served, got %d", code)
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Filesystem is a Store that keeps each value in a file of a directory. Writes
+// go through a temporary file that's renamed into place, so a crash never
+// leaves a partially written value.
+type Filesystem struct {
+	kv    filesystemDir
+	blobs filesystemDir
+}
+
+// NewFilesystem creates a store in dir, creating the directory if needed, and
+// opens the values stored there previously.
+func NewFilesystem(dir string) (*Filesystem, error) {
+	s := &Filesystem{
+		kv:    filesystemDir(filepath.Join(dir, "kv")),
+		blobs: filesystemDir(filepath.Join(dir, "blobs")),
+	}
+	for _, d := range []filesystemDir{s.kv, s.blobs} {
+		if err := os.MkdirAll(string(d), 0o755); err != nil {
+			return nil, fmt.Errorf("creating storage directory: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// NewFilesystemBlobs creates blob storage keeping each blob in a file of dir,
+// named after its escaped key, creating the directory if needed. Unlike
+// NewFilesystem, blobs aren't kept in a subdirectory, so that other programs
+// can pick up the files, e.g. exports.
+func NewFilesystemBlobs(dir string) (Blobs, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating storage directory: %w", err)
+	}
+	return filesystemDir(dir), nil
+}
+
+// Get implements KV.Get.
+func (s *Filesystem) Get(key string) ([]byte, error) {
+	r, err := s.kv.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// Put implements KV.Put.
+func (s *Filesystem) Put(key string, value []byte) error {
+	_, err := s.kv.Write(key, bytes.NewReader(value))
+	return err
+}
+
+// Delete implements KV.Delete.
+func (s *Filesystem) Delete(key string) error {
+	return s.kv.Delete(key)
+}
+
+// List implements KV.List.
+func (s *Filesystem) List(prefix string) ([]string, error) {
+	return s.kv.List(prefix)
+}
+
+// Blobs implements Store.Blobs.
+func (s *Filesystem) Blobs() Blobs {
+	return s.blobs
+}
+
+// Close implements Store.Close.
+func (s *Filesystem) Close() error {
+	return nil
+}
+
+// filesystemDir stores each value in a file of the directory, named after the
+// escaped key so that keys may contain path separators.
+type filesystemDir string
+
+// path returns the path of the file of a key.
+func (d filesystemDir) path(key string) string {
+	return filepath.Join(string(d), url.QueryEscape(key))
+}
+
+// Open implements Blobs.Open.
+func (d filesystemDir) Open(key string) (io.ReadCloser, error) {
+	f, err := os.Open(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Write implements Blobs.Write.
+func (d filesystemDir) Write(key string, r io.Reader) (int64, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	// Escaped keys never contain "%t", so temporary files can't be mistaken
+	// for values.
+	tmp, err := os.CreateTemp(string(d), "%tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("writing %q: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		return 0, fmt.Errorf("writing %q: %w", key, err)
+	}
+	return n, nil
+}
+
+// Delete implements Blobs.Delete.
+func (d filesystemDir) Delete(key string) error {
+	if err := os.Remove(d.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List implements Blobs.List.
+func (d filesystemDir) List(prefix string) ([]string, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		key, err := url.QueryUnescape(entry.Name())
+		if err != nil || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
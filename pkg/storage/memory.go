@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// values holds copies of values by key.
+type values struct {
+	m      sync.RWMutex
+	values map[string][]byte
+}
+
+func (v *values) get(key string) ([]byte, error) {
+	v.m.RLock()
+	defer v.m.RUnlock()
+	value, ok := v.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(value), nil
+}
+
+func (v *values) put(key string, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	v.m.Lock()
+	defer v.m.Unlock()
+	v.values[key] = bytes.Clone(value)
+	return nil
+}
+
+func (v *values) delete(key string) error {
+	v.m.Lock()
+	defer v.m.Unlock()
+	delete(v.values, key)
+	return nil
+}
+
+func (v *values) list(prefix string) ([]string, error) {
+	v.m.RLock()
+	defer v.m.RUnlock()
+	keys := []string{}
+	for key := range v.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// Memory is a Store that keeps everything in memory. It's meant for tests and
+// deployments that don't need state to survive restarts.
+type Memory struct {
+	kv    values
+	blobs memoryBlobs
+}
+
+// NewMemory creates an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		kv:    values{values: make(map[string][]byte)},
+		blobs: memoryBlobs{values: values{values: make(map[string][]byte)}},
+	}
+}
+
+// Get implements KV.Get.
+func (s *Memory) Get(key string) ([]byte, error) {
+	return s.kv.get(key)
+}
+
+// Put implements KV.Put.
+func (s *Memory) Put(key string, value []byte) error {
+	return s.kv.put(key, value)
+}
+
+// Delete implements KV.Delete.
+func (s *Memory) Delete(key string) error {
+	return s.kv.delete(key)
+}
+
+// List implements KV.List.
+func (s *Memory) List(prefix string) ([]string, error) {
+	return s.kv.list(prefix)
+}
+
+// Blobs implements Store.Blobs.
+func (s *Memory) Blobs() Blobs {
+	return &s.blobs
+}
+
+// Close implements Store.Close.
+func (s *Memory) Close() error {
+	return nil
+}
+
+// memoryBlobs is the blob storage of Memory.
+type memoryBlobs struct {
+	values values
+}
+
+// Open implements Blobs.Open.
+func (b *memoryBlobs) Open(key string) (io.ReadCloser, error) {
+	value, err := b.values.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(value)), nil
+}
+
+// Write implements Blobs.Write.
+func (b *memoryBlobs) Write(key string, r io.Reader) (int64, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(value)), b.values.put(key, value)
+}
+
+// Delete implements Blobs.Delete.
+func (b *memoryBlobs) Delete(key string) error {
+	return b.values.delete(key)
+}
+
+// List implements Blobs.List.
+func (b *memoryBlobs) List(prefix string) ([]string, error) {
+	return b.values.list(prefix)
+}
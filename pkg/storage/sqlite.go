@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLite is a Store backed by a SQLite database, which keeps values durable
+// across restarts in a single file.
+type SQLite struct {
+	db    *sql.DB
+	blobs sqliteTable
+}
+
+// NewSQLite opens the SQLite database at path, creating it if needed.
+func NewSQLite(path string) (*SQLite, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating storage directory: %w", err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	for _, table := range []string{"kv", "blobs"} {
+		if _, err := db.Exec("CREATE TABLE IF NOT EXISTS " + table + " (key TEXT PRIMARY KEY, value BLOB NOT NULL)"); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("creating %s table: %w", table, err)
+		}
+	}
+	return &SQLite{db: db, blobs: sqliteTable{db: db, table: "blobs"}}, nil
+}
+
+// kv returns the key-value table.
+func (s *SQLite) kv() sqliteTable {
+	return sqliteTable{db: s.db, table: "kv"}
+}
+
+// Get implements KV.Get.
+func (s *SQLite) Get(key string) ([]byte, error) {
+	return s.kv().get(key)
+}
+
+// Put implements KV.Put.
+func (s *SQLite) Put(key string, value []byte) error {
+	return s.kv().put(key, value)
+}
+
+// Delete implements KV.Delete.
+func (s *SQLite) Delete(key string) error {
+	return s.kv().Delete(key)
+}
+
+// List implements KV.List.
+func (s *SQLite) List(prefix string) ([]string, error) {
+	return s.kv().List(prefix)
+}
+
+// Blobs implements Store.Blobs.
+func (s *SQLite) Blobs() Blobs {
+	return s.blobs
+}
+
+// Close implements Store.Close.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// sqliteTable stores values in a table of a SQLite database.
+type sqliteTable struct {
+	db    *sql.DB
+	table string
+}
+
+func (t sqliteTable) get(key string) ([]byte, error) {
+	var value []byte
+	err := t.db.QueryRow("SELECT value FROM "+t.table+" WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (t sqliteTable) put(key string, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := t.db.Exec("INSERT INTO "+t.table+" (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value", key, value)
+	return err
+}
+
+// Open implements Blobs.Open.
+func (t sqliteTable) Open(key string) (io.ReadCloser, error) {
+	value, err := t.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(value)), nil
+}
+
+// Write implements Blobs.Write.
+func (t sqliteTable) Write(key string, r io.Reader) (int64, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(value)), t.put(key, value)
+}
+
+// Delete implements Blobs.Delete.
+func (t sqliteTable) Delete(key string) error {
+	_, err := t.db.Exec("DELETE FROM "+t.table+" WHERE key = ?", key)
+	return err
+}
+
+// List implements Blobs.List.
+func (t sqliteTable) List(prefix string) ([]string, error) {
+	// LIKE is case-insensitive, so compare the prefix exactly instead.
+	rows, err := t.db.Query("SELECT key FROM "+t.table+" WHERE substr(key, 1, length(?1)) = ?1 ORDER BY key", prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,80 @@
+// Package storage defines the key-value and blob storage used for state that
+// must outlive the model runner, such as recorded requests and model store
+// metadata, along with in-memory, filesystem, and SQLite implementations.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned when a key doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// KV stores small values by key. Implementations are safe for concurrent use.
+type KV interface {
+	// Get returns the value of a key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+	// Put sets the value of a key, replacing any existing value.
+	Put(key string, value []byte) error
+	// Delete removes a key. Deleting a missing key isn't an error.
+	Delete(key string) error
+	// List returns the sorted keys starting with prefix.
+	List(prefix string) ([]string, error)
+}
+
+// Blobs stores large values by key. Implementations are safe for concurrent
+// use.
+type Blobs interface {
+	// Open returns a reader for the blob of a key, or ErrNotFound.
+	Open(key string) (io.ReadCloser, error)
+	// Write stores the contents of r under a key, replacing any existing blob,
+	// and returns the number of bytes written. The blob is replaced only if r
+	// is read entirely.
+	Write(key string, r io.Reader) (int64, error)
+	// Delete removes a blob. Deleting a missing blob isn't an error.
+	Delete(key string) error
+	// List returns the sorted keys starting with prefix.
+	List(prefix string) ([]string, error)
+}
+
+// Store provides both key-value and blob storage.
+type Store interface {
+	KV
+	// Blobs returns the blob storage of the store.
+	Blobs() Blobs
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// Open opens the store described by spec, which is one of "memory",
+// "filesystem:<directory>", or "sqlite:<file>".
+func Open(spec string) (Store, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "memory":
+		return NewMemory(), nil
+	case "filesystem":
+		if path == "" {
+			return nil, errors.New("filesystem storage requires a directory")
+		}
+		return NewFilesystem(path)
+	case "sqlite":
+		if path == "" {
+			return nil, errors.New("sqlite storage requires a database file")
+		}
+		return NewSQLite(path)
+	default:
+		return nil, fmt.Errorf("unknown storage %q, expected memory, filesystem:<directory>, or sqlite:<file>", kind)
+	}
+}
+
+// validateKey checks that a key can be stored by every implementation.
+func validateKey(key string) error {
+	if key == "" {
+		return errors.New("empty key")
+	}
+	return nil
+}
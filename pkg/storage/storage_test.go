@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newStores(t *testing.T) map[string]Store {
+	t.Helper()
+	dir := t.TempDir()
+	stores := map[string]Store{"memory": NewMemory()}
+	for _, spec := range []string{"filesystem:" + filepath.Join(dir, "fs"), "sqlite:" + filepath.Join(dir, "db", "storage.db")} {
+		store, err := Open(spec)
+		if err != nil {
+			t.Fatalf("Unexpected error opening %s: %v", spec, err)
+		}
+		t.Cleanup(func() { store.Close() })
+		stores[strings.SplitN(spec, ":", 2)[0]] = store
+	}
+	return stores
+}
+
+func TestKV(t *testing.T) {
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.Get("missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+			if err := store.Put("", []byte("x")); err == nil {
+				t.Error("Expected error for an empty key")
+			}
+			for _, key := range []string{"records/ai/smollm2:latest", "records/A", "recordsX", "models"} {
+				if err := store.Put(key, []byte("old")); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if err := store.Put("records/A", []byte("new")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if value, err := store.Get("records/A"); err != nil || string(value) != "new" {
+				t.Errorf("Expected the replaced value, got %q (%v)", value, err)
+			}
+			keys, err := store.List("records/")
+			if err != nil || !slices.Equal(keys, []string{"records/A", "records/ai/smollm2:latest"}) {
+				t.Errorf("Unexpected keys %v (%v)", keys, err)
+			}
+			if err := store.Delete("records/A"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := store.Delete("records/A"); err != nil {
+				t.Errorf("Expected deleting a missing key to succeed, got %v", err)
+			}
+			if keys, _ := store.List("records/a"); !slices.Equal(keys, []string{"records/ai/smollm2:latest"}) {
+				t.Errorf("Expected a case-sensitive prefix match, got %v", keys)
+			}
+		})
+	}
+}
+
+func TestBlobs(t *testing.T) {
+	for name, store := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			blobs := store.Blobs()
+			if _, err := blobs.Open("missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+			n, err := blobs.Write("files/a", strings.NewReader("contents"))
+			if err != nil || n != 8 {
+				t.Fatalf("Unexpected write of %d bytes (%v)", n, err)
+			}
+			if _, err := blobs.Write("files/a", io.MultiReader(strings.NewReader("partial"), errReader{})); err == nil {
+				t.Error("Expected a failed read to fail the write")
+			}
+			r, err := blobs.Open("files/a")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			contents, _ := io.ReadAll(r)
+			r.Close()
+			if string(contents) != "contents" {
+				t.Errorf("Expected a failed write to keep the blob, got %q", contents)
+			}
+			if keys, err := blobs.List(""); err != nil || !slices.Equal(keys, []string{"files/a"}) {
+				t.Errorf("Unexpected keys %v (%v)", keys, err)
+			}
+			if err := blobs.Delete("files/a"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, err := blobs.Open("files/a"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound after delete, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir := t.TempDir()
+	for _, spec := range []string{"filesystem:" + filepath.Join(dir, "fs"), "sqlite:" + filepath.Join(dir, "storage.db")} {
+		store, err := Open(spec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		store.Put("key", []byte("value"))
+		store.Close()
+		if store, err = Open(spec); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if value, err := store.Get("key"); err != nil || string(value) != "value" {
+			t.Errorf("%s: expected the value to survive reopening, got %q (%v)", spec, value, err)
+		}
+		store.Close()
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	for _, spec := range []string{"", "redis:localhost", "filesystem", "sqlite:"} {
+		if _, err := Open(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
@@ -0,0 +1,97 @@
+// Package tracing exports OpenTelemetry traces of inference requests, so that
+// their latency (scheduling, runner startup, and backend proxying) can be
+// correlated with the traces of the applications making them.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// InstrumentationName is the name of the tracers of the model runner.
+	InstrumentationName = "github.com/docker/model-runner"
+	// defaultServiceName is the service name of exported spans unless
+	// OTEL_SERVICE_NAME is set.
+	defaultServiceName = "model-runner"
+)
+
+// propagator propagates W3C trace contexts and baggage.
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Enabled returns whether an OTLP endpoint is configured in the environment,
+// i.e. whether OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, and OTEL_SDK_DISABLED isn't.
+func Enabled() bool {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// NewProvider creates a tracer provider exporting spans over OTLP/HTTP. The
+// exporter, resource, and sampler are configured through the standard
+// OTEL_EXPORTER_OTLP_*, OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES, and
+// OTEL_TRACES_SAMPLER environment variables. The provider must be shut down
+// to flush pending spans.
+func NewProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(defaultServiceName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating resource: %w", err)
+	}
+	// Attributes from the environment take precedence over the defaults.
+	if fromEnv, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, fromEnv); err == nil {
+			res = merged
+		}
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	), nil
+}
+
+// Tracer returns the model runner's tracer of a provider, which may be nil,
+// in which case spans aren't recorded.
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = noop.NewTracerProvider()
+	}
+	return provider.Tracer(InstrumentationName)
+}
+
+// Extract returns a context with the remote span context propagated in the
+// headers of an incoming request, if any.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject propagates the span context of ctx, if any, in the headers of an
+// outgoing request.
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Start starts a child span of the span in ctx, if any, with the same tracer
+// provider. It's used by components that aren't configured with a provider,
+// so that their spans are only recorded within traced requests.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer(trace.SpanFromContext(ctx).TracerProvider()).Start(ctx, name, opts...)
+}
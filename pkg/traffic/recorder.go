@@ -0,0 +1,225 @@
+// Package traffic records all of the server's traffic to a file and replays
+// recordings against the server, at their original or an accelerated pace, to
+// load-test configuration changes with realistic workloads.
+package traffic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/credentials"
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// ReplayHeader marks replayed requests, which aren't recorded.
+	ReplayHeader = "X-Traffic-Replay"
+
+	// maximumBodySize is the maximum size of a recorded request body. Larger
+	// bodies aren't recorded, and their requests aren't replayed.
+	maximumBodySize = 16 * 1024 * 1024
+)
+
+// sensitiveHeaders are the request headers that aren't recorded.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// sensitiveRoutes are the routes, along with their subroutes, whose request
+// bodies carry secrets and so aren't recorded.
+var sensitiveRoutes = []string{inference.InferencePrefix + credentials.APIPath}
+
+// isSensitiveRoute returns whether the request bodies of a path carry secrets.
+func isSensitiveRoute(path string) bool {
+	for _, route := range sensitiveRoutes {
+		if path == route || strings.HasPrefix(path, route+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Entry is a recorded request.
+type Entry struct {
+	// Time is the time at which the request was received.
+	Time   time.Time   `json:"time"`
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	// Client is the address of the client, as forwarded by trusted reverse
+	// proxies.
+	Client string `json:"client,omitempty"`
+	// Body is the request body, if it's JSON.
+	Body json.RawMessage `json:"body,omitempty"`
+	// RawBody is the request body, if it isn't JSON.
+	RawBody []byte `json:"raw_body,omitempty"`
+	// Truncated is set if the body was too large to be recorded.
+	Truncated bool `json:"truncated,omitempty"`
+	// Redacted is set if the body wasn't recorded because it carries
+	// secrets.
+	Redacted bool `json:"redacted,omitempty"`
+	// StatusCode is the response status code.
+	StatusCode int `json:"status_code"`
+	// DurationMs is the time taken to serve the request.
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// body returns the entry's request body.
+func (e *Entry) body() []byte {
+	if len(e.Body) > 0 {
+		return e.Body
+	}
+	return e.RawBody
+}
+
+// Recorder records requests to a file, one JSON entry per line.
+type Recorder struct {
+	log logging.Logger
+	// mutex guards file and writer.
+	mutex  sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// NewRecorder creates a recorder that appends entries to the file at path.
+func NewRecorder(log logging.Logger, path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open traffic recording: %w", err)
+	}
+	return &Recorder{log: log, file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// Close flushes and closes the recording.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.writer.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// Middleware returns a handler that records the requests served by next.
+// Replayed requests aren't recorded, nor are the bodies of requests to
+// sensitive routes.
+func (r *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(ReplayHeader) != "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		entry := Entry{
+			Time:   time.Now(),
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Query:  req.URL.RawQuery,
+			Header: req.Header.Clone(),
+			Client: middleware.ClientAddress(req),
+		}
+		for _, header := range sensitiveHeaders {
+			entry.Header.Del(header)
+		}
+		if req.Body != nil && req.Body != http.NoBody && isSensitiveRoute(req.URL.Path) {
+			entry.Redacted = true
+		} else if req.Body != nil && req.Body != http.NoBody {
+			body, err := io.ReadAll(io.LimitReader(req.Body, maximumBodySize+1))
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusInternalServerError)
+				return
+			}
+			if len(body) > maximumBodySize {
+				entry.Truncated = true
+				req.Body = readCloser{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+			} else {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				if json.Valid(body) {
+					entry.Body = body
+				} else {
+					entry.RawBody = body
+				}
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, req)
+		entry.StatusCode = recorder.statusCode
+		entry.DurationMs = time.Since(entry.Time).Milliseconds()
+		r.write(entry)
+	})
+}
+
+// write appends an entry to the recording.
+func (r *Recorder) write(entry Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		r.log.Warnf("Failed to encode traffic entry: %v", err)
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.writer.Write(line)
+	r.writer.WriteByte('\n')
+	if err := r.writer.Flush(); err != nil {
+		r.log.Warnf("Failed to write traffic entry: %v", err)
+	}
+}
+
+// Load reads a recording's entries. Blank lines are ignored.
+func Load(reader io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 2*maximumBodySize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("invalid entry on line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read recording: %w", err)
+	}
+	return entries, nil
+}
+
+// readCloser combines a reader with the closer of the original body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// statusRecorder is an http.ResponseWriter that records the status code of a
+// response.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *statusRecorder) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush implements http.Flusher.Flush, so that streamed responses aren't
+// buffered.
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,257 @@
+package traffic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// ReplayPath is the path of the replay route, relative to the inference
+	// prefix.
+	ReplayPath = "/traffic/replay"
+
+	// maximumRecordingSize is the maximum size of a replayed recording.
+	maximumRecordingSize = 256 * 1024 * 1024
+)
+
+// LatencySummary summarizes request latencies, in milliseconds.
+type LatencySummary struct {
+	P50Ms int64 `json:"p50_ms"`
+	P95Ms int64 `json:"p95_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+// summarizeLatencies returns the summary of latencies.
+func summarizeLatencies(latencies []int64) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	percentile := func(p int) int64 {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	return LatencySummary{P50Ms: percentile(50), P95Ms: percentile(95), MaxMs: sorted[len(sorted)-1]}
+}
+
+// ReplayReport reports the outcome of a replay.
+type ReplayReport struct {
+	// Requests is the number of replayed requests.
+	Requests int `json:"requests"`
+	// Skipped is the number of requests that weren't replayed because their
+	// bodies weren't recorded.
+	Skipped int `json:"skipped"`
+	// Speed is the factor by which the recording was accelerated, or zero if
+	// requests were replayed without delays.
+	Speed float64 `json:"speed"`
+	// RecordedDurationMs and DurationMs are the times spanned by the
+	// recording and taken by the replay.
+	RecordedDurationMs int64 `json:"recorded_duration_ms"`
+	DurationMs         int64 `json:"duration_ms"`
+	// StatusCodes counts the replayed responses by status code.
+	StatusCodes map[string]int `json:"status_codes"`
+	// StatusMismatches is the number of replayed requests whose status code
+	// differs from the recorded one.
+	StatusMismatches int            `json:"status_mismatches"`
+	RecordedLatency  LatencySummary `json:"recorded_latency"`
+	Latency          LatencySummary `json:"latency"`
+}
+
+// Replay replays entries against target, preserving their relative timing
+// divided by speed, or without delays if speed is zero. Requests are issued
+// concurrently, as they were recorded, and Replay returns once they've all
+// completed or ctx is cancelled.
+func Replay(ctx context.Context, target http.Handler, entries []Entry, speed float64) ReplayReport {
+	report := ReplayReport{Speed: speed, StatusCodes: make(map[string]int)}
+	var replayed []Entry
+	for _, entry := range entries {
+		if entry.Truncated || entry.Redacted {
+			report.Skipped++
+			continue
+		}
+		replayed = append(replayed, entry)
+	}
+	if len(replayed) == 0 {
+		return report
+	}
+	slices.SortStableFunc(replayed, func(a, b Entry) int {
+		return a.Time.Compare(b.Time)
+	})
+	origin := replayed[0].Time
+	last := replayed[len(replayed)-1]
+	report.RecordedDurationMs = last.Time.Add(time.Duration(last.DurationMs) * time.Millisecond).Sub(origin).Milliseconds()
+
+	var mutex sync.Mutex
+	var recordedLatencies, latencies []int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, entry := range replayed {
+		if speed > 0 {
+			delay := time.Duration(float64(entry.Time.Sub(origin))/speed) - time.Since(start)
+			if delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statusCode, latency := replayEntry(ctx, target, entry)
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Requests++
+			report.StatusCodes[strconv.Itoa(statusCode)]++
+			if statusCode != entry.StatusCode {
+				report.StatusMismatches++
+			}
+			recordedLatencies = append(recordedLatencies, entry.DurationMs)
+			latencies = append(latencies, latency.Milliseconds())
+		}()
+	}
+	wg.Wait()
+
+	report.DurationMs = time.Since(start).Milliseconds()
+	report.RecordedLatency = summarizeLatencies(recordedLatencies)
+	report.Latency = summarizeLatencies(latencies)
+	return report
+}
+
+// replayEntry replays a request, returning the response status code and the
+// time taken to serve it. Response bodies are discarded.
+func replayEntry(ctx context.Context, target http.Handler, entry Entry) (int, time.Duration) {
+	url := entry.Path
+	if entry.Query != "" {
+		url += "?" + entry.Query
+	}
+	body := entry.body()
+	request, err := http.NewRequestWithContext(ctx, entry.Method, url, bytes.NewReader(body))
+	if err != nil {
+		return http.StatusBadRequest, 0
+	}
+	for name, values := range entry.Header {
+		request.Header[name] = slices.Clone(values)
+	}
+	request.Header.Set(ReplayHeader, "1")
+	request.ContentLength = int64(len(body))
+
+	writer := &discardWriter{header: make(http.Header), statusCode: http.StatusOK}
+	start := time.Now()
+	target.ServeHTTP(writer, request)
+	return writer.statusCode, time.Since(start)
+}
+
+// discardWriter is an http.ResponseWriter that records the status code of a
+// response and discards its body.
+type discardWriter struct {
+	header     http.Header
+	statusCode int
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+// Flush implements http.Flusher.Flush, so that streamed responses are served
+// as they would be to clients.
+func (w *discardWriter) Flush() {}
+
+// Handler implements the replay API, which replays uploaded recordings
+// against the server.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	// target serves replayed requests, typically the server's handler.
+	target http.Handler
+}
+
+// NewHandler creates a new replay API handler whose replayed requests are
+// served by target.
+func NewHandler(log logging.Logger, target http.Handler, allowedOrigins []string) *Handler {
+	h := &Handler{
+		log:    log,
+		router: http.NewServeMux(),
+		target: target,
+	}
+
+	h.router.HandleFunc("POST "+inference.InferencePrefix+ReplayPath, h.handleReplay)
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// handleReplay replays the recording in the request body, at the pace set by
+// the speed query parameter, which defaults to 1 (the original pace).
+func (h *Handler) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(ReplayHeader) != "" {
+		http.Error(w, "replays can't be replayed", http.StatusBadRequest)
+		return
+	}
+	speed := 1.0
+	if value := r.URL.Query().Get("speed"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "speed must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		speed = parsed
+	}
+
+	recording, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maximumRecordingSize))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, "recording too large", http.StatusBadRequest)
+		} else {
+			http.Error(w, "failed to read request body", http.StatusInternalServerError)
+		}
+		return
+	}
+	entries, err := Load(bytes.NewReader(recording))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(entries) == 0 {
+		http.Error(w, "recording is empty", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Infof("Replaying %d recorded requests at speed %g", len(entries), speed)
+	report := Replay(r.Context(), h.target, entries, speed)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.log.Warnf("Failed to encode replay report: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package traffic
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	recorder, err := NewRecorder(logrus.New(), path)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	handler := recorder.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(body)
+	}))
+
+	request := httptest.NewRequest(http.MethodPost, "/engines/v1/chat/completions?x=1", strings.NewReader(`{"model":"ai/smollm2"}`))
+	request.Header.Set("Authorization", "Bearer secret")
+	request.Header.Set("User-Agent", "test")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, request)
+	if w.Body.String() != `{"model":"ai/smollm2"}` {
+		t.Errorf("Expected the body to be passed through, got %q", w.Body.String())
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/missing", strings.NewReader("plain")))
+
+	// Replayed requests aren't recorded.
+	request = httptest.NewRequest(http.MethodGet, "/models", nil)
+	request.Header.Set(ReplayHeader, "1")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Failed to close recorder: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open recording: %v", err)
+	}
+	defer file.Close()
+	entries, err := Load(file)
+	if err != nil {
+		t.Fatalf("Failed to load recording: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", entries)
+	}
+	first, second := entries[0], entries[1]
+	if first.Path != "/engines/v1/chat/completions" || first.Query != "x=1" || string(first.Body) != `{"model":"ai/smollm2"}` ||
+		first.StatusCode != http.StatusOK || first.Header.Get("Authorization") != "" || first.Header.Get("User-Agent") != "test" {
+		t.Errorf("Unexpected entry %+v", first)
+	}
+	if string(second.RawBody) != "plain" || second.StatusCode != http.StatusNotFound {
+		t.Errorf("Unexpected entry %+v", second)
+	}
+}
+
+func TestRecorderCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	recorder, err := NewRecorder(logrus.New(), path)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	var received string
+	handler := recorder.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+	}))
+	body := `{"username":"user","secret":"hunter2"}`
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/engines/credentials/registry.example.com", strings.NewReader(body)))
+	if received != body {
+		t.Errorf("Expected the body to be passed through, got %q", received)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Failed to close recorder: %v", err)
+	}
+
+	recording, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read recording: %v", err)
+	}
+	if strings.Contains(string(recording), "secret") || strings.Contains(string(recording), "hunter2") {
+		t.Errorf("Expected the credentials not to be recorded, got %s", recording)
+	}
+	entries, err := Load(bytes.NewReader(recording))
+	if err != nil {
+		t.Fatalf("Failed to load recording: %v", err)
+	}
+	if len(entries) != 1 || !entries[0].Redacted || entries[0].body() != nil {
+		t.Fatalf("Expected a redacted entry, got %+v", entries)
+	}
+
+	// Redacted requests aren't replayed.
+	replayed := false
+	report := Replay(t.Context(), http.HandlerFunc(func(http.ResponseWriter, *http.Request) { replayed = true }), entries, 0)
+	if replayed || report.Skipped != 1 {
+		t.Errorf("Expected the redacted request to be skipped, got %+v", report)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var mutex sync.Mutex
+	var paths []string
+	target := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		paths = append(paths, r.URL.RequestURI()+" "+string(body))
+		mutex.Unlock()
+		if r.Header.Get(ReplayHeader) == "" {
+			t.Error("Expected replayed requests to be marked")
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	origin := time.Now()
+	entries := []Entry{
+		{Time: origin, Method: http.MethodPost, Path: "/a", Query: "x=1", Body: json.RawMessage(`{}`), StatusCode: http.StatusOK, DurationMs: 10},
+		{Time: origin.Add(200 * time.Millisecond), Method: http.MethodGet, Path: "/fail", StatusCode: http.StatusOK, DurationMs: 20},
+		{Time: origin.Add(time.Second), Method: http.MethodPost, Path: "/large", Truncated: true},
+	}
+
+	// Replays are accelerated by the speed.
+	report := Replay(t.Context(), target, entries, 2)
+	if report.Requests != 2 || report.Skipped != 1 || report.StatusMismatches != 1 || report.StatusCodes["503"] != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.DurationMs < 100 || report.DurationMs > 1000 || report.RecordedDurationMs != 220 || report.RecordedLatency.MaxMs != 20 {
+		t.Errorf("Unexpected timing %+v", report)
+	}
+	if len(paths) != 2 || paths[0] != "/a?x=1 {}" {
+		t.Errorf("Unexpected replayed requests %v", paths)
+	}
+
+	// Without a speed, requests are replayed without delays.
+	if report := Replay(t.Context(), target, entries, 0); report.DurationMs >= 100 {
+		t.Errorf("Expected no delays, got %+v", report)
+	}
+}
+
+func TestHandleReplay(t *testing.T) {
+	var replayed int
+	h := NewHandler(logrus.New(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replayed++
+	}), nil)
+	replay := func(query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, inference.InferencePrefix+ReplayPath+query, strings.NewReader(body)))
+		return w
+	}
+
+	var recording bytes.Buffer
+	json.NewEncoder(&recording).Encode(Entry{Time: time.Now(), Method: http.MethodGet, Path: "/models", StatusCode: http.StatusOK})
+	w := replay("?speed=0", "\n"+recording.String())
+	var report ReplayReport
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &report) != nil || report.Requests != 1 || replayed != 1 {
+		t.Errorf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+
+	for query, body := range map[string]string{
+		"?speed=-1": recording.String(),
+		"?speed=x":  recording.String(),
+		"":          "",
+		"?speed=1":  "not json",
+	} {
+		if w := replay(query, body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", query+" "+body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package transcription
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// APIPath is the path of the streaming transcription route, relative to
+	// the inference prefix.
+	APIPath = "/v1/audio/transcriptions/stream"
+
+	// maximumMessageBytes is the maximum size of a client message.
+	maximumMessageBytes = 1024 * 1024
+	// minimumSampleRate and maximumSampleRate bound the sample rate of
+	// streamed audio.
+	minimumSampleRate = 8000
+	maximumSampleRate = 48000
+)
+
+// message is a client message: binary messages are audio, and text messages
+// are JSON control messages.
+type message struct {
+	data   []byte
+	binary bool
+}
+
+// messageCodec receives client messages.
+var messageCodec = websocket.Codec{
+	Unmarshal: func(data []byte, payloadType byte, v any) error {
+		*v.(*message) = message{data: data, binary: payloadType == websocket.BinaryFrame}
+		return nil
+	},
+}
+
+// Handler implements the streaming transcription API.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	// transcriber transcribes utterances.
+	transcriber Transcriber
+}
+
+// NewHandler creates a new streaming transcription API handler whose
+// utterances are transcribed by transcriber.
+func NewHandler(log logging.Logger, transcriber Transcriber, allowedOrigins []string) *Handler {
+	h := &Handler{
+		log:         log,
+		router:      http.NewServeMux(),
+		transcriber: transcriber,
+	}
+
+	h.router.HandleFunc("GET "+inference.InferencePrefix+APIPath, h.handleStream)
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// streamConfig parses the configuration of a stream from the query
+// parameters of its request.
+func streamConfig(r *http.Request) (StreamConfig, error) {
+	query := r.URL.Query()
+	config := StreamConfig{
+		SampleRate:      DefaultSampleRate,
+		Language:        query.Get("language"),
+		InterimInterval: DefaultInterimInterval,
+		VAD:             DefaultVADConfig,
+	}
+	switch encoding := query.Get("encoding"); encoding {
+	case "", "pcm16":
+	case "opus":
+		return config, errors.New("opus audio isn't supported yet; stream pcm16 audio instead")
+	default:
+		return config, fmt.Errorf("unknown encoding %q", encoding)
+	}
+	if value := query.Get("sample_rate"); value != "" {
+		sampleRate, err := strconv.Atoi(value)
+		if err != nil || sampleRate < minimumSampleRate || sampleRate > maximumSampleRate {
+			return config, fmt.Errorf("sample_rate must be between %d and %d", minimumSampleRate, maximumSampleRate)
+		}
+		config.SampleRate = sampleRate
+	}
+	if value := query.Get("interim"); value != "" {
+		interim, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, errors.New("interim must be a boolean")
+		}
+		if !interim {
+			config.InterimInterval = 0
+		}
+	}
+	if value := query.Get("silence_ms"); value != "" {
+		silence, err := strconv.Atoi(value)
+		if err != nil || silence < int(frameDuration/time.Millisecond) {
+			return config, fmt.Errorf("silence_ms must be an integer of at least %d", frameDuration/time.Millisecond)
+		}
+		config.VAD.MinSilence = time.Duration(silence) * time.Millisecond
+	}
+	if value := query.Get("threshold"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 || threshold >= 1 {
+			return config, errors.New("threshold must be between 0 and 1")
+		}
+		config.VAD.Threshold = threshold
+	}
+	return config, nil
+}
+
+// handleStream serves a transcription stream over a WebSocket.
+func (h *Handler) handleStream(w http.ResponseWriter, r *http.Request) {
+	config, err := streamConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server := websocket.Server{
+		// Origins are checked by the CORS middleware, like those of other
+		// requests.
+		Handshake: func(*websocket.Config, *http.Request) error {
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = maximumMessageBytes
+			stream := NewStream(r.Context(), config, h.transcriber, func(event []byte) error {
+				return websocket.Message.Send(conn, string(event))
+			})
+			defer stream.Close()
+			for {
+				var message message
+				if err := messageCodec.Receive(conn, &message); err != nil {
+					return
+				}
+				if err := h.handleMessage(stream, message); err != nil {
+					h.log.Warnf("Closing transcription stream: %v", err)
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// handleMessage handles a client message.
+func (h *Handler) handleMessage(stream *Stream, message message) error {
+	if message.binary {
+		return stream.Write(message.data)
+	}
+	var control struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message.data, &control); err != nil {
+		return stream.Error("invalid control message")
+	}
+	switch control.Type {
+	case "flush":
+		return stream.Flush()
+	default:
+		return stream.Error(fmt.Sprintf("unknown control message type %q", control.Type))
+	}
+}
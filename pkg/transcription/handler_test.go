@@ -0,0 +1,88 @@
+package transcription
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+func TestHandleStream(t *testing.T) {
+	var language string
+	var wav []byte
+	whisper := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/inference" || r.FormValue("response_format") != "json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		language = r.FormValue("language")
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var buffer bytes.Buffer
+		buffer.ReadFrom(file)
+		wav = buffer.Bytes()
+		w.Write([]byte(`{"text":" Hello there.\n"}`))
+	}))
+	defer whisper.Close()
+
+	server := httptest.NewServer(NewHandler(logrus.New(), NewWhisperServer(whisper.URL), []string{"http://localhost"}))
+	defer server.Close()
+	url := server.URL + inference.InferencePrefix + APIPath
+
+	for _, query := range []string{"?encoding=opus", "?sample_rate=100", "?interim=maybe", "?silence_ms=0"} {
+		response, err := http.Get(url + query)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, response.StatusCode)
+		}
+	}
+
+	url = "ws" + strings.TrimPrefix(url, "http") + "?language=en&interim=false"
+	if conn, err := websocket.Dial(url, "", "http://example.com"); err == nil {
+		conn.Close()
+		t.Fatal("Expected a stream from a disallowed origin to be rejected")
+	}
+	conn, err := websocket.Dial(url, "", "http://localhost")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	if err := websocket.Message.Send(conn, `{"type":"rewind"}`); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	var event Event
+	if err := websocket.JSON.Receive(conn, &event); err != nil || event.Type != EventError {
+		t.Errorf("Expected an error for an unknown message, got %+v (%v)", event, err)
+	}
+
+	speech := audio(time.Second, true)
+	if err := websocket.Message.Send(conn, speech); err != nil {
+		t.Fatalf("Failed to send audio: %v", err)
+	}
+	if err := websocket.JSON.Receive(conn, &event); err != nil || event.Type != EventSpeechStarted {
+		t.Errorf("Expected speech to start, got %+v (%v)", event, err)
+	}
+	if err := websocket.Message.Send(conn, `{"type":"flush"}`); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if err := websocket.JSON.Receive(conn, &event); err != nil || event.Type != EventFinalTranscript || event.Text != "Hello there." || event.EndMS != 1000 {
+		t.Errorf("Expected a final transcript, got %+v (%v)", event, err)
+	}
+	if language != "en" || !bytes.HasPrefix(wav, []byte("RIFF")) || !bytes.Equal(wav[44:], speech) {
+		t.Errorf("Unexpected transcription request in %q of %d bytes", language, len(wav))
+	}
+}
@@ -0,0 +1,218 @@
+package transcription
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSampleRate is the default sample rate of streamed audio, which
+	// is whisper's.
+	DefaultSampleRate = 16000
+	// DefaultInterimInterval is the default interval between interim
+	// transcripts of an utterance in progress, in audio duration.
+	DefaultInterimInterval = time.Second
+	// maximumQueuedTranscriptions is the maximum number of utterances queued
+	// for transcription, beyond which streaming blocks.
+	maximumQueuedTranscriptions = 64
+)
+
+// Event types sent to clients.
+const (
+	// EventSpeechStarted is sent when an utterance starts.
+	EventSpeechStarted = "speech.started"
+	// EventInterimTranscript is sent with the transcript of an utterance in
+	// progress, which may change.
+	EventInterimTranscript = "transcript.interim"
+	// EventFinalTranscript is sent with the transcript of an utterance that
+	// ended.
+	EventFinalTranscript = "transcript.final"
+	// EventError is sent when an utterance couldn't be transcribed, or a
+	// client message is invalid.
+	EventError = "error"
+)
+
+// Event is an event sent to clients.
+type Event struct {
+	Type string `json:"type"`
+	// Utterance is the index of the utterance in the stream.
+	Utterance int `json:"utterance"`
+	// StartMS and EndMS are the offsets of the utterance in the stream, in
+	// milliseconds. EndMS is only set in final transcripts.
+	StartMS int64  `json:"start_ms"`
+	EndMS   int64  `json:"end_ms,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// StreamConfig configures a transcription stream.
+type StreamConfig struct {
+	// SampleRate is the sample rate of the stream's mono pcm16 audio.
+	SampleRate int
+	// Language is the language of the audio. If it's empty, it's detected.
+	Language string
+	// InterimInterval is the interval between interim transcripts of an
+	// utterance in progress, in audio duration. If it's zero, only final
+	// transcripts are sent.
+	InterimInterval time.Duration
+	// VAD configures the segmentation of the stream into utterances.
+	VAD VADConfig
+}
+
+// transcription is an utterance, or part of one, queued for transcription.
+type transcription struct {
+	event Event
+	pcm   []byte
+}
+
+// Stream transcribes a stream of audio, sending events as utterances start
+// and are transcribed. Transcriptions are performed in order by a single
+// goroutine, and interim transcriptions are skipped if they're superseded
+// before they start.
+type Stream struct {
+	config      StreamConfig
+	transcriber Transcriber
+	segmenter   *segmenter
+	// ctx is cancelled when the stream is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// sendLock serializes send.
+	sendLock sync.Mutex
+	send     func(event []byte) error
+	// queue holds pending transcriptions, and done is closed once they're
+	// processed.
+	queue chan transcription
+	done  chan struct{}
+	// utterance is the index of the utterance in progress, or of the next
+	// one, and interimBytes is the size of the utterance in progress at its
+	// last interim transcription.
+	utterance    int
+	interimBytes int
+}
+
+// NewStream creates a stream whose utterances are transcribed by transcriber
+// and whose events are encoded as JSON and passed to send.
+func NewStream(ctx context.Context, config StreamConfig, transcriber Transcriber, send func(event []byte) error) *Stream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream{
+		config:      config,
+		transcriber: transcriber,
+		segmenter:   newSegmenter(config.VAD, config.SampleRate),
+		ctx:         ctx,
+		cancel:      cancel,
+		send:        send,
+		queue:       make(chan transcription, maximumQueuedTranscriptions),
+		done:        make(chan struct{}),
+	}
+	go s.transcribe()
+	return s
+}
+
+// Write streams audio.
+func (s *Stream) Write(pcm []byte) error {
+	return s.handle(s.segmenter.write(pcm))
+}
+
+// Flush ends the utterance in progress, if any, so that it's transcribed
+// without waiting for silence.
+func (s *Stream) Flush() error {
+	return s.handle(s.segmenter.flush())
+}
+
+// Close stops the stream. Queued transcriptions are abandoned.
+func (s *Stream) Close() {
+	s.cancel()
+	close(s.queue)
+	<-s.done
+}
+
+// Error sends an error event.
+func (s *Stream) Error(message string) error {
+	return s.sendEvent(Event{Type: EventError, Utterance: s.utterance, Message: message})
+}
+
+// handle handles the starts and ends of utterances, and queues interim
+// transcriptions of the utterance in progress.
+func (s *Stream) handle(events []vadEvent) error {
+	for _, event := range events {
+		if !event.ended {
+			s.interimBytes = 0
+			if err := s.sendEvent(Event{Type: EventSpeechStarted, Utterance: s.utterance, StartMS: s.milliseconds(event.start)}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.enqueue(transcription{
+			event: Event{Type: EventFinalTranscript, Utterance: s.utterance, StartMS: s.milliseconds(event.start), EndMS: s.milliseconds(event.end)},
+			pcm:   event.utterance,
+		}, true); err != nil {
+			return err
+		}
+		s.utterance++
+	}
+
+	if s.config.InterimInterval > 0 && s.segmenter.speaking &&
+		len(s.segmenter.utterance)-s.interimBytes >= s.segmenter.durationBytes(s.config.InterimInterval) {
+		s.interimBytes = len(s.segmenter.utterance)
+		s.enqueue(transcription{
+			event: Event{Type: EventInterimTranscript, Utterance: s.utterance, StartMS: s.milliseconds(s.segmenter.start)},
+			pcm:   append([]byte(nil), s.segmenter.utterance...),
+		}, false)
+	}
+	return nil
+}
+
+// enqueue queues a transcription. If wait is false, the transcription is
+// dropped if the queue is full.
+func (s *Stream) enqueue(t transcription, wait bool) error {
+	if !wait {
+		select {
+		case s.queue <- t:
+		default:
+		}
+		return nil
+	}
+	select {
+	case s.queue <- t:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// transcribe processes queued transcriptions until the queue is closed.
+func (s *Stream) transcribe() {
+	defer close(s.done)
+	for t := range s.queue {
+		if s.ctx.Err() != nil || (t.event.Type == EventInterimTranscript && len(s.queue) > 0) {
+			continue
+		}
+		text, err := s.transcriber.Transcribe(s.ctx, t.pcm, s.config.SampleRate, s.config.Language)
+		if err != nil {
+			if s.ctx.Err() == nil {
+				s.sendEvent(Event{Type: EventError, Utterance: t.event.Utterance, Message: err.Error()})
+			}
+			continue
+		}
+		t.event.Text = text
+		s.sendEvent(t.event)
+	}
+}
+
+// sendEvent sends an event.
+func (s *Stream) sendEvent(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	return s.send(data)
+}
+
+// milliseconds converts a byte offset in the stream to milliseconds.
+func (s *Stream) milliseconds(offset int64) int64 {
+	return offset / 2 * 1000 / int64(s.config.SampleRate)
+}
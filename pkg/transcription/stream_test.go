@@ -0,0 +1,174 @@
+package transcription
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// audio returns pcm16 audio at DefaultSampleRate with the specified duration,
+// which is a tone if speech is true and silence otherwise.
+func audio(duration time.Duration, speech bool) []byte {
+	pcm := make([]byte, int(duration*DefaultSampleRate/time.Second)*2)
+	if speech {
+		for i := 0; i < len(pcm)/2; i++ {
+			sample := int16(8000)
+			if i%20 < 10 {
+				sample = -sample
+			}
+			binary.LittleEndian.PutUint16(pcm[2*i:], uint16(sample))
+		}
+	}
+	return pcm
+}
+
+// transcriberFunc adapts a function to a Transcriber.
+type transcriberFunc func(pcm []byte) (string, error)
+
+func (f transcriberFunc) Transcribe(_ context.Context, pcm []byte, _ int, _ string) (string, error) {
+	return f(pcm)
+}
+
+// recorder records the events of a stream.
+type recorder struct {
+	m      sync.Mutex
+	events []Event
+	// interims receives interim transcripts, and finals receives final
+	// transcripts and errors.
+	interims, finals chan Event
+}
+
+func newRecorder() *recorder {
+	return &recorder{interims: make(chan Event, 16), finals: make(chan Event, 16)}
+}
+
+func (r *recorder) send(data []byte) error {
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	r.m.Lock()
+	r.events = append(r.events, event)
+	r.m.Unlock()
+	switch event.Type {
+	case EventInterimTranscript:
+		r.interims <- event
+	case EventFinalTranscript, EventError:
+		r.finals <- event
+	}
+	return nil
+}
+
+func (r *recorder) types() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+	var types []string
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestSegmenter(t *testing.T) {
+	s := newSegmenter(DefaultVADConfig, DefaultSampleRate)
+	var events []vadEvent
+	events = append(events, s.write(audio(time.Second, false))...)
+	speech := audio(time.Second, true)
+	// Write speech in chunks that aren't aligned with frames.
+	for chunk := range slices.Chunk(speech, 1001) {
+		events = append(events, s.write(chunk)...)
+	}
+	events = append(events, s.write(audio(time.Second, false))...)
+
+	if len(events) != 2 || events[0].ended || !events[1].ended {
+		t.Fatalf("Expected an utterance to start and end, got %+v", events)
+	}
+	// The utterance includes the preroll and the trailing silence.
+	wantStart := int64(len(audio(time.Second-prerollDuration, false)))
+	wantEnd := int64(len(audio(2*time.Second+DefaultVADConfig.MinSilence, false)))
+	if events[0].start != wantStart || events[1].start != wantStart || events[1].end != wantEnd {
+		t.Errorf("Expected an utterance from %d to %d, got %+v", wantStart, wantEnd, events)
+	}
+	if len(events[1].utterance) != int(wantEnd-wantStart) || !bytes.Contains(events[1].utterance, speech) {
+		t.Errorf("Unexpected utterance of %d bytes", len(events[1].utterance))
+	}
+
+	// Short noises don't start utterances.
+	if events := s.write(append(audio(40*time.Millisecond, true), audio(time.Second, false)...)); len(events) != 0 {
+		t.Errorf("Expected no utterance, got %+v", events)
+	}
+
+	// Long utterances are split, and flushing ends them.
+	s = newSegmenter(VADConfig{Threshold: 0.01, MinSpeech: 100 * time.Millisecond, MinSilence: time.Second, MaxUtterance: time.Second}, DefaultSampleRate)
+	events = s.write(audio(1500*time.Millisecond, true))
+	events = append(events, s.flush()...)
+	var ended int
+	for _, event := range events {
+		if event.ended {
+			ended++
+		}
+	}
+	if len(events) != 4 || ended != 2 || s.speaking {
+		t.Errorf("Expected a split utterance, got %+v", events)
+	}
+}
+
+func TestStream(t *testing.T) {
+	var failing atomic.Bool
+	transcriber := transcriberFunc(func(pcm []byte) (string, error) {
+		if failing.Load() {
+			return "", errors.New("whisper is down")
+		}
+		return "hello", nil
+	})
+	events := newRecorder()
+	config := StreamConfig{SampleRate: DefaultSampleRate, InterimInterval: DefaultInterimInterval, VAD: DefaultVADConfig}
+	stream := NewStream(context.Background(), config, transcriber, events.send)
+	defer stream.Close()
+
+	if err := stream.Write(audio(500*time.Millisecond, false)); err != nil {
+		t.Fatalf("Failed to write audio: %v", err)
+	}
+	for range 4 {
+		if err := stream.Write(audio(500*time.Millisecond, true)); err != nil {
+			t.Fatalf("Failed to write audio: %v", err)
+		}
+	}
+	if interim := <-events.interims; interim.Utterance != 0 || interim.Text != "hello" || interim.StartMS != 300 {
+		t.Errorf("Unexpected interim transcript %+v", interim)
+	}
+	if err := stream.Write(audio(time.Second, false)); err != nil {
+		t.Fatalf("Failed to write audio: %v", err)
+	}
+	final := <-events.finals
+	if final.Utterance != 0 || final.Text != "hello" || final.StartMS != 300 || final.EndMS != 3100 {
+		t.Errorf("Unexpected final transcript %+v", final)
+	}
+	types := events.types()
+	if types[0] != EventSpeechStarted || types[len(types)-1] != EventFinalTranscript {
+		t.Errorf("Unexpected events %v", types)
+	}
+
+	// Flushing ends an utterance without waiting for silence, and failures
+	// are reported.
+	failing.Store(true)
+	stream.Write(audio(time.Second, true))
+	stream.Write(audio(time.Second, true))
+	stream.Flush()
+	for {
+		event := <-events.finals
+		if event.Type == EventError {
+			if event.Utterance != 1 || event.Message != "whisper is down" {
+				t.Errorf("Unexpected error %+v", event)
+			}
+			break
+		}
+	}
+}
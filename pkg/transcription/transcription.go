@@ -0,0 +1,118 @@
+// Package transcription implements streaming speech-to-text over WebSockets.
+// Clients stream raw audio frames, which are segmented into utterances by
+// voice activity detection, and receive interim transcripts while an utterance
+// is in progress and a final transcript when it ends. Transcription is
+// delegated to a pluggable Transcriber, such as a local whisper.cpp server.
+package transcription
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// maximumResponseSize is the maximum size of a transcription server's
+// response.
+const maximumResponseSize = 1024 * 1024
+
+// Transcriber transcribes audio.
+type Transcriber interface {
+	// Transcribe transcribes mono, little-endian pcm16 audio with the
+	// specified sample rate. If language is empty, it's detected.
+	Transcribe(ctx context.Context, pcm []byte, sampleRate int, language string) (string, error)
+}
+
+// WhisperServer is a Transcriber backed by a whisper.cpp server, e.g. one
+// started with whisper-server --convert.
+type WhisperServer struct {
+	// url is the base URL of the server.
+	url string
+	// client issues requests to the server.
+	client *http.Client
+}
+
+// NewWhisperServer creates a Transcriber backed by the whisper.cpp server at
+// the specified base URL.
+func NewWhisperServer(url string) *WhisperServer {
+	return &WhisperServer{url: strings.TrimSuffix(url, "/"), client: http.DefaultClient}
+}
+
+// Transcribe implements Transcriber.Transcribe.
+func (w *WhisperServer) Transcribe(ctx context.Context, pcm []byte, sampleRate int, language string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	file.Write(encodeWAV(pcm, sampleRate))
+	form.WriteField("response_format", "json")
+	form.WriteField("temperature", "0")
+	if language != "" {
+		form.WriteField("language", language)
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url+"/inference", &body)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	response, err := w.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(response.Body, maximumResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read transcription: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcription request failed with status %d: %s", response.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var result struct {
+		Text  string `json:"text"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("invalid transcription: %w", err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("transcription failed: %s", result.Error)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+// encodeWAV encodes mono pcm16 audio with the specified sample rate as a WAV
+// file.
+func encodeWAV(pcm []byte, sampleRate int) []byte {
+	const bitsPerSample, channels = 16, 1
+	var wav bytes.Buffer
+	wav.Grow(44 + len(pcm))
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(36+len(pcm)))
+	wav.WriteString("WAVEfmt ")
+	for _, field := range []any{
+		uint32(16),
+		uint16(1), // PCM
+		uint16(channels),
+		uint32(sampleRate),
+		uint32(sampleRate * channels * bitsPerSample / 8),
+		uint16(channels * bitsPerSample / 8),
+		uint16(bitsPerSample),
+	} {
+		binary.Write(&wav, binary.LittleEndian, field)
+	}
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(len(pcm)))
+	wav.Write(pcm)
+	return wav.Bytes()
+}
@@ -0,0 +1,175 @@
+package transcription
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	// frameDuration is the duration of the frames whose energy is compared
+	// with the threshold.
+	frameDuration = 20 * time.Millisecond
+	// prerollDuration is the duration of audio preceding detected speech
+	// that's included in utterances, so that their onsets aren't clipped.
+	prerollDuration = 200 * time.Millisecond
+)
+
+// VADConfig configures the voice activity detection that segments streamed
+// audio into utterances.
+type VADConfig struct {
+	// Threshold is the RMS level, relative to full scale, above which a frame
+	// is considered speech.
+	Threshold float64
+	// MinSpeech is the duration of speech that starts an utterance.
+	MinSpeech time.Duration
+	// MinSilence is the duration of silence that ends an utterance.
+	MinSilence time.Duration
+	// MaxUtterance is the maximum duration of an utterance. Longer utterances
+	// are split.
+	MaxUtterance time.Duration
+}
+
+// DefaultVADConfig is the default voice activity detection configuration. Its
+// maximum utterance duration is whisper's context window.
+var DefaultVADConfig = VADConfig{
+	Threshold:    0.01,
+	MinSpeech:    100 * time.Millisecond,
+	MinSilence:   600 * time.Millisecond,
+	MaxUtterance: 30 * time.Second,
+}
+
+// vadEvent is the start or end of an utterance.
+type vadEvent struct {
+	// ended is true if the utterance ended, and false if it started.
+	ended bool
+	// start and end are the byte offsets of the utterance in the stream. end
+	// is only set if the utterance ended.
+	start, end int64
+	// utterance is the audio of the utterance that ended.
+	utterance []byte
+}
+
+// segmenter segments pcm16 audio into utterances by the energy of its frames.
+type segmenter struct {
+	config     VADConfig
+	frameBytes int
+	// durationBytes converts durations to sizes in bytes.
+	durationBytes func(time.Duration) int
+	// pending is the audio of an incomplete frame.
+	pending []byte
+	// preroll is the recent audio preceding an utterance.
+	preroll []byte
+	// offset is the byte offset of the next frame in the stream.
+	offset int64
+	// speaking is true while an utterance is in progress.
+	speaking bool
+	// utterance and start are the audio and byte offset of the utterance in
+	// progress.
+	utterance []byte
+	start     int64
+	// speech and silence are the durations of the current runs of speech and
+	// silence frames.
+	speech, silence time.Duration
+}
+
+// newSegmenter creates a segmenter for audio with the specified sample rate.
+func newSegmenter(config VADConfig, sampleRate int) *segmenter {
+	durationBytes := func(d time.Duration) int {
+		return int(int64(d)*int64(sampleRate)/int64(time.Second)) * 2
+	}
+	return &segmenter{
+		config:        config,
+		frameBytes:    durationBytes(frameDuration),
+		durationBytes: durationBytes,
+	}
+}
+
+// write processes audio, returning the starts and ends of utterances.
+func (s *segmenter) write(pcm []byte) []vadEvent {
+	var events []vadEvent
+	s.pending = append(s.pending, pcm...)
+	for len(s.pending) >= s.frameBytes {
+		events = append(events, s.frame(s.pending[:s.frameBytes])...)
+		s.pending = s.pending[s.frameBytes:]
+	}
+	s.pending = append([]byte(nil), s.pending...)
+	return events
+}
+
+// frame processes a frame of audio.
+func (s *segmenter) frame(frame []byte) []vadEvent {
+	defer func() {
+		s.offset += int64(len(frame))
+	}()
+	speech := rms(frame) >= s.config.Threshold
+
+	if !s.speaking {
+		s.preroll = append(s.preroll, frame...)
+		if excess := len(s.preroll) - s.durationBytes(prerollDuration+s.config.MinSpeech); excess > 0 {
+			s.preroll = append(s.preroll[:0], s.preroll[excess:]...)
+		}
+		if !speech {
+			s.speech = 0
+			return nil
+		}
+		if s.speech += frameDuration; s.speech < s.config.MinSpeech {
+			return nil
+		}
+		s.speaking, s.silence = true, 0
+		s.utterance = append([]byte(nil), s.preroll...)
+		s.start = s.offset + int64(len(frame)) - int64(len(s.preroll))
+		s.preroll = s.preroll[:0]
+		return []vadEvent{{start: s.start}}
+	}
+
+	s.utterance = append(s.utterance, frame...)
+	if speech {
+		s.silence = 0
+	} else {
+		s.silence += frameDuration
+	}
+	if s.silence >= s.config.MinSilence {
+		return []vadEvent{s.end(s.offset + int64(len(frame)))}
+	}
+	if len(s.utterance) >= s.durationBytes(s.config.MaxUtterance) {
+		// Split the utterance, continuing with another.
+		end := s.end(s.offset + int64(len(frame)))
+		s.speaking, s.silence = true, 0
+		s.start = end.end
+		return []vadEvent{end, {start: s.start}}
+	}
+	return nil
+}
+
+// end ends the utterance in progress at the specified byte offset.
+func (s *segmenter) end(offset int64) vadEvent {
+	event := vadEvent{ended: true, start: s.start, end: offset, utterance: s.utterance}
+	s.speaking, s.utterance, s.speech = false, nil, 0
+	return event
+}
+
+// flush ends the utterance in progress, if any, including incomplete frames.
+func (s *segmenter) flush() []vadEvent {
+	if !s.speaking {
+		return nil
+	}
+	s.utterance = append(s.utterance, s.pending...)
+	s.offset += int64(len(s.pending))
+	s.pending = nil
+	return []vadEvent{s.end(s.offset)}
+}
+
+// rms returns the RMS level of pcm16 audio, relative to full scale.
+func rms(pcm []byte) float64 {
+	samples := len(pcm) / 2
+	if samples == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < samples; i++ {
+		sample := float64(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / math.MaxInt16
+		sum += sample * sample
+	}
+	return math.Sqrt(sum / float64(samples))
+}
@@ -0,0 +1,230 @@
+package vectorstore
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chunking strategy types.
+const (
+	// ChunkingAuto uses the markdown strategy for markdown documents and the
+	// paragraph strategy for all others.
+	ChunkingAuto = "auto"
+	// ChunkingFixed splits text into chunks of a fixed size that overlap,
+	// preferring to break at whitespace.
+	ChunkingFixed = "fixed"
+	// ChunkingParagraph packs consecutive paragraphs into chunks.
+	ChunkingParagraph = "paragraph"
+	// ChunkingMarkdown packs consecutive markdown sections into chunks,
+	// repeating each section's heading in all of its chunks.
+	ChunkingMarkdown = "markdown"
+)
+
+const (
+	// DefaultMaxChunkSize is the default maximum chunk size in characters.
+	DefaultMaxChunkSize = 2000
+	// DefaultChunkOverlap is the default overlap between fixed-size chunks in
+	// characters.
+	DefaultChunkOverlap = 200
+	// minimumMaxChunkSize and maximumMaxChunkSize bound the maximum chunk
+	// size.
+	minimumMaxChunkSize = 100
+	maximumMaxChunkSize = 20000
+)
+
+// ChunkingStrategy configures how documents are split into chunks, each of
+// which is embedded separately. Sizes are measured in characters.
+type ChunkingStrategy struct {
+	// Type is the strategy type.
+	Type string `json:"type"`
+	// MaxChunkSize is the maximum size of a chunk.
+	MaxChunkSize int `json:"max_chunk_size,omitempty"`
+	// ChunkOverlap is the number of characters that consecutive chunks share
+	// when text has to be split within a paragraph. It must be at most half of
+	// the maximum chunk size.
+	ChunkOverlap int `json:"chunk_overlap,omitempty"`
+}
+
+// withDefaults validates a strategy and fills in its defaults.
+func (s ChunkingStrategy) withDefaults() (ChunkingStrategy, error) {
+	switch s.Type {
+	case "":
+		s.Type = ChunkingAuto
+	case ChunkingAuto, ChunkingFixed, ChunkingParagraph, ChunkingMarkdown:
+	default:
+		return s, fmt.Errorf("unknown chunking strategy %q (must be one of auto, fixed, paragraph, or markdown)", s.Type)
+	}
+	if s.MaxChunkSize == 0 {
+		s.MaxChunkSize = DefaultMaxChunkSize
+		if s.ChunkOverlap == 0 {
+			s.ChunkOverlap = DefaultChunkOverlap
+		}
+	}
+	if s.MaxChunkSize < minimumMaxChunkSize || s.MaxChunkSize > maximumMaxChunkSize {
+		return s, fmt.Errorf("max_chunk_size must be between %d and %d", minimumMaxChunkSize, maximumMaxChunkSize)
+	}
+	if s.ChunkOverlap < 0 || s.ChunkOverlap > s.MaxChunkSize/2 {
+		return s, fmt.Errorf("chunk_overlap must be between 0 and half of max_chunk_size")
+	}
+	return s, nil
+}
+
+// chunk splits text into chunks using the strategy. The markdown argument
+// indicates whether the text is markdown, for use by the auto strategy.
+func (s ChunkingStrategy) chunk(text string, markdown bool) []string {
+	strategy := s.Type
+	if strategy == ChunkingAuto {
+		strategy = ChunkingParagraph
+		if markdown {
+			strategy = ChunkingMarkdown
+		}
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var chunks []string
+	switch strategy {
+	case ChunkingFixed:
+		chunks = splitFixed(text, s.MaxChunkSize, s.ChunkOverlap)
+	case ChunkingMarkdown:
+		for _, section := range markdownSections(text) {
+			heading, body := section[0], section[1]
+			size := s.MaxChunkSize
+			if headingSize := utf8.RuneCountInString(heading) + 2; headingSize > s.MaxChunkSize/2 {
+				// Headings are only repeated if they leave enough room.
+				body, heading = heading+"\n\n"+body, ""
+			} else if heading != "" {
+				size -= headingSize
+			}
+			for _, chunk := range s.pack(paragraphs(body), size) {
+				if heading != "" {
+					chunk = heading + "\n\n" + chunk
+				}
+				chunks = append(chunks, chunk)
+			}
+		}
+	default:
+		chunks = s.pack(paragraphs(text), s.MaxChunkSize)
+	}
+
+	nonEmpty := chunks[:0]
+	for _, chunk := range chunks {
+		if chunk = strings.TrimSpace(chunk); chunk != "" {
+			nonEmpty = append(nonEmpty, chunk)
+		}
+	}
+	return nonEmpty
+}
+
+// splitFixed splits text into chunks of at most size characters that overlap
+// by overlap characters, breaking at whitespace where possible.
+func splitFixed(text string, size, overlap int) []string {
+	runes := []rune(text)
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			// Break after the last whitespace in the second half of the
+			// chunk, if there is one.
+			for i := end; i > start+size/2; i-- {
+				if unicode.IsSpace(runes[i-1]) {
+					end = i
+					break
+				}
+			}
+		}
+		chunks = append(chunks, string(runes[start:end]))
+		if end == len(runes) {
+			break
+		}
+		start = max(end-overlap, start+1)
+	}
+	return chunks
+}
+
+// pack combines consecutive paragraphs into chunks of at most size
+// characters. Paragraphs that are too large on their own are split.
+func (s ChunkingStrategy) pack(paragraphs []string, size int) []string {
+	var chunks []string
+	var current strings.Builder
+	currentSize := 0
+	flush := func() {
+		if currentSize > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentSize = 0
+		}
+	}
+
+	for _, paragraph := range paragraphs {
+		paragraphSize := utf8.RuneCountInString(paragraph)
+		if paragraphSize > size {
+			flush()
+			chunks = append(chunks, splitFixed(paragraph, size, s.ChunkOverlap)...)
+			continue
+		}
+		if currentSize > 0 && currentSize+2+paragraphSize > size {
+			flush()
+		}
+		if currentSize > 0 {
+			current.WriteString("\n\n")
+			currentSize += 2
+		}
+		current.WriteString(paragraph)
+		currentSize += paragraphSize
+	}
+	flush()
+	return chunks
+}
+
+// paragraphs splits text into its non-empty paragraphs, which are separated
+// by blank lines.
+func paragraphs(text string) []string {
+	var result []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			result = append(result, paragraph)
+		}
+	}
+	return result
+}
+
+// markdownSections splits markdown text into sections at headings, returning
+// each section's heading (empty for any text before the first heading) and
+// body. Headings within fenced code blocks are ignored.
+func markdownSections(text string) [][2]string {
+	var sections [][2]string
+	heading := ""
+	var body strings.Builder
+	inFence := false
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if !inFence && isMarkdownHeading(trimmed) {
+			if heading != "" || strings.TrimSpace(body.String()) != "" {
+				sections = append(sections, [2]string{heading, body.String()})
+			}
+			heading = trimmed
+			body.Reset()
+			continue
+		}
+		body.WriteString(line)
+		body.WriteByte('\n')
+	}
+	if heading != "" || strings.TrimSpace(body.String()) != "" {
+		sections = append(sections, [2]string{heading, body.String()})
+	}
+	return sections
+}
+
+// isMarkdownHeading returns whether a line is an ATX heading.
+func isMarkdownHeading(line string) bool {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	return level >= 1 && level <= 6 && (level == len(line) || line[level] == ' ')
+}
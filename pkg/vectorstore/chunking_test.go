@@ -0,0 +1,85 @@
+package vectorstore
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkingStrategyDefaults(t *testing.T) {
+	strategy, err := ChunkingStrategy{}.withDefaults()
+	if err != nil || strategy != (ChunkingStrategy{Type: ChunkingAuto, MaxChunkSize: DefaultMaxChunkSize, ChunkOverlap: DefaultChunkOverlap}) {
+		t.Errorf("Unexpected default strategy %+v (%v)", strategy, err)
+	}
+	for _, invalid := range []ChunkingStrategy{
+		{Type: "semantic"},
+		{MaxChunkSize: 10},
+		{MaxChunkSize: 1000, ChunkOverlap: 600},
+		{MaxChunkSize: 1000, ChunkOverlap: -1},
+	} {
+		if _, err := invalid.withDefaults(); err == nil {
+			t.Errorf("Expected error for %+v", invalid)
+		}
+	}
+}
+
+func TestChunk(t *testing.T) {
+	sentence := "The quick brown fox jumps over the lazy dog. "
+	paragraph := strings.TrimSpace(strings.Repeat(sentence, 3))
+
+	t.Run("fixed", func(t *testing.T) {
+		strategy := ChunkingStrategy{Type: ChunkingFixed, MaxChunkSize: 100, ChunkOverlap: 20}
+		text := strings.Repeat(sentence, 10)
+		chunks := strategy.chunk(text, false)
+		if len(chunks) < 5 {
+			t.Fatalf("Expected at least 5 chunks, got %d", len(chunks))
+		}
+		for i, chunk := range chunks {
+			if utf8.RuneCountInString(chunk) > 100 {
+				t.Errorf("Chunk %d exceeds maximum size: %q", i, chunk)
+			}
+			if i > 0 && !strings.Contains(text, chunk) {
+				t.Errorf("Chunk %d isn't part of the text: %q", i, chunk)
+			}
+		}
+		// Consecutive chunks overlap.
+		if last := chunks[0][len(chunks[0])-10:]; !strings.Contains(chunks[1], last) {
+			t.Errorf("Expected chunk 1 to overlap with chunk 0, got %q and %q", chunks[0], chunks[1])
+		}
+	})
+
+	t.Run("paragraph", func(t *testing.T) {
+		strategy := ChunkingStrategy{Type: ChunkingParagraph, MaxChunkSize: 300}
+		text := strings.Join([]string{paragraph, paragraph, paragraph, strings.Repeat(sentence, 10)}, "\n\n")
+		chunks := strategy.chunk(text, false)
+		if len(chunks) < 3 || chunks[0] != paragraph+"\n\n"+paragraph {
+			t.Fatalf("Expected the first two paragraphs to be packed together, got %q", chunks)
+		}
+		for i, chunk := range chunks {
+			if utf8.RuneCountInString(chunk) > 300 {
+				t.Errorf("Chunk %d exceeds maximum size: %q", i, chunk)
+			}
+		}
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		strategy := ChunkingStrategy{Type: ChunkingAuto, MaxChunkSize: 200}
+		text := "Intro text.\n\n# Setup\n\n" + paragraph + "\n\n" + paragraph +
+			"\n\n```sh\n# not a heading\n```\n\n## Usage\n\nRun it."
+		chunks := strategy.chunk(text, true)
+		want := []string{
+			"Intro text.",
+			"# Setup\n\n" + paragraph,
+			"# Setup\n\n" + paragraph + "\n\n```sh\n# not a heading\n```",
+			"## Usage\n\nRun it.",
+		}
+		if len(chunks) != len(want) {
+			t.Fatalf("Expected %d chunks, got %q", len(want), chunks)
+		}
+		for i := range want {
+			if chunks[i] != want[i] {
+				t.Errorf("Expected chunk %d to be %q, got %q", i, want[i], chunks[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,460 @@
+package vectorstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/retrieval"
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+const (
+	// APIPath is the path of the vector store API routes, relative to the
+	// inference prefix.
+	APIPath = "/v1/vector_stores"
+
+	// maximumRequestSize is the maximum size of a vector store API request
+	// body.
+	maximumRequestSize = 10 * 1024 * 1024
+	// maximumDocumentsPerRequest is the maximum number of documents that can
+	// be added by a single request, all of which are embedded in one batch.
+	maximumDocumentsPerRequest = 256
+	// defaultMaxResults is the default number of search results.
+	defaultMaxResults = 10
+	// maximumMaxResults is the maximum number of search results.
+	maximumMaxResults = 50
+)
+
+// CreateRequest is the body of a vector store creation request.
+type CreateRequest struct {
+	// Name is the store's optional name.
+	Name string `json:"name"`
+	// Model is the embedding model used to embed documents and queries.
+	Model string `json:"model"`
+	// Dimensions is the optional number of dimensions to request from the
+	// embedding model.
+	Dimensions int `json:"dimensions"`
+}
+
+// AddDocumentsRequest is the body of a request to add documents to a vector
+// store.
+type AddDocumentsRequest struct {
+	// Documents are the documents to add. Only their IDs, text, and metadata
+	// are used.
+	Documents []Document `json:"documents"`
+}
+
+// SearchRequest is the body of a vector store search request.
+type SearchRequest struct {
+	// Query is the text to search for.
+	Query string `json:"query"`
+	// MaxNumResults is the maximum number of results to return.
+	MaxNumResults int `json:"max_num_results"`
+	// ScoreThreshold is the minimum score of returned results.
+	ScoreThreshold *float32 `json:"score_threshold,omitempty"`
+}
+
+// SearchResponse is the response to a vector store search request.
+type SearchResponse struct {
+	// Object is always "vector_store.search_results.page".
+	Object string `json:"object"`
+	// SearchQuery is the query that was searched for.
+	SearchQuery string `json:"search_query"`
+	// Data are the results, most similar first.
+	Data []SearchResult `json:"data"`
+}
+
+// listResponse is the response to a list request.
+type listResponse[T any] struct {
+	Object string `json:"object"`
+	Data   []T    `json:"data"`
+}
+
+// deletedResponse is the response to a deletion request.
+type deletedResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+// embeddingError is an error response from the embeddings endpoint, which is
+// relayed with its original status.
+type embeddingError struct {
+	statusCode int
+	message    string
+}
+
+// Error implements error.Error.
+func (e *embeddingError) Error() string {
+	return fmt.Sprintf("embedding failed: %s", e.message)
+}
+
+// Handler implements the vector store API.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	manager     *Manager
+	ingester    *ingester
+	// embedder serves the OpenAI embeddings API, typically the scheduler.
+	embedder http.Handler
+}
+
+// NewHandler creates a new vector store API handler that embeds documents and
+// queries using embedder.
+func NewHandler(log logging.Logger, embedder http.Handler, allowedOrigins []string, manager *Manager) *Handler {
+	h := &Handler{
+		log:      log,
+		router:   http.NewServeMux(),
+		manager:  manager,
+		ingester: newIngester(),
+		embedder: embedder,
+	}
+
+	for route, handler := range h.routeHandlers() {
+		h.router.HandleFunc(route, handler)
+	}
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// routeHandlers returns the mapping of routes to their handlers.
+func (h *Handler) routeHandlers() map[string]http.HandlerFunc {
+	prefix := inference.InferencePrefix + APIPath
+	return map[string]http.HandlerFunc{
+		"POST " + prefix:                                     h.handleCreate,
+		"GET " + prefix:                                      h.handleList,
+		"GET " + prefix + "/{store}":                         h.handleGet,
+		"DELETE " + prefix + "/{store}":                      h.handleDelete,
+		"POST " + prefix + "/{store}/documents":              h.handleAddDocuments,
+		"GET " + prefix + "/{store}/documents":               h.handleListDocuments,
+		"GET " + prefix + "/{store}/documents/{document}":    h.handleGetDocument,
+		"DELETE " + prefix + "/{store}/documents/{document}": h.handleDeleteDocument,
+		"POST " + prefix + "/{store}/search":                 h.handleSearch,
+		"POST " + prefix + "/{store}/ingestions":             h.handleIngest,
+		"GET " + prefix + "/{store}/ingestions":              h.handleListIngestions,
+		"GET " + prefix + "/{store}/ingestions/{job}":        h.handleGetIngestion,
+		"DELETE " + prefix + "/{store}/ingestions/{job}":     h.handleCancelIngestion,
+	}
+}
+
+// decodeRequest decodes a JSON request body, writing an error response and
+// returning false if it can't be decoded.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maximumRequestSize))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, "request too large", http.StatusBadRequest)
+		} else {
+			http.Error(w, "failed to read request body", http.StatusInternalServerError)
+		}
+		return false
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeJSON writes a JSON response.
+func (h *Handler) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warnf("Failed to encode vector store response: %v", err)
+	}
+}
+
+// writeError writes an error response with the status appropriate for err.
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	var embeddingErr *embeddingError
+	switch {
+	case errors.Is(err, ErrStoreNotFound), errors.Is(err, ErrDocumentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.As(err, &embeddingErr):
+		http.Error(w, err.Error(), embeddingErr.statusCode)
+	default:
+		h.log.Warnf("Vector store request failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var request CreateRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	if request.Model == "" {
+		http.Error(w, "model is required", http.StatusBadRequest)
+		return
+	}
+	if request.Dimensions < 0 {
+		http.Error(w, "dimensions must be positive", http.StatusBadRequest)
+		return
+	}
+	store, err := h.manager.Create(request.Name, request.Model, request.Dimensions)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, store)
+}
+
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, listResponse[VectorStore]{Object: "list", Data: h.manager.List()})
+}
+
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	store, err := h.manager.Get(r.PathValue("store"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, store)
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("store")
+	if err := h.manager.Delete(id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, deletedResponse{ID: id, Object: "vector_store.deleted", Deleted: true})
+}
+
+func (h *Handler) handleAddDocuments(w http.ResponseWriter, r *http.Request) {
+	store, err := h.manager.Get(r.PathValue("store"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	var request AddDocumentsRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	if len(request.Documents) == 0 {
+		http.Error(w, "documents are required", http.StatusBadRequest)
+		return
+	}
+	if len(request.Documents) > maximumDocumentsPerRequest {
+		http.Error(w, fmt.Sprintf("at most %d documents can be added per request", maximumDocumentsPerRequest), http.StatusBadRequest)
+		return
+	}
+	texts := make([]string, len(request.Documents))
+	for i, document := range request.Documents {
+		if strings.TrimSpace(document.Text) == "" {
+			http.Error(w, fmt.Sprintf("document %d has no text", i), http.StatusBadRequest)
+			return
+		}
+		texts[i] = document.Text
+	}
+
+	embeddings, err := h.embed(r.Context(), r, store, texts)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	added, err := h.manager.AddDocuments(store.ID, request.Documents, embeddings)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, listResponse[Document]{Object: "list", Data: added})
+}
+
+func (h *Handler) handleListDocuments(w http.ResponseWriter, r *http.Request) {
+	documents, err := h.manager.Documents(r.PathValue("store"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, listResponse[Document]{Object: "list", Data: documents})
+}
+
+func (h *Handler) handleGetDocument(w http.ResponseWriter, r *http.Request) {
+	document, err := h.manager.Document(r.PathValue("store"), r.PathValue("document"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, document)
+}
+
+func (h *Handler) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	documentID := r.PathValue("document")
+	if err := h.manager.DeleteDocument(r.PathValue("store"), documentID); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, deletedResponse{ID: documentID, Object: "vector_store.document.deleted", Deleted: true})
+}
+
+func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	store, err := h.manager.Get(r.PathValue("store"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	var request SearchRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	if strings.TrimSpace(request.Query) == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return
+	}
+	if request.MaxNumResults == 0 {
+		request.MaxNumResults = defaultMaxResults
+	}
+	if request.MaxNumResults < 1 || request.MaxNumResults > maximumMaxResults {
+		http.Error(w, fmt.Sprintf("max_num_results must be between 1 and %d", maximumMaxResults), http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.search(r, store, request)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, SearchResponse{
+		Object:      "vector_store.search_results.page",
+		SearchQuery: request.Query,
+		Data:        results,
+	})
+}
+
+// search searches a store on behalf of r using a validated search request.
+func (h *Handler) search(r *http.Request, store VectorStore, request SearchRequest) ([]SearchResult, error) {
+	filtered := []SearchResult{}
+	if store.DocumentCount == 0 {
+		return filtered, nil
+	}
+	embeddings, err := h.embed(r.Context(), r, store, []string{request.Query})
+	if err != nil {
+		return nil, err
+	}
+	results, err := h.manager.Search(store.ID, embeddings[0], request.MaxNumResults)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if request.ScoreThreshold == nil || result.Score >= *request.ScoreThreshold {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered, nil
+}
+
+// Retrieve implements retrieval.Retriever.Retrieve, allowing chat completion
+// requests to be grounded in a store's documents.
+func (h *Handler) Retrieve(r *http.Request, options retrieval.Options, query string) ([]retrieval.Chunk, error) {
+	store, err := h.manager.Get(options.VectorStoreID)
+	if errors.Is(err, ErrStoreNotFound) {
+		return nil, fmt.Errorf("%w: %s", retrieval.ErrVectorStoreNotFound, options.VectorStoreID)
+	} else if err != nil {
+		return nil, err
+	}
+	results, err := h.search(r, store, SearchRequest{
+		Query:          query,
+		MaxNumResults:  min(options.MaxNumResults, maximumMaxResults),
+		ScoreThreshold: options.ScoreThreshold,
+	})
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]retrieval.Chunk, len(results))
+	for i, result := range results {
+		chunks[i] = retrieval.Chunk{
+			DocumentID: result.DocumentID,
+			Text:       result.Text,
+			Score:      result.Score,
+			Metadata:   result.Metadata,
+		}
+	}
+	return chunks, nil
+}
+
+// embed embeds texts using a store's embedding model by issuing an embeddings
+// request on behalf of the original request, which loads the model into an
+// embedding runner if necessary. The embeddings request uses ctx rather than
+// the original request's context, so that it can outlive the original request.
+func (h *Handler) embed(ctx context.Context, r *http.Request, store VectorStore, texts []string) ([][]float32, error) {
+	request := map[string]any{
+		"model": store.Model,
+		"input": texts,
+	}
+	if store.Dimensions > 0 {
+		request["dimensions"] = store.Dimensions
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode embeddings request: %w", err)
+	}
+
+	// Clone the original request to preserve headers (User-Agent, etc.), but
+	// drop those that only apply to the original request.
+	embeddingsRequest := r.Clone(ctx)
+	embeddingsRequest.Method = http.MethodPost
+	embeddingsRequest.URL.Path = inference.InferencePrefix + "/v1/embeddings"
+	embeddingsRequest.URL.RawQuery = ""
+	embeddingsRequest.Body = io.NopCloser(bytes.NewReader(body))
+	embeddingsRequest.ContentLength = int64(len(body))
+	embeddingsRequest.Header.Set("Content-Type", "application/json")
+	for _, header := range []string{inference.DryRunHeader, inference.IdempotencyKeyHeader, inference.QueueProgressHeader, "Accept-Encoding"} {
+		embeddingsRequest.Header.Del(header)
+	}
+
+	recorder := utils.NewResponseRecorder()
+	h.embedder.ServeHTTP(recorder, embeddingsRequest)
+	if recorder.StatusCode != http.StatusOK {
+		return nil, &embeddingError{
+			statusCode: recorder.StatusCode,
+			message:    strings.TrimSpace(recorder.Body.String()),
+		}
+	}
+
+	var response struct {
+		Data []embeddingData `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		return nil, &embeddingError{statusCode: http.StatusBadGateway, message: "invalid embeddings response"}
+	}
+	if len(response.Data) != len(texts) {
+		return nil, &embeddingError{
+			statusCode: http.StatusBadGateway,
+			message:    fmt.Sprintf("expected %d embeddings, got %d", len(texts), len(response.Data)),
+		}
+	}
+	slices.SortFunc(response.Data, func(a, b embeddingData) int {
+		return a.Index - b.Index
+	})
+	embeddings := make([][]float32, len(response.Data))
+	for i, item := range response.Data {
+		embeddings[i] = item.Embedding
+	}
+	return embeddings, nil
+}
+
+// embeddingData is an embedding in an embeddings response.
+type embeddingData struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
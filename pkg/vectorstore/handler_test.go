@@ -0,0 +1,180 @@
+package vectorstore
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/inference/retrieval"
+	"github.com/docker/model-runner/pkg/internal/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+// letterEmbedder serves embeddings that count the letters in each input.
+type letterEmbedder struct {
+	requests []map[string]any
+}
+
+func (e *letterEmbedder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != inference.InferencePrefix+"/v1/embeddings" || r.Header.Get(inference.IdempotencyKeyHeader) != "" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	var request map[string]any
+	body, _ := io.ReadAll(r.Body)
+	json.Unmarshal(body, &request)
+	e.requests = append(e.requests, request)
+	if request["model"] != "embedder" {
+		http.Error(w, "model not found", http.StatusNotFound)
+		return
+	}
+
+	var data []embeddingData
+	for i, input := range request["input"].([]any) {
+		embedding := make([]float32, 26)
+		for _, c := range strings.ToLower(input.(string)) {
+			if c >= 'a' && c <= 'z' {
+				embedding[c-'a']++
+			}
+		}
+		// Respond out of order to check that results are reordered.
+		data = append([]embeddingData{{Index: i, Embedding: embedding}}, data...)
+	}
+	json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data})
+}
+
+func newTestHandler(t *testing.T, dir string, embedder http.Handler) *Handler {
+	t.Helper()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	manager, err := NewManager(log, dir)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	return NewHandler(log, embedder, nil, manager)
+}
+
+// serve performs a request and decodes a successful JSON response into v.
+func serve(t *testing.T, handler http.Handler, method, path, body string, v any) int {
+	t.Helper()
+	request := httptest.NewRequest(method, inference.InferencePrefix+APIPath+path, strings.NewReader(body))
+	request.Header.Set(inference.IdempotencyKeyHeader, "key")
+	return testutil.Serve(t, handler, request, v)
+}
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	embedder := &letterEmbedder{}
+	handler := newTestHandler(t, dir, embedder)
+
+	var store VectorStore
+	if code := serve(t, handler, http.MethodPost, "", `{"name":"docs","model":"embedder"}`, &store); code != http.StatusOK {
+		t.Fatalf("Expected store to be created, got status %d", code)
+	}
+	if !strings.HasPrefix(store.ID, "vs_") || store.Model != "embedder" {
+		t.Fatalf("Unexpected store: %+v", store)
+	}
+	if code := serve(t, handler, http.MethodPost, "", `{"name":"docs"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for store without model, got %d", http.StatusBadRequest, code)
+	}
+
+	var added listResponse[Document]
+	code := serve(t, handler, http.MethodPost, "/"+store.ID+"/documents",
+		`{"documents":[{"id":"a","text":"aaa apple","metadata":{"kind":"fruit"}},{"id":"z","text":"zzz zebra"},{"text":"mmm"}]}`, &added)
+	if code != http.StatusOK || len(added.Data) != 3 || added.Data[2].ID == "" {
+		t.Fatalf("Expected 3 documents to be added, got status %d and %+v", code, added.Data)
+	}
+	if code := serve(t, handler, http.MethodPost, "/"+store.ID+"/documents", `{"documents":[{"text":" "}]}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for empty document, got %d", http.StatusBadRequest, code)
+	}
+
+	var results SearchResponse
+	if code := serve(t, handler, http.MethodPost, "/"+store.ID+"/search", `{"query":"zz","max_num_results":2}`, &results); code != http.StatusOK {
+		t.Fatalf("Search failed with status %d", code)
+	}
+	if len(results.Data) != 2 || results.Data[0].DocumentID != "z" || results.Data[0].Text != "zzz zebra" {
+		t.Fatalf("Expected zebra document to match first, got %+v", results.Data)
+	}
+	if code := serve(t, handler, http.MethodPost, "/"+store.ID+"/search", `{"query":"apple","score_threshold":0.5}`, &results); code != http.StatusOK {
+		t.Fatalf("Search failed with status %d", code)
+	}
+	if len(results.Data) != 1 || results.Data[0].DocumentID != "a" || results.Data[0].Metadata["kind"] != "fruit" {
+		t.Fatalf("Expected only apple document to match, got %+v", results.Data)
+	}
+
+	// Stores are persisted.
+	handler = newTestHandler(t, dir, embedder)
+	if code := serve(t, handler, http.MethodGet, "/"+store.ID, "", &store); code != http.StatusOK || store.DocumentCount != 3 {
+		t.Fatalf("Expected persisted store with 3 documents, got status %d and %+v", code, store)
+	}
+	if code := serve(t, handler, http.MethodDelete, "/"+store.ID+"/documents/z", "", nil); code != http.StatusOK {
+		t.Fatalf("Expected document to be deleted, got status %d", code)
+	}
+	if code := serve(t, handler, http.MethodGet, "/"+store.ID+"/documents/z", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for deleted document, got %d", http.StatusNotFound, code)
+	}
+	if code := serve(t, handler, http.MethodPost, "/"+store.ID+"/search", `{"query":"zz"}`, &results); code != http.StatusOK || len(results.Data) != 2 {
+		t.Fatalf("Expected 2 remaining documents to match, got status %d and %+v", code, results.Data)
+	}
+	var documents listResponse[Document]
+	if code := serve(t, handler, http.MethodGet, "/"+store.ID+"/documents", "", &documents); code != http.StatusOK || len(documents.Data) != 2 {
+		t.Errorf("Expected 2 documents, got status %d and %+v", code, documents.Data)
+	}
+
+	if code := serve(t, handler, http.MethodDelete, "/"+store.ID, "", nil); code != http.StatusOK {
+		t.Fatalf("Expected store to be deleted, got status %d", code)
+	}
+	var stores listResponse[VectorStore]
+	if code := serve(t, handler, http.MethodGet, "", "", &stores); code != http.StatusOK || len(stores.Data) != 0 {
+		t.Errorf("Expected no stores, got status %d and %+v", code, stores.Data)
+	}
+	if code := serve(t, handler, http.MethodPost, "/"+store.ID+"/search", `{"query":"zz"}`, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for deleted store, got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestHandlerEmbeddingErrors(t *testing.T) {
+	embedder := &letterEmbedder{}
+	handler := newTestHandler(t, t.TempDir(), embedder)
+
+	var store VectorStore
+	serve(t, handler, http.MethodPost, "", `{"model":"missing","dimensions":8}`, &store)
+	if code := serve(t, handler, http.MethodPost, "/"+store.ID+"/documents", `{"documents":[{"text":"abc"}]}`, nil); code != http.StatusNotFound {
+		t.Errorf("Expected embedding status %d to be relayed, got %d", http.StatusNotFound, code)
+	}
+	if len(embedder.requests) != 1 || embedder.requests[0]["dimensions"] != float64(8) {
+		t.Errorf("Expected dimensions to be requested, got %v", embedder.requests)
+	}
+}
+
+func TestRetrieve(t *testing.T) {
+	handler := newTestHandler(t, t.TempDir(), &letterEmbedder{})
+	var store VectorStore
+	serve(t, handler, http.MethodPost, "", `{"model":"embedder"}`, &store)
+	serve(t, handler, http.MethodPost, "/"+store.ID+"/documents", `{"documents":[
+		{"id":"zoo","text":"zebras at the zoo","metadata":{"source":"zoo.txt"}},
+		{"id":"fruit","text":"apples and bananas"}
+	]}`, nil)
+
+	request := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+"/v1/chat/completions", nil)
+	chunks, err := handler.Retrieve(request, retrieval.Options{VectorStoreID: store.ID, MaxNumResults: 1}, "zebra zoo")
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(chunks) != 1 || chunks[0].DocumentID != "zoo" || chunks[0].Text != "zebras at the zoo" || chunks[0].Metadata["source"] != "zoo.txt" {
+		t.Errorf("Expected the zoo document, got %+v", chunks)
+	}
+
+	threshold := float32(1.1)
+	if chunks, err := handler.Retrieve(request, retrieval.Options{VectorStoreID: store.ID, MaxNumResults: 2, ScoreThreshold: &threshold}, "zebra"); err != nil || len(chunks) != 0 {
+		t.Errorf("Expected no chunks above the score threshold, got %+v (%v)", chunks, err)
+	}
+	if _, err := handler.Retrieve(request, retrieval.Options{VectorStoreID: "vs_missing", MaxNumResults: 1}, "zebra"); !errors.Is(err, retrieval.ErrVectorStoreNotFound) {
+		t.Errorf("Expected ErrVectorStoreNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,385 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+const (
+	// defaultM is the number of neighbors that each node is connected to on
+	// layers above the base layer (the base layer allows twice as many).
+	defaultM = 16
+	// defaultEfConstruction is the size of the candidate list used when
+	// inserting nodes.
+	defaultEfConstruction = 200
+	// defaultEfSearch is the minimum size of the candidate list used when
+	// searching.
+	defaultEfSearch = 64
+)
+
+// hnswNode is a node in the HNSW graph. Fields are exported for encoding.
+type hnswNode struct {
+	// ID is the identifier of the document that the node represents.
+	ID string
+	// Vector is the node's unit-length vector.
+	Vector []float32
+	// Neighbors are the node's neighbors on each of its layers.
+	Neighbors [][]int32
+	// Deleted indicates that the node has been removed. Deleted nodes are
+	// retained to keep the graph navigable until the index is compacted.
+	Deleted bool
+}
+
+// hnswIndex is a hierarchical navigable small world graph for approximate
+// nearest neighbor search by cosine similarity. It isn't safe for concurrent
+// use.
+type hnswIndex struct {
+	// Dimensions is the dimensionality of the indexed vectors, or 0 if no
+	// vectors have been indexed.
+	Dimensions int
+	// M is the maximum number of neighbors per node on upper layers.
+	M int
+	// EfConstruction is the candidate list size used for insertion.
+	EfConstruction int
+	// EntryPoint is the node at which searches start, or -1 if the index is
+	// empty.
+	EntryPoint int32
+	// MaxLevel is the level of the entry point.
+	MaxLevel int
+	// Nodes are the graph's nodes.
+	Nodes []hnswNode
+
+	// ids maps document IDs to their (live) nodes.
+	ids map[string]int32
+	// deleted is the number of deleted nodes.
+	deleted int
+	// random is the source of node levels.
+	random *rand.Rand
+}
+
+// newHNSWIndex creates an empty index.
+func newHNSWIndex() *hnswIndex {
+	index := &hnswIndex{
+		M:              defaultM,
+		EfConstruction: defaultEfConstruction,
+		EntryPoint:     -1,
+	}
+	index.init()
+	return index
+}
+
+// init initializes the index's derived state.
+func (h *hnswIndex) init() {
+	h.ids = make(map[string]int32, len(h.Nodes))
+	h.deleted = 0
+	for i, node := range h.Nodes {
+		if node.Deleted {
+			h.deleted++
+		} else {
+			h.ids[node.ID] = int32(i)
+		}
+	}
+	h.random = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// Len returns the number of live vectors in the index.
+func (h *hnswIndex) Len() int {
+	return len(h.ids)
+}
+
+// distance returns the cosine distance between two unit-length vectors.
+func distance(a, b []float32) float32 {
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot
+}
+
+// normalize returns a unit-length copy of a vector. Zero vectors can't be
+// normalized and are rejected.
+func normalize(vector []float32) ([]float32, error) {
+	var sumOfSquares float64
+	for _, value := range vector {
+		sumOfSquares += float64(value) * float64(value)
+	}
+	if sumOfSquares == 0 || math.IsNaN(sumOfSquares) || math.IsInf(sumOfSquares, 0) {
+		return nil, fmt.Errorf("vector has no direction")
+	}
+	norm := math.Sqrt(sumOfSquares)
+	normalized := make([]float32, len(vector))
+	for i, value := range vector {
+		normalized[i] = float32(float64(value) / norm)
+	}
+	return normalized, nil
+}
+
+// Add indexes a vector for a document, replacing any existing vector for the
+// same document.
+func (h *hnswIndex) Add(id string, vector []float32) error {
+	if h.Dimensions != 0 && len(vector) != h.Dimensions {
+		return fmt.Errorf("vector has %d dimensions, expected %d", len(vector), h.Dimensions)
+	}
+	normalized, err := normalize(vector)
+	if err != nil {
+		return err
+	}
+	h.Delete(id)
+	h.Dimensions = len(vector)
+
+	level := int(-math.Log(1-h.random.Float64()) / math.Log(float64(h.M)))
+	node := int32(len(h.Nodes))
+	h.Nodes = append(h.Nodes, hnswNode{
+		ID:        id,
+		Vector:    normalized,
+		Neighbors: make([][]int32, level+1),
+	})
+	h.ids[id] = node
+
+	if h.EntryPoint < 0 {
+		h.EntryPoint, h.MaxLevel = node, level
+		return nil
+	}
+
+	// Descend greedily through the layers above the node's level, then
+	// connect the node on each of its layers.
+	entryPoint := h.EntryPoint
+	for l := h.MaxLevel; l > level; l-- {
+		entryPoint = h.searchLayer(normalized, []int32{entryPoint}, 1, l)[0].node
+	}
+	entryPoints := []int32{entryPoint}
+	for l := min(level, h.MaxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(normalized, entryPoints, h.EfConstruction, l)
+		neighbors := make([]int32, 0, h.M)
+		for _, candidate := range candidates[:min(h.M, len(candidates))] {
+			neighbors = append(neighbors, candidate.node)
+		}
+		h.Nodes[node].Neighbors[l] = neighbors
+		for _, neighbor := range neighbors {
+			h.connect(neighbor, node, l)
+		}
+		entryPoints = entryPoints[:0]
+		for _, candidate := range candidates {
+			entryPoints = append(entryPoints, candidate.node)
+		}
+	}
+
+	if level > h.MaxLevel {
+		h.EntryPoint, h.MaxLevel = node, level
+	}
+	return nil
+}
+
+// connect adds a link from one node to another on a layer, pruning the node's
+// most distant neighbors if it has too many.
+func (h *hnswIndex) connect(from, to int32, level int) {
+	neighbors := append(h.Nodes[from].Neighbors[level], to)
+	maximum := h.M
+	if level == 0 {
+		maximum = 2 * h.M
+	}
+	if len(neighbors) > maximum {
+		vector := h.Nodes[from].Vector
+		slices.SortFunc(neighbors, func(a, b int32) int {
+			da, db := distance(vector, h.Nodes[a].Vector), distance(vector, h.Nodes[b].Vector)
+			if da < db {
+				return -1
+			} else if da > db {
+				return 1
+			}
+			return 0
+		})
+		neighbors = neighbors[:maximum]
+	}
+	h.Nodes[from].Neighbors[level] = neighbors
+}
+
+// Delete removes a document's vector from the index, returning whether it was
+// present.
+func (h *hnswIndex) Delete(id string) bool {
+	node, ok := h.ids[id]
+	if !ok {
+		return false
+	}
+	delete(h.ids, id)
+	h.Nodes[node].Deleted = true
+	h.deleted++
+	return true
+}
+
+// NeedsCompaction returns whether enough of the index's nodes have been
+// deleted that it should be rebuilt.
+func (h *hnswIndex) NeedsCompaction() bool {
+	return h.deleted > 0 && h.deleted >= len(h.ids)
+}
+
+// Compact rebuilds the index without its deleted nodes.
+func (h *hnswIndex) Compact() {
+	nodes := h.Nodes
+	h.Nodes = nil
+	h.EntryPoint, h.MaxLevel = -1, 0
+	h.init()
+	for _, node := range nodes {
+		if !node.Deleted {
+			// Vectors are already normalized and of the right dimensions.
+			h.Add(node.ID, node.Vector)
+		}
+	}
+}
+
+// searchResult is a document matched by a search.
+type searchResult struct {
+	// ID is the document ID.
+	ID string
+	// Score is the cosine similarity between the document and the query.
+	Score float32
+}
+
+// Search returns the (approximately) k most similar documents to a query
+// vector, most similar first.
+func (h *hnswIndex) Search(query []float32, k int) ([]searchResult, error) {
+	if h.EntryPoint < 0 || k <= 0 {
+		return nil, nil
+	}
+	if len(query) != h.Dimensions {
+		return nil, fmt.Errorf("query has %d dimensions, expected %d", len(query), h.Dimensions)
+	}
+	normalized, err := normalize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	entryPoint := h.EntryPoint
+	for l := h.MaxLevel; l > 0; l-- {
+		entryPoint = h.searchLayer(normalized, []int32{entryPoint}, 1, l)[0].node
+	}
+	// Deleted nodes are excluded after searching, so widen the search to
+	// compensate for them.
+	ef := max(defaultEfSearch, k) + min(h.deleted, k)
+	candidates := h.searchLayer(normalized, []int32{entryPoint}, ef, 0)
+
+	results := make([]searchResult, 0, k)
+	for _, candidate := range candidates {
+		node := &h.Nodes[candidate.node]
+		if node.Deleted {
+			continue
+		}
+		results = append(results, searchResult{ID: node.ID, Score: 1 - candidate.distance})
+		if len(results) == k {
+			break
+		}
+	}
+	return results, nil
+}
+
+// candidate is a node considered during a search.
+type candidate struct {
+	node     int32
+	distance float32
+}
+
+// candidateHeap is a heap of candidates, ordered nearest first unless
+// farthest is set.
+type candidateHeap struct {
+	items    []candidate
+	farthest bool
+}
+
+func (c *candidateHeap) Len() int { return len(c.items) }
+func (c *candidateHeap) Less(i, j int) bool {
+	if c.farthest {
+		return c.items[i].distance > c.items[j].distance
+	}
+	return c.items[i].distance < c.items[j].distance
+}
+func (c *candidateHeap) Swap(i, j int) { c.items[i], c.items[j] = c.items[j], c.items[i] }
+func (c *candidateHeap) Push(x any)    { c.items = append(c.items, x.(candidate)) }
+func (c *candidateHeap) Pop() any {
+	last := c.items[len(c.items)-1]
+	c.items = c.items[:len(c.items)-1]
+	return last
+}
+
+// searchLayer performs a best-first search of a layer starting from the entry
+// points, returning up to ef of the nearest nodes found, nearest first.
+func (h *hnswIndex) searchLayer(query []float32, entryPoints []int32, ef, level int) []candidate {
+	visited := make(map[int32]struct{}, ef*4)
+	candidates := &candidateHeap{}
+	results := &candidateHeap{farthest: true}
+	for _, entryPoint := range entryPoints {
+		visited[entryPoint] = struct{}{}
+		c := candidate{node: entryPoint, distance: distance(query, h.Nodes[entryPoint].Vector)}
+		heap.Push(candidates, c)
+		heap.Push(results, c)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		nearest := heap.Pop(candidates).(candidate)
+		if results.Len() >= ef && nearest.distance > results.items[0].distance {
+			break
+		}
+		for _, neighbor := range h.Nodes[nearest.node].Neighbors[level] {
+			if _, ok := visited[neighbor]; ok {
+				continue
+			}
+			visited[neighbor] = struct{}{}
+			d := distance(query, h.Nodes[neighbor].Vector)
+			if results.Len() < ef || d < results.items[0].distance {
+				heap.Push(candidates, candidate{node: neighbor, distance: d})
+				heap.Push(results, candidate{node: neighbor, distance: d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sorted := make([]candidate, results.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(results).(candidate)
+	}
+	return sorted
+}
+
+// encode writes the index.
+func (h *hnswIndex) encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(h)
+}
+
+// decodeHNSWIndex reads an index written by encode.
+func decodeHNSWIndex(r io.Reader) (*hnswIndex, error) {
+	index := &hnswIndex{}
+	if err := gob.NewDecoder(r).Decode(index); err != nil {
+		return nil, err
+	}
+	// Validate the graph so that corrupt indexes can't cause panics.
+	if index.M < 2 || index.EfConstruction < 1 {
+		return nil, fmt.Errorf("invalid index parameters")
+	}
+	for _, node := range index.Nodes {
+		if len(node.Vector) != index.Dimensions || len(node.Neighbors) == 0 {
+			return nil, fmt.Errorf("invalid node %q", node.ID)
+		}
+		for level, neighbors := range node.Neighbors {
+			for _, neighbor := range neighbors {
+				if neighbor < 0 || int(neighbor) >= len(index.Nodes) || len(index.Nodes[neighbor].Neighbors) <= level {
+					return nil, fmt.Errorf("invalid neighbor %d of node %q", neighbor, node.ID)
+				}
+			}
+		}
+	}
+	if index.EntryPoint >= int32(len(index.Nodes)) || (index.EntryPoint < 0 && len(index.Nodes) > 0) ||
+		(index.EntryPoint >= 0 && len(index.Nodes[index.EntryPoint].Neighbors) != index.MaxLevel+1) {
+		return nil, fmt.Errorf("invalid entry point %d", index.EntryPoint)
+	}
+	index.init()
+	return index, nil
+}
@@ -0,0 +1,165 @@
+package vectorstore
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// randomVectors generates reproducible random vectors.
+func randomVectors(count, dimensions int) [][]float32 {
+	random := rand.New(rand.NewPCG(1, 2))
+	vectors := make([][]float32, count)
+	for i := range vectors {
+		vectors[i] = make([]float32, dimensions)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(random.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+// bruteForceSearch returns the IDs of the k most similar vectors.
+func bruteForceSearch(vectors [][]float32, query []float32, k int) []string {
+	normalizedQuery, _ := normalize(query)
+	type match struct {
+		id       string
+		distance float32
+	}
+	matches := make([]match, len(vectors))
+	for i, vector := range vectors {
+		normalized, _ := normalize(vector)
+		matches[i] = match{id: fmt.Sprint(i), distance: distance(normalizedQuery, normalized)}
+	}
+	slices.SortFunc(matches, func(a, b match) int {
+		if a.distance < b.distance {
+			return -1
+		} else if a.distance > b.distance {
+			return 1
+		}
+		return 0
+	})
+	ids := make([]string, k)
+	for i := range ids {
+		ids[i] = matches[i].id
+	}
+	return ids
+}
+
+func TestHNSWIndexRecall(t *testing.T) {
+	vectors := randomVectors(2000, 32)
+	index := newHNSWIndex()
+	for i, vector := range vectors {
+		if err := index.Add(fmt.Sprint(i), vector); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	const k = 10
+	queries := randomVectors(50, 32)
+	found := 0
+	for _, query := range queries {
+		results, err := index.Search(query, k)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) != k {
+			t.Fatalf("Expected %d results, got %d", k, len(results))
+		}
+		for i := 1; i < len(results); i++ {
+			if results[i].Score > results[i-1].Score {
+				t.Fatalf("Results aren't ordered by score: %v", results)
+			}
+		}
+		expected := bruteForceSearch(vectors, query, k)
+		for _, result := range results {
+			if slices.Contains(expected, result.ID) {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / float64(k*len(queries)); recall < 0.9 {
+		t.Errorf("Expected recall of at least 0.9, got %.2f", recall)
+	}
+}
+
+func TestHNSWIndexDelete(t *testing.T) {
+	vectors := randomVectors(200, 8)
+	index := newHNSWIndex()
+	for i, vector := range vectors {
+		index.Add(fmt.Sprint(i), vector)
+	}
+
+	// A document's own vector is its nearest neighbor until it's deleted.
+	results, _ := index.Search(vectors[7], 1)
+	if len(results) != 1 || results[0].ID != "7" {
+		t.Fatalf("Expected document 7 to match itself, got %v", results)
+	}
+	if !index.Delete("7") || index.Delete("7") {
+		t.Fatal("Expected document 7 to be deleted exactly once")
+	}
+	results, _ = index.Search(vectors[7], 5)
+	for _, result := range results {
+		if result.ID == "7" {
+			t.Fatal("Deleted document was returned")
+		}
+	}
+
+	for i := range 150 {
+		index.Delete(fmt.Sprint(i))
+	}
+	if !index.NeedsCompaction() {
+		t.Fatal("Expected index to need compaction")
+	}
+	index.Compact()
+	if len(index.Nodes) != 50 || index.Len() != 50 || index.NeedsCompaction() {
+		t.Fatalf("Expected 50 nodes after compaction, got %d", len(index.Nodes))
+	}
+	results, _ = index.Search(vectors[180], 1)
+	if len(results) != 1 || results[0].ID != "180" {
+		t.Errorf("Expected document 180 to match itself after compaction, got %v", results)
+	}
+
+	if err := index.Add("x", []float32{1, 2}); err == nil {
+		t.Error("Expected error for vector with wrong dimensions")
+	}
+	if err := index.Add("x", make([]float32, 8)); err == nil {
+		t.Error("Expected error for zero vector")
+	}
+}
+
+func TestHNSWIndexEncoding(t *testing.T) {
+	vectors := randomVectors(100, 16)
+	index := newHNSWIndex()
+	for i, vector := range vectors {
+		index.Add(fmt.Sprint(i), vector)
+	}
+	index.Delete("3")
+
+	var encoded bytes.Buffer
+	if err := index.encode(&encoded); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	decoded, err := decodeHNSWIndex(bytes.NewReader(encoded.Bytes()))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if decoded.Len() != 99 || decoded.Dimensions != 16 {
+		t.Fatalf("Expected 99 vectors of 16 dimensions, got %d of %d", decoded.Len(), decoded.Dimensions)
+	}
+	want, _ := index.Search(vectors[42], 5)
+	got, _ := decoded.Search(vectors[42], 5)
+	if !slices.Equal(want, got) {
+		t.Errorf("Expected decoded index to return %v, got %v", want, got)
+	}
+
+	// Corrupt graphs are rejected.
+	decoded.Nodes[0].Neighbors[0] = append(decoded.Nodes[0].Neighbors[0], 1000)
+	encoded.Reset()
+	decoded.encode(&encoded)
+	if _, err := decodeHNSWIndex(&encoded); err == nil {
+		t.Error("Expected error decoding corrupt index")
+	}
+}
@@ -0,0 +1,443 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docker/model-runner/pkg/internal/utils"
+)
+
+// Ingestion job statuses.
+const (
+	// IngestionQueued indicates that a job hasn't started.
+	IngestionQueued = "queued"
+	// IngestionInProgress indicates that a job is extracting, chunking, or
+	// embedding its files.
+	IngestionInProgress = "in_progress"
+	// IngestionCompleted indicates that a job has finished. Individual files
+	// may still have failed.
+	IngestionCompleted = "completed"
+	// IngestionFailed indicates that a job stopped because of an error.
+	IngestionFailed = "failed"
+	// IngestionCancelled indicates that a job was cancelled.
+	IngestionCancelled = "cancelled"
+)
+
+const (
+	// maximumIngestionSize is the maximum size of an ingestion request body.
+	maximumIngestionSize = 64 * 1024 * 1024
+	// maximumIngestionFiles is the maximum number of files per ingestion job.
+	maximumIngestionFiles = 32
+	// ingestionBatchSize is the number of chunks embedded per embeddings
+	// request.
+	ingestionBatchSize = 32
+	// maximumIngestionJobs is the number of jobs whose status is retained.
+	maximumIngestionJobs = 100
+)
+
+// IngestionFile is the status of a file within an ingestion job.
+type IngestionFile struct {
+	// Filename is the name of the uploaded file. Chunks are stored as
+	// documents with IDs of the form "<filename>:<index>", so reingesting a
+	// file replaces its chunks.
+	Filename string `json:"filename"`
+	// Status is "pending", "completed", or "failed".
+	Status string `json:"status"`
+	// Chunks is the number of chunks that the file was split into.
+	Chunks int `json:"chunks"`
+	// Error describes why the file failed.
+	Error string `json:"error,omitempty"`
+}
+
+// IngestionJob describes a background ingestion job.
+type IngestionJob struct {
+	// ID is the job's identifier.
+	ID string `json:"id"`
+	// Object is always "vector_store.ingestion_job".
+	Object string `json:"object"`
+	// VectorStoreID is the ID of the store into which files are ingested.
+	VectorStoreID string `json:"vector_store_id"`
+	// Status is the job's status.
+	Status string `json:"status"`
+	// ChunkingStrategy is the strategy used to chunk files.
+	ChunkingStrategy ChunkingStrategy `json:"chunking_strategy"`
+	// Files are the statuses of the job's files.
+	Files []IngestionFile `json:"files"`
+	// TotalChunks is the total number of chunks to embed, which is known once
+	// all files have been chunked.
+	TotalChunks int `json:"total_chunks"`
+	// EmbeddedChunks is the number of chunks embedded and stored so far.
+	EmbeddedChunks int `json:"embedded_chunks"`
+	// Error describes why the job failed.
+	Error string `json:"error,omitempty"`
+	// CreatedAt is the job's creation time as a Unix timestamp.
+	CreatedAt int64 `json:"created_at"`
+	// CompletedAt is the time at which the job finished as a Unix timestamp.
+	CompletedAt int64 `json:"completed_at,omitempty"`
+}
+
+// ingestionFileData is an uploaded file awaiting ingestion.
+type ingestionFileData struct {
+	// name is the file's name.
+	name string
+	// kind is "pdf", "markdown", or "text".
+	kind string
+	// data is the file's content.
+	data []byte
+}
+
+// ingestionJob is a running or finished ingestion job.
+type ingestionJob struct {
+	// status is the job's status, guarded by the ingester's lock.
+	status IngestionJob
+	// cancel cancels the job.
+	cancel context.CancelFunc
+}
+
+// ingester tracks ingestion jobs.
+type ingester struct {
+	// mu guards jobs and order.
+	mu sync.Mutex
+	// jobs maps job IDs to jobs.
+	jobs map[string]*ingestionJob
+	// order lists job IDs from oldest to newest.
+	order []string
+}
+
+// newIngester creates a new ingester.
+func newIngester() *ingester {
+	return &ingester{jobs: make(map[string]*ingestionJob)}
+}
+
+// add registers a job, evicting the oldest finished jobs if too many are
+// retained.
+func (in *ingester) add(job *ingestionJob) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.jobs[job.status.ID] = job
+	in.order = append(in.order, job.status.ID)
+	for i := 0; len(in.order) > maximumIngestionJobs && i < len(in.order); {
+		switch in.jobs[in.order[i]].status.Status {
+		case IngestionCompleted, IngestionFailed, IngestionCancelled:
+			delete(in.jobs, in.order[i])
+			in.order = slices.Delete(in.order, i, i+1)
+		default:
+			i++
+		}
+	}
+}
+
+// get returns a snapshot of a store's job.
+func (in *ingester) get(storeID, jobID string) (IngestionJob, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	job, ok := in.jobs[jobID]
+	if !ok || job.status.VectorStoreID != storeID {
+		return IngestionJob{}, false
+	}
+	return job.snapshot(), true
+}
+
+// list returns snapshots of a store's jobs, newest first.
+func (in *ingester) list(storeID string) []IngestionJob {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	jobs := []IngestionJob{}
+	for i := len(in.order) - 1; i >= 0; i-- {
+		if job := in.jobs[in.order[i]]; job.status.VectorStoreID == storeID {
+			jobs = append(jobs, job.snapshot())
+		}
+	}
+	return jobs
+}
+
+// cancel cancels a store's job, returning its snapshot.
+func (in *ingester) cancel(storeID, jobID string) (IngestionJob, bool) {
+	in.mu.Lock()
+	job, ok := in.jobs[jobID]
+	in.mu.Unlock()
+	if !ok || job.status.VectorStoreID != storeID {
+		return IngestionJob{}, false
+	}
+	job.cancel()
+	return in.get(storeID, jobID)
+}
+
+// update modifies a job's status under the ingester's lock.
+func (in *ingester) update(job *ingestionJob, update func(*IngestionJob)) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	update(&job.status)
+}
+
+// snapshot returns a copy of the job's status. The caller must hold the
+// ingester's lock.
+func (j *ingestionJob) snapshot() IngestionJob {
+	status := j.status
+	status.Files = slices.Clone(j.status.Files)
+	return status
+}
+
+// ingestionFileKind determines the kind of an uploaded file from its name and
+// content type.
+func ingestionFileKind(filename, contentType string) (string, bool) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pdf":
+		return "pdf", true
+	case ".md", ".markdown":
+		return "markdown", true
+	case ".txt", ".text":
+		return "text", true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/pdf":
+		return "pdf", true
+	case mediaType == "text/markdown":
+		return "markdown", true
+	case strings.HasPrefix(mediaType, "text/"):
+		return "text", true
+	}
+	return "", false
+}
+
+// extractText extracts the text of an uploaded file.
+func extractText(file ingestionFileData) (string, error) {
+	if file.kind == "pdf" {
+		return extractPDFText(file.data)
+	}
+	if !utf8.Valid(file.data) {
+		return "", fmt.Errorf("file isn't valid UTF-8 text")
+	}
+	return string(file.data), nil
+}
+
+func (h *Handler) handleIngest(w http.ResponseWriter, r *http.Request) {
+	store, err := h.manager.Get(r.PathValue("store"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maximumIngestionSize)
+	if err := r.ParseMultipartForm(maximumIngestionSize); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, "request too large", http.StatusBadRequest)
+		} else {
+			http.Error(w, "request must be a multipart form with files in file fields", http.StatusBadRequest)
+		}
+		return
+	}
+
+	strategy := ChunkingStrategy{}
+	if value := r.FormValue("chunking_strategy"); value != "" {
+		if err := json.Unmarshal([]byte(value), &strategy); err != nil {
+			http.Error(w, "invalid chunking_strategy", http.StatusBadRequest)
+			return
+		}
+	}
+	if strategy, err = strategy.withDefaults(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		http.Error(w, "at least one file is required", http.StatusBadRequest)
+		return
+	}
+	if len(headers) > maximumIngestionFiles {
+		http.Error(w, fmt.Sprintf("at most %d files can be ingested per request", maximumIngestionFiles), http.StatusBadRequest)
+		return
+	}
+	files := make([]ingestionFileData, 0, len(headers))
+	for _, header := range headers {
+		kind, ok := ingestionFileKind(header.Filename, header.Header.Get("Content-Type"))
+		if !ok {
+			http.Error(w, fmt.Sprintf("unsupported file type for %q (must be PDF, markdown, or text)", header.Filename), http.StatusBadRequest)
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			http.Error(w, "failed to read uploaded file", http.StatusInternalServerError)
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			http.Error(w, "failed to read uploaded file", http.StatusInternalServerError)
+			return
+		}
+		files = append(files, ingestionFileData{name: filepath.Base(header.Filename), kind: kind, data: data})
+	}
+
+	// The job outlives the request, so it has its own context.
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &ingestionJob{
+		status: IngestionJob{
+			ID:               utils.NewID("ingest_"),
+			Object:           "vector_store.ingestion_job",
+			VectorStoreID:    store.ID,
+			Status:           IngestionQueued,
+			ChunkingStrategy: strategy,
+			CreatedAt:        time.Now().Unix(),
+		},
+		cancel: cancel,
+	}
+	for _, file := range files {
+		job.status.Files = append(job.status.Files, IngestionFile{Filename: file.name, Status: "pending"})
+	}
+	h.ingester.add(job)
+
+	// Embeddings requests are issued on behalf of a copy of this request.
+	template := r.Clone(ctx)
+	template.MultipartForm, template.Form, template.PostForm = nil, nil, nil
+	go h.runIngestion(ctx, template, store, job, files)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	snapshot, _ := h.ingester.get(store.ID, job.status.ID)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// runIngestion extracts, chunks, embeds, and stores the files of a job.
+func (h *Handler) runIngestion(ctx context.Context, r *http.Request, store VectorStore, job *ingestionJob, files []ingestionFileData) {
+	defer job.cancel()
+	h.ingester.update(job, func(status *IngestionJob) {
+		status.Status = IngestionInProgress
+	})
+
+	// Chunk all files up front so that the total amount of work is known.
+	type fileChunks struct {
+		index     int
+		documents []Document
+	}
+	var pending []fileChunks
+	total := 0
+	for i, file := range files {
+		text, err := extractText(file)
+		var chunks []string
+		if err == nil {
+			chunks = job.status.ChunkingStrategy.chunk(text, file.kind == "markdown")
+			if len(chunks) == 0 {
+				err = fmt.Errorf("file contains no text")
+			}
+		}
+		if err != nil {
+			h.ingester.update(job, func(status *IngestionJob) {
+				status.Files[i].Status, status.Files[i].Error = "failed", err.Error()
+			})
+			continue
+		}
+		documents := make([]Document, len(chunks))
+		for c, chunk := range chunks {
+			documents[c] = Document{
+				ID:   file.name + ":" + strconv.Itoa(c),
+				Text: chunk,
+				Metadata: map[string]any{
+					"source":        file.name,
+					"chunk":         c,
+					"ingestion_job": job.status.ID,
+				},
+			}
+		}
+		pending = append(pending, fileChunks{index: i, documents: documents})
+		total += len(chunks)
+		h.ingester.update(job, func(status *IngestionJob) {
+			status.Files[i].Chunks = len(chunks)
+			status.TotalChunks = total
+		})
+	}
+
+	finish := func(status string, err error) {
+		h.ingester.update(job, func(job *IngestionJob) {
+			job.Status = status
+			if err != nil {
+				job.Error = err.Error()
+			}
+			job.CompletedAt = time.Now().Unix()
+		})
+	}
+
+	for _, file := range pending {
+		for start := 0; start < len(file.documents); start += ingestionBatchSize {
+			batch := file.documents[start:min(start+ingestionBatchSize, len(file.documents))]
+			texts := make([]string, len(batch))
+			for i, document := range batch {
+				texts[i] = document.Text
+			}
+			embeddings, err := h.embed(ctx, r, store, texts)
+			if err == nil {
+				_, err = h.manager.AddDocuments(store.ID, batch, embeddings)
+			}
+			if ctx.Err() != nil {
+				finish(IngestionCancelled, nil)
+				return
+			} else if err != nil {
+				h.log.Warnf("Ingestion job %s failed: %v", job.status.ID, err)
+				finish(IngestionFailed, err)
+				return
+			}
+			h.ingester.update(job, func(status *IngestionJob) {
+				status.EmbeddedChunks += len(batch)
+			})
+		}
+
+		// Remove chunks left over from previous ingestions of the file.
+		name := files[file.index].name
+		current := make(map[string]bool, len(file.documents))
+		for _, document := range file.documents {
+			current[document.ID] = true
+		}
+		if _, err := h.manager.deleteDocuments(store.ID, func(document Document) bool {
+			return document.Metadata["source"] == name && !current[document.ID]
+		}); err != nil {
+			finish(IngestionFailed, err)
+			return
+		}
+		h.ingester.update(job, func(status *IngestionJob) {
+			status.Files[file.index].Status = "completed"
+		})
+	}
+	finish(IngestionCompleted, nil)
+}
+
+func (h *Handler) handleListIngestions(w http.ResponseWriter, r *http.Request) {
+	store, err := h.manager.Get(r.PathValue("store"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, listResponse[IngestionJob]{Object: "list", Data: h.ingester.list(store.ID)})
+}
+
+func (h *Handler) handleGetIngestion(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.ingester.get(r.PathValue("store"), r.PathValue("job"))
+	if !ok {
+		http.Error(w, ErrIngestionJobNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	h.writeJSON(w, job)
+}
+
+func (h *Handler) handleCancelIngestion(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.ingester.cancel(r.PathValue("store"), r.PathValue("job"))
+	if !ok {
+		http.Error(w, ErrIngestionJobNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	h.writeJSON(w, job)
+}
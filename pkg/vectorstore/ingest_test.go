@@ -0,0 +1,159 @@
+package vectorstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/model-runner/pkg/inference"
+)
+
+// ingest uploads files to a store's ingestion endpoint.
+func ingest(t *testing.T, handler http.Handler, storeID string, strategy string, files map[string]string) (int, IngestionJob) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if strategy != "" {
+		writer.WriteField("chunking_strategy", strategy)
+	}
+	for name, content := range files {
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte(content))
+	}
+	writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, inference.InferencePrefix+APIPath+"/"+storeID+"/ingestions", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	var job IngestionJob
+	if recorder.Code == http.StatusAccepted {
+		json.Unmarshal(recorder.Body.Bytes(), &job)
+	}
+	return recorder.Code, job
+}
+
+// waitForIngestion polls a job until it finishes.
+func waitForIngestion(t *testing.T, handler http.Handler, storeID, jobID string) IngestionJob {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var job IngestionJob
+		if code := serve(t, handler, http.MethodGet, "/"+storeID+"/ingestions/"+jobID, "", &job); code != http.StatusOK {
+			t.Fatalf("Failed to get job status: %d", code)
+		}
+		if job.Status != IngestionQueued && job.Status != IngestionInProgress {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for ingestion job")
+	return IngestionJob{}
+}
+
+func TestIngestion(t *testing.T) {
+	handler := newTestHandler(t, t.TempDir(), &letterEmbedder{})
+	var store VectorStore
+	serve(t, handler, http.MethodPost, "", `{"model":"embedder"}`, &store)
+
+	paragraph := strings.Repeat("zebras roam the savanna. ", 6)
+	code, job := ingest(t, handler, store.ID, `{"type":"paragraph","max_chunk_size":200,"chunk_overlap":0}`, map[string]string{
+		"animals.txt": paragraph + "\n\n" + paragraph + "\n\n" + paragraph,
+		"guide.md":    "# Apples\n\nApples are a fruit.\n\n# Pears\n\nPears are too.",
+		"report.pdf":  string(buildPDF("BT (Quarterly sales report) Tj ET", true)),
+		"empty.txt":   " \n ",
+	})
+	if code != http.StatusAccepted || !strings.HasPrefix(job.ID, "ingest_") || len(job.Files) != 4 {
+		t.Fatalf("Expected ingestion job to be accepted, got status %d and %+v", code, job)
+	}
+
+	job = waitForIngestion(t, handler, store.ID, job.ID)
+	if job.Status != IngestionCompleted || job.TotalChunks != 5 || job.EmbeddedChunks != 5 || job.CompletedAt == 0 {
+		t.Fatalf("Expected job to complete with 5 chunks, got %+v", job)
+	}
+	statuses := map[string]IngestionFile{}
+	for _, file := range job.Files {
+		statuses[file.Filename] = file
+	}
+	if file := statuses["animals.txt"]; file.Status != "completed" || file.Chunks != 3 {
+		t.Errorf("Unexpected status for animals.txt: %+v", file)
+	}
+	// The paragraph strategy doesn't split markdown at headings.
+	if file := statuses["guide.md"]; file.Status != "completed" || file.Chunks != 1 {
+		t.Errorf("Unexpected status for guide.md: %+v", file)
+	}
+	if file := statuses["empty.txt"]; file.Status != "failed" || file.Error == "" {
+		t.Errorf("Expected empty.txt to fail, got %+v", file)
+	}
+
+	var results SearchResponse
+	serve(t, handler, http.MethodPost, "/"+store.ID+"/search", `{"query":"quarterly report","max_num_results":1}`, &results)
+	if len(results.Data) != 1 || results.Data[0].DocumentID != "report.pdf:0" || results.Data[0].Metadata["source"] != "report.pdf" {
+		t.Errorf("Expected PDF chunk to match, got %+v", results.Data)
+	}
+
+	// Reingesting a file replaces its chunks.
+	_, job = ingest(t, handler, store.ID, "", map[string]string{"animals.txt": "Just one zebra."})
+	if job = waitForIngestion(t, handler, store.ID, job.ID); job.Status != IngestionCompleted {
+		t.Fatalf("Expected reingestion to complete, got %+v", job)
+	}
+	var documents listResponse[Document]
+	serve(t, handler, http.MethodGet, "/"+store.ID+"/documents", "", &documents)
+	if len(documents.Data) != 3 {
+		t.Errorf("Expected 3 documents after reingestion, got %d", len(documents.Data))
+	}
+
+	var jobs listResponse[IngestionJob]
+	if serve(t, handler, http.MethodGet, "/"+store.ID+"/ingestions", "", &jobs); len(jobs.Data) != 2 || jobs.Data[0].ID != job.ID {
+		t.Errorf("Expected 2 jobs, newest first, got %+v", jobs.Data)
+	}
+
+	// Invalid requests are rejected.
+	if code, _ := ingest(t, handler, store.ID, "", map[string]string{"image.png": "\x89PNG"}); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unsupported file, got %d", http.StatusBadRequest, code)
+	}
+	if code, _ := ingest(t, handler, store.ID, `{"type":"semantic"}`, map[string]string{"a.txt": "a"}); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unknown strategy, got %d", http.StatusBadRequest, code)
+	}
+	if code, _ := ingest(t, handler, store.ID, "", nil); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without files, got %d", http.StatusBadRequest, code)
+	}
+	if code, _ := ingest(t, handler, "vs_missing", "", map[string]string{"a.txt": "a"}); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for missing store, got %d", http.StatusNotFound, code)
+	}
+}
+
+// blockingEmbedder blocks embeddings requests until they're cancelled.
+type blockingEmbedder struct {
+	started chan struct{}
+}
+
+func (e *blockingEmbedder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	close(e.started)
+	<-r.Context().Done()
+	http.Error(w, "cancelled", http.StatusServiceUnavailable)
+}
+
+func TestIngestionCancellation(t *testing.T) {
+	embedder := &blockingEmbedder{started: make(chan struct{})}
+	handler := newTestHandler(t, t.TempDir(), embedder)
+	var store VectorStore
+	serve(t, handler, http.MethodPost, "", `{"model":"embedder"}`, &store)
+
+	_, job := ingest(t, handler, store.ID, "", map[string]string{"a.txt": "some text"})
+	<-embedder.started
+	if code := serve(t, handler, http.MethodDelete, "/"+store.ID+"/ingestions/"+job.ID, "", nil); code != http.StatusOK {
+		t.Fatalf("Expected job to be cancelled, got status %d", code)
+	}
+	if job = waitForIngestion(t, handler, store.ID, job.ID); job.Status != IngestionCancelled || job.EmbeddedChunks != 0 {
+		t.Errorf("Expected cancelled job, got %+v", job)
+	}
+	if code := serve(t, handler, http.MethodGet, "/"+store.ID+"/ingestions/ingest_missing", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for missing job, got %d", http.StatusNotFound, code)
+	}
+}
@@ -0,0 +1,369 @@
+package vectorstore
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// maximumPDFStreamSize is the maximum decompressed size of a PDF stream,
+// which guards against decompression bombs.
+const maximumPDFStreamSize = 64 * 1024 * 1024
+
+// errNoPDFText indicates that no text could be extracted from a PDF.
+var errNoPDFText = errors.New("no extractable text found (scanned PDFs and PDFs with embedded character maps are unsupported)")
+
+var (
+	// pdfStreamKeyword matches the keyword that starts a stream's data.
+	pdfStreamKeyword = regexp.MustCompile(`>>\s*stream\r?\n`)
+	// pdfSkippedStream matches the dictionaries of streams that never hold
+	// page content.
+	pdfSkippedStream = regexp.MustCompile(`/(Subtype\s*/Image|Type\s*/(XRef|ObjStm|Metadata|EmbeddedFile)|Length[123]\b)`)
+)
+
+// extractPDFText extracts the text of a PDF by interpreting the text
+// operators of its (uncompressed or Flate-compressed) content streams. It
+// handles the common case of PDFs produced from text documents, but it
+// doesn't interpret fonts' character maps or the page tree, so text is
+// returned in the order in which content streams appear in the file.
+func extractPDFText(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", fmt.Errorf("not a PDF file")
+	}
+
+	var text strings.Builder
+	for _, match := range pdfStreamKeyword.FindAllIndex(data, -1) {
+		dictionary := pdfStreamDictionary(data, match[0]+2)
+		if pdfSkippedStream.Match(dictionary) {
+			continue
+		}
+		start := match[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+		stream := data[start : start+end]
+
+		if bytes.Contains(dictionary, []byte("/FlateDecode")) {
+			reader, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			decoded, err := io.ReadAll(io.LimitReader(reader, maximumPDFStreamSize))
+			reader.Close()
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				continue
+			}
+			stream = decoded
+		} else if bytes.Contains(dictionary, []byte("/Filter")) {
+			// Other filters are only used for images and fonts in practice.
+			continue
+		}
+		extractPDFContentText(stream, &text)
+	}
+
+	extracted := normalizePDFText(text.String())
+	if extracted == "" {
+		return "", errNoPDFText
+	}
+	return extracted, nil
+}
+
+// pdfStreamDictionary returns the dictionary of a stream, given the offset
+// just past the dictionary's closing delimiter.
+func pdfStreamDictionary(data []byte, end int) []byte {
+	depth := 0
+	for i := end - 1; i > 0; i-- {
+		switch {
+		case data[i] == '>' && data[i-1] == '>':
+			depth++
+			i--
+		case data[i] == '<' && data[i-1] == '<':
+			depth--
+			i--
+			if depth == 0 {
+				return data[i:end]
+			}
+		}
+	}
+	return nil
+}
+
+// pdfOperand is an operand in a content stream.
+type pdfOperand struct {
+	// text is set for string operands.
+	text string
+	// number is set for numeric operands.
+	number float64
+	// isText indicates whether the operand is a string.
+	isText bool
+	// array holds the elements of array operands.
+	array []pdfOperand
+}
+
+// extractPDFContentText appends the text shown by a content stream's text
+// operators to text, using text positioning operators to infer line breaks
+// and spaces.
+func extractPDFContentText(content []byte, text *strings.Builder) {
+	var operands []pdfOperand
+	var array []pdfOperand
+	inArray := false
+	push := func(operand pdfOperand) {
+		if inArray {
+			array = append(array, operand)
+		} else {
+			operands = append(operands, operand)
+		}
+	}
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case isPDFWhitespace(c):
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			var s string
+			s, i = parsePDFLiteralString(content, i)
+			push(pdfOperand{text: s, isText: true})
+		case c == '<' && i+1 < len(content) && content[i+1] == '<':
+			i += 2
+		case c == '>' && i+1 < len(content) && content[i+1] == '>':
+			i += 2
+		case c == '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return
+			}
+			push(pdfOperand{text: decodePDFHexString(content[i+1 : i+end]), isText: true})
+			i += end + 1
+		case c == '[':
+			inArray, array = true, nil
+			i++
+		case c == ']':
+			inArray = false
+			operands = append(operands, pdfOperand{array: array})
+			i++
+		case c == '/':
+			// Names are only used for resources, which don't affect text.
+			i++
+			for i < len(content) && !isPDFWhitespace(content[i]) && !isPDFDelimiter(content[i]) {
+				i++
+			}
+		default:
+			start := i
+			for i < len(content) && !isPDFWhitespace(content[i]) && !isPDFDelimiter(content[i]) {
+				i++
+			}
+			if i == start {
+				// Skip unexpected delimiters.
+				i++
+				continue
+			}
+			token := string(content[start:i])
+			if number, err := strconv.ParseFloat(token, 64); err == nil {
+				push(pdfOperand{number: number})
+				continue
+			}
+			if token == "BI" {
+				// Skip inline image data.
+				end := bytes.Index(content[i:], []byte("EI"))
+				if end < 0 {
+					return
+				}
+				i += end + 2
+			}
+			applyPDFTextOperator(token, operands, text)
+			operands = operands[:0]
+		}
+	}
+}
+
+// applyPDFTextOperator appends the text produced by a content stream operator
+// to text.
+func applyPDFTextOperator(operator string, operands []pdfOperand, text *strings.Builder) {
+	lastText := func() string {
+		for i := len(operands) - 1; i >= 0; i-- {
+			if operands[i].isText {
+				return operands[i].text
+			}
+		}
+		return ""
+	}
+
+	// Text objects and lines start on new lines, without introducing blank
+	// lines, because layout doesn't reliably indicate paragraphs.
+	newline := func() {
+		if s := text.String(); s != "" && s[len(s)-1] != '\n' {
+			text.WriteByte('\n')
+		}
+	}
+
+	switch operator {
+	case "Tj":
+		text.WriteString(lastText())
+	case "'", "\"":
+		newline()
+		text.WriteString(lastText())
+	case "TJ":
+		if len(operands) == 0 {
+			return
+		}
+		for _, element := range operands[len(operands)-1].array {
+			if element.isText {
+				text.WriteString(element.text)
+			} else if element.number < -200 {
+				// Large negative adjustments move the next glyph right by
+				// (roughly) the width of a space.
+				text.WriteByte(' ')
+			}
+		}
+	case "Td", "TD":
+		if len(operands) >= 2 && operands[len(operands)-1].number != 0 {
+			newline()
+		} else {
+			text.WriteByte(' ')
+		}
+	case "T*", "ET":
+		newline()
+	}
+}
+
+// parsePDFLiteralString parses the literal string starting at offset start,
+// returning it and the offset after it.
+func parsePDFLiteralString(content []byte, start int) (string, int) {
+	var s []byte
+	depth := 0
+	i := start
+	for i < len(content) {
+		c := content[i]
+		i++
+		switch c {
+		case '(':
+			if depth > 0 {
+				s = append(s, c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return decodePDFString(s), i
+			}
+			s = append(s, c)
+		case '\\':
+			if i >= len(content) {
+				break
+			}
+			escaped := content[i]
+			i++
+			switch escaped {
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'b', 'f':
+			case '\r':
+				// Line continuation.
+				if i < len(content) && content[i] == '\n' {
+					i++
+				}
+			case '\n':
+				// Line continuation.
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					value := int(escaped - '0')
+					for j := 0; j < 2 && i < len(content) && content[i] >= '0' && content[i] <= '7'; j++ {
+						value = value*8 + int(content[i]-'0')
+						i++
+					}
+					s = append(s, byte(value))
+				} else {
+					s = append(s, escaped)
+				}
+			}
+		default:
+			s = append(s, c)
+		}
+	}
+	return decodePDFString(s), i
+}
+
+// decodePDFHexString decodes the contents of a hexadecimal string.
+func decodePDFHexString(hex []byte) string {
+	var digits []byte
+	for _, c := range hex {
+		if unicode.Is(unicode.ASCII_Hex_Digit, rune(c)) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	s := make([]byte, len(digits)/2)
+	for i := range s {
+		value, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		s[i] = byte(value)
+	}
+	return decodePDFString(s)
+}
+
+// decodePDFString decodes a string's bytes, which are either UTF-16BE with a
+// byte order mark or (approximately) Latin-1. Control characters are
+// dropped, as they usually indicate glyph IDs rather than text.
+func decodePDFString(s []byte) string {
+	var runes []rune
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		runes = utf16.Decode(units)
+	} else {
+		runes = make([]rune, len(s))
+		for i, b := range s {
+			runes[i] = rune(b)
+		}
+	}
+
+	var decoded strings.Builder
+	for _, r := range runes {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			decoded.WriteRune(r)
+		}
+	}
+	return decoded.String()
+}
+
+// normalizePDFText collapses the whitespace of extracted text, keeping line
+// breaks.
+func normalizePDFText(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isPDFWhitespace returns whether c is a PDF whitespace character.
+func isPDFWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+// isPDFDelimiter returns whether c is a PDF delimiter character.
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
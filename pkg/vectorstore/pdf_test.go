@@ -0,0 +1,58 @@
+package vectorstore
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+)
+
+// buildPDF builds a minimal PDF with a single page showing content, which is
+// compressed if compress is set.
+func buildPDF(content string, compress bool) []byte {
+	stream := []byte(content)
+	filter := ""
+	if compress {
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		writer.Write(stream)
+		writer.Close()
+		stream = compressed.Bytes()
+		filter = " /Filter /FlateDecode"
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	pdf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	pdf.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+	pdf.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>\nendobj\n")
+	fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d%s >>\nstream\n", len(stream), filter)
+	pdf.Write(stream)
+	pdf.WriteString("\nendstream\nendobj\n")
+	pdf.WriteString("5 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>\nendobj\n")
+	pdf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	content := `BT /F1 12 Tf 72 720 Td (Hello, \(PDF\) world!) Tj 0 -14 Td [(Kerned)-300(text) 20 (s)] TJ ET
+BT 72 600 Td <FEFF00430061006600E9> Tj T* (caf\351 \101) Tj ET`
+	want := "Hello, (PDF) world!\nKerned texts\nCafé\ncafé A"
+
+	for _, compress := range []bool{false, true} {
+		text, err := extractPDFText(buildPDF(content, compress))
+		if err != nil {
+			t.Fatalf("extractPDFText failed (compressed: %t): %v", compress, err)
+		}
+		if text != want {
+			t.Errorf("Expected %q, got %q (compressed: %t)", want, text, compress)
+		}
+	}
+
+	if _, err := extractPDFText(buildPDF("0 0 m 100 100 l S", true)); err != errNoPDFText {
+		t.Errorf("Expected errNoPDFText for PDF without text, got %v", err)
+	}
+	if _, err := extractPDFText([]byte("plain text")); err == nil {
+		t.Error("Expected error for non-PDF data")
+	}
+}
@@ -0,0 +1,486 @@
+// Package vectorstore implements a lightweight vector store that embeds
+// documents using the model runner's embedding models and indexes them on disk
+// for local similarity search.
+package vectorstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/model-runner/pkg/internal/utils"
+	"github.com/docker/model-runner/pkg/logging"
+)
+
+var (
+	// ErrStoreNotFound indicates that a vector store doesn't exist. If
+	// returned in conjunction with an HTTP request, it should be paired with a
+	// 404 response status.
+	ErrStoreNotFound = errors.New("vector store not found")
+	// ErrDocumentNotFound indicates that a document doesn't exist in a vector
+	// store. If returned in conjunction with an HTTP request, it should be
+	// paired with a 404 response status.
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrIngestionJobNotFound indicates that an ingestion job doesn't exist
+	// (or is no longer retained). If returned in conjunction with an HTTP
+	// request, it should be paired with a 404 response status.
+	ErrIngestionJobNotFound = errors.New("ingestion job not found")
+)
+
+const (
+	// metadataFileName is the name of the file that holds a store's
+	// description and documents.
+	metadataFileName = "store.json"
+	// indexFileName is the name of the file that holds a store's index.
+	indexFileName = "index.gob"
+)
+
+// VectorStore describes a vector store.
+type VectorStore struct {
+	// ID is the store's identifier.
+	ID string `json:"id"`
+	// Object is always "vector_store".
+	Object string `json:"object"`
+	// Name is the store's optional name.
+	Name string `json:"name,omitempty"`
+	// Model is the embedding model used to embed documents and queries.
+	Model string `json:"model"`
+	// Dimensions is the number of dimensions requested from the embedding
+	// model, or 0 if the model's full embeddings are used.
+	Dimensions int `json:"dimensions,omitempty"`
+	// CreatedAt is the store's creation time as a Unix timestamp.
+	CreatedAt int64 `json:"created_at"`
+	// DocumentCount is the number of documents in the store.
+	DocumentCount int `json:"document_count"`
+}
+
+// Document is a document in a vector store.
+type Document struct {
+	// ID is the document's identifier, which is unique within its store.
+	ID string `json:"id"`
+	// Object is always "vector_store.document".
+	Object string `json:"object"`
+	// Text is the document's text, which is embedded for search.
+	Text string `json:"text"`
+	// Metadata is arbitrary metadata returned alongside search results.
+	Metadata map[string]any `json:"metadata,omitempty"`
+	// CreatedAt is the time at which the document was added as a Unix
+	// timestamp.
+	CreatedAt int64 `json:"created_at"`
+}
+
+// SearchResult is a document matched by a search.
+type SearchResult struct {
+	// DocumentID is the matched document's identifier.
+	DocumentID string `json:"document_id"`
+	// Score is the cosine similarity between the document and the query.
+	Score float32 `json:"score"`
+	// Text is the document's text.
+	Text string `json:"text"`
+	// Metadata is the document's metadata.
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// storeMetadata is the persisted form of a store, excluding its index.
+type storeMetadata struct {
+	// Store describes the store.
+	Store VectorStore `json:"store"`
+	// Documents are the store's documents.
+	Documents []Document `json:"documents"`
+}
+
+// store is a vector store.
+type store struct {
+	// mu guards the store's state.
+	mu sync.RWMutex
+	// dir is the directory holding the store's files.
+	dir string
+	// info describes the store.
+	info VectorStore
+	// documents maps document IDs to documents.
+	documents map[string]Document
+	// index indexes the documents' embeddings.
+	index *hnswIndex
+	// removed indicates that the store has been deleted.
+	removed bool
+}
+
+// describe returns the store's description. The caller must hold the store's
+// lock.
+func (s *store) describe() VectorStore {
+	info := s.info
+	info.DocumentCount = len(s.documents)
+	return info
+}
+
+// save persists the store. The caller must hold the store's write lock.
+func (s *store) save() error {
+	metadata := storeMetadata{Store: s.info, Documents: make([]Document, 0, len(s.documents))}
+	for _, document := range s.documents {
+		metadata.Documents = append(metadata.Documents, document)
+	}
+	slices.SortFunc(metadata.Documents, func(a, b Document) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	encodedMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("unable to encode store: %w", err)
+	}
+	var encodedIndex bytes.Buffer
+	if err := s.index.encode(&encodedIndex); err != nil {
+		return fmt.Errorf("unable to encode index: %w", err)
+	}
+
+	// Write the index first so that the documents never refer to vectors that
+	// haven't been persisted.
+	if err := utils.WriteFileAtomically(filepath.Join(s.dir, indexFileName), encodedIndex.Bytes()); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomically(filepath.Join(s.dir, metadataFileName), encodedMetadata)
+}
+
+// loadStore loads a store from a directory.
+func loadStore(dir string) (*store, error) {
+	encodedMetadata, err := os.ReadFile(filepath.Join(dir, metadataFileName))
+	if err != nil {
+		return nil, err
+	}
+	var metadata storeMetadata
+	if err := json.Unmarshal(encodedMetadata, &metadata); err != nil {
+		return nil, fmt.Errorf("unable to decode store: %w", err)
+	}
+	indexFile, err := os.Open(filepath.Join(dir, indexFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer indexFile.Close()
+	index, err := decodeHNSWIndex(indexFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode index: %w", err)
+	}
+
+	s := &store{
+		dir:       dir,
+		info:      metadata.Store,
+		documents: make(map[string]Document, len(metadata.Documents)),
+		index:     index,
+	}
+	for _, document := range metadata.Documents {
+		s.documents[document.ID] = document
+	}
+	// Reconcile the index with the documents in case a save was interrupted
+	// between writing the index and writing the documents.
+	for _, node := range index.Nodes {
+		if _, ok := s.documents[node.ID]; !ok {
+			index.Delete(node.ID)
+		}
+	}
+	for id := range s.documents {
+		if _, ok := index.ids[id]; !ok {
+			delete(s.documents, id)
+		}
+	}
+	return s, nil
+}
+
+// Manager manages the vector stores persisted in a directory.
+type Manager struct {
+	// root is the directory holding the stores, one per subdirectory.
+	root string
+	// mu guards stores.
+	mu sync.RWMutex
+	// stores maps store IDs to stores.
+	stores map[string]*store
+}
+
+// NewManager creates a manager for the vector stores in the specified
+// directory, creating it if necessary. Stores that can't be loaded are logged
+// and skipped.
+func NewManager(log logging.Logger, root string) (*Manager, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create vector store directory: %w", err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vector store directory: %w", err)
+	}
+
+	m := &Manager{root: root, stores: make(map[string]*store)}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		s, err := loadStore(filepath.Join(root, entry.Name()))
+		if err != nil {
+			log.Warnf("Skipping vector store %s: %v", entry.Name(), err)
+			continue
+		}
+		m.stores[s.info.ID] = s
+	}
+	return m, nil
+}
+
+// get returns the store with the specified ID.
+func (m *Manager) get(id string) (*store, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.stores[id]
+	if !ok {
+		return nil, ErrStoreNotFound
+	}
+	return s, nil
+}
+
+// Create creates an empty vector store whose documents are embedded with the
+// specified model.
+func (m *Manager) Create(name, model string, dimensions int) (VectorStore, error) {
+	id := utils.NewID("vs_")
+	s := &store{
+		dir: filepath.Join(m.root, id),
+		info: VectorStore{
+			ID:         id,
+			Object:     "vector_store",
+			Name:       name,
+			Model:      model,
+			Dimensions: dimensions,
+			CreatedAt:  time.Now().Unix(),
+		},
+		documents: make(map[string]Document),
+		index:     newHNSWIndex(),
+	}
+	if err := os.Mkdir(s.dir, 0o755); err != nil {
+		return VectorStore{}, fmt.Errorf("unable to create vector store directory: %w", err)
+	}
+	if err := s.save(); err != nil {
+		os.RemoveAll(s.dir)
+		return VectorStore{}, err
+	}
+
+	m.mu.Lock()
+	m.stores[id] = s
+	m.mu.Unlock()
+	return s.describe(), nil
+}
+
+// List returns descriptions of all vector stores, newest first.
+func (m *Manager) List() []VectorStore {
+	m.mu.RLock()
+	stores := make([]*store, 0, len(m.stores))
+	for _, s := range m.stores {
+		stores = append(stores, s)
+	}
+	m.mu.RUnlock()
+
+	infos := make([]VectorStore, 0, len(stores))
+	for _, s := range stores {
+		s.mu.RLock()
+		infos = append(infos, s.describe())
+		s.mu.RUnlock()
+	}
+	slices.SortFunc(infos, func(a, b VectorStore) int {
+		if a.CreatedAt != b.CreatedAt {
+			return int(b.CreatedAt - a.CreatedAt)
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return infos
+}
+
+// Get returns the description of a vector store.
+func (m *Manager) Get(id string) (VectorStore, error) {
+	s, err := m.get(id)
+	if err != nil {
+		return VectorStore{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.describe(), nil
+}
+
+// Delete deletes a vector store and its files.
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
+	s, ok := m.stores[id]
+	if !ok {
+		m.mu.Unlock()
+		return ErrStoreNotFound
+	}
+	delete(m.stores, id)
+	m.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removed = true
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("unable to remove vector store files: %w", err)
+	}
+	return nil
+}
+
+// AddDocuments adds documents with their embeddings to a vector store,
+// replacing any existing documents with the same IDs. Documents without IDs
+// are assigned them. The added documents are returned.
+func (m *Manager) AddDocuments(id string, documents []Document, embeddings [][]float32) ([]Document, error) {
+	if len(documents) != len(embeddings) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(documents), len(embeddings))
+	}
+	s, err := m.get(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removed {
+		return nil, ErrStoreNotFound
+	}
+
+	// Validate all embeddings up front so that batches are added atomically.
+	dimensions := s.index.Dimensions
+	for i, embedding := range embeddings {
+		if dimensions == 0 {
+			dimensions = len(embedding)
+		}
+		if len(embedding) != dimensions {
+			return nil, fmt.Errorf("embedding %d has %d dimensions, expected %d", i, len(embedding), dimensions)
+		}
+		if _, err := normalize(embedding); err != nil {
+			return nil, fmt.Errorf("invalid embedding %d: %w", i, err)
+		}
+	}
+
+	now := time.Now().Unix()
+	added := make([]Document, len(documents))
+	for i, document := range documents {
+		if document.ID == "" {
+			document.ID = utils.NewID("doc_")
+		}
+		document.Object = "vector_store.document"
+		document.CreatedAt = now
+		if err := s.index.Add(document.ID, embeddings[i]); err != nil {
+			return nil, fmt.Errorf("unable to index document %q: %w", document.ID, err)
+		}
+		s.documents[document.ID] = document
+		added[i] = document
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// Documents returns the documents in a vector store, ordered by ID.
+func (m *Manager) Documents(id string) ([]Document, error) {
+	s, err := m.get(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	documents := make([]Document, 0, len(s.documents))
+	for _, document := range s.documents {
+		documents = append(documents, document)
+	}
+	slices.SortFunc(documents, func(a, b Document) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return documents, nil
+}
+
+// Document returns a document in a vector store.
+func (m *Manager) Document(id, documentID string) (Document, error) {
+	s, err := m.get(id)
+	if err != nil {
+		return Document{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	document, ok := s.documents[documentID]
+	if !ok {
+		return Document{}, ErrDocumentNotFound
+	}
+	return document, nil
+}
+
+// DeleteDocument deletes a document from a vector store.
+func (m *Manager) DeleteDocument(id, documentID string) error {
+	s, err := m.get(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removed {
+		return ErrStoreNotFound
+	}
+	if _, ok := s.documents[documentID]; !ok {
+		return ErrDocumentNotFound
+	}
+	delete(s.documents, documentID)
+	s.index.Delete(documentID)
+	if s.index.NeedsCompaction() {
+		s.index.Compact()
+	}
+	return s.save()
+}
+
+// deleteDocuments deletes the documents in a vector store that match a
+// predicate, returning the number of documents deleted.
+func (m *Manager) deleteDocuments(id string, match func(Document) bool) (int, error) {
+	s, err := m.get(id)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removed {
+		return 0, ErrStoreNotFound
+	}
+	deleted := 0
+	for documentID, document := range s.documents {
+		if match(document) {
+			delete(s.documents, documentID)
+			s.index.Delete(documentID)
+			deleted++
+		}
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	if s.index.NeedsCompaction() {
+		s.index.Compact()
+	}
+	return deleted, s.save()
+}
+
+// Search returns the documents in a vector store that are most similar to a
+// query embedding, most similar first.
+func (m *Manager) Search(id string, query []float32, maxResults int) ([]SearchResult, error) {
+	s, err := m.get(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	matches, err := s.index.Search(query, maxResults)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SearchResult, 0, len(matches))
+	for _, match := range matches {
+		document := s.documents[match.ID]
+		results = append(results, SearchResult{
+			DocumentID: match.ID,
+			Score:      match.Score,
+			Text:       document.Text,
+			Metadata:   document.Metadata,
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,158 @@
+// Package version describes the model runner's build and API revision, so that
+// clients such as Docker Desktop and the CLI can negotiate compatibility and
+// gate features on the server they talk to.
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/docker/model-runner/pkg/inference"
+	"github.com/docker/model-runner/pkg/logging"
+	"github.com/docker/model-runner/pkg/middleware"
+)
+
+// Version is the model runner's version. It's set at build time with
+// -ldflags "-X github.com/docker/model-runner/pkg/version.Version=...".
+var Version = "dev"
+
+const (
+	// APIRevision is the revision of the model runner's API. It's incremented
+	// whenever the API changes in a way clients may need to gate on, since
+	// versions of builds that aren't released don't order meaningfully.
+	APIRevision = 1
+
+	// MinimumClientVersion is the oldest client version supported by the API.
+	MinimumClientVersion = "0.1.0"
+
+	// APIPath is the path of the version route, relative to the inference
+	// prefix.
+	APIPath = "/version"
+)
+
+const (
+	// ServerVersionHeader is the header reporting the server's version.
+	ServerVersionHeader = "X-Model-Runner-Version"
+	// APIRevisionHeader is the header reporting the API revision.
+	APIRevisionHeader = "X-Model-Runner-API-Revision"
+	// MinimumClientVersionHeader is the header reporting the oldest client
+	// version supported by the API.
+	MinimumClientVersionHeader = "X-Model-Runner-Min-Client-Version"
+)
+
+// Info describes the model runner's build.
+type Info struct {
+	// Version is the model runner's version.
+	Version string `json:"version"`
+	// APIRevision is the revision of the API.
+	APIRevision int `json:"api_revision"`
+	// MinimumClientVersion is the oldest client version supported by the API.
+	MinimumClientVersion string `json:"minimum_client_version"`
+	// Commit and BuildTime identify the source revision the model runner was
+	// built from, if known.
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	// Modified is whether the source tree had uncommitted changes.
+	Modified bool `json:"modified,omitempty"`
+	// GoVersion is the version of Go the model runner was built with.
+	GoVersion string `json:"go_version"`
+	// OS and Arch are the platform the model runner was built for.
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// Backends are the versions of the running backends, keyed by name.
+	Backends map[string]string `json:"backends,omitempty"`
+}
+
+// Build returns information about the running build, without backend
+// versions.
+func Build() Info {
+	info := Info{
+		Version:              Version,
+		APIRevision:          APIRevision,
+		MinimumClientVersion: MinimumClientVersion,
+		GoVersion:            runtime.Version(),
+		OS:                   runtime.GOOS,
+		Arch:                 runtime.GOARCH,
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.time":
+				info.BuildTime = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// BackendVersion extracts the version from the status of a running backend,
+// such as "running vllm version: 0.9.1". It returns an empty string if the
+// backend isn't running or its version is unknown.
+func BackendVersion(status string) string {
+	if !strings.HasPrefix(status, "running ") {
+		return ""
+	}
+	_, version, ok := strings.Cut(status, "version: ")
+	if !ok || version == "unknown" {
+		return ""
+	}
+	return strings.TrimSpace(version)
+}
+
+// Middleware adds the version negotiation headers to the responses of next.
+func Middleware(next http.Handler) http.Handler {
+	apiRevision := strconv.Itoa(APIRevision)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ServerVersionHeader, Version)
+		w.Header().Set(APIRevisionHeader, apiRevision)
+		w.Header().Set(MinimumClientVersionHeader, MinimumClientVersion)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Handler implements the version API.
+type Handler struct {
+	log         logging.Logger
+	router      *http.ServeMux
+	httpHandler http.Handler
+	backends    func() map[string]string
+}
+
+// NewHandler creates a new version API handler, which reports the backend
+// versions returned by backends, since backends are updated over time.
+func NewHandler(log logging.Logger, allowedOrigins []string, backends func() map[string]string) *Handler {
+	h := &Handler{
+		log:      log,
+		router:   http.NewServeMux(),
+		backends: backends,
+	}
+
+	h.router.HandleFunc("GET "+inference.InferencePrefix+APIPath, h.handleGetVersion)
+
+	h.httpHandler = middleware.CorsMiddleware(allowedOrigins, h.router)
+
+	return h
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.httpHandler.ServeHTTP(w, r)
+}
+
+// handleGetVersion handles GET <inference-prefix>/version requests.
+func (h *Handler) handleGetVersion(w http.ResponseWriter, _ *http.Request) {
+	info := Build()
+	info.Backends = h.backends()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		h.log.Warnln("Error while encoding version response:", err)
+	}
+}
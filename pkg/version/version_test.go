@@ -0,0 +1,37 @@
+package version
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBackendVersion(t *testing.T) {
+	for status, expected := range map[string]string{
+		"running llama.cpp latest-cpu (sha256:1234) version: 4a5b6c7": "4a5b6c7",
+		"running llama.cpp version: 4a5b6c7":                          "4a5b6c7",
+		"running vllm version: 0.9.1\n":                               "0.9.1",
+		"running MLX version: unknown":                                "",
+		"installing":                                                  "",
+		"not installed":                                               "",
+		"failed to install llama.cpp: version: 1":                     "",
+	} {
+		if got := BackendVersion(status); got != expected {
+			t.Errorf("Expected version %q for status %q, got %q", expected, status, got)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Middleware(http.NotFoundHandler()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	for header, expected := range map[string]string{
+		ServerVersionHeader:        Version,
+		APIRevisionHeader:          "1",
+		MinimumClientVersionHeader: MinimumClientVersion,
+	} {
+		if got := recorder.Header().Get(header); got != expected {
+			t.Errorf("Expected header %s to be %q, got %q", header, expected, got)
+		}
+	}
+}